@@ -1,16 +0,0 @@
-module asql
-
-go 1.23.0
-
-require (
-	github.com/briandowns/spinner v1.23.1
-	github.com/chzyer/readline v1.5.1
-)
-
-require (
-	github.com/fatih/color v1.7.0 // indirect
-	github.com/mattn/go-colorable v0.1.2 // indirect
-	github.com/mattn/go-isatty v0.0.8 // indirect
-	golang.org/x/sys v0.23.0 // indirect
-	golang.org/x/term v0.23.0 // indirect
-)
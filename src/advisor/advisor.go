@@ -0,0 +1,247 @@
+// Package advisor
+// AriaSQL index advisor package
+// Copyright (C) AriaSQL
+// Author(s): Alex Gaetano Padula
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+package advisor
+
+import (
+	"ariasql/catalog"
+	"ariasql/parser"
+	"ariasql/statements"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Advice is an index recommended on a column of a table
+type Advice struct {
+	Table      string        // Table of the column
+	Column     string        // Column to index
+	ForeignKey bool          // The column is a foreign key
+	Statements int           // Statements filtering by the column
+	Calls      int64         // Executions of those statements
+	Total      time.Duration // Time spent executing them
+	Saving     time.Duration // Estimated time an index would have saved them
+	Rows       int64         // Rows of the table
+}
+
+// Statement returns the statement creating the index
+func (a *Advice) Statement() string {
+	return fmt.Sprintf("CREATE INDEX %s_%s ON %s (%s);", a.Table, a.Column, a.Table, a.Column)
+}
+
+// Advise recommends indexes on the tables of a database from the statements executed within it
+// Columns which statements compare to values and no visible index has are recommended, as are foreign key columns
+// without a visible index.  A statement reading few of the rows of a table would have been saved most of its time,
+// its time is credited to every column it filters by as any one of them could be indexed.
+func Advise(db *catalog.Database, stats []statements.Stat) []*Advice {
+	advice := make(map[[2]string]*Advice)
+
+	// Tables are named as in the database, the name of a table is its alias while a query reads it
+	get := func(tbl *catalog.Table, table, column string) *Advice {
+		k := [2]string{table, column}
+		if advice[k] == nil {
+			advice[k] = &Advice{Table: table, Column: column, Rows: tbl.Rows.Count()}
+		}
+
+		return advice[k]
+	}
+
+	for _, stat := range stats {
+		if stat.Database != db.Name || stat.Calls == stat.Errors {
+			continue
+		}
+
+		for _, col := range filtered(db, stat.Query) {
+			tbl := db.GetTable(col[0])
+			if tbl == nil || indexed(tbl, col[1]) {
+				continue
+			}
+
+			a := get(tbl, col[0], col[1])
+			a.Statements++
+			a.Calls += stat.Calls
+			a.Total += stat.Total
+			a.Saving += saving(stat, a.Rows)
+		}
+	}
+
+	for _, name := range db.GetTables() {
+		tbl := db.GetTable(name)
+		if tbl == nil {
+			continue
+		}
+
+		for column, colDef := range tbl.TableSchema.ColumnDefinitions {
+			if colDef.References != nil && !indexed(tbl, column) {
+				get(tbl, name, column).ForeignKey = true
+			}
+		}
+	}
+
+	result := make([]*Advice, 0, len(advice))
+	for _, a := range advice {
+		result = append(result, a)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Saving != result[j].Saving {
+			return result[i].Saving > result[j].Saving
+		}
+
+		if result[i].Table != result[j].Table {
+			return result[i].Table < result[j].Table
+		}
+
+		return result[i].Column < result[j].Column
+	})
+
+	return result
+}
+
+// indexed returns true if a visible index has the column
+func indexed(tbl *catalog.Table, column string) bool {
+	return tbl.VisibleIndexedColumn(column, false) != nil || tbl.VisibleIndexedColumn(column, true) != nil
+}
+
+// saving estimates the time an index would have saved the executions of a statement on a table of rows
+// Without an index every row is read, with one about as many as the statement returned or changed
+func saving(stat statements.Stat, rows int64) time.Duration {
+	calls := stat.Calls - stat.Errors
+	if rows <= 0 || calls <= 0 {
+		return 0
+	}
+
+	read := float64(stat.Rows) / float64(calls)
+	if read >= float64(rows) {
+		return 0
+	}
+
+	return time.Duration(float64(stat.Total) * (1 - read/float64(rows)))
+}
+
+// filtered returns the table and column pairs a normalized statement compares to values
+// SELECT, UPDATE and DELETE statements are parsed with their literals as 0, other statements filter nothing
+func filtered(db *catalog.Database, normalized string) [][2]string {
+	query := strings.ReplaceAll(normalized, "(...)", "(0)")
+	query = strings.ReplaceAll(query, "?", "0") + ";"
+
+	stmt, err := parser.NewParser(parser.NewLexer([]byte(query))).Parse()
+	if err != nil {
+		return nil
+	}
+
+	var tables []*parser.Table
+	var where *parser.WhereClause
+
+	switch s := stmt.(type) {
+	case *parser.SelectStmt:
+		if s.TableExpression == nil || s.TableExpression.FromClause == nil {
+			return nil
+		}
+
+		tables, where = s.TableExpression.FromClause.Tables, s.TableExpression.WhereClause
+	case *parser.UpdateStmt:
+		tables, where = []*parser.Table{{Name: s.TableName}}, s.WhereClause
+	case *parser.DeleteStmt:
+		tables, where = []*parser.Table{{Name: s.TableName}}, s.WhereClause
+	}
+
+	if where == nil {
+		return nil
+	}
+
+	// Tables by the name or alias columns are qualified with
+	names := make(map[string]string)
+	for _, t := range tables {
+		if t.Args != nil || t.Name == nil {
+			continue
+		}
+
+		names[t.Name.Value] = t.Name.Value
+		if t.Alias != nil {
+			names[t.Alias.Value] = t.Name.Value
+		}
+	}
+
+	var columns [][2]string
+	seen := make(map[[2]string]bool)
+
+	add := func(expr *parser.ValueExpression) {
+		if expr == nil {
+			return
+		}
+
+		col, ok := expr.Value.(*parser.ColumnSpecification)
+		if !ok || col.ColumnName == nil {
+			return
+		}
+
+		table := ""
+
+		if col.TableName != nil {
+			table = names[col.TableName.Value]
+		} else {
+			// An unqualified column is of the table which has it
+			for _, t := range tables {
+				if t.Args != nil || t.Name == nil {
+					continue
+				}
+
+				if tbl := db.GetTable(t.Name.Value); tbl != nil {
+					if _, ok := tbl.TableSchema.ColumnDefinitions[col.ColumnName.Value]; ok {
+						table = t.Name.Value
+						break
+					}
+				}
+			}
+		}
+
+		k := [2]string{table, col.ColumnName.Value}
+		if table != "" && !seen[k] {
+			seen[k] = true
+			columns = append(columns, k)
+		}
+	}
+
+	var walk func(cond interface{})
+	walk = func(cond interface{}) {
+		switch cond := cond.(type) {
+		case *parser.LogicalCondition:
+			walk(cond.Left)
+			walk(cond.Right)
+		case *parser.ComparisonPredicate:
+			if cond.Left == nil || cond.Right == nil {
+				return
+			}
+
+			if _, ok := cond.Right.Value.(*parser.Literal); ok {
+				add(cond.Left)
+			} else if _, ok := cond.Left.Value.(*parser.Literal); ok {
+				add(cond.Right)
+			}
+		case *parser.InPredicate:
+			add(cond.Left)
+		case *parser.BetweenPredicate:
+			add(cond.Left)
+		}
+	}
+
+	walk(where.SearchCondition)
+
+	return columns
+}
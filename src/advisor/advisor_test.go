@@ -0,0 +1,127 @@
+// Package advisor tests
+// Copyright (C) AriaSQL
+// Author(s): Alex Gaetano Padula
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+package advisor
+
+import (
+	"ariasql/catalog"
+	"ariasql/statements"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestAdvise(t *testing.T) {
+	defer os.RemoveAll("./test/")
+
+	c := catalog.New("./test/")
+	err := c.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer c.Close()
+
+	err = c.CreateDatabase("shop")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db := c.GetDatabase("shop")
+
+	err = db.CreateTable("customers", &catalog.TableSchema{
+		ColumnDefinitions: map[string]*catalog.ColumnDefinition{"customer_id": {DataType: "INT", Unique: true, NotNull: true}},
+	}, false, false, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = db.CreateTable("orders", &catalog.TableSchema{
+		ColumnDefinitions: map[string]*catalog.ColumnDefinition{
+			"order_id":    {DataType: "INT", Unique: true, NotNull: true},
+			"customer_id": {DataType: "INT", References: &catalog.Reference{TableName: "customers", ColumnName: "customer_id"}},
+			"status":      {DataType: "CHAR", Length: 16},
+		},
+	}, false, false, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, _, err = db.GetTable("customers").Insert([]map[string]interface{}{{"customer_id": 1}}, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	orders := db.GetTable("orders")
+
+	rows := make([]map[string]interface{}, 0, 100)
+	for i := 0; i < 100; i++ {
+		rows = append(rows, map[string]interface{}{"order_id": i, "customer_id": 1, "status": "open"})
+	}
+
+	_, _, err = orders.Insert(rows, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The foreign key index created with the table is dropped
+	err = orders.DropIndex(catalog.FOREIGN_KEY_INDEX_PREFIX + "customer_id")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stats := statements.New(0)
+	for i := 0; i < 10; i++ {
+		stats.Record([]byte("SELECT * FROM orders o WHERE o.status = 'shipped' AND order_id > 5;"), "shop", "admin", 10*time.Millisecond, 1, nil)
+	}
+
+	stats.Record([]byte("DELETE FROM orders WHERE status IN ('lost', 'void');"), "shop", "admin", 5*time.Millisecond, 50, nil)
+	stats.Record([]byte("SELECT * FROM orders WHERE status = 'open';"), "other", "admin", time.Second, 1, nil)
+
+	advice := Advise(db, stats.Stats())
+	if len(advice) != 2 {
+		t.Fatalf("expected advice on status and customer_id, got %d", len(advice))
+	}
+
+	status := advice[0]
+	if status.Table != "orders" || status.Column != "status" || status.ForeignKey || status.Statements != 2 || status.Calls != 11 || status.Rows != 100 {
+		t.Fatalf("unexpected advice %+v", status)
+	}
+
+	// 99 of 100 rows are saved reading 10 times for 10ms, half of the rows deleting for 5ms
+	if status.Total != 105*time.Millisecond || status.Saving != 99*time.Millisecond+2500*time.Microsecond {
+		t.Fatalf("unexpected times %s %s", status.Total, status.Saving)
+	}
+
+	if status.Statement() != "CREATE INDEX orders_status ON orders (status);" {
+		t.Fatalf("unexpected statement %s", status.Statement())
+	}
+
+	if advice[1].Column != "customer_id" || !advice[1].ForeignKey || advice[1].Statements != 0 {
+		t.Fatalf("expected advice on the foreign key, got %+v", advice[1])
+	}
+
+	// Indexed columns are not recommended
+	err = orders.CreateIndex("orders_status", []string{"status"}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	advice = Advise(db, stats.Stats())
+	if len(advice) != 1 || advice[0].Column != "customer_id" {
+		t.Fatalf("expected advice on the foreign key only, got %d", len(advice))
+	}
+}
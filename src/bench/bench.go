@@ -0,0 +1,726 @@
+// Package bench
+// AriaSQL benchmark package
+// Copyright (C) AriaSQL
+// Author(s): Alex Gaetano Padula
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+package bench
+
+import (
+	"ariasql/catalog"
+	"ariasql/core"
+	"ariasql/dsn"
+	"ariasql/executor"
+	"ariasql/parser"
+	"ariasql/storage"
+	"bytes"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const DATABASE = "ariabench"        // Database the workloads run in, dropped and created on every run
+const LOAD_BATCH_SIZE = 500         // Rows inserted per statement when loading workload data
+const BRANCH_ACCOUNTS = 10000       // Accounts per branch of the tpcb workload, scaled down from TPC-B's 100000
+const BRANCH_TELLERS = 10           // Tellers per branch of the tpcb workload
+const KV_ROWS = 10000               // Keys per scale of the kv workload
+const SCAN_ROWS = 10000             // Rows per scale of the scan workload
+const SCAN_GROUPS = 100             // Distinct groups of the scan workload
+const READ_BUFFER_SIZE = 1024 * 256 // Buffer size for reading server responses
+
+// Session executes statements for one client of a benchmark
+type Session interface {
+	Execute(stmt string) ([]byte, error) // Executes a statement and returns its result set
+	Close() error                        // Closes the session
+}
+
+// Target is the AriaSQL instance a benchmark runs against
+type Target interface {
+	Open() (Session, error)            // Opens a session
+	IOStats() (storage.IOStats, error) // Returns the IO counters of the instance
+	Close() error                      // Closes the target
+}
+
+// Options are the options of a benchmark run
+type Options struct {
+	Clients   int           // Concurrent sessions
+	Duration  time.Duration // How long operations are run for
+	Scale     int           // Multiplies the rows loaded by a workload
+	BatchSize int           // Rows inserted per operation by the load workload
+	ReadRatio float64       // Share of reads of the kv workload, 0 to 1
+}
+
+// Workload is a standard benchmark workload
+type Workload struct {
+	Name        string                                                                  // Workload name
+	Description string                                                                  // What the workload measures
+	Unit        func(options *Options) string                                           // What one operation is
+	Setup       func(session Session, options *Options) error                           // Creates and loads the tables of the workload
+	Run         func(session Session, options *Options, rng *rand.Rand, op int64) error // Runs one operation, op is the sequence number of the operation across clients
+}
+
+// Report is the result of a benchmark run
+type Report struct {
+	Workload   string          `json:"workload"`    // Workload name
+	Target     string          `json:"target"`      // Server address or embedded data directory
+	Unit       string          `json:"unit"`        // What one operation is
+	Clients    int             `json:"clients"`     // Concurrent sessions
+	Scale      int             `json:"scale"`       // Scale the workload was loaded at
+	Duration   time.Duration   `json:"duration_ns"` // Time operations ran for
+	Operations int64           `json:"operations"`  // Successful operations
+	Errors     int64           `json:"errors"`      // Failed operations
+	Throughput float64         `json:"throughput"`  // Successful operations per second
+	Latency    *Latency        `json:"latency"`     // Latency of successful operations
+	IO         storage.IOStats `json:"io"`          // IO performed while operations ran, excluding setup
+}
+
+// Latency are latency statistics of the operations of a run
+type Latency struct {
+	Mean time.Duration `json:"mean_ns"`
+	P50  time.Duration `json:"p50_ns"`
+	P90  time.Duration `json:"p90_ns"`
+	P95  time.Duration `json:"p95_ns"`
+	P99  time.Duration `json:"p99_ns"`
+	Max  time.Duration `json:"max_ns"`
+}
+
+// Workloads are the available workloads by name
+var Workloads = map[string]*Workload{
+	"tpcb": {
+		Name:        "tpcb",
+		Description: "TPC-B-like transactions updating an account, teller and branch balance and appending to history",
+		Unit:        func(options *Options) string { return "transactions" },
+		Setup:       setupTPCB,
+		Run:         runTPCB,
+	},
+	"kv": {
+		Name:        "kv",
+		Description: "Key-value point reads and updates by unique key",
+		Unit:        func(options *Options) string { return "requests" },
+		Setup:       setupKV,
+		Run:         runKV,
+	},
+	"load": {
+		Name:        "load",
+		Description: "Bulk load of multi-row inserts into an indexed table",
+		Unit:        func(options *Options) string { return fmt.Sprintf("batches of %d rows", options.BatchSize) },
+		Setup:       setupLoad,
+		Run:         runLoad,
+	},
+	"scan": {
+		Name:        "scan",
+		Description: "Analytic aggregates over full table scans",
+		Unit:        func(options *Options) string { return "queries" },
+		Setup:       setupScan,
+		Run:         runScan,
+	},
+}
+
+// Run runs a workload against a target
+// The benchmark database is created and loaded first, then every client runs operations until the duration has passed
+func Run(target Target, name string, options *Options) (*Report, error) {
+	workload, ok := Workloads[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown workload %s", name)
+	}
+
+	if options.Clients < 1 || options.Scale < 1 || options.BatchSize < 1 {
+		return nil, errors.New("clients, scale and batch size must be at least 1")
+	}
+
+	if options.ReadRatio < 0 || options.ReadRatio > 1 {
+		return nil, errors.New("read ratio must be between 0 and 1")
+	}
+
+	setup, err := target.Open()
+	if err != nil {
+		return nil, err
+	}
+
+	// The database may not exist yet
+	setup.Execute("DROP DATABASE " + DATABASE + ";")
+
+	for _, stmt := range []string{"CREATE DATABASE " + DATABASE + ";", "USE " + DATABASE + ";"} {
+		_, err = setup.Execute(stmt)
+		if err != nil {
+			setup.Close()
+			return nil, err
+		}
+	}
+
+	err = workload.Setup(setup, options)
+	setup.Close()
+	if err != nil {
+		return nil, fmt.Errorf("setup: %s", err.Error())
+	}
+
+	sessions := make([]Session, options.Clients)
+
+	defer func() {
+		for _, session := range sessions {
+			if session != nil {
+				session.Close()
+			}
+		}
+	}()
+
+	for i := range sessions {
+		sessions[i], err = target.Open()
+		if err != nil {
+			return nil, err
+		}
+
+		_, err = sessions[i].Execute("USE " + DATABASE + ";")
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	before, err := target.IOStats()
+	if err != nil {
+		return nil, err
+	}
+
+	var seq, failed atomic.Int64
+
+	latencies := make([][]time.Duration, options.Clients)
+	wg := &sync.WaitGroup{}
+
+	start := time.Now()
+	deadline := start.Add(options.Duration)
+
+	for i, session := range sessions {
+		wg.Add(1)
+		go func(i int, session Session) {
+			defer wg.Done()
+
+			rng := rand.New(rand.NewSource(int64(i) + start.UnixNano()))
+
+			for time.Now().Before(deadline) {
+				opStart := time.Now()
+
+				err := workload.Run(session, options, rng, seq.Add(1)-1)
+				if err != nil {
+					failed.Add(1)
+					continue
+				}
+
+				latencies[i] = append(latencies[i], time.Since(opStart))
+			}
+		}(i, session)
+	}
+
+	wg.Wait()
+
+	elapsed := time.Since(start)
+
+	after, err := target.IOStats()
+	if err != nil {
+		return nil, err
+	}
+
+	all := make([]time.Duration, 0)
+	for _, l := range latencies {
+		all = append(all, l...)
+	}
+
+	return &Report{
+		Workload:   workload.Name,
+		Unit:       workload.Unit(options),
+		Clients:    options.Clients,
+		Scale:      options.Scale,
+		Duration:   elapsed,
+		Operations: int64(len(all)),
+		Errors:     failed.Load(),
+		Throughput: float64(len(all)) / elapsed.Seconds(),
+		Latency:    latency(all),
+		IO:         after.Sub(before),
+	}, nil
+}
+
+// String formats a report for the terminal
+func (r *Report) String() string {
+	return fmt.Sprintf(`workload    %s
+target      %s
+clients     %d
+scale       %d
+duration    %s
+operations  %d %s, %d errors
+throughput  %.2f %s per second
+latency     mean %s, p50 %s, p90 %s, p95 %s, p99 %s, max %s
+io          %d reads (%d bytes), %d writes (%d bytes), %d syncs
+`,
+		r.Workload, r.Target, r.Clients, r.Scale, r.Duration.Round(time.Millisecond), r.Operations, r.Unit, r.Errors, r.Throughput, r.Unit,
+		r.Latency.Mean.Round(time.Microsecond), r.Latency.P50.Round(time.Microsecond), r.Latency.P90.Round(time.Microsecond),
+		r.Latency.P95.Round(time.Microsecond), r.Latency.P99.Round(time.Microsecond), r.Latency.Max.Round(time.Microsecond),
+		r.IO.Reads, r.IO.BytesRead, r.IO.Writes, r.IO.BytesWritten, r.IO.Syncs)
+}
+
+// latency returns the latency statistics of operation durations
+func latency(durations []time.Duration) *Latency {
+	l := &Latency{}
+
+	if len(durations) == 0 {
+		return l
+	}
+
+	sort.Slice(durations, func(i, j int) bool { return durations[i] < durations[j] })
+
+	var total time.Duration
+	for _, d := range durations {
+		total += d
+	}
+
+	l.Mean = total / time.Duration(len(durations))
+	l.P50 = percentile(durations, 50)
+	l.P90 = percentile(durations, 90)
+	l.P95 = percentile(durations, 95)
+	l.P99 = percentile(durations, 99)
+	l.Max = durations[len(durations)-1]
+
+	return l
+}
+
+// percentile returns the nearest rank percentile of sorted durations
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+
+	return sorted[rank-1]
+}
+
+// load inserts rows in batches, row returns the values of row i
+func load(session Session, table string, columns string, rows int, row func(i int) string) error {
+	for i := 0; i < rows; i += LOAD_BATCH_SIZE {
+		values := make([]string, 0, LOAD_BATCH_SIZE)
+
+		for j := i; j < rows && j < i+LOAD_BATCH_SIZE; j++ {
+			values = append(values, "("+row(j)+")")
+		}
+
+		_, err := session.Execute(fmt.Sprintf("INSERT INTO %s (%s) VALUES %s;", table, columns, strings.Join(values, ", ")))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// execute executes statements in order, stopping at the first error
+func execute(session Session, stmts ...string) error {
+	for _, stmt := range stmts {
+		_, err := session.Execute(stmt)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// setupTPCB creates and loads the branches, tellers, accounts and history tables
+func setupTPCB(session Session, options *Options) error {
+	err := execute(session,
+		"CREATE TABLE branches (bid INT NOT NULL UNIQUE, bbalance INT, filler CHAR(88));",
+		"CREATE TABLE tellers (tid INT NOT NULL UNIQUE, bid INT, tbalance INT, filler CHAR(84));",
+		"CREATE TABLE accounts (aid INT NOT NULL UNIQUE, bid INT, abalance INT, filler CHAR(84));",
+		"CREATE TABLE history (tid INT, bid INT, aid INT, delta INT, mtime DATETIME DEFAULT SYS_DATETIME, filler CHAR(22));",
+	)
+	if err != nil {
+		return err
+	}
+
+	err = load(session, "branches", "bid, bbalance, filler", options.Scale, func(i int) string {
+		return fmt.Sprintf("%d, 0, 'branch'", i+1)
+	})
+	if err != nil {
+		return err
+	}
+
+	err = load(session, "tellers", "tid, bid, tbalance, filler", options.Scale*BRANCH_TELLERS, func(i int) string {
+		return fmt.Sprintf("%d, %d, 0, 'teller'", i+1, i/BRANCH_TELLERS+1)
+	})
+	if err != nil {
+		return err
+	}
+
+	return load(session, "accounts", "aid, bid, abalance, filler", options.Scale*BRANCH_ACCOUNTS, func(i int) string {
+		return fmt.Sprintf("%d, %d, 0, 'account'", i+1, i/BRANCH_ACCOUNTS+1)
+	})
+}
+
+// runTPCB runs a TPC-B-like transaction
+// Deltas are deposits as negative literals can not be inserted, the account balance is read after the commit as SELECT is not allowed within a transaction
+func runTPCB(session Session, options *Options, rng *rand.Rand, op int64) error {
+	aid := rng.Intn(options.Scale*BRANCH_ACCOUNTS) + 1
+	tid := rng.Intn(options.Scale*BRANCH_TELLERS) + 1
+	bid := (tid-1)/BRANCH_TELLERS + 1
+	delta := rng.Intn(5000) + 1
+
+	err := execute(session,
+		"BEGIN;",
+		fmt.Sprintf("UPDATE accounts SET abalance = abalance + %d WHERE aid = %d;", delta, aid),
+		fmt.Sprintf("UPDATE tellers SET tbalance = tbalance + %d WHERE tid = %d;", delta, tid),
+		fmt.Sprintf("UPDATE branches SET bbalance = bbalance + %d WHERE bid = %d;", delta, bid),
+		fmt.Sprintf("INSERT INTO history (tid, bid, aid, delta, filler) VALUES (%d, %d, %d, %d, 'history');", tid, bid, aid, delta),
+		"COMMIT;",
+	)
+	if err != nil {
+		session.Execute("ROLLBACK;")
+		return err
+	}
+
+	_, err = session.Execute(fmt.Sprintf("SELECT abalance FROM accounts WHERE aid = %d;", aid))
+	return err
+}
+
+// setupKV creates and loads the kv table
+func setupKV(session Session, options *Options) error {
+	_, err := session.Execute("CREATE TABLE kv (k INT NOT NULL UNIQUE, v CHAR(100));")
+	if err != nil {
+		return err
+	}
+
+	return load(session, "kv", "k, v", options.Scale*KV_ROWS, func(i int) string {
+		return fmt.Sprintf("%d, 'value %d'", i+1, i+1)
+	})
+}
+
+// runKV reads or updates the value of a random key
+func runKV(session Session, options *Options, rng *rand.Rand, op int64) error {
+	k := rng.Intn(options.Scale*KV_ROWS) + 1
+
+	if rng.Float64() < options.ReadRatio {
+		_, err := session.Execute(fmt.Sprintf("SELECT v FROM kv WHERE k = %d;", k))
+		return err
+	}
+
+	_, err := session.Execute(fmt.Sprintf("UPDATE kv SET v = 'value %d' WHERE k = %d;", rng.Int63(), k))
+	return err
+}
+
+// setupLoad creates the bulk table
+func setupLoad(session Session, options *Options) error {
+	_, err := session.Execute("CREATE TABLE bulk (id INT NOT NULL UNIQUE, name CHAR(32), amount INT);")
+	return err
+}
+
+// runLoad inserts a batch of rows, batches of all clients have distinct ids
+func runLoad(session Session, options *Options, rng *rand.Rand, op int64) error {
+	values := make([]string, options.BatchSize)
+
+	for i := range values {
+		id := op*int64(options.BatchSize) + int64(i) + 1
+		values[i] = fmt.Sprintf("(%d, 'row %d', %d)", id, id, rng.Intn(100000))
+	}
+
+	_, err := session.Execute("INSERT INTO bulk (id, name, amount) VALUES " + strings.Join(values, ", ") + ";")
+	return err
+}
+
+// setupScan creates and loads the facts table
+func setupScan(session Session, options *Options) error {
+	_, err := session.Execute("CREATE TABLE facts (id INT NOT NULL UNIQUE, grp INT, amount INT);")
+	if err != nil {
+		return err
+	}
+
+	rng := rand.New(rand.NewSource(1))
+
+	return load(session, "facts", "id, grp, amount", options.Scale*SCAN_ROWS, func(i int) string {
+		return fmt.Sprintf("%d, %d, %d", i+1, i%SCAN_GROUPS, rng.Intn(100000))
+	})
+}
+
+// runScan runs an aggregate over a full scan of the facts table
+func runScan(session Session, options *Options, rng *rand.Rand, op int64) error {
+	var query string
+
+	switch op % 3 {
+	case 0:
+		query = fmt.Sprintf("SELECT SUM(amount) FROM facts WHERE grp = %d;", rng.Intn(SCAN_GROUPS))
+	case 1:
+		query = fmt.Sprintf("SELECT COUNT(*) FROM facts WHERE amount > %d;", rng.Intn(100000))
+	default:
+		low := rng.Intn(SCAN_GROUPS)
+		query = fmt.Sprintf("SELECT MAX(amount) FROM facts WHERE grp BETWEEN %d AND %d;", low, low+SCAN_GROUPS/10)
+	}
+
+	_, err := session.Execute(query)
+	return err
+}
+
+// Embedded is an AriaSQL instance opened within the benchmark process
+type Embedded struct {
+	aria *core.AriaSQL // AriaSQL instance
+}
+
+// embeddedSession is a channel of an embedded instance
+type embeddedSession struct {
+	aria    *core.AriaSQL      // AriaSQL instance
+	channel *core.Channel      // Channel of the session
+	ex      *executor.Executor // Executor of the channel
+}
+
+// NewEmbedded opens an embedded instance on a data directory, sessions are of the admin user
+func NewEmbedded(dataDir string) (*Embedded, error) {
+	aria, err := core.New(&core.Config{DataDir: dataDir})
+	if err != nil {
+		return nil, err
+	}
+
+	aria.Catalog = catalog.New(aria.Config.DataDir)
+
+	err = aria.Catalog.Open()
+	if err != nil {
+		return nil, err
+	}
+
+	aria.Channels = make([]*core.Channel, 0)
+	aria.ChannelsLock = &sync.Mutex{}
+
+	return &Embedded{aria: aria}, nil
+}
+
+// Open opens a session
+func (e *Embedded) Open() (Session, error) {
+	user := e.aria.Catalog.GetUser("admin")
+	if user == nil {
+		return nil, errors.New("admin user does not exist")
+	}
+
+	channel := e.aria.OpenChannel(user)
+
+	return &embeddedSession{aria: e.aria, channel: channel, ex: executor.New(e.aria, channel)}, nil
+}
+
+// IOStats returns the IO counters of the process
+func (e *Embedded) IOStats() (storage.IOStats, error) {
+	return storage.Stats(), nil
+}
+
+// Close closes the instance
+func (e *Embedded) Close() error {
+	return e.aria.Close()
+}
+
+// Execute executes a statement
+func (s *embeddedSession) Execute(stmt string) ([]byte, error) {
+	p := parser.NewParser(parser.NewLexer([]byte(stmt)))
+
+	ast, err := p.Parse()
+	if err != nil {
+		return nil, err
+	}
+
+	defer s.ex.Clear()
+
+	err = s.ex.Execute(ast)
+	if err != nil {
+		return nil, err
+	}
+
+	return append([]byte{}, s.ex.GetResultSet()...), nil
+}
+
+// Close closes the session
+func (s *embeddedSession) Close() error {
+	return s.aria.CloseChannel(s.channel)
+}
+
+// Remote is an AriaSQL server
+type Remote struct {
+	Address  string   // Server address, host:port
+	Username string   // User to connect as
+	Password string   // Password of the user
+	DSN      *dsn.DSN // Connection string, connected with instead of the address and user if set
+}
+
+// remoteSession is a connection to a server
+type remoteSession struct {
+	conn net.Conn // Connection to the server
+	buf  []byte   // Read buffer
+}
+
+// Open connects to the server
+func (r *Remote) Open() (Session, error) {
+	d := r.DSN
+	if d == nil {
+		d = &dsn.DSN{Username: r.Username, Password: r.Password}
+	}
+
+	var conn net.Conn
+	var err error
+
+	if r.DSN != nil {
+		conn, err = d.Dial()
+	} else {
+		conn, err = net.Dial("tcp", r.Address)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	session := &remoteSession{conn: conn, buf: make([]byte, READ_BUFFER_SIZE)}
+
+	_, err = conn.Write([]byte(d.Auth()))
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	response, err := session.read()
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	if !bytes.HasPrefix(response, []byte("OK")) {
+		conn.Close()
+		return nil, errors.New(strings.TrimSpace(string(response)))
+	}
+
+	if d.Database != "" {
+		_, err = session.Execute("USE " + d.Database + ";")
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+
+	return session, nil
+}
+
+// IOStats returns the IO counters of the server, read with SHOW IO
+func (r *Remote) IOStats() (storage.IOStats, error) {
+	session, err := r.Open()
+	if err != nil {
+		return storage.IOStats{}, err
+	}
+
+	defer session.Close()
+
+	response, err := session.Execute("SHOW IO;")
+	if err != nil {
+		return storage.IOStats{}, err
+	}
+
+	row, err := parseTable(response)
+	if err != nil {
+		return storage.IOStats{}, err
+	}
+
+	stats := storage.IOStats{}
+
+	for column, counter := range map[string]*int64{
+		"Reads":        &stats.Reads,
+		"Writes":       &stats.Writes,
+		"BytesRead":    &stats.BytesRead,
+		"BytesWritten": &stats.BytesWritten,
+		"Syncs":        &stats.Syncs,
+	} {
+		*counter, err = strconv.ParseInt(row[column], 10, 64)
+		if err != nil {
+			return storage.IOStats{}, fmt.Errorf("SHOW IO column %s: %s", column, err.Error())
+		}
+	}
+
+	return stats, nil
+}
+
+// Close is a no-op, sessions are closed on their own
+func (r *Remote) Close() error {
+	return nil
+}
+
+// Execute sends a statement to the server and reads its response
+func (s *remoteSession) Execute(stmt string) ([]byte, error) {
+	_, err := s.conn.Write([]byte(stmt))
+	if err != nil {
+		return nil, err
+	}
+
+	response, err := s.read()
+	if err != nil {
+		return nil, err
+	}
+
+	if bytes.HasPrefix(response, []byte("ERR: ")) {
+		return nil, errors.New(strings.TrimSpace(string(response[5:])))
+	}
+
+	return response, nil
+}
+
+// read reads a response, responses end with a newline
+func (s *remoteSession) read() ([]byte, error) {
+	response := make([]byte, 0)
+
+	for len(response) == 0 || response[len(response)-1] != '\n' {
+		n, err := s.conn.Read(s.buf)
+		if err != nil {
+			return nil, err
+		}
+
+		response = append(response, s.buf[:n]...)
+	}
+
+	return response, nil
+}
+
+// Close closes the connection
+func (s *remoteSession) Close() error {
+	s.conn.Write([]byte("close"))
+	return s.conn.Close()
+}
+
+// parseTable returns the first row of a result set formatted as a table
+func parseTable(table []byte) (map[string]string, error) {
+	lines := make([][]string, 0)
+
+	for _, line := range strings.Split(string(table), "\n") {
+		if !strings.HasPrefix(line, "|") {
+			continue
+		}
+
+		cells := strings.Split(strings.Trim(line, "|"), "|")
+		for i := range cells {
+			cells[i] = strings.TrimSpace(cells[i])
+		}
+
+		lines = append(lines, cells)
+	}
+
+	if len(lines) < 2 || len(lines[0]) != len(lines[1]) {
+		return nil, errors.New("expected a result set")
+	}
+
+	row := make(map[string]string)
+	for i, column := range lines[0] {
+		row[column] = lines[1][i]
+	}
+
+	return row, nil
+}
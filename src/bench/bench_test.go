@@ -0,0 +1,161 @@
+// Package bench tests
+// Copyright (C) AriaSQL
+// Author(s): Alex Gaetano Padula
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+package bench
+
+import (
+	"ariasql/catalog"
+	"ariasql/core"
+	"ariasql/server"
+	"os"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRun(t *testing.T) {
+	defer os.RemoveAll("./test")
+
+	target, err := NewEmbedded("./test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer target.Close()
+
+	report, err := Run(target, "load", &Options{Clients: 1, Duration: 200 * time.Millisecond, Scale: 1, BatchSize: 10, ReadRatio: 0.9})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if report.Operations == 0 || report.Errors != 0 {
+		t.Fatalf("expected operations without errors, got %d operations and %d errors", report.Operations, report.Errors)
+	}
+
+	if report.Throughput <= 0 || report.Latency.P50 <= 0 || report.Latency.P50 > report.Latency.Max {
+		t.Fatalf("unexpected throughput %f or latency %+v", report.Throughput, report.Latency)
+	}
+
+	if report.IO.Writes == 0 {
+		t.Fatal("expected IO writes")
+	}
+
+	// Every batch inserted its own ids
+	session, err := target.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer session.Close()
+
+	err = execute(session, "USE "+DATABASE+";")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := session.Execute("SELECT COUNT(*) FROM bulk;")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	row, err := parseTable(result)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if row["COUNT"] != strconv.Itoa(int(report.Operations)*10) {
+		t.Fatalf("expected %d rows, got %v", report.Operations*10, row)
+	}
+
+	_, err = Run(target, "unknown", &Options{Clients: 1, Scale: 1, BatchSize: 1})
+	if err == nil {
+		t.Fatal("expected error for unknown workload")
+	}
+}
+
+func TestRun_Remote(t *testing.T) {
+	defer os.RemoveAll("./test")
+
+	aria, err := core.New(&core.Config{DataDir: "./test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	aria.Catalog = catalog.New(aria.Config.DataDir)
+	aria.Catalog.AdminPassword = "admin"
+
+	err = aria.Catalog.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer aria.Close()
+
+	aria.Channels = make([]*core.Channel, 0)
+	aria.ChannelsLock = &sync.Mutex{}
+
+	s, err := server.NewTCPServer(3697, "127.0.0.1", aria, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer s.Stop()
+
+	go s.Start()
+
+	target := &Remote{Address: "127.0.0.1:3697", Username: "admin", Password: "admin"}
+
+	report, err := Run(target, "load", &Options{Clients: 1, Duration: 200 * time.Millisecond, Scale: 1, BatchSize: 10, ReadRatio: 0.9})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if report.Operations == 0 || report.Errors != 0 {
+		t.Fatalf("expected operations without errors, got %d operations and %d errors", report.Operations, report.Errors)
+	}
+
+	if report.IO.Writes == 0 || report.IO.BytesWritten == 0 {
+		t.Fatalf("expected IO writes read with SHOW IO, got %+v", report.IO)
+	}
+
+	_, err = (&Remote{Address: "127.0.0.1:3697", Username: "admin", Password: "wrong"}).Open()
+	if err == nil {
+		t.Fatal("expected authentication error")
+	}
+}
+
+func TestLatency(t *testing.T) {
+	durations := make([]time.Duration, 0)
+	for i := 100; i > 0; i-- {
+		durations = append(durations, time.Duration(i)*time.Millisecond)
+	}
+
+	l := latency(durations)
+
+	expected := &Latency{
+		Mean: 50500 * time.Microsecond,
+		P50:  50 * time.Millisecond,
+		P90:  90 * time.Millisecond,
+		P95:  95 * time.Millisecond,
+		P99:  99 * time.Millisecond,
+		Max:  100 * time.Millisecond,
+	}
+
+	if *l != *expected {
+		t.Fatalf("expected %+v, got %+v", expected, l)
+	}
+}
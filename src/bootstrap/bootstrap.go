@@ -0,0 +1,187 @@
+// Package bootstrap
+// AriaSQL bootstrap package, initializing a new data directory from the environment for containers
+// Copyright (C) AriaSQL
+// Author(s): Alex Gaetano Padula
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+package bootstrap
+
+import (
+	"ariasql/catalog"
+	"ariasql/core"
+	"ariasql/executor"
+	"ariasql/parser"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const ROOT_PASSWORD_ENV = "ARIASQL_ROOT_PASSWORD"           // Password of the admin user created on a new data directory
+const ROOT_PASSWORD_FILE_ENV = "ARIASQL_ROOT_PASSWORD_FILE" // File holding the password of the admin user, such as a Docker secret
+const DATABASE_ENV = "ARIASQL_DATABASE"                     // Database created on a new data directory, in use by the init scripts
+const INIT_SCRIPTS_DIR_ENV = "ARIASQL_INIT_SCRIPTS_DIR"     // Directory of the SQL scripts run on a new data directory
+const SCRIPT_EXTENSION = ".sql"                             // Extension of the init scripts run, other files are skipped
+
+// Settings initialize a new data directory
+type Settings struct {
+	RootPassword string // Password of the admin user, the default if empty
+	Database     string // Database created, none if empty
+	ScriptsDir   string // Directory of the init scripts, none are run if empty
+}
+
+// FromEnv returns the settings of the environment, the root password is read from ARIASQL_ROOT_PASSWORD_FILE if set
+func FromEnv() (*Settings, error) {
+	settings := &Settings{
+		RootPassword: os.Getenv(ROOT_PASSWORD_ENV),
+		Database:     os.Getenv(DATABASE_ENV),
+		ScriptsDir:   os.Getenv(INIT_SCRIPTS_DIR_ENV),
+	}
+
+	if file := os.Getenv(ROOT_PASSWORD_FILE_ENV); file != "" {
+		if settings.RootPassword != "" {
+			return nil, fmt.Errorf("both %s and %s are set", ROOT_PASSWORD_ENV, ROOT_PASSWORD_FILE_ENV)
+		}
+
+		password, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+
+		// Secrets are often written with a trailing newline
+		settings.RootPassword = strings.TrimRight(string(password), "\r\n")
+		if settings.RootPassword == "" {
+			return nil, fmt.Errorf("%s is empty", file)
+		}
+	}
+
+	return settings, nil
+}
+
+// Run initializes a new data directory, the catalog must be open and have created the admin user
+// The database is created, then the init scripts are run in name order as the admin user with the database in use.
+// A statement which fails stops initialization, the data directory is not initialized again on the next start.
+func Run(aria *core.AriaSQL, settings *Settings) error {
+	if !aria.Catalog.Fresh {
+		return nil
+	}
+
+	scripts, err := Scripts(settings.ScriptsDir)
+	if err != nil {
+		return err
+	}
+
+	if settings.Database == "" && len(scripts) == 0 {
+		return nil
+	}
+
+	user := aria.Catalog.GetUser(catalog.DEFAULT_ADMIN_USER)
+	if user == nil {
+		return errors.New("admin user does not exist")
+	}
+
+	channel := aria.OpenChannel(user)
+	defer aria.CloseChannel(channel)
+
+	ex := executor.New(aria, channel)
+
+	if settings.Database != "" {
+		err = execute(ex, []byte("CREATE DATABASE "+settings.Database+";"))
+		if err != nil {
+			return fmt.Errorf("creating database %s: %s", settings.Database, err.Error())
+		}
+
+		log.Printf("bootstrap: database %s created", settings.Database)
+	}
+
+	for _, script := range scripts {
+		// Every script starts with the database created in use
+		channel.Database = nil
+		if settings.Database != "" {
+			channel.Database = aria.Catalog.GetDatabase(settings.Database)
+		}
+
+		err = runScript(ex, script)
+		if err != nil {
+			return fmt.Errorf("init script %s: %s", filepath.Base(script), err.Error())
+		}
+
+		log.Printf("bootstrap: init script %s run", filepath.Base(script))
+	}
+
+	return nil
+}
+
+// Scripts returns the init scripts of a directory in name order, none if dir is empty
+func Scripts(dir string) ([]string, error) {
+	if dir == "" {
+		return nil, nil
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	scripts := make([]string, 0, len(entries))
+
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.EqualFold(filepath.Ext(entry.Name()), SCRIPT_EXTENSION) {
+			continue
+		}
+
+		scripts = append(scripts, filepath.Join(dir, entry.Name()))
+	}
+
+	sort.Strings(scripts)
+
+	return scripts, nil
+}
+
+// runScript executes the statements of a script one at a time, the first which fails is returned with the statement number
+func runScript(ex *executor.Executor, script string) error {
+	data, err := os.ReadFile(script)
+	if err != nil {
+		return err
+	}
+
+	stmts, err := parser.Split(data)
+	if err != nil {
+		return err
+	}
+
+	for i, stmt := range stmts {
+		err = execute(ex, stmt)
+		if err != nil {
+			return fmt.Errorf("statement %d: %s", i+1, err.Error())
+		}
+	}
+
+	return nil
+}
+
+// execute parses and executes a statement
+func execute(ex *executor.Executor, stmt []byte) error {
+	ast, err := parser.NewParser(parser.NewLexer(stmt)).Parse()
+	if err != nil {
+		return err
+	}
+
+	defer ex.Clear()
+
+	return ex.Execute(ast)
+}
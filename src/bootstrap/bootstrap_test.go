@@ -0,0 +1,175 @@
+// Package bootstrap tests
+// Copyright (C) AriaSQL
+// Author(s): Alex Gaetano Padula
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+package bootstrap
+
+import (
+	"ariasql/catalog"
+	"ariasql/core"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// open opens an AriaSQL instance on a data directory, the admin user created with password on a new one
+func open(t *testing.T, dataDir, password string) *core.AriaSQL {
+	aria, err := core.New(&core.Config{DataDir: dataDir})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	aria.Catalog = catalog.New(aria.Config.DataDir)
+	aria.Catalog.AdminPassword = password
+
+	if err := aria.Catalog.Open(); err != nil {
+		t.Fatal(err)
+	}
+
+	aria.Channels = make([]*core.Channel, 0)
+	aria.ChannelsLock = &sync.Mutex{}
+
+	return aria
+}
+
+func TestRun(t *testing.T) {
+	defer os.RemoveAll("./test/")
+
+	scripts := t.TempDir()
+
+	for name, script := range map[string]string{
+		"01-schema.sql": "CREATE TABLE users (user_id INT NOT NULL UNIQUE SEQUENCE, email CHAR(255));\nCREATE INDEX users_email ON users (email);",
+		"02-data.sql":   "INSERT INTO users (email) VALUES ('alex@example.com');",
+		"readme.md":     "Not a script",
+	} {
+		err := os.WriteFile(filepath.Join(scripts, name), []byte(script), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	aria := open(t, "./test", "s3cret")
+
+	if !aria.Catalog.Fresh {
+		t.Fatal("expected a new data directory")
+	}
+
+	err := Run(aria, &Settings{RootPassword: "s3cret", Database: "shop", ScriptsDir: scripts})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The admin user has the password given, not the default
+	if _, err = aria.Catalog.AuthenticateUser(catalog.DEFAULT_ADMIN_USER, catalog.DEFAULT_ADMIN_PASSWORD); err == nil {
+		t.Fatal("expected the default password refused")
+	}
+
+	if _, err = aria.Catalog.AuthenticateUser(catalog.DEFAULT_ADMIN_USER, "s3cret"); err != nil {
+		t.Fatal(err)
+	}
+
+	db := aria.Catalog.GetDatabase("shop")
+	if db == nil || db.GetTable("users") == nil {
+		t.Fatal("expected the scripts run within the database created")
+	}
+
+	rows := make([]map[string]interface{}, 0)
+	for iter := db.GetTable("users").NewIterator(); iter.Valid(); {
+		row, err := iter.Next()
+		if err != nil {
+			break
+		}
+		rows = append(rows, row)
+	}
+
+	if len(rows) != 1 {
+		t.Fatalf("expected the row inserted by the second script, got %v", rows)
+	}
+
+	aria.Close()
+
+	// A data directory initialized before is left as is
+	aria = open(t, "./test", "changed")
+	defer aria.Close()
+
+	if aria.Catalog.Fresh {
+		t.Fatal("expected the data directory initialized before")
+	}
+
+	err = Run(aria, &Settings{RootPassword: "changed", Database: "other", ScriptsDir: scripts})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if aria.Catalog.GetDatabase("other") != nil {
+		t.Fatal("expected no database created on a data directory initialized before")
+	}
+
+	if _, err = aria.Catalog.AuthenticateUser(catalog.DEFAULT_ADMIN_USER, "s3cret"); err != nil {
+		t.Fatal("expected the password kept")
+	}
+}
+
+func TestRun_failing(t *testing.T) {
+	defer os.RemoveAll("./test/")
+
+	scripts := t.TempDir()
+
+	err := os.WriteFile(filepath.Join(scripts, "init.sql"), []byte("CREATE TABLE t (id INT);\nINSERT INTO missing (id) VALUES (1);"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	aria := open(t, "./test", "s3cret")
+	defer aria.Close()
+
+	err = Run(aria, &Settings{RootPassword: "s3cret", Database: "shop", ScriptsDir: scripts})
+	if err == nil || !strings.HasPrefix(err.Error(), "init script init.sql: statement 2:") {
+		t.Fatalf("expected the failing statement reported, got %v", err)
+	}
+}
+
+func TestFromEnv(t *testing.T) {
+	t.Setenv(ROOT_PASSWORD_ENV, "")
+	t.Setenv(DATABASE_ENV, "shop")
+	t.Setenv(INIT_SCRIPTS_DIR_ENV, "/docker-entrypoint-initdb.d")
+
+	secret := filepath.Join(t.TempDir(), "root_password")
+
+	err := os.WriteFile(secret, []byte("s3cret\n"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv(ROOT_PASSWORD_FILE_ENV, secret)
+
+	settings, err := FromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if settings.RootPassword != "s3cret" || settings.Database != "shop" || settings.ScriptsDir != "/docker-entrypoint-initdb.d" {
+		t.Fatalf("unexpected settings %+v", settings)
+	}
+
+	// The password is given once
+	t.Setenv(ROOT_PASSWORD_ENV, "other")
+
+	if _, err = FromEnv(); err == nil {
+		t.Fatal("expected an error with both the password and its file")
+	}
+}
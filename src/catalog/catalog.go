@@ -18,23 +18,41 @@
 package catalog
 
 import (
+	"ariasql/fault"
 	"ariasql/shared"
+	"ariasql/storage"
 	"ariasql/storage/btree"
+	"ariasql/wait"
 	"bytes"
+	"container/list"
+	"crypto/hmac"
+	"crypto/rand"
 	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
 	"encoding/gob"
 	"encoding/hex"
 	"errors"
 	"fmt"
 	"github.com/DataDog/zstd"
 	"github.com/google/uuid"
+	"golang.org/x/crypto/argon2"
 	"golang.org/x/crypto/chacha20"
+	"golang.org/x/crypto/chacha20poly1305"
+	"hash/fnv"
+	"io"
+	"log"
+	"maps"
+	"math"
 	"os"
+	"path/filepath"
 	"slices"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
 	"time"
+	"unicode/utf8"
 )
 
 const MAX_COLUMN_NAME_SIZE = 64 // Max 64 bytes for column name
@@ -57,21 +75,133 @@ const SYS_USERS_EXTENSION = ".usrs" // Users file extension
 
 const DB_PROC_EXTENSION = ".proc" // Procedure file extension
 
+const SYS_SHARDS_EXTENSION = ".shrd" // Shard map file extension
+
+const DB_MIGRATIONS_EXTENSION = ".migr" // Applied schema migrations file extension
+
+const DB_SETTINGS_EXTENSION = ".sets" // Database settings file extension
+
+const DB_TIERS_EXTENSION = ".tier" // Tiers of the tables not on the hot tier file extension
+
+const DB_WARM_EXTENSION = ".warm" // Tables read into the cache on startup file extension
+
+const TIER_HOT = "HOT"               // Tables within the data directory
+const TIER_COLD = "COLD"             // Tables within the cold directory, a secondary and usually cheaper and slower disk
+const TIER_MOVING_SUFFIX = ".moving" // Suffix of the directory a table is copied into while it is moved between tiers
+
+const FOREIGN_KEY_INDEX_PREFIX = "fk_" // Prefix of the name of the index created on a foreign key column
+
 // DB_SCHEMA_TABLE_SEQ_FILE_EXTENSION Table count file extension
 // The table count file is used to store the number of rows in a table
 // Used for sequence columns (there can only be one sequence column per table)
 // The sequence column is a column that auto increments based on the number of rows in the table
 const DB_SCHEMA_TABLE_SEQ_FILE_EXTENSION = ".seq" // Table seq file extension
 
+// DB_SCHEMA_TABLE_HISTORY_FILE_EXTENSION Table history file extension
+// The table history file keeps rows as they were before they were changed, for flashback queries
+const DB_SCHEMA_TABLE_HISTORY_FILE_EXTENSION = ".hist" // Table history file extension
+
+// DB_SCHEMA_TABLE_BLOOM_FILE_EXTENSION Bloom filter file extension
+// The bloom filter file holds the column of a bloom filter, its bits are kept next to it in a bits file
+const DB_SCHEMA_TABLE_BLOOM_FILE_EXTENSION = ".blm"       // Bloom filter file extension
+const DB_SCHEMA_TABLE_BLOOM_BITS_FILE_EXTENSION = ".bits" // Bloom filter bits file extension
+
+const BLOOM_SEGMENT_ROWS = 1024  // Rows of a table a bloom filter segment covers, equality scans skip whole segments
+const BLOOM_SEGMENT_BYTES = 1024 // Bits of a bloom filter segment, about 2% false positives with a distinct value per row
+const BLOOM_HASHES = 4           // Bits set within a segment per value
+
+const RUNTIME_FILTER_BITS_PER_KEY = 10 // Bits of a runtime filter per value, about 1% false positives
+const RUNTIME_FILTER_SEGMENT_KEYS = 64 // Values of a runtime filter up to which segments a bloom filter rules out every value of are skipped
+
+const CONSTRAINT_CHECK = "check"      // Suffix of the name of a CHECK constraint, table_column_check
+const CONSTRAINT_FOREIGN_KEY = "fkey" // Suffix of the name of a foreign key constraint, table_column_fkey
+
+const INDEX_BATCH_ROWS = 256 // Rows an insert writes before putting them into the table indexes, a batch at a time
+const INDEX_WORKERS = 8      // Indexes of a table a batch of rows is put into at once
+
+const HISTORY_PURGE_INTERVAL = 1000 // Versions written to a table history between purges of versions past the retention window
+
+// ENCRYPTED_INDEX_BUCKETS Amount of buckets indexed values of an encrypted table are spread across
+// Values are never stored in an index of an encrypted table, instead a keyed hash of the value picks a bucket.
+// Many values share a bucket so the index does not reveal which rows hold equal values, the cost is that
+// a lookup has to fetch and decrypt every row within the bucket.  Buckets are not ordered so range scans on
+// an encrypted table can not use an index and fall back to a full scan.
+const ENCRYPTED_INDEX_BUCKETS = 256
+
+// INDEX_NULL_KEY Key NULL is stored under within the table indexes
+// NULL is not a value so it is never encoded like one, the marker starts with a NUL byte no key of a value starts with.
+// A unique index holds any amount of rows under the marker, NULL is not equal to NULL
+const INDEX_NULL_KEY = "\x00NULL"
+
+// Index keys start with the type of the value, see EncodeKey.  Keys of a type sort together, in the order of their values
+const KEY_BOOL = 0x01   // false then true
+const KEY_NUMBER = 0x02 // Integers and floats as an order preserving float64, integers float64 cannot hold exactly followed by the integer
+const KEY_TIME = 0x03   // Unix nanoseconds
+const KEY_STRING = 0x04 // Bytes of the string
+const KEY_BYTES = 0x05  // Bytes of the binary
+const KEY_OTHER = 0x06  // Values of any other type formatted
+
+// DDL_JOURNAL_FILE_EXTENSION DDL journal entry file extension
+// A journal entry is written next to the database, table or index before its files are created or removed
+// and removed once done.  Entries left behind by a crash are resolved by Open, see RecoverDDLJournal
+const DDL_JOURNAL_FILE_EXTENSION = ".ddl"
+
+const LAYOUT_VERSION = 5                     // On-disk layout version of the data directory this build reads and writes
+const LAYOUT_VERSION_FILE = "layout.version" // Layout version file within the data directory
+const LOCK_FILE = "ariasql.lock"             // Lock file within the data directory, held while the catalog is open
+
+const BACKUP_MANIFEST_FILE = "manifest" // Manifest file within a backup, written last
+const BACKUP_DATA_DIRECTORY = "data"    // Copied files and pages within a backup
+
 // Catalog is the root of the database catalog
 type Catalog struct {
-	Databases     map[string]*Database // Databases is a map of database names to database objects
-	Directory     string               // Directory is the directory where database catalog data is stored
-	Users         map[string]*User     // Users is a map of user names to user objects
-	UsersFile     *os.File             // Users file
-	UsersFileLock *sync.Mutex          // Users file lock
-	UsersLock     *sync.Mutex          // Users lock
-	DatabasesLock *sync.Mutex          // Databases lock
+	Databases          map[string]*Database   // Databases is a map of database names to database objects
+	Directory          string                 // Directory is the directory where database catalog data is stored
+	Users              map[string]*User       // Users is a map of user names to user objects
+	UsersFile          *os.File               // Users file
+	UsersFileLock      *sync.Mutex            // Users file lock
+	UsersLock          *sync.Mutex            // Users lock
+	DatabasesLock      *sync.Mutex            // Databases lock
+	MaxOpenTables      int                    // Max amount of tables with open files, the files of least recently used tables are closed past it, 0 is no limit
+	AutoUpgrade        bool                   // Run layout migrations on Open instead of refusing an older data directory
+	FlashbackRetention time.Duration          // How long rows are kept after they are changed for AS OF queries, 0 disables flashback
+	openTables         *list.List             // Open tables, most recently used first
+	openTablesLock     *sync.Mutex            // Open tables lock
+	directoryLock      *storage.DirectoryLock // Exclusive lock on the catalog directory
+	Shards             map[string]*Shard      // Shard map of a coordinator, shard names to shards
+	ShardsLock         *sync.Mutex            // Shards lock
+	SafeMode           bool                   // Validate every table on Open and quarantine objects failing it instead of failing Open
+	Quarantined        []*Quarantine          // Objects quarantined by safe mode
+	QuarantinedLock    *sync.Mutex            // Quarantined lock
+	ColdDirectory      string                 // Directory of the cold tier, empty if there is none
+	AdminPassword      string                 // Password of the admin user created on a new data directory, generated if empty
+	Fresh              bool                   // Open created the admin user, the data directory is new
+	PasswordGenerated  bool                   // Open generated the password of the admin user into AdminPassword
+}
+
+const DEFAULT_ADMIN_USER = "admin"     // User created with every privilege on a new data directory
+const DEFAULT_ADMIN_PASSWORD = "admin" // Password of the admin user created by earlier versions, warned about while in use
+const GENERATED_PASSWORD_BYTES = 18    // Random bytes of a generated admin password, 24 characters once encoded
+
+const QUARANTINE_TABLE = "TABLE"           // A table failing validation
+const QUARANTINE_PROCEDURES = "PROCEDURES" // The procedures of a database whose procedures file does not decode
+const QUARANTINE_SETTINGS = "SETTINGS"     // The settings of a database whose settings file does not decode
+
+// Quarantine is an object cordoned off by safe mode as it failed validation on Open
+// A quarantined table cannot be used or created again until it is dropped, its files are left untouched for
+// inspection or repair with -check.  Quarantined procedures are not loaded and cannot be changed.
+type Quarantine struct {
+	Database string // Database of the object
+	Name     string // Table name, or the database name for its procedures and settings
+	Kind     string // QUARANTINE_TABLE, QUARANTINE_PROCEDURES or QUARANTINE_SETTINGS
+	Path     string // File or directory failing validation
+	Reason   string // Why validation failed
+}
+
+// Shard is an AriaSQL instance holding part of the data of sharded tables
+type Shard struct {
+	Name    string // Shard name
+	Address string // Server address of the shard, host:port
 }
 
 // Database is a database object
@@ -83,21 +213,66 @@ type Database struct {
 	Procedures         map[string]*Procedure // Procedures is a map of procedure names to procedure objects
 	ProceduresFile     *os.File              // Procedures file
 	ProceduresFileLock *sync.Mutex           // Procedures lock
+	MigrationsLock     *sync.Mutex           // Held while a schema migration is applied and recorded
+	Settings           *DatabaseSettings     // Defaults of the tables created in the database
+	catalog            *Catalog              // Catalog the database belongs to
+}
+
+// DatabaseSettings are the defaults of the tables created in a database, a table can override them
+// i.e CREATE DATABASE db1 WITH (compress = true, encrypt = true, collation = 'nocase');
+type DatabaseSettings struct {
+	Compress  bool   // New tables are compressed
+	Encrypt   bool   // New tables are encrypted, their key is given with ENCRYPT('key')
+	Collation string // Collation the string columns of new tables compare and order in, empty is binary
 }
 
 // Table is a table object
 type Table struct {
 	Name         string            // Name is the table name
 	Indexes      map[string]*Index // Indexes is a map of index names to index objects
+	Blooms       map[string]*Bloom // Blooms is a map of bloom filter names to bloom filters
 	Rows         *btree.Pager      // Rows is the btree pager for the table.  We use the pager to page our table data
 	TableSchema  *TableSchema      // TableSchema is the schema of the table
 	Directory    string            // Directory is the directory where table data is stored
-	SequenceFile *os.File          // Table sequence file
+	SequenceFile *storage.File     // Table sequence file
 	SeqLock      *sync.Mutex       // Sequence mutex
 	Compress     bool              // Compress is true if the table data is compressed
 	Encrypt      bool              // Encrypt is true if the table data is encrypted
 	HashedKey    [32]byte          // HashedKey is the hashed key used to encrypt the table data
 	Nonce        [12]byte          // Nonce is the nonce used to encrypt the table data
+	loaded       bool              // True if the table files are open
+	lruElement   *list.Element     // Element within the catalog open tables
+	retention    time.Duration     // How long changed rows are kept in the history, 0 keeps no history
+	history      *btree.Pager      // History file, opened on first use
+	historyLock  *sync.Mutex       // Serializes versions written to the history
+	lastVersion  int64             // Time of the version written last, versions are written in increasing time
+	versions     int               // Versions written since the history was last purged
+	Tier         string            // TIER_HOT or TIER_COLD, the tier the table files are on
+	accessed     time.Time         // When the table was last accessed, or the catalog opened if it was not since
+	Warm         bool              // The table and its indexes are read into the cache on startup, see WarmTables
+}
+
+// Version is a row as it was before it was changed, kept in the table history for flashback queries
+type Version struct {
+	Time   int64                  // Unix nanoseconds of the change
+	RowID  int64                  // Row changed, HISTORY_START for the version marking when the history started
+	Before map[string]interface{} // Row before the change, nil if the row was inserted
+}
+
+const HISTORY_START = -1 // Row id of the version marking when the history of a table started
+
+const SYSTEM_TIME_START = "system_time_start" // Column of a row version holding the time it became current
+const SYSTEM_TIME_END = "system_time_end"     // Column of a row version holding the time it was replaced
+
+// SchemaMigration is a migration applied to a database, see APPLY MIGRATION
+type SchemaMigration struct {
+	Version    int       // Migrations are numbered from 1 in the order they were applied
+	Name       string    // Migration name
+	File       string    // Migration file, relative to the migrations directory
+	Checksum   string    // SHA-256 of the migration file
+	Statements int       // Amount of statements applied
+	AppliedBy  string    // User who applied the migration
+	AppliedAt  time.Time // When the migration was applied
 }
 
 // Procedure is a procedure object
@@ -109,6 +284,11 @@ type Procedure struct {
 // TableSchema is the schema of a table
 type TableSchema struct {
 	ColumnDefinitions map[string]*ColumnDefinition // ColumnDefinitions is a map of column names to column definitions
+	Compress          bool                         // Compress is true if new rows are written compressed
+	ShardKey          string                       // Column rows are spread across shards by on a coordinator, empty if the table is not sharded
+	SystemVersioned   bool                         // SystemVersioned is true if every version of the rows is kept in the table history
+	NotValid          []string                     // NotValid are the names of constraints the existing rows were not validated against
+	Collation         string                       // Collation the string columns compare and order in unless COLLATE is given, empty is binary
 }
 
 // ColumnDefinition is a column definition
@@ -134,18 +314,31 @@ type Reference struct {
 
 // Index is an index object
 type Index struct {
-	Name    string       // Name is the index name
-	Columns []string     // Columns is a list of column names in the index
-	Unique  bool         // Unique is true if the index is unique, there can only be one row with the same value
-	btree   *btree.BTree // BTree is the Btree object for the index
-	lock    *sync.Mutex  // Lock is the lock for the index
+	Name      string       // Name is the index name
+	Columns   []string     // Columns is a list of column names in the index
+	Unique    bool         // Unique is true if the index is unique, there can only be one row with the same value
+	Invisible bool         // Invisible is true if the optimizer ignores the index, it is still maintained and enforces uniqueness
+	btree     *btree.BTree // BTree is the Btree object for the index
+	lock      *sync.Mutex  // Lock is the lock for the index
+}
+
+// Bloom is a bloom filter on a column, split in segments of BLOOM_SEGMENT_ROWS rows
+// A segment missing a bit of a value holds no row with the value.  Bits are never cleared,
+// values of updated and deleted rows stay behind as false positives until the filter is created again
+type Bloom struct {
+	Name   string        // Name is the bloom filter name
+	Column string        // Column is the column filtered on
+	bits   []byte        // Bits of every segment, BLOOM_SEGMENT_BYTES per segment
+	file   *storage.File // Bits file
+	lock   *sync.Mutex   // Lock is the lock for the bits
 }
 
 // User is a user object
 type User struct {
-	Username   string
-	Password   string
-	Privileges []*Privilege
+	Username           string
+	Password           string
+	Privileges         []*Privilege
+	MustChangePassword bool // The password was generated, the user has to change it before any other statement
 }
 
 // Privilege is a user privilege
@@ -158,2209 +351,6702 @@ type Privilege struct {
 // New creates a new catalog
 func New(directory string) *Catalog {
 	return &Catalog{
-		Directory: directory,
+		Directory:       directory,
+		openTables:      list.New(),
+		openTablesLock:  &sync.Mutex{},
+		QuarantinedLock: &sync.Mutex{},
 	}
 }
 
-// Open initializes the catalog, reading all databases, tables, indexes, etc from disk
-func (cat *Catalog) Open() error {
-	gob.Register(&TableSchema{})
-	gob.Register(&shared.SysDate{})
-	gob.Register(&shared.SysTime{})
-	gob.Register(&shared.SysTimestamp{})
-	gob.Register(&shared.GenUUID{})
-	gob.Register(time.Time{})
-
-	cat.Databases = make(map[string]*Database)
+// checkLayoutVersion stamps the data directory with the layout version, refusing a directory written by a newer layout
+// Directories created before the layout version file existed are stamped as version 1
+// An older directory is migrated if AutoUpgrade is set, otherwise it is refused until upgraded
+func (cat *Catalog) checkLayoutVersion() error {
+	version, err := readLayoutVersion(cat.Directory)
+	if err != nil {
+		return err
+	}
 
-	// Check for databases directory
-	_, err := os.Stat(fmt.Sprintf("%s%sdatabases", cat.Directory, shared.GetOsPathSeparator()))
-	if os.IsNotExist(err) {
-		// Create databases directory
-		err = os.MkdirAll(fmt.Sprintf("%s%sdatabases", cat.Directory, shared.GetOsPathSeparator()), 0755)
-		if err != nil {
-			return err
-		}
+	if version > LAYOUT_VERSION {
+		return fmt.Errorf("data directory layout version %d is newer than supported version %d", version, LAYOUT_VERSION)
+	}
 
-	} else {
-		// Read databases
-		databaseDirs, err := os.ReadDir(fmt.Sprintf("%s%sdatabases", cat.Directory, shared.GetOsPathSeparator()))
-		if err != nil {
-			return err
+	if version < LAYOUT_VERSION {
+		if !cat.AutoUpgrade {
+			return fmt.Errorf("data directory layout version %d is older than version %d, upgrade it with -upgrade", version, LAYOUT_VERSION)
 		}
 
-		for _, databaseDir := range databaseDirs {
-			if databaseDir.IsDir() {
-				db := &Database{
-					Directory: fmt.Sprintf("%s%sdatabases%s%s", cat.Directory, shared.GetOsPathSeparator(), shared.GetOsPathSeparator(), databaseDir.Name()),
-				}
-
-				db.TablesLock = &sync.Mutex{}
-				db.Name = databaseDir.Name()
-				cat.Databases[databaseDir.Name()] = db
-
-				// Create procedures map
-				db.Procedures = make(map[string]*Procedure)
-				db.ProceduresFileLock = &sync.Mutex{}
-
-				// Check if {db.name}.DB_PROC_EXTENSION exists
-				if _, err := os.Stat(fmt.Sprintf("%s%s%s%s", db.Directory, shared.GetOsPathSeparator(), db.Name, DB_PROC_EXTENSION)); err == nil {
-					// Open procedure file
-					db.ProceduresFile, err = os.Open(fmt.Sprintf("%s%s%s%s", db.Directory, shared.GetOsPathSeparator(), db.Name, DB_PROC_EXTENSION))
-					if err != nil {
-						return err
-					}
-
-					// Decode procedures
-					dec := gob.NewDecoder(db.ProceduresFile)
-					err = dec.Decode(&db.Procedures)
-					if err != nil {
-						return err
-					}
-
-				}
-
-				// Within databases directory there are table directories
-				tblDirs, err := os.ReadDir(fmt.Sprintf("%s", db.Directory))
-				if err != nil {
-					return err
-				}
-
-				db.Tables = make(map[string]*Table)
-
-				for _, tblDir := range tblDirs {
-					if tblDir.IsDir() {
-						tbl := &Table{
-							Name:      tblDir.Name(),
-							Directory: fmt.Sprintf("%s%s%s", db.Directory, shared.GetOsPathSeparator(), tblDir.Name()),
-						}
-
-						// Within each table there is a schema file, index files , sequence file, and data file
-
-						// Read schema file
-						schemaFile, err := os.Open(fmt.Sprintf("%s%s%s", tbl.Directory, shared.GetOsPathSeparator(), fmt.Sprintf("%s%s", tblDir.Name(), DB_SCHEMA_TABLE_SCHEMA_FILE_EXTENSION)))
-						if err != nil {
-							return err
-						}
-
-						// Decode schema
-						dec := gob.NewDecoder(schemaFile)
-						tblSchema := &TableSchema{}
-						err = dec.Decode(tblSchema)
-
-						if err != nil {
-							return err
-						}
-
-						tbl.TableSchema = tblSchema
+		return migrate(cat.Directory, version, LAYOUT_VERSION, migrations)
+	}
 
-						// Read data file
-						rowFile, err := btree.OpenPager(fmt.Sprintf("%s%s%s", tbl.Directory, shared.GetOsPathSeparator(), fmt.Sprintf("%s%s", tblDir.Name(), DB_SCHEMA_TABLE_DATA_FILE_EXTENSION)), os.O_RDWR, 0755)
-						if err != nil {
-							return err
-						}
+	return nil
+}
 
-						tbl.Rows = rowFile
+// readLayoutVersion reads the layout version of a data directory, stamping directories without one
+// A directory holding databases but no version was written before the version file existed and is version 1,
+// only an empty directory is stamped with the current version
+func readLayoutVersion(directory string) (int, error) {
+	d, err := os.ReadFile(filepath.Join(directory, LAYOUT_VERSION_FILE))
+	if os.IsNotExist(err) {
+		version := LAYOUT_VERSION
 
-						// Read sequence file
-						seqFile, err := os.Open(fmt.Sprintf("%s%s%s", tbl.Directory, shared.GetOsPathSeparator(), fmt.Sprintf("%s%s", tblDir.Name(), DB_SCHEMA_TABLE_SEQ_FILE_EXTENSION)))
-						if err != nil {
-							return err
-						}
+		_, err = os.Stat(filepath.Join(directory, "databases"))
+		if err == nil {
+			version = 1
+		} else if !os.IsNotExist(err) {
+			return 0, err
+		}
 
-						tbl.SequenceFile = seqFile
+		return version, writeLayoutVersion(directory, version)
+	} else if err != nil {
+		return 0, err
+	}
 
-						tblFiles, err := os.ReadDir(fmt.Sprintf("%s", tbl.Directory))
-						if err != nil {
-							return err
-						}
+	version, err := strconv.Atoi(strings.TrimSpace(string(d)))
+	if err != nil {
+		return 0, fmt.Errorf("invalid layout version %q", string(d))
+	}
 
-						tbl.Indexes = make(map[string]*Index)
+	return version, nil
+}
 
-						for _, tblFile := range tblFiles {
-							if strings.HasSuffix(tblFile.Name(), DB_SCHEMA_TABLE_INDEX_FILE_EXTENSION) {
-								// Read index file
-								indexFile, err := os.Open(fmt.Sprintf("%s%s%s", tbl.Directory, shared.GetOsPathSeparator(), tblFile.Name()))
-								if err != nil {
-									return err
-								}
+// writeLayoutVersion stamps a data directory with a layout version
+func writeLayoutVersion(directory string, version int) error {
+	return os.WriteFile(filepath.Join(directory, LAYOUT_VERSION_FILE), []byte(strconv.Itoa(version)), 0644)
+}
 
-								// Decode index
-								dec := gob.NewDecoder(indexFile)
-								idx := &Index{}
-								err = dec.Decode(idx)
+// Migration upgrades a data directory from the previous layout version to Version
+// Migrations run with the data directory locked and the catalog closed, a migration interrupted by a crash
+// is run again on the next upgrade so it must be safe to run on a partially migrated directory
+type Migration struct {
+	Version     int                          // Layout version the migration upgrades to
+	Description string                       // What the migration changes
+	Migrate     func(directory string) error // Migrates the data directory
+}
 
-								if err != nil {
-									return err
-								}
+// migrations are the layout migrations in version order, the last one upgrades to LAYOUT_VERSION
+// When the on-disk format changes LAYOUT_VERSION is bumped and a migration to it is added here
+var migrations = []*Migration{
+	{Version: 2, Description: "store NULL index keys under INDEX_NULL_KEY", Migrate: migrateIndexNullKeys},
+	{Version: 3, Description: "store index keys typed, numbers compare as numbers", Migrate: migrateIndexTypedKeys},
+	{Version: 4, Description: "store deleted pages as bitmaps", Migrate: migrateDeletedPages},
+	{Version: 5, Description: "rebuild the indexes of compressed tables under the keys of their values", Migrate: migrateCompressedIndexes},
+}
 
-								// Open btree
-								bt, err := btree.Open(fmt.Sprintf("%s%s%s%s", tbl.Directory, shared.GetOsPathSeparator(), fmt.Sprintf("idx_%s", idx.Name), ".bt"), os.O_RDWR, 0755, 6)
-								if err != nil {
-									return err
-								}
+// migrateIndexNullKeys moves the entries of rows holding NULL from the formatted <nil> key of every index to INDEX_NULL_KEY
+// Rows which do not decode, encrypted rows, are left under their bucket
+func migrateIndexNullKeys(directory string) error {
+	return forEachTableDirectory(directory, migrateTableNullKeys)
+}
 
-								idx.btree = bt
+// forEachTableDirectory calls migrate with the directory and name of every table of a data directory
+func forEachTableDirectory(directory string, migrate func(directory, name string) error) error {
+	databasesDir := filepath.Join(directory, "databases")
 
-								tbl.Indexes[idx.Name] = idx
-								tbl.Indexes[idx.Name].lock = &sync.Mutex{}
+	databaseDirs, err := os.ReadDir(databasesDir)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
 
-							}
+	for _, databaseDir := range databaseDirs {
+		if !databaseDir.IsDir() {
+			continue
+		}
 
-						}
+		tableDirs, err := os.ReadDir(filepath.Join(databasesDir, databaseDir.Name()))
+		if err != nil {
+			return err
+		}
 
-						db.Tables[tbl.Name] = tbl
-					}
-				}
+		for _, tableDir := range tableDirs {
+			if !tableDir.IsDir() {
+				continue
+			}
 
+			err = migrate(filepath.Join(databasesDir, databaseDir.Name(), tableDir.Name()), tableDir.Name())
+			if err != nil {
+				return err
 			}
 		}
-
 	}
 
-	// Open users file
-	cat.Users = make(map[string]*User)
+	return nil
+}
 
-	cat.UsersFile, err = os.OpenFile(fmt.Sprintf("%s%susers%s", cat.Directory, shared.GetOsPathSeparator(), SYS_USERS_EXTENSION), os.O_CREATE|os.O_RDWR, 0755)
+// migrateTableNullKeys moves the entries of rows holding NULL to INDEX_NULL_KEY within the indexes of a table
+func migrateTableNullKeys(directory, name string) error {
+	entries, err := os.ReadDir(directory)
 	if err != nil {
 		return err
-
 	}
 
-	cat.UsersLock = &sync.Mutex{}
-	cat.UsersFileLock = &sync.Mutex{}
-	cat.DatabasesLock = &sync.Mutex{}
+	var rows *btree.Pager
 
-	err = cat.ReadUsersFromFile()
-	if err != nil {
+	for _, entry := range entries {
+		if !strings.HasSuffix(entry.Name(), DB_SCHEMA_TABLE_INDEX_FILE_EXTENSION) {
+			continue
+		}
 
-		if strings.Contains(err.Error(), "users file is empty") {
-			// Create default user
-			err = cat.CreateNewUser("admin", "admin")
+		indexFile, err := os.Open(filepath.Join(directory, entry.Name()))
+		if err != nil {
+			return err
+		}
+
+		idx := &Index{}
+		err = gob.NewDecoder(indexFile).Decode(idx)
+		indexFile.Close()
+		if err != nil {
+			return err
+		}
+
+		bt, err := btree.Open(filepath.Join(directory, fmt.Sprintf("idx_%s.bt", indexName(entry.Name()))), os.O_RDWR, 0755, 6)
+		if err != nil {
+			return err
+		}
+
+		key, err := bt.Get([]byte("<nil>"))
+		if err != nil || key == nil {
+			bt.Close()
 			if err != nil {
 				return err
 			}
 
-			err = cat.GrantPrivilegeToUser("admin", &Privilege{
-				DatabaseName:     "*",
-				TableName:        "*",
-				PrivilegeActions: []shared.PrivilegeAction{shared.PRIV_ALL},
-			})
+			continue
+		}
+
+		if rows == nil {
+			rows, err = btree.OpenPager(filepath.Join(directory, name+DB_SCHEMA_TABLE_DATA_FILE_EXTENSION), os.O_RDWR, 0755)
 			if err != nil {
+				bt.Close()
 				return err
 			}
 
+			defer rows.Close()
 		}
-		return err
-	}
 
-	return nil
-}
+		tbl := &Table{Name: name, Directory: directory, Rows: rows}
 
-// Close closes the catalog
-func (cat *Catalog) Close() {
-	for _, db := range cat.Databases {
-		db.ProceduresFile.Close()
+		// The values are copied as the key is changed while moving them
+		for _, v := range slices.Clone(key.V) {
+			rowId, err := strconv.ParseInt(string(v), 10, 64)
+			if err != nil {
+				continue
+			}
 
-		for _, tbl := range db.Tables {
-			if tbl.Rows != nil {
-				tbl.Rows.Close()
+			row, err := tbl.GetRow(rowId)
+			if err != nil {
+				continue
 			}
-			for _, idx := range tbl.Indexes {
-				if idx.btree != nil {
-					idx.btree.Close()
-				}
+
+			// The key is shared with a column holding the text <nil>
+			if !slices.ContainsFunc(idx.Columns, func(column string) bool { return row[column] == nil }) {
+				continue
+			}
+
+			err = bt.Put([]byte(INDEX_NULL_KEY), v)
+			if err == nil {
+				err = bt.Remove([]byte("<nil>"), v)
+			}
+
+			if err != nil {
+				bt.Close()
+				return err
 			}
 		}
+
+		bt.Close()
 	}
 
+	return nil
 }
 
-// CreateDatabase create a new database
-func (cat *Catalog) CreateDatabase(name string) error {
-	// Check if database exists
-	if _, ok := cat.Databases[name]; ok {
-		return fmt.Errorf("database %s already exists", name)
-	}
+// migrateIndexTypedKeys moves the entries of every index from the formatted value to its typed key, see EncodeKey
+// and fills the bloom filters again from the typed keys of the rows
+func migrateIndexTypedKeys(directory string) error {
+	return forEachTableDirectory(directory, migrateTableTypedKeys)
+}
 
-	// Create database directory
-	err := os.Mkdir(fmt.Sprintf("%s%sdatabases%s%s", cat.Directory, shared.GetOsPathSeparator(), shared.GetOsPathSeparator(), name), 0755)
+// migrateTableTypedKeys moves the entries of the indexes of a table to typed keys and fills its bloom filters again
+// Rows which do not decode, encrypted rows, are left under their bucket and their bloom filters as they are.
+// Entries already under their typed key are left, the migration can run again on a partially migrated table
+func migrateTableTypedKeys(directory, name string) error {
+	entries, err := os.ReadDir(directory)
 	if err != nil {
 		return err
 	}
 
-	// Create database
-	cat.Databases[name] = &Database{
-		Name:               name,
-		Tables:             make(map[string]*Table),
-		Procedures:         make(map[string]*Procedure),
-		ProceduresFileLock: &sync.Mutex{},
-		Directory:          fmt.Sprintf("%s%sdatabases%s%s", cat.Directory, shared.GetOsPathSeparator(), shared.GetOsPathSeparator(), name),
-	}
-
-	// Create procedures file
-	procFile, err := os.Create(fmt.Sprintf("%s%s%s%s", cat.Databases[name].Directory, shared.GetOsPathSeparator(), name, DB_PROC_EXTENSION))
-	if err != nil {
+	rows, err := btree.OpenPager(filepath.Join(directory, name+DB_SCHEMA_TABLE_DATA_FILE_EXTENSION), os.O_RDWR, 0755)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
 		return err
 	}
 
-	cat.Databases[name].ProceduresFile = procFile
+	defer rows.Close()
 
-	cat.Databases[name].ProceduresFileLock.Lock()
-	defer cat.Databases[name].ProceduresFileLock.Unlock()
+	tbl := &Table{Name: name, Directory: directory, Rows: rows}
 
-	// Write to procedures file
-	enc := gob.NewEncoder(procFile)
-	err = enc.Encode(cat.Databases[name].Procedures)
-	if err != nil {
-		return err
+	for _, entry := range entries {
+		switch {
+		case strings.HasSuffix(entry.Name(), DB_SCHEMA_TABLE_INDEX_FILE_EXTENSION):
+			err = migrateIndexKeys(tbl, entry.Name())
+		case strings.HasSuffix(entry.Name(), DB_SCHEMA_TABLE_BLOOM_FILE_EXTENSION):
+			err = refillBloom(tbl, entry.Name())
+		}
 
+		if err != nil {
+			return err
+		}
 	}
 
 	return nil
 }
 
-// DropDatabase drops a database by name
-func (cat *Catalog) DropDatabase(name string) error {
-	// Check if database exists
-	if _, ok := cat.Databases[name]; !ok {
-		return fmt.Errorf("database %s does not exist", name)
+// migrateIndexKeys moves the entries of an index of a table from the formatted values of its columns to their typed keys
+func migrateIndexKeys(tbl *Table, fileName string) error {
+	indexFile, err := os.Open(filepath.Join(tbl.Directory, fileName))
+	if err != nil {
+		return err
 	}
 
-	// Drop database directory
-	err := os.RemoveAll(cat.Databases[name].Directory)
+	idx := &Index{}
+	err = gob.NewDecoder(indexFile).Decode(idx)
+	indexFile.Close()
 	if err != nil {
 		return err
 	}
 
-	// Drop database
-	delete(cat.Databases, name)
+	bt, err := btree.Open(filepath.Join(tbl.Directory, fmt.Sprintf("idx_%s.bt", indexName(fileName))), os.O_RDWR, 0755, 6)
+	if err != nil {
+		return err
+	}
 
-	return nil
-}
+	defer bt.Close()
 
-// GetIndexes gets the indexes for a table
-func (tbl *Table) GetIndexes() []*Index {
-	indexes := make([]*Index, 0)
-
-	for _, idx := range tbl.Indexes {
-		indexes = append(indexes, idx)
-
-	}
-
-	return indexes
-
-}
-
-// GetLock get btree lock
-func (idx *Index) GetLock() *sync.Mutex {
-	return idx.lock
-}
-
-// DropTable drops a table by name
-func (db *Database) DropTable(name string) error {
-	// Check if table exists
-	if _, ok := db.Tables[name]; !ok {
-		return fmt.Errorf("table %s does not exist", name)
-	}
-
-	// Drop table
-	delete(db.Tables, name)
-
-	// Drop table directory
-	err := os.RemoveAll(fmt.Sprintf("%s%s%s", db.Directory, shared.GetOsPathSeparator(), name))
-	if err != nil {
-		return err
-	}
-
-	return nil
-
-}
-
-// CreateTable creates a new table in a schema
-func (db *Database) CreateTable(name string, tblSchema *TableSchema, encrypt bool, compress bool, key []byte) error {
-	if tblSchema == nil {
-		return fmt.Errorf("table schema is nil")
-	}
-
-	if len(name) > MAX_TABLE_NAME_SIZE {
-		return fmt.Errorf("table name is too long, max length is %d", MAX_TABLE_NAME_SIZE)
-	}
-
-	// Check if table exists
-	if _, ok := db.Tables[name]; ok {
-		return fmt.Errorf("table %s already exists", name)
-	}
-
-	// Create table
-	db.Tables[name] = &Table{
-		Name:        name,
-		Indexes:     make(map[string]*Index),
-		TableSchema: tblSchema,
-		Directory:   fmt.Sprintf("%s%s%s", db.Directory, shared.GetOsPathSeparator(), name),
-	}
-
-	// Create table directory
-	err := os.Mkdir(fmt.Sprintf("%s%s%s", db.Directory, shared.GetOsPathSeparator(), name), 0755)
+	keys, err := bt.Range([]byte{}, []byte{0xff})
 	if err != nil {
 		return err
 	}
 
-	sequenceDefined := false
-
-	for colName, colDef := range tblSchema.ColumnDefinitions {
-		if len(colName) > MAX_COLUMN_NAME_SIZE {
-			// delete table
-			delete(db.Tables, name)
-			os.RemoveAll(fmt.Sprintf("%s%s%s", db.Directory, shared.GetOsPathSeparator(), name))
-			return fmt.Errorf("column name is too long, max length is %d", MAX_COLUMN_NAME_SIZE)
-		}
+	for _, k := range keys {
+		key := k.(*btree.Key)
 
-		if !shared.IsValidDataType(colDef.DataType) {
-			delete(db.Tables, name)
-			os.RemoveAll(fmt.Sprintf("%s%s%s", db.Directory, shared.GetOsPathSeparator(), name))
-			return fmt.Errorf("invalid data type %s", colDef.DataType)
+		if string(key.K) == INDEX_NULL_KEY {
+			continue
 		}
 
-		if colDef.Unique {
-			err = db.Tables[name].CreateIndex(fmt.Sprintf("unique_%s", colName), []string{colName}, true)
+		for _, v := range slices.Clone(key.V) {
+			rowId, err := strconv.ParseInt(string(v), 10, 64)
 			if err != nil {
-				delete(db.Tables, name)
-				os.RemoveAll(fmt.Sprintf("%s%s%s", db.Directory, shared.GetOsPathSeparator(), name))
-				return err
+				continue
 			}
-		}
 
-		if colDef.Sequence {
-			if sequenceDefined {
-				delete(db.Tables, name)
-				os.RemoveAll(fmt.Sprintf("%s%s%s", db.Directory, shared.GetOsPathSeparator(), name))
-				return fmt.Errorf("only one sequence column is allowed per table")
+			row, err := tbl.GetRow(rowId)
+			if err != nil {
+				continue
 			}
 
-			// Sequenced column must be unique and not null
-
-			if !colDef.Unique || !colDef.NotNull {
-				delete(db.Tables, name)
-				os.RemoveAll(fmt.Sprintf("%s%s%s", db.Directory, shared.GetOsPathSeparator(), name))
-				return fmt.Errorf("sequence column %s must be unique and not null", colName)
+			// The columns of the index the entry was formatted from, a row can hold the same value in several
+			var typed [][]byte
+			for _, column := range idx.Columns {
+				if row[column] != nil && fmt.Sprintf("%v", row[column]) == string(key.K) && !bytes.Equal(EncodeKey(row[column]), key.K) {
+					typed = append(typed, EncodeKey(row[column]))
+				}
 			}
 
-			// Datatype MUST be an integer
-			if strings.ToUpper(colDef.DataType) != "INT" && strings.ToUpper(colDef.DataType) != "INTEGER" {
-				delete(db.Tables, name)
-				os.RemoveAll(fmt.Sprintf("%s%s%s", db.Directory, shared.GetOsPathSeparator(), name))
-				return fmt.Errorf("sequence column %s must be an integer", colName)
+			if len(typed) == 0 {
+				continue
 			}
 
-			sequenceDefined = true
-		}
-
-		switch strings.ToUpper(colDef.DataType) {
-		case "CHARACTER", "CHAR":
-			// A character datatype requires a length
-			if colDef.Length == 0 {
-				delete(db.Tables, name)
-				os.RemoveAll(fmt.Sprintf("%s%s%s", db.Directory, shared.GetOsPathSeparator(), name))
-				return fmt.Errorf("column %s requires a length", colName)
-			}
-		case "NUMERIC", "DECIMAL", "DEC", "FLOAT", "DOUBLE", "REAL":
-			// A numeric datatype requires a precision and scale
-			if colDef.Precision == 0 {
-				delete(db.Tables, name)
-				os.RemoveAll(fmt.Sprintf("%s%s%s", db.Directory, shared.GetOsPathSeparator(), name))
-				return fmt.Errorf("column %s requires a precision", colName)
+			for _, t := range typed {
+				err = bt.Put(t, v)
+				if err != nil {
+					return err
+				}
 			}
 
-			if colDef.Scale == 0 {
-				delete(db.Tables, name)
-				os.RemoveAll(fmt.Sprintf("%s%s%s", db.Directory, shared.GetOsPathSeparator(), name))
-				return fmt.Errorf("column %s requires a scale", colName)
+			err = bt.Remove(key.K, v)
+			if err != nil {
+				return err
 			}
-		case "INT", "INTEGER", "SMALLINT":
-		case "DATE", "TIME", "TIMESTAMP", "DATETIME":
-		case "BINARY":
-		case "UUID":
-		case "BOOLEAN", "BOOL":
-		case "TEXT":
-		case "BLOB":
-
-		default:
-			delete(db.Tables, name)
-			os.RemoveAll(fmt.Sprintf("%s%s%s", db.Directory, shared.GetOsPathSeparator(), name))
-			return fmt.Errorf("invalid data type %s", colDef.DataType)
 		}
 	}
 
-	if encrypt {
-		db.Tables[name].Encrypt = true
-
-		// sha256 hash the key
-		hash := sha256.New()
-
-		// Write data to the hash
-		hash.Write(key)
-
-		// Calculate the hash
-		hashBytes := hash.Sum(nil)
-
-		db.Tables[name].HashedKey = [32]byte(hashBytes)
-
-		// The nonce is 12 bytes of the end of the hash
-		db.Tables[name].Nonce = [12]byte{}
-		db.Tables[name].Nonce = [12]byte(append(db.Tables[name].Nonce[:], hashBytes[len(hashBytes)-12:]...))
-	}
-
-	if compress {
-		db.Tables[name].Compress = true
-	}
+	return nil
+}
 
-	// Create sequence file
-	seqFile, err := os.Create(fmt.Sprintf("%s%s%s%s", db.Tables[name].Directory, shared.GetOsPathSeparator(), name, DB_SCHEMA_TABLE_SEQ_FILE_EXTENSION))
+// refillBloom sets the bits of a bloom filter of a table again from the typed keys of its rows
+// The bits are left as they are if no row decodes, the rows of an encrypted table set the bits of their bucket
+func refillBloom(tbl *Table, fileName string) error {
+	bloomFile, err := os.Open(filepath.Join(tbl.Directory, fileName))
 	if err != nil {
-		delete(db.Tables, name)
-		os.RemoveAll(fmt.Sprintf("%s%s%s", db.Directory, shared.GetOsPathSeparator(), name))
 		return err
 	}
 
-	schemaFile, err := os.Create(fmt.Sprintf("%s%s%s%s", db.Tables[name].Directory, shared.GetOsPathSeparator(), name, DB_SCHEMA_TABLE_SCHEMA_FILE_EXTENSION))
+	b := &Bloom{}
+	err = gob.NewDecoder(bloomFile).Decode(b)
+	bloomFile.Close()
 	if err != nil {
-		delete(db.Tables, name)
-		os.RemoveAll(fmt.Sprintf("%s%s%s", db.Directory, shared.GetOsPathSeparator(), name))
 		return err
 	}
 
-	defer schemaFile.Close()
+	decoded, failed := 0, 0
 
-	// Encode schema to file
-	enc := gob.NewEncoder(schemaFile)
+	for rowId := int64(0); rowId < tbl.Rows.Count(); rowId++ {
+		if tbl.Rows.IsDeleted(rowId) {
+			continue
+		}
 
-	err = enc.Encode(tblSchema)
-	if err != nil {
-		delete(db.Tables, name)
-		os.RemoveAll(fmt.Sprintf("%s%s%s", db.Directory, shared.GetOsPathSeparator(), name))
-		return err
+		page, err := tbl.Rows.GetPage(rowId)
+		if errors.Is(err, btree.ErrOverflowPage) {
+			continue
+		} else if err != nil {
+			return err
+		}
+
+		// Legacy overflow pages do not decode either
+		row, err := tbl.readRow(page)
+		if err != nil {
+			failed++
+			continue
+		}
+
+		decoded++
+		b.set(rowId, EncodeKey(row[b.Column]))
 	}
 
-	// Create btree pager
-	rowFile, err := btree.OpenPager(fmt.Sprintf("%s%s%s%s", db.Tables[name].Directory, shared.GetOsPathSeparator(), name, DB_SCHEMA_TABLE_DATA_FILE_EXTENSION), os.O_CREATE|os.O_RDWR, 0755)
+	if decoded == 0 && failed > 0 {
+		return nil
+	}
+
+	// Segments past the bits written are never skipped, a bits file truncated by a crash is filled on the next run
+	f, err := storage.OpenFile(tbl.bloomPaths(b.Name)[1], os.O_CREATE|os.O_RDWR|os.O_TRUNC, 0755)
 	if err != nil {
-		delete(db.Tables, name)
-		os.RemoveAll(fmt.Sprintf("%s%s%s", db.Directory, shared.GetOsPathSeparator(), name))
 		return err
 	}
 
-	db.Tables[name].Rows = rowFile
+	defer f.Close()
 
-	db.Tables[name].SequenceFile = seqFile
-	db.Tables[name].SeqLock = &sync.Mutex{}
+	if len(b.bits) > 0 {
+		_, err = f.WriteAt(b.bits, 0)
+	}
 
-	return nil
+	return err
 }
 
-// GetTable gets a table by name
-func (db *Database) GetTable(tableName string) *Table {
-	return db.Tables[tableName]
+// migrateDeletedPages writes every deleted pages file of the data directory listing the pages as text as a bitmap
+// Files of tables, indexes, history and the WAL are managed by a pager alike
+func migrateDeletedPages(directory string) error {
+	return filepath.WalkDir(directory, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if d.IsDir() || !strings.HasSuffix(path, btree.DELETED_PAGES_EXTENSION) {
+			return nil
+		}
+
+		return btree.MigrateDeletedPages(strings.TrimSuffix(path, btree.DELETED_PAGES_EXTENSION))
+	})
 }
 
-// CreateIndex creates a new index on a table
-func (tbl *Table) CreateIndex(name string, columns []string, unique bool) error {
-	if len(name) > MAX_INDEX_NAME_SIZE {
-		return fmt.Errorf("index name is too long, max length is %d", MAX_INDEX_NAME_SIZE)
-	}
+// migrateCompressedIndexes rebuilds the indexes of every compressed table, their keys were the formatted compressed values
+func migrateCompressedIndexes(directory string) error {
+	return forEachTableDirectory(directory, rebuildTableIndexes)
+}
 
-	// Check if index exists
-	if _, ok := tbl.Indexes[name]; ok {
-		return fmt.Errorf("index %s already exists", name)
+// rebuildTableIndexes creates the index files of a compressed table again from its rows, see Table.IndexKey
+// A table with rows which do not decode, encrypted rows, is left as it is as its indexes would lose their entries.
+// The files are created again from the rows, the migration can run again on a partially migrated table
+func rebuildTableIndexes(directory, name string) error {
+	schemaFile, err := os.Open(filepath.Join(directory, name+DB_SCHEMA_TABLE_SCHEMA_FILE_EXTENSION))
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
 	}
 
-	bt, err := btree.Open(fmt.Sprintf("%s%s%s%s", tbl.Directory, shared.GetOsPathSeparator(), fmt.Sprintf("idx_%s", name), ".bt"), os.O_CREATE|os.O_RDWR, 0755, 6)
+	tblSchema := &TableSchema{}
+	err = gob.NewDecoder(schemaFile).Decode(tblSchema)
+	schemaFile.Close()
 	if err != nil {
 		return err
 	}
 
-	// Create index
-	tbl.Indexes[name] = &Index{
-		Name:    name,
-		Columns: columns,
-		Unique:  unique,
-		btree:   bt,
-		lock:    &sync.Mutex{},
+	if !tblSchema.Compress {
+		return nil
 	}
 
-	// Create index file
-	indexFile, err := os.Create(fmt.Sprintf("%s%s%s%s", tbl.Directory, shared.GetOsPathSeparator(), fmt.Sprintf("idx_%s", name), DB_SCHEMA_TABLE_INDEX_FILE_EXTENSION))
-	if err != nil {
+	rows, err := btree.OpenPager(filepath.Join(directory, name+DB_SCHEMA_TABLE_DATA_FILE_EXTENSION), os.O_RDWR, 0755)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
 		return err
 	}
 
-	defer indexFile.Close()
-
-	// Encode index to file
-	enc := gob.NewEncoder(indexFile)
+	defer rows.Close()
 
-	err = enc.Encode(tbl.Indexes[name])
-	if err != nil {
-		return err
-	}
+	tbl := &Table{Name: name, Directory: directory, Rows: rows, TableSchema: tblSchema, Compress: true}
 
-	return nil
+	live := make(map[int64]map[string]interface{})
 
-}
+	for rowId := int64(0); rowId < rows.Count(); rowId++ {
+		if rows.IsDeleted(rowId) {
+			continue
+		}
 
-// DropIndex drops an index by name
-func (tbl *Table) DropIndex(name string) error {
-	// Check if index exists
-	if _, ok := tbl.Indexes[name]; !ok {
-		return fmt.Errorf("index %s does not exist", name)
-	}
+		page, err := rows.GetPage(rowId)
+		if errors.Is(err, btree.ErrOverflowPage) {
+			continue
+		} else if err != nil {
+			return err
+		}
 
-	// Drop index
-	delete(tbl.Indexes, name)
+		row, err := tbl.readRow(page)
+		if err != nil {
+			log.Printf("indexes of table %s are not rebuilt, row %d does not decode: %s", directory, rowId, err.Error())
+			return nil
+		}
 
-	// Drop index file
-	err := os.Remove(fmt.Sprintf("%s%s%s%s", tbl.Directory, shared.GetOsPathSeparator(), fmt.Sprintf("idx_%s", name), DB_SCHEMA_TABLE_INDEX_FILE_EXTENSION))
-	if err != nil {
-		return err
+		live[rowId] = row
 	}
 
-	// Remove btree file
-	err = os.Remove(fmt.Sprintf("%s%s%s%s", tbl.Directory, shared.GetOsPathSeparator(), fmt.Sprintf("idx_%s", name), ".bt"))
+	entries, err := os.ReadDir(directory)
 	if err != nil {
 		return err
 	}
 
-	return nil
-}
-
-// GetDatabase gets a database by name
-func (cat *Catalog) GetDatabase(name string) *Database {
+	for _, entry := range entries {
+		if !strings.HasSuffix(entry.Name(), DB_SCHEMA_TABLE_INDEX_FILE_EXTENSION) {
+			continue
+		}
 
-	return cat.Databases[name]
+		indexFile, err := os.Open(filepath.Join(directory, entry.Name()))
+		if err != nil {
+			return err
+		}
 
-	return nil
-}
+		idx := &Index{}
+		err = gob.NewDecoder(indexFile).Decode(idx)
+		indexFile.Close()
+		if err != nil {
+			return err
+		}
 
-// GetIndex gets an index by name
-func (tbl *Table) GetIndex(name string) *Index {
-	return tbl.Indexes[name]
-}
+		// The btree and its deleted pages, the pages written since the last backup stay marked and the new ones are marked as written
+		paths := tbl.indexPaths(indexName(entry.Name()))[1:3]
 
-// Insert inserts a row into the table
-func (tbl *Table) Insert(rows []map[string]interface{}, db *Database) ([]int64, []map[string]interface{}, error) {
-	rowIds := make([]int64, 0)                        // inserted row ids
-	insertedRows := make([]map[string]interface{}, 0) // inserted rows
+		for _, path := range paths {
+			err = os.Remove(path)
+			if err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
 
-	for _, row := range rows {
-		// Insert row into table
-		rowId, err := tbl.insert(row, db)
+		bt, err := btree.Open(paths[0], os.O_CREATE|os.O_RDWR, 0755, 6)
 		if err != nil {
-			return nil, nil, err
+			return err
 		}
 
-		rowIds = append(rowIds, rowId)
-		insertedRows = append(insertedRows, row)
-
+		for _, rowId := range slices.Sorted(maps.Keys(live)) {
+			for _, column := range idx.Columns {
+				value, ok := live[rowId][column]
+				if !ok {
+					continue
+				}
+
+				err = bt.Put(tbl.IndexKey(value), []byte(fmt.Sprintf("%d", rowId)))
+				if err != nil {
+					bt.Close()
+					return err
+				}
+			}
+		}
+
+		err = bt.Close()
+		if err != nil {
+			return err
+		}
 	}
 
-	return rowIds, insertedRows, nil
+	return nil
 }
 
-// insert inserts a row into the table
-func (tbl *Table) insert(row map[string]interface{}, db *Database) (int64, error) {
-	// Check row against schema
-	for colName, colDef := range tbl.TableSchema.ColumnDefinitions {
+// migrate runs the migrations between two layout versions in order, stamping the directory after each one
+func migrate(directory string, from, to int, migrations []*Migration) error {
+	for version := from + 1; version <= to; version++ {
+		var migration *Migration
 
-		if colDef.NotNull && !colDef.Sequence {
-			if _, ok := row[colName]; !ok {
-				return -1, fmt.Errorf("column %s cannot be null", colName)
+		for _, m := range migrations {
+			if m.Version == version {
+				migration = m
+				break
 			}
 		}
 
-		// Check if row column exists if not set to NULL
-		if _, ok := row[colName]; !ok {
-			row[colName] = nil
+		if migration == nil {
+			return fmt.Errorf("no migration to layout version %d", version)
 		}
 
-		switch strings.ToUpper(colDef.DataType) {
-		case "TEXT":
-			if _, ok := row[colName].(string); !ok {
-				return -1, fmt.Errorf("column %s is not a string", colName)
-			}
+		err := migration.Migrate(directory)
+		if err != nil {
+			return fmt.Errorf("migration to layout version %d (%s) failed: %v", version, migration.Description, err)
+		}
 
-		case "BOOL", "BOOLEAN":
-			if _, ok := row[colName].(bool); !ok {
-				return -1, fmt.Errorf("column %s is not a boolean", colName)
-			}
-		case "BLOB":
-			if _, ok := row[colName].(string); !ok {
-				return -1, fmt.Errorf("column %s is not a string", colName)
-			}
+		err = writeLayoutVersion(directory, version)
+		if err != nil {
+			return err
+		}
+	}
 
-			var err error
+	return nil
+}
 
-			// Decode hex (0x0102030405060708090A0B0C0D0E0F10)
-			row[colName], err = hex.DecodeString(row[colName].(string))
-			if err != nil {
-				return -1, fmt.Errorf("column %s is not a valid binary", colName)
-			}
-		case "BINARY":
-			if _, ok := row[colName].(string); !ok {
-				return -1, fmt.Errorf("column %s is not a string", colName)
-			}
+// Upgrade migrates a data directory to the current layout version, the server must not be running
+// Returns the layout version the directory was upgraded from
+func Upgrade(directory string) (int, error) {
+	directoryLock, err := storage.LockDirectory(directory, LOCK_FILE)
+	if err != nil {
+		return 0, err
+	}
 
-			// Check length
-			if len(row[colName].(string)) > colDef.Length {
-				return -1, fmt.Errorf("column %s is too long", colName)
-			}
+	defer directoryLock.Unlock()
 
-			var err error
+	version, err := readLayoutVersion(directory)
+	if err != nil {
+		return 0, err
+	}
 
-			// Decode hex (0x0102030405060708090A0B0C0D0E0F10)
-			row[colName], err = hex.DecodeString(row[colName].(string))
-			if err != nil {
-				return -1, fmt.Errorf("column %s is not a valid binary", colName)
+	if version > LAYOUT_VERSION {
+		return version, fmt.Errorf("data directory layout version %d is newer than supported version %d", version, LAYOUT_VERSION)
+	}
+
+	return version, migrate(directory, version, LAYOUT_VERSION, migrations)
+}
+
+// Open initializes the catalog, reading all databases, tables, indexes, etc from disk
+func (cat *Catalog) Open() error {
+	gob.Register(&TableSchema{})
+	gob.Register(&shared.SysDate{})
+	gob.Register(&shared.SysTime{})
+	gob.Register(&shared.SysTimestamp{})
+	gob.Register(&shared.GenUUID{})
+	gob.Register(&shared.GenUUIDv7{})
+	gob.Register(time.Time{})
+
+	cat.Databases = make(map[string]*Database)
+	cat.openTables = list.New()
+	cat.openTablesLock = &sync.Mutex{}
+	cat.Quarantined = make([]*Quarantine, 0)
+	cat.QuarantinedLock = &sync.Mutex{}
+
+	err := os.MkdirAll(cat.Directory, 0755)
+	if err != nil {
+		return err
+	}
+
+	// Only one instance can use a data directory at a time
+	if cat.directoryLock == nil {
+		cat.directoryLock, err = storage.LockDirectory(cat.Directory, LOCK_FILE)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = cat.checkLayoutVersion()
+	if err != nil {
+		cat.directoryLock.Unlock()
+		cat.directoryLock = nil
+		return err
+	}
+
+	// Check for databases directory
+	_, err = os.Stat(filepath.Join(cat.Directory, "databases"))
+	if os.IsNotExist(err) {
+		// Create databases directory
+		err = os.MkdirAll(filepath.Join(cat.Directory, "databases"), 0755)
+		if err != nil {
+			return err
+		}
+
+	} else {
+		// Resolve DDL operations interrupted by a crash
+		_, err = RecoverDDLJournal(filepath.Join(cat.Directory, "databases"))
+		if err != nil {
+			return err
+		}
+
+		// including drops of tables on the cold tier
+		if cat.ColdDirectory != "" {
+			_, err = RecoverDDLJournal(filepath.Join(cat.ColdDirectory, "databases"))
+			if err != nil && !os.IsNotExist(err) {
+				return err
 			}
+		}
 
-		case "UUID":
-			if colDef.NotNull {
-				return -1, fmt.Errorf("column %s is not a string", colName)
-			} else if colDef.Default != nil {
-				if _, ok := colDef.Default.(*shared.GenUUID); ok {
-					row[colName] = uuid.New().String()
-				} else {
-					continue
+		// Read databases
+		databaseDirs, err := os.ReadDir(filepath.Join(cat.Directory, "databases"))
+		if err != nil {
+			return err
+		}
+
+		for _, databaseDir := range databaseDirs {
+			if databaseDir.IsDir() {
+				db := &Database{
+					Directory: filepath.Join(cat.Directory, "databases", databaseDir.Name()),
+					catalog:   cat,
 				}
-			}
 
-			// Check if valid UUID
-			_, err := uuid.Parse(row[colName].(string))
-			if err != nil {
-				return -1, errors.New(fmt.Sprintf("'%s' is not a valid UUID\n", row[colName].(string)))
-			}
-		case "DATETIME", "TIMESTAMP":
-			if _, ok := row[colName].(string); !ok {
-				if colDef.NotNull {
-					return -1, fmt.Errorf("column %s is not a string", colName)
-				} else if colDef.Default != nil {
-					if _, ok := colDef.Default.(*shared.SysDate); ok {
-						row[colName] = time.Now()
-					} else if _, ok := colDef.Default.(*shared.SysTime); ok {
-						row[colName] = time.Now()
-					} else if _, ok := colDef.Default.(*shared.SysTimestamp); ok {
-						row[colName] = time.Now()
+				db.TablesLock = &sync.Mutex{}
+				db.Name = databaseDir.Name()
+				cat.Databases[databaseDir.Name()] = db
+
+				// Create procedures map
+				db.Procedures = make(map[string]*Procedure)
+				db.ProceduresFileLock = &sync.Mutex{}
+				db.MigrationsLock = &sync.Mutex{}
+
+				// Check if {db.name}.DB_PROC_EXTENSION exists
+				if _, err := os.Stat(filepath.Join(db.Directory, db.Name+DB_PROC_EXTENSION)); err == nil {
+					// Open procedure file
+					db.ProceduresFile, err = os.Open(filepath.Join(db.Directory, db.Name+DB_PROC_EXTENSION))
+					if err != nil {
+						return err
+					}
+
+					// Decode procedures
+					dec := gob.NewDecoder(db.ProceduresFile)
+					err = dec.Decode(&db.Procedures)
+					if err != nil {
+						if !cat.SafeMode {
+							return err
+						}
+
+						db.ProceduresFile.Close()
+						db.ProceduresFile = nil
+						db.Procedures = make(map[string]*Procedure)
+
+						cat.quarantine(&Quarantine{Database: db.Name, Name: db.Name, Kind: QUARANTINE_PROCEDURES, Path: filepath.Join(db.Directory, db.Name+DB_PROC_EXTENSION), Reason: fmt.Sprintf("procedures file does not decode: %s", err.Error())})
 					}
 
-					continue
-				} else {
-					continue
 				}
-			}
 
-			// Check date format
-			// Should be in the format YYYY-MM-DD HH:MM:SS
+				// Databases created before settings existed have none
+				db.Settings, err = db.readSettings()
+				if err != nil {
+					if !cat.SafeMode {
+						return err
+					}
 
-			// convert 2024-09-14 153201 to 2024-09-14 15:32:01
-			row[colName] = strings.TrimSuffix(strings.TrimPrefix(row[colName].(string), "'"), "'")
+					db.Settings = &DatabaseSettings{}
 
-			original := row[colName].(string)
+					cat.quarantine(&Quarantine{Database: db.Name, Name: db.Name, Kind: QUARANTINE_SETTINGS, Path: filepath.Join(db.Directory, db.Name+DB_SETTINGS_EXTENSION), Reason: fmt.Sprintf("settings file does not decode: %s", err.Error())})
+				}
 
-			// Split the date and time parts
-			datePart := original[:10]
-			timePart := original[11:]
+				// Within databases directory there are table directories
+				tblDirs, err := os.ReadDir(fmt.Sprintf("%s", db.Directory))
+				if err != nil {
+					return err
+				}
 
-			// Extract hours, minutes, and seconds
-			hours := timePart[:2]
-			minutes := timePart[2:4]
-			seconds := timePart[4:]
+				db.Tables = make(map[string]*Table)
 
-			// Format the new datetime string
-			row[colName] = fmt.Sprintf("%s %s:%s:%s", datePart, hours, minutes, seconds)
+				// Tables are opened on first access, see GetTable
+				for _, tblDir := range tblDirs {
+					if tblDir.IsDir() {
+						// A table copied to the hot tier when the catalog closed, the table is still on the cold tier
+						if strings.HasSuffix(tblDir.Name(), TIER_MOVING_SUFFIX) {
+							err = os.RemoveAll(filepath.Join(db.Directory, tblDir.Name()))
+							if err != nil {
+								return err
+							}
 
-			if !shared.IsValidDateTimeFormat(row[colName].(string)) {
-				return -1, fmt.Errorf("column %s is not a valid datetime", colName)
-			}
+							continue
+						}
 
-			// convert to time.Time
-			t, err := shared.StringToGOTime(row[colName].(string))
-			if err != nil {
-				return -1, fmt.Errorf("column %s is not a valid datetime", colName)
-			}
+						db.Tables[tblDir.Name()] = &Table{
+							Name:      tblDir.Name(),
+							Directory: filepath.Join(db.Directory, tblDir.Name()),
+							Tier:      TIER_HOT,
+							accessed:  time.Now(),
+						}
+					}
+				}
 
-			row[colName] = t
+				err = db.placeTables()
+				if err != nil {
+					return err
+				}
 
-		case "DATE":
-			if _, ok := row[colName].(string); !ok {
-				if colDef.NotNull {
-					return -1, fmt.Errorf("column %s is not a string", colName)
-				} else {
-					continue
+				err = db.markWarm()
+				if err != nil {
+					return err
+				}
+
+				// In safe mode a table failing validation is quarantined instead of failing on first access
+				if cat.SafeMode {
+					for name, tbl := range db.Tables {
+						err = tbl.validate()
+						if err != nil {
+							delete(db.Tables, name)
+							cat.quarantine(&Quarantine{Database: db.Name, Name: name, Kind: QUARANTINE_TABLE, Path: tbl.Directory, Reason: err.Error()})
+						}
+					}
 				}
+
 			}
+		}
 
-			// Check date format
-			// Should be in the format YYYY-MM-DD
-			if !shared.IsValidDateFormat(strings.TrimSuffix(strings.TrimPrefix(row[colName].(string), "'"), "'")) {
-				return -1, fmt.Errorf("column %s is not a valid date", colName)
+	}
+
+	// Open users file
+	cat.Users = make(map[string]*User)
+
+	cat.UsersFile, err = os.OpenFile(filepath.Join(cat.Directory, "users"+SYS_USERS_EXTENSION), os.O_CREATE|os.O_RDWR, 0755)
+	if err != nil {
+		return err
+
+	}
+
+	cat.UsersLock = &sync.Mutex{}
+	cat.UsersFileLock = &sync.Mutex{}
+	cat.DatabasesLock = &sync.Mutex{}
+	cat.ShardsLock = &sync.Mutex{}
+
+	err = cat.readShards()
+	if err != nil {
+		return err
+	}
+
+	err = cat.ReadUsersFromFile()
+	if err != nil {
+
+		if strings.Contains(err.Error(), "users file is empty") {
+			// Without a password given the admin user gets a random one, to be changed on first login
+			if cat.AdminPassword == "" {
+				cat.AdminPassword, err = generatePassword()
+				if err != nil {
+					return err
+				}
+
+				cat.PasswordGenerated = true
 			}
 
-			// convert to time.Time
-			t, err := shared.StringToGOTime(strings.TrimSuffix(strings.TrimPrefix(row[colName].(string), "'"), "'"))
+			// Create default user
+			err = cat.CreateNewUser(DEFAULT_ADMIN_USER, cat.AdminPassword)
 			if err != nil {
-				return -1, fmt.Errorf("column %s is not a valid date", colName)
+				return err
+			}
+
+			cat.Fresh = true
+			cat.Users[DEFAULT_ADMIN_USER].MustChangePassword = cat.PasswordGenerated
+
+			err = cat.GrantPrivilegeToUser(DEFAULT_ADMIN_USER, &Privilege{
+				DatabaseName:     "*",
+				TableName:        "*",
+				PrivilegeActions: []shared.PrivilegeAction{shared.PRIV_ALL},
+			})
+			if err != nil {
+				return err
+			}
+
+		}
+		return err
+	}
+
+	return nil
+}
+
+// Close closes the catalog
+func (cat *Catalog) Close() {
+	for _, db := range cat.Databases {
+		db.ProceduresFile.Close()
+
+		for _, tbl := range db.Tables {
+			tbl.close()
+		}
+	}
+
+	if cat.directoryLock != nil {
+		cat.directoryLock.Unlock()
+		cat.directoryLock = nil
+	}
+
+}
+
+// CreateDatabase create a new database
+func (cat *Catalog) CreateDatabase(name string) error {
+	return cat.CreateDatabaseWithSettings(name, &DatabaseSettings{})
+}
+
+// CreateDatabaseWithSettings creates a new database whose tables are created with the settings as defaults
+func (cat *Catalog) CreateDatabaseWithSettings(name string, settings *DatabaseSettings) (err error) {
+	if settings == nil {
+		settings = &DatabaseSettings{}
+	}
+
+	// Check if database exists
+	if _, ok := cat.Databases[name]; ok {
+		return fmt.Errorf("database %s already exists", name)
+	}
+
+	err = journalBegin(filepath.Join(cat.Directory, "databases"), name, DDL_CREATE, filepath.Join(cat.Directory, "databases", name))
+	if err != nil {
+		return err
+	}
+
+	defer journalEnd(filepath.Join(cat.Directory, "databases"), name, &err)
+
+	// Create database directory
+	err = os.Mkdir(filepath.Join(cat.Directory, "databases", name), 0755)
+	if err != nil {
+		return err
+	}
+
+	// Create database
+	cat.Databases[name] = &Database{
+		Name:               name,
+		Tables:             make(map[string]*Table),
+		TablesLock:         &sync.Mutex{},
+		Procedures:         make(map[string]*Procedure),
+		ProceduresFileLock: &sync.Mutex{},
+		MigrationsLock:     &sync.Mutex{},
+		Settings:           settings,
+		Directory:          filepath.Join(cat.Directory, "databases", name),
+		catalog:            cat,
+	}
+
+	err = cat.Databases[name].writeSettings()
+	if err != nil {
+		return err
+	}
+
+	// Create procedures file
+	procFile, err := os.Create(filepath.Join(cat.Databases[name].Directory, name+DB_PROC_EXTENSION))
+	if err != nil {
+		return err
+	}
+
+	cat.Databases[name].ProceduresFile = procFile
+
+	cat.Databases[name].ProceduresFileLock.Lock()
+	defer cat.Databases[name].ProceduresFileLock.Unlock()
+
+	// Write to procedures file
+	enc := gob.NewEncoder(procFile)
+	err = enc.Encode(cat.Databases[name].Procedures)
+	if err != nil {
+		return err
+
+	}
+
+	return nil
+}
+
+// DropDatabase drops a database by name
+func (cat *Catalog) DropDatabase(name string) (err error) {
+	// Check if database exists
+	if _, ok := cat.Databases[name]; !ok {
+		return fmt.Errorf("database %s does not exist", name)
+	}
+
+	err = journalBegin(filepath.Join(cat.Directory, "databases"), name, DDL_DROP, cat.Databases[name].Directory)
+	if err != nil {
+		return err
+	}
+
+	defer journalEnd(filepath.Join(cat.Directory, "databases"), name, &err)
+
+	// Files can not be removed while open on Windows
+	for _, tbl := range cat.Databases[name].Tables {
+		cat.forgetTable(tbl)
+		tbl.close()
+	}
+
+	if cat.Databases[name].ProceduresFile != nil {
+		cat.Databases[name].ProceduresFile.Close()
+	}
+
+	// Drop database directory
+	err = os.RemoveAll(cat.Databases[name].Directory)
+	if err != nil {
+		return err
+	}
+
+	// and the directory of its tables on the cold tier
+	if cat.ColdDirectory != "" {
+		err = os.RemoveAll(filepath.Join(cat.ColdDirectory, "databases", name))
+		if err != nil {
+			return err
+		}
+	}
+
+	// Drop database
+	delete(cat.Databases, name)
+
+	cat.QuarantinedLock.Lock()
+	cat.Quarantined = slices.DeleteFunc(cat.Quarantined, func(q *Quarantine) bool { return q.Database == name })
+	cat.QuarantinedLock.Unlock()
+
+	return nil
+}
+
+// GetIndexes gets the indexes for a table
+func (tbl *Table) GetIndexes() []*Index {
+	indexes := make([]*Index, 0)
+
+	for _, idx := range tbl.Indexes {
+		indexes = append(indexes, idx)
+
+	}
+
+	return indexes
+
+}
+
+// GetLock get btree lock
+func (idx *Index) GetLock() *sync.Mutex {
+	return idx.lock
+}
+
+// DropTable drops a table by name, a table quarantined by safe mode is dropped with its files
+func (db *Database) DropTable(name string) (err error) {
+	tbl, ok := db.Tables[name]
+	quarantined := db.quarantined(QUARANTINE_TABLE, name)
+
+	// Check if table exists
+	if !ok && quarantined == nil {
+		return fmt.Errorf("table %s does not exist", name)
+	}
+
+	// A table on the cold tier is dropped from the cold directory
+	directory := filepath.Join(db.Directory, name)
+	if tbl != nil {
+		directory = tbl.Directory
+	}
+
+	// The entry is written next to the table directory, within the cold directory for a table on the cold tier
+	err = journalBegin(filepath.Dir(directory), name, DDL_DROP, directory)
+	if err != nil {
+		return err
+	}
+
+	defer journalEnd(filepath.Dir(directory), name, &err)
+
+	if tbl != nil {
+		if db.catalog != nil {
+			db.catalog.forgetTable(tbl)
+		}
+
+		tbl.close()
+
+		// Drop table
+		delete(db.Tables, name)
+	}
+
+	// Drop table directory
+	err = os.RemoveAll(directory)
+	if err != nil {
+		return err
+	}
+
+	if tbl != nil && tbl.Tier != TIER_HOT {
+		err = db.writeTiers()
+		if err != nil {
+			return err
+		}
+	}
+
+	if tbl != nil && tbl.Warm {
+		err = db.writeWarm()
+		if err != nil {
+			return err
+		}
+	}
+
+	if quarantined != nil {
+		db.catalog.release(quarantined)
+	}
+
+	return nil
+
+}
+
+// CreateTable creates a new table in a schema
+func (db *Database) CreateTable(name string, tblSchema *TableSchema, encrypt bool, compress bool, key []byte) (err error) {
+	if tblSchema == nil {
+		return fmt.Errorf("table schema is nil")
+	}
+
+	if len(name) > MAX_TABLE_NAME_SIZE {
+		return fmt.Errorf("table name is too long, max length is %d", MAX_TABLE_NAME_SIZE)
+	}
+
+	// Check if table exists
+	if _, ok := db.Tables[name]; ok {
+		return fmt.Errorf("table %s already exists", name)
+	}
+
+	// Creating a quarantined table again would truncate its files
+	if db.quarantined(QUARANTINE_TABLE, name) != nil {
+		return fmt.Errorf("table %s is quarantined, drop it first", name)
+	}
+
+	// Without its settings a new table would miss the defaults of the database, such as encryption
+	if db.quarantined(QUARANTINE_SETTINGS, db.Name) != nil {
+		return fmt.Errorf("settings of database %s are quarantined, tables cannot be created", db.Name)
+	}
+
+	err = journalBegin(db.Directory, name, DDL_CREATE, filepath.Join(db.Directory, name))
+	if err != nil {
+		return err
+	}
+
+	defer journalEnd(db.Directory, name, &err)
+
+	// Create table
+	db.Tables[name] = &Table{
+		Name:        name,
+		Indexes:     make(map[string]*Index),
+		Blooms:      make(map[string]*Bloom),
+		TableSchema: tblSchema,
+		Directory:   filepath.Join(db.Directory, name),
+		Tier:        TIER_HOT,
+		accessed:    time.Now(),
+	}
+
+	// Create table directory
+	err = os.Mkdir(filepath.Join(db.Directory, name), 0755)
+	if err != nil {
+		return err
+	}
+
+	sequenceDefined := false
+
+	for colName, colDef := range tblSchema.ColumnDefinitions {
+		if len(colName) > MAX_COLUMN_NAME_SIZE {
+			// delete table
+			delete(db.Tables, name)
+			os.RemoveAll(filepath.Join(db.Directory, name))
+			return fmt.Errorf("column name is too long, max length is %d", MAX_COLUMN_NAME_SIZE)
+		}
+
+		if !shared.IsValidDataType(colDef.DataType) {
+			delete(db.Tables, name)
+			os.RemoveAll(filepath.Join(db.Directory, name))
+			return fmt.Errorf("invalid data type %s", colDef.DataType)
+		}
+
+		if colDef.Unique {
+			err = db.Tables[name].CreateIndex(fmt.Sprintf("unique_%s", colName), []string{colName}, true)
+			if err != nil {
+				delete(db.Tables, name)
+				os.RemoveAll(filepath.Join(db.Directory, name))
+				return err
+			}
+		} else if colDef.References != nil {
+			// Foreign key columns are joined on and looked up by, they are indexed unless unique already
+			err = db.Tables[name].CreateIndex(fmt.Sprintf("%s%s", FOREIGN_KEY_INDEX_PREFIX, colName), []string{colName}, false)
+			if err != nil {
+				delete(db.Tables, name)
+				os.RemoveAll(filepath.Join(db.Directory, name))
+				return err
+			}
+		}
+
+		if colDef.Sequence {
+			if sequenceDefined {
+				delete(db.Tables, name)
+				os.RemoveAll(filepath.Join(db.Directory, name))
+				return fmt.Errorf("only one sequence column is allowed per table")
+			}
+
+			// Sequenced column must be unique and not null
+
+			if !colDef.Unique || !colDef.NotNull {
+				delete(db.Tables, name)
+				os.RemoveAll(filepath.Join(db.Directory, name))
+				return fmt.Errorf("sequence column %s must be unique and not null", colName)
+			}
+
+			// Datatype MUST be an integer
+			if strings.ToUpper(colDef.DataType) != "INT" && strings.ToUpper(colDef.DataType) != "INTEGER" {
+				delete(db.Tables, name)
+				os.RemoveAll(filepath.Join(db.Directory, name))
+				return fmt.Errorf("sequence column %s must be an integer", colName)
+			}
+
+			sequenceDefined = true
+		}
+
+		switch strings.ToUpper(colDef.DataType) {
+		case "CHARACTER", "CHAR":
+			// A character datatype requires a length
+			if colDef.Length == 0 {
+				delete(db.Tables, name)
+				os.RemoveAll(filepath.Join(db.Directory, name))
+				return fmt.Errorf("column %s requires a length", colName)
+			}
+		case "NUMERIC", "DECIMAL", "DEC", "FLOAT", "DOUBLE", "REAL":
+			// A numeric datatype requires a precision and scale
+			if colDef.Precision == 0 {
+				delete(db.Tables, name)
+				os.RemoveAll(filepath.Join(db.Directory, name))
+				return fmt.Errorf("column %s requires a precision", colName)
+			}
+
+			if colDef.Scale == 0 {
+				delete(db.Tables, name)
+				os.RemoveAll(filepath.Join(db.Directory, name))
+				return fmt.Errorf("column %s requires a scale", colName)
+			}
+		case "INT", "INTEGER", "SMALLINT":
+		case "DATE", "TIME", "TIMESTAMP", "DATETIME":
+		case "BINARY":
+		case "UUID":
+		case "BOOLEAN", "BOOL":
+		case "TEXT":
+		case "BLOB":
+
+		default:
+			delete(db.Tables, name)
+			os.RemoveAll(filepath.Join(db.Directory, name))
+			return fmt.Errorf("invalid data type %s", colDef.DataType)
+		}
+	}
+
+	if encrypt {
+		db.Tables[name].Encrypt = true
+
+		// sha256 hash the key
+		hash := sha256.New()
+
+		// Write data to the hash
+		hash.Write(key)
+
+		// Calculate the hash
+		hashBytes := hash.Sum(nil)
+
+		db.Tables[name].HashedKey = [32]byte(hashBytes)
+
+		// The nonce is 12 bytes of the end of the hash
+		db.Tables[name].Nonce = [12]byte{}
+		db.Tables[name].Nonce = [12]byte(append(db.Tables[name].Nonce[:], hashBytes[len(hashBytes)-12:]...))
+	}
+
+	if compress {
+		db.Tables[name].Compress = true
+		tblSchema.Compress = true
+	}
+
+	// Create sequence file
+	seqFile, err := storage.OpenFile(filepath.Join(db.Tables[name].Directory, name+DB_SCHEMA_TABLE_SEQ_FILE_EXTENSION), os.O_CREATE|os.O_RDWR|os.O_TRUNC, 0755)
+	if err != nil {
+		delete(db.Tables, name)
+		os.RemoveAll(filepath.Join(db.Directory, name))
+		return err
+	}
+
+	schemaFile, err := os.Create(filepath.Join(db.Tables[name].Directory, name+DB_SCHEMA_TABLE_SCHEMA_FILE_EXTENSION))
+	if err != nil {
+		delete(db.Tables, name)
+		os.RemoveAll(filepath.Join(db.Directory, name))
+		return err
+	}
+
+	defer schemaFile.Close()
+
+	// Encode schema to file
+	enc := gob.NewEncoder(schemaFile)
+
+	err = enc.Encode(tblSchema)
+	if err != nil {
+		delete(db.Tables, name)
+		os.RemoveAll(filepath.Join(db.Directory, name))
+		return err
+	}
+
+	// Create btree pager
+	rowFile, err := btree.OpenPager(filepath.Join(db.Tables[name].Directory, name+DB_SCHEMA_TABLE_DATA_FILE_EXTENSION), os.O_CREATE|os.O_RDWR, 0755)
+	if err != nil {
+		delete(db.Tables, name)
+		os.RemoveAll(filepath.Join(db.Directory, name))
+		return err
+	}
+
+	db.Tables[name].Rows = rowFile
+
+	db.Tables[name].SequenceFile = seqFile
+	db.Tables[name].SeqLock = &sync.Mutex{}
+	db.Tables[name].historyLock = &sync.Mutex{}
+
+	if tblSchema.SystemVersioned {
+		// The history of a system versioned table starts when it is created
+		err = db.Tables[name].openHistory()
+		if err != nil {
+			delete(db.Tables, name)
+			os.RemoveAll(filepath.Join(db.Directory, name))
+			return err
+		}
+	}
+
+	db.Tables[name].loaded = true
+
+	if db.catalog != nil {
+		return db.catalog.touchTable(db.Tables[name])
+	}
+
+	return nil
+}
+
+// GetTable gets a table by name, opening the table files if they are not open
+func (db *Database) GetTable(tableName string) *Table {
+	tbl, ok := db.Tables[tableName]
+	if !ok {
+		return nil
+	}
+
+	if db.catalog == nil {
+		return tbl
+	}
+
+	err := db.catalog.touchTable(tbl)
+	if err != nil {
+		log.Println(err)
+		return nil
+	}
+
+	return tbl
+}
+
+// touchTable opens the table if needed and marks it most recently used
+// The descriptors of least recently used tables are closed once there are more than MaxOpenTables open, the tables
+// stay open so sessions using them are not affected, their files are opened again on next use
+func (cat *Catalog) touchTable(tbl *Table) error {
+	cat.openTablesLock.Lock()
+	defer cat.openTablesLock.Unlock()
+
+	tbl.retention = cat.FlashbackRetention
+	tbl.accessed = time.Now()
+
+	if !tbl.loaded {
+		err := tbl.open()
+		if err != nil {
+			return err
+		}
+	}
+
+	if tbl.lruElement == nil {
+		tbl.lruElement = cat.openTables.PushFront(tbl)
+	} else {
+		cat.openTables.MoveToFront(tbl.lruElement)
+	}
+
+	for cat.MaxOpenTables > 0 && cat.openTables.Len() > cat.MaxOpenTables {
+		evicted := cat.openTables.Back().Value.(*Table)
+		if evicted == tbl {
+			break
+		}
+
+		cat.openTables.Remove(evicted.lruElement)
+		evicted.lruElement = nil
+		evicted.idle()
+	}
+
+	return nil
+}
+
+// forgetTable removes a table from the open tables
+func (cat *Catalog) forgetTable(tbl *Table) {
+	cat.openTablesLock.Lock()
+	defer cat.openTablesLock.Unlock()
+
+	if tbl.lruElement != nil {
+		cat.openTables.Remove(tbl.lruElement)
+		tbl.lruElement = nil
+	}
+}
+
+// open opens the table schema, data, sequence and index files
+func (tbl *Table) open() error {
+	// Within each table there is a schema file, index files , sequence file, and data file
+
+	// Read schema file
+	schemaFile, err := os.Open(filepath.Join(tbl.Directory, tbl.Name+DB_SCHEMA_TABLE_SCHEMA_FILE_EXTENSION))
+	if err != nil {
+		return err
+	}
+
+	defer schemaFile.Close()
+
+	// Decode schema
+	dec := gob.NewDecoder(schemaFile)
+	tblSchema := &TableSchema{}
+	err = dec.Decode(tblSchema)
+	if err != nil {
+		return err
+	}
+
+	tbl.TableSchema = tblSchema
+	tbl.Compress = tblSchema.Compress
+
+	// Read data file
+	rowFile, err := btree.OpenPager(filepath.Join(tbl.Directory, tbl.Name+DB_SCHEMA_TABLE_DATA_FILE_EXTENSION), os.O_RDWR, 0755)
+	if err != nil {
+		return err
+	}
+
+	tbl.Rows = rowFile
+
+	// Read sequence file
+	seqFile, err := storage.OpenFile(filepath.Join(tbl.Directory, tbl.Name+DB_SCHEMA_TABLE_SEQ_FILE_EXTENSION), os.O_RDWR, 0755)
+	if err != nil {
+		rowFile.Close()
+		return err
+	}
+
+	tbl.SequenceFile = seqFile
+	tbl.SeqLock = &sync.Mutex{}
+	tbl.historyLock = &sync.Mutex{}
+
+	tblFiles, err := os.ReadDir(tbl.Directory)
+	if err != nil {
+		tbl.close()
+		return err
+	}
+
+	tbl.Indexes = make(map[string]*Index)
+
+	for _, tblFile := range tblFiles {
+		if strings.HasSuffix(tblFile.Name(), DB_SCHEMA_TABLE_INDEX_FILE_EXTENSION) {
+			idx, err := tbl.openIndex(tblFile.Name())
+			if err != nil {
+				tbl.close()
+				return err
+			}
+
+			tbl.Indexes[idx.Name] = idx
+		}
+	}
+
+	tbl.Blooms = make(map[string]*Bloom)
+
+	for _, tblFile := range tblFiles {
+		if strings.HasSuffix(tblFile.Name(), DB_SCHEMA_TABLE_BLOOM_FILE_EXTENSION) {
+			b, err := tbl.openBloom(tblFile.Name())
+			if err != nil {
+				tbl.close()
+				return err
+			}
+
+			tbl.Blooms[b.Name] = b
+		}
+	}
+
+	tbl.loaded = true
+
+	return nil
+}
+
+// openIndex opens an index from its index file
+func (tbl *Table) openIndex(fileName string) (*Index, error) {
+	// Read index file
+	indexFile, err := os.Open(filepath.Join(tbl.Directory, fileName))
+	if err != nil {
+		return nil, err
+	}
+
+	defer indexFile.Close()
+
+	// Decode index
+	dec := gob.NewDecoder(indexFile)
+	idx := &Index{}
+	err = dec.Decode(idx)
+	if err != nil {
+		return nil, err
+	}
+
+	// The file name is the name of the index, the name within the file can be from before a rename
+	idx.Name = indexName(fileName)
+
+	// Open btree
+	bt, err := btree.Open(filepath.Join(tbl.Directory, fmt.Sprintf("idx_%s.bt", idx.Name)), os.O_RDWR, 0755, 6)
+	if err != nil {
+		return nil, err
+	}
+
+	idx.btree = bt
+	idx.lock = &sync.Mutex{}
+
+	return idx, nil
+}
+
+// close closes the table files, the table is opened again on next access
+func (tbl *Table) close() {
+	if tbl.Rows != nil {
+		tbl.Rows.Close()
+		tbl.Rows = nil
+	}
+
+	if tbl.SequenceFile != nil {
+		tbl.SequenceFile.Close()
+		tbl.SequenceFile = nil
+	}
+
+	for _, idx := range tbl.Indexes {
+		if idx.btree != nil {
+			idx.btree.Close()
+		}
+	}
+
+	for _, b := range tbl.Blooms {
+		b.file.Close()
+	}
+
+	if tbl.history != nil {
+		tbl.history.Close()
+		tbl.history = nil
+	}
+
+	tbl.Indexes = nil
+	tbl.Blooms = nil
+	tbl.loaded = false
+}
+
+// idle closes the descriptors of the table files which are not in use, they are opened again on next use
+func (tbl *Table) idle() {
+	if tbl.Rows != nil {
+		tbl.Rows.Idle()
+	}
+
+	if tbl.SequenceFile != nil {
+		tbl.SequenceFile.Idle()
+	}
+
+	for _, idx := range tbl.Indexes {
+		if idx.btree != nil {
+			idx.btree.Idle()
+		}
+	}
+
+	for _, b := range tbl.Blooms {
+		b.file.Idle()
+	}
+
+	tbl.historyLock.Lock()
+	defer tbl.historyLock.Unlock()
+
+	if tbl.history != nil {
+		tbl.history.Idle()
+	}
+}
+
+// validate opens the table and checks its files agree with its schema, the table is closed again
+func (tbl *Table) validate() error {
+	err := tbl.open()
+	if err != nil {
+		return fmt.Errorf("table does not open: %s", err.Error())
+	}
+
+	defer tbl.close()
+
+	if len(tbl.TableSchema.ColumnDefinitions) == 0 {
+		return errors.New("schema has no columns")
+	}
+
+	for _, idx := range tbl.Indexes {
+		for _, column := range idx.Columns {
+			if _, ok := tbl.TableSchema.ColumnDefinitions[column]; !ok {
+				return fmt.Errorf("index %s is on column %s which is not in the schema", idx.Name, column)
+			}
+		}
+	}
+
+	for _, b := range tbl.Blooms {
+		if _, ok := tbl.TableSchema.ColumnDefinitions[b.Column]; !ok {
+			return fmt.Errorf("bloom filter %s is on column %s which is not in the schema", b.Name, b.Column)
+		}
+	}
+
+	stat, err := os.Stat(filepath.Join(tbl.Directory, tbl.Name+DB_SCHEMA_TABLE_DATA_FILE_EXTENSION))
+	if err != nil {
+		return err
+	}
+
+	if stat.Size()%int64(btree.PAGE_SIZE+btree.HEADER_SIZE) != 0 {
+		return fmt.Errorf("data file ends with a partial page of %d bytes", stat.Size()%int64(btree.PAGE_SIZE+btree.HEADER_SIZE))
+	}
+
+	seq, err := tbl.SequenceFile.ReadAll()
+	if err != nil {
+		return err
+	}
+
+	if len(seq) > 0 {
+		if _, err := strconv.Atoi(string(seq)); err != nil {
+			return fmt.Errorf("sequence file does not hold a number")
+		}
+	}
+
+	return nil
+}
+
+// quarantine records an object quarantined by safe mode
+func (cat *Catalog) quarantine(q *Quarantine) {
+	cat.QuarantinedLock.Lock()
+	defer cat.QuarantinedLock.Unlock()
+
+	log.Printf("safe mode: quarantined %s %s of database %s: %s", strings.ToLower(q.Kind), q.Name, q.Database, q.Reason)
+
+	cat.Quarantined = append(cat.Quarantined, q)
+}
+
+// release removes an object from the quarantined objects once it is dropped
+func (cat *Catalog) release(q *Quarantine) {
+	cat.QuarantinedLock.Lock()
+	defer cat.QuarantinedLock.Unlock()
+
+	cat.Quarantined = slices.DeleteFunc(cat.Quarantined, func(o *Quarantine) bool { return o == q })
+}
+
+// GetQuarantined returns the objects quarantined by safe mode
+func (cat *Catalog) GetQuarantined() []*Quarantine {
+	cat.QuarantinedLock.Lock()
+	defer cat.QuarantinedLock.Unlock()
+
+	return slices.Clone(cat.Quarantined)
+}
+
+// quarantined returns the object of the database quarantined by safe mode, nil if not quarantined
+func (db *Database) quarantined(kind, name string) *Quarantine {
+	if db.catalog == nil {
+		return nil
+	}
+
+	db.catalog.QuarantinedLock.Lock()
+	defer db.catalog.QuarantinedLock.Unlock()
+
+	for _, q := range db.catalog.Quarantined {
+		if q.Database == db.Name && q.Kind == kind && q.Name == name {
+			return q
+		}
+	}
+
+	return nil
+}
+
+// CreateIndex creates a new index on a table
+func (tbl *Table) CreateIndex(name string, columns []string, unique bool) (err error) {
+	if len(name) > MAX_INDEX_NAME_SIZE {
+		return fmt.Errorf("index name is too long, max length is %d", MAX_INDEX_NAME_SIZE)
+	}
+
+	// Check if index exists
+	if _, ok := tbl.Indexes[name]; ok {
+		return fmt.Errorf("index %s already exists", name)
+	}
+
+	err = journalBegin(tbl.Directory, fmt.Sprintf("idx_%s", name), DDL_CREATE, tbl.indexPaths(name)...)
+	if err != nil {
+		return err
+	}
+
+	defer journalEnd(tbl.Directory, fmt.Sprintf("idx_%s", name), &err)
+
+	bt, err := btree.Open(filepath.Join(tbl.Directory, fmt.Sprintf("idx_%s.bt", name)), os.O_CREATE|os.O_RDWR, 0755, 6)
+	if err != nil {
+		return err
+	}
+
+	idx := &Index{
+		Name:    name,
+		Columns: columns,
+		Unique:  unique,
+		btree:   bt,
+		lock:    &sync.Mutex{},
+	}
+
+	// fail removes the files of the index which could not be created
+	fail := func(err error) error {
+		bt.Close()
+
+		for _, path := range tbl.indexPaths(name) {
+			os.Remove(path)
+		}
+
+		return err
+	}
+
+	// Index the rows of the table, lookups answered from the index alone must see every row
+	// Indexes of a table being created are created before its data file
+	iter := tbl.NewIterator()
+	for tbl.Rows != nil && iter.Valid() {
+		row, err := iter.Next()
+		if err != nil {
+			return fail(err)
+		}
+
+		// Overflow pages do not decode
+		if row == nil {
+			continue
+		}
+
+		rowId := iter.Current() - 1
+
+		for _, col := range columns {
+			// NULLs are never duplicates, buckets of an encrypted table hold many values
+			if unique && len(columns) == 1 && row[col] != nil && !tbl.Encrypt {
+				key, err := bt.Get(tbl.IndexKey(row[col]))
+				if err != nil {
+					return fail(err)
+				}
+
+				if key != nil && len(key.V) > 0 {
+					return fail(fmt.Errorf("column %s holds %v more than once", col, row[col]))
+				}
+			}
+
+			err = bt.Put(tbl.IndexKey(row[col]), []byte(fmt.Sprintf("%d", rowId)))
+			if err != nil {
+				return fail(err)
+			}
+		}
+	}
+
+	// Create index file
+	indexFile, err := os.Create(filepath.Join(tbl.Directory, fmt.Sprintf("idx_%s%s", name, DB_SCHEMA_TABLE_INDEX_FILE_EXTENSION)))
+	if err != nil {
+		return fail(err)
+	}
+
+	defer indexFile.Close()
+
+	// Encode index to file
+	enc := gob.NewEncoder(indexFile)
+
+	err = enc.Encode(idx)
+	if err != nil {
+		return fail(err)
+	}
+
+	// Create index, only once its files are written as a failed create is rolled back
+	tbl.Indexes[name] = idx
+
+	return nil
+
+}
+
+// indexName returns the name of an index from the name of its index file
+func indexName(fileName string) string {
+	return strings.TrimSuffix(strings.TrimPrefix(fileName, "idx_"), DB_SCHEMA_TABLE_INDEX_FILE_EXTENSION)
+}
+
+// indexPaths returns the files of an index
+func (tbl *Table) indexPaths(name string) []string {
+	return []string{
+		filepath.Join(tbl.Directory, fmt.Sprintf("idx_%s%s", name, DB_SCHEMA_TABLE_INDEX_FILE_EXTENSION)),
+		filepath.Join(tbl.Directory, fmt.Sprintf("idx_%s.bt", name)),
+		filepath.Join(tbl.Directory, fmt.Sprintf("idx_%s.bt.del", name)),
+		filepath.Join(tbl.Directory, fmt.Sprintf("idx_%s.bt%s", name, btree.DIRTY_PAGES_EXTENSION)),
+	}
+}
+
+// DropIndex drops an index by name
+func (tbl *Table) DropIndex(name string) (err error) {
+	// Check if index exists
+	if _, ok := tbl.Indexes[name]; !ok {
+		return fmt.Errorf("index %s does not exist", name)
+	}
+
+	err = journalBegin(tbl.Directory, fmt.Sprintf("idx_%s", name), DDL_DROP, tbl.indexPaths(name)...)
+	if err != nil {
+		return err
+	}
+
+	defer journalEnd(tbl.Directory, fmt.Sprintf("idx_%s", name), &err)
+
+	// Files can not be removed while open on Windows
+	tbl.Indexes[name].btree.Close()
+
+	// Drop index
+	delete(tbl.Indexes, name)
+
+	// Drop index files
+	for _, path := range tbl.indexPaths(name) {
+		err = os.Remove(path)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// RenameIndex renames an index, its files are renamed under a journal entry so an interrupted rename is finished on recovery
+func (tbl *Table) RenameIndex(name, newName string) (err error) {
+	if len(newName) > MAX_INDEX_NAME_SIZE {
+		return fmt.Errorf("index name is too long, max length is %d", MAX_INDEX_NAME_SIZE)
+	}
+
+	idx, ok := tbl.Indexes[name]
+	if !ok {
+		return fmt.Errorf("index %s does not exist", name)
+	}
+
+	if _, ok := tbl.Indexes[newName]; ok {
+		return fmt.Errorf("index %s already exists", newName)
+	}
+
+	idx.lock.Lock()
+	defer idx.lock.Unlock()
+
+	paths, newPaths := tbl.indexPaths(name), tbl.indexPaths(newName)
+
+	err = journalRename(tbl.Directory, fmt.Sprintf("idx_%s", name), paths, newPaths)
+	if err != nil {
+		return err
+	}
+
+	defer journalEnd(tbl.Directory, fmt.Sprintf("idx_%s", name), &err)
+
+	// Files can not be renamed while open on Windows
+	idx.btree.Close()
+
+	for i, path := range paths {
+		err = os.Rename(path, newPaths[i])
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	idx.Name = newName
+
+	// Rewrite the index file so the name within it matches
+	err = tbl.writeIndexFile(idx)
+	if err != nil {
+		return err
+	}
+
+	idx.btree, err = btree.Open(newPaths[1], os.O_RDWR, 0755, 6)
+	if err != nil {
+		return err
+	}
+
+	delete(tbl.Indexes, name)
+	tbl.Indexes[newName] = idx
+
+	return nil
+}
+
+// SetIndexVisible makes an index visible or invisible to the optimizer, an invisible index is still maintained
+func (tbl *Table) SetIndexVisible(name string, visible bool) error {
+	idx, ok := tbl.Indexes[name]
+	if !ok {
+		return fmt.Errorf("index %s does not exist", name)
+	}
+
+	idx.lock.Lock()
+	defer idx.lock.Unlock()
+
+	idx.Invisible = !visible
+
+	return tbl.writeIndexFile(idx)
+}
+
+// writeIndexFile rewrites the index file of an index, it is replaced as a whole
+func (tbl *Table) writeIndexFile(idx *Index) error {
+	path := tbl.indexPaths(idx.Name)[0]
+
+	indexFile, err := os.Create(path + ".tmp")
+	if err != nil {
+		return err
+	}
+
+	err = gob.NewEncoder(indexFile).Encode(idx)
+	indexFile.Close()
+	if err != nil {
+		os.Remove(path + ".tmp")
+		return err
+	}
+
+	return os.Rename(path+".tmp", path)
+}
+
+// bloomPaths returns the files of a bloom filter
+func (tbl *Table) bloomPaths(name string) []string {
+	return []string{
+		filepath.Join(tbl.Directory, fmt.Sprintf("bloom_%s%s", name, DB_SCHEMA_TABLE_BLOOM_FILE_EXTENSION)),
+		filepath.Join(tbl.Directory, fmt.Sprintf("bloom_%s%s", name, DB_SCHEMA_TABLE_BLOOM_BITS_FILE_EXTENSION)),
+	}
+}
+
+// openBloom opens a bloom filter from its bloom filter file, its bits are read into memory
+func (tbl *Table) openBloom(fileName string) (*Bloom, error) {
+	bloomFile, err := os.Open(filepath.Join(tbl.Directory, fileName))
+	if err != nil {
+		return nil, err
+	}
+
+	defer bloomFile.Close()
+
+	b := &Bloom{}
+	err = gob.NewDecoder(bloomFile).Decode(b)
+	if err != nil {
+		return nil, err
+	}
+
+	b.file, err = storage.OpenFile(tbl.bloomPaths(b.Name)[1], os.O_CREATE|os.O_RDWR, 0755)
+	if err != nil {
+		return nil, err
+	}
+
+	b.bits, err = b.file.ReadAll()
+	if err != nil {
+		b.file.Close()
+		return nil, err
+	}
+
+	// Bytes past the last bit set were never written, the segment is padded back to its size
+	if len(b.bits)%BLOOM_SEGMENT_BYTES != 0 {
+		b.bits = append(b.bits, make([]byte, BLOOM_SEGMENT_BYTES-len(b.bits)%BLOOM_SEGMENT_BYTES)...)
+	}
+
+	b.lock = &sync.Mutex{}
+
+	return b, nil
+}
+
+// CreateBloomFilter creates a bloom filter on a column, filled from the rows of the table
+func (tbl *Table) CreateBloomFilter(name, column string) (err error) {
+	if len(name) > MAX_INDEX_NAME_SIZE {
+		return fmt.Errorf("bloom filter name is too long, max length is %d", MAX_INDEX_NAME_SIZE)
+	}
+
+	if _, ok := tbl.Blooms[name]; ok {
+		return fmt.Errorf("bloom filter %s already exists", name)
+	}
+
+	colDef, ok := tbl.TableSchema.ColumnDefinitions[column]
+	if !ok {
+		return fmt.Errorf("column %s does not exist", column)
+	}
+
+	// Values of these columns are compared after conversion so their keys would not match the values searched for
+	switch strings.ToUpper(colDef.DataType) {
+	case "DATE", "TIME", "DATETIME", "TIMESTAMP", "BLOB", "BINARY":
+		return fmt.Errorf("bloom filters are not supported on %s columns", strings.ToUpper(colDef.DataType))
+	}
+
+	paths := tbl.bloomPaths(name)
+
+	err = journalBegin(tbl.Directory, fmt.Sprintf("bloom_%s", name), DDL_CREATE, paths...)
+	if err != nil {
+		return err
+	}
+
+	defer journalEnd(tbl.Directory, fmt.Sprintf("bloom_%s", name), &err)
+
+	b := &Bloom{Name: name, Column: column, lock: &sync.Mutex{}}
+
+	// Fill the bits from the rows of the table
+	iter := tbl.NewIterator()
+	for iter.Valid() {
+		row, err := iter.Next()
+		if err != nil {
+			return err
+		}
+
+		// Overflow pages do not decode
+		if row == nil {
+			continue
+		}
+
+		b.set(iter.Current()-1, tbl.IndexKey(row[column]))
+	}
+
+	b.file, err = storage.OpenFile(paths[1], os.O_CREATE|os.O_RDWR|os.O_TRUNC, 0755)
+	if err != nil {
+		return err
+	}
+
+	if len(b.bits) > 0 {
+		_, err = b.file.WriteAt(b.bits, 0)
+		if err != nil {
+			b.file.Close()
+			return err
+		}
+	}
+
+	bloomFile, err := os.Create(paths[0])
+	if err != nil {
+		b.file.Close()
+		return err
+	}
+
+	defer bloomFile.Close()
+
+	err = gob.NewEncoder(bloomFile).Encode(b)
+	if err != nil {
+		b.file.Close()
+		return err
+	}
+
+	tbl.Blooms[name] = b
+
+	return nil
+}
+
+// DropBloomFilter drops a bloom filter by name
+func (tbl *Table) DropBloomFilter(name string) (err error) {
+	b, ok := tbl.Blooms[name]
+	if !ok {
+		return fmt.Errorf("bloom filter %s does not exist", name)
+	}
+
+	err = journalBegin(tbl.Directory, fmt.Sprintf("bloom_%s", name), DDL_DROP, tbl.bloomPaths(name)...)
+	if err != nil {
+		return err
+	}
+
+	defer journalEnd(tbl.Directory, fmt.Sprintf("bloom_%s", name), &err)
+
+	// Files can not be removed while open on Windows
+	b.file.Close()
+
+	delete(tbl.Blooms, name)
+
+	for _, path := range tbl.bloomPaths(name) {
+		err = os.Remove(path)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// GetBloomFilters returns the bloom filters of the table by name
+func (tbl *Table) GetBloomFilters() []*Bloom {
+	blooms := make([]*Bloom, 0, len(tbl.Blooms))
+	for _, b := range tbl.Blooms {
+		blooms = append(blooms, b)
+	}
+
+	sort.Slice(blooms, func(i, j int) bool {
+		return blooms[i].Name < blooms[j].Name
+	})
+
+	return blooms
+}
+
+// BloomFilterColumn returns a bloom filter on a column, nil if there is none
+func (tbl *Table) BloomFilterColumn(column string) *Bloom {
+	for _, b := range tbl.GetBloomFilters() {
+		if b.Column == column {
+			return b
+		}
+	}
+
+	return nil
+}
+
+// bloomBits returns the bits a key sets within a segment, double hashing one 64 bit hash
+func bloomBits(key []byte) [BLOOM_HASHES]uint32 {
+	h := fnv.New64a()
+	h.Write(key)
+	sum := h.Sum64()
+
+	h1, h2 := uint32(sum), uint32(sum>>32)|1
+
+	var bits [BLOOM_HASHES]uint32
+	for i := range bits {
+		bits[i] = (h1 + uint32(i)*h2) % (BLOOM_SEGMENT_BYTES * 8)
+	}
+
+	return bits
+}
+
+// set sets the bits of a key within the segment of a row, returns the offsets of the bytes changed
+// The bloom filter lock must be held or the filter not shared yet
+func (b *Bloom) set(rowId int64, key []byte) []int64 {
+	offset := rowId / BLOOM_SEGMENT_ROWS * BLOOM_SEGMENT_BYTES
+
+	if int64(len(b.bits)) < offset+BLOOM_SEGMENT_BYTES {
+		b.bits = append(b.bits, make([]byte, offset+BLOOM_SEGMENT_BYTES-int64(len(b.bits)))...)
+	}
+
+	var changed []int64
+
+	for _, bit := range bloomBits(key) {
+		i := offset + int64(bit/8)
+		if b.bits[i]&(1<<(bit%8)) == 0 {
+			b.bits[i] |= 1 << (bit % 8)
+			changed = append(changed, i)
+		}
+	}
+
+	return changed
+}
+
+// add adds the key of a row to the bloom filter, the bytes changed are written to the bits file
+func (b *Bloom) add(rowId int64, key []byte) error {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	for _, i := range b.set(rowId, key) {
+		_, err := b.file.WriteAt(b.bits[i:i+1], i)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// mayContain returns false if no row within a segment holds a key, segments past the bits are never skipped
+func (b *Bloom) mayContain(segment int64, bits [BLOOM_HASHES]uint32) bool {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	offset := segment * BLOOM_SEGMENT_BYTES
+	if offset+BLOOM_SEGMENT_BYTES > int64(len(b.bits)) {
+		return true
+	}
+
+	for _, bit := range bits {
+		if b.bits[offset+int64(bit/8)]&(1<<(bit%8)) == 0 {
+			return false
+		}
+	}
+
+	return true
+}
+
+// BloomScanIO returns the amount of rows within the segments an equality scan on a bloom filter reads
+func (tbl *Table) BloomScanIO(b *Bloom, value interface{}) int64 {
+	bits := bloomBits(tbl.IndexKey(value))
+	count := tbl.Rows.Count()
+
+	var io int64
+	for segment := int64(0); segment*BLOOM_SEGMENT_ROWS < count; segment++ {
+		if b.mayContain(segment, bits) {
+			io += min(BLOOM_SEGMENT_ROWS, count-segment*BLOOM_SEGMENT_ROWS)
+		}
+	}
+
+	return io
+}
+
+// GetDatabase gets a database by name
+func (cat *Catalog) GetDatabase(name string) *Database {
+
+	return cat.Databases[name]
+
+	return nil
+}
+
+// GetIndex gets an index by name
+func (tbl *Table) GetIndex(name string) *Index {
+	return tbl.Indexes[name]
+}
+
+// Insert inserts rows into the table, in order
+// If a row fails the rows inserted before it are returned with the error, the row failing is the next
+func (tbl *Table) Insert(rows []map[string]interface{}, db *Database) ([]int64, []map[string]interface{}, error) {
+	rowIds := make([]int64, 0)                        // inserted row ids
+	insertedRows := make([]map[string]interface{}, 0) // inserted rows
+
+	for start := 0; start < len(rows); start += INDEX_BATCH_ROWS {
+		batch := rows[start:min(start+INDEX_BATCH_ROWS, len(rows))]
+
+		// Unique keys of the rows written within the batch, they are not within the indexes yet
+		pending := make(map[string]map[string]bool)
+
+		var err error
+		written := 0
+
+		for _, row := range batch {
+			// Insert row into table
+			var rowId int64
+			rowId, err = tbl.insert(row, db, pending)
+			if err != nil {
+				break
+			}
+
+			rowIds = append(rowIds, rowId)
+			insertedRows = append(insertedRows, row)
+			written++
+		}
+
+		// Rows written before a row failing are indexed too
+		indexErr := tbl.indexRows(rowIds[len(rowIds)-written:], insertedRows[len(insertedRows)-written:])
+		if indexErr != nil {
+			return rowIds[:len(rowIds)-written], insertedRows[:len(insertedRows)-written], indexErr
+		}
+
+		if err != nil {
+			return rowIds, insertedRows, err
+		}
+	}
+
+	return rowIds, insertedRows, nil
+}
+
+// indexRows puts rows written into the table indexes, up to INDEX_WORKERS indexes at once
+// An index is put into by one worker holding its lock, lookups wait for the batch
+func (tbl *Table) indexRows(rowIds []int64, rows []map[string]interface{}) error {
+	if len(rowIds) == 0 || len(tbl.Indexes) == 0 {
+		return nil
+	}
+
+	indexes := make(chan *Index, len(tbl.Indexes))
+	for _, idx := range tbl.Indexes {
+		indexes <- idx
+	}
+	close(indexes)
+
+	errs := make(chan error, len(tbl.Indexes))
+	wg := &sync.WaitGroup{}
+
+	for i := 0; i < min(INDEX_WORKERS, len(tbl.Indexes)); i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for idx := range indexes {
+				errs <- tbl.indexBatch(idx, rowIds, rows)
+			}
+		}()
+	}
+
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// indexBatch puts rows into an index, a key per indexed column of a row
+func (tbl *Table) indexBatch(idx *Index, rowIds []int64, rows []map[string]interface{}) error {
+	wait.Lock(idx.lock, wait.INDEX_LOCK)
+	defer idx.lock.Unlock()
+
+	for i, row := range rows {
+		for _, col := range idx.Columns {
+			val, ok := row[col]
+			if !ok {
+				continue
+			}
+
+			err := idx.btree.Put(tbl.IndexKey(val), []byte(fmt.Sprintf("%d", rowIds[i])))
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// insert writes a row into the table, the row is indexed by Insert with the rest of its batch
+// pending holds the unique keys by column of the rows of the batch written before it
+func (tbl *Table) insert(row map[string]interface{}, db *Database, pending map[string]map[string]bool) (int64, error) {
+	// Check row against schema
+	for colName, colDef := range tbl.TableSchema.ColumnDefinitions {
+
+		if colDef.NotNull && !colDef.Sequence {
+			if _, ok := row[colName]; !ok {
+				return -1, fmt.Errorf("column %s cannot be null", colName)
+			}
+		}
+
+		// Check if row column exists if not set to NULL
+		if _, ok := row[colName]; !ok {
+			row[colName] = nil
+		}
+
+		switch strings.ToUpper(colDef.DataType) {
+		case "TEXT":
+			if _, ok := row[colName].(string); !ok {
+				return -1, fmt.Errorf("column %s is not a string", colName)
+			}
+
+			if !utf8.ValidString(row[colName].(string)) {
+				return -1, fmt.Errorf("column %s is not valid UTF-8", colName)
+			}
+
+		case "BOOL", "BOOLEAN":
+			if _, ok := row[colName].(bool); !ok {
+				return -1, fmt.Errorf("column %s is not a boolean", colName)
+			}
+		case "BLOB":
+			if _, ok := row[colName].(string); !ok {
+				return -1, fmt.Errorf("column %s is not a string", colName)
+			}
+
+			var err error
+
+			// Decode hex (0x0102030405060708090A0B0C0D0E0F10)
+			row[colName], err = hex.DecodeString(row[colName].(string))
+			if err != nil {
+				return -1, fmt.Errorf("column %s is not a valid binary", colName)
+			}
+		case "BINARY":
+			if _, ok := row[colName].(string); !ok {
+				return -1, fmt.Errorf("column %s is not a string", colName)
+			}
+
+			// Check length
+			if len(row[colName].(string)) > colDef.Length {
+				return -1, fmt.Errorf("column %s is too long", colName)
+			}
+
+			var err error
+
+			// Decode hex (0x0102030405060708090A0B0C0D0E0F10)
+			row[colName], err = hex.DecodeString(row[colName].(string))
+			if err != nil {
+				return -1, fmt.Errorf("column %s is not a valid binary", colName)
+			}
+
+		case "UUID":
+			// A UUID not given is generated by the default of the column
+			if row[colName] == nil {
+				if _, ok := colDef.Default.(*shared.GenUUID); ok {
+					row[colName] = shared.GenerateUUID()
+				} else if _, ok := colDef.Default.(*shared.GenUUIDv7); ok {
+					row[colName] = shared.GenerateUUIDv7()
+				} else if colDef.NotNull {
+					return -1, fmt.Errorf("column %s cannot be null", colName)
+				} else {
+					continue
+				}
+			}
+
+			if _, ok := row[colName].(string); !ok {
+				return -1, fmt.Errorf("column %s is not a string", colName)
+			}
+
+			// Check if valid UUID
+			_, err := uuid.Parse(shared.UnquoteLiteral(row[colName].(string)))
+			if err != nil {
+				return -1, errors.New(fmt.Sprintf("'%s' is not a valid UUID\n", row[colName].(string)))
+			}
+		case "DATETIME", "TIMESTAMP":
+			// A time generated by a replicated statement is kept
+			if _, ok := row[colName].(time.Time); ok {
+				continue
+			}
+
+			if _, ok := row[colName].(string); !ok {
+				if colDef.NotNull {
+					return -1, fmt.Errorf("column %s is not a string", colName)
+				} else if colDef.Default != nil {
+					if _, ok := colDef.Default.(*shared.SysDate); ok {
+						row[colName] = shared.Now()
+					} else if _, ok := colDef.Default.(*shared.SysTime); ok {
+						row[colName] = shared.Now()
+					} else if _, ok := colDef.Default.(*shared.SysTimestamp); ok {
+						row[colName] = shared.Now()
+					}
+
+					continue
+				} else {
+					continue
+				}
+			}
+
+			// Check date format
+			// Should be in the format YYYY-MM-DD HH:MM:SS
+
+			// convert 2024-09-14 153201 to 2024-09-14 15:32:01
+			row[colName] = strings.TrimSuffix(strings.TrimPrefix(row[colName].(string), "'"), "'")
+
+			original := row[colName].(string)
+
+			// Split the date and time parts
+			datePart := original[:10]
+			timePart := original[11:]
+
+			// Extract hours, minutes, and seconds
+			hours := timePart[:2]
+			minutes := timePart[2:4]
+			seconds := timePart[4:]
+
+			// Format the new datetime string
+			row[colName] = fmt.Sprintf("%s %s:%s:%s", datePart, hours, minutes, seconds)
+
+			if !shared.IsValidDateTimeFormat(row[colName].(string)) {
+				return -1, fmt.Errorf("column %s is not a valid datetime", colName)
+			}
+
+			// convert to time.Time
+			t, err := shared.StringToGOTime(row[colName].(string))
+			if err != nil {
+				return -1, fmt.Errorf("column %s is not a valid datetime", colName)
+			}
+
+			row[colName] = t
+
+		case "DATE":
+			if _, ok := row[colName].(string); !ok {
+				if colDef.NotNull {
+					return -1, fmt.Errorf("column %s is not a string", colName)
+				} else {
+					continue
+				}
+			}
+
+			// Check date format
+			// Should be in the format YYYY-MM-DD
+			if !shared.IsValidDateFormat(strings.TrimSuffix(strings.TrimPrefix(row[colName].(string), "'"), "'")) {
+				return -1, fmt.Errorf("column %s is not a valid date", colName)
+			}
+
+			// convert to time.Time
+			t, err := shared.StringToGOTime(strings.TrimSuffix(strings.TrimPrefix(row[colName].(string), "'"), "'"))
+			if err != nil {
+				return -1, fmt.Errorf("column %s is not a valid date", colName)
+			}
+
+			row[colName] = t
+
+		case "TIME":
+			if _, ok := row[colName].(string); !ok {
+				if colDef.NotNull {
+					return -1, fmt.Errorf("column %s is not a string", colName)
+				} else {
+					continue
+				}
+			}
+
+			// Check date format
+			// Should be in the format HH:MM:SS
+
+			if !shared.IsValidTimeFormat(row[colName].(string)) {
+				return -1, fmt.Errorf("column %s is not a valid time", colName)
+			}
+
+			// convert to time.Time
+			t, err := shared.StringToGOTime(row[colName].(string))
+			if err != nil {
+				return -1, fmt.Errorf("column %s is not a valid date", colName)
+			}
+
+			row[colName] = t
+
+		case "CHARACTER", "CHAR":
+			if _, ok := row[colName].(string); !ok {
+
+				// if column can be null, check if it is null
+				if colDef.NotNull {
+					if row[colName] != nil {
+						return -1, fmt.Errorf("column %s is not a string", colName)
+					}
+				} else {
+					continue
+				}
+
+			} else {
+				if !utf8.ValidString(row[colName].(string)) {
+					return -1, fmt.Errorf("column %s is not valid UTF-8", colName)
+				}
+
+				// Check length, in characters
+				if charLength(row[colName].(string)) > colDef.Length {
+					return -1, fmt.Errorf("column %s is too long", colName)
+				}
+			}
+
+		case "NUMERIC", "DECIMAL", "DEC", "FLOAT", "DOUBLE", "REAL":
+			if _, ok := row[colName].(float64); !ok {
+
+				if colDef.NotNull {
+					if row[colName] != nil {
+						return -1, fmt.Errorf("column %s is not a floating point number", colName)
+					}
+				} else {
+					continue
+				}
+			}
+
+			str := fmt.Sprintf("%.14g", row[colName].(float64))
+
+			// Split the string on the decimal point
+			parts := strings.Split(str, ".")
+
+			if len(parts) > 1 {
+
+				// The scale is the number of digits after the decimal point
+				scale := len(parts[1])
+
+				// The precision is the total number of digits
+				precision := len(parts[0]) + len(parts[1])
+
+				if colDef.Scale > 0 {
+					// Check scale
+
+					if scale > colDef.Scale {
+						return -1, fmt.Errorf("column %s has too many digits after the decimal point", colName)
+					}
+
+				}
+
+				if colDef.Precision > 0 {
+					// Check precision
+					if precision > colDef.Precision {
+						return -1, fmt.Errorf("column %s is too large", colName)
+					}
+				}
+			}
+
+		case "INT", "INTEGER", "SMALLINT":
+			// Check for sequence
+			if colDef.Sequence {
+				// Check if sequence column is unique
+				idx := tbl.CheckIndexedColumn(colName, true)
+				if idx == nil {
+					return -1, fmt.Errorf("sequence column %s must be unique", colName)
+				}
+
+				// Increment sequence
+				seq, err := tbl.IncrementSequence()
+				if err != nil {
+					return -1, err
+				}
+
+				row[colName] = seq
+			}
+
+			if _, ok := row[colName].(int); !ok {
+				if _, ok := row[colName].(uint64); !ok {
+					return -1, fmt.Errorf("column %s is not an int", colName)
+				} else {
+					row[colName] = int(row[colName].(uint64))
+				}
+
+			}
+
+			// Check if value fits in either INT/INTEGER, SMALLINT
+
+			// Check if value fits in INT/INTEGER
+			if strings.ToUpper(colDef.DataType) == "INT" || strings.ToUpper(colDef.DataType) == "INTEGER" {
+				if row[colName].(int) > 2147483647 {
+					return -1, fmt.Errorf("column %s is too large for INT/INTEGER", colName)
+				}
+			}
+
+			// Check if value fits in SMALLINT
+			if strings.ToUpper(colDef.DataType) == "SMALLINT" {
+				if row[colName].(int) > 32767 {
+					return -1, fmt.Errorf("column %s is too large for SMALLINT", colName)
+				}
+			}
+		default:
+			return -1, fmt.Errorf("invalid data type %s", colDef.DataType)
+		}
+
+		if colDef.Unique {
+			// Check if unique key exists
+			if !colDef.Sequence {
+				if _, ok := row[colName]; !ok {
+					return -1, fmt.Errorf("column %s cannot be null", colName)
+				}
+			}
+
+			idx := tbl.CheckIndexedColumn(colName, true)
+			if idx == nil {
+				return -1, fmt.Errorf("problem getting unique rows for column %s", colName)
+			}
+
+			// NULL is not equal to any value, not even NULL, so a unique column holds any amount of NULLs
+			if row[colName] != nil {
+				// Check if unique key exists
+				rowIds, err := tbl.IndexLookup(idx, colName, row[colName])
+				if err != nil {
+					return -1, fmt.Errorf("problem getting unique rows for column %s", colName)
+				}
+
+				if len(rowIds) > 0 || pending[colName][string(EncodeKey(row[colName]))] {
+					return -1, fmt.Errorf("row with %s %v already exists", colName, row[colName])
+				}
+			}
+
+		}
+
+		if colDef.References != nil {
+			// Check if foreign key exists
+			if _, ok := row[colName]; !ok {
+				return -1, fmt.Errorf("column %s cannot be null", colName)
+			}
+
+			// Get referenced table
+			refTbl := db.GetTable(colDef.References.TableName)
+			if refTbl == nil {
+				return -1, fmt.Errorf("foreign key constraint violation on column %s", colName)
+			}
+
+			// Check if foreign key exists
+			idx := refTbl.CheckIndexedColumn(colName, true)
+			if idx == nil {
+				return -1, fmt.Errorf("foreign key constraint violation on column %s", colName)
+			}
+
+			if idx == nil {
+				return -1, fmt.Errorf("foreign key constraint violation on column %s", colName)
+
+			}
+
+		}
+
+	}
+
+	// Write row to table
+	rowId, err := tbl.writeRow(row)
+	if err != nil {
+		return -1, err
+	}
+
+	// The row is written but not indexed yet
+	err = fault.CrashPoint("catalog.insert.row")
+	if err != nil {
+		return -1, err
+	}
+
+	for _, b := range tbl.Blooms {
+		err = b.add(rowId, tbl.IndexKey(row[b.Column]))
+		if err != nil {
+			return -1, err
+		}
+	}
+
+	err = tbl.recordVersion(rowId, nil)
+	if err != nil {
+		return -1, err
+	}
+
+	// Later rows of the batch are checked against the row's unique keys until the batch is indexed
+	for colName, colDef := range tbl.TableSchema.ColumnDefinitions {
+		if colDef.Unique && row[colName] != nil {
+			if pending[colName] == nil {
+				pending[colName] = make(map[string]bool)
+			}
+
+			pending[colName][string(EncodeKey(row[colName]))] = true
+		}
+	}
+
+	return rowId, nil
+}
+
+// GetBtree gets the btree for an index
+func (idx *Index) GetBtree() *btree.BTree {
+	return idx.btree
+}
+
+// IndexKey returns the key a value is stored under within the table indexes, see EncodeKey
+// Compressed tables index the plain value, compression only applies to row data.
+// Encrypted tables index the bucket of the value, see ENCRYPTED_INDEX_BUCKETS
+func (tbl *Table) IndexKey(value interface{}) []byte {
+	if !tbl.Encrypt {
+		return EncodeKey(value)
+	}
+
+	// Buckets are of the value formatted, the rows of an encrypted table cannot be read to move them to buckets of typed keys
+	// Lookups compare every row within the bucket so values formatted alike sharing one is harmless
+	key := []byte(INDEX_NULL_KEY)
+	if value != nil {
+		key = []byte(fmt.Sprintf("%v", value))
+	}
+
+	// Keyed hash of the value, without the table key a bucket tells nothing about the value
+	mac := hmac.New(sha256.New, tbl.HashedKey[:])
+	mac.Write(key)
+
+	bucket := binary.BigEndian.Uint32(mac.Sum(nil)[:4]) % ENCRYPTED_INDEX_BUCKETS
+
+	return []byte(fmt.Sprintf("bucket_%d", bucket))
+}
+
+// EncodeKey returns the typed key of a value, keys compare with bytes.Compare in the order of their values, NULL is INDEX_NULL_KEY
+// Numbers of any type holding the same value within +-2^53 share a key, so 9 sorts before 10 and 10 equals 10.0.  Beyond
+// that float64 does not hold every integer, an integer key is followed by the integer and is not equal to a float key
+// i.e 10 is KEY_NUMBER 0xc0 0x24 0 0 0 0 0 0, 'ten' is KEY_STRING t e n
+func EncodeKey(value interface{}) []byte {
+	switch v := value.(type) {
+	case nil:
+		return []byte(INDEX_NULL_KEY)
+	case bool:
+		if v {
+			return []byte{KEY_BOOL, 1}
+		}
+
+		return []byte{KEY_BOOL, 0}
+	case int:
+		return integerKey(int64(v))
+	case int8:
+		return integerKey(int64(v))
+	case int16:
+		return integerKey(int64(v))
+	case int32:
+		return integerKey(int64(v))
+	case int64:
+		return integerKey(v)
+	case uint:
+		return unsignedKey(uint64(v))
+	case uint8:
+		return integerKey(int64(v))
+	case uint16:
+		return integerKey(int64(v))
+	case uint32:
+		return integerKey(int64(v))
+	case uint64:
+		return unsignedKey(v)
+	case float32:
+		return floatKey(float64(v))
+	case float64:
+		return floatKey(v)
+	case time.Time:
+		return append([]byte{KEY_TIME}, binary.BigEndian.AppendUint64(nil, uint64(v.UnixNano())^1<<63)...)
+	case string:
+		return append([]byte{KEY_STRING}, v...)
+	case []byte:
+		return append([]byte{KEY_BYTES}, v...)
+	}
+
+	return append([]byte{KEY_OTHER}, fmt.Sprintf("%v", value)...)
+}
+
+// floatKey returns the key of a number, the bits of a float64 flipped so they compare in order
+func floatKey(f float64) []byte {
+	// -0 equals 0
+	if f == 0 {
+		f = 0
+	}
+
+	bits := math.Float64bits(f)
+	if f < 0 {
+		bits = ^bits
+	} else {
+		bits |= 1 << 63
+	}
+
+	return binary.BigEndian.AppendUint64([]byte{KEY_NUMBER}, bits)
+}
+
+// integerKey returns the key of an integer, integers float64 cannot hold exactly are followed by the integer to stay distinct
+func integerKey(i int64) []byte {
+	key := floatKey(float64(i))
+
+	if i > 1<<53 || i < -(1<<53) {
+		key = binary.BigEndian.AppendUint64(key, uint64(i)^1<<63)
+	}
+
+	return key
+}
+
+// unsignedKey returns the key of an unsigned integer, an integer int64 cannot hold follows every int64 sharing its float
+// with 8 0xff bytes, the largest int64 suffix, and the integer
+func unsignedKey(u uint64) []byte {
+	if u <= math.MaxInt64 {
+		return integerKey(int64(u))
+	}
+
+	key := append(floatKey(float64(u)), 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff)
+
+	return binary.BigEndian.AppendUint64(key, u)
+}
+
+// IndexLookup returns the row ids within an index where column equals value
+// For encrypted tables every row within the value's bucket is fetched, decrypted and compared
+func (tbl *Table) IndexLookup(idx *Index, column string, value interface{}) ([]int64, error) {
+	rowIds := make([]int64, 0)
+
+	wait.Lock(idx.lock, wait.INDEX_LOCK)
+	key, err := idx.btree.Get(tbl.IndexKey(value))
+	idx.lock.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	if key == nil {
+		return rowIds, nil
+	}
+
+	for _, v := range key.V {
+		// We store a []byte(rowId) in the btree
+		// We need to convert it to an int64
+		rowId, err := strconv.ParseInt(string(v), 10, 64)
+		if err != nil {
+			return nil, err
+		}
+
+		if tbl.Encrypt {
+			row, err := tbl.GetRow(rowId)
+			if err != nil {
+				return nil, err
+			}
+
+			// Bucket is shared with other values
+			if !bytes.Equal(EncodeKey(row[column]), EncodeKey(value)) {
+				continue
+			}
+		}
+
+		rowIds = append(rowIds, rowId)
+	}
+
+	return rowIds, nil
+}
+
+// writeRow writes a row to the table
+func (tbl *Table) writeRow(row map[string]interface{}) (int64, error) {
+	// Write row to table
+
+	// encode row to bytes
+	encoded, err := EncodeRow(row)
+	if err != nil {
+		return -1, err
+	}
+
+	// check if table has compression set
+	if tbl.Compress {
+		// compress row
+		encoded, err = Compress(encoded)
+		if err != nil {
+			return -1, err
+		}
+
+	}
+
+	// Check if table has encryption set
+	if tbl.Encrypt {
+		// encrypt row
+		encoded, err = Encrypt(tbl.HashedKey, tbl.Nonce, encoded)
+		if err != nil {
+			return -1, err
+		}
+	}
+
+	rowId, err := tbl.Rows.Write(encoded)
+	if err != nil {
+		return -1, err
+	}
+
+	return rowId, nil
+}
+
+// EncodeRow encodes a row to a byte slice
+func EncodeRow(n map[string]interface{}) ([]byte, error) {
+	// use gob
+	buff := new(bytes.Buffer)
+
+	enc := gob.NewEncoder(buff)
+	err := enc.Encode(n)
+
+	if err != nil {
+		return nil, err
+
+	}
+
+	return buff.Bytes(), nil
+}
+
+// decodeRow decodes a row from a byte slice
+func decodeRow(b []byte) (map[string]interface{}, error) {
+	var decoded map[string]interface{}
+
+	err := gob.NewDecoder(bytes.NewReader(b)).Decode(&decoded)
+	if err != nil {
+		return nil, err
+	}
+
+	return decoded, nil
+}
+
+// IncrementSequence increments the sequence for the table
+func (tbl *Table) IncrementSequence() (int, error) {
+	wait.Lock(tbl.SeqLock, wait.SEQUENCE_LOCK)
+	defer tbl.SeqLock.Unlock()
+	d, err := tbl.SequenceFile.ReadAll()
+
+	if string(d) == "" {
+		// A sequence not written, such as on a full disk, would be handed out again
+		_, err = tbl.SequenceFile.WriteAt([]byte("1"), 0)
+		if err != nil {
+			return 0, err
+		}
+
+		return 1, nil
+	}
+
+	i, err := strconv.Atoi(string(d))
+	if err != nil {
+		return 0, err
+	}
+
+	j := i + 1
+
+	// Written before truncating so a failed write leaves the previous sequence
+	n, err := tbl.SequenceFile.WriteAt([]byte(fmt.Sprintf("%d", j)), 0)
+	if err != nil {
+		return 0, err
+	}
+
+	tbl.SequenceFile.Truncate(int64(n))
+
+	return j, nil
+
+	return 0, nil
+}
+
+// Iterator is an iterator for rows in a table
+type Iterator struct {
+	table  *Table
+	row    int64
+	blooms []*Bloom               // Bloom filters segments are skipped by, see Prune
+	keys   [][BLOOM_HASHES]uint32 // Bits of the value searched for within each bloom filter
+	only   []int64                // Rows left to return when restricted, see Restrict
+	limit  bool                   // True if the iterator is restricted to only
+	filter *RuntimeFilter         // Runtime filter rows are checked against, see Filter
+	bloom  *Bloom                 // Bloom filter on the column of the runtime filter, segments ruling out every value are skipped
+	values [][BLOOM_HASHES]uint32 // Bits of the values of the runtime filter within the bloom filter
+	stats  FilterStats            // Rows and segments skipped by the runtime filter
+}
+
+// RuntimeFilter is a bloom filter of the values a join can match a column of a table on, built from the smaller input of a hash join
+// Rows of the table the filter rules out are skipped as they are read, before they are returned to the join
+type RuntimeFilter struct {
+	Column string   // Column of the table the values are matched on
+	bits   []uint64 // Bits of the filter
+	values []interface{}
+	keys   int // Values added
+}
+
+// FilterStats are the rows and segments of a table a runtime filter skipped
+type FilterStats struct {
+	Segments int64 // Segments skipped as the bloom filter on the column rules out every value of the runtime filter
+	Rows     int64 // Rows read and skipped as the runtime filter rules out their value
+}
+
+// NewRuntimeFilter returns a runtime filter on a column sized for an amount of values
+func NewRuntimeFilter(column string, values int) *RuntimeFilter {
+	words := max(values*RUNTIME_FILTER_BITS_PER_KEY/64+1, 1)
+
+	return &RuntimeFilter{Column: column, bits: make([]uint64, words)}
+}
+
+// JoinKey returns the key a value is matched on by a join, numbers are keyed by value so 1 matches 1.0
+func JoinKey(value interface{}) string {
+	switch v := value.(type) {
+	case int:
+		return "n" + strconv.FormatFloat(float64(v), 'g', -1, 64)
+	case int64:
+		return "n" + strconv.FormatFloat(float64(v), 'g', -1, 64)
+	case uint64:
+		return "n" + strconv.FormatFloat(float64(v), 'g', -1, 64)
+	case float64:
+		return "n" + strconv.FormatFloat(v, 'g', -1, 64)
+	default:
+		return fmt.Sprintf("%T%v", v, v)
+	}
+}
+
+// positions returns the bits of a value within the filter
+func (f *RuntimeFilter) positions(value interface{}) [BLOOM_HASHES]uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(JoinKey(value)))
+	sum := h.Sum64()
+
+	h1, h2 := sum&0xffffffff, sum>>32|1
+	n := uint64(len(f.bits) * 64)
+
+	var positions [BLOOM_HASHES]uint64
+	for i := range positions {
+		positions[i] = (h1 + uint64(i)*h2) % n
+	}
+
+	return positions
+}
+
+// Add adds a value the join can match
+func (f *RuntimeFilter) Add(value interface{}) {
+	for _, p := range f.positions(value) {
+		f.bits[p/64] |= 1 << (p % 64)
+	}
+
+	if f.keys < RUNTIME_FILTER_SEGMENT_KEYS {
+		f.values = append(f.values, value)
+	}
+
+	f.keys++
+}
+
+// MayContain returns false if the join can not match value
+func (f *RuntimeFilter) MayContain(value interface{}) bool {
+	for _, p := range f.positions(value) {
+		if f.bits[p/64]&(1<<(p%64)) == 0 {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Keys returns the amount of values added
+func (f *RuntimeFilter) Keys() int {
+	return f.keys
+}
+
+// GetTable gets the table for the iterator
+func (ri *Iterator) GetTable() *Table {
+	return ri.table
+}
+
+// GetRow gets a row by id
+func (tbl *Table) GetRow(rowId int64) (map[string]interface{}, error) {
+	// Read row from table
+	row, err := tbl.Rows.GetPage(rowId)
+	if err != nil {
+		return nil, err
+	}
+
+	return tbl.readRow(row)
+}
+
+// readRow decrypts, decompresses and decodes a row read from the table pager
+// Compression is detected per row so rows written before compression was toggled stay readable
+func (tbl *Table) readRow(row []byte) (map[string]interface{}, error) {
+	var err error
+
+	// check for encryption
+	if tbl.Encrypt {
+		row, err = Decrypt(tbl.HashedKey, tbl.Nonce, row)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if IsCompressed(row) {
+		row, err = Decompress(row)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// decode row
+	return decodeRow(row)
+}
+
+// SetShardKey sets the column rows of the table are spread across shards by, empty to not shard the table
+func (tbl *Table) SetShardKey(column string) error {
+	if column != "" {
+		if _, ok := tbl.TableSchema.ColumnDefinitions[column]; !ok {
+			return fmt.Errorf("column %s does not exist", column)
+		}
+	}
+
+	tbl.TableSchema.ShardKey = column
+
+	// write schema to file
+	schemaFile, err := os.Create(filepath.Join(tbl.Directory, tbl.Name+DB_SCHEMA_TABLE_SCHEMA_FILE_EXTENSION))
+	if err != nil {
+		return err
+	}
+
+	defer schemaFile.Close()
+
+	return gob.NewEncoder(schemaFile).Encode(tbl.TableSchema)
+}
+
+// ConstraintName returns the name of the CHECK or foreign key constraint of a column
+func (tbl *Table) ConstraintName(column, kind string) string {
+	return tbl.Name + "_" + column + "_" + kind
+}
+
+// Constraint returns the column and kind of the constraint named name
+func (tbl *Table) Constraint(name string) (string, string, error) {
+	for column, colDef := range tbl.TableSchema.ColumnDefinitions {
+		if colDef.Check != nil && tbl.ConstraintName(column, CONSTRAINT_CHECK) == name {
+			return column, CONSTRAINT_CHECK, nil
+		}
+
+		if colDef.References != nil && tbl.ConstraintName(column, CONSTRAINT_FOREIGN_KEY) == name {
+			return column, CONSTRAINT_FOREIGN_KEY, nil
+		}
+	}
+
+	return "", "", fmt.Errorf("constraint %s does not exist", name)
+}
+
+// AddConstraint adds a CHECK or foreign key constraint to a column
+// A constraint added not valid is enforced on new rows only until it is validated
+func (tbl *Table) AddConstraint(column string, check interface{}, references *Reference, notValid bool) error {
+	colDef, ok := tbl.TableSchema.ColumnDefinitions[column]
+	if !ok {
+		return fmt.Errorf("column %s does not exist", column)
+	}
+
+	kind := CONSTRAINT_CHECK
+
+	if references != nil {
+		if colDef.References != nil {
+			return fmt.Errorf("column %s already has a foreign key constraint", column)
+		}
+
+		kind = CONSTRAINT_FOREIGN_KEY
+		colDef.References = references
+	} else {
+		if colDef.Check != nil {
+			return fmt.Errorf("column %s already has a check constraint", column)
+		}
+
+		colDef.Check = check
+	}
+
+	if notValid {
+		tbl.TableSchema.NotValid = append(tbl.TableSchema.NotValid, tbl.ConstraintName(column, kind))
+	}
+
+	err := tbl.writeSchema()
+	if err != nil {
+		return err
+	}
+
+	// A foreign key column is indexed unless an index has it already
+	if references != nil && tbl.CheckIndexedColumn(column, false) == nil && tbl.CheckIndexedColumn(column, true) == nil {
+		return tbl.CreateIndex(FOREIGN_KEY_INDEX_PREFIX+column, []string{column}, false)
+	}
+
+	return nil
+}
+
+// ValidateConstraint marks a constraint the existing rows were not validated against as valid
+func (tbl *Table) ValidateConstraint(name string) error {
+	tbl.TableSchema.NotValid = slices.DeleteFunc(tbl.TableSchema.NotValid, func(n string) bool {
+		return n == name
+	})
+
+	return tbl.writeSchema()
+}
+
+// writeSchema writes the table schema to its file
+func (tbl *Table) writeSchema() error {
+	schemaFile, err := os.Create(filepath.Join(tbl.Directory, tbl.Name+DB_SCHEMA_TABLE_SCHEMA_FILE_EXTENSION))
+	if err != nil {
+		return err
+	}
+
+	defer schemaFile.Close()
+
+	return gob.NewEncoder(schemaFile).Encode(tbl.TableSchema)
+}
+
+// Recompress rewrites every row of the table compressed or uncompressed
+// A row needing more pages than it occupies continues on newly allocated pages, it keeps its row id
+func (tbl *Table) Recompress(compress bool) error {
+	tbl.Compress = compress
+	tbl.TableSchema.Compress = compress
+
+	// write schema to file
+	schemaFile, err := os.Create(filepath.Join(tbl.Directory, tbl.Name+DB_SCHEMA_TABLE_SCHEMA_FILE_EXTENSION))
+	if err != nil {
+		return err
+	}
+
+	defer schemaFile.Close()
+
+	// Encode schema to file
+	enc := gob.NewEncoder(schemaFile)
+
+	err = enc.Encode(tbl.TableSchema)
+	if err != nil {
+		return err
+	}
+
+	for rowId := int64(0); rowId < tbl.Rows.Count(); rowId++ {
+		if tbl.Rows.IsDeleted(rowId) {
+			continue
+		}
+
+		page, err := tbl.Rows.GetPage(rowId)
+		if errors.Is(err, btree.ErrOverflowPage) {
+			continue
+		} else if err != nil {
+			return err
+		}
+
+		row, err := tbl.readRow(page)
+		if err != nil && tbl.Rows.IsLegacy(rowId) {
+			// A legacy page can be an overflow of a previous row
+			continue
+		} else if err != nil {
+			return fmt.Errorf("row %d does not decode: %s", rowId, err.Error())
+		}
+
+		encoded, err := EncodeRow(row)
+		if err != nil {
+			return err
+		}
+
+		if compress {
+			encoded, err = Compress(encoded)
+			if err != nil {
+				return err
+			}
+		}
+
+		if tbl.Encrypt {
+			encoded, err = Encrypt(tbl.HashedKey, tbl.Nonce, encoded)
+			if err != nil {
+				return err
+			}
+		}
+
+		err = tbl.Rows.WriteTo(rowId, encoded)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// NewIterator returns a new row iterator
+func (tbl *Table) NewIterator() *Iterator {
+	return &Iterator{
+		table: tbl,
+		row:   0,
+	}
+}
+
+// Current returns the current row id
+func (ri *Iterator) Current() int64 {
+	return ri.row
+}
+
+// Prune skips the segments of the table the bloom filter on column rules out value for, false if there is no bloom filter on column
+// Only rows where column equals value are then returned, along with rows sharing a segment with them
+func (ri *Iterator) Prune(column string, value interface{}) bool {
+	b := ri.table.BloomFilterColumn(column)
+	if b == nil {
+		return false
+	}
+
+	ri.blooms = append(ri.blooms, b)
+	ri.keys = append(ri.keys, bloomBits(ri.table.IndexKey(value)))
+
+	return true
+}
+
+// Restrict restricts the iterator to rows, such as the rows an index lookup returned, they are returned in row order
+func (ri *Iterator) Restrict(rowIds []int64) {
+	ri.only = slices.Clone(rowIds)
+	slices.Sort(ri.only)
+	ri.only = slices.Compact(ri.only)
+	ri.limit = true
+}
+
+// Filter skips the rows of the table a runtime filter rules out, they are read but not returned
+// With a bloom filter on the column of a runtime filter of few values the segments ruling out every value are not read
+func (ri *Iterator) Filter(filter *RuntimeFilter) {
+	ri.filter = filter
+
+	b := ri.table.BloomFilterColumn(filter.Column)
+	if b == nil || filter.keys > RUNTIME_FILTER_SEGMENT_KEYS {
+		return
+	}
+
+	ri.bloom = b
+	for _, value := range filter.values {
+		ri.values = append(ri.values, bloomBits(ri.table.IndexKey(value)))
+	}
+}
+
+// FilterStats returns the rows and segments the runtime filter of the iterator skipped
+func (ri *Iterator) FilterStats() FilterStats {
+	return ri.stats
+}
+
+// pruned returns true if a bloom filter rules out the segment of a row
+func (ri *Iterator) pruned(rowId int64) bool {
+	for i, b := range ri.blooms {
+		if !b.mayContain(rowId/BLOOM_SEGMENT_ROWS, ri.keys[i]) {
+			return true
+		}
+	}
+
+	// Every value of the runtime filter has to be ruled out
+	if ri.bloom != nil {
+		for _, bits := range ri.values {
+			if ri.bloom.mayContain(rowId/BLOOM_SEGMENT_ROWS, bits) {
+				return false
+			}
+		}
+
+		ri.stats.Segments++
+
+		return true
+	}
+
+	return false
+}
+
+// Next returns the next row in the table
+func (ri *Iterator) Next() (map[string]interface{}, error) {
+	if ri.limit {
+		if len(ri.only) == 0 {
+			return nil, errors.New("no more rows")
+		}
+
+		rowId := ri.only[0]
+		ri.only = ri.only[1:]
+		ri.row = rowId + 1
+
+		return ri.table.GetRow(rowId)
+	}
+
+	for {
+		for {
+			if (len(ri.blooms) > 0 || ri.bloom != nil) && ri.row%BLOOM_SEGMENT_ROWS == 0 && ri.pruned(ri.row) {
+				ri.row += BLOOM_SEGMENT_ROWS
+				continue
+			}
+
+			if ri.table.Rows.IsDeleted(ri.row) {
+				ri.row++
+				continue
+
+			} else {
+				break
+			}
+
+		}
+
+		// Read row from table, the rest of a row on overflow pages is read with the page it starts at
+		row, err := ri.table.Rows.GetPage(ri.row)
+		if errors.Is(err, btree.ErrOverflowPage) {
+			ri.row++
+
+			if ri.Valid() {
+				continue
+			}
+
+			return nil, nil
+		} else if err != nil {
+			return nil, err
+		}
+
+		// decode row
+		decoded, err := ri.table.readRow(row)
+		if err != nil {
+			ri.row++
+
+			// A legacy page can be the overflow of a previous row, a row of its own which does not decode is corrupt
+			if ri.table.Rows.IsLegacy(ri.row - 1) {
+				return nil, nil
+			}
+
+			return nil, fmt.Errorf("row %d does not decode: %s", ri.row-1, err.Error())
+		}
+
+		ri.row++
+
+		// A row the runtime filter rules out is skipped, the next row is read
+		if ri.filter != nil && !ri.filter.MayContain(decoded[ri.filter.Column]) {
+			ri.stats.Rows++
+
+			if ri.Valid() {
+				continue
+			}
+
+			return nil, nil
+		}
+
+		return decoded, nil
+	}
+}
+
+// Valid returns true if the iterator is valid
+func (ri *Iterator) Valid() bool {
+	if ri.limit {
+		return len(ri.only) > 0
+	}
+
+	return ri.row < ri.table.Rows.Count()
+
+}
+
+// IOCount returns the amount of IO operations
+func (tbl *Table) IOCount() int64 {
+	return tbl.Rows.Count() // This is not correct amount of rows as each page can be an overflow or deleted, this is just amount trips to disk
+}
+
+// CheckIndexedColumn checks if a column is indexed, if so return index
+// If unique is true, check if the index is unique
+func (tbl *Table) CheckIndexedColumn(column string, unique bool) *Index {
+	for _, idx := range tbl.Indexes {
+		if slices.Contains(idx.Columns, column) {
+
+			if idx.Unique == unique {
+				return idx
+			}
+		}
+	}
+
+	return nil
+}
+
+// VisibleIndexedColumn checks if a column is indexed by an index visible to the optimizer, if so return index
+// If unique is true, check if the index is unique
+func (tbl *Table) VisibleIndexedColumn(column string, unique bool) *Index {
+	for _, idx := range tbl.Indexes {
+		if !idx.Invisible && idx.Unique == unique && slices.Contains(idx.Columns, column) {
+			return idx
+		}
+	}
+
+	return nil
+}
+
+// GetUniqueIndex gets the first unique index for a table
+func (tbl *Table) GetUniqueIndex() *Index {
+	for _, idx := range tbl.Indexes {
+		if idx.Unique {
+			return idx
+		}
+	}
+
+	return nil
+
+}
+
+// DeleteRow deletes a row from the table
+func (tbl *Table) DeleteRow(rowId int64) error {
+	// Read row from table
+	decoded, err := tbl.GetRow(rowId)
+	if err != nil {
+		return err
+	}
+
+	// Delete row from indexes
+	for col, val := range decoded {
+		for _, idx := range tbl.Indexes {
+			if slices.Contains(idx.Columns, col) {
+				// Remove from index
+				err := idx.btree.Remove(tbl.IndexKey(val), []byte(fmt.Sprintf("%d", rowId)))
+				if err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	// The row is removed from the indexes but not deleted yet
+	err = fault.CrashPoint("catalog.delete.index")
+	if err != nil {
+		return err
+	}
+
+	// Delete row from table
+	err = tbl.Rows.DeletePage(rowId)
+	if err != nil {
+		return err
+	}
+
+	return tbl.recordVersion(rowId, decoded)
+}
+
+// SetClause Set for update
+type SetClause struct {
+	ColumnName string
+	Value      interface{}
+}
+
+// CopyRow copies a row
+func CopyRow(row *map[string]interface{}) map[string]interface{} {
+	newRow := make(map[string]interface{})
+	for k, v := range *row {
+		newRow[k] = v
+	}
+	return newRow
+}
+
+// charLength returns the length of a CHAR value in characters, without the quotes it is stored within
+func charLength(value string) int {
+	return utf8.RuneCountInString(strings.TrimSuffix(strings.TrimPrefix(value, "'"), "'"))
+}
+
+// UpdateRow updates a row in the table
+func (tbl *Table) UpdateRow(rowId int64, row map[string]interface{}, sets []*SetClause) error {
+
+	var prevRow map[string]interface{}
+	before := CopyRow(&row) // Row before the update, kept in the history
+
+	for _, set := range sets {
+
+		if _, ok := row[set.ColumnName]; !ok {
+			return fmt.Errorf("column %s does not exist", set.ColumnName)
+		}
+
+		prevRow = CopyRow(&row)
+		row[set.ColumnName] = set.Value
+
+		// Check row against schema
+		for colName, colDef := range tbl.TableSchema.ColumnDefinitions {
+			if colName == set.ColumnName {
+				switch strings.ToUpper(colDef.DataType) {
+				case "CHARACTER", "CHAR":
+					if _, ok := row[colName].(string); !ok {
+						if !colDef.NotNull {
+							if row[colName] != nil {
+								return fmt.Errorf("column %s is not a string", colName)
+							}
+						}
+					} else {
+						if !utf8.ValidString(row[colName].(string)) {
+							return fmt.Errorf("column %s is not valid UTF-8", colName)
+						}
+
+						// Check length, in characters
+						if charLength(row[colName].(string)) > colDef.Length {
+							return fmt.Errorf("column %s is too long", colName)
+						}
+					}
+
+				case "TEXT":
+					if v, ok := row[colName].(string); ok && !utf8.ValidString(v) {
+						return fmt.Errorf("column %s is not valid UTF-8", colName)
+					}
+
+				case "NUMERIC", "DECIMAL", "DEC", "FLOAT", "DOUBLE", "REAL":
+					if _, ok := row[colName].(float64); !ok {
+						return fmt.Errorf("column %s is not a float64", colName)
+					}
+
+					str := fmt.Sprintf("%.14g", row[colName].(float64))
+
+					// Split the string on the decimal point
+					parts := strings.Split(str, ".")
+
+					if len(parts) > 1 {
+
+						// The scale is the number of digits after the decimal point
+						scale := len(parts[1])
+
+						// The precision is the total number of digits
+						precision := len(parts[0]) + len(parts[1])
+
+						if colDef.Scale > 0 {
+							// Check scale
+
+							if scale > colDef.Scale {
+								return fmt.Errorf("column %s has too many digits after the decimal point", colName)
+							}
+
+						}
+
+						if colDef.Precision > 0 {
+							// Check precision
+							if precision > colDef.Precision {
+								return fmt.Errorf("column %s is too large", colName)
+							}
+						}
+					}
+
+				case "INT", "INTEGER", "SMALLINT":
+
+					if _, ok := row[colName].(int); !ok {
+						if _, ok := row[colName].(uint64); !ok {
+							return fmt.Errorf("column %s is not an int", colName)
+						} else {
+							row[colName] = int(row[colName].(uint64))
+						}
+					}
+
+					// Check if value fits in INT/INTEGER
+					if strings.ToUpper(colDef.DataType) == "INT" || strings.ToUpper(colDef.DataType) == "INTEGER" {
+						if row[colName].(int) > 2147483647 {
+							return fmt.Errorf("column %s is too large for INT/INTEGER", colName)
+						}
+					}
+
+					// Check if value fits in SMALLINT
+					if strings.ToUpper(colDef.DataType) == "SMALLINT" {
+						if row[colName].(int) > 32767 {
+							return fmt.Errorf("column %s is too large for SMALLINT", colName)
+						}
+					}
+
+				}
+
+			}
+		}
+
+	}
+
+	// Encode row
+	encoded, err := EncodeRow(row)
+	if err != nil {
+		return err
+	}
+
+	if tbl.Compress {
+		encoded, err = Compress(encoded)
+		if err != nil {
+			return err
+		}
+	}
+
+	if tbl.Encrypt {
+		encoded, err = Encrypt(tbl.HashedKey, tbl.Nonce, encoded)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = tbl.Rows.WriteTo(rowId, encoded)
+	if err != nil {
+		return err
+	}
+
+	// The row is written but its indexes are not updated yet
+	err = fault.CrashPoint("catalog.update.row")
+	if err != nil {
+		return err
+	}
+
+	for _, set := range sets {
+		for colName, _ := range tbl.TableSchema.ColumnDefinitions {
+			if colName == set.ColumnName {
+				for _, idx := range tbl.Indexes {
+					if slices.Contains(idx.Columns, colName) {
+						// Remove old value from index
+						err := idx.btree.Remove(tbl.IndexKey(prevRow[colName]), []byte(fmt.Sprintf("%d", rowId)))
+						if err != nil {
+							return err
+						}
+
+						// Insert into index
+						err = idx.btree.Put(tbl.IndexKey(row[colName]), []byte(fmt.Sprintf("%d", rowId)))
+						if err != nil {
+							return err
+						}
+					}
+				}
+			}
+		}
+
+		// The old value stays within the bloom filter, bits are never cleared
+		for _, b := range tbl.Blooms {
+			if b.Column == set.ColumnName {
+				err = b.add(rowId, tbl.IndexKey(row[set.ColumnName]))
+				if err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	return tbl.recordVersion(rowId, before)
+
+}
+
+// openHistory opens the history file of the table, creating it with a version marking when the history started
+func (tbl *Table) openHistory() error {
+	if tbl.history != nil {
+		return nil
+	}
+
+	path := filepath.Join(tbl.Directory, tbl.Name+DB_SCHEMA_TABLE_HISTORY_FILE_EXTENSION)
+
+	_, err := os.Stat(path)
+	created := os.IsNotExist(err)
+
+	history, err := btree.OpenPager(path, os.O_CREATE|os.O_RDWR, 0755)
+	if err != nil {
+		return err
+	}
+
+	tbl.history = history
+
+	if created {
+		return tbl.writeVersion(&Version{Time: time.Now().UnixNano(), RowID: HISTORY_START})
+	}
+
+	return tbl.purgeHistory()
+}
+
+// recordVersion keeps a row as it was before it was changed, before is nil if the row was inserted
+func (tbl *Table) recordVersion(rowId int64, before map[string]interface{}) error {
+	if tbl.retention <= 0 && !tbl.TableSchema.SystemVersioned {
+		return nil
+	}
+
+	tbl.historyLock.Lock()
+	defer tbl.historyLock.Unlock()
+
+	err := tbl.openHistory()
+	if err != nil {
+		return err
+	}
+
+	err = tbl.writeVersion(&Version{Time: time.Now().UnixNano(), RowID: rowId, Before: before})
+	if err != nil {
+		return err
+	}
+
+	tbl.versions++
+	if tbl.versions >= HISTORY_PURGE_INTERVAL {
+		return tbl.purgeHistory()
+	}
+
+	return nil
+}
+
+// writeVersion writes a version to the history, its time is moved past the version written last so versions are ordered
+func (tbl *Table) writeVersion(version *Version) error {
+	if version.Time <= tbl.lastVersion {
+		version.Time = tbl.lastVersion + 1
+	}
+
+	tbl.lastVersion = version.Time
+
+	buff := new(bytes.Buffer)
+
+	err := gob.NewEncoder(buff).Encode(version)
+	if err != nil {
+		return err
+	}
+
+	encoded := buff.Bytes()
+
+	if tbl.Encrypt {
+		encoded, err = Encrypt(tbl.HashedKey, tbl.Nonce, encoded)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = tbl.history.Write(encoded)
+	return err
+}
+
+// readVersions reads every version of the history with its page
+func (tbl *Table) readVersions() (map[int64]*Version, error) {
+	versions := make(map[int64]*Version)
+
+	for page := int64(0); page < tbl.history.Count(); page++ {
+		if tbl.history.IsDeleted(page) {
+			continue
+		}
+
+		data, err := tbl.history.GetPage(page)
+		if errors.Is(err, btree.ErrOverflowPage) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+
+		if tbl.Encrypt {
+			data, err = Decrypt(tbl.HashedKey, tbl.Nonce, data)
+			if err != nil {
+				continue // A legacy overflow page of a version
+			}
+		}
+
+		version := &Version{}
+		err = gob.NewDecoder(bytes.NewReader(data)).Decode(version)
+		if err != nil {
+			continue // An overflow page of a version
+		}
+
+		if version.Time > tbl.lastVersion {
+			tbl.lastVersion = version.Time
+		}
+
+		versions[page] = version
+	}
+
+	return versions, nil
+}
+
+// purgeHistory deletes the versions past the retention window, versions of a system versioned table are kept
+func (tbl *Table) purgeHistory() error {
+	tbl.versions = 0
+
+	if tbl.TableSchema.SystemVersioned {
+		return nil
+	}
+
+	versions, err := tbl.readVersions()
+	if err != nil {
+		return err
+	}
+
+	cutoff := time.Now().Add(-tbl.retention).UnixNano()
+
+	for page, version := range versions {
+		if version.RowID != HISTORY_START && version.Time < cutoff {
+			err = tbl.history.DeletePage(page)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// AsOf returns the rows of the table as they were at t, changes made since are undone using the history
+// t must be after the history of the table started and, unless the table is system versioned, within the retention window
+func (tbl *Table) AsOf(t time.Time) ([]map[string]interface{}, error) {
+	if !tbl.TableSchema.SystemVersioned {
+		if tbl.retention <= 0 {
+			return nil, errors.New("flashback is not enabled")
+		}
+
+		if t.Before(time.Now().Add(-tbl.retention)) {
+			return nil, fmt.Errorf("timestamp is outside the flashback retention window of %s", tbl.retention)
+		}
+	}
+
+	tbl.historyLock.Lock()
+	defer tbl.historyLock.Unlock()
+
+	err := tbl.openHistory()
+	if err != nil {
+		return nil, err
+	}
+
+	// Rows as they are now
+	rows := make(map[int64]map[string]interface{})
+
+	iter := tbl.NewIterator()
+	for iter.Valid() {
+		row, err := iter.Next()
+		if err != nil || row == nil {
+			continue
+		}
+
+		rows[iter.Current()-1] = row
+	}
+
+	versions, err := tbl.readVersions()
+	if err != nil {
+		return nil, err
+	}
+
+	// Changes made after t are undone from the newest to the oldest
+	var undo []*Version
+
+	for _, version := range versions {
+		if version.RowID == HISTORY_START {
+			if version.Time > t.UnixNano() {
+				return nil, fmt.Errorf("no history of table %s before %s", tbl.Name, time.Unix(0, version.Time).Format("2006-01-02 15:04:05"))
+			}
+
+			continue
+		}
+
+		if version.Time > t.UnixNano() {
+			undo = append(undo, version)
+		}
+	}
+
+	sort.Slice(undo, func(i, j int) bool {
+		return undo[i].Time > undo[j].Time
+	})
+
+	for _, version := range undo {
+		if version.Before == nil {
+			delete(rows, version.RowID)
+		} else {
+			rows[version.RowID] = version.Before
+		}
+	}
+
+	rowIds := make([]int64, 0, len(rows))
+	for rowId := range rows {
+		rowIds = append(rowIds, rowId)
+	}
+
+	slices.Sort(rowIds)
+
+	result := make([]map[string]interface{}, len(rowIds))
+	for i, rowId := range rowIds {
+		result[i] = rows[rowId]
+	}
+
+	return result, nil
+}
+
+// Between returns every version of the rows of a system versioned table which was current at some time from from to to
+// Versions have the time they became current as SYSTEM_TIME_START and the time they were replaced as SYSTEM_TIME_END, nil if still current
+func (tbl *Table) Between(from, to time.Time) ([]map[string]interface{}, error) {
+	if !tbl.TableSchema.SystemVersioned {
+		return nil, fmt.Errorf("table %s is not system versioned", tbl.Name)
+	}
+
+	tbl.historyLock.Lock()
+	defer tbl.historyLock.Unlock()
+
+	err := tbl.openHistory()
+	if err != nil {
+		return nil, err
+	}
+
+	// Rows as they are now
+	rows := make(map[int64]map[string]interface{})
+
+	iter := tbl.NewIterator()
+	for iter.Valid() {
+		row, err := iter.Next()
+		if err != nil || row == nil {
+			continue
+		}
+
+		rows[iter.Current()-1] = row
+	}
+
+	versions, err := tbl.readVersions()
+	if err != nil {
+		return nil, err
+	}
+
+	var start int64 // Time the history started
+	changes := make(map[int64][]*Version)
+
+	for _, version := range versions {
+		if version.RowID == HISTORY_START {
+			start = version.Time
+			continue
+		}
+
+		changes[version.RowID] = append(changes[version.RowID], version)
+	}
+
+	rowIds := make([]int64, 0, len(rows)+len(changes))
+	for rowId := range rows {
+		rowIds = append(rowIds, rowId)
+	}
+
+	for rowId := range changes {
+		if _, ok := rows[rowId]; !ok {
+			rowIds = append(rowIds, rowId)
+		}
+	}
+
+	slices.Sort(rowIds)
+
+	var result []map[string]interface{}
+
+	// appendVersion appends a version of a row if it was current at some time within the range
+	appendVersion := func(row map[string]interface{}, current, replaced int64) {
+		if current > to.UnixNano() || (replaced != 0 && replaced <= from.UnixNano()) {
+			return
+		}
+
+		version := CopyRow(&row)
+		version[SYSTEM_TIME_START] = time.Unix(0, current)
+		version[SYSTEM_TIME_END] = nil
+
+		if replaced != 0 {
+			version[SYSTEM_TIME_END] = time.Unix(0, replaced)
+		}
+
+		result = append(result, version)
+	}
+
+	for _, rowId := range rowIds {
+		sort.Slice(changes[rowId], func(i, j int) bool {
+			return changes[rowId][i].Time < changes[rowId][j].Time
+		})
+
+		// Each change holds the version it replaced, nil if the row did not exist before it
+		current := start
+		for _, version := range changes[rowId] {
+			if version.Before != nil {
+				appendVersion(version.Before, current, version.Time)
+			}
+
+			current = version.Time
+		}
+
+		if row, ok := rows[rowId]; ok {
+			appendVersion(row, current, 0)
+		}
+	}
+
+	return result, nil
+}
+
+// RevokePrivilegeFromUser revokes a privilege from a user
+func (cat *Catalog) RevokePrivilegeFromUser(username string, priv *Privilege) error {
+	// Lock users map
+	cat.UsersLock.Lock()
+	defer cat.UsersLock.Unlock()
+
+	// Check if user exists
+	if _, ok := cat.Users[username]; !ok {
+		return fmt.Errorf("user %s does not exist", username)
+	}
+
+	// Check if privilege exists
+	for _, p := range cat.Users[username].Privileges {
+		if p.DatabaseName == priv.DatabaseName && p.TableName == priv.TableName {
+
+			// Revoke privilege
+			for i, l := range cat.Users[username].Privileges {
+				if l.DatabaseName == l.DatabaseName && l.TableName == l.TableName {
+
+					if len(l.PrivilegeActions) == len(priv.PrivilegeActions) {
+
+						cat.Users[username].Privileges = append(cat.Users[username].Privileges[:i], cat.Users[username].Privileges[i+1:]...)
+					} else {
+						for _, a := range priv.PrivilegeActions {
+							for j, b := range l.PrivilegeActions {
+								if a == b {
+									// only remove the privilege action
+									cat.Users[username].Privileges[i].PrivilegeActions = append(l.PrivilegeActions[:j], l.PrivilegeActions[j+1:]...)
+								}
+							}
+						}
+					}
+					break
+				}
+			}
+
+			err := cat.EncodeUsersToFile()
+
+			if err != nil {
+				return err
+			}
+
+			return nil
+
+		}
+
+	}
+
+	return fmt.Errorf("privilege does not exist for user %s", username)
+}
+
+// GrantPrivilegeToUser grants a privilege to a user
+func (cat *Catalog) GrantPrivilegeToUser(username string, priv *Privilege) error {
+	// Lock users map
+	cat.UsersLock.Lock()
+	defer cat.UsersLock.Unlock()
+
+	// Check if user exists
+	if _, ok := cat.Users[username]; !ok {
+		return fmt.Errorf("user %s does not exist", username)
+	}
+
+	// Check if privilege exists
+	for _, p := range cat.Users[username].Privileges {
+		if p.DatabaseName == priv.DatabaseName && p.TableName == priv.TableName {
+			return fmt.Errorf(fmt.Sprintf("privilege already exists for user %s", username))
+		}
+	}
+
+	cat.Users[username].Privileges = append(cat.Users[username].Privileges, priv)
+
+	err := cat.EncodeUsersToFile()
+
+	if err != nil {
+		return err
+	}
+
+	return nil
+
+}
+
+// DropUser removes a user
+func (cat *Catalog) DropUser(username string) error {
+	// Lock users map
+	cat.UsersLock.Lock()
+	defer cat.UsersLock.Unlock()
+
+	// Check if user exists
+	if _, ok := cat.Users[username]; !ok {
+		return fmt.Errorf("user %s does not exist", username)
+	}
+
+	// Drop user
+	delete(cat.Users, username)
+
+	err := cat.EncodeUsersToFile()
+	if err != nil {
+		return err
+	}
+
+	return nil
+
+}
+
+// CreateNewUser creates a new user
+func (cat *Catalog) CreateNewUser(username, password string) error {
+	// Lock users map
+	cat.UsersLock.Lock()
+	defer cat.UsersLock.Unlock()
+
+	// Check if user exists
+	if _, ok := cat.Users[username]; ok {
+		return fmt.Errorf("user %s already exists", username)
+	}
+
+	// bcrypt password
+	hashedPassword, err := shared.HashPassword(password)
+	if err != nil {
+		return err
+	}
+
+	// Create user
+	cat.Users[username] = &User{
+		Username: username,
+		Password: hashedPassword,
+	}
+
+	err = cat.EncodeUsersToFile()
+	if err != nil {
+		return err
+	}
+
+	return nil
+
+}
+
+// EncodeUsersToFile encodes users to file
+func (cat *Catalog) EncodeUsersToFile() error {
+	// Lock users file
+	cat.UsersFileLock.Lock()
+	defer cat.UsersFileLock.Unlock()
+
+	// seek to beginning of file
+	if _, err := cat.UsersFile.Seek(0, 0); err != nil {
+		return err
+	}
+
+	// Encode users to file
+	enc := gob.NewEncoder(cat.UsersFile)
+
+	err := enc.Encode(cat.Users)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// ReadUsersFromFile reads users from file
+func (cat *Catalog) ReadUsersFromFile() error {
+
+	if _, err := cat.UsersFile.Seek(0, 0); err != nil {
+		return err
+	}
+
+	// Check size
+	fi, err := cat.UsersFile.Stat()
+	if err != nil {
+		return err
+	}
+
+	if fi.Size() == 0 {
+
+		return errors.New("users file is empty")
+	}
+
+	// Lock users file
+	cat.UsersFileLock.Lock()
+	defer cat.UsersFileLock.Unlock()
+
+	// Read users from file
+	dec := gob.NewDecoder(cat.UsersFile)
+
+	err = dec.Decode(&cat.Users)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// readShards reads the shard map from file
+func (cat *Catalog) readShards() error {
+	cat.Shards = make(map[string]*Shard)
+
+	d, err := os.ReadFile(filepath.Join(cat.Directory, "shards"+SYS_SHARDS_EXTENSION))
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	return gob.NewDecoder(bytes.NewReader(d)).Decode(&cat.Shards)
+}
+
+// writeShards writes the shard map to file
+func (cat *Catalog) writeShards() error {
+	buff := bytes.NewBuffer([]byte{})
+
+	err := gob.NewEncoder(buff).Encode(cat.Shards)
+	if err != nil {
+		return err
+	}
+
+	tmp := filepath.Join(cat.Directory, "shards"+SYS_SHARDS_EXTENSION+".tmp")
+
+	err = os.WriteFile(tmp, buff.Bytes(), 0644)
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, filepath.Join(cat.Directory, "shards"+SYS_SHARDS_EXTENSION))
+}
+
+// CreateShard adds a shard to the shard map
+func (cat *Catalog) CreateShard(name string, address string) error {
+	cat.ShardsLock.Lock()
+	defer cat.ShardsLock.Unlock()
+
+	if _, ok := cat.Shards[name]; ok {
+		return fmt.Errorf("shard %s already exists", name)
+	}
+
+	cat.Shards[name] = &Shard{Name: name, Address: address}
+
+	err := cat.writeShards()
+	if err != nil {
+		delete(cat.Shards, name)
+		return err
+	}
+
+	return nil
+}
+
+// DropShard removes a shard from the shard map
+func (cat *Catalog) DropShard(name string) error {
+	cat.ShardsLock.Lock()
+	defer cat.ShardsLock.Unlock()
+
+	shard, ok := cat.Shards[name]
+	if !ok {
+		return fmt.Errorf("shard %s does not exist", name)
+	}
+
+	delete(cat.Shards, name)
+
+	err := cat.writeShards()
+	if err != nil {
+		cat.Shards[name] = shard
+		return err
+	}
+
+	return nil
+}
+
+// GetShards returns the shards ordered by name
+// Rows are spread across shards by their position within this order
+func (cat *Catalog) GetShards() []*Shard {
+	cat.ShardsLock.Lock()
+	defer cat.ShardsLock.Unlock()
+
+	shards := make([]*Shard, 0, len(cat.Shards))
+
+	for _, shard := range cat.Shards {
+		shards = append(shards, shard)
+	}
+
+	sort.Slice(shards, func(i, j int) bool { return shards[i].Name < shards[j].Name })
+
+	return shards
+}
+
+// GetUser gets a user by username
+func (cat *Catalog) GetUser(username string) *User {
+	cat.UsersLock.Lock()
+	defer cat.UsersLock.Unlock()
+	return cat.Users[username]
+}
+
+// AuthenticateUser authenticates a user
+func (cat *Catalog) AuthenticateUser(username, password string) (*User, error) {
+	cat.UsersLock.Lock()
+	defer cat.UsersLock.Unlock()
+
+	// Check if user exists
+	if _, ok := cat.Users[username]; !ok {
+		return nil, fmt.Errorf("user %s does not exist", username)
+	}
+
+	// Check password
+	ok := shared.ComparePasswords(cat.Users[username].Password, password)
+	if !ok {
+		return nil, errors.New("authentication failed")
+	}
+
+	return cat.Users[username], nil
+}
+
+// DefaultPasswordInUse returns true if the admin user still has the default password of earlier versions
+func (cat *Catalog) DefaultPasswordInUse() bool {
+	user := cat.GetUser(DEFAULT_ADMIN_USER)
+
+	return user != nil && shared.ComparePasswords(user.Password, DEFAULT_ADMIN_PASSWORD)
+}
+
+// generatePassword returns a random password of url safe base64 characters
+func generatePassword() (string, error) {
+	b := make([]byte, GENERATED_PASSWORD_BYTES)
+
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// HasPrivilege checks if a user has a privilege
+func (u *User) HasPrivilege(db, tbl string, actions []shared.PrivilegeAction) bool {
+
+	var has []bool // Slice of booleans determining if user has privileges
+
+	for _, p := range u.Privileges {
+		for _, a := range actions {
+			if p.DatabaseName == db && p.TableName == tbl { // if the requested database and table match the privilege
+				for _, pa := range p.PrivilegeActions {
+					if pa == a { // if the privilege action matches the requested action
+						has = append(has, true)
+					} else if pa == shared.PRIV_ALL { // if the privilege action is all
+						has = append(has, true)
+					}
+				}
+			} else if p.DatabaseName == "*" && p.TableName == "*" { // all databases and tables
+				for _, pa := range p.PrivilegeActions {
+					if pa == a {
+						has = append(has, true)
+					} else if pa == shared.PRIV_ALL {
+						has = append(has, true)
+					}
+				}
+			} else if p.DatabaseName == db && p.TableName == "*" { // all tables in a database
+				for _, pa := range p.PrivilegeActions {
+					if pa == a {
+						has = append(has, true)
+					} else if pa == shared.PRIV_ALL {
+						has = append(has, true)
+					}
+				}
+			} else if p.DatabaseName == "*" && p.TableName == tbl { // all databases and a table
+				for _, pa := range p.PrivilegeActions {
+					if pa == a {
+						has = append(has, true)
+					} else if pa == shared.PRIV_ALL {
+						has = append(has, true)
+					}
+				}
+			}
+		}
+	}
+
+	if len(has) == len(actions) {
+		return true
+	}
+
+	return false
+}
+
+// GetUsers gets all users
+func (cat *Catalog) GetUsers() []string {
+	cat.UsersLock.Lock()
+	defer cat.UsersLock.Unlock()
+
+	var users []string
+	for k := range cat.Users {
+		users = append(users, k)
+	}
+
+	slices.Sort(users)
+
+	return users
+}
+
+// GetTables gets all tables in a database
+func (db *Database) GetTables() []string {
+
+	db.TablesLock.Lock()
+	defer db.TablesLock.Unlock()
+
+	var tables []string
+	for k := range db.Tables {
+		tables = append(tables, k)
+	}
+
+	return tables
+}
+
+// GetDatabases gets all databases
+func (cat *Catalog) GetDatabases() []string {
+	cat.DatabasesLock.Lock()
+	defer cat.DatabasesLock.Unlock()
+
+	var dbs []string
+	for k := range cat.Databases {
+		dbs = append(dbs, k)
+	}
+
+	slices.Sort(dbs)
+
+	return dbs
+}
+
+// TableIOStats are the IO counters of the data file of a table or the btree file of one of its indexes
+type TableIOStats struct {
+	Database string // Database name
+	Table    string // Table name
+	Index    string // Index name, empty for the data file of the table
+	storage.FileStats
+}
+
+// IOStats returns the IO counters of every table and index since the process started or storage.ResetFileStats
+// Tables are not opened, counters of closed tables are kept
+func (cat *Catalog) IOStats() ([]*TableIOStats, error) {
+	stats := make([]*TableIOStats, 0)
+
+	for _, dbName := range cat.GetDatabases() {
+		cat.DatabasesLock.Lock()
+		db, ok := cat.Databases[dbName]
+		cat.DatabasesLock.Unlock()
+
+		if !ok {
+			continue
+		}
+
+		db.TablesLock.Lock()
+		directories := make(map[string]string, len(db.Tables))
+		for name, tbl := range db.Tables {
+			directories[name] = tbl.Directory
+		}
+		db.TablesLock.Unlock()
+
+		tables := make([]string, 0, len(directories))
+		for name := range directories {
+			tables = append(tables, name)
+		}
+
+		slices.Sort(tables)
+
+		for _, tblName := range tables {
+			directory := directories[tblName]
+
+			stats = append(stats, &TableIOStats{
+				Database:  dbName,
+				Table:     tblName,
+				FileStats: storage.StatsOf(filepath.Join(directory, tblName+DB_SCHEMA_TABLE_DATA_FILE_EXTENSION)),
+			})
+
+			entries, err := os.ReadDir(directory)
+			if err != nil {
+				if os.IsNotExist(err) {
+					continue // Dropped meanwhile
+				}
+
+				return nil, err
+			}
+
+			for _, entry := range entries {
+				if !strings.HasPrefix(entry.Name(), "idx_") || !strings.HasSuffix(entry.Name(), ".bt") {
+					continue
+				}
+
+				stats = append(stats, &TableIOStats{
+					Database:  dbName,
+					Table:     tblName,
+					Index:     strings.TrimSuffix(strings.TrimPrefix(entry.Name(), "idx_"), ".bt"),
+					FileStats: storage.StatsOf(filepath.Join(directory, entry.Name())),
+				})
+			}
+		}
+	}
+
+	return stats, nil
+}
+
+// AlterUserUsername alters a user's username
+func (cat *Catalog) AlterUserUsername(oldUsername, newUsername string) error {
+	// Lock users map
+	cat.UsersLock.Lock()
+	defer cat.UsersLock.Unlock()
+
+	// Check if user exists
+	if _, ok := cat.Users[oldUsername]; !ok {
+		return fmt.Errorf("user %s does not exist", oldUsername)
+	}
+
+	// Check if new username already exists
+	if _, ok := cat.Users[newUsername]; ok {
+		return fmt.Errorf("user %s already exists", newUsername)
+	}
+
+	// Create user
+	cat.Users[newUsername] = cat.Users[oldUsername]
+	cat.Users[newUsername].Username = newUsername
+
+	// Drop old user
+	delete(cat.Users, oldUsername)
+
+	err := cat.EncodeUsersToFile()
+	if err != nil {
+		return err
+	}
+
+	return nil
+
+}
+
+// AlterUserPassword alters a user's password
+func (cat *Catalog) AlterUserPassword(username, password string) error {
+	// Lock users map
+	cat.UsersLock.Lock()
+	defer cat.UsersLock.Unlock()
+
+	// Check if user exists
+	if _, ok := cat.Users[username]; !ok {
+		return fmt.Errorf("user %s does not exist", username)
+	}
+
+	// A generated password is replaced by another
+	if cat.Users[username].MustChangePassword && shared.ComparePasswords(cat.Users[username].Password, password) {
+		return errors.New("new password must differ from the generated password")
+	}
+
+	// bcrypt password
+	hashedPassword, err := shared.HashPassword(password)
+	if err != nil {
+		return err
+	}
+
+	// Create user
+	cat.Users[username].Password = hashedPassword
+	cat.Users[username].MustChangePassword = false
+
+	err = cat.EncodeUsersToFile()
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// GetPrivileges gets a user's privileges
+func (u *User) GetPrivileges() []string {
+	var formattedStr []string
+
+	for _, priv := range u.Privileges {
+		var privActionsStr []string
+
+		for _, action := range priv.PrivilegeActions {
+			privActionsStr = append(privActionsStr, action.String())
+		}
+
+		formattedStr = append(formattedStr, fmt.Sprintf("%s.%s: %s", priv.DatabaseName, priv.TableName, strings.Join(privActionsStr, ", ")))
+
+	}
+
+	return formattedStr
+}
+
+// AddProcedure adds a procedure to the database
+func (db *Database) AddProcedure(proc *Procedure) error {
+	db.ProceduresFileLock.Lock()
+	defer db.ProceduresFileLock.Unlock()
+
+	if _, ok := db.Procedures[proc.Name]; ok {
+		return fmt.Errorf("procedure %s already exists", proc.Name)
+	}
+
+	db.Procedures[proc.Name] = proc
+
+	// Encode procedures to file
+	err := db.EncodeProceduresToFile()
+	if err != nil {
+		return err
+
+	}
+
+	return nil
+}
+
+// DropProcedure drops a procedure from the database
+func (db *Database) DropProcedure(procName string) error {
+	db.ProceduresFileLock.Lock()
+	defer db.ProceduresFileLock.Unlock()
+
+	if _, ok := db.Procedures[procName]; !ok {
+		return fmt.Errorf("procedure %s does not exist", procName)
+	}
+
+	delete(db.Procedures, procName)
+
+	// Encode procedures to file
+	err := db.EncodeProceduresToFile()
+	if err != nil {
+		return err
+
+	}
+
+	return nil
+}
+
+// GetProcedures gets all procedures in a database
+func (db *Database) GetProcedures() []string {
+	db.ProceduresFileLock.Lock()
+	defer db.ProceduresFileLock.Unlock() // Lock procedures file which also locks procedures map
+
+	var procs []string
+	for k := range db.Procedures {
+		procs = append(procs, k)
+	}
+
+	slices.Sort(procs)
+
+	return procs
+}
+
+// GetProcedure gets a procedure by name
+func (db *Database) GetProcedure(procName string) (*Procedure, error) {
+	db.ProceduresFileLock.Lock()
+	defer db.ProceduresFileLock.Unlock()
+
+	if _, ok := db.Procedures[procName]; !ok {
+		return nil, fmt.Errorf("procedure %s does not exist", procName)
+	}
+
+	return db.Procedures[procName], nil
+}
+
+// GetMigrations returns the migrations applied to the database, in the order they were applied
+func (db *Database) GetMigrations() ([]*SchemaMigration, error) {
+	migrations := make([]*SchemaMigration, 0)
+
+	d, err := os.ReadFile(filepath.Join(db.Directory, db.Name+DB_MIGRATIONS_EXTENSION))
+	if os.IsNotExist(err) {
+		return migrations, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	err = gob.NewDecoder(bytes.NewReader(d)).Decode(&migrations)
+	if err != nil {
+		return nil, err
+	}
+
+	return migrations, nil
+}
+
+// RecordMigration records a migration applied to the database, its version follows the migration applied last
+// The caller holds MigrationsLock from checking the migrations applied until the migration is recorded
+func (db *Database) RecordMigration(migration *SchemaMigration) error {
+	migrations, err := db.GetMigrations()
+	if err != nil {
+		return err
+	}
+
+	migration.Version = len(migrations) + 1
+	migrations = append(migrations, migration)
+
+	buff := bytes.NewBuffer([]byte{})
+
+	err = gob.NewEncoder(buff).Encode(migrations)
+	if err != nil {
+		return err
+	}
+
+	tmp := filepath.Join(db.Directory, db.Name+DB_MIGRATIONS_EXTENSION+".tmp")
+
+	err = os.WriteFile(tmp, buff.Bytes(), 0644)
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, filepath.Join(db.Directory, db.Name+DB_MIGRATIONS_EXTENSION))
+}
+
+// tierDirectory returns the directory of a table of the database on a tier
+func (db *Database) tierDirectory(tier, name string) (string, error) {
+	switch tier {
+	case TIER_HOT:
+		return filepath.Join(db.Directory, name), nil
+	case TIER_COLD:
+		if db.catalog == nil || db.catalog.ColdDirectory == "" {
+			return "", errors.New("no cold tier is configured")
+		}
+
+		return filepath.Join(db.catalog.ColdDirectory, "databases", db.Name, name), nil
+	}
+
+	return "", fmt.Errorf("unknown tier %s, expected %s or %s", tier, TIER_HOT, TIER_COLD)
+}
+
+// readTiers reads the tiers of the tables of the database not on the hot tier, by table name
+func (db *Database) readTiers() (map[string]string, error) {
+	tiers := make(map[string]string)
+
+	d, err := os.ReadFile(filepath.Join(db.Directory, db.Name+DB_TIERS_EXTENSION))
+	if os.IsNotExist(err) {
+		return tiers, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	err = gob.NewDecoder(bytes.NewReader(d)).Decode(&tiers)
+	if err != nil {
+		return nil, err
+	}
+
+	return tiers, nil
+}
+
+// writeTiers writes the tiers of the tables of the database not on the hot tier
+func (db *Database) writeTiers() error {
+	tiers := make(map[string]string)
+
+	for name, tbl := range db.Tables {
+		if tbl.Tier != TIER_HOT {
+			tiers[name] = tbl.Tier
+		}
+	}
+
+	buff := bytes.NewBuffer([]byte{})
+
+	err := gob.NewEncoder(buff).Encode(tiers)
+	if err != nil {
+		return err
+	}
+
+	tmp := filepath.Join(db.Directory, db.Name+DB_TIERS_EXTENSION+".tmp")
+
+	err = os.WriteFile(tmp, buff.Bytes(), 0644)
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, filepath.Join(db.Directory, db.Name+DB_TIERS_EXTENSION))
+}
+
+// placeTables points the tables on the cold tier at their directory on Open
+// A move is recorded once the table is copied, the copy on the tier the table is not on is left by a move
+// interrupted by a crash and is removed
+func (db *Database) placeTables() error {
+	tiers, err := db.readTiers()
+	if err != nil {
+		return err
+	}
+
+	for name, tier := range tiers {
+		directory, err := db.tierDirectory(tier, name)
+		if err != nil {
+			return fmt.Errorf("table %s is on the %s tier: %s", name, strings.ToLower(tier), err.Error())
+		}
+
+		if _, ok := db.Tables[name]; ok {
+			if _, err := os.Stat(directory); err == nil {
+				log.Printf("removing %s, table %s of database %s was moved to the %s tier", filepath.Join(db.Directory, name), name, db.Name, strings.ToLower(tier))
+
+				err = os.RemoveAll(filepath.Join(db.Directory, name))
+				if err != nil {
+					return err
+				}
+			}
+		}
+
+		db.Tables[name] = &Table{Name: name, Directory: directory, Tier: tier, accessed: time.Now()}
+	}
+
+	if db.catalog.ColdDirectory == "" {
+		return nil
+	}
+
+	coldDirs, err := os.ReadDir(filepath.Join(db.catalog.ColdDirectory, "databases", db.Name))
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	for _, coldDir := range coldDirs {
+		if !coldDir.IsDir() || tiers[coldDir.Name()] == TIER_COLD {
+			continue
+		}
+
+		log.Printf("removing %s, table %s of database %s is not on the cold tier", filepath.Join(db.catalog.ColdDirectory, "databases", db.Name, coldDir.Name()), strings.TrimSuffix(coldDir.Name(), TIER_MOVING_SUFFIX), db.Name)
+
+		err = os.RemoveAll(filepath.Join(db.catalog.ColdDirectory, "databases", db.Name, coldDir.Name()))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// MoveTable moves the files of a table to a tier, the table stays queryable from its new directory
+// The table is closed and copied before the move is recorded, the files left behind are then removed
+func (db *Database) MoveTable(name, tier string) error {
+	tier = strings.ToUpper(tier)
+
+	tbl, ok := db.Tables[name]
+	if !ok {
+		return fmt.Errorf("table %s does not exist", name)
+	}
+
+	directory, err := db.tierDirectory(tier, name)
+	if err != nil {
+		return err
+	}
+
+	if tbl.Tier == tier {
+		return fmt.Errorf("table %s is already on the %s tier", name, strings.ToLower(tier))
+	}
+
+	// The table can not be opened while it is moved
+	db.catalog.openTablesLock.Lock()
+	defer db.catalog.openTablesLock.Unlock()
+
+	if tbl.lruElement != nil {
+		db.catalog.openTables.Remove(tbl.lruElement)
+		tbl.lruElement = nil
+	}
+
+	tbl.close()
+
+	err = os.MkdirAll(filepath.Dir(directory), 0755)
+	if err != nil {
+		return err
+	}
+
+	moving := directory + TIER_MOVING_SUFFIX
+
+	err = copyDirectory(tbl.Directory, moving)
+	if err != nil {
+		os.RemoveAll(moving)
+		return err
+	}
+
+	err = os.Rename(moving, directory)
+	if err != nil {
+		os.RemoveAll(moving)
+		return err
+	}
+
+	previousTier, previousDirectory := tbl.Tier, tbl.Directory
+
+	tbl.Tier = tier
+	tbl.Directory = directory
+
+	err = db.writeTiers()
+	if err != nil {
+		tbl.Tier = previousTier
+		tbl.Directory = previousDirectory
+		os.RemoveAll(directory)
+		return err
+	}
+
+	err = os.RemoveAll(previousDirectory)
+	if err != nil {
+		log.Printf("table %s of database %s moved to the %s tier, %s was not removed: %s", name, db.Name, strings.ToLower(tier), previousDirectory, err.Error())
+	}
+
+	return nil
+}
+
+// IdleTables returns the tables on the hot tier not accessed for idle, by name
+func (db *Database) IdleTables(idle time.Duration) []string {
+	db.catalog.openTablesLock.Lock()
+	defer db.catalog.openTablesLock.Unlock()
+
+	names := make([]string, 0)
+
+	for name, tbl := range db.Tables {
+		if tbl.Tier == TIER_HOT && time.Since(tbl.accessed) >= idle {
+			names = append(names, name)
+		}
+	}
+
+	slices.Sort(names)
+
+	return names
+}
+
+// TablePlacement is the tier the files of a table are on
+type TablePlacement struct {
+	Tier      string    // TIER_HOT or TIER_COLD
+	Directory string    // Directory of the table files
+	Accessed  time.Time // When the table was last accessed, or the catalog opened if it was not since
+	Warm      bool      // The table is read into the cache on startup
+}
+
+// Placement returns the tier the files of a table are on, nil if the table does not exist
+func (db *Database) Placement(name string) *TablePlacement {
+	db.catalog.openTablesLock.Lock()
+	defer db.catalog.openTablesLock.Unlock()
+
+	tbl, ok := db.Tables[name]
+	if !ok {
+		return nil
+	}
+
+	return &TablePlacement{Tier: tbl.Tier, Directory: tbl.Directory, Accessed: tbl.accessed, Warm: tbl.Warm}
+}
+
+// markWarm marks the tables read into the cache on startup on Open
+func (db *Database) markWarm() error {
+	d, err := os.ReadFile(filepath.Join(db.Directory, db.Name+DB_WARM_EXTENSION))
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	names := make([]string, 0)
+
+	err = gob.NewDecoder(bytes.NewReader(d)).Decode(&names)
+	if err != nil {
+		return err
+	}
+
+	for _, name := range names {
+		if tbl, ok := db.Tables[name]; ok {
+			tbl.Warm = true
+		}
+	}
+
+	return nil
+}
+
+// writeWarm writes the names of the tables read into the cache on startup
+func (db *Database) writeWarm() error {
+	names := make([]string, 0)
+
+	for name, tbl := range db.Tables {
+		if tbl.Warm {
+			names = append(names, name)
+		}
+	}
+
+	slices.Sort(names)
+
+	buff := bytes.NewBuffer([]byte{})
+
+	err := gob.NewEncoder(buff).Encode(names)
+	if err != nil {
+		return err
+	}
+
+	tmp := filepath.Join(db.Directory, db.Name+DB_WARM_EXTENSION+".tmp")
+
+	err = os.WriteFile(tmp, buff.Bytes(), 0644)
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, filepath.Join(db.Directory, db.Name+DB_WARM_EXTENSION))
+}
+
+// SetWarm sets whether a table and its indexes are read into the cache on startup
+func (db *Database) SetWarm(name string, warm bool) error {
+	tbl, ok := db.Tables[name]
+	if !ok {
+		return fmt.Errorf("table %s does not exist", name)
+	}
+
+	previous := tbl.Warm
+	tbl.Warm = warm
+
+	err := db.writeWarm()
+	if err != nil {
+		tbl.Warm = previous
+		return err
+	}
+
+	return nil
+}
+
+// CacheLoad is what was read of a table into the cache
+type CacheLoad struct {
+	Table string // Table read
+	Files int    // Data and index files read
+	Bytes int64  // Bytes read
+}
+
+// LoadIntoCache opens the table and reads its data and index files, so the queries following a restart
+// read its pages from the page cache of the operating system instead of the disk
+func (tbl *Table) LoadIntoCache() (*CacheLoad, error) {
+	load := &CacheLoad{Table: tbl.Name}
+
+	n, err := tbl.Rows.Preload()
+	if err != nil {
+		return nil, err
+	}
+
+	load.Files++
+	load.Bytes += n
+
+	for _, idx := range tbl.Indexes {
+		n, err = idx.btree.Pager.Preload()
+		if err != nil {
+			return nil, err
+		}
+
+		load.Files++
+		load.Bytes += n
+	}
+
+	return load, nil
+}
+
+// WarmTables reads the tables marked warm of every database into the cache, a table which fails is logged and skipped
+func (cat *Catalog) WarmTables() []*CacheLoad {
+	loads := make([]*CacheLoad, 0)
+
+	for _, dbName := range cat.GetDatabases() {
+		db := cat.GetDatabase(dbName)
+		if db == nil {
+			continue
+		}
+
+		for _, name := range db.GetTables() {
+			if tbl, ok := db.Tables[name]; !ok || !tbl.Warm {
+				continue
+			}
+
+			tbl := db.GetTable(name)
+			if tbl == nil {
+				continue
+			}
+
+			load, err := tbl.LoadIntoCache()
+			if err != nil {
+				log.Printf("unable to warm table %s of database %s: %s", name, dbName, err.Error())
+				continue
 			}
 
-			row[colName] = t
+			loads = append(loads, load)
+		}
+	}
+
+	return loads
+}
+
+// copyDirectory copies the files of a table directory, synced to disk
+func copyDirectory(src, dst string) error {
+	err := os.MkdirAll(dst, 0755)
+	if err != nil {
+		return err
+	}
+
+	entries, err := os.ReadDir(src)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+
+		err = copyFile(filepath.Join(src, entry.Name()), filepath.Join(dst, entry.Name()))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// copyFile copies a file, synced to disk
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+
+	defer in.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+
+	defer out.Close()
+
+	_, err = io.Copy(out, in)
+	if err != nil {
+		return err
+	}
+
+	return out.Sync()
+}
+
+// readSettings reads the settings of the database, a database without a settings file has the zero settings
+func (db *Database) readSettings() (*DatabaseSettings, error) {
+	settings := &DatabaseSettings{}
+
+	d, err := os.ReadFile(filepath.Join(db.Directory, db.Name+DB_SETTINGS_EXTENSION))
+	if os.IsNotExist(err) {
+		return settings, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	err = gob.NewDecoder(bytes.NewReader(d)).Decode(settings)
+	if err != nil {
+		return nil, err
+	}
+
+	return settings, nil
+}
+
+// writeSettings writes the settings of the database
+func (db *Database) writeSettings() error {
+	buff := bytes.NewBuffer([]byte{})
+
+	err := gob.NewEncoder(buff).Encode(db.Settings)
+	if err != nil {
+		return err
+	}
+
+	tmp := filepath.Join(db.Directory, db.Name+DB_SETTINGS_EXTENSION+".tmp")
+
+	err = os.WriteFile(tmp, buff.Bytes(), 0644)
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, filepath.Join(db.Directory, db.Name+DB_SETTINGS_EXTENSION))
+}
+
+// EncodeProceduresToFile encodes procedures to file
+func (db *Database) EncodeProceduresToFile() error {
+
+	if db.quarantined(QUARANTINE_PROCEDURES, db.Name) != nil {
+		return fmt.Errorf("procedures of database %s are quarantined", db.Name)
+	}
+
+	// seek to beginning of file
+	if _, err := db.ProceduresFile.Seek(0, 0); err != nil {
+		return err
+	}
+
+	// Encode procedures to file
+	enc := gob.NewEncoder(db.ProceduresFile)
+
+	err := enc.Encode(db.Procedures)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Compress compresses a row with ZSTD
+func Compress(row []byte) ([]byte, error) {
+	return zstd.Compress(nil, row)
+
+}
+
+// Decompress decompresses a row with ZSTD
+// Rows read from a pager are padded to the page size, anything after the ZSTD frame is ignored
+func Decompress(row []byte) ([]byte, error) {
+	size, err := frameSize(row)
+	if err != nil {
+		return nil, err
+	}
+
+	return zstd.Decompress(nil, row[:size])
+}
 
-		case "TIME":
-			if _, ok := row[colName].(string); !ok {
-				if colDef.NotNull {
-					return -1, fmt.Errorf("column %s is not a string", colName)
-				} else {
-					continue
-				}
-			}
+// frameSize returns the length of the ZSTD frame at the start of data
+func frameSize(data []byte) (int, error) {
+	if !IsCompressed(data) || len(data) < 5 {
+		return 0, errors.New("not a zstd frame")
+	}
 
-			// Check date format
-			// Should be in the format HH:MM:SS
+	descriptor := data[4]
+	singleSegment := descriptor&0x20 != 0
+	checksum := descriptor&0x04 != 0
 
-			if !shared.IsValidTimeFormat(row[colName].(string)) {
-				return -1, fmt.Errorf("column %s is not a valid time", colName)
-			}
+	offset := 5 // magic number and frame header descriptor
 
-			// convert to time.Time
-			t, err := shared.StringToGOTime(row[colName].(string))
-			if err != nil {
-				return -1, fmt.Errorf("column %s is not a valid date", colName)
-			}
+	if !singleSegment {
+		offset++ // window descriptor
+	}
 
-			row[colName] = t
+	offset += []int{0, 1, 2, 4}[descriptor&0x03] // dictionary id
 
-		case "CHARACTER", "CHAR":
-			if _, ok := row[colName].(string); !ok {
+	switch descriptor >> 6 {
+	case 0:
+		if singleSegment {
+			offset++
+		}
+	case 1:
+		offset += 2
+	case 2:
+		offset += 4
+	case 3:
+		offset += 8
+	}
 
-				// if column can be null, check if it is null
-				if colDef.NotNull {
-					if row[colName] != nil {
-						return -1, fmt.Errorf("column %s is not a string", colName)
-					}
-				} else {
-					continue
-				}
+	// Blocks follow the header, each starts with a 3 byte block header
+	for {
+		if offset+3 > len(data) {
+			return 0, errors.New("truncated zstd frame")
+		}
 
-			} else {
-				// Check length
-				if len(strings.TrimSuffix(strings.TrimPrefix(row[colName].(string), "'"), "'")) > colDef.Length {
-					return -1, fmt.Errorf("column %s is too long", colName)
-				}
-			}
+		header := int(data[offset]) | int(data[offset+1])<<8 | int(data[offset+2])<<16
+		offset += 3
 
-		case "NUMERIC", "DECIMAL", "DEC", "FLOAT", "DOUBLE", "REAL":
-			if _, ok := row[colName].(float64); !ok {
+		lastBlock := header&0x01 != 0
+		blockSize := header >> 3
 
-				if colDef.NotNull {
-					if row[colName] != nil {
-						return -1, fmt.Errorf("column %s is not a floating point number", colName)
-					}
-				} else {
-					continue
-				}
-			}
+		// RLE blocks store a single byte
+		if (header>>1)&0x03 == 1 {
+			blockSize = 1
+		}
 
-			str := fmt.Sprintf("%.14g", row[colName].(float64))
+		offset += blockSize
 
-			// Split the string on the decimal point
-			parts := strings.Split(str, ".")
+		if lastBlock {
+			break
+		}
+	}
 
-			if len(parts) > 1 {
+	if checksum {
+		offset += 4
+	}
 
-				// The scale is the number of digits after the decimal point
-				scale := len(parts[1])
+	if offset > len(data) {
+		return 0, errors.New("truncated zstd frame")
+	}
 
-				// The precision is the total number of digits
-				precision := len(parts[0]) + len(parts[1])
+	return offset, nil
+}
 
-				if colDef.Scale > 0 {
-					// Check scale
+// IsCompressed returns true if a row starts with the ZSTD frame magic number
+func IsCompressed(row []byte) bool {
+	return bytes.HasPrefix(row, []byte{0x28, 0xb5, 0x2f, 0xfd})
+}
 
-					if scale > colDef.Scale {
-						return -1, fmt.Errorf("column %s has too many digits after the decimal point", colName)
-					}
+// Encrypt encrypts a row with ChaCha20
+func Encrypt(key [32]byte, nonce [12]byte, row []byte) ([]byte, error) {
+	var ciphertext = make([]byte, len(row))
 
-				}
+	// Create a new ChaCha20 cipher
+	c, err := chacha20.NewUnauthenticatedCipher(key[:], nonce[:])
+	if err != nil {
+		return nil, err
+	}
 
-				if colDef.Precision > 0 {
-					// Check precision
-					if precision > colDef.Precision {
-						return -1, fmt.Errorf("column %s is too large", colName)
-					}
-				}
-			}
+	// Encrypt the plaintext
+	c.XORKeyStream(ciphertext, row)
+	return ciphertext, nil
+}
 
-		case "INT", "INTEGER", "SMALLINT":
-			// Check for sequence
-			if colDef.Sequence {
-				// Check if sequence column is unique
-				idx := tbl.CheckIndexedColumn(colName, true)
-				if idx == nil {
-					return -1, fmt.Errorf("sequence column %s must be unique", colName)
-				}
+// Decrypt decrypts ciphertext using ChaCha20
+func Decrypt(key [32]byte, nonce [12]byte, cipherRow []byte) ([]byte, error) {
+	var plaintext = make([]byte, len(cipherRow))
 
-				// Increment sequence
-				seq, err := tbl.IncrementSequence()
-				if err != nil {
-					return -1, err
-				}
+	// Create a new ChaCha20 cipher
+	c, err := chacha20.NewUnauthenticatedCipher(key[:], nonce[:])
+	if err != nil {
+		return nil, err
+	}
 
-				row[colName] = seq
-			}
+	// Decrypt the ciphertext
+	c.XORKeyStream(plaintext, cipherRow)
+	return plaintext, nil
+}
 
-			if _, ok := row[colName].(int); !ok {
-				if _, ok := row[colName].(uint64); !ok {
-					return -1, fmt.Errorf("column %s is not an int", colName)
+// Alter alters a table, specifically a column
+func (tbl *Table) Alter(columnName string, columnDef *ColumnDefinition) error {
+	if columnDef == nil {
+		// Drop column
+		var existingIndexValues *Index
+
+		// Find indexes that are using that column
+		for _, idx := range tbl.Indexes {
+			// if the index is just using that column drop the index
+			// if the index is using multiple columns, remove the column from the index
+
+			if slices.Contains(idx.Columns, columnName) {
+				if len(idx.Columns) == 1 {
+					// Drop index
+					err := tbl.DropIndex(idx.Name)
+					if err != nil {
+						return err
+					}
 				} else {
-					row[colName] = int(row[colName].(uint64))
-				}
+					// Remove column from index
+					for i, col := range idx.Columns {
+						if col == columnName {
+							idx.Columns = append(idx.Columns[:i], idx.Columns[i+1:]...)
 
-			}
+							if !idx.Unique {
+								existingIndexValues = idx
+							}
+						}
 
-			// Check if value fits in either INT/INTEGER, SMALLINT
+					}
 
-			// Check if value fits in INT/INTEGER
-			if strings.ToUpper(colDef.DataType) == "INT" || strings.ToUpper(colDef.DataType) == "INTEGER" {
-				if row[colName].(int) > 2147483647 {
-					return -1, fmt.Errorf("column %s is too large for INT/INTEGER", colName)
 				}
 			}
+		}
 
-			// Check if value fits in SMALLINT
-			if strings.ToUpper(colDef.DataType) == "SMALLINT" {
-				if row[colName].(int) > 32767 {
-					return -1, fmt.Errorf("column %s is too large for SMALLINT", colName)
+		for _, b := range tbl.GetBloomFilters() {
+			if b.Column == columnName {
+				err := tbl.DropBloomFilter(b.Name)
+				if err != nil {
+					return err
 				}
 			}
-		default:
-			return -1, fmt.Errorf("invalid data type %s", colDef.DataType)
 		}
 
-		if colDef.Unique {
-			// Check if unique key exists
-			if !colDef.Sequence {
-				if _, ok := row[colName]; !ok {
-					return -1, fmt.Errorf("column %s cannot be null", colName)
-				}
-			}
+		// Drop column from schema
+		delete(tbl.TableSchema.ColumnDefinitions, columnName)
 
-			idx := tbl.CheckIndexedColumn(colName, true)
-			if idx == nil {
-				return -1, fmt.Errorf("problem getting unique rows for column %s", colName)
-			}
+		// iterate over all rows and remove the column
+		ri := tbl.NewIterator()
 
-			// Check if unique key exists
-			key, err := idx.btree.Get([]byte(fmt.Sprintf("%v", row[colName])))
+		for ri.Valid() {
+			row, err := ri.Next()
 			if err != nil {
-				return -1, fmt.Errorf("problem getting unique rows for column %s", colName)
+				continue
 			}
 
-			if key != nil {
-
-				for _, rowId := range key.V {
-					// We store a []byte(rowId) in the btree
-					// We need to convert it to an int64
-
-					// Convert []byte to int64
-					id, err := strconv.ParseInt(string(rowId), 10, 64)
-					if err != nil {
-						return -1, errors.New("problem getting unique rows")
-					}
-
-					// Get row from table
-					r, err := tbl.Rows.GetPage(id)
-					if err != nil {
-						return -1, errors.New("problem getting unique rows")
-					}
-
-					// Decode row
-					decoded, err := decodeRow(r)
-					if err != nil {
-						return -1, errors.New("problem getting unique rows")
-					}
-
-					// Check if row exists
-					if decoded[colName] == row[colName] {
-						return -1, fmt.Errorf("row with %s %v already exists", colName, row[colName])
-					}
-
+			if _, ok := row[columnName]; ok {
+				if existingIndexValues != nil {
+					// remove from indexes
+					existingIndexValues.btree.Remove(tbl.IndexKey(row[columnName]), []byte(fmt.Sprintf("%d", ri.Current())))
 				}
 			}
 
-		}
+			// Remove column from row
+			delete(row, columnName)
 
-		if colDef.References != nil {
-			// Check if foreign key exists
-			if _, ok := row[colName]; !ok {
-				return -1, fmt.Errorf("column %s cannot be null", colName)
+			encoded, err := EncodeRow(row)
+			if err != nil {
+				continue
 			}
 
-			// Get referenced table
-			refTbl := db.GetTable(colDef.References.TableName)
-			if refTbl == nil {
-				return -1, fmt.Errorf("foreign key constraint violation on column %s", colName)
+			if tbl.Compress {
+				encoded, err = Compress(encoded)
+				if err != nil {
+					continue
+				}
 			}
 
-			// Check if foreign key exists
-			idx := refTbl.CheckIndexedColumn(colName, true)
-			if idx == nil {
-				return -1, fmt.Errorf("foreign key constraint violation on column %s", colName)
+			if tbl.Encrypt {
+				encoded, err = Encrypt(tbl.HashedKey, tbl.Nonce, encoded)
+				if err != nil {
+					continue
+				}
 			}
 
-			if idx == nil {
-				return -1, fmt.Errorf("foreign key constraint violation on column %s", colName)
-
+			// Write row back to table
+			err = tbl.Rows.WriteTo(ri.Current(), encoded)
+			if err != nil {
+				return err
 			}
-
 		}
+	} else {
+		// check if column exists
+		if _, ok := tbl.TableSchema.ColumnDefinitions[columnName]; !ok {
+			// Column does not exist, add column
 
-	}
-
-	// Write row to table
-	rowId, err := tbl.writeRow(row)
-	if err != nil {
-		return -1, err
-	}
+			if len(columnName) > MAX_COLUMN_NAME_SIZE {
+				return fmt.Errorf("column name is too long, max length is %d", MAX_COLUMN_NAME_SIZE)
+			}
 
-	// Insert row into indexes
-	for col, val := range row {
-		for _, idx := range tbl.Indexes {
-			if slices.Contains(idx.Columns, col) {
+			if !shared.IsValidDataType(columnDef.DataType) {
+				return fmt.Errorf("invalid data type %s", columnDef.DataType)
+			}
 
-				// Check for compression
-				if tbl.Compress {
-					val, err = Compress([]byte(fmt.Sprintf("%v", val)))
-					if err != nil {
-						return -1, err
-					}
+			if columnDef.Unique {
+				err := tbl.CreateIndex(fmt.Sprintf("unique_%s", columnName), []string{columnName}, true)
+				if err != nil {
+					return err
 				}
+			} else if columnDef.References != nil {
+				err := tbl.CreateIndex(fmt.Sprintf("%s%s", FOREIGN_KEY_INDEX_PREFIX, columnName), []string{columnName}, false)
+				if err != nil {
+					return err
+				}
+			}
 
-				if tbl.Encrypt {
-					val, err = Encrypt(tbl.HashedKey, tbl.Nonce, val.([]byte))
-					if err != nil {
-						return -1, err
+			if columnDef.Sequence {
+				// Check if sequence column exists
+				var sequenceDefined bool
+				for _, colDef := range tbl.TableSchema.ColumnDefinitions {
+					if colDef.Sequence {
+						sequenceDefined = true
 					}
 				}
 
-				err := idx.btree.Put([]byte(fmt.Sprintf("%v", val)), []byte(fmt.Sprintf("%d", rowId)))
-				if err != nil {
-					return -1, err
+				if sequenceDefined {
+					return errors.New("sequence column already defined")
 				}
-			}
-		}
-	}
 
-	return rowId, nil
-}
+				// Sequenced column must be unique and not null
 
-// GetBtree gets the btree for an index
-func (idx *Index) GetBtree() *btree.BTree {
-	return idx.btree
-}
+				if !columnDef.Unique || !columnDef.NotNull {
 
-// writeRow writes a row to the table
-func (tbl *Table) writeRow(row map[string]interface{}) (int64, error) {
-	// Write row to table
+					return fmt.Errorf("sequence column %s must be unique and not null", columnName)
+				}
 
-	// encode row to bytes
-	encoded, err := EncodeRow(row)
-	if err != nil {
-		return -1, err
-	}
+				// Datatype MUST be an integer
+				if strings.ToUpper(columnDef.DataType) != "INT" && strings.ToUpper(columnDef.DataType) != "INTEGER" {
+					return fmt.Errorf("sequence column %s must be an integer", columnName)
+				}
 
-	// check if table has compression set
-	if tbl.Compress {
-		// compress row
-		encoded, err = Compress(encoded)
-		if err != nil {
-			return -1, err
-		}
+				sequenceDefined = true
+			}
 
-	}
+			switch strings.ToUpper(columnDef.DataType) {
+			case "CHARACTER", "CHAR":
+				// A character datatype requires a length
+				if columnDef.Length == 0 {
+					return fmt.Errorf("column %s requires a length", columnName)
+				}
+			case "NUMERIC", "DECIMAL", "DEC", "FLOAT", "DOUBLE", "REAL":
+				// A numeric datatype requires a precision and scale
+				if columnDef.Precision == 0 {
+					return fmt.Errorf("column %s requires a precision", columnName)
+				}
 
-	// Check if table has encryption set
-	if tbl.Encrypt {
-		// encrypt row
-		encoded, err = Encrypt(tbl.HashedKey, tbl.Nonce, encoded)
-		if err != nil {
-			return -1, err
-		}
-	}
+				if columnDef.Scale == 0 {
+					return fmt.Errorf("column %s requires a scale", columnName)
+				}
+			case "INT", "INTEGER", "SMALLINT":
+			case "DATE", "TIME", "TIMESTAMP", "DATETIME":
+			case "BINARY":
+			case "UUID":
+			case "BOOLEAN", "BOOL":
+			case "TEXT":
+			case "BLOB":
 
-	rowId, err := tbl.Rows.Write(encoded)
-	if err != nil {
-		return -1, err
-	}
+			default:
+				return fmt.Errorf("invalid data type %s", columnDef.DataType)
+			}
 
-	return rowId, nil
-}
+			// update schema
+			tbl.TableSchema.ColumnDefinitions[columnName] = columnDef
 
-// EncodeRow encodes a row to a byte slice
-func EncodeRow(n map[string]interface{}) ([]byte, error) {
-	// use gob
-	buff := new(bytes.Buffer)
+			// write schema to file
+			schemaFile, err := os.Create(filepath.Join(tbl.Directory, tbl.Name+DB_SCHEMA_TABLE_SCHEMA_FILE_EXTENSION))
+			if err != nil {
+				return err
+			}
 
-	enc := gob.NewEncoder(buff)
-	err := enc.Encode(n)
+			defer schemaFile.Close()
 
-	if err != nil {
-		return nil, err
+			// Encode schema to file
+			enc := gob.NewEncoder(schemaFile)
 
-	}
+			err = enc.Encode(tbl.TableSchema)
+			if err != nil {
+				return err
+			}
 
-	return buff.Bytes(), nil
-}
+			// iterate over all rows and add the column
+			ri := tbl.NewIterator()
 
-// decodeRow decodes a row from a byte slice
-func decodeRow(b []byte) (map[string]interface{}, error) {
-	var decoded map[string]interface{}
+			for ri.Valid() {
+				row, err := ri.Next()
+				if err != nil {
+					continue
+				}
 
-	err := gob.NewDecoder(bytes.NewReader(b)).Decode(&decoded)
-	if err != nil {
-		return nil, err
-	}
+				if columnDef.NotNull {
+					if _, ok := row[columnName]; !ok {
+						return fmt.Errorf("column %s cannot be null", columnName)
+					}
+				}
 
-	return decoded, nil
-}
+				if columnDef.Unique {
+					if _, ok := row[columnName]; !ok {
+						return fmt.Errorf("column %s cannot be null", columnName)
+					}
 
-// IncrementSequence increments the sequence for the table
-func (tbl *Table) IncrementSequence() (int, error) {
-	tbl.SeqLock.Lock()
-	defer tbl.SeqLock.Unlock()
-	d, err := os.ReadFile(tbl.SequenceFile.Name())
+					idx := tbl.CheckIndexedColumn(columnName, true)
+					if idx == nil {
+						return fmt.Errorf("problem getting unique rows for column %s", columnName)
+					}
 
-	if string(d) == "" {
-		tbl.SequenceFile.Write([]byte("1"))
-		return 1, nil
-	}
+					// Check if unique key exists
+					rowIds, err := tbl.IndexLookup(idx, columnName, row[columnName])
+					if err != nil {
+						return fmt.Errorf("problem getting unique rows for column %s", columnName)
+					}
 
-	i, err := strconv.Atoi(string(d))
-	if err != nil {
-		return 0, err
-	}
+					if len(rowIds) > 0 {
+						return fmt.Errorf("row with %s %v already exists", columnName, row[columnName])
+					}
+				}
 
-	j := i + 1
-	tbl.SequenceFile.Truncate(0)
-	tbl.SequenceFile.Seek(0, os.SEEK_SET)
-	tbl.SequenceFile.Write([]byte(fmt.Sprintf("%d", j)))
+			}
 
-	return j, nil
+		} else {
+			return errors.New("you can only drop a column or add a new column")
+		}
+	}
 
-	return 0, nil
-}
+	return nil
 
-// Iterator is an iterator for rows in a table
-type Iterator struct {
-	table *Table
-	row   int64
 }
 
-// GetTable gets the table for the iterator
-func (ri *Iterator) GetTable() *Table {
-	return ri.table
+// CheckIssue is a problem found when checking a data directory
+type CheckIssue struct {
+	Path     string // File or directory the problem was found in
+	Problem  string // Description of the problem
+	Repaired bool   // True if the problem was repaired
 }
 
-// GetRow gets a row by id
-func (tbl *Table) GetRow(rowId int64) (map[string]interface{}, error) {
-	// Read row from table
-	row, err := tbl.Rows.GetPage(rowId)
+// Check validates a data directory offline, the directory must not be in use by a running instance
+// Schema and index files must decode, index entries must point to live rows, unique indexes must not hold duplicates,
+// sequences must not be behind the largest sequenced value and files not belonging to a table are reported as orphaned.
+// With repair set dangling index entries and orphaned files are removed and sequences are moved forward.  Rows that do
+// not decode are reported and never repaired, index entries pointing to them are kept.
+func Check(directory string, repair bool) ([]*CheckIssue, error) {
+	issues := make([]*CheckIssue, 0)
+
+	// the data directory must not be in use by a running instance
+	directoryLock, err := storage.LockDirectory(directory, LOCK_FILE)
 	if err != nil {
 		return nil, err
 	}
 
-	// check for encryption
-	if tbl.Encrypt {
-		row, err = Decrypt(tbl.HashedKey, tbl.Nonce, row)
-		if err != nil {
-			return nil, err
-		}
-	}
+	defer directoryLock.Unlock()
 
-	if tbl.Compress {
-		row, err = Decompress(row)
+	databasesDir := filepath.Join(directory, "databases")
+
+	if repair {
+		resolved, err := RecoverDDLJournal(databasesDir)
 		if err != nil {
 			return nil, err
 		}
-	}
-
-	// decode row
-	decoded, err := decodeRow(row)
-	if err != nil {
-		return nil, err
-	}
-
-	return decoded, nil
-}
-
-// NewIterator returns a new row iterator
-func (tbl *Table) NewIterator() *Iterator {
-	return &Iterator{
-		table: tbl,
-		row:   0,
-	}
-}
-
-// Current returns the current row id
-func (ri *Iterator) Current() int64 {
-	return ri.row
-}
-
-// Next returns the next row in the table
-func (ri *Iterator) Next() (map[string]interface{}, error) {
-	for {
-		if slices.Contains(ri.table.Rows.GetDeletedPages(), ri.row) {
-			ri.row++
-			continue
 
-		} else {
-			break
+		for _, journalPath := range resolved {
+			issues = append(issues, &CheckIssue{Path: journalPath, Problem: "incomplete DDL operation", Repaired: true})
 		}
-
 	}
 
-	// Read row from table
-	row, err := ri.table.Rows.GetPage(ri.row)
+	databaseDirs, err := os.ReadDir(databasesDir)
 	if err != nil {
 		return nil, err
 	}
 
-	// decode row
-	decoded, err := decodeRow(row)
-	if err != nil {
-		ri.row++
-		// When decoding next a row can be an overflow or deleted that is why we skip it
-		return nil, nil
-	}
-
-	ri.row++
-
-	return decoded, nil
-}
-
-// Valid returns true if the iterator is valid
-func (ri *Iterator) Valid() bool {
-	return ri.row < ri.table.Rows.Count()
-
-}
-
-// IOCount returns the amount of IO operations
-func (tbl *Table) IOCount() int64 {
-	return tbl.Rows.Count() // This is not correct amount of rows as each page can be an overflow or deleted, this is just amount trips to disk
-}
-
-// CheckIndexedColumn checks if a column is indexed, if so return index
-// If unique is true, check if the index is unique
-func (tbl *Table) CheckIndexedColumn(column string, unique bool) *Index {
-	for _, idx := range tbl.Indexes {
-		if slices.Contains(idx.Columns, column) {
+	for _, databaseDir := range databaseDirs {
+		dbDirectory := filepath.Join(databasesDir, databaseDir.Name())
 
-			if idx.Unique == unique {
-				return idx
-			}
+		if strings.HasSuffix(databaseDir.Name(), DDL_JOURNAL_FILE_EXTENSION) {
+			issues = append(issues, &CheckIssue{Path: dbDirectory, Problem: "incomplete DDL operation, resolved on next start"})
+			continue
 		}
-	}
 
-	return nil
-}
+		if !databaseDir.IsDir() {
+			issues = append(issues, &CheckIssue{Path: dbDirectory, Problem: "orphaned file, not a database"})
+			continue
+		}
 
-// GetUniqueIndex gets the first unique index for a table
-func (tbl *Table) GetUniqueIndex() *Index {
-	for _, idx := range tbl.Indexes {
-		if idx.Unique {
-			return idx
+		entries, err := os.ReadDir(dbDirectory)
+		if err != nil {
+			return nil, err
 		}
-	}
 
-	return nil
+		for _, entry := range entries {
+			path := filepath.Join(dbDirectory, entry.Name())
 
-}
+			if entry.IsDir() && strings.HasSuffix(entry.Name(), TIER_MOVING_SUFFIX) {
+				issues = append(issues, &CheckIssue{Path: path, Problem: "incomplete move of a table between tiers, removed on next start"})
+				continue
+			}
 
-// DeleteRow deletes a row from the table
-func (tbl *Table) DeleteRow(rowId int64) error {
-	// Read row from table
-	row, err := tbl.Rows.GetPage(rowId)
-	if err != nil {
-		return err
-	}
+			if entry.IsDir() {
+				tblIssues, err := checkTable(path, entry.Name(), repair)
+				if err != nil {
+					return nil, err
+				}
 
-	// decode row
-	decoded, err := decodeRow(row)
-	if err != nil {
-		return err
-	}
+				issues = append(issues, tblIssues...)
+				continue
+			}
 
-	// Delete row from indexes
-	for col, val := range decoded {
-		for _, idx := range tbl.Indexes {
-			if slices.Contains(idx.Columns, col) {
-				// Remove from index
-				err := idx.btree.Remove([]byte(fmt.Sprintf("%v", val)), []byte(fmt.Sprintf("%d", rowId)))
+			if entry.Name() == databaseDir.Name()+DB_PROC_EXTENSION {
+				procFile, err := os.Open(path)
 				if err != nil {
-					return err
+					return nil, err
+				}
+
+				procedures := make(map[string]*Procedure)
+				err = gob.NewDecoder(procFile).Decode(&procedures)
+				procFile.Close()
+				if err != nil {
+					issues = append(issues, &CheckIssue{Path: path, Problem: fmt.Sprintf("procedures file does not decode: %s", err.Error())})
 				}
+				continue
 			}
-		}
-	}
 
-	// Delete row from table
-	err = tbl.Rows.DeletePage(rowId)
-	if err != nil {
-		return err
-	}
+			if entry.Name() == databaseDir.Name()+DB_MIGRATIONS_EXTENSION {
+				d, err := os.ReadFile(path)
+				if err != nil {
+					return nil, err
+				}
 
-	return nil
-}
+				migrations := make([]*SchemaMigration, 0)
+				err = gob.NewDecoder(bytes.NewReader(d)).Decode(&migrations)
+				if err != nil {
+					issues = append(issues, &CheckIssue{Path: path, Problem: fmt.Sprintf("migrations file does not decode: %s", err.Error())})
+				}
+				continue
+			}
 
-// SetClause Set for update
-type SetClause struct {
-	ColumnName string
-	Value      interface{}
-}
+			if entry.Name() == databaseDir.Name()+DB_TIERS_EXTENSION {
+				d, err := os.ReadFile(path)
+				if err != nil {
+					return nil, err
+				}
 
-// CopyRow copies a row
-func CopyRow(row *map[string]interface{}) map[string]interface{} {
-	newRow := make(map[string]interface{})
-	for k, v := range *row {
-		newRow[k] = v
-	}
-	return newRow
-}
+				tiers := make(map[string]string)
+				err = gob.NewDecoder(bytes.NewReader(d)).Decode(&tiers)
+				if err != nil {
+					issues = append(issues, &CheckIssue{Path: path, Problem: fmt.Sprintf("tiers file does not decode: %s", err.Error())})
+				}
+				continue
+			}
 
-// UpdateRow updates a row in the table
-func (tbl *Table) UpdateRow(rowId int64, row map[string]interface{}, sets []*SetClause) error {
+			if entry.Name() == databaseDir.Name()+DB_WARM_EXTENSION {
+				d, err := os.ReadFile(path)
+				if err != nil {
+					return nil, err
+				}
 
-	var prevRow map[string]interface{}
+				err = gob.NewDecoder(bytes.NewReader(d)).Decode(&[]string{})
+				if err != nil {
+					issues = append(issues, &CheckIssue{Path: path, Problem: fmt.Sprintf("warm tables file does not decode: %s", err.Error())})
+				}
+				continue
+			}
 
-	for _, set := range sets {
+			if entry.Name() == databaseDir.Name()+DB_SETTINGS_EXTENSION {
+				d, err := os.ReadFile(path)
+				if err != nil {
+					return nil, err
+				}
 
-		if _, ok := row[set.ColumnName]; !ok {
-			return fmt.Errorf("column %s does not exist", set.ColumnName)
+				err = gob.NewDecoder(bytes.NewReader(d)).Decode(&DatabaseSettings{})
+				if err != nil {
+					issues = append(issues, &CheckIssue{Path: path, Problem: fmt.Sprintf("settings file does not decode: %s", err.Error())})
+				}
+				continue
+			}
+
+			issues = append(issues, checkOrphan(path, repair))
 		}
+	}
 
-		prevRow = CopyRow(&row)
-		row[set.ColumnName] = set.Value
+	return issues, nil
+}
 
-		// Check row against schema
-		for colName, colDef := range tbl.TableSchema.ColumnDefinitions {
-			if colName == set.ColumnName {
-				switch strings.ToUpper(colDef.DataType) {
-				case "CHARACTER", "CHAR":
-					if _, ok := row[colName].(string); !ok {
-						if !colDef.NotNull {
-							if row[colName] != nil {
-								return fmt.Errorf("column %s is not a string", colName)
-							}
-						}
-					} else {
-						// Check length
-						if len(row[colName].(string)) > colDef.Length {
-							return fmt.Errorf("column %s is too long", colName)
-						}
-					}
+// checkOrphan reports a file that does not belong to the catalog, removing it when repairing
+func checkOrphan(path string, repair bool) *CheckIssue {
+	if strings.HasSuffix(path, DDL_JOURNAL_FILE_EXTENSION) {
+		// Only left when not repairing, repairing resolves the journal first
+		return &CheckIssue{Path: path, Problem: "incomplete DDL operation, resolved on next start"}
+	}
 
-				case "NUMERIC", "DECIMAL", "DEC", "FLOAT", "DOUBLE", "REAL":
-					if _, ok := row[colName].(float64); !ok {
-						return fmt.Errorf("column %s is not a float64", colName)
-					}
+	issue := &CheckIssue{Path: path, Problem: "orphaned file"}
 
-					str := fmt.Sprintf("%.14g", row[colName].(float64))
+	if repair {
+		issue.Repaired = os.RemoveAll(path) == nil
+	}
 
-					// Split the string on the decimal point
-					parts := strings.Split(str, ".")
+	return issue
+}
 
-					if len(parts) > 1 {
+// checkTable checks a single table directory
+func checkTable(directory, name string, repair bool) ([]*CheckIssue, error) {
+	issues := make([]*CheckIssue, 0)
+	schemaPath := filepath.Join(directory, name+DB_SCHEMA_TABLE_SCHEMA_FILE_EXTENSION)
+	dataPath := filepath.Join(directory, name+DB_SCHEMA_TABLE_DATA_FILE_EXTENSION)
+	seqPath := filepath.Join(directory, name+DB_SCHEMA_TABLE_SEQ_FILE_EXTENSION)
 
-						// The scale is the number of digits after the decimal point
-						scale := len(parts[1])
+	// Read schema file
+	schemaFile, err := os.Open(schemaPath)
+	if err != nil {
+		return append(issues, &CheckIssue{Path: directory, Problem: "table has no schema file"}), nil
+	}
 
-						// The precision is the total number of digits
-						precision := len(parts[0]) + len(parts[1])
+	tblSchema := &TableSchema{}
+	err = gob.NewDecoder(schemaFile).Decode(tblSchema)
+	schemaFile.Close()
+	if err != nil {
+		return append(issues, &CheckIssue{Path: schemaPath, Problem: fmt.Sprintf("schema does not decode: %s", err.Error())}), nil
+	}
 
-						if colDef.Scale > 0 {
-							// Check scale
+	if _, err := os.Stat(seqPath); err != nil {
+		issues = append(issues, &CheckIssue{Path: seqPath, Problem: "table has no sequence file"})
+	}
 
-							if scale > colDef.Scale {
-								return fmt.Errorf("column %s has too many digits after the decimal point", colName)
-							}
+	rows, err := btree.OpenPager(dataPath, os.O_RDWR, 0755)
+	if err != nil {
+		return append(issues, &CheckIssue{Path: dataPath, Problem: fmt.Sprintf("data file does not open: %s", err.Error())}), nil
+	}
 
-						}
+	defer rows.Close()
 
-						if colDef.Precision > 0 {
-							// Check precision
-							if precision > colDef.Precision {
-								return fmt.Errorf("column %s is too large", colName)
-							}
-						}
-					}
+	tbl := &Table{Name: name, Directory: directory, Rows: rows, TableSchema: tblSchema, Compress: tblSchema.Compress}
 
-				case "INT", "INTEGER", "SMALLINT":
+	// Decode every live row, encrypted rows can not be decoded without the table key
+	decoded := make(map[int64]map[string]interface{})
+	undecoded := make(map[int64]error)
+	pages := make([]int64, 0)
 
-					if _, ok := row[colName].(int); !ok {
-						if _, ok := row[colName].(uint64); !ok {
-							return fmt.Errorf("column %s is not an int", colName)
-						} else {
-							row[colName] = int(row[colName].(uint64))
-						}
-					}
+	for rowId := int64(0); rowId < rows.Count(); rowId++ {
+		if rows.IsDeleted(rowId) {
+			continue
+		}
 
-					// Check if value fits in INT/INTEGER
-					if strings.ToUpper(colDef.DataType) == "INT" || strings.ToUpper(colDef.DataType) == "INTEGER" {
-						if row[colName].(int) > 2147483647 {
-							return fmt.Errorf("column %s is too large for INT/INTEGER", colName)
-						}
-					}
+		page, err := rows.GetPage(rowId)
+		if errors.Is(err, btree.ErrOverflowPage) {
+			continue
+		}
 
-					// Check if value fits in SMALLINT
-					if strings.ToUpper(colDef.DataType) == "SMALLINT" {
-						if row[colName].(int) > 32767 {
-							return fmt.Errorf("column %s is too large for SMALLINT", colName)
-						}
-					}
+		pages = append(pages, rowId)
 
-				}
+		if errors.Is(err, btree.ErrCorruptPage) {
+			issues = append(issues, &CheckIssue{Path: dataPath, Problem: fmt.Sprintf("row %d: %s", rowId, err.Error())})
+			continue
+		} else if err != nil {
+			continue
+		}
 
-			}
+		row, err := tbl.readRow(page)
+		if err != nil {
+			// A damaged or an encrypted row
+			undecoded[rowId] = err
+			continue
 		}
 
+		decoded[rowId] = row
 	}
 
-	// Encode row
-	encoded, err := EncodeRow(row)
-	if err != nil {
-		return err
+	// Every row that is not deleted is live, whether it decodes or not, so repairing never removes the index entries
+	// of a row that is damaged
+	live := make(map[int64]bool)
+	for _, rowId := range pages {
+		live[rowId] = true
 	}
 
-	err = tbl.Rows.WriteTo(rowId, encoded)
-	if err != nil {
-		return err
+	rowLevel := len(decoded) > 0 || len(pages) == 0
+	if !rowLevel {
+		issues = append(issues, &CheckIssue{Path: dataPath, Problem: "rows do not decode, table may be encrypted, row level checks skipped"})
+	} else {
+		// Rows of a table whose other rows decode are damaged, they are left for inspection
+		for _, rowId := range slices.Sorted(maps.Keys(undecoded)) {
+			issues = append(issues, &CheckIssue{Path: dataPath, Problem: fmt.Sprintf("row %d does not decode, its index entries are kept: %s", rowId, undecoded[rowId].Error())})
+		}
 	}
 
-	for _, set := range sets {
-		for colName, _ := range tbl.TableSchema.ColumnDefinitions {
-			if colName == set.ColumnName {
-				for _, idx := range tbl.Indexes {
-					if slices.Contains(idx.Columns, colName) {
-						// Remove old value from index
-						err := idx.btree.Remove([]byte(fmt.Sprintf("%v", prevRow[colName])), []byte(fmt.Sprintf("%d", rowId)))
-						if err != nil {
-							return err
-						}
+	// Check sequence
+	for colName, colDef := range tblSchema.ColumnDefinitions {
+		if !colDef.Sequence || !rowLevel {
+			continue
+		}
 
-						// Insert into index
-						err = idx.btree.Put([]byte(fmt.Sprintf("%v", row[colName])), []byte(fmt.Sprintf("%d", rowId)))
-						if err != nil {
-							return err
-						}
-					}
-				}
+		maxValue := 0
+		for _, row := range decoded {
+			if v, err := strconv.Atoi(fmt.Sprintf("%v", row[colName])); err == nil && v > maxValue {
+				maxValue = v
 			}
 		}
-	}
 
-	return nil
+		d, _ := os.ReadFile(seqPath)
+		current, _ := strconv.Atoi(string(d))
 
-}
+		if current < maxValue {
+			issue := &CheckIssue{Path: seqPath, Problem: fmt.Sprintf("sequence is at %d, column %s holds %d", current, colName, maxValue)}
 
-// RevokePrivilegeFromUser revokes a privilege from a user
-func (cat *Catalog) RevokePrivilegeFromUser(username string, priv *Privilege) error {
-	// Lock users map
-	cat.UsersLock.Lock()
-	defer cat.UsersLock.Unlock()
+			if repair {
+				issue.Repaired = os.WriteFile(seqPath, []byte(fmt.Sprintf("%d", maxValue)), 0755) == nil
+			}
 
-	// Check if user exists
-	if _, ok := cat.Users[username]; !ok {
-		return fmt.Errorf("user %s does not exist", username)
+			issues = append(issues, issue)
+		}
 	}
 
-	// Check if privilege exists
-	for _, p := range cat.Users[username].Privileges {
-		if p.DatabaseName == priv.DatabaseName && p.TableName == priv.TableName {
+	indexes := make(map[string]bool)
 
-			// Revoke privilege
-			for i, l := range cat.Users[username].Privileges {
-				if l.DatabaseName == l.DatabaseName && l.TableName == l.TableName {
+	entries, err := os.ReadDir(directory)
+	if err != nil {
+		return nil, err
+	}
 
-					if len(l.PrivilegeActions) == len(priv.PrivilegeActions) {
+	// Check indexes
+	for _, entry := range entries {
+		if !strings.HasSuffix(entry.Name(), DB_SCHEMA_TABLE_INDEX_FILE_EXTENSION) {
+			continue
+		}
 
-						cat.Users[username].Privileges = append(cat.Users[username].Privileges[:i], cat.Users[username].Privileges[i+1:]...)
-					} else {
-						for _, a := range priv.PrivilegeActions {
-							for j, b := range l.PrivilegeActions {
-								if a == b {
-									// only remove the privilege action
-									cat.Users[username].Privileges[i].PrivilegeActions = append(l.PrivilegeActions[:j], l.PrivilegeActions[j+1:]...)
-								}
-							}
-						}
-					}
-					break
-				}
-			}
+		indexPath := filepath.Join(directory, entry.Name())
 
-			err := cat.EncodeUsersToFile()
+		indexFile, err := os.Open(indexPath)
+		if err != nil {
+			return nil, err
+		}
+
+		idx := &Index{}
+		err = gob.NewDecoder(indexFile).Decode(idx)
+		indexFile.Close()
+		if err != nil {
+			issues = append(issues, &CheckIssue{Path: indexPath, Problem: fmt.Sprintf("index does not decode: %s", err.Error())})
+			continue
+		}
+
+		idx.Name = indexName(entry.Name())
+		indexes[fmt.Sprintf("idx_%s", idx.Name)] = true
 
-			if err != nil {
-				return err
-			}
+		btPath := filepath.Join(directory, fmt.Sprintf("idx_%s.bt", idx.Name))
+		if _, err := os.Stat(btPath); err != nil {
+			issues = append(issues, &CheckIssue{Path: btPath, Problem: fmt.Sprintf("index %s has no btree file", idx.Name)})
+			continue
+		}
 
-			return nil
+		bt, err := btree.Open(btPath, os.O_RDWR, 0755, 6)
+		if err != nil {
+			issues = append(issues, &CheckIssue{Path: btPath, Problem: fmt.Sprintf("index btree does not open: %s", err.Error())})
+			continue
+		}
 
+		keys, err := bt.Range([]byte{}, []byte{0xff})
+		if err != nil {
+			issues = append(issues, &CheckIssue{Path: btPath, Problem: fmt.Sprintf("index btree does not read: %s", err.Error())})
+			bt.Close()
+			continue
 		}
 
-	}
+		for _, k := range keys {
+			key := k.(*btree.Key)
+			liveIds := 0
 
-	return fmt.Errorf("privilege does not exist for user %s", username)
-}
+			for _, v := range key.V {
+				rowId, err := strconv.ParseInt(string(v), 10, 64)
+				if err == nil && live[rowId] {
+					liveIds++
+					continue
+				}
 
-// GrantPrivilegeToUser grants a privilege to a user
-func (cat *Catalog) GrantPrivilegeToUser(username string, priv *Privilege) error {
-	// Lock users map
-	cat.UsersLock.Lock()
-	defer cat.UsersLock.Unlock()
+				issue := &CheckIssue{Path: btPath, Problem: fmt.Sprintf("index %s entry %q points to row %s which does not exist", idx.Name, key.K, v)}
 
-	// Check if user exists
-	if _, ok := cat.Users[username]; !ok {
-		return fmt.Errorf("user %s does not exist", username)
-	}
+				if repair {
+					issue.Repaired = bt.Remove(key.K, v) == nil
+				}
 
-	// Check if privilege exists
-	for _, p := range cat.Users[username].Privileges {
-		if p.DatabaseName == priv.DatabaseName && p.TableName == priv.TableName {
-			return fmt.Errorf(fmt.Sprintf("privilege already exists for user %s", username))
+				issues = append(issues, issue)
+			}
+
+			// Buckets of an encrypted table hold many values
+			if idx.Unique && rowLevel && liveIds > 1 && string(key.K) != INDEX_NULL_KEY {
+				issues = append(issues, &CheckIssue{Path: btPath, Problem: fmt.Sprintf("unique index %s holds %d rows for %q", idx.Name, liveIds, key.K)})
+			}
 		}
-	}
 
-	cat.Users[username].Privileges = append(cat.Users[username].Privileges, priv)
+		bt.Close()
+	}
 
-	err := cat.EncodeUsersToFile()
+	// Check for orphaned files
+	for _, entry := range entries {
+		fileName := entry.Name()
+
+		switch {
+		case fileName == name+DB_SCHEMA_TABLE_SCHEMA_FILE_EXTENSION,
+			fileName == name+DB_SCHEMA_TABLE_DATA_FILE_EXTENSION,
+			fileName == name+DB_SCHEMA_TABLE_DATA_FILE_EXTENSION+".del",
+			fileName == name+DB_SCHEMA_TABLE_DATA_FILE_EXTENSION+btree.DIRTY_PAGES_EXTENSION,
+			fileName == name+DB_SCHEMA_TABLE_SEQ_FILE_EXTENSION,
+			fileName == name+DB_SCHEMA_TABLE_HISTORY_FILE_EXTENSION,
+			fileName == name+DB_SCHEMA_TABLE_HISTORY_FILE_EXTENSION+".del",
+			fileName == name+DB_SCHEMA_TABLE_HISTORY_FILE_EXTENSION+btree.DIRTY_PAGES_EXTENSION:
+			continue
+		case strings.HasSuffix(fileName, DB_SCHEMA_TABLE_INDEX_FILE_EXTENSION),
+			strings.HasSuffix(fileName, DB_SCHEMA_TABLE_BLOOM_FILE_EXTENSION):
+			continue
+		case strings.HasSuffix(fileName, DB_SCHEMA_TABLE_BLOOM_BITS_FILE_EXTENSION):
+			// Bits of a bloom filter without its bloom filter file are orphaned
+			if _, err := os.Stat(filepath.Join(directory, strings.TrimSuffix(fileName, DB_SCHEMA_TABLE_BLOOM_BITS_FILE_EXTENSION)+DB_SCHEMA_TABLE_BLOOM_FILE_EXTENSION)); err == nil {
+				continue
+			}
+		case strings.HasSuffix(fileName, ".bt") && indexes[strings.TrimSuffix(fileName, ".bt")],
+			strings.HasSuffix(fileName, ".bt.del") && indexes[strings.TrimSuffix(fileName, ".bt.del")],
+			strings.HasSuffix(fileName, ".bt"+btree.DIRTY_PAGES_EXTENSION) && indexes[strings.TrimSuffix(fileName, ".bt"+btree.DIRTY_PAGES_EXTENSION)]:
+			continue
+		}
 
-	if err != nil {
-		return err
+		issues = append(issues, checkOrphan(filepath.Join(directory, fileName), repair))
 	}
 
-	return nil
-
+	return issues, nil
 }
 
-// DropUser removes a user
-func (cat *Catalog) DropUser(username string) error {
-	// Lock users map
-	cat.UsersLock.Lock()
-	defer cat.UsersLock.Unlock()
-
-	// Check if user exists
-	if _, ok := cat.Users[username]; !ok {
-		return fmt.Errorf("user %s does not exist", username)
-	}
+// DDLOperation is the kind of DDL operation a journal entry is for
+type DDLOperation int
 
-	// Drop user
-	delete(cat.Users, username)
+const (
+	_          DDLOperation = iota
+	DDL_CREATE              // Incomplete creates are rolled back
+	DDL_DROP                // Incomplete drops are rolled forward
+	DDL_RENAME              // Incomplete renames are rolled forward
+)
 
-	err := cat.EncodeUsersToFile()
-	if err != nil {
-		return err
-	}
+// DDLJournalEntry is an in-flight DDL operation
+type DDLJournalEntry struct {
+	Operation DDLOperation // Operation
+	Paths     []string     // Files and directories created, removed or renamed by the operation, relative to the directory of the entry
+	Targets   []string     // Paths are renamed to, for renames
+}
 
-	return nil
+// journalBegin writes a journal entry for a DDL operation on name within directory
+func journalBegin(directory, name string, operation DDLOperation, paths ...string) error {
+	return writeJournal(directory, name, &DDLJournalEntry{Operation: operation, Paths: paths})
+}
 
+// journalRename writes a journal entry for renaming paths to targets on name within directory
+func journalRename(directory, name string, paths, targets []string) error {
+	return writeJournal(directory, name, &DDLJournalEntry{Operation: DDL_RENAME, Paths: paths, Targets: targets})
 }
 
-// CreateNewUser creates a new user
-func (cat *Catalog) CreateNewUser(username, password string) error {
-	// Lock users map
-	cat.UsersLock.Lock()
-	defer cat.UsersLock.Unlock()
+// writeJournal writes a journal entry on name within directory, its paths must be within directory
+func writeJournal(directory, name string, entry *DDLJournalEntry) error {
+	// Paths are kept relative so an entry stays valid when the data directory moves
+	relative := func(paths []string) ([]string, error) {
+		rel := make([]string, 0, len(paths))
 
-	// Check if user exists
-	if _, ok := cat.Users[username]; ok {
-		return fmt.Errorf("user %s already exists", username)
+		for _, path := range paths {
+			r, err := filepath.Rel(directory, path)
+			if err != nil {
+				return nil, err
+			}
+
+			_, err = journalPath(directory, r)
+			if err != nil {
+				return nil, err
+			}
+
+			rel = append(rel, r)
+		}
+
+		return rel, nil
 	}
 
-	// bcrypt password
-	hashedPassword, err := shared.HashPassword(password)
+	paths, err := relative(entry.Paths)
 	if err != nil {
 		return err
 	}
 
-	// Create user
-	cat.Users[username] = &User{
-		Username: username,
-		Password: hashedPassword,
-	}
-
-	err = cat.EncodeUsersToFile()
+	targets, err := relative(entry.Targets)
 	if err != nil {
 		return err
 	}
 
-	return nil
-
-}
-
-// EncodeUsersToFile encodes users to file
-func (cat *Catalog) EncodeUsersToFile() error {
-	// Lock users file
-	cat.UsersFileLock.Lock()
-	defer cat.UsersFileLock.Unlock()
-
-	// seek to beginning of file
-	if _, err := cat.UsersFile.Seek(0, 0); err != nil {
+	journalFile, err := os.Create(filepath.Join(directory, name+DDL_JOURNAL_FILE_EXTENSION))
+	if err != nil {
 		return err
 	}
 
-	// Encode users to file
-	enc := gob.NewEncoder(cat.UsersFile)
+	defer journalFile.Close()
 
-	err := enc.Encode(cat.Users)
+	// Encode entry to file
+	enc := gob.NewEncoder(journalFile)
+
+	err = enc.Encode(&DDLJournalEntry{Operation: entry.Operation, Paths: paths, Targets: targets})
 	if err != nil {
 		return err
 	}
 
-	return nil
+	// The entry must be on disk before the operation touches any files
+	return journalFile.Sync()
 }
 
-// ReadUsersFromFile reads users from file
-func (cat *Catalog) ReadUsersFromFile() error {
-
-	if _, err := cat.UsersFile.Seek(0, 0); err != nil {
-		return err
+// journalPath resolves a path of a journal entry against the directory of the entry
+// An entry only ever touches files within its directory, any other path is refused.
+func journalPath(directory, path string) (string, error) {
+	if filepath.IsAbs(path) {
+		return "", fmt.Errorf("journal path %s is not within %s", path, directory)
 	}
 
-	// Check size
-	fi, err := cat.UsersFile.Stat()
-	if err != nil {
-		return err
+	path = filepath.Clean(path)
+	if path == "." || path == ".." || strings.HasPrefix(path, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("journal path %s is not within %s", path, directory)
 	}
 
-	if fi.Size() == 0 {
+	return filepath.Join(directory, path), nil
+}
 
-		return errors.New("users file is empty")
+// journalEnd ends a DDL operation on name within directory, err is the error the operation returns
+// A failed operation is resolved as on recovery before its entry is removed, the entry is kept for Open to
+// resolve if that fails too.
+func journalEnd(directory, name string, err *error) {
+	journalFile := filepath.Join(directory, name+DDL_JOURNAL_FILE_EXTENSION)
+
+	if *err != nil {
+		rerr := resolveJournal(directory, journalFile)
+		if rerr != nil {
+			log.Printf("keeping DDL journal entry %s: %s", journalFile, rerr.Error())
+			return
+		}
 	}
 
-	// Lock users file
-	cat.UsersFileLock.Lock()
-	defer cat.UsersFileLock.Unlock()
-
-	// Read users from file
-	dec := gob.NewDecoder(cat.UsersFile)
+	os.Remove(journalFile)
+}
 
-	err = dec.Decode(&cat.Users)
+// resolveJournal resolves the journal entry of journalFile within directory, rolling back a create and finishing a drop or rename
+func resolveJournal(directory, journalFile string) error {
+	f, err := os.Open(journalFile)
 	if err != nil {
 		return err
 	}
 
-	return nil
-}
+	journalEntry := &DDLJournalEntry{}
+	err = gob.NewDecoder(f).Decode(journalEntry)
+	f.Close()
 
-// GetUser gets a user by username
-func (cat *Catalog) GetUser(username string) *User {
-	cat.UsersLock.Lock()
-	defer cat.UsersLock.Unlock()
-	return cat.Users[username]
-}
+	// An entry that does not decode was never completely written, its operation did not start
+	if err != nil {
+		return nil
+	}
 
-// AuthenticateUser authenticates a user
-func (cat *Catalog) AuthenticateUser(username, password string) (*User, error) {
-	cat.UsersLock.Lock()
-	defer cat.UsersLock.Unlock()
+	paths := make([]string, 0, len(journalEntry.Paths))
 
-	// Check if user exists
-	if _, ok := cat.Users[username]; !ok {
-		return nil, fmt.Errorf("user %s does not exist", username)
-	}
+	for _, path := range journalEntry.Paths {
+		path, err = journalPath(directory, path)
+		if err != nil {
+			return err
+		}
 
-	// Check password
-	ok := shared.ComparePasswords(cat.Users[username].Password, password)
-	if !ok {
-		return nil, errors.New("authentication failed")
+		paths = append(paths, path)
 	}
 
-	return cat.Users[username], nil
-}
-
-// HasPrivilege checks if a user has a privilege
-func (u *User) HasPrivilege(db, tbl string, actions []shared.PrivilegeAction) bool {
+	if journalEntry.Operation == DDL_RENAME {
+		if len(journalEntry.Targets) != len(paths) {
+			return fmt.Errorf("journal entry %s does not have a target for every path", journalFile)
+		}
 
-	var has []bool // Slice of booleans determining if user has privileges
+		for i, path := range paths {
+			target, err := journalPath(directory, journalEntry.Targets[i])
+			if err != nil {
+				return err
+			}
 
-	for _, p := range u.Privileges {
-		for _, a := range actions {
-			if p.DatabaseName == db && p.TableName == tbl { // if the requested database and table match the privilege
-				for _, pa := range p.PrivilegeActions {
-					if pa == a { // if the privilege action matches the requested action
-						has = append(has, true)
-					} else if pa == shared.PRIV_ALL { // if the privilege action is all
-						has = append(has, true)
-					}
-				}
-			} else if p.DatabaseName == "*" && p.TableName == "*" { // all databases and tables
-				for _, pa := range p.PrivilegeActions {
-					if pa == a {
-						has = append(has, true)
-					} else if pa == shared.PRIV_ALL {
-						has = append(has, true)
-					}
-				}
-			} else if p.DatabaseName == db && p.TableName == "*" { // all tables in a database
-				for _, pa := range p.PrivilegeActions {
-					if pa == a {
-						has = append(has, true)
-					} else if pa == shared.PRIV_ALL {
-						has = append(has, true)
-					}
-				}
-			} else if p.DatabaseName == "*" && p.TableName == tbl { // all databases and a table
-				for _, pa := range p.PrivilegeActions {
-					if pa == a {
-						has = append(has, true)
-					} else if pa == shared.PRIV_ALL {
-						has = append(has, true)
-					}
-				}
+			err = os.Rename(path, target)
+			if err != nil && !os.IsNotExist(err) {
+				return err
 			}
 		}
+
+		return nil
 	}
 
-	if len(has) == len(actions) {
-		return true
+	for _, path := range paths {
+		err = os.RemoveAll(path)
+		if err != nil {
+			return err
+		}
 	}
 
-	return false
+	return nil
 }
 
-// GetUsers gets all users
-func (cat *Catalog) GetUsers() []string {
-	cat.UsersLock.Lock()
-	defer cat.UsersLock.Unlock()
+// RecoverDDLJournal resolves DDL journal entries left behind within directory and its sub directories
+// Creates and drops are both resolved by removing every path of the entry, an incomplete create is undone and an incomplete drop is finished
+// Renames are finished by renaming the paths not renamed yet
+// Returns the journal entry files that were resolved
+func RecoverDDLJournal(directory string) ([]string, error) {
+	resolved := make([]string, 0)
 
-	var users []string
-	for k := range cat.Users {
-		users = append(users, k)
+	entries, err := os.ReadDir(directory)
+	if err != nil {
+		return nil, err
 	}
 
-	slices.Sort(users)
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), DDL_JOURNAL_FILE_EXTENSION) {
+			continue
+		}
 
-	return users
-}
+		journalFile := filepath.Join(directory, entry.Name())
 
-// GetTables gets all tables in a database
-func (db *Database) GetTables() []string {
+		err = resolveJournal(directory, journalFile)
+		if err != nil {
+			return nil, err
+		}
 
-	db.TablesLock.Lock()
-	defer db.TablesLock.Unlock()
+		err = os.Remove(journalFile)
+		if err != nil {
+			return nil, err
+		}
 
-	var tables []string
-	for k := range db.Tables {
-		tables = append(tables, k)
+		resolved = append(resolved, journalFile)
 	}
 
-	return tables
-}
+	// Re-read as resolved entries can remove directories
+	entries, err = os.ReadDir(directory)
+	if err != nil {
+		return nil, err
+	}
 
-// GetDatabases gets all databases
-func (cat *Catalog) GetDatabases() []string {
-	cat.DatabasesLock.Lock()
-	defer cat.DatabasesLock.Unlock()
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
 
-	var dbs []string
-	for k := range cat.Databases {
-		dbs = append(dbs, k)
+		subResolved, err := RecoverDDLJournal(filepath.Join(directory, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		resolved = append(resolved, subResolved...)
 	}
 
-	slices.Sort(dbs)
+	return resolved, nil
+}
 
-	return dbs
+// BackupManifest describes a backup, a full backup or an incremental backup holding the pages changed since the previous backup
+type BackupManifest struct {
+	Sequence      int           // Position of the backup within the backup directory
+	Incremental   bool          // True if the backup is based on the previous backup
+	LayoutVersion int           // Layout version of the backed up data directory
+	Created       time.Time     // When the backup was taken
+	Encrypted     bool          // True if the files within the backup are encrypted with a key derived from a passphrase
+	Salt          []byte        // Salt the key of an encrypted backup is derived with
+	Files         []*BackupFile // Every file of the data directory
+	MAC           []byte        // HMAC-SHA256 of the manifest keyed by the key of an encrypted backup, see manifestMAC
 }
 
-// AlterUserUsername alters a user's username
-func (cat *Catalog) AlterUserUsername(oldUsername, newUsername string) error {
-	// Lock users map
-	cat.UsersLock.Lock()
-	defer cat.UsersLock.Unlock()
+// BackupFile is a file within a backup
+type BackupFile struct {
+	Path        string  // Path relative to the data directory
+	Size        int64   // Size of the file
+	Incremental bool    // True if only Pages are within the backup, otherwise the whole file is
+	Pages       []int64 // Pages changed since the previous backup, stored one after another
+	Checksum    []byte  // SHA-256 of the file or pages within the backup, an HMAC-SHA256 keyed by the backup key if encrypted
+}
 
-	// Check if user exists
-	if _, ok := cat.Users[oldUsername]; !ok {
-		return fmt.Errorf("user %s does not exist", oldUsername)
+// Backup backs up a data directory into a new sequence within the backup directory
+// An incremental backup copies only pages written since the previous backup, other files are copied whole
+// With a passphrase the files within the backup are encrypted
+// The data directory must not be in use
+func Backup(directory, backupDirectory string, incremental bool, passphrase string) (*BackupManifest, error) {
+	directoryLock, err := storage.LockDirectory(directory, LOCK_FILE)
+	if err != nil {
+		return nil, err
 	}
 
-	// Check if new username already exists
-	if _, ok := cat.Users[newUsername]; ok {
-		return fmt.Errorf("user %s already exists", newUsername)
-	}
+	defer directoryLock.Unlock()
 
-	// Create user
-	cat.Users[newUsername] = cat.Users[oldUsername]
-	cat.Users[newUsername].Username = newUsername
+	manifests, err := readBackupManifests(backupDirectory)
+	if err != nil {
+		return nil, err
+	}
 
-	// Drop old user
-	delete(cat.Users, oldUsername)
+	if incremental && len(manifests) == 0 {
+		return nil, errors.New("no previous backup to base an incremental backup on")
+	}
 
-	err := cat.EncodeUsersToFile()
+	version, err := readLayoutVersion(directory)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	return nil
+	manifest := &BackupManifest{Sequence: 1, Incremental: incremental, LayoutVersion: version, Created: shared.Now()}
+	if len(manifests) > 0 {
+		manifest.Sequence = manifests[len(manifests)-1].Sequence + 1
+	}
 
-}
+	var key []byte
 
-// AlterUserPassword alters a user's password
-func (cat *Catalog) AlterUserPassword(username, password string) error {
-	// Lock users map
-	cat.UsersLock.Lock()
-	defer cat.UsersLock.Unlock()
+	if passphrase != "" {
+		manifest.Encrypted = true
+		manifest.Salt = make([]byte, 16)
 
-	// Check if user exists
-	if _, ok := cat.Users[username]; !ok {
-		return fmt.Errorf("user %s does not exist", username)
-	}
+		_, err = rand.Read(manifest.Salt)
+		if err != nil {
+			return nil, err
+		}
 
-	// bcrypt password
-	hashedPassword, err := shared.HashPassword(password)
-	if err != nil {
-		return err
+		key = backupKey(passphrase, manifest.Salt)
 	}
 
-	// Create user
-	cat.Users[username].Password = hashedPassword
+	sequenceDirectory := filepath.Join(backupDirectory, fmt.Sprintf("%06d", manifest.Sequence))
 
-	err = cat.EncodeUsersToFile()
+	// Remove what is left of an interrupted backup with the same sequence
+	err = os.RemoveAll(sequenceDirectory)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	return nil
-}
+	pagerFiles := make([]string, 0)
 
-// GetPrivileges gets a user's privileges
-func (u *User) GetPrivileges() []string {
-	var formattedStr []string
+	err = filepath.WalkDir(directory, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
 
-	for _, priv := range u.Privileges {
-		var privActionsStr []string
+		if d.IsDir() || d.Name() == LOCK_FILE || strings.HasSuffix(d.Name(), btree.DIRTY_PAGES_EXTENSION) {
+			return nil
+		}
 
-		for _, action := range priv.PrivilegeActions {
-			privActionsStr = append(privActionsStr, action.String())
+		rel, err := filepath.Rel(directory, path)
+		if err != nil {
+			return err
 		}
 
-		formattedStr = append(formattedStr, fmt.Sprintf("%s.%s: %s", priv.DatabaseName, priv.TableName, strings.Join(privActionsStr, ", ")))
+		// Files with a deleted pages file are managed by a pager
+		_, err = os.Stat(path + ".del")
+		pager := err == nil
+		if pager {
+			pagerFiles = append(pagerFiles, path)
+		}
+
+		file, err := backupFile(path, rel, filepath.Join(sequenceDirectory, BACKUP_DATA_DIRECTORY, rel), incremental && pager, key)
+		if err != nil {
+			return err
+		}
 
+		manifest.Files = append(manifest.Files, file)
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	return formattedStr
-}
+	if key != nil {
+		manifest.MAC = manifestMAC(manifest, key)
+	}
 
-// AddProcedure adds a procedure to the database
-func (db *Database) AddProcedure(proc *Procedure) error {
-	db.ProceduresFileLock.Lock()
-	defer db.ProceduresFileLock.Unlock()
+	err = writeBackupManifest(sequenceDirectory, manifest)
+	if err != nil {
+		return nil, err
+	}
 
-	if _, ok := db.Procedures[proc.Name]; ok {
-		return fmt.Errorf("procedure %s already exists", proc.Name)
+	// The next incremental backup copies the pages written from now on
+	for _, path := range pagerFiles {
+		err = btree.ResetDirtyPages(path)
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	db.Procedures[proc.Name] = proc
+	return manifest, nil
+}
 
-	// Encode procedures to file
-	err := db.EncodeProceduresToFile()
+// backupFile copies a file into a backup, only its dirty pages if incremental and the file has a dirty pages bitmap
+func backupFile(path, rel, dest string, incremental bool, key []byte) (*BackupFile, error) {
+	stat, err := os.Stat(path)
 	if err != nil {
-		return err
+		return nil, err
+	}
 
+	file := &BackupFile{Path: rel, Size: stat.Size()}
+
+	err = os.MkdirAll(filepath.Dir(dest), 0755)
+	if err != nil {
+		return nil, err
 	}
 
-	return nil
-}
+	if incremental {
+		pages, ok, err := btree.DirtyPages(path)
+		if err != nil {
+			return nil, err
+		}
 
-// DropProcedure drops a procedure from the database
-func (db *Database) DropProcedure(procName string) error {
-	db.ProceduresFileLock.Lock()
-	defer db.ProceduresFileLock.Unlock()
+		if ok {
+			file.Incremental = true
+			file.Pages = make([]int64, 0, len(pages))
 
-	if _, ok := db.Procedures[procName]; !ok {
-		return fmt.Errorf("procedure %s does not exist", procName)
-	}
+			src, err := os.Open(path)
+			if err != nil {
+				return nil, err
+			}
 
-	delete(db.Procedures, procName)
+			defer src.Close()
 
-	// Encode procedures to file
-	err := db.EncodeProceduresToFile()
-	if err != nil {
-		return err
+			buff := bytes.NewBuffer([]byte{})
+			page := make([]byte, btree.PAGE_SIZE+btree.HEADER_SIZE)
+
+			for _, pageID := range pages {
+				// Pages past the end of the file were truncated away
+				if (pageID+1)*int64(len(page)) > file.Size {
+					continue
+				}
+
+				_, err = src.ReadAt(page, pageID*int64(len(page)))
+				if err != nil {
+					return nil, err
+				}
+
+				buff.Write(page)
+				file.Pages = append(file.Pages, pageID)
+			}
 
+			return file, writeBackupData(dest, file, buff.Bytes(), key)
+		}
 	}
 
-	return nil
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	file.Size = int64(len(data))
+
+	return file, writeBackupData(dest, file, data, key)
 }
 
-// GetProcedures gets all procedures in a database
-func (db *Database) GetProcedures() []string {
-	db.ProceduresFileLock.Lock()
-	defer db.ProceduresFileLock.Unlock() // Lock procedures file which also locks procedures map
+// backupKey derives the key of an encrypted backup from a passphrase
+func backupKey(passphrase string, salt []byte) []byte {
+	return argon2.IDKey([]byte(passphrase), salt, 1, 64*1024, 4, chacha20poly1305.KeySize)
+}
 
-	var procs []string
-	for k := range db.Procedures {
-		procs = append(procs, k)
+// backupChecksum returns the checksum of the data of a file within a backup, keyed by the key of an encrypted backup
+// so it can not be recomputed without the passphrase
+func backupChecksum(data []byte, key []byte) []byte {
+	if key == nil {
+		checksum := sha256.Sum256(data)
+		return checksum[:]
 	}
 
-	slices.Sort(procs)
+	mac := hmac.New(sha256.New, key)
+	mac.Write(data)
 
-	return procs
+	return mac.Sum(nil)
 }
 
-// GetProcedure gets a procedure by name
-func (db *Database) GetProcedure(procName string) (*Procedure, error) {
-	db.ProceduresFileLock.Lock()
-	defer db.ProceduresFileLock.Unlock()
+// writeBackupData writes the data of a file within a backup, encrypted if there is a key, and sets its checksum
+func writeBackupData(dest string, file *BackupFile, data []byte, key []byte) error {
+	file.Checksum = backupChecksum(data, key)
 
-	if _, ok := db.Procedures[procName]; !ok {
-		return nil, fmt.Errorf("procedure %s does not exist", procName)
+	if key != nil {
+		aead, err := chacha20poly1305.NewX(key)
+		if err != nil {
+			return err
+		}
+
+		nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(data)+aead.Overhead())
+
+		_, err = rand.Read(nonce)
+		if err != nil {
+			return err
+		}
+
+		// The path is authenticated so files can not be swapped within a backup
+		data = aead.Seal(nonce, nonce, data, []byte(file.Path))
 	}
 
-	return db.Procedures[procName], nil
+	return os.WriteFile(dest, data, 0644)
 }
 
-// EncodeProceduresToFile encodes procedures to file
-func (db *Database) EncodeProceduresToFile() error {
+// readBackupData reads the data of a file within a backup, decrypting it with the key of an encrypted backup and validating its checksum
+func readBackupData(sequenceDirectory string, file *BackupFile, key []byte) ([]byte, error) {
+	data, err := os.ReadFile(filepath.Join(sequenceDirectory, BACKUP_DATA_DIRECTORY, file.Path))
+	if err != nil {
+		return nil, err
+	}
 
-	// seek to beginning of file
-	if _, err := db.ProceduresFile.Seek(0, 0); err != nil {
-		return err
+	if key != nil {
+		aead, err := chacha20poly1305.NewX(key)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(data) < aead.NonceSize() {
+			return nil, fmt.Errorf("%s is truncated", file.Path)
+		}
+
+		data, err = aead.Open(nil, data[:aead.NonceSize()], data[aead.NonceSize():], []byte(file.Path))
+		if err != nil {
+			return nil, fmt.Errorf("%s does not decrypt, wrong passphrase or corrupted", file.Path)
+		}
 	}
 
-	// Encode procedures to file
-	enc := gob.NewEncoder(db.ProceduresFile)
+	if !hmac.Equal(backupChecksum(data, key), file.Checksum) {
+		return nil, fmt.Errorf("%s checksum mismatch", file.Path)
+	}
 
-	err := enc.Encode(db.Procedures)
-	if err != nil {
-		return err
+	pageSize := int64(btree.PAGE_SIZE + btree.HEADER_SIZE)
+
+	if file.Incremental && int64(len(data)) != int64(len(file.Pages))*pageSize {
+		return nil, fmt.Errorf("%s holds %d bytes for %d pages", file.Path, len(data), len(file.Pages))
+	} else if !file.Incremental && int64(len(data)) != file.Size {
+		return nil, fmt.Errorf("%s holds %d bytes, expected %d", file.Path, len(data), file.Size)
 	}
 
-	return nil
+	return data, nil
 }
 
-// Compress compresses a row with ZSTD
-func Compress(row []byte) ([]byte, error) {
-	return zstd.Compress(nil, row)
+// manifestKey returns the key of a backup, nil if it is not encrypted
+// A backup restored or verified with a passphrase must be encrypted, a manifest rewritten as not encrypted is refused
+func manifestKey(manifest *BackupManifest, passphrase string) ([]byte, error) {
+	if !manifest.Encrypted {
+		if passphrase != "" {
+			return nil, fmt.Errorf("backup %06d is not encrypted, a passphrase was given", manifest.Sequence)
+		}
+
+		return nil, nil
+	}
 
+	if passphrase == "" {
+		return nil, fmt.Errorf("backup %06d is encrypted, a passphrase is required", manifest.Sequence)
+	}
+
+	return backupKey(passphrase, manifest.Salt), nil
 }
 
-// Decompress decompresses a row with ZSTD
-func Decompress(row []byte) ([]byte, error) {
-	return zstd.Decompress(nil, row)
+// manifestMAC returns the HMAC-SHA256 of a manifest keyed by the key of the backup
+// Every field but the MAC is authenticated, so files can not be added, removed or changed and a backup can not be
+// turned into an incremental one or the other way around without the passphrase
+func manifestMAC(manifest *BackupManifest, key []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+
+	// Variable length fields are prefixed with their length so fields can not run into one another
+	writeBytes := func(b []byte) {
+		binary.Write(mac, binary.BigEndian, int64(len(b)))
+		mac.Write(b)
+	}
+
+	binary.Write(mac, binary.BigEndian, int64(manifest.Sequence))
+	binary.Write(mac, binary.BigEndian, manifest.Incremental)
+	binary.Write(mac, binary.BigEndian, int64(manifest.LayoutVersion))
+	binary.Write(mac, binary.BigEndian, manifest.Created.UnixNano())
+	binary.Write(mac, binary.BigEndian, manifest.Encrypted)
+	writeBytes(manifest.Salt)
+	binary.Write(mac, binary.BigEndian, int64(len(manifest.Files)))
+
+	for _, file := range manifest.Files {
+		writeBytes([]byte(file.Path))
+		binary.Write(mac, binary.BigEndian, file.Size)
+		binary.Write(mac, binary.BigEndian, file.Incremental)
+		binary.Write(mac, binary.BigEndian, int64(len(file.Pages)))
+		binary.Write(mac, binary.BigEndian, file.Pages)
+		writeBytes(file.Checksum)
+	}
+
+	return mac.Sum(nil)
 }
 
-// Encrypt encrypts a row with ChaCha20
-func Encrypt(key [32]byte, nonce [12]byte, row []byte) ([]byte, error) {
-	var ciphertext = make([]byte, len(row))
+// authenticateManifest checks the MAC of the manifest of an encrypted backup with its key
+func authenticateManifest(manifest *BackupManifest, key []byte) error {
+	if key == nil {
+		return nil
+	}
 
-	// Create a new ChaCha20 cipher
-	c, err := chacha20.NewUnauthenticatedCipher(key[:], nonce[:])
-	if err != nil {
-		return nil, err
+	if !hmac.Equal(manifestMAC(manifest, key), manifest.MAC) {
+		return fmt.Errorf("backup %06d manifest does not authenticate, wrong passphrase or tampered", manifest.Sequence)
 	}
 
-	// Encrypt the plaintext
-	c.XORKeyStream(ciphertext, row)
-	return ciphertext, nil
+	return nil
 }
 
-// Decrypt decrypts ciphertext using ChaCha20
-func Decrypt(key [32]byte, nonce [12]byte, cipherRow []byte) ([]byte, error) {
-	var plaintext = make([]byte, len(cipherRow))
+// writeBackupManifest writes the manifest of a backup, a backup without a manifest is incomplete
+func writeBackupManifest(sequenceDirectory string, manifest *BackupManifest) error {
+	buff := bytes.NewBuffer([]byte{})
 
-	// Create a new ChaCha20 cipher
-	c, err := chacha20.NewUnauthenticatedCipher(key[:], nonce[:])
+	err := gob.NewEncoder(buff).Encode(manifest)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	// Decrypt the ciphertext
-	c.XORKeyStream(plaintext, cipherRow)
-	return plaintext, nil
-}
+	tmp := filepath.Join(sequenceDirectory, BACKUP_MANIFEST_FILE+".tmp")
 
-// Alter alters a table, specifically a column
-func (tbl *Table) Alter(columnName string, columnDef *ColumnDefinition) error {
-	if columnDef == nil {
-		// Drop column
-		var existingIndexValues *Index
+	err = os.WriteFile(tmp, buff.Bytes(), 0644)
+	if err != nil {
+		return err
+	}
 
-		// Find indexes that are using that column
-		for _, idx := range tbl.Indexes {
-			// if the index is just using that column drop the index
-			// if the index is using multiple columns, remove the column from the index
+	return os.Rename(tmp, filepath.Join(sequenceDirectory, BACKUP_MANIFEST_FILE))
+}
 
-			if slices.Contains(idx.Columns, columnName) {
-				if len(idx.Columns) == 1 {
-					// Drop index
-					err := tbl.DropIndex(idx.Name)
-					if err != nil {
-						return err
-					}
-				} else {
-					// Remove column from index
-					for i, col := range idx.Columns {
-						if col == columnName {
-							idx.Columns = append(idx.Columns[:i], idx.Columns[i+1:]...)
+// readBackupManifests reads the manifests of the complete backups within a backup directory ordered by sequence
+func readBackupManifests(backupDirectory string) ([]*BackupManifest, error) {
+	manifests := make([]*BackupManifest, 0)
 
-							if !idx.Unique {
-								existingIndexValues = idx
-							}
-						}
+	entries, err := os.ReadDir(backupDirectory)
+	if os.IsNotExist(err) {
+		return manifests, nil
+	} else if err != nil {
+		return nil, err
+	}
 
-					}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
 
-				}
-			}
+		d, err := os.ReadFile(filepath.Join(backupDirectory, entry.Name(), BACKUP_MANIFEST_FILE))
+		if os.IsNotExist(err) {
+			continue // incomplete backup
+		} else if err != nil {
+			return nil, err
 		}
 
-		// Drop column from schema
-		delete(tbl.TableSchema.ColumnDefinitions, columnName)
+		manifest := &BackupManifest{}
 
-		// iterate over all rows and remove the column
-		ri := tbl.NewIterator()
+		err = gob.NewDecoder(bytes.NewReader(d)).Decode(manifest)
+		if err != nil {
+			return nil, fmt.Errorf("backup %s: %s", entry.Name(), err.Error())
+		}
 
-		for ri.Valid() {
-			row, err := ri.Next()
-			if err != nil {
-				continue
-			}
+		manifests = append(manifests, manifest)
+	}
 
-			if _, ok := row[columnName]; ok {
-				if existingIndexValues != nil {
-					// remove from indexes
-					existingIndexValues.btree.Remove([]byte(fmt.Sprintf("%v", row[columnName])), []byte(fmt.Sprintf("%d", ri.Current())))
-				}
-			}
+	sort.Slice(manifests, func(i, j int) bool { return manifests[i].Sequence < manifests[j].Sequence })
 
-			// Remove column from row
-			delete(row, columnName)
+	return manifests, nil
+}
 
-			encoded, err := EncodeRow(row)
-			if err != nil {
-				continue
-			}
+// backupChain returns the backups restoring the latest backup applies, the latest full backup and the incremental backups taken after it
+func backupChain(backupDirectory string, manifests []*BackupManifest) ([]*BackupManifest, error) {
+	if len(manifests) == 0 {
+		return nil, fmt.Errorf("no backup found in %s", backupDirectory)
+	}
 
-			if tbl.Compress {
-				encoded, err = Compress(encoded)
-				if err != nil {
-					continue
-				}
-			}
+	// Find the latest full backup
+	base := len(manifests) - 1
+	for base > 0 && manifests[base].Incremental {
+		base--
+	}
 
-			if tbl.Encrypt {
-				encoded, err = Encrypt(tbl.HashedKey, tbl.Nonce, encoded)
-				if err != nil {
-					continue
-				}
-			}
+	if manifests[base].Incremental {
+		return nil, errors.New("no full backup to restore incremental backups onto")
+	}
 
-			// Write row back to table
-			err = tbl.Rows.WriteTo(ri.Current(), encoded)
-			if err != nil {
-				return err
-			}
+	for i := base + 1; i < len(manifests); i++ {
+		if manifests[i].Sequence != manifests[i-1].Sequence+1 {
+			return nil, fmt.Errorf("backup %06d is missing", manifests[i-1].Sequence+1)
 		}
-	} else {
-		// check if column exists
-		if _, ok := tbl.TableSchema.ColumnDefinitions[columnName]; !ok {
-			// Column does not exist, add column
+	}
 
-			if len(columnName) > MAX_COLUMN_NAME_SIZE {
-				return fmt.Errorf("column name is too long, max length is %d", MAX_COLUMN_NAME_SIZE)
-			}
+	return manifests[base:], nil
+}
 
-			if !shared.IsValidDataType(columnDef.DataType) {
-				return fmt.Errorf("invalid data type %s", columnDef.DataType)
-			}
+// Restore restores the latest backup within a backup directory into an empty data directory
+// The latest full backup is restored first, then the incremental backups taken after it in order
+func Restore(backupDirectory, directory string, passphrase string) (*BackupManifest, error) {
+	manifests, err := readBackupManifests(backupDirectory)
+	if err != nil {
+		return nil, err
+	}
 
-			if columnDef.Unique {
-				err := tbl.CreateIndex(fmt.Sprintf("unique_%s", columnName), []string{columnName}, true)
-				if err != nil {
-					return err
-				}
-			}
+	chain, err := backupChain(backupDirectory, manifests)
+	if err != nil {
+		return nil, err
+	}
 
-			if columnDef.Sequence {
-				// Check if sequence column exists
-				var sequenceDefined bool
-				for _, colDef := range tbl.TableSchema.ColumnDefinitions {
-					if colDef.Sequence {
-						sequenceDefined = true
-					}
-				}
+	err = os.MkdirAll(directory, 0755)
+	if err != nil {
+		return nil, err
+	}
 
-				if sequenceDefined {
-					return errors.New("sequence column already defined")
-				}
+	directoryLock, err := storage.LockDirectory(directory, LOCK_FILE)
+	if err != nil {
+		return nil, err
+	}
 
-				// Sequenced column must be unique and not null
+	defer directoryLock.Unlock()
 
-				if !columnDef.Unique || !columnDef.NotNull {
+	entries, err := os.ReadDir(directory)
+	if err != nil {
+		return nil, err
+	}
 
-					return fmt.Errorf("sequence column %s must be unique and not null", columnName)
-				}
+	for _, entry := range entries {
+		if entry.Name() != LOCK_FILE {
+			return nil, fmt.Errorf("data directory %s is not empty", directory)
+		}
+	}
 
-				// Datatype MUST be an integer
-				if strings.ToUpper(columnDef.DataType) != "INT" && strings.ToUpper(columnDef.DataType) != "INTEGER" {
-					return fmt.Errorf("sequence column %s must be an integer", columnName)
-				}
+	for _, manifest := range chain {
+		key, err := manifestKey(manifest, passphrase)
+		if err != nil {
+			return nil, err
+		}
 
-				sequenceDefined = true
-			}
+		err = authenticateManifest(manifest, key)
+		if err != nil {
+			return nil, err
+		}
 
-			switch strings.ToUpper(columnDef.DataType) {
-			case "CHARACTER", "CHAR":
-				// A character datatype requires a length
-				if columnDef.Length == 0 {
-					return fmt.Errorf("column %s requires a length", columnName)
-				}
-			case "NUMERIC", "DECIMAL", "DEC", "FLOAT", "DOUBLE", "REAL":
-				// A numeric datatype requires a precision and scale
-				if columnDef.Precision == 0 {
-					return fmt.Errorf("column %s requires a precision", columnName)
-				}
+		err = restoreBackup(filepath.Join(backupDirectory, fmt.Sprintf("%06d", manifest.Sequence)), directory, manifest, key)
+		if err != nil {
+			return nil, err
+		}
+	}
 
-				if columnDef.Scale == 0 {
-					return fmt.Errorf("column %s requires a scale", columnName)
-				}
-			case "INT", "INTEGER", "SMALLINT":
-			case "DATE", "TIME", "TIMESTAMP", "DATETIME":
-			case "BINARY":
-			case "UUID":
-			case "BOOLEAN", "BOOL":
-			case "TEXT":
-			case "BLOB":
+	// Remove files that no longer existed when the latest backup was taken
+	latest := chain[len(chain)-1]
+	files := make(map[string]bool)
 
-			default:
-				return fmt.Errorf("invalid data type %s", columnDef.DataType)
-			}
+	for _, file := range latest.Files {
+		files[file.Path] = true
+	}
 
-			// update schema
-			tbl.TableSchema.ColumnDefinitions[columnName] = columnDef
+	err = filepath.WalkDir(directory, func(path string, d os.DirEntry, err error) error {
+		if err != nil || d.IsDir() || d.Name() == LOCK_FILE {
+			return err
+		}
 
-			// write schema to file
-			schemaFile, err := os.Create(fmt.Sprintf("%s%s%s%s", tbl.Directory, shared.GetOsPathSeparator(), tbl.Name, DB_SCHEMA_TABLE_SCHEMA_FILE_EXTENSION))
-			if err != nil {
-				return err
-			}
+		rel, err := filepath.Rel(directory, path)
+		if err != nil {
+			return err
+		}
 
-			defer schemaFile.Close()
+		if !files[rel] {
+			return os.Remove(path)
+		}
 
-			// Encode schema to file
-			enc := gob.NewEncoder(schemaFile)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
 
-			err = enc.Encode(tbl.TableSchema)
+	return latest, nil
+}
+
+// restoreBackup applies one backup to a data directory
+func restoreBackup(sequenceDirectory, directory string, manifest *BackupManifest, key []byte) error {
+	for _, file := range manifest.Files {
+		dest := filepath.Join(directory, file.Path)
+
+		data, err := readBackupData(sequenceDirectory, file, key)
+		if err != nil {
+			return fmt.Errorf("backup %06d: %s", manifest.Sequence, err.Error())
+		}
+
+		err = os.MkdirAll(filepath.Dir(dest), 0755)
+		if err != nil {
+			return err
+		}
+
+		if !file.Incremental {
+			err = os.WriteFile(dest, data, 0644)
 			if err != nil {
 				return err
 			}
 
-			// iterate over all rows and add the column
-			ri := tbl.NewIterator()
+			continue
+		}
 
-			for ri.Valid() {
-				row, err := ri.Next()
-				if err != nil {
-					continue
-				}
+		// Write the changed pages over the file restored so far
+		f, err := os.OpenFile(dest, os.O_CREATE|os.O_RDWR, 0644)
+		if err != nil {
+			return err
+		}
 
-				if columnDef.NotNull {
-					if _, ok := row[columnName]; !ok {
-						return fmt.Errorf("column %s cannot be null", columnName)
-					}
-				}
+		pageSize := int64(btree.PAGE_SIZE + btree.HEADER_SIZE)
 
-				if columnDef.Unique {
-					if _, ok := row[columnName]; !ok {
-						return fmt.Errorf("column %s cannot be null", columnName)
-					}
+		for i, pageID := range file.Pages {
+			_, err = f.WriteAt(data[int64(i)*pageSize:int64(i+1)*pageSize], pageID*pageSize)
+			if err != nil {
+				f.Close()
+				return err
+			}
+		}
 
-					idx := tbl.CheckIndexedColumn(columnName, true)
-					if idx == nil {
-						return fmt.Errorf("problem getting unique rows for column %s", columnName)
-					}
+		err = f.Truncate(file.Size)
+		f.Close()
+		if err != nil {
+			return err
+		}
+	}
 
-					if tbl.Compress {
-						row[columnName], err = Compress([]byte(fmt.Sprintf("%v", row[columnName])))
-						if err != nil {
-							return err
-						}
-					}
+	return nil
+}
 
-					if tbl.Encrypt {
-						row[columnName], err = Encrypt(tbl.HashedKey, tbl.Nonce, row[columnName].([]byte))
-						if err != nil {
-							return err
-						}
-					}
+// VerifyBackup validates the backups within a backup directory without restoring them
+// Every file is read, decrypted and compared to its checksum, and the latest backup must be restorable from the backups before it
+func VerifyBackup(backupDirectory string, passphrase string) ([]*CheckIssue, error) {
+	issues := make([]*CheckIssue, 0)
 
-					// Check if unique key exists
-					key, err := idx.btree.Get([]byte(fmt.Sprintf("%v", row[columnName])))
-					if err != nil {
-						return fmt.Errorf("problem getting unique rows for column %s", columnName)
-					}
+	entries, err := os.ReadDir(backupDirectory)
+	if err != nil {
+		return nil, err
+	}
 
-					if key != nil {
+	for _, entry := range entries {
+		if _, err := os.Stat(filepath.Join(backupDirectory, entry.Name(), BACKUP_MANIFEST_FILE)); entry.IsDir() && os.IsNotExist(err) {
+			issues = append(issues, &CheckIssue{Path: filepath.Join(backupDirectory, entry.Name()), Problem: "incomplete backup, no manifest"})
+		}
+	}
 
-						for _, rowId := range key.V {
-							// We store a []byte(rowId) in the btree
-							// We need to convert it to an int64
+	manifests, err := readBackupManifests(backupDirectory)
+	if err != nil {
+		return nil, err
+	}
 
-							// Convert []byte to int64
-							id, err := strconv.ParseInt(string(rowId), 10, 64)
-							if err != nil {
-								return errors.New("problem getting unique rows")
-							}
+	for _, manifest := range manifests {
+		sequenceDirectory := filepath.Join(backupDirectory, fmt.Sprintf("%06d", manifest.Sequence))
 
-							// Get row from table
-							r, err := tbl.Rows.GetPage(id)
-							if err != nil {
-								return errors.New("problem getting unique rows")
-							}
+		if manifest.LayoutVersion > LAYOUT_VERSION {
+			issues = append(issues, &CheckIssue{Path: sequenceDirectory, Problem: fmt.Sprintf("layout version %d is newer than supported version %d", manifest.LayoutVersion, LAYOUT_VERSION)})
+		}
 
-							if tbl.Encrypt {
-								r, err = Decrypt(tbl.HashedKey, tbl.Nonce, r)
-								if err != nil {
-									return errors.New("problem getting unique rows")
-								}
-							}
+		key, err := manifestKey(manifest, passphrase)
+		if err != nil {
+			return nil, err
+		}
 
-							if tbl.Compress {
-								r, err = Decompress(r)
-								if err != nil {
-									return errors.New("problem getting unique rows")
-								}
-							}
+		// The files of a manifest that does not authenticate are not read
+		err = authenticateManifest(manifest, key)
+		if err != nil {
+			issues = append(issues, &CheckIssue{Path: sequenceDirectory, Problem: err.Error()})
+			continue
+		}
 
-							// Decode row
-							decoded, err := decodeRow(r)
-							if err != nil {
-								return errors.New("problem getting unique rows")
-							}
+		for _, file := range manifest.Files {
+			_, err = readBackupData(sequenceDirectory, file, key)
+			if err != nil {
+				issues = append(issues, &CheckIssue{Path: sequenceDirectory, Problem: err.Error()})
+			}
+		}
+	}
 
-							// Check if row exists
-							if decoded[columnName] == row[columnName] {
-								return fmt.Errorf("row with %s %v already exists", columnName, row[columnName])
-							}
+	chain, err := backupChain(backupDirectory, manifests)
+	if err != nil {
+		return append(issues, &CheckIssue{Path: backupDirectory, Problem: err.Error()}), nil
+	}
 
-						}
-					}
-				}
+	// Pages of an incremental backup are written over a file restored by an earlier backup of the chain, unless they cover the whole file
+	restored := make(map[string]bool)
+	pageSize := int64(btree.PAGE_SIZE + btree.HEADER_SIZE)
 
+	for _, manifest := range chain {
+		for _, file := range manifest.Files {
+			if file.Incremental && !restored[file.Path] && int64(len(file.Pages))*pageSize < file.Size {
+				issues = append(issues, &CheckIssue{Path: filepath.Join(backupDirectory, fmt.Sprintf("%06d", manifest.Sequence)), Problem: fmt.Sprintf("%s has no earlier copy to apply its pages to", file.Path)})
 			}
 
-		} else {
-			return errors.New("you can only drop a column or add a new column")
+			restored[file.Path] = true
 		}
 	}
 
-	return nil
-
+	return issues, nil
 }
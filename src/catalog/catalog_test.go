@@ -18,11 +18,22 @@
 package catalog
 
 import (
+	"ariasql/fault"
 	"ariasql/shared"
+	"ariasql/storage"
+	"ariasql/storage/btree"
+	"bytes"
 	"crypto/sha256"
+	"encoding/gob"
+	"errors"
 	"fmt"
+	"math"
 	"os"
+	"path/filepath"
+	"slices"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestNewCatalog(t *testing.T) {
@@ -791,7 +802,7 @@ func TestTable_Insert(t *testing.T) {
 		{
 			"name": "John Doe",
 		},
-	})
+	}, db)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -861,7 +872,7 @@ func TestTable_GetRow(t *testing.T) {
 		{
 			"name": "John Doe",
 		},
-	})
+	}, db)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -930,7 +941,7 @@ func TestTable_IOCount(t *testing.T) {
 		{
 			"name": "John Doe",
 		},
-	})
+	}, db)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -999,7 +1010,7 @@ func TestTable_NewIterator(t *testing.T) {
 		{
 			"name": "Jane Doe",
 		},
-	})
+	}, db)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -1019,6 +1030,86 @@ func TestTable_NewIterator(t *testing.T) {
 
 }
 
+func TestTable_IteratorOverflow(t *testing.T) {
+	defer os.RemoveAll("test/")
+
+	c := New("test/")
+	err := c.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer c.Close()
+
+	err = c.CreateDatabase("db1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db := c.GetDatabase("db1")
+
+	err = db.CreateTable("table1", &TableSchema{
+		ColumnDefinitions: map[string]*ColumnDefinition{
+			"id": {
+				DataType: "INT",
+				NotNull:  true,
+			},
+			"body": {
+				DataType: "TEXT",
+			},
+		},
+	}, false, false, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	table := db.GetTable("table1")
+
+	// Rows larger than a page continue on overflow pages, the rows around them are read whole
+	large := strings.Repeat("large row ", 500)
+
+	rowIds, _, err := table.Insert([]map[string]interface{}{{"id": 1, "body": "small"}, {"id": 2, "body": large}, {"id": 3, "body": "small"}}, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	read := make(map[int]string)
+
+	iter := table.NewIterator()
+	for iter.Valid() {
+		row, err := iter.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if row != nil {
+			read[row["id"].(int)] = row["body"].(string)
+		}
+	}
+
+	if len(read) != 3 || read[2] != large || read[3] != "small" {
+		t.Fatalf("expected 3 rows read whole, got %d", len(read))
+	}
+
+	// A row which does not decode is reported rather than skipped
+	err = table.Rows.WriteTo(rowIds[2], []byte("not a row"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	iter = table.NewIterator()
+	for iter.Valid() {
+		_, err = iter.Next()
+		if err != nil {
+			break
+		}
+	}
+
+	if err == nil || !strings.Contains(err.Error(), fmt.Sprintf("row %d does not decode", rowIds[2])) {
+		t.Fatalf("expected row %d not to decode, got %v", rowIds[2], err)
+	}
+}
+
 func TestTable_DeleteRow(t *testing.T) {
 	defer os.RemoveAll("test/")
 
@@ -1072,7 +1163,7 @@ func TestTable_DeleteRow(t *testing.T) {
 		{
 			"name": "John Doe",
 		},
-	})
+	}, db)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -1148,7 +1239,7 @@ func TestTable_UpdateRow(t *testing.T) {
 		{
 			"name": "John Doe",
 		},
-	})
+	}, db)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -1176,84 +1267,103 @@ func TestTable_UpdateRow(t *testing.T) {
 	}
 }
 
-func TestCatalog_CreateNewUser(t *testing.T) {
+func TestTable_AsOf(t *testing.T) {
 	defer os.RemoveAll("test/")
 
 	c := New("test/")
+	c.FlashbackRetention = time.Hour
+
 	err := c.Open()
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	err = c.CreateNewUser("user1", "password")
+	defer c.Close()
+
+	err = c.CreateDatabase("db1")
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	usr := c.GetUser("user1")
+	db := c.GetDatabase("db1")
 
-	if usr == nil {
-		t.Fatal("expected non-nil user")
+	err = db.CreateTable("table1", &TableSchema{
+		ColumnDefinitions: map[string]*ColumnDefinition{
+			"id": {
+				DataType: "INT",
+				NotNull:  true,
+				Unique:   true,
+				Sequence: true,
+			},
+			"name": {
+				DataType: "CHAR",
+				Length:   50,
+			},
+		},
+	}, false, false, nil)
+	if err != nil {
+		t.Fatal(err)
 	}
 
-}
-
-func TestCatalog_DropUser(t *testing.T) {
-	defer os.RemoveAll("test/")
+	table := db.GetTable("table1")
 
-	c := New("test/")
-	err := c.Open()
+	_, _, err = table.Insert([]map[string]interface{}{{"name": "John Doe"}, {"name": "Jane Doe"}}, db)
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	err = c.CreateNewUser("user1", "password")
+	inserted := time.Now()
+
+	row, err := table.GetRow(0)
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	err = c.DropUser("user1")
+	err = table.UpdateRow(0, row, []*SetClause{{ColumnName: "name", Value: "Jim Doe"}})
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	usr := c.GetUser("user1")
-
-	if usr != nil {
-		t.Fatal("expected nil user")
+	err = table.DeleteRow(1)
+	if err != nil {
+		t.Fatal(err)
 	}
-}
-
-func TestCatalog_AuthenticateUser(t *testing.T) {
-	defer os.RemoveAll("test/")
 
-	c := New("test/")
-	err := c.Open()
+	_, _, err = table.Insert([]map[string]interface{}{{"name": "Joe Doe"}}, db)
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	err = c.CreateNewUser("user1", "password")
+	rows, err := table.AsOf(inserted)
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	_, err = c.AuthenticateUser("user1", "password")
+	if len(rows) != 2 || rows[0]["name"] != "John Doe" || rows[1]["name"] != "Jane Doe" {
+		t.Fatalf("expected the rows as inserted, got %v", rows)
+	}
+
+	rows, err = table.AsOf(time.Now())
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	_, err = c.AuthenticateUser("user1", "password1")
+	if len(rows) != 2 || rows[0]["name"] != "Jim Doe" || rows[1]["name"] != "Joe Doe" {
+		t.Fatalf("expected the rows as they are, got %v", rows)
+	}
+
+	_, err = table.AsOf(time.Now().Add(-2 * time.Hour))
 	if err == nil {
-		t.Fatal("expected error")
+		t.Fatal("expected error for a timestamp outside the retention window")
 	}
 
-	if err.Error() != "authentication failed" {
-		t.Fatalf("expected authentication failed, got %s", err.Error())
+	_, err = table.AsOf(inserted.Add(-time.Minute))
+	if err == nil {
+		t.Fatal("expected error for a timestamp before the history started")
 	}
 }
 
-func TestCatalog_GrantPrivilegeToUser(t *testing.T) {
+func TestTable_Between(t *testing.T) {
 	defer os.RemoveAll("test/")
 
 	c := New("test/")
@@ -1262,260 +1372,3301 @@ func TestCatalog_GrantPrivilegeToUser(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	err = c.CreateNewUser("user1", "password")
+	defer c.Close()
+
+	err = c.CreateDatabase("db1")
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	err = c.GrantPrivilegeToUser("user1", &Privilege{
-		DatabaseName:     "db1",
-		TableName:        "tbl1",
-		PrivilegeActions: []shared.PrivilegeAction{shared.PRIV_CREATE, shared.PRIV_SELECT},
-	})
+	db := c.GetDatabase("db1")
+
+	err = db.CreateTable("table1", &TableSchema{
+		ColumnDefinitions: map[string]*ColumnDefinition{
+			"name": {
+				DataType: "CHAR",
+				Length:   50,
+			},
+		},
+		SystemVersioned: true,
+	}, false, false, nil)
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	usr := c.GetUser("user1")
+	created := time.Now()
+	table := db.GetTable("table1")
 
-	if usr == nil {
-		t.Fatal("expected non-nil user")
+	_, _, err = table.Insert([]map[string]interface{}{{"name": "John Doe"}, {"name": "Jane Doe"}}, db)
+	if err != nil {
+		t.Fatal(err)
 	}
 
-	if !usr.HasPrivilege("db1", "tbl1", []shared.PrivilegeAction{shared.PRIV_CREATE, shared.PRIV_SELECT}) {
-		t.Fatal("expected user to have SELECT privilege and CREATE privilege on db1.tbl1")
+	row, err := table.GetRow(0)
+	if err != nil {
+		t.Fatal(err)
 	}
-}
-
-func TestCatalog_RevokePrivilegeFromUser(t *testing.T) {
-	defer os.RemoveAll("test/")
 
-	c := New("test/")
-	err := c.Open()
+	err = table.UpdateRow(0, row, []*SetClause{{ColumnName: "name", Value: "Jim Doe"}})
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	err = c.CreateNewUser("user1", "password")
+	updated := time.Now()
+
+	err = table.DeleteRow(1)
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	err = c.GrantPrivilegeToUser("user1", &Privilege{
-		DatabaseName:     "db1",
-		TableName:        "tbl1",
-		PrivilegeActions: []shared.PrivilegeAction{shared.PRIV_CREATE, shared.PRIV_SELECT},
-	})
+	// Versions are kept without flashback retention configured
+	rows, err := table.AsOf(created)
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	err = c.RevokePrivilegeFromUser("user1", &Privilege{
-		DatabaseName:     "db1",
-		TableName:        "tbl1",
-		PrivilegeActions: []shared.PrivilegeAction{shared.PRIV_CREATE, shared.PRIV_SELECT},
-	})
+	if len(rows) != 0 {
+		t.Fatalf("expected no rows when the table was created, got %v", rows)
+	}
+
+	rows, err = table.AsOf(updated)
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	usr := c.GetUser("user1")
+	if len(rows) != 2 || rows[0]["name"] != "Jim Doe" || rows[1]["name"] != "Jane Doe" {
+		t.Fatalf("expected the rows after the update, got %v", rows)
+	}
 
-	if usr == nil {
-		t.Fatal("expected non-nil user")
+	rows, err = table.Between(created, time.Now())
+	if err != nil {
+		t.Fatal(err)
 	}
 
-	if usr.HasPrivilege("db1", "tbl1", []shared.PrivilegeAction{shared.PRIV_CREATE, shared.PRIV_SELECT}) {
-		t.Fatal("expected user to not have SELECT privilege and CREATE privilege on db1.tbl1")
+	if len(rows) != 3 {
+		t.Fatalf("expected 3 versions, got %v", rows)
 	}
-}
 
-func TestUser_HasPrivilege(t *testing.T) {
-	usr := &User{
-		Username: "user1",
-		Password: "password",
-		Privileges: []*Privilege{
-			{
-				DatabaseName:     "db1",
-				TableName:        "*",
-				PrivilegeActions: []shared.PrivilegeAction{shared.PRIV_CREATE, shared.PRIV_SELECT},
-			},
-		},
+	if rows[0]["name"] != "John Doe" || rows[0][SYSTEM_TIME_END] == nil {
+		t.Fatalf("expected the replaced version of the first row, got %v", rows[0])
 	}
 
-	if !usr.HasPrivilege("db1", "tbl1", []shared.PrivilegeAction{shared.PRIV_CREATE, shared.PRIV_SELECT}) {
-		t.Fatal("expected user to have SELECT privilege and CREATE privilege on db1.tbl1")
+	if rows[1]["name"] != "Jim Doe" || rows[1][SYSTEM_TIME_END] != nil {
+		t.Fatalf("expected the current version of the first row, got %v", rows[1])
 	}
 
-}
+	if rows[2]["name"] != "Jane Doe" || rows[2][SYSTEM_TIME_END] == nil {
+		t.Fatalf("expected the deleted version of the second row, got %v", rows[2])
+	}
 
-func TestUser_HasPrivilege2(t *testing.T) {
-	usr := &User{
-		Username: "user1",
-		Password: "password",
-		Privileges: []*Privilege{
-			{
-				DatabaseName:     "*",
-				TableName:        "*",
-				PrivilegeActions: []shared.PrivilegeAction{shared.PRIV_CREATE, shared.PRIV_SELECT},
-			},
-		},
+	rows, err = table.Between(time.Now(), time.Now())
+	if err != nil {
+		t.Fatal(err)
 	}
 
-	if !usr.HasPrivilege("db1", "tbl1", []shared.PrivilegeAction{shared.PRIV_CREATE, shared.PRIV_SELECT}) {
-		t.Fatal("expected user to have SELECT privilege and CREATE privilege on db1.tbl1")
+	if len(rows) != 1 || rows[0]["name"] != "Jim Doe" {
+		t.Fatalf("expected the current version only, got %v", rows)
 	}
 
-}
+	// The table stays system versioned once reopened
+	c.Close()
 
-func TestUser_HasPrivilege3(t *testing.T) {
-	usr := &User{
-		Username: "user1",
-		Password: "password",
-		Privileges: []*Privilege{
-			{
-				DatabaseName:     "db1",
-				TableName:        "t",
-				PrivilegeActions: []shared.PrivilegeAction{shared.PRIV_CREATE, shared.PRIV_SELECT},
-			},
-		},
+	c = New("test/")
+	err = c.Open()
+	if err != nil {
+		t.Fatal(err)
 	}
 
-	if usr.HasPrivilege("db1", "tbl1", []shared.PrivilegeAction{shared.PRIV_CREATE, shared.PRIV_SELECT}) {
-		t.Fatal("expected user to not have SELECT privilege and CREATE privilege on db1.tbl1")
+	defer c.Close()
+
+	rows, err = c.GetDatabase("db1").GetTable("table1").Between(created, time.Now())
+	if err != nil {
+		t.Fatal(err)
 	}
 
+	if len(rows) != 3 {
+		t.Fatalf("expected 3 versions once reopened, got %v", rows)
+	}
 }
 
-func TestCatalog_ReadUsersFromFile(t *testing.T) {
+func TestCatalog_CreateNewUser(t *testing.T) {
 	defer os.RemoveAll("test/")
-	cat := New("test/")
-	err := cat.Open()
 
+	c := New("test/")
+	err := c.Open()
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	cat.Close()
-
-	err = cat.Open()
-
+	err = c.CreateNewUser("user1", "password")
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	// There should be an admin user
-	if cat.GetUser("admin") == nil {
-		t.Fatal("expected admin user")
+	usr := c.GetUser("user1")
+
+	if usr == nil {
+		t.Fatal("expected non-nil user")
+	}
+
+}
+
+func TestCatalog_DropUser(t *testing.T) {
+	defer os.RemoveAll("test/")
+
+	c := New("test/")
+	err := c.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = c.CreateNewUser("user1", "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = c.DropUser("user1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	usr := c.GetUser("user1")
+
+	if usr != nil {
+		t.Fatal("expected nil user")
+	}
+}
+
+func TestCatalog_Open_generatedPassword(t *testing.T) {
+	defer os.RemoveAll("test/")
+
+	c := New("test/")
+	err := c.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !c.PasswordGenerated || len(c.AdminPassword) != 24 {
+		t.Fatalf("expected a generated password, got %q", c.AdminPassword)
+	}
+
+	user, err := c.AuthenticateUser(DEFAULT_ADMIN_USER, c.AdminPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !user.MustChangePassword {
+		t.Fatal("expected the generated password to be changed on first login")
+	}
+
+	if c.DefaultPasswordInUse() {
+		t.Fatal("expected no default password")
+	}
+
+	// The generated password cannot be set again
+	err = c.AlterUserPassword(DEFAULT_ADMIN_USER, c.AdminPassword)
+	if err == nil {
+		t.Fatal("expected the generated password refused")
+	}
+
+	err = c.AlterUserPassword(DEFAULT_ADMIN_USER, "s3cret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c.Close()
+
+	// The change is kept, a password of an earlier version is warned about
+	c = New("test/")
+	err = c.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	if c.Fresh || c.PasswordGenerated || c.GetUser(DEFAULT_ADMIN_USER).MustChangePassword {
+		t.Fatal("expected the changed password kept")
+	}
+
+	err = c.AlterUserPassword(DEFAULT_ADMIN_USER, DEFAULT_ADMIN_PASSWORD)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !c.DefaultPasswordInUse() {
+		t.Fatal("expected the default password in use")
+	}
+}
+
+func TestCatalog_AuthenticateUser(t *testing.T) {
+	defer os.RemoveAll("test/")
+
+	c := New("test/")
+	err := c.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = c.CreateNewUser("user1", "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = c.AuthenticateUser("user1", "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = c.AuthenticateUser("user1", "password1")
+	if err == nil {
+		t.Fatal("expected error")
+	}
+
+	if err.Error() != "authentication failed" {
+		t.Fatalf("expected authentication failed, got %s", err.Error())
+	}
+}
+
+func TestCatalog_GrantPrivilegeToUser(t *testing.T) {
+	defer os.RemoveAll("test/")
+
+	c := New("test/")
+	err := c.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = c.CreateNewUser("user1", "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = c.GrantPrivilegeToUser("user1", &Privilege{
+		DatabaseName:     "db1",
+		TableName:        "tbl1",
+		PrivilegeActions: []shared.PrivilegeAction{shared.PRIV_CREATE, shared.PRIV_SELECT},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	usr := c.GetUser("user1")
+
+	if usr == nil {
+		t.Fatal("expected non-nil user")
+	}
+
+	if !usr.HasPrivilege("db1", "tbl1", []shared.PrivilegeAction{shared.PRIV_CREATE, shared.PRIV_SELECT}) {
+		t.Fatal("expected user to have SELECT privilege and CREATE privilege on db1.tbl1")
+	}
+}
+
+func TestCatalog_RevokePrivilegeFromUser(t *testing.T) {
+	defer os.RemoveAll("test/")
+
+	c := New("test/")
+	err := c.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = c.CreateNewUser("user1", "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = c.GrantPrivilegeToUser("user1", &Privilege{
+		DatabaseName:     "db1",
+		TableName:        "tbl1",
+		PrivilegeActions: []shared.PrivilegeAction{shared.PRIV_CREATE, shared.PRIV_SELECT},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = c.RevokePrivilegeFromUser("user1", &Privilege{
+		DatabaseName:     "db1",
+		TableName:        "tbl1",
+		PrivilegeActions: []shared.PrivilegeAction{shared.PRIV_CREATE, shared.PRIV_SELECT},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	usr := c.GetUser("user1")
+
+	if usr == nil {
+		t.Fatal("expected non-nil user")
+	}
+
+	if usr.HasPrivilege("db1", "tbl1", []shared.PrivilegeAction{shared.PRIV_CREATE, shared.PRIV_SELECT}) {
+		t.Fatal("expected user to not have SELECT privilege and CREATE privilege on db1.tbl1")
+	}
+}
+
+func TestUser_HasPrivilege(t *testing.T) {
+	usr := &User{
+		Username: "user1",
+		Password: "password",
+		Privileges: []*Privilege{
+			{
+				DatabaseName:     "db1",
+				TableName:        "*",
+				PrivilegeActions: []shared.PrivilegeAction{shared.PRIV_CREATE, shared.PRIV_SELECT},
+			},
+		},
+	}
+
+	if !usr.HasPrivilege("db1", "tbl1", []shared.PrivilegeAction{shared.PRIV_CREATE, shared.PRIV_SELECT}) {
+		t.Fatal("expected user to have SELECT privilege and CREATE privilege on db1.tbl1")
+	}
+
+}
+
+func TestUser_HasPrivilege2(t *testing.T) {
+	usr := &User{
+		Username: "user1",
+		Password: "password",
+		Privileges: []*Privilege{
+			{
+				DatabaseName:     "*",
+				TableName:        "*",
+				PrivilegeActions: []shared.PrivilegeAction{shared.PRIV_CREATE, shared.PRIV_SELECT},
+			},
+		},
+	}
+
+	if !usr.HasPrivilege("db1", "tbl1", []shared.PrivilegeAction{shared.PRIV_CREATE, shared.PRIV_SELECT}) {
+		t.Fatal("expected user to have SELECT privilege and CREATE privilege on db1.tbl1")
+	}
+
+}
+
+func TestUser_HasPrivilege3(t *testing.T) {
+	usr := &User{
+		Username: "user1",
+		Password: "password",
+		Privileges: []*Privilege{
+			{
+				DatabaseName:     "db1",
+				TableName:        "t",
+				PrivilegeActions: []shared.PrivilegeAction{shared.PRIV_CREATE, shared.PRIV_SELECT},
+			},
+		},
+	}
+
+	if usr.HasPrivilege("db1", "tbl1", []shared.PrivilegeAction{shared.PRIV_CREATE, shared.PRIV_SELECT}) {
+		t.Fatal("expected user to not have SELECT privilege and CREATE privilege on db1.tbl1")
+	}
+
+}
+
+func TestCatalog_ReadUsersFromFile(t *testing.T) {
+	defer os.RemoveAll("test/")
+	cat := New("test/")
+	err := cat.Open()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cat.Close()
+
+	err = cat.Open()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// There should be an admin user
+	if cat.GetUser("admin") == nil {
+		t.Fatal("expected admin user")
+	}
+
+	if len(cat.GetUser("admin").Privileges) != 1 {
+		t.Fatal("expected admin user to have 1 privilege")
+	}
+
+}
+
+func TestCatalog_Compress(t *testing.T) {
+	defer os.RemoveAll("test/")
+	cat := New("test/")
+	err := cat.Open()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cat.Close()
+
+	err = cat.Open()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	row := map[string]interface{}{
+		"id":   1,
+		"name": "'john_doe'",
+	}
+
+	// encode
+	encoded, err := EncodeRow(row)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	compressed, err := Compress(encoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// decompress
+	decompressed, err := Decompress(compressed)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// decode
+	decoded, err := decodeRow(decompressed)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if decoded["id"] != 1 {
+		t.Fatalf("expected 1, got %d", decoded["id"])
+	}
+
+	if decoded["name"] != "'john_doe'" {
+		t.Fatalf("expected 'john_doe', got %s", decoded["name"])
+	}
+
+}
+
+func TestEncrypt(t *testing.T) {
+
+	// sha256 hash the key
+	hash := sha256.New()
+
+	// Write data to the hash
+	hash.Write([]byte("hello world"))
+
+	// Calculate the hash
+	hashBytes := hash.Sum(nil)
+
+	key := [32]byte(hashBytes)
+	nonce := [12]byte{}
+	nonce = [12]byte(append(nonce[:], hashBytes[len(hashBytes)-12:]...))
+
+	row := map[string]interface{}{
+		"id":   1,
+		"name": "'john_doe'",
+	}
+
+	encoded, err := EncodeRow(row)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	enc, err := Encrypt(key, nonce, encoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dec, err := Decrypt(key, nonce, enc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decoded, err := decodeRow(dec)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if decoded["id"] != 1 {
+		t.Fatalf("expected 1, got %d", decoded["id"])
+	}
+
+	if decoded["name"] != "'john_doe'" {
+		t.Fatalf("expected 'john_doe', got %s", decoded["name"])
+	}
+
+}
+
+func TestTable_IndexLookupEncrypted(t *testing.T) {
+	defer os.RemoveAll("test/")
+
+	c := New("test/")
+	err := c.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer c.Close()
+
+	err = c.CreateDatabase("db1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db := c.GetDatabase("db1")
+	if db == nil {
+		t.Fatal("expected non-nil database")
+	}
+
+	err = db.CreateTable("table1", &TableSchema{
+		ColumnDefinitions: map[string]*ColumnDefinition{
+			"id": {
+				DataType: "INT",
+				NotNull:  true,
+				Unique:   true,
+				Sequence: true,
+			},
+			"name": {
+				DataType: "CHAR",
+				Length:   50,
+				NotNull:  true,
+			},
+		},
+	}, true, false, []byte("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	table := db.GetTable("table1")
+	if table == nil {
+		t.Fatal("expected non-nil table")
+	}
+
+	err = table.CreateIndex("name_idx", []string{"name"}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Index keys of an encrypted table must not contain the value
+	if string(table.IndexKey("john_doe")) == "john_doe" {
+		t.Fatal("expected index key to not be the plain value")
+	}
+
+	_, _, err = table.Insert([]map[string]interface{}{
+		{"name": "john_doe"},
+		{"name": "jane_doe"},
+	}, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rowIds, err := table.IndexLookup(table.GetIndex("name_idx"), "name", "jane_doe")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(rowIds) != 1 {
+		t.Fatalf("expected 1 row, got %d", len(rowIds))
+	}
+
+	row, err := table.GetRow(rowIds[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if row["name"] != "jane_doe" {
+		t.Fatalf("expected jane_doe, got %v", row["name"])
+	}
+}
+
+func TestTable_Recompress(t *testing.T) {
+	defer os.RemoveAll("test/")
+
+	c := New("test/")
+	err := c.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer c.Close()
+
+	err = c.CreateDatabase("db1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db := c.GetDatabase("db1")
+	if db == nil {
+		t.Fatal("expected non-nil database")
+	}
+
+	err = db.CreateTable("table1", &TableSchema{
+		ColumnDefinitions: map[string]*ColumnDefinition{
+			"name": {
+				DataType: "CHAR",
+				Length:   50,
+			},
+			"notes": {
+				DataType: "CHAR",
+				Length:   btree.PAGE_SIZE * 4,
+			},
+		},
+	}, false, false, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	table := db.GetTable("table1")
+
+	_, _, err = table.Insert([]map[string]interface{}{
+		{"name": "john_doe"},
+	}, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = table.Recompress(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Rows inserted after compression was enabled are mixed with the rewritten ones
+	_, _, err = table.Insert([]map[string]interface{}{
+		{"name": "jane_doe"},
+	}, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for rowId := int64(0); rowId < 2; rowId++ {
+		page, err := table.Rows.GetPage(rowId)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !IsCompressed(page) {
+			t.Fatalf("expected row %d to be compressed", rowId)
+		}
+	}
+
+	// A row compressed into a page needs more pages uncompressed
+	long := strings.Repeat("a", btree.PAGE_SIZE*2)
+
+	rowIds, _, err := table.Insert([]map[string]interface{}{
+		{"name": "long", "notes": long},
+	}, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = table.Recompress(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	page, err := table.Rows.GetPage(rowIds[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if IsCompressed(page) {
+		t.Fatal("expected the row growing uncompressed to be rewritten")
+	}
+
+	row, err := table.GetRow(rowIds[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if row["notes"] != long {
+		t.Fatal("expected the rewritten row to read back whole")
+	}
+
+	names := make([]string, 0)
+
+	iter := table.NewIterator()
+	for iter.Valid() {
+		row, err := iter.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if row == nil {
+			continue
+		}
+
+		names = append(names, row["name"].(string))
+	}
+
+	if len(names) != 3 {
+		t.Fatalf("expected 3 rows, got %d", len(names))
+	}
+
+	if !slices.Contains(names, "john_doe") || !slices.Contains(names, "jane_doe") {
+		t.Fatalf("expected john_doe and jane_doe, got %v", names)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	defer os.RemoveAll("test/")
+
+	c := New("test/")
+	err := c.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = c.CreateDatabase("db1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db := c.GetDatabase("db1")
+
+	err = db.CreateTable("table1", &TableSchema{
+		ColumnDefinitions: map[string]*ColumnDefinition{
+			"id": {
+				DataType: "INT",
+				NotNull:  true,
+				Unique:   true,
+				Sequence: true,
+			},
+			"name": {
+				DataType: "CHAR",
+				Length:   50,
+			},
+		},
+	}, false, false, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	table := db.GetTable("table1")
+
+	rowIds, _, err := table.Insert([]map[string]interface{}{
+		{"name": "john_doe"},
+		{"name": "jane_doe"},
+	}, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Row that does not decode, its index entries are kept
+	err = table.Rows.WriteTo(rowIds[1], []byte("damaged"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Index entry pointing to a row that does not exist
+	err = table.GetIndex("unique_id").GetBtree().Put([]byte("42"), []byte("42"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c.Close()
+
+	// Orphaned file
+	err = os.WriteFile(filepath.Join(table.Directory, "orphan.tmp"), []byte("x"), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	issues, err := Check("test/", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(issues) != 3 {
+		for _, issue := range issues {
+			t.Log(issue.Path, issue.Problem)
+		}
+		t.Fatalf("expected 3 issues, got %d", len(issues))
+	}
+
+	issues, err = Check("test/", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, issue := range issues {
+		damaged := strings.Contains(issue.Problem, "does not decode")
+
+		if issue.Repaired == damaged {
+			t.Fatalf("expected %s to be repaired only if the row decodes", issue.Problem)
+		}
+	}
+
+	issues, err = Check("test/", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(issues) != 1 || !strings.Contains(issues[0].Problem, fmt.Sprintf("row %d does not decode", rowIds[1])) {
+		t.Fatalf("expected only the damaged row after repair, got %d issues", len(issues))
+	}
+
+	// The index entry of the damaged row was not removed
+	bt, err := btree.Open(filepath.Join(table.Directory, "idx_unique_id.bt"), os.O_RDWR, 0755, 6)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer bt.Close()
+
+	keys, err := bt.Range([]byte{}, []byte{0xff})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entries := 0
+	for _, k := range keys {
+		entries += len(k.(*btree.Key).V)
+	}
+
+	if entries != 2 {
+		t.Fatalf("expected the index entries of both rows to be kept, got %d", entries)
+	}
+}
+
+func TestRecoverDDLJournal(t *testing.T) {
+	defer os.RemoveAll("test/")
+
+	c := New("test/")
+	err := c.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = c.CreateDatabase("db1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db := c.GetDatabase("db1")
+
+	// Simulate a crash during CREATE TABLE, the table directory exists without a schema
+	tblDir := filepath.Join(db.Directory, "table1")
+
+	err = journalBegin(db.Directory, "table1", DDL_CREATE, tblDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = os.Mkdir(tblDir, 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c.Close()
+
+	c = New("test/")
+	err = c.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer c.Close()
+
+	if _, err := os.Stat(tblDir); !os.IsNotExist(err) {
+		t.Fatal("expected incomplete table to be removed")
+	}
+
+	if _, err := os.Stat(filepath.Join(db.Directory, "table1"+DDL_JOURNAL_FILE_EXTENSION)); !os.IsNotExist(err) {
+		t.Fatal("expected journal entry to be removed")
+	}
+
+	if c.GetDatabase("db1").GetTable("table1") != nil {
+		t.Fatal("expected table to not exist")
+	}
+
+	// Paths are kept relative to the directory of the entry
+	journalFile := filepath.Join(db.Directory, "table2"+DDL_JOURNAL_FILE_EXTENSION)
+
+	err = journalBegin(db.Directory, "table2", DDL_CREATE, filepath.Join(db.Directory, "table2"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.Open(journalFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entry := &DDLJournalEntry{}
+	err = gob.NewDecoder(f).Decode(entry)
+	f.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(entry.Paths) != 1 || entry.Paths[0] != "table2" {
+		t.Fatalf("expected the relative path table2, got %v", entry.Paths)
+	}
+
+	// A create failing in process is rolled back before its entry is removed
+	err = os.Mkdir(filepath.Join(db.Directory, "table2"), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	failed := errors.New("create failed")
+	journalEnd(db.Directory, "table2", &failed)
+
+	if _, err := os.Stat(filepath.Join(db.Directory, "table2")); !os.IsNotExist(err) {
+		t.Fatal("expected failed create to be rolled back")
+	}
+
+	if _, err := os.Stat(journalFile); !os.IsNotExist(err) {
+		t.Fatal("expected journal entry to be removed")
+	}
+
+	// Paths outside the directory of the entry are refused, written or read
+	err = journalBegin(db.Directory, "table3", DDL_DROP, "test/")
+	if err == nil {
+		t.Fatal("expected error journaling a path outside the database directory")
+	}
+
+	f, err = os.Create(filepath.Join(db.Directory, "table3"+DDL_JOURNAL_FILE_EXTENSION))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = gob.NewEncoder(f).Encode(&DDLJournalEntry{Operation: DDL_DROP, Paths: []string{filepath.Join("..", "..")}})
+	f.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = RecoverDDLJournal(filepath.Join("test", "databases"))
+	if err == nil {
+		t.Fatal("expected error recovering an entry outside its directory")
+	}
+
+	if _, err := os.Stat(filepath.Join(db.Directory, "db1"+DB_PROC_EXTENSION)); err != nil {
+		t.Fatal("expected database files to be kept")
+	}
+}
+
+func TestTable_RenameIndex(t *testing.T) {
+	defer os.RemoveAll("test/")
+
+	c := New("test/")
+	err := c.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = c.CreateDatabase("db1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db := c.GetDatabase("db1")
+
+	err = db.CreateTable("table1", &TableSchema{
+		ColumnDefinitions: map[string]*ColumnDefinition{
+			"id": {
+				DataType: "INT",
+				NotNull:  true,
+				Unique:   true,
+			},
+			"name": {
+				DataType: "CHAR",
+				Length:   50,
+			},
+		},
+	}, false, false, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tbl := db.GetTable("table1")
+
+	err = tbl.CreateIndex("idx_name", []string{"name"}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, _, err = tbl.Insert([]map[string]interface{}{{"id": 1, "name": "John Doe"}}, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = tbl.RenameIndex("idx_name", "unique_id")
+	if err == nil {
+		t.Fatal("expected error renaming to an existing index")
+	}
+
+	err = tbl.RenameIndex("idx_name", "idx_full_name")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if tbl.GetIndex("idx_name") != nil || tbl.GetIndex("idx_full_name") == nil {
+		t.Fatal("expected index to be renamed")
+	}
+
+	if _, err := os.Stat(filepath.Join(tbl.Directory, "idx_idx_name.bt")); !os.IsNotExist(err) {
+		t.Fatal("expected btree file to be renamed")
+	}
+
+	// Simulate a crash during a rename, only the index file was renamed
+	paths, newPaths := tbl.indexPaths("idx_full_name"), tbl.indexPaths("idx_last_name")
+
+	err = journalRename(tbl.Directory, "idx_idx_full_name", paths, newPaths)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c.Close()
+
+	err = os.Rename(paths[0], newPaths[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c = New("test/")
+	err = c.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tbl = c.GetDatabase("db1").GetTable("table1")
+
+	// The name within the index file is from before the renames, the file name is used
+	idx := tbl.GetIndex("idx_last_name")
+	if idx == nil {
+		t.Fatal("expected interrupted rename to be finished")
+	}
+
+	rowIds, err := tbl.IndexLookup(idx, "name", "John Doe")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(rowIds) != 1 {
+		t.Fatalf("expected 1 row, got %d", len(rowIds))
+	}
+
+	c.Close()
+
+	issues, err := checkTable(tbl.Directory, "table1", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(issues) != 0 {
+		t.Fatalf("expected no issues, got %v", issues)
+	}
+}
+
+func TestTable_SetIndexVisible(t *testing.T) {
+	defer os.RemoveAll("test/")
+
+	c := New("test/")
+	err := c.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = c.CreateDatabase("db1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db := c.GetDatabase("db1")
+
+	err = db.CreateTable("table1", &TableSchema{
+		ColumnDefinitions: map[string]*ColumnDefinition{
+			"id": {
+				DataType: "INT",
+				NotNull:  true,
+				Unique:   true,
+			},
+		},
+	}, false, false, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tbl := db.GetTable("table1")
+
+	err = tbl.SetIndexVisible("unique_id", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if tbl.VisibleIndexedColumn("id", true) != nil {
+		t.Fatal("expected invisible index to be ignored")
+	}
+
+	// Constraints still use the index
+	if tbl.CheckIndexedColumn("id", true) == nil {
+		t.Fatal("expected index")
+	}
+
+	err = tbl.SetIndexVisible("idx_missing", false)
+	if err == nil {
+		t.Fatal("expected error for an index which does not exist")
+	}
+
+	c.Close()
+
+	c = New("test/")
+	err = c.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer c.Close()
+
+	tbl = c.GetDatabase("db1").GetTable("table1")
+
+	if !tbl.GetIndex("unique_id").Invisible {
+		t.Fatal("expected index to stay invisible once reopened")
+	}
+
+	err = tbl.SetIndexVisible("unique_id", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if tbl.VisibleIndexedColumn("id", true) == nil {
+		t.Fatal("expected visible index")
+	}
+}
+
+func TestTable_BloomFilter(t *testing.T) {
+	defer os.RemoveAll("test/")
+
+	c := New("test/")
+	err := c.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = c.CreateDatabase("db1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db := c.GetDatabase("db1")
+
+	err = db.CreateTable("table1", &TableSchema{
+		ColumnDefinitions: map[string]*ColumnDefinition{
+			"id": {
+				DataType: "INT",
+			},
+			"name": {
+				DataType: "CHAR",
+				Length:   10,
+			},
+			"created": {
+				DataType: "DATE",
+			},
+		},
+	}, false, false, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tbl := db.GetTable("table1")
+
+	rows := make([]map[string]interface{}, 0)
+	for i := 0; i < BLOOM_SEGMENT_ROWS*2+100; i++ {
+		rows = append(rows, map[string]interface{}{"id": i, "name": fmt.Sprintf("n%d", i)})
+	}
+
+	_, _, err = tbl.Insert(rows, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = tbl.CreateBloomFilter("bf_created", "created")
+	if err == nil {
+		t.Fatal("expected error for a bloom filter on a DATE column")
+	}
+
+	err = tbl.CreateBloomFilter("bf_name", "name")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = tbl.CreateBloomFilter("bf_name", "name")
+	if err == nil {
+		t.Fatal("expected error for a bloom filter which already exists")
+	}
+
+	// scan returns the rows an iterator pruned on name returns
+	scan := func(tbl *Table, name string) []map[string]interface{} {
+		iter := tbl.NewIterator()
+		if !iter.Prune("name", name) {
+			t.Fatal("expected bloom filter on name")
+		}
+
+		var found []map[string]interface{}
+		for iter.Valid() {
+			row, err := iter.Next()
+			if err != nil {
+				break
+			}
+
+			if row != nil {
+				found = append(found, row)
+			}
+		}
+
+		return found
+	}
+
+	found := scan(tbl, "n2050")
+	if len(found) > BLOOM_SEGMENT_ROWS {
+		t.Fatalf("expected at most one segment to be read, got %d rows", len(found))
+	}
+
+	if !slices.ContainsFunc(found, func(row map[string]interface{}) bool { return row["name"] == "n2050" }) {
+		t.Fatal("expected row n2050")
+	}
+
+	if len(scan(tbl, "missing")) > BLOOM_SEGMENT_ROWS {
+		t.Fatal("expected segments without the value to be skipped")
+	}
+
+	// Rows inserted after the bloom filter was created are added to it
+	_, _, err = tbl.Insert([]map[string]interface{}{{"id": 5000, "name": "late"}}, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !slices.ContainsFunc(scan(tbl, "late"), func(row map[string]interface{}) bool { return row["id"] == 5000 }) {
+		t.Fatal("expected row inserted after the bloom filter was created")
+	}
+
+	c.Close()
+
+	// Bits files are not orphaned
+	issues, err := Check("test/", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, issue := range issues {
+		t.Fatalf("expected no issues, got %s: %s", issue.Path, issue.Problem)
+	}
+
+	c = New("test/")
+	err = c.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer c.Close()
+
+	tbl = c.GetDatabase("db1").GetTable("table1")
+
+	if tbl.BloomFilterColumn("name") == nil {
+		t.Fatal("expected bloom filter once reopened")
+	}
+
+	if !slices.ContainsFunc(scan(tbl, "late"), func(row map[string]interface{}) bool { return row["id"] == 5000 }) {
+		t.Fatal("expected row late once reopened")
+	}
+
+	if io := tbl.BloomScanIO(tbl.BloomFilterColumn("name"), "n10"); io < 1 || io > BLOOM_SEGMENT_ROWS {
+		t.Fatalf("expected the rows of one segment to be read, got %d", io)
+	}
+
+	err = tbl.DropBloomFilter("bf_name")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range tbl.bloomPaths("bf_name") {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Fatalf("expected %s to be removed", path)
+		}
+	}
+
+	if tbl.NewIterator().Prune("name", "n10") {
+		t.Fatal("expected no bloom filter once dropped")
+	}
+}
+
+func TestTable_IndexNull(t *testing.T) {
+	defer os.RemoveAll("test/")
+
+	c := New("test/")
+	err := c.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer c.Close()
+
+	err = c.CreateDatabase("db1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db := c.GetDatabase("db1")
+
+	err = db.CreateTable("table1", &TableSchema{
+		ColumnDefinitions: map[string]*ColumnDefinition{
+			"id": {
+				DataType: "INT",
+				NotNull:  true,
+				Unique:   true,
+			},
+			"email": {
+				DataType: "CHAR",
+				Length:   50,
+				Unique:   true,
+			},
+			"name": {
+				DataType: "CHAR",
+				Length:   50,
+			},
+		},
+	}, false, false, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tbl := db.GetTable("table1")
+
+	// NULL is not equal to NULL, a unique index holds any amount of NULLs
+	rowIds, _, err := tbl.Insert([]map[string]interface{}{{"id": 1, "email": "a@example.com"}, {"id": 2, "email": nil}, {"id": 3}}, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, _, err = tbl.Insert([]map[string]interface{}{{"id": 4, "email": "a@example.com"}}, db)
+	if err == nil {
+		t.Fatal("expected unique constraint violation")
+	}
+
+	if string(tbl.IndexKey(nil)) != INDEX_NULL_KEY {
+		t.Fatalf("expected NULL marker, got %q", tbl.IndexKey(nil))
+	}
+
+	// The text <nil> is a value, not NULL
+	if string(tbl.IndexKey("<nil>")) == INDEX_NULL_KEY {
+		t.Fatal("expected the text <nil> to be stored apart from NULL")
+	}
+
+	found, err := tbl.IndexLookup(tbl.CheckIndexedColumn("email", true), "email", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !slices.Equal(found, rowIds[1:]) {
+		t.Fatalf("expected rows %v, got %v", rowIds[1:], found)
+	}
+
+	// Rows inserted before an index is created are indexed, NULLs included
+	err = tbl.CreateIndex("idx_name", []string{"name"}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	found, err = tbl.IndexLookup(tbl.GetIndex("idx_name"), "name", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(found) != 3 {
+		t.Fatalf("expected 3 rows, got %v", found)
+	}
+
+	// A unique index can not be created on a column holding a value more than once
+	_, _, err = tbl.Insert([]map[string]interface{}{{"id": 5, "name": "john"}, {"id": 6, "name": "john"}}, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = tbl.CreateIndex("unique_name", []string{"name"}, true)
+	if err == nil {
+		t.Fatal("expected error for duplicate values")
+	}
+
+	if _, err := os.Stat(tbl.indexPaths("unique_name")[1]); !os.IsNotExist(err) {
+		t.Fatal("expected index files to be removed")
+	}
+}
+
+func TestTable_InsertIndexBatch(t *testing.T) {
+	defer os.RemoveAll("test/")
+
+	c := New("test/")
+	err := c.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer c.Close()
+
+	err = c.CreateDatabase("db1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db := c.GetDatabase("db1")
+
+	columns := map[string]*ColumnDefinition{
+		"id": {
+			DataType: "INT",
+			NotNull:  true,
+			Unique:   true,
+		},
+	}
+
+	for i := 0; i < 8; i++ {
+		columns[fmt.Sprintf("c%d", i)] = &ColumnDefinition{DataType: "INT"}
+	}
+
+	err = db.CreateTable("wide", &TableSchema{ColumnDefinitions: columns}, false, false, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tbl := db.GetTable("wide")
+
+	for i := 0; i < 8; i++ {
+		err = tbl.CreateIndex(fmt.Sprintf("idx_c%d", i), []string{fmt.Sprintf("c%d", i)}, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// More rows than a batch, every index is put into at once
+	rows := make([]map[string]interface{}, 0)
+	for id := 0; id < INDEX_BATCH_ROWS*2+10; id++ {
+		row := map[string]interface{}{"id": id}
+		for i := 0; i < 8; i++ {
+			row[fmt.Sprintf("c%d", i)] = id % (i + 2)
+		}
+
+		rows = append(rows, row)
+	}
+
+	rowIds, _, err := tbl.Insert(rows, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 8; i++ {
+		found, err := tbl.IndexLookup(tbl.GetIndex(fmt.Sprintf("idx_c%d", i)), fmt.Sprintf("c%d", i), 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		expect := 0
+		for id := range rows {
+			if id%(i+2) == 0 {
+				expect++
+			}
+		}
+
+		if len(found) != expect {
+			t.Fatalf("expected %d rows within idx_c%d, got %d", expect, i, len(found))
+		}
+	}
+
+	found, err := tbl.IndexLookup(tbl.CheckIndexedColumn("id", true), "id", INDEX_BATCH_ROWS+5)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !slices.Equal(found, rowIds[INDEX_BATCH_ROWS+5:INDEX_BATCH_ROWS+6]) {
+		t.Fatalf("expected row %d, got %v", rowIds[INDEX_BATCH_ROWS+5], found)
+	}
+
+	// A key repeated within a batch is caught before the batch is indexed, the rows before it are indexed
+	rows = make([]map[string]interface{}, 0)
+	for _, id := range []int{1000, 1001, 1000} {
+		row := map[string]interface{}{"id": id}
+		for i := 0; i < 8; i++ {
+			row[fmt.Sprintf("c%d", i)] = 1
+		}
+
+		rows = append(rows, row)
+	}
+
+	inserted, _, err := tbl.Insert(rows, db)
+	if err == nil || !strings.Contains(err.Error(), "already exists") {
+		t.Fatalf("expected unique constraint violation, got %v", err)
+	}
+
+	if len(inserted) != 2 {
+		t.Fatalf("expected 2 rows inserted, got %d", len(inserted))
+	}
+
+	found, err = tbl.IndexLookup(tbl.CheckIndexedColumn("id", true), "id", 1001)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !slices.Equal(found, inserted[1:]) {
+		t.Fatalf("expected row %v, got %v", inserted[1:], found)
+	}
+}
+
+func TestCatalog_MigrateIndexNullKeys(t *testing.T) {
+	defer os.RemoveAll("test/")
+
+	c := New("test/")
+	err := c.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = c.CreateDatabase("db1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db := c.GetDatabase("db1")
+
+	err = db.CreateTable("table1", &TableSchema{
+		ColumnDefinitions: map[string]*ColumnDefinition{
+			"id": {
+				DataType: "INT",
+				NotNull:  true,
+				Unique:   true,
+			},
+			"name": {
+				DataType: "CHAR",
+				Length:   50,
+				Unique:   true,
+			},
+		},
+	}, false, false, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tbl := db.GetTable("table1")
+
+	_, _, err = tbl.Insert([]map[string]interface{}{{"id": 1, "name": nil}, {"id": 2, "name": "<nil>"}}, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Store the NULL under its key from layout version 1
+	bt := tbl.GetIndex("unique_name").GetBtree()
+
+	err = bt.Remove([]byte(INDEX_NULL_KEY), []byte("0"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = bt.Put([]byte("<nil>"), []byte("0"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c.Close()
+
+	err = writeLayoutVersion("test", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	from, err := Upgrade("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if from != 1 {
+		t.Fatalf("expected layout version 1, got %d", from)
+	}
+
+	c = New("test/")
+	err = c.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer c.Close()
+
+	tbl = c.GetDatabase("db1").GetTable("table1")
+
+	for value, expected := range map[interface{}][]int64{nil: {0}, "<nil>": {1}} {
+		found, err := tbl.IndexLookup(tbl.GetIndex("unique_name"), "name", value)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !slices.Equal(found, expected) {
+			t.Fatalf("expected rows %v for %v, got %v", expected, value, found)
+		}
+	}
+}
+
+func TestEncodeKey(t *testing.T) {
+	// Keys compare in the order of their values, NULL first
+	ordered := []interface{}{nil, false, true, -10.5, -9, 0, 9, 10, 10.5, 1 << 60, "10", "9", "a"}
+
+	for i := 1; i < len(ordered); i++ {
+		if bytes.Compare(EncodeKey(ordered[i-1]), EncodeKey(ordered[i])) >= 0 {
+			t.Fatalf("expected %v to sort before %v", ordered[i-1], ordered[i])
+		}
+	}
+
+	// Numbers of any type holding the same value within +-2^53 share a key
+	for _, value := range []interface{}{int64(10), 10.0, float32(10), uint8(10), uint(10), uint64(10)} {
+		if !bytes.Equal(EncodeKey(value), EncodeKey(10)) {
+			t.Fatalf("expected %T 10 to share the key of 10", value)
+		}
+	}
+
+	if bytes.Equal(EncodeKey(10), EncodeKey("10")) || bytes.Equal(EncodeKey(0.0), EncodeKey(false)) {
+		t.Fatal("expected values of other types to have other keys")
+	}
+
+	if bytes.Equal(EncodeKey(int64(1<<60)), EncodeKey(int64(1<<60+1))) {
+		t.Fatal("expected integers float64 cannot hold exactly to have their own keys")
+	}
+
+	// Unsigned integers share the key of the signed integer, those above the largest int64 sort after it
+	if !bytes.Equal(EncodeKey(uint64(1<<60+1)), EncodeKey(int64(1<<60+1))) {
+		t.Fatal("expected an unsigned integer to share the key of the signed integer")
+	}
+
+	unsigned := []interface{}{int64(math.MaxInt64 - 1), int64(math.MaxInt64), uint64(math.MaxInt64 + 1), uint64(math.MaxInt64 + 2), uint64(math.MaxUint64)}
+
+	for i := 1; i < len(unsigned); i++ {
+		if bytes.Compare(EncodeKey(unsigned[i-1]), EncodeKey(unsigned[i])) >= 0 {
+			t.Fatalf("expected %v to sort before %v", unsigned[i-1], unsigned[i])
+		}
+	}
+}
+
+func TestCatalog_MigrateIndexTypedKeys(t *testing.T) {
+	defer os.RemoveAll("test/")
+
+	c := New("test/")
+	err := c.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = c.CreateDatabase("db1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db := c.GetDatabase("db1")
+
+	err = db.CreateTable("table1", &TableSchema{
+		ColumnDefinitions: map[string]*ColumnDefinition{
+			"id": {
+				DataType: "INT",
+				Unique:   true,
+			},
+			"name": {
+				DataType: "CHAR",
+				Length:   10,
+			},
+		},
+	}, false, false, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tbl := db.GetTable("table1")
+
+	rows := []map[string]interface{}{{"id": 9, "name": "nine"}, {"id": 10, "name": "10"}, {"id": 11, "name": "eleven"}}
+
+	_, _, err = tbl.Insert(rows, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = tbl.CreateIndex("name_idx", []string{"name"}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = tbl.CreateBloomFilter("id_bloom", "id")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Store the keys formatted as in layout version 2
+	legacy := &Bloom{}
+
+	for i, row := range rows {
+		for name, column := range map[string]string{"unique_id": "id", "name_idx": "name"} {
+			bt := tbl.GetIndex(name).GetBtree()
+
+			err = bt.Remove(EncodeKey(row[column]), []byte(fmt.Sprintf("%d", i)))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = bt.Put([]byte(fmt.Sprintf("%v", row[column])), []byte(fmt.Sprintf("%d", i)))
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		legacy.set(int64(i), []byte(fmt.Sprintf("%v", row["id"])))
+	}
+
+	c.Close()
+
+	err = os.WriteFile(tbl.bloomPaths("id_bloom")[1], legacy.bits, 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = writeLayoutVersion("test", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = Upgrade("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Running the migration again leaves the migrated keys
+	err = migrateIndexTypedKeys("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c = New("test/")
+	err = c.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer c.Close()
+
+	tbl = c.GetDatabase("db1").GetTable("table1")
+
+	for _, lookup := range []struct {
+		index, column string
+		value         interface{}
+		expected      []int64
+	}{
+		{"unique_id", "id", 10, []int64{1}},
+		{"unique_id", "id", 10.0, []int64{1}},
+		{"unique_id", "id", 9, []int64{0}},
+		{"unique_id", "id", 11, []int64{2}},
+		{"name_idx", "name", "10", []int64{1}},
+		{"name_idx", "name", 10, []int64{}},
+	} {
+		found, err := tbl.IndexLookup(tbl.GetIndex(lookup.index), lookup.column, lookup.value)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !slices.Equal(found, lookup.expected) {
+			t.Fatalf("expected rows %v for %v on %s, got %v", lookup.expected, lookup.value, lookup.index, found)
+		}
+	}
+
+	// The bloom filter holds the typed keys of the rows
+	if io := tbl.BloomScanIO(tbl.BloomFilterColumn("id"), 10); io < 1 {
+		t.Fatal("expected the segment of 10 to be read")
+	}
+}
+
+func TestCatalog_MigrateDeletedPages(t *testing.T) {
+	defer os.RemoveAll("test/")
+
+	c := New("test/")
+	err := c.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = c.CreateDatabase("db1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db := c.GetDatabase("db1")
+
+	err = db.CreateTable("table1", &TableSchema{
+		ColumnDefinitions: map[string]*ColumnDefinition{
+			"id": {
+				DataType: "INT",
+				NotNull:  true,
+				Unique:   true,
+			},
+		},
+	}, false, false, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tbl := db.GetTable("table1")
+
+	_, _, err = tbl.Insert([]map[string]interface{}{{"id": 1}, {"id": 2}, {"id": 3}}, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c.Close()
+
+	// List the deleted pages as text as in layout version 3
+	path := filepath.Join(tbl.Directory, "table1"+DB_SCHEMA_TABLE_DATA_FILE_EXTENSION+btree.DELETED_PAGES_EXTENSION)
+
+	err = os.WriteFile(path, []byte("1"), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = writeLayoutVersion("test", 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = Upgrade("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(data, []byte(btree.DELETED_PAGES_MAGIC+"\x02")) {
+		t.Fatalf("unexpected deleted pages file %q", data)
+	}
+
+	c = New("test/")
+	err = c.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer c.Close()
+
+	tbl = c.GetDatabase("db1").GetTable("table1")
+
+	if !tbl.Rows.IsDeleted(1) || tbl.Rows.IsDeleted(0) || tbl.Rows.IsDeleted(2) {
+		t.Fatal("expected row 1 deleted")
+	}
+}
+
+func TestCatalog_MigrateCompressedIndexes(t *testing.T) {
+	defer os.RemoveAll("test/")
+
+	c := New("test/")
+	err := c.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = c.CreateDatabase("db1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db := c.GetDatabase("db1")
+
+	err = db.CreateTable("table1", &TableSchema{
+		ColumnDefinitions: map[string]*ColumnDefinition{
+			"id": {
+				DataType: "INT",
+				NotNull:  true,
+				Unique:   true,
+			},
+			"name": {
+				DataType: "CHAR",
+				Length:   50,
+			},
+		},
+	}, false, true, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tbl := db.GetTable("table1")
+
+	err = tbl.CreateIndex("idx_name", []string{"name"}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rows := []map[string]interface{}{{"id": 1, "name": "one"}, {"id": 2, "name": "two"}, {"id": 3, "name": "three"}}
+
+	_, _, err = tbl.Insert(rows, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	columns := make(map[string]string) // Column of every index
+	for name, idx := range tbl.Indexes {
+		columns[name] = idx.Columns[0]
+	}
+
+	c.Close()
+
+	// Store the keys as the formatted compressed values, as in layout version 4
+	for name, column := range columns {
+		paths := tbl.indexPaths(name)
+
+		for _, path := range paths[1:] {
+			os.Remove(path)
+		}
+
+		bt, err := btree.Open(paths[1], os.O_CREATE|os.O_RDWR, 0755, 6)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for rowId, row := range rows {
+			compressed, err := Compress([]byte(fmt.Sprintf("%v", row[column])))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = bt.Put([]byte(fmt.Sprintf("%v", compressed)), []byte(fmt.Sprintf("%d", rowId)))
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		bt.Close()
+	}
+
+	err = writeLayoutVersion("test", 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = Upgrade("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c = New("test/")
+	err = c.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer c.Close()
+
+	tbl = c.GetDatabase("db1").GetTable("table1")
+
+	for column, value := range map[string]interface{}{"id": 3, "name": "two"} {
+		var idx *Index
+		for _, i := range tbl.Indexes {
+			if slices.Equal(i.Columns, []string{column}) {
+				idx = i
+			}
+		}
+
+		if idx == nil {
+			t.Fatalf("expected an index on %s", column)
+		}
+
+		rowIds, err := tbl.IndexLookup(idx, column, value)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(rowIds) != 1 {
+			t.Fatalf("expected one row with %s %v, got %v", column, value, rowIds)
+		}
+	}
+
+	_, _, err = tbl.Insert([]map[string]interface{}{{"id": 2, "name": "again"}}, c.GetDatabase("db1"))
+	if err == nil {
+		t.Fatal("expected error inserting a duplicate id")
+	}
+}
+
+func TestCatalog_UpgradeUnversioned(t *testing.T) {
+	defer os.RemoveAll("test/")
+
+	c := New("test/")
+	err := c.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = c.CreateDatabase("db1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db := c.GetDatabase("db1")
+
+	err = db.CreateTable("table1", &TableSchema{
+		ColumnDefinitions: map[string]*ColumnDefinition{
+			"id": {
+				DataType: "INT",
+				NotNull:  true,
+				Unique:   true,
+			},
+			"name": {
+				DataType: "CHAR",
+				Length:   50,
+				Unique:   true,
+			},
+		},
+	}, false, false, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tbl := db.GetTable("table1")
+
+	rows := []map[string]interface{}{{"id": 1, "name": nil}, {"id": 2, "name": "two"}, {"id": 3, "name": "three"}}
+
+	_, _, err = tbl.Insert(rows, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Store the keys formatted as before the layout version file existed
+	for i, row := range rows {
+		for name, column := range map[string]string{"unique_id": "id", "unique_name": "name"} {
+			bt := tbl.GetIndex(name).GetBtree()
+
+			err = bt.Remove(EncodeKey(row[column]), []byte(fmt.Sprintf("%d", i)))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = bt.Put([]byte(fmt.Sprintf("%v", row[column])), []byte(fmt.Sprintf("%d", i)))
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	c.Close()
+
+	err = os.WriteFile(filepath.Join(tbl.Directory, "table1"+DB_SCHEMA_TABLE_DATA_FILE_EXTENSION+btree.DELETED_PAGES_EXTENSION), []byte("2"), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = os.Remove(filepath.Join("test", LAYOUT_VERSION_FILE))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The directory is taken as version 1 and refused until upgraded
+	c = New("test/")
+	err = c.Open()
+	if err == nil {
+		c.Close()
+		t.Fatal("expected error opening an unversioned data directory")
+	}
+
+	from, err := Upgrade("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if from != 1 {
+		t.Fatalf("expected layout version 1, got %d", from)
+	}
+
+	c = New("test/")
+	err = c.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer c.Close()
+
+	tbl = c.GetDatabase("db1").GetTable("table1")
+
+	for _, lookup := range []struct {
+		index, column string
+		value         interface{}
+		expected      []int64
+	}{
+		{"unique_id", "id", 2, []int64{1}},
+		{"unique_name", "name", nil, []int64{0}},
+		{"unique_name", "name", "two", []int64{1}},
+	} {
+		found, err := tbl.IndexLookup(tbl.GetIndex(lookup.index), lookup.column, lookup.value)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !slices.Equal(found, lookup.expected) {
+			t.Fatalf("expected rows %v for %v on %s, got %v", lookup.expected, lookup.value, lookup.index, found)
+		}
+	}
+
+	if !tbl.Rows.IsDeleted(2) || tbl.Rows.IsDeleted(1) {
+		t.Fatal("expected row 2 deleted")
+	}
+
+	// An empty directory is stamped with the current version
+	err = os.MkdirAll("test/empty", 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	version, err := readLayoutVersion("test/empty")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if version != LAYOUT_VERSION {
+		t.Fatalf("expected layout version %d, got %d", LAYOUT_VERSION, version)
+	}
+}
+
+func TestCatalog_MaxOpenTables(t *testing.T) {
+	defer os.RemoveAll("test/")
+
+	c := New("test/")
+	err := c.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = c.CreateDatabase("db1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db := c.GetDatabase("db1")
+
+	for _, name := range []string{"table1", "table2", "table3"} {
+		err = db.CreateTable(name, &TableSchema{
+			ColumnDefinitions: map[string]*ColumnDefinition{
+				"id": {
+					DataType: "INT",
+					NotNull:  true,
+					Unique:   true,
+					Sequence: true,
+				},
+			},
+		}, false, false, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	c.Close()
+
+	c = New("test/")
+	c.MaxOpenTables = 2
+	err = c.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer c.Close()
+
+	db = c.GetDatabase("db1")
+
+	// Tables are not opened until accessed
+	for _, tbl := range db.Tables {
+		if tbl.loaded {
+			t.Fatalf("expected %s to not be open", tbl.Name)
+		}
+	}
+
+	table1 := db.GetTable("table1")
+	db.GetTable("table2")
+	db.GetTable("table3")
+
+	// The files of the least recently used table are closed, the table itself stays usable
+	if !table1.loaded || table1.Rows == nil || table1.Indexes == nil {
+		t.Fatal("expected table1 to stay open")
+	}
+
+	if c.openTables.Len() != 2 {
+		t.Fatalf("expected 2 open tables, got %d", c.openTables.Len())
+	}
+
+	// Reopened on access, the files of table2 are closed in turn
+	opened := storage.OpenFiles()
+
+	table1 = db.GetTable("table1")
+
+	if storage.OpenFiles() >= opened {
+		t.Fatalf("expected the files of table2 to be closed, %d open before and %d after", opened, storage.OpenFiles())
+	}
+
+	_, _, err = table1.Insert([]map[string]interface{}{{}, {}}, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	row, err := table1.GetRow(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if row["id"] != 1 {
+		t.Fatalf("expected 1, got %v", row["id"])
+	}
+
+	// A table is used while another table pushes it out, as another session would
+	it := table1.NewIterator()
+
+	if _, err = it.Next(); err != nil {
+		t.Fatal(err)
+	}
+
+	db.GetTable("table2")
+	db.GetTable("table3")
+
+	row, err = it.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if row["id"] != 2 {
+		t.Fatalf("expected 2, got %v", row["id"])
+	}
+
+	_, _, err = table1.Insert([]map[string]interface{}{{}}, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCatalog_CrashPoint(t *testing.T) {
+	defer os.RemoveAll("test/")
+	defer fault.Reset()
+
+	c := New("test/")
+	err := c.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = c.CreateDatabase("db1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db := c.GetDatabase("db1")
+
+	err = db.CreateTable("table1", &TableSchema{
+		ColumnDefinitions: map[string]*ColumnDefinition{
+			"id": {
+				DataType: "INT",
+				NotNull:  true,
+				Unique:   true,
+				Sequence: true,
+			},
+			"name": {
+				DataType: "CHAR",
+				Length:   50,
+			},
+		},
+	}, false, false, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	table := db.GetTable("table1")
+
+	_, _, err = table.Insert([]map[string]interface{}{{"name": "john_doe"}}, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Crash once the second row is written but before it is indexed
+	fault.CrashAt("catalog.insert.row", 1)
+
+	_, _, err = table.Insert([]map[string]interface{}{{"name": "jane_doe"}}, db)
+	if !errors.Is(err, fault.ErrCrashed) {
+		t.Fatalf("expected crash, got %v", err)
+	}
+
+	// Nothing reaches the files after the crash
+	_, _, err = table.Insert([]map[string]interface{}{{"name": "jim_doe"}}, db)
+	if err == nil {
+		t.Fatal("expected error after crash")
+	}
+
+	c.Close()
+
+	fault.Reset()
+
+	c = New("test/")
+	err = c.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	table = c.GetDatabase("db1").GetTable("table1")
+
+	names := make([]string, 0)
+	iter := table.NewIterator()
+	for iter.Valid() {
+		row, err := iter.Next()
+		if err != nil {
+			break
+		}
+
+		if row != nil {
+			names = append(names, row["name"].(string))
+		}
+	}
+
+	if !slices.Equal(names, []string{"john_doe", "jane_doe"}) {
+		t.Fatalf("expected the unindexed row to survive the crash, got %v", names)
+	}
+
+	defer c.Close()
+
+	// Only the row inserted before the crash is indexed
+	key, err := table.GetIndex("unique_id").GetBtree().Get(table.IndexKey(1))
+	if err != nil || key == nil {
+		t.Fatalf("expected index entry, got %v", err)
+	}
+
+	key, err = table.GetIndex("unique_id").GetBtree().Get(table.IndexKey(2))
+	if err == nil && key != nil {
+		t.Fatalf("expected no index entry, got %v", key.V)
+	}
+}
+
+func TestCatalog_IOStats(t *testing.T) {
+	defer os.RemoveAll("test/")
+
+	c := New("test/")
+	err := c.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer c.Close()
+
+	err = c.CreateDatabase("db1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db := c.GetDatabase("db1")
+
+	err = db.CreateTable("table1", &TableSchema{
+		ColumnDefinitions: map[string]*ColumnDefinition{
+			"id": {
+				DataType: "INT",
+				NotNull:  true,
+				Unique:   true,
+				Sequence: true,
+			},
+		},
+	}, false, false, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, _, err = db.GetTable("table1").Insert([]map[string]interface{}{{}, {}}, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stats, err := c.IOStats()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(stats) != 2 {
+		t.Fatalf("expected stats of the table and its index, got %d", len(stats))
+	}
+
+	if stats[0].Database != "db1" || stats[0].Table != "table1" || stats[0].Index != "" || stats[0].Writes < 2 {
+		t.Fatalf("unexpected table stats %+v", stats[0])
+	}
+
+	if stats[1].Index != "unique_id" || stats[1].Writes == 0 || stats[1].WriteTime <= 0 {
+		t.Fatalf("unexpected index stats %+v", stats[1])
+	}
+}
+
+func TestDatabase_RecordMigration(t *testing.T) {
+	defer os.RemoveAll("test/")
+
+	c := New("test/")
+	err := c.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = c.CreateDatabase("db1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db := c.GetDatabase("db1")
+
+	for _, name := range []string{"create_orders", "index_orders"} {
+		err = db.RecordMigration(&SchemaMigration{Name: name, File: name + ".sql", Checksum: "abc", Statements: 1, AppliedBy: "admin", AppliedAt: time.Now()})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	c.Close()
+
+	// Migrations are read back once the catalog is opened again
+	c = New("test/")
+	err = c.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	migrations, err := c.GetDatabase("db1").GetMigrations()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c.Close()
+
+	if len(migrations) != 2 || migrations[0].Version != 1 || migrations[1].Version != 2 || migrations[1].Name != "index_orders" {
+		t.Fatalf("expected 2 migrations in order, got %+v", migrations)
+	}
+
+	issues, err := Check("test/", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(issues) != 0 {
+		t.Fatalf("expected no issues, got %+v", issues[0])
+	}
+}
+
+func TestCatalog_LayoutVersion(t *testing.T) {
+	defer os.RemoveAll("test/")
+
+	c := New("test/")
+	err := c.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c.Close()
+
+	d, err := os.ReadFile(filepath.Join("test", LAYOUT_VERSION_FILE))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(d) != fmt.Sprintf("%d", LAYOUT_VERSION) {
+		t.Fatalf("expected %d, got %s", LAYOUT_VERSION, d)
+	}
+
+	// A directory from a newer layout must not be opened
+	err = os.WriteFile(filepath.Join("test", LAYOUT_VERSION_FILE), []byte(fmt.Sprintf("%d", LAYOUT_VERSION+1)), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c = New("test/")
+	err = c.Open()
+	if err == nil {
+		t.Fatal("expected error opening newer layout")
+	}
+}
+
+func TestCatalog_Migrate(t *testing.T) {
+	defer os.RemoveAll("test/")
+
+	err := os.MkdirAll("test", 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ran := make([]int, 0)
+
+	testMigrations := []*Migration{
+		{Version: 2, Description: "first", Migrate: func(directory string) error {
+			ran = append(ran, 2)
+			return nil
+		}},
+		{Version: 3, Description: "second", Migrate: func(directory string) error {
+			ran = append(ran, 3)
+			return errors.New("failed")
+		}},
+	}
+
+	err = migrate("test", 1, 3, testMigrations)
+	if err == nil {
+		t.Fatal("expected error from failed migration")
+	}
+
+	if len(ran) != 2 || ran[0] != 2 || ran[1] != 3 {
+		t.Fatalf("expected migrations 2 and 3 to run, got %v", ran)
+	}
+
+	// The directory is stamped with the last migration that succeeded
+	version, err := readLayoutVersion("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if version != 2 {
+		t.Fatalf("expected layout version 2, got %d", version)
+	}
+
+	// A missing migration is an error
+	err = migrate("test", 3, 4, testMigrations)
+	if err == nil {
+		t.Fatal("expected error for missing migration")
+	}
+
+	// Upgrading a directory already at the current layout leaves it as is
+	err = writeLayoutVersion("test", LAYOUT_VERSION)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	from, err := Upgrade("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if from != LAYOUT_VERSION {
+		t.Fatalf("expected layout version %d, got %d", LAYOUT_VERSION, from)
+	}
+}
+
+func TestBackup(t *testing.T) {
+	defer os.RemoveAll("test/")
+	defer os.RemoveAll("backup/")
+	defer os.RemoveAll("restored/")
+
+	// insert opens the catalog and inserts rows into db1.table1
+	insert := func(rows int) {
+		c := New("test/")
+		err := c.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		defer c.Close()
+
+		db := c.GetDatabase("db1")
+		if db == nil {
+			err = c.CreateDatabase("db1")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			db = c.GetDatabase("db1")
+
+			err = db.CreateTable("table1", &TableSchema{
+				ColumnDefinitions: map[string]*ColumnDefinition{
+					"id": {
+						DataType: "INT",
+						NotNull:  true,
+						Unique:   true,
+						Sequence: true,
+					},
+				},
+			}, false, false, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		for i := 0; i < rows; i++ {
+			_, _, err = db.GetTable("table1").Insert([]map[string]interface{}{{}}, db)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	insert(100)
+
+	_, err := Backup("test/", "backup/", true, "")
+	if err == nil {
+		t.Fatal("expected error taking an incremental backup without a full backup")
+	}
+
+	full, err := Backup("test/", "backup/", false, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	insert(5)
+
+	incremental, err := Backup("test/", "backup/", true, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if incremental.Sequence != full.Sequence+1 {
+		t.Fatalf("expected sequence %d, got %d", full.Sequence+1, incremental.Sequence)
+	}
+
+	// Only the new rows are within the incremental backup
+	for _, file := range incremental.Files {
+		if filepath.Base(file.Path) != "table1"+DB_SCHEMA_TABLE_DATA_FILE_EXTENSION {
+			continue
+		}
+
+		if !file.Incremental || len(file.Pages) != 5 {
+			t.Fatalf("expected 5 pages of the data file, got %v", file.Pages)
+		}
+	}
+
+	restored, err := Restore("backup/", "restored/", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if restored.Sequence != incremental.Sequence {
+		t.Fatalf("expected backup %d to be restored, got %d", incremental.Sequence, restored.Sequence)
+	}
+
+	c := New("restored/")
+	err = c.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer c.Close()
+
+	tbl := c.GetDatabase("db1").GetTable("table1")
+
+	if tbl.Rows.Count() != 105 {
+		t.Fatalf("expected 105 rows, got %d", tbl.Rows.Count())
+	}
+
+	row, err := tbl.GetRow(104)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if row["id"] != 105 {
+		t.Fatalf("expected 105, got %v", row["id"])
+	}
+
+	// Restoring needs an empty data directory
+	_, err = Restore("backup/", "test/", "")
+	if err == nil {
+		t.Fatal("expected error restoring into a data directory in use")
+	}
+}
+
+func TestVerifyBackup(t *testing.T) {
+	defer os.RemoveAll("test/")
+	defer os.RemoveAll("backup/")
+	defer os.RemoveAll("restored/")
+
+	c := New("test/")
+	err := c.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = c.CreateDatabase("db1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c.Close()
+
+	manifest, err := Backup("test/", "backup/", false, "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !manifest.Encrypted {
+		t.Fatal("expected encrypted backup")
+	}
+
+	issues, err := VerifyBackup("backup/", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(issues) != 0 {
+		t.Fatalf("expected no issues, got %s", issues[0].Problem)
+	}
+
+	_, err = VerifyBackup("backup/", "")
+	if err == nil {
+		t.Fatal("expected error verifying an encrypted backup without a passphrase")
+	}
+
+	issues, err = VerifyBackup("backup/", "wrong")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(issues) == 0 {
+		t.Fatal("expected issues with the wrong passphrase")
+	}
+
+	// Damage a file within the backup
+	data := filepath.Join("backup", fmt.Sprintf("%06d", manifest.Sequence), BACKUP_DATA_DIRECTORY, LAYOUT_VERSION_FILE)
+
+	d, err := os.ReadFile(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d[len(d)-1] ^= 0xff
+
+	err = os.WriteFile(data, d, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	issues, err = VerifyBackup("backup/", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(issues) != 1 {
+		t.Fatalf("expected 1 issue, got %d", len(issues))
+	}
+
+	_, err = Restore("backup/", "restored/", "secret")
+	if err == nil {
+		t.Fatal("expected error restoring a damaged backup")
+	}
+
+	// Changes to the manifest of an encrypted backup do not authenticate
+	manifestPath := filepath.Join("backup", fmt.Sprintf("%06d", manifest.Sequence), BACKUP_MANIFEST_FILE)
+
+	original, err := os.ReadFile(manifestPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rewrite := func(change func(m *BackupManifest)) {
+		m := &BackupManifest{}
+
+		err := gob.NewDecoder(bytes.NewReader(original)).Decode(m)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		change(m)
+
+		err = writeBackupManifest(filepath.Dir(manifestPath), m)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	rewrite(func(m *BackupManifest) { m.Files = m.Files[1:] })
+
+	issues, err = VerifyBackup("backup/", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(issues) != 1 || !strings.Contains(issues[0].Problem, "does not authenticate") {
+		t.Fatalf("expected the manifest not to authenticate, got %v", issues)
+	}
+
+	rewrite(func(m *BackupManifest) { m.Encrypted = false; m.MAC = nil })
+
+	_, err = VerifyBackup("backup/", "secret")
+	if err == nil || !strings.Contains(err.Error(), "not encrypted") {
+		t.Fatalf("expected error verifying a backup rewritten as not encrypted, got %v", err)
+	}
+}
+
+func TestCatalog_SafeMode(t *testing.T) {
+	defer os.RemoveAll("test/")
+
+	c := New("test/")
+	err := c.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = c.CreateDatabase("db1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db := c.GetDatabase("db1")
+
+	for _, name := range []string{"good", "bad"} {
+		err = db.CreateTable(name, &TableSchema{
+			ColumnDefinitions: map[string]*ColumnDefinition{"id": {DataType: "INT"}},
+		}, false, false, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	c.Close()
+
+	// Damage the schema of a table and the procedures of the database
+	err = os.WriteFile(filepath.Join("test", "databases", "db1", "bad", "bad"+DB_SCHEMA_TABLE_SCHEMA_FILE_EXTENSION), []byte("not a schema"), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = os.WriteFile(filepath.Join("test", "databases", "db1", "db1"+DB_PROC_EXTENSION), []byte("not procedures"), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c = New("test/")
+	err = c.Open()
+	if err == nil {
+		c.Close()
+		t.Fatal("expected error opening damaged procedures without safe mode")
+	}
+
+	c.Close()
+
+	c = New("test/")
+	c.SafeMode = true
+
+	err = c.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer c.Close()
+
+	quarantined := c.GetQuarantined()
+	if len(quarantined) != 2 {
+		t.Fatalf("expected 2 quarantined objects, got %d", len(quarantined))
+	}
+
+	db = c.GetDatabase("db1")
+
+	if db.GetTable("bad") != nil || db.GetTable("good") == nil {
+		t.Fatal("expected only the damaged table to be quarantined")
+	}
+
+	err = db.AddProcedure(&Procedure{Name: "proc1"})
+	if err == nil {
+		t.Fatal("expected error changing quarantined procedures")
+	}
+
+	// A quarantined table is not created again over its files
+	err = db.CreateTable("bad", &TableSchema{
+		ColumnDefinitions: map[string]*ColumnDefinition{"id": {DataType: "INT"}},
+	}, false, false, nil)
+	if err == nil {
+		t.Fatal("expected error creating a quarantined table")
+	}
+
+	// Dropping a quarantined table removes it and releases the name
+	err = db.DropTable("bad")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(c.GetQuarantined()) != 1 || c.GetQuarantined()[0].Kind != QUARANTINE_PROCEDURES {
+		t.Fatalf("expected the procedures to stay quarantined, got %v", c.GetQuarantined())
+	}
+
+	err = db.CreateTable("bad", &TableSchema{
+		ColumnDefinitions: map[string]*ColumnDefinition{"id": {DataType: "INT"}},
+	}, false, false, nil)
+	if err != nil {
+		t.Fatal(err)
 	}
+}
 
-	if len(cat.GetUser("admin").Privileges) != 1 {
-		t.Fatal("expected admin user to have 1 privilege")
+func TestCatalog_CreateDatabaseWithSettings(t *testing.T) {
+	defer os.RemoveAll("test/")
+
+	c := New("test/")
+	err := c.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = c.CreateDatabaseWithSettings("db1", &DatabaseSettings{Compress: true, Collation: "nocase"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = c.CreateDatabase("db2")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c.Close()
+
+	c = New("test/")
+	err = c.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	settings := c.GetDatabase("db1").Settings
+	if !settings.Compress || settings.Encrypt || settings.Collation != "nocase" {
+		t.Fatalf("expected the settings to be read back, got %+v", settings)
+	}
+
+	if *c.GetDatabase("db2").Settings != (DatabaseSettings{}) {
+		t.Fatalf("expected no settings, got %+v", c.GetDatabase("db2").Settings)
 	}
 
+	c.Close()
+
+	issues, err := Check("test/", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(issues) != 0 {
+		t.Fatalf("expected no issues, got %s %s", issues[0].Path, issues[0].Problem)
+	}
+
+	err = os.WriteFile(filepath.Join("test", "databases", "db1", "db1"+DB_SETTINGS_EXTENSION), []byte("not settings"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// In safe mode settings which do not decode are quarantined and no tables are created without them
+	c = New("test/")
+	c.SafeMode = true
+
+	err = c.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer c.Close()
+
+	if len(c.GetQuarantined()) != 1 || c.GetQuarantined()[0].Kind != QUARANTINE_SETTINGS {
+		t.Fatalf("expected the settings to be quarantined, got %v", c.GetQuarantined())
+	}
+
+	err = c.GetDatabase("db1").CreateTable("users", &TableSchema{
+		ColumnDefinitions: map[string]*ColumnDefinition{"id": {DataType: "INT"}},
+	}, false, false, nil)
+	if err == nil {
+		t.Fatal("expected error creating a table without the settings of the database")
+	}
 }
 
-func TestCatalog_Compress(t *testing.T) {
+func TestDatabase_SetWarm(t *testing.T) {
 	defer os.RemoveAll("test/")
-	cat := New("test/")
-	err := cat.Open()
 
+	c := New("test/")
+
+	err := c.Open()
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	cat.Close()
+	err = c.CreateDatabase("db1")
+	if err != nil {
+		t.Fatal(err)
+	}
 
-	err = cat.Open()
+	db := c.GetDatabase("db1")
+
+	for _, name := range []string{"orders", "users"} {
+		err = db.CreateTable(name, &TableSchema{
+			ColumnDefinitions: map[string]*ColumnDefinition{"name": {DataType: "TEXT"}},
+		}, false, false, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = db.GetTable(name).CreateIndex("name_idx", []string{"name"}, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, _, err = db.GetTable(name).Insert([]map[string]interface{}{{"name": "John Doe"}}, db)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err = db.SetWarm("missing", true)
+	if err == nil {
+		t.Fatal("expected an error warming a table which does not exist")
+	}
+
+	for _, name := range []string{"orders", "users"} {
+		err = db.SetWarm(name, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
 
+	err = db.DropTable("orders")
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	row := map[string]interface{}{
-		"id":   1,
-		"name": "'john_doe'",
+	c.Close()
+
+	c = New("test/")
+
+	err = c.Open()
+	if err != nil {
+		t.Fatal(err)
 	}
 
-	// encode
-	encoded, err := EncodeRow(row)
+	db = c.GetDatabase("db1")
+
+	if !db.Placement("users").Warm {
+		t.Fatal("expected users to stay warm")
+	}
+
+	loads := c.WarmTables()
+	if len(loads) != 1 || loads[0].Table != "users" || loads[0].Files != 2 || loads[0].Bytes == 0 {
+		t.Fatalf("unexpected loads %v", loads)
+	}
+
+	c.Close()
+
+	issues, err := Check("test/", false)
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	compressed, err := Compress(encoded)
+	for _, issue := range issues {
+		if strings.HasSuffix(issue.Path, DB_WARM_EXTENSION) {
+			t.Fatalf("unexpected issue %s: %s", issue.Path, issue.Problem)
+		}
+	}
+}
+
+func TestDatabase_MoveTable(t *testing.T) {
+	defer os.RemoveAll("test/")
+	defer os.RemoveAll("test_cold/")
+
+	c := New("test/")
+	c.ColdDirectory = "test_cold/"
+
+	err := c.Open()
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	// decompress
-	decompressed, err := Decompress(compressed)
+	err = c.CreateDatabase("db1")
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	// decode
-	decoded, err := decodeRow(decompressed)
+	db := c.GetDatabase("db1")
+
+	err = db.CreateTable("orders", &TableSchema{
+		ColumnDefinitions: map[string]*ColumnDefinition{"name": {DataType: "TEXT"}},
+	}, false, false, nil)
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	if decoded["id"] != 1 {
-		t.Fatalf("expected 1, got %d", decoded["id"])
+	_, _, err = db.GetTable("orders").Insert([]map[string]interface{}{{"name": "John Doe"}}, db)
+	if err != nil {
+		t.Fatal(err)
 	}
 
-	if decoded["name"] != "'john_doe'" {
-		t.Fatalf("expected 'john_doe', got %s", decoded["name"])
+	if len(db.IdleTables(0)) != 1 || len(db.IdleTables(time.Hour)) != 0 {
+		t.Fatal("expected orders to be idle only without a minimum idle time")
 	}
 
-}
+	err = db.MoveTable("orders", TIER_COLD)
+	if err != nil {
+		t.Fatal(err)
+	}
 
-func TestEncrypt(t *testing.T) {
+	cold := filepath.Join("test_cold", "databases", "db1", "orders")
 
-	// sha256 hash the key
-	hash := sha256.New()
+	if _, err = os.Stat(filepath.Join(cold, "orders"+DB_SCHEMA_TABLE_DATA_FILE_EXTENSION)); err != nil {
+		t.Fatal("expected the table files on the cold tier")
+	}
 
-	// Write data to the hash
-	hash.Write([]byte("hello world"))
+	if _, err = os.Stat(filepath.Join("test", "databases", "db1", "orders")); !os.IsNotExist(err) {
+		t.Fatal("expected the table files to be removed from the hot tier")
+	}
 
-	// Calculate the hash
-	hashBytes := hash.Sum(nil)
+	err = db.MoveTable("orders", TIER_COLD)
+	if err == nil {
+		t.Fatal("expected error moving a table to the tier it is on")
+	}
 
-	key := [32]byte(hashBytes)
-	nonce := [12]byte{}
-	nonce = [12]byte(append(nonce[:], hashBytes[len(hashBytes)-12:]...))
+	c.Close()
 
-	row := map[string]interface{}{
-		"id":   1,
-		"name": "'john_doe'",
+	// A table moved to the cold tier is read from the cold directory after a restart
+	c = New("test/")
+	c.ColdDirectory = "test_cold/"
+
+	err = c.Open()
+	if err != nil {
+		t.Fatal(err)
 	}
 
-	encoded, err := EncodeRow(row)
+	db = c.GetDatabase("db1")
+
+	placement := db.Placement("orders")
+	if placement == nil || placement.Tier != TIER_COLD || placement.Directory != filepath.Join(c.ColdDirectory, "databases", "db1", "orders") {
+		t.Fatalf("expected orders on the cold tier, got %+v", placement)
+	}
+
+	iter := db.GetTable("orders").NewIterator()
+
+	row, err := iter.Next()
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	enc, err := Encrypt(key, nonce, encoded)
+	if row["name"] != "John Doe" {
+		t.Fatalf("expected John Doe, got %v", row["name"])
+	}
+
+	// Moving the table back and crashing before the cold files are removed leaves a copy behind
+	err = db.MoveTable("orders", TIER_HOT)
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	dec, err := Decrypt(key, nonce, enc)
+	c.Close()
+
+	err = copyDirectory(filepath.Join("test", "databases", "db1", "orders"), cold)
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	decoded, err := decodeRow(dec)
+	c = New("test/")
+	c.ColdDirectory = "test_cold/"
+
+	err = c.Open()
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	if decoded["id"] != 1 {
-		t.Fatalf("expected 1, got %d", decoded["id"])
+	if _, err = os.Stat(cold); !os.IsNotExist(err) {
+		t.Fatal("expected the copy left on the cold tier to be removed")
 	}
 
-	if decoded["name"] != "'john_doe'" {
-		t.Fatalf("expected 'john_doe', got %s", decoded["name"])
+	if c.GetDatabase("db1").Placement("orders").Tier != TIER_HOT {
+		t.Fatal("expected orders on the hot tier")
+	}
+
+	// A table on the cold tier is dropped from the cold directory
+	db = c.GetDatabase("db1")
+
+	err = db.CreateTable("archive", &TableSchema{ColumnDefinitions: map[string]*ColumnDefinition{"id": {DataType: "INT"}}}, false, false, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = db.MoveTable("archive", TIER_COLD)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = db.DropTable("archive")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = os.Stat(filepath.Join(c.ColdDirectory, "databases", "db1", "archive")); !os.IsNotExist(err) {
+		t.Fatal("expected the cold directory of the dropped table to be removed")
+	}
+
+	c.Close()
+
+	// Without a cold directory tables can not be moved to the cold tier
+	c = New("test/")
+
+	err = c.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer c.Close()
+
+	err = c.GetDatabase("db1").MoveTable("orders", TIER_COLD)
+	if err == nil {
+		t.Fatal("expected error without a cold tier")
+	}
+}
+
+func TestDatabase_CreateTableForeignKeyIndex(t *testing.T) {
+	defer os.RemoveAll("test/")
+
+	c := New("test/")
+
+	err := c.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer c.Close()
+
+	err = c.CreateDatabase("db1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db := c.GetDatabase("db1")
+
+	err = db.CreateTable("customers", &TableSchema{
+		ColumnDefinitions: map[string]*ColumnDefinition{"customer_id": {DataType: "INT", Unique: true, NotNull: true}},
+	}, false, false, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = db.CreateTable("orders", &TableSchema{
+		ColumnDefinitions: map[string]*ColumnDefinition{
+			"order_id":    {DataType: "INT", Unique: true, NotNull: true},
+			"customer_id": {DataType: "INT", References: &Reference{TableName: "customers", ColumnName: "customer_id"}},
+		},
+	}, false, false, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	idx := db.GetTable("orders").CheckIndexedColumn("customer_id", false)
+	if idx == nil || idx.Name != FOREIGN_KEY_INDEX_PREFIX+"customer_id" {
+		t.Fatalf("expected the foreign key column to be indexed, got %+v", idx)
+	}
+
+	if len(db.GetTable("orders").GetIndexes()) != 2 {
+		t.Fatalf("expected a unique index and a foreign key index, got %d indexes", len(db.GetTable("orders").GetIndexes()))
+	}
+}
+
+func TestRuntimeFilter(t *testing.T) {
+	filter := NewRuntimeFilter("customer_id", 100)
+
+	for i := 0; i < 100; i++ {
+		filter.Add(i * 2)
+	}
+
+	if filter.Keys() != 100 {
+		t.Fatalf("expected 100 keys, got %d", filter.Keys())
+	}
+
+	// Values added are never ruled out, numbers match by value
+	for i := 0; i < 100; i++ {
+		if !filter.MayContain(i*2) || !filter.MayContain(float64(i*2)) {
+			t.Fatalf("expected %d to be contained", i*2)
+		}
+	}
+
+	falsePositives := 0
+	for i := 0; i < 1000; i++ {
+		if filter.MayContain(i*2 + 1001) {
+			falsePositives++
+		}
+	}
+
+	if falsePositives > 50 {
+		t.Fatalf("expected few false positives, got %d of 1000", falsePositives)
 	}
 
+	if JoinKey("0") == JoinKey(0) {
+		t.Fatal("expected a string to be keyed apart from a number")
+	}
 }
@@ -0,0 +1,560 @@
+// Package checkpoint
+// AriaSQL checkpoint package
+// Copyright (C) AriaSQL
+// Author(s): Alex Gaetano Padula
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+package checkpoint
+
+import (
+	"ariasql/core"
+	"ariasql/storage/btree"
+	"ariasql/wal"
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const DIRECTORY = "checkpoint"         // Checkpoint directory within the data directory
+const RECORD_FILE = "record"           // Record of the last checkpoint within the checkpoint directory
+const CHECK_INTERVAL = 5 * time.Second // Time between checks of the triggers of a checkpoint
+const MTIME_SLACK = 2 * time.Second    // Files written this close before the previous checkpoint are copied again, modification times can be coarse
+const IMAGE_TMP_EXTENSION = ".tmp"     // Copy of a checkpoint not yet complete
+
+// imaged are the files and directories of the data directory within a checkpoint, those -recover rebuilds
+var imaged = []string{"databases", "users.usrs"}
+
+// Checkpointer takes checkpoints of the data directory
+// A checkpoint copies the databases and users while writes go on, then holds off writes, rotates the WAL, copies
+// again the files written since it started copying and records the LSN the copy holds every WAL entry up to.  Once
+// recorded the WAL segments up to the checkpoint and the previous checkpoint are removed.
+type Checkpointer struct {
+	aria   *core.AriaSQL          // AriaSQL instance pointer
+	config *core.Checkpoint       // Checkpoint configuration, nil to only take checkpoints on CHECKPOINT
+	last   *core.CheckpointRecord // Last checkpoint taken, nil if none was
+	lock   *sync.Mutex            // One checkpoint at a time
+	stop   chan struct{}          // Closed to stop checking the triggers
+	wg     *sync.WaitGroup        // Checking goroutine
+}
+
+// New creates a checkpointer of the data directory, checkpoints are taken on the configured triggers once started
+func New(aria *core.AriaSQL) (*Checkpointer, error) {
+	config := aria.Config.Checkpoint
+
+	if config != nil && (config.Interval < 0 || config.MaxWALBytes < 0) {
+		return nil, errors.New("checkpoint triggers cannot be negative")
+	}
+
+	last, err := Read(aria.Config.DataDir)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Checkpointer{aria: aria, config: config, last: last, lock: &sync.Mutex{}, stop: make(chan struct{}), wg: &sync.WaitGroup{}}, nil
+}
+
+// Start starts checking the triggers of a checkpoint, nothing is checked without them
+func (c *Checkpointer) Start() {
+	if c.config == nil || (c.config.Interval == 0 && c.config.MaxWALBytes == 0) {
+		return
+	}
+
+	c.wg.Add(1)
+
+	go func() {
+		defer c.wg.Done()
+
+		ticker := time.NewTicker(CHECK_INTERVAL)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-c.stop:
+				return
+			case <-ticker.C:
+				if !c.due() {
+					continue
+				}
+
+				_, err := c.Checkpoint()
+				if err != nil {
+					log.Printf("checkpoint: %s", err.Error())
+				}
+			}
+		}
+	}()
+}
+
+// Close stops checking the triggers
+func (c *Checkpointer) Close() {
+	close(c.stop)
+	c.wg.Wait()
+}
+
+// due returns true if a trigger fired, no checkpoint is taken while the server is read-only
+func (c *Checkpointer) due() bool {
+	if c.aria.ReadOnly() != nil {
+		return false
+	}
+
+	if c.config.Interval > 0 {
+		last := c.Last()
+		if last == nil || time.Since(last.Created) >= time.Duration(c.config.Interval)*time.Second {
+			return true
+		}
+	}
+
+	if c.config.MaxWALBytes > 0 {
+		size, err := c.aria.WAL.Size()
+		if err == nil && size >= c.config.MaxWALBytes {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Last returns the last checkpoint taken, nil if none was
+func (c *Checkpointer) Last() *core.CheckpointRecord {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return c.last
+}
+
+// Checkpoint takes a checkpoint, writes only wait while the files written during the first copy are copied again
+func (c *Checkpointer) Checkpoint() (*core.CheckpointRecord, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	directory := filepath.Join(c.aria.Config.DataDir, DIRECTORY)
+
+	err := os.MkdirAll(directory, 0755)
+	if err != nil {
+		return nil, err
+	}
+
+	started := time.Now()
+	image := fmt.Sprintf("%d", started.UnixNano())
+	tmp := filepath.Join(directory, image+IMAGE_TMP_EXTENSION)
+
+	// The first copy is taken while statements write, files they write are torn or out of date in it
+	precopy, err := c.image(directory, tmp, nil, started)
+	if err != nil {
+		os.RemoveAll(tmp)
+		return nil, err
+	}
+
+	c.aria.WriteGate.Lock()
+	locked := true
+	held := time.Now()
+
+	defer func() {
+		if locked {
+			c.aria.WriteGate.Unlock()
+		}
+	}()
+
+	// Entries written from now on are after the checkpoint
+	segment, err := c.aria.WAL.Rotate()
+	if err != nil {
+		return nil, err
+	}
+
+	record := &core.CheckpointRecord{Created: time.Now(), Image: image}
+	record.WALRotatedAt = record.Created
+
+	if segment != nil {
+		record.WALRotatedAt = segment.RotatedAt
+	}
+
+	segments, err := c.covered(record)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.last != nil {
+		record.LSN = c.last.LSN
+	}
+
+	for _, s := range segments {
+		entries, err := segmentEntries(s)
+		if err != nil {
+			return nil, err
+		}
+
+		record.LSN += entries
+	}
+
+	// With writes held off, the files written since the first copy started are copied again
+	copied, err := c.image(directory, tmp, precopy, started)
+	if err != nil {
+		os.RemoveAll(tmp)
+		return nil, err
+	}
+
+	record.Files = len(copied)
+
+	for _, f := range copied {
+		record.Copied += f.copied
+	}
+
+	err = os.Rename(tmp, filepath.Join(directory, record.Image))
+	if err != nil {
+		os.RemoveAll(tmp)
+		return nil, err
+	}
+
+	record.Duration = time.Since(held)
+
+	err = writeRecord(directory, record)
+	if err != nil {
+		os.RemoveAll(filepath.Join(directory, record.Image))
+		return nil, err
+	}
+
+	c.aria.WriteGate.Unlock()
+	locked = false
+
+	c.last = record
+
+	// The WAL is truncated up to the checkpoint, a crash before leaves segments -recover skips
+	for _, s := range segments {
+		err = wal.RemoveSegment(s)
+		if err != nil {
+			return record, err
+		}
+	}
+
+	entries, err := os.ReadDir(directory)
+	if err != nil {
+		return record, err
+	}
+
+	for _, entry := range entries {
+		if entry.Name() != record.Image && entry.Name() != RECORD_FILE {
+			err = os.RemoveAll(filepath.Join(directory, entry.Name()))
+			if err != nil {
+				return record, err
+			}
+		}
+	}
+
+	return record, nil
+}
+
+// covered returns the WAL segments rotated up to a checkpoint and after the previous one
+func (c *Checkpointer) covered(record *core.CheckpointRecord) ([]*wal.Segment, error) {
+	segments, err := wal.Segments(c.aria.WAL.FilePath)
+	if err != nil {
+		return nil, err
+	}
+
+	covered := make([]*wal.Segment, 0, len(segments))
+
+	for _, s := range segments {
+		if s.RotatedAt.After(record.WALRotatedAt) {
+			continue
+		}
+
+		// Left behind by a crash after the previous checkpoint was recorded, its entries are counted
+		if c.last != nil && !s.RotatedAt.After(c.last.WALRotatedAt) {
+			err = wal.RemoveSegment(s)
+			if err != nil {
+				return nil, err
+			}
+
+			continue
+		}
+
+		covered = append(covered, s)
+	}
+
+	return covered, nil
+}
+
+// imageFile is a file of the data directory copied into a checkpoint
+type imageFile struct {
+	size    int64     // Size of the file when it was copied
+	modTime time.Time // Modification time of the file when it was copied
+	copied  int64     // Bytes copied, 0 if the file was linked to the previous checkpoint
+}
+
+// image copies the databases and users of the data directory into tmp, the files of the image are returned by path
+// Files not written since the previous checkpoint are linked to its copy.  Once copied before, as precopy, a file is
+// only copied again if it changed or was written since the checkpoint started, files no longer there are removed.
+func (c *Checkpointer) image(directory, tmp string, precopy map[string]*imageFile, started time.Time) (map[string]*imageFile, error) {
+	if precopy == nil {
+		err := os.RemoveAll(tmp)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	files := make(map[string]*imageFile)
+
+	for _, name := range imaged {
+		root := filepath.Join(c.aria.Config.DataDir, name)
+
+		err := filepath.WalkDir(root, func(path string, d os.DirEntry, err error) error {
+			if os.IsNotExist(err) && path == root {
+				return nil
+			} else if err != nil {
+				return err
+			}
+
+			rel, err := filepath.Rel(c.aria.Config.DataDir, path)
+			if err != nil {
+				return err
+			}
+
+			dest := filepath.Join(tmp, rel)
+
+			if d.IsDir() {
+				return os.MkdirAll(dest, 0755)
+			}
+
+			// Dirty pages are of backups, not of the data
+			if strings.HasSuffix(d.Name(), btree.DIRTY_PAGES_EXTENSION) {
+				return nil
+			}
+
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+
+			file := &imageFile{size: info.Size(), modTime: info.ModTime()}
+			files[rel] = file
+
+			if before, ok := precopy[rel]; ok && before.size == file.size && before.modTime.Equal(file.modTime) && file.modTime.Before(started.Add(-MTIME_SLACK)) {
+				file.copied = before.copied
+				return nil
+			}
+
+			// A copy linked to the previous checkpoint is replaced rather than written through
+			err = os.Remove(dest)
+			if err != nil && !os.IsNotExist(err) {
+				return err
+			}
+
+			err = os.MkdirAll(filepath.Dir(dest), 0755)
+			if err != nil {
+				return err
+			}
+
+			if c.last != nil && info.ModTime().Before(c.last.Created.Add(-MTIME_SLACK)) {
+				if os.Link(filepath.Join(directory, c.last.Image, rel), dest) == nil {
+					return nil
+				}
+			}
+
+			file.copied, err = copyFile(path, dest)
+
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if precopy == nil {
+		return files, nil
+	}
+
+	// Tables dropped or renamed since the first copy are not part of the checkpoint
+	for _, name := range imaged {
+		err := filepath.WalkDir(filepath.Join(tmp, name), func(path string, d os.DirEntry, err error) error {
+			if os.IsNotExist(err) {
+				return nil
+			} else if err != nil {
+				return err
+			}
+
+			rel, err := filepath.Rel(tmp, path)
+			if err != nil {
+				return err
+			}
+
+			_, err = os.Stat(filepath.Join(c.aria.Config.DataDir, rel))
+			if !os.IsNotExist(err) {
+				return err
+			}
+
+			err = os.RemoveAll(path)
+			if err != nil {
+				return err
+			}
+
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return files, nil
+}
+
+// Read returns the last checkpoint of a data directory, nil if none was taken
+func Read(dataDirectory string) (*core.CheckpointRecord, error) {
+	data, err := os.ReadFile(filepath.Join(dataDirectory, DIRECTORY, RECORD_FILE))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	record := &core.CheckpointRecord{}
+
+	err = gob.NewDecoder(bytes.NewReader(data)).Decode(record)
+	if err != nil {
+		return nil, err
+	}
+
+	return record, nil
+}
+
+// Restore replaces the databases and users of a data directory with the last checkpoint, which is returned
+// Nothing is restored if no checkpoint was taken
+func Restore(dataDirectory string) (*core.CheckpointRecord, error) {
+	record, err := Read(dataDirectory)
+	if err != nil || record == nil {
+		return nil, err
+	}
+
+	image := filepath.Join(dataDirectory, DIRECTORY, record.Image)
+
+	for _, name := range imaged {
+		err = os.RemoveAll(filepath.Join(dataDirectory, name))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = filepath.WalkDir(image, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(image, path)
+		if err != nil {
+			return err
+		}
+
+		dest := filepath.Join(dataDirectory, rel)
+
+		if d.IsDir() {
+			return os.MkdirAll(dest, 0755)
+		}
+
+		// The checkpoint is copied rather than linked, the next checkpoint may link to it
+		_, err = copyFile(path, dest)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return record, nil
+}
+
+// Replayed returns the WAL segments written after a checkpoint, every segment without one
+func Replayed(record *core.CheckpointRecord, segments []*wal.Segment) []*wal.Segment {
+	if record == nil {
+		return segments
+	}
+
+	replayed := make([]*wal.Segment, 0, len(segments))
+
+	for _, s := range segments {
+		if s.RotatedAt.After(record.WALRotatedAt) {
+			replayed = append(replayed, s)
+		}
+	}
+
+	return replayed
+}
+
+// writeRecord records a checkpoint, a checkpoint is taken once recorded
+func writeRecord(directory string, record *core.CheckpointRecord) error {
+	buff := bytes.NewBuffer([]byte{})
+
+	err := gob.NewEncoder(buff).Encode(record)
+	if err != nil {
+		return err
+	}
+
+	tmp := filepath.Join(directory, RECORD_FILE+".tmp")
+
+	err = os.WriteFile(tmp, buff.Bytes(), 0644)
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, filepath.Join(directory, RECORD_FILE))
+}
+
+// segmentEntries returns the amount of entries within a WAL segment
+func segmentEntries(segment *wal.Segment) (int64, error) {
+	w, err := wal.OpenWAL(segment.Path, os.O_RDWR, 0644)
+	if err != nil {
+		return 0, err
+	}
+
+	defer w.Close()
+
+	return w.Entries()
+}
+
+// copyFile copies a file once it is flushed to disk, the copy is flushed as well, the bytes copied are returned
+func copyFile(source, dest string) (int64, error) {
+	in, err := os.OpenFile(source, os.O_RDWR, 0)
+	if err != nil {
+		return 0, err
+	}
+
+	defer in.Close()
+
+	err = in.Sync()
+	if err != nil {
+		return 0, err
+	}
+
+	out, err := os.Create(dest)
+	if err != nil {
+		return 0, err
+	}
+
+	defer out.Close()
+
+	n, err := io.Copy(out, in)
+	if err != nil {
+		return n, err
+	}
+
+	return n, out.Sync()
+}
@@ -0,0 +1,323 @@
+// Package checkpoint
+// AriaSQL checkpoint package
+// Copyright (C) AriaSQL
+// Author(s): Alex Gaetano Padula
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+package checkpoint
+
+import (
+	"ariasql/catalog"
+	"ariasql/core"
+	"ariasql/wal"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestNew(t *testing.T) {
+	defer os.RemoveAll("./test/")
+
+	_, err := New(&core.AriaSQL{Config: &core.Config{DataDir: "./test", Checkpoint: &core.Checkpoint{Interval: -1}}})
+	if err == nil {
+		t.Fatal("expected error for a negative interval")
+	}
+}
+
+func TestCheckpointer_Checkpoint(t *testing.T) {
+	defer os.RemoveAll("./test/")
+
+	aria, err := core.New(&core.Config{DataDir: "./test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer aria.WAL.Close()
+
+	aria.Catalog = catalog.New(aria.Config.DataDir)
+
+	err = aria.Catalog.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer aria.Catalog.Close()
+
+	err = aria.Catalog.CreateDatabase("db1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db := aria.Catalog.GetDatabase("db1")
+
+	for _, name := range []string{"orders", "users"} {
+		err = db.CreateTable(name, &catalog.TableSchema{
+			ColumnDefinitions: map[string]*catalog.ColumnDefinition{"id": {DataType: "INT"}},
+		}, false, false, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, entry := range []string{"entry 1", "entry 2"} {
+		err = aria.WAL.Append([]byte(entry))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	c, err := New(aria)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Files written this close before a checkpoint are copied again by the next one
+	time.Sleep(MTIME_SLACK + 100*time.Millisecond)
+
+	// A statement writing holds off the checkpoint until it is done
+	aria.WriteGate.RLock()
+
+	taken := make(chan *core.CheckpointRecord)
+	go func() {
+		record, err := c.Checkpoint()
+		if err != nil {
+			t.Error(err)
+		}
+
+		taken <- record
+	}()
+
+	select {
+	case <-taken:
+		t.Fatal("expected the checkpoint to wait for the write")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	// The first copy is taken while the write goes on
+	precopies, err := filepath.Glob(filepath.Join(aria.Config.DataDir, DIRECTORY, "*"+IMAGE_TMP_EXTENSION, "databases", "db1", "orders"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(precopies) != 1 {
+		t.Fatal("expected the databases to be copied before the write is done")
+	}
+
+	aria.WriteGate.RUnlock()
+
+	first := <-taken
+	if first == nil || first.LSN != 2 || first.Files == 0 || first.Copied == 0 {
+		t.Fatalf("expected a checkpoint of 2 entries, got %+v", first)
+	}
+
+	// The WAL is truncated up to the checkpoint
+	entries, err := aria.WAL.Entries()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	segments, err := wal.Segments(aria.WAL.FilePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if entries != 0 || len(segments) != 0 {
+		t.Fatalf("expected an empty WAL, got %d entries and %d segments", entries, len(segments))
+	}
+
+	err = aria.WAL.Append([]byte("entry 3"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, _, err = db.GetTable("orders").Insert([]map[string]interface{}{{"id": 1}}, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Files not written since the previous checkpoint are linked to it, the previous checkpoint is removed
+	second, err := c.Checkpoint()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	total := int64(0)
+
+	err = filepath.WalkDir(filepath.Join(aria.Config.DataDir, DIRECTORY, second.Image), func(path string, d os.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+
+		info, err := d.Info()
+		total += info.Size()
+
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if second.LSN != 3 || second.Files != first.Files || second.Copied == 0 || second.Copied >= total {
+		t.Fatalf("expected a checkpoint of 3 entries copying less than its %d bytes, got %+v", total, second)
+	}
+
+	if _, err := os.Stat(filepath.Join(aria.Config.DataDir, DIRECTORY, first.Image)); !os.IsNotExist(err) {
+		t.Fatal("expected the previous checkpoint to be removed")
+	}
+
+	last, err := Read(aria.Config.DataDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if last == nil || last.LSN != second.LSN || c.Last().Image != second.Image {
+		t.Fatalf("expected the second checkpoint to be recorded, got %+v", last)
+	}
+
+	// Segments rotated after the checkpoint are replayed on top of it
+	replayed := Replayed(last, []*wal.Segment{{RotatedAt: last.WALRotatedAt}, {RotatedAt: last.WALRotatedAt.Add(time.Second)}})
+	if len(replayed) != 1 {
+		t.Fatalf("expected 1 segment to be replayed, got %d", len(replayed))
+	}
+
+	aria.Catalog.Close()
+
+	// Restoring replaces the databases with the checkpoint
+	err = os.RemoveAll(filepath.Join(aria.Config.DataDir, "databases", "db1", "users"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	restored, err := Restore(aria.Config.DataDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if restored == nil || restored.Image != second.Image {
+		t.Fatalf("expected the second checkpoint to be restored, got %+v", restored)
+	}
+
+	aria.Catalog = catalog.New(aria.Config.DataDir)
+
+	err = aria.Catalog.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db = aria.Catalog.GetDatabase("db1")
+	if db == nil || db.GetTable("users") == nil || db.GetTable("orders") == nil {
+		t.Fatal("expected the tables of the checkpoint to be restored")
+	}
+
+	if count := db.GetTable("orders").Rows.Count(); count != 1 {
+		t.Fatalf("expected the row of the checkpoint to be restored, got %d rows", count)
+	}
+}
+
+func TestCheckpointer_image(t *testing.T) {
+	defer os.RemoveAll("./test/")
+
+	aria, err := core.New(&core.Config{DataDir: "./test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer aria.WAL.Close()
+
+	c, err := New(aria)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Files written long before the checkpoint, a table written, one dropped and one created during the first copy
+	for _, name := range []string{"written", "dropped", "unchanged"} {
+		err = os.MkdirAll(filepath.Join(aria.Config.DataDir, "databases", "db1", name), 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		path := filepath.Join(aria.Config.DataDir, "databases", "db1", name, "data")
+
+		err = os.WriteFile(path, []byte("rows of "+name), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		old := time.Now().Add(-time.Hour)
+
+		err = os.Chtimes(path, old, old)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	directory := filepath.Join(aria.Config.DataDir, DIRECTORY)
+	tmp := filepath.Join(directory, "image"+IMAGE_TMP_EXTENSION)
+	started := time.Now()
+
+	precopy, err := c.image(directory, tmp, nil, started)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(precopy) != 3 {
+		t.Fatalf("expected 3 files copied, got %d", len(precopy))
+	}
+
+	err = os.WriteFile(filepath.Join(aria.Config.DataDir, "databases", "db1", "written", "data"), []byte("more rows of written"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = os.RemoveAll(filepath.Join(aria.Config.DataDir, "databases", "db1", "dropped"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = os.MkdirAll(filepath.Join(aria.Config.DataDir, "databases", "db1", "created"), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = os.WriteFile(filepath.Join(aria.Config.DataDir, "databases", "db1", "created", "data"), []byte("rows of created"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Held off writes, only the files changed since the first copy are copied again
+	files, err := c.image(directory, tmp, precopy, started)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(files) != 3 || files[filepath.Join("databases", "db1", "unchanged", "data")].copied != precopy[filepath.Join("databases", "db1", "unchanged", "data")].copied {
+		t.Fatalf("expected the unchanged file to be left as copied, got %d files", len(files))
+	}
+
+	for name, expected := range map[string]string{"written": "more rows of written", "unchanged": "rows of unchanged", "created": "rows of created"} {
+		data, err := os.ReadFile(filepath.Join(tmp, "databases", "db1", name, "data"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if string(data) != expected {
+			t.Fatalf("expected %q in the copy of %s, got %q", expected, name, data)
+		}
+	}
+
+	if _, err := os.Stat(filepath.Join(tmp, "databases", "db1", "dropped")); !os.IsNotExist(err) {
+		t.Fatal("expected the dropped table to be removed from the copy")
+	}
+}
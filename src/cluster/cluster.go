@@ -0,0 +1,790 @@
+// Package cluster
+// AriaSQL cluster package
+// Copyright (C) AriaSQL
+// Author(s): Alex Gaetano Padula
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+package cluster
+
+import (
+	"ariasql/core"
+	"ariasql/executor"
+	"ariasql/parser"
+	"ariasql/shared"
+	"bytes"
+	crand "crypto/rand"
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"github.com/hashicorp/raft"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const CLUSTER_DIRECTORY = "cluster"        // Cluster state directory within the data directory
+const LOG_FILE = "raft.log"                // Raft log file
+const STABLE_FILE = "raft.stable"          // Raft term and vote file
+const APPLIED_FILE = "applied"             // Index of the last raft log entry applied to the catalog
+const APPLY_TIMEOUT = 10 * time.Second     // How long a write waits to be committed by the cluster
+const TRANSPORT_TIMEOUT = 10 * time.Second // Cluster network timeout
+
+// Node is an AriaSQL node in cluster mode
+// The leader checks statements like a standalone instance and replicates the statements the WAL records through raft, every node
+// applies the committed entries to its own catalog in the order of the log.  On the leader the session which sent a
+// statement executes it as its entry is applied, on followers an executor per channel of origin does.  Writes on a follower
+// fail, reads on a follower are served while the follower heard from the leader within the configured staleness.
+type Node struct {
+	aria      *core.AriaSQL          // AriaSQL instance
+	config    *core.Cluster          // Cluster configuration
+	raft      *raft.Raft             // Raft instance
+	fsm       *fsm                   // State machine applying entries to the catalog
+	logs      *logStore              // Raft log and stable store
+	transport *raft.NetworkTransport // Cluster transport
+}
+
+// Entry is a replicated statement
+// The leader resolves the time and the seed of the random numbers of the statement, every node executes it with them
+// so SYS_TIMESTAMP, GENERATE_UUID and RANDOM have the same values on all of them
+type Entry struct {
+	NodeID    string      // Node the statement was executed on
+	ChannelID uint64      // Channel the statement was executed on
+	Request   uint64      // Request of the session waiting for the entry on its node
+	Time      int64       // Time of the statement, in unix nanoseconds
+	Seed      int64       // Seed of the UUIDs and random numbers of the statement
+	Stmt      interface{} // Statement, encoded with its type as registered by the WAL
+}
+
+// source returns the clock and random numbers the statement of the entry is executed with
+func (e *Entry) source() *shared.Source {
+	return shared.NewSource(time.Unix(0, e.Time), e.Seed)
+}
+
+// Open joins the AriaSQL instance to its cluster
+// The catalog must be open
+func Open(aria *core.AriaSQL) (*Node, error) {
+	config := aria.Config.Cluster
+	if config == nil || config.NodeID == "" {
+		return nil, errors.New("cluster node id is not configured")
+	}
+
+	directory := filepath.Join(aria.Config.DataDir, CLUSTER_DIRECTORY)
+
+	err := os.MkdirAll(directory, 0755)
+	if err != nil {
+		return nil, err
+	}
+
+	var logOutput io.Writer = os.Stderr
+	if aria.LogFile != nil {
+		logOutput = aria.LogFile
+	}
+
+	logs, err := openLogStore(directory)
+	if err != nil {
+		return nil, err
+	}
+
+	snapshots, err := raft.NewFileSnapshotStore(directory, 2, logOutput)
+	if err != nil {
+		logs.Close()
+		return nil, err
+	}
+
+	transport, err := raft.NewTCPTransport(config.Address, nil, 3, TRANSPORT_TIMEOUT, logOutput)
+	if err != nil {
+		logs.Close()
+		return nil, err
+	}
+
+	f, err := newFSM(aria, config.NodeID, directory)
+	if err != nil {
+		transport.Close()
+		logs.Close()
+		return nil, err
+	}
+
+	conf := raft.DefaultConfig()
+	conf.LocalID = raft.ServerID(config.NodeID)
+	conf.LogOutput = logOutput
+
+	node := &Node{
+		aria:      aria,
+		config:    config,
+		fsm:       f,
+		logs:      logs,
+		transport: transport,
+	}
+
+	if config.Bootstrap {
+		existing, err := raft.HasExistingState(logs, logs, snapshots)
+		if err != nil {
+			node.Close()
+			return nil, err
+		}
+
+		if !existing {
+			servers := []raft.Server{{ID: conf.LocalID, Address: transport.LocalAddr()}}
+
+			for _, peer := range config.Peers {
+				servers = append(servers, raft.Server{ID: raft.ServerID(peer.NodeID), Address: raft.ServerAddress(peer.Address)})
+			}
+
+			err = raft.BootstrapCluster(conf, logs, logs, snapshots, transport, raft.Configuration{Servers: servers})
+			if err != nil {
+				node.Close()
+				return nil, err
+			}
+		}
+	}
+
+	node.raft, err = raft.NewRaft(conf, f, logs, logs, snapshots, transport)
+	if err != nil {
+		node.Close()
+		return nil, err
+	}
+
+	return node, nil
+}
+
+// Replicate replicates a statement, blocking until the cluster committed it and this node applies it
+// The statement is executed by the caller with the source returned, the entries which follow are applied once done is called.
+// Entries that do not write are only replicated by the leader so followers can follow the channel
+func (n *Node) Replicate(channelID uint64, stmt interface{}, write bool) (*shared.Source, func(), error) {
+	if n.raft.State() != raft.Leader {
+		if !write {
+			return nil, func() {}, nil
+		}
+
+		leader, _ := n.raft.LeaderWithID()
+		if leader == "" {
+			return nil, nil, errors.New("cluster has no leader")
+		}
+
+		return nil, nil, fmt.Errorf("node is not the cluster leader, the leader is %s", leader)
+	}
+
+	seed := make([]byte, 8)
+
+	_, err := crand.Read(seed)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	entry := &Entry{NodeID: n.config.NodeID, ChannelID: channelID, Time: time.Now().UnixNano(), Seed: int64(binary.LittleEndian.Uint64(seed)), Stmt: stmt}
+
+	w := n.fsm.wait(entry)
+
+	buff := bytes.NewBuffer([]byte{})
+
+	err = gob.NewEncoder(buff).Encode(entry)
+	if err != nil {
+		n.fsm.cancel(w)
+		return nil, nil, err
+	}
+
+	future := n.raft.Apply(buff.Bytes(), APPLY_TIMEOUT)
+
+	// The future is only done once the entry was applied, which waits for the caller
+	failed := make(chan error, 1)
+	go func() { failed <- future.Error() }()
+
+	select {
+	case <-w.applied:
+	case err = <-failed:
+		// An entry the state machine took while the future failed is executed all the same
+		if n.fsm.cancel(w) {
+			return nil, nil, err
+		}
+
+		<-w.applied
+	}
+
+	return entry.source(), func() { close(w.done) }, nil
+}
+
+// CheckRead returns an error if the node can not serve reads
+func (n *Node) CheckRead() error {
+	if n.raft.State() == raft.Leader {
+		return nil
+	}
+
+	if n.config.MaxStaleness <= 0 {
+		return errors.New("node is not the cluster leader, reads are only served by the leader")
+	}
+
+	if time.Since(n.raft.LastContact()) > time.Duration(n.config.MaxStaleness)*time.Millisecond {
+		return errors.New("node has not heard from the cluster leader within the max staleness")
+	}
+
+	return nil
+}
+
+// Leader returns the cluster address of the current leader, empty if there is none
+func (n *Node) Leader() string {
+	leader, _ := n.raft.LeaderWithID()
+	return string(leader)
+}
+
+// IsLeader returns true if the node is the cluster leader
+func (n *Node) IsLeader() bool {
+	return n.raft.State() == raft.Leader
+}
+
+// Close leaves the cluster and closes the cluster state
+func (n *Node) Close() error {
+	if n.raft != nil {
+		err := n.raft.Shutdown().Error()
+		if err != nil {
+			return err
+		}
+	}
+
+	n.transport.Close()
+
+	return n.logs.Close()
+}
+
+// fsm applies committed entries to the catalog
+type fsm struct {
+	aria      *core.AriaSQL                 // AriaSQL instance
+	nodeID    string                        // Id of this node
+	directory string                        // Cluster state directory
+	applied   uint64                        // Index of the last entry applied
+	executors map[string]*executor.Executor // Executors per channel of origin
+	waiting   map[uint64]*waiter            // Sessions of this node waiting for their entry to be applied, by request
+	requests  uint64                        // Requests so far
+	lock      *sync.Mutex                   // Applied index lock
+	waitLock  *sync.Mutex                   // Waiting sessions lock
+}
+
+// waiter is a session of this node waiting for its entry to be applied
+type waiter struct {
+	request uint64        // Request of the entry
+	applied chan struct{} // Closed once the entry is applied, the session executes its statement
+	done    chan struct{} // Closed by the session once its statement executed
+}
+
+// wait registers a session waiting for an entry, setting the request of the entry
+func (f *fsm) wait(entry *Entry) *waiter {
+	f.waitLock.Lock()
+	defer f.waitLock.Unlock()
+
+	f.requests++
+
+	w := &waiter{request: f.requests, applied: make(chan struct{}), done: make(chan struct{})}
+	f.waiting[w.request] = w
+	entry.Request = w.request
+
+	return w
+}
+
+// cancel stops a session waiting for its entry, false if the entry is already being applied
+func (f *fsm) cancel(w *waiter) bool {
+	f.waitLock.Lock()
+	defer f.waitLock.Unlock()
+
+	if _, ok := f.waiting[w.request]; !ok {
+		return false
+	}
+
+	delete(f.waiting, w.request)
+
+	return true
+}
+
+// waiter returns the session of this node waiting for an entry, nil if none is
+func (f *fsm) waiter(entry *Entry) *waiter {
+	if entry.NodeID != f.nodeID {
+		return nil
+	}
+
+	f.waitLock.Lock()
+	defer f.waitLock.Unlock()
+
+	w := f.waiting[entry.Request]
+	delete(f.waiting, entry.Request)
+
+	return w
+}
+
+// newFSM creates the state machine, reading the index of the last applied entry
+func newFSM(aria *core.AriaSQL, nodeID string, directory string) (*fsm, error) {
+	f := &fsm{
+		aria:      aria,
+		nodeID:    nodeID,
+		directory: directory,
+		executors: make(map[string]*executor.Executor),
+		waiting:   make(map[uint64]*waiter),
+		lock:      &sync.Mutex{},
+		waitLock:  &sync.Mutex{},
+	}
+
+	d, err := os.ReadFile(filepath.Join(directory, APPLIED_FILE))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	if err == nil {
+		f.applied, err = strconv.ParseUint(strings.TrimSpace(string(d)), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid applied index %q", string(d))
+		}
+	}
+
+	return f, nil
+}
+
+// Apply applies a committed entry to the catalog
+// An entry a session of this node waits for is executed by the session while the entries which follow wait, other entries
+// by the executor of their channel.  Entries at or below the applied index are replayed by raft on start up and skipped
+func (f *fsm) Apply(l *raft.Log) interface{} {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	if l.Type != raft.LogCommand || l.Index <= f.applied {
+		return nil
+	}
+
+	entry := &Entry{}
+
+	err := gob.NewDecoder(bytes.NewReader(l.Data)).Decode(entry)
+	if err != nil {
+		return err
+	}
+
+	var applyErr error
+
+	if w := f.waiter(entry); w != nil {
+		close(w.applied)
+		<-w.done
+	} else if entry.Stmt != nil {
+		ex, err := f.executor(entry)
+		if err != nil {
+			return err
+		}
+
+		// Errors are returned to the leader, the statement failed on the leader the same way
+		ex.SetSource(entry.source())
+		applyErr = ex.Execute(entry.Stmt.(parser.Statement))
+		ex.SetSource(nil)
+		ex.Clear()
+	}
+
+	err = f.setApplied(l.Index)
+	if err != nil {
+		return err
+	}
+
+	return applyErr
+}
+
+// executor returns the executor of the channel an entry was executed on
+// Each channel of origin gets its own executor so the database in use and open transactions are kept per channel
+func (f *fsm) executor(entry *Entry) (*executor.Executor, error) {
+	key := fmt.Sprintf("%s/%d", entry.NodeID, entry.ChannelID)
+
+	if ex, ok := f.executors[key]; ok {
+		return ex, nil
+	}
+
+	user := f.aria.Catalog.GetUser("admin") // will bypass privileges as executor is set to recover
+	if user == nil {
+		return nil, errors.New("admin user not found")
+	}
+
+	ex := executor.New(f.aria, f.aria.OpenChannel(user))
+	ex.SetRecover(true)
+
+	f.executors[key] = ex
+
+	return ex, nil
+}
+
+// setApplied persists the index of the last applied entry
+func (f *fsm) setApplied(index uint64) error {
+	err := os.WriteFile(filepath.Join(f.directory, APPLIED_FILE), []byte(strconv.FormatUint(index, 10)), 0644)
+	if err != nil {
+		return err
+	}
+
+	f.applied = index
+
+	return nil
+}
+
+// Snapshot returns a snapshot of the applied index
+// The catalog itself is the state, it is not copied into snapshots
+func (f *fsm) Snapshot() (raft.FSMSnapshot, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	return &snapshot{applied: f.applied}, nil
+}
+
+// Restore restores the state machine from a snapshot
+// As snapshots do not hold the catalog a node can only be restored from a snapshot it already applied,
+// a node that fell behind the compacted log must be seeded with a copy of another node's data directory
+func (f *fsm) Restore(rc io.ReadCloser) error {
+	defer rc.Close()
+
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	var applied uint64
+
+	err := binary.Read(rc, binary.LittleEndian, &applied)
+	if err != nil {
+		return err
+	}
+
+	if applied > f.applied {
+		return fmt.Errorf("node applied up to %d, snapshot is at %d, seed the node with a copy of another node's data directory", f.applied, applied)
+	}
+
+	return nil
+}
+
+// snapshot is a snapshot of the applied index
+type snapshot struct {
+	applied uint64 // Index of the last applied entry
+}
+
+// Persist writes the snapshot
+func (s *snapshot) Persist(sink raft.SnapshotSink) error {
+	err := binary.Write(sink, binary.LittleEndian, s.applied)
+	if err != nil {
+		sink.Cancel()
+		return err
+	}
+
+	return sink.Close()
+}
+
+// Release is called when the snapshot is no longer needed
+func (s *snapshot) Release() {}
+
+// logStore is a file backed raft log and stable store
+// Log operations are appended to the log file as length prefixed records and replayed on open,
+// the file is rewritten when raft compacts the log
+type logStore struct {
+	directory string               // Cluster state directory
+	file      *os.File             // Log file
+	logs      map[uint64]*raft.Log // Logs by index
+	first     uint64               // First index, 0 if empty
+	last      uint64               // Last index, 0 if empty
+	stable    map[string][]byte    // Stable store values
+	lock      *sync.Mutex          // Store lock
+}
+
+// logRecord is an operation on the log file
+type logRecord struct {
+	Logs []*raft.Log // Logs stored
+	Min  uint64      // First index deleted
+	Max  uint64      // Last index deleted
+}
+
+// openLogStore opens the log and stable store, replaying the log file
+func openLogStore(directory string) (*logStore, error) {
+	s := &logStore{
+		directory: directory,
+		logs:      make(map[uint64]*raft.Log),
+		stable:    make(map[string][]byte),
+		lock:      &sync.Mutex{},
+	}
+
+	d, err := os.ReadFile(filepath.Join(directory, STABLE_FILE))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	if err == nil {
+		err = gob.NewDecoder(bytes.NewReader(d)).Decode(&s.stable)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	s.file, err = os.OpenFile(filepath.Join(directory, LOG_FILE), os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		var size uint32
+
+		err = binary.Read(s.file, binary.LittleEndian, &size)
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			// a record cut short by a crash was never acknowledged, drop it
+			break
+		}
+
+		data := make([]byte, size)
+
+		_, err = io.ReadFull(s.file, data)
+		if err != nil {
+			break
+		}
+
+		record := &logRecord{}
+
+		err = gob.NewDecoder(bytes.NewReader(data)).Decode(record)
+		if err != nil {
+			s.file.Close()
+			return nil, err
+		}
+
+		s.apply(record)
+	}
+
+	// truncate a partial trailing record
+	offset, err := s.file.Seek(0, io.SeekCurrent)
+	if err != nil {
+		s.file.Close()
+		return nil, err
+	}
+
+	err = s.file.Truncate(offset)
+	if err != nil {
+		s.file.Close()
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// apply applies a record to the in memory logs
+func (s *logStore) apply(record *logRecord) {
+	for _, l := range record.Logs {
+		s.logs[l.Index] = l
+
+		if s.first == 0 || l.Index < s.first {
+			s.first = l.Index
+		}
+
+		if l.Index > s.last {
+			s.last = l.Index
+		}
+	}
+
+	if record.Max > 0 {
+		for i := record.Min; i <= record.Max; i++ {
+			delete(s.logs, i)
+		}
+
+		s.first, s.last = 0, 0
+
+		for i := range s.logs {
+			if s.first == 0 || i < s.first {
+				s.first = i
+			}
+
+			if i > s.last {
+				s.last = i
+			}
+		}
+	}
+}
+
+// write appends a record to the log file
+func (s *logStore) write(record *logRecord) error {
+	buff := bytes.NewBuffer([]byte{})
+
+	err := gob.NewEncoder(buff).Encode(record)
+	if err != nil {
+		return err
+	}
+
+	data := make([]byte, 4, 4+buff.Len())
+	binary.LittleEndian.PutUint32(data, uint32(buff.Len()))
+	data = append(data, buff.Bytes()...)
+
+	_, err = s.file.Write(data)
+	if err != nil {
+		return err
+	}
+
+	return s.file.Sync()
+}
+
+// FirstIndex returns the first index written, 0 for no entries
+func (s *logStore) FirstIndex() (uint64, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.first, nil
+}
+
+// LastIndex returns the last index written, 0 for no entries
+func (s *logStore) LastIndex() (uint64, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.last, nil
+}
+
+// GetLog gets a log entry at a given index
+func (s *logStore) GetLog(index uint64, log *raft.Log) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	l, ok := s.logs[index]
+	if !ok {
+		return raft.ErrLogNotFound
+	}
+
+	*log = *l
+
+	return nil
+}
+
+// StoreLog stores a log entry
+func (s *logStore) StoreLog(log *raft.Log) error {
+	return s.StoreLogs([]*raft.Log{log})
+}
+
+// StoreLogs stores multiple log entries
+func (s *logStore) StoreLogs(logs []*raft.Log) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	record := &logRecord{Logs: logs}
+
+	err := s.write(record)
+	if err != nil {
+		return err
+	}
+
+	s.apply(record)
+
+	return nil
+}
+
+// DeleteRange deletes a range of log entries, inclusive
+// The log file is rewritten with the remaining entries
+func (s *logStore) DeleteRange(min, max uint64) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.apply(&logRecord{Min: min, Max: max})
+
+	remaining := &logRecord{}
+
+	for i := s.first; s.first > 0 && i <= s.last; i++ {
+		if l, ok := s.logs[i]; ok {
+			remaining.Logs = append(remaining.Logs, l)
+		}
+	}
+
+	tmp := filepath.Join(s.directory, LOG_FILE+".tmp")
+
+	file, err := os.OpenFile(tmp, os.O_CREATE|os.O_RDWR|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+
+	s.file.Close()
+	s.file = file
+
+	err = s.write(remaining)
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, filepath.Join(s.directory, LOG_FILE))
+}
+
+// Set sets a stable store value
+func (s *logStore) Set(key []byte, val []byte) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.stable[string(key)] = val
+
+	buff := bytes.NewBuffer([]byte{})
+
+	err := gob.NewEncoder(buff).Encode(s.stable)
+	if err != nil {
+		return err
+	}
+
+	tmp := filepath.Join(s.directory, STABLE_FILE+".tmp")
+
+	file, err := os.OpenFile(tmp, os.O_CREATE|os.O_RDWR|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+
+	_, err = file.Write(buff.Bytes())
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	err = file.Sync()
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	file.Close()
+
+	return os.Rename(tmp, filepath.Join(s.directory, STABLE_FILE))
+}
+
+// Get gets a stable store value
+func (s *logStore) Get(key []byte) ([]byte, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	val, ok := s.stable[string(key)]
+	if !ok {
+		return nil, errors.New("not found")
+	}
+
+	return val, nil
+}
+
+// SetUint64 sets a stable store value as uint64
+func (s *logStore) SetUint64(key []byte, val uint64) error {
+	data := make([]byte, 8)
+	binary.LittleEndian.PutUint64(data, val)
+
+	return s.Set(key, data)
+}
+
+// GetUint64 gets a stable store value as uint64
+func (s *logStore) GetUint64(key []byte) (uint64, error) {
+	val, err := s.Get(key)
+	if err != nil {
+		return 0, err
+	}
+
+	return binary.LittleEndian.Uint64(val), nil
+}
+
+// Close closes the log file
+func (s *logStore) Close() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.file.Close()
+}
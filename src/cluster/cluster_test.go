@@ -0,0 +1,329 @@
+// Package cluster tests
+// Copyright (C) AriaSQL
+// Author(s): Alex Gaetano Padula
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+package cluster
+
+import (
+	"ariasql/catalog"
+	"ariasql/core"
+	"ariasql/executor"
+	"ariasql/parser"
+	"fmt"
+	"github.com/hashicorp/raft"
+	"maps"
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+// startNode starts a cluster node with its own data directory
+func startNode(t *testing.T, i int, peers []*core.Peer) (*core.AriaSQL, *Node) {
+	dataDir := fmt.Sprintf("./test%d", i)
+
+	aria, err := core.New(&core.Config{DataDir: dataDir})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	aria.Config.Cluster = &core.Cluster{
+		NodeID:       peers[i].NodeID,
+		Address:      peers[i].Address,
+		Bootstrap:    true,
+		MaxStaleness: 5000,
+	}
+
+	for j, peer := range peers {
+		if j != i {
+			aria.Config.Cluster.Peers = append(aria.Config.Cluster.Peers, peer)
+		}
+	}
+
+	aria.Catalog = catalog.New(dataDir)
+
+	err = aria.Catalog.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	aria.Channels = make([]*core.Channel, 0)
+	aria.ChannelsLock = &sync.Mutex{}
+
+	node, err := Open(aria)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	aria.Replicator = node
+
+	return aria, node
+}
+
+// execute parses and executes a statement
+func execute(ex *executor.Executor, stmt string) error {
+	p := parser.NewParser(parser.NewLexer([]byte(stmt)))
+
+	ast, err := p.Parse()
+	if err != nil {
+		return err
+	}
+
+	return ex.Execute(ast)
+}
+
+func TestNode_Replicate(t *testing.T) {
+	peers := []*core.Peer{
+		{NodeID: "node0", Address: "127.0.0.1:37950"},
+		{NodeID: "node1", Address: "127.0.0.1:37951"},
+		{NodeID: "node2", Address: "127.0.0.1:37952"},
+	}
+
+	arias := make([]*core.AriaSQL, 0)
+	nodes := make([]*Node, 0)
+
+	for i := range peers {
+		defer os.RemoveAll(fmt.Sprintf("./test%d", i))
+
+		aria, node := startNode(t, i, peers)
+		arias = append(arias, aria)
+		nodes = append(nodes, node)
+	}
+
+	defer func() {
+		for i := range nodes {
+			nodes[i].Close()
+			arias[i].Close()
+		}
+	}()
+
+	leader := -1
+
+	for deadline := time.Now().Add(10 * time.Second); leader == -1 && time.Now().Before(deadline); {
+		for i, node := range nodes {
+			if node.IsLeader() {
+				leader = i
+			}
+		}
+
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	if leader == -1 {
+		t.Fatal("no leader elected")
+	}
+
+	follower := (leader + 1) % len(nodes)
+
+	ex := executor.New(arias[leader], arias[leader].OpenChannel(arias[leader].Catalog.GetUser("admin")))
+
+	for _, stmt := range []string{
+		"CREATE DATABASE test;",
+		"USE test;",
+		"CREATE TABLE users (user_id INT SEQUENCE NOT NULL UNIQUE, name CHAR(255), uid UUID DEFAULT GENERATE_UUID, token UUID, created TIMESTAMP DEFAULT SYS_TIMESTAMP);",
+		"INSERT INTO users (name) VALUES ('alex');",
+	} {
+		err := execute(ex, stmt)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Sessions writing at once on the leader take sequence values in the order of the log on every node
+	wg := &sync.WaitGroup{}
+	errs := make(chan error, 2)
+
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			sex := executor.New(arias[leader], arias[leader].OpenChannel(arias[leader].Catalog.GetUser("admin")))
+
+			err := execute(sex, "USE test;")
+			if err != nil {
+				errs <- err
+				return
+			}
+
+			for j := 0; j < 5; j++ {
+				err = execute(sex, fmt.Sprintf("INSERT INTO users (name) VALUES ('session%d-%d');", i, j))
+				if err != nil {
+					errs <- err
+					return
+				}
+			}
+		}()
+	}
+
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Fatal(err)
+	}
+
+	err := execute(ex, "UPDATE users SET token = GENERATE_UUID WHERE user_id > 5;")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Followers apply the entries committed by the leader, generating the same values
+	expected := tableRows(t, arias[leader])
+
+	if len(expected) != 11 {
+		t.Fatalf("expected 11 rows on leader, got %d", len(expected))
+	}
+
+	var rows map[int]string
+
+	for deadline := time.Now().Add(10 * time.Second); !maps.Equal(rows, expected) && time.Now().Before(deadline); {
+		rows = tableRows(t, arias[follower])
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	for id, row := range expected {
+		if rows[id] != row {
+			t.Fatalf("expected row %d to be %s on follower, got %s", id, row, rows[id])
+		}
+	}
+
+	// Writes on a follower fail, reads are served
+	fex := executor.New(arias[follower], arias[follower].OpenChannel(arias[follower].Catalog.GetUser("admin")))
+
+	err = execute(fex, "USE test;")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = execute(fex, "INSERT INTO users (name) VALUES ('jane');")
+	if err == nil {
+		t.Fatal("expected error writing on a follower")
+	}
+
+	err = execute(fex, "SELECT * FROM users;")
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// tableRows returns the rows of test.users by user id, formatted, once all rows are applied
+func tableRows(t *testing.T, aria *core.AriaSQL) map[int]string {
+	rows := make(map[int]string)
+
+	db := aria.Catalog.GetDatabase("test")
+	if db == nil {
+		return rows
+	}
+
+	tbl := db.GetTable("users")
+	if tbl == nil {
+		return rows
+	}
+
+	iter := tbl.NewIterator()
+
+	for iter.Valid() {
+		row, err := iter.Next()
+		if err != nil {
+			break
+		}
+
+		if row != nil {
+			rows[row["user_id"].(int)] = fmt.Sprintf("%v %v %v %v", row["name"], row["uid"], row["token"], row["created"])
+		}
+	}
+
+	return rows
+}
+
+func TestLogStore(t *testing.T) {
+	defer os.RemoveAll("./test")
+
+	err := os.MkdirAll("./test", 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := openLogStore("./test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := uint64(1); i <= 10; i++ {
+		err = s.StoreLog(&raft.Log{Index: i, Term: 1, Data: []byte(fmt.Sprintf("entry%d", i))})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err = s.DeleteRange(1, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = s.SetUint64([]byte("term"), 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s.Close()
+
+	// Logs and stable values survive reopening
+	s, err = openLogStore("./test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer s.Close()
+
+	first, _ := s.FirstIndex()
+	last, _ := s.LastIndex()
+
+	if first != 5 || last != 10 {
+		t.Fatalf("expected indexes 5 to 10, got %d to %d", first, last)
+	}
+
+	l := &raft.Log{}
+
+	err = s.GetLog(7, l)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(l.Data) != "entry7" {
+		t.Fatalf("expected entry7, got %s", l.Data)
+	}
+
+	err = s.GetLog(2, l)
+	if err != raft.ErrLogNotFound {
+		t.Fatalf("expected ErrLogNotFound, got %v", err)
+	}
+
+	term, err := s.GetUint64([]byte("term"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if term != 3 {
+		t.Fatalf("expected term 3, got %d", term)
+	}
+
+	_, err = s.Get([]byte("missing"))
+	if err == nil {
+		t.Fatal("expected error for missing key")
+	}
+}
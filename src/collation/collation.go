@@ -0,0 +1,65 @@
+// Package collation
+// AriaSQL collation package
+// Copyright (C) AriaSQL
+// Author(s): Alex Gaetano Padula
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+package collation
+
+import (
+	"fmt"
+	"golang.org/x/text/collate"
+	"golang.org/x/text/language"
+	"strings"
+)
+
+const BINARY = "binary" // Compares the bytes of strings
+const NOCASE = "nocase" // Compares strings ignoring case
+
+// Collation compares strings in the order of a collation
+type Collation struct {
+	Name     string            // Name of the collation
+	collator *collate.Collator // Collator of a locale, nil for BINARY and NOCASE
+}
+
+// Lookup returns the collation named name, BINARY, NOCASE or a BCP 47 locale such as de, sv or en-u-kn-true
+// Locales take the Unicode extensions of collations, -u-kn-true orders digits by their numeric value and -u-ks-level2 ignores case
+func Lookup(name string) (*Collation, error) {
+	switch strings.ToLower(name) {
+	case BINARY:
+		return &Collation{Name: BINARY}, nil
+	case NOCASE:
+		return &Collation{Name: NOCASE}, nil
+	}
+
+	tag, err := language.Parse(name)
+	if err != nil {
+		return nil, fmt.Errorf("unknown collation %s", name)
+	}
+
+	return &Collation{Name: name, collator: collate.New(tag)}, nil
+}
+
+// Compare returns -1, 0 or 1 if a is before, equal to or after b
+// A collation of a locale is not safe for concurrent use
+func (c *Collation) Compare(a, b string) int {
+	switch {
+	case c.collator != nil:
+		return c.collator.CompareString(a, b)
+	case c.Name == NOCASE:
+		return strings.Compare(strings.ToLower(a), strings.ToLower(b))
+	}
+
+	return strings.Compare(a, b)
+}
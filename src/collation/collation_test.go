@@ -0,0 +1,63 @@
+// Package collation tests
+// Copyright (C) AriaSQL
+// Author(s): Alex Gaetano Padula
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+package collation
+
+import (
+	"testing"
+)
+
+func TestLookup(t *testing.T) {
+	if _, err := Lookup("not a locale"); err == nil {
+		t.Fatal("expected error")
+	}
+
+	for _, name := range []string{"BINARY", "nocase", "de", "en-u-kn-true", "en-u-ks-level2"} {
+		if _, err := Lookup(name); err != nil {
+			t.Fatalf("expected collation %s, got %s", name, err.Error())
+		}
+	}
+}
+
+func TestCollation_Compare(t *testing.T) {
+	tests := []struct {
+		collation string
+		a, b      string
+		expect    int
+	}{
+		{"binary", "B", "a", -1},
+		{"binary", "a", "A", 1},
+		{"nocase", "a", "A", 0},
+		{"nocase", "B", "a", 1},
+		{"en", "B", "a", 1},
+		{"en", "item10", "item9", -1},
+		{"en-u-kn-true", "item10", "item9", 1},
+		{"en-u-ks-level2", "Apple", "apple", 0},
+		{"sv", "ö", "z", 1},
+		{"de", "ö", "z", -1},
+	}
+
+	for _, test := range tests {
+		c, err := Lookup(test.collation)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got := c.Compare(test.a, test.b); got != test.expect {
+			t.Fatalf("%s: expected %s compared to %s to be %d, got %d", test.collation, test.a, test.b, test.expect, got)
+		}
+	}
+}
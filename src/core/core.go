@@ -20,7 +20,10 @@ package core
 import (
 	"ariasql/catalog"
 	"ariasql/parser"
+	"ariasql/plancache"
 	"ariasql/shared"
+	"ariasql/statements"
+	"ariasql/wait"
 	"ariasql/wal"
 	"encoding/gob"
 	"errors"
@@ -29,32 +32,521 @@ import (
 	"log"
 	"net"
 	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
 )
 
 // AriaSQL is the core of the database system
 type AriaSQL struct {
-	Config       *Config          // DataDir is the directory where the data is stored
-	Catalog      *catalog.Catalog // Catalog is the root of the database catalog
-	Channels     []*Channel       // Channel to the database, could be through shell or network
-	ChannelsLock *sync.Mutex      // Channels lock
-	WAL          *wal.WAL         // Write ahead log
-	LogFile      *os.File         // Log file
+	Config       *Config                // DataDir is the directory where the data is stored
+	Catalog      *catalog.Catalog       // Catalog is the root of the database catalog
+	Channels     []*Channel             // Channel to the database, could be through shell or network
+	ChannelsLock *sync.Mutex            // Channels lock
+	WAL          *wal.WAL               // Write ahead log
+	LogFile      *os.File               // Log file
+	Replicator   Replicator             // Replicates WAL entries in cluster mode, nil when standalone
+	ChangeLog    ChangeLog              // Records row changes in edge sync mode, nil when not syncing
+	Coordinator  Coordinator            // Routes queries to shards in coordinator mode, nil when not coordinating
+	Notifier     Notifier               // Notifies webhooks of row changes, nil when no webhooks are configured
+	Statements   *statements.Statements // Executions aggregated by statement digest, surfaced through sys.statement_stats
+	Plans        *plancache.Cache       // Plans of the statements of every session, surfaced through SHOW PLAN CACHE
+	Firewall     Firewall               // Checks statements against the configured rules before they are executed, nil when no rules are configured
+	Purger       Purger                 // Purges logs past their retention, surfaced through sys.retention, nil when no retention is configured
+	Checkpointer Checkpointer           // Takes checkpoints on CHECKPOINT and when configured, nil when checkpoints are not taken
+	CommitLock   sync.Mutex             // Held by a serializable transaction from validating its reads until its writes are applied
+	WriteGate    sync.RWMutex           // Held shared by a statement writing while it runs, exclusively by a checkpoint
+	readOnly     atomic.Pointer[ReadOnly]
+	readOnlies   atomic.Int64
+	writes       sync.Map      // Sequence of the last write to every table, by database.table
+	writeSeq     atomic.Uint64 // Writes to tables so far
+}
+
+// ReadOnly is why the server turned read-only and since when
+type ReadOnly struct {
+	Reason string    // Why writes are refused
+	Since  time.Time // When the server turned read-only
+}
+
+// ErrReadOnly is returned by writes while the server is read-only
+var ErrReadOnly = errors.New("server is read-only")
+
+// SetReadOnly turns the server read-only, writes fail until SetReadWrite, false if it already was
+func (ariasql *AriaSQL) SetReadOnly(reason string) bool {
+	if !ariasql.readOnly.CompareAndSwap(nil, &ReadOnly{Reason: reason, Since: time.Now()}) {
+		return false
+	}
+
+	ariasql.readOnlies.Add(1)
+	log.Printf("server is read-only: %s", reason)
+
+	return true
+}
+
+// SetReadWrite accepts writes again, false if the server was not read-only
+func (ariasql *AriaSQL) SetReadWrite() bool {
+	return ariasql.readOnly.Swap(nil) != nil
+}
+
+// ReadOnly returns why and since when the server is read-only, nil while it accepts writes
+func (ariasql *AriaSQL) ReadOnly() *ReadOnly {
+	return ariasql.readOnly.Load()
+}
+
+// ReadOnlies returns how many times the server turned read-only since it started
+func (ariasql *AriaSQL) ReadOnlies() int64 {
+	return ariasql.readOnlies.Load()
+}
+
+// CheckWrite returns an error while the server is read-only
+func (ariasql *AriaSQL) CheckWrite() error {
+	readOnly := ariasql.readOnly.Load()
+	if readOnly == nil {
+		return nil
+	}
+
+	return fmt.Errorf("%w, %s", ErrReadOnly, readOnly.Reason)
+}
+
+// DiskFull turns the server read-only if err is a write failing as the disk is full, true if it is
+// Writes which follow would fail part way and could leave files half written
+func (ariasql *AriaSQL) DiskFull(err error) bool {
+	if !errors.Is(err, syscall.ENOSPC) {
+		return false
+	}
+
+	ariasql.SetReadOnly("the disk of the data directory is full")
+
+	return true
+}
+
+const ISOLATION_READ_COMMITTED = "READ COMMITTED"   // Statements read the rows committed when they run
+const ISOLATION_REPEATABLE_READ = "REPEATABLE READ" // Transactions read the rows committed when they began, see ErrSerialization
+const ISOLATION_SERIALIZABLE = "SERIALIZABLE"       // Transactions behave as if run one after another, see ErrSerialization
+
+// ErrSerialization is returned by a repeatable read or serializable transaction reading a table written since it began,
+// or committing an update or delete of such a table.  A serializable transaction also fails to commit if a table it read
+// was written since it began.  The transaction is rolled back and can be retried.
+var ErrSerialization = errors.New("could not serialize access due to a concurrent write")
+
+// Written records a write to a table, repeatable read and serializable transactions which read it fail
+func (ariasql *AriaSQL) Written(database, table string) {
+	ariasql.writes.Store(database+"."+table, ariasql.writeSeq.Add(1))
+}
+
+// WriteSequence returns the sequence of the last write to any table, a transaction begins at it
+func (ariasql *AriaSQL) WriteSequence() uint64 {
+	return ariasql.writeSeq.Load()
+}
+
+// WrittenSince returns true if a table was written after the write sequence seq
+func (ariasql *AriaSQL) WrittenSince(database, table string, seq uint64) bool {
+	written, ok := ariasql.writes.Load(database + "." + table)
+
+	return ok && written.(uint64) > seq
+}
+
+// Replicator replicates statements the WAL records to the other nodes of a cluster, see package cluster
+// Replicate returns once the cluster applies the statement, with the source it is executed with on every node.
+// The statements which follow are applied once done is called, writes fail on a node that is not the leader
+type Replicator interface {
+	Replicate(channelID uint64, stmt interface{}, write bool) (source *shared.Source, done func(), err error) // Replicates a statement
+	CheckRead() error                                                                                         // Returns an error if the node can not serve reads
+}
+
+// Firewall blocks, rewrites or logs statements matching rules before they are executed, see package firewall
+type Firewall interface {
+	Check(channel *Channel, query []byte, stmt interface{}) error // Returns an error if the statement is blocked, rewrites it in place otherwise
+}
+
+// ChangeLog records row changes to sync between edge nodes and their hub, see package edge
+type ChangeLog interface {
+	RecordChange(database string, table string, deleted bool, row map[string]interface{}) error // Records an inserted, updated or deleted row
+}
+
+// Checkpointer takes checkpoints of the data directory, see package checkpoint
+type Checkpointer interface {
+	Checkpoint() (*CheckpointRecord, error) // Takes a checkpoint, writes wait until it is taken
+	Last() *CheckpointRecord                // Returns the last checkpoint taken, nil if none was
+}
+
+// CheckpointRecord is a checkpoint of the data directory, a copy of its databases and users holding every WAL entry up to LSN
+type CheckpointRecord struct {
+	LSN          int64         // WAL entries written since the data directory was created, all within the checkpoint
+	Created      time.Time     // When writes were held off, every write before is within the copy
+	Image        string        // Directory of the copy within the checkpoint directory
+	WALRotatedAt time.Time     // WAL segments rotated up to then are within the checkpoint, they are removed once it is taken
+	Files        int           // Files within the copy
+	Copied       int64         // Bytes copied, files not written since the previous checkpoint are linked to it instead
+	Duration     time.Duration // How long writes were held off
+}
+
+// Purger purges the WAL, change log and audit log past their retention, see package retention
+type Purger interface {
+	Usage() ([]LogUsage, error) // Returns the space taken by every log retained and how much of it a purge would reclaim
+}
+
+// LogUsage is the space taken by a log retained and how much of it a purge would reclaim
+type LogUsage struct {
+	Log         string    // wal, changelog or auditlog
+	Files       int       // Files of the log, the file written to and those rotated out of it
+	Bytes       int64     // Bytes of the files of the log
+	Reclaimable int64     // Bytes past the retention of the log, removed by the next purge
+	Purged      int64     // Bytes removed since the server started
+	LastPurge   time.Time // When the log was last purged, zero if it never was
+}
+
+// Coordinator routes queries received by the server to the shards of the catalog shard map, see package shard
+type Coordinator interface {
+	Execute(channel *Channel, query []byte, stmt interface{}, json bool) ([]byte, error) // Executes a parsed query on the shards and returns the formatted result set, nil if there is none
+	CloseChannel(channel *Channel)                                                       // Closes the shard connections of a channel
+}
+
+// Notifier notifies webhooks of row changes, see package webhook
+type Notifier interface {
+	Notify(database string, table string, operation string, rows []map[string]interface{}) // Notifies of inserted, updated or deleted rows, operation is INSERT, UPDATE or DELETE
 }
 
 // Channel is a connection to the database
 type Channel struct {
-	ChannelID uint64
-	Database  *catalog.Database // Current database, this would be a result of using the USE command
-	User      *catalog.User     // Current user, this would be a result of using the USE command
+	ChannelID       uint64
+	Database        *catalog.Database  // Current database, this would be a result of using the USE command
+	User            *catalog.User      // Current user, this would be a result of using the USE command
+	Listening       map[string]bool    // Notification channels listened on with LISTEN, guarded by ChannelsLock
+	Notifications   chan *Notification // Notifications received on listened channels, written to the connection by the server
+	Waits           *wait.Session      // What the channel waits on, surfaced through sys.session_waits
+	Address         string             // Address of the client, reported by the proxy when connected through one, empty if not connected over the network
+	ApplicationName string             // Name of the application, sent by the client when connecting
+	ClientVersion   string             // Version of the client, sent by the client when connecting
+	Labels          map[string]string  // Labels attributing the session, such as a team or service, sent by the client when connecting
+	Trace           []string           // Debug output logged for the statements of the session, set with SET trace
+	Isolation       string             // Isolation level of the transactions the session begins, empty is ISOLATION_READ_COMMITTED
+	OptimizerTrace  bool               // Trace the plans considered for the statements of the session, set with SET optimizer_trace
+	query           atomic.Pointer[Query]
+}
+
+const TRACE_STATEMENT = "statement" // Log every statement of the session with the rows it returned or changed and its time
+const TRACE_PLAN = "plan"           // Log the operators every statement of the session ran with their time
+const TRACE_IO = "io"               // Log the storage IO of every statement of the session
+
+// ErrQueryCancelled is returned by a query cancelled while it runs
+var ErrQueryCancelled = errors.New("query cancelled")
+
+// Query is a statement a channel is executing, the resource watchdog reads and cancels it
+type Query struct {
+	Text    string                 // Normalized statement
+	Started time.Time              // When the statement started executing
+	bytes   atomic.Int64           // Bytes of rows read
+	reason  atomic.Pointer[string] // Why the query was cancelled, nil while it runs
+}
+
+// Read counts n bytes of rows read by the query and returns the bytes read so far
+func (q *Query) Read(n int64) int64 {
+	return q.bytes.Add(n)
+}
+
+// Bytes returns the bytes of rows read by the query
+func (q *Query) Bytes() int64 {
+	return q.bytes.Load()
+}
+
+// Cancel cancels the query, it fails the next time it reads a row
+func (q *Query) Cancel(reason string) {
+	q.reason.CompareAndSwap(nil, &reason)
+}
+
+// Err returns an error once the query is cancelled
+func (q *Query) Err() error {
+	reason := q.reason.Load()
+	if reason == nil {
+		return nil
+	}
+
+	return fmt.Errorf("%w: %s", ErrQueryCancelled, *reason)
+}
+
+// BeginQuery sets the statement the channel is executing
+func (ch *Channel) BeginQuery(text string) *Query {
+	query := &Query{Text: text, Started: time.Now()}
+	ch.query.Store(query)
+
+	return query
+}
+
+// EndQuery clears the statement the channel was executing
+func (ch *Channel) EndQuery() {
+	ch.query.Store(nil)
+}
+
+// Query returns the statement the channel is executing, nil if it is not executing one
+func (ch *Channel) Query() *Query {
+	return ch.query.Load()
+}
+
+// Client returns the user of the channel with the address and client info of the connection, for logs
+// i.e alex@198.51.100.23:40022 (billing 2.1.0 team=payments)
+func (ch *Channel) Client() string {
+	client := ch.User.Username
+	if ch.Address != "" {
+		client += "@" + ch.Address
+	}
+
+	if info := ch.ClientInfo(); info != "" {
+		client += " (" + info + ")"
+	}
+
+	return client
+}
+
+// ClientInfo returns the application, client version and labels of the channel, empty if the client sent none
+// i.e billing 2.1.0 region=eu,team=payments
+func (ch *Channel) ClientInfo() string {
+	info := make([]string, 0, 3)
+
+	if ch.ApplicationName != "" {
+		info = append(info, ch.ApplicationName)
+	}
+
+	if ch.ClientVersion != "" {
+		info = append(info, ch.ClientVersion)
+	}
+
+	if len(ch.Labels) > 0 {
+		info = append(info, ch.LabelString())
+	}
+
+	return strings.Join(info, " ")
+}
+
+// LabelString returns the labels of the channel as key=value pairs sorted by key, separated by commas
+func (ch *Channel) LabelString() string {
+	labels := make([]string, 0, len(ch.Labels))
+	for key, value := range ch.Labels {
+		labels = append(labels, key+"="+value)
+	}
+
+	sort.Strings(labels)
+
+	return strings.Join(labels, ",")
+}
+
+// SetTrace sets the debug output logged for the statements of the channel from a comma separated list of
+// TRACE_STATEMENT, TRACE_PLAN and TRACE_IO, empty or off to log none
+// i.e plan,io
+func (ch *Channel) SetTrace(options string) error {
+	trace := make([]string, 0)
+
+	for _, option := range strings.Split(strings.ToLower(options), ",") {
+		option = strings.TrimSpace(option)
+
+		switch option {
+		case "", "off":
+		case TRACE_STATEMENT, TRACE_PLAN, TRACE_IO:
+			if !slices.Contains(trace, option) {
+				trace = append(trace, option)
+			}
+		default:
+			return fmt.Errorf("unknown trace option %s, expected %s, %s or %s", option, TRACE_STATEMENT, TRACE_PLAN, TRACE_IO)
+		}
+	}
+
+	ch.Trace = trace
+
+	return nil
+}
+
+// SetOptimizerTrace turns tracing the plans considered for the statements of the channel on or off
+func (ch *Channel) SetOptimizerTrace(value string) error {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "on":
+		ch.OptimizerTrace = true
+	case "off":
+		ch.OptimizerTrace = false
+	default:
+		return fmt.Errorf("invalid optimizer_trace %s, expected ON or OFF", value)
+	}
+
+	return nil
+}
+
+// SetIsolation sets the isolation level of the transactions the channel begins
+func (ch *Channel) SetIsolation(level string) error {
+	level, err := Isolation(level)
+	if err != nil {
+		return err
+	}
+
+	ch.Isolation = level
+
+	return nil
 }
 
+// Isolation returns the isolation level named level, ISOLATION_READ_COMMITTED, ISOLATION_REPEATABLE_READ or ISOLATION_SERIALIZABLE
+func Isolation(level string) (string, error) {
+	level = strings.Join(strings.Fields(strings.ToUpper(level)), " ")
+
+	switch level {
+	case ISOLATION_READ_COMMITTED, ISOLATION_REPEATABLE_READ, ISOLATION_SERIALIZABLE:
+		return level, nil
+	}
+
+	return "", fmt.Errorf("unknown isolation level %s, expected %s, %s or %s", level, ISOLATION_READ_COMMITTED, ISOLATION_REPEATABLE_READ, ISOLATION_SERIALIZABLE)
+}
+
+// Tracing returns true if the channel logs the debug output of option
+func (ch *Channel) Tracing(option string) bool {
+	return slices.Contains(ch.Trace, option)
+}
+
+// Notification is a message sent with NOTIFY to the channels listening on its notification channel
+type Notification struct {
+	Channel string // Notification channel
+	Payload string // Payload, can be empty
+	Sender  uint64 // Channel id of the notifying channel
+}
+
+const NOTIFICATION_QUEUE_SIZE = 1024  // Notifications queued per channel, notifications are dropped when the queue is full
+const MAX_NOTIFICATION_PAYLOAD = 8000 // Maximum payload size in bytes
+
 // Config is the configuration for AriaSQL
 type Config struct {
 	// The path to the data directory
-	DataDir  string     // Data directory
-	Logging  bool       // Enable logging
-	Replicas []*Replica // Every wal write will be sent to these replicas
+	DataDir            string      // Data directory
+	Logging            bool        // Enable logging
+	Replicas           []*Replica  // Every wal write will be sent to these replicas
+	MaxOpenTables      int         // Max amount of tables with open files, 0 is no limit
+	MaxOpenFiles       int         // Global budget of open file descriptors, 0 uses the storage default
+	AutoUpgrade        bool        // Migrate an older data directory layout on start up
+	Cluster            *Cluster    // Cluster mode, nil when standalone
+	Edge               *Edge       // Edge sync mode, nil when not syncing
+	Sharding           *Sharding   // Coordinator mode, nil when not coordinating
+	Webhooks           []*Webhook  // HTTP endpoints notified of row changes
+	Tracing            *Tracing    // OpenTelemetry span export, nil when not tracing
+	MaxStatements      int         // Statements kept in sys.statement_stats, 0 uses the default
+	MaxPlans           int         // Plans kept in the plan cache, 0 uses the default
+	Rules              []*Rule     // Statements blocked, rewritten or logged before they are executed, in order
+	FlashbackRetention int         // Seconds changed rows are kept for SELECT ... AS OF TIMESTAMP, 0 disables flashback
+	MaxRecursion       int         // Iterations the recursive query of a WITH RECURSIVE statement can run, 0 uses the default
+	MaxReoptimizations int         // Joins a select re-optimizes once an input is far larger than estimated, 0 uses the default, below 0 disables re-optimization
+	SubqueryCacheRows  int         // Rows of subquery results a statement memoizes by correlation key, 0 uses the default, below 0 disables memoization
+	MinFreeSpace       int64       // Free bytes on the disk of the data directory below which the server turns read-only, 0 only on a write failing as the disk is full
+	Watchdog           *Watchdog   // Cancels queries before the server runs out of memory, nil when not watching
+	Tiering            *Tiering    // Cold tier tables are moved to, nil when there is none
+	Retention          *Retention  // How long and how large logs are kept, nil keeps them all
+	Checkpoint         *Checkpoint // When checkpoints are taken besides CHECKPOINT, nil to only take them on CHECKPOINT
+}
+
+// Checkpoint is the configuration of checkpoints, taken once either trigger fires
+// A checkpoint copies the databases and users of the data directory, writes waiting until it is done, and truncates the WAL
+// up to it.  -recover restores the last checkpoint and replays the WAL written since.
+type Checkpoint struct {
+	Interval    int   // Seconds between checkpoints, 0 to not take them by time
+	MaxWALBytes int64 // Bytes the WAL file grows to before a checkpoint is taken, 0 to not take them by size
+}
+
+// Retention is the configuration of how long and how large the logs of the server are kept
+// The WAL and the audit log are rotated out of the file written to on every purge, the rotated files past the
+// retention are removed.  The change log of an edge hub is trimmed in place, an edge node that did not sync for
+// longer than its retention misses the changes purged.
+type Retention struct {
+	WAL       *LogRetention // Rotated WAL segments, -recover only replays the segments kept, nil keeps them all
+	ChangeLog *LogRetention // Changes accepted by an edge hub, nil keeps them all
+	AuditLog  *LogRetention // Rotations of aria.log, nil keeps them all
+	Interval  int           // Seconds between purges, 0 uses the default
+}
+
+// LogRetention is how long and how large a log is kept, whichever removes more
+type LogRetention struct {
+	MaxAge   int   // Seconds an entry is kept, 0 for no limit
+	MaxBytes int64 // Bytes kept, the oldest entries are removed first, 0 for no limit
+}
+
+// Tiering is the configuration of the cold tier, a secondary data directory on a cheaper and slower disk
+// Tables on the cold tier stay queryable, their files are read from the cold directory.  Tables are moved
+// between tiers with MOVE TABLE, or to the cold tier once they were not accessed for ColdAfter.
+type Tiering struct {
+	ColdDir   string // Directory of the cold tier
+	ColdAfter int    // Seconds a table is not accessed before it is moved to the cold tier, 0 to only move tables with MOVE TABLE
+	Interval  int    // Seconds between checks for tables not accessed, 0 uses the default
+}
+
+// Watchdog is the configuration of the resource watchdog
+// Intermediate results are held in memory, a query reading a large table can take the whole server down with it.
+// The watchdog samples the resident memory of the process and cancels running queries while it is over the limit.
+type Watchdog struct {
+	MaxMemory     int64  // Resident memory of the process in bytes above which queries are cancelled, 0 to not watch memory
+	MaxQueryBytes int64  // Bytes of rows a single query can read before it is cancelled, 0 for no limit
+	Policy        string // Queries cancelled while over MaxMemory, LARGEST, NEWEST or ALL, empty is LARGEST
+	Interval      int    // Milliseconds between samples, 0 uses the default
+}
+
+// Rule matches statements sent by clients and blocks, rewrites or logs them
+// Every condition set must match, a rule without conditions matches every statement
+type Rule struct {
+	Name      string // Name of the rule, logged and returned when it triggers
+	Statement string // Statement to match, for example DELETE or DROP TABLE, empty for every statement
+	Database  string // Database to match, empty for every database
+	Table     string // Table to match, empty for every table
+	User      string // User to match, empty for every user
+	NoWhere   bool   // Only match SELECT, UPDATE and DELETE statements without a WHERE clause
+	Pattern   string // Regular expression matched against the normalized statement, empty to not match on the text
+	Action    string // BLOCK rejects the statement, LIMIT adds a LIMIT to a SELECT, LOG only logs it
+	Limit     int    // Rows a SELECT is limited to by the LIMIT action
+	Message   string // Returned to the client when the statement is blocked
+}
+
+// Tracing is the configuration of the export of OpenTelemetry spans to an OTLP collector
+type Tracing struct {
+	Endpoint    string            // OTLP HTTP traces endpoint, for example http://localhost:4318/v1/traces
+	Headers     map[string]string // Headers sent with every export, for example an API key
+	ServiceName string            // Service name spans are exported under, empty uses ariasql
+	SampleRatio float64           // Share of queries traced when the application did not sample them, 0 traces every query
+}
+
+// Webhook is an HTTP endpoint the changed rows of a table are posted to as JSON
+type Webhook struct {
+	URL        string   // Endpoint to post to, http or https
+	Secret     string   // Key the payload is signed with using HMAC-SHA256, empty to not sign
+	Database   string   // Database to notify on, empty for every database
+	Table      string   // Table to notify on, empty for every table
+	Operations []string // Operations to notify on, INSERT, UPDATE and DELETE, empty for every operation
+	Retries    int      // Delivery attempts after a failed one
+	Timeout    int      // Request timeout in milliseconds, 0 uses the default
+}
+
+// Sharding is the configuration of a coordinator, the user must exist on every shard with the privileges clients are granted on the coordinator
+type Sharding struct {
+	Username string // User to connect to the shards with
+	Password string // Password of the user
+}
+
+// Edge is the configuration of a node in edge sync mode
+// A node with a hub address is an edge node, a node with a listen address is a hub, a node can be both
+type Edge struct {
+	NodeID   string // Unique id of this node
+	Hub      string // Address of the hub to sync with, host:port
+	Listen   string // Address to accept edge nodes on when this node is a hub, host:port
+	Interval int    // How often in milliseconds an edge node syncs with its hub, 0 uses the default
+}
+
+// Cluster is the configuration of a node in cluster mode
+type Cluster struct {
+	NodeID       string  // Unique id of this node within the cluster
+	Address      string  // Address the node listens on for cluster traffic, host:port
+	Peers        []*Peer // The other nodes of the cluster
+	Bootstrap    bool    // Form a new cluster from this node and its peers if there is no cluster state yet
+	MaxStaleness int     // How long in milliseconds a follower may go without hearing from the leader and still serve reads, 0 only serves reads on the leader
+}
+
+// Peer is another node of the cluster
+type Peer struct {
+	NodeID  string // Unique id of the node
+	Address string // Cluster address of the node, host:port
 }
 
 // Replica is a replica server
@@ -85,8 +577,8 @@ func New(config *Config) (*AriaSQL, error) {
 	}
 
 	// create ariaconf.yaml
-	if _, err := os.Stat(fmt.Sprintf("%s%sariaconf.yaml", config.DataDir, shared.GetOsPathSeparator())); os.IsNotExist(err) {
-		confFile, err := os.Create(fmt.Sprintf("%s%sariaconf.yaml", config.DataDir, shared.GetOsPathSeparator()))
+	if _, err := os.Stat(filepath.Join(config.DataDir, "ariaconf.yaml")); os.IsNotExist(err) {
+		confFile, err := os.Create(filepath.Join(config.DataDir, "ariaconf.yaml"))
 		if err != nil {
 			return nil, err
 		}
@@ -106,7 +598,7 @@ func New(config *Config) (*AriaSQL, error) {
 
 	} else {
 		// read configuration from file
-		confFile, err := os.Open(fmt.Sprintf("%s%sariaconf.yaml", config.DataDir, shared.GetOsPathSeparator()))
+		confFile, err := os.Open(filepath.Join(config.DataDir, "ariaconf.yaml"))
 		if err != nil {
 			return nil, err
 		}
@@ -125,7 +617,7 @@ func New(config *Config) (*AriaSQL, error) {
 	// if logging is set to true, create log file
 	if config.Logging {
 		var err error
-		logFile, err = os.OpenFile(fmt.Sprintf("%s%saria.log", config.DataDir, shared.GetOsPathSeparator()), os.O_CREATE|os.O_APPEND|os.O_RDWR, 0644)
+		logFile, err = os.OpenFile(filepath.Join(config.DataDir, "aria.log"), os.O_CREATE|os.O_APPEND|os.O_RDWR, 0644)
 		if err != nil {
 			return nil, err
 		}
@@ -133,7 +625,7 @@ func New(config *Config) (*AriaSQL, error) {
 		log.SetOutput(logFile)
 	}
 
-	wal, err := wal.OpenWAL(fmt.Sprintf("%s%swal.dat", config.DataDir, shared.GetOsPathSeparator()), os.O_CREATE|os.O_RDWR, 0644)
+	wal, err := wal.OpenWAL(filepath.Join(config.DataDir, "wal.dat"), os.O_CREATE|os.O_RDWR, 0644)
 	if err != nil {
 		return nil, err
 
@@ -150,18 +642,53 @@ func New(config *Config) (*AriaSQL, error) {
 		WAL:          wal,
 		ChannelsLock: &sync.Mutex{},
 		LogFile:      logFile,
+		Statements:   statements.New(config.MaxStatements),
+		Plans:        plancache.New(config.MaxPlans),
 	}, err
 }
 
+// RotateLog copies aria.log to a file named after it and the unix nanoseconds of the rotation and empties it
+// The log file stays open, loggers writing to it keep appending.  The rotated file is returned, empty if logging
+// is off or the log is empty.
+func (ariasql *AriaSQL) RotateLog() (string, error) {
+	if ariasql.LogFile == nil {
+		return "", nil
+	}
+
+	stat, err := ariasql.LogFile.Stat()
+	if err != nil || stat.Size() == 0 {
+		return "", err
+	}
+
+	rotated := fmt.Sprintf("%s.%d", ariasql.LogFile.Name(), time.Now().UnixNano())
+
+	data, err := os.ReadFile(ariasql.LogFile.Name())
+	if err != nil {
+		return "", err
+	}
+
+	err = os.WriteFile(rotated, data, 0644)
+	if err != nil {
+		return "", err
+	}
+
+	// Lines logged while copying are lost, the file is opened for appending so logging continues from the start
+	return rotated, ariasql.LogFile.Truncate(0)
+}
+
 // OpenChannel opens a new channel to database
 func (ariasql *AriaSQL) OpenChannel(user *catalog.User) *Channel {
 	ariasql.ChannelsLock.Lock()
 	defer ariasql.ChannelsLock.Unlock()
 	channel := &Channel{
-		ChannelID: uint64(len(ariasql.Channels) + 1),
-		User:      user,
+		ChannelID:     uint64(len(ariasql.Channels) + 1),
+		User:          user,
+		Listening:     make(map[string]bool),
+		Notifications: make(chan *Notification, NOTIFICATION_QUEUE_SIZE),
 	}
 
+	channel.Waits = wait.NewSession(channel.ChannelID)
+
 	ariasql.Channels = append(ariasql.Channels, channel)
 
 	return channel
@@ -172,8 +699,9 @@ func (ariasql *AriaSQL) CloseChannel(channel *Channel) error {
 	ariasql.ChannelsLock.Lock()
 	defer ariasql.ChannelsLock.Unlock()
 
+	// Channel ids are reused once a channel is closed so we compare the channels themselves
 	for i, ch := range ariasql.Channels {
-		if ch.ChannelID == channel.ChannelID {
+		if ch == channel {
 			ariasql.Channels = append(ariasql.Channels[:i], ariasql.Channels[i+1:]...)
 			return nil
 		}
@@ -182,6 +710,54 @@ func (ariasql *AriaSQL) CloseChannel(channel *Channel) error {
 	return errors.New("channel not found")
 }
 
+// Listen starts listening on a notification channel
+func (ariasql *AriaSQL) Listen(channel *Channel, name string) {
+	ariasql.ChannelsLock.Lock()
+	defer ariasql.ChannelsLock.Unlock()
+
+	channel.Listening[name] = true
+}
+
+// Unlisten stops listening on a notification channel, * stops listening on every notification channel
+func (ariasql *AriaSQL) Unlisten(channel *Channel, name string) {
+	ariasql.ChannelsLock.Lock()
+	defer ariasql.ChannelsLock.Unlock()
+
+	if name == "*" {
+		channel.Listening = make(map[string]bool)
+		return
+	}
+
+	delete(channel.Listening, name)
+}
+
+// Notify sends a notification to every open channel listening on its notification channel, including the sender
+// Notifications are never blocked on, a notification is dropped for a channel whose queue is full
+func (ariasql *AriaSQL) Notify(sender *Channel, name string, payload string) error {
+	if len(payload) > MAX_NOTIFICATION_PAYLOAD {
+		return fmt.Errorf("notification payload is longer than %d bytes", MAX_NOTIFICATION_PAYLOAD)
+	}
+
+	ariasql.ChannelsLock.Lock()
+	defer ariasql.ChannelsLock.Unlock()
+
+	notification := &Notification{Channel: name, Payload: payload, Sender: sender.ChannelID}
+
+	for _, ch := range ariasql.Channels {
+		if !ch.Listening[name] {
+			continue
+		}
+
+		select {
+		case ch.Notifications <- notification:
+		default:
+			log.Printf("channel %d: notification queue full, notification on %s dropped", ch.ChannelID, name)
+		}
+	}
+
+	return nil
+}
+
 // GetChannel returns a channel by ID
 func (ariasql *AriaSQL) GetChannel(channelID uint64) *Channel {
 	for _, ch := range ariasql.Channels {
@@ -210,7 +786,7 @@ func (ariasql *AriaSQL) Close() error {
 
 // saveConfig saves the configuration to a file
 func (ariasql *AriaSQL) saveConfig() error {
-	confFile, err := os.OpenFile(fmt.Sprintf("%s%sariaconf.yaml", ariasql.Config.DataDir, shared.GetOsPathSeparator()), os.O_CREATE|os.O_RDWR, 0644)
+	confFile, err := os.OpenFile(filepath.Join(ariasql.Config.DataDir, "ariaconf.yaml"), os.O_CREATE|os.O_RDWR, 0644)
 	if err != nil {
 		return err
 	}
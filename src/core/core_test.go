@@ -18,6 +18,7 @@
 package core
 
 import (
+	"ariasql/catalog"
 	"os"
 	"testing"
 )
@@ -25,6 +26,7 @@ import (
 func TestNew(t *testing.T) {
 	defer os.Remove("wal.dat")
 	defer os.Remove("wal.dat.del")
+	defer os.Remove("wal.dat.dirty")
 	defer os.Remove("ariaconf.yaml")
 	aria, err := New(&Config{
 		DataDir: "./",
@@ -46,6 +48,7 @@ func TestNew(t *testing.T) {
 func TestAriaSQL_OpenChannel(t *testing.T) {
 	defer os.Remove("wal.dat")
 	defer os.Remove("wal.dat.del")
+	defer os.Remove("wal.dat.dirty")
 	defer os.Remove("ariaconf.yaml")
 	aria, err := New(&Config{
 		DataDir: "./",
@@ -76,6 +79,7 @@ func TestAriaSQL_OpenChannel(t *testing.T) {
 func TestAriaSQL_RemoveChannel(t *testing.T) {
 	defer os.Remove("wal.dat")
 	defer os.Remove("wal.dat.del")
+	defer os.Remove("wal.dat.dirty")
 	defer os.Remove("ariaconf.yaml")
 	aria, err := New(&Config{
 		DataDir: "./",
@@ -95,3 +99,117 @@ func TestAriaSQL_RemoveChannel(t *testing.T) {
 		t.Fatalf("expected 0, got %d", len(aria.Channels))
 	}
 }
+
+func TestChannel_Client(t *testing.T) {
+	channel := &Channel{User: &catalog.User{Username: "alex"}}
+
+	if channel.Client() != "alex" {
+		t.Fatalf("expected alex, got %s", channel.Client())
+	}
+
+	channel.Address = "198.51.100.23:40022"
+	channel.ApplicationName = "billing"
+	channel.ClientVersion = "2.1.0"
+	channel.Labels = map[string]string{"team": "payments", "region": "eu"}
+
+	if channel.Client() != "alex@198.51.100.23:40022 (billing 2.1.0 region=eu,team=payments)" {
+		t.Fatalf("unexpected client %s", channel.Client())
+	}
+}
+
+func TestChannel_SetTrace(t *testing.T) {
+	channel := &Channel{}
+
+	err := channel.SetTrace("Plan, io,plan")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(channel.Trace) != 2 || !channel.Tracing(TRACE_PLAN) || !channel.Tracing(TRACE_IO) || channel.Tracing(TRACE_STATEMENT) {
+		t.Fatalf("expected plan and io, got %v", channel.Trace)
+	}
+
+	err = channel.SetTrace("plan,locks")
+	if err == nil {
+		t.Fatal("expected error for an unknown option")
+	}
+
+	if len(channel.Trace) != 2 {
+		t.Fatalf("expected the trace to be unchanged, got %v", channel.Trace)
+	}
+
+	err = channel.SetTrace("off")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(channel.Trace) != 0 {
+		t.Fatalf("expected no trace, got %v", channel.Trace)
+	}
+}
+
+func TestChannel_SetIsolation(t *testing.T) {
+	channel := &Channel{}
+
+	err := channel.SetIsolation("read  committed")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if channel.Isolation != ISOLATION_READ_COMMITTED {
+		t.Fatalf("expected %s, got %s", ISOLATION_READ_COMMITTED, channel.Isolation)
+	}
+
+	err = channel.SetIsolation("Repeatable Read")
+	if err != nil || channel.Isolation != ISOLATION_REPEATABLE_READ {
+		t.Fatalf("expected %s, got %s %v", ISOLATION_REPEATABLE_READ, channel.Isolation, err)
+	}
+
+	err = channel.SetIsolation("read uncommitted")
+	if err == nil {
+		t.Fatal("expected error for an unknown isolation level")
+	}
+
+	if channel.Isolation != ISOLATION_REPEATABLE_READ {
+		t.Fatalf("expected the isolation level to be unchanged, got %s", channel.Isolation)
+	}
+}
+
+func TestChannel_SetOptimizerTrace(t *testing.T) {
+	channel := &Channel{}
+
+	err := channel.SetOptimizerTrace("ON")
+	if err != nil || !channel.OptimizerTrace {
+		t.Fatalf("expected the optimizer trace on, got %v %v", channel.OptimizerTrace, err)
+	}
+
+	err = channel.SetOptimizerTrace("yes")
+	if err == nil || !channel.OptimizerTrace {
+		t.Fatal("expected error for an invalid value and the optimizer trace unchanged")
+	}
+
+	err = channel.SetOptimizerTrace("off")
+	if err != nil || channel.OptimizerTrace {
+		t.Fatalf("expected the optimizer trace off, got %v %v", channel.OptimizerTrace, err)
+	}
+}
+
+func TestAriaSQL_WrittenSince(t *testing.T) {
+	aria := &AriaSQL{}
+
+	began := aria.WriteSequence()
+
+	if aria.WrittenSince("db1", "orders", began) {
+		t.Fatal("expected orders not to be written")
+	}
+
+	aria.Written("db1", "orders")
+
+	if !aria.WrittenSince("db1", "orders", began) {
+		t.Fatal("expected orders to be written")
+	}
+
+	if aria.WrittenSince("db1", "orders", aria.WriteSequence()) || aria.WrittenSince("db2", "orders", began) {
+		t.Fatal("expected no write after the last sequence or to another database")
+	}
+}
@@ -0,0 +1,287 @@
+// Package daemon
+// AriaSQL daemon package, pid files and the readiness and watchdog notifications of systemd
+// Copyright (C) AriaSQL
+// Author(s): Alex Gaetano Padula
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+package daemon
+
+import (
+	"ariasql/core"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const NOTIFY_SOCKET = "NOTIFY_SOCKET"   // Environment variable of the socket the service manager reads notifications from
+const WATCHDOG_USEC = "WATCHDOG_USEC"   // Environment variable of the watchdog timeout in microseconds
+const WATCHDOG_PID = "WATCHDOG_PID"     // Environment variable of the process the watchdog is enabled for
+const STATE_READY = "READY=1"           // The server is accepting connections
+const STATE_STOPPING = "STOPPING=1"     // The server is shutting down
+const STATE_WATCHDOG = "WATCHDOG=1"     // The server is alive, pinged within the watchdog timeout
+const WATCHDOG_PINGS = 2                // Pings sent within a watchdog timeout, a ping missed is not a timeout
+const PID_FILE_PERMISSIONS = 0644       // Permissions a pid file is written with
+const HEALTH_TIMEOUT = 10 * time.Second // Longest a health check runs if the watchdog is not enabled
+
+// WritePidFile writes the pid of the process to a file, replacing the file of a process no longer running
+// An error is returned if the file holds the pid of another running process
+func WritePidFile(path string) error {
+	err := CheckPidFile(path)
+	if err != nil {
+		return err
+	}
+
+	// Written whole or not at all, a supervisor never reads a partial pid
+	tmp := path + ".tmp"
+
+	err = os.WriteFile(tmp, []byte(strconv.Itoa(os.Getpid())+"\n"), PID_FILE_PERMISSIONS)
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, path)
+}
+
+// CheckPidFile returns an error if a pid file holds the pid of another running process
+func CheckPidFile(path string) error {
+	if pid, err := ReadPidFile(path); err == nil && pid != os.Getpid() && running(pid) {
+		return fmt.Errorf("pid file %s is held by running process %d", path, pid)
+	}
+
+	return nil
+}
+
+// ReadPidFile returns the pid within a pid file
+func ReadPidFile(path string) (int, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil || pid <= 0 {
+		return 0, fmt.Errorf("pid file %s does not hold a pid", path)
+	}
+
+	return pid, nil
+}
+
+// RemovePidFile removes a pid file if it holds the pid of the process, a file written by another process is left
+func RemovePidFile(path string) error {
+	pid, err := ReadPidFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if pid != os.Getpid() {
+		return nil
+	}
+
+	return os.Remove(path)
+}
+
+// running returns true if a process with the pid is running
+func running(pid int) bool {
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+
+	err = process.Signal(syscall.Signal(0))
+
+	// A process of another user can not be signalled, it is still running
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
+
+// Notify sends states, such as READY=1, to the service manager on $NOTIFY_SOCKET
+// false is returned if the process was not started by a service manager expecting notifications
+func Notify(states ...string) (bool, error) {
+	socket := os.Getenv(NOTIFY_SOCKET)
+	if socket == "" {
+		return false, nil
+	}
+
+	// A socket starting with @ is within the abstract namespace
+	if strings.HasPrefix(socket, "@") {
+		socket = "\x00" + socket[1:]
+	}
+
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		return false, err
+	}
+
+	defer conn.Close()
+
+	_, err = conn.Write([]byte(strings.Join(states, "\n")))
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// WatchdogTimeout returns the watchdog timeout of the service manager, 0 if the watchdog is not enabled for the process
+func WatchdogTimeout() (time.Duration, error) {
+	usec := os.Getenv(WATCHDOG_USEC)
+	if usec == "" {
+		return 0, nil
+	}
+
+	// The watchdog of a service manager started for another process, a child of this one
+	if pid := os.Getenv(WATCHDOG_PID); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return 0, nil
+	}
+
+	timeout, err := strconv.ParseInt(usec, 10, 64)
+	if err != nil || timeout <= 0 {
+		return 0, fmt.Errorf("invalid %s %q", WATCHDOG_USEC, usec)
+	}
+
+	return time.Duration(timeout) * time.Microsecond, nil
+}
+
+// Notifier tells the service manager the server is ready once it accepts connections, and pings its watchdog
+// for as long as the catalog responds.  A server whose catalog stops responding misses its pings and is
+// restarted by the service manager.
+type Notifier struct {
+	aria    *core.AriaSQL   // AriaSQL instance pointer
+	pidFile string          // Pid file written once ready, empty to write none
+	timeout time.Duration   // Watchdog timeout, 0 if the watchdog is not enabled
+	healthy func() bool     // Returns true if the server is healthy
+	notify  func(...string) // Sends states to the service manager
+	stop    chan struct{}   // Closed to stop pinging
+	wg      *sync.WaitGroup // Pinging goroutine
+}
+
+// New creates a notifier of the service manager, a pid file is written to pidFile once ready if not empty
+// An error is returned if the pid file is held by another running server
+func New(aria *core.AriaSQL, pidFile string) (*Notifier, error) {
+	if pidFile != "" {
+		err := CheckPidFile(pidFile)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	timeout, err := WatchdogTimeout()
+	if err != nil {
+		return nil, err
+	}
+
+	n := &Notifier{aria: aria, pidFile: pidFile, timeout: timeout, stop: make(chan struct{}), wg: &sync.WaitGroup{}}
+	n.healthy = n.catalogResponds
+	n.notify = n.send
+
+	return n, nil
+}
+
+// Ready writes the pid file and tells the service manager the server accepts connections on address
+// Pinging the watchdog starts if it is enabled
+func (n *Notifier) Ready(address string) error {
+	if n.pidFile != "" {
+		err := WritePidFile(n.pidFile)
+		if err != nil {
+			return err
+		}
+	}
+
+	n.notify(STATE_READY, fmt.Sprintf("STATUS=Accepting connections on %s", address), fmt.Sprintf("MAINPID=%d", os.Getpid()))
+
+	if n.timeout > 0 {
+		n.wg.Add(1)
+		go n.ping()
+	}
+
+	return nil
+}
+
+// ping pings the watchdog WATCHDOG_PINGS times within its timeout while the server is healthy
+func (n *Notifier) ping() {
+	defer n.wg.Done()
+
+	ticker := time.NewTicker(n.timeout / WATCHDOG_PINGS)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-n.stop:
+			return
+		case <-ticker.C:
+			if n.healthy() {
+				n.notify(STATE_WATCHDOG)
+			}
+		}
+	}
+}
+
+// catalogResponds returns true if the catalog answers within the watchdog timeout, false if it is closed or its lock is held for longer
+func (n *Notifier) catalogResponds() bool {
+	if n.aria.Catalog == nil {
+		return false
+	}
+
+	timeout := n.timeout
+	if timeout == 0 {
+		timeout = HEALTH_TIMEOUT
+	}
+
+	done := make(chan struct{})
+
+	go func() {
+		n.aria.Catalog.GetDatabases()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+// send sends states to the service manager, failures are logged
+func (n *Notifier) send(states ...string) {
+	_, err := Notify(states...)
+	if err != nil {
+		log.Printf("daemon: unable to notify the service manager: %s", err.Error())
+	}
+}
+
+// Close tells the service manager the server is stopping, stops pinging the watchdog and removes the pid file
+func (n *Notifier) Close() {
+	n.notify(STATE_STOPPING)
+
+	close(n.stop)
+	n.wg.Wait()
+
+	if n.pidFile != "" {
+		err := RemovePidFile(n.pidFile)
+		if err != nil {
+			log.Printf("daemon: unable to remove pid file: %s", err.Error())
+		}
+	}
+}
@@ -0,0 +1,229 @@
+// Package daemon tests
+// Copyright (C) AriaSQL
+// Author(s): Alex Gaetano Padula
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+package daemon
+
+import (
+	"ariasql/core"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestWritePidFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ariasql.pid")
+
+	err := WritePidFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pid, err := ReadPidFile(path)
+	if err != nil || pid != os.Getpid() {
+		t.Fatalf("expected pid %d, got %d %v", os.Getpid(), pid, err)
+	}
+
+	// A pid file of a running process is not replaced
+	err = os.WriteFile(path, []byte(strconv.Itoa(os.Getppid())), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = WritePidFile(path); err == nil || !strings.Contains(err.Error(), "held by running process") {
+		t.Fatalf("expected the pid file held, got %v", err)
+	}
+
+	// Nor removed
+	if err = RemovePidFile(path); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = os.Stat(path); err != nil {
+		t.Fatal("expected the pid file of another process kept")
+	}
+
+	// A pid file of a process no longer running is replaced
+	err = os.WriteFile(path, []byte("999999999\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = WritePidFile(path); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = RemovePidFile(path); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = os.Stat(path); !os.IsNotExist(err) {
+		t.Fatal("expected the pid file removed")
+	}
+}
+
+func TestNotify(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "notify.sock")
+
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	t.Setenv(NOTIFY_SOCKET, "")
+
+	if notified, err := Notify(STATE_READY); notified || err != nil {
+		t.Fatalf("expected no notification without a socket, got %v %v", notified, err)
+	}
+
+	t.Setenv(NOTIFY_SOCKET, socket)
+
+	notified, err := Notify(STATE_READY, "STATUS=Accepting connections")
+	if !notified || err != nil {
+		t.Fatalf("expected a notification, got %v %v", notified, err)
+	}
+
+	buf := make([]byte, 1024)
+
+	n, err := conn.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(buf[:n]) != "READY=1\nSTATUS=Accepting connections" {
+		t.Fatalf("unexpected notification %q", buf[:n])
+	}
+}
+
+func TestWatchdogTimeout(t *testing.T) {
+	t.Setenv(WATCHDOG_USEC, "")
+	t.Setenv(WATCHDOG_PID, "")
+
+	if timeout, err := WatchdogTimeout(); timeout != 0 || err != nil {
+		t.Fatalf("expected the watchdog disabled, got %s %v", timeout, err)
+	}
+
+	t.Setenv(WATCHDOG_USEC, "2000000")
+
+	if timeout, err := WatchdogTimeout(); timeout != 2*time.Second || err != nil {
+		t.Fatalf("expected a 2s timeout, got %s %v", timeout, err)
+	}
+
+	// The watchdog of another process
+	t.Setenv(WATCHDOG_PID, strconv.Itoa(os.Getpid()+1))
+
+	if timeout, err := WatchdogTimeout(); timeout != 0 || err != nil {
+		t.Fatalf("expected the watchdog disabled for another process, got %s %v", timeout, err)
+	}
+
+	t.Setenv(WATCHDOG_PID, strconv.Itoa(os.Getpid()))
+	t.Setenv(WATCHDOG_USEC, "never")
+
+	if _, err := WatchdogTimeout(); err == nil {
+		t.Fatal("expected an invalid timeout")
+	}
+}
+
+func TestNotifier_Ready(t *testing.T) {
+	t.Setenv(WATCHDOG_USEC, "20000")
+	t.Setenv(WATCHDOG_PID, "")
+
+	path := filepath.Join(t.TempDir(), "ariasql.pid")
+
+	n, err := New(&core.AriaSQL{Config: &core.Config{}}, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lock := &sync.Mutex{}
+	healthy := true
+	states := make([]string, 0)
+
+	n.healthy = func() bool {
+		lock.Lock()
+		defer lock.Unlock()
+
+		return healthy
+	}
+
+	n.notify = func(s ...string) {
+		lock.Lock()
+		defer lock.Unlock()
+
+		states = append(states, s...)
+	}
+
+	count := func(state string) int {
+		lock.Lock()
+		defer lock.Unlock()
+
+		c := 0
+		for _, s := range states {
+			if s == state {
+				c++
+			}
+		}
+
+		return c
+	}
+
+	err = n.Ready("0.0.0.0:3695")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if pid, err := ReadPidFile(path); err != nil || pid != os.Getpid() {
+		t.Fatalf("expected the pid file written once ready, got %d %v", pid, err)
+	}
+
+	if count(STATE_READY) != 1 || count("STATUS=Accepting connections on 0.0.0.0:3695") != 1 {
+		t.Fatalf("expected the server ready, got %q", states)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+
+	if count(STATE_WATCHDOG) == 0 {
+		t.Fatal("expected the watchdog pinged while healthy")
+	}
+
+	// An unhealthy server misses its pings
+	lock.Lock()
+	healthy = false
+	lock.Unlock()
+
+	time.Sleep(20 * time.Millisecond)
+	pings := count(STATE_WATCHDOG)
+	time.Sleep(100 * time.Millisecond)
+
+	if count(STATE_WATCHDOG) != pings {
+		t.Fatal("expected no pings while unhealthy")
+	}
+
+	n.Close()
+
+	if count(STATE_STOPPING) != 1 {
+		t.Fatalf("expected the server stopping, got %q", states)
+	}
+
+	if _, err = os.Stat(path); !os.IsNotExist(err) {
+		t.Fatal("expected the pid file removed on close")
+	}
+}
@@ -0,0 +1,198 @@
+// Package diff
+// AriaSQL data diff package
+// Copyright (C) AriaSQL
+// Author(s): Alex Gaetano Padula
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+package diff
+
+import (
+	"ariasql/bench"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const DEFAULT_CHUNKS = 64 // Chunks a table compared by a column is checksummed in if not configured
+
+// Options are the options of a comparison
+type Options struct {
+	Database string   // Database compared
+	Tables   []string // Tables compared, table or table:column to compare by chunks of the column, every table of the source if empty
+	Chunks   int      // Chunks a table compared by a column is checksummed in
+}
+
+// Result is the comparison of a table on the source and the target
+type Result struct {
+	Table  string   `json:"table"`  // Table compared
+	By     string   `json:"by"`     // Column the table was compared by, empty if compared as a whole
+	Rows   [2]int   `json:"rows"`   // Rows of the table on the source and the target
+	Chunks []*Chunk `json:"chunks"` // Chunks which differ, every row is in chunk 0 if compared as a whole
+}
+
+// Chunk is a chunk of a table which differs between the source and the target
+type Chunk struct {
+	Chunk     int       `json:"chunk"`     // Chunk number
+	Rows      [2]int    `json:"rows"`      // Rows of the chunk on the source and the target
+	Checksums [2]string `json:"checksums"` // Checksums of the chunk on the source and the target
+}
+
+// Match returns true if the table holds the same rows on the source and the target
+func (r *Result) Match() bool {
+	return len(r.Chunks) == 0
+}
+
+// String formats a result for the terminal
+func (r *Result) String() string {
+	if r.Match() {
+		return fmt.Sprintf("%s: match, %d rows\n", r.Table, r.Rows[0])
+	}
+
+	b := strings.Builder{}
+	fmt.Fprintf(&b, "%s: differs, %d rows on the source and %d on the target\n", r.Table, r.Rows[0], r.Rows[1])
+
+	for _, c := range r.Chunks {
+		if r.By == "" {
+			fmt.Fprintf(&b, "  checksum %s on the source, %s on the target\n", c.Checksums[0], c.Checksums[1])
+			continue
+		}
+
+		fmt.Fprintf(&b, "  chunk %d by %s: %d rows on the source and %d on the target, checksum %s and %s\n", c.Chunk, r.By, c.Rows[0], c.Rows[1], c.Checksums[0], c.Checksums[1])
+	}
+
+	return b.String()
+}
+
+// Compare compares the tables of a database on the source and the target with CHECKSUM TABLE
+// A table compared by a column is checksummed in chunks of its rows, rows are assigned to a chunk by the hash of the column on both instances
+// so a chunk which differs holds the rows which differ, whatever order the rows were written in
+func Compare(source, target bench.Session, options *Options) ([]*Result, error) {
+	if options.Database == "" {
+		return nil, errors.New("no database to compare")
+	}
+
+	chunks := options.Chunks
+	if chunks == 0 {
+		chunks = DEFAULT_CHUNKS
+	}
+
+	if chunks < 0 {
+		return nil, errors.New("chunks must be greater than 0")
+	}
+
+	for _, session := range []bench.Session{source, target} {
+		_, err := session.Execute("USE " + options.Database + ";")
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	tables := options.Tables
+	if len(tables) == 0 {
+		response, err := source.Execute("SHOW TABLES;")
+		if err != nil {
+			return nil, err
+		}
+
+		for _, row := range parseRows(response) {
+			tables = append(tables, row["Table"])
+		}
+
+		sort.Strings(tables)
+	}
+
+	results := make([]*Result, 0, len(tables))
+
+	for _, table := range tables {
+		result := &Result{Table: table}
+
+		query := "CHECKSUM TABLE " + table + ";"
+
+		if name, by, ok := strings.Cut(table, ":"); ok {
+			result.Table, result.By = name, by
+			query = fmt.Sprintf("CHECKSUM TABLE %s BY %s CHUNKS %d;", name, by, chunks)
+		}
+
+		var checksums [2]map[int]map[string]string
+
+		for i, session := range []bench.Session{source, target} {
+			response, err := session.Execute(query)
+			if err != nil {
+				return nil, fmt.Errorf("table %s on the %s: %s", result.Table, []string{"source", "target"}[i], err.Error())
+			}
+
+			checksums[i] = make(map[int]map[string]string)
+
+			for _, row := range parseRows(response) {
+				chunk, _ := strconv.Atoi(row["Chunk"])
+				checksums[i][chunk] = row
+
+				rows, _ := strconv.Atoi(row["Rows"])
+				result.Rows[i] += rows
+			}
+		}
+
+		for chunk := 0; chunk < len(checksums[0]) || chunk < len(checksums[1]); chunk++ {
+			s, t := checksums[0][chunk], checksums[1][chunk]
+			if s["Checksum"] == t["Checksum"] && s["Rows"] == t["Rows"] {
+				continue
+			}
+
+			c := &Chunk{Chunk: chunk, Checksums: [2]string{s["Checksum"], t["Checksum"]}}
+			c.Rows[0], _ = strconv.Atoi(s["Rows"])
+			c.Rows[1], _ = strconv.Atoi(t["Rows"])
+
+			result.Chunks = append(result.Chunks, c)
+		}
+
+		results = append(results, result)
+	}
+
+	return results, nil
+}
+
+// parseRows returns the rows of a result set formatted as a table
+func parseRows(table []byte) []map[string]string {
+	var header []string
+	rows := make([]map[string]string, 0)
+
+	for _, line := range strings.Split(string(table), "\n") {
+		if !strings.HasPrefix(line, "|") {
+			continue
+		}
+
+		cells := strings.Split(strings.Trim(line, "|"), "|")
+		for i := range cells {
+			cells[i] = strings.TrimSpace(cells[i])
+		}
+
+		if header == nil {
+			header = cells
+			continue
+		}
+
+		row := make(map[string]string)
+		for i, column := range header {
+			if i < len(cells) {
+				row[column] = cells[i]
+			}
+		}
+
+		rows = append(rows, row)
+	}
+
+	return rows
+}
@@ -0,0 +1,126 @@
+// Package diff tests
+// Copyright (C) AriaSQL
+// Author(s): Alex Gaetano Padula
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+package diff
+
+import (
+	"ariasql/bench"
+	"os"
+	"testing"
+)
+
+func TestCompare(t *testing.T) {
+	defer os.RemoveAll("./test")
+
+	var sessions []bench.Session
+
+	for _, dir := range []string{"./test/source", "./test/target"} {
+		err := os.MkdirAll(dir, 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		instance, err := bench.NewEmbedded(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		defer instance.Close()
+
+		session, err := instance.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		defer session.Close()
+
+		sessions = append(sessions, session)
+	}
+
+	// The target has the same users written in another order, and another price for one product
+	for i, stmts := range [][]string{
+		{
+			"INSERT INTO users (user_id, name) VALUES (1, 'alex');",
+			"INSERT INTO users (user_id, name) VALUES (2, 'sam');",
+			"INSERT INTO products (product_id, price) VALUES (1, 10);",
+			"INSERT INTO products (product_id, price) VALUES (2, 20);",
+		},
+		{
+			"INSERT INTO users (user_id, name) VALUES (2, 'sam');",
+			"INSERT INTO users (user_id, name) VALUES (1, 'alex');",
+			"INSERT INTO products (product_id, price) VALUES (1, 10);",
+			"INSERT INTO products (product_id, price) VALUES (2, 25);",
+		},
+	} {
+		for _, stmt := range append([]string{
+			"CREATE DATABASE shop;",
+			"USE shop;",
+			"CREATE TABLE users (user_id INT, name CHAR(8));",
+			"CREATE TABLE products (product_id INT, price INT);",
+		}, stmts...) {
+			_, err := sessions[i].Execute(stmt)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	results, err := Compare(sessions[0], sessions[1], &Options{Database: "shop"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(results) != 2 || results[0].Table != "products" || results[1].Table != "users" {
+		t.Fatalf("expected products and users compared, got %v", results)
+	}
+
+	if results[0].Match() || len(results[0].Chunks) != 1 || results[0].Rows != [2]int{2, 2} {
+		t.Fatalf("expected products to differ, got %s", results[0].String())
+	}
+
+	if !results[1].Match() || results[1].Rows != [2]int{2, 2} {
+		t.Fatalf("expected users to match, got %s", results[1].String())
+	}
+
+	// By chunks only the chunk of the product which differs is reported
+	results, err = Compare(sessions[0], sessions[1], &Options{Database: "shop", Tables: []string{"products:product_id"}, Chunks: 16})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(results) != 1 || len(results[0].Chunks) != 1 || results[0].Chunks[0].Rows != [2]int{1, 1} || results[0].By != "product_id" {
+		t.Fatalf("expected a chunk of a product to differ, got %s", results[0].String())
+	}
+
+	_, err = sessions[1].Execute("DELETE FROM products WHERE product_id = 2;")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	results, err = Compare(sessions[0], sessions[1], &Options{Database: "shop", Tables: []string{"products:product_id"}, Chunks: 16})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(results[0].Chunks) != 1 || results[0].Chunks[0].Rows != [2]int{1, 0} || results[0].Rows != [2]int{2, 1} {
+		t.Fatalf("expected a product missing from the target, got %s", results[0].String())
+	}
+
+	_, err = Compare(sessions[0], sessions[1], &Options{Database: "shop", Tables: []string{"orders"}})
+	if err == nil {
+		t.Fatal("expected error")
+	}
+}
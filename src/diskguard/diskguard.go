@@ -0,0 +1,120 @@
+// Package diskguard
+// AriaSQL disk space guard package
+// Copyright (C) AriaSQL
+// Author(s): Alex Gaetano Padula
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+package diskguard
+
+import (
+	"ariasql/core"
+	"ariasql/storage"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+const INTERVAL = 5 * time.Second      // Time between checks of the free space
+const DEFAULT_RESUME_SPACE = 64 << 20 // Free bytes the server turns read-write again at if MinFreeSpace is not configured
+
+// Guard checks the free space on the disk of the data directory
+// With MinFreeSpace configured the server turns read-only before the disk is full.  A server which
+// turned read-only, on low space or on a write failing as the disk is full, turns read-write again
+// once space is freed and the WAL is intact.
+type Guard struct {
+	aria   *core.AriaSQL                   // AriaSQL instance pointer
+	free   func(dir string) (int64, error) // Returns the free space of a directory
+	stop   chan struct{}                   // Closed to stop checking
+	wg     *sync.WaitGroup                 // Checking goroutine
+	logged string                          // Why the server stays read-only, logged once
+}
+
+// New creates a guard of the data directory, checking starts with Start
+func New(aria *core.AriaSQL) *Guard {
+	return &Guard{aria: aria, free: storage.FreeSpace, stop: make(chan struct{}), wg: &sync.WaitGroup{}}
+}
+
+// Start starts checking the free space every INTERVAL
+func (g *Guard) Start() {
+	g.wg.Add(1)
+
+	go func() {
+		defer g.wg.Done()
+
+		ticker := time.NewTicker(INTERVAL)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-g.stop:
+				return
+			case <-ticker.C:
+				g.check()
+			}
+		}
+	}()
+}
+
+// Close stops checking
+func (g *Guard) Close() {
+	close(g.stop)
+	g.wg.Wait()
+}
+
+// check checks the free space and turns the server read-only or read-write
+func (g *Guard) check() {
+	free, err := g.free(g.aria.Config.DataDir)
+	if err != nil {
+		log.Printf("disk guard: %s", err.Error())
+		return
+	}
+
+	min := g.aria.Config.MinFreeSpace
+
+	if g.aria.ReadOnly() == nil {
+		if min > 0 && free < min {
+			g.aria.SetReadOnly(fmt.Sprintf("%d bytes free on the disk of the data directory, below %d bytes", free, min))
+		}
+
+		return
+	}
+
+	resume := min
+	if resume <= 0 {
+		resume = DEFAULT_RESUME_SPACE
+	}
+
+	if free < resume {
+		return
+	}
+
+	// An entry part written when the disk filled up must be recovered before the WAL is appended to
+	if g.aria.WAL != nil {
+		err = g.aria.WAL.Intact()
+		if err != nil {
+			if g.logged != err.Error() {
+				log.Printf("disk guard: %d bytes free but the server stays read-only, %s, recover the WAL with -recover", free, err.Error())
+				g.logged = err.Error()
+			}
+
+			return
+		}
+	}
+
+	if g.aria.SetReadWrite() {
+		log.Printf("disk guard: %d bytes free on the disk of the data directory, the server is read-write again", free)
+		g.logged = ""
+	}
+}
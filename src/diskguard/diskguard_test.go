@@ -0,0 +1,121 @@
+// Package diskguard tests
+// Copyright (C) AriaSQL
+// Author(s): Alex Gaetano Padula
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+package diskguard
+
+import (
+	"ariasql/core"
+	"ariasql/wal"
+	"errors"
+	"os"
+	"syscall"
+	"testing"
+)
+
+func TestGuard_check(t *testing.T) {
+	defer os.RemoveAll("./test/")
+
+	err := os.MkdirAll("./test", 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w, err := wal.OpenWAL("./test/wal.dat", os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer w.Close()
+
+	err = w.Append([]byte("entry"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	aria := &core.AriaSQL{Config: &core.Config{DataDir: "./test", MinFreeSpace: 1000}, WAL: w}
+
+	free := int64(5000)
+
+	g := New(aria)
+	g.free = func(dir string) (int64, error) { return free, nil }
+
+	g.check()
+	if aria.ReadOnly() != nil {
+		t.Fatal("expected the server to stay read-write")
+	}
+
+	// Below the minimum the server turns read-only
+	free = 500
+
+	g.check()
+	if aria.ReadOnly() == nil || !errors.Is(aria.CheckWrite(), core.ErrReadOnly) {
+		t.Fatal("expected the server to be read-only")
+	}
+
+	// Once space is freed the server is read-write again
+	free = 5000
+
+	g.check()
+	if aria.ReadOnly() != nil || aria.CheckWrite() != nil {
+		t.Fatal("expected the server to be read-write again")
+	}
+
+	if aria.ReadOnlies() != 1 {
+		t.Fatalf("expected the server to have been read-only once, got %d", aria.ReadOnlies())
+	}
+
+	// A write failing on a full disk turns the server read-only
+	if !aria.DiskFull(&os.PathError{Op: "write", Path: "wal.dat", Err: syscall.ENOSPC}) || aria.ReadOnly() == nil {
+		t.Fatal("expected the server to be read-only on a full disk")
+	}
+
+	// Without MinFreeSpace the server resumes at DEFAULT_RESUME_SPACE
+	aria.Config.MinFreeSpace = 0
+
+	g.check()
+	if aria.ReadOnly() == nil {
+		t.Fatal("expected the server to stay read-only below DEFAULT_RESUME_SPACE")
+	}
+
+	// A partly written WAL entry keeps the server read-only
+	free = DEFAULT_RESUME_SPACE
+
+	f, err := os.OpenFile("./test/wal.dat", os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = f.Write([]byte("partial"))
+	f.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	g.check()
+	if aria.ReadOnly() == nil {
+		t.Fatal("expected the server to stay read-only with a partial WAL entry")
+	}
+
+	err = os.Truncate("./test/wal.dat", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	g.check()
+	if aria.ReadOnly() != nil {
+		t.Fatal("expected the server to be read-write with an intact WAL")
+	}
+}
@@ -0,0 +1,930 @@
+// Package edge
+// AriaSQL edge sync package
+// Copyright (C) AriaSQL
+// Author(s): Alex Gaetano Padula
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+package edge
+
+import (
+	"ariasql/catalog"
+	"ariasql/core"
+	"ariasql/parser"
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"maps"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+)
+
+const EDGE_DIRECTORY = "edge"            // Edge sync state directory within the data directory
+const OUTBOX_FILE = "outbox"             // Changes of an edge node not yet synced with its hub
+const STATE_FILE = "state"               // Row versions and hub cursor of an edge node
+const CHANGES_FILE = "changes"           // Changes accepted by a hub
+const CONFLICTS_FILE = "conflicts"       // Conflicts detected on this node
+const DEFAULT_INTERVAL = 5 * time.Second // Default sync interval of an edge node
+const SYNC_TIMEOUT = 30 * time.Second    // Sync connection timeout
+
+// Node is an AriaSQL node in edge sync mode
+// Edge nodes accept writes while offline, recording changed rows in an outbox that is pushed to the hub
+// once it can be reached.  The hub applies the changes and hands out the changes of the other nodes in return.
+// Rows are identified by a unique column and conflicting changes are resolved by last writer wins.
+type Node struct {
+	aria      *core.AriaSQL      // AriaSQL instance
+	config    *core.Edge         // Edge configuration
+	directory string             // Edge sync state directory
+	versions  map[string]Version // Version of every synced row by row key
+	last      int64              // Timestamp of the last change recorded on this node
+	outbox    []*Change          // Changes not yet synced with the hub
+	cursor    uint64             // Sequence of the last hub change applied on this node
+	seq       uint64             // Sequence of the last change accepted by this node as a hub
+	changes   []*Change          // Changes accepted by this node as a hub
+	conflicts []*Conflict        // Conflicts detected on this node
+	lock      *sync.Mutex        // Node lock
+	listener  net.Listener       // Hub listener
+	stop      chan struct{}      // Closed on Close
+	wg        *sync.WaitGroup    // Background goroutines
+}
+
+// Version is the version of a row, the later timestamp wins with the node id breaking ties
+type Version struct {
+	Timestamp int64  // Unix nanoseconds the row was changed at
+	NodeID    string // Node the row was changed on
+}
+
+// Change is a changed row
+type Change struct {
+	Seq      uint64                 // Sequence within the hub, set by the hub
+	NodeID   string                 // Node the row was changed on
+	Database string                 // Database name
+	Table    string                 // Table name
+	Column   string                 // Unique column identifying the row
+	Value    interface{}            // Value of the unique column
+	Deleted  bool                   // True if the row was deleted
+	Row      map[string]interface{} // The row after the change
+	Version  Version                // Version of the row after the change
+	Base     Version                // Version of the row the change was made on
+}
+
+// Conflict is a change made without seeing another node's change to the same row
+type Conflict struct {
+	Change   *Change // The change
+	Existing Version // Version of the row the change met
+	Kept     bool    // True if the change won and was applied
+	Problem  string  // Set if the change could not be applied at all
+}
+
+// SyncRequest is sent by an edge node to its hub
+type SyncRequest struct {
+	NodeID  string    // Edge node id
+	Changes []*Change // Changes of the edge node
+	Cursor  uint64    // Sequence of the last hub change the edge node applied
+}
+
+// SyncResponse is sent by a hub to an edge node
+type SyncResponse struct {
+	Changes   []*Change   // Changes of other nodes after the cursor
+	Cursor    uint64      // Sequence of the last change within Changes
+	Conflicts []*Conflict // Changes of the edge node the hub could not apply
+	Error     string      // Set if the sync failed
+}
+
+// edgeState is the persisted state of an edge node
+type edgeState struct {
+	Versions map[string]Version // Version of every synced row
+	Cursor   uint64             // Sequence of the last hub change applied
+	Seq      uint64             // Sequence of the last change accepted as a hub, changes purged up to it are not in the changes file
+}
+
+// Open opens the edge sync state of an AriaSQL instance
+// The catalog must be open
+func Open(aria *core.AriaSQL) (*Node, error) {
+	config := aria.Config.Edge
+	if config == nil || config.NodeID == "" {
+		return nil, errors.New("edge node id is not configured")
+	}
+
+	n := &Node{
+		aria:      aria,
+		config:    config,
+		directory: filepath.Join(aria.Config.DataDir, EDGE_DIRECTORY),
+		versions:  make(map[string]Version),
+		lock:      &sync.Mutex{},
+		stop:      make(chan struct{}),
+		wg:        &sync.WaitGroup{},
+	}
+
+	err := os.MkdirAll(n.directory, 0755)
+	if err != nil {
+		return nil, err
+	}
+
+	d, err := os.ReadFile(filepath.Join(n.directory, STATE_FILE))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	if err == nil {
+		state := &edgeState{}
+
+		err = gob.NewDecoder(bytes.NewReader(d)).Decode(state)
+		if err != nil {
+			return nil, err
+		}
+
+		n.versions = state.Versions
+		n.cursor = state.Cursor
+		n.seq = state.Seq
+	}
+
+	// Hub changes and the outbox are newer than the saved versions
+	err = readRecords(filepath.Join(n.directory, CHANGES_FILE), func(c *Change) {
+		n.changes = append(n.changes, c)
+		n.seq = max(n.seq, c.Seq)
+		n.setVersion(c)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = readRecords(filepath.Join(n.directory, OUTBOX_FILE), func(c *Change) {
+		n.outbox = append(n.outbox, c)
+		n.setVersion(c)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return n, nil
+}
+
+// Start starts accepting edge nodes if this node is a hub and syncing with the hub if this node is an edge node
+func (n *Node) Start() error {
+	if n.config.Listen != "" {
+		var err error
+
+		n.listener, err = net.Listen("tcp", n.config.Listen)
+		if err != nil {
+			return err
+		}
+
+		n.wg.Add(1)
+		go n.accept()
+	}
+
+	if n.config.Hub != "" {
+		interval := DEFAULT_INTERVAL
+		if n.config.Interval > 0 {
+			interval = time.Duration(n.config.Interval) * time.Millisecond
+		}
+
+		n.wg.Add(1)
+		go func() {
+			defer n.wg.Done()
+
+			ticker := time.NewTicker(interval)
+			defer ticker.Stop()
+
+			for {
+				select {
+				case <-n.stop:
+					return
+				case <-ticker.C:
+					// An unreachable hub is expected, changes stay in the outbox until the next sync
+					err := n.Sync()
+					if err != nil {
+						log.Println("edge sync:", err)
+					}
+				}
+			}
+		}()
+	}
+
+	return nil
+}
+
+// Close stops syncing
+func (n *Node) Close() error {
+	close(n.stop)
+
+	if n.listener != nil {
+		n.listener.Close()
+	}
+
+	n.wg.Wait()
+
+	return nil
+}
+
+// rowKey returns the key of a changed row within the versions
+func rowKey(database, table string, value interface{}) string {
+	return fmt.Sprintf("%s/%s/%v", database, table, value)
+}
+
+// newer returns true if version v wins over version o
+func (v Version) newer(o Version) bool {
+	if v.Timestamp != o.Timestamp {
+		return v.Timestamp > o.Timestamp
+	}
+
+	return v.NodeID > o.NodeID
+}
+
+// setVersion sets the version of a row if the change is newer
+func (n *Node) setVersion(c *Change) {
+	key := rowKey(c.Database, c.Table, c.Value)
+
+	if current, ok := n.versions[key]; !ok || c.Version.newer(current) {
+		n.versions[key] = c.Version
+	}
+
+	if c.NodeID == n.config.NodeID && c.Version.Timestamp > n.last {
+		n.last = c.Version.Timestamp
+	}
+}
+
+// syncColumn returns the column identifying rows of a table, the first unique column that is not a sequence
+// Sequences are assigned by each node on its own so they can not identify a row across nodes
+func syncColumn(tbl *catalog.Table) string {
+	columns := make([]string, 0)
+
+	for name := range tbl.TableSchema.ColumnDefinitions {
+		columns = append(columns, name)
+	}
+
+	sort.Strings(columns)
+
+	for _, name := range columns {
+		colDef := tbl.TableSchema.ColumnDefinitions[name]
+		if colDef.Unique && !colDef.Sequence {
+			return name
+		}
+	}
+
+	return ""
+}
+
+// RecordChange records a changed row to sync
+// Rows of tables without a unique column that is not a sequence are not synced
+func (n *Node) RecordChange(database string, table string, deleted bool, row map[string]interface{}) error {
+	db := n.aria.Catalog.GetDatabase(database)
+	if db == nil {
+		return fmt.Errorf("database %s does not exist", database)
+	}
+
+	tbl := db.GetTable(table)
+	if tbl == nil {
+		return fmt.Errorf("table %s does not exist", table)
+	}
+
+	column := syncColumn(tbl)
+	if column == "" {
+		return nil
+	}
+
+	n.lock.Lock()
+	defer n.lock.Unlock()
+
+	// Versions of a node always increase, even if the clock goes back
+	timestamp := time.Now().UnixNano()
+	if timestamp <= n.last {
+		timestamp = n.last + 1
+	}
+
+	c := &Change{
+		NodeID:   n.config.NodeID,
+		Database: database,
+		Table:    table,
+		Column:   column,
+		Value:    row[column],
+		Deleted:  deleted,
+		Row:      catalog.CopyRow(&row),
+		Version:  Version{Timestamp: timestamp, NodeID: n.config.NodeID},
+		Base:     n.versions[rowKey(database, table, row[column])],
+	}
+
+	// An edge node keeps its changes until the hub has them, a hub hands them out right away
+	if n.config.Hub != "" {
+		err := appendRecord(filepath.Join(n.directory, OUTBOX_FILE), c)
+		if err != nil {
+			return err
+		}
+
+		n.outbox = append(n.outbox, c)
+	} else {
+		n.seq++
+		c.Seq = n.seq
+
+		err := appendRecord(filepath.Join(n.directory, CHANGES_FILE), c)
+		if err != nil {
+			return err
+		}
+
+		n.changes = append(n.changes, c)
+	}
+
+	n.setVersion(c)
+
+	return nil
+}
+
+// Sync pushes the outbox to the hub and applies the changes of other nodes
+func (n *Node) Sync() error {
+	n.lock.Lock()
+	req := &SyncRequest{NodeID: n.config.NodeID, Changes: n.outbox, Cursor: n.cursor}
+	n.lock.Unlock()
+
+	conn, err := net.DialTimeout("tcp", n.config.Hub, SYNC_TIMEOUT)
+	if err != nil {
+		return err
+	}
+
+	defer conn.Close()
+
+	conn.SetDeadline(time.Now().Add(SYNC_TIMEOUT))
+
+	err = gob.NewEncoder(conn).Encode(req)
+	if err != nil {
+		return err
+	}
+
+	res := &SyncResponse{}
+
+	err = gob.NewDecoder(conn).Decode(res)
+	if err != nil {
+		return err
+	}
+
+	if res.Error != "" {
+		return errors.New(res.Error)
+	}
+
+	n.aria.WriteGate.RLock()
+	defer n.aria.WriteGate.RUnlock()
+
+	n.lock.Lock()
+	defer n.lock.Unlock()
+
+	for _, conflict := range res.Conflicts {
+		n.conflict(conflict)
+	}
+
+	for _, c := range res.Changes {
+		err = n.apply(c)
+		if err != nil {
+			return err
+		}
+	}
+
+	n.cursor = res.Cursor
+
+	err = n.saveState()
+	if err != nil {
+		return err
+	}
+
+	// Changes recorded while syncing stay in the outbox
+	n.outbox = n.outbox[len(req.Changes):]
+
+	return writeRecords(filepath.Join(n.directory, OUTBOX_FILE), n.outbox)
+}
+
+// accept accepts edge nodes
+func (n *Node) accept() {
+	defer n.wg.Done()
+
+	for {
+		conn, err := n.listener.Accept()
+		if err != nil {
+			select {
+			case <-n.stop:
+				return
+			default:
+				log.Println("edge accept:", err)
+				continue
+			}
+		}
+
+		n.wg.Add(1)
+		go func() {
+			defer n.wg.Done()
+			defer conn.Close()
+
+			conn.SetDeadline(time.Now().Add(SYNC_TIMEOUT))
+
+			req := &SyncRequest{}
+
+			err := gob.NewDecoder(conn).Decode(req)
+			if err != nil {
+				return
+			}
+
+			res, err := n.handle(req)
+			if err != nil {
+				res = &SyncResponse{Error: err.Error()}
+			}
+
+			gob.NewEncoder(conn).Encode(res)
+		}()
+	}
+}
+
+// handle applies the changes of an edge node on the hub, responding with the changes of other nodes
+func (n *Node) handle(req *SyncRequest) (*SyncResponse, error) {
+	n.aria.WriteGate.RLock()
+	defer n.aria.WriteGate.RUnlock()
+
+	n.lock.Lock()
+	defer n.lock.Unlock()
+
+	res := &SyncResponse{}
+
+	conflicts := len(n.conflicts)
+
+	for _, c := range req.Changes {
+		// An outbox pushed twice, if the previous response was lost, is only applied once
+		if current, ok := n.versions[rowKey(c.Database, c.Table, c.Value)]; ok && current == c.Version {
+			continue
+		}
+
+		err := n.apply(c)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Concurrent changes are detected by the edge node itself once it applies the change it ran into
+	for _, conflict := range n.conflicts[conflicts:] {
+		if conflict.Change.NodeID == req.NodeID && conflict.Problem != "" {
+			res.Conflicts = append(res.Conflicts, conflict)
+		}
+	}
+
+	for _, c := range n.changes {
+		if c.Seq > req.Cursor && c.NodeID != req.NodeID {
+			res.Changes = append(res.Changes, c)
+		}
+	}
+
+	res.Cursor = n.seq
+
+	return res, nil
+}
+
+// apply applies a change of another node, last writer wins
+// Hubs record applied changes to hand them out to other edge nodes.  The write gate is taken before the node lock,
+// a statement recording its changes holds the gate while it takes the node lock.
+func (n *Node) apply(c *Change) error {
+	key := rowKey(c.Database, c.Table, c.Value)
+
+	current, exists := n.versions[key]
+
+	// The row was changed since the change's node last saw it
+	concurrent := exists && current != c.Base && current.NodeID != c.NodeID
+
+	if exists && !c.Version.newer(current) {
+		if concurrent {
+			n.conflict(&Conflict{Change: c, Existing: current})
+		}
+
+		return nil
+	}
+
+	err := n.applyRow(c)
+	if err != nil {
+		n.conflict(&Conflict{Change: c, Existing: current, Problem: err.Error()})
+		return nil
+	}
+
+	if concurrent {
+		n.conflict(&Conflict{Change: c, Existing: current, Kept: true})
+	}
+
+	n.versions[key] = c.Version
+
+	if n.config.Listen != "" {
+		accepted := *c
+		n.seq++
+		accepted.Seq = n.seq
+
+		err = appendRecord(filepath.Join(n.directory, CHANGES_FILE), &accepted)
+		if err != nil {
+			return err
+		}
+
+		n.changes = append(n.changes, &accepted)
+	}
+
+	return nil
+}
+
+// applyRow writes a changed row to the catalog as a statement would, appending it to the WAL first
+// The write gate is held by the caller, see apply
+func (n *Node) applyRow(c *Change) error {
+	db := n.aria.Catalog.GetDatabase(c.Database)
+	if db == nil {
+		return fmt.Errorf("database %s does not exist", c.Database)
+	}
+
+	tbl := db.GetTable(c.Table)
+	if tbl == nil {
+		return fmt.Errorf("table %s does not exist", c.Table)
+	}
+
+	idx := tbl.CheckIndexedColumn(c.Column, true)
+	if idx == nil {
+		return fmt.Errorf("column %s is not unique", c.Column)
+	}
+
+	err := n.aria.CheckWrite()
+	if err != nil {
+		return err
+	}
+
+	rowIds, err := tbl.IndexLookup(idx, c.Column, c.Value)
+	if err != nil {
+		return err
+	}
+
+	table := &parser.Identifier{Value: c.Table}
+
+	// The row the change is for, by its unique column
+	where := &parser.WhereClause{SearchCondition: &parser.ComparisonPredicate{
+		Left:  &parser.ValueExpression{Value: &parser.ColumnSpecification{ColumnName: &parser.Identifier{Value: c.Column}}},
+		Op:    parser.OP_EQ,
+		Right: &parser.ValueExpression{Value: &parser.Literal{Value: c.Value}},
+	}}
+
+	if c.Deleted {
+		if len(rowIds) == 0 {
+			return nil
+		}
+
+		err = n.appendWAL(db, &parser.DeleteStmt{TableName: table, WhereClause: where})
+		if err != nil {
+			return err
+		}
+
+		for _, rowId := range rowIds {
+			err = tbl.DeleteRow(rowId)
+			if err != nil {
+				return err
+			}
+		}
+
+		n.aria.Written(c.Database, c.Table)
+
+		return nil
+	}
+
+	// Sequences are assigned by each node on its own
+	row := catalog.CopyRow(&c.Row)
+	for name, colDef := range tbl.TableSchema.ColumnDefinitions {
+		if colDef.Sequence {
+			delete(row, name)
+		}
+	}
+
+	if len(rowIds) == 0 {
+		stmt := &parser.InsertStmt{TableName: table, Values: [][]interface{}{{}}}
+
+		for _, name := range slices.Sorted(maps.Keys(row)) {
+			stmt.ColumnNames = append(stmt.ColumnNames, &parser.Identifier{Value: name})
+			stmt.Values[0] = append(stmt.Values[0], &parser.Literal{Value: row[name]})
+		}
+
+		err = n.appendWAL(db, stmt)
+		if err != nil {
+			return err
+		}
+
+		_, _, err = tbl.Insert([]map[string]interface{}{row}, db)
+		if err != nil {
+			return err
+		}
+
+		n.aria.Written(c.Database, c.Table)
+
+		return nil
+	}
+
+	existing, err := tbl.GetRow(rowIds[0])
+	if err != nil {
+		return err
+	}
+
+	sets := make([]*catalog.SetClause, 0)
+	stmt := &parser.UpdateStmt{TableName: table, WhereClause: where}
+
+	for _, name := range slices.Sorted(maps.Keys(row)) {
+		value := row[name]
+
+		if _, ok := existing[name]; ok && fmt.Sprintf("%v", existing[name]) != fmt.Sprintf("%v", value) {
+			sets = append(sets, &catalog.SetClause{ColumnName: name, Value: value})
+			stmt.SetClause = append(stmt.SetClause, &parser.SetClause{Column: &parser.Identifier{Value: name}, Value: &parser.Literal{Value: value}})
+		}
+	}
+
+	if len(sets) == 0 {
+		return nil
+	}
+
+	err = n.appendWAL(db, stmt)
+	if err != nil {
+		return err
+	}
+
+	err = tbl.UpdateRow(rowIds[0], existing, sets)
+	if err != nil {
+		return err
+	}
+
+	n.aria.Written(c.Database, c.Table)
+
+	return nil
+}
+
+// appendWAL appends the statement writing a changed row to the WAL, after the database it is written to is selected
+// The WAL is replayed by one channel so the database of the change is selected before every change
+func (n *Node) appendWAL(db *catalog.Database, stmt interface{}) error {
+	err := n.aria.WAL.Append(n.aria.WAL.Encode(&parser.UseStmt{DatabaseName: &parser.Identifier{Value: db.Name}}))
+	if err != nil {
+		return err
+	}
+
+	return n.aria.WAL.Append(n.aria.WAL.Encode(stmt))
+}
+
+// conflict records a conflict
+func (n *Node) conflict(conflict *Conflict) {
+	n.conflicts = append(n.conflicts, conflict)
+
+	if conflict.Problem != "" {
+		log.Printf("edge conflict: change of %s to %s.%s %s=%v not applied: %s", conflict.Change.NodeID, conflict.Change.Database, conflict.Change.Table, conflict.Change.Column, conflict.Change.Value, conflict.Problem)
+	} else {
+		kept := conflict.Existing.NodeID
+		if conflict.Kept {
+			kept = conflict.Change.NodeID
+		}
+
+		log.Printf("edge conflict: concurrent changes to %s.%s %s=%v by %s and %s, kept the change of %s", conflict.Change.Database, conflict.Change.Table, conflict.Change.Column, conflict.Change.Value, conflict.Change.NodeID, conflict.Existing.NodeID, kept)
+	}
+
+	err := appendRecord(filepath.Join(n.directory, CONFLICTS_FILE), conflict)
+	if err != nil {
+		log.Println("edge conflict:", err)
+	}
+}
+
+// Conflicts returns the conflicts detected on this node since it was opened
+func (n *Node) Conflicts() []*Conflict {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+
+	return append([]*Conflict{}, n.conflicts...)
+}
+
+// Pending returns the amount of changes not yet synced with the hub
+func (n *Node) Pending() int {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+
+	return len(n.outbox)
+}
+
+// ChangesSize returns the bytes of the changes accepted by this node as a hub and how many of them PurgeChanges would remove
+func (n *Node) ChangesSize(before time.Time, maxBytes int64) (size int64, reclaimable int64, err error) {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+
+	sizes, err := n.changeSizes()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	for _, s := range sizes {
+		size += s
+	}
+
+	for _, s := range sizes[:n.expired(sizes, before, maxBytes)] {
+		reclaimable += s
+	}
+
+	return size, reclaimable, nil
+}
+
+// PurgeChanges removes the changes accepted by this node as a hub before a time, and the oldest changes past maxBytes
+// An edge node whose cursor is before the changes kept misses the changes removed.  The bytes removed are returned.
+func (n *Node) PurgeChanges(before time.Time, maxBytes int64) (int64, error) {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+
+	sizes, err := n.changeSizes()
+	if err != nil {
+		return 0, err
+	}
+
+	expired := n.expired(sizes, before, maxBytes)
+	if expired == 0 {
+		return 0, nil
+	}
+
+	// The versions of the changes removed are only kept by the state from now on
+	err = n.saveState()
+	if err != nil {
+		return 0, err
+	}
+
+	err = writeRecords(filepath.Join(n.directory, CHANGES_FILE), n.changes[expired:])
+	if err != nil {
+		return 0, err
+	}
+
+	purged := int64(0)
+	for _, s := range sizes[:expired] {
+		purged += s
+	}
+
+	n.changes = append([]*Change{}, n.changes[expired:]...)
+
+	return purged, nil
+}
+
+// changeSizes returns the bytes of every change accepted as a hub within the changes file
+func (n *Node) changeSizes() ([]int64, error) {
+	sizes := make([]int64, len(n.changes))
+
+	for i, c := range n.changes {
+		data, err := encodeRecord(c)
+		if err != nil {
+			return nil, err
+		}
+
+		sizes[i] = int64(len(data))
+	}
+
+	return sizes, nil
+}
+
+// expired returns how many of the oldest changes accepted as a hub were changed before a time or are past maxBytes
+// Changes are removed in sequence order, by age up to the first change made since
+func (n *Node) expired(sizes []int64, before time.Time, maxBytes int64) int {
+	expired := 0
+
+	if !before.IsZero() {
+		for expired < len(n.changes) && n.changes[expired].Version.Timestamp < before.UnixNano() {
+			expired++
+		}
+	}
+
+	if maxBytes > 0 {
+		kept := int64(0)
+		for _, s := range sizes[expired:] {
+			kept += s
+		}
+
+		for expired < len(sizes) && kept > maxBytes {
+			kept -= sizes[expired]
+			expired++
+		}
+	}
+
+	return expired
+}
+
+// saveState saves the row versions and hub cursor
+func (n *Node) saveState() error {
+	buff := bytes.NewBuffer([]byte{})
+
+	err := gob.NewEncoder(buff).Encode(&edgeState{Versions: n.versions, Cursor: n.cursor, Seq: n.seq})
+	if err != nil {
+		return err
+	}
+
+	tmp := filepath.Join(n.directory, STATE_FILE+".tmp")
+
+	err = os.WriteFile(tmp, buff.Bytes(), 0644)
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, filepath.Join(n.directory, STATE_FILE))
+}
+
+// encodeRecord encodes a length prefixed record
+func encodeRecord(record interface{}) ([]byte, error) {
+	buff := bytes.NewBuffer([]byte{})
+
+	err := gob.NewEncoder(buff).Encode(record)
+	if err != nil {
+		return nil, err
+	}
+
+	data := make([]byte, 4, 4+buff.Len())
+	binary.LittleEndian.PutUint32(data, uint32(buff.Len()))
+
+	return append(data, buff.Bytes()...), nil
+}
+
+// appendRecord appends a record to a file
+func appendRecord(path string, record interface{}) error {
+	data, err := encodeRecord(record)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+
+	defer file.Close()
+
+	_, err = file.Write(data)
+	if err != nil {
+		return err
+	}
+
+	return file.Sync()
+}
+
+// writeRecords replaces a file with the given changes
+func writeRecords(path string, changes []*Change) error {
+	buff := bytes.NewBuffer([]byte{})
+
+	for _, c := range changes {
+		data, err := encodeRecord(c)
+		if err != nil {
+			return err
+		}
+
+		buff.Write(data)
+	}
+
+	tmp := path + ".tmp"
+
+	err := os.WriteFile(tmp, buff.Bytes(), 0644)
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, path)
+}
+
+// readRecords reads the changes within a file, a record cut short by a crash ends the file
+func readRecords(path string, fn func(c *Change)) error {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	defer file.Close()
+
+	for {
+		var size uint32
+
+		err = binary.Read(file, binary.LittleEndian, &size)
+		if err != nil {
+			return nil
+		}
+
+		data := make([]byte, size)
+
+		_, err = io.ReadFull(file, data)
+		if err != nil {
+			return nil
+		}
+
+		c := &Change{}
+
+		err = gob.NewDecoder(bytes.NewReader(data)).Decode(c)
+		if err != nil {
+			return err
+		}
+
+		fn(c)
+	}
+}
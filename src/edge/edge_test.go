@@ -0,0 +1,275 @@
+// Package edge tests
+// Copyright (C) AriaSQL
+// Author(s): Alex Gaetano Padula
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+package edge
+
+import (
+	"ariasql/catalog"
+	"ariasql/core"
+	"ariasql/executor"
+	"ariasql/parser"
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+// startNode opens an AriaSQL instance in edge sync mode with a shop database
+func startNode(t *testing.T, dataDir string, config *core.Edge) (*core.AriaSQL, *Node, *executor.Executor) {
+	aria, err := core.New(&core.Config{DataDir: dataDir})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	aria.Config.Edge = config
+
+	aria.Catalog = catalog.New(dataDir)
+
+	err = aria.Catalog.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	aria.Channels = make([]*core.Channel, 0)
+	aria.ChannelsLock = &sync.Mutex{}
+
+	node, err := Open(aria)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	aria.ChangeLog = node
+
+	ex := executor.New(aria, aria.OpenChannel(aria.Catalog.GetUser("admin")))
+
+	for _, stmt := range []string{
+		"CREATE DATABASE shop;",
+		"USE shop;",
+		"CREATE TABLE items (sku CHAR(32) NOT NULL UNIQUE, qty INT);",
+	} {
+		execute(t, ex, stmt)
+	}
+
+	return aria, node, ex
+}
+
+// execute parses and executes a statement
+func execute(t *testing.T, ex *executor.Executor, stmt string) {
+	p := parser.NewParser(parser.NewLexer([]byte(stmt)))
+
+	ast, err := p.Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = ex.Execute(ast)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// qty returns the qty of an item, -1 if the item does not exist
+func qty(t *testing.T, aria *core.AriaSQL, sku string) int {
+	tbl := aria.Catalog.GetDatabase("shop").GetTable("items")
+
+	rowIds, err := tbl.IndexLookup(tbl.CheckIndexedColumn("sku", true), "sku", "'"+sku+"'")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(rowIds) == 0 {
+		return -1
+	}
+
+	row, err := tbl.GetRow(rowIds[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return row["qty"].(int)
+}
+
+func TestNode_Sync(t *testing.T) {
+	defer os.RemoveAll("./hub")
+	defer os.RemoveAll("./store")
+
+	storeAria, store, storeEx := startNode(t, "./store", &core.Edge{NodeID: "store", Hub: "127.0.0.1:37960"})
+	defer storeAria.Close()
+	defer store.Close()
+
+	// The edge node accepts writes while the hub is unreachable
+	execute(t, storeEx, "INSERT INTO items (sku, qty) VALUES ('a', 1), ('b', 2);")
+
+	err := store.Sync()
+	if err == nil {
+		t.Fatal("expected error syncing with an unreachable hub")
+	}
+
+	if store.Pending() != 2 {
+		t.Fatalf("expected 2 pending changes, got %d", store.Pending())
+	}
+
+	// Changes of a transaction are recorded once it commits, a rolled back transaction records none
+	execute(t, storeEx, "BEGIN;")
+	execute(t, storeEx, "INSERT INTO items (sku, qty) VALUES ('d', 4);")
+	execute(t, storeEx, "ROLLBACK;")
+
+	execute(t, storeEx, "BEGIN;")
+	execute(t, storeEx, "INSERT INTO items (sku, qty) VALUES ('e', 5);")
+
+	if store.Pending() != 2 {
+		t.Fatalf("expected 2 pending changes before commit, got %d", store.Pending())
+	}
+
+	execute(t, storeEx, "COMMIT;")
+
+	if store.Pending() != 3 {
+		t.Fatalf("expected 3 pending changes after commit, got %d", store.Pending())
+	}
+
+	hubAria, hub, hubEx := startNode(t, "./hub", &core.Edge{NodeID: "hub", Listen: "127.0.0.1:37960"})
+	defer hubAria.Close()
+	defer hub.Close()
+
+	err = hub.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	execute(t, hubEx, "INSERT INTO items (sku, qty) VALUES ('c', 3);")
+
+	entries, err := hubAria.WAL.Entries()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = store.Sync()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Synced rows are logged to the WAL of the node applying them, each after the database it belongs to
+	synced, err := hubAria.WAL.Entries()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if synced-entries != 6 {
+		t.Fatalf("expected 6 WAL entries for the synced rows, got %d", synced-entries)
+	}
+
+	if store.Pending() != 0 {
+		t.Fatalf("expected no pending changes, got %d", store.Pending())
+	}
+
+	if qty(t, hubAria, "a") != 1 || qty(t, hubAria, "b") != 2 {
+		t.Fatal("expected edge rows on the hub")
+	}
+
+	if qty(t, storeAria, "c") != 3 {
+		t.Fatal("expected hub row on the edge node")
+	}
+
+	if qty(t, hubAria, "d") != -1 || qty(t, hubAria, "e") != 5 {
+		t.Fatal("expected only the commited transaction on the hub")
+	}
+
+	// Concurrent changes to the same row, the later one wins on both nodes
+	execute(t, hubEx, "UPDATE items SET qty = 10 WHERE sku = 'a';")
+	execute(t, storeEx, "UPDATE items SET qty = 20 WHERE sku = 'a';")
+	execute(t, storeEx, "DELETE FROM items WHERE sku = 'b';")
+
+	err = store.Sync()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if qty(t, hubAria, "a") != 20 || qty(t, storeAria, "a") != 20 {
+		t.Fatalf("expected qty 20 on both nodes, got %d and %d", qty(t, hubAria, "a"), qty(t, storeAria, "a"))
+	}
+
+	if qty(t, hubAria, "b") != -1 {
+		t.Fatal("expected deleted row to be deleted on the hub")
+	}
+
+	if len(store.Conflicts()) == 0 {
+		t.Fatal("expected conflict to be reported")
+	}
+
+	if len(hub.Conflicts()) == 0 {
+		t.Fatal("expected conflict on the hub")
+	}
+}
+
+func TestNode_PurgeChanges(t *testing.T) {
+	defer os.RemoveAll("./hub")
+
+	hubAria, hub, hubEx := startNode(t, "./hub", &core.Edge{NodeID: "hub", Listen: "127.0.0.1:37961"})
+	defer hubAria.Close()
+
+	execute(t, hubEx, "INSERT INTO items (sku, qty) VALUES ('a', 1), ('b', 2);")
+
+	before := time.Now()
+
+	execute(t, hubEx, "INSERT INTO items (sku, qty) VALUES ('c', 3);")
+
+	size, reclaimable, err := hub.ChangesSize(before, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if size == 0 || reclaimable == 0 || reclaimable >= size {
+		t.Fatalf("expected the first 2 of 3 changes to be reclaimable, got %d of %d bytes", reclaimable, size)
+	}
+
+	purged, err := hub.PurgeChanges(before, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if purged != reclaimable {
+		t.Fatalf("expected %d bytes purged, got %d", reclaimable, purged)
+	}
+
+	// Sequences continue past the changes purged, an edge node behind them only gets the changes kept
+	execute(t, hubEx, "INSERT INTO items (sku, qty) VALUES ('d', 4);")
+
+	res, err := hub.handle(&SyncRequest{NodeID: "store"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(res.Changes) != 2 || res.Changes[0].Seq != 3 || res.Cursor != 4 {
+		t.Fatalf("expected changes 3 and 4, got %d changes up to %d", len(res.Changes), res.Cursor)
+	}
+
+	hub.Close()
+
+	// The sequence is kept across restarts once every change is purged
+	_, err = hub.PurgeChanges(time.Time{}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reopened, err := Open(hubAria)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(reopened.changes) != 0 || reopened.seq != 4 {
+		t.Fatalf("expected no changes up to 4, got %d changes up to %d", len(reopened.changes), reopened.seq)
+	}
+}
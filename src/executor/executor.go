@@ -17,16 +17,35 @@
 package executor
 
 import (
+	"ariasql/advisor"
 	"ariasql/catalog"
+	"ariasql/checkpoint"
+	"ariasql/collation"
 	"ariasql/core"
+	"ariasql/export"
+	"ariasql/migration"
 	"ariasql/parser"
+	"ariasql/plancache"
 	"ariasql/shared"
-	"ariasql/storage/btree"
+	"ariasql/storage"
+	"ariasql/tracing"
+	"ariasql/wait"
+	"bufio"
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"go.opentelemetry.io/otel/attribute"
+	"io"
 	"log"
+	"maps"
 	"math"
 	"os"
+	"path/filepath"
 	"reflect"
 	"slices"
 	"sort"
@@ -35,22 +54,58 @@ import (
 	"sync"
 	"sync/atomic"
 	"time"
+	"unicode/utf8"
 )
 
 // Executor is the main executor structure
 type Executor struct {
-	aria             *core.AriaSQL        // AriaSQL instance pointer
-	ch               *core.Channel        // Channel pointer
-	json             bool                 // Enable JSON output, default is false, set by client from server usually
-	recover          bool                 // Recover flag
-	Transaction      *Transaction         // Transaction statements
-	TransactionBegun bool                 // Transaction begun
-	ResultSetBuffer  []byte               // Result set buffer
-	vars             map[string]*Variable // Defined variables
-	cursors          map[string]*Cursor   // Allocated cursors
-	fetchStatus      atomic.Int32         // Fetch status
-	plan             *Plan                // Execution plan
-	explaining       bool                 // Explaining flag, populates plan
+	aria             *core.AriaSQL                       // AriaSQL instance pointer
+	ch               *core.Channel                       // Channel pointer
+	json             bool                                // Enable JSON output, default is false, set by client from server usually
+	recover          bool                                // Recover flag
+	Transaction      *Transaction                        // Transaction statements
+	TransactionBegun bool                                // Transaction begun
+	ResultSetBuffer  []byte                              // Result set buffer
+	vars             map[string]*Variable                // Defined variables
+	cursors          map[string]*Cursor                  // Allocated cursors
+	fetchStatus      atomic.Int32                        // Fetch status
+	plan             *Plan                               // Execution plan
+	explaining       bool                                // Explaining flag, populates plan
+	depth            int                                 // Depth of nested Execute calls, statements are only replicated at the top level
+	ctx              context.Context                     // Context of the span of the query executed, spans of statements and operators are its children
+	rows             int                                 // Rows returned or changed by the statement executed last
+	ctes             map[string][]map[string]interface{} // Rows of the common table expressions of the select executed, by name
+	collations       map[string]*collation.Collation     // Collations compared in, by name
+	spans            int                                 // Spans open, operators logged by the plan trace are indented by it
+	optimizerTrace   *OptimizerTrace                     // Plans considered for the statement executing, nil unless SET optimizer_trace is on
+	lastTrace        *OptimizerTrace                     // Trace of the statement traced last, returned by SHOW OPTIMIZER TRACE
+	planStep         int                                 // Filters of the statement executing planned so far, cached plans are by statement and step
+	subqueries       *subqueryCache                      // Results of the subqueries of the statement executing, by subquery and correlation key
+	prepared         map[string]*parser.PrepareStmt      // Prepared statements of the session, by name
+	binding          bool                                // Set while EXECUTE runs the statements bound, they are replicated as if sent by the client
+	definer          *catalog.User                       // Definer of the SECURITY DEFINER procedure executing, nil outside of one
+	source           *shared.Source                      // Clock and random numbers of the replicated statement executing, nil outside of one
+	replicated       func()                              // Lets the cluster apply the entries after the statement executing, nil if it was not replicated
+}
+
+// ErrNoPrivilege is wrapped by the errors of statements the user of the session lacks a privilege for
+var ErrNoPrivilege = errors.New("user does not have the privilege")
+
+// RowError is the error of a row of a statement changing several, the rows before it may have been changed
+type RowError struct {
+	Row      int   // Position of the row failing within the rows of the statement, from 0
+	Inserted int   // Rows inserted before the row failed, rows checked before inserting any are not
+	Err      error // Why the row failed
+}
+
+// Error returns the error of the row
+func (e *RowError) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns the error of the row
+func (e *RowError) Unwrap() error {
+	return e.Err
 }
 
 // Variable struct represents a variable on the executor
@@ -68,7 +123,21 @@ type Cursor struct {
 
 // Transaction represents a transaction
 type Transaction struct {
-	Statements []*TransactionStmt // Transaction statements
+	Statements    []*TransactionStmt   // Transaction statements
+	Notifications []*parser.NotifyStmt // Notifications sent once the transaction is commited
+	changes       []*rowChange         // Changed rows recorded once the transaction is commited
+	Isolation     string               // Isolation level of the transaction
+	Began         uint64               // Write sequence the transaction began at
+	Reads         map[string]bool      // Tables read by a repeatable read or serializable transaction
+	committing    bool                 // Set while the statements of the transaction are applied
+}
+
+// rowChange is a change of rows of a table handed to webhooks and recorded in edge sync mode
+type rowChange struct {
+	database  string                   // Database name
+	table     string                   // Table name
+	operation string                   // INSERT, UPDATE or DELETE
+	rows      []map[string]interface{} // Rows after the change
 }
 
 // TransactionStmt represents a transaction statement
@@ -103,12 +172,76 @@ type Step struct {
 	IO        int64      // Number of IO operations
 }
 
+// OptimizerTrace is the trace of the plans considered for a statement, recorded with SET optimizer_trace = ON
+type OptimizerTrace struct {
+	Statement       string        `json:"statement"`                 // Statement traced
+	Tables          []*TableTrace `json:"tables"`                    // Tables read by the statement, in the order they were planned
+	Joins           []*JoinTrace  `json:"joins,omitempty"`           // Joins of common table expressions and table functions with the tables before them
+	Reoptimizations int           `json:"reoptimizations,omitempty"` // Joins re-optimized as an input was far larger than estimated
+	SubqueryHits    int           `json:"subquery_hits,omitempty"`   // Subqueries not executed again as their results for the correlation key were cached
+	SubqueryMisses  int           `json:"subquery_misses,omitempty"` // Subqueries executed as their results for the correlation key were not cached
+	Error           string        `json:"error,omitempty"`           // Error the statement failed with
+}
+
+// TableTrace is how reading a table was planned
+type TableTrace struct {
+	Table        string        `json:"table"`                   // Table name
+	Rows         int64         `json:"rows"`                    // Rows of the table
+	FullScanIO   int64         `json:"full_scan_io"`            // Cost of reading every row
+	Candidates   []*Candidate  `json:"candidates"`              // Columns of predicates considered for an index scan
+	BloomFilters []*BloomTrace `json:"bloom_filters,omitempty"` // Bloom filters skipping segments of a full scan
+	Chosen       string        `json:"chosen"`                  // FULL SCAN or INDEX SCAN
+	Index        string        `json:"index,omitempty"`         // Index of the index scan chosen
+	Reason       string        `json:"reason"`                  // Why the plan was chosen
+}
+
+// Candidate is a column of the predicates considered for an index scan
+type Candidate struct {
+	Column  string `json:"column"`           // Column compared
+	Index   string `json:"index,omitempty"`  // Visible index on the column
+	Unique  bool   `json:"unique,omitempty"` // The index is unique
+	Lookups int    `json:"lookups"`          // Values looked up in the index
+	IO      int64  `json:"io"`               // Cost of the index scan, rows looked up and pages of the index
+	Pruned  string `json:"pruned,omitempty"` // Why the column can not be read with an index scan, empty if it can
+}
+
+// BloomTrace is a bloom filter checked for the segments of a table which can have a value
+type BloomTrace struct {
+	Column string `json:"column"` // Column of the bloom filter
+	IO     int64  `json:"io"`     // Rows of the segments which can have the value
+}
+
+const INFORMATION_SCHEMA = "information_schema" // Schema of the views of the catalog, selected from without a database
+const SYS_SCHEMA = "sys"                        // Schema of the views of the server's sessions and statements, selected from without a database
+const DEFAULT_MAX_RECURSION = 1000              // Iterations the recursive query of a WITH RECURSIVE statement can run if not configured
+const MAX_SERIES_ROWS = 10000000                // Rows generate_series can return
+const COPY_BUFFER_SIZE = 64 * 1024              // Bytes of rows COPY ... TO STDOUT writes to the client at once
+const COPY_BATCH_ROWS = 1000                    // Rows COPY ... FROM STDIN inserts at once
+const COPY_END = "\\."                          // Line ending the rows of a COPY, a value of \. is escaped so no row is read as the end
+const ADAPTIVE_MISESTIMATE = 100                // An input of a join this many times larger than estimated re-optimizes the join
+const TABLE_FUNCTION_ROWS = 10                  // Rows a table function is estimated to return when a join is planned
+const DEFAULT_MAX_REOPTIMIZATIONS = 3           // Joins a select re-optimizes if not configured
+const HASH_JOIN = "HASH JOIN"                   // Join looking up a hash table built on the smaller input
+const INDEX_NESTED_LOOP = "INDEX NESTED LOOP"   // Join looking up every combination joined before in an index of the table
+const NESTED_LOOP = "NESTED LOOP"               // Join of every combination joined before with every row of the table
+const RUNTIME_FILTER_MAX_ROWS = 10000           // Rows joined before a hash join is built on at most to push a runtime filter into the scan of the table
+const DEFAULT_SUBQUERY_CACHE_ROWS = 100000      // Rows of subquery results a statement memoizes if not configured
+
+// TableFunction returns the rows of a table function called within a FROM clause
+// Arguments are literals as the parser keeps them, a string quoted, a number an uint64, a negative number an int, a decimal a float64
+// Strings within the rows returned are quoted as within the rows of a table
+type TableFunction func(args []interface{}) ([]map[string]interface{}, error)
+
+var tableFunctions = map[string]TableFunction{"generate_series": generateSeries} // Built-in table functions by name
+var tableFunctionsLock = &sync.RWMutex{}                                         // Table functions lock
+
 type EXPLAIN_OP int // When explaining execution we append to explain
 
 const (
 	EXPLAIN_SELECT EXPLAIN_OP = iota
 	FULL_SCAN
 	INDEX_SCAN
+	BLOOM_SCAN
 )
 
 // New creates a new Executor
@@ -116,11 +249,105 @@ const (
 // You must pass in a pointer to an AriaSQL instance and a pointer to a Channel instance
 // they should be created before calling this function
 func New(aria *core.AriaSQL, ch *core.Channel) *Executor {
-	return &Executor{ch: ch, aria: aria}
+	return &Executor{ch: ch, aria: aria, ctx: context.Background()}
 }
 
 // Execute executes an abstract syntax tree statement
 func (ex *Executor) Execute(stmt parser.Statement) error {
+	if ex.depth == 0 {
+		ex.rows = 0
+		ex.planStep = 0
+		ex.subqueries = nil
+	}
+
+	// Debug output of the session enabled with SET trace
+	top := ex.depth == 0 && ex.ch != nil && len(ex.ch.Trace) > 0
+
+	var started time.Time
+	var before storage.IOStats
+	if top {
+		started, before = time.Now(), storage.Stats()
+	}
+
+	end := ex.startSpan("execute "+tracing.Operation(stmt), attribute.String("db.operation.name", tracing.Operation(stmt)))
+
+	// The plans considered for the statements reading tables are traced with SET optimizer_trace = ON
+	optimize := ex.depth == 0 && ex.ch != nil && ex.ch.OptimizerTrace && optimized(stmt)
+	if optimize {
+		ex.optimizerTrace = &OptimizerTrace{Statement: tracing.Operation(stmt), Tables: []*TableTrace{}}
+		if query := ex.ch.Query(); query != nil {
+			ex.optimizerTrace.Statement = query.Text
+		}
+	}
+
+	// Statements writing wait for a checkpoint being taken, a checkpoint waits for them
+	if ex.depth == 0 && ex.aria != nil && !ex.recover && gated(stmt) {
+		ex.aria.WriteGate.RLock()
+		defer ex.aria.WriteGate.RUnlock()
+	}
+
+	err := ex.execute(stmt)
+	end(err)
+
+	if err == nil {
+		ex.invalidatePlans(stmt)
+	}
+
+	if optimize {
+		if err != nil {
+			ex.optimizerTrace.Error = err.Error()
+		}
+
+		ex.lastTrace, ex.optimizerTrace = ex.optimizerTrace, nil
+	}
+
+	if top {
+		ex.traceStatement(stmt, time.Since(started), storage.Stats().Sub(before), err)
+	}
+
+	// A write failing as the disk is full turns the server read-only
+	if err != nil && ex.depth == 0 && ex.aria != nil && ex.aria.DiskFull(err) {
+		return fmt.Errorf("%w, the server is read-only until space is freed", err)
+	}
+
+	return err
+}
+
+// gated returns true if a statement may write while it runs, all but selects, LOAD INTO CACHE and CHECKPOINT itself
+func gated(stmt parser.Statement) bool {
+	switch stmt.(type) {
+	case *parser.SelectStmt, *parser.LoadIntoCacheStmt, *parser.CheckpointStmt:
+		return false
+	}
+
+	return true
+}
+
+// topLevel returns true if the statement executing is replicated on its own, a top level statement or one EXECUTE binds
+func (ex *Executor) topLevel() bool {
+	return ex.depth == 1 || ex.binding && ex.depth == 2
+}
+
+// execute executes a statement
+func (ex *Executor) execute(stmt parser.Statement) error {
+	ex.depth++
+	defer func() { ex.depth-- }()
+
+	// The cluster applies the entries after a replicated statement once it executed
+	defer func() {
+		if ex.replicated != nil && ex.topLevel() {
+			ex.replicated()
+			ex.source, ex.replicated = nil, nil
+		}
+	}()
+
+	// In cluster mode a follower only serves reads while it is close enough to the leader
+	if _, ok := stmt.(*parser.SelectStmt); ok && ex.aria != nil && ex.aria.Replicator != nil && !ex.recover {
+		err := ex.aria.Replicator.CheckRead()
+		if err != nil {
+			return err
+		}
+	}
 
 	// If we are explaining an execution we will create a new plan
 	if ex.explaining {
@@ -137,8 +364,8 @@ func (ex *Executor) Execute(stmt parser.Statement) error {
 			return errors.New("no database selected")
 		}
 
-		if !ex.ch.User.HasPrivilege(ex.ch.Database.Name, "*", []shared.PrivilegeAction{shared.PRIV_COMMIT}) {
-			return errors.New("user does not have the privilege to BEGIN a transaction on system. A user must have BEGIN privilege for specific database")
+		if !ex.currentUser().HasPrivilege(ex.ch.Database.Name, "*", []shared.PrivilegeAction{shared.PRIV_COMMIT}) {
+			return fmt.Errorf("%w to BEGIN a transaction on system. A user must have BEGIN privilege for specific database", ErrNoPrivilege)
 		}
 
 		// Check if transactions already begun
@@ -149,10 +376,18 @@ func (ex *Executor) Execute(stmt parser.Statement) error {
 		// Set transaction begun flag
 		ex.TransactionBegun = true
 
-		ex.Transaction = &Transaction{Statements: []*TransactionStmt{}} // Initialize the transaction
+		ex.Transaction = &Transaction{Statements: []*TransactionStmt{}, Isolation: core.ISOLATION_READ_COMMITTED, Reads: make(map[string]bool)} // Initialize the transaction
+
+		if !ex.recover {
+			if ex.ch.Isolation != "" {
+				ex.Transaction.Isolation = ex.ch.Isolation
+			}
+
+			ex.Transaction.Began = ex.aria.WriteSequence()
+		}
 
 		// Append to wal
-		err := ex.aria.WAL.Append(ex.aria.WAL.Encode(s))
+		err := ex.appendWAL(s)
 		if err != nil {
 			return err
 		}
@@ -166,8 +401,8 @@ func (ex *Executor) Execute(stmt parser.Statement) error {
 		}
 
 		// Check user has the privilege to rollback
-		if !ex.ch.User.HasPrivilege(ex.ch.Database.Name, "*", []shared.PrivilegeAction{shared.PRIV_ROLLBACK}) {
-			return errors.New("user does not have the privilege to ROLLBACK transaction on system. A user must have ROLLBACK privilege for specific database")
+		if !ex.currentUser().HasPrivilege(ex.ch.Database.Name, "*", []shared.PrivilegeAction{shared.PRIV_ROLLBACK}) {
+			return fmt.Errorf("%w to ROLLBACK transaction on system. A user must have ROLLBACK privilege for specific database", ErrNoPrivilege)
 		}
 
 		// Check if transaction has begun
@@ -176,7 +411,7 @@ func (ex *Executor) Execute(stmt parser.Statement) error {
 		}
 
 		// Append to wal
-		err := ex.aria.WAL.Append(ex.aria.WAL.Encode(s))
+		err := ex.appendWAL(s)
 		if err != nil {
 			return err
 		}
@@ -195,12 +430,44 @@ func (ex *Executor) Execute(stmt parser.Statement) error {
 		}
 
 		// Check user has the privilege to commit
-		if !ex.ch.User.HasPrivilege(ex.ch.Database.Name, "*", []shared.PrivilegeAction{shared.PRIV_COMMIT}) {
-			return errors.New("user does not have the privilege to COMMIT transactions on system. A user must have COMMIT privilege for specific database")
+		if !ex.currentUser().HasPrivilege(ex.ch.Database.Name, "*", []shared.PrivilegeAction{shared.PRIV_COMMIT}) {
+			return fmt.Errorf("%w to COMMIT transactions on system. A user must have COMMIT privilege for specific database", ErrNoPrivilege)
+		}
+
+		// A repeatable read transaction only commits if none of the tables it updates or deletes from were written since
+		// it began, a serializable transaction neither if the tables it read were.  The tables are validated and the
+		// statements applied while no other such transaction commits
+		if ex.TransactionBegun && ex.Transaction.isolated() && !ex.recover {
+			ex.aria.CommitLock.Lock()
+			defer ex.aria.CommitLock.Unlock()
+
+			var tables []string
+			for _, tx := range ex.Transaction.Statements {
+				switch ss := tx.Stmt.(type) {
+				case *parser.UpdateStmt:
+					tables = append(tables, ss.TableName.Value)
+				case *parser.DeleteStmt:
+					tables = append(tables, ss.TableName.Value)
+				}
+			}
+
+			if ex.Transaction.Isolation == core.ISOLATION_SERIALIZABLE {
+				for table := range ex.Transaction.Reads {
+					tables = append(tables, table)
+				}
+			}
+
+			for _, table := range tables {
+				if ex.aria.WrittenSince(ex.ch.Database.Name, table, ex.Transaction.Began) {
+					return ex.serializationFailure(table)
+				}
+			}
+
+			ex.Transaction.committing = true
 		}
 
 		// Append to wal
-		err := ex.aria.WAL.Append(ex.aria.WAL.Encode(s))
+		err := ex.appendWAL(s)
 		if err != nil {
 			return err
 		}
@@ -227,10 +494,12 @@ func (ex *Executor) Execute(stmt parser.Statement) error {
 				rowIds, deletedRows, err := ex.executeDeleteStmt(ss)
 				if err != nil {
 					// If an error occurs, rollback the transaction
-					err = ex.rollback()
-					if err != nil {
-						return err
+					rollbackErr := ex.rollback()
+					if rollbackErr != nil {
+						return rollbackErr
 					}
+
+					return err
 				}
 
 				if ex.TransactionBegun { // If transaction has begun
@@ -264,10 +533,11 @@ func (ex *Executor) Execute(stmt parser.Statement) error {
 				rowIds, updatedRows, err := ex.executeUpdateStmt(ss)
 				if err != nil {
 					// If an error occurs, rollback the transaction
-					err = ex.rollback()
-					if err != nil {
-						return err
+					rollbackErr := ex.rollback()
+					if rollbackErr != nil {
+						return rollbackErr
 					}
+
 					return err
 				}
 
@@ -311,7 +581,7 @@ func (ex *Executor) Execute(stmt parser.Statement) error {
 				}
 
 				// Check if user has the privilege to insert into the table
-				if !ex.ch.User.HasPrivilege(ex.ch.Database.Name, tbl.Name, []shared.PrivilegeAction{shared.PRIV_INSERT}) {
+				if !ex.currentUser().HasPrivilege(ex.ch.Database.Name, tbl.Name, []shared.PrivilegeAction{shared.PRIV_INSERT}) {
 					if j > 0 {
 						// rollback
 						err := ex.rollback()
@@ -319,7 +589,7 @@ func (ex *Executor) Execute(stmt parser.Statement) error {
 							return err
 						}
 					}
-					return errors.New("user does not have the privilege to INSERT on system for database " + ex.ch.Database.Name + " and table " + ss.TableName.Value)
+					return fmt.Errorf("%w to INSERT on system for database %s and table %s", ErrNoPrivilege, ex.ch.Database.Name, ss.TableName.Value)
 				}
 
 				// Rows to be inserted
@@ -341,6 +611,8 @@ func (ex *Executor) Execute(stmt parser.Statement) error {
 
 				}
 
+				ex.resolveDefaults(tbl, rows)
+
 				// We get inserted rowIds and inserted rows in case of rollback
 				rowIds, insertedRows, err := tbl.Insert(rows, ex.ch.Database)
 				if err != nil {
@@ -354,6 +626,11 @@ func (ex *Executor) Execute(stmt parser.Statement) error {
 					return err
 				}
 
+				err = ex.recordChanges(tbl, "INSERT", insertedRows)
+				if err != nil {
+					return err
+				}
+
 				for i, rowId := range rowIds {
 					ex.Transaction.Statements[j].Rollback.Rows = append(ex.Transaction.Statements[len(ex.Transaction.Statements)-1].Rollback.Rows, &Before{
 						RowId: rowId,
@@ -365,14 +642,30 @@ func (ex *Executor) Execute(stmt parser.Statement) error {
 			}
 		}
 
+		// Record the rows the transaction changed now that it has been commited
+		for _, change := range ex.Transaction.changes {
+			err = ex.emitChange(change)
+			if err != nil {
+				return err
+			}
+		}
+
+		// Send the notifications of the transaction now that it has been commited
+		for _, notify := range ex.Transaction.Notifications {
+			err = ex.notify(notify)
+			if err != nil {
+				return err
+			}
+		}
+
 		// Transaction has been commited
 		ex.TransactionBegun = false // Reset transaction begun flag
 
 		return nil
 	case *parser.CreateDatabaseStmt:
 		if !ex.recover { // If not recovering from WAL, check if user has the privilege to create a database
-			if !ex.ch.User.HasPrivilege("*", "*", []shared.PrivilegeAction{shared.PRIV_CREATE}) {
-				return errors.New("user does not have the privilege to CREATE on system. A user must have CREATE privilege system wide")
+			if !ex.currentUser().HasPrivilege("*", "*", []shared.PrivilegeAction{shared.PRIV_CREATE}) {
+				return fmt.Errorf("%w to CREATE on system. A user must have CREATE privilege system wide", ErrNoPrivilege)
 			}
 		}
 
@@ -381,14 +674,19 @@ func (ex *Executor) Execute(stmt parser.Statement) error {
 			return errors.New("statement not allowed in a transaction")
 		}
 
+		settings, err := tableSettings(s.Defaults, catalog.DatabaseSettings{})
+		if err != nil {
+			return err
+		}
+
 		// Append the statement to the WAL file
-		err := ex.aria.WAL.Append(ex.aria.WAL.Encode(s))
+		err = ex.appendWAL(s)
 		if err != nil {
 			return err
 		}
 
 		// Create the database
-		return ex.aria.Catalog.CreateDatabase(s.Name.Value)
+		return ex.aria.Catalog.CreateDatabaseWithSettings(s.Name.Value, &settings)
 	case *parser.CreateTableStmt:
 
 		// Check if a database is selected
@@ -397,8 +695,8 @@ func (ex *Executor) Execute(stmt parser.Statement) error {
 		}
 
 		if !ex.recover { // If not recovering from WAL
-			if !ex.ch.User.HasPrivilege(ex.ch.Database.Name, "", []shared.PrivilegeAction{shared.PRIV_CREATE}) {
-				return errors.New("user does not have the privilege to CREATE on system for database " + ex.ch.Database.Name)
+			if !ex.currentUser().HasPrivilege(ex.ch.Database.Name, "", []shared.PrivilegeAction{shared.PRIV_CREATE}) {
+				return fmt.Errorf("%w to CREATE on system for database %s", ErrNoPrivilege, ex.ch.Database.Name)
 			}
 		}
 
@@ -406,23 +704,45 @@ func (ex *Executor) Execute(stmt parser.Statement) error {
 			return errors.New("statement not allowed in a transaction")
 		}
 
-		// Append the statement to the WAL file
-		err := ex.aria.WAL.Append(ex.aria.WAL.Encode(s))
+		// The table inherits the defaults of the database, its WITH settings override them
+		defaults := catalog.DatabaseSettings{}
+		if ex.ch.Database.Settings != nil {
+			defaults = *ex.ch.Database.Settings
+		}
+
+		settings, err := tableSettings(s.Settings, defaults)
 		if err != nil {
 			return err
 		}
 
+		compress := s.Compress || settings.Compress
+		encrypt := s.Encrypt || settings.Encrypt
+
 		var encKey string
 
 		if s.EncryptKey != nil {
 
-			encKey := s.EncryptKey.Value.(string) // if any
+			encKey = s.EncryptKey.Value.(string) // if any
 
 			encKey = strings.TrimSuffix(strings.TrimPrefix(encKey, "'"), "'")
 		}
 
+		if encrypt && encKey == "" {
+			return fmt.Errorf("database %s encrypts new tables, give a key with ENCRYPT('key') or create the table WITH (encrypt = false)", ex.ch.Database.Name)
+		}
+
+		if s.TableSchema != nil {
+			s.TableSchema.Collation = settings.Collation
+		}
+
+		// Append the statement to the WAL file
+		err = ex.appendWAL(s)
+		if err != nil {
+			return err
+		}
+
 		// Create the table
-		err = ex.ch.Database.CreateTable(s.TableName.Value, s.TableSchema, s.Encrypt, s.Compress, []byte(encKey))
+		err = ex.ch.Database.CreateTable(s.TableName.Value, s.TableSchema, encrypt, compress, []byte(encKey))
 		if err != nil {
 			return err
 		}
@@ -436,8 +756,8 @@ func (ex *Executor) Execute(stmt parser.Statement) error {
 		}
 
 		if !ex.recover { // If not recovering from WAL
-			if !ex.ch.User.HasPrivilege(ex.ch.Database.Name, s.TableName.Value, []shared.PrivilegeAction{shared.PRIV_CREATE}) {
-				return errors.New("user does not have the privilege to DROP on system for database " + ex.ch.Database.Name)
+			if !ex.currentUser().HasPrivilege(ex.ch.Database.Name, s.TableName.Value, []shared.PrivilegeAction{shared.PRIV_CREATE}) {
+				return fmt.Errorf("%w to DROP on system for database %s", ErrNoPrivilege, ex.ch.Database.Name)
 			}
 		}
 
@@ -446,7 +766,7 @@ func (ex *Executor) Execute(stmt parser.Statement) error {
 		}
 
 		// Append the statement to the WAL file
-		err := ex.aria.WAL.Append(ex.aria.WAL.Encode(s))
+		err := ex.appendWAL(s)
 		if err != nil {
 			return err
 		}
@@ -468,8 +788,8 @@ func (ex *Executor) Execute(stmt parser.Statement) error {
 		}
 
 		if !ex.recover { // If not recovering from WAL
-			if !ex.ch.User.HasPrivilege(ex.ch.Database.Name, "*", []shared.PrivilegeAction{shared.PRIV_CREATE}) {
-				return errors.New("user does not have the privilege to CREATE on system for database " + ex.ch.Database.Name)
+			if !ex.currentUser().HasPrivilege(ex.ch.Database.Name, "*", []shared.PrivilegeAction{shared.PRIV_CREATE}) {
+				return fmt.Errorf("%w to CREATE on system for database %s", ErrNoPrivilege, ex.ch.Database.Name)
 			}
 		}
 
@@ -487,7 +807,7 @@ func (ex *Executor) Execute(stmt parser.Statement) error {
 		}
 
 		// Append the statement to the WAL file
-		err := ex.aria.WAL.Append(ex.aria.WAL.Encode(s))
+		err := ex.appendWAL(s)
 		if err != nil {
 			return err
 		}
@@ -511,8 +831,8 @@ func (ex *Executor) Execute(stmt parser.Statement) error {
 		}
 
 		if !ex.recover { // If not recovering from WAL
-			if !ex.ch.User.HasPrivilege(ex.ch.Database.Name, "*", []shared.PrivilegeAction{shared.PRIV_CREATE}) {
-				return errors.New("user does not have the privilege to DROP on system for database " + ex.ch.Database.Name)
+			if !ex.currentUser().HasPrivilege(ex.ch.Database.Name, "*", []shared.PrivilegeAction{shared.PRIV_CREATE}) {
+				return fmt.Errorf("%w to DROP on system for database %s", ErrNoPrivilege, ex.ch.Database.Name)
 			}
 		}
 
@@ -523,7 +843,7 @@ func (ex *Executor) Execute(stmt parser.Statement) error {
 		}
 
 		// Append the statement to the WAL file
-		err := ex.aria.WAL.Append(ex.aria.WAL.Encode(s))
+		err := ex.appendWAL(s)
 		if err != nil {
 			return err
 		}
@@ -534,6 +854,119 @@ func (ex *Executor) Execute(stmt parser.Statement) error {
 			return err
 		}
 
+		return nil
+	case *parser.AlterIndexStmt:
+
+		// Check if a database is selected
+		if ex.ch.Database == nil {
+			return errors.New("no database selected")
+		}
+
+		if ex.TransactionBegun {
+			return errors.New("statement not allowed in a transaction")
+		}
+
+		if !ex.recover { // If not recovering from WAL
+			if !ex.currentUser().HasPrivilege(ex.ch.Database.Name, s.TableName.Value, []shared.PrivilegeAction{shared.PRIV_ALTER}) {
+				return fmt.Errorf("%w to ALTER on table %s", ErrNoPrivilege, s.TableName.Value)
+			}
+		}
+
+		// Get the table
+		tbl := ex.ch.Database.GetTable(s.TableName.Value)
+		if tbl == nil {
+			return errors.New("table does not exist")
+		}
+
+		// Append the statement to the WAL file
+		err := ex.appendWAL(s)
+		if err != nil {
+			return err
+		}
+
+		if s.Visibility != 0 {
+			// An invisible index is ignored by the optimizer but still maintained, it can be made visible again at no cost
+			return tbl.SetIndexVisible(s.IndexName.Value, s.Visibility == parser.ALTER_INDEX_VISIBLE)
+		}
+
+		// Rename the index
+		err = tbl.RenameIndex(s.IndexName.Value, s.NewName.Value)
+		if err != nil {
+			return err
+		}
+
+		return nil
+	case *parser.CreateBloomFilterStmt:
+
+		// Check if a database is selected
+		if ex.ch.Database == nil {
+			return errors.New("no database selected")
+		}
+
+		if ex.TransactionBegun {
+			return errors.New("statement not allowed in a transaction")
+		}
+
+		if !ex.recover { // If not recovering from WAL
+			if !ex.currentUser().HasPrivilege(ex.ch.Database.Name, "*", []shared.PrivilegeAction{shared.PRIV_CREATE}) {
+				return fmt.Errorf("%w to CREATE on system for database %s", ErrNoPrivilege, ex.ch.Database.Name)
+			}
+		}
+
+		// Get the table
+		tbl := ex.ch.Database.GetTable(s.TableName.Value)
+		if tbl == nil {
+			return errors.New("table does not exist")
+		}
+
+		// Append the statement to the WAL file
+		err := ex.appendWAL(s)
+		if err != nil {
+			return err
+		}
+
+		// Create the bloom filter, it is filled from the rows of the table
+		err = tbl.CreateBloomFilter(s.FilterName.Value, s.ColumnName.Value)
+		if err != nil {
+			return err
+		}
+
+		return nil
+	case *parser.DropBloomFilterStmt:
+
+		// Check if a database is selected
+		if ex.ch.Database == nil {
+			return errors.New("no database selected")
+		}
+
+		if ex.TransactionBegun {
+			return errors.New("statement not allowed in a transaction")
+		}
+
+		if !ex.recover { // If not recovering from WAL
+			if !ex.currentUser().HasPrivilege(ex.ch.Database.Name, "*", []shared.PrivilegeAction{shared.PRIV_CREATE}) {
+				return fmt.Errorf("%w to DROP on system for database %s", ErrNoPrivilege, ex.ch.Database.Name)
+			}
+		}
+
+		// Get the table
+		tbl := ex.ch.Database.GetTable(s.TableName.Value)
+		if tbl == nil {
+			return errors.New("table does not exist")
+		}
+
+		// Append the statement to the WAL file
+		err := ex.appendWAL(s)
+		if err != nil {
+			return err
+		}
+
+		// Drop the bloom filter
+		err = tbl.DropBloomFilter(s.FilterName.Value)
+		if err != nil {
+			return err
+		}
+
 		return nil
 	case *parser.InsertStmt:
 
@@ -549,13 +982,13 @@ func (ex *Executor) Execute(stmt parser.Statement) error {
 		}
 
 		if !ex.recover { // If not recovering from WAL
-			if !ex.ch.User.HasPrivilege(ex.ch.Database.Name, s.TableName.Value, []shared.PrivilegeAction{shared.PRIV_CREATE}) {
-				return errors.New("user does not have the privilege to INSERT on system for database " + ex.ch.Database.Name + " and table " + s.TableName.Value)
+			if !ex.currentUser().HasPrivilege(ex.ch.Database.Name, s.TableName.Value, []shared.PrivilegeAction{shared.PRIV_CREATE}) {
+				return fmt.Errorf("%w to INSERT on system for database %s and table %s", ErrNoPrivilege, ex.ch.Database.Name, s.TableName.Value)
 			}
 		}
 
 		// Append the statement to the WAL file
-		err := ex.aria.WAL.Append(ex.aria.WAL.Encode(stmt))
+		err := ex.appendWAL(stmt)
 		if err != nil {
 			return err
 		}
@@ -578,16 +1011,18 @@ func (ex *Executor) Execute(stmt parser.Statement) error {
 
 		}
 
+		ex.resolveDefaults(tbl, rows)
+
 		// Check table schema constraints for check
 		for name, colDef := range tbl.TableSchema.ColumnDefinitions {
 			if colDef.Check != nil {
-				for _, row := range rows {
+				for i, row := range rows {
 					r := []map[string]interface{}{row}
 					t := []*catalog.Table{tbl}
 					var fr []map[string]interface{}
 
 					if !ex.evaluateCondition(colDef.Check, &r, t, &fr) {
-						return errors.New("check constraint failed for column " + name)
+						return &RowError{Row: i, Err: errors.New("check constraint failed for column " + name)}
 					}
 				}
 			}
@@ -601,7 +1036,20 @@ func (ex *Executor) Execute(stmt parser.Statement) error {
 			})
 		} else {
 
-			_, _, err = tbl.Insert(rows, ex.ch.Database)
+			_, inserted, err := tbl.Insert(rows, ex.ch.Database)
+			if err != nil {
+				// The rows inserted before the row failing are kept
+				if len(inserted) > 0 {
+					changeErr := ex.recordChanges(tbl, "INSERT", inserted)
+					if changeErr != nil {
+						return changeErr
+					}
+				}
+
+				return &RowError{Row: len(inserted), Inserted: len(inserted), Err: err}
+			}
+
+			err = ex.recordChanges(tbl, "INSERT", rows)
 			if err != nil {
 				return err
 			}
@@ -620,7 +1068,7 @@ func (ex *Executor) Execute(stmt parser.Statement) error {
 		}
 
 		// Append the statement to the WAL file
-		err := ex.aria.WAL.Append(ex.aria.WAL.Encode(s))
+		err := ex.appendWAL(s)
 		if err != nil {
 			return err
 		}
@@ -635,13 +1083,13 @@ func (ex *Executor) Execute(stmt parser.Statement) error {
 		}
 
 		if !ex.recover { // If not recovering from WAL
-			if !ex.ch.User.HasPrivilege(stmt.(*parser.DropDatabaseStmt).Name.Value, "*", []shared.PrivilegeAction{shared.PRIV_CREATE}) {
-				return errors.New("user does not have the privilege to INSERT on system for database " + stmt.(*parser.DropDatabaseStmt).Name.Value)
+			if !ex.currentUser().HasPrivilege(stmt.(*parser.DropDatabaseStmt).Name.Value, "*", []shared.PrivilegeAction{shared.PRIV_CREATE}) {
+				return fmt.Errorf("%w to INSERT on system for database %s", ErrNoPrivilege, stmt.(*parser.DropDatabaseStmt).Name.Value)
 			}
 		}
 
 		// Append the statement to the WAL file
-		err := ex.aria.WAL.Append(ex.aria.WAL.Encode(s))
+		err := ex.appendWAL(s)
 		if err != nil {
 			return err
 		}
@@ -660,13 +1108,13 @@ func (ex *Executor) Execute(stmt parser.Statement) error {
 		return nil
 
 	case *parser.SelectStmt:
-		// Check if a database is selected
-		if ex.ch.Database == nil {
+		// Check if a database is selected, system views and table functions do not need one
+		if _, ok := systemView(s); ex.ch.Database == nil && !ok && !readsTableFunctionsOnly(s) {
 			return errors.New("no database selected")
 		}
 
-		// Check if transaction has begun
-		if ex.TransactionBegun {
+		// Only a repeatable read or serializable transaction reads, the tables it reads are checked for writes
+		if ex.TransactionBegun && !ex.Transaction.isolated() {
 			return errors.New("statement not allowed in a transaction")
 		}
 
@@ -686,7 +1134,7 @@ func (ex *Executor) Execute(stmt parser.Statement) error {
 		}
 
 		// Append the statement to the WAL file
-		err := ex.aria.WAL.Append(ex.aria.WAL.Encode(s))
+		err := ex.appendWAL(s)
 		if err != nil {
 			return err
 		}
@@ -717,7 +1165,7 @@ func (ex *Executor) Execute(stmt parser.Statement) error {
 		}
 
 		// Append the statement to the WAL file
-		err := ex.aria.WAL.Append(ex.aria.WAL.Encode(s))
+		err := ex.appendWAL(s)
 		if err != nil {
 			return err
 		}
@@ -741,8 +1189,8 @@ func (ex *Executor) Execute(stmt parser.Statement) error {
 		return nil
 	case *parser.CreateUserStmt:
 		if !ex.recover { // If not recovering from WAL
-			if !ex.ch.User.HasPrivilege("*", "*", []shared.PrivilegeAction{shared.PRIV_CREATE}) {
-				return errors.New("user does not have the privilege to CREATE on system")
+			if !ex.currentUser().HasPrivilege("*", "*", []shared.PrivilegeAction{shared.PRIV_CREATE}) {
+				return fmt.Errorf("%w to CREATE on system", ErrNoPrivilege)
 			}
 		}
 
@@ -752,7 +1200,7 @@ func (ex *Executor) Execute(stmt parser.Statement) error {
 		}
 
 		// Append the statement to the WAL file
-		err := ex.aria.WAL.Append(ex.aria.WAL.Encode(s))
+		err := ex.appendWAL(s)
 		if err != nil {
 			return err
 		}
@@ -767,8 +1215,8 @@ func (ex *Executor) Execute(stmt parser.Statement) error {
 
 	case *parser.DropUserStmt:
 		if !ex.recover { // If not recovering from WAL
-			if !ex.ch.User.HasPrivilege("*", "*", []shared.PrivilegeAction{shared.PRIV_CREATE}) {
-				return errors.New("user does not have the privilege to DROP on system")
+			if !ex.currentUser().HasPrivilege("*", "*", []shared.PrivilegeAction{shared.PRIV_CREATE}) {
+				return fmt.Errorf("%w to DROP on system", ErrNoPrivilege)
 			}
 		}
 
@@ -777,7 +1225,7 @@ func (ex *Executor) Execute(stmt parser.Statement) error {
 			return errors.New("statement not allowed in a transaction")
 		}
 
-		err := ex.aria.WAL.Append(ex.aria.WAL.Encode(s))
+		err := ex.appendWAL(s)
 		if err != nil {
 			return err
 		}
@@ -789,11 +1237,60 @@ func (ex *Executor) Execute(stmt parser.Statement) error {
 
 		return nil
 
+	case *parser.CreateShardStmt:
+		if !ex.recover { // If not recovering from WAL
+			if !ex.currentUser().HasPrivilege("*", "*", []shared.PrivilegeAction{shared.PRIV_CREATE}) {
+				return fmt.Errorf("%w to CREATE on system", ErrNoPrivilege)
+			}
+		}
+
+		// Check if a transaction has begun
+		if ex.TransactionBegun {
+			return errors.New("statement not allowed in a transaction")
+		}
+
+		err := ex.appendWAL(s)
+		if err != nil {
+			return err
+		}
+
+		// Add the shard to the shard map
+		err = ex.aria.Catalog.CreateShard(s.ShardName.Value, s.Address.Value.(string))
+		if err != nil {
+			return err
+		}
+
+		return nil
+
+	case *parser.DropShardStmt:
+		if !ex.recover { // If not recovering from WAL
+			if !ex.currentUser().HasPrivilege("*", "*", []shared.PrivilegeAction{shared.PRIV_CREATE}) {
+				return fmt.Errorf("%w to DROP on system", ErrNoPrivilege)
+			}
+		}
+
+		// Check if a transaction has begun
+		if ex.TransactionBegun {
+			return errors.New("statement not allowed in a transaction")
+		}
+
+		err := ex.appendWAL(s)
+		if err != nil {
+			return err
+		}
+
+		err = ex.aria.Catalog.DropShard(s.ShardName.Value)
+		if err != nil {
+			return err
+		}
+
+		return nil
+
 	case *parser.GrantStmt:
 
 		if !ex.recover { // If not recovering from WAL
-			if !ex.ch.User.HasPrivilege("*", "*", []shared.PrivilegeAction{shared.PRIV_GRANT}) {
-				return errors.New("user does not have the privilege to GRANT on system")
+			if !ex.currentUser().HasPrivilege("*", "*", []shared.PrivilegeAction{shared.PRIV_GRANT}) {
+				return fmt.Errorf("%w to GRANT on system", ErrNoPrivilege)
 			}
 		}
 
@@ -834,7 +1331,7 @@ func (ex *Executor) Execute(stmt parser.Statement) error {
 			}
 		}
 
-		err := ex.aria.WAL.Append(ex.aria.WAL.Encode(s))
+		err := ex.appendWAL(s)
 		if err != nil {
 			return err
 		}
@@ -848,8 +1345,8 @@ func (ex *Executor) Execute(stmt parser.Statement) error {
 
 	case *parser.RevokeStmt:
 		if !ex.recover { // If not recovering from WAL
-			if !ex.ch.User.HasPrivilege("*", "*", []shared.PrivilegeAction{shared.PRIV_REVOKE}) {
-				return errors.New("user does not have the privilege to REVOKE on system")
+			if !ex.currentUser().HasPrivilege("*", "*", []shared.PrivilegeAction{shared.PRIV_REVOKE}) {
+				return fmt.Errorf("%w to REVOKE on system", ErrNoPrivilege)
 			}
 		}
 
@@ -889,7 +1386,7 @@ func (ex *Executor) Execute(stmt parser.Statement) error {
 			}
 		}
 
-		err := ex.aria.WAL.Append(ex.aria.WAL.Encode(s))
+		err := ex.appendWAL(s)
 		if err != nil {
 			return err
 		}
@@ -903,8 +1400,8 @@ func (ex *Executor) Execute(stmt parser.Statement) error {
 
 	case *parser.ShowStmt:
 
-		if !ex.ch.User.HasPrivilege("*", "*", []shared.PrivilegeAction{shared.PRIV_SHOW}) {
-			return errors.New("user does not have the privilege to SHOW on system") // system wide privilege
+		if !ex.currentUser().HasPrivilege("*", "*", []shared.PrivilegeAction{shared.PRIV_SHOW}) {
+			return fmt.Errorf("%w to SHOW on system", ErrNoPrivilege) // system wide privilege
 		}
 
 		if ex.TransactionBegun {
@@ -935,8 +1432,8 @@ func (ex *Executor) Execute(stmt parser.Statement) error {
 			return nil
 		case parser.SHOW_INDEXES:
 
-			if !ex.ch.User.HasPrivilege("*", "*", []shared.PrivilegeAction{shared.PRIV_SHOW}) {
-				return errors.New("user does not have the privilege to SHOW on system") // system wide privilege
+			if !ex.currentUser().HasPrivilege("*", "*", []shared.PrivilegeAction{shared.PRIV_SHOW}) {
+				return fmt.Errorf("%w to SHOW on system", ErrNoPrivilege) // system wide privilege
 			}
 
 			if ex.ch.Database == nil {
@@ -949,17 +1446,30 @@ func (ex *Executor) Execute(stmt parser.Statement) error {
 			}
 
 			indexes := table.GetIndexes()
+			sort.Slice(indexes, func(i, j int) bool {
+				return indexes[i].Name < indexes[j].Name
+			})
 
 			results := make([]map[string]interface{}, len(indexes))
 
 			for i, index := range indexes {
-				results[i] = map[string]interface{}{"Index": index.Name, "Columns": strings.Join(index.Columns, ","), "Unique": index.Unique}
+				results[i] = map[string]interface{}{"Index": index.Name, "Columns": strings.Join(index.Columns, ","), "Unique": index.Unique, "Visible": !index.Invisible}
 			}
 
-			return nil
-		case parser.SHOW_DATABASES:
-			if !ex.ch.User.HasPrivilege("*", "*", []shared.PrivilegeAction{shared.PRIV_SHOW}) {
-				return errors.New("user does not have the privilege to SHOW on system") // system wide privilege
+			if !ex.json {
+				ex.ResultSetBuffer = shared.CreateTableByteArray(results, shared.GetHeaders(results, true))
+			} else {
+				var err error
+				ex.ResultSetBuffer, err = shared.CreateJSONByteArray(results)
+				if err != nil {
+					return err
+				}
+			}
+
+			return nil
+		case parser.SHOW_DATABASES:
+			if !ex.currentUser().HasPrivilege("*", "*", []shared.PrivilegeAction{shared.PRIV_SHOW}) {
+				return fmt.Errorf("%w to SHOW on system", ErrNoPrivilege) // system wide privilege
 			}
 
 			databases := ex.aria.Catalog.GetDatabases()
@@ -1007,8 +1517,8 @@ func (ex *Executor) Execute(stmt parser.Statement) error {
 
 		case parser.SHOW_USERS:
 
-			if !ex.ch.User.HasPrivilege("*", "*", []shared.PrivilegeAction{shared.PRIV_SHOW}) {
-				return errors.New("user does not have the privilege to SHOW on system") // system wide privilege
+			if !ex.currentUser().HasPrivilege("*", "*", []shared.PrivilegeAction{shared.PRIV_SHOW}) {
+				return fmt.Errorf("%w to SHOW on system", ErrNoPrivilege) // system wide privilege
 			}
 
 			users := ex.aria.Catalog.GetUsers()
@@ -1030,14 +1540,264 @@ func (ex *Executor) Execute(stmt parser.Statement) error {
 				}
 			}
 
+			return nil
+		case parser.SHOW_IO:
+			// IO performed by the server since it started, read and written through data, index and WAL files
+			stats := storage.Stats()
+
+			results := []map[string]interface{}{{
+				"Reads":        int(stats.Reads),
+				"Writes":       int(stats.Writes),
+				"BytesRead":    int(stats.BytesRead),
+				"BytesWritten": int(stats.BytesWritten),
+				"Syncs":        int(stats.Syncs),
+				"OpenFiles":    storage.OpenFiles(),
+			}}
+
+			if !ex.json {
+				ex.ResultSetBuffer = shared.CreateTableByteArray(results, shared.GetHeaders(results, true))
+			} else {
+				var err error
+				ex.ResultSetBuffer, err = shared.CreateJSONByteArray(results)
+				if err != nil {
+					return err
+				}
+			}
+
+			return nil
+		case parser.SHOW_ENGINE_STATUS:
+			if !ex.currentUser().HasPrivilege("*", "*", []shared.PrivilegeAction{shared.PRIV_SHOW}) {
+				return fmt.Errorf("%w to SHOW on system", ErrNoPrivilege) // system wide privilege
+			}
+
+			// Waits of every session on every event since the server started
+			stats := wait.ServerStats()
+			results := make([]map[string]interface{}, len(stats))
+
+			for i, stat := range stats {
+				avg := 0
+				if stat.Waits > 0 {
+					avg = int(stat.Total.Microseconds() / stat.Waits)
+				}
+
+				results[i] = map[string]interface{}{
+					"Event":   stat.Event.String(),
+					"Waits":   int(stat.Waits),
+					"Waiting": int(stat.Waiting),
+					"TotalUs": int(stat.Total.Microseconds()),
+					"AvgUs":   avg,
+					"MaxUs":   int(stat.Max.Microseconds()),
+				}
+			}
+
+			if !ex.json {
+				ex.ResultSetBuffer = shared.CreateTableByteArray(results, shared.GetHeaders(results, true))
+			} else {
+				var err error
+				ex.ResultSetBuffer, err = shared.CreateJSONByteArray(results)
+				if err != nil {
+					return err
+				}
+			}
+
+			return nil
+		case parser.SHOW_PROCESSLIST:
+			// Sessions open with the address of their client
+			ex.aria.ChannelsLock.Lock()
+			channels := slices.Clone(ex.aria.Channels)
+			ex.aria.ChannelsLock.Unlock()
+
+			results := make([]map[string]interface{}, 0, len(channels))
+
+			for _, ch := range channels {
+				if ch.User == nil {
+					continue
+				}
+
+				database := ""
+				if ch.Database != nil {
+					database = ch.Database.Name
+				}
+
+				event := ""
+				if ch.Waits != nil {
+					current, _, waiting := ch.Waits.Current()
+					if waiting {
+						event = current.String()
+					}
+				}
+
+				results = append(results, map[string]interface{}{
+					"Id":          int(ch.ChannelID),
+					"User":        ch.User.Username,
+					"Address":     ch.Address,
+					"Application": ch.ApplicationName,
+					"Client":      ch.ClientVersion,
+					"Labels":      ch.LabelString(),
+					"Database":    database,
+					"Wait":        event,
+				})
+			}
+
+			if !ex.json {
+				ex.ResultSetBuffer = shared.CreateTableByteArray(results, shared.GetHeaders(results, true))
+			} else {
+				var err error
+				ex.ResultSetBuffer, err = shared.CreateJSONByteArray(results)
+				if err != nil {
+					return err
+				}
+			}
+
+			return nil
+		case parser.SHOW_MIGRATIONS:
+			if ex.ch.Database == nil {
+				return errors.New("no database selected")
+			}
+
+			migrations, err := ex.ch.Database.GetMigrations()
+			if err != nil {
+				return err
+			}
+
+			results := make([]map[string]interface{}, len(migrations))
+
+			for i, m := range migrations {
+				results[i] = map[string]interface{}{
+					"Version":    m.Version,
+					"Name":       m.Name,
+					"File":       m.File,
+					"Checksum":   m.Checksum,
+					"Statements": m.Statements,
+					"AppliedBy":  m.AppliedBy,
+					"AppliedAt":  shared.FormatToDateTime(m.AppliedAt),
+				}
+			}
+
+			if !ex.json {
+				ex.ResultSetBuffer = shared.CreateTableByteArray(results, shared.GetHeaders(results, true))
+			} else {
+				ex.ResultSetBuffer, err = shared.CreateJSONByteArray(results)
+				if err != nil {
+					return err
+				}
+			}
+
+			return nil
+		case parser.SHOW_PLAN_CACHE, parser.SHOW_PLAN_CACHE_STATUS:
+			// Plans are cached for the statements of every user
+			if !ex.currentUser().HasPrivilege("*", "*", []shared.PrivilegeAction{shared.PRIV_SHOW}) {
+				return fmt.Errorf("%w to SHOW on system", ErrNoPrivilege) // system wide privilege
+			}
+
+			var results []map[string]interface{}
+
+			if s.ShowType == parser.SHOW_PLAN_CACHE_STATUS {
+				stats := ex.aria.Plans.Stats()
+
+				results = []map[string]interface{}{{
+					"Plans":         stats.Plans,
+					"MaxPlans":      stats.Max,
+					"Hits":          stats.Hits,
+					"Misses":        stats.Misses,
+					"Invalidations": stats.Invalidations,
+					"Evictions":     stats.Evictions,
+				}}
+			} else {
+				for _, plan := range ex.aria.Plans.Plans() {
+					results = append(results, map[string]interface{}{
+						"Database":  plan.Database,
+						"Statement": plan.Statement,
+						"Step":      plan.Step,
+						"Tables":    strings.Join(plan.Tables(), ","),
+						"Plan":      plan.String(),
+						"Hits":      plan.Hits,
+						"Created":   plan.Created.Format(time.RFC3339),
+					})
+				}
+			}
+
+			var err error
+
+			if !ex.json {
+				ex.ResultSetBuffer = shared.CreateTableByteArray(results, shared.GetHeaders(results, true))
+			} else {
+				ex.ResultSetBuffer, err = shared.CreateJSONByteArray(results)
+				if err != nil {
+					return err
+				}
+			}
+
+			return nil
+		case parser.SHOW_OPTIMIZER_TRACE:
+			if ex.lastTrace == nil {
+				return errors.New("no statement traced, SET optimizer_trace = ON to trace the next statement")
+			}
+
+			trace, err := json.Marshal(ex.lastTrace)
+			if err != nil {
+				return err
+			}
+
+			results := []map[string]interface{}{{"Statement": ex.lastTrace.Statement, "Trace": string(trace)}}
+
+			if !ex.json {
+				ex.ResultSetBuffer = shared.CreateTableByteArray(results, shared.GetHeaders(results, true))
+			} else {
+				ex.ResultSetBuffer, err = shared.CreateJSONByteArray(results)
+				if err != nil {
+					return err
+				}
+			}
+
+			return nil
+		case parser.SHOW_INDEX_ADVICE:
+			// Statement stats of every user are analyzed
+			if !ex.currentUser().HasPrivilege("*", "*", []shared.PrivilegeAction{shared.PRIV_SHOW}) {
+				return fmt.Errorf("%w to SHOW on system", ErrNoPrivilege) // system wide privilege
+			}
+
+			if ex.ch.Database == nil {
+				return errors.New("no database selected")
+			}
+
+			advice := advisor.Advise(ex.ch.Database, ex.aria.Statements.Stats())
+
+			results := make([]map[string]interface{}, len(advice))
+
+			for i, a := range advice {
+				results[i] = map[string]interface{}{
+					"Table":             a.Table,
+					"Column":            a.Column,
+					"ForeignKey":        a.ForeignKey,
+					"Statements":        a.Statements,
+					"Calls":             a.Calls,
+					"TableRows":         a.Rows,
+					"TotalTimeUs":       a.Total.Microseconds(),
+					"EstimatedSavingUs": a.Saving.Microseconds(),
+					"Suggestion":        a.Statement(),
+				}
+			}
+
+			var err error
+
+			if !ex.json {
+				ex.ResultSetBuffer = shared.CreateTableByteArray(results, shared.GetHeaders(results, true))
+			} else {
+				ex.ResultSetBuffer, err = shared.CreateJSONByteArray(results)
+				if err != nil {
+					return err
+				}
+			}
+
 			return nil
 		default:
 			return errors.New("unsupported show type")
 		}
 	case *parser.AlterUserStmt:
 		if !ex.recover { // If not recovering from WAL
-			if !ex.ch.User.HasPrivilege("*", "*", []shared.PrivilegeAction{shared.PRIV_ALTER}) {
-				return errors.New("user does not have the privilege to ALTER on system") // Altering a user just requires an ALTER privilege system wide
+			if !ex.currentUser().HasPrivilege("*", "*", []shared.PrivilegeAction{shared.PRIV_ALTER}) {
+				return fmt.Errorf("%w to ALTER on system", ErrNoPrivilege) // Altering a user just requires an ALTER privilege system wide
 			}
 		}
 
@@ -1046,7 +1806,7 @@ func (ex *Executor) Execute(stmt parser.Statement) error {
 		}
 
 		if s.SetType == parser.ALTER_USER_SET_PASSWORD {
-			err := ex.aria.WAL.Append(ex.aria.WAL.Encode(s))
+			err := ex.appendWAL(s)
 			if err != nil {
 				return err
 			}
@@ -1056,7 +1816,7 @@ func (ex *Executor) Execute(stmt parser.Statement) error {
 				return err
 			}
 		} else if s.SetType == parser.ALTER_USER_SET_USERNAME {
-			err := ex.aria.WAL.Append(ex.aria.WAL.Encode(s))
+			err := ex.appendWAL(s)
 			if err != nil {
 				return err
 			}
@@ -1077,7 +1837,7 @@ func (ex *Executor) Execute(stmt parser.Statement) error {
 		}
 
 		// Append to wal
-		err := ex.aria.WAL.Append(ex.aria.WAL.Encode(s))
+		err := ex.appendWAL(s)
 		if err != nil {
 			return err
 		}
@@ -1119,7 +1879,7 @@ func (ex *Executor) Execute(stmt parser.Statement) error {
 		cursor := ex.cursors[s.CursorName.Value]
 
 		// Append to wal
-		err = ex.aria.WAL.Append(ex.aria.WAL.Encode(s))
+		err = ex.appendWAL(s)
 		if err != nil {
 			return err
 		}
@@ -1221,7 +1981,7 @@ func (ex *Executor) Execute(stmt parser.Statement) error {
 		}
 
 		// Append to wal
-		err := ex.aria.WAL.Append(ex.aria.WAL.Encode(s))
+		err := ex.appendWAL(s)
 		if err != nil {
 			return err
 		}
@@ -1243,7 +2003,7 @@ func (ex *Executor) Execute(stmt parser.Statement) error {
 		switch s.Expr.(type) {
 		case *parser.Literal:
 			// Append to wal
-			err := ex.aria.WAL.Append(ex.aria.WAL.Encode(s))
+			err := ex.appendWAL(s)
 			if err != nil {
 				return err
 			}
@@ -1260,7 +2020,7 @@ func (ex *Executor) Execute(stmt parser.Statement) error {
 			}
 
 			// Append to wal
-			err := ex.aria.WAL.Append(ex.aria.WAL.Encode(s))
+			err := ex.appendWAL(s)
 			if err != nil {
 				return err
 			}
@@ -1318,7 +2078,7 @@ func (ex *Executor) Execute(stmt parser.Statement) error {
 			}
 
 			// Append to wal
-			err := ex.aria.WAL.Append(ex.aria.WAL.Encode(s))
+			err := ex.appendWAL(s)
 			if err != nil {
 				return err
 			}
@@ -1347,7 +2107,7 @@ func (ex *Executor) Execute(stmt parser.Statement) error {
 			ex.vars[s.CursorVariableName.Value] = &Variable{DataType: s.CursorVariableDataType.Value, Value: nil}
 
 			// Append to wal
-			err := ex.aria.WAL.Append(ex.aria.WAL.Encode(s))
+			err := ex.appendWAL(s)
 			if err != nil {
 				return err
 			}
@@ -1379,7 +2139,7 @@ func (ex *Executor) Execute(stmt parser.Statement) error {
 		delete(ex.cursors, s.CursorName.Value) // delete the cursor
 
 		// Append to wal
-		err := ex.aria.WAL.Append(ex.aria.WAL.Encode(s))
+		err := ex.appendWAL(s)
 		if err != nil {
 			return err
 		}
@@ -1421,7 +2181,7 @@ func (ex *Executor) Execute(stmt parser.Statement) error {
 		}
 
 		// Append to wal
-		err := ex.aria.WAL.Append(ex.aria.WAL.Encode(s))
+		err := ex.appendWAL(s)
 		if err != nil {
 			return err
 		}
@@ -1432,13 +2192,19 @@ func (ex *Executor) Execute(stmt parser.Statement) error {
 			return errors.New("no database selected")
 		}
 
+		if !ex.recover { // If not recovering from WAL
+			if !ex.currentUser().HasPrivilege(ex.ch.Database.Name, s.ProcedureName.Value, []shared.PrivilegeAction{shared.PRIV_CREATE}) {
+				return fmt.Errorf("%w to DROP on system for database %s", ErrNoPrivilege, ex.ch.Database.Name)
+			}
+		}
+
 		// Check if transaction has begun
 		if ex.TransactionBegun {
 			return errors.New("statement not allowed in a transaction")
 		}
 
 		// Append to wal
-		err := ex.aria.WAL.Append(ex.aria.WAL.Encode(s))
+		err := ex.appendWAL(s)
 		if err != nil {
 			return err
 		}
@@ -1457,13 +2223,22 @@ func (ex *Executor) Execute(stmt parser.Statement) error {
 			return errors.New("no database selected")
 		}
 
+		if !ex.recover { // If not recovering from WAL
+			if !ex.currentUser().HasPrivilege(ex.ch.Database.Name, "*", []shared.PrivilegeAction{shared.PRIV_CREATE}) {
+				return fmt.Errorf("%w to CREATE on system for database %s", ErrNoPrivilege, ex.ch.Database.Name)
+			}
+
+			// The creator is the definer, recovery keeps the definer logged with the statement
+			s.Procedure.Definer = ex.currentUser().Username
+		}
+
 		// Check if transaction has begun
 		if ex.TransactionBegun {
 			return errors.New("statement not allowed in a transaction")
 		}
 
 		// Append to wal
-		err := ex.aria.WAL.Append(ex.aria.WAL.Encode(s))
+		err := ex.appendWAL(s)
 		if err != nil {
 			return err
 		}
@@ -1501,6 +2276,22 @@ func (ex *Executor) Execute(stmt parser.Statement) error {
 			return errors.New("procedure does not exist")
 		}
 
+		if !ex.recover { // If not recovering from WAL
+			if !ex.currentUser().HasPrivilege(ex.ch.Database.Name, s.ProcedureName.Value, []shared.PrivilegeAction{shared.PRIV_EXEC}) {
+				return fmt.Errorf("%w to EXEC on procedure %s", ErrNoPrivilege, s.ProcedureName.Value)
+			}
+		}
+
+		// A definer procedure runs as its definer, recovery already runs as admin
+		var definer *catalog.User
+
+		if proc.Proc.(*parser.Procedure).SecurityDefiner && !ex.recover {
+			definer = ex.aria.Catalog.GetUser(proc.Proc.(*parser.Procedure).Definer)
+			if definer == nil {
+				return errors.New("definer of procedure " + s.ProcedureName.Value + " does not exist")
+			}
+		}
+
 		// Add args to vars
 		for i, arg := range s.Args {
 			if _, ok := ex.vars[proc.Proc.(*parser.Procedure).Parameters[i].Name.Value]; !ok {
@@ -1523,11 +2314,22 @@ func (ex *Executor) Execute(stmt parser.Statement) error {
 		}
 
 		// Append to wal
-		err = ex.aria.WAL.Append(ex.aria.WAL.Encode(s))
+		err = ex.appendWAL(s)
 		if err != nil {
 			return err
 		}
 
+		// Privileges are checked against the definer while the body runs, the user of the channel is left as it is
+		// The caller's privileges apply again once the procedure returns, also when it fails
+		if definer != nil {
+			caller := ex.definer
+			ex.definer = definer
+
+			defer func() {
+				ex.definer = caller
+			}()
+		}
+
 		// Execute the procedure
 		for _, ss := range proc.Proc.(*parser.Procedure).Body.Stmts {
 			err := ex.Execute(ss)
@@ -1566,3555 +2368,7744 @@ func (ex *Executor) Execute(stmt parser.Statement) error {
 		ex.explaining = false // Set explaining flag to false
 
 		return nil
-	case *parser.AlterTableStmt:
-		// Check if a database is selected
-		if ex.ch.Database == nil {
-			return errors.New("no database selected")
+	case *parser.ListenStmt:
+		// Check if transaction has begun
+		if ex.TransactionBegun {
+			return errors.New("statement not allowed in a transaction")
 		}
 
-		// Check if user has the privilege to alter table
-		if !ex.ch.User.HasPrivilege(ex.ch.Database.Name, s.TableName.Value, []shared.PrivilegeAction{shared.PRIV_ALTER}) {
-			return errors.New("user does not have the privilege to ALTER on table " + s.TableName.Value)
+		ex.aria.Listen(ex.ch, s.Channel.Value)
+
+		return nil
+	case *parser.UnlistenStmt:
+		// Check if transaction has begun
+		if ex.TransactionBegun {
+			return errors.New("statement not allowed in a transaction")
 		}
 
-		// Append to wal
-		err := ex.aria.WAL.Append(ex.aria.WAL.Encode(s))
-		if err != nil {
-			return err
+		ex.aria.Unlisten(ex.ch, s.Channel.Value)
+
+		return nil
+	case *parser.NotifyStmt:
+		// Within a transaction the notification is sent on commit and discarded on rollback
+		if ex.TransactionBegun {
+			ex.Transaction.Notifications = append(ex.Transaction.Notifications, s)
+			return nil
 		}
 
-		// Get the table
-		table := ex.ch.Database.GetTable(s.TableName.Value)
-		if table == nil {
-			return errors.New("table does not exist")
+		return ex.notify(s)
+	case *parser.CheckpointStmt:
+		if !ex.currentUser().HasPrivilege("*", "*", []shared.PrivilegeAction{shared.PRIV_ALTER}) {
+			return fmt.Errorf("%w to CHECKPOINT on system", ErrNoPrivilege) // system wide privilege
+		}
+
+		if ex.TransactionBegun {
+			return errors.New("statement not allowed in a transaction")
+		}
+
+		// The statement calling a procedure holds off the checkpoint
+		if ex.depth > 1 {
+			return errors.New("CHECKPOINT is not allowed within a procedure")
+		}
 
+		if ex.aria.Checkpointer == nil {
+			return errors.New("checkpoints are not taken by this server")
 		}
 
-		// Alter the table
-		err = table.Alter(s.ColumnName.Value, s.ColumnDefinition)
+		err := ex.aria.CheckWrite()
 		if err != nil {
 			return err
 		}
 
-	default:
-		return errors.New("unsupported statement " + reflect.TypeOf(s).String())
-
-	}
+		_, err = ex.aria.Checkpointer.Checkpoint()
+		return err
+	case *parser.ResetStatisticsStmt:
+		if !ex.currentUser().HasPrivilege("*", "*", []shared.PrivilegeAction{shared.PRIV_ALTER}) {
+			return fmt.Errorf("%w to RESET STATISTICS on system", ErrNoPrivilege) // system wide privilege
+		}
 
-	return errors.New("unsupported statement")
-}
+		if ex.TransactionBegun {
+			return errors.New("statement not allowed in a transaction")
+		}
 
-// executeSelectStmt executes a select statement
-func (ex *Executor) executeSelectStmt(stmt *parser.SelectStmt, subquery bool) ([]map[string]interface{}, error) {
-	var results []map[string]interface{} // Final results
-	var headers []string                 // Headers, final select list headers(columns,keys)
+		// Counters of tables, indexes and statements start over, SHOW IO still counts from start up
+		storage.ResetFileStats()
+		ex.aria.Statements.Reset()
 
-	// Check for select list
-	if stmt.SelectList == nil {
-		return nil, errors.New("no select list")
-	}
+		return nil
+	case *parser.ExportStmt:
+		// Check if a database is selected
+		if ex.ch.Database == nil {
+			return errors.New("no database selected")
+		}
 
-	if stmt.SelectList != nil && stmt.TableExpression == nil {
-		for i, expr := range stmt.SelectList.Expressions {
-			switch expr := expr.Value.(type) {
-			case *parser.Literal:
-				results = append(results, map[string]interface{}{fmt.Sprintf("%v", expr.Value): expr.Value})
-			case *parser.Identifier:
-				results = append(results, map[string]interface{}{fmt.Sprintf("%v", expr.Value): expr.Value})
-			case *parser.BinaryExpression:
-				var val interface{}
-				err := evaluateBinaryExpression(expr, &val, nil)
-				if err != nil {
-					return nil, err
-				}
+		// Check if transaction has begun
+		if ex.TransactionBegun {
+			return errors.New("statement not allowed in a transaction")
+		}
 
-				if stmt.SelectList.Expressions[i].Alias == nil {
-					results = append(results, map[string]interface{}{fmt.Sprintf("%v", val): val})
-				} else {
+		filename, err := export.Path(ex.aria.Config.DataDir, s.File.Value.(string))
+		if err != nil {
+			return err
+		}
 
-					results = append(results, map[string]interface{}{stmt.SelectList.Expressions[i].Alias.Value: val})
-				}
+		query := s.Query
+		columns := make([]*export.Column, 0)
 
+		if s.TableName != nil {
+			table := ex.ch.Database.GetTable(s.TableName.Value)
+			if table == nil {
+				return errors.New("table does not exist")
 			}
-		}
 
-	} else if stmt.SelectList != nil && stmt.TableExpression != nil {
-		var tbles []*catalog.Table // Table list
-		// a table list is the tables required say for a join or not, can be a single table
+			// Table columns are exported with their data types
+			for name, colDef := range table.TableSchema.ColumnDefinitions {
+				columns = append(columns, &export.Column{Name: name, DataType: colDef.DataType})
+			}
 
-		// Check if table expression is not nil,
-		// if so we need to evaluate the from clause
-		// Gathering the proposed tables
-		if stmt.TableExpression != nil {
-			if stmt.TableExpression.FromClause == nil {
-				return nil, errors.New("no from clause") // No from?  We need a from clause, that is the tables for the select
+			query = &parser.SelectStmt{
+				SelectList:      &parser.SelectList{Expressions: []*parser.ValueExpression{{Value: &parser.Wildcard{}}}},
+				TableExpression: &parser.TableExpression{FromClause: &parser.FromClause{Tables: []*parser.Table{{Name: s.TableName}}}},
 			}
 		}
 
-		// Gather tables required for the select, can be 1 or more
-		for _, tblExpr := range stmt.TableExpression.FromClause.Tables {
-
-			tbl := ex.ch.Database.GetTable(tblExpr.Name.Value)
-			if tbl == nil {
-				return nil, errors.New("table does not exist")
-			}
-
-			// If there is an alias set the table name temporarily to the alias
-			if tblExpr.Alias != nil {
-				tbl.Name = tblExpr.Alias.Value
-			}
+		// Privileges are checked by the select
+		rows, err := ex.executeSelectStmt(query, true)
+		if err != nil {
+			return err
+		}
 
-			// Check if user has the privilege to select from the table
-			if !ex.ch.User.HasPrivilege(ex.ch.Database.Name, tbl.Name, []shared.PrivilegeAction{shared.PRIV_SELECT}) {
-				return nil, errors.New("user does not have the privilege to SELECT on table " + tbl.Name)
+		if s.TableName == nil {
+			// Query column types are inferred from the results
+			for _, name := range shared.GetColumns(rows) {
+				columns = append(columns, &export.Column{Name: name})
 			}
+		}
 
-			tbles = append(tbles, tbl)
+		err = export.WriteParquet(filename, columns, rows, s.RowGroupSize)
+		if err != nil {
+			return err
 		}
 
-		// Check if there are any tables
-		if len(tbles) == 0 {
-			return nil, errors.New("no tables")
-		} // You can't do this!!  There should be tables
+		exported := []map[string]interface{}{{"RowsExported": len(rows)}}
 
-		// search reads tables, the where condition and gathers the rows based on that
-		// search will also evaluate joins, subqueries, and other predicates
-		// if the column in a predicate is indexed, we can use the index to locate rows faster to evaluate
-		rows, err := ex.search(tbles, stmt.TableExpression.WhereClause, nil, false, nil, nil)
-		if err != nil {
-			return nil, err
+		// Now we format the results
+		if !ex.json {
+			ex.ResultSetBuffer = shared.CreateTableByteArray(exported, shared.GetHeaders(exported, true))
+		} else {
+			ex.ResultSetBuffer, err = shared.CreateJSONByteArray(exported)
+			if err != nil {
+				return err
+			}
 		}
 
-		if ex.explaining {
-			return nil, nil
+		return nil
+	case *parser.ChecksumTableStmt:
+		// Check if a database is selected
+		if ex.ch.Database == nil {
+			return errors.New("no database selected")
 		}
 
-		// Pass rows to result set
-		results = rows
+		var results []map[string]interface{}
 
-		//If there is a group by clause
-		if stmt.TableExpression.GroupByClause != nil {
+		for _, name := range s.TableNames {
+			tbl := ex.ch.Database.GetTable(name.Value)
+			if tbl == nil {
+				return errors.New("table does not exist")
+			}
 
-			// Group the results
-			groupedRows, err := ex.group(results, stmt.TableExpression.GroupByClause)
-			if err != nil {
-				return nil, err
+			if !ex.currentUser().HasPrivilege(ex.ch.Database.Name, tbl.Name, []shared.PrivilegeAction{shared.PRIV_SELECT}) {
+				return fmt.Errorf("%w to SELECT on table %s", ErrNoPrivilege, tbl.Name)
 			}
 
-			// Check for having clause
-			if stmt.TableExpression.HavingClause != nil {
-				// Filter the results based on the having clause
-				results, err = ex.having(groupedRows, stmt.TableExpression.HavingClause, stmt.SelectList)
-				if err != nil {
-					return nil, err
+			if s.By != nil {
+				if _, ok := tbl.TableSchema.ColumnDefinitions[s.By.Value]; !ok {
+					return errors.New("column " + s.By.Value + " does not exist")
 				}
+			}
 
-				// Because we evaluated the aggregates in the having clause we don't need to evaluate the aggregates in the select list,
-				// We can just filter the columns based on the select list
-				ex.removeAggregatesFromSelectList(stmt.SelectList, &headers)
-
-				err = ex.selectListFilter(&results, stmt.SelectList, &headers)
-				if err != nil {
-					return nil, err
+			checksums := checksumTable(tbl, s.By, s.Chunks)
 
-				}
-			} else {
-				// No having clause, return the grouped rows
-				results = []map[string]interface{}{}
-				for _, row := range groupedRows {
-					results = append(results, row[0])
+			if s.By != nil {
+				for chunk, c := range checksums {
+					results = append(results, map[string]interface{}{"Chunk": chunk, "Rows": c.rows, "Checksum": fmt.Sprintf("%016x", c.sum)})
 				}
 
+				continue
 			}
-		} else {
-			// We should evaluate the select list
-			// Based on projection (select list), we can filter the columns
-
-			err = ex.selectListFilter(&results, stmt.SelectList, &headers)
-			if err != nil {
-				return nil, err
 
-			}
+			results = append(results, map[string]interface{}{"Table": tbl.Name, "Rows": checksums[0].rows, "Checksum": fmt.Sprintf("%016x", checksums[0].sum)})
 		}
 
-		// Check for order by
-		if stmt.TableExpression.OrderByClause != nil {
-			var err error
-			results, err = ex.orderBy(results, stmt.TableExpression.OrderByClause)
+		ex.rows += len(results)
+
+		var err error
+
+		// Now we format the results
+		if !ex.json {
+			ex.ResultSetBuffer = shared.CreateTableByteArray(results, shared.GetHeaders(results, true))
+		} else {
+			ex.ResultSetBuffer, err = shared.CreateJSONByteArray(results)
 			if err != nil {
-				return nil, err
+				return err
 			}
 		}
 
-		// Check for limit and offset
-		if stmt.TableExpression.LimitClause != nil {
-			offset := 0
-			count := len(results)
-
-			if stmt.TableExpression.LimitClause.Offset != nil {
-				// Type assertion to uint64
-				offset = int(stmt.TableExpression.LimitClause.Offset.Value.(uint64))
-			}
-			if stmt.TableExpression.LimitClause.Count != nil {
-				// Type assertion to uint64
-				count = int(stmt.TableExpression.LimitClause.Count.Value.(uint64))
-			}
+		return nil
+	case *parser.LoadIntoCacheStmt:
+		// Check if a database is selected
+		if ex.ch.Database == nil {
+			return errors.New("no database selected")
+		}
 
-			// Ensure offset and count are within bounds
-			if offset > len(results) {
-				// If offset is beyond the length of results, return an empty slice
-				results = []map[string]interface{}{}
-			} else {
-				end := offset + count
-				if end > len(results) {
-					end = len(results) // Adjust end if it exceeds the length of results
-				}
+		var results []map[string]interface{}
 
-				results = results[offset:end]
+		for _, name := range s.TableNames {
+			tbl := ex.ch.Database.GetTable(name.Value)
+			if tbl == nil {
+				return errors.New("table does not exist")
 			}
-		}
 
-		// Check for distinct
-		if stmt.Distinct {
-			results = shared.DistinctMap(results, shared.GetColumns(results)...)
-		}
+			if !ex.currentUser().HasPrivilege(ex.ch.Database.Name, tbl.Name, []shared.PrivilegeAction{shared.PRIV_SELECT}) {
+				return fmt.Errorf("%w to SELECT on table %s", ErrNoPrivilege, tbl.Name)
+			}
 
-		if stmt.Union != nil {
-			// Evaluate the union
-			unionResults, err := ex.executeSelectStmt(stmt.Union, true)
+			load, err := tbl.LoadIntoCache()
 			if err != nil {
-				return nil, err
+				return err
 			}
 
-			// Merge the results
-			results = append(results, unionResults...)
-
-			if !stmt.UnionAll {
-				results = shared.DistinctMap(results, shared.GetColumns(results)...)
-			}
+			results = append(results, map[string]interface{}{"Table": load.Table, "Files": load.Files, "Bytes": load.Bytes})
 		}
 
-		if subquery {
-			return results, nil
-		}
+		ex.rows += len(results)
 
-	}
+		var err error
 
-	// Now we format the results
-	if !ex.json {
-		if len(headers) == 0 {
+		if !ex.json {
 			ex.ResultSetBuffer = shared.CreateTableByteArray(results, shared.GetHeaders(results, true))
 		} else {
-			ex.ResultSetBuffer = shared.CreateTableByteArray(results, headers)
+			ex.ResultSetBuffer, err = shared.CreateJSONByteArray(results)
+			if err != nil {
+				return err
+			}
+		}
 
+		return nil
+	case *parser.SetSessionStmt:
+		switch strings.ToLower(s.Name.Value) {
+		case "trace":
+			return ex.ch.SetTrace(s.Value.Value.(string))
+		case "optimizer_trace":
+			return ex.ch.SetOptimizerTrace(s.Value.Value.(string))
 		}
-	} else {
-		var err error
-		shared.RemoveSingleQuotesFromResult(&results)
-		ex.ResultSetBuffer, err = shared.CreateJSONByteArray(results)
-		if err != nil {
-			return nil, err
+
+		return fmt.Errorf("unknown session setting %s", s.Name.Value)
+	case *parser.SetTransactionStmt:
+		if !ex.TransactionBegun {
+			return ex.ch.SetIsolation(s.Isolation)
 		}
 
-	}
+		// Within a transaction the level of the transaction is set, before it reads or writes
+		if len(ex.Transaction.Statements) > 0 || len(ex.Transaction.Reads) > 0 {
+			return errors.New("SET TRANSACTION must be the first statement of a transaction")
+		}
 
-	return nil, nil // We return rows in result set buffer
+		isolation, err := core.Isolation(s.Isolation)
+		if err != nil {
+			return err
+		}
 
-}
+		ex.Transaction.Isolation = isolation
+		ex.Transaction.Began = ex.aria.WriteSequence()
 
-// checkWildcard checks select list for wildcard
-func (ex *Executor) checkWildcard(selectList *parser.SelectList) bool {
-	for _, expr := range selectList.Expressions {
-		if _, ok := expr.Value.(*parser.Wildcard); ok {
-			return true
+		return nil
+	case *parser.MoveTableStmt:
+		// Check if a database is selected
+		if ex.ch.Database == nil {
+			return errors.New("no database selected")
 		}
-	}
 
-	return false
-}
+		if !ex.currentUser().HasPrivilege(ex.ch.Database.Name, s.TableName.Value, []shared.PrivilegeAction{shared.PRIV_ALTER}) {
+			return fmt.Errorf("%w to ALTER on table %s", ErrNoPrivilege, s.TableName.Value)
+		}
 
-// removeAggregatesFromSelectList removes aggregates from the select list, after evaluating the having clause
-func (ex *Executor) removeAggregatesFromSelectList(selectList *parser.SelectList, headers *[]string) {
+		if ex.TransactionBegun {
+			return errors.New("statement not allowed in a transaction")
+		}
 
-	for i, expr := range selectList.Expressions {
-		if agg, ok := expr.Value.(*parser.AggregateFunc); ok {
+		// Tiers are local to a server so the move is not written to the WAL
+		err := ex.aria.CheckWrite()
+		if err != nil {
+			return err
+		}
 
-			// replace aggregate function with column specification
-			for _, arg := range agg.Args {
-				if colSpec, ok := arg.(*parser.ColumnSpecification); ok {
+		return ex.ch.Database.MoveTable(s.TableName.Value, s.Tier)
+	case *parser.PrepareStmt:
+		// Prepared statements are of the session, they are not logged
+		if _, ok := ex.prepared[s.Name.Value]; ok {
+			return errors.New("prepared statement " + s.Name.Value + " already exists")
+		}
 
-					if expr.Alias != nil {
-						selectList.Expressions[i] = &parser.ValueExpression{Value: colSpec, Alias: expr.Alias}
-						selectList.Expressions[i] = &parser.ValueExpression{Value: &parser.ColumnSpecification{ColumnName: &parser.Identifier{
-							Value: expr.Alias.Value,
-						}}}
-						*headers = append(*headers, expr.Alias.Value)
-					} else {
-						selectList.Expressions[i] = &parser.ValueExpression{Value: colSpec}
-					}
+		if ex.prepared == nil {
+			ex.prepared = make(map[string]*parser.PrepareStmt)
+		}
 
-				}
-			}
+		ex.prepared[s.Name.Value] = s
 
-		} else if _, ok := expr.Value.(*parser.ColumnSpecification); ok {
-			*headers = append(*headers, expr.Value.(*parser.ColumnSpecification).ColumnName.Value)
+		return nil
+	case *parser.ExecutePreparedStmt:
+		return ex.executePrepared(s)
+	case *parser.DeallocatePrepareStmt:
+		if _, ok := ex.prepared[s.Name.Value]; !ok {
+			return errors.New("prepared statement " + s.Name.Value + " does not exist")
 		}
-	}
 
-}
+		delete(ex.prepared, s.Name.Value)
 
-// executeUpdateStmt updates rows in a table
-func (ex *Executor) executeUpdateStmt(stmt *parser.UpdateStmt) ([]int64, []map[string]interface{}, error) {
-	var rowIds []int64                // Updated row ids
-	var rows []map[string]interface{} // Rows to update
-	var updatedRows int
-	var tbles []*catalog.Table // Table list
+		return nil
+	case *parser.DescribeStmt:
+		// Check if a database is selected
+		if ex.ch.Database == nil {
+			return errors.New("no database selected")
+		}
 
-	tbles = append(tbles, ex.ch.Database.GetTable(stmt.TableName.Value))
+		names := make([]string, 0, len(s.TableNames))
+		for _, name := range s.TableNames {
+			names = append(names, name.Value)
+		}
 
-	// Check if there are any tables
-	if len(tbles) == 0 {
-		return nil, nil, errors.New("no tables")
-	} // You can't do this!!
+		all := len(names) == 0
+		if all {
+			names = ex.ch.Database.GetTables()
+			sort.Strings(names)
+		}
 
-	// For a 1 table query we can evaluate the search condition
-	// If the column is indexed, we can use the index to locate rows faster
+		var results []map[string]interface{}
 
-	// Filter the results
-	err := ex.filter(stmt.WhereClause, tbles, &rows, &rowIds)
-	if err != nil {
-		return nil, nil, err
-	}
+		for _, name := range names {
+			tbl := ex.ch.Database.GetTable(name)
+			if tbl == nil {
+				return errors.New("table does not exist")
+			}
 
-	if ex.explaining {
-		return nil, nil, nil
-	}
+			// Describing every table leaves out the tables the user cannot select from
+			if !ex.currentUser().HasPrivilege(ex.ch.Database.Name, tbl.Name, []shared.PrivilegeAction{shared.PRIV_SELECT}) {
+				if all {
+					continue
+				}
 
-	for i, row := range rows {
-		setClause := convertSetClauseToCatalogLike(&stmt.SetClause, &row)
+				return fmt.Errorf("%w to SELECT on table %s", ErrNoPrivilege, tbl.Name)
+			}
 
-		if i < len(rowIds) {
-			if rowIds[i] == 0 {
-				err = tbles[0].UpdateRow(rowIds[i], row, setClause)
-				if err != nil {
-					return nil, nil, err
-				}
-				updatedRows++
+			// JSON output is read by tools, a table is a single row with its columns, keys and indexes nested
+			if ex.json {
+				results = append(results, describeTable(tbl))
 			} else {
-				err = tbles[0].UpdateRow(rowIds[i]-1, row, setClause)
-				if err != nil {
-					return nil, nil, err
-				}
-				updatedRows++
+				results = append(results, describeColumns(tbl)...)
 			}
 		}
-	}
-
-	rowsAffected := map[string]interface{}{"RowsAffected": updatedRows}
-	rows = []map[string]interface{}{rowsAffected}
 
-	// Now we format the results
-	if !ex.json {
-		ex.ResultSetBuffer = shared.CreateTableByteArray(rows, shared.GetHeaders(rows, true))
-	} else {
 		var err error
-		shared.RemoveSingleQuotesFromResult(&rows)
-		ex.ResultSetBuffer, err = shared.CreateJSONByteArray(rows)
-		if err != nil {
-			return nil, nil, err
-		}
-
-	}
 
-	return nil, nil, nil
-
-}
-
-// executeDeleteStmt deletes rows from a table
-func (ex *Executor) executeDeleteStmt(stmt *parser.DeleteStmt) ([]int64, []map[string]interface{}, error) {
-	var rowIds []int64                // Updated row ids
-	var rows []map[string]interface{} // Rows before deletion
-	var deletedRows int
-	var tbles []*catalog.Table // Table list
+		if !ex.json {
+			ex.ResultSetBuffer = shared.CreateTableByteArray(results, []string{"Table", "Column", "Type", "Nullable", "Default", "Key", "References"})
+		} else {
+			ex.ResultSetBuffer, err = shared.CreateJSONByteArray(results)
+			if err != nil {
+				return err
+			}
+		}
 
-	tbles = append(tbles, ex.ch.Database.GetTable(stmt.TableName.Value))
+		return nil
+	case *parser.ApplyMigrationStmt:
+		// Check if a database is selected
+		if ex.ch.Database == nil {
+			return errors.New("no database selected")
+		}
 
-	// Check if there are any tables
-	if len(tbles) == 0 {
-		return nil, nil, errors.New("no tables")
-	} // You can't do this!!
+		if !ex.recover { // If not recovering from WAL
+			if !ex.currentUser().HasPrivilege(ex.ch.Database.Name, "*", []shared.PrivilegeAction{shared.PRIV_CREATE}) {
+				return fmt.Errorf("%w to CREATE on system for database %s", ErrNoPrivilege, ex.ch.Database.Name)
+			}
+		}
 
-	// For a 1 table query we can evaluate the search condition
-	// If the column is indexed, we can use the index to locate rows faster
+		// Check if transaction has begun
+		if ex.TransactionBegun {
+			return errors.New("statement not allowed in a transaction")
+		}
 
-	// Filter the results
-	err := ex.filter(stmt.WhereClause, tbles, &rows, &rowIds)
-	if err != nil {
-		return nil, nil, err
-	}
+		return ex.applyMigration(s)
+	case *parser.CopyStmt:
+		// The rows of a COPY are streamed through the connection of the client with CopyOut and CopyIn
+		return errors.New("COPY is only supported through a client connection")
+	case *parser.AlterTableStmt:
+		// Check if a database is selected
+		if ex.ch.Database == nil {
+			return errors.New("no database selected")
+		}
 
-	if ex.explaining {
-		return nil, nil, nil
-	}
+		// Check if user has the privilege to alter table
+		if !ex.currentUser().HasPrivilege(ex.ch.Database.Name, s.TableName.Value, []shared.PrivilegeAction{shared.PRIV_ALTER}) {
+			return fmt.Errorf("%w to ALTER on table %s", ErrNoPrivilege, s.TableName.Value)
+		}
 
-	for i := range rows {
-		err = tbles[0].DeleteRow(rowIds[i] - 1)
+		// Append to wal
+		err := ex.appendWAL(s)
 		if err != nil {
-			return nil, nil, err
+			return err
 		}
-		deletedRows++
 
-	}
+		// Get the table
+		table := ex.ch.Database.GetTable(s.TableName.Value)
+		if table == nil {
+			return errors.New("table does not exist")
 
-	rowsAffected := map[string]interface{}{"RowsAffected": deletedRows}
-	rows = []map[string]interface{}{rowsAffected}
+		}
 
-	// Now we format the results
-	if !ex.json {
-		ex.ResultSetBuffer = shared.CreateTableByteArray(rows, shared.GetHeaders(rows, true))
-	} else {
-		var err error
-		shared.RemoveSingleQuotesFromResult(&rows)
-		ex.ResultSetBuffer, err = shared.CreateJSONByteArray(rows)
-		if err != nil {
-			return nil, nil, err
+		if s.Constraint != nil {
+			return ex.addConstraint(table, s.ColumnName.Value, s.Constraint)
 		}
 
-	}
+		if s.Validate != nil {
+			// Validate the existing rows against a constraint added NOT VALID
+			column, kind, err := table.Constraint(s.Validate.Value)
+			if err != nil {
+				return err
+			}
 
-	return rowIds, rows, nil
+			colDef := table.TableSchema.ColumnDefinitions[column]
 
-}
+			var violations []map[string]interface{}
+			if kind == catalog.CONSTRAINT_CHECK {
+				violations, err = ex.constraintViolations(table, column, colDef.Check, nil)
+			} else {
+				violations, err = ex.constraintViolations(table, column, nil, colDef.References)
+			}
+			if err != nil {
+				return err
+			}
 
-// convertSetClauseToCatalogLike converts a set clause(s) to a catalog set clause(s)
-func convertSetClauseToCatalogLike(setClause *[]*parser.SetClause, row *map[string]interface{}) []*catalog.SetClause {
-	var setClauses []*catalog.SetClause
+			// The constraint remains not valid until no row violates it, the rows which do are returned
+			if len(violations) == 0 {
+				err = table.ValidateConstraint(s.Validate.Value)
+				if err != nil {
+					return err
+				}
+			}
 
-	for _, set := range *setClause {
-		var val interface{}
+			ex.rows += len(violations)
 
-		// check if set.Value.Value is *BinaryExpression
-		// if so, evaluate the expression
-		if _, ok := set.Value.Value.(*parser.BinaryExpression); ok {
-			err := evaluateBinaryExpression(set.Value.Value.(*parser.BinaryExpression), &val, &[]map[string]interface{}{*row})
+			if !ex.json {
+				ex.ResultSetBuffer = shared.CreateTableByteArray(violations, shared.GetHeaders(violations, true))
+			} else {
+				ex.ResultSetBuffer, err = shared.CreateJSONByteArray(violations)
+				if err != nil {
+					return err
+				}
+			}
+
+			return nil
+		}
+
+		if s.ShardKey != nil {
+			// Set the column the coordinator shards the table by
+			err = table.SetShardKey(s.ShardKey.Value)
 			if err != nil {
-				return nil
+				return err
 			}
 
-		} else {
-			val = set.Value.Value
+			return nil
 		}
 
-		setClauses = append(setClauses, &catalog.SetClause{
-			ColumnName: set.Column.Value,
-			Value:      val,
-		})
+		if s.Warm != nil {
+			// Read the table into the cache on startup, or stop to
+			return ex.ch.Database.SetWarm(s.TableName.Value, *s.Warm)
+		}
 
-	}
+		switch s.Storage {
+		case parser.ALTER_TABLE_COMPRESS:
+			err = table.Recompress(true)
+		case parser.ALTER_TABLE_DECOMPRESS:
+			err = table.Recompress(false)
+		case parser.ALTER_TABLE_RECOMPRESS:
+			err = table.Recompress(table.Compress)
+		default:
+			// Alter the table
+			err = table.Alter(s.ColumnName.Value, s.ColumnDefinition)
+		}
+		if err != nil {
+			return err
+		}
 
-	return setClauses
+		return nil
 
-}
+	default:
+		return errors.New("unsupported statement " + reflect.TypeOf(s).String())
 
-// having filters the results based on the having clause
-func (ex *Executor) having(groupedRows map[interface{}][]map[string]interface{}, having *parser.HavingClause, selectList *parser.SelectList) ([]map[string]interface{}, error) {
-	var results []map[string]interface{}
+	}
 
-	var leftCondition, rightCondition interface{}
-	var logicalOp parser.LogicalOperator
+	return errors.New("unsupported statement")
+}
 
-	// check if logical expression
-	if _, ok := having.SearchCondition.(*parser.LogicalCondition); ok {
-		leftCondition = having.SearchCondition.(*parser.LogicalCondition).Left
-		rightCondition = having.SearchCondition.(*parser.LogicalCondition).Right
-		logicalOp = having.SearchCondition.(*parser.LogicalCondition).Op
-	} else {
-		leftCondition = having.SearchCondition
+// executeSelectStmt executes a select statement
+func (ex *Executor) executeSelectStmt(stmt *parser.SelectStmt, subquery bool) ([]map[string]interface{}, error) {
+	var results []map[string]interface{} // Final results
+	var headers []string                 // Headers, final select list headers(columns,keys)
 
+	// Check for select list
+	if stmt.SelectList == nil {
+		return nil, errors.New("no select list")
 	}
 
-	for _, group := range groupedRows {
-		leftResults, err := ex.evalHavingCondition(leftCondition, group, selectList)
+	// Common table expressions are evaluated first, the statement and its subqueries read them as tables
+	if stmt.With != nil {
+		previous := ex.ctes
+		defer func() { ex.ctes = previous }()
+
+		err := ex.evaluateWith(stmt.With)
 		if err != nil {
 			return nil, err
 		}
+	}
 
-		if rightCondition != nil {
-			rightResults, err := ex.evalHavingCondition(rightCondition, group, selectList)
-			if err != nil {
-				return nil, err
-			}
+	if stmt.SelectList != nil && stmt.TableExpression == nil {
+		for i, expr := range stmt.SelectList.Expressions {
+			switch expr := expr.Value.(type) {
+			case *parser.Literal:
+				value := expr.Value
+				if v, ok := value.(uint64); ok {
+					value = int(v)
+				}
 
-			if logicalOp == parser.OP_AND {
-				if len(leftResults) > 0 && len(rightResults) > 0 {
-					results = append(results, rightResults...)
+				if stmt.SelectList.Expressions[i].Alias == nil {
+					results = append(results, map[string]interface{}{fmt.Sprintf("%v", expr.Value): value})
+				} else {
+					results = append(results, map[string]interface{}{stmt.SelectList.Expressions[i].Alias.Value: value})
 				}
-			} else if logicalOp == parser.OP_OR {
-				if len(leftResults) > 0 || len(rightResults) > 0 {
-					results = append(results, rightResults...)
-					results = append(results, leftResults...)
+			case *parser.Identifier:
+				results = append(results, map[string]interface{}{fmt.Sprintf("%v", expr.Value): expr.Value})
+			case *parser.RandomFunc, *shared.GenUUIDv7, *parser.HashFunc:
+				name := functionName(expr)
+				if stmt.SelectList.Expressions[i].Alias != nil {
+					name = stmt.SelectList.Expressions[i].Alias.Value
 				}
-			}
 
-		} else {
-			results = append(results, leftResults...)
+				results = append(results, map[string]interface{}{name: ex.functionValue(expr, nil)})
+			case *parser.BinaryExpression:
+				var val interface{}
+				err := evaluateBinaryExpression(expr, &val, nil)
+				if err != nil {
+					return nil, err
+				}
+
+				if stmt.SelectList.Expressions[i].Alias == nil {
+					results = append(results, map[string]interface{}{fmt.Sprintf("%v", val): val})
+				} else {
+
+					results = append(results, map[string]interface{}{stmt.SelectList.Expressions[i].Alias.Value: val})
+				}
+
+			}
 		}
 
-	}
+		if stmt.Union != nil {
+			unionResults, err := ex.executeSelectStmt(stmt.Union, true)
+			if err != nil {
+				return nil, err
+			}
 
-	return results, nil
-}
+			results = append(results, unionResults...)
 
-// evalHavingCondition evaluates the having condition
-func (ex *Executor) evalHavingCondition(cond interface{}, group []map[string]interface{}, selectList *parser.SelectList) ([]map[string]interface{}, error) {
-	var results []map[string]interface{}
+			if !stmt.UnionAll {
+				results = shared.DistinctMap(results, shared.GetColumns(results)...)
+			}
+		}
 
-	switch cond.(type) {
-	case *parser.ComparisonPredicate:
-		// left must be an aggregate function
-		// right must be a literal
+		if subquery {
+			return results, nil
+		}
 
-		// Get the aggregate function
-		aggFunc := cond.(*parser.ComparisonPredicate).Left.Value.(*parser.AggregateFunc)
+	} else if stmt.SelectList != nil && stmt.TableExpression != nil {
+		var rows []map[string]interface{}
+		var err error
 
-		// Get the right value
-		//rightVal := having.SearchCondition.(*parser.ComparisonPredicate).Right.Value.(*parser.Literal).Value
+		if view, ok := systemView(stmt); ok {
+			// System views are read from the catalog and the server rather than a table
+			rows, err = ex.readSystemView(view, stmt.TableExpression.WhereClause)
+			if err != nil {
+				return nil, err
+			}
+		} else if ex.readsCommonTable(stmt) || readsTableFunction(stmt) {
+			// Common table expressions and table functions are read from their rows, joined with the other tables read
+			rows, err = ex.readCommonTables(stmt)
+			if err != nil {
+				return nil, err
+			}
+		} else {
+			var tbles []*catalog.Table // Table list
+			// a table list is the tables required say for a join or not, can be a single table
 
-		// Get the aggregate function name
-		aggFuncName := aggFunc.FuncName
+			// Check if table expression is not nil,
+			// if so we need to evaluate the from clause
+			// Gathering the proposed tables
+			if stmt.TableExpression != nil {
+				if stmt.TableExpression.FromClause == nil {
+					return nil, errors.New("no from clause") // No from?  We need a from clause, that is the tables for the select
+				}
+			}
 
-		// Get the aggregate function arguments
-		aggFuncArgs := aggFunc.Args
+			// Gather tables required for the select, can be 1 or more
+			for _, tblExpr := range stmt.TableExpression.FromClause.Tables {
 
-		// Get the column name
-		//colName := aggFuncArgs[0].(*parser.ColumnSpecification).ColumnName.Value
+				tbl := ex.ch.Database.GetTable(tblExpr.Name.Value)
+				if tbl == nil {
+					return nil, errors.New("table does not exist")
+				}
 
-		switch aggFuncName {
-		case "COUNT":
+				err = ex.isolatedRead(tblExpr.Name.Value)
+				if err != nil {
+					return nil, err
+				}
 
-			// map is grouped
-			// i.e 2024/09/16 15:19:47 before group [map[customer_id:1 order_date:'2024-01-01' order_id:1] map[customer_id:1 order_date:'2024-01-15' order_id:2] map[customer_id:2 order_date:'2024-01-10' order_id:3] map[customer_id:2 order_date:'2024-01-20' order_id:4] map[customer_id:3 order_date:'2024-01-05' order_id:5] map[customer_id:3 order_date:'2024-01-25' order_id:6] map[customer_id:3 order_date:'2024-01-30' order_id:7]]
-			//  map[1:[map[customer_id:1 order_date:'2024-01-01' order_id:1] map[customer_id:1 order_date:'2024-01-15' order_id:2]] 2:[map[customer_id:2 order_date:'2024-01-10' order_id:3] map[customer_id:2 order_date:'2024-01-20' order_id:4]] 3:[map[customer_id:3 order_date:'2024-01-05' order_id:5] map[customer_id:3 order_date:'2024-01-25' order_id:6] map[customer_id:3 order_date:'2024-01-30' order_id:7]]]
+				// If there is an alias set the table name temporarily to the alias
+				if tblExpr.Alias != nil {
+					tbl.Name = tblExpr.Alias.Value
+				}
 
-			// Count the number of rows
-			count := len(group)
+				// Check if user has the privilege to select from the table
+				if !ex.currentUser().HasPrivilege(ex.ch.Database.Name, tbl.Name, []shared.PrivilegeAction{shared.PRIV_SELECT}) {
+					return nil, fmt.Errorf("%w to SELECT on table %s", ErrNoPrivilege, tbl.Name)
+				}
 
-			newComparisonPredicate := &parser.ComparisonPredicate{
-				Left:  &parser.ValueExpression{Value: aggFuncArgs[0].(*parser.ColumnSpecification)},
-				Op:    cond.(*parser.ComparisonPredicate).Op,
-				Right: cond.(*parser.ComparisonPredicate).Right,
+				tbles = append(tbles, tbl)
 			}
 
-			rows := []map[string]interface{}{
-				{aggFuncArgs[0].(*parser.ColumnSpecification).ColumnName.Value: count},
-			}
-
-			ok := ex.evaluateCondition(newComparisonPredicate, &rows, nil, nil)
-			if ok {
-				group[0][aggFuncArgs[0].(*parser.ColumnSpecification).ColumnName.Value] = count
-
-				if selectList != nil {
-					for _, expr := range selectList.Expressions {
-						if _, ok := expr.Value.(*parser.AggregateFunc); ok {
-							if expr.Value.(*parser.AggregateFunc).FuncName == "COUNT" {
-								if expr.Alias != nil {
-									group[0][expr.Alias.Value] = count
-								} else {
+			// Check if there are any tables
+			if len(tbles) == 0 {
+				return nil, errors.New("no tables")
+			} // You can't do this!!  There should be tables
 
-								}
-							}
-						}
+			// Ordering by a string column of a table with a default collation orders in the collation
+			if stmt.TableExpression.OrderByClause != nil && len(stmt.TableExpression.OrderByClause.OrderByExpressions) > 0 {
+				expr := stmt.TableExpression.OrderByClause.OrderByExpressions[0]
+				if expr.Collation == nil {
+					if name := columnCollation(expr, tbles); name != "" {
+						expr.Collation = &parser.Identifier{Value: name}
 					}
 				}
-
-				results = append(results, group[0])
 			}
 
-		case "SUM":
-			// Sum the values
-			var sum int
-
-			for _, r := range group {
-				for _, arg := range aggFuncArgs {
-					switch arg := arg.(type) {
-					case *parser.ColumnSpecification:
-						if _, ok := r[arg.ColumnName.Value]; !ok {
-							return nil, errors.New("column does not exist")
-						}
-
-						switch r[arg.ColumnName.Value].(type) {
-						case int:
-							sum += r[arg.ColumnName.Value].(int)
-						case int64:
-							sum += int(r[arg.ColumnName.Value].(int64))
-						case float64:
-							sum += int(r[arg.ColumnName.Value].(float64))
-
-						}
-					}
+			if asOfTable(stmt) {
+				// A flashback query reads the table as it was, changes made since are undone from its history
+				// FOR SYSTEM_TIME BETWEEN reads every version of the rows of a system versioned table
+				if len(tbles) != 1 {
+					return nil, errors.New("AS OF is only supported when selecting from a single table")
+				}
 
+				rows, err = ex.readAsOf(tbles[0], stmt.TableExpression.FromClause.Tables[0], stmt.TableExpression.WhereClause)
+				if err != nil {
+					return nil, err
+				}
+			} else {
+				// search reads tables, the where condition and gathers the rows based on that
+				// search will also evaluate joins, subqueries, and other predicates
+				// if the column in a predicate is indexed, we can use the index to locate rows faster to evaluate
+				rows, err = ex.search(tbles, stmt.TableExpression.WhereClause, nil, false, nil, nil)
+				if err != nil {
+					return nil, err
 				}
 			}
+		}
 
-			newComparisonPredicate := &parser.ComparisonPredicate{
-				Left:  &parser.ValueExpression{Value: aggFuncArgs[0].(*parser.ColumnSpecification)},
-				Op:    cond.(*parser.ComparisonPredicate).Op,
-				Right: cond.(*parser.ComparisonPredicate).Right,
-			}
+		if ex.explaining {
+			return nil, nil
+		}
 
-			rows := []map[string]interface{}{
-				{aggFuncArgs[0].(*parser.ColumnSpecification).ColumnName.Value: sum},
-			}
+		// PIVOT and UNPIVOT reshape the rows read, after the where condition is evaluated
+		rows, err = pivotTables(stmt.TableExpression.FromClause, rows)
+		if err != nil {
+			return nil, err
+		}
 
-			ok := ex.evaluateCondition(newComparisonPredicate, &rows, nil, nil)
-			if ok {
-				usingAlias := false
-				// Check if agg is within select list, if so get alias
-				if selectList != nil {
-					for _, expr := range selectList.Expressions {
-						if _, ok := expr.Value.(*parser.AggregateFunc); ok {
-							if expr.Value.(*parser.AggregateFunc).FuncName == "SUM" {
-								if expr.Alias != nil {
-									group[0][expr.Alias.Value] = sum
-								} else {
-									group[0][aggFuncArgs[0].(*parser.ColumnSpecification).ColumnName.Value] = sum
-								}
-							}
-						}
-					}
-				}
+		// Pass rows to result set
+		results = rows
 
-				if !usingAlias {
+		//If there is a group by clause
+		if stmt.TableExpression.GroupByClause != nil && stmt.TableExpression.GroupByClause.GroupingSets != nil {
+			// GROUPING SETS, ROLLUP and CUBE aggregate every set of columns grouped by in a single pass over the rows
+			results, err = ex.groupingSets(results, stmt.SelectList, stmt.TableExpression.GroupByClause, stmt.TableExpression.HavingClause, &headers)
+			if err != nil {
+				return nil, err
+			}
+		} else if stmt.TableExpression.GroupByClause != nil {
 
-					results = append(results, group[0])
-				}
+			// Group the results
+			groupedRows, err := ex.group(results, stmt.TableExpression.GroupByClause)
+			if err != nil {
+				return nil, err
 			}
-		case "AVG":
-			// Average the values
-			var sum int
 
-			for _, r := range group {
-				for _, arg := range aggFuncArgs {
-					switch arg := arg.(type) {
-					case *parser.ColumnSpecification:
-						if _, ok := r[arg.ColumnName.Value]; !ok {
-							return nil, errors.New("column does not exist")
-						}
+			// Check for having clause
+			if stmt.TableExpression.HavingClause != nil {
+				// Filter the results based on the having clause
+				results, err = ex.having(groupedRows, stmt.TableExpression.HavingClause, stmt.SelectList)
+				if err != nil {
+					return nil, err
+				}
 
-						switch r[arg.ColumnName.Value].(type) {
-						case int:
-							sum += r[arg.ColumnName.Value].(int)
-						case int64:
-							sum += int(r[arg.ColumnName.Value].(int64))
-						case float64:
-							sum += int(r[arg.ColumnName.Value].(float64))
+				// Because we evaluated the aggregates in the having clause we don't need to evaluate the aggregates in the select list,
+				// We can just filter the columns based on the select list
+				ex.removeAggregatesFromSelectList(stmt.SelectList, &headers)
 
-						}
-					}
+				err = ex.selectListFilter(&results, stmt.SelectList, &headers)
+				if err != nil {
+					return nil, err
 
 				}
+			} else {
+				// No having clause, return the grouped rows
+				results = []map[string]interface{}{}
+				for _, row := range groupedRows {
+					results = append(results, row[0])
+				}
 
 			}
+		} else {
+			// We should evaluate the select list
+			// Based on projection (select list), we can filter the columns
 
-			avg := sum / len(group)
+			err = ex.selectListFilter(&results, stmt.SelectList, &headers)
+			if err != nil {
+				return nil, err
 
-			newComparisonPredicate := &parser.ComparisonPredicate{
-				Left:  &parser.ValueExpression{Value: aggFuncArgs[0].(*parser.ColumnSpecification)},
-				Op:    cond.(*parser.ComparisonPredicate).Op,
-				Right: cond.(*parser.ComparisonPredicate).Right,
 			}
+		}
 
-			rows := []map[string]interface{}{
-				{aggFuncArgs[0].(*parser.ColumnSpecification).ColumnName.Value: avg},
+		// Check for order by
+		if stmt.TableExpression.OrderByClause != nil {
+			var err error
+			results, err = ex.orderBy(results, stmt.TableExpression.OrderByClause)
+			if err != nil {
+				return nil, err
 			}
+		}
 
-			ok := ex.evaluateCondition(newComparisonPredicate, &rows, nil, nil)
-			if ok {
+		// Check for limit and offset
+		if stmt.TableExpression.LimitClause != nil {
+			offset := 0
+			count := len(results)
 
-				if selectList != nil {
-					for _, expr := range selectList.Expressions {
-						if _, ok := expr.Value.(*parser.AggregateFunc); ok {
-							if expr.Value.(*parser.AggregateFunc).FuncName == "AVG" {
-								if expr.Alias != nil {
-									group[0][expr.Alias.Value] = avg
-								}
-							}
-						}
-					}
+			if stmt.TableExpression.LimitClause.Offset != nil {
+				// Type assertion to uint64
+				offset = int(stmt.TableExpression.LimitClause.Offset.Value.(uint64))
+			}
+			if stmt.TableExpression.LimitClause.Count != nil {
+				// Type assertion to uint64
+				count = int(stmt.TableExpression.LimitClause.Count.Value.(uint64))
+			}
+
+			// Ensure offset and count are within bounds
+			if offset > len(results) {
+				// If offset is beyond the length of results, return an empty slice
+				results = []map[string]interface{}{}
+			} else {
+				end := offset + count
+				if end > len(results) {
+					end = len(results) // Adjust end if it exceeds the length of results
 				}
 
-				group[0][aggFuncArgs[0].(*parser.ColumnSpecification).ColumnName.Value] = avg
-				results = append(results, group[0])
+				results = results[offset:end]
 			}
+		}
 
-		case "MAX":
-			// Find the maximum value
-			var mx int
+		// Check for distinct
+		if stmt.Distinct {
+			results = shared.DistinctMap(results, shared.GetColumns(results)...)
+		}
 
-			for _, r := range group {
+		if stmt.Union != nil {
+			// Evaluate the union
+			unionResults, err := ex.executeSelectStmt(stmt.Union, true)
+			if err != nil {
+				return nil, err
+			}
 
-				for _, arg := range aggFuncArgs {
-					switch arg := arg.(type) {
-					case *parser.ColumnSpecification:
-						if _, ok := r[arg.ColumnName.Value]; !ok {
-							return nil, errors.New("column does not exist")
-						}
+			// Merge the results
+			results = append(results, unionResults...)
 
-						switch r[arg.ColumnName.Value].(type) {
-						case int:
-							if r[arg.ColumnName.Value].(int) > mx {
-								mx = r[arg.ColumnName.Value].(int)
-							}
-						case int64:
-							if int(r[arg.ColumnName.Value].(int64)) > mx {
-								mx = int(r[arg.ColumnName.Value].(int64))
-							}
-						case float64:
-							if int(r[arg.ColumnName.Value].(float64)) > mx {
-								mx = int(r[arg.ColumnName.Value].(float64))
-							}
-						}
-					}
+			if !stmt.UnionAll {
+				results = shared.DistinctMap(results, shared.GetColumns(results)...)
+			}
+		}
 
-				}
+		if subquery {
+			return results, nil
+		}
 
-			}
+	}
 
-			newComparisonPredicate := &parser.ComparisonPredicate{
-				Left:  &parser.ValueExpression{Value: aggFuncArgs[0].(*parser.ColumnSpecification)},
-				Op:    cond.(*parser.ComparisonPredicate).Op,
-				Right: cond.(*parser.ComparisonPredicate).Right,
-			}
+	ex.rows += len(results)
 
-			rows := []map[string]interface{}{
-				{aggFuncArgs[0].(*parser.ColumnSpecification).ColumnName.Value: mx},
-			}
+	// Now we format the results
+	if !ex.json {
+		if len(headers) == 0 {
+			ex.ResultSetBuffer = shared.CreateTableByteArray(results, shared.GetHeaders(results, true))
+		} else {
+			ex.ResultSetBuffer = shared.CreateTableByteArray(results, headers)
 
-			ok := ex.evaluateCondition(newComparisonPredicate, &rows, nil, nil)
-			if ok {
+		}
+	} else {
+		var err error
+		shared.RemoveSingleQuotesFromResult(&results)
 
-				usingAlias := false
-				// Check if agg is within select list, if so get alias
-				if selectList != nil {
-					for _, expr := range selectList.Expressions {
-						if _, ok := expr.Value.(*parser.AggregateFunc); ok {
-							if expr.Value.(*parser.AggregateFunc).FuncName == "MAX" {
-								if expr.Alias != nil {
+		// Keys are in the order of the select list, clients read columns in the order they were selected
+		if len(headers) == 0 {
+			ex.ResultSetBuffer, err = shared.CreateJSONByteArray(results)
+		} else {
+			ex.ResultSetBuffer, err = shared.CreateOrderedJSONByteArray(results, headers)
+		}
+		if err != nil {
+			return nil, err
+		}
 
-									group[0][expr.Alias.Value] = mx
-									usingAlias = true
-								}
-							}
-						}
-					}
-				}
+	}
 
-				if !usingAlias {
-					group[0][aggFuncArgs[0].(*parser.ColumnSpecification).ColumnName.Value] = mx
-				}
+	return nil, nil // We return rows in result set buffer
 
-				results = append(results, group[0])
-			}
+}
 
-		case "MIN":
-			// Find the minimum value
-			mn := int(^uint(0) >> 1) // Max int value
+// evaluateWith evaluates the common table expressions of a WITH clause in order, a common table expression can read the ones before it
+func (ex *Executor) evaluateWith(with *parser.WithClause) error {
+	ctes := make(map[string][]map[string]interface{})
+	for name, rows := range ex.ctes {
+		ctes[name] = rows
+	}
 
-			for _, r := range group {
-				for _, arg := range aggFuncArgs {
-					switch arg := arg.(type) {
-					case *parser.ColumnSpecification:
-						if _, ok := r[arg.ColumnName.Value]; !ok {
-							return nil, errors.New("column does not exist")
-						}
+	ex.ctes = ctes
 
-						switch r[arg.ColumnName.Value].(type) {
-						case int:
-							if r[arg.ColumnName.Value].(int) < mn {
-								mn = r[arg.ColumnName.Value].(int)
-							}
-						case int64:
-							if int(r[arg.ColumnName.Value].(int64)) < mn {
-								mn = int(r[arg.ColumnName.Value].(int64))
-							}
-						case float64:
-							if int(r[arg.ColumnName.Value].(float64)) < mn {
-								mn = int(r[arg.ColumnName.Value].(float64))
-							}
-						}
-					}
+	for _, cte := range with.CommonTableExpressions {
+		var rows []map[string]interface{}
+		var err error
 
-				}
+		if with.Recursive && readsTable(cte.Query, cte.Name.Value) {
+			rows, err = ex.evaluateRecursive(cte)
+		} else {
+			rows, err = ex.evaluateQuery(cte, cte.Query)
+		}
 
-			}
+		if err != nil {
+			return err
+		}
 
-			newComparisonPredicate := &parser.ComparisonPredicate{
-				Left:  &parser.ValueExpression{Value: aggFuncArgs[0].(*parser.ColumnSpecification)},
-				Op:    cond.(*parser.ComparisonPredicate).Op,
-				Right: cond.(*parser.ComparisonPredicate).Right,
-			}
+		ex.ctes[cte.Name.Value] = rows
+	}
 
-			rows := []map[string]interface{}{
-				{aggFuncArgs[0].(*parser.ColumnSpecification).ColumnName.Value: mn},
-			}
+	return nil
+}
 
-			ok := ex.evaluateCondition(newComparisonPredicate, &rows, nil, nil)
-			if ok {
-				if selectList != nil {
-					for _, expr := range selectList.Expressions {
-						if _, ok := expr.Value.(*parser.AggregateFunc); ok {
-							if expr.Value.(*parser.AggregateFunc).FuncName == "MIN" {
-								if expr.Alias != nil {
-									group[0][expr.Alias.Value] = mn
-								}
-							}
-						}
-					}
-				}
-				group[0][aggFuncArgs[0].(*parser.ColumnSpecification).ColumnName.Value] = mn
+// evaluateRecursive evaluates a recursive common table expression
+// The first query is evaluated once, the queries after it are evaluated reading the rows added by the iteration before until an iteration adds no rows
+// With UNION rather than UNION ALL rows already returned are not added again, which ends the recursion of cycles
+func (ex *Executor) evaluateRecursive(cte *parser.CommonTableExpression) ([]map[string]interface{}, error) {
+	anchor := *cte.Query
+	anchor.Union = nil
 
-				results = append(results, group[0])
+	if readsTable(&anchor, cte.Name.Value) {
+		return nil, fmt.Errorf("the first query of recursive %s can not read from it", cte.Name.Value)
+	}
+
+	maxRecursion := ex.aria.Config.MaxRecursion
+	if maxRecursion <= 0 {
+		maxRecursion = DEFAULT_MAX_RECURSION
+	}
+
+	rows, err := ex.evaluateQuery(cte, &anchor)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool)
+
+	if !cte.Query.UnionAll {
+		rows = distinctRows(rows, seen)
+	}
+
+	results := rows
+
+	for depth := 1; len(rows) > 0; depth++ {
+		if depth > maxRecursion {
+			return nil, fmt.Errorf("recursive query %s exceeded the max recursion depth of %d", cte.Name.Value, maxRecursion)
+		}
+
+		// The recursive queries read the rows added by the iteration before
+		ex.ctes[cte.Name.Value] = rows
+
+		var added []map[string]interface{}
+
+		for query := cte.Query.Union; query != nil; query = query.Union {
+			recursive := *query
+			recursive.Union = nil
+
+			queryRows, err := ex.evaluateQuery(cte, &recursive)
+			if err != nil {
+				return nil, err
 			}
 
+			added = append(added, queryRows...)
+		}
+
+		if !cte.Query.UnionAll {
+			added = distinctRows(added, seen)
 		}
+
+		results = append(results, added...)
+		rows = added
 	}
 
 	return results, nil
-
 }
 
-// group groups the results
-func (ex *Executor) group(results []map[string]interface{}, groupBy *parser.GroupByClause) (map[interface{}][]map[string]interface{}, error) {
+// evaluateQuery returns the rows of a query of a common table expression, with the columns renamed to the column list of the common table expression
+func (ex *Executor) evaluateQuery(cte *parser.CommonTableExpression, query *parser.SelectStmt) ([]map[string]interface{}, error) {
+	rows, err := ex.executeSelectStmt(query, true)
+	if err != nil {
+		return nil, err
+	}
 
-	grouped := make(map[interface{}][]map[string]interface{})
-	if groupBy == nil {
-		return grouped, nil
+	if len(cte.Columns) == 0 {
+		return rows, nil
 	}
 
-	if len(groupBy.GroupByExpressions) == 0 {
-		return grouped, nil
+	names, err := selectListNames(query.SelectList)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", cte.Name.Value, err.Error())
 	}
 
-	// Iterate through the data
-	for _, entry := range results {
-		// Get the group key value
-		groupValue := entry[groupBy.GroupByExpressions[0].Value.(*parser.ColumnSpecification).ColumnName.Value]
+	if len(names) != len(cte.Columns) {
+		return nil, fmt.Errorf("%s has %d columns but its query returns %d", cte.Name.Value, len(cte.Columns), len(names))
+	}
 
-		// Append the entry to the slice corresponding to the group key value
-		grouped[groupValue] = append(grouped[groupValue], entry)
+	renamed := make([]map[string]interface{}, 0, len(rows))
+
+	for _, row := range rows {
+		newRow := make(map[string]interface{}, len(names))
+		for i, name := range names {
+			newRow[cte.Columns[i].Value] = row[name]
+		}
+
+		renamed = append(renamed, newRow)
 	}
 
-	return grouped, nil
+	return renamed, nil
 }
 
-// getFirstAggFuncFromBinaryExpression gets the first aggregate function from a binary expression
-func getFirstAggFuncFromBinaryExpression(expr *parser.BinaryExpression) *parser.AggregateFunc {
-	switch expr.Left.(type) {
-	case *parser.AggregateFunc:
-		return expr.Left.(*parser.AggregateFunc)
-	case *parser.BinaryExpression:
-		return getFirstAggFuncFromBinaryExpression(expr.Left.(*parser.BinaryExpression))
-	}
+// selectListNames returns the names of the columns of a select list, in order
+func selectListNames(selectList *parser.SelectList) ([]string, error) {
+	var names []string
 
-	return nil
+	for _, expr := range selectList.Expressions {
+		if expr.Alias != nil {
+			names = append(names, expr.Alias.Value)
+			continue
+		}
 
+		switch value := expr.Value.(type) {
+		case *parser.ColumnSpecification:
+			names = append(names, value.ColumnName.Value)
+		case *parser.BinaryExpression:
+			col := getFirstLeftBinaryExpressionColumn(value)
+			if col == nil {
+				return nil, errors.New("an expression without a column must be named with AS")
+			}
+
+			names = append(names, col.ColumnName.Value)
+		case *parser.Literal:
+			names = append(names, fmt.Sprintf("%v", value.Value))
+		case *parser.Wildcard:
+			return nil, errors.New("a column list can not be used with *")
+		default:
+			return nil, errors.New("an expression without a column must be named with AS")
+		}
+	}
+
+	return names, nil
 }
 
-// selectListFilter filters the results based on the select list
-func (ex *Executor) selectListFilter(results *[]map[string]interface{}, selectList *parser.SelectList, headers *[]string) error {
+// distinctRows returns the rows not in seen, adding them to seen
+func distinctRows(rows []map[string]interface{}, seen map[string]bool) []map[string]interface{} {
+	var distinct []map[string]interface{}
 
-	if ex.explaining {
-		return nil
+	for _, row := range rows {
+		keys := make([]string, 0, len(row))
+		for k := range row {
+			keys = append(keys, k)
+		}
 
+		sort.Strings(keys)
+
+		key := strings.Builder{}
+		for _, k := range keys {
+			key.WriteString(fmt.Sprintf("%s=%#v;", k, row[k]))
+		}
+
+		if seen[key.String()] {
+			continue
+		}
+
+		seen[key.String()] = true
+		distinct = append(distinct, row)
 	}
 
-	if selectList == nil {
-		return errors.New("no select list")
+	return distinct
+}
+
+// readsTable returns true if a select statement or a select it is combined with by UNION reads from a table
+func readsTable(stmt *parser.SelectStmt, name string) bool {
+	for ; stmt != nil; stmt = stmt.Union {
+		if stmt.TableExpression == nil || stmt.TableExpression.FromClause == nil {
+			continue
+		}
+
+		for _, tbl := range stmt.TableExpression.FromClause.Tables {
+			if tbl.Name.Value == name {
+				return true
+			}
+		}
 	}
 
-	if len(selectList.Expressions) == 0 {
-		return errors.New("no select list")
+	return false
+}
+
+// readsCommonTable returns true if a select statement reads from a common table expression
+func (ex *Executor) readsCommonTable(stmt *parser.SelectStmt) bool {
+	if stmt.TableExpression.FromClause == nil {
+		return false
 	}
 
-	for i, expr := range selectList.Expressions {
+	for _, tbl := range stmt.TableExpression.FromClause.Tables {
+		if _, ok := ex.ctes[tbl.Name.Value]; ok {
+			return true
+		}
+	}
 
-		switch expr := expr.Value.(type) {
+	return false
+}
 
-		case *parser.BinaryExpression:
+// readsTableFunction returns true if a select statement calls a table function within its from clause
+func readsTableFunction(stmt *parser.SelectStmt) bool {
+	if stmt.TableExpression == nil || stmt.TableExpression.FromClause == nil {
+		return false
+	}
 
-			// Left should be a column
+	for _, tbl := range stmt.TableExpression.FromClause.Tables {
+		if tbl.Args != nil {
+			return true
+		}
+	}
 
-			col := getFirstLeftBinaryExpressionColumn(expr)
+	return false
+}
 
-			if col != nil {
+// readsTableFunctionsOnly returns true if every table within the from clause of a select statement is a table function
+func readsTableFunctionsOnly(stmt *parser.SelectStmt) bool {
+	if !readsTableFunction(stmt) {
+		return false
+	}
 
-				for j, row := range *results {
-					var val interface{}
+	for _, tbl := range stmt.TableExpression.FromClause.Tables {
+		if tbl.Args == nil {
+			return false
+		}
+	}
 
-					err := evaluateBinaryExpression(expr, &val, &[]map[string]interface{}{row})
-					if err != nil {
-						return err
-					}
+	return true
+}
 
-					if selectList.Expressions[i].Alias == nil {
+// subqueryKey identifies the results of a subquery for the values of the outer columns it references
+type subqueryKey struct {
+	stmt        *parser.SelectStmt // Subquery
+	correlation string             // Values of the outer columns referenced, empty if the subquery references none
+}
 
-						// update corresponding column
-						(*results)[j][col.ColumnName.Value] = val
-					} else {
-						// update corresponding column
-						(*results)[j][selectList.Expressions[i].Alias.Value] = val
-						// delete the old column
-						delete((*results)[j], col.ColumnName.Value)
-					}
+// subqueryCache is the results of the subqueries of the statement executing, by subquery and correlation key
+type subqueryCache struct {
+	results map[subqueryKey][]map[string]interface{}             // Rows of a subquery by correlation key
+	outer   map[*parser.SelectStmt][]*parser.ColumnSpecification // Outer columns a subquery references
+	rows    int                                                  // Rows cached
+	max     int                                                  // Rows cached at most, results once full are not cached
+}
 
-				}
+// executeSubquery executes a subquery of a condition evaluated on a row
+// A subquery executed again with the same values of the outer columns it references returns the rows it returned before within the statement
+func (ex *Executor) executeSubquery(stmt *parser.SelectStmt, rows *[]map[string]interface{}) ([]map[string]interface{}, error) {
+	max := DEFAULT_SUBQUERY_CACHE_ROWS
+	if ex.aria != nil && ex.aria.Config.SubqueryCacheRows != 0 {
+		max = ex.aria.Config.SubqueryCacheRows
+	}
 
-				if selectList.Expressions[i].Alias == nil {
-					*headers = append(*headers, col.ColumnName.Value)
-				} else {
-					*headers = append(*headers, selectList.Expressions[i].Alias.Value)
-				}
-			} else {
-				// is aggregate function
-				// evaluate the expression
-				var val interface{}
+	// Explained subqueries are executed every time so the plan has each of their steps
+	if max < 0 || ex.explaining {
+		if ex.optimizerTrace != nil {
+			ex.optimizerTrace.SubqueryMisses++
+		}
 
-				err := evaluateBinaryExpression(expr, &val, results)
-				if err != nil {
-					return err
-				}
+		return ex.executeSelectStmt(stmt, true)
+	}
 
-				if selectList.Expressions[i].Alias == nil {
-					*results = []map[string]interface{}{map[string]interface{}{getFirstAggFuncFromBinaryExpression(expr).FuncName: val}}
-					*headers = []string{getFirstAggFuncFromBinaryExpression(expr).FuncName}
-				} else {
-					*results = []map[string]interface{}{map[string]interface{}{selectList.Expressions[i].Alias.Value: val}}
-					*headers = []string{selectList.Expressions[i].Alias.Value}
-				}
+	if ex.subqueries == nil {
+		ex.subqueries = &subqueryCache{results: make(map[subqueryKey][]map[string]interface{}), outer: make(map[*parser.SelectStmt][]*parser.ColumnSpecification), max: max}
+	}
 
-			}
+	outer, ok := ex.subqueries.outer[stmt]
+	if !ok {
+		outer = outerColumns(stmt)
+		ex.subqueries.outer[stmt] = outer
+	}
 
-		case *parser.Wildcard:
+	key := subqueryKey{stmt: stmt, correlation: correlationKey(outer, rows)}
 
-			return nil
-		case *parser.ColumnSpecification:
+	if results, ok := ex.subqueries.results[key]; ok {
+		if ex.optimizerTrace != nil {
+			ex.optimizerTrace.SubqueryHits++
+		}
 
-			// Check for alias
-			if selectList.Expressions[i].Alias == nil {
-				if expr.ColumnName.Value == "*" && expr.TableName != nil {
-					for _, row := range *results {
-						for k, v := range row {
-							if strings.HasPrefix(k, expr.TableName.Value+".") {
-								row[k] = v
-								*headers = append(*headers, k)
-							}
-						}
-					}
+		return results, nil
+	}
 
-				}
+	results, err := ex.executeSelectStmt(stmt, true)
+	if err != nil {
+		return nil, err
+	}
 
-			} else {
-				*headers = append(*headers, selectList.Expressions[i].Alias.Value)
-				// Replace all instances of the column name with the alias
-				for _, row := range *results {
+	if ex.optimizerTrace != nil {
+		ex.optimizerTrace.SubqueryMisses++
+	}
 
-					if _, ok := row[expr.ColumnName.Value]; ok {
-						row[selectList.Expressions[i].Alias.Value] = row[expr.ColumnName.Value]
-						delete(row, expr.ColumnName.Value)
-					}
-				}
+	if ex.subqueries.rows+len(results) <= ex.subqueries.max {
+		ex.subqueries.results[key] = results
+		ex.subqueries.rows += len(results)
+	}
+
+	return results, nil
+}
+
+// outerColumns returns the columns a subquery references qualified by a table not within any of its FROM clauses
+func outerColumns(stmt *parser.SelectStmt) []*parser.ColumnSpecification {
+	var columns []*parser.ColumnSpecification
+	tables := make(map[string]bool)
+
+	var walk func(v reflect.Value)
+	walk = func(v reflect.Value) {
+		switch v.Kind() {
+		case reflect.Pointer, reflect.Interface:
+			if v.IsNil() {
+				return
 			}
 
-			*headers = append(*headers, expr.ColumnName.Value)
-		case *parser.AggregateFunc:
-			var err error
+			switch node := v.Interface().(type) {
+			case *parser.ColumnSpecification:
+				if node.TableName != nil && node.ColumnName != nil {
+					columns = append(columns, node)
+				}
+				return
+			case *parser.Table:
+				if node.Name != nil {
+					tables[node.Name.Value] = true
+				}
 
-			// evaluate the aggregate function
-			err = evaluateAggregate(expr, results, headers, selectList.Expressions[i].Alias)
-			if err != nil {
-				return err
+				if node.Alias != nil {
+					tables[node.Alias.Value] = true
+				}
 			}
-		case *parser.CaseExpr:
-			var err error
 
-			err = ex.evaluateSelectCase(expr, results, headers, selectList.Expressions[i].Alias)
-			if err != nil {
-				return err
+			walk(v.Elem())
+		case reflect.Struct:
+			for i := 0; i < v.NumField(); i++ {
+				if v.Type().Field(i).IsExported() {
+					walk(v.Field(i))
+				}
 			}
-		case *parser.UpperFunc, *parser.LowerFunc, *parser.LengthFunc, *parser.PositionFunc, *parser.RoundFunc,
-			*parser.TrimFunc, *parser.SubstrFunc, *parser.ConcatFunc, *parser.CastFunc, *shared.GenUUID, *shared.SysDate,
-			*shared.SysTime, *shared.SysTimestamp, *parser.CoalesceFunc, *parser.ReverseFunc:
-			var err error
-			err = evaluateSystemFunc(expr, results, headers, selectList.Expressions[i].Alias)
-			if err != nil {
-				return err
+		case reflect.Slice, reflect.Array:
+			for i := 0; i < v.Len(); i++ {
+				walk(v.Index(i))
+			}
+		case reflect.Map:
+			iter := v.MapRange()
+			for iter.Next() {
+				walk(iter.Value())
 			}
 		}
-
 	}
 
-	// remove dupes from columns
-	*headers = shared.RemoveDupesStringSlice(headers)
+	walk(reflect.ValueOf(stmt))
 
-	// check if * is in headers
-	for i, h := range *headers {
-		if h == "*" {
-			// remove
-			*headers = append((*headers)[:i], (*headers)[i+1:]...)
+	outer := make([]*parser.ColumnSpecification, 0, len(columns))
+	for _, column := range columns {
+		if !tables[column.TableName.Value] {
+			outer = append(outer, column)
 		}
 	}
 
-	for _, row := range *results {
-		for k, _ := range row {
-			if !slices.Contains(*headers, k) {
-				delete(row, k)
+	return outer
+}
+
+// correlationKey returns the values of outer columns within the row a condition is evaluated on
+func correlationKey(columns []*parser.ColumnSpecification, rows *[]map[string]interface{}) string {
+	if len(columns) == 0 || rows == nil {
+		return ""
+	}
+
+	values := make([]string, len(columns))
+
+	for i, column := range columns {
+		values[i] = "\x00"
+
+		for _, row := range *rows {
+			if v, ok := row[column.TableName.Value+"."+column.ColumnName.Value]; ok {
+				values[i] = catalog.JoinKey(v)
+				break
+			}
+
+			if v, ok := row[column.ColumnName.Value]; ok {
+				values[i] = catalog.JoinKey(v)
+				break
 			}
 		}
+	}
 
+	return strings.Join(values, "\x1f")
+}
+
+// RegisterTableFunction registers a built-in table function, called by name within a FROM clause i.e. SELECT * FROM name(1, 'a')
+func RegisterTableFunction(name string, fn TableFunction) error {
+	name = strings.ToLower(name)
+
+	if _, err := shared.QuoteIdentifier(name); err != nil {
+		return err
 	}
 
-	return nil
+	tableFunctionsLock.Lock()
+	defer tableFunctionsLock.Unlock()
 
-}
+	if _, ok := tableFunctions[name]; ok {
+		return fmt.Errorf("table function %s already exists", name)
+	}
 
-// evaluateSelectCase evaluates a case expression within a select list
-func (ex *Executor) evaluateSelectCase(expr interface{}, results *[]map[string]interface{}, columns *[]string, alias *parser.Identifier) error {
-	switch expr := expr.(type) {
-	case *parser.CaseExpr:
-		for i, _ := range *results {
+	tableFunctions[name] = fn
 
-			if len(expr.WhenClauses) == 0 {
-				return errors.New("no when clauses in case expression")
-			}
+	return nil
+}
 
-			for _, when := range expr.WhenClauses {
+// callTableFunction returns the rows of a table function called within a from clause
+// A function returning a single column named as the function names the column by the alias of the call, as generate_series(1, 3) AS n
+func callTableFunction(tblExpr *parser.Table) ([]map[string]interface{}, error) {
+	name := strings.ToLower(tblExpr.Name.Value)
 
-				ok := ex.evaluateCondition(when.Condition, results, nil, nil)
+	tableFunctionsLock.RLock()
+	fn, ok := tableFunctions[name]
+	tableFunctionsLock.RUnlock()
 
-				if ok {
-					var result interface{}
+	if !ok {
+		return nil, fmt.Errorf("table function %s does not exist", tblExpr.Name.Value)
+	}
 
-					switch when.Result.(*parser.ValueExpression).Value.(type) {
-					case *parser.ColumnSpecification:
-						result = (*results)[i][when.Result.(*parser.ValueExpression).Value.(*parser.ColumnSpecification).ColumnName.Value]
-					case *parser.Literal:
-						result = when.Result.(*parser.ValueExpression).Value.(*parser.Literal).Value
-					case *parser.BinaryExpression:
-						err := evaluateBinaryExpression(when.Result.(*parser.ValueExpression).Value.(*parser.BinaryExpression), &result, results)
-						if err != nil {
-							return err
-						}
+	if tblExpr.AsOf != nil || tblExpr.Between != nil {
+		return nil, fmt.Errorf("table function %s can not be read AS OF", tblExpr.Name.Value)
+	}
 
-					}
+	args := make([]interface{}, len(tblExpr.Args))
+	for i, arg := range tblExpr.Args {
+		args[i] = arg.Value
+	}
 
-					if alias == nil {
-						(*results)[i]["case_result"] = result
-						*columns = append(*columns, "case_result")
-					} else {
-						(*results)[i][alias.Value] = result
-						*columns = append(*columns, alias.Value)
-					}
-				}
-			}
+	rows, err := fn(args)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", name, err.Error())
+	}
 
-			// in the CASE of CASE ;)
-			// We use the furthest left column, thats the column we are evaluating and updating
-			// We can find that in the first when condition
+	if tblExpr.Alias == nil {
+		return rows, nil
+	}
 
+	for _, row := range rows {
+		if value, ok := row[name]; ok && len(row) == 1 {
+			delete(row, name)
+			row[tblExpr.Alias.Value] = value
 		}
 	}
 
-	return nil
+	return rows, nil
 }
 
-// evaluateSystemFunc evaluates system functions like UPPER within a select list
-func evaluateSystemFunc(expr interface{}, results *[]map[string]interface{}, columns *[]string, alias *parser.Identifier) error {
-	switch expr := expr.(type) {
-	case *parser.ConcatFunc:
-		for i, row := range *results {
-			for k, v := range row {
+// generateSeries returns a row for every number from start to stop by step, generate_series(start, stop[, step])
+// Called with timestamps or dates the step is an interval i.e. generate_series('2024-06-01', '2024-06-30', '1 week')
+func generateSeries(args []interface{}) ([]map[string]interface{}, error) {
+	if len(args) != 2 && len(args) != 3 {
+		return nil, errors.New("expected start, stop and an optional step")
+	}
 
-				if _, ok := row[k].(string); ok {
-					newStr := ""
+	if _, ok := args[0].(string); ok {
+		return generateTimeSeries(args)
+	}
 
-					replaceK := false
+	var numbers [3]float64
+	decimal := false
 
-					for _, arg := range expr.Args {
-						switch arg := arg.(type) {
-						case *parser.ValueExpression:
-							switch arg.Value.(type) {
-							case *parser.ColumnSpecification:
-								if arg.Value.(*parser.ColumnSpecification).ColumnName.Value == k {
-									newStr += strings.TrimSuffix(strings.TrimPrefix(v.(string), "'"), "'")
-									replaceK = true
+	for i, arg := range args {
+		switch v := arg.(type) {
+		case uint64:
+			numbers[i] = float64(v)
+		case int:
+			numbers[i] = float64(v)
+		case float64:
+			numbers[i] = v
+			decimal = true
+		default:
+			return nil, errors.New("expected numbers or timestamps")
+		}
+	}
 
-								}
-							case *parser.Literal:
-								newStr += strings.TrimSuffix(strings.TrimPrefix(arg.Value.(*parser.Literal).Value.(string), "'"), "'")
+	start, stop, step := numbers[0], numbers[1], 1.0
+	if len(args) == 3 {
+		step = numbers[2]
+	}
 
-							}
-						}
+	if step == 0 {
+		return nil, errors.New("step can not be 0")
+	}
 
-					}
+	// A decimal step can land just short of stop, as 0.1 ten times is less than 1
+	count := math.Floor((stop-start)/step+1e-9) + 1
+	if count < 0 {
+		count = 0
+	}
 
-					if replaceK {
+	if count > MAX_SERIES_ROWS {
+		return nil, fmt.Errorf("series of more than %d rows", MAX_SERIES_ROWS)
+	}
 
-						if alias == nil {
-							(*results)[i][k] = fmt.Sprintf("'%s'", newStr)
-							*columns = append(*columns, k)
-						} else {
-							(*results)[i][alias.Value] = fmt.Sprintf("'%s'", newStr)
-							*columns = append(*columns, alias.Value)
-						}
-					}
+	rows := make([]map[string]interface{}, 0, int(count))
 
-				}
-			}
+	for i := 0; i < int(count); i++ {
+		// Every value is computed from start so decimal steps do not accumulate rounding errors
+		value := start + float64(i)*step
 
+		if decimal {
+			rows = append(rows, map[string]interface{}{"generate_series": value})
+		} else {
+			rows = append(rows, map[string]interface{}{"generate_series": int(value)})
 		}
-	case *parser.SubstrFunc:
-		for i, row := range *results {
-			for k, v := range row {
-				if _, ok := row[k].(string); ok {
-					if expr.Arg.(*parser.ValueExpression).Value.(*parser.ColumnSpecification).ColumnName.Value == k {
-						startPos := int(expr.StartPos.Value.(uint64))
-						endPos := int(expr.Length.Value.(uint64))
+	}
 
-						if len(v.(string)) < startPos {
-							return errors.New("start position is greater than the length of the string")
-						}
+	return rows, nil
+}
 
-						if len(v.(string)) < endPos {
-							return errors.New("end position is greater than the length of the string")
-						}
+// generateTimeSeries returns a row for every timestamp from start to stop by an interval, dates are returned if start is a date and the interval whole days
+func generateTimeSeries(args []interface{}) ([]map[string]interface{}, error) {
+	if len(args) != 3 {
+		return nil, errors.New("expected start, stop and an interval")
+	}
 
-						if alias == nil {
-							(*results)[i][k] = fmt.Sprintf("'%s'", strings.TrimSuffix(strings.TrimPrefix(v.(string), "'"), "'")[startPos-1:endPos])
-							*columns = append(*columns, k)
-						} else {
-							(*results)[i][alias.Value] = fmt.Sprintf("'%s'", strings.TrimSuffix(strings.TrimPrefix(v.(string), "'"), "'")[startPos-1:endPos])
-							*columns = append(*columns, alias.Value)
-						}
-					}
-				}
-			}
+	var times [2]time.Time
 
+	for i, arg := range args[:2] {
+		str, ok := arg.(string)
+		if !ok {
+			return nil, errors.New("expected timestamps")
 		}
-	case *parser.TrimFunc:
-		for i, row := range *results {
-			for k, v := range row {
-				if _, ok := row[k].(string); ok {
-					if expr.Arg.(*parser.ValueExpression).Value.(*parser.ColumnSpecification).ColumnName.Value == k {
-						if alias == nil {
-							(*results)[i][k] = fmt.Sprintf("'%s'", strings.TrimSpace(strings.TrimSuffix(strings.TrimPrefix(v.(string), "'"), "'")))
-							*columns = append(*columns, k)
-						} else {
-							(*results)[i][alias.Value] = fmt.Sprintf("'%s'", strings.TrimSpace(strings.TrimSuffix(strings.TrimPrefix(v.(string), "'"), "'")))
-							*columns = append(*columns, alias.Value)
-						}
-					}
-				}
-			}
 
+		var err error
+		times[i], err = shared.StringToGOTime(shared.UnquoteLiteral(str))
+		if err != nil {
+			return nil, err
 		}
-	case *parser.LengthFunc:
-		for i, row := range *results {
-			for k, v := range row {
-				if _, ok := row[k].(string); ok {
-					if expr.Arg.(*parser.ValueExpression).Value.(*parser.ColumnSpecification).ColumnName.Value == k {
-						if alias == nil {
-							(*results)[i][k] = len(strings.TrimPrefix(strings.TrimSuffix(v.(string), "'"), "'"))
-							*columns = append(*columns, k)
-						} else {
-							(*results)[i][alias.Value] = len(strings.TrimPrefix(strings.TrimSuffix(v.(string), "'"), "'"))
-							*columns = append(*columns, alias.Value)
-						}
-					}
-				}
-			}
+	}
 
-		}
-	case *parser.PositionFunc:
-		for i, row := range *results {
-			for k, v := range row {
-				if _, ok := row[k].(string); ok {
-					if expr.Arg.(*parser.ValueExpression).Value.(*parser.ColumnSpecification).ColumnName.Value == k {
-						if alias == nil {
-							(*results)[i][k] = strings.Index(v.(string), strings.TrimSuffix(strings.TrimPrefix(expr.In.(*parser.ValueExpression).Value.(*parser.Literal).Value.(string), "'"), "'"))
-							*columns = append(*columns, k)
-						} else {
-							(*results)[i][alias.Value] = strings.Index(v.(string), strings.TrimSuffix(strings.TrimPrefix(expr.In.(*parser.ValueExpression).Value.(*parser.Literal).Value.(string), "'"), "'"))
-							*columns = append(*columns, alias.Value)
-						}
-					}
-				}
-			}
+	interval, ok := args[2].(string)
+	if !ok {
+		return nil, errors.New("expected an interval i.e. '1 day'")
+	}
 
-		}
-	case *parser.RoundFunc:
-		for i, row := range *results {
-			for k, v := range row {
-				if _, ok := row[k].(float64); ok {
-					if expr.Arg.(*parser.ValueExpression).Value.(*parser.ColumnSpecification).ColumnName.Value == k {
+	years, months, days, duration, err := parseInterval(shared.UnquoteLiteral(interval))
+	if err != nil {
+		return nil, err
+	}
 
-						if alias == nil {
+	layout := "2006-01-02 15:04:05"
+	if len(shared.UnquoteLiteral(args[0].(string))) == len("2006-01-02") && duration == 0 {
+		layout = "2006-01-02"
+	}
 
-							(*results)[i][k] = math.Round(v.(float64))
-							*columns = append(*columns, k)
-						} else {
-							(*results)[i][alias.Value] = math.Round(v.(float64))
-							*columns = append(*columns, alias.Value)
-						}
-					}
-				}
-			}
+	start, stop := times[0], times[1]
+	forward := addInterval(start, years, months, days, duration).After(start)
+
+	var rows []map[string]interface{}
+
+	for i := 0; ; i++ {
+		// Every timestamp is computed from start so a month step from the 31st does not drift
+		t := addInterval(start, years*i, months*i, days*i, duration*time.Duration(i))
 
+		if (forward && t.After(stop)) || (!forward && t.Before(stop)) {
+			break
 		}
-	case *parser.ReverseFunc:
 
-		for i, row := range *results {
-			for k, v := range row {
-				if _, ok := row[k].(string); ok {
-					if expr.Arg.(*parser.ValueExpression).Value.(*parser.ColumnSpecification).ColumnName.Value == k {
+		if len(rows) == MAX_SERIES_ROWS {
+			return nil, fmt.Errorf("series of more than %d rows", MAX_SERIES_ROWS)
+		}
 
-						if alias == nil {
+		rows = append(rows, map[string]interface{}{"generate_series": fmt.Sprintf("'%s'", t.Format(layout))})
+	}
 
-							(*results)[i][k] = shared.ReverseString(v.(string))
-							*columns = append(*columns, k)
-						} else {
-							(*results)[i][alias.Value] = shared.ReverseString(v.(string))
-							*columns = append(*columns, alias.Value)
-						}
-					}
-				}
-			}
+	return rows, nil
+}
+
+// addInterval returns t plus an interval, a month or year added to the end of a month is the end of the month added to i.e. 2024-01-31 plus 1 month is 2024-02-29
+func addInterval(t time.Time, years, months, days int, duration time.Duration) time.Time {
+	month := time.Date(t.Year()+years, t.Month()+time.Month(months), 1, t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), t.Location())
+
+	day := t.Day()
+	if last := month.AddDate(0, 1, -1).Day(); day > last {
+		day = last
+	}
+
+	return month.AddDate(0, 0, day-1+days).Add(duration)
+}
 
+// parseInterval parses an interval i.e. '1 day', '-2 hours' or '1 year 6 months'
+// Units are second, minute, hour, day, week, month and year, singular or plural
+func parseInterval(interval string) (int, int, int, time.Duration, error) {
+	var years, months, days int
+	var duration time.Duration
+
+	fields := strings.Fields(strings.ToLower(interval))
+	if len(fields) == 0 || len(fields)%2 != 0 {
+		return 0, 0, 0, 0, fmt.Errorf("invalid interval %s", interval)
+	}
+
+	for i := 0; i < len(fields); i += 2 {
+		n, err := strconv.Atoi(fields[i])
+		if err != nil {
+			return 0, 0, 0, 0, fmt.Errorf("invalid interval %s", interval)
+		}
+
+		switch strings.TrimSuffix(fields[i+1], "s") {
+		case "second":
+			duration += time.Duration(n) * time.Second
+		case "minute":
+			duration += time.Duration(n) * time.Minute
+		case "hour":
+			duration += time.Duration(n) * time.Hour
+		case "day":
+			days += n
+		case "week":
+			days += n * 7
+		case "month":
+			months += n
+		case "year":
+			years += n
+		default:
+			return 0, 0, 0, 0, fmt.Errorf("invalid interval unit %s", fields[i+1])
 		}
-	case *parser.CoalesceFunc:
-		for i, row := range *results {
-			for k, _ := range row {
-				if _, ok := row[k]; ok {
+	}
 
-					for _, arg := range expr.Args {
-						if arg.(*parser.ValueExpression).Value.(*parser.ColumnSpecification).ColumnName.Value == k {
-							if alias == nil {
-								(*results)[i][k] = expr.Value.(*parser.ValueExpression).Value.(*parser.Literal).Value
-								*columns = append(*columns, k)
-							} else {
-								(*results)[i][alias.Value] = expr.Value.(*parser.ValueExpression).Value.(*parser.Literal).Value
-								*columns = append(*columns, alias.Value)
-							}
-						}
-					}
-				}
-			}
+	if years == 0 && months == 0 && days == 0 && duration == 0 {
+		return 0, 0, 0, 0, errors.New("interval can not be 0")
+	}
+
+	return years, months, days, duration, nil
+}
+
+// readCommonTables returns the rows of a select reading from common table expressions, and tables, matching the where clause
+// Every combination of the rows of the tables joined is matched, the columns of a row are qualified by the name or alias of their table when more than one table is read
+func (ex *Executor) readCommonTables(stmt *parser.SelectStmt) ([]map[string]interface{}, error) {
+	var sources []*joinSource // Tables read, a table of the database is read once joined
+	var names []string        // Names the columns of every table read are qualified by
+
+	for _, tblExpr := range stmt.TableExpression.FromClause.Tables {
+		name := tblExpr.Name.Value
+		if tblExpr.Alias != nil {
+			name = tblExpr.Alias.Value
 		}
 
-	case *parser.UpperFunc:
-		for i, row := range *results {
-			for k, v := range row {
-				if _, ok := row[k].(string); ok {
-					if expr.Arg.(*parser.ValueExpression).Value.(*parser.ColumnSpecification).ColumnName.Value == k {
+		source := &joinSource{name: name}
 
-						if alias == nil {
+		rows, ok := ex.ctes[tblExpr.Name.Value]
+		if tblExpr.Args != nil {
+			var err error
+			rows, err = callTableFunction(tblExpr)
+			if err != nil {
+				return nil, err
+			}
 
-							(*results)[i][k] = strings.ToUpper(v.(string))
-							*columns = append(*columns, k)
-						} else {
-							(*results)[i][alias.Value] = strings.ToUpper(v.(string))
-							*columns = append(*columns, alias.Value)
-						}
-					}
-				}
+			// The rows a table function returns are not known until it is read
+			source.rows, source.read, source.estimate = rows, true, TABLE_FUNCTION_ROWS
+		} else if !ok {
+			if ex.ch.Database == nil {
+				return nil, errors.New("no database selected")
+			}
+
+			tbl := ex.ch.Database.GetTable(tblExpr.Name.Value)
+			if tbl == nil {
+				return nil, errors.New("table does not exist")
+			}
+
+			// Check if user has the privilege to select from the table
+			if !ex.currentUser().HasPrivilege(ex.ch.Database.Name, tbl.Name, []shared.PrivilegeAction{shared.PRIV_SELECT}) {
+				return nil, fmt.Errorf("%w to SELECT on table %s", ErrNoPrivilege, tbl.Name)
+			}
+
+			err := ex.isolatedRead(tbl.Name)
+			if err != nil {
+				return nil, err
 			}
+
+			source.tbl, source.estimate = tbl, tbl.Rows.Count()
+		} else {
+			source.rows, source.read, source.estimate = rows, true, int64(len(rows))
 		}
-	case *parser.LowerFunc:
-		for i, row := range *results {
-			for k, v := range row {
-				if _, ok := row[k].(string); ok {
-					if expr.Arg.(*parser.ValueExpression).Value.(*parser.ColumnSpecification).ColumnName.Value == k {
 
-						if alias == nil {
+		sources = append(sources, source)
+		names = append(names, name)
+	}
 
-							(*results)[i][k] = strings.ToLower(v.(string))
-							*columns = append(*columns, k)
-						} else {
-							(*results)[i][alias.Value] = strings.ToLower(v.(string))
-							*columns = append(*columns, alias.Value)
-						}
-					}
+	var results []map[string]interface{}
+
+	// joined returns a combination as a row, rows are copied as the rows of common table expressions are read again
+	joined := func(combination []map[string]interface{}) map[string]interface{} {
+		row := make(map[string]interface{})
+		for i, r := range combination {
+			for k, v := range r {
+				if len(sources) == 1 {
+					row[k] = v
+				} else {
+					row[names[i]+"."+k] = v
 				}
 			}
 		}
-	case *parser.CastFunc:
-		for i, row := range *results {
-			for k, v := range row {
-				if _, ok := row[k].(string); ok {
-					if expr.Expr.(*parser.ValueExpression).Value.(*parser.ColumnSpecification).ColumnName.Value == k {
 
-						if alias == nil {
+		return row
+	}
 
-							switch expr.DataType.Value {
-							case "INT", "INTEGER", "SMALLINT":
-								// check if row value is string
-								if _, ok := v.(string); ok {
-									// Convert string to int
-									intVal, err := strconv.Atoi(v.(string))
-									if err != nil {
-										return nil
-									}
+	if stmt.TableExpression.WhereClause != nil {
+		err := ex.lookupCollations(stmt.TableExpression.WhereClause.SearchCondition)
+		if err != nil {
+			return nil, err
+		}
+	}
 
-									(*results)[i][k] = intVal
+	combinations, err := ex.join(sources, stmt.TableExpression.WhereClause)
+	if err != nil {
+		return nil, err
+	}
 
-								}
-							case "FLOAT", "DOUBLE", "DECIMAL", "REAL", "NUMERIC":
-								// check if row value is string
-								if _, ok := v.(string); ok {
-									// Convert string to float
-									floatVal, err := strconv.ParseFloat(strings.TrimSuffix(strings.TrimPrefix(v.(string), "'"), "'"), 64)
-									if err != nil {
-										return nil
-									}
+	for _, combination := range combinations {
+		// The condition can trim the names of the tables off the columns of the row it is evaluated on
+		current := []map[string]interface{}{joined(combination)}
+		if ex.evaluateWhereClause(stmt.TableExpression.WhereClause, &current, nil, &[]map[string]interface{}{}) {
+			results = append(results, joined(combination))
+		}
+	}
 
-									(*results)[i][k] = floatVal
+	if len(sources) == 1 || ex.checkWildcard(stmt.SelectList) {
+		return results, nil
+	}
 
-								}
-							case "DATE":
-								// check if row value is string
-								if _, ok := v.(string); ok {
-									// Convert string to time.Time
-									dateVal, err := time.Parse("2006-01-02", v.(string))
-									if err != nil {
-										return nil
-									}
+	// The select list refers to columns by their name only, a column of the first table read is used unless qualified otherwise
+	for _, row := range results {
+		for j := len(names) - 1; j >= 0; j-- {
+			for k, v := range combinationColumns(row, names[j]) {
+				row[k] = v
+			}
+		}
 
-									(*results)[i][k] = fmt.Sprintf("'%s'", dateVal)
+		for _, expr := range stmt.SelectList.Expressions {
+			var col *parser.ColumnSpecification
 
-								}
-							case "DATETIME", "TIMESTAMP":
-								// check if row value is string
-								if _, ok := v.(string); ok {
-									// Convert string to time.Time
-									dateVal, err := time.Parse("2006-01-02 15:04:05", v.(string))
-									if err != nil {
-										return nil
-									}
+			switch value := expr.Value.(type) {
+			case *parser.ColumnSpecification:
+				col = value
+			case *parser.BinaryExpression:
+				col = getFirstLeftBinaryExpressionColumn(value)
+			}
 
-									(*results)[i][k] = fmt.Sprintf("'%s'", dateVal)
+			if col == nil || col.TableName == nil {
+				continue
+			}
 
-								}
-							case "TIME":
-								// check if row value is string
-								if _, ok := v.(string); ok {
-									// Convert string to time.Time
-									dateVal, err := time.Parse("15:04:05", v.(string))
-									if err != nil {
-										return nil
-									}
+			if v, ok := row[col.TableName.Value+"."+col.ColumnName.Value]; ok {
+				row[col.ColumnName.Value] = v
+			}
+		}
+	}
 
-									(*results)[i][k] = fmt.Sprintf("'%s'", dateVal)
+	return results, nil
+}
 
-								}
-							case "BOOL", "BOOLEAN":
-								// check if row value is string
-								if _, ok := v.(string); ok {
-									if v.(string) == "T" || v.(string) == "t" {
-										v = "true"
-									} else if v.(string) == "F" || v.(string) == "f" {
-										v = "false"
-									} else if v.(string) == "'true'" {
-										v = "true"
-									} else if v.(string) == "'false'" {
-										v = "false"
-									}
+// combinationColumns returns the columns of a joined row qualified by name, by their name only
+func combinationColumns(row map[string]interface{}, name string) map[string]interface{} {
+	columns := make(map[string]interface{})
 
-									// Convert string to bool
-									boolVal, err := strconv.ParseBool(v.(string))
-									if err != nil {
-										return nil
-									}
+	for k, v := range row {
+		if strings.HasPrefix(k, name+".") {
+			columns[strings.TrimPrefix(k, name+".")] = v
+		}
+	}
 
-									(*results)[i][k] = boolVal
+	return columns
+}
 
-								}
-							}
+// joinSource is a table read by a select joining common table expressions, table functions and tables
+type joinSource struct {
+	name     string                   // Name the columns of the table are qualified by
+	tbl      *catalog.Table           // Table of the database read, nil for common table expressions and table functions
+	rows     []map[string]interface{} // Rows of the table, read once joined for a table of the database
+	read     bool                     // The rows were read
+	estimate int64                    // Rows of the table estimated when the join was planned
+}
 
-							*columns = append(*columns, k)
-						} else {
-							switch expr.DataType.Value {
-							case "INT", "INTEGER", "SMALLINT":
-								// check if row value is string
-								if _, ok := v.(string); ok {
-									// Convert string to int
-									intVal, err := strconv.Atoi(v.(string))
-									if err != nil {
-										return nil
-									}
+// joinKey is an equality predicate between a column of a table and a column of a table joined before it
+type joinKey struct {
+	source int    // Table joined before, by position within the from clause
+	left   string // Column of the table joined before
+	right  string // Column of the table joined
+}
 
-									(*results)[i][alias.Value] = intVal
+// joinStep is how a table is joined with the combinations of the tables joined before it
+type joinStep struct {
+	operation string         // HASH JOIN, INDEX NESTED LOOP or NESTED LOOP
+	build     string         // Input a hash join is built on, LEFT for the combinations joined before or RIGHT for the table
+	index     *catalog.Index // Index an index nested loop looks the table up in
+	left      int64          // Combinations joined before estimated
+	rows      int64          // Combinations the join returns estimated
+}
 
-								}
-							case "FLOAT", "DOUBLE", "DECIMAL", "REAL", "NUMERIC":
-								// check if row value is string
-								if _, ok := v.(string); ok {
-									// Convert string to float
-									floatVal, err := strconv.ParseFloat(strings.TrimSuffix(strings.TrimPrefix(v.(string), "'"), "'"), 64)
-									if err != nil {
-										return nil
-									}
+// JoinTrace is how a table was joined with the tables read before it
+type JoinTrace struct {
+	Table           string `json:"table"`                      // Table joined
+	Planned         string `json:"planned"`                    // Join planned, HASH JOIN, INDEX NESTED LOOP or NESTED LOOP
+	Executed        string `json:"executed"`                   // Join executed, differs from the join planned once re-optimized
+	Build           string `json:"build,omitempty"`            // Input the hash join executed was built on, LEFT or RIGHT
+	Index           string `json:"index,omitempty"`            // Index the index nested loop executed looked the table up in
+	Estimated       int64  `json:"estimated"`                  // Rows of the table estimated
+	Actual          int64  `json:"actual"`                     // Rows of the table read
+	Reason          string `json:"reason,omitempty"`           // Why the join was re-optimized
+	RuntimeFilter   string `json:"runtime_filter,omitempty"`   // Column of the table a runtime filter of the rows joined before was pushed into the scan of
+	FilteredRows    int64  `json:"filtered_rows,omitempty"`    // Rows of the table the runtime filter skipped
+	SkippedSegments int64  `json:"skipped_segments,omitempty"` // Segments of the table not read as its bloom filter rules out every value of the runtime filter
+}
 
-									(*results)[i][alias.Value] = floatVal
+// join returns the combinations of the rows of the tables read which can match the equality predicates between them
+// Tables are joined in order of the from clause with the combinations of the tables before them, with a hash join built on the input estimated smaller,
+// an index nested loop when fewer combinations are looked up than the table has rows, or a nested loop without an equality predicate.
+// An input found ADAPTIVE_MISESTIMATE times larger than estimated while joining re-optimizes the join, and the joins left, up to the re-optimization limit
+func (ex *Executor) join(sources []*joinSource, where *parser.WhereClause) ([][]map[string]interface{}, error) {
+	rows, err := ex.joinRows(sources[0])
+	if err != nil {
+		return nil, err
+	}
 
-								}
-							case "DATE":
-								// check if row value is string
-								if _, ok := v.(string); ok {
-									// Convert string to time.Time
-									dateVal, err := time.Parse("2006-01-02", v.(string))
-									if err != nil {
-										return nil
-									}
+	combinations := make([][]map[string]interface{}, len(rows))
+	for i, row := range rows {
+		combinations[i] = make([]map[string]interface{}, len(sources))
+		combinations[i][0] = row
+	}
 
-									(*results)[i][alias.Value] = fmt.Sprintf("'%s'", dateVal)
+	if len(sources) == 1 {
+		return combinations, nil
+	}
 
-								}
-							case "DATETIME", "TIMESTAMP":
-								// check if row value is string
-								if _, ok := v.(string); ok {
-									// Convert string to time.Time
-									dateVal, err := time.Parse("2006-01-02 15:04:05", v.(string))
-									if err != nil {
-										return nil
-									}
-
-									(*results)[i][alias.Value] = fmt.Sprintf("'%s'", dateVal)
+	names := make([]string, len(sources))
+	for i, source := range sources {
+		names[i] = source.name
+	}
 
-								}
-							case "TIME":
-								// check if row value is string
-								if _, ok := v.(string); ok {
-									// Convert string to time.Time
-									dateVal, err := time.Parse("15:04:05", v.(string))
-									if err != nil {
-										return nil
-									}
+	keys := make([][]joinKey, len(sources))
+	if where != nil {
+		for i := 1; i < len(sources); i++ {
+			keys[i] = joinKeys(where.SearchCondition, names, i)
+		}
+	}
 
-									(*results)[i][alias.Value] = fmt.Sprintf("'%s'", dateVal)
+	maxReoptimizations := DEFAULT_MAX_REOPTIMIZATIONS
+	if ex.aria != nil && ex.aria.Config.MaxReoptimizations != 0 {
+		maxReoptimizations = max(ex.aria.Config.MaxReoptimizations, 0)
+	}
 
-								}
-							case "BOOL", "BOOLEAN":
-								// check if row value is string
-								if _, ok := v.(string); ok {
-									if v.(string) == "T" || v.(string) == "t" {
-										v = "true"
-									} else if v.(string) == "F" || v.(string) == "f" {
-										v = "false"
-									} else if v.(string) == "'true'" {
-										v = "true"
-									} else if v.(string) == "'false'" {
-										v = "false"
-									}
+	reoptimizations := 0
 
-									// Convert string to bool
-									boolVal, err := strconv.ParseBool(v.(string))
-									if err != nil {
-										return nil
-									}
+	steps := make([]*joinStep, len(sources))
+	planJoins(sources, keys, steps, 1, sources[0].estimate)
 
-									(*results)[i][alias.Value] = boolVal
+	for i := 1; i < len(sources); i++ {
+		trace := &JoinTrace{Table: sources[i].name, Planned: steps[i].operation, Estimated: sources[i].estimate}
 
-								}
-							}
-							*columns = append(*columns, alias.Value)
-						}
-					}
-				}
-			}
+		// The combinations joined before are known, the joins left are planned again once they are far more than estimated
+		if misestimated(steps[i].left, int64(len(combinations))) && reoptimizations < maxReoptimizations {
+			reoptimizations++
+			planJoins(sources, keys, steps, i, int64(len(combinations)))
+			trace.Reason = fmt.Sprintf("%d rows were joined before %s, %d estimated, the joins left were planned again", len(combinations), sources[i].name, steps[i].left)
 		}
-	}
 
-	return nil
-}
+		step := steps[i]
 
-// evaluateAggregate evaluates an aggregate function
-func evaluateAggregate(expr *parser.AggregateFunc, results *[]map[string]interface{}, columns *[]string, alias *parser.Identifier) error {
-	switch expr.FuncName {
-	case "COUNT":
-		count := 0
+		// A hash join built on a table far larger than estimated is built on the combinations joined before instead, if there are fewer
+		if step.operation == HASH_JOIN && step.build == "RIGHT" && reoptimizations < maxReoptimizations {
+			rows, err := ex.joinRows(sources[i])
+			if err != nil {
+				return nil, err
+			}
 
-		for _, row := range *results {
-			for _, arg := range expr.Args {
-				switch arg := arg.(type) {
-				case *parser.ColumnSpecification:
-					if _, ok := row[arg.ColumnName.Value]; !ok {
-						return errors.New("column does not exist")
-					}
-					count++
-				case *parser.Wildcard:
-					count++
-				}
+			if misestimated(sources[i].estimate, int64(len(rows))) && len(combinations) < len(rows) {
+				reoptimizations++
+				step = &joinStep{operation: HASH_JOIN, build: "LEFT", left: step.left, rows: step.rows}
+				trace.Reason = fmt.Sprintf("%s built %d rows, %d estimated, the hash join was built on the %d rows joined before", sources[i].name, len(rows), sources[i].estimate, len(combinations))
 			}
 		}
 
-		if alias == nil {
-			*results = []map[string]interface{}{map[string]interface{}{"COUNT": count}}
-			*columns = []string{"COUNT"}
-		} else {
-			*results = []map[string]interface{}{map[string]interface{}{alias.Value: count}}
-			*columns = []string{alias.Value}
+		trace.Executed, trace.Build = step.operation, step.build
+		if step.index != nil {
+			trace.Index = step.index.Name
 		}
 
-	case "SUM":
-		// Sum the values
-		var sum int
-
-		for _, row := range *results {
-			for _, arg := range expr.Args {
-				switch arg := arg.(type) {
-				case *parser.ColumnSpecification:
-
-					if _, ok := row[arg.ColumnName.Value]; !ok {
-						return errors.New("column does not exist ")
-					}
-
-					switch row[arg.ColumnName.Value].(type) {
-					case int:
-						sum += row[arg.ColumnName.Value].(int)
-					case int64:
-						sum += int(row[arg.ColumnName.Value].(int64))
-					case float64:
-						sum += int(row[arg.ColumnName.Value].(float64))
-
-					}
-				}
-
-			}
-
+		combinations, err = ex.joinStep(combinations, sources[i], i, keys[i], step, trace)
+		if err != nil {
+			return nil, err
 		}
 
-		if alias == nil {
-			*results = []map[string]interface{}{map[string]interface{}{"SUM": sum}}
-			*columns = []string{"SUM"}
-		} else {
-			*results = []map[string]interface{}{map[string]interface{}{alias.Value: sum}}
-			*columns = []string{alias.Value}
+		if ex.optimizerTrace != nil {
+			ex.optimizerTrace.Joins = append(ex.optimizerTrace.Joins, trace)
 		}
+	}
 
-	case "AVG":
-		// Average the values
-		var sum int
-		var count int
+	if ex.optimizerTrace != nil {
+		ex.optimizerTrace.Reoptimizations += reoptimizations
+	}
 
-		for _, row := range *results {
-			for _, arg := range expr.Args {
-				switch arg := arg.(type) {
-				case *parser.ColumnSpecification:
-					if _, ok := row[arg.ColumnName.Value]; !ok {
-						return errors.New("column does not exist")
-					}
+	return combinations, nil
+}
 
-					switch row[arg.ColumnName.Value].(type) {
-					case int:
-						sum += row[arg.ColumnName.Value].(int)
-					case int64:
-						sum += int(row[arg.ColumnName.Value].(int64))
-					case float64:
-						sum += int(row[arg.ColumnName.Value].(float64))
+// planJoins plans the joins of the tables from the table at position from, the combinations joined before it estimated to be left
+func planJoins(sources []*joinSource, keys [][]joinKey, steps []*joinStep, from int, left int64) {
+	for i := from; i < len(sources); i++ {
+		source := sources[i]
+		step := &joinStep{operation: NESTED_LOOP, left: left, rows: left * max(source.estimate, 1)}
 
-					}
-				}
+		if len(keys[i]) > 0 {
+			// A table joined on an equality predicate returns a combination per row of the larger input
+			step.rows = max(left, source.estimate)
 
+			if idx := joinIndex(source, keys[i]); idx != nil && left < source.estimate {
+				step.operation, step.index = INDEX_NESTED_LOOP, idx
+			} else {
+				step.operation, step.build = HASH_JOIN, "RIGHT"
+				if left < source.estimate {
+					step.build = "LEFT"
+				}
 			}
 		}
 
-		count = len(*results)
+		steps[i] = step
+		left = step.rows
+	}
+}
 
-		avg := sum / count
+// joinIndex returns a visible index on the column of the first equality predicate a table of the database is joined on, nil if there is none
+// Temporal columns are not looked up as their values are formatted once read
+func joinIndex(source *joinSource, keys []joinKey) *catalog.Index {
+	if source.tbl == nil {
+		return nil
+	}
 
-		if alias == nil {
-			*results = []map[string]interface{}{map[string]interface{}{"AVG": avg}}
-			*columns = []string{"AVG"}
-		} else {
-			*results = []map[string]interface{}{map[string]interface{}{alias.Value: avg}}
-			*columns = []string{alias.Value}
-		}
+	col, ok := source.tbl.TableSchema.ColumnDefinitions[keys[0].right]
+	if !ok || slices.Contains([]string{"DATE", "TIME", "TIMESTAMP", "DATETIME"}, col.DataType) {
+		return nil
+	}
 
-	case "MAX":
-		// Find the maximum value
-		var mx int
+	idx := source.tbl.VisibleIndexedColumn(keys[0].right, true)
+	if idx == nil {
+		idx = source.tbl.VisibleIndexedColumn(keys[0].right, false)
+	}
 
-		for _, row := range *results {
-			for _, arg := range expr.Args {
-				switch arg := arg.(type) {
-				case *parser.ColumnSpecification:
-					if _, ok := row[arg.ColumnName.Value]; !ok {
-						return errors.New("column does not exist")
-					}
+	return idx
+}
 
-					switch row[arg.ColumnName.Value].(type) {
-					case int:
-						if row[arg.ColumnName.Value].(int) > mx {
-							mx = row[arg.ColumnName.Value].(int)
-						}
-					case int64:
-						if int(row[arg.ColumnName.Value].(int64)) > mx {
-							mx = int(row[arg.ColumnName.Value].(int64))
-						}
-					case float64:
-						if int(row[arg.ColumnName.Value].(float64)) > mx {
-							mx = int(row[arg.ColumnName.Value].(float64))
-						}
-					}
-				}
-			}
-		}
+// misestimated returns true if an input of a join has ADAPTIVE_MISESTIMATE times more rows than estimated
+func misestimated(estimate, rows int64) bool {
+	return rows > max(estimate, 1)*ADAPTIVE_MISESTIMATE
+}
 
-		if alias == nil {
-			*results = []map[string]interface{}{map[string]interface{}{"MAX": mx}}
-			*columns = []string{"MAX"}
-		} else {
-			*results = []map[string]interface{}{map[string]interface{}{alias.Value: mx}}
-			*columns = []string{alias.Value}
+// joinKeys returns the equality predicates between a table and the tables before it, ANDed at the top of a search condition
+func joinKeys(cond interface{}, names []string, i int) []joinKey {
+	switch cond := cond.(type) {
+	case *parser.LogicalCondition:
+		if cond.Op != parser.OP_AND {
+			return nil
 		}
 
-	case "MIN":
-		// Find the minimum value
-		var mn int
-		mn = int(^uint(0) >> 1)
+		return append(joinKeys(cond.Left, names, i), joinKeys(cond.Right, names, i)...)
+	case *parser.ComparisonPredicate:
+		if cond.Op != parser.OP_EQ || cond.Left == nil || cond.Right == nil || collationOf(cond) != "" {
+			return nil
+		}
 
-		for _, row := range *results {
-			for _, arg := range expr.Args {
-				switch arg := arg.(type) {
-				case *parser.ColumnSpecification:
-					if _, ok := row[arg.ColumnName.Value]; !ok {
-						return errors.New("column does not exist")
-					}
+		left, lok := cond.Left.Value.(*parser.ColumnSpecification)
+		right, rok := cond.Right.Value.(*parser.ColumnSpecification)
+		if !lok || !rok || left.TableName == nil || right.TableName == nil {
+			return nil
+		}
 
-					switch row[arg.ColumnName.Value].(type) {
-					case int:
-						if row[arg.ColumnName.Value].(int) < mn {
-							mn = row[arg.ColumnName.Value].(int)
-						}
-					case int64:
-						if int(row[arg.ColumnName.Value].(int64)) < mn {
-							mn = int(row[arg.ColumnName.Value].(int64))
-						}
-					case float64:
-						if int(row[arg.ColumnName.Value].(float64)) < mn {
-							mn = int(row[arg.ColumnName.Value].(float64))
-						}
-					}
-				}
-			}
+		l, r := slices.Index(names, left.TableName.Value), slices.Index(names, right.TableName.Value)
+		if l == i {
+			l, r, left, right = r, l, right, left
 		}
 
-		if alias == nil {
-			*results = []map[string]interface{}{map[string]interface{}{"MIN": mn}}
-			*columns = []string{"MIN"}
-		} else {
-			*results = []map[string]interface{}{map[string]interface{}{alias.Value: mn}}
-			*columns = []string{alias.Value}
+		if r == i && l >= 0 && l < i {
+			return []joinKey{{source: l, left: left.ColumnName.Value, right: right.ColumnName.Value}}
 		}
 	}
 
 	return nil
 }
 
-// search searches tables based on the where clause
-func (ex *Executor) search(tbls []*catalog.Table, where *parser.WhereClause, update *[]*parser.SetClause, del bool, rowIds *[]int64, before *[]map[string]interface{}) ([]map[string]interface{}, error) {
-	var filteredRows []map[string]interface{} // The final rows that are filtered based on the where clause
+// joinRows returns the rows of a table joined, a table of the database is read the first time
+func (ex *Executor) joinRows(source *joinSource) ([]map[string]interface{}, error) {
+	if source.read {
+		return source.rows, nil
+	}
 
-	// Check if there are no tables
-	if len(tbls) == 0 {
-		return nil, errors.New("no tables")
+	rows, err := ex.search([]*catalog.Table{source.tbl}, nil, nil, false, nil, nil)
+	if err != nil {
+		return nil, err
 	}
 
-	// Check if there is no where clause
-	if where == nil {
+	source.rows, source.read = rows, true
 
-		// If there is no where clause, we return all rows from whatever tables were passed
-		for _, tbl := range tbls {
+	return rows, nil
+}
 
-			// If we are explaining, we add a full scan step to the plan
-			if ex.explaining {
-				ex.plan.Steps = append(ex.plan.Steps, &Step{Operation: FULL_SCAN, Table: tbl.Name, Column: "n/a", IO: tbl.IOCount()})
-				continue
-			}
+// joinStep joins a table at position i with the combinations of the tables before it, the rows of the table read are traced
+func (ex *Executor) joinStep(combinations [][]map[string]interface{}, source *joinSource, i int, keys []joinKey, step *joinStep, trace *JoinTrace) ([][]map[string]interface{}, error) {
+	var joined [][]map[string]interface{}
 
-			// Setup new row iterator
-			iter := tbl.NewIterator()
+	combine := func(combination []map[string]interface{}, row map[string]interface{}) {
+		c := slices.Clone(combination)
+		c[i] = row
+		joined = append(joined, c)
+	}
 
-			for iter.Valid() {
-				// For every row in the table, we append it to the filtered rows
-				row, err := iter.Next()
+	if step.operation == INDEX_NESTED_LOOP {
+		looked := make(map[string][]map[string]interface{}) // Rows looked up by value, a value is looked up once
+		read := int64(0)
+
+		for _, combination := range combinations {
+			value := combination[keys[0].source][keys[0].left]
+			key := hashKey([]interface{}{value})
+
+			rows, ok := looked[key]
+			if !ok {
+				rowIds, err := source.tbl.IndexLookup(step.index, keys[0].right, value)
 				if err != nil {
-					continue
+					return nil, err
 				}
 
-				filteredRows = append(filteredRows, row)
-			}
-		}
+				// Rows are read in the order of a full scan
+				slices.Sort(rowIds)
 
-		if ex.explaining {
-			ex.ResultSetBuffer = shared.CreateTableByteArray(convertPlanToRows(ex.plan), shared.GetHeaders(convertPlanToRows(ex.plan), true))
-			return filteredRows, nil
-		}
+				for _, rowId := range rowIds {
+					row, err := source.tbl.GetRow(rowId)
+					if err != nil {
+						return nil, err
+					}
 
-		for i, row := range filteredRows {
-			for k, v := range row {
-				// Check if value is time.Time
-				if _, ok := v.(time.Time); ok {
+					formatTemporal(source.tbl, row)
+					rows = append(rows, row)
+				}
 
-					tbl := tbls[0]
+				looked[key] = rows
+				read += int64(len(rows))
+			}
 
-					// get the column type and format if need be
-					for name, col := range tbl.TableSchema.ColumnDefinitions {
+			for _, row := range rows {
+				combine(combination, row)
+			}
+		}
 
-						if name == k {
-							switch col.DataType {
-							case "DATE":
-								filteredRows[i][k] = fmt.Sprintf("'%s'", v.(time.Time).Format("2006-01-02"))
-							case "TIME":
-								filteredRows[i][k] = fmt.Sprintf("'%s'", v.(time.Time).Format("15:04:05"))
-							case "TIMESTAMP":
-								filteredRows[i][k] = fmt.Sprintf("'%s'", v.(time.Time).Format("2006-01-02 15:04:05"))
-							case "DATETIME":
-								filteredRows[i][k] = fmt.Sprintf("'%s'", v.(time.Time).Format("2006-01-02 15:04:05"))
-							}
-						}
-					}
+		trace.Actual = read
 
-				}
+		return joined, nil
+	}
 
-			}
+	var rows []map[string]interface{}
+	var err error
+
+	// A hash join built on few rows joined before pushes a runtime filter of their values into the scan of the table
+	if step.operation == HASH_JOIN && step.build == "LEFT" && !source.read && len(combinations) <= RUNTIME_FILTER_MAX_ROWS {
+		filter := catalog.NewRuntimeFilter(keys[0].right, len(combinations))
+		for _, combination := range combinations {
+			filter.Add(combination[keys[0].source][keys[0].left])
 		}
 
+		var stats catalog.FilterStats
+
+		rows, stats, err = ex.scanFiltered(source.tbl, filter)
+		trace.RuntimeFilter, trace.FilteredRows, trace.SkippedSegments = filter.Column, stats.Rows, stats.Segments
 	} else {
+		rows, err = ex.joinRows(source)
+	}
 
-		var err error
+	if err != nil {
+		return nil, err
+	}
 
-		// where is the where clause
-		// filteredRows is the final rows from this function that are filtered based on the where clause
-		// tbls are the tables that are being filtered
-		// update is a set of set clauses for an update statement, if this is an update statement
-		// del is a flag to indicate if this is a delete statement
-		// before is a list of rows before a delete or update statement
+	switch {
+	case step.operation == NESTED_LOOP:
+		for _, combination := range combinations {
+			for _, row := range rows {
+				combine(combination, row)
+			}
+		}
+	case step.build == "RIGHT":
+		built := make(map[string][]map[string]interface{})
+		for _, row := range rows {
+			key := hashKey(rightValues(row, keys))
+			built[key] = append(built[key], row)
+		}
 
-		err = ex.filter(where, tbls, &filteredRows, rowIds)
-		if err != nil {
-			return nil, err
+		for _, combination := range combinations {
+			for _, row := range built[hashKey(leftValues(combination, keys))] {
+				combine(combination, row)
+			}
+		}
+	default:
+		built := make(map[string][]int)
+		for c, combination := range combinations {
+			key := hashKey(leftValues(combination, keys))
+			built[key] = append(built[key], c)
+		}
 
+		// Matches are returned in the order of a nested loop over the combinations joined before
+		var matches [][2]int
+		for r, row := range rows {
+			for _, c := range built[hashKey(rightValues(row, keys))] {
+				matches = append(matches, [2]int{c, r})
+			}
 		}
 
+		slices.SortFunc(matches, func(a, b [2]int) int {
+			if a[0] != b[0] {
+				return a[0] - b[0]
+			}
+
+			return a[1] - b[1]
+		})
+
+		for _, match := range matches {
+			combine(combinations[match[0]], rows[match[1]])
+		}
 	}
 
-	return filteredRows, nil
+	trace.Actual = int64(len(rows))
 
+	return joined, nil
 }
 
-// Optimize struct
-// Reads abstract syntax tree and collections tables and columns to check for index optimization
-type Optimize struct {
-	Tables map[string][]map[string]interface{} // Table and columns to check
-}
+// scanFiltered reads the rows of a table a runtime filter can match, the rows it rules out are skipped as they are read
+func (ex *Executor) scanFiltered(tbl *catalog.Table, filter *catalog.RuntimeFilter) ([]map[string]interface{}, catalog.FilterStats, error) {
+	if ex.optimizerTrace != nil {
+		trace := ex.tableTrace(tbl)
+		trace.Chosen, trace.Reason = "FULL SCAN", fmt.Sprintf("runtime filter of %d values on %s", filter.Keys(), filter.Column)
+	}
 
-// opt optimizes the where clause
-func (ex *Executor) opt(cond interface{}, optimize *Optimize, tbls []*catalog.Table) error {
-	switch cond.(type) {
-	case *parser.LogicalCondition:
-		err := ex.opt(cond.(*parser.LogicalCondition).Left, optimize, tbls)
-		if err != nil {
-			return err
+	end := ex.startSpan("full scan", attribute.String("db.collection.name", tbl.Name))
+
+	iter := tbl.NewIterator()
+	iter.Filter(filter)
+
+	var rows []map[string]interface{}
 
+	for iter.Valid() {
+		row, err := ex.next(iter)
+		if errors.Is(err, core.ErrQueryCancelled) {
+			end(err)
+			return nil, iter.FilterStats(), err
 		}
 
-		err = ex.opt(cond.(*parser.LogicalCondition).Right, optimize, tbls)
-		if err != nil {
-			return err
+		if err != nil || row == nil {
+			continue
 		}
 
-	case *parser.ComparisonPredicate:
-		// check if left is column spec
-		if _, ok := cond.(*parser.ComparisonPredicate).Left.Value.(*parser.ColumnSpecification); ok {
-			col := cond.(*parser.ComparisonPredicate).Left.Value.(*parser.ColumnSpecification)
+		formatTemporal(tbl, row)
+		rows = append(rows, row)
+	}
 
-			var tbl *catalog.Table
+	end(nil)
 
-			// In case of aliases
-			if col.TableName != nil {
-				for _, t := range tbls {
-					if t.Name == col.TableName.Value {
-						tbl = t
-						break
-					}
-				}
-			}
+	return rows, iter.FilterStats(), nil
+}
 
-			if tbl == nil {
-				// Get first table in tables list
-				tbl = ex.ch.Database.GetTable(tbls[0].Name)
-				if tbl == nil {
-					return errors.New("table does not exist")
-				}
+// leftValues returns the values of a combination a table is joined on
+func leftValues(combination []map[string]interface{}, keys []joinKey) []interface{} {
+	values := make([]interface{}, len(keys))
+	for i, key := range keys {
+		values[i] = combination[key.source][key.left]
+	}
 
-				col.TableName = &parser.Identifier{Value: tbl.Name}
-			}
+	return values
+}
 
-			iter := tbl.NewIterator()
-			if iter.Valid() {
-				row, err := iter.Next()
-				if err != nil {
-					return err
-				}
+// rightValues returns the values of a row of a table it is joined on
+func rightValues(row map[string]interface{}, keys []joinKey) []interface{} {
+	values := make([]interface{}, len(keys))
+	for i, key := range keys {
+		values[i] = row[key.right]
+	}
 
-				for k, _ := range row {
-					if k == col.ColumnName.Value {
+	return values
+}
 
-						optimize.Tables[col.TableName.Value] = append(optimize.Tables[col.TableName.Value], map[string]interface{}{"column": col.ColumnName.Value, "value": row[k]})
+// hashKey returns the key values are hashed under when joined, see catalog.JoinKey
+// Values under the same key can still differ, the where clause is evaluated on every combination joined
+func hashKey(values []interface{}) string {
+	var key strings.Builder
 
-						// check if right is column spec
-						if _, ok := cond.(*parser.ComparisonPredicate).Right.Value.(*parser.ColumnSpecification); ok {
+	for _, value := range values {
+		key.WriteString(catalog.JoinKey(value))
+		key.WriteByte(0)
+	}
 
-							col = cond.(*parser.ComparisonPredicate).Right.Value.(*parser.ColumnSpecification)
+	return key.String()
+}
 
-							iter := tbl.NewIterator()
-							if iter.Valid() {
-								row, err := iter.Next()
-								if err != nil {
-									return err
-								}
+// formatTemporal formats the DATE, TIME, TIMESTAMP and DATETIME values of a row read from a table as quoted literals
+func formatTemporal(tbl *catalog.Table, row map[string]interface{}) {
+	for k, v := range row {
+		t, ok := v.(time.Time)
+		if !ok {
+			continue
+		}
 
-								for k, _ := range row {
-									if k == col.ColumnName.Value {
-										optimize.Tables[col.TableName.Value] = append(optimize.Tables[col.TableName.Value], map[string]interface{}{"column": col.ColumnName.Value, "value": row[k]})
+		col, ok := tbl.TableSchema.ColumnDefinitions[k]
+		if !ok {
+			continue
+		}
 
-										break // break out of loop
-									}
-								}
-							}
+		switch col.DataType {
+		case "DATE":
+			row[k] = fmt.Sprintf("'%s'", t.Format("2006-01-02"))
+		case "TIME":
+			row[k] = fmt.Sprintf("'%s'", t.Format("15:04:05"))
+		case "TIMESTAMP", "DATETIME":
+			row[k] = fmt.Sprintf("'%s'", t.Format("2006-01-02 15:04:05"))
+		}
+	}
+}
 
-							break // break out of loop
-						}
+// pivotTables pivots or unpivots the rows read from a single table, rows are returned as is if the table is neither
+func pivotTables(from *parser.FromClause, rows []map[string]interface{}) ([]map[string]interface{}, error) {
+	if from == nil {
+		return rows, nil
+	}
 
-						break // break out of loop
-					}
-				}
-			}
+	for _, tbl := range from.Tables {
+		if tbl.Pivot == nil && tbl.Unpivot == nil {
+			continue
+		}
 
+		if len(from.Tables) != 1 {
+			return nil, errors.New("PIVOT and UNPIVOT are only supported when selecting from a single table")
 		}
 
-	case *parser.InPredicate:
-		// check if left is column spec
-		if _, ok := cond.(*parser.InPredicate).Left.Value.(*parser.ColumnSpecification); ok {
-			col := cond.(*parser.InPredicate).Left.Value.(*parser.ColumnSpecification)
+		if tbl.Pivot != nil {
+			return pivot(tbl.Pivot, rows)
+		}
 
-			if col.TableName == nil {
+		return unpivot(tbl.Unpivot, rows)
+	}
 
-				// Get first table in tables list
-				tbl := ex.ch.Database.GetTable(tbls[0].Name)
-				if tbl == nil {
-					return errors.New("table does not exist")
-				}
+	return rows, nil
+}
 
-				iter := tbl.NewIterator()
-				if iter.Valid() {
-					row, err := iter.Next()
-					if err != nil {
-						return err
-					}
+// pivot returns a row for every distinct value of the columns neither aggregated nor pivoted
+// Every value listed becomes a column, the aggregate of the rows of the group having that value
+func pivot(clause *parser.PivotClause, rows []map[string]interface{}) ([]map[string]interface{}, error) {
+	aggregated := ""
+	if len(clause.Aggregate.Args) > 0 {
+		if column, ok := clause.Aggregate.Args[0].(*parser.ColumnSpecification); ok {
+			aggregated = column.ColumnName.Value
+		}
+	}
 
-					for k, _ := range row {
-						if k == col.ColumnName.Value {
-							col.TableName = &parser.Identifier{Value: tbl.Name}
-							break // break out of loop
-						}
-					}
+	forColumn := clause.For.ColumnName.Value
 
-				}
-			}
+	// Columns are gathered from every row, a row read may not have every column
+	present := make(map[string]bool)
+	for _, row := range rows {
+		for column := range row {
+			present[column] = true
+		}
+	}
 
-			for _, val := range cond.(*parser.InPredicate).Values {
-				optimize.Tables[col.TableName.Value] = append(optimize.Tables[col.TableName.Value], map[string]interface{}{"column": col.ColumnName.Value, "value": val.Value})
-			}
+	if len(rows) > 0 && !present[forColumn] {
+		return nil, fmt.Errorf("column %s does not exist", forColumn)
+	}
 
+	var columns []string
+	for column := range present {
+		if column != aggregated && column != forColumn {
+			columns = append(columns, column)
 		}
-	case *parser.BetweenPredicate:
-		// check if left is column spec
-		if _, ok := cond.(*parser.BetweenPredicate).Left.Value.(*parser.ColumnSpecification); ok {
-			col := cond.(*parser.BetweenPredicate).Left.Value.(*parser.ColumnSpecification)
+	}
 
-			if col.TableName == nil {
+	sort.Strings(columns)
 
-				// Get first table in tables list
-				tbl := ex.ch.Database.GetTable(tbls[0].Name)
-				if tbl == nil {
-					return errors.New("table does not exist")
-				}
+	names := make([]string, len(clause.Values))
+	values := make([]string, len(clause.Values))
 
-				iter := tbl.NewIterator()
-				if iter.Valid() {
-					row, err := iter.Next()
-					if err != nil {
-						return err
-					}
+	for i, value := range clause.Values {
+		v := value.Value.Value
+		if u, ok := v.(uint64); ok {
+			v = int(u)
+		}
 
-					for k, _ := range row {
-						if k == col.ColumnName.Value {
-							col.TableName = &parser.Identifier{Value: tbl.Name}
-							break // break out of loop
-						}
-					}
+		values[i] = fmt.Sprintf("%v", v)
 
-				}
-			}
+		if value.Alias != nil {
+			names[i] = value.Alias.Value
+		} else if str, ok := v.(string); ok {
+			names[i] = shared.UnquoteLiteral(str)
+		} else {
+			names[i] = values[i]
+		}
 
-			if _, ok := optimize.Tables[col.TableName.Value]; !ok {
-				optimize.Tables[col.TableName.Value] = []map[string]interface{}{}
-			}
+		if present[names[i]] && !strings.EqualFold(names[i], forColumn) && names[i] != aggregated {
+			return nil, fmt.Errorf("pivoted column %s already exists", names[i])
+		}
+	}
 
-			optimize.Tables[col.TableName.Value] = append(optimize.Tables[col.TableName.Value], map[string]interface{}{"column": col.ColumnName.Value, "value": cond.(*parser.BetweenPredicate).Upper.Value})
-			optimize.Tables[col.TableName.Value] = append(optimize.Tables[col.TableName.Value], map[string]interface{}{"column": col.ColumnName.Value, "value": cond.(*parser.BetweenPredicate).Lower.Value})
+	// Groups are kept in the order they are first read
+	var keys []string
+	groups := make(map[string][]map[string]interface{})
 
+	for _, row := range rows {
+		key := ""
+		for _, column := range columns {
+			key += fmt.Sprintf("%v\x00", row[column])
 		}
-	case *parser.LikePredicate:
-		// check if left is column spec
-		if _, ok := cond.(*parser.LikePredicate).Left.Value.(*parser.ColumnSpecification); ok {
 
-			col := cond.(*parser.LikePredicate).Left.Value.(*parser.ColumnSpecification)
+		if _, ok := groups[key]; !ok {
+			keys = append(keys, key)
+		}
 
-			if col.TableName == nil {
+		groups[key] = append(groups[key], row)
+	}
 
-				// Get first table in tables list
-				tbl := ex.ch.Database.GetTable(tbls[0].Name)
-				if tbl == nil {
-					return errors.New("table does not exist")
-				}
+	pivoted := make([]map[string]interface{}, 0, len(keys))
 
-				iter := tbl.NewIterator()
-				if iter.Valid() {
-					row, err := iter.Next()
-					if err != nil {
-						return err
-					}
+	for _, key := range keys {
+		group := groups[key]
 
-					for k, _ := range row {
-						if k == col.ColumnName.Value {
-							col.TableName = &parser.Identifier{Value: tbl.Name}
-							break // break out of loop
-						}
-					}
+		row := make(map[string]interface{})
+		for _, column := range columns {
+			row[column] = group[0][column]
+		}
 
+		for i := range clause.Values {
+			var matching []map[string]interface{}
+			for _, r := range group {
+				if fmt.Sprintf("%v", r[forColumn]) == values[i] {
+					matching = append(matching, r)
 				}
 			}
 
-			if _, ok := optimize.Tables[col.TableName.Value]; !ok {
-				optimize.Tables[col.TableName.Value] = []map[string]interface{}{}
+			value, err := aggregateGroup(clause.Aggregate, matching)
+			if err != nil {
+				return nil, err
 			}
 
-			optimize.Tables[col.TableName.Value] = append(optimize.Tables[col.TableName.Value], map[string]interface{}{"column": col.ColumnName.Value, "value": cond.(*parser.LikePredicate).Pattern.Value})
-
+			row[names[i]] = value
 		}
-	case *parser.IsPredicate:
-		// check if left is column spec
-		if _, ok := cond.(*parser.IsPredicate).Left.Value.(*parser.ColumnSpecification); ok {
-			col := cond.(*parser.IsPredicate).Left.Value.(*parser.ColumnSpecification)
 
-			if col.TableName == nil {
+		pivoted = append(pivoted, row)
+	}
 
-				// Get first table in tables list
-				tbl := ex.ch.Database.GetTable(tbls[0].Name)
-				if tbl == nil {
-					return errors.New("table does not exist")
-				}
+	return pivoted, nil
+}
 
-				iter := tbl.NewIterator()
-				if iter.Valid() {
-					row, err := iter.Next()
-					if err != nil {
-						return err
-					}
+// unpivot returns a row for every column listed of every row, the name of the column and its value
+// The columns not listed are kept, a NULL value is skipped
+func unpivot(clause *parser.UnpivotClause, rows []map[string]interface{}) ([]map[string]interface{}, error) {
+	listed := make(map[string]bool)
+	for _, column := range clause.Columns {
+		listed[column.Value] = true
+	}
 
-					for k, _ := range row {
-						if k == col.ColumnName.Value {
-							col.TableName = &parser.Identifier{Value: tbl.Name}
-							break // break out of loop
-						}
-					}
+	unpivoted := make([]map[string]interface{}, 0, len(rows))
 
-				}
+	for _, row := range rows {
+		for _, column := range clause.Columns {
+			value, ok := row[column.Value]
+			if !ok {
+				return nil, fmt.Errorf("column %s does not exist", column.Value)
 			}
 
-			if _, ok := optimize.Tables[col.TableName.Value]; !ok {
-				optimize.Tables[col.TableName.Value] = []map[string]interface{}{}
+			if value == nil {
+				continue
 			}
 
-			optimize.Tables[col.TableName.Value] = append(optimize.Tables[col.TableName.Value], map[string]interface{}{"column": col.ColumnName.Value, "value": nil})
+			r := make(map[string]interface{})
+			for k, v := range row {
+				if !listed[k] {
+					r[k] = v
+				}
+			}
 
-		}
-	case *parser.NotExpr:
-		err := ex.opt(cond.(*parser.NotExpr).Expr, optimize, tbls)
-		if err != nil {
-			return err
+			r[clause.For.Value] = shared.QuoteLiteral(column.Value)
+			r[clause.Value.Value] = value
+
+			unpivoted = append(unpivoted, r)
 		}
 	}
-	return nil
-}
 
-// Row represents a row object
-// ID is the page/row id and Row is the actual row
-type Row struct {
-	ID  int64
-	Row *map[string]interface{}
+	return unpivoted, nil
 }
 
-// convertRowsToMap converts a slice of rows to a slice of maps
-func convertRowsToMap(rows []*Row) []map[string]interface{} {
-	var results []map[string]interface{}
-
-	for _, row := range rows {
-		results = append(results, *row.Row)
+// asOfTable returns true if any table a select statement reads from is read AS OF a timestamp or FOR SYSTEM_TIME BETWEEN timestamps
+func asOfTable(stmt *parser.SelectStmt) bool {
+	for _, tbl := range stmt.TableExpression.FromClause.Tables {
+		if tbl.AsOf != nil || tbl.Between != nil {
+			return true
+		}
 	}
 
-	return results
+	return false
 }
 
-// convertPlanToRows converts a plan to rows
-func convertPlanToRows(plan *Plan) []map[string]interface{} {
-	var results []map[string]interface{}
+// parseTimestamp parses the timestamp of an AS OF or FOR SYSTEM_TIME clause, in local time or RFC 3339
+func parseTimestamp(literal *parser.Literal) (time.Time, error) {
+	timestamp := strings.Trim(literal.Value.(string), "'")
 
-	for _, step := range plan.Steps {
+	t, err := time.ParseInLocation("2006-01-02 15:04:05", timestamp, time.Local)
+	if err != nil {
+		t, err = time.Parse(time.RFC3339, timestamp)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid timestamp %s", timestamp)
+		}
+	}
 
-		op := ""
+	return t, nil
+}
 
-		switch step.Operation {
-		case FULL_SCAN:
-			op = "FULL SCAN"
-		case INDEX_SCAN:
-			op = "INDEX SCAN"
+// readAsOf returns the rows of a table as they were at the AS OF timestamp of tblExpr, or every version of the rows
+// within its FOR SYSTEM_TIME BETWEEN range, matching the where clause
+func (ex *Executor) readAsOf(tbl *catalog.Table, tblExpr *parser.Table, where *parser.WhereClause) ([]map[string]interface{}, error) {
+	var from, to time.Time
+	var err error
+
+	if tblExpr.Between != nil {
+		from, err = parseTimestamp(tblExpr.Between[0])
+		if err != nil {
+			return nil, err
 		}
 
-		results = append(results, map[string]interface{}{"operation": op, "table": step.Table, "column": step.Column, "io": step.IO})
+		to, err = parseTimestamp(tblExpr.Between[1])
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		from, err = parseTimestamp(tblExpr.AsOf)
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	return results
-}
+	if ex.explaining {
+		ex.plan.Steps = append(ex.plan.Steps, &Step{Operation: FULL_SCAN, Table: tbl.Name, Column: "n/a", IO: tbl.IOCount()})
+		ex.ResultSetBuffer = shared.CreateTableByteArray(convertPlanToRows(ex.plan), shared.GetHeaders(convertPlanToRows(ex.plan), true))
+		return nil, nil
+	}
 
-// filter filters rows based on the where clause
-func (ex *Executor) filter(where *parser.WhereClause, tbls []*catalog.Table, filteredRows *[]map[string]interface{}, rowIds *[]int64) error {
+	end := ex.startSpan("flashback scan", attribute.String("db.collection.name", tbl.Name))
 
-	if len(tbls) == 0 {
-		return errors.New("no tables")
+	var rows []map[string]interface{}
+	if tblExpr.Between != nil {
+		rows, err = tbl.Between(from, to)
+	} else {
+		rows, err = tbl.AsOf(from)
 	}
 
-	// gather the tables and columns to check
-	optimize := &Optimize{
-		Tables: make(map[string][]map[string]interface{}),
+	end(err)
+	if err != nil {
+		return nil, err
 	}
 
-	if where != nil {
+	var filteredRows []map[string]interface{}
 
-		// Check for optimizations, such as indexes
-		err := ex.opt(where.SearchCondition, optimize, tbls)
-		if err != nil {
-			return err
+	for _, row := range rows {
+		for k, v := range row {
+			if v, ok := v.(time.Time); ok {
+				if k == catalog.SYSTEM_TIME_START || k == catalog.SYSTEM_TIME_END {
+					row[k] = fmt.Sprintf("'%s'", v.Local().Format("2006-01-02 15:04:05"))
+				} else if col, ok := tbl.TableSchema.ColumnDefinitions[k]; ok {
+					switch col.DataType {
+					case "DATE":
+						row[k] = fmt.Sprintf("'%s'", v.Format("2006-01-02"))
+					case "TIME":
+						row[k] = fmt.Sprintf("'%s'", v.Format("15:04:05"))
+					case "TIMESTAMP", "DATETIME":
+						row[k] = fmt.Sprintf("'%s'", v.Format("2006-01-02 15:04:05"))
+					}
+				}
+			}
 		}
 
-		if ex.explaining {
-			for tblName, colsValues := range optimize.Tables {
+		current := []map[string]interface{}{row}
 
-				for _, colValue := range colsValues {
-					// Get index
-					var tbl *catalog.Table
+		if ex.evaluateWhereClause(where, &current, nil, &[]map[string]interface{}{}) {
+			filteredRows = append(filteredRows, row)
+		}
+	}
 
-					for _, t := range tbls {
-						if t.Name == tblName {
-							tbl = t
-							break
-						}
-					}
+	return filteredRows, nil
+}
 
-					idx := tbl.CheckIndexedColumn(colValue["column"].(string), true)
-					if idx == nil {
-						// check if non unique index
-						idx = tbl.CheckIndexedColumn(colValue["column"].(string), false)
-						if idx == nil {
-							idx = nil
-						}
-					}
+// systemView returns the system view a select statement reads from, if any, qualified by its schema
+func systemView(stmt *parser.SelectStmt) (string, bool) {
+	if stmt.TableExpression == nil || stmt.TableExpression.FromClause == nil || len(stmt.TableExpression.FromClause.Tables) != 1 {
+		return "", false
+	}
 
-					io := 0
+	name := strings.ToLower(stmt.TableExpression.FromClause.Tables[0].Name.Value)
+	if !strings.HasPrefix(name, INFORMATION_SCHEMA+".") && !strings.HasPrefix(name, SYS_SCHEMA+".") {
+		return "", false
+	}
 
-					if idx != nil {
-						// check if value is literal
+	return name, true
+}
 
-						// check if table is using compression
-						if tbl.Compress {
-							// Compress the value
-							colValue["value"], err = catalog.Compress([]byte(fmt.Sprintf("%v", colValue["value"])))
-						}
+// readSystemView returns the rows of a system view matching the where clause
+func (ex *Executor) readSystemView(view string, where *parser.WhereClause) ([]map[string]interface{}, error) {
+	var rows []map[string]interface{}
 
-						// Check if encryption is enabled
-						if tbl.Encrypt {
-							// Encrypt the value
-							colValue["value"], err = catalog.Encrypt(tbl.HashedKey, tbl.Nonce, []byte(fmt.Sprintf("%v", colValue["value"])))
-						}
+	switch view {
+	case INFORMATION_SCHEMA + ".table_io_stats":
+		// IO of tables and indexes the user can select from
+		stats, err := ex.aria.Catalog.IOStats()
+		if err != nil {
+			return nil, err
+		}
 
-						var key *btree.Key
+		for _, stat := range stats {
+			if !ex.currentUser().HasPrivilege(stat.Database, stat.Table, []shared.PrivilegeAction{shared.PRIV_SELECT}) {
+				continue
+			}
 
-						if tbl.Encrypt || tbl.Compress {
-							idx.GetLock().Lock()
-							key, err = idx.GetBtree().Get(colValue["value"].([]byte))
-							if err != nil {
-								idx.GetLock().Unlock()
-								return err
-							}
-							idx.GetLock().Unlock()
-						} else {
-							idx.GetLock().Lock()
-							key, err = idx.GetBtree().Get([]byte(fmt.Sprintf("%v", colValue["value"])))
-							if err != nil {
-								idx.GetLock().Unlock()
-								return err
-							}
-							idx.GetLock().Unlock()
-						}
+			// Strings are quoted as within table rows so they compare with literals
+			var index interface{}
+			if stat.Index != "" {
+				index = fmt.Sprintf("'%s'", stat.Index)
+			}
 
-						if key != nil {
-							for range key.V {
-								io++
-							}
-						}
+			avgRead, avgWrite := 0, 0
+			if stat.Reads > 0 {
+				avgRead = int(stat.ReadTime.Microseconds() / stat.Reads)
+			}
 
-						ex.plan.Steps = append(ex.plan.Steps, &Step{Operation: INDEX_SCAN, Table: tblName, Column: colValue["column"].(string), IO: int64(io) + idx.GetBtree().Pager.Count()})
+			if stat.Writes > 0 {
+				avgWrite = int(stat.WriteTime.Microseconds() / stat.Writes)
+			}
 
-					} else {
-						// remove from optimize
-						delete(optimize.Tables, tblName)
-					}
+			rows = append(rows, map[string]interface{}{
+				"database_name": fmt.Sprintf("'%s'", stat.Database),
+				"table_name":    fmt.Sprintf("'%s'", stat.Table),
+				"index_name":    index,
+				"reads":         int(stat.Reads),
+				"writes":        int(stat.Writes),
+				"bytes_read":    int(stat.BytesRead),
+				"bytes_written": int(stat.BytesWritten),
+				"syncs":         int(stat.Syncs),
+				"read_time_us":  int(stat.ReadTime.Microseconds()),
+				"write_time_us": int(stat.WriteTime.Microseconds()),
+				"sync_time_us":  int(stat.SyncTime.Microseconds()),
+				"avg_read_us":   avgRead,
+				"avg_write_us":  avgWrite,
+			})
+		}
+	case SYS_SCHEMA + ".session_waits":
+		// Cumulative waits of the sessions open, users without the SHOW privilege only see their own
+		all := ex.currentUser().HasPrivilege("*", "*", []shared.PrivilegeAction{shared.PRIV_SHOW})
 
-				}
+		ex.aria.ChannelsLock.Lock()
+		channels := slices.Clone(ex.aria.Channels)
+		ex.aria.ChannelsLock.Unlock()
+
+		for _, ch := range channels {
+			if ch.Waits == nil || ch.User == nil || (!all && ch.User.Username != ex.ch.User.Username) {
+				continue
 			}
 
-			ex.ResultSetBuffer = shared.CreateTableByteArray(convertPlanToRows(ex.plan), shared.GetHeaders(convertPlanToRows(ex.plan), true))
+			current, since, waiting := ch.Waits.Current()
 
-			return nil
+			for _, stat := range ch.Waits.Stats() {
+				currentWait := 0
+				if waiting && current == stat.Event {
+					currentWait = int(since.Microseconds())
+				}
+
+				// Events never waited on are left out
+				if stat.Waits == 0 && stat.Waiting == 0 {
+					continue
+				}
 
+				rows = append(rows, map[string]interface{}{
+					"session_id":      int(ch.ChannelID),
+					"user_name":       fmt.Sprintf("'%s'", ch.User.Username),
+					"event":           fmt.Sprintf("'%s'", stat.Event),
+					"waits":           int(stat.Waits),
+					"wait_time_us":    int(stat.Total.Microseconds()),
+					"max_wait_us":     int(stat.Max.Microseconds()),
+					"waiting":         int(stat.Waiting),
+					"current_wait_us": currentWait,
+				})
+			}
 		}
-	}
+	case SYS_SCHEMA + ".statement_stats":
+		// Executions by statement digest, users without the SHOW privilege only see their own
+		all := ex.currentUser().HasPrivilege("*", "*", []shared.PrivilegeAction{shared.PRIV_SHOW})
 
-	indexedColumns := make(map[string]*catalog.Index)
+		for _, stat := range ex.aria.Statements.Stats() {
+			if !all && stat.User != ex.ch.User.Username {
+				continue
+			}
 
-	var tblIters []*catalog.Iterator
+			var database interface{}
+			if stat.Database != "" {
+				database = fmt.Sprintf("'%s'", stat.Database)
+			}
 
-	// For each table
-	for _, tbl := range tbls {
-		// skip table where index is found
-		if _, ok := indexedColumns[tbl.Name]; ok {
-			continue
+			rows = append(rows, map[string]interface{}{
+				"digest":        fmt.Sprintf("'%s'", stat.Digest),
+				"query":         fmt.Sprintf("'%s'", stat.Query),
+				"database_name": database,
+				"user_name":     fmt.Sprintf("'%s'", stat.User),
+				"calls":         int(stat.Calls),
+				"errors":        int(stat.Errors),
+				"rows":          int(stat.Rows),
+				"total_time_us": int(stat.Total.Microseconds()),
+				"min_time_us":   int(stat.Min.Microseconds()),
+				"max_time_us":   int(stat.Max.Microseconds()),
+				"mean_time_us":  int(stat.Mean().Microseconds()),
+			})
+		}
+	case SYS_SCHEMA + ".migrations":
+		// Migrations applied to the database selected
+		if ex.ch.Database == nil {
+			return nil, errors.New("no database selected")
 		}
 
-		// Setup new row iterator
-		iter := tbl.NewIterator()
-
-		tblIters = append(tblIters, iter)
-
-	}
+		if !ex.currentUser().HasPrivilege(ex.ch.Database.Name, "*", []shared.PrivilegeAction{shared.PRIV_SELECT}) {
+			return nil, fmt.Errorf("%w to SELECT on database %s", ErrNoPrivilege, ex.ch.Database.Name)
+		}
 
-	invalidIters := 0
+		migrations, err := ex.ch.Database.GetMigrations()
+		if err != nil {
+			return nil, err
+		}
 
-	var currentRows []*Row
+		for _, m := range migrations {
+			rows = append(rows, map[string]interface{}{
+				"version":    m.Version,
+				"name":       fmt.Sprintf("'%s'", m.Name),
+				"file":       fmt.Sprintf("'%s'", m.File),
+				"checksum":   fmt.Sprintf("'%s'", m.Checksum),
+				"statements": m.Statements,
+				"applied_by": fmt.Sprintf("'%s'", m.AppliedBy),
+				"applied_at": fmt.Sprintf("'%s'", shared.FormatToDateTime(m.AppliedAt)),
+			})
+		}
+	case SYS_SCHEMA + ".tiers":
+		// Tier the files of every table of the database selected are on
+		if ex.ch.Database == nil {
+			return nil, errors.New("no database selected")
+		}
 
-	if len(optimize.Tables) > 0 {
-		for tblName, colsValues := range optimize.Tables {
-			var tbl *catalog.Table
+		names := ex.ch.Database.GetTables()
+		sort.Strings(names)
 
-			for _, t := range tbls {
-				if t.Name == tblName {
-					tbl = t
-					break
-				}
+		for _, name := range names {
+			if !ex.currentUser().HasPrivilege(ex.ch.Database.Name, name, []shared.PrivilegeAction{shared.PRIV_SELECT}) {
+				continue
 			}
 
-			for _, colValue := range colsValues {
-				col := colValue["column"].(string)
-				val := colValue["value"]
-
-				var idx *catalog.Index
+			placement := ex.ch.Database.Placement(name)
+			if placement == nil {
+				continue
+			}
 
-				idx = tbl.CheckIndexedColumn(col, true)
-				if idx == nil {
-					// try not unique index
-					idx = tbl.CheckIndexedColumn(col, false)
-					if idx != nil {
-						idx = nil
+			row := map[string]interface{}{
+				"table_name":    fmt.Sprintf("'%s'", name),
+				"tier":          fmt.Sprintf("'%s'", placement.Tier),
+				"directory":     fmt.Sprintf("'%s'", placement.Directory),
+				"last_accessed": fmt.Sprintf("'%s'", shared.FormatToDateTime(placement.Accessed)),
+				"warm":          0,
+			}
 
-					}
+			if placement.Warm {
+				row["warm"] = 1
+			}
 
-				}
+			rows = append(rows, row)
+		}
+	case SYS_SCHEMA + ".quarantine":
+		// Objects quarantined by safe mode on startup
+		if !ex.currentUser().HasPrivilege("*", "*", []shared.PrivilegeAction{shared.PRIV_SHOW}) {
+			return nil, fmt.Errorf("%w to SHOW on system", ErrNoPrivilege)
+		}
 
-				if idx != nil {
+		for _, q := range ex.aria.Catalog.GetQuarantined() {
+			rows = append(rows, map[string]interface{}{
+				"database_name": fmt.Sprintf("'%s'", q.Database),
+				"name":          fmt.Sprintf("'%s'", q.Name),
+				"kind":          fmt.Sprintf("'%s'", q.Kind),
+				"path":          fmt.Sprintf("'%s'", q.Path),
+				"reason":        fmt.Sprintf("'%s'", q.Reason),
+			})
+		}
+	case SYS_SCHEMA + ".disk":
+		// Free space of the data directory and whether the server is read-only, to alert on a filling disk
+		if !ex.currentUser().HasPrivilege("*", "*", []shared.PrivilegeAction{shared.PRIV_SHOW}) {
+			return nil, fmt.Errorf("%w to SHOW on system", ErrNoPrivilege)
+		}
 
-					var key *btree.Key
+		free, err := storage.FreeSpace(ex.aria.Config.DataDir)
+		if err != nil {
+			return nil, err
+		}
 
-					if tbl.Compress {
-						var err error
-						// Compress the value
-						val, err = catalog.Compress([]byte(fmt.Sprintf("%v", val)))
-						if err != nil {
-							return err
-						}
+		row := map[string]interface{}{
+			"data_dir":        fmt.Sprintf("'%s'", ex.aria.Config.DataDir),
+			"free_bytes":      int(free),
+			"min_free_bytes":  int(ex.aria.Config.MinFreeSpace),
+			"read_only":       0,
+			"reason":          nil,
+			"since":           nil,
+			"read_only_count": int(ex.aria.ReadOnlies()),
+		}
 
-					}
+		if readOnly := ex.aria.ReadOnly(); readOnly != nil {
+			row["read_only"] = 1
+			row["reason"] = fmt.Sprintf("'%s'", readOnly.Reason)
+			row["since"] = fmt.Sprintf("'%s'", shared.FormatToDateTime(readOnly.Since))
+		}
 
-					if tbl.Encrypt {
-						var err error
-						// Encrypt the value
-						val, err = catalog.Encrypt(tbl.HashedKey, tbl.Nonce, []byte(fmt.Sprintf("%v", val)))
-						if err != nil {
-							return err
-						}
-					}
+		rows = append(rows, row)
+	case SYS_SCHEMA + ".checkpoint":
+		// Last checkpoint taken, empty if none was
+		if !ex.currentUser().HasPrivilege("*", "*", []shared.PrivilegeAction{shared.PRIV_SHOW}) {
+			return nil, fmt.Errorf("%w to SHOW on system", ErrNoPrivilege)
+		}
 
-					if tbl.Encrypt || tbl.Compress {
-						var err error
-						idx.GetLock().Lock()
-						key, err = idx.GetBtree().Get(val.([]byte))
-						if err != nil {
-							idx.GetLock().Unlock()
-							return err
-						}
+		if ex.aria.Checkpointer == nil {
+			break
+		}
 
-						idx.GetLock().Unlock()
-					} else {
-						var err error
-						idx.GetLock().Lock()
-						key, err = idx.GetBtree().Get([]byte(fmt.Sprintf("%v", val)))
-						if err != nil {
-							idx.GetLock().Unlock()
-							return err
-						}
+		if last := ex.aria.Checkpointer.Last(); last != nil {
+			rows = append(rows, map[string]interface{}{
+				"lsn":          int(last.LSN),
+				"created":      fmt.Sprintf("'%s'", shared.FormatToDateTime(last.Created)),
+				"files":        last.Files,
+				"bytes_copied": int(last.Copied),
+				"duration_us":  int(last.Duration.Microseconds()),
+			})
+		}
+	case SYS_SCHEMA + ".retention":
+		// Space taken by the logs retained and how much of it the next purge reclaims, empty without retention
+		if !ex.currentUser().HasPrivilege("*", "*", []shared.PrivilegeAction{shared.PRIV_SHOW}) {
+			return nil, fmt.Errorf("%w to SHOW on system", ErrNoPrivilege)
+		}
 
-						idx.GetLock().Unlock()
-					}
+		if ex.aria.Purger == nil {
+			break
+		}
 
-					if key != nil {
-						for _, v := range key.V {
-							int64Str := string(v)
-							rRowId, err := strconv.ParseInt(int64Str, 10, 64)
-							if err != nil {
-								return err
-							}
+		usage, err := ex.aria.Purger.Usage()
+		if err != nil {
+			return nil, err
+		}
 
-							row, err := tbl.GetRow(rRowId)
-							if err != nil {
-								return err
-							}
+		for _, u := range usage {
+			var lastPurge interface{}
+			if !u.LastPurge.IsZero() {
+				lastPurge = fmt.Sprintf("'%s'", shared.FormatToDateTime(u.LastPurge))
+			}
 
-							// convert to tablename.columnname
-							for k, vv := range row {
-								delete(row, k)
-								row[fmt.Sprintf("%v.%v", tbl.Name, k)] = vv
-							}
+			rows = append(rows, map[string]interface{}{
+				"log":               fmt.Sprintf("'%s'", u.Log),
+				"files":             u.Files,
+				"bytes":             int(u.Bytes),
+				"reclaimable_bytes": int(u.Reclaimable),
+				"purged_bytes":      int(u.Purged),
+				"last_purge":        lastPurge,
+			})
+		}
+	default:
+		return nil, fmt.Errorf("%s does not exist", view)
+	}
 
-							currentRows = append(currentRows, &Row{ID: rRowId, Row: &row})
+	if where == nil {
+		return rows, nil
+	}
 
-						}
-					}
-				}
+	var filteredRows []map[string]interface{}
 
-			}
+	for _, row := range rows {
+		current := []map[string]interface{}{row}
 
+		if ex.evaluateWhereClause(where, &current, nil, &[]map[string]interface{}{}) {
+			filteredRows = append(filteredRows, row)
 		}
 	}
 
-	for invalidIters < len(tblIters) {
-		if invalidIters >= len(tblIters) {
-			break
+	return filteredRows, nil
+}
+
+// checkWildcard checks select list for wildcard
+func (ex *Executor) checkWildcard(selectList *parser.SelectList) bool {
+	for _, expr := range selectList.Expressions {
+		if _, ok := expr.Value.(*parser.Wildcard); ok {
+			return true
 		}
+	}
 
-		for i := 0; i < len(tblIters); i++ {
-			iter := tblIters[i]
+	return false
+}
 
-			if iter.Valid() {
-				row, err := iter.Next()
-				if err != nil {
+// removeAggregatesFromSelectList removes aggregates from the select list, after evaluating the having clause
+func (ex *Executor) removeAggregatesFromSelectList(selectList *parser.SelectList, headers *[]string) {
 
-					invalidIters++
-					continue
-				}
+	for i, expr := range selectList.Expressions {
+		if agg, ok := expr.Value.(*parser.AggregateFunc); ok {
 
-				// convert row to tablename.columnname
+			// replace aggregate function with column specification
+			for _, arg := range agg.Args {
+				if colSpec, ok := arg.(*parser.ColumnSpecification); ok {
 
-				if i > len(tbls)-1 {
-					break
-				}
+					if expr.Alias != nil {
+						selectList.Expressions[i] = &parser.ValueExpression{Value: colSpec, Alias: expr.Alias}
+						selectList.Expressions[i] = &parser.ValueExpression{Value: &parser.ColumnSpecification{ColumnName: &parser.Identifier{
+							Value: expr.Alias.Value,
+						}}}
+						*headers = append(*headers, expr.Alias.Value)
+					} else {
+						selectList.Expressions[i] = &parser.ValueExpression{Value: colSpec}
+					}
 
-				for k, v := range row {
-					delete(row, k)
-					row[fmt.Sprintf("%v.%v", tbls[i].Name, k)] = v
 				}
-
-				currentRows = append(currentRows, &Row{ID: iter.Current(), Row: &row})
-
-			} else {
-				invalidIters++
 			}
+
+		} else if _, ok := expr.Value.(*parser.ColumnSpecification); ok {
+			*headers = append(*headers, expr.Value.(*parser.ColumnSpecification).ColumnName.Value)
 		}
+	}
 
-		currentRowsMap := convertRowsToMap(currentRows)
+}
 
-		if ex.evaluateWhereClause(where, &currentRowsMap, tbls, filteredRows) {
+// executeUpdateStmt updates rows in a table
+func (ex *Executor) executeUpdateStmt(stmt *parser.UpdateStmt) ([]int64, []map[string]interface{}, error) {
+	var rowIds []int64                // Updated row ids
+	var rows []map[string]interface{} // Rows to update
+	var updatedRows int
+	var tbles []*catalog.Table // Table list
 
-			// add the columns to the new row
-			for i, row := range currentRowsMap {
+	tbles = append(tbles, ex.ch.Database.GetTable(stmt.TableName.Value))
 
-				for k, v := range row {
-					// Check if value is time.Time
-					if _, ok := v.(time.Time); ok {
-						// if so we need to read the schema to get the type
+	// Check if there are any tables
+	if len(tbles) == 0 {
+		return nil, nil, errors.New("no tables")
+	} // You can't do this!!
 
-						// split the key and get the table name
-						tblName := strings.Split(k, ".")[0]
+	// For a 1 table query we can evaluate the search condition
+	// If the column is indexed, we can use the index to locate rows faster
 
-						// get the table
-						for _, tbl := range tbls {
-							if tbl.Name == tblName {
-								// get the column type
-								for name, col := range tbl.TableSchema.ColumnDefinitions {
-									if name == strings.Split(k, ".")[1] {
-										switch col.DataType {
-										case "DATE":
-											currentRowsMap[i][k] = fmt.Sprintf("'%s'", v.(time.Time).Format("2006-01-02"))
-										case "TIME":
-											currentRowsMap[i][k] = fmt.Sprintf("'%s'", v.(time.Time).Format("15:04:05"))
-										case "TIMESTAMP", "DATETIME":
-											currentRowsMap[i][k] = fmt.Sprintf("'%s'", v.(time.Time).Format("2006-01-02 15:04:05"))
-										}
-									}
-								}
-							}
-						}
+	// Filter the results
+	err := ex.filter(stmt.WhereClause, tbles, &rows, &rowIds)
+	if err != nil {
+		return nil, nil, err
+	}
 
-					}
+	if ex.explaining {
+		return nil, nil, nil
+	}
 
-					if len(tbls) == 1 {
-						if strings.Contains(k, ".") {
-							// remove tablename
-							newKey := strings.Split(k, ".")[1]
-							currentRowsMap[i][newKey] = currentRowsMap[i][k]
-							delete(currentRowsMap[i], k)
-						}
-					}
+	for i, row := range rows {
+		setClause := ex.convertSetClauseToCatalogLike(&stmt.SetClause, &row)
 
+		if i < len(rowIds) {
+			if rowIds[i] == 0 {
+				err = tbles[0].UpdateRow(rowIds[i], row, setClause)
+				if err != nil {
+					return nil, nil, err
+				}
+				updatedRows++
+			} else {
+				err = tbles[0].UpdateRow(rowIds[i]-1, row, setClause)
+				if err != nil {
+					return nil, nil, err
 				}
+				updatedRows++
 			}
 
-			// create a new row
-			newRow := map[string]interface{}{}
-
-			if rowIds != nil {
-				if *rowIds == nil {
-					*rowIds = []int64{}
-				}
+			err = ex.recordChanges(tbles[0], "UPDATE", []map[string]interface{}{row})
+			if err != nil {
+				return nil, nil, err
 			}
+		}
+	}
 
-			for i := range currentRowsMap {
+	rowsAffected := map[string]interface{}{"RowsAffected": updatedRows}
+	rows = []map[string]interface{}{rowsAffected}
 
-				if rowIds != nil {
-					for j, _ := range currentRows {
+	// Now we format the results
+	if !ex.json {
+		ex.ResultSetBuffer = shared.CreateTableByteArray(rows, shared.GetHeaders(rows, true))
+	} else {
+		var err error
+		shared.RemoveSingleQuotesFromResult(&rows)
+		ex.ResultSetBuffer, err = shared.CreateJSONByteArray(rows)
+		if err != nil {
+			return nil, nil, err
+		}
 
-						for k, _ := range *currentRows[j].Row {
-							if strings.Contains(k, ".") {
-								// remove tablename
-								newKey := strings.Split(k, ".")[1]
-								(*currentRows[j].Row)[newKey] = (*currentRows[j].Row)[k]
-								delete(*currentRows[j].Row, k)
-							}
-						}
+	}
 
-						if where != nil {
+	return nil, nil, nil
 
-							if shared.IdenticalMap(*currentRows[j].Row, currentRowsMap[i]) {
-								*rowIds = append(*rowIds, currentRows[j].ID)
+}
 
-							}
-						}
+// executeDeleteStmt deletes rows from a table
+func (ex *Executor) executeDeleteStmt(stmt *parser.DeleteStmt) ([]int64, []map[string]interface{}, error) {
+	var rowIds []int64                // Updated row ids
+	var rows []map[string]interface{} // Rows before deletion
+	var deletedRows int
+	var tbles []*catalog.Table // Table list
 
-					}
+	tbles = append(tbles, ex.ch.Database.GetTable(stmt.TableName.Value))
 
-				}
+	// Check if there are any tables
+	if len(tbles) == 0 {
+		return nil, nil, errors.New("no tables")
+	} // You can't do this!!
 
-				for k, v := range currentRowsMap[i] {
-					newRow[k] = v
-				}
-			}
+	// For a 1 table query we can evaluate the search condition
+	// If the column is indexed, we can use the index to locate rows faster
 
-			// check if newRow == map[]
-			if len(newRow) > 0 {
-				*filteredRows = append(*filteredRows, newRow)
+	// Filter the results
+	err := ex.filter(stmt.WhereClause, tbles, &rows, &rowIds)
+	if err != nil {
+		return nil, nil, err
+	}
 
-			}
+	if ex.explaining {
+		return nil, nil, nil
+	}
 
+	for i := range rows {
+		err = tbles[0].DeleteRow(rowIds[i] - 1)
+		if err != nil {
+			return nil, nil, err
 		}
-		currentRowsMap = []map[string]interface{}{}
+		deletedRows++
 
-		if where != nil {
-			currentRows = []*Row{}
+		err = ex.recordChanges(tbles[0], "DELETE", []map[string]interface{}{rows[i]})
+		if err != nil {
+			return nil, nil, err
 		}
 
 	}
 
-	// if there was no where clause append all row ids
-	if where == nil {
-		for _, row := range currentRows {
-			*rowIds = append(*rowIds, row.ID)
+	rowsAffected := map[string]interface{}{"RowsAffected": deletedRows}
+	rows = []map[string]interface{}{rowsAffected}
+
+	// Now we format the results
+	if !ex.json {
+		ex.ResultSetBuffer = shared.CreateTableByteArray(rows, shared.GetHeaders(rows, true))
+	} else {
+		var err error
+		shared.RemoveSingleQuotesFromResult(&rows)
+		ex.ResultSetBuffer, err = shared.CreateJSONByteArray(rows)
+		if err != nil {
+			return nil, nil, err
 		}
 
 	}
 
-	return nil
+	return rowIds, rows, nil
+
 }
 
-// evaluateWhereClause evaluates the where clause
-func (ex *Executor) evaluateWhereClause(where *parser.WhereClause, rows *[]map[string]interface{}, tbls []*catalog.Table, filteredRows *[]map[string]interface{}) bool {
-	// If there is no where clause, we return true
-	if where == nil {
-		return true
+// resolveDefaults fills the columns of rows generated on insert from the source of the replicated statement executing
+// Columns are filled in the order of their names so every node generates the same values, the catalog generates them otherwise
+func (ex *Executor) resolveDefaults(tbl *catalog.Table, rows []map[string]interface{}) {
+	if ex.source == nil {
+		return
 	}
 
-	// If there is a where clause, we evaluate the condition
-	return ex.evaluateCondition(where.SearchCondition, rows, tbls, filteredRows)
-}
+	names := slices.Sorted(maps.Keys(tbl.TableSchema.ColumnDefinitions))
 
-// EvaluateCondition evaluates a condition
-func (ex *Executor) evaluateCondition(condition interface{}, rows *[]map[string]interface{}, tbls []*catalog.Table, filteredRows *[]map[string]interface{}) bool {
-	// If there is no condition, we return true
-	if condition == nil {
-		return true
-	}
+	for _, row := range rows {
+		for _, name := range names {
+			colDef := tbl.TableSchema.ColumnDefinitions[name]
 
-	_, not := condition.(*parser.NotExpr)
-	if not {
-		condition = condition.(*parser.NotExpr).Expr
+			value := row[name]
+			if value == nil {
+				value = colDef.Default
+			}
 
+			switch strings.ToUpper(colDef.DataType) {
+			case "UUID":
+				switch value.(type) {
+				case *shared.GenUUID:
+					row[name] = ex.source.GenerateUUID()
+				case *shared.GenUUIDv7:
+					row[name] = ex.source.GenerateUUIDv7()
+				}
+			case "DATETIME", "TIMESTAMP":
+				switch value.(type) {
+				case *shared.SysDate, *shared.SysTime, *shared.SysTimestamp:
+					row[name] = ex.source.Now()
+				}
+			}
+		}
 	}
+}
 
-	switch condition := condition.(type) {
-	case *parser.LogicalCondition:
-		switch condition.Op {
-		case parser.OP_AND:
-			return ex.evaluateCondition(condition.Left, rows, tbls, filteredRows) && ex.evaluateCondition(condition.Right, rows, tbls, filteredRows)
-		case parser.OP_OR:
-			return ex.evaluateCondition(condition.Left, rows, tbls, filteredRows) || ex.evaluateCondition(condition.Right, rows, tbls, filteredRows)
-		case parser.OP_NOT:
-			return !ex.evaluateCondition(condition.Right, rows, tbls, filteredRows)
-		}
+// convertSetClauseToCatalogLike converts a set clause(s) to a catalog set clause(s)
+func (ex *Executor) convertSetClauseToCatalogLike(setClause *[]*parser.SetClause, row *map[string]interface{}) []*catalog.SetClause {
+	var setClauses []*catalog.SetClause
 
-	case *parser.InPredicate:
-		// check if left is column spec
-		if _, ok := condition.Left.Value.(*parser.ColumnSpecification); ok {
-			left := ex.evaluateValueExpression(condition.Left, rows)
+	for _, set := range *setClause {
+		var val interface{}
 
-			// Check if first value is selectStmt
-			if _, ok := condition.Values[0].Value.(*parser.SelectStmt); ok {
+		// check if set.Value.Value is *BinaryExpression
+		// if so, evaluate the expression
+		if _, ok := set.Value.Value.(*parser.BinaryExpression); ok {
+			err := evaluateBinaryExpression(set.Value.Value.(*parser.BinaryExpression), &val, &[]map[string]interface{}{*row})
+			if err != nil {
+				return nil
+			}
 
-				innerRows, err := ex.executeSelectStmt(condition.Values[0].Value.(*parser.SelectStmt), true)
-				if err != nil {
-					return false
-				}
+		} else if _, ok := set.Value.Value.(*shared.GenUUID); ok {
+			// A UUID is generated for every row updated
+			val = ex.source.GenerateUUID()
+		} else if _, ok := set.Value.Value.(*shared.GenUUIDv7); ok {
+			val = ex.source.GenerateUUIDv7()
+		} else {
+			val = set.Value.Value
+		}
 
-				for _, val := range innerRows {
-					if not {
+		setClauses = append(setClauses, &catalog.SetClause{
+			ColumnName: set.Column.Value,
+			Value:      val,
+		})
 
-						if left != val[condition.Left.Value.(*parser.ColumnSpecification).ColumnName.Value] {
-							return true
-						}
+	}
 
-					} else {
+	return setClauses
 
-						if left == val[condition.Left.Value.(*parser.ColumnSpecification).ColumnName.Value] {
+}
 
-							return true
-						}
+// having filters the results based on the having clause
+func (ex *Executor) having(groupedRows map[interface{}][]map[string]interface{}, having *parser.HavingClause, selectList *parser.SelectList) ([]map[string]interface{}, error) {
+	end := ex.startSpan("having")
+	defer end(nil)
+	var results []map[string]interface{}
 
-					}
-				}
+	var leftCondition, rightCondition interface{}
+	var logicalOp parser.LogicalOperator
 
-				return false
+	// check if logical expression
+	if _, ok := having.SearchCondition.(*parser.LogicalCondition); ok {
+		leftCondition = having.SearchCondition.(*parser.LogicalCondition).Left
+		rightCondition = having.SearchCondition.(*parser.LogicalCondition).Right
+		logicalOp = having.SearchCondition.(*parser.LogicalCondition).Op
+	} else {
+		leftCondition = having.SearchCondition
 
-			}
+	}
 
-			for _, val := range condition.Values {
+	for _, group := range groupedRows {
+		leftResults, err := ex.evalHavingCondition(leftCondition, group, selectList)
+		if err != nil {
+			return nil, err
+		}
 
-				switch val.Value.(*parser.Literal).Value.(type) {
-				case uint64:
-					val.Value.(*parser.Literal).Value = int(val.Value.(*parser.Literal).Value.(uint64))
+		if rightCondition != nil {
+			rightResults, err := ex.evalHavingCondition(rightCondition, group, selectList)
+			if err != nil {
+				return nil, err
+			}
+
+			if logicalOp == parser.OP_AND {
+				if len(leftResults) > 0 && len(rightResults) > 0 {
+					results = append(results, rightResults...)
+				}
+			} else if logicalOp == parser.OP_OR {
+				if len(leftResults) > 0 || len(rightResults) > 0 {
+					results = append(results, rightResults...)
+					results = append(results, leftResults...)
 				}
+			}
 
-				if not {
-					if val.Value.(*parser.Literal).Value != left {
+		} else {
+			results = append(results, leftResults...)
+		}
 
-						return true
-					}
+	}
 
-				} else {
-					if val.Value.(*parser.Literal).Value == left {
+	return results, nil
+}
 
-						return true
-					}
-				}
+// evalHavingCondition evaluates the having condition
+func (ex *Executor) evalHavingCondition(cond interface{}, group []map[string]interface{}, selectList *parser.SelectList) ([]map[string]interface{}, error) {
+	var results []map[string]interface{}
 
-			}
-		}
+	switch cond.(type) {
+	case *parser.ComparisonPredicate:
+		// left must be an aggregate function
+		// right must be a literal
 
-	case *parser.IsPredicate:
+		// Get the aggregate function
+		aggFunc := cond.(*parser.ComparisonPredicate).Left.Value.(*parser.AggregateFunc)
 
-		if not {
-			return false
-		}
+		// Get the right value
+		//rightVal := having.SearchCondition.(*parser.ComparisonPredicate).Right.Value.(*parser.Literal).Value
 
-		if _, ok := condition.Left.Value.(*parser.ColumnSpecification); ok {
-			left := ex.evaluateValueExpression(condition.Left, rows)
+		// Get the aggregate function name
+		aggFuncName := aggFunc.FuncName
 
-			if condition.Null {
-				return left == nil
-			} else {
-				return left != nil
-			}
+		// Get the aggregate function arguments
+		aggFuncArgs := aggFunc.Args
 
-		}
-	case *parser.BetweenPredicate:
-		// check if left is column spec
-		if _, ok := condition.Left.Value.(*parser.ColumnSpecification); ok {
-			left := ex.evaluateValueExpression(condition.Left, rows)
-			right := ex.evaluateValueExpression(condition.Lower, rows)
-			upper := ex.evaluateValueExpression(condition.Upper, rows)
+		// Get the column name
+		//colName := aggFuncArgs[0].(*parser.ColumnSpecification).ColumnName.Value
 
-			if left == nil {
-				return false
-			}
+		switch aggFuncName {
+		case "COUNT":
 
-			if !not {
-				// check if left is a string
-				if _, ok := left.(string); ok {
-					// check if right is a string
-					if _, ok := right.(string); ok {
-						return left.(string) >= right.(string) && left.(string) <= upper.(string) // left >= lower && left <= upper
-					}
+			// map is grouped
+			// i.e 2024/09/16 15:19:47 before group [map[customer_id:1 order_date:'2024-01-01' order_id:1] map[customer_id:1 order_date:'2024-01-15' order_id:2] map[customer_id:2 order_date:'2024-01-10' order_id:3] map[customer_id:2 order_date:'2024-01-20' order_id:4] map[customer_id:3 order_date:'2024-01-05' order_id:5] map[customer_id:3 order_date:'2024-01-25' order_id:6] map[customer_id:3 order_date:'2024-01-30' order_id:7]]
+			//  map[1:[map[customer_id:1 order_date:'2024-01-01' order_id:1] map[customer_id:1 order_date:'2024-01-15' order_id:2]] 2:[map[customer_id:2 order_date:'2024-01-10' order_id:3] map[customer_id:2 order_date:'2024-01-20' order_id:4]] 3:[map[customer_id:3 order_date:'2024-01-05' order_id:5] map[customer_id:3 order_date:'2024-01-25' order_id:6] map[customer_id:3 order_date:'2024-01-30' order_id:7]]]
 
-					return false
-				}
+			// Count the number of rows
+			count := len(group)
 
-				// check if left is a float
-				if _, ok := left.(float64); ok {
-					if _, ok := right.(uint64); ok {
-						right = float64(right.(uint64))
+			newComparisonPredicate := &parser.ComparisonPredicate{
+				Left:  &parser.ValueExpression{Value: aggFuncArgs[0].(*parser.ColumnSpecification)},
+				Op:    cond.(*parser.ComparisonPredicate).Op,
+				Right: cond.(*parser.ComparisonPredicate).Right,
+			}
 
-					}
+			rows := []map[string]interface{}{
+				{aggFuncArgs[0].(*parser.ColumnSpecification).ColumnName.Value: count},
+			}
 
-					if _, ok := upper.(uint64); ok {
-						upper = float64(upper.(uint64))
+			ok := ex.evaluateCondition(newComparisonPredicate, &rows, nil, nil)
+			if ok {
+				group[0][aggFuncArgs[0].(*parser.ColumnSpecification).ColumnName.Value] = count
 
-					}
+				if selectList != nil {
+					for _, expr := range selectList.Expressions {
+						if _, ok := expr.Value.(*parser.AggregateFunc); ok {
+							if expr.Value.(*parser.AggregateFunc).FuncName == "COUNT" {
+								if expr.Alias != nil {
+									group[0][expr.Alias.Value] = count
+								} else {
 
-					return left.(float64) >= right.(float64) && left.(float64) <= upper.(float64) // left >= lower && left <= upper
+								}
+							}
+						}
+					}
 				}
 
-				return left.(int) >= int(right.(uint64)) && left.(int) <= int(upper.(uint64)) // left >= lower && left <= upper
-			} else {
-				return left.(int) < int(right.(uint64)) || left.(int) > int(upper.(uint64)) // left < lower || left > upper
+				results = append(results, group[0])
 			}
 
-		}
-	case *parser.LikePredicate:
-		// check if left is column spec
-		if _, ok := condition.Left.Value.(*parser.ColumnSpecification); ok {
-			left := ex.evaluateValueExpression(condition.Left, rows)
+		case "SUM":
+			// Sum the values
+			var sum int
 
-			pattern := condition.Pattern.Value
-			/*
-				'%a'
-				Matches any string that ends with 'a'. The '%' wildcard matches any sequence of characters, including an empty sequence.
+			for _, r := range group {
+				for _, arg := range aggFuncArgs {
+					switch arg := arg.(type) {
+					case *parser.ColumnSpecification:
+						if _, ok := r[arg.ColumnName.Value]; !ok {
+							return nil, errors.New("column does not exist")
+						}
 
-				'%a%'
-				Matches any string that contains 'a' anywhere within it. The '%' wildcard before and after 'a' means that 'a' can be preceded or followed by any sequence of characters.
+						switch r[arg.ColumnName.Value].(type) {
+						case int:
+							sum += r[arg.ColumnName.Value].(int)
+						case int64:
+							sum += int(r[arg.ColumnName.Value].(int64))
+						case float64:
+							sum += int(r[arg.ColumnName.Value].(float64))
 
-				'a%'
-				Matches any string that starts with 'a'. The '%' wildcard after 'a' allows for any sequence of characters after 'a'.
+						}
+					}
 
-				'a%b'
-				Matches any string that starts with 'a' and ends with 'b'. The '%' wildcard in the middle allows for any sequence of characters between 'a' and 'b'.
+				}
+			}
 
-			*/
+			newComparisonPredicate := &parser.ComparisonPredicate{
+				Left:  &parser.ValueExpression{Value: aggFuncArgs[0].(*parser.ColumnSpecification)},
+				Op:    cond.(*parser.ComparisonPredicate).Op,
+				Right: cond.(*parser.ComparisonPredicate).Right,
+			}
 
-			if left == nil {
-				return false
+			rows := []map[string]interface{}{
+				{aggFuncArgs[0].(*parser.ColumnSpecification).ColumnName.Value: sum},
 			}
 
-			if !not {
-				switch {
+			ok := ex.evaluateCondition(newComparisonPredicate, &rows, nil, nil)
+			if ok {
+				usingAlias := false
+				// Check if agg is within select list, if so get alias
+				if selectList != nil {
+					for _, expr := range selectList.Expressions {
+						if _, ok := expr.Value.(*parser.AggregateFunc); ok {
+							if expr.Value.(*parser.AggregateFunc).FuncName == "SUM" {
+								if expr.Alias != nil {
+									group[0][expr.Alias.Value] = sum
+								} else {
+									group[0][aggFuncArgs[0].(*parser.ColumnSpecification).ColumnName.Value] = sum
+								}
+							}
+						}
+					}
+				}
 
-				case strings.HasPrefix(pattern.(*parser.Literal).Value.(string), "'%") && strings.HasSuffix(pattern.(*parser.Literal).Value.(string), "%'"):
-					// '%a%'
+				if !usingAlias {
+
+					results = append(results, group[0])
+				}
+			}
+		case "AVG":
+			// Average the values
+			var sum int
+
+			for _, r := range group {
+				for _, arg := range aggFuncArgs {
+					switch arg := arg.(type) {
+					case *parser.ColumnSpecification:
+						if _, ok := r[arg.ColumnName.Value]; !ok {
+							return nil, errors.New("column does not exist")
+						}
+
+						switch r[arg.ColumnName.Value].(type) {
+						case int:
+							sum += r[arg.ColumnName.Value].(int)
+						case int64:
+							sum += int(r[arg.ColumnName.Value].(int64))
+						case float64:
+							sum += int(r[arg.ColumnName.Value].(float64))
+
+						}
+					}
+
+				}
+
+			}
+
+			avg := sum / len(group)
+
+			newComparisonPredicate := &parser.ComparisonPredicate{
+				Left:  &parser.ValueExpression{Value: aggFuncArgs[0].(*parser.ColumnSpecification)},
+				Op:    cond.(*parser.ComparisonPredicate).Op,
+				Right: cond.(*parser.ComparisonPredicate).Right,
+			}
+
+			rows := []map[string]interface{}{
+				{aggFuncArgs[0].(*parser.ColumnSpecification).ColumnName.Value: avg},
+			}
+
+			ok := ex.evaluateCondition(newComparisonPredicate, &rows, nil, nil)
+			if ok {
+
+				if selectList != nil {
+					for _, expr := range selectList.Expressions {
+						if _, ok := expr.Value.(*parser.AggregateFunc); ok {
+							if expr.Value.(*parser.AggregateFunc).FuncName == "AVG" {
+								if expr.Alias != nil {
+									group[0][expr.Alias.Value] = avg
+								}
+							}
+						}
+					}
+				}
+
+				group[0][aggFuncArgs[0].(*parser.ColumnSpecification).ColumnName.Value] = avg
+				results = append(results, group[0])
+			}
+
+		case "MAX":
+			// Find the maximum value
+			var mx int
+
+			for _, r := range group {
+
+				for _, arg := range aggFuncArgs {
+					switch arg := arg.(type) {
+					case *parser.ColumnSpecification:
+						if _, ok := r[arg.ColumnName.Value]; !ok {
+							return nil, errors.New("column does not exist")
+						}
+
+						switch r[arg.ColumnName.Value].(type) {
+						case int:
+							if r[arg.ColumnName.Value].(int) > mx {
+								mx = r[arg.ColumnName.Value].(int)
+							}
+						case int64:
+							if int(r[arg.ColumnName.Value].(int64)) > mx {
+								mx = int(r[arg.ColumnName.Value].(int64))
+							}
+						case float64:
+							if int(r[arg.ColumnName.Value].(float64)) > mx {
+								mx = int(r[arg.ColumnName.Value].(float64))
+							}
+						}
+					}
+
+				}
+
+			}
+
+			newComparisonPredicate := &parser.ComparisonPredicate{
+				Left:  &parser.ValueExpression{Value: aggFuncArgs[0].(*parser.ColumnSpecification)},
+				Op:    cond.(*parser.ComparisonPredicate).Op,
+				Right: cond.(*parser.ComparisonPredicate).Right,
+			}
+
+			rows := []map[string]interface{}{
+				{aggFuncArgs[0].(*parser.ColumnSpecification).ColumnName.Value: mx},
+			}
+
+			ok := ex.evaluateCondition(newComparisonPredicate, &rows, nil, nil)
+			if ok {
+
+				usingAlias := false
+				// Check if agg is within select list, if so get alias
+				if selectList != nil {
+					for _, expr := range selectList.Expressions {
+						if _, ok := expr.Value.(*parser.AggregateFunc); ok {
+							if expr.Value.(*parser.AggregateFunc).FuncName == "MAX" {
+								if expr.Alias != nil {
+
+									group[0][expr.Alias.Value] = mx
+									usingAlias = true
+								}
+							}
+						}
+					}
+				}
+
+				if !usingAlias {
+					group[0][aggFuncArgs[0].(*parser.ColumnSpecification).ColumnName.Value] = mx
+				}
+
+				results = append(results, group[0])
+			}
+
+		case "MIN":
+			// Find the minimum value
+			mn := int(^uint(0) >> 1) // Max int value
+
+			for _, r := range group {
+				for _, arg := range aggFuncArgs {
+					switch arg := arg.(type) {
+					case *parser.ColumnSpecification:
+						if _, ok := r[arg.ColumnName.Value]; !ok {
+							return nil, errors.New("column does not exist")
+						}
+
+						switch r[arg.ColumnName.Value].(type) {
+						case int:
+							if r[arg.ColumnName.Value].(int) < mn {
+								mn = r[arg.ColumnName.Value].(int)
+							}
+						case int64:
+							if int(r[arg.ColumnName.Value].(int64)) < mn {
+								mn = int(r[arg.ColumnName.Value].(int64))
+							}
+						case float64:
+							if int(r[arg.ColumnName.Value].(float64)) < mn {
+								mn = int(r[arg.ColumnName.Value].(float64))
+							}
+						}
+					}
+
+				}
+
+			}
+
+			newComparisonPredicate := &parser.ComparisonPredicate{
+				Left:  &parser.ValueExpression{Value: aggFuncArgs[0].(*parser.ColumnSpecification)},
+				Op:    cond.(*parser.ComparisonPredicate).Op,
+				Right: cond.(*parser.ComparisonPredicate).Right,
+			}
+
+			rows := []map[string]interface{}{
+				{aggFuncArgs[0].(*parser.ColumnSpecification).ColumnName.Value: mn},
+			}
+
+			ok := ex.evaluateCondition(newComparisonPredicate, &rows, nil, nil)
+			if ok {
+				if selectList != nil {
+					for _, expr := range selectList.Expressions {
+						if _, ok := expr.Value.(*parser.AggregateFunc); ok {
+							if expr.Value.(*parser.AggregateFunc).FuncName == "MIN" {
+								if expr.Alias != nil {
+									group[0][expr.Alias.Value] = mn
+								}
+							}
+						}
+					}
+				}
+				group[0][aggFuncArgs[0].(*parser.ColumnSpecification).ColumnName.Value] = mn
+
+				results = append(results, group[0])
+			}
+
+		}
+	}
+
+	return results, nil
+
+}
+
+// group groups the results
+func (ex *Executor) group(results []map[string]interface{}, groupBy *parser.GroupByClause) (map[interface{}][]map[string]interface{}, error) {
+	end := ex.startSpan("group")
+	defer end(nil)
+
+	grouped := make(map[interface{}][]map[string]interface{})
+	if groupBy == nil {
+		return grouped, nil
+	}
+
+	if len(groupBy.GroupByExpressions) == 0 {
+		return grouped, nil
+	}
+
+	// Iterate through the data
+	for _, entry := range results {
+		// Get the group key value
+		groupValue := entry[groupBy.GroupByExpressions[0].Value.(*parser.ColumnSpecification).ColumnName.Value]
+
+		// Append the entry to the slice corresponding to the group key value
+		grouped[groupValue] = append(grouped[groupValue], entry)
+	}
+
+	return grouped, nil
+}
+
+// group is a group of rows of a grouping set
+type group struct {
+	set    map[string]bool        // Columns of the grouping set
+	values map[string]interface{} // Values of the columns of the grouping set shared by the rows
+	rows   []map[string]interface{}
+}
+
+// groupingSets groups rows by every grouping set of a GROUP BY clause, returning a row per group of every set matching the having clause
+// Rows are read once, adding every row to its group of every set, the columns grouped by but not in the set of a group are NULL
+func (ex *Executor) groupingSets(rows []map[string]interface{}, selectList *parser.SelectList, groupBy *parser.GroupByClause, having *parser.HavingClause, headers *[]string) ([]map[string]interface{}, error) {
+	end := ex.startSpan("group")
+	defer end(nil)
+
+	grouped := make(map[string]bool) // Every column grouped by
+	for _, expr := range groupBy.GroupByExpressions {
+		col, ok := expr.Value.(*parser.ColumnSpecification)
+		if !ok {
+			return nil, errors.New("GROUPING SETS, ROLLUP and CUBE can only group by columns")
+		}
+
+		grouped[col.ColumnName.Value] = true
+	}
+
+	groups := make([][]*group, len(groupBy.GroupingSets)) // Groups of every set, in the order they were found
+	keys := make(map[string]*group)
+
+	for _, row := range rows {
+		for i, set := range groupBy.GroupingSets {
+			key := strings.Builder{}
+			key.WriteString(strconv.Itoa(i))
+
+			for _, expr := range set {
+				key.WriteString(fmt.Sprintf("|%#v", row[expr.Value.(*parser.ColumnSpecification).ColumnName.Value]))
+			}
+
+			g, ok := keys[key.String()]
+			if !ok {
+				g = newGroup(set, row)
+				keys[key.String()] = g
+				groups[i] = append(groups[i], g)
+			}
+
+			g.rows = append(g.rows, row)
+		}
+	}
+
+	// An empty grouping set has a group even without rows, COUNT(*) of no rows is 0
+	for i, set := range groupBy.GroupingSets {
+		if len(set) == 0 && len(groups[i]) == 0 {
+			groups[i] = append(groups[i], newGroup(set, nil))
+		}
+	}
+
+	*headers = []string{}
+
+	for _, expr := range selectList.Expressions {
+		var name string
+
+		switch value := expr.Value.(type) {
+		case *parser.ColumnSpecification:
+			if !grouped[value.ColumnName.Value] {
+				return nil, fmt.Errorf("column %s must be grouped by or aggregated", value.ColumnName.Value)
+			}
+
+			name = value.ColumnName.Value
+		case *parser.AggregateFunc:
+			name = value.FuncName
+		case *parser.GroupingFunc:
+			name = "GROUPING"
+		case *parser.Literal:
+			name = fmt.Sprintf("%v", value.Value)
+		default:
+			return nil, errors.New("only columns grouped by, aggregates, GROUPING and literals can be selected with GROUPING SETS, ROLLUP and CUBE")
+		}
+
+		if expr.Alias != nil {
+			name = expr.Alias.Value
+		}
+
+		*headers = append(*headers, name)
+	}
+
+	var results []map[string]interface{}
+
+	for _, set := range groups {
+		for _, g := range set {
+			if having != nil {
+				ok, err := ex.groupHaving(having.SearchCondition, g, grouped)
+				if err != nil {
+					return nil, err
+				}
+
+				if !ok {
+					continue
+				}
+			}
+
+			row := make(map[string]interface{})
+
+			for i, expr := range selectList.Expressions {
+				var err error
+
+				switch value := expr.Value.(type) {
+				case *parser.ColumnSpecification:
+					row[(*headers)[i]] = g.values[value.ColumnName.Value]
+				case *parser.AggregateFunc:
+					row[(*headers)[i]], err = aggregateGroup(value, g.rows)
+				case *parser.GroupingFunc:
+					row[(*headers)[i]], err = grouping(value, g, grouped)
+				case *parser.Literal:
+					row[(*headers)[i]] = value.Value
+					if v, ok := value.Value.(uint64); ok {
+						row[(*headers)[i]] = int(v)
+					}
+				}
+
+				if err != nil {
+					return nil, err
+				}
+			}
+
+			results = append(results, row)
+		}
+	}
+
+	return results, nil
+}
+
+// newGroup returns a group of a grouping set with the values of the columns of the set of row
+func newGroup(set []*parser.ValueExpression, row map[string]interface{}) *group {
+	g := &group{set: make(map[string]bool), values: make(map[string]interface{})}
+
+	for _, expr := range set {
+		name := expr.Value.(*parser.ColumnSpecification).ColumnName.Value
+		g.set[name] = true
+		g.values[name] = row[name]
+	}
+
+	return g
+}
+
+// aggregateGroup returns the value of an aggregate function over the rows of a group
+func aggregateGroup(expr *parser.AggregateFunc, rows []map[string]interface{}) (interface{}, error) {
+	if len(rows) == 0 {
+		if expr.FuncName == "COUNT" || expr.FuncName == "SUM" {
+			return 0, nil
+		}
+
+		return nil, nil
+	}
+
+	var columns []string
+
+	err := evaluateAggregate(expr, &rows, &columns, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return rows[0][columns[0]], nil
+}
+
+// grouping returns the value of a GROUPING function for a group, a bit set for every argument not in the grouping set of the group
+func grouping(expr *parser.GroupingFunc, g *group, grouped map[string]bool) (int, error) {
+	value := 0
+
+	for _, arg := range expr.Args {
+		if !grouped[arg.ColumnName.Value] {
+			return 0, fmt.Errorf("GROUPING argument %s is not grouped by", arg.ColumnName.Value)
+		}
+
+		value <<= 1
+		if !g.set[arg.ColumnName.Value] {
+			value |= 1
+		}
+	}
+
+	return value, nil
+}
+
+// groupHaving evaluates a having condition on a group, aggregates and GROUPING functions compared are evaluated over the group
+func (ex *Executor) groupHaving(cond interface{}, g *group, grouped map[string]bool) (bool, error) {
+	switch cond := cond.(type) {
+	case *parser.LogicalCondition:
+		right, err := ex.groupHaving(cond.Right, g, grouped)
+		if err != nil {
+			return false, err
+		}
+
+		if cond.Op == parser.OP_NOT {
+			return !right, nil
+		}
+
+		left, err := ex.groupHaving(cond.Left, g, grouped)
+		if err != nil {
+			return false, err
+		}
+
+		if cond.Op == parser.OP_OR {
+			return left || right, nil
+		}
+
+		return left && right, nil
+	case *parser.NotExpr:
+		ok, err := ex.groupHaving(cond.Expr, g, grouped)
+		return !ok, err
+	case *parser.ComparisonPredicate:
+		var left interface{}
+		var err error
+
+		switch value := cond.Left.Value.(type) {
+		case *parser.AggregateFunc:
+			left, err = aggregateGroup(value, g.rows)
+		case *parser.GroupingFunc:
+			left, err = grouping(value, g, grouped)
+		case *parser.ColumnSpecification:
+			left = g.values[value.ColumnName.Value]
+		default:
+			return false, errors.New("HAVING can only compare aggregates, GROUPING and columns grouped by")
+		}
+
+		if err != nil {
+			return false, err
+		}
+
+		// The value is compared as a column of a row, as the having clause of a plain GROUP BY does
+		predicate := &parser.ComparisonPredicate{
+			Left:  &parser.ValueExpression{Value: &parser.ColumnSpecification{ColumnName: &parser.Identifier{Value: "value"}}},
+			Op:    cond.Op,
+			Right: cond.Right,
+		}
+
+		return ex.evaluateCondition(predicate, &[]map[string]interface{}{{"value": left}}, nil, nil), nil
+	}
+
+	return false, errors.New("HAVING can only compare aggregates, GROUPING and columns grouped by")
+}
+
+// getFirstAggFuncFromBinaryExpression gets the first aggregate function from a binary expression
+func getFirstAggFuncFromBinaryExpression(expr *parser.BinaryExpression) *parser.AggregateFunc {
+	switch expr.Left.(type) {
+	case *parser.AggregateFunc:
+		return expr.Left.(*parser.AggregateFunc)
+	case *parser.BinaryExpression:
+		return getFirstAggFuncFromBinaryExpression(expr.Left.(*parser.BinaryExpression))
+	}
+
+	return nil
+
+}
+
+// selectListFilter filters the results based on the select list
+func (ex *Executor) selectListFilter(results *[]map[string]interface{}, selectList *parser.SelectList, headers *[]string) error {
+	end := ex.startSpan("project")
+	defer end(nil)
+
+	if ex.explaining {
+		return nil
+
+	}
+
+	if selectList == nil {
+		return errors.New("no select list")
+	}
+
+	if len(selectList.Expressions) == 0 {
+		return errors.New("no select list")
+	}
+
+	for i, expr := range selectList.Expressions {
+
+		switch expr := expr.Value.(type) {
+
+		case *parser.BinaryExpression:
+
+			// Left should be a column
+
+			col := getFirstLeftBinaryExpressionColumn(expr)
+
+			if col != nil {
+
+				for j, row := range *results {
+					var val interface{}
+
+					err := evaluateBinaryExpression(expr, &val, &[]map[string]interface{}{row})
+					if err != nil {
+						return err
+					}
+
+					if selectList.Expressions[i].Alias == nil {
+
+						// update corresponding column
+						(*results)[j][col.ColumnName.Value] = val
+					} else {
+						// update corresponding column
+						(*results)[j][selectList.Expressions[i].Alias.Value] = val
+
+						// delete the old column, unless aliased to its own name
+						if selectList.Expressions[i].Alias.Value != col.ColumnName.Value {
+							delete((*results)[j], col.ColumnName.Value)
+						}
+					}
+
+				}
+
+				if selectList.Expressions[i].Alias == nil {
+					*headers = append(*headers, col.ColumnName.Value)
+				} else {
+					*headers = append(*headers, selectList.Expressions[i].Alias.Value)
+				}
+			} else {
+				// is aggregate function
+				// evaluate the expression
+				var val interface{}
+
+				err := evaluateBinaryExpression(expr, &val, results)
+				if err != nil {
+					return err
+				}
+
+				if selectList.Expressions[i].Alias == nil {
+					*results = []map[string]interface{}{map[string]interface{}{getFirstAggFuncFromBinaryExpression(expr).FuncName: val}}
+					*headers = []string{getFirstAggFuncFromBinaryExpression(expr).FuncName}
+				} else {
+					*results = []map[string]interface{}{map[string]interface{}{selectList.Expressions[i].Alias.Value: val}}
+					*headers = []string{selectList.Expressions[i].Alias.Value}
+				}
+
+			}
+
+		case *parser.Wildcard:
+
+			return nil
+		case *parser.Literal:
+			name := fmt.Sprintf("%v", expr.Value)
+			if selectList.Expressions[i].Alias != nil {
+				name = selectList.Expressions[i].Alias.Value
+			}
+
+			value := expr.Value
+			if v, ok := value.(uint64); ok {
+				value = int(v)
+			}
+
+			for _, row := range *results {
+				row[name] = value
+			}
+
+			*headers = append(*headers, name)
+		case *parser.ColumnSpecification:
+
+			// Check for alias
+			if selectList.Expressions[i].Alias == nil {
+				if expr.ColumnName.Value == "*" && expr.TableName != nil {
+					for _, row := range *results {
+						for k, v := range row {
+							if strings.HasPrefix(k, expr.TableName.Value+".") {
+								row[k] = v
+								*headers = append(*headers, k)
+							}
+						}
+					}
+
+				}
+
+			} else {
+				*headers = append(*headers, selectList.Expressions[i].Alias.Value)
+				// Replace all instances of the column name with the alias
+				for _, row := range *results {
+
+					if _, ok := row[expr.ColumnName.Value]; ok {
+						row[selectList.Expressions[i].Alias.Value] = row[expr.ColumnName.Value]
+						delete(row, expr.ColumnName.Value)
+					}
+				}
+			}
+
+			*headers = append(*headers, expr.ColumnName.Value)
+		case *parser.AggregateFunc:
+			var err error
+
+			// evaluate the aggregate function
+			err = evaluateAggregate(expr, results, headers, selectList.Expressions[i].Alias)
+			if err != nil {
+				return err
+			}
+		case *parser.CaseExpr:
+			var err error
+
+			err = ex.evaluateSelectCase(expr, results, headers, selectList.Expressions[i].Alias)
+			if err != nil {
+				return err
+			}
+		case *parser.UpperFunc, *parser.LowerFunc, *parser.LengthFunc, *parser.PositionFunc, *parser.RoundFunc,
+			*parser.TrimFunc, *parser.SubstrFunc, *parser.ConcatFunc, *parser.CastFunc, *shared.GenUUID, *shared.SysDate,
+			*shared.SysTime, *shared.SysTimestamp, *parser.CoalesceFunc, *parser.ReverseFunc:
+			var err error
+			err = evaluateSystemFunc(expr, results, headers, selectList.Expressions[i].Alias)
+			if err != nil {
+				return err
+			}
+		case *parser.RandomFunc, *shared.GenUUIDv7, *parser.HashFunc:
+			// Evaluated for every row, RANDOM and UUID_V7 differ on every row
+			name := functionName(expr)
+			if selectList.Expressions[i].Alias != nil {
+				name = selectList.Expressions[i].Alias.Value
+			}
+
+			for _, row := range *results {
+				row[name] = ex.functionValue(expr, row)
+			}
+
+			*headers = append(*headers, name)
+		}
+
+	}
+
+	// remove dupes from columns
+	*headers = shared.RemoveDupesStringSlice(headers)
+
+	// check if * is in headers
+	for i, h := range *headers {
+		if h == "*" {
+			// remove
+			*headers = append((*headers)[:i], (*headers)[i+1:]...)
+		}
+	}
+
+	for _, row := range *results {
+		for k, _ := range row {
+			if !slices.Contains(*headers, k) {
+				delete(row, k)
+			}
+		}
+
+	}
+
+	return nil
+
+}
+
+// evaluateSelectCase evaluates a case expression within a select list
+func (ex *Executor) evaluateSelectCase(expr interface{}, results *[]map[string]interface{}, columns *[]string, alias *parser.Identifier) error {
+	switch expr := expr.(type) {
+	case *parser.CaseExpr:
+		for i, _ := range *results {
+
+			if len(expr.WhenClauses) == 0 {
+				return errors.New("no when clauses in case expression")
+			}
+
+			for _, when := range expr.WhenClauses {
+
+				ok := ex.evaluateCondition(when.Condition, results, nil, nil)
+
+				if ok {
+					var result interface{}
+
+					switch when.Result.(*parser.ValueExpression).Value.(type) {
+					case *parser.ColumnSpecification:
+						result = (*results)[i][when.Result.(*parser.ValueExpression).Value.(*parser.ColumnSpecification).ColumnName.Value]
+					case *parser.Literal:
+						result = when.Result.(*parser.ValueExpression).Value.(*parser.Literal).Value
+					case *parser.BinaryExpression:
+						err := evaluateBinaryExpression(when.Result.(*parser.ValueExpression).Value.(*parser.BinaryExpression), &result, results)
+						if err != nil {
+							return err
+						}
+
+					}
+
+					if alias == nil {
+						(*results)[i]["case_result"] = result
+						*columns = append(*columns, "case_result")
+					} else {
+						(*results)[i][alias.Value] = result
+						*columns = append(*columns, alias.Value)
+					}
+				}
+			}
+
+			// in the CASE of CASE ;)
+			// We use the furthest left column, thats the column we are evaluating and updating
+			// We can find that in the first when condition
+
+		}
+	}
+
+	return nil
+}
+
+// evaluateSystemFunc evaluates system functions like UPPER within a select list
+func evaluateSystemFunc(expr interface{}, results *[]map[string]interface{}, columns *[]string, alias *parser.Identifier) error {
+	switch expr := expr.(type) {
+	case *parser.ConcatFunc:
+		for i, row := range *results {
+			for k, v := range row {
+
+				if _, ok := row[k].(string); ok {
+					newStr := ""
+
+					replaceK := false
+
+					for _, arg := range expr.Args {
+						switch arg := arg.(type) {
+						case *parser.ValueExpression:
+							switch arg.Value.(type) {
+							case *parser.ColumnSpecification:
+								if arg.Value.(*parser.ColumnSpecification).ColumnName.Value == k {
+									newStr += strings.TrimSuffix(strings.TrimPrefix(v.(string), "'"), "'")
+									replaceK = true
+
+								}
+							case *parser.Literal:
+								newStr += strings.TrimSuffix(strings.TrimPrefix(arg.Value.(*parser.Literal).Value.(string), "'"), "'")
+
+							}
+						}
+
+					}
+
+					if replaceK {
+
+						if alias == nil {
+							(*results)[i][k] = fmt.Sprintf("'%s'", newStr)
+							*columns = append(*columns, k)
+						} else {
+							(*results)[i][alias.Value] = fmt.Sprintf("'%s'", newStr)
+							*columns = append(*columns, alias.Value)
+						}
+					}
+
+				}
+			}
+
+		}
+	case *parser.SubstrFunc:
+		for i, row := range *results {
+			for k, v := range row {
+				if _, ok := row[k].(string); ok {
+					if expr.Arg.(*parser.ValueExpression).Value.(*parser.ColumnSpecification).ColumnName.Value == k {
+						startPos := int(expr.StartPos.Value.(uint64))
+						endPos := int(expr.Length.Value.(uint64))
+
+						// Positions are in characters
+						if utf8.RuneCountInString(v.(string)) < startPos {
+							return errors.New("start position is greater than the length of the string")
+						}
+
+						if utf8.RuneCountInString(v.(string)) < endPos {
+							return errors.New("end position is greater than the length of the string")
+						}
+
+						chars := []rune(strings.TrimSuffix(strings.TrimPrefix(v.(string), "'"), "'"))
+
+						if alias == nil {
+							(*results)[i][k] = fmt.Sprintf("'%s'", string(chars[startPos-1:endPos]))
+							*columns = append(*columns, k)
+						} else {
+							(*results)[i][alias.Value] = fmt.Sprintf("'%s'", string(chars[startPos-1:endPos]))
+							*columns = append(*columns, alias.Value)
+						}
+					}
+				}
+			}
+
+		}
+	case *parser.TrimFunc:
+		for i, row := range *results {
+			for k, v := range row {
+				if _, ok := row[k].(string); ok {
+					if expr.Arg.(*parser.ValueExpression).Value.(*parser.ColumnSpecification).ColumnName.Value == k {
+						if alias == nil {
+							(*results)[i][k] = fmt.Sprintf("'%s'", strings.TrimSpace(strings.TrimSuffix(strings.TrimPrefix(v.(string), "'"), "'")))
+							*columns = append(*columns, k)
+						} else {
+							(*results)[i][alias.Value] = fmt.Sprintf("'%s'", strings.TrimSpace(strings.TrimSuffix(strings.TrimPrefix(v.(string), "'"), "'")))
+							*columns = append(*columns, alias.Value)
+						}
+					}
+				}
+			}
+
+		}
+	case *parser.LengthFunc:
+		for i, row := range *results {
+			for k, v := range row {
+				if _, ok := row[k].(string); ok {
+					if expr.Arg.(*parser.ValueExpression).Value.(*parser.ColumnSpecification).ColumnName.Value == k {
+						if alias == nil {
+							(*results)[i][k] = utf8.RuneCountInString(strings.TrimPrefix(strings.TrimSuffix(v.(string), "'"), "'"))
+							*columns = append(*columns, k)
+						} else {
+							(*results)[i][alias.Value] = utf8.RuneCountInString(strings.TrimPrefix(strings.TrimSuffix(v.(string), "'"), "'"))
+							*columns = append(*columns, alias.Value)
+						}
+					}
+				}
+			}
+
+		}
+	case *parser.PositionFunc:
+		for i, row := range *results {
+			for k, v := range row {
+				if _, ok := row[k].(string); ok {
+					if expr.Arg.(*parser.ValueExpression).Value.(*parser.ColumnSpecification).ColumnName.Value == k {
+						if alias == nil {
+							(*results)[i][k] = shared.RuneIndex(v.(string), strings.TrimSuffix(strings.TrimPrefix(expr.In.(*parser.ValueExpression).Value.(*parser.Literal).Value.(string), "'"), "'"))
+							*columns = append(*columns, k)
+						} else {
+							(*results)[i][alias.Value] = shared.RuneIndex(v.(string), strings.TrimSuffix(strings.TrimPrefix(expr.In.(*parser.ValueExpression).Value.(*parser.Literal).Value.(string), "'"), "'"))
+							*columns = append(*columns, alias.Value)
+						}
+					}
+				}
+			}
+
+		}
+	case *parser.RoundFunc:
+		for i, row := range *results {
+			for k, v := range row {
+				if _, ok := row[k].(float64); ok {
+					if expr.Arg.(*parser.ValueExpression).Value.(*parser.ColumnSpecification).ColumnName.Value == k {
+
+						if alias == nil {
+
+							(*results)[i][k] = math.Round(v.(float64))
+							*columns = append(*columns, k)
+						} else {
+							(*results)[i][alias.Value] = math.Round(v.(float64))
+							*columns = append(*columns, alias.Value)
+						}
+					}
+				}
+			}
+
+		}
+	case *parser.ReverseFunc:
+
+		for i, row := range *results {
+			for k, v := range row {
+				if _, ok := row[k].(string); ok {
+					if expr.Arg.(*parser.ValueExpression).Value.(*parser.ColumnSpecification).ColumnName.Value == k {
+
+						if alias == nil {
+
+							(*results)[i][k] = shared.ReverseString(v.(string))
+							*columns = append(*columns, k)
+						} else {
+							(*results)[i][alias.Value] = shared.ReverseString(v.(string))
+							*columns = append(*columns, alias.Value)
+						}
+					}
+				}
+			}
+
+		}
+	case *parser.CoalesceFunc:
+		for i, row := range *results {
+			for k, _ := range row {
+				if _, ok := row[k]; ok {
+
+					for _, arg := range expr.Args {
+						if arg.(*parser.ValueExpression).Value.(*parser.ColumnSpecification).ColumnName.Value == k {
+							if alias == nil {
+								(*results)[i][k] = expr.Value.(*parser.ValueExpression).Value.(*parser.Literal).Value
+								*columns = append(*columns, k)
+							} else {
+								(*results)[i][alias.Value] = expr.Value.(*parser.ValueExpression).Value.(*parser.Literal).Value
+								*columns = append(*columns, alias.Value)
+							}
+						}
+					}
+				}
+			}
+		}
+
+	case *parser.UpperFunc:
+		for i, row := range *results {
+			for k, v := range row {
+				if _, ok := row[k].(string); ok {
+					if expr.Arg.(*parser.ValueExpression).Value.(*parser.ColumnSpecification).ColumnName.Value == k {
+
+						if alias == nil {
+
+							(*results)[i][k] = strings.ToUpper(v.(string))
+							*columns = append(*columns, k)
+						} else {
+							(*results)[i][alias.Value] = strings.ToUpper(v.(string))
+							*columns = append(*columns, alias.Value)
+						}
+					}
+				}
+			}
+		}
+	case *parser.LowerFunc:
+		for i, row := range *results {
+			for k, v := range row {
+				if _, ok := row[k].(string); ok {
+					if expr.Arg.(*parser.ValueExpression).Value.(*parser.ColumnSpecification).ColumnName.Value == k {
+
+						if alias == nil {
+
+							(*results)[i][k] = strings.ToLower(v.(string))
+							*columns = append(*columns, k)
+						} else {
+							(*results)[i][alias.Value] = strings.ToLower(v.(string))
+							*columns = append(*columns, alias.Value)
+						}
+					}
+				}
+			}
+		}
+	case *parser.CastFunc:
+		for i, row := range *results {
+			for k, v := range row {
+				if _, ok := row[k].(string); ok {
+					if expr.Expr.(*parser.ValueExpression).Value.(*parser.ColumnSpecification).ColumnName.Value == k {
+
+						if alias == nil {
+
+							switch expr.DataType.Value {
+							case "INT", "INTEGER", "SMALLINT":
+								// check if row value is string
+								if _, ok := v.(string); ok {
+									// Convert string to int
+									intVal, err := strconv.Atoi(v.(string))
+									if err != nil {
+										return nil
+									}
+
+									(*results)[i][k] = intVal
+
+								}
+							case "FLOAT", "DOUBLE", "DECIMAL", "REAL", "NUMERIC":
+								// check if row value is string
+								if _, ok := v.(string); ok {
+									// Convert string to float
+									floatVal, err := strconv.ParseFloat(strings.TrimSuffix(strings.TrimPrefix(v.(string), "'"), "'"), 64)
+									if err != nil {
+										return nil
+									}
+
+									(*results)[i][k] = floatVal
+
+								}
+							case "DATE":
+								// check if row value is string
+								if _, ok := v.(string); ok {
+									// Convert string to time.Time
+									dateVal, err := time.Parse("2006-01-02", v.(string))
+									if err != nil {
+										return nil
+									}
+
+									(*results)[i][k] = fmt.Sprintf("'%s'", dateVal)
+
+								}
+							case "DATETIME", "TIMESTAMP":
+								// check if row value is string
+								if _, ok := v.(string); ok {
+									// Convert string to time.Time
+									dateVal, err := time.Parse("2006-01-02 15:04:05", v.(string))
+									if err != nil {
+										return nil
+									}
+
+									(*results)[i][k] = fmt.Sprintf("'%s'", dateVal)
+
+								}
+							case "TIME":
+								// check if row value is string
+								if _, ok := v.(string); ok {
+									// Convert string to time.Time
+									dateVal, err := time.Parse("15:04:05", v.(string))
+									if err != nil {
+										return nil
+									}
+
+									(*results)[i][k] = fmt.Sprintf("'%s'", dateVal)
+
+								}
+							case "BOOL", "BOOLEAN":
+								// check if row value is string
+								if _, ok := v.(string); ok {
+									if v.(string) == "T" || v.(string) == "t" {
+										v = "true"
+									} else if v.(string) == "F" || v.(string) == "f" {
+										v = "false"
+									} else if v.(string) == "'true'" {
+										v = "true"
+									} else if v.(string) == "'false'" {
+										v = "false"
+									}
+
+									// Convert string to bool
+									boolVal, err := strconv.ParseBool(v.(string))
+									if err != nil {
+										return nil
+									}
+
+									(*results)[i][k] = boolVal
+
+								}
+							}
+
+							*columns = append(*columns, k)
+						} else {
+							switch expr.DataType.Value {
+							case "INT", "INTEGER", "SMALLINT":
+								// check if row value is string
+								if _, ok := v.(string); ok {
+									// Convert string to int
+									intVal, err := strconv.Atoi(v.(string))
+									if err != nil {
+										return nil
+									}
+
+									(*results)[i][alias.Value] = intVal
+
+								}
+							case "FLOAT", "DOUBLE", "DECIMAL", "REAL", "NUMERIC":
+								// check if row value is string
+								if _, ok := v.(string); ok {
+									// Convert string to float
+									floatVal, err := strconv.ParseFloat(strings.TrimSuffix(strings.TrimPrefix(v.(string), "'"), "'"), 64)
+									if err != nil {
+										return nil
+									}
+
+									(*results)[i][alias.Value] = floatVal
+
+								}
+							case "DATE":
+								// check if row value is string
+								if _, ok := v.(string); ok {
+									// Convert string to time.Time
+									dateVal, err := time.Parse("2006-01-02", v.(string))
+									if err != nil {
+										return nil
+									}
+
+									(*results)[i][alias.Value] = fmt.Sprintf("'%s'", dateVal)
+
+								}
+							case "DATETIME", "TIMESTAMP":
+								// check if row value is string
+								if _, ok := v.(string); ok {
+									// Convert string to time.Time
+									dateVal, err := time.Parse("2006-01-02 15:04:05", v.(string))
+									if err != nil {
+										return nil
+									}
+
+									(*results)[i][alias.Value] = fmt.Sprintf("'%s'", dateVal)
+
+								}
+							case "TIME":
+								// check if row value is string
+								if _, ok := v.(string); ok {
+									// Convert string to time.Time
+									dateVal, err := time.Parse("15:04:05", v.(string))
+									if err != nil {
+										return nil
+									}
+
+									(*results)[i][alias.Value] = fmt.Sprintf("'%s'", dateVal)
+
+								}
+							case "BOOL", "BOOLEAN":
+								// check if row value is string
+								if _, ok := v.(string); ok {
+									if v.(string) == "T" || v.(string) == "t" {
+										v = "true"
+									} else if v.(string) == "F" || v.(string) == "f" {
+										v = "false"
+									} else if v.(string) == "'true'" {
+										v = "true"
+									} else if v.(string) == "'false'" {
+										v = "false"
+									}
+
+									// Convert string to bool
+									boolVal, err := strconv.ParseBool(v.(string))
+									if err != nil {
+										return nil
+									}
+
+									(*results)[i][alias.Value] = boolVal
+
+								}
+							}
+							*columns = append(*columns, alias.Value)
+						}
+					}
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// evaluateAggregate evaluates an aggregate function
+func evaluateAggregate(expr *parser.AggregateFunc, results *[]map[string]interface{}, columns *[]string, alias *parser.Identifier) error {
+	switch expr.FuncName {
+	case "COUNT":
+		count := 0
+
+		for _, row := range *results {
+			for _, arg := range expr.Args {
+				switch arg := arg.(type) {
+				case *parser.ColumnSpecification:
+					if _, ok := row[arg.ColumnName.Value]; !ok {
+						return errors.New("column does not exist")
+					}
+					count++
+				case *parser.Wildcard:
+					count++
+				}
+			}
+		}
+
+		if alias == nil {
+			*results = []map[string]interface{}{map[string]interface{}{"COUNT": count}}
+			*columns = []string{"COUNT"}
+		} else {
+			*results = []map[string]interface{}{map[string]interface{}{alias.Value: count}}
+			*columns = []string{alias.Value}
+		}
+
+	case "SUM":
+		// Sum the values
+		var sum int
+
+		for _, row := range *results {
+			for _, arg := range expr.Args {
+				switch arg := arg.(type) {
+				case *parser.ColumnSpecification:
+
+					if _, ok := row[arg.ColumnName.Value]; !ok {
+						return errors.New("column does not exist ")
+					}
+
+					switch row[arg.ColumnName.Value].(type) {
+					case int:
+						sum += row[arg.ColumnName.Value].(int)
+					case int64:
+						sum += int(row[arg.ColumnName.Value].(int64))
+					case float64:
+						sum += int(row[arg.ColumnName.Value].(float64))
+
+					}
+				}
+
+			}
+
+		}
+
+		if alias == nil {
+			*results = []map[string]interface{}{map[string]interface{}{"SUM": sum}}
+			*columns = []string{"SUM"}
+		} else {
+			*results = []map[string]interface{}{map[string]interface{}{alias.Value: sum}}
+			*columns = []string{alias.Value}
+		}
+
+	case "AVG":
+		// Average the values
+		var sum int
+		var count int
+
+		for _, row := range *results {
+			for _, arg := range expr.Args {
+				switch arg := arg.(type) {
+				case *parser.ColumnSpecification:
+					if _, ok := row[arg.ColumnName.Value]; !ok {
+						return errors.New("column does not exist")
+					}
+
+					switch row[arg.ColumnName.Value].(type) {
+					case int:
+						sum += row[arg.ColumnName.Value].(int)
+					case int64:
+						sum += int(row[arg.ColumnName.Value].(int64))
+					case float64:
+						sum += int(row[arg.ColumnName.Value].(float64))
+
+					}
+				}
+
+			}
+		}
+
+		count = len(*results)
+
+		avg := sum / count
+
+		if alias == nil {
+			*results = []map[string]interface{}{map[string]interface{}{"AVG": avg}}
+			*columns = []string{"AVG"}
+		} else {
+			*results = []map[string]interface{}{map[string]interface{}{alias.Value: avg}}
+			*columns = []string{alias.Value}
+		}
+
+	case "MAX":
+		// Find the maximum value
+		var mx int
+
+		for _, row := range *results {
+			for _, arg := range expr.Args {
+				switch arg := arg.(type) {
+				case *parser.ColumnSpecification:
+					if _, ok := row[arg.ColumnName.Value]; !ok {
+						return errors.New("column does not exist")
+					}
+
+					switch row[arg.ColumnName.Value].(type) {
+					case int:
+						if row[arg.ColumnName.Value].(int) > mx {
+							mx = row[arg.ColumnName.Value].(int)
+						}
+					case int64:
+						if int(row[arg.ColumnName.Value].(int64)) > mx {
+							mx = int(row[arg.ColumnName.Value].(int64))
+						}
+					case float64:
+						if int(row[arg.ColumnName.Value].(float64)) > mx {
+							mx = int(row[arg.ColumnName.Value].(float64))
+						}
+					}
+				}
+			}
+		}
+
+		if alias == nil {
+			*results = []map[string]interface{}{map[string]interface{}{"MAX": mx}}
+			*columns = []string{"MAX"}
+		} else {
+			*results = []map[string]interface{}{map[string]interface{}{alias.Value: mx}}
+			*columns = []string{alias.Value}
+		}
+
+	case "MIN":
+		// Find the minimum value
+		var mn int
+		mn = int(^uint(0) >> 1)
+
+		for _, row := range *results {
+			for _, arg := range expr.Args {
+				switch arg := arg.(type) {
+				case *parser.ColumnSpecification:
+					if _, ok := row[arg.ColumnName.Value]; !ok {
+						return errors.New("column does not exist")
+					}
+
+					switch row[arg.ColumnName.Value].(type) {
+					case int:
+						if row[arg.ColumnName.Value].(int) < mn {
+							mn = row[arg.ColumnName.Value].(int)
+						}
+					case int64:
+						if int(row[arg.ColumnName.Value].(int64)) < mn {
+							mn = int(row[arg.ColumnName.Value].(int64))
+						}
+					case float64:
+						if int(row[arg.ColumnName.Value].(float64)) < mn {
+							mn = int(row[arg.ColumnName.Value].(float64))
+						}
+					}
+				}
+			}
+		}
+
+		if alias == nil {
+			*results = []map[string]interface{}{map[string]interface{}{"MIN": mn}}
+			*columns = []string{"MIN"}
+		} else {
+			*results = []map[string]interface{}{map[string]interface{}{alias.Value: mn}}
+			*columns = []string{alias.Value}
+		}
+	}
+
+	return nil
+}
+
+// search searches tables based on the where clause
+func (ex *Executor) search(tbls []*catalog.Table, where *parser.WhereClause, update *[]*parser.SetClause, del bool, rowIds *[]int64, before *[]map[string]interface{}) ([]map[string]interface{}, error) {
+	var filteredRows []map[string]interface{} // The final rows that are filtered based on the where clause
+
+	// Check if there are no tables
+	if len(tbls) == 0 {
+		return nil, errors.New("no tables")
+	}
+
+	if where != nil {
+		fold(where.SearchCondition)
+
+		defaultCollations(where.SearchCondition, tbls)
+
+		err := ex.lookupCollations(where.SearchCondition)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Check if there is no where clause
+	if where == nil {
+
+		// If there is no where clause, we return all rows from whatever tables were passed
+		for _, tbl := range tbls {
+
+			if ex.optimizerTrace != nil {
+				trace := ex.tableTrace(tbl)
+				trace.Chosen, trace.Reason = "FULL SCAN", "no WHERE clause"
+			}
+
+			// If we are explaining, we add a full scan step to the plan
+			if ex.explaining {
+				ex.plan.Steps = append(ex.plan.Steps, &Step{Operation: FULL_SCAN, Table: tbl.Name, Column: "n/a", IO: tbl.IOCount()})
+				continue
+			}
+
+			end := ex.startSpan("full scan", attribute.String("db.collection.name", tbl.Name))
+
+			// Setup new row iterator
+			iter := tbl.NewIterator()
+
+			for iter.Valid() {
+				// For every row in the table, we append it to the filtered rows
+				row, err := ex.next(iter)
+				if errors.Is(err, core.ErrQueryCancelled) {
+					end(err)
+					return nil, err
+				}
+
+				if err != nil {
+					continue
+				}
+
+				filteredRows = append(filteredRows, row)
+			}
+
+			end(nil)
+		}
+
+		if ex.explaining {
+			ex.ResultSetBuffer = shared.CreateTableByteArray(convertPlanToRows(ex.plan), shared.GetHeaders(convertPlanToRows(ex.plan), true))
+			return filteredRows, nil
+		}
+
+		for _, row := range filteredRows {
+			formatTemporal(tbls[0], row)
+		}
+
+	} else {
+
+		var err error
+
+		// where is the where clause
+		// filteredRows is the final rows from this function that are filtered based on the where clause
+		// tbls are the tables that are being filtered
+		// update is a set of set clauses for an update statement, if this is an update statement
+		// del is a flag to indicate if this is a delete statement
+		// before is a list of rows before a delete or update statement
+
+		err = ex.filter(where, tbls, &filteredRows, rowIds)
+		if err != nil {
+			return nil, err
+
+		}
+
+	}
+
+	return filteredRows, nil
+
+}
+
+// Optimize struct
+// Reads abstract syntax tree and collections tables and columns to check for index optimization
+type Optimize struct {
+	Tables map[string][]map[string]interface{} // Table and columns to check
+}
+
+// opt optimizes the where clause
+func (ex *Executor) opt(cond interface{}, optimize *Optimize, tbls []*catalog.Table) error {
+	switch cond.(type) {
+	case *parser.LogicalCondition:
+		err := ex.opt(cond.(*parser.LogicalCondition).Left, optimize, tbls)
+		if err != nil {
+			return err
+
+		}
+
+		err = ex.opt(cond.(*parser.LogicalCondition).Right, optimize, tbls)
+		if err != nil {
+			return err
+		}
+
+	case *parser.ComparisonPredicate:
+		// A comparison in a collation matches values the index does not have, 'ALEX' for 'alex' COLLATE nocase
+		if collationOf(cond.(*parser.ComparisonPredicate)) != "" {
+			ex.tracePruned(cond.(*parser.ComparisonPredicate).Left, tbls, "compared in a collation the index does not order by")
+			return nil
+		}
+
+		if _, ok := cond.(*parser.ComparisonPredicate).Left.Value.(*parser.ColumnSpecification); !ok {
+			ex.tracePruned(cond.(*parser.ComparisonPredicate).Right, tbls, "the column is not on the left of the comparison")
+		}
+
+		// check if left is column spec
+		if _, ok := cond.(*parser.ComparisonPredicate).Left.Value.(*parser.ColumnSpecification); ok {
+			col := cond.(*parser.ComparisonPredicate).Left.Value.(*parser.ColumnSpecification)
+
+			var tbl *catalog.Table
+
+			// In case of aliases
+			if col.TableName != nil {
+				for _, t := range tbls {
+					if t.Name == col.TableName.Value {
+						tbl = t
+						break
+					}
+				}
+			}
+
+			if tbl == nil {
+				// Get first table in tables list
+				tbl = ex.ch.Database.GetTable(tbls[0].Name)
+				if tbl == nil {
+					return errors.New("table does not exist")
+				}
+
+				col.TableName = &parser.Identifier{Value: tbl.Name}
+			}
+
+			iter := tbl.NewIterator()
+			if iter.Valid() {
+				row, err := ex.next(iter)
+				if err != nil {
+					return err
+				}
+
+				for k, _ := range row {
+					if k == col.ColumnName.Value {
+
+						optimize.Tables[col.TableName.Value] = append(optimize.Tables[col.TableName.Value], map[string]interface{}{"column": col.ColumnName.Value, "value": row[k]})
+
+						// check if right is column spec
+						if _, ok := cond.(*parser.ComparisonPredicate).Right.Value.(*parser.ColumnSpecification); ok {
+
+							col = cond.(*parser.ComparisonPredicate).Right.Value.(*parser.ColumnSpecification)
+
+							iter := tbl.NewIterator()
+							if iter.Valid() {
+								row, err := ex.next(iter)
+								if err != nil {
+									return err
+								}
+
+								for k, _ := range row {
+									if k == col.ColumnName.Value {
+										optimize.Tables[col.TableName.Value] = append(optimize.Tables[col.TableName.Value], map[string]interface{}{"column": col.ColumnName.Value, "value": row[k]})
+
+										break // break out of loop
+									}
+								}
+							}
+
+							break // break out of loop
+						}
+
+						break // break out of loop
+					}
+				}
+			}
+
+		}
+
+	case *parser.InPredicate:
+		// check if left is column spec
+		if _, ok := cond.(*parser.InPredicate).Left.Value.(*parser.ColumnSpecification); ok {
+			col := cond.(*parser.InPredicate).Left.Value.(*parser.ColumnSpecification)
+
+			if col.TableName == nil {
+
+				// Get first table in tables list
+				tbl := ex.ch.Database.GetTable(tbls[0].Name)
+				if tbl == nil {
+					return errors.New("table does not exist")
+				}
+
+				iter := tbl.NewIterator()
+				if iter.Valid() {
+					row, err := ex.next(iter)
+					if err != nil {
+						return err
+					}
+
+					for k, _ := range row {
+						if k == col.ColumnName.Value {
+							col.TableName = &parser.Identifier{Value: tbl.Name}
+							break // break out of loop
+						}
+					}
+
+				}
+			}
+
+			// An empty table has no row to find the column in
+			if col.TableName == nil {
+				break
+			}
+
+			for _, val := range cond.(*parser.InPredicate).Values {
+				optimize.Tables[col.TableName.Value] = append(optimize.Tables[col.TableName.Value], map[string]interface{}{"column": col.ColumnName.Value, "value": val.Value})
+			}
+
+		}
+	case *parser.BetweenPredicate:
+		// check if left is column spec
+		if _, ok := cond.(*parser.BetweenPredicate).Left.Value.(*parser.ColumnSpecification); ok {
+			col := cond.(*parser.BetweenPredicate).Left.Value.(*parser.ColumnSpecification)
+
+			if col.TableName == nil {
+
+				// Get first table in tables list
+				tbl := ex.ch.Database.GetTable(tbls[0].Name)
+				if tbl == nil {
+					return errors.New("table does not exist")
+				}
+
+				iter := tbl.NewIterator()
+				if iter.Valid() {
+					row, err := ex.next(iter)
+					if err != nil {
+						return err
+					}
+
+					for k, _ := range row {
+						if k == col.ColumnName.Value {
+							col.TableName = &parser.Identifier{Value: tbl.Name}
+							break // break out of loop
+						}
+					}
+
+				}
+			}
+
+			if _, ok := optimize.Tables[col.TableName.Value]; !ok {
+				optimize.Tables[col.TableName.Value] = []map[string]interface{}{}
+			}
+
+			optimize.Tables[col.TableName.Value] = append(optimize.Tables[col.TableName.Value], map[string]interface{}{"column": col.ColumnName.Value, "value": cond.(*parser.BetweenPredicate).Upper.Value})
+			optimize.Tables[col.TableName.Value] = append(optimize.Tables[col.TableName.Value], map[string]interface{}{"column": col.ColumnName.Value, "value": cond.(*parser.BetweenPredicate).Lower.Value})
+
+		}
+	case *parser.LikePredicate:
+		// check if left is column spec
+		if _, ok := cond.(*parser.LikePredicate).Left.Value.(*parser.ColumnSpecification); ok {
+
+			col := cond.(*parser.LikePredicate).Left.Value.(*parser.ColumnSpecification)
+
+			if col.TableName == nil {
+
+				// Get first table in tables list
+				tbl := ex.ch.Database.GetTable(tbls[0].Name)
+				if tbl == nil {
+					return errors.New("table does not exist")
+				}
+
+				iter := tbl.NewIterator()
+				if iter.Valid() {
+					row, err := ex.next(iter)
+					if err != nil {
+						return err
+					}
+
+					for k, _ := range row {
+						if k == col.ColumnName.Value {
+							col.TableName = &parser.Identifier{Value: tbl.Name}
+							break // break out of loop
+						}
+					}
+
+				}
+			}
+
+			if _, ok := optimize.Tables[col.TableName.Value]; !ok {
+				optimize.Tables[col.TableName.Value] = []map[string]interface{}{}
+			}
+
+			optimize.Tables[col.TableName.Value] = append(optimize.Tables[col.TableName.Value], map[string]interface{}{"column": col.ColumnName.Value, "value": cond.(*parser.LikePredicate).Pattern.Value})
+
+		}
+	case *parser.IsPredicate:
+		// check if left is column spec
+		if _, ok := cond.(*parser.IsPredicate).Left.Value.(*parser.ColumnSpecification); ok {
+			col := cond.(*parser.IsPredicate).Left.Value.(*parser.ColumnSpecification)
+
+			if col.TableName == nil {
+
+				// Get first table in tables list
+				tbl := ex.ch.Database.GetTable(tbls[0].Name)
+				if tbl == nil {
+					return errors.New("table does not exist")
+				}
+
+				iter := tbl.NewIterator()
+				if iter.Valid() {
+					row, err := ex.next(iter)
+					if err != nil {
+						return err
+					}
+
+					for k, _ := range row {
+						if k == col.ColumnName.Value {
+							col.TableName = &parser.Identifier{Value: tbl.Name}
+							break // break out of loop
+						}
+					}
+
+				}
+			}
+
+			if _, ok := optimize.Tables[col.TableName.Value]; !ok {
+				optimize.Tables[col.TableName.Value] = []map[string]interface{}{}
+			}
+
+			// IS NOT NULL can not be answered from an index
+			if cond.(*parser.IsPredicate).Null {
+				optimize.Tables[col.TableName.Value] = append(optimize.Tables[col.TableName.Value], map[string]interface{}{"column": col.ColumnName.Value, "value": nil})
+			} else {
+				ex.tracePruned(cond.(*parser.IsPredicate).Left, tbls, "IS NOT NULL can not be answered from an index")
+			}
+
+		}
+	case *parser.NotExpr:
+		err := ex.opt(cond.(*parser.NotExpr).Expr, optimize, tbls)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Row represents a row object
+// ID is the page/row id and Row is the actual row
+type Row struct {
+	ID  int64
+	Row *map[string]interface{}
+}
+
+// convertRowsToMap converts a slice of rows to a slice of maps
+func convertRowsToMap(rows []*Row) []map[string]interface{} {
+	var results []map[string]interface{}
+
+	for _, row := range rows {
+		results = append(results, *row.Row)
+	}
+
+	return results
+}
+
+// convertPlanToRows converts a plan to rows
+func convertPlanToRows(plan *Plan) []map[string]interface{} {
+	var results []map[string]interface{}
+
+	for _, step := range plan.Steps {
+
+		op := ""
+
+		switch step.Operation {
+		case FULL_SCAN:
+			op = "FULL SCAN"
+		case INDEX_SCAN:
+			op = "INDEX SCAN"
+		case BLOOM_SCAN:
+			op = "BLOOM SCAN"
+		}
+
+		results = append(results, map[string]interface{}{"operation": op, "table": step.Table, "column": step.Column, "io": step.IO})
+	}
+
+	return results
+}
+
+// filter filters rows based on the where clause
+func (ex *Executor) filter(where *parser.WhereClause, tbls []*catalog.Table, filteredRows *[]map[string]interface{}, rowIds *[]int64) error {
+
+	if len(tbls) == 0 {
+		return errors.New("no tables")
+	}
+
+	names := make([]string, 0, len(tbls))
+	for _, tbl := range tbls {
+		names = append(names, tbl.Name)
+	}
+
+	end := ex.startSpan("filter", attribute.StringSlice("db.collection.name", names))
+	defer end(nil)
+
+	// gather the tables and columns to check
+	optimize := &Optimize{
+		Tables: make(map[string][]map[string]interface{}),
+	}
+
+	if where != nil {
+
+		// Check for optimizations, such as indexes
+		err := ex.opt(where.SearchCondition, optimize, tbls)
+		if err != nil {
+			return err
+		}
+
+		if ex.optimizerTrace != nil {
+			err = ex.tracePlans(where, optimize, tbls)
+			if err != nil {
+				return err
+			}
+		}
+
+		if ex.explaining {
+			for tblName, colsValues := range optimize.Tables {
+
+				for _, colValue := range colsValues {
+					// Get index
+					var tbl *catalog.Table
+
+					for _, t := range tbls {
+						if t.Name == tblName {
+							tbl = t
+							break
+						}
+					}
+
+					idx := tbl.VisibleIndexedColumn(colValue["column"].(string), true)
+					if idx == nil {
+						// check if non unique index
+						idx = tbl.VisibleIndexedColumn(colValue["column"].(string), false)
+						if idx == nil {
+							idx = nil
+						}
+					}
+
+					io := 0
+
+					if idx != nil {
+						// check if value is literal
+
+						rowIds, err := tbl.IndexLookup(idx, colValue["column"].(string), colValue["value"])
+						if err != nil {
+							return err
+						}
+
+						io = len(rowIds)
+
+						ex.plan.Steps = append(ex.plan.Steps, &Step{Operation: INDEX_SCAN, Table: tblName, Column: colValue["column"].(string), IO: int64(io) + idx.GetBtree().Pager.Count()})
+
+					} else {
+						// remove from optimize
+						delete(optimize.Tables, tblName)
+					}
+
+				}
+			}
+
+			// Segments of a single table are skipped by bloom filters on the columns of equality predicates without an index
+			if len(tbls) == 1 {
+				for _, pred := range ex.bloomPredicates(where.SearchCondition, tbls[0]) {
+					b := tbls[0].BloomFilterColumn(pred["column"].(string))
+					ex.plan.Steps = append(ex.plan.Steps, &Step{Operation: BLOOM_SCAN, Table: tbls[0].Name, Column: b.Column, IO: tbls[0].BloomScanIO(b, pred["value"])})
+				}
+			}
+
+			ex.ResultSetBuffer = shared.CreateTableByteArray(convertPlanToRows(ex.plan), shared.GetHeaders(convertPlanToRows(ex.plan), true))
+
+			return nil
+
+		}
+	}
+
+	indexedColumns := make(map[string]*catalog.Index)
+
+	var tblIters []*catalog.Iterator
+
+	// For each table
+	for _, tbl := range tbls {
+		// skip table where index is found
+		if _, ok := indexedColumns[tbl.Name]; ok {
+			continue
+		}
+
+		// Setup new row iterator
+		iter := tbl.NewIterator()
+
+		if where != nil && len(tbls) == 1 {
+			for _, pred := range ex.bloomPredicates(where.SearchCondition, tbl) {
+				iter.Prune(pred["column"].(string), pred["value"])
+			}
+
+			// NULLs are stored under their own key, the rows under it are the only rows which can match
+			if idx, col := ex.nullPredicate(where.SearchCondition, tbl); idx != nil {
+				rowIds, err := tbl.IndexLookup(idx, col, nil)
+				if err != nil {
+					return err
+				}
+
+				iter.Restrict(rowIds)
+			}
+		}
+
+		tblIters = append(tblIters, iter)
+
+	}
+
+	invalidIters := 0
+
+	var currentRows []*Row
+
+	// The index every column is looked up in is reused from the plan cache, on a miss the plan is cached
+	plan, planned := ex.cachedPlan(tbls)
+
+	if len(optimize.Tables) > 0 {
+		for tblName, colsValues := range optimize.Tables {
+			var tbl *catalog.Table
+
+			for _, t := range tbls {
+				if t.Name == tblName {
+					tbl = t
+					break
+				}
+			}
+
+			for _, colValue := range colsValues {
+				col := colValue["column"].(string)
+				val := colValue["value"]
+
+				var idx *catalog.Index
+
+				if name, ok := planned.Index(catalogName(tbl), col); ok {
+					if name != "" {
+						idx = tbl.GetIndex(name)
+					}
+				} else {
+					idx = tbl.VisibleIndexedColumn(col, true)
+					if idx == nil {
+						// try not unique index
+						idx = tbl.VisibleIndexedColumn(col, false)
+						if idx != nil {
+							idx = nil
+
+						}
+
+					}
+
+					if _, ok := plan.Index(catalogName(tbl), col); plan != nil && !ok {
+						access := plancache.Access{Table: catalogName(tbl), Column: col}
+						if idx != nil {
+							access.Index = idx.Name
+						}
+
+						plan.Access = append(plan.Access, access)
+					}
+				}
+
+				if idx != nil {
+
+					endLookup := ex.startSpan("index lookup", attribute.String("db.collection.name", tbl.Name), attribute.String("ariasql.index", idx.Name))
+
+					rowIds, err := tbl.IndexLookup(idx, col, val)
+					endLookup(err)
+					if err != nil {
+						return err
+					}
+
+					for _, rRowId := range rowIds {
+						row, err := tbl.GetRow(rRowId)
+						if err != nil {
+							return err
+						}
+
+						// convert to tablename.columnname
+						for k, vv := range row {
+							delete(row, k)
+							row[fmt.Sprintf("%v.%v", tbl.Name, k)] = vv
+						}
+
+						// Row ids are one past the row, as the iterator's current row is after reading one
+						currentRows = append(currentRows, &Row{ID: rRowId + 1, Row: &row})
+
+					}
+				}
+
+			}
+
+		}
+	}
+
+	if plan != nil {
+		ex.aria.Plans.Put(plan)
+	}
+
+	for invalidIters < len(tblIters) {
+		if invalidIters >= len(tblIters) {
+			break
+		}
+
+		for i := 0; i < len(tblIters); i++ {
+			iter := tblIters[i]
+
+			if iter.Valid() {
+				row, err := ex.next(iter)
+				if errors.Is(err, core.ErrQueryCancelled) {
+					return err
+				}
+
+				if err != nil {
+
+					invalidIters++
+					continue
+				}
+
+				// convert row to tablename.columnname
+
+				if i > len(tbls)-1 {
+					break
+				}
+
+				for k, v := range row {
+					delete(row, k)
+					row[fmt.Sprintf("%v.%v", tbls[i].Name, k)] = v
+				}
+
+				currentRows = append(currentRows, &Row{ID: iter.Current(), Row: &row})
+
+			} else {
+				invalidIters++
+			}
+		}
+
+		currentRowsMap := convertRowsToMap(currentRows)
+
+		if ex.evaluateWhereClause(where, &currentRowsMap, tbls, filteredRows) {
+
+			// add the columns to the new row
+			for i, row := range currentRowsMap {
+
+				for k, v := range row {
+					// Check if value is time.Time
+					if _, ok := v.(time.Time); ok {
+						// if so we need to read the schema to get the type
+
+						// split the key and get the table name
+						tblName := strings.Split(k, ".")[0]
+
+						// get the table
+						for _, tbl := range tbls {
+							if tbl.Name == tblName {
+								// get the column type
+								for name, col := range tbl.TableSchema.ColumnDefinitions {
+									if name == strings.Split(k, ".")[1] {
+										switch col.DataType {
+										case "DATE":
+											currentRowsMap[i][k] = fmt.Sprintf("'%s'", v.(time.Time).Format("2006-01-02"))
+										case "TIME":
+											currentRowsMap[i][k] = fmt.Sprintf("'%s'", v.(time.Time).Format("15:04:05"))
+										case "TIMESTAMP", "DATETIME":
+											currentRowsMap[i][k] = fmt.Sprintf("'%s'", v.(time.Time).Format("2006-01-02 15:04:05"))
+										}
+									}
+								}
+							}
+						}
+
+					}
+
+					if len(tbls) == 1 {
+						if strings.Contains(k, ".") {
+							// remove tablename
+							newKey := strings.Split(k, ".")[1]
+							currentRowsMap[i][newKey] = currentRowsMap[i][k]
+							delete(currentRowsMap[i], k)
+						}
+					}
+
+				}
+			}
+
+			// create a new row
+			newRow := map[string]interface{}{}
+
+			if rowIds != nil {
+				if *rowIds == nil {
+					*rowIds = []int64{}
+				}
+			}
+
+			for i := range currentRowsMap {
+
+				if rowIds != nil {
+					for j, _ := range currentRows {
+
+						for k, _ := range *currentRows[j].Row {
+							if strings.Contains(k, ".") {
+								// remove tablename
+								newKey := strings.Split(k, ".")[1]
+								(*currentRows[j].Row)[newKey] = (*currentRows[j].Row)[k]
+								delete(*currentRows[j].Row, k)
+							}
+						}
+
+						if where != nil {
+
+							if shared.IdenticalMap(*currentRows[j].Row, currentRowsMap[i]) {
+								*rowIds = append(*rowIds, currentRows[j].ID)
+
+							}
+						}
+
+					}
+
+				}
+
+				for k, v := range currentRowsMap[i] {
+					newRow[k] = v
+				}
+			}
+
+			// check if newRow == map[]
+			if len(newRow) > 0 {
+				*filteredRows = append(*filteredRows, newRow)
+
+			}
+
+		}
+		currentRowsMap = []map[string]interface{}{}
+
+		if where != nil {
+			currentRows = []*Row{}
+		}
+
+	}
+
+	// if there was no where clause append all row ids
+	if where == nil {
+		for _, row := range currentRows {
+			*rowIds = append(*rowIds, row.ID)
+		}
+
+	}
+
+	return nil
+}
+
+// cachedPlan returns the cached plan of the filter of the statement executing, or on a miss a plan to cache
+// Only statements sent by clients are cached, by their normalized text, the statements of procedures and transactions are not
+func (ex *Executor) cachedPlan(tbls []*catalog.Table) (*plancache.Plan, *plancache.Plan) {
+	if ex.aria == nil || ex.aria.Plans == nil || ex.ch == nil || ex.ch.Database == nil || ex.depth != 1 || ex.explaining || ex.recover {
+		return nil, nil
+	}
+
+	query := ex.ch.Query()
+	if query == nil {
+		return nil, nil
+	}
+
+	ex.planStep++
+
+	rows := make(map[string]int64)
+	for _, tbl := range tbls {
+		rows[catalogName(tbl)] = tbl.Rows.Count()
+	}
+
+	planned := ex.aria.Plans.Get(ex.ch.Database.Name, query.Text, ex.planStep, func(table string) int64 { return rows[table] })
+	if planned != nil {
+		return nil, planned
+	}
+
+	return &plancache.Plan{Database: ex.ch.Database.Name, Statement: query.Text, Step: ex.planStep, Rows: rows}, nil
+}
+
+// invalidatePlans removes the cached plans reading the tables a statement altered or dropped
+func (ex *Executor) invalidatePlans(stmt parser.Statement) {
+	if ex.aria == nil || ex.aria.Plans == nil || ex.ch == nil {
+		return
+	}
+
+	var table *parser.Identifier
+
+	switch s := stmt.(type) {
+	case *parser.DropDatabaseStmt:
+		ex.aria.Plans.Invalidate(s.Name.Value, "")
+		return
+	case *parser.DropTableStmt:
+		table = s.TableName
+	case *parser.AlterTableStmt:
+		table = s.TableName
+	case *parser.CreateIndexStmt:
+		table = s.TableName
+	case *parser.DropIndexStmt:
+		table = s.TableName
+	case *parser.AlterIndexStmt:
+		table = s.TableName
+	case *parser.CreateBloomFilterStmt:
+		table = s.TableName
+	case *parser.DropBloomFilterStmt:
+		table = s.TableName
+	case *parser.MoveTableStmt:
+		table = s.TableName
+	}
+
+	if table != nil && ex.ch.Database != nil {
+		ex.aria.Plans.Invalidate(ex.ch.Database.Name, table.Value)
+	}
+}
+
+// catalogName returns the name of a table within its database, a table read under an alias is named by the alias while it is read
+func catalogName(tbl *catalog.Table) string {
+	if tbl.Directory == "" {
+		return tbl.Name
+	}
+
+	return filepath.Base(tbl.Directory)
+}
+
+// optimized returns true if the plans of a statement are traced with SET optimizer_trace = ON
+func optimized(stmt parser.Statement) bool {
+	switch stmt.(type) {
+	case *parser.SelectStmt, *parser.UpdateStmt, *parser.DeleteStmt, *parser.ExplainStmt:
+		return true
+	}
+
+	return false
+}
+
+// tableTrace returns the trace of a table within the optimizer trace, adding it if the table was not planned yet
+func (ex *Executor) tableTrace(tbl *catalog.Table) *TableTrace {
+	for _, trace := range ex.optimizerTrace.Tables {
+		if trace.Table == tbl.Name {
+			return trace
+		}
+	}
+
+	trace := &TableTrace{Table: tbl.Name, Rows: tbl.Rows.Count(), FullScanIO: tbl.IOCount(), Candidates: []*Candidate{}}
+	ex.optimizerTrace.Tables = append(ex.optimizerTrace.Tables, trace)
+
+	return trace
+}
+
+// tracePruned traces the column of an expression as not considered for an index scan
+func (ex *Executor) tracePruned(expr *parser.ValueExpression, tbls []*catalog.Table, reason string) {
+	if ex.optimizerTrace == nil || expr == nil {
+		return
+	}
+
+	col, ok := expr.Value.(*parser.ColumnSpecification)
+	if !ok || col.ColumnName == nil {
+		return
+	}
+
+	for _, tbl := range tbls {
+		if col.TableName != nil && col.TableName.Value != tbl.Name {
+			continue
+		}
+
+		if _, ok := tbl.TableSchema.ColumnDefinitions[col.ColumnName.Value]; ok {
+			trace := ex.tableTrace(tbl)
+			trace.Candidates = append(trace.Candidates, &Candidate{Column: col.ColumnName.Value, Pruned: reason})
+			return
+		}
+	}
+}
+
+// tracePlans traces the plans considered for reading the tables of a where clause, the columns to check are gathered by opt
+// As with EXPLAIN a table is read with an index scan if a predicate is on a column with a visible index, the cheapest is chosen
+func (ex *Executor) tracePlans(where *parser.WhereClause, optimize *Optimize, tbls []*catalog.Table) error {
+	for _, tbl := range tbls {
+		trace := ex.tableTrace(tbl)
+
+		for _, colValue := range optimize.Tables[tbl.Name] {
+			column := colValue["column"].(string)
+
+			var candidate *Candidate
+			for _, c := range trace.Candidates {
+				if c.Column == column && c.Lookups > 0 {
+					candidate = c
+					break
+				}
+			}
+
+			if candidate == nil {
+				candidate = &Candidate{Column: column}
+				trace.Candidates = append(trace.Candidates, candidate)
+			}
+
+			candidate.Lookups++
+
+			idx := tbl.VisibleIndexedColumn(column, true)
+			if idx == nil {
+				idx = tbl.VisibleIndexedColumn(column, false)
+			}
+
+			if idx == nil {
+				candidate.Pruned = "no visible index on the column"
+
+				// An invisible index is not considered by the optimizer
+				if idx = tbl.CheckIndexedColumn(column, true); idx == nil {
+					idx = tbl.CheckIndexedColumn(column, false)
+				}
+
+				if idx != nil {
+					candidate.Pruned = "index " + idx.Name + " is invisible"
+				}
+
+				continue
+			}
+
+			rowIds, err := tbl.IndexLookup(idx, column, colValue["value"])
+			if err != nil {
+				return err
+			}
+
+			candidate.Index, candidate.Unique = idx.Name, idx.Unique
+			candidate.IO += int64(len(rowIds)) + idx.GetBtree().Pager.Count()
+		}
+
+		var chosen *Candidate
+		for _, c := range trace.Candidates {
+			if c.Index != "" && (chosen == nil || c.IO < chosen.IO) {
+				chosen = c
+			}
+		}
+
+		switch {
+		case chosen != nil:
+			trace.Chosen, trace.Index = "INDEX SCAN", chosen.Index
+			trace.Reason = fmt.Sprintf("index scan of %s costs %d io, a full scan %d io", chosen.Column, chosen.IO, trace.FullScanIO)
+		case len(trace.Candidates) > 0:
+			trace.Chosen, trace.Reason = "FULL SCAN", "no predicate can be answered from a visible index"
+		case trace.Rows == 0:
+			trace.Chosen, trace.Reason = "FULL SCAN", "the table is empty"
+		default:
+			trace.Chosen, trace.Reason = "FULL SCAN", "no predicate compares a column of the table"
+		}
+
+		// Segments of a single table are skipped by bloom filters on the columns of equality predicates without an index
+		if len(tbls) == 1 {
+			for _, pred := range ex.bloomPredicates(where.SearchCondition, tbl) {
+				b := tbl.BloomFilterColumn(pred["column"].(string))
+				trace.BloomFilters = append(trace.BloomFilters, &BloomTrace{Column: b.Column, IO: tbl.BloomScanIO(b, pred["value"])})
+			}
+		}
+	}
+
+	return nil
+}
+
+// bloomPredicates returns the column = literal predicates of a condition every row has to match which a bloom filter can prune by
+// Predicates on columns with a visible index are left to the index, predicates under OR or NOT are never returned
+func (ex *Executor) bloomPredicates(cond interface{}, tbl *catalog.Table) []map[string]interface{} {
+	switch cond := cond.(type) {
+	case *parser.LogicalCondition:
+		if cond.Op != parser.OP_AND {
+			return nil
+		}
+
+		return append(ex.bloomPredicates(cond.Left, tbl), ex.bloomPredicates(cond.Right, tbl)...)
+	case *parser.ComparisonPredicate:
+		if cond.Op != parser.OP_EQ || cond.Left == nil || cond.Right == nil {
+			return nil
+		}
+
+		// A value equal in a collation can be absent from the filter, such as 'ALEX' for 'alex' COLLATE nocase
+		if cond.Left.Collation != nil || cond.Right.Collation != nil {
+			return nil
+		}
+
+		col, ok := cond.Left.Value.(*parser.ColumnSpecification)
+		if !ok || (col.TableName != nil && col.TableName.Value != tbl.Name) {
+			return nil
+		}
+
+		lit, ok := cond.Right.Value.(*parser.Literal)
+		if !ok || lit.Value == nil {
+			return nil
+		}
+
+		if tbl.VisibleIndexedColumn(col.ColumnName.Value, true) != nil || tbl.VisibleIndexedColumn(col.ColumnName.Value, false) != nil {
+			return nil
+		}
+
+		if tbl.BloomFilterColumn(col.ColumnName.Value) == nil {
+			return nil
+		}
+
+		return []map[string]interface{}{{"column": col.ColumnName.Value, "value": lit.Value}}
+	}
+
+	return nil
+}
+
+// nullPredicate returns a visible index and its column for a column IS NULL predicate of a condition every row has to match
+// Predicates under OR or NOT are never returned
+func (ex *Executor) nullPredicate(cond interface{}, tbl *catalog.Table) (*catalog.Index, string) {
+	switch cond := cond.(type) {
+	case *parser.LogicalCondition:
+		if cond.Op != parser.OP_AND {
+			return nil, ""
+		}
+
+		idx, col := ex.nullPredicate(cond.Left, tbl)
+		if idx == nil {
+			idx, col = ex.nullPredicate(cond.Right, tbl)
+		}
+
+		return idx, col
+	case *parser.IsPredicate:
+		if !cond.Null || cond.Left == nil {
+			return nil, ""
+		}
+
+		col, ok := cond.Left.Value.(*parser.ColumnSpecification)
+		if !ok || (col.TableName != nil && col.TableName.Value != tbl.Name) {
+			return nil, ""
+		}
+
+		idx := tbl.VisibleIndexedColumn(col.ColumnName.Value, true)
+		if idx == nil {
+			idx = tbl.VisibleIndexedColumn(col.ColumnName.Value, false)
+		}
+
+		if idx == nil {
+			return nil, ""
+		}
+
+		return idx, col.ColumnName.Value
+	}
+
+	return nil, ""
+}
+
+// evaluateWhereClause evaluates the where clause
+func (ex *Executor) evaluateWhereClause(where *parser.WhereClause, rows *[]map[string]interface{}, tbls []*catalog.Table, filteredRows *[]map[string]interface{}) bool {
+	// If there is no where clause, we return true
+	if where == nil {
+		return true
+	}
+
+	// If there is a where clause, we evaluate the condition
+	return ex.evaluateCondition(where.SearchCondition, rows, tbls, filteredRows)
+}
+
+// EvaluateCondition evaluates a condition
+func (ex *Executor) evaluateCondition(condition interface{}, rows *[]map[string]interface{}, tbls []*catalog.Table, filteredRows *[]map[string]interface{}) bool {
+	// If there is no condition, we return true
+	if condition == nil {
+		return true
+	}
+
+	_, not := condition.(*parser.NotExpr)
+	if not {
+		condition = condition.(*parser.NotExpr).Expr
+
+	}
+
+	switch condition := condition.(type) {
+	case *parser.LogicalCondition:
+		switch condition.Op {
+		case parser.OP_AND:
+			return ex.evaluateCondition(condition.Left, rows, tbls, filteredRows) && ex.evaluateCondition(condition.Right, rows, tbls, filteredRows)
+		case parser.OP_OR:
+			return ex.evaluateCondition(condition.Left, rows, tbls, filteredRows) || ex.evaluateCondition(condition.Right, rows, tbls, filteredRows)
+		case parser.OP_NOT:
+			return !ex.evaluateCondition(condition.Right, rows, tbls, filteredRows)
+		}
+
+	case *parser.InPredicate:
+		// check if left is column spec
+		if _, ok := condition.Left.Value.(*parser.ColumnSpecification); ok {
+			left := ex.evaluateValueExpression(condition.Left, rows)
+
+			// Check if first value is selectStmt
+			if _, ok := condition.Values[0].Value.(*parser.SelectStmt); ok {
+
+				innerRows, err := ex.executeSubquery(condition.Values[0].Value.(*parser.SelectStmt), rows)
+				if err != nil {
+					return false
+				}
+
+				for _, val := range innerRows {
+					if not {
+
+						if left != val[condition.Left.Value.(*parser.ColumnSpecification).ColumnName.Value] {
+							return true
+						}
+
+					} else {
+
+						if left == val[condition.Left.Value.(*parser.ColumnSpecification).ColumnName.Value] {
+
+							return true
+						}
+
+					}
+				}
+
+				return false
+
+			}
+
+			for _, val := range condition.Values {
+
+				switch val.Value.(*parser.Literal).Value.(type) {
+				case uint64:
+					val.Value.(*parser.Literal).Value = int(val.Value.(*parser.Literal).Value.(uint64))
+				}
+
+				if not {
+					if val.Value.(*parser.Literal).Value != left {
+
+						return true
+					}
+
+				} else {
+					if val.Value.(*parser.Literal).Value == left {
+
+						return true
+					}
+				}
+
+			}
+		}
+
+	case *parser.IsPredicate:
+
+		if not {
+			return false
+		}
+
+		if _, ok := condition.Left.Value.(*parser.ColumnSpecification); ok {
+			left := ex.evaluateValueExpression(condition.Left, rows)
+
+			if condition.Null {
+				return left == nil
+			} else {
+				return left != nil
+			}
+
+		}
+	case *parser.BetweenPredicate:
+		// check if left is column spec
+		if _, ok := condition.Left.Value.(*parser.ColumnSpecification); ok {
+			left := ex.evaluateValueExpression(condition.Left, rows)
+			right := ex.evaluateValueExpression(condition.Lower, rows)
+			upper := ex.evaluateValueExpression(condition.Upper, rows)
+
+			if left == nil {
+				return false
+			}
+
+			if !not {
+				// check if left is a string
+				if _, ok := left.(string); ok {
+					// check if right is a string
+					if _, ok := right.(string); ok {
+						return left.(string) >= right.(string) && left.(string) <= upper.(string) // left >= lower && left <= upper
+					}
+
+					return false
+				}
+
+				// check if left is a float
+				if _, ok := left.(float64); ok {
+					if _, ok := right.(uint64); ok {
+						right = float64(right.(uint64))
+
+					}
+
+					if _, ok := upper.(uint64); ok {
+						upper = float64(upper.(uint64))
+
+					}
+
+					return left.(float64) >= right.(float64) && left.(float64) <= upper.(float64) // left >= lower && left <= upper
+				}
+
+				return left.(int) >= int(right.(uint64)) && left.(int) <= int(upper.(uint64)) // left >= lower && left <= upper
+			} else {
+				return left.(int) < int(right.(uint64)) || left.(int) > int(upper.(uint64)) // left < lower || left > upper
+			}
+
+		}
+	case *parser.LikePredicate:
+		// check if left is column spec
+		if _, ok := condition.Left.Value.(*parser.ColumnSpecification); ok {
+			left := ex.evaluateValueExpression(condition.Left, rows)
+
+			pattern := condition.Pattern.Value
+			/*
+				'%a'
+				Matches any string that ends with 'a'. The '%' wildcard matches any sequence of characters, including an empty sequence.
+
+				'%a%'
+				Matches any string that contains 'a' anywhere within it. The '%' wildcard before and after 'a' means that 'a' can be preceded or followed by any sequence of characters.
+
+				'a%'
+				Matches any string that starts with 'a'. The '%' wildcard after 'a' allows for any sequence of characters after 'a'.
+
+				'a%b'
+				Matches any string that starts with 'a' and ends with 'b'. The '%' wildcard in the middle allows for any sequence of characters between 'a' and 'b'.
+
+			*/
+
+			if left == nil {
+				return false
+			}
+
+			if !not {
+				switch {
+
+				case strings.HasPrefix(pattern.(*parser.Literal).Value.(string), "'%") && strings.HasSuffix(pattern.(*parser.Literal).Value.(string), "%'"):
+					// '%a%'
 					if strings.Contains(left.(string), strings.TrimPrefix(strings.TrimSuffix(pattern.(*parser.Literal).Value.(string), "%'"), "'%")) {
 						return true
 					}
-				case strings.HasSuffix(pattern.(*parser.Literal).Value.(string), "%'"):
-					// 'a%'
-					if strings.HasPrefix(left.(string), strings.TrimSuffix(pattern.(*parser.Literal).Value.(string), "%'")) {
-						return true
+				case strings.HasSuffix(pattern.(*parser.Literal).Value.(string), "%'"):
+					// 'a%'
+					if strings.HasPrefix(left.(string), strings.TrimSuffix(pattern.(*parser.Literal).Value.(string), "%'")) {
+						return true
+					}
+				case strings.HasPrefix(pattern.(*parser.Literal).Value.(string), "'%"):
+					// '%a'
+					if strings.HasSuffix(left.(string), strings.TrimPrefix(pattern.(*parser.Literal).Value.(string), "'%")) {
+						return true
+					}
+				case len(strings.Split(pattern.(*parser.Literal).Value.(string), "%")) == 2:
+					// 'a%b'
+					lStr := strings.TrimLeft(strings.Split(pattern.(*parser.Literal).Value.(string), "%")[0], "'")
+					rStr := strings.TrimRight(strings.Split(pattern.(*parser.Literal).Value.(string), "%")[1], "'")
+
+					if strings.HasPrefix(strings.TrimPrefix(strings.TrimSuffix(left.(string), "'"), "'"), lStr) && strings.HasSuffix(strings.TrimPrefix(strings.TrimSuffix(left.(string), "'"), "'"), rStr) {
+						return true
+					}
+
+				default:
+					return false
+
+				}
+			} else {
+				switch {
+
+				case strings.HasPrefix(pattern.(*parser.Literal).Value.(string), "'%") && strings.HasSuffix(pattern.(*parser.Literal).Value.(string), "%'"):
+					// '%a%'
+					if !strings.Contains(left.(string), strings.TrimPrefix(strings.TrimSuffix(pattern.(*parser.Literal).Value.(string), "%'"), "'%")) {
+						return true
+					}
+				case strings.HasSuffix(pattern.(*parser.Literal).Value.(string), "%'"):
+					// 'a%'
+					if !strings.HasPrefix(left.(string), strings.TrimSuffix(pattern.(*parser.Literal).Value.(string), "%'")) {
+						return true
+					}
+				case strings.HasPrefix(pattern.(*parser.Literal).Value.(string), "'%"):
+					// '%a'
+					if !strings.HasSuffix(left.(string), strings.TrimPrefix(pattern.(*parser.Literal).Value.(string), "'%")) {
+						return true
+					}
+				case len(strings.Split(pattern.(*parser.Literal).Value.(string), "%")) == 2:
+					// 'a%b'
+					lStr := strings.TrimLeft(strings.Split(pattern.(*parser.Literal).Value.(string), "%")[0], "'")
+					rStr := strings.TrimRight(strings.Split(pattern.(*parser.Literal).Value.(string), "%")[1], "'")
+
+					if !strings.HasPrefix(strings.TrimPrefix(strings.TrimSuffix(left.(string), "'"), "'"), lStr) && !strings.HasSuffix(strings.TrimPrefix(strings.TrimSuffix(left.(string), "'"), "'"), rStr) {
+						return true
+					}
+
+				default:
+					return false
+
+				}
+			}
+		}
+	case *parser.ExistsPredicate:
+		// check subquery
+
+		// Pass outer table to exists subquery
+		/*
+			SELECT *
+			FROM users
+			WHERE EXISTS (
+			    SELECT 1
+			    FROM posts
+			    WHERE users.user_id + posts.user_id = 5
+			);
+		*/
+		for _, tbl := range tbls {
+			//condition.Expr.Value.(*parser.SelectStmt).TableExpression.FromClause.Tables = append(condition.Expr.Value.(*parser.SelectStmt).TableExpression.FromClause.Tables, &parser.Table{
+			//	Name: &parser.Identifier{Value: tbl.Name},
+			//})
+
+			// push to start of condition.Expr.Value.(*parser.SelectStmt).TableExpression.FromClause.Tables
+			condition.Expr.Value.(*parser.SelectStmt).TableExpression.FromClause.Tables = append([]*parser.Table{&parser.Table{
+				Name: &parser.Identifier{Value: tbl.Name},
+			}}, condition.Expr.Value.(*parser.SelectStmt).TableExpression.FromClause.Tables...)
+		}
+
+		r, err := ex.executeSelectStmt(condition.Expr.Value.(*parser.SelectStmt), true)
+		if err != nil {
+			return false
+		}
+
+		if not {
+			// if not exists
+			// if there are no results return true
+			if len(r) == 0 {
+				return true
+			} else {
+				return false
+			}
+		}
+
+		// when there is no not, we add to filteredRows
+		if len(r) > 0 {
+
+			// check if any results compare to *filteredRows
+			// if so skip
+			if len(*filteredRows) > 0 {
+				for _, row := range *filteredRows {
+					for _, rr := range r {
+						for k, v := range rr {
+							if row[k] == v {
+								return false
+							} else {
+								if row[k] != v {
+									return false
+								}
+							}
+						}
+
+						*filteredRows = append(*filteredRows, rr)
+						return true
+					}
+
+					return true
+				}
+			} else {
+				*filteredRows = append(*filteredRows, r...)
+				return false
+			}
+
+			return false
+		} else {
+			return false
+		}
+
+	case *parser.ComparisonPredicate:
+
+		left := ex.evaluateValueExpression(condition.Left, rows)
+		right := ex.evaluateValueExpression(condition.Right, rows)
+
+		// check if right is value expression
+		if _, ok := condition.Right.Value.(*parser.ValueExpression); ok {
+
+			// check if right is subquery
+			if _, ok := condition.Right.Value.(*parser.ValueExpression).Value.(*parser.SelectStmt); ok {
+				rows, err := ex.executeSubquery(condition.Right.Value.(*parser.ValueExpression).Value.(*parser.SelectStmt), rows)
+				if err != nil {
+					return false
+				}
+
+				// get first key
+				for k, _ := range rows[0] {
+					right = rows[0][k]
+					break
+				}
+
+			}
+		}
+
+		// a = b COLLATE name compares strings in the collation
+		if name := collationOf(condition); name != "" {
+			l, lok := left.(string)
+			r, rok := right.(string)
+			if lok && rok {
+				coll, err := ex.collation(name)
+				if err != nil {
+					return false
+				}
+
+				return compare(coll.Compare(shared.UnquoteLiteral(l), shared.UnquoteLiteral(r)), condition.Op) != not
+			}
+		}
+
+		switch left.(type) {
+		case int:
+			// Check if right is not int
+			if _, ok := right.(int); !ok {
+				// check if right is nil
+				if right == nil {
+					return false
+				}
+
+				// check if right is string
+				if _, ok := right.(string); ok {
+					return false
+				}
+
+				right = int(right.(uint64))
+
+			}
+		case float64:
+			// Check if right is not float64
+			if _, ok := right.(string); ok {
+				return false
+			}
+
+			if v, ok := right.(uint64); ok {
+				right = float64(v)
+			}
+
+		}
+
+		switch condition.Op {
+		case parser.OP_EQ:
+
+			if !not {
+				return left == right
+			} else {
+				return left != right
+			}
+
+		case parser.OP_NEQ:
+			if !not {
+				return left != right
+			} else {
+				return left == right
+			}
+
+		case parser.OP_LT:
+			if !not {
+				switch left.(type) {
+				case int:
+					return left.(int) < right.(int)
+				case float64:
+					return left.(float64) < right.(float64)
+				case uint64:
+					return left.(uint64) < right.(uint64)
+				case string:
+					// check if right is string
+					if _, ok := right.(string); ok {
+						return left.(string) < right.(string)
+					}
+
+					return false
+				}
+			} else {
+				switch left.(type) {
+				case int:
+					return left.(int) >= right.(int)
+				case float64:
+					return left.(float64) >= right.(float64)
+				case uint64:
+					return left.(uint64) >= right.(uint64)
+				case string:
+
+					// check if right is string
+					if _, ok := right.(string); ok {
+						return left.(string) >= right.(string)
+					}
+
+					return false
+				}
+			}
+		case parser.OP_LTE:
+			if !not {
+				switch left.(type) {
+				case int:
+					return left.(int) <= right.(int)
+				case float64:
+					return left.(float64) <= right.(float64)
+				case uint64:
+					return left.(uint64) <= right.(uint64)
+				case string:
+					// check if right is string
+					if _, ok := right.(string); ok {
+						return left.(string) <= right.(string)
+					}
+
+					return false
+				}
+
+			} else {
+				switch left.(type) {
+				case int:
+					return left.(int) > right.(int)
+				case float64:
+					return left.(float64) > right.(float64)
+				case uint64:
+					return left.(uint64) > right.(uint64)
+				case string:
+					// check if right is string
+					if _, ok := right.(string); ok {
+						return left.(string) > right.(string)
+					}
+
+					return false
+				}
+			}
+		case parser.OP_GT:
+			if !not {
+				switch left.(type) {
+				case int:
+					return left.(int) > right.(int)
+				case float64:
+					return left.(float64) > right.(float64)
+				case uint64:
+					return left.(uint64) > right.(uint64)
+				case string:
+					// check if right is string
+					if _, ok := right.(string); ok {
+						return left.(string) > right.(string)
+					}
+
+					return false
+				}
+			} else {
+
+				switch left.(type) {
+				case int:
+					return left.(int) <= right.(int)
+				case float64:
+					return left.(float64) <= right.(float64)
+				case uint64:
+					return left.(uint64) <= right.(uint64)
+				case string:
+					// check if right is string
+					if _, ok := right.(string); ok {
+						return left.(string) <= right.(string)
+					}
+
+					return false
+				}
+
+			}
+		case parser.OP_GTE:
+			if !not {
+				switch left.(type) {
+				case int:
+					return left.(int) >= right.(int)
+				case float64:
+					return left.(float64) >= right.(float64)
+				case uint64:
+					return left.(uint64) >= right.(uint64)
+				case string:
+					// check if right is string
+					if _, ok := right.(string); ok {
+						return left.(string) >= right.(string)
+					}
+
+					return false
+				}
+			} else {
+				switch left.(type) {
+				case int:
+					return left.(int) < right.(int)
+				case float64:
+					return left.(float64) < right.(float64)
+				case uint64:
+					return left.(uint64) < right.(uint64)
+				case string:
+					// check if right is string
+					if _, ok := right.(string); ok {
+						return left.(string) < right.(string)
+					}
+
+					return false
+				}
+			}
+		}
+	default:
+
+		return false
+
+	}
+
+	return false
+}
+
+// evaluateCaseExpr evaluates a case expression with a where clause
+func (ex *Executor) evaluateCaseExpr(expr *parser.CaseExpr, rows *[]map[string]interface{}) (string, error) {
+	// If there is no where clause, we return true
+	if expr == nil {
+		return "", nil
+	}
+
+	// If there is a where clause, we evaluate the condition
+	return ex.evaluateCaseCondition(expr, rows)
+
+}
+
+// EvaluateCaseCondition evaluates a case condition
+func (ex *Executor) evaluateCaseCondition(expr *parser.CaseExpr, rows *[]map[string]interface{}) (string, error) {
+	// If there is no condition, we return true
+	if expr == nil {
+		return "", nil
+	}
+
+	col := "" // column name of where we will be updating
+
+	// Check first when clause for left column
+	switch expr.WhenClauses[0].Condition.(type) {
+	case *parser.ComparisonPredicate:
+		col = expr.WhenClauses[0].Condition.(*parser.ComparisonPredicate).Left.Value.(*parser.ColumnSpecification).ColumnName.Value
+	case *parser.InPredicate:
+		col = expr.WhenClauses[0].Condition.(*parser.InPredicate).Left.Value.(*parser.ColumnSpecification).ColumnName.Value
+	case *parser.BetweenPredicate:
+		col = expr.WhenClauses[0].Condition.(*parser.BetweenPredicate).Left.Value.(*parser.ColumnSpecification).ColumnName.Value
+	case *parser.LikePredicate:
+		col = expr.WhenClauses[0].Condition.(*parser.LikePredicate).Left.Value.(*parser.ColumnSpecification).ColumnName.Value
+	case *parser.IsPredicate:
+		col = expr.WhenClauses[0].Condition.(*parser.IsPredicate).Left.Value.(*parser.ColumnSpecification).ColumnName.Value
+
+	}
+
+	for _, when := range expr.WhenClauses {
+		if when.Condition != nil {
+			if ex.evaluateCondition(when.Condition, rows, nil, nil) {
+				for i, row := range *rows {
+					for k, _ := range row {
+						if k == col {
+							(*rows)[i][col] = when.Result.(*parser.ValueExpression).Value.(*parser.Literal).Value
+						}
+					}
+				}
+
+			}
+		}
+	}
+
+	return col, nil
+}
+
+// EvaluateValueExpression evaluates a value expression
+func (ex *Executor) evaluateValueExpression(vexpr *parser.ValueExpression, rows *[]map[string]interface{}) interface{} {
+	switch expr := vexpr.Value.(type) {
+	case *parser.CaseExpr:
+		// check if left is column spec
+		col, err := ex.evaluateCaseExpr(expr, rows)
+		if err != nil {
+			return false
+		}
+
+		for _, row := range *rows {
+			for k, v := range row {
+				if k == col {
+					return v
+				}
+			}
+
+		}
+
+	case *shared.GenUUID:
+		return ex.source.GenerateUUID()
+	case *shared.SysDate, *shared.SysTimestamp, *shared.SysTime:
+		return ex.source.Now()
+	case *shared.GenUUIDv7, *parser.RandomFunc:
+		return ex.functionValue(expr, nil)
+	case *parser.HashFunc:
+		return hash(expr.FuncName, ex.evaluateValueExpression(expr.Arg.(*parser.ValueExpression), rows))
+
+	case *parser.UpperFunc:
+		for i, row := range *rows {
+
+			newRow := map[string]interface{}{}
+			for k, v := range row {
+				// trim off the tablename if it exists
+
+				if strings.Contains(k, ".") {
+					newRow[strings.Split(k, ".")[1]] = v
+				} else {
+					newRow[k] = v
+
+				}
+			}
+
+			for k, v := range newRow {
+
+				if k == expr.Arg.(*parser.ValueExpression).Value.(*parser.ColumnSpecification).ColumnName.Value {
+					// check if row value is string
+					if _, ok := v.(string); ok {
+						newRow[k] = strings.ToUpper(v.(string))
+						*rows = append(*rows, newRow)
+						*rows = append((*rows)[:i], (*rows)[i+1:]...)
+						return newRow[k]
+					}
+
+				}
+			}
+
+		}
+	case *parser.LowerFunc:
+		for i, row := range *rows {
+
+			newRow := map[string]interface{}{}
+			for k, v := range row {
+				// trim off the tablename if it exists
+
+				if strings.Contains(k, ".") {
+					newRow[strings.Split(k, ".")[1]] = v
+				} else {
+					newRow[k] = v
+
+				}
+			}
+
+			for k, v := range newRow {
+
+				if k == expr.Arg.(*parser.ValueExpression).Value.(*parser.ColumnSpecification).ColumnName.Value {
+					// check if row value is string
+					if _, ok := v.(string); ok {
+						newRow[k] = strings.ToLower(v.(string))
+						*rows = append(*rows, newRow)
+						*rows = append((*rows)[:i], (*rows)[i+1:]...)
+						return newRow[k]
+					}
+
+				}
+			}
+
+		}
+	case *parser.RoundFunc:
+		for i, row := range *rows {
+
+			newRow := map[string]interface{}{}
+			for k, v := range row {
+				// trim off the tablename if it exists
+
+				if strings.Contains(k, ".") {
+					newRow[strings.Split(k, ".")[1]] = v
+				} else {
+					newRow[k] = v
+
+				}
+			}
+
+			for k, v := range newRow {
+
+				if k == expr.Arg.(*parser.ValueExpression).Value.(*parser.ColumnSpecification).ColumnName.Value {
+					// check if row value is string
+					if _, ok := v.(float64); ok {
+
+						newRow[k] = math.Round(v.(float64))
+						*rows = append(*rows, newRow)
+						*rows = append((*rows)[:i], (*rows)[i+1:]...)
+						return newRow[k]
+					} else if _, ok := v.(int); ok {
+						newRow[k] = math.Round(float64(v.(int)))
+						*rows = append(*rows, newRow)
+						*rows = append((*rows)[:i], (*rows)[i+1:]...)
+						return newRow[k]
+					} else if _, ok := v.(uint64); ok {
+						newRow[k] = math.Round(float64(v.(uint64)))
+						*rows = append(*rows, newRow)
+						*rows = append((*rows)[:i], (*rows)[i+1:]...)
+						return newRow[k]
+					}
+
+				}
+			}
+
+		}
+	case *parser.ReverseFunc:
+		for i, row := range *rows {
+
+			newRow := map[string]interface{}{}
+			for k, v := range row {
+				// trim off the tablename if it exists
+
+				if strings.Contains(k, ".") {
+					newRow[strings.Split(k, ".")[1]] = v
+				} else {
+					newRow[k] = v
+
+				}
+			}
+
+			for k, v := range newRow {
+
+				if k == expr.Arg.(*parser.ValueExpression).Value.(*parser.ColumnSpecification).ColumnName.Value {
+					// check if row value is string
+					if _, ok := v.(string); ok {
+						newRow[k] = shared.ReverseString(v.(string))
+						*rows = append(*rows, newRow)
+						*rows = append((*rows)[:i], (*rows)[i+1:]...)
+						return newRow[k]
+					}
+
+				}
+			}
+		}
+	case *parser.LengthFunc:
+		for i, row := range *rows {
+
+			newRow := map[string]interface{}{}
+			for k, v := range row {
+				// trim off the tablename if it exists
+
+				if strings.Contains(k, ".") {
+					newRow[strings.Split(k, ".")[1]] = v
+				} else {
+					newRow[k] = v
+
+				}
+			}
+
+			for k, v := range newRow {
+
+				if k == expr.Arg.(*parser.ValueExpression).Value.(*parser.ColumnSpecification).ColumnName.Value {
+					// check if row value is string
+					if _, ok := v.(string); ok {
+						newRow[k] = utf8.RuneCountInString(v.(string)) - 2
+						*rows = append(*rows, newRow)
+						*rows = append((*rows)[:i], (*rows)[i+1:]...)
+						return newRow[k]
+					}
+
+				}
+			}
+
+		}
+
+	case *parser.PositionFunc:
+		for i, row := range *rows {
+
+			newRow := map[string]interface{}{}
+			for k, v := range row {
+				// trim off the tablename if it exists
+
+				if strings.Contains(k, ".") {
+					newRow[strings.Split(k, ".")[1]] = v
+				} else {
+					newRow[k] = v
+
+				}
+			}
+
+			for k, v := range newRow {
+
+				if k == expr.In.(*parser.ValueExpression).Value.(*parser.ColumnSpecification).ColumnName.Value {
+					// check if row value is string
+					if _, ok := v.(string); ok {
+						newRow[k] = (shared.RuneIndex(v.(string), strings.TrimSuffix(strings.TrimPrefix(expr.Arg.(*parser.ValueExpression).Value.(*parser.Literal).Value.(string), "'"), "'"))) + 1
+
+						*rows = append(*rows, newRow)
+						*rows = append((*rows)[:i], (*rows)[i+1:]...)
+						return newRow[k]
+					}
+
+				}
+			}
+
+		}
+	case *parser.SubstrFunc:
+		for i, row := range *rows {
+
+			newRow := map[string]interface{}{}
+			for k, v := range row {
+				// trim off the tablename if it exists
+
+				if strings.Contains(k, ".") {
+					newRow[strings.Split(k, ".")[1]] = v
+				} else {
+					newRow[k] = v
+
+				}
+			}
+
+			for k, v := range newRow {
+
+				if k == expr.Arg.(*parser.ValueExpression).Value.(*parser.ColumnSpecification).ColumnName.Value {
+					// check if row value is string
+					if _, ok := v.(string); ok {
+						start := int(expr.StartPos.Value.(uint64))
+
+						if start == 1 {
+							start = 0
+						}
+
+						end := int(expr.Length.Value.(uint64))
+
+						newRow[k] = string([]rune(strings.TrimPrefix(strings.TrimSuffix(v.(string), "'"), "'"))[start:end])
+
+						newRow[k] = fmt.Sprintf("'%s'", newRow[k])
+
+						*rows = append(*rows, newRow)
+						*rows = append((*rows)[:i], (*rows)[i+1:]...)
+						return newRow[k]
 					}
-				case strings.HasPrefix(pattern.(*parser.Literal).Value.(string), "'%"):
-					// '%a'
-					if strings.HasSuffix(left.(string), strings.TrimPrefix(pattern.(*parser.Literal).Value.(string), "'%")) {
-						return true
+
+				}
+			}
+
+		}
+	case *parser.ConcatFunc:
+		for i, row := range *rows {
+
+			newRow := map[string]interface{}{}
+			for k, v := range row {
+				// trim off the tablename if it exists
+
+				if strings.Contains(k, ".") {
+					newRow[strings.Split(k, ".")[1]] = v
+				} else {
+					newRow[k] = v
+
+				}
+			}
+
+			for k, v := range newRow {
+
+				if k == expr.Args[0].(*parser.ValueExpression).Value.(*parser.ColumnSpecification).ColumnName.Value {
+					// check if row value is string
+					if _, ok := v.(string); ok {
+						for _, arg := range expr.Args[1:] {
+							if _, ok := arg.(*parser.ValueExpression).Value.(*parser.ColumnSpecification); ok {
+								var newStr []string
+								newStr = append(newStr, strings.TrimSuffix(strings.TrimPrefix(v.(string), "'"), "'"))
+								newStr = append(newStr, strings.TrimSuffix(strings.TrimPrefix(newRow[arg.(*parser.ValueExpression).Value.(*parser.ColumnSpecification).ColumnName.Value].(string), "'"), "'"))
+								newRow[k] = fmt.Sprintf("'%s'", strings.Join(newStr, ""))
+							} else {
+								var newStr []string
+								newStr = append(newStr, strings.TrimSuffix(strings.TrimPrefix(v.(string), "'"), "'"))
+								newStr = append(newStr, strings.TrimSuffix(strings.TrimPrefix(arg.(*parser.ValueExpression).Value.(*parser.Literal).Value.(string), "'"), "'"))
+								newRow[k] = fmt.Sprintf("'%s'", strings.Join(newStr, ""))
+							}
+						}
+
+						*rows = append(*rows, newRow)
+						*rows = append((*rows)[:i], (*rows)[i+1:]...)
+						return newRow[k]
 					}
-				case len(strings.Split(pattern.(*parser.Literal).Value.(string), "%")) == 2:
-					// 'a%b'
-					lStr := strings.TrimLeft(strings.Split(pattern.(*parser.Literal).Value.(string), "%")[0], "'")
-					rStr := strings.TrimRight(strings.Split(pattern.(*parser.Literal).Value.(string), "%")[1], "'")
 
-					if strings.HasPrefix(strings.TrimPrefix(strings.TrimSuffix(left.(string), "'"), "'"), lStr) && strings.HasSuffix(strings.TrimPrefix(strings.TrimSuffix(left.(string), "'"), "'"), rStr) {
-						return true
-					}
+				}
+			}
+
+		}
+	case *parser.TrimFunc:
+		for i, row := range *rows {
+
+			newRow := map[string]interface{}{}
+			for k, v := range row {
+				// trim off the tablename if it exists
+
+				if strings.Contains(k, ".") {
+					newRow[strings.Split(k, ".")[1]] = v
+				} else {
+					newRow[k] = v
+
+				}
+			}
+
+			for k, v := range newRow {
+
+				if k == expr.Arg.(*parser.ValueExpression).Value.(*parser.ColumnSpecification).ColumnName.Value {
+					// check if row value is string
+					if _, ok := v.(string); ok {
+						newRow[k] = fmt.Sprintf("'%s'", strings.TrimSpace(strings.TrimSuffix(strings.TrimPrefix(v.(string), "'"), "'")))
+						*rows = append(*rows, newRow)
+						*rows = append((*rows)[:i], (*rows)[i+1:]...)
+						return newRow[k]
+					}
+
+				}
+			}
+
+		}
+
+	case *parser.CoalesceFunc:
+		for i, row := range *rows {
+
+			newRow := map[string]interface{}{}
+			for k, v := range row {
+				// trim off the tablename if it exists
+
+				if strings.Contains(k, ".") {
+					newRow[strings.Split(k, ".")[1]] = v
+				} else {
+					newRow[k] = v
+
+				}
+			}
+
+			for k, v := range newRow {
+
+				if k == expr.Args[0].(*parser.ValueExpression).Value.(*parser.ColumnSpecification).ColumnName.Value {
+					// Value should be nil
+					if v == nil {
+						newRow[k] = expr.Value.(*parser.ValueExpression).Value.(*parser.Literal).Value
+						*rows = append(*rows, newRow)
+						*rows = append((*rows)[:i], (*rows)[i+1:]...)
+						return newRow[k]
+					}
+				}
+			}
+
+		}
+	case *parser.CastFunc:
+		for i, row := range *rows {
+
+			newRow := map[string]interface{}{}
+			for k, v := range row {
+				// trim off the tablename if it exists
+
+				if strings.Contains(k, ".") {
+					newRow[strings.Split(k, ".")[1]] = v
+				} else {
+					newRow[k] = v
+
+				}
+			}
+
+			for k, v := range newRow {
+
+				if k == expr.Expr.(*parser.ValueExpression).Value.(*parser.ColumnSpecification).ColumnName.Value {
+					switch expr.DataType.Value {
+					case "INT", "INTEGER", "SMALLINT":
+						// check if row value is string
+						if _, ok := v.(string); ok {
+							// Convert string to int
+							intVal, err := strconv.Atoi(v.(string))
+							if err != nil {
+								return nil
+							}
+
+							newRow[k] = intVal
+
+							*rows = append(*rows, newRow)
+
+							*rows = append((*rows)[:i], (*rows)[i+1:]...)
+
+							return newRow[k]
+
+						}
+					case "FLOAT", "DOUBLE", "DECIMAL", "REAL", "NUMERIC":
+						// check if row value is string
+						if _, ok := v.(string); ok {
+							// Convert string to float
+							floatVal, err := strconv.ParseFloat(v.(string), 64)
+							if err != nil {
+								return nil
+							}
+
+							newRow[k] = floatVal
+
+							*rows = append(*rows, newRow)
+
+							*rows = append((*rows)[:i], (*rows)[i+1:]...)
+
+							return newRow[k]
+						}
+					case "DATE":
+						// check if row value is string
+						if _, ok := v.(string); ok {
+							// Convert string to time.Time
+							dateVal, err := time.Parse("2006-01-02", v.(string))
+							if err != nil {
+								return nil
+							}
+
+							newRow[k] = dateVal
+
+							*rows = append(*rows, newRow)
+
+							*rows = append((*rows)[:i], (*rows)[i+1:]...)
+
+							return newRow[k]
+						}
+					case "DATETIME", "TIMESTAMP":
+						// check if row value is string
+						if _, ok := v.(string); ok {
+							// Convert string to time.Time
+							dateVal, err := time.Parse("2006-01-02 15:04:05", v.(string))
+							if err != nil {
+								return nil
+							}
+
+							newRow[k] = dateVal
+
+							*rows = append(*rows, newRow)
+
+							*rows = append((*rows)[:i], (*rows)[i+1:]...)
+
+							return newRow[k]
+
+						}
+					case "TIME":
+						// check if row value is string
+						if _, ok := v.(string); ok {
+							// Convert string to time.Time
+							dateVal, err := time.Parse("15:04:05", v.(string))
+							if err != nil {
+								return nil
+							}
 
-				default:
-					return false
+							newRow[k] = dateVal
 
-				}
-			} else {
-				switch {
+							*rows = append(*rows, newRow)
 
-				case strings.HasPrefix(pattern.(*parser.Literal).Value.(string), "'%") && strings.HasSuffix(pattern.(*parser.Literal).Value.(string), "%'"):
-					// '%a%'
-					if !strings.Contains(left.(string), strings.TrimPrefix(strings.TrimSuffix(pattern.(*parser.Literal).Value.(string), "%'"), "'%")) {
-						return true
-					}
-				case strings.HasSuffix(pattern.(*parser.Literal).Value.(string), "%'"):
-					// 'a%'
-					if !strings.HasPrefix(left.(string), strings.TrimSuffix(pattern.(*parser.Literal).Value.(string), "%'")) {
-						return true
-					}
-				case strings.HasPrefix(pattern.(*parser.Literal).Value.(string), "'%"):
-					// '%a'
-					if !strings.HasSuffix(left.(string), strings.TrimPrefix(pattern.(*parser.Literal).Value.(string), "'%")) {
-						return true
-					}
-				case len(strings.Split(pattern.(*parser.Literal).Value.(string), "%")) == 2:
-					// 'a%b'
-					lStr := strings.TrimLeft(strings.Split(pattern.(*parser.Literal).Value.(string), "%")[0], "'")
-					rStr := strings.TrimRight(strings.Split(pattern.(*parser.Literal).Value.(string), "%")[1], "'")
+							*rows = append((*rows)[:i], (*rows)[i+1:]...)
 
-					if !strings.HasPrefix(strings.TrimPrefix(strings.TrimSuffix(left.(string), "'"), "'"), lStr) && !strings.HasSuffix(strings.TrimPrefix(strings.TrimSuffix(left.(string), "'"), "'"), rStr) {
-						return true
+							return newRow[k]
+						}
+					case "BOOL", "BOOLEAN":
+						// check if row value is string
+						if _, ok := v.(string); ok {
+							if v.(string) == "T" || v.(string) == "t" {
+								v = "true"
+							} else if v.(string) == "F" || v.(string) == "f" {
+								v = "false"
+							} else if v.(string) == "'true'" {
+								v = "true"
+							} else if v.(string) == "'false'" {
+								v = "false"
+							}
+
+							// Convert string to bool
+							boolVal, err := strconv.ParseBool(v.(string))
+							if err != nil {
+								return nil
+							}
+
+							newRow[k] = boolVal
+
+							*rows = append(*rows, newRow)
+
+							*rows = append((*rows)[:i], (*rows)[i+1:]...)
+
+							return newRow[k]
+
+						}
 					}
 
-				default:
-					return false
+				}
+			}
+
+		}
+
+	case *parser.Literal:
+
+		return expr.Value
+
+	case *parser.ColumnSpecification:
+
+		if expr.TableName == nil {
+			for i, row := range *rows {
+				newRow := map[string]interface{}{}
+				for k, v := range row {
+					// trim off the tablename if it exists
+
+					if strings.Contains(k, ".") {
+						newRow[strings.Split(k, ".")[1]] = v
+					} else {
+						newRow[k] = v
 
+					}
 				}
+				*rows = append(*rows, newRow)
+				*rows = append((*rows)[:i], (*rows)[i+1:]...)
 			}
 		}
-	case *parser.ExistsPredicate:
-		// check subquery
+		for _, row := range *rows {
+			// check if tablename.columnname exists
+			if expr.TableName != nil {
+				if _, ok := row[fmt.Sprintf("%v.%v", expr.TableName.Value, expr.ColumnName.Value)]; ok {
+					return row[fmt.Sprintf("%v.%v", expr.TableName.Value, expr.ColumnName.Value)]
+				}
+			}
+			if _, ok := row[expr.ColumnName.Value]; ok {
 
-		// Pass outer table to exists subquery
-		/*
-			SELECT *
-			FROM users
-			WHERE EXISTS (
-			    SELECT 1
-			    FROM posts
-			    WHERE users.user_id + posts.user_id = 5
-			);
-		*/
-		for _, tbl := range tbls {
-			//condition.Expr.Value.(*parser.SelectStmt).TableExpression.FromClause.Tables = append(condition.Expr.Value.(*parser.SelectStmt).TableExpression.FromClause.Tables, &parser.Table{
-			//	Name: &parser.Identifier{Value: tbl.Name},
-			//})
+				return row[expr.ColumnName.Value]
+			}
 
-			// push to start of condition.Expr.Value.(*parser.SelectStmt).TableExpression.FromClause.Tables
-			condition.Expr.Value.(*parser.SelectStmt).TableExpression.FromClause.Tables = append([]*parser.Table{&parser.Table{
-				Name: &parser.Identifier{Value: tbl.Name},
-			}}, condition.Expr.Value.(*parser.SelectStmt).TableExpression.FromClause.Tables...)
 		}
 
-		r, err := ex.executeSelectStmt(condition.Expr.Value.(*parser.SelectStmt), true)
+		return nil
+
+	case *parser.BinaryExpression:
+		var val interface{}
+		err := evaluateBinaryExpression(expr, &val, rows)
 		if err != nil {
-			return false
+			return nil
 		}
 
-		if not {
-			// if not exists
-			// if there are no results return true
-			if len(r) == 0 {
-				return true
-			} else {
-				return false
-			}
+		return val
+	case *parser.Variable:
+		// check if variable exists
+		if _, ok := ex.vars[expr.VariableName.Value]; ok {
+			return ex.vars[expr.VariableName.Value].Value
 		}
+	}
 
-		// when there is no not, we add to filteredRows
-		if len(r) > 0 {
+	return nil
+}
 
-			// check if any results compare to *filteredRows
-			// if so skip
-			if len(*filteredRows) > 0 {
-				for _, row := range *filteredRows {
-					for _, rr := range r {
-						for k, v := range rr {
-							if row[k] == v {
-								return false
-							} else {
-								if row[k] != v {
-									return false
-								}
-							}
-						}
+// functionName returns the column a function of the select list is named by without an alias, random for RANDOM()
+func functionName(expr interface{}) string {
+	switch expr := expr.(type) {
+	case *parser.RandomFunc:
+		return "random"
+	case *shared.GenUUIDv7:
+		return "uuid_v7"
+	case *parser.HashFunc:
+		return strings.ToLower(expr.FuncName)
+	}
 
-						*filteredRows = append(*filteredRows, rr)
-						return true
-					}
+	return ""
+}
 
-					return true
+// functionValue returns the value of RANDOM, UUID_V7, MD5 or SHA256 for a row, the row is nil if the function has no column argument
+func (ex *Executor) functionValue(expr interface{}, row map[string]interface{}) interface{} {
+	switch expr := expr.(type) {
+	case *parser.RandomFunc:
+		return ex.source.Random()
+	case *shared.GenUUIDv7:
+		return fmt.Sprintf("'%s'", ex.source.GenerateUUIDv7())
+	case *parser.HashFunc:
+		switch arg := expr.Arg.(*parser.ValueExpression).Value.(type) {
+		case *parser.Literal:
+			return hash(expr.FuncName, arg.Value)
+		case *parser.ColumnSpecification:
+			if arg.TableName != nil {
+				if v, ok := row[arg.TableName.Value+"."+arg.ColumnName.Value]; ok {
+					return hash(expr.FuncName, v)
 				}
-			} else {
-				*filteredRows = append(*filteredRows, r...)
-				return false
 			}
 
-			return false
-		} else {
-			return false
+			return hash(expr.FuncName, row[arg.ColumnName.Value])
 		}
+	}
 
-	case *parser.ComparisonPredicate:
+	return nil
+}
 
-		left := ex.evaluateValueExpression(condition.Left, rows)
-		right := ex.evaluateValueExpression(condition.Right, rows)
+// hash returns the hex digest of a value as a string, the digest of a string is of its text without quotes
+func hash(funcName string, value interface{}) interface{} {
+	if value == nil {
+		return nil
+	}
 
-		// check if right is value expression
-		if _, ok := condition.Right.Value.(*parser.ValueExpression); ok {
+	text := fmt.Sprintf("%v", value)
+	if str, ok := value.(string); ok {
+		text = shared.UnquoteLiteral(str)
+	}
 
-			// check if right is subquery
-			if _, ok := condition.Right.Value.(*parser.ValueExpression).Value.(*parser.SelectStmt); ok {
-				rows, err := ex.executeSelectStmt(condition.Right.Value.(*parser.ValueExpression).Value.(*parser.SelectStmt), true)
-				if err != nil {
-					return false
-				}
+	if funcName == "MD5" {
+		return fmt.Sprintf("'%x'", md5.Sum([]byte(text)))
+	}
 
-				// get first key
-				for k, _ := range rows[0] {
-					right = rows[0][k]
-					break
+	return fmt.Sprintf("'%x'", sha256.Sum256([]byte(text)))
+}
+
+// checksum is the checksum of the rows of a table or of a chunk of a table
+type checksum struct {
+	rows int    // Amount of rows
+	sum  uint64 // Sum of the hashes of the rows, the same whatever order the rows are in
+}
+
+// describeTable returns the metadata of a table as a single row, its columns in name order, keys and indexes
+func describeTable(tbl *catalog.Table) map[string]interface{} {
+	columns := make([]map[string]interface{}, 0, len(tbl.TableSchema.ColumnDefinitions))
+	primaryKey := make([]string, 0)
+	foreignKeys := make([]map[string]interface{}, 0)
+
+	for _, name := range describedColumns(tbl) {
+		colDef := tbl.TableSchema.ColumnDefinitions[name]
+
+		var references interface{}
+		if colDef.References != nil {
+			references = map[string]interface{}{"Table": colDef.References.TableName, "Column": colDef.References.ColumnName}
+
+			foreignKeys = append(foreignKeys, map[string]interface{}{
+				"Name":             tbl.ConstraintName(name, catalog.CONSTRAINT_FOREIGN_KEY),
+				"Column":           name,
+				"ReferencedTable":  colDef.References.TableName,
+				"ReferencedColumn": colDef.References.ColumnName,
+				"Valid":            !slices.Contains(tbl.TableSchema.NotValid, tbl.ConstraintName(name, catalog.CONSTRAINT_FOREIGN_KEY)),
+			})
+		}
+
+		// A PRIMARY KEY column is a sequence, there is one per table
+		if colDef.Sequence {
+			primaryKey = append(primaryKey, name)
+		}
+
+		columns = append(columns, map[string]interface{}{
+			"Name":       name,
+			"Type":       columnType(colDef),
+			"DataType":   strings.ToUpper(colDef.DataType),
+			"Length":     colDef.Length,
+			"Precision":  colDef.Precision,
+			"Scale":      colDef.Scale,
+			"Nullable":   !colDef.NotNull,
+			"Default":    columnDefault(colDef),
+			"PrimaryKey": colDef.Sequence,
+			"Unique":     colDef.Unique,
+			"Sequence":   colDef.Sequence,
+			"Check":      colDef.Check != nil,
+			"References": references,
+		})
+	}
+
+	indexes := tbl.GetIndexes()
+	sort.Slice(indexes, func(i, j int) bool { return indexes[i].Name < indexes[j].Name })
+
+	describedIndexes := make([]map[string]interface{}, len(indexes))
+	for i, idx := range indexes {
+		describedIndexes[i] = map[string]interface{}{
+			"Name":    idx.Name,
+			"Columns": idx.Columns,
+			"Unique":  idx.Unique,
+			"Visible": !idx.Invisible,
+		}
+	}
+
+	return map[string]interface{}{
+		"Table":           tbl.Name,
+		"Columns":         columns,
+		"PrimaryKey":      primaryKey,
+		"ForeignKeys":     foreignKeys,
+		"Indexes":         describedIndexes,
+		"Compressed":      tbl.Compress,
+		"Encrypted":       tbl.Encrypt,
+		"SystemVersioned": tbl.TableSchema.SystemVersioned,
+	}
+}
+
+// describeColumns returns a row per column of a table in name order, the table output of DESCRIBE
+// Key is PRI for the primary key, UNI for a unique column and MUL for a column an index starts with
+func describeColumns(tbl *catalog.Table) []map[string]interface{} {
+	rows := make([]map[string]interface{}, 0, len(tbl.TableSchema.ColumnDefinitions))
+
+	for _, name := range describedColumns(tbl) {
+		colDef := tbl.TableSchema.ColumnDefinitions[name]
+
+		nullable := "YES"
+		if colDef.NotNull {
+			nullable = "NO"
+		}
+
+		key := ""
+		switch {
+		case colDef.Sequence:
+			key = "PRI"
+		case colDef.Unique:
+			key = "UNI"
+		default:
+			for _, idx := range tbl.GetIndexes() {
+				if len(idx.Columns) > 0 && idx.Columns[0] == name {
+					key = "MUL"
 				}
+			}
+		}
+
+		references := ""
+		if colDef.References != nil {
+			references = colDef.References.TableName + "(" + colDef.References.ColumnName + ")"
+		}
+
+		defaultValue := ""
+		if d := columnDefault(colDef); d != nil {
+			defaultValue = d.(string)
+		}
+
+		rows = append(rows, map[string]interface{}{
+			"Table":      tbl.Name,
+			"Column":     name,
+			"Type":       columnType(colDef),
+			"Nullable":   nullable,
+			"Default":    defaultValue,
+			"Key":        key,
+			"References": references,
+		})
+	}
+
+	return rows
+}
+
+// describedColumns returns the columns of a table in name order, a table keeps no order of its columns
+func describedColumns(tbl *catalog.Table) []string {
+	columns := make([]string, 0, len(tbl.TableSchema.ColumnDefinitions))
+	for name := range tbl.TableSchema.ColumnDefinitions {
+		columns = append(columns, name)
+	}
+
+	sort.Strings(columns)
+
+	return columns
+}
+
+// columnType returns the data type of a column as written in CREATE TABLE, i.e CHAR(50) or DECIMAL(10,2)
+func columnType(colDef *catalog.ColumnDefinition) string {
+	dataType := strings.ToUpper(colDef.DataType)
+
+	switch {
+	case colDef.Precision > 0:
+		return fmt.Sprintf("%s(%d,%d)", dataType, colDef.Precision, colDef.Scale)
+	case colDef.Length > 0:
+		return fmt.Sprintf("%s(%d)", dataType, colDef.Length)
+	}
+
+	return dataType
+}
+
+// columnDefault returns the default of a column as written in CREATE TABLE, nil if the column has none
+func columnDefault(colDef *catalog.ColumnDefinition) interface{} {
+	switch d := colDef.Default.(type) {
+	case nil:
+		return nil
+	case *shared.SysDate:
+		return "SYS_DATE"
+	case *shared.SysTime:
+		return "SYS_TIME"
+	case *shared.SysTimestamp:
+		return "SYS_TIMESTAMP"
+	case *shared.GenUUID:
+		return "GENERATE_UUID"
+	case *shared.GenUUIDv7:
+		return "UUID_V7"
+	case *parser.Literal:
+		return fmt.Sprintf("%v", d.Value)
+	}
+
+	return fmt.Sprintf("%v", colDef.Default)
+}
+
+// applyMigration applies the statements of a migration file to the database selected and records the migration
+// The statements are applied as a whole, if one fails those applied before it are undone in reverse order.
+// A migration applied before is not applied again, unless its file changed which is an error
+func (ex *Executor) applyMigration(s *parser.ApplyMigrationStmt) error {
+	name, file := s.Name.Value.(string), s.File.Value.(string)
+
+	filename, err := migration.Path(ex.aria.Config.DataDir, file)
+	if err != nil {
+		return err
+	}
 
-			}
-		}
+	m, err := migration.Read(filename)
+	if err != nil {
+		return err
+	}
 
-		switch left.(type) {
-		case int:
-			// Check if right is not int
-			if _, ok := right.(int); !ok {
-				// check if right is nil
-				if right == nil {
-					return false
-				}
+	db := ex.ch.Database
 
-				// check if right is string
-				if _, ok := right.(string); ok {
-					return false
-				}
+	db.MigrationsLock.Lock()
+	defer db.MigrationsLock.Unlock()
 
-				right = int(right.(uint64))
+	applied, err := db.GetMigrations()
+	if err != nil {
+		return err
+	}
 
-			}
-		case float64:
-			// Check if right is not float64
-			if _, ok := right.(string); ok {
-				return false
-			}
+	for _, a := range applied {
+		if a.Name != name {
+			continue
+		}
 
-			right = float64(right.(uint64))
+		if a.Checksum != m.Checksum {
+			return fmt.Errorf("migration %s was applied from a different file, checksum %s", name, a.Checksum)
+		}
+
+		return ex.migrationResult(a, "already applied")
+	}
 
+	// Every statement must be one that can be undone before any is applied
+	for i, stmt := range m.Statements {
+		_, err = migration.Undo(db, stmt)
+		if err != nil {
+			return fmt.Errorf("statement %d: %s", i+1, err.Error())
 		}
+	}
 
-		switch condition.Op {
-		case parser.OP_EQ:
+	// Append to wal
+	err = ex.appendWAL(s)
+	if err != nil {
+		return err
+	}
 
-			if !not {
-				return left == right
-			} else {
-				return left != right
-			}
+	var undo []parser.Statement
 
-		case parser.OP_NEQ:
-			if !not {
-				return left != right
-			} else {
-				return left == right
+	// rollback undoes the statements applied so far
+	rollback := func(cause error) error {
+		for i := len(undo) - 1; i >= 0; i-- {
+			err := ex.Execute(undo[i])
+			if err != nil {
+				return fmt.Errorf("%s, undoing the migration failed: %s", cause.Error(), err.Error())
 			}
+		}
 
-		case parser.OP_LT:
-			if !not {
-				switch left.(type) {
-				case int:
-					return left.(int) < right.(int)
-				case float64:
-					return left.(float64) < right.(float64)
-				case uint64:
-					return left.(uint64) < right.(uint64)
-				case string:
-					// check if right is string
-					if _, ok := right.(string); ok {
-						return left.(string) < right.(string)
-					}
+		return cause
+	}
 
-					return false
-				}
-			} else {
-				switch left.(type) {
-				case int:
-					return left.(int) >= right.(int)
-				case float64:
-					return left.(float64) >= right.(float64)
-				case uint64:
-					return left.(uint64) >= right.(uint64)
-				case string:
+	for i, stmt := range m.Statements {
+		u, _ := migration.Undo(db, stmt)
 
-					// check if right is string
-					if _, ok := right.(string); ok {
-						return left.(string) >= right.(string)
-					}
+		err = ex.Execute(stmt)
+		if err != nil {
+			return rollback(fmt.Errorf("statement %d: %s", i+1, err.Error()))
+		}
 
-					return false
-				}
-			}
-		case parser.OP_LTE:
-			if !not {
-				switch left.(type) {
-				case int:
-					return left.(int) <= right.(int)
-				case float64:
-					return left.(float64) <= right.(float64)
-				case uint64:
-					return left.(uint64) <= right.(uint64)
-				case string:
-					// check if right is string
-					if _, ok := right.(string); ok {
-						return left.(string) <= right.(string)
-					}
+		if u != nil {
+			undo = append(undo, u)
+		}
+	}
 
-					return false
-				}
+	record := &catalog.SchemaMigration{
+		Name:       name,
+		File:       file,
+		Checksum:   m.Checksum,
+		Statements: len(m.Statements),
+		AppliedBy:  ex.ch.User.Username,
+		AppliedAt:  ex.source.Now(),
+	}
 
-			} else {
-				switch left.(type) {
-				case int:
-					return left.(int) > right.(int)
-				case float64:
-					return left.(float64) > right.(float64)
-				case uint64:
-					return left.(uint64) > right.(uint64)
-				case string:
-					// check if right is string
-					if _, ok := right.(string); ok {
-						return left.(string) > right.(string)
-					}
+	err = db.RecordMigration(record)
+	if err != nil {
+		return rollback(err)
+	}
 
-					return false
-				}
-			}
-		case parser.OP_GT:
-			if !not {
-				switch left.(type) {
-				case int:
-					return left.(int) > right.(int)
-				case float64:
-					return left.(float64) > right.(float64)
-				case uint64:
-					return left.(uint64) > right.(uint64)
-				case string:
-					// check if right is string
-					if _, ok := right.(string); ok {
-						return left.(string) > right.(string)
-					}
+	return ex.migrationResult(record, "applied")
+}
 
-					return false
-				}
-			} else {
+// migrationResult formats a migration and whether it was applied as the result set
+func (ex *Executor) migrationResult(m *catalog.SchemaMigration, status string) error {
+	var err error
 
-				switch left.(type) {
-				case int:
-					return left.(int) <= right.(int)
-				case float64:
-					return left.(float64) <= right.(float64)
-				case uint64:
-					return left.(uint64) <= right.(uint64)
-				case string:
-					// check if right is string
-					if _, ok := right.(string); ok {
-						return left.(string) <= right.(string)
-					}
+	results := []map[string]interface{}{{
+		"Version":    m.Version,
+		"Name":       m.Name,
+		"Checksum":   m.Checksum,
+		"Statements": m.Statements,
+		"Status":     status,
+	}}
 
-					return false
-				}
+	if !ex.json {
+		ex.ResultSetBuffer = shared.CreateTableByteArray(results, shared.GetHeaders(results, true))
+	} else {
+		ex.ResultSetBuffer, err = shared.CreateJSONByteArray(results)
+		if err != nil {
+			return err
+		}
+	}
 
-			}
-		case parser.OP_GTE:
-			if !not {
-				switch left.(type) {
-				case int:
-					return left.(int) >= right.(int)
-				case float64:
-					return left.(float64) >= right.(float64)
-				case uint64:
-					return left.(uint64) >= right.(uint64)
-				case string:
-					// check if right is string
-					if _, ok := right.(string); ok {
-						return left.(string) >= right.(string)
-					}
+	return nil
+}
 
-					return false
-				}
-			} else {
-				switch left.(type) {
-				case int:
-					return left.(int) < right.(int)
-				case float64:
-					return left.(float64) < right.(float64)
-				case uint64:
-					return left.(uint64) < right.(uint64)
-				case string:
-					// check if right is string
-					if _, ok := right.(string); ok {
-						return left.(string) < right.(string)
-					}
+// copyEscaper escapes the backslashes, tabs and line breaks of a value of the COPY text format
+var copyEscaper = strings.NewReplacer("\\", "\\\\", "\n", "\\n", "\r", "\\r", "\t", "\\t")
 
-					return false
-				}
-			}
-		}
-	default:
+// copyUnescaper unescapes a value of the COPY text format
+var copyUnescaper = strings.NewReplacer("\\\\", "\\", "\\n", "\n", "\\r", "\r", "\\t", "\t")
 
-		return false
+// CopyOut writes the rows of a table or query to w in the COPY text format, a line per row with the values separated by tabs
+// NULL is written \N, the backslashes, tabs and line breaks of values are escaped.  The amount of rows written is returned
+func (ex *Executor) CopyOut(stmt *parser.CopyStmt, w io.Writer) (int, error) {
+	ex.rows = 0
 
+	if stmt.From {
+		return 0, errors.New("expected COPY ... TO STDOUT")
 	}
 
-	return false
-}
+	// In cluster mode a follower only serves reads while it is close enough to the leader
+	if ex.aria != nil && ex.aria.Replicator != nil && !ex.recover {
+		err := ex.aria.Replicator.CheckRead()
+		if err != nil {
+			return 0, err
+		}
+	}
 
-// evaluateCaseExpr evaluates a case expression with a where clause
-func (ex *Executor) evaluateCaseExpr(expr *parser.CaseExpr, rows *[]map[string]interface{}) (string, error) {
-	// If there is no where clause, we return true
-	if expr == nil {
-		return "", nil
+	if ex.ch.Database == nil {
+		return 0, errors.New("no database selected")
 	}
 
-	// If there is a where clause, we evaluate the condition
-	return ex.evaluateCaseCondition(expr, rows)
+	out := bufio.NewWriterSize(w, COPY_BUFFER_SIZE)
 
-}
+	write := func(row map[string]interface{}, columns []string, types map[string]string) error {
+		values := make([]string, len(columns))
+		for i, column := range columns {
+			values[i] = copyText(row[column], types[column])
+		}
 
-// EvaluateCaseCondition evaluates a case condition
-func (ex *Executor) evaluateCaseCondition(expr *parser.CaseExpr, rows *[]map[string]interface{}) (string, error) {
-	// If there is no condition, we return true
-	if expr == nil {
-		return "", nil
+		_, err := out.WriteString(strings.Join(values, "\t") + "\n")
+		return err
 	}
 
-	col := "" // column name of where we will be updating
+	if stmt.Query != nil {
+		// Privileges are checked by the select
+		rows, err := ex.executeSelectStmt(stmt.Query, true)
+		if err != nil {
+			return 0, err
+		}
 
-	// Check first when clause for left column
-	switch expr.WhenClauses[0].Condition.(type) {
-	case *parser.ComparisonPredicate:
-		col = expr.WhenClauses[0].Condition.(*parser.ComparisonPredicate).Left.Value.(*parser.ColumnSpecification).ColumnName.Value
-	case *parser.InPredicate:
-		col = expr.WhenClauses[0].Condition.(*parser.InPredicate).Left.Value.(*parser.ColumnSpecification).ColumnName.Value
-	case *parser.BetweenPredicate:
-		col = expr.WhenClauses[0].Condition.(*parser.BetweenPredicate).Left.Value.(*parser.ColumnSpecification).ColumnName.Value
-	case *parser.LikePredicate:
-		col = expr.WhenClauses[0].Condition.(*parser.LikePredicate).Left.Value.(*parser.ColumnSpecification).ColumnName.Value
-	case *parser.IsPredicate:
-		col = expr.WhenClauses[0].Condition.(*parser.IsPredicate).Left.Value.(*parser.ColumnSpecification).ColumnName.Value
+		columns := shared.GetColumns(rows)
+
+		for _, row := range rows {
+			err = write(row, columns, nil)
+			if err != nil {
+				return ex.rows, err
+			}
+
+			ex.rows++
+		}
+
+		err = out.Flush()
+		if err != nil {
+			return ex.rows, err
+		}
 
+		return ex.rows, ex.copied()
 	}
 
-	for _, when := range expr.WhenClauses {
-		if when.Condition != nil {
-			if ex.evaluateCondition(when.Condition, rows, nil, nil) {
-				for i, row := range *rows {
-					for k, _ := range row {
-						if k == col {
-							(*rows)[i][col] = when.Result.(*parser.ValueExpression).Value.(*parser.Literal).Value
-						}
-					}
-				}
+	tbl, columns, err := ex.copyTable(stmt)
+	if err != nil {
+		return 0, err
+	}
 
-			}
-		}
+	types := make(map[string]string)
+	for _, column := range columns {
+		types[column] = strings.ToUpper(tbl.TableSchema.ColumnDefinitions[column].DataType)
 	}
 
-	return col, nil
-}
+	// Rows are written as they are read, a table is never held in memory
+	iter := tbl.NewIterator()
+	for iter.Valid() {
+		// Overflow and deleted pages have no row
+		row, err := ex.next(iter)
+		if errors.Is(err, core.ErrQueryCancelled) {
+			return 0, err
+		}
 
-// EvaluateValueExpression evaluates a value expression
-func (ex *Executor) evaluateValueExpression(vexpr *parser.ValueExpression, rows *[]map[string]interface{}) interface{} {
-	switch expr := vexpr.Value.(type) {
-	case *parser.CaseExpr:
-		// check if left is column spec
-		col, err := ex.evaluateCaseExpr(expr, rows)
+		if err != nil || row == nil {
+			continue
+		}
+
+		err = write(row, columns, types)
 		if err != nil {
-			return false
+			return ex.rows, err
 		}
 
-		for _, row := range *rows {
-			for k, v := range row {
-				if k == col {
-					return v
-				}
-			}
+		ex.rows++
+	}
 
-		}
+	err = out.Flush()
+	if err != nil {
+		return ex.rows, err
+	}
 
-	case *shared.GenUUID:
-		return shared.GenerateUUID()
-	case *shared.SysDate, *shared.SysTimestamp, *shared.SysTime:
-		return time.Now()
+	return ex.rows, ex.copied()
+}
 
-	case *parser.UpperFunc:
-		for i, row := range *rows {
+// CopyIn reads rows in the COPY text format from r until a line of \. or the end of r, and inserts them into a table
+// Rows are inserted in batches, the batches inserted before a row fails are kept unless the copy runs within a transaction.
+// Once a row fails the rest are still read so the client is not cut off mid copy.  The amount of rows inserted is returned
+func (ex *Executor) CopyIn(stmt *parser.CopyStmt, r io.Reader) (int, error) {
+	ex.rows = 0
 
-			newRow := map[string]interface{}{}
-			for k, v := range row {
-				// trim off the tablename if it exists
+	if !stmt.From {
+		return 0, errors.New("expected COPY ... FROM STDIN")
+	}
 
-				if strings.Contains(k, ".") {
-					newRow[strings.Split(k, ".")[1]] = v
-				} else {
-					newRow[k] = v
+	if ex.ch.Database == nil {
+		return 0, errors.New("no database selected")
+	}
 
-				}
-			}
+	tbl, columns, err := ex.copyTable(stmt)
+	if err != nil {
+		return 0, err
+	}
 
-			for k, v := range newRow {
+	reader, ok := r.(*bufio.Reader)
+	if !ok {
+		reader = bufio.NewReader(r)
+	}
 
-				if k == expr.Arg.(*parser.ValueExpression).Value.(*parser.ColumnSpecification).ColumnName.Value {
-					// check if row value is string
-					if _, ok := v.(string); ok {
-						newRow[k] = strings.ToUpper(v.(string))
-						*rows = append(*rows, newRow)
-						*rows = append((*rows)[:i], (*rows)[i+1:]...)
-						return newRow[k]
-					}
+	columnNames := make([]*parser.Identifier, len(columns))
+	for i, column := range columns {
+		columnNames[i] = &parser.Identifier{Value: column}
+	}
 
-				}
-			}
+	copied := 0
+	var values [][]interface{}
 
+	// insert inserts the rows read since the last batch, a transaction keeps the statement so every batch is a new one
+	insert := func() error {
+		if len(values) == 0 {
+			return nil
 		}
-	case *parser.LowerFunc:
-		for i, row := range *rows {
 
-			newRow := map[string]interface{}{}
-			for k, v := range row {
-				// trim off the tablename if it exists
+		err := ex.Execute(&parser.InsertStmt{TableName: stmt.TableName, ColumnNames: columnNames, Values: values})
+		if err != nil {
+			return err
+		}
 
-				if strings.Contains(k, ".") {
-					newRow[strings.Split(k, ".")[1]] = v
-				} else {
-					newRow[k] = v
+		copied += len(values)
+		values = nil
 
-				}
-			}
+		return nil
+	}
 
-			for k, v := range newRow {
+	var failed error
 
-				if k == expr.Arg.(*parser.ValueExpression).Value.(*parser.ColumnSpecification).ColumnName.Value {
-					// check if row value is string
-					if _, ok := v.(string); ok {
-						newRow[k] = strings.ToLower(v.(string))
-						*rows = append(*rows, newRow)
-						*rows = append((*rows)[:i], (*rows)[i+1:]...)
-						return newRow[k]
-					}
+	for line := 1; ; line++ {
+		text, err := reader.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return copied, err
+		}
+
+		text = strings.TrimSuffix(strings.TrimSuffix(text, "\n"), "\r")
+		if text == COPY_END || (err == io.EOF && text == "") {
+			break
+		}
 
+		if failed == nil {
+			row, rowErr := copyValues(text, columns, tbl)
+			if rowErr != nil {
+				failed = fmt.Errorf("line %d: %s", line, rowErr.Error())
+			} else {
+				values = append(values, row)
+
+				if len(values) == COPY_BATCH_ROWS {
+					failed = insert()
 				}
 			}
-
 		}
-	case *parser.RoundFunc:
-		for i, row := range *rows {
 
-			newRow := map[string]interface{}{}
-			for k, v := range row {
-				// trim off the tablename if it exists
+		if err == io.EOF {
+			break
+		}
+	}
 
-				if strings.Contains(k, ".") {
-					newRow[strings.Split(k, ".")[1]] = v
-				} else {
-					newRow[k] = v
+	if failed == nil {
+		failed = insert()
+	}
 
-				}
-			}
+	ex.rows = copied
 
-			for k, v := range newRow {
+	if failed != nil {
+		return copied, failed
+	}
 
-				if k == expr.Arg.(*parser.ValueExpression).Value.(*parser.ColumnSpecification).ColumnName.Value {
-					// check if row value is string
-					if _, ok := v.(float64); ok {
+	return copied, ex.copied()
+}
 
-						newRow[k] = math.Round(v.(float64))
-						*rows = append(*rows, newRow)
-						*rows = append((*rows)[:i], (*rows)[i+1:]...)
-						return newRow[k]
-					} else if _, ok := v.(int); ok {
-						newRow[k] = math.Round(float64(v.(int)))
-						*rows = append(*rows, newRow)
-						*rows = append((*rows)[:i], (*rows)[i+1:]...)
-						return newRow[k]
-					} else if _, ok := v.(uint64); ok {
-						newRow[k] = math.Round(float64(v.(uint64)))
-						*rows = append(*rows, newRow)
-						*rows = append((*rows)[:i], (*rows)[i+1:]...)
-						return newRow[k]
-					}
+// copied formats the amount of rows a COPY copied as its result set
+func (ex *Executor) copied() error {
+	var err error
 
-				}
-			}
+	copied := []map[string]interface{}{{"RowsCopied": ex.rows}}
 
+	if !ex.json {
+		ex.ResultSetBuffer = shared.CreateTableByteArray(copied, shared.GetHeaders(copied, true))
+	} else {
+		ex.ResultSetBuffer, err = shared.CreateJSONByteArray(copied)
+		if err != nil {
+			return err
 		}
-	case *parser.ReverseFunc:
-		for i, row := range *rows {
+	}
 
-			newRow := map[string]interface{}{}
-			for k, v := range row {
-				// trim off the tablename if it exists
+	return nil
+}
 
-				if strings.Contains(k, ".") {
-					newRow[strings.Split(k, ".")[1]] = v
-				} else {
-					newRow[k] = v
+// executePrepared executes a prepared statement for every set of values bound to its parameters
+// The rows of an INSERT are inserted in batches through the bulk insert path, an UPDATE or DELETE is executed for every set of values.
+// A set of values failing does not fail the others, the result set has a row per set failing with its position, from 1, and its error
+func (ex *Executor) executePrepared(s *parser.ExecutePreparedStmt) error {
+	prepared, ok := ex.prepared[s.Name.Value]
+	if !ok {
+		return errors.New("prepared statement " + s.Name.Value + " does not exist")
+	}
 
-				}
-			}
+	failed := make([]map[string]interface{}, 0)
+	failing := make(map[int]bool)
 
-			for k, v := range newRow {
+	fail := func(set int, err error) {
+		if !failing[set] {
+			failing[set] = true
+			failed = append(failed, map[string]interface{}{"Row": set + 1, "Error": err.Error()})
+		}
+	}
 
-				if k == expr.Arg.(*parser.ValueExpression).Value.(*parser.ColumnSpecification).ColumnName.Value {
-					// check if row value is string
-					if _, ok := v.(string); ok {
-						newRow[k] = shared.ReverseString(v.(string))
-						*rows = append(*rows, newRow)
-						*rows = append((*rows)[:i], (*rows)[i+1:]...)
-						return newRow[k]
-					}
+	ex.binding = true
+	defer func() { ex.binding = false }()
 
-				}
+	if insert, ok := prepared.Stmt.(*parser.InsertStmt); ok {
+		ex.executeBoundInserts(insert, prepared.Parameters, s.Values, fail)
+	} else {
+		for i, values := range s.Values {
+			stmt, err := bind(prepared.Stmt, prepared.Parameters, values)
+			if err == nil {
+				err = ex.Execute(stmt)
+			}
+
+			if err != nil {
+				fail(i, err)
 			}
 		}
-	case *parser.LengthFunc:
-		for i, row := range *rows {
+	}
 
-			newRow := map[string]interface{}{}
-			for k, v := range row {
-				// trim off the tablename if it exists
+	sort.Slice(failed, func(i, j int) bool { return failed[i]["Row"].(int) < failed[j]["Row"].(int) })
 
-				if strings.Contains(k, ".") {
-					newRow[strings.Split(k, ".")[1]] = v
-				} else {
-					newRow[k] = v
+	var err error
 
-				}
-			}
+	if !ex.json {
+		ex.ResultSetBuffer = shared.CreateTableByteArray(failed, []string{"Row", "Error"})
+	} else {
+		ex.ResultSetBuffer, err = shared.CreateJSONByteArray(failed)
+		if err != nil {
+			return err
+		}
+	}
 
-			for k, v := range newRow {
+	return nil
+}
 
-				if k == expr.Arg.(*parser.ValueExpression).Value.(*parser.ColumnSpecification).ColumnName.Value {
-					// check if row value is string
-					if _, ok := v.(string); ok {
-						newRow[k] = len(v.(string)) - 2
-						*rows = append(*rows, newRow)
-						*rows = append((*rows)[:i], (*rows)[i+1:]...)
-						return newRow[k]
-					}
+// boundRow is a row of a prepared INSERT bound to a set of values
+type boundRow struct {
+	set    int           // Position of the set of values bound, from 0
+	values []interface{} // Values of the row
+}
 
-				}
-			}
+// executeBoundInserts inserts the rows of a prepared INSERT bound to every set of values, COPY_BATCH_ROWS at once
+// A row failing is left out and the rows of the batch after it are inserted with the next batch
+func (ex *Executor) executeBoundInserts(insert *parser.InsertStmt, parameters int, sets [][]*parser.Literal, fail func(set int, err error)) {
+	var pending []boundRow
 
+	for i, values := range sets {
+		stmt, err := bind(insert, parameters, values)
+		if err != nil {
+			fail(i, err)
+			continue
 		}
 
-	case *parser.PositionFunc:
-		for i, row := range *rows {
+		for _, row := range stmt.(*parser.InsertStmt).Values {
+			pending = append(pending, boundRow{set: i, values: row})
+		}
+	}
 
-			newRow := map[string]interface{}{}
-			for k, v := range row {
-				// trim off the tablename if it exists
+	for len(pending) > 0 {
+		batch := pending[:min(len(pending), COPY_BATCH_ROWS)]
 
-				if strings.Contains(k, ".") {
-					newRow[strings.Split(k, ".")[1]] = v
-				} else {
-					newRow[k] = v
+		values := make([][]interface{}, len(batch))
+		for i, row := range batch {
+			values[i] = row.values
+		}
 
-				}
+		err := ex.Execute(&parser.InsertStmt{TableName: insert.TableName, ColumnNames: insert.ColumnNames, Values: values})
+		if err == nil {
+			pending = pending[len(batch):]
+			continue
+		}
+
+		var rowErr *RowError
+		if !errors.As(err, &rowErr) {
+			// The statement failed as a whole, such as for a table which does not exist
+			for _, row := range pending {
+				fail(row.set, err)
 			}
 
-			for k, v := range newRow {
+			return
+		}
 
-				if k == expr.In.(*parser.ValueExpression).Value.(*parser.ColumnSpecification).ColumnName.Value {
-					// check if row value is string
-					if _, ok := v.(string); ok {
-						newRow[k] = (strings.Index(v.(string), strings.TrimSuffix(strings.TrimPrefix(expr.Arg.(*parser.ValueExpression).Value.(*parser.Literal).Value.(string), "'"), "'"))) + 1
+		fail(batch[rowErr.Row].set, rowErr.Err)
 
-						*rows = append(*rows, newRow)
-						*rows = append((*rows)[:i], (*rows)[i+1:]...)
-						return newRow[k]
-					}
+		// The rows inserted before the row failing are kept, the rows after it are inserted again
+		rest := make([]boundRow, 0, len(pending)-rowErr.Inserted-1)
+		rest = append(rest, pending[rowErr.Inserted:rowErr.Row]...)
+		pending = append(rest, pending[rowErr.Row+1:]...)
+	}
+}
 
-				}
+// bind returns a copy of a prepared statement with its parameters replaced by a set of values, by position
+func bind(stmt parser.Statement, parameters int, values []*parser.Literal) (parser.Statement, error) {
+	if len(values) != parameters {
+		return nil, fmt.Errorf("expected %d values, got %d", parameters, len(values))
+	}
+
+	return bound(reflect.ValueOf(stmt), values).Interface().(parser.Statement), nil
+}
+
+// bound returns a copy of a node of a prepared statement with its parameters replaced by the values
+// Literals which are not parameters, and maps, are shared with the prepared statement as they are not changed
+func bound(v reflect.Value, values []*parser.Literal) reflect.Value {
+	switch v.Kind() {
+	case reflect.Pointer:
+		if v.IsNil() {
+			return v
+		}
+
+		if literal, ok := v.Interface().(*parser.Literal); ok {
+			if placeholder, ok := literal.Value.(*parser.Placeholder); ok {
+				return reflect.ValueOf(&parser.Literal{Value: values[placeholder.Position-1].Value})
 			}
 
+			return v
 		}
-	case *parser.SubstrFunc:
-		for i, row := range *rows {
 
-			newRow := map[string]interface{}{}
-			for k, v := range row {
-				// trim off the tablename if it exists
+		c := reflect.New(v.Type().Elem())
+		c.Elem().Set(bound(v.Elem(), values))
 
-				if strings.Contains(k, ".") {
-					newRow[strings.Split(k, ".")[1]] = v
-				} else {
-					newRow[k] = v
+		return c
+	case reflect.Interface:
+		if v.IsNil() {
+			return v
+		}
 
-				}
+		c := reflect.New(v.Type()).Elem()
+		c.Set(bound(v.Elem(), values))
+
+		return c
+	case reflect.Struct:
+		c := reflect.New(v.Type()).Elem()
+		c.Set(v)
+
+		for i := 0; i < v.NumField(); i++ {
+			if v.Type().Field(i).IsExported() {
+				c.Field(i).Set(bound(v.Field(i), values))
 			}
+		}
 
-			for k, v := range newRow {
+		return c
+	case reflect.Slice:
+		if v.IsNil() {
+			return v
+		}
 
-				if k == expr.Arg.(*parser.ValueExpression).Value.(*parser.ColumnSpecification).ColumnName.Value {
-					// check if row value is string
-					if _, ok := v.(string); ok {
-						start := int(expr.StartPos.Value.(uint64))
+		c := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		for i := 0; i < v.Len(); i++ {
+			c.Index(i).Set(bound(v.Index(i), values))
+		}
+
+		return c
+	}
+
+	return v
+}
 
-						if start == 1 {
-							start = 0
-						}
+// copyTable returns the table of a COPY and the columns copied, the columns named or every column by name
+func (ex *Executor) copyTable(stmt *parser.CopyStmt) (*catalog.Table, []string, error) {
+	tbl := ex.ch.Database.GetTable(stmt.TableName.Value)
+	if tbl == nil {
+		return nil, nil, errors.New("table does not exist")
+	}
 
-						end := int(expr.Length.Value.(uint64))
+	action, privilege := shared.PRIV_SELECT, "SELECT"
+	if stmt.From {
+		action, privilege = shared.PRIV_INSERT, "INSERT"
+	}
 
-						newRow[k] = strings.TrimPrefix(strings.TrimSuffix(v.(string), "'"), "'")[start:end]
+	if !ex.currentUser().HasPrivilege(ex.ch.Database.Name, tbl.Name, []shared.PrivilegeAction{action}) {
+		return nil, nil, fmt.Errorf("%w to %s on table %s", ErrNoPrivilege, privilege, tbl.Name)
+	}
 
-						newRow[k] = fmt.Sprintf("'%s'", newRow[k])
+	columns := make([]string, 0, len(stmt.ColumnNames))
 
-						*rows = append(*rows, newRow)
-						*rows = append((*rows)[:i], (*rows)[i+1:]...)
-						return newRow[k]
-					}
+	for _, columnName := range stmt.ColumnNames {
+		if _, ok := tbl.TableSchema.ColumnDefinitions[columnName.Value]; !ok {
+			return nil, nil, errors.New("column " + columnName.Value + " does not exist")
+		}
 
-				}
-			}
+		columns = append(columns, columnName.Value)
+	}
 
+	if len(columns) == 0 {
+		for column := range tbl.TableSchema.ColumnDefinitions {
+			columns = append(columns, column)
 		}
-	case *parser.ConcatFunc:
-		for i, row := range *rows {
 
-			newRow := map[string]interface{}{}
-			for k, v := range row {
-				// trim off the tablename if it exists
+		sort.Strings(columns)
+	}
 
-				if strings.Contains(k, ".") {
-					newRow[strings.Split(k, ".")[1]] = v
-				} else {
-					newRow[k] = v
+	return tbl, columns, nil
+}
 
-				}
-			}
+// copyText returns a row value as a value of the COPY text format
+func copyText(v interface{}, dataType string) string {
+	switch v := v.(type) {
+	case nil:
+		return "\\N"
+	case string:
+		return copyEscaper.Replace(shared.UnquoteLiteral(v))
+	case bool:
+		if v {
+			return "t"
+		}
+
+		return "f"
+	case []byte:
+		return hex.EncodeToString(v)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case time.Time:
+		switch dataType {
+		case "DATE":
+			return v.Format("2006-01-02")
+		case "TIME":
+			return v.Format("15:04:05")
+		}
+
+		return v.Format("2006-01-02 15:04:05")
+	}
 
-			for k, v := range newRow {
+	return copyEscaper.Replace(fmt.Sprintf("%v", v))
+}
 
-				if k == expr.Args[0].(*parser.ValueExpression).Value.(*parser.ColumnSpecification).ColumnName.Value {
-					// check if row value is string
-					if _, ok := v.(string); ok {
-						for _, arg := range expr.Args[1:] {
-							if _, ok := arg.(*parser.ValueExpression).Value.(*parser.ColumnSpecification); ok {
-								var newStr []string
-								newStr = append(newStr, strings.TrimSuffix(strings.TrimPrefix(v.(string), "'"), "'"))
-								newStr = append(newStr, strings.TrimSuffix(strings.TrimPrefix(newRow[arg.(*parser.ValueExpression).Value.(*parser.ColumnSpecification).ColumnName.Value].(string), "'"), "'"))
-								newRow[k] = fmt.Sprintf("'%s'", strings.Join(newStr, ""))
-							} else {
-								var newStr []string
-								newStr = append(newStr, strings.TrimSuffix(strings.TrimPrefix(v.(string), "'"), "'"))
-								newStr = append(newStr, strings.TrimSuffix(strings.TrimPrefix(arg.(*parser.ValueExpression).Value.(*parser.Literal).Value.(string), "'"), "'"))
-								newRow[k] = fmt.Sprintf("'%s'", strings.Join(newStr, ""))
-							}
-						}
+// copyValues returns the values of a line of the COPY text format as literals of the columns, nil for NULL
+func copyValues(line string, columns []string, tbl *catalog.Table) ([]interface{}, error) {
+	fields := strings.Split(line, "\t")
+	if len(fields) != len(columns) {
+		return nil, fmt.Errorf("expected %d values, got %d", len(columns), len(fields))
+	}
 
-						*rows = append(*rows, newRow)
-						*rows = append((*rows)[:i], (*rows)[i+1:]...)
-						return newRow[k]
-					}
+	values := make([]interface{}, len(fields))
 
-				}
-			}
+	for i, field := range fields {
+		// A column not given is NULL
+		if field == "\\N" {
+			continue
+		}
 
+		value, err := copyValue(copyUnescaper.Replace(field), columns[i], tbl.TableSchema.ColumnDefinitions[columns[i]].DataType)
+		if err != nil {
+			return nil, err
 		}
-	case *parser.TrimFunc:
-		for i, row := range *rows {
 
-			newRow := map[string]interface{}{}
-			for k, v := range row {
-				// trim off the tablename if it exists
+		values[i] = &parser.Literal{Value: value}
+	}
 
-				if strings.Contains(k, ".") {
-					newRow[strings.Split(k, ".")[1]] = v
-				} else {
-					newRow[k] = v
+	return values, nil
+}
 
-				}
-			}
+// copyValue converts a value of the COPY text format into the value the parser reads a literal of the column as
+func copyValue(value string, column string, dataType string) (interface{}, error) {
+	switch strings.ToUpper(dataType) {
+	case "INT", "INTEGER", "SMALLINT":
+		i, err := strconv.Atoi(value)
+		if err != nil {
+			return nil, fmt.Errorf("column %s is not an int", column)
+		}
 
-			for k, v := range newRow {
+		return i, nil
+	case "NUMERIC", "DECIMAL", "DEC", "FLOAT", "DOUBLE", "REAL":
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return nil, fmt.Errorf("column %s is not a floating point number", column)
+		}
+
+		return f, nil
+	case "BOOL", "BOOLEAN":
+		switch strings.ToLower(value) {
+		case "t", "true", "1":
+			return true, nil
+		case "f", "false", "0":
+			return false, nil
+		}
+
+		return nil, fmt.Errorf("column %s is not a boolean", column)
+	case "BLOB", "BINARY", "TIME":
+		// Hex strings and times are inserted unquoted
+		return value, nil
+	case "DATETIME", "TIMESTAMP":
+		// A timestamp is inserted with the colons of its time dropped, 2024-09-14 153201
+		date, clock, _ := strings.Cut(value, " ")
+		return date + " " + strings.ReplaceAll(clock, ":", ""), nil
+	}
 
-				if k == expr.Arg.(*parser.ValueExpression).Value.(*parser.ColumnSpecification).ColumnName.Value {
-					// check if row value is string
-					if _, ok := v.(string); ok {
-						newRow[k] = fmt.Sprintf("'%s'", strings.TrimSpace(strings.TrimSuffix(strings.TrimPrefix(v.(string), "'"), "'")))
-						*rows = append(*rows, newRow)
-						*rows = append((*rows)[:i], (*rows)[i+1:]...)
-						return newRow[k]
-					}
+	return "'" + strings.ReplaceAll(value, "'", "\\'") + "'", nil
+}
 
-				}
-			}
+// addConstraint adds a CHECK or foreign key constraint to a column
+// Unless the constraint is added NOT VALID the existing rows are validated against it first
+func (ex *Executor) addConstraint(tbl *catalog.Table, column string, constraint *parser.ColumnConstraint) error {
+	if _, ok := tbl.TableSchema.ColumnDefinitions[column]; !ok {
+		return fmt.Errorf("column %s does not exist", column)
+	}
 
+	if constraint.References != nil {
+		// New rows are checked against a unique index of the referenced column
+		refTbl := ex.ch.Database.GetTable(constraint.References.TableName)
+		if refTbl == nil {
+			return fmt.Errorf("table %s does not exist", constraint.References.TableName)
 		}
 
-	case *parser.CoalesceFunc:
-		for i, row := range *rows {
-
-			newRow := map[string]interface{}{}
-			for k, v := range row {
-				// trim off the tablename if it exists
+		if refTbl.CheckIndexedColumn(column, true) == nil {
+			return fmt.Errorf("table %s has no unique index on column %s", constraint.References.TableName, column)
+		}
+	}
 
-				if strings.Contains(k, ".") {
-					newRow[strings.Split(k, ".")[1]] = v
-				} else {
-					newRow[k] = v
+	if !constraint.NotValid {
+		violations, err := ex.constraintViolations(tbl, column, constraint.Check, constraint.References)
+		if err != nil {
+			return err
+		}
 
-				}
-			}
+		if len(violations) > 0 {
+			return fmt.Errorf("%d rows violate the constraint, add it NOT VALID and validate it once they are fixed", len(violations))
+		}
+	}
 
-			for k, v := range newRow {
+	return tbl.AddConstraint(column, constraint.Check, constraint.References, constraint.NotValid)
+}
 
-				if k == expr.Args[0].(*parser.ValueExpression).Value.(*parser.ColumnSpecification).ColumnName.Value {
-					// Value should be nil
-					if v == nil {
-						newRow[k] = expr.Value.(*parser.ValueExpression).Value.(*parser.Literal).Value
-						*rows = append(*rows, newRow)
-						*rows = append((*rows)[:i], (*rows)[i+1:]...)
-						return newRow[k]
-					}
-				}
-			}
+// constraintViolations returns the rows of a table which violate a CHECK or foreign key constraint of a column
+// A row with no value for the column satisfies the constraint
+func (ex *Executor) constraintViolations(tbl *catalog.Table, column string, check interface{}, references *catalog.Reference) ([]map[string]interface{}, error) {
+	var keys map[string]struct{} // Values of the referenced column
 
+	if references != nil {
+		refTbl := ex.ch.Database.GetTable(references.TableName)
+		if refTbl == nil {
+			return nil, fmt.Errorf("table %s does not exist", references.TableName)
 		}
-	case *parser.CastFunc:
-		for i, row := range *rows {
-
-			newRow := map[string]interface{}{}
-			for k, v := range row {
-				// trim off the tablename if it exists
 
-				if strings.Contains(k, ".") {
-					newRow[strings.Split(k, ".")[1]] = v
-				} else {
-					newRow[k] = v
+		keys = make(map[string]struct{})
 
-				}
+		iter := refTbl.NewIterator()
+		for iter.Valid() {
+			// Overflow and deleted pages have no row
+			row, err := ex.next(iter)
+			if errors.Is(err, core.ErrQueryCancelled) {
+				return nil, err
 			}
 
-			for k, v := range newRow {
+			if err != nil || row == nil || row[column] == nil {
+				continue
+			}
 
-				if k == expr.Expr.(*parser.ValueExpression).Value.(*parser.ColumnSpecification).ColumnName.Value {
-					switch expr.DataType.Value {
-					case "INT", "INTEGER", "SMALLINT":
-						// check if row value is string
-						if _, ok := v.(string); ok {
-							// Convert string to int
-							intVal, err := strconv.Atoi(v.(string))
-							if err != nil {
-								return nil
-							}
+			keys[encodeValue(row[column])] = struct{}{}
+		}
+	}
 
-							newRow[k] = intVal
+	violations := make([]map[string]interface{}, 0)
 
-							*rows = append(*rows, newRow)
+	iter := tbl.NewIterator()
+	for iter.Valid() {
+		row, err := ex.next(iter)
+		if errors.Is(err, core.ErrQueryCancelled) {
+			return nil, err
+		}
 
-							*rows = append((*rows)[:i], (*rows)[i+1:]...)
+		if err != nil || row == nil || row[column] == nil {
+			continue
+		}
 
-							return newRow[k]
+		if references != nil {
+			if _, ok := keys[encodeValue(row[column])]; ok {
+				continue
+			}
+		} else {
+			// The condition is evaluated on a copy, functions within it can change the row
+			r := []map[string]interface{}{maps.Clone(row)}
+			var fr []map[string]interface{}
 
-						}
-					case "FLOAT", "DOUBLE", "DECIMAL", "REAL", "NUMERIC":
-						// check if row value is string
-						if _, ok := v.(string); ok {
-							// Convert string to float
-							floatVal, err := strconv.ParseFloat(v.(string), 64)
-							if err != nil {
-								return nil
-							}
+			if ex.evaluateCondition(check, &r, []*catalog.Table{tbl}, &fr) {
+				continue
+			}
+		}
 
-							newRow[k] = floatVal
+		violations = append(violations, row)
+	}
 
-							*rows = append(*rows, newRow)
+	return violations, nil
+}
 
-							*rows = append((*rows)[:i], (*rows)[i+1:]...)
+// checksumTable returns the checksum of every row of a table, by a column the checksums of chunks rows are assigned to by the hash of the column
+// A table holding the same rows on two instances has the same checksums, rows are hashed by their values rather than how they are stored
+func checksumTable(tbl *catalog.Table, by *parser.Identifier, chunks int) []*checksum {
+	if by == nil {
+		chunks = 1
+	}
 
-							return newRow[k]
-						}
-					case "DATE":
-						// check if row value is string
-						if _, ok := v.(string); ok {
-							// Convert string to time.Time
-							dateVal, err := time.Parse("2006-01-02", v.(string))
-							if err != nil {
-								return nil
-							}
+	checksums := make([]*checksum, chunks)
+	for i := range checksums {
+		checksums[i] = &checksum{}
+	}
 
-							newRow[k] = dateVal
+	iter := tbl.NewIterator()
+	for iter.Valid() {
+		// Overflow and deleted pages have no row
+		row, err := iter.Next()
+		if err != nil || row == nil {
+			continue
+		}
 
-							*rows = append(*rows, newRow)
+		chunk := 0
+		if by != nil {
+			chunk = int(hashValue(row[by.Value]) % uint64(chunks))
+		}
 
-							*rows = append((*rows)[:i], (*rows)[i+1:]...)
+		checksums[chunk].rows++
+		checksums[chunk].sum += hashRow(row)
+	}
 
-							return newRow[k]
-						}
-					case "DATETIME", "TIMESTAMP":
-						// check if row value is string
-						if _, ok := v.(string); ok {
-							// Convert string to time.Time
-							dateVal, err := time.Parse("2006-01-02 15:04:05", v.(string))
-							if err != nil {
-								return nil
-							}
+	return checksums
+}
 
-							newRow[k] = dateVal
+// hashRow returns the hash of the columns and values of a row
+func hashRow(row map[string]interface{}) uint64 {
+	columns := make([]string, 0, len(row))
+	for column := range row {
+		columns = append(columns, column)
+	}
 
-							*rows = append(*rows, newRow)
+	sort.Strings(columns)
 
-							*rows = append((*rows)[:i], (*rows)[i+1:]...)
+	h := sha256.New()
+	for _, column := range columns {
+		fmt.Fprintf(h, "%s\x00%s\x00", column, encodeValue(row[column]))
+	}
 
-							return newRow[k]
+	return binary.BigEndian.Uint64(h.Sum(nil))
+}
 
-						}
-					case "TIME":
-						// check if row value is string
-						if _, ok := v.(string); ok {
-							// Convert string to time.Time
-							dateVal, err := time.Parse("15:04:05", v.(string))
-							if err != nil {
-								return nil
-							}
+// hashValue returns the hash of a value
+func hashValue(value interface{}) uint64 {
+	sum := sha256.Sum256([]byte(encodeValue(value)))
+	return binary.BigEndian.Uint64(sum[:])
+}
 
-							newRow[k] = dateVal
+// encodeValue encodes a value with its type, 1 and '1' are encoded differently
+func encodeValue(value interface{}) string {
+	switch value := value.(type) {
+	case nil:
+		return "NULL"
+	case time.Time:
+		return "time.Time:" + value.UTC().Format(time.RFC3339Nano)
+	case []byte:
+		return fmt.Sprintf("[]byte:%x", value)
+	}
 
-							*rows = append(*rows, newRow)
+	return fmt.Sprintf("%T:%v", value, value)
+}
 
-							*rows = append((*rows)[:i], (*rows)[i+1:]...)
+// fold replaces the deterministic functions of literals compared within a condition by their value, evaluated once rather than for every row
+// A column compared with a folded value can be looked up within its index
+func fold(cond interface{}) {
+	switch cond := cond.(type) {
+	case *parser.LogicalCondition:
+		fold(cond.Left)
+		fold(cond.Right)
+	case *parser.NotExpr:
+		fold(cond.Expr)
+	case *parser.ComparisonPredicate:
+		for _, expr := range []*parser.ValueExpression{cond.Left, cond.Right} {
+			if expr == nil {
+				continue
+			}
 
-							return newRow[k]
-						}
-					case "BOOL", "BOOLEAN":
-						// check if row value is string
-						if _, ok := v.(string); ok {
-							if v.(string) == "T" || v.(string) == "t" {
-								v = "true"
-							} else if v.(string) == "F" || v.(string) == "f" {
-								v = "false"
-							} else if v.(string) == "'true'" {
-								v = "true"
-							} else if v.(string) == "'false'" {
-								v = "false"
-							}
+			// RANDOM() < 0.1 is evaluated for every row, it is not deterministic
+			hashFunc, ok := expr.Value.(*parser.HashFunc)
+			if !ok || !parser.Deterministic(hashFunc) {
+				continue
+			}
 
-							// Convert string to bool
-							boolVal, err := strconv.ParseBool(v.(string))
-							if err != nil {
-								return nil
-							}
+			if literal, ok := hashFunc.Arg.(*parser.ValueExpression).Value.(*parser.Literal); ok {
+				expr.Value = &parser.Literal{Value: hash(hashFunc.FuncName, literal.Value)}
+			}
+		}
+	}
+}
 
-							newRow[k] = boolVal
+// collation returns the collation named name, collations are looked up once per executor
+func (ex *Executor) collation(name string) (*collation.Collation, error) {
+	if coll, ok := ex.collations[name]; ok {
+		return coll, nil
+	}
 
-							*rows = append(*rows, newRow)
+	coll, err := collation.Lookup(name)
+	if err != nil {
+		return nil, err
+	}
 
-							*rows = append((*rows)[:i], (*rows)[i+1:]...)
+	if ex.collations == nil {
+		ex.collations = make(map[string]*collation.Collation)
+	}
 
-							return newRow[k]
+	ex.collations[name] = coll
 
-						}
-					}
+	return coll, nil
+}
 
-				}
-			}
+// lookupCollations looks up the collations compared in within a condition, an unknown collation is an error
+func (ex *Executor) lookupCollations(cond interface{}) error {
+	switch cond := cond.(type) {
+	case *parser.LogicalCondition:
+		err := ex.lookupCollations(cond.Left)
+		if err != nil {
+			return err
+		}
 
+		return ex.lookupCollations(cond.Right)
+	case *parser.NotExpr:
+		return ex.lookupCollations(cond.Expr)
+	case *parser.ComparisonPredicate:
+		if name := collationOf(cond); name != "" {
+			_, err := ex.collation(name)
+			return err
 		}
+	}
 
-	case *parser.Literal:
+	return nil
+}
 
-		return expr.Value
+// defaultCollations gives comparisons without COLLATE on a string column the default collation of its table
+func defaultCollations(cond interface{}, tbls []*catalog.Table) {
+	switch cond := cond.(type) {
+	case *parser.LogicalCondition:
+		defaultCollations(cond.Left, tbls)
+		defaultCollations(cond.Right, tbls)
+	case *parser.NotExpr:
+		defaultCollations(cond.Expr, tbls)
+	case *parser.ComparisonPredicate:
+		if collationOf(cond) != "" {
+			return
+		}
 
-	case *parser.ColumnSpecification:
+		if name := columnCollation(cond.Left, tbls); name != "" {
+			cond.Left.Collation = &parser.Identifier{Value: name}
+		} else if name := columnCollation(cond.Right, tbls); name != "" {
+			cond.Right.Collation = &parser.Identifier{Value: name}
+		}
+	}
+}
 
-		if expr.TableName == nil {
-			for i, row := range *rows {
-				newRow := map[string]interface{}{}
-				for k, v := range row {
-					// trim off the tablename if it exists
+// columnCollation returns the default collation of the table of a string column, empty if the expression is not such a column
+func columnCollation(expr *parser.ValueExpression, tbls []*catalog.Table) string {
+	if expr == nil {
+		return ""
+	}
 
-					if strings.Contains(k, ".") {
-						newRow[strings.Split(k, ".")[1]] = v
-					} else {
-						newRow[k] = v
+	colSpec, ok := expr.Value.(*parser.ColumnSpecification)
+	if !ok {
+		return ""
+	}
 
-					}
-				}
-				*rows = append(*rows, newRow)
-				*rows = append((*rows)[:i], (*rows)[i+1:]...)
-			}
+	for _, tbl := range tbls {
+		if colSpec.TableName != nil && colSpec.TableName.Value != tbl.Name {
+			continue
 		}
-		for _, row := range *rows {
-			// check if tablename.columnname exists
-			if expr.TableName != nil {
-				if _, ok := row[fmt.Sprintf("%v.%v", expr.TableName.Value, expr.ColumnName.Value)]; ok {
-					return row[fmt.Sprintf("%v.%v", expr.TableName.Value, expr.ColumnName.Value)]
-				}
-			}
-			if _, ok := row[expr.ColumnName.Value]; ok {
-
-				return row[expr.ColumnName.Value]
-			}
 
+		if tbl.TableSchema == nil || tbl.TableSchema.Collation == "" {
+			continue
 		}
 
-		return nil
-
-	case *parser.BinaryExpression:
-		var val interface{}
-		err := evaluateBinaryExpression(expr, &val, rows)
-		if err != nil {
-			return nil
+		colDef, ok := tbl.TableSchema.ColumnDefinitions[colSpec.ColumnName.Value]
+		if !ok {
+			continue
 		}
 
-		return val
-	case *parser.Variable:
-		// check if variable exists
-		if _, ok := ex.vars[expr.VariableName.Value]; ok {
-			return ex.vars[expr.VariableName.Value].Value
+		switch strings.ToUpper(colDef.DataType) {
+		case "CHAR", "CHARACTER", "TEXT":
+			return tbl.TableSchema.Collation
 		}
 	}
 
-	return nil
+	return ""
+}
+
+// collationOf returns the collation of a comparison, that of its right side over that of its left, empty if none
+func collationOf(cond *parser.ComparisonPredicate) string {
+	if cond.Right != nil && cond.Right.Collation != nil {
+		return cond.Right.Collation.Value
+	}
+
+	if cond.Left != nil && cond.Left.Collation != nil {
+		return cond.Left.Collation.Value
+	}
+
+	return ""
+}
+
+// compare returns true if the result of comparing two values, -1, 0 or 1, satisfies the comparison operator
+func compare(cmp int, op parser.ComparisonOperator) bool {
+	switch op {
+	case parser.OP_EQ:
+		return cmp == 0
+	case parser.OP_NEQ:
+		return cmp != 0
+	case parser.OP_LT:
+		return cmp < 0
+	case parser.OP_LTE:
+		return cmp <= 0
+	case parser.OP_GT:
+		return cmp > 0
+	case parser.OP_GTE:
+		return cmp >= 0
+	}
+
+	return false
 }
 
 // getFirstLeftBinaryExpressionColumn gets the first left binary expression column
@@ -5463,6 +10454,8 @@ func evaluateBinaryExpression(expr *parser.BinaryExpression, val *interface{}, r
 
 // orderBy orders the results
 func (ex *Executor) orderBy(results []map[string]interface{}, orderBy *parser.OrderByClause) ([]map[string]interface{}, error) {
+	end := ex.startSpan("sort")
+	defer end(nil)
 	if orderBy == nil {
 		return results, nil
 	}
@@ -5471,14 +10464,39 @@ func (ex *Executor) orderBy(results []map[string]interface{}, orderBy *parser.Or
 		return results, nil
 	}
 
+	// ORDER BY RANDOM() shuffles the rows, with a LIMIT a random sample of the rows is returned
+	if _, ok := orderBy.OrderByExpressions[0].Value.(*parser.RandomFunc); ok {
+		for i := len(results) - 1; i > 0; i-- {
+			j := int(ex.source.Random() * float64(i+1))
+			results[i], results[j] = results[j], results[i]
+		}
+
+		return results, nil
+	}
+
 	// Get the column name
 	colName := orderBy.OrderByExpressions[0].Value.(*parser.ColumnSpecification).ColumnName.Value
 
 	// Get the order
 	order := orderBy.Order
 
+	// ORDER BY col COLLATE name orders strings in the collation instead of by their bytes
+	var coll *collation.Collation
+	if orderBy.OrderByExpressions[0].Collation != nil {
+		var err error
+		coll, err = collation.Lookup(orderBy.OrderByExpressions[0].Collation.Value)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	// Define a custom sort function
 	less := func(i, j int) bool {
+		// NULLs, such as the columns not grouped by in a row of a grouping set, sort first
+		if results[i][colName] == nil || results[j][colName] == nil {
+			return results[i][colName] == nil && results[j][colName] != nil
+		}
+
 		// You may want to add error checking here
 		switch results[i][colName].(type) {
 		case int:
@@ -5488,6 +10506,10 @@ func (ex *Executor) orderBy(results []map[string]interface{}, orderBy *parser.Or
 		case float64:
 			return results[i][colName].(float64) < results[j][colName].(float64)
 		case string:
+			if coll != nil {
+				return coll.Compare(shared.UnquoteLiteral(results[i][colName].(string)), shared.UnquoteLiteral(results[j][colName].(string))) < 0
+			}
+
 			return strings.Compare(results[i][colName].(string), results[j][colName].(string)) < 0
 		}
 		return false
@@ -5501,8 +10523,21 @@ func (ex *Executor) orderBy(results []map[string]interface{}, orderBy *parser.Or
 			return results, nil
 		}
 
+		// The type of the column is that of its first value which is not NULL
+		var sample interface{}
+		for _, row := range results {
+			if row[colName] != nil {
+				sample = row[colName]
+				break
+			}
+		}
+
+		if sample == nil {
+			return results, nil
+		}
+
 		// For descending order, we can use the same function but negate the result
-		switch results[0][colName].(type) {
+		switch sample.(type) {
 		case int:
 			sort.SliceStable(results, func(i, j int) bool {
 				return !less(i, j)
@@ -5610,13 +10645,55 @@ func (ex *Executor) rollback() error {
 	return nil
 }
 
+// isolated returns true if the transaction is repeatable read or serializable
+func (tx *Transaction) isolated() bool {
+	return tx.Isolation == core.ISOLATION_REPEATABLE_READ || tx.Isolation == core.ISOLATION_SERIALIZABLE
+}
+
+// isolatedRead records a table read by a repeatable read or serializable transaction
+// Reading a table written since the transaction began rolls the transaction back with core.ErrSerialization, so the
+// rows read are the rows committed when the transaction began
+func (ex *Executor) isolatedRead(table string) error {
+	if ex.recover || !ex.TransactionBegun || !ex.Transaction.isolated() || ex.Transaction.committing {
+		return nil
+	}
+
+	if ex.aria.WrittenSince(ex.ch.Database.Name, table, ex.Transaction.Began) {
+		return ex.serializationFailure(table)
+	}
+
+	ex.Transaction.Reads[table] = true
+
+	return nil
+}
+
+// serializationFailure rolls back a transaction which read or changes a table written since it began
+func (ex *Executor) serializationFailure(table string) error {
+	err := ex.appendWAL(&parser.RollbackStmt{})
+	if err != nil {
+		return err
+	}
+
+	err = ex.rollback()
+	if err != nil {
+		return err
+	}
+
+	return fmt.Errorf("%w, table %s was written since the transaction began, retry the transaction", core.ErrSerialization, table)
+}
+
 // Recover recovers an AriaSQL instance from a WAL file
 func (ex *Executor) Recover(asts []interface{}) error {
 
+	// release the current catalog and its data directory lock before rebuilding
+	if ex.aria != nil && ex.aria.Catalog != nil {
+		ex.aria.Catalog.Close()
+	}
+
 	// check if data directory exists
 	if _, err := os.Stat(ex.aria.Config.DataDir); !os.IsNotExist(err) {
 
-		err := os.RemoveAll(fmt.Sprintf("%s%sdatabases", ex.aria.Config.DataDir, shared.GetOsPathSeparator()))
+		err := os.RemoveAll(filepath.Join(ex.aria.Config.DataDir, "databases"))
 		if err != nil {
 			return err
 		}
@@ -5624,12 +10701,18 @@ func (ex *Executor) Recover(asts []interface{}) error {
 
 	if _, err := os.Stat(ex.aria.Config.DataDir); !os.IsNotExist(err) {
 
-		err := os.RemoveAll(fmt.Sprintf("%s%susers.usrs", ex.aria.Config.DataDir, shared.GetOsPathSeparator()))
+		err := os.RemoveAll(filepath.Join(ex.aria.Config.DataDir, "users.usrs"))
 		if err != nil {
 			return err
 		}
 	}
 
+	// The statements are replayed on the last checkpoint, if one was taken
+	_, err := checkpoint.Restore(ex.aria.Config.DataDir)
+	if err != nil {
+		return err
+	}
+
 	aria, err := core.New(&core.Config{
 		DataDir: ex.aria.Config.DataDir,
 	})
@@ -5638,6 +10721,8 @@ func (ex *Executor) Recover(asts []interface{}) error {
 	}
 
 	aria.Catalog = catalog.New(aria.Config.DataDir)
+	aria.Catalog.MaxOpenTables = aria.Config.MaxOpenTables
+	aria.Catalog.AutoUpgrade = aria.Config.AutoUpgrade
 
 	if err := aria.Catalog.Open(); err != nil {
 		return err
@@ -5666,17 +10751,274 @@ func (ex *Executor) Recover(asts []interface{}) error {
 	return nil
 }
 
+// appendWAL appends a statement to the WAL file
+// In cluster mode top level statements are replicated to the cluster first, nested statements
+// of procedures and transactions are reproduced by replaying their top level statement.  The rest of a replicated
+// statement runs once the cluster applies its entry, in the order of the log and with the source every node uses
+func (ex *Executor) appendWAL(stmt interface{}) error {
+	// Writes are refused while the disk is full, before anything is written
+	if !ex.recover {
+		err := ex.aria.CheckWrite()
+		if err != nil {
+			return err
+		}
+	}
+
+	data := ex.aria.WAL.Encode(stmt)
+
+	if ex.aria.Replicator != nil && !ex.recover && ex.replicated == nil && ex.topLevel() {
+		_, use := stmt.(*parser.UseStmt) // USE only changes the channel, followers still run it
+		source, done, err := ex.aria.Replicator.Replicate(ex.ch.ChannelID, stmt, !use)
+		if err != nil {
+			return err
+		}
+
+		ex.source, ex.replicated = source, done
+	}
+
+	end := ex.waits().Begin(wait.WAL_WRITE)
+	defer end()
+
+	return ex.aria.WAL.Append(data)
+}
+
+// waits returns the waits of the channel, nil if the executor has no channel
+func (ex *Executor) waits() *wait.Session {
+	if ex.ch == nil {
+		return nil
+	}
+
+	return ex.ch.Waits
+}
+
+// next returns the next row of a table iterator, counting its bytes against the query the channel is executing
+// An error is returned once the query is cancelled by the resource watchdog or read more than a query can
+func (ex *Executor) next(iter *catalog.Iterator) (map[string]interface{}, error) {
+	row, err := iter.Next()
+	if err != nil || ex.ch == nil {
+		return row, err
+	}
+
+	query := ex.ch.Query()
+	if query == nil {
+		return row, nil
+	}
+
+	read := query.Read(rowSize(row))
+
+	if ex.aria.Config.Watchdog != nil && ex.aria.Config.Watchdog.MaxQueryBytes > 0 && read > ex.aria.Config.Watchdog.MaxQueryBytes {
+		query.Cancel(fmt.Sprintf("read more than %d bytes of rows", ex.aria.Config.Watchdog.MaxQueryBytes))
+	}
+
+	return row, query.Err()
+}
+
+// rowSize returns an estimate of the bytes a row takes in memory
+func rowSize(row map[string]interface{}) int64 {
+	size := int64(0)
+
+	for column, value := range row {
+		size += int64(len(column))
+
+		switch v := value.(type) {
+		case string:
+			size += int64(len(v))
+		case []byte:
+			size += int64(len(v))
+		default:
+			size += 8
+		}
+	}
+
+	return size
+}
+
+// notify sends a notification to the channels listening on its notification channel
+func (ex *Executor) notify(s *parser.NotifyStmt) error {
+	payload := ""
+	if s.Payload != nil {
+		payload = s.Payload.Value.(string)
+	}
+
+	return ex.aria.Notify(ex.ch, s.Channel.Value, payload)
+}
+
+// recordChanges records changed rows of a table in edge sync mode and notifies webhooks of them
+// operation is INSERT, UPDATE or DELETE
+func (ex *Executor) recordChanges(tbl *catalog.Table, operation string, rows []map[string]interface{}) error {
+	ex.rows += len(rows)
+
+	if ex.recover {
+		return nil
+	}
+
+	ex.aria.Written(ex.ch.Database.Name, tbl.Name)
+
+	change := &rowChange{database: ex.ch.Database.Name, table: tbl.Name, operation: operation, rows: rows}
+
+	// Within a transaction the rows are recorded on commit and discarded on rollback
+	if ex.TransactionBegun {
+		ex.Transaction.changes = append(ex.Transaction.changes, change)
+		return nil
+	}
+
+	return ex.emitChange(change)
+}
+
+// emitChange hands the rows of a commited change to the webhooks and records them to sync in edge sync mode
+func (ex *Executor) emitChange(change *rowChange) error {
+	if ex.aria.Notifier != nil {
+		ex.aria.Notifier.Notify(change.database, change.table, change.operation, change.rows)
+	}
+
+	if ex.aria.ChangeLog == nil {
+		return nil
+	}
+
+	for _, row := range change.rows {
+		err := ex.aria.ChangeLog.RecordChange(change.database, change.table, change.operation == "DELETE", row)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 // SetRecover sets the recover flag
 func (ex *Executor) SetRecover(rec bool) {
 	ex.recover = rec
 }
 
+// SetSource sets the clock and random numbers statements are executed with, nil for the ones of the server
+func (ex *Executor) SetSource(source *shared.Source) {
+	ex.source = source
+}
+
+// currentUser returns the user privileges are checked against, the definer within a SECURITY DEFINER procedure
+func (ex *Executor) currentUser() *catalog.User {
+	if ex.definer != nil {
+		return ex.definer
+	}
+
+	return ex.ch.User
+}
+
 // GetResultSet returns the result set buffer
 func (ex *Executor) GetResultSet() []byte {
 	return ex.ResultSetBuffer
 }
 
+// Rows returns the amount of rows returned or changed by the statement executed last
+func (ex *Executor) Rows() int {
+	return ex.rows
+}
+
 // SetJsonOutput sets the json output flag
 func (ex *Executor) SetJsonOutput(jsonOutput bool) {
 	ex.json = jsonOutput
 }
+
+// SetContext sets the context of the query executed next, its span is the parent of the spans of execution
+func (ex *Executor) SetContext(ctx context.Context) {
+	ex.ctx = ctx
+}
+
+// startSpan starts a span of a statement or operator, spans started until the returned func is called are its children
+func (ex *Executor) startSpan(name string, attrs ...attribute.KeyValue) func(err error) {
+	parent := ex.ctx
+	if parent == nil {
+		parent = context.Background()
+	}
+
+	ctx, span := tracing.Start(parent, name, attrs...)
+	ex.ctx = ctx
+
+	// The statement span is logged by the statement trace, operators by the plan trace
+	plan := ex.ch != nil && ex.ch.Tracing(core.TRACE_PLAN) && ex.spans > 0
+	started := time.Now()
+	ex.spans++
+
+	return func(err error) {
+		span.End(err)
+		ex.ctx = parent
+		ex.spans--
+
+		if plan {
+			operator := name
+			for _, attr := range attrs {
+				if attr.Value.Type() == attribute.STRINGSLICE {
+					operator += " " + strings.Join(attr.Value.AsStringSlice(), ",")
+				} else {
+					operator += " " + attr.Value.Emit()
+				}
+			}
+
+			ex.trace(core.TRACE_PLAN, "%s%s took %s", strings.Repeat("  ", ex.spans-1), operator, time.Since(started))
+		}
+	}
+}
+
+// tableSettings returns the table defaults with the settings of a WITH clause applied, unknown settings are an error
+func tableSettings(settings parser.Settings, defaults catalog.DatabaseSettings) (catalog.DatabaseSettings, error) {
+	for name, value := range settings {
+		switch name {
+		case "compress", "encrypt":
+			b, ok := value.Value.(bool)
+			if !ok {
+				return defaults, fmt.Errorf("setting %s must be true or false", name)
+			}
+
+			if name == "compress" {
+				defaults.Compress = b
+			} else {
+				defaults.Encrypt = b
+			}
+		case "collation":
+			c, ok := value.Value.(string)
+			if !ok {
+				return defaults, errors.New("setting collation must be a string")
+			}
+
+			// An empty collation is binary
+			if c != "" {
+				_, err := collation.Lookup(c)
+				if err != nil {
+					return defaults, err
+				}
+			}
+
+			defaults.Collation = c
+		default:
+			return defaults, fmt.Errorf("unknown setting %s, expected compress, encrypt or collation", name)
+		}
+	}
+
+	return defaults, nil
+}
+
+// trace logs debug output of the session to the server log with the session id
+func (ex *Executor) trace(option, format string, args ...interface{}) {
+	log.Printf("session %d: %s: %s", ex.ch.ChannelID, option, fmt.Sprintf(format, args...))
+}
+
+// traceStatement logs a statement executed by the session with the debug output enabled with SET trace
+func (ex *Executor) traceStatement(stmt parser.Statement, took time.Duration, stats storage.IOStats, err error) {
+	text := tracing.Operation(stmt)
+	if query := ex.ch.Query(); query != nil {
+		text = query.Text
+	}
+
+	if ex.ch.Tracing(core.TRACE_STATEMENT) {
+		if err != nil {
+			ex.trace(core.TRACE_STATEMENT, "%s failed after %s: %s", text, took, err.Error())
+		} else {
+			ex.trace(core.TRACE_STATEMENT, "%s returned or changed %d row(s) in %s", text, ex.rows, took)
+		}
+	}
+
+	// The counters are of the process, with concurrent queries IO of other queries is included
+	if ex.ch.Tracing(core.TRACE_IO) {
+		ex.trace(core.TRACE_IO, "%s read %d time(s) %d bytes, wrote %d time(s) %d bytes, synced %d time(s)", text, stats.Reads, stats.BytesRead, stats.Writes, stats.BytesWritten, stats.Syncs)
+	}
+}
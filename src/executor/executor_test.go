@@ -18,14 +18,35 @@ package executor
 
 import (
 	"ariasql/catalog"
+	"ariasql/checkpoint"
 	"ariasql/core"
+	"ariasql/fault"
 	"ariasql/parser"
+	"ariasql/wait"
 	"ariasql/wal"
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/parquet-go/parquet-go"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace/noop"
+	"io"
 	"log"
 	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
 	"sync"
+	"syscall"
 	"testing"
+	"time"
 )
 
 func TestNew(t *testing.T) {
@@ -18490,3 +18511,5464 @@ func TestStmt99(t *testing.T) {
 
 	log.Println(string(ex.ResultSetBuffer))
 }
+
+func TestStmt100(t *testing.T) {
+	defer os.RemoveAll("./test/")
+
+	// Create a new AriaSQL instance
+	aria, err := core.New(&core.Config{
+		DataDir: "./test",
+	})
+	if err != nil {
+		t.Fatal(err)
+		return
+
+	}
+
+	aria.Catalog = catalog.New(aria.Config.DataDir)
+
+	if err := aria.Catalog.Open(); err != nil {
+		t.Fatal(err)
+		return
+	}
+
+	defer aria.Close()
+
+	aria.Channels = make([]*core.Channel, 0)
+	aria.ChannelsLock = &sync.Mutex{}
+
+	user := aria.Catalog.GetUser("admin")
+
+	ch := aria.OpenChannel(user)
+	ex := New(aria, ch)
+	ex.SetJsonOutput(true)
+
+	for _, stmt := range []string{
+		"CREATE DATABASE test;",
+		"USE test;",
+		"CREATE TABLE orders (order_id INT NOT NULL UNIQUE, customer CHAR(32), amount DECIMAL(10,2), ordered DATE, paid BOOLEAN);",
+		"INSERT INTO orders (order_id, customer, amount, ordered, paid) VALUES (1, 'alex', 10.25, '2024-05-01', true), (2, 'jane', 20.50, '2024-05-02', false), (3, 'alex', 5.75, '2024-05-03', true);",
+		"EXPORT TABLE orders TO 'orders.parquet' ROW GROUP SIZE 2;",
+		"EXPORT QUERY SELECT customer, amount FROM orders WHERE customer = 'alex' TO 'reports/alex.parquet';",
+	} {
+		lexer := parser.NewLexer([]byte(stmt))
+		t.Log(stmt)
+
+		p := parser.NewParser(lexer)
+		ast, err := p.Parse()
+		if err != nil {
+			t.Fatal(err)
+			return
+		}
+
+		err = ex.Execute(ast)
+		if err != nil {
+			t.Fatal(err)
+			return
+		}
+
+		if strings.HasPrefix(stmt, "EXPORT TABLE") && string(ex.ResultSetBuffer) != `[{"RowsExported":3}]` {
+			t.Fatalf("expected 3 exported rows, got %s", string(ex.ResultSetBuffer))
+		}
+
+		ex.Clear()
+	}
+
+	for file, expect := range map[string][]string{
+		"./test/exports/orders.parquet":       {"amount", "customer", "order_id", "ordered", "paid"},
+		"./test/exports/reports/alex.parquet": {"amount", "customer"},
+	} {
+		f, err := os.Open(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		info, err := f.Stat()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		pf, err := parquet.OpenFile(f, info.Size())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		columns := make([]string, 0)
+		for _, field := range pf.Schema().Fields() {
+			columns = append(columns, field.Name())
+		}
+
+		if strings.Join(columns, ",") != strings.Join(expect, ",") {
+			t.Fatalf("expected columns %v, got %v", expect, columns)
+		}
+
+		if file == "./test/exports/orders.parquet" && (pf.NumRows() != 3 || len(pf.RowGroups()) != 2) {
+			t.Fatalf("expected 3 rows in 2 row groups, got %d rows in %d row groups", pf.NumRows(), len(pf.RowGroups()))
+		}
+
+		if file == "./test/exports/reports/alex.parquet" && pf.NumRows() != 2 {
+			t.Fatalf("expected 2 rows, got %d", pf.NumRows())
+		}
+
+		f.Close()
+	}
+
+	// Exports cannot leave the exports directory
+	p := parser.NewParser(parser.NewLexer([]byte("EXPORT TABLE orders TO '../orders.parquet';")))
+	ast, err := p.Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = ex.Execute(ast)
+	if err == nil {
+		t.Fatal("expected error exporting outside the exports directory")
+	}
+}
+
+func TestStmt101(t *testing.T) {
+	defer os.RemoveAll("./test/")
+
+	// Create a new AriaSQL instance
+	aria, err := core.New(&core.Config{
+		DataDir: "./test",
+	})
+	if err != nil {
+		t.Fatal(err)
+		return
+
+	}
+
+	aria.Catalog = catalog.New(aria.Config.DataDir)
+
+	if err := aria.Catalog.Open(); err != nil {
+		t.Fatal(err)
+		return
+	}
+
+	defer aria.Close()
+
+	aria.Channels = make([]*core.Channel, 0)
+	aria.ChannelsLock = &sync.Mutex{}
+
+	user := aria.Catalog.GetUser("admin")
+
+	listener := aria.OpenChannel(user)
+	listenerEx := New(aria, listener)
+
+	notifier := aria.OpenChannel(user)
+	notifierEx := New(aria, notifier)
+
+	execute := func(ex *Executor, stmt string) {
+		lexer := parser.NewLexer([]byte(stmt))
+		t.Log(stmt)
+
+		p := parser.NewParser(lexer)
+		ast, err := p.Parse()
+		if err != nil {
+			t.Fatal(err)
+			return
+		}
+
+		err = ex.Execute(ast)
+		if err != nil {
+			t.Fatal(err)
+			return
+		}
+	}
+
+	execute(listenerEx, "LISTEN jobs;")
+	execute(listenerEx, "LISTEN cache;")
+
+	execute(notifierEx, "NOTIFY jobs, 'job 1';")
+	execute(notifierEx, "NOTIFY other, 'ignored';")
+
+	// Notifications within a transaction are sent on commit and discarded on rollback
+	execute(notifierEx, "CREATE DATABASE test;")
+	execute(notifierEx, "USE test;")
+	execute(notifierEx, "BEGIN;")
+	execute(notifierEx, "NOTIFY cache, 'rolled back';")
+	execute(notifierEx, "ROLLBACK;")
+	execute(notifierEx, "BEGIN;")
+	execute(notifierEx, "NOTIFY cache;")
+
+	if len(listener.Notifications) != 1 {
+		t.Fatalf("expected 1 notification before commit, got %d", len(listener.Notifications))
+	}
+
+	execute(notifierEx, "COMMIT;")
+
+	execute(listenerEx, "UNLISTEN *;")
+	execute(notifierEx, "NOTIFY jobs, 'job 2';")
+
+	expected := []*core.Notification{
+		{Channel: "jobs", Payload: "job 1", Sender: notifier.ChannelID},
+		{Channel: "cache", Payload: "", Sender: notifier.ChannelID},
+	}
+
+	if len(listener.Notifications) != len(expected) {
+		t.Fatalf("expected %d notifications, got %d", len(expected), len(listener.Notifications))
+	}
+
+	for _, e := range expected {
+		n := <-listener.Notifications
+		if *n != *e {
+			t.Fatalf("expected %v, got %v", e, n)
+		}
+	}
+
+	if len(notifier.Notifications) != 0 {
+		t.Fatalf("expected no notifications for the notifier, got %d", len(notifier.Notifications))
+	}
+}
+
+func TestStmt102(t *testing.T) {
+	defer os.RemoveAll("./test/")
+
+	// Record the spans of execution
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	defer otel.SetTracerProvider(noop.NewTracerProvider())
+
+	// Create a new AriaSQL instance
+	aria, err := core.New(&core.Config{
+		DataDir: "./test",
+	})
+	if err != nil {
+		t.Fatal(err)
+		return
+
+	}
+
+	aria.Catalog = catalog.New(aria.Config.DataDir)
+
+	if err := aria.Catalog.Open(); err != nil {
+		t.Fatal(err)
+		return
+	}
+
+	defer aria.Close()
+
+	aria.Channels = make([]*core.Channel, 0)
+	aria.ChannelsLock = &sync.Mutex{}
+
+	ex := New(aria, aria.OpenChannel(aria.Catalog.GetUser("admin")))
+
+	stmts := []string{
+		"CREATE DATABASE test;",
+		"USE test;",
+		"CREATE TABLE users (user_id INT NOT NULL UNIQUE, name CHAR(255));",
+		"INSERT INTO users (user_id, name) VALUES (1, 'john'), (2, 'jane');",
+		"SELECT * FROM users;",
+		"SELECT name FROM users WHERE user_id = 2 ORDER BY name DESC;",
+	}
+
+	for _, stmt := range stmts {
+		lexer := parser.NewLexer([]byte(stmt))
+		t.Log(stmt)
+
+		p := parser.NewParser(lexer)
+		ast, err := p.Parse()
+		if err != nil {
+			t.Fatal(err)
+			return
+		}
+
+		err = ex.Execute(ast)
+		if err != nil {
+			t.Fatal(err)
+			return
+		}
+
+		ex.Clear()
+	}
+
+	// Execution spans are children of the span of the query set on the executor
+	ctx, query := otel.Tracer("test").Start(context.Background(), "query")
+	ex.SetContext(ctx)
+
+	lexer := parser.NewLexer([]byte("SELECT * FROM nope;"))
+	ast, err := parser.NewParser(lexer).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = ex.Execute(ast)
+	if err == nil {
+		t.Fatal("expected error")
+	}
+
+	query.End()
+
+	spans := make(map[string][]sdktrace.ReadOnlySpan)
+	for _, span := range recorder.Ended() {
+		spans[span.Name()] = append(spans[span.Name()], span)
+	}
+
+	for name, count := range map[string]int{"execute CREATE DATABASE": 1, "execute USE": 1, "execute INSERT": 1, "execute SELECT": 3, "full scan": 1, "filter": 1, "index lookup": 1, "project": 2, "sort": 1} {
+		if len(spans[name]) != count {
+			t.Fatalf("expected %d %s spans, got %d", count, name, len(spans[name]))
+		}
+	}
+
+	// Operators are children of the statement they are executed for
+	lookup := spans["index lookup"][0]
+	if lookup.Parent().SpanID() != spans["filter"][0].SpanContext().SpanID() {
+		t.Fatal("expected index lookup to be a child of filter")
+	}
+
+	if spans["filter"][0].Parent().SpanID() != spans["execute SELECT"][1].SpanContext().SpanID() {
+		t.Fatal("expected filter to be a child of the second select")
+	}
+
+	failed := spans["execute SELECT"][2]
+	if failed.Parent().SpanID() != query.SpanContext().SpanID() || failed.Status().Code != codes.Error {
+		t.Fatalf("expected failed select within query with an error status, got %v", failed.Status())
+	}
+
+	for _, attr := range spans["execute INSERT"][0].Attributes() {
+		if attr.Key == "ariasql.io.writes" && attr.Value.AsInt64() == 0 {
+			t.Fatal("expected insert to write")
+		}
+	}
+}
+
+func TestStmt103(t *testing.T) {
+	defer os.RemoveAll("./test/")
+
+	// Create a new AriaSQL instance
+	aria, err := core.New(&core.Config{
+		DataDir: "./test",
+	})
+	if err != nil {
+		t.Fatal(err)
+		return
+
+	}
+
+	aria.Catalog = catalog.New(aria.Config.DataDir)
+
+	if err := aria.Catalog.Open(); err != nil {
+		t.Fatal(err)
+		return
+	}
+
+	defer aria.Close()
+
+	aria.Channels = make([]*core.Channel, 0)
+	aria.ChannelsLock = &sync.Mutex{}
+
+	ex := New(aria, aria.OpenChannel(aria.Catalog.GetUser("admin")))
+	ex.SetJsonOutput(true)
+
+	execute := func(stmt string) []map[string]interface{} {
+		lexer := parser.NewLexer([]byte(stmt))
+		t.Log(stmt)
+
+		p := parser.NewParser(lexer)
+		ast, err := p.Parse()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = ex.Execute(ast)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var rows []map[string]interface{}
+		if len(ex.GetResultSet()) > 0 {
+			err = json.Unmarshal(ex.GetResultSet(), &rows)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		ex.Clear()
+
+		return rows
+	}
+
+	// The information schema is read without a database selected
+	if rows := execute("SELECT * FROM information_schema.table_io_stats;"); len(rows) != 0 {
+		t.Fatalf("expected no rows, got %v", rows)
+	}
+
+	execute("CREATE DATABASE test;")
+	execute("USE test;")
+	execute("CREATE TABLE users (user_id INT NOT NULL UNIQUE, name CHAR(255));")
+	execute("CREATE TABLE orders (order_id INT NOT NULL UNIQUE);")
+	execute("INSERT INTO users (user_id, name) VALUES (1, 'john'), (2, 'jane');")
+	execute("SELECT * FROM users WHERE user_id = 2;")
+
+	rows := execute("SELECT * FROM information_schema.table_io_stats;")
+	if len(rows) != 4 {
+		t.Fatalf("expected 2 tables and 2 indexes, got %v", rows)
+	}
+
+	rows = execute("SELECT table_name, index_name, writes, reads FROM information_schema.table_io_stats WHERE table_name = 'users' ORDER BY writes DESC;")
+	if len(rows) != 2 {
+		t.Fatalf("expected the table and index of users, got %v", rows)
+	}
+
+	for _, row := range rows {
+		if row["table_name"] != "users" || row["writes"].(float64) == 0 || row["reads"].(float64) == 0 {
+			t.Fatalf("expected reads and writes of users, got %v", row)
+		}
+	}
+
+	rows = execute("SELECT table_name FROM information_schema.table_io_stats WHERE writes > 0 AND index_name IS NULL;")
+	if len(rows) != 1 || rows[0]["table_name"] != "users" {
+		t.Fatalf("expected users, got %v", rows)
+	}
+
+	execute("RESET STATISTICS;")
+
+	rows = execute("SELECT table_name FROM information_schema.table_io_stats WHERE writes > 0;")
+	if len(rows) != 0 {
+		t.Fatalf("expected no writes after reset, got %v", rows)
+	}
+
+	lexer := parser.NewLexer([]byte("SELECT * FROM information_schema.nope;"))
+	ast, err := parser.NewParser(lexer).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = ex.Execute(ast)
+	if err == nil {
+		t.Fatal("expected error for unknown view")
+	}
+}
+
+func TestStmt104(t *testing.T) {
+	defer os.RemoveAll("./test/")
+
+	// Create a new AriaSQL instance
+	aria, err := core.New(&core.Config{
+		DataDir: "./test",
+	})
+	if err != nil {
+		t.Fatal(err)
+		return
+
+	}
+
+	aria.Catalog = catalog.New(aria.Config.DataDir)
+
+	if err := aria.Catalog.Open(); err != nil {
+		t.Fatal(err)
+		return
+	}
+
+	defer aria.Close()
+
+	aria.Channels = make([]*core.Channel, 0)
+	aria.ChannelsLock = &sync.Mutex{}
+
+	err = aria.Catalog.CreateNewUser("alex", "changeme")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	admin := aria.OpenChannel(aria.Catalog.GetUser("admin"))
+	alex := aria.OpenChannel(aria.Catalog.GetUser("alex"))
+
+	ex := New(aria, admin)
+	ex.SetJsonOutput(true)
+
+	execute := func(ex *Executor, stmt string) ([]map[string]interface{}, error) {
+		lexer := parser.NewLexer([]byte(stmt))
+		t.Log(stmt)
+
+		p := parser.NewParser(lexer)
+		ast, err := p.Parse()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = ex.Execute(ast)
+		if err != nil {
+			return nil, err
+		}
+
+		var rows []map[string]interface{}
+		if len(ex.GetResultSet()) > 0 {
+			err = json.Unmarshal(ex.GetResultSet(), &rows)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		ex.Clear()
+
+		return rows, nil
+	}
+
+	// Writing to the WAL is waited on by the session
+	_, err = execute(ex, "CREATE DATABASE test;")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// alex is waiting for its client
+	end := alex.Waits.Begin(wait.CLIENT_READ)
+
+	rows, err := execute(ex, "SELECT session_id, event, waits FROM sys.session_waits WHERE event = 'wal write';")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(rows) != 1 || rows[0]["session_id"].(float64) != float64(admin.ChannelID) || rows[0]["waits"].(float64) != 1 {
+		t.Fatalf("expected 1 wal write of admin, got %v", rows)
+	}
+
+	rows, err = execute(ex, "SELECT * FROM sys.session_waits WHERE waiting = 1;")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(rows) != 1 || rows[0]["user_name"] != "alex" || rows[0]["event"] != "client read" || rows[0]["waits"].(float64) != 0 {
+		t.Fatalf("expected alex waiting on client read, got %v", rows)
+	}
+
+	end()
+
+	// Users without the SHOW privilege only see their own sessions
+	exAlex := New(aria, alex)
+	exAlex.SetJsonOutput(true)
+
+	rows, err = execute(exAlex, "SELECT user_name, waits FROM sys.session_waits;")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(rows) != 1 || rows[0]["user_name"] != "alex" || rows[0]["waits"].(float64) != 1 {
+		t.Fatalf("expected the finished client read of alex, got %v", rows)
+	}
+
+	_, err = execute(exAlex, "SHOW ENGINE STATUS;")
+	if err == nil {
+		t.Fatal("expected error without SHOW privilege")
+	}
+
+	rows, err = execute(ex, "SHOW ENGINE STATUS;")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(rows) != int(wait.EVENTS) {
+		t.Fatalf("expected a row per event, got %v", rows)
+	}
+
+	for _, row := range rows {
+		if (row["Event"] == "wal write" || row["Event"] == "client read") && row["Waits"].(float64) < 1 {
+			t.Fatalf("expected waits on %s, got %v", row["Event"], row)
+		}
+	}
+
+	_, err = execute(ex, "SELECT * FROM sys.nope;")
+	if err == nil {
+		t.Fatal("expected error for unknown view")
+	}
+}
+
+func TestStmt105(t *testing.T) {
+	defer os.RemoveAll("./test/")
+
+	// Create a new AriaSQL instance
+	aria, err := core.New(&core.Config{
+		DataDir: "./test",
+	})
+	if err != nil {
+		t.Fatal(err)
+		return
+
+	}
+
+	aria.Catalog = catalog.New(aria.Config.DataDir)
+
+	if err := aria.Catalog.Open(); err != nil {
+		t.Fatal(err)
+		return
+	}
+
+	defer aria.Close()
+
+	aria.Channels = make([]*core.Channel, 0)
+	aria.ChannelsLock = &sync.Mutex{}
+
+	err = aria.Catalog.CreateNewUser("alex", "changeme")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	admin := aria.OpenChannel(aria.Catalog.GetUser("admin"))
+	alex := aria.OpenChannel(aria.Catalog.GetUser("alex"))
+
+	ex := New(aria, admin)
+	ex.SetJsonOutput(true)
+
+	// Statements are recorded the way the server records them
+	execute := func(ex *Executor, ch *core.Channel, stmt string) []map[string]interface{} {
+		lexer := parser.NewLexer([]byte(stmt))
+		t.Log(stmt)
+
+		p := parser.NewParser(lexer)
+		ast, err := p.Parse()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		database := ""
+		if ch.Database != nil {
+			database = ch.Database.Name
+		}
+
+		err = ex.Execute(ast)
+		aria.Statements.Record([]byte(stmt), database, ch.User.Username, time.Millisecond, ex.Rows(), err)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var rows []map[string]interface{}
+		if len(ex.GetResultSet()) > 0 {
+			err = json.Unmarshal(ex.GetResultSet(), &rows)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		ex.Clear()
+
+		return rows
+	}
+
+	execute(ex, admin, "CREATE DATABASE test;")
+	execute(ex, admin, "USE test;")
+	execute(ex, admin, "CREATE TABLE users (user_id INT NOT NULL UNIQUE, name CHAR(255));")
+	execute(ex, admin, "INSERT INTO users (user_id, name) VALUES (1, 'john'), (2, 'jane');")
+	execute(ex, admin, "INSERT INTO users (user_id, name) VALUES (3, 'jim');")
+
+	if ex.Rows() != 1 {
+		t.Fatalf("expected 1 row inserted, got %d", ex.Rows())
+	}
+
+	execute(ex, admin, "SELECT * FROM users WHERE user_id > 1;")
+	execute(ex, admin, "SELECT * FROM users WHERE user_id > 2;")
+
+	if ex.Rows() != 1 {
+		t.Fatalf("expected 1 row selected, got %d", ex.Rows())
+	}
+
+	exAlex := New(aria, alex)
+	exAlex.SetJsonOutput(true)
+	execute(exAlex, alex, "SELECT * FROM sys.session_waits;")
+
+	rows := execute(ex, admin, "SELECT query, database_name, calls, rows FROM sys.statement_stats WHERE query = 'INSERT INTO users (user_id, name) VALUES (...)';")
+	if len(rows) != 1 || rows[0]["database_name"] != "test" || rows[0]["calls"].(float64) != 2 || rows[0]["rows"].(float64) != 3 {
+		t.Fatalf("expected 2 inserts of 3 rows, got %v", rows)
+	}
+
+	rows = execute(ex, admin, "SELECT calls, rows FROM sys.statement_stats WHERE query = 'SELECT * FROM users WHERE user_id > ?';")
+	if len(rows) != 1 || rows[0]["calls"].(float64) != 2 || rows[0]["rows"].(float64) != 3 {
+		t.Fatalf("expected 2 selects of 3 rows, got %v", rows)
+	}
+
+	// Users without the SHOW privilege only see their own statements
+	rows = execute(exAlex, alex, "SELECT query, user_name, database_name FROM sys.statement_stats;")
+	if len(rows) != 1 || rows[0]["query"] != "SELECT * FROM sys.session_waits" || rows[0]["user_name"] != "alex" || rows[0]["database_name"] != nil {
+		t.Fatalf("expected the statement of alex, got %v", rows)
+	}
+
+	execute(ex, admin, "RESET STATISTICS;")
+
+	// The reset itself is recorded once it executed
+	rows = execute(ex, admin, "SELECT query FROM sys.statement_stats;")
+	if len(rows) != 1 || rows[0]["query"] != "RESET STATISTICS" {
+		t.Fatalf("expected only the reset after reset, got %v", rows)
+	}
+}
+
+func TestStmt106(t *testing.T) {
+	defer os.RemoveAll("./test/")
+
+	// Create a new AriaSQL instance
+	aria, err := core.New(&core.Config{
+		DataDir: "./test",
+	})
+	if err != nil {
+		t.Fatal(err)
+		return
+
+	}
+
+	aria.Catalog = catalog.New(aria.Config.DataDir)
+	aria.Catalog.FlashbackRetention = time.Hour
+
+	if err := aria.Catalog.Open(); err != nil {
+		t.Fatal(err)
+		return
+	}
+
+	defer aria.Close()
+
+	aria.Channels = make([]*core.Channel, 0)
+	aria.ChannelsLock = &sync.Mutex{}
+
+	ex := New(aria, aria.OpenChannel(aria.Catalog.GetUser("admin")))
+	ex.SetJsonOutput(true)
+
+	execute := func(stmt string) ([]map[string]interface{}, error) {
+		lexer := parser.NewLexer([]byte(stmt))
+		t.Log(stmt)
+
+		p := parser.NewParser(lexer)
+		ast, err := p.Parse()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		defer ex.Clear()
+
+		err = ex.Execute(ast)
+		if err != nil {
+			return nil, err
+		}
+
+		var rows []map[string]interface{}
+		if len(ex.GetResultSet()) > 0 {
+			err = json.Unmarshal(ex.GetResultSet(), &rows)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		return rows, nil
+	}
+
+	for _, stmt := range []string{
+		"CREATE DATABASE test;",
+		"USE test;",
+		"CREATE TABLE users (user_id INT NOT NULL UNIQUE, name CHAR(255));",
+		"CREATE TABLE posts (post_id INT NOT NULL UNIQUE, user_id INT);",
+		"INSERT INTO users (user_id, name) VALUES (1, 'john'), (2, 'jane');",
+	} {
+		_, err = execute(stmt)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Timestamps are to the second
+	time.Sleep(1100 * time.Millisecond)
+	before := time.Now().Format("2006-01-02 15:04:05")
+	time.Sleep(1100 * time.Millisecond)
+
+	for _, stmt := range []string{
+		"UPDATE users SET name = 'johnny' WHERE user_id = 1;",
+		"DELETE FROM users WHERE user_id = 2;",
+		"INSERT INTO users (user_id, name) VALUES (3, 'jim');",
+	} {
+		_, err = execute(stmt)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	rows, err := execute("SELECT * FROM users AS OF TIMESTAMP '" + before + "' ORDER BY user_id ASC;")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(rows) != 2 || rows[0]["name"] != "john" || rows[1]["name"] != "jane" {
+		t.Fatalf("expected john and jane, got %v", rows)
+	}
+
+	rows, err = execute("SELECT name FROM users AS OF TIMESTAMP '" + before + "' WHERE user_id = 2;")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(rows) != 1 || rows[0]["name"] != "jane" {
+		t.Fatalf("expected jane, got %v", rows)
+	}
+
+	rows, err = execute("SELECT * FROM users ORDER BY user_id ASC;")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(rows) != 2 || rows[0]["name"] != "johnny" || rows[1]["name"] != "jim" {
+		t.Fatalf("expected johnny and jim, got %v", rows)
+	}
+
+	_, err = execute("SELECT * FROM users AS OF TIMESTAMP '" + before + "', posts;")
+	if err == nil || err.Error() != "AS OF is only supported when selecting from a single table" {
+		t.Fatalf("expected error for a join, got %v", err)
+	}
+
+	_, err = execute("SELECT * FROM users AS OF TIMESTAMP '2000-01-01 00:00:00';")
+	if err == nil {
+		t.Fatal("expected error for a timestamp outside the retention window")
+	}
+}
+
+func TestStmt107(t *testing.T) {
+	defer os.RemoveAll("./test/")
+
+	// Create a new AriaSQL instance
+	aria, err := core.New(&core.Config{
+		DataDir: "./test",
+	})
+	if err != nil {
+		t.Fatal(err)
+		return
+
+	}
+
+	aria.Catalog = catalog.New(aria.Config.DataDir)
+
+	if err := aria.Catalog.Open(); err != nil {
+		t.Fatal(err)
+		return
+	}
+
+	defer aria.Close()
+
+	aria.Channels = make([]*core.Channel, 0)
+	aria.ChannelsLock = &sync.Mutex{}
+
+	ex := New(aria, aria.OpenChannel(aria.Catalog.GetUser("admin")))
+	ex.SetJsonOutput(true)
+
+	execute := func(stmt string) ([]map[string]interface{}, error) {
+		lexer := parser.NewLexer([]byte(stmt))
+		t.Log(stmt)
+
+		p := parser.NewParser(lexer)
+		ast, err := p.Parse()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		defer ex.Clear()
+
+		err = ex.Execute(ast)
+		if err != nil {
+			return nil, err
+		}
+
+		var rows []map[string]interface{}
+		if len(ex.GetResultSet()) > 0 {
+			err = json.Unmarshal(ex.GetResultSet(), &rows)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		return rows, nil
+	}
+
+	for _, stmt := range []string{
+		"CREATE DATABASE test;",
+		"USE test;",
+		"CREATE TABLE accounts (account_id INT NOT NULL UNIQUE, balance INT) WITH SYSTEM VERSIONING;",
+		"CREATE TABLE users (user_id INT NOT NULL UNIQUE, name CHAR(255));",
+		"INSERT INTO accounts (account_id, balance) VALUES (1, 100), (2, 200);",
+	} {
+		_, err = execute(stmt)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Timestamps are to the second
+	time.Sleep(1100 * time.Millisecond)
+	before := time.Now().Format("2006-01-02 15:04:05")
+	time.Sleep(1100 * time.Millisecond)
+
+	for _, stmt := range []string{
+		"UPDATE accounts SET balance = 150 WHERE account_id = 1;",
+		"DELETE FROM accounts WHERE account_id = 2;",
+	} {
+		_, err = execute(stmt)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	after := time.Now().Add(time.Second).Format("2006-01-02 15:04:05")
+
+	// The history is kept without flashback retention configured
+	rows, err := execute("SELECT * FROM accounts FOR SYSTEM_TIME AS OF '" + before + "' ORDER BY account_id ASC;")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(rows) != 2 || rows[0]["balance"].(float64) != 100 || rows[1]["balance"].(float64) != 200 {
+		t.Fatalf("expected the balances before the changes, got %v", rows)
+	}
+
+	rows, err = execute("SELECT balance, system_time_end FROM accounts FOR SYSTEM_TIME BETWEEN '" + before + "' AND '" + after + "' WHERE account_id = 1;")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(rows) != 2 {
+		t.Fatalf("expected 2 versions of account 1, got %v", rows)
+	}
+
+	for _, row := range rows {
+		if row["balance"].(float64) == 150 && row["system_time_end"] != nil {
+			t.Fatalf("expected the current version to have no end, got %v", row)
+		}
+
+		if row["balance"].(float64) == 100 && row["system_time_end"] == nil {
+			t.Fatalf("expected the replaced version to have an end, got %v", row)
+		}
+	}
+
+	_, err = execute("SELECT * FROM users FOR SYSTEM_TIME BETWEEN '" + before + "' AND '" + after + "';")
+	if err == nil || err.Error() != "table users is not system versioned" {
+		t.Fatalf("expected error for a table which is not system versioned, got %v", err)
+	}
+
+	_, err = execute("SELECT * FROM users FOR SYSTEM_TIME AS OF '" + before + "';")
+	if err == nil || err.Error() != "flashback is not enabled" {
+		t.Fatalf("expected error for a table which is not system versioned, got %v", err)
+	}
+}
+
+func TestStmt108(t *testing.T) {
+	defer os.RemoveAll("./test/")
+
+	// Create a new AriaSQL instance
+	aria, err := core.New(&core.Config{
+		DataDir: "./test",
+	})
+	if err != nil {
+		t.Fatal(err)
+		return
+
+	}
+
+	aria.Catalog = catalog.New(aria.Config.DataDir)
+
+	if err := aria.Catalog.Open(); err != nil {
+		t.Fatal(err)
+		return
+	}
+
+	defer aria.Close()
+
+	aria.Channels = make([]*core.Channel, 0)
+	aria.ChannelsLock = &sync.Mutex{}
+
+	err = aria.Catalog.CreateNewUser("alex", "changeme")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ex := New(aria, aria.OpenChannel(aria.Catalog.GetUser("admin")))
+	ex.SetJsonOutput(true)
+
+	execute := func(ex *Executor, stmt string) error {
+		lexer := parser.NewLexer([]byte(stmt))
+		t.Log(stmt)
+
+		p := parser.NewParser(lexer)
+		ast, err := p.Parse()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		defer ex.Clear()
+
+		return ex.Execute(ast)
+	}
+
+	for _, stmt := range []string{
+		"CREATE DATABASE test;",
+		"USE test;",
+		"CREATE TABLE users (user_id INT NOT NULL UNIQUE, name CHAR(255));",
+		"CREATE INDEX idx_name ON users (name);",
+		"INSERT INTO users (user_id, name) VALUES (1, 'john'), (2, 'jane');",
+		"ALTER INDEX idx_name ON users RENAME TO idx_full_name;",
+	} {
+		err = execute(ex, stmt)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tbl := aria.Catalog.GetDatabase("test").GetTable("users")
+	if tbl.GetIndex("idx_name") != nil || tbl.GetIndex("idx_full_name") == nil {
+		t.Fatal("expected index to be renamed")
+	}
+
+	err = execute(ex, "ALTER INDEX idx_name ON users RENAME TO idx_other;")
+	if err == nil || err.Error() != "index idx_name does not exist" {
+		t.Fatalf("expected error for an index which does not exist, got %v", err)
+	}
+
+	// Users need the ALTER privilege on the table
+	exAlex := New(aria, aria.OpenChannel(aria.Catalog.GetUser("alex")))
+
+	err = execute(exAlex, "USE test;")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = execute(exAlex, "ALTER INDEX idx_full_name ON users RENAME TO idx_other;")
+	if err == nil || err.Error() != "user does not have the privilege to ALTER on table users" {
+		t.Fatalf("expected privilege error, got %v", err)
+	}
+
+	err = execute(ex, "DROP INDEX idx_full_name ON users;")
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestStmt109(t *testing.T) {
+	defer os.RemoveAll("./test/")
+
+	// Create a new AriaSQL instance
+	aria, err := core.New(&core.Config{
+		DataDir: "./test",
+	})
+	if err != nil {
+		t.Fatal(err)
+		return
+
+	}
+
+	aria.Catalog = catalog.New(aria.Config.DataDir)
+
+	if err := aria.Catalog.Open(); err != nil {
+		t.Fatal(err)
+		return
+	}
+
+	defer aria.Close()
+
+	aria.Channels = make([]*core.Channel, 0)
+	aria.ChannelsLock = &sync.Mutex{}
+
+	ex := New(aria, aria.OpenChannel(aria.Catalog.GetUser("admin")))
+
+	execute := func(stmt string) (string, error) {
+		lexer := parser.NewLexer([]byte(stmt))
+		t.Log(stmt)
+
+		p := parser.NewParser(lexer)
+		ast, err := p.Parse()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		defer ex.Clear()
+
+		err = ex.Execute(ast)
+
+		return string(ex.GetResultSet()), err
+	}
+
+	for _, stmt := range []string{
+		"CREATE DATABASE test;",
+		"USE test;",
+		"CREATE TABLE users (user_id INT NOT NULL UNIQUE, name CHAR(255));",
+		"INSERT INTO users (user_id, name) VALUES (1, 'john'), (2, 'jane');",
+		"ALTER INDEX unique_user_id ON users INVISIBLE;",
+	} {
+		_, err = execute(stmt)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The optimizer ignores the invisible index
+	result, err := execute("EXPLAIN SELECT * FROM users WHERE user_id = 1;")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Contains(result, "INDEX SCAN") {
+		t.Fatalf("expected no index scan, got %s", result)
+	}
+
+	result, err = execute("SELECT * FROM users WHERE user_id = 2;")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(result, "jane") {
+		t.Fatalf("expected jane, got %s", result)
+	}
+
+	// The invisible index is still maintained and enforces uniqueness
+	_, err = execute("INSERT INTO users (user_id, name) VALUES (2, 'jim');")
+	if err == nil {
+		t.Fatal("expected unique constraint violation")
+	}
+
+	_, err = execute("INSERT INTO users (user_id, name) VALUES (3, 'jim');")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result, err = execute("SHOW INDEXES FROM users;")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(result, "unique_user_id") || !strings.Contains(result, "false") {
+		t.Fatalf("expected invisible index, got %s", result)
+	}
+
+	_, err = execute("ALTER INDEX unique_user_id ON users VISIBLE;")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result, err = execute("EXPLAIN SELECT * FROM users WHERE user_id = 3;")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(result, "INDEX SCAN") {
+		t.Fatalf("expected index scan, got %s", result)
+	}
+
+	result, err = execute("SELECT * FROM users WHERE user_id = 3;")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(result, "jim") {
+		t.Fatalf("expected jim inserted while the index was invisible, got %s", result)
+	}
+}
+
+func TestStmt110(t *testing.T) {
+	defer os.RemoveAll("./test/")
+
+	// Create a new AriaSQL instance
+	aria, err := core.New(&core.Config{
+		DataDir: "./test",
+	})
+	if err != nil {
+		t.Fatal(err)
+		return
+
+	}
+
+	aria.Catalog = catalog.New(aria.Config.DataDir)
+
+	if err := aria.Catalog.Open(); err != nil {
+		t.Fatal(err)
+		return
+	}
+
+	defer aria.Close()
+
+	aria.Channels = make([]*core.Channel, 0)
+	aria.ChannelsLock = &sync.Mutex{}
+
+	ex := New(aria, aria.OpenChannel(aria.Catalog.GetUser("admin")))
+
+	execute := func(stmt string) (string, error) {
+		lexer := parser.NewLexer([]byte(stmt))
+		t.Log(stmt)
+
+		p := parser.NewParser(lexer)
+		ast, err := p.Parse()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		defer ex.Clear()
+
+		err = ex.Execute(ast)
+
+		return string(ex.GetResultSet()), err
+	}
+
+	for _, stmt := range []string{
+		"CREATE DATABASE test;",
+		"USE test;",
+		"CREATE TABLE users (user_id INT NOT NULL UNIQUE, email CHAR(255));",
+	} {
+		_, err = execute(stmt)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Rows spanning two bloom filter segments
+	values := make([]string, 0)
+	for i := 0; i < catalog.BLOOM_SEGMENT_ROWS*2; i++ {
+		values = append(values, "("+strconv.Itoa(i)+", 'user"+strconv.Itoa(i)+"@example.com')")
+	}
+
+	_, err = execute("INSERT INTO users (user_id, email) VALUES " + strings.Join(values, ", ") + ";")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = execute("CREATE BLOOM FILTER bf_email ON users (email);")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := execute("EXPLAIN SELECT * FROM users WHERE email = 'user1500@example.com';")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(result, "BLOOM SCAN") {
+		t.Fatalf("expected bloom scan, got %s", result)
+	}
+
+	// Only the segment holding the row is read
+	if !strings.Contains(result, "| "+strconv.Itoa(catalog.BLOOM_SEGMENT_ROWS)+" ") {
+		t.Fatalf("expected the rows of one segment to be read, got %s", result)
+	}
+
+	result, err = execute("SELECT user_id FROM users WHERE email = 'user1500@example.com';")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(result, "1500") {
+		t.Fatalf("expected user 1500, got %s", result)
+	}
+
+	// Predicates under OR can not prune
+	result, err = execute("SELECT user_id FROM users WHERE email = 'missing' OR user_id = 7;")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(result, "7") {
+		t.Fatalf("expected user 7, got %s", result)
+	}
+
+	_, err = execute("UPDATE users SET email = 'moved@example.com' WHERE user_id = 3;")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result, err = execute("SELECT user_id FROM users WHERE email = 'moved@example.com';")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(result, "3") {
+		t.Fatalf("expected updated user 3, got %s", result)
+	}
+
+	_, err = execute("DROP BLOOM FILTER bf_email ON users;")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result, err = execute("EXPLAIN SELECT * FROM users WHERE email = 'user1500@example.com';")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Contains(result, "BLOOM SCAN") {
+		t.Fatalf("expected no bloom scan once dropped, got %s", result)
+	}
+}
+
+func TestStmt111(t *testing.T) {
+	defer os.RemoveAll("./test/")
+
+	// Create a new AriaSQL instance
+	aria, err := core.New(&core.Config{
+		DataDir: "./test",
+	})
+	if err != nil {
+		t.Fatal(err)
+		return
+
+	}
+
+	aria.Catalog = catalog.New(aria.Config.DataDir)
+
+	if err := aria.Catalog.Open(); err != nil {
+		t.Fatal(err)
+		return
+	}
+
+	defer aria.Close()
+
+	aria.Channels = make([]*core.Channel, 0)
+	aria.ChannelsLock = &sync.Mutex{}
+
+	ex := New(aria, aria.OpenChannel(aria.Catalog.GetUser("admin")))
+
+	execute := func(stmt string) (string, error) {
+		lexer := parser.NewLexer([]byte(stmt))
+		t.Log(stmt)
+
+		p := parser.NewParser(lexer)
+		ast, err := p.Parse()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		defer ex.Clear()
+
+		err = ex.Execute(ast)
+
+		return string(ex.GetResultSet()), err
+	}
+
+	for _, stmt := range []string{
+		"CREATE DATABASE test;",
+		"USE test;",
+		"CREATE TABLE users (user_id INT NOT NULL UNIQUE, email CHAR(255) UNIQUE, name CHAR(255));",
+		"INSERT INTO users (user_id, email, name) VALUES (1, 'john@example.com', 'john');",
+		// NULL is not equal to NULL, a unique column holds any amount of NULLs
+		"INSERT INTO users (user_id, email, name) VALUES (2, NULL, 'jane');",
+		"INSERT INTO users (user_id, name) VALUES (3, 'jim');",
+	} {
+		_, err = execute(stmt)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	_, err = execute("INSERT INTO users (user_id, email, name) VALUES (4, 'john@example.com', 'jack');")
+	if err == nil {
+		t.Fatal("expected unique constraint violation")
+	}
+
+	result, err := execute("EXPLAIN SELECT * FROM users WHERE email IS NULL;")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(result, "INDEX SCAN") {
+		t.Fatalf("expected index scan, got %s", result)
+	}
+
+	result, err = execute("SELECT name FROM users WHERE email IS NULL;")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(result, "jane") || !strings.Contains(result, "jim") || strings.Contains(result, "john") {
+		t.Fatalf("expected jane and jim, got %s", result)
+	}
+
+	result, err = execute("SELECT name FROM users WHERE email IS NOT NULL;")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(result, "john") || strings.Contains(result, "jane") || strings.Contains(result, "jim") {
+		t.Fatalf("expected john, got %s", result)
+	}
+
+	result, err = execute("SELECT name FROM users WHERE email IS NULL AND user_id = 3;")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(result, "jim") || strings.Contains(result, "jane") {
+		t.Fatalf("expected jim, got %s", result)
+	}
+
+	// Rows are no longer under the NULL key once given a value
+	_, err = execute("UPDATE users SET email = 'jane@example.com' WHERE user_id = 2;")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result, err = execute("SELECT name FROM users WHERE email IS NULL;")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(result, "jim") || strings.Contains(result, "jane") {
+		t.Fatalf("expected jim, got %s", result)
+	}
+
+	_, err = execute("DELETE FROM users WHERE email IS NULL;")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result, err = execute("SELECT name FROM users;")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Contains(result, "jim") || !strings.Contains(result, "jane") {
+		t.Fatalf("expected jim to be deleted, got %s", result)
+	}
+}
+
+func TestStmt112(t *testing.T) {
+	defer os.RemoveAll("./test/")
+
+	// Create a new AriaSQL instance
+	aria, err := core.New(&core.Config{
+		DataDir: "./test",
+	})
+	if err != nil {
+		t.Fatal(err)
+		return
+
+	}
+
+	aria.Catalog = catalog.New(aria.Config.DataDir)
+
+	if err := aria.Catalog.Open(); err != nil {
+		t.Fatal(err)
+		return
+	}
+
+	defer aria.Close()
+
+	aria.Channels = make([]*core.Channel, 0)
+	aria.ChannelsLock = &sync.Mutex{}
+
+	err = aria.Catalog.CreateNewUser("alex", "changeme")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The address of a client behind a proxy is the one the proxy reported
+	admin := aria.OpenChannel(aria.Catalog.GetUser("admin"))
+	admin.Address = "203.0.113.7:52100"
+	admin.ApplicationName = "billing"
+	admin.ClientVersion = "2.1.0"
+	admin.Labels = map[string]string{"team": "payments"}
+
+	alex := aria.OpenChannel(aria.Catalog.GetUser("alex"))
+	alex.Address = "198.51.100.23:40022"
+
+	execute := func(ex *Executor, stmt string) (string, error) {
+		lexer := parser.NewLexer([]byte(stmt))
+		t.Log(stmt)
+
+		p := parser.NewParser(lexer)
+		ast, err := p.Parse()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		defer ex.Clear()
+
+		err = ex.Execute(ast)
+
+		return string(ex.GetResultSet()), err
+	}
+
+	result, err := execute(New(aria, admin), "SHOW PROCESSLIST;")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(result, "203.0.113.7:52100") || !strings.Contains(result, "198.51.100.23:40022") {
+		t.Fatalf("expected the addresses of both sessions, got\n%s", result)
+	}
+
+	if !strings.Contains(result, "billing") || !strings.Contains(result, "2.1.0") || !strings.Contains(result, "team=payments") {
+		t.Fatalf("expected the client info of the admin session, got\n%s", result)
+	}
+
+	// Sessions are listed with the SHOW privilege only
+	_, err = execute(New(aria, alex), "SHOW PROCESSLIST;")
+	if err == nil {
+		t.Fatal("expected an error without the SHOW privilege")
+	}
+}
+
+func TestStmt113(t *testing.T) {
+	defer os.RemoveAll("./test/")
+
+	// Create a new AriaSQL instance
+	aria, err := core.New(&core.Config{
+		DataDir: "./test",
+	})
+	if err != nil {
+		t.Fatal(err)
+		return
+
+	}
+
+	aria.Catalog = catalog.New(aria.Config.DataDir)
+
+	if err := aria.Catalog.Open(); err != nil {
+		t.Fatal(err)
+		return
+	}
+
+	defer aria.Close()
+
+	aria.Channels = make([]*core.Channel, 0)
+	aria.ChannelsLock = &sync.Mutex{}
+
+	ex := New(aria, aria.OpenChannel(aria.Catalog.GetUser("admin")))
+	ex.SetJsonOutput(true)
+
+	execute := func(stmt string) (string, error) {
+		lexer := parser.NewLexer([]byte(stmt))
+		t.Log(stmt)
+
+		p := parser.NewParser(lexer)
+		ast, err := p.Parse()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		defer ex.Clear()
+
+		err = ex.Execute(ast)
+
+		return string(ex.GetResultSet()), err
+	}
+
+	for _, stmt := range []string{
+		"CREATE DATABASE test;",
+		"USE test;",
+		"CREATE TABLE words (word_id INT NOT NULL UNIQUE, word CHAR(5), note TEXT);",
+		// Five characters of six bytes fit a CHAR(5)
+		"INSERT INTO words (word_id, word, note) VALUES (1, 'héllo', '日本語');",
+		"UPDATE words SET word = 'naïve' WHERE word_id = 1;",
+	} {
+		_, err = execute(stmt)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	_, err = execute("INSERT INTO words (word_id, word, note) VALUES (2, 'héllos', '');")
+	if err == nil || err.Error() != "column word is too long" {
+		t.Fatalf("expected column word is too long, got %v", err)
+	}
+
+	result, err := execute("SELECT word, note, LENGTH(note) AS note_length FROM words WHERE word_id = 1;")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Strings are returned as they were sent, not re-encoded byte by byte
+	expected := `[{"word":"naïve","note":"日本語","note_length":3}]`
+	if strings.TrimSpace(result) != expected {
+		t.Fatalf("expected %s, got %s", expected, result)
+	}
+}
+
+func TestStmt114(t *testing.T) {
+	defer os.RemoveAll("./test/")
+
+	// Create a new AriaSQL instance
+	aria, err := core.New(&core.Config{
+		DataDir:      "./test",
+		MaxRecursion: 10,
+	})
+	if err != nil {
+		t.Fatal(err)
+		return
+
+	}
+
+	aria.Catalog = catalog.New(aria.Config.DataDir)
+
+	if err := aria.Catalog.Open(); err != nil {
+		t.Fatal(err)
+		return
+	}
+
+	defer aria.Close()
+
+	aria.Channels = make([]*core.Channel, 0)
+	aria.ChannelsLock = &sync.Mutex{}
+
+	ex := New(aria, aria.OpenChannel(aria.Catalog.GetUser("admin")))
+	ex.SetJsonOutput(true)
+
+	execute := func(stmt string) (string, error) {
+		lexer := parser.NewLexer([]byte(stmt))
+		t.Log(stmt)
+
+		p := parser.NewParser(lexer)
+		ast, err := p.Parse()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		defer ex.Clear()
+
+		err = ex.Execute(ast)
+
+		return string(ex.GetResultSet()), err
+	}
+
+	for _, stmt := range []string{
+		"CREATE DATABASE test;",
+		"USE test;",
+		"CREATE TABLE employees (id INT NOT NULL UNIQUE, name CHAR(16), manager_id INT);",
+		"INSERT INTO employees (id, name, manager_id) VALUES (1, 'ada', 0), (2, 'bob', 1), (3, 'cy', 1), (4, 'dee', 2), (5, 'eve', 4);",
+		"CREATE TABLE links (source INT, target INT);",
+		"INSERT INTO links (source, target) VALUES (1, 2), (2, 3), (3, 1);",
+	} {
+		_, err = execute(stmt)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, test := range []struct {
+		stmt     string
+		expected string
+	}{
+		{
+			// The org chart below ada, the depth of an employee is one more than the depth of their manager
+			stmt: `WITH RECURSIVE chart (id, name, depth) AS (
+				SELECT id, name, 1 AS depth FROM employees WHERE manager_id = 0
+				UNION ALL
+				SELECT e.id, e.name, c.depth + 1 AS depth FROM employees e, chart c WHERE e.manager_id = c.id
+			) SELECT name, depth FROM chart ORDER BY id ASC;`,
+			expected: `[{"name":"ada","depth":1},{"name":"bob","depth":2},{"name":"cy","depth":2},{"name":"dee","depth":3},{"name":"eve","depth":4}]`,
+		},
+		{
+			stmt:     "WITH RECURSIVE n (x) AS (SELECT 1 UNION ALL SELECT x + 1 FROM n WHERE x < 5) SELECT x FROM n;",
+			expected: `[{"x":1},{"x":2},{"x":3},{"x":4},{"x":5}]`,
+		},
+		{
+			// UNION ends the recursion of a cycle once no new rows are reached
+			stmt: `WITH RECURSIVE reachable (node) AS (
+				SELECT 1 AS node
+				UNION
+				SELECT l.target FROM links l, reachable r WHERE l.source = r.node
+			) SELECT node FROM reachable ORDER BY node ASC;`,
+			expected: `[{"node":1},{"node":2},{"node":3}]`,
+		},
+		{
+			// A common table expression reads the ones before it
+			stmt:     "WITH managers AS (SELECT manager_id FROM employees WHERE manager_id > 0), top AS (SELECT manager_id FROM managers WHERE manager_id < 2) SELECT manager_id FROM top;",
+			expected: `[{"manager_id":1},{"manager_id":1}]`,
+		},
+	} {
+		result, err := execute(test.stmt)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if strings.TrimSpace(result) != test.expected {
+			t.Fatalf("expected %s, got %s", test.expected, result)
+		}
+	}
+
+	// UNION ALL follows the cycle until the max recursion depth configured
+	_, err = execute("WITH RECURSIVE walk (node) AS (SELECT 1 AS node UNION ALL SELECT l.target FROM links l, walk w WHERE l.source = w.node) SELECT node FROM walk;")
+	if err == nil || err.Error() != "recursive query walk exceeded the max recursion depth of 10" {
+		t.Fatalf("expected recursive query walk exceeded the max recursion depth of 10, got %v", err)
+	}
+
+	_, err = execute("WITH RECURSIVE n (x) AS (SELECT x FROM n UNION ALL SELECT 1) SELECT x FROM n;")
+	if err == nil || err.Error() != "the first query of recursive n can not read from it" {
+		t.Fatalf("expected the first query of recursive n can not read from it, got %v", err)
+	}
+}
+
+func TestStmt115(t *testing.T) {
+	defer os.RemoveAll("./test/")
+
+	// Create a new AriaSQL instance
+	aria, err := core.New(&core.Config{
+		DataDir: "./test",
+	})
+	if err != nil {
+		t.Fatal(err)
+		return
+
+	}
+
+	aria.Catalog = catalog.New(aria.Config.DataDir)
+
+	if err := aria.Catalog.Open(); err != nil {
+		t.Fatal(err)
+		return
+	}
+
+	defer aria.Close()
+
+	aria.Channels = make([]*core.Channel, 0)
+	aria.ChannelsLock = &sync.Mutex{}
+
+	ex := New(aria, aria.OpenChannel(aria.Catalog.GetUser("admin")))
+	ex.SetJsonOutput(true)
+
+	execute := func(stmt string) (string, error) {
+		lexer := parser.NewLexer([]byte(stmt))
+		t.Log(stmt)
+
+		p := parser.NewParser(lexer)
+		ast, err := p.Parse()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		defer ex.Clear()
+
+		err = ex.Execute(ast)
+
+		return string(ex.GetResultSet()), err
+	}
+
+	for _, stmt := range []string{
+		"CREATE DATABASE test;",
+		"USE test;",
+		"CREATE TABLE sales (sale_id INT NOT NULL UNIQUE, region CHAR(8), product CHAR(8), amount INT);",
+		"INSERT INTO sales (sale_id, region, product, amount) VALUES (1, 'east', 'apple', 10), (2, 'east', 'pear', 20), (3, 'west', 'apple', 30), (4, 'west', 'apple', 5);",
+	} {
+		_, err = execute(stmt)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, test := range []struct {
+		stmt     string
+		expected string
+	}{
+		{
+			// Totals by region and product, subtotals by region and the grand total
+			stmt: "SELECT region, product, SUM(amount) AS total, GROUPING(region, product) AS level FROM sales GROUP BY ROLLUP (region, product);",
+			expected: `[{"region":"east","product":"apple","total":10,"level":0},{"region":"east","product":"pear","total":20,"level":0},{"region":"west","product":"apple","total":35,"level":0},` +
+				`{"region":"east","product":null,"total":30,"level":1},{"region":"west","product":null,"total":35,"level":1},{"region":null,"product":null,"total":65,"level":3}]`,
+		},
+		{
+			stmt:     "SELECT product, COUNT(*) AS sales FROM sales GROUP BY CUBE (region, product) HAVING GROUPING(region) = 1 ORDER BY product ASC;",
+			expected: `[{"product":null,"sales":4},{"product":"apple","sales":3},{"product":"pear","sales":1}]`,
+		},
+		{
+			stmt:     "SELECT region, SUM(amount) AS total FROM sales GROUP BY GROUPING SETS ((region), ()) HAVING SUM(amount) > 30;",
+			expected: `[{"region":"west","total":35},{"region":null,"total":65}]`,
+		},
+	} {
+		result, err := execute(test.stmt)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if strings.TrimSpace(result) != test.expected {
+			t.Fatalf("expected %s, got %s", test.expected, result)
+		}
+	}
+
+	_, err = execute("SELECT region, amount FROM sales GROUP BY ROLLUP (region);")
+	if err == nil || err.Error() != "column amount must be grouped by or aggregated" {
+		t.Fatalf("expected column amount must be grouped by or aggregated, got %v", err)
+	}
+}
+
+func TestStmt116(t *testing.T) {
+	defer os.RemoveAll("./test/")
+
+	// Create a new AriaSQL instance
+	aria, err := core.New(&core.Config{
+		DataDir: "./test",
+	})
+	if err != nil {
+		t.Fatal(err)
+		return
+
+	}
+
+	aria.Catalog = catalog.New(aria.Config.DataDir)
+
+	if err := aria.Catalog.Open(); err != nil {
+		t.Fatal(err)
+		return
+	}
+
+	defer aria.Close()
+
+	aria.Channels = make([]*core.Channel, 0)
+	aria.ChannelsLock = &sync.Mutex{}
+
+	ex := New(aria, aria.OpenChannel(aria.Catalog.GetUser("admin")))
+	ex.SetJsonOutput(true)
+
+	execute := func(stmt string) (string, error) {
+		lexer := parser.NewLexer([]byte(stmt))
+		t.Log(stmt)
+
+		p := parser.NewParser(lexer)
+		ast, err := p.Parse()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		defer ex.Clear()
+
+		err = ex.Execute(ast)
+
+		return string(ex.GetResultSet()), err
+	}
+
+	for _, stmt := range []string{
+		"CREATE DATABASE test;",
+		"USE test;",
+		"CREATE TABLE sales (region CHAR(8), product CHAR(8), amount INT);",
+		"INSERT INTO sales (region, product, amount) VALUES ('east', 'apple', 10), ('east', 'pear', 20), ('west', 'apple', 30), ('west', 'apple', 5), ('north', 'plum', 1);",
+		"CREATE TABLE wide (region CHAR(8), apple INT, pear INT);",
+		"INSERT INTO wide (region, apple, pear) VALUES ('east', 10, 20), ('west', 35, 0);",
+	} {
+		_, err = execute(stmt)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, test := range []struct {
+		stmt     string
+		expected string
+	}{
+		{
+			// A product not listed is not a column, its region has a row
+			stmt:     "SELECT * FROM sales PIVOT (SUM(amount) FOR product IN ('apple' AS apples, 'pear'));",
+			expected: `[{"apples":10,"pear":20,"region":"east"},{"apples":35,"pear":0,"region":"west"},{"apples":0,"pear":0,"region":"north"}]`,
+		},
+		{
+			// The where condition is evaluated on the rows of the table
+			stmt:     "SELECT region, apple FROM sales PIVOT (MAX(amount) FOR product IN ('apple')) WHERE amount < 30 ORDER BY region ASC;",
+			expected: `[{"region":"east","apple":10},{"region":"north","apple":null},{"region":"west","apple":5}]`,
+		},
+		{
+			stmt:     "SELECT region, product, amount FROM wide UNPIVOT (amount FOR product IN (apple, pear));",
+			expected: `[{"region":"east","product":"apple","amount":10},{"region":"east","product":"pear","amount":20},{"region":"west","product":"apple","amount":35},{"region":"west","product":"pear","amount":0}]`,
+		},
+	} {
+		result, err := execute(test.stmt)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if strings.TrimSpace(result) != test.expected {
+			t.Fatalf("expected %s, got %s", test.expected, result)
+		}
+	}
+
+	_, err = execute("SELECT * FROM sales PIVOT (SUM(amount) FOR product IN ('apple')), wide;")
+	if err == nil || err.Error() != "PIVOT and UNPIVOT are only supported when selecting from a single table" {
+		t.Fatalf("expected PIVOT and UNPIVOT are only supported when selecting from a single table, got %v", err)
+	}
+}
+
+func TestStmt117(t *testing.T) {
+	defer os.RemoveAll("./test/")
+
+	// Create a new AriaSQL instance
+	aria, err := core.New(&core.Config{
+		DataDir: "./test",
+	})
+	if err != nil {
+		t.Fatal(err)
+		return
+
+	}
+
+	aria.Catalog = catalog.New(aria.Config.DataDir)
+
+	if err := aria.Catalog.Open(); err != nil {
+		t.Fatal(err)
+		return
+	}
+
+	defer aria.Close()
+
+	aria.Channels = make([]*core.Channel, 0)
+	aria.ChannelsLock = &sync.Mutex{}
+
+	ex := New(aria, aria.OpenChannel(aria.Catalog.GetUser("admin")))
+	ex.SetJsonOutput(true)
+
+	execute := func(stmt string) (string, error) {
+		lexer := parser.NewLexer([]byte(stmt))
+		t.Log(stmt)
+
+		p := parser.NewParser(lexer)
+		ast, err := p.Parse()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		defer ex.Clear()
+
+		err = ex.Execute(ast)
+
+		return string(ex.GetResultSet()), err
+	}
+
+	// Table functions are read without a database selected
+	result, err := execute("SELECT * FROM generate_series(1, 3);")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.TrimSpace(result) != `[{"generate_series":1},{"generate_series":2},{"generate_series":3}]` {
+		t.Fatalf("expected 1 to 3, got %s", result)
+	}
+
+	err = RegisterTableFunction("colors", func(args []interface{}) ([]map[string]interface{}, error) {
+		return []map[string]interface{}{{"color": "'red'"}, {"color": "'blue'"}}, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer delete(tableFunctions, "colors")
+
+	err = RegisterTableFunction("generate_series", generateSeries)
+	if err == nil || err.Error() != "table function generate_series already exists" {
+		t.Fatalf("expected table function generate_series already exists, got %v", err)
+	}
+
+	for _, stmt := range []string{
+		"CREATE DATABASE test;",
+		"USE test;",
+		"CREATE TABLE users (user_id INT NOT NULL UNIQUE, name CHAR(8));",
+		"INSERT INTO users (user_id, name) VALUES (1, 'alex'), (2, 'sam');",
+	} {
+		_, err = execute(stmt)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, test := range []struct {
+		stmt     string
+		expected string
+	}{
+		{
+			stmt:     "SELECT n FROM generate_series(10, 0, -4) AS n;",
+			expected: `[{"n":10},{"n":6},{"n":2}]`,
+		},
+		{
+			stmt:     "SELECT * FROM generate_series(0, 1, 0.25) WHERE generate_series > 0.5;",
+			expected: `[{"generate_series":0.75},{"generate_series":1}]`,
+		},
+		{
+			stmt:     "SELECT * FROM generate_series('2024-01-31', '2024-04-30', '1 month');",
+			expected: `[{"generate_series":"2024-01-31"},{"generate_series":"2024-02-29"},{"generate_series":"2024-03-31"},{"generate_series":"2024-04-30"}]`,
+		},
+		{
+			stmt:     "SELECT * FROM generate_series('2024-06-01 00:00:00', '2024-06-01 12:00:00', '6 hours');",
+			expected: `[{"generate_series":"2024-06-01 00:00:00"},{"generate_series":"2024-06-01 06:00:00"},{"generate_series":"2024-06-01 12:00:00"}]`,
+		},
+		{
+			// Every combination of the rows of a table and a table function
+			stmt:     "SELECT u.name, d.d FROM users u, generate_series(1, 2) AS d WHERE u.user_id = 1;",
+			expected: `[{"name":"alex","d":1},{"name":"alex","d":2}]`,
+		},
+		{
+			stmt:     "SELECT color FROM colors();",
+			expected: `[{"color":"red"},{"color":"blue"}]`,
+		},
+	} {
+		result, err := execute(test.stmt)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if strings.TrimSpace(result) != test.expected {
+			t.Fatalf("expected %s, got %s", test.expected, result)
+		}
+	}
+
+	for stmt, expected := range map[string]string{
+		"SELECT * FROM generate_series(1, 10, 0);":                                  "generate_series: step can not be 0",
+		"SELECT * FROM generate_series('2024-01-01', '2024-01-02', '1 fortnight');": "generate_series: invalid interval unit fortnight",
+		"SELECT * FROM unknown_series(1, 2);":                                       "table function unknown_series does not exist",
+	} {
+		_, err = execute(stmt)
+		if err == nil || err.Error() != expected {
+			t.Fatalf("expected %s, got %v", expected, err)
+		}
+	}
+}
+
+func TestStmt118(t *testing.T) {
+	defer os.RemoveAll("./test/")
+
+	// Create a new AriaSQL instance
+	aria, err := core.New(&core.Config{
+		DataDir: "./test",
+	})
+	if err != nil {
+		t.Fatal(err)
+		return
+
+	}
+
+	aria.Catalog = catalog.New(aria.Config.DataDir)
+
+	if err := aria.Catalog.Open(); err != nil {
+		t.Fatal(err)
+		return
+	}
+
+	defer aria.Close()
+
+	aria.Channels = make([]*core.Channel, 0)
+	aria.ChannelsLock = &sync.Mutex{}
+
+	ex := New(aria, aria.OpenChannel(aria.Catalog.GetUser("admin")))
+	ex.SetJsonOutput(true)
+
+	execute := func(stmt string) (string, error) {
+		lexer := parser.NewLexer([]byte(stmt))
+		t.Log(stmt)
+
+		p := parser.NewParser(lexer)
+		ast, err := p.Parse()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		defer ex.Clear()
+
+		err = ex.Execute(ast)
+
+		return string(ex.GetResultSet()), err
+	}
+
+	for _, stmt := range []string{
+		"CREATE DATABASE test;",
+		"USE test;",
+		"CREATE TABLE users (user_id UUID DEFAULT UUID_V7, name CHAR(8), digest CHAR(32));",
+		"CREATE INDEX digest_idx ON users (digest);",
+		"INSERT INTO users (name, digest) VALUES ('alex', '534b44a19bf18d20b71ecc4eb77c572f');",
+		"INSERT INTO users (name, digest) VALUES ('sam', 'x');",
+		"INSERT INTO users (user_id, name, digest) VALUES ('0190a6c8-8b5e-7c3a-9f00-000000000001', 'kim', 'y');",
+	} {
+		_, err = execute(stmt)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, test := range []struct {
+		stmt     string
+		expected string
+	}{
+		{
+			stmt:     "SELECT name, MD5(name) AS h, SHA256(name) FROM users WHERE name = 'alex';",
+			expected: `[{"name":"alex","h":"534b44a19bf18d20b71ecc4eb77c572f","sha256":"4135aa9dc1b842a653dea846903ddb95bfb8c5a10c504a7fa16e10bc31d1fdf0"}]`,
+		},
+		{
+			stmt:     "SELECT name FROM users WHERE MD5(name) = '534b44a19bf18d20b71ecc4eb77c572f';",
+			expected: `[{"name":"alex"}]`,
+		},
+		{
+			// MD5('alex') is folded to its value before the index is looked up
+			stmt:     "SELECT name FROM users WHERE digest = MD5('alex');",
+			expected: `[{"name":"alex"}]`,
+		},
+		{
+			// A UUID given is kept rather than generated
+			stmt:     "SELECT user_id FROM users WHERE name = 'kim';",
+			expected: `[{"user_id":"0190a6c8-8b5e-7c3a-9f00-000000000001"}]`,
+		},
+		{
+			stmt:     "SELECT name FROM users WHERE RANDOM() >= 1;",
+			expected: `null`,
+		},
+	} {
+		result, err := execute(test.stmt)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if strings.TrimSpace(result) != test.expected {
+			t.Fatalf("expected %s, got %s", test.expected, result)
+		}
+	}
+
+	result, err := execute("EXPLAIN SELECT name FROM users WHERE digest = MD5('alex');")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(result, "INDEX SCAN") {
+		t.Fatalf("expected an index scan, got %s", result)
+	}
+
+	// UUIDs generated later sort after
+	result, err = execute("SELECT user_id, name FROM users WHERE name = 'alex' OR name = 'sam';")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var rows []map[string]interface{}
+	err = json.Unmarshal([]byte(result), &rows)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(rows) != 2 || rows[0]["user_id"].(string)[14] != '7' || rows[0]["user_id"].(string) >= rows[1]["user_id"].(string) {
+		t.Fatalf("expected time ordered version 7 UUIDs, got %s", result)
+	}
+
+	result, err = execute("SELECT name, RANDOM() AS r FROM users ORDER BY RANDOM() LIMIT 2;")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rows = nil
+	err = json.Unmarshal([]byte(result), &rows)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(rows) != 2 {
+		t.Fatalf("expected a sample of 2 rows, got %s", result)
+	}
+
+	for _, row := range rows {
+		if r := row["r"].(float64); r < 0 || r >= 1 {
+			t.Fatalf("expected a number from 0 up to 1, got %v", r)
+		}
+	}
+}
+
+func TestStmt119(t *testing.T) {
+	defer os.RemoveAll("./test/")
+
+	// Create a new AriaSQL instance
+	aria, err := core.New(&core.Config{
+		DataDir: "./test",
+	})
+	if err != nil {
+		t.Fatal(err)
+		return
+
+	}
+
+	aria.Catalog = catalog.New(aria.Config.DataDir)
+
+	if err := aria.Catalog.Open(); err != nil {
+		t.Fatal(err)
+		return
+	}
+
+	defer aria.Close()
+
+	aria.Channels = make([]*core.Channel, 0)
+	aria.ChannelsLock = &sync.Mutex{}
+
+	ex := New(aria, aria.OpenChannel(aria.Catalog.GetUser("admin")))
+	ex.SetJsonOutput(true)
+
+	execute := func(stmt string) (string, error) {
+		lexer := parser.NewLexer([]byte(stmt))
+		t.Log(stmt)
+
+		p := parser.NewParser(lexer)
+		ast, err := p.Parse()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		defer ex.Clear()
+
+		err = ex.Execute(ast)
+
+		return string(ex.GetResultSet()), err
+	}
+
+	for _, stmt := range []string{
+		"CREATE DATABASE test;",
+		"USE test;",
+		"CREATE TABLE files (file_id INT, name CHAR(16));",
+		"CREATE INDEX name_idx ON files (name);",
+		"INSERT INTO files (file_id, name) VALUES (1, 'item10');",
+		"INSERT INTO files (file_id, name) VALUES (2, 'Item2');",
+		"INSERT INTO files (file_id, name) VALUES (3, 'item9');",
+	} {
+		_, err = execute(stmt)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, test := range []struct {
+		stmt     string
+		expected string
+	}{
+		{
+			stmt:     "SELECT name FROM files ORDER BY name;",
+			expected: `[{"name":"Item2"},{"name":"item10"},{"name":"item9"}]`,
+		},
+		{
+			stmt:     "SELECT name FROM files ORDER BY name COLLATE nocase;",
+			expected: `[{"name":"item10"},{"name":"Item2"},{"name":"item9"}]`,
+		},
+		{
+			// Digits are ordered by their numeric value
+			stmt:     "SELECT name FROM files ORDER BY name COLLATE 'en-u-kn-true';",
+			expected: `[{"name":"Item2"},{"name":"item9"},{"name":"item10"}]`,
+		},
+		{
+			stmt:     "SELECT file_id FROM files WHERE name = 'ITEM2' COLLATE nocase;",
+			expected: `[{"file_id":2}]`,
+		},
+		{
+			stmt:     "SELECT file_id FROM files WHERE name COLLATE 'en-u-ks-level2' = 'item2';",
+			expected: `[{"file_id":2}]`,
+		},
+		{
+			stmt:     "SELECT file_id FROM files WHERE name < 'item3' COLLATE 'en-u-kn-true';",
+			expected: `[{"file_id":2}]`,
+		},
+		{
+			stmt:     "SELECT file_id FROM files WHERE name = 'ITEM2';",
+			expected: `null`,
+		},
+	} {
+		result, err := execute(test.stmt)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if strings.TrimSpace(result) != test.expected {
+			t.Fatalf("expected %s, got %s", test.expected, result)
+		}
+	}
+
+	result, err := execute("EXPLAIN SELECT file_id FROM files WHERE name = 'ITEM2' COLLATE nocase;")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Contains(result, "INDEX SCAN") {
+		t.Fatalf("expected no index scan, got %s", result)
+	}
+
+	for _, stmt := range []string{
+		"SELECT name FROM files ORDER BY name COLLATE 'not a locale';",
+		"SELECT name FROM files WHERE name = 'item2' COLLATE 'not a locale';",
+	} {
+		_, err = execute(stmt)
+		if err == nil || err.Error() != "unknown collation not a locale" {
+			t.Fatalf("expected unknown collation, got %v", err)
+		}
+	}
+}
+
+func TestStmt120(t *testing.T) {
+	defer os.RemoveAll("./test/")
+
+	// Create a new AriaSQL instance
+	aria, err := core.New(&core.Config{
+		DataDir: "./test",
+	})
+	if err != nil {
+		t.Fatal(err)
+		return
+
+	}
+
+	aria.Catalog = catalog.New(aria.Config.DataDir)
+
+	if err := aria.Catalog.Open(); err != nil {
+		t.Fatal(err)
+		return
+	}
+
+	defer aria.Close()
+
+	aria.Channels = make([]*core.Channel, 0)
+	aria.ChannelsLock = &sync.Mutex{}
+
+	ex := New(aria, aria.OpenChannel(aria.Catalog.GetUser("admin")))
+	ex.SetJsonOutput(true)
+
+	execute := func(stmt string) (string, error) {
+		lexer := parser.NewLexer([]byte(stmt))
+		t.Log(stmt)
+
+		p := parser.NewParser(lexer)
+		ast, err := p.Parse()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		defer ex.Clear()
+
+		err = ex.Execute(ast)
+
+		return string(ex.GetResultSet()), err
+	}
+
+	for _, stmt := range []string{
+		"CREATE DATABASE a;",
+		"USE a;",
+		"CREATE TABLE users (user_id INT, name CHAR(8));",
+		"INSERT INTO users (user_id, name) VALUES (1, 'alex');",
+		"INSERT INTO users (user_id, name) VALUES (2, 'sam');",
+		"INSERT INTO users (user_id, name) VALUES (3, 'kim');",
+		"CREATE DATABASE b;",
+		"USE b;",
+		"CREATE TABLE users (user_id INT, name CHAR(8));",
+		"INSERT INTO users (user_id, name) VALUES (3, 'kim');",
+		"INSERT INTO users (user_id, name) VALUES (1, 'alex');",
+		"INSERT INTO users (user_id, name) VALUES (2, 'sam');",
+	} {
+		_, err = execute(stmt)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	checksums := func(database string, stmt string) []map[string]interface{} {
+		_, err := execute("USE " + database + ";")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		result, err := execute(stmt)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var rows []map[string]interface{}
+		err = json.Unmarshal([]byte(result), &rows)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return rows
+	}
+
+	// The same rows written in another order have the same checksum
+	a := checksums("a", "CHECKSUM TABLE users;")
+	b := checksums("b", "CHECKSUM TABLE users;")
+
+	if len(a) != 1 || a[0]["Table"] != "users" || a[0]["Rows"] != float64(3) || len(a[0]["Checksum"].(string)) != 16 {
+		t.Fatalf("unexpected checksum %v", a)
+	}
+
+	if a[0]["Checksum"] != b[0]["Checksum"] {
+		t.Fatalf("expected the same checksum, got %v and %v", a, b)
+	}
+
+	_, err = execute("UPDATE users SET name = 'max' WHERE user_id = 2;")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b = checksums("b", "CHECKSUM TABLE users;")
+	if a[0]["Checksum"] == b[0]["Checksum"] {
+		t.Fatal("expected the checksum to change")
+	}
+
+	// Only the chunk of the row updated differs
+	a = checksums("a", "CHECKSUM TABLE users BY user_id CHUNKS 8;")
+	b = checksums("b", "CHECKSUM TABLE users BY user_id CHUNKS 8;")
+
+	if len(a) != 8 || len(b) != 8 {
+		t.Fatalf("expected 8 chunks, got %v", a)
+	}
+
+	rows, differ := 0, 0
+	for i := range a {
+		if a[i]["Chunk"] != float64(i) {
+			t.Fatalf("expected chunk %d, got %v", i, a[i])
+		}
+
+		rows += int(a[i]["Rows"].(float64))
+
+		if a[i]["Checksum"] != b[i]["Checksum"] {
+			differ++
+		}
+	}
+
+	if rows != 3 || differ != 1 {
+		t.Fatalf("expected 3 rows and 1 chunk differing, got %d rows and %d chunks", rows, differ)
+	}
+
+	for _, stmt := range []string{
+		"CHECKSUM TABLE orders;",
+		"CHECKSUM TABLE users BY id CHUNKS 8;",
+	} {
+		_, err = execute(stmt)
+		if err == nil {
+			t.Fatalf("expected error for %s", stmt)
+		}
+	}
+}
+
+func TestStmt121(t *testing.T) {
+	defer os.RemoveAll("./test/")
+
+	// Create a new AriaSQL instance
+	aria, err := core.New(&core.Config{
+		DataDir: "./test",
+	})
+	if err != nil {
+		t.Fatal(err)
+		return
+
+	}
+
+	aria.Catalog = catalog.New(aria.Config.DataDir)
+
+	if err := aria.Catalog.Open(); err != nil {
+		t.Fatal(err)
+		return
+	}
+
+	defer aria.Close()
+
+	aria.Channels = make([]*core.Channel, 0)
+	aria.ChannelsLock = &sync.Mutex{}
+
+	ex := New(aria, aria.OpenChannel(aria.Catalog.GetUser("admin")))
+	ex.SetJsonOutput(true)
+
+	execute := func(stmt string) (string, error) {
+		lexer := parser.NewLexer([]byte(stmt))
+		t.Log(stmt)
+
+		p := parser.NewParser(lexer)
+		ast, err := p.Parse()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		defer ex.Clear()
+
+		err = ex.Execute(ast)
+
+		return string(ex.GetResultSet()), err
+	}
+
+	for _, stmt := range []string{
+		"CREATE DATABASE test;",
+		"USE test;",
+		"CREATE TABLE users (user_id INT, name CHAR(8));",
+		"CREATE UNIQUE INDEX users_user_id ON users (user_id);",
+		"INSERT INTO users (user_id, name) VALUES (1, 'alex');",
+		"CREATE TABLE orders (order_id INT, user_id INT, total INT);",
+		"INSERT INTO orders (order_id, user_id, total) VALUES (1, 1, 10);",
+		"INSERT INTO orders (order_id, user_id, total) VALUES (2, 2, 0);",
+	} {
+		_, err = execute(stmt)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Existing rows are validated against a constraint unless it is added NOT VALID
+	_, err = execute("ALTER TABLE orders ALTER COLUMN total ADD CHECK (total > 0);")
+	if err == nil || err.Error() != "1 rows violate the constraint, add it NOT VALID and validate it once they are fixed" {
+		t.Fatalf("expected the constraint to be violated, got %v", err)
+	}
+
+	for _, stmt := range []string{
+		"ALTER TABLE orders ALTER COLUMN total ADD CHECK (total > 0) NOT VALID;",
+		"ALTER TABLE orders ALTER COLUMN user_id ADD REFERENCES users (user_id) NOT VALID;",
+	} {
+		_, err = execute(stmt)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	orders := ex.ch.Database.GetTable("orders")
+	if !slices.Equal(orders.TableSchema.NotValid, []string{"orders_total_check", "orders_user_id_fkey"}) {
+		t.Fatalf("expected both constraints not valid, got %v", orders.TableSchema.NotValid)
+	}
+
+	// A constraint not valid is enforced on new rows
+	_, err = execute("INSERT INTO orders (order_id, user_id, total) VALUES (3, 1, 0);")
+	if err == nil || err.Error() != "check constraint failed for column total" {
+		t.Fatalf("expected check constraint to fail, got %v", err)
+	}
+
+	for _, name := range []string{"orders_total_check", "orders_user_id_fkey"} {
+		result, err := execute("ALTER TABLE orders VALIDATE CONSTRAINT " + name + ";")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		expect := `[{"order_id":2,"total":0,"user_id":2}]`
+		if result != expect {
+			t.Fatalf("expected %s, got %s", expect, result)
+		}
+	}
+
+	if len(orders.TableSchema.NotValid) != 2 {
+		t.Fatalf("expected both constraints not valid, got %v", orders.TableSchema.NotValid)
+	}
+
+	for _, stmt := range []string{
+		"DELETE FROM orders WHERE order_id = 2;",
+		"ALTER TABLE orders VALIDATE CONSTRAINT orders_total_check;",
+		"ALTER TABLE orders VALIDATE CONSTRAINT orders_user_id_fkey;",
+	} {
+		_, err = execute(stmt)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if len(orders.TableSchema.NotValid) != 0 {
+		t.Fatalf("expected both constraints valid, got %v", orders.TableSchema.NotValid)
+	}
+
+	for _, stmt := range []string{
+		"ALTER TABLE orders VALIDATE CONSTRAINT orders_order_id_check;",
+		"ALTER TABLE orders ALTER COLUMN total ADD CHECK (total > 1);",
+		"ALTER TABLE orders ALTER COLUMN order_id ADD REFERENCES customers (order_id);",
+		"ALTER TABLE orders ALTER COLUMN order_id ADD REFERENCES users (order_id);",
+	} {
+		_, err = execute(stmt)
+		if err == nil {
+			t.Fatalf("expected error for %s", stmt)
+		}
+	}
+}
+
+func TestStmt122(t *testing.T) {
+	defer os.RemoveAll("./test/")
+
+	// Create a new AriaSQL instance
+	aria, err := core.New(&core.Config{
+		DataDir: "./test",
+	})
+	if err != nil {
+		t.Fatal(err)
+		return
+
+	}
+
+	aria.Catalog = catalog.New(aria.Config.DataDir)
+
+	if err := aria.Catalog.Open(); err != nil {
+		t.Fatal(err)
+		return
+	}
+
+	defer aria.Close()
+
+	aria.Channels = make([]*core.Channel, 0)
+	aria.ChannelsLock = &sync.Mutex{}
+
+	ex := New(aria, aria.OpenChannel(aria.Catalog.GetUser("admin")))
+	ex.SetJsonOutput(true)
+
+	parse := func(stmt string) parser.Statement {
+		t.Log(stmt)
+
+		ast, err := parser.NewParser(parser.NewLexer([]byte(stmt))).Parse()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return ast
+	}
+
+	for _, stmt := range []string{
+		"CREATE DATABASE test;",
+		"USE test;",
+		"CREATE TABLE users (user_id INT, name TEXT, born DATE, seen DATETIME, active BOOL, balance DECIMAL(10,2));",
+		"CREATE TABLE copies (user_id INT, name TEXT, born DATE, seen DATETIME, active BOOL, balance DECIMAL(10,2));",
+		"CREATE TABLE notes (note_id INT, body CHAR(8));",
+		`INSERT INTO users (user_id, name, born, seen, active, balance) VALUES (1, 'it\'s a\\b', '1990-01-02', '2024-09-14 153201', TRUE, 1.5);`,
+		"INSERT INTO users (user_id, name, born, seen, active, balance) VALUES (2, 'sam', '1991-03-04', '2024-09-15 080000', FALSE, 20);",
+	} {
+		err = ex.Execute(parse(stmt))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ex.Clear()
+	}
+
+	out := &bytes.Buffer{}
+
+	rows, err := ex.CopyOut(parse("COPY users TO STDOUT;").(*parser.CopyStmt), out)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expect := "t\t1.5\t1990-01-02\tit's a\\\\b\t2024-09-14 15:32:01\t1\n" +
+		"f\t20\t1991-03-04\tsam\t2024-09-15 08:00:00\t2\n"
+	if rows != 2 || out.String() != expect {
+		t.Fatalf("expected %q, got %d rows %q", expect, rows, out.String())
+	}
+
+	if string(ex.GetResultSet()) != `[{"RowsCopied":2}]` {
+		t.Fatalf("expected 2 rows copied, got %s", string(ex.GetResultSet()))
+	}
+
+	// The rows copied to the client are copied back into another table, the statement following the rows stays unread
+	in := bufio.NewReader(strings.NewReader(out.String() + COPY_END + "\nSELECT * FROM copies;"))
+
+	rows, err = ex.CopyIn(parse("COPY copies FROM STDIN;").(*parser.CopyStmt), in)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rest, _ := io.ReadAll(in)
+	if rows != 2 || string(rest) != "SELECT * FROM copies;" {
+		t.Fatalf("expected 2 rows copied and the select unread, got %d rows %q", rows, string(rest))
+	}
+
+	copied := &bytes.Buffer{}
+
+	_, err = ex.CopyOut(parse("COPY copies TO STDOUT;").(*parser.CopyStmt), copied)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if copied.String() != expect {
+		t.Fatalf("expected %q, got %q", expect, copied.String())
+	}
+
+	// Columns are copied in the order named, NULL is \N
+	rows, err = ex.CopyIn(parse("COPY notes (body, note_id) FROM STDIN;").(*parser.CopyStmt), strings.NewReader("\\N\t3\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out.Reset()
+
+	_, err = ex.CopyOut(parse("COPY (SELECT * FROM notes WHERE note_id = 3) TO STDOUT;").(*parser.CopyStmt), out)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if rows != 1 || out.String() != "\\N\t3\n" {
+		t.Fatalf("expected a note with no body, got %q", out.String())
+	}
+
+	// The rows following a failing row are read but not inserted
+	in = bufio.NewReader(strings.NewReader("4\tkim\nfive\tlee\n6\tmax\n" + COPY_END + "\n"))
+
+	rows, err = ex.CopyIn(parse("COPY notes (note_id, body) FROM STDIN;").(*parser.CopyStmt), in)
+	if err == nil || err.Error() != "line 2: column note_id is not an int" || rows != 0 || in.Buffered() != 0 {
+		t.Fatalf("expected line 2 to fail, got %d rows %v", rows, err)
+	}
+
+	for _, stmt := range []string{
+		"COPY orders TO STDOUT;",
+		"COPY users (email) TO STDOUT;",
+		"COPY users FROM STDIN;",
+	} {
+		_, err = ex.CopyOut(parse(stmt).(*parser.CopyStmt), out)
+		if err == nil {
+			t.Fatalf("expected error for %s", stmt)
+		}
+	}
+
+	err = ex.Execute(parse("COPY users TO STDOUT;"))
+	if err == nil {
+		t.Fatal("expected COPY to require a client connection")
+	}
+}
+
+func TestStmt123(t *testing.T) {
+	defer os.RemoveAll("./test/")
+
+	// Create a new AriaSQL instance
+	aria, err := core.New(&core.Config{
+		DataDir: "./test",
+	})
+	if err != nil {
+		t.Fatal(err)
+		return
+
+	}
+
+	aria.Catalog = catalog.New(aria.Config.DataDir)
+
+	if err := aria.Catalog.Open(); err != nil {
+		t.Fatal(err)
+		return
+	}
+
+	defer aria.Close()
+
+	aria.Channels = make([]*core.Channel, 0)
+	aria.ChannelsLock = &sync.Mutex{}
+
+	ex := New(aria, aria.OpenChannel(aria.Catalog.GetUser("admin")))
+	ex.SetJsonOutput(true)
+
+	execute := func(stmt string) error {
+		t.Log(stmt)
+
+		ast, err := parser.NewParser(parser.NewLexer([]byte(stmt))).Parse()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ex.Clear()
+
+		return ex.Execute(ast)
+	}
+
+	writeMigration := func(file, script string) {
+		err := os.MkdirAll("./test/migrations", 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = os.WriteFile("./test/migrations/"+file, []byte(script), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, stmt := range []string{"CREATE DATABASE test;", "USE test;"} {
+		err = execute(stmt)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	writeMigration("0001_orders.sql", `-- orders
+CREATE TABLE orders (order_id INT, total DECIMAL(10,2));
+CREATE INDEX orders_id ON orders (order_id);
+ALTER TABLE orders ALTER COLUMN note TEXT;
+`)
+
+	err = execute("APPLY MIGRATION 'orders' FROM '0001_orders.sql';")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var result []map[string]interface{}
+
+	err = json.Unmarshal(ex.GetResultSet(), &result)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(result) != 1 || result[0]["Version"] != float64(1) || result[0]["Statements"] != float64(3) || result[0]["Status"] != "applied" {
+		t.Fatalf("expected version 1 applied, got %s", string(ex.GetResultSet()))
+	}
+
+	tbl := aria.Catalog.GetDatabase("test").GetTable("orders")
+	if tbl == nil || tbl.GetIndex("orders_id") == nil || tbl.TableSchema.ColumnDefinitions["note"] == nil {
+		t.Fatal("expected the orders table with its index and note column")
+	}
+
+	// Applying a migration again changes nothing
+	err = execute("APPLY MIGRATION 'orders' FROM '0001_orders.sql';")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(string(ex.GetResultSet()), `"Status":"already applied"`) {
+		t.Fatalf("expected already applied, got %s", string(ex.GetResultSet()))
+	}
+
+	// A migration applied from a different file is an error
+	writeMigration("0001_orders_changed.sql", "CREATE TABLE orders2 (order_id INT);\n")
+
+	err = execute("APPLY MIGRATION 'orders' FROM '0001_orders_changed.sql';")
+	if err == nil || !strings.Contains(err.Error(), "different file") {
+		t.Fatalf("expected a checksum mismatch, got %v", err)
+	}
+
+	// A failing statement undoes the statements applied before it
+	writeMigration("0002_items.sql", `CREATE TABLE items (item_id INT);
+CREATE INDEX items_id ON items (item_id);
+DROP INDEX orders_id ON orders;
+CREATE TABLE items (item_id INT);
+`)
+
+	err = execute("APPLY MIGRATION 'items' FROM '0002_items.sql';")
+	if err == nil || !strings.HasPrefix(err.Error(), "statement 4") {
+		t.Fatalf("expected statement 4 to fail, got %v", err)
+	}
+
+	if aria.Catalog.GetDatabase("test").GetTable("items") != nil || tbl.GetIndex("orders_id") == nil {
+		t.Fatal("expected the items table dropped and the orders index created again")
+	}
+
+	// Statements which cannot be undone are not allowed, nothing is applied
+	writeMigration("0003_drop.sql", "CREATE TABLE logs (log_id INT);\nDROP TABLE orders;\n")
+
+	err = execute("APPLY MIGRATION 'drop_orders' FROM '0003_drop.sql';")
+	if err == nil || err.Error() != "statement 2: DROP TABLE cannot be undone and is not allowed in a migration" {
+		t.Fatalf("expected DROP TABLE to be rejected, got %v", err)
+	}
+
+	if aria.Catalog.GetDatabase("test").GetTable("logs") != nil {
+		t.Fatal("expected no statement to be applied")
+	}
+
+	for _, stmt := range []string{
+		"APPLY MIGRATION 'escape' FROM '../0001_orders.sql';",
+		"APPLY MIGRATION 'missing' FROM 'missing.sql';",
+	} {
+		err = execute(stmt)
+		if err == nil {
+			t.Fatalf("expected error for %s", stmt)
+		}
+	}
+
+	err = execute("SHOW MIGRATIONS;")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(string(ex.GetResultSet()), `"AppliedBy":"admin"`) || !strings.Contains(string(ex.GetResultSet()), `"File":"0001_orders.sql"`) {
+		t.Fatalf("expected the orders migration, got %s", string(ex.GetResultSet()))
+	}
+
+	err = execute("SELECT version, name, statements FROM sys.migrations WHERE name = 'orders';")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(ex.GetResultSet()) != `[{"version":1,"name":"orders","statements":3}]` {
+		t.Fatalf("unexpected migrations %s", string(ex.GetResultSet()))
+	}
+}
+
+func TestStmt124(t *testing.T) {
+	defer os.RemoveAll("./test/")
+
+	// Create a new AriaSQL instance
+	aria, err := core.New(&core.Config{
+		DataDir: "./test",
+	})
+	if err != nil {
+		t.Fatal(err)
+		return
+
+	}
+
+	aria.Catalog = catalog.New(aria.Config.DataDir)
+
+	if err := aria.Catalog.Open(); err != nil {
+		t.Fatal(err)
+		return
+	}
+
+	defer aria.Close()
+
+	aria.Channels = make([]*core.Channel, 0)
+	aria.ChannelsLock = &sync.Mutex{}
+
+	ex := New(aria, aria.OpenChannel(aria.Catalog.GetUser("admin")))
+	ex.SetJsonOutput(true)
+
+	execute := func(stmt string) error {
+		t.Log(stmt)
+
+		ast, err := parser.NewParser(parser.NewLexer([]byte(stmt))).Parse()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ex.Clear()
+
+		return ex.Execute(ast)
+	}
+
+	for _, stmt := range []string{
+		"CREATE DATABASE test;",
+		"USE test;",
+		"CREATE TABLE users (user_id INT PRIMARY KEY, email CHAR(100) NOT NULL UNIQUE);",
+		"CREATE TABLE orders (order_id INT PRIMARY KEY, user_id INT, total DECIMAL(10,2) DEFAULT 0.5, status TEXT DEFAULT 'new', created DATETIME DEFAULT SYS_TIMESTAMP, FOREIGN KEY (user_id) REFERENCES users(user_id));",
+		"CREATE INDEX orders_user ON orders (user_id, created);",
+	} {
+		err = execute(stmt)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err = execute("DESCRIBE orders;")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var tables []struct {
+		Table   string
+		Columns []struct {
+			Name       string
+			Type       string
+			DataType   string
+			Precision  int
+			Scale      int
+			Nullable   bool
+			Default    interface{}
+			PrimaryKey bool
+			References *struct{ Table, Column string }
+		}
+		PrimaryKey  []string
+		ForeignKeys []struct {
+			Column, ReferencedTable, ReferencedColumn string
+			Valid                                     bool
+		}
+		Indexes []struct {
+			Name    string
+			Columns []string
+			Unique  bool
+		}
+	}
+
+	err = json.Unmarshal(ex.GetResultSet(), &tables)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(tables) != 1 || tables[0].Table != "orders" || len(tables[0].Columns) != 5 {
+		t.Fatalf("expected the 5 columns of orders, got %s", string(ex.GetResultSet()))
+	}
+
+	columns := tables[0].Columns
+
+	// Columns are in name order
+	if columns[0].Name != "created" || columns[0].Default != "SYS_TIMESTAMP" || !columns[0].Nullable {
+		t.Fatalf("unexpected created column %+v", columns[0])
+	}
+
+	if columns[1].Name != "order_id" || !columns[1].PrimaryKey || columns[1].Nullable {
+		t.Fatalf("unexpected order_id column %+v", columns[1])
+	}
+
+	if columns[3].Name != "total" || columns[3].Type != "DECIMAL(10,2)" || columns[3].DataType != "DECIMAL" || columns[3].Precision != 10 || columns[3].Scale != 2 || columns[3].Default != "0.5" {
+		t.Fatalf("unexpected total column %+v", columns[3])
+	}
+
+	if columns[2].Default != "'new'" || columns[4].References == nil || columns[4].References.Table != "users" {
+		t.Fatalf("unexpected status or user_id column %+v %+v", columns[2], columns[4])
+	}
+
+	if len(tables[0].PrimaryKey) != 1 || tables[0].PrimaryKey[0] != "order_id" {
+		t.Fatalf("expected order_id primary key, got %v", tables[0].PrimaryKey)
+	}
+
+	if len(tables[0].ForeignKeys) != 1 || tables[0].ForeignKeys[0].ReferencedColumn != "user_id" || !tables[0].ForeignKeys[0].Valid {
+		t.Fatalf("expected a foreign key on user_id, got %+v", tables[0].ForeignKeys)
+	}
+
+	if len(tables[0].Indexes) != 3 || tables[0].Indexes[0].Name != "fk_user_id" || tables[0].Indexes[1].Name != "orders_user" || len(tables[0].Indexes[1].Columns) != 2 || !tables[0].Indexes[2].Unique {
+		t.Fatalf("expected the foreign key index, orders_user and the primary key index, got %+v", tables[0].Indexes)
+	}
+
+	// Every table of the database
+	err = execute("DESCRIBE;")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = json.Unmarshal(ex.GetResultSet(), &tables)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(tables) != 2 || tables[0].Table != "orders" || tables[1].Table != "users" {
+		t.Fatalf("expected orders and users, got %s", string(ex.GetResultSet()))
+	}
+
+	// The table output has a row per column
+	ex.SetJsonOutput(false)
+
+	err = execute("DESCRIBE users;")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expect := `+-------+---------+-----------+----------+---------+-----+------------+
+| Table | Column  | Type      | Nullable | Default | Key | References |
++-------+---------+-----------+----------+---------+-----+------------+
+| users | email   | CHAR(100) | NO       |         | UNI |            |
+| users | user_id | INT       | NO       |         | PRI |            |
++-------+---------+-----------+----------+---------+-----+------------+
+`
+	if string(ex.GetResultSet()) != expect {
+		t.Fatalf("expected %s, got %s", expect, string(ex.GetResultSet()))
+	}
+
+	err = execute("DESCRIBE missing;")
+	if err == nil {
+		t.Fatal("expected error for a missing table")
+	}
+}
+
+func TestStmt125(t *testing.T) {
+	defer os.RemoveAll("./test/")
+
+	// Create a new AriaSQL instance
+	aria, err := core.New(&core.Config{
+		DataDir:  "./test",
+		Watchdog: &core.Watchdog{MaxQueryBytes: 2000},
+	})
+	if err != nil {
+		t.Fatal(err)
+		return
+
+	}
+
+	aria.Catalog = catalog.New(aria.Config.DataDir)
+
+	if err := aria.Catalog.Open(); err != nil {
+		t.Fatal(err)
+		return
+	}
+
+	defer aria.Close()
+
+	aria.Channels = make([]*core.Channel, 0)
+	aria.ChannelsLock = &sync.Mutex{}
+
+	ch := aria.OpenChannel(aria.Catalog.GetUser("admin"))
+	ex := New(aria, ch)
+
+	execute := func(stmt string) error {
+		t.Log(stmt)
+
+		ast, err := parser.NewParser(parser.NewLexer([]byte(stmt))).Parse()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ex.Clear()
+
+		// The server begins a query on the channel for every statement
+		ch.BeginQuery(stmt)
+		defer ch.EndQuery()
+
+		return ex.Execute(ast)
+	}
+
+	for _, stmt := range []string{
+		"CREATE DATABASE test;",
+		"USE test;",
+		"CREATE TABLE small (id INT, name CHAR(50));",
+		"CREATE TABLE large (id INT, name CHAR(50));",
+		"INSERT INTO small (id, name) VALUES (1, 'a'), (2, 'b');",
+	} {
+		err = execute(stmt)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for i := 0; i < 100; i++ {
+		err = execute(fmt.Sprintf("INSERT INTO large (id, name) VALUES (%d, 'row %d');", i, i))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err = execute("SELECT * FROM small;")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A query reading more bytes of rows than a query can is cancelled
+	err = execute("SELECT * FROM large;")
+	if !errors.Is(err, core.ErrQueryCancelled) {
+		t.Fatalf("expected the query to be cancelled, got %v", err)
+	}
+
+	// A query cancelled by the watchdog fails on the next row it reads
+	ch.BeginQuery("SELECT * FROM small;").Cancel("server memory over the limit")
+
+	ast, err := parser.NewParser(parser.NewLexer([]byte("SELECT * FROM small;"))).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = ex.Execute(ast)
+	if err == nil || err.Error() != "query cancelled: server memory over the limit" {
+		t.Fatalf("expected the query to be cancelled, got %v", err)
+	}
+
+	ch.EndQuery()
+
+	// Statements executed without a query on the channel are not counted
+	ex.Clear()
+
+	ast, err = parser.NewParser(parser.NewLexer([]byte("SELECT * FROM large;"))).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = ex.Execute(ast)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestStmt126(t *testing.T) {
+	defer os.RemoveAll("./test/")
+	defer fault.Reset()
+
+	// Create a new AriaSQL instance
+	aria, err := core.New(&core.Config{
+		DataDir: "./test",
+	})
+	if err != nil {
+		t.Fatal(err)
+		return
+
+	}
+
+	aria.Catalog = catalog.New(aria.Config.DataDir)
+
+	if err := aria.Catalog.Open(); err != nil {
+		t.Fatal(err)
+		return
+	}
+
+	defer aria.Close()
+
+	aria.Channels = make([]*core.Channel, 0)
+	aria.ChannelsLock = &sync.Mutex{}
+
+	ex := New(aria, aria.OpenChannel(aria.Catalog.GetUser("admin")))
+	ex.SetJsonOutput(true)
+
+	execute := func(stmt string) error {
+		t.Log(stmt)
+
+		ast, err := parser.NewParser(parser.NewLexer([]byte(stmt))).Parse()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ex.Clear()
+
+		return ex.Execute(ast)
+	}
+
+	for _, stmt := range []string{
+		"CREATE DATABASE test;",
+		"USE test;",
+		"CREATE TABLE users (user_id INT SEQUENCE NOT NULL UNIQUE, name CHAR(50));",
+		"INSERT INTO users (name) VALUES ('alex');",
+	} {
+		err = execute(stmt)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The disk fills up while the sequence of the next row is written
+	fault.Inject(&fault.Fault{Op: fault.WRITE, File: ".seq", Nth: 1, Kind: fault.NO_SPACE})
+
+	err = execute("INSERT INTO users (name) VALUES ('jane');")
+	if !errors.Is(err, syscall.ENOSPC) {
+		t.Fatalf("expected the disk to be full, got %v", err)
+	}
+
+	if aria.ReadOnly() == nil {
+		t.Fatal("expected the server to be read-only")
+	}
+
+	fault.Reset()
+
+	// Writes are refused while reads still work
+	err = execute("INSERT INTO users (name) VALUES ('jim');")
+	if !errors.Is(err, core.ErrReadOnly) {
+		t.Fatalf("expected the server to be read-only, got %v", err)
+	}
+
+	err = execute("CREATE TABLE orders (order_id INT);")
+	if !errors.Is(err, core.ErrReadOnly) {
+		t.Fatalf("expected the server to be read-only, got %v", err)
+	}
+
+	err = execute("SELECT name FROM users WHERE name = 'alex';")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(ex.GetResultSet()) != `[{"name":"alex"}]` {
+		t.Fatalf("unexpected users %s", string(ex.GetResultSet()))
+	}
+
+	err = execute("SELECT read_only, reason, read_only_count FROM sys.disk;")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(ex.GetResultSet()) != `[{"read_only":1,"reason":"the disk of the data directory is full","read_only_count":1}]` {
+		t.Fatalf("unexpected disk %s", string(ex.GetResultSet()))
+	}
+
+	// Once space is freed writes succeed again
+	aria.SetReadWrite()
+
+	err = execute("INSERT INTO users (name) VALUES ('jim');")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = execute("SELECT read_only FROM sys.disk;")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(ex.GetResultSet()) != `[{"read_only":0}]` {
+		t.Fatalf("unexpected disk %s", string(ex.GetResultSet()))
+	}
+}
+
+func TestStmt127(t *testing.T) {
+	defer os.RemoveAll("./test/")
+
+	// Create a new AriaSQL instance
+	aria, err := core.New(&core.Config{
+		DataDir: "./test",
+	})
+	if err != nil {
+		t.Fatal(err)
+		return
+
+	}
+
+	aria.Catalog = catalog.New(aria.Config.DataDir)
+
+	if err := aria.Catalog.Open(); err != nil {
+		t.Fatal(err)
+		return
+	}
+
+	defer aria.Close()
+
+	aria.Channels = make([]*core.Channel, 0)
+	aria.ChannelsLock = &sync.Mutex{}
+
+	ex := New(aria, aria.OpenChannel(aria.Catalog.GetUser("admin")))
+	ex.SetJsonOutput(true)
+
+	execute := func(stmt string) error {
+		t.Log(stmt)
+
+		ast, err := parser.NewParser(parser.NewLexer([]byte(stmt))).Parse()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ex.Clear()
+
+		return ex.Execute(ast)
+	}
+
+	for _, stmt := range []string{
+		"CREATE DATABASE test;",
+		"USE test;",
+		"CREATE TABLE users (user_id INT, name CHAR(50));",
+		"CREATE TABLE orders (order_id INT, user_id INT);",
+		"INSERT INTO users (user_id, name) VALUES (1, 'alex');",
+	} {
+		err = execute(stmt)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	aria.Catalog.Close()
+
+	// Damage the schema of a table and start in safe mode
+	err = os.WriteFile(filepath.Join("test", "databases", "test", "orders", "orders"+catalog.DB_SCHEMA_TABLE_SCHEMA_FILE_EXTENSION), []byte("not a schema"), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	aria.Catalog = catalog.New(aria.Config.DataDir)
+	aria.Catalog.SafeMode = true
+
+	if err := aria.Catalog.Open(); err != nil {
+		t.Fatal(err)
+	}
+
+	ex = New(aria, aria.OpenChannel(aria.Catalog.GetUser("admin")))
+	ex.SetJsonOutput(true)
+
+	for _, stmt := range []string{"USE test;", "SELECT name FROM users;"} {
+		err = execute(stmt)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if string(ex.GetResultSet()) != `[{"name":"alex"}]` {
+		t.Fatalf("unexpected users %s", string(ex.GetResultSet()))
+	}
+
+	err = execute("SELECT database_name, name, kind FROM sys.quarantine;")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(ex.GetResultSet()) != `[{"database_name":"test","name":"orders","kind":"TABLE"}]` {
+		t.Fatalf("unexpected quarantine %s", string(ex.GetResultSet()))
+	}
+
+	err = execute("DROP TABLE orders;")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = execute("SELECT name FROM sys.quarantine;")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(ex.GetResultSet()) != `null` {
+		t.Fatalf("expected nothing quarantined, got %s", string(ex.GetResultSet()))
+	}
+}
+
+func TestStmt128(t *testing.T) {
+	defer os.RemoveAll("./test/")
+
+	// Create a new AriaSQL instance
+	aria, err := core.New(&core.Config{
+		DataDir: "./test",
+	})
+	if err != nil {
+		t.Fatal(err)
+		return
+
+	}
+
+	aria.Catalog = catalog.New(aria.Config.DataDir)
+
+	if err := aria.Catalog.Open(); err != nil {
+		t.Fatal(err)
+		return
+	}
+
+	defer aria.Close()
+
+	aria.Channels = make([]*core.Channel, 0)
+	aria.ChannelsLock = &sync.Mutex{}
+
+	ch := aria.OpenChannel(aria.Catalog.GetUser("admin"))
+	ex := New(aria, ch)
+
+	other := New(aria, aria.OpenChannel(aria.Catalog.GetUser("admin")))
+
+	execute := func(ex *Executor, stmt string) error {
+		t.Log(stmt)
+
+		ast, err := parser.NewParser(parser.NewLexer([]byte(stmt))).Parse()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ex.Clear()
+
+		return ex.Execute(ast)
+	}
+
+	for _, stmt := range []string{
+		"CREATE DATABASE test;",
+		"USE test;",
+		"CREATE TABLE users (user_id INT, name CHAR(50));",
+		"INSERT INTO users (user_id, name) VALUES (1, 'alex'), (2, 'jane');",
+	} {
+		err = execute(ex, stmt)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err = execute(other, "USE test;")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	buf := &bytes.Buffer{}
+	log.SetOutput(buf)
+	defer log.SetOutput(os.Stderr)
+
+	err = execute(ex, "SET trace = 'statement,plan,io';")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = execute(ex, "SELECT name FROM users WHERE user_id = 1;")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Statements of other sessions are not logged
+	err = execute(other, "SELECT name FROM users;")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	output := buf.String()
+
+	session := fmt.Sprintf("session %d: ", ch.ChannelID)
+
+	for _, line := range []string{session + "statement: SELECT returned or changed 1 row(s)", session + "plan: filter users took", session + "plan: project took", session + "io: SELECT read "} {
+		if !strings.Contains(output, line) {
+			t.Fatalf("expected %q to be logged, got %s", line, output)
+		}
+	}
+
+	if strings.Contains(output, fmt.Sprintf("session %d: ", other.ch.ChannelID)) {
+		t.Fatalf("expected nothing logged for the other session, got %s", output)
+	}
+
+	err = execute(ex, "SET SESSION trace TO 'verbose';")
+	if err == nil {
+		t.Fatal("expected error for an unknown trace option")
+	}
+
+	err = execute(ex, "SET trace = 'off';")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	buf.Reset()
+
+	err = execute(ex, "SELECT name FROM users;")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if buf.Len() != 0 {
+		t.Fatalf("expected nothing logged, got %s", buf.String())
+	}
+
+	err = execute(ex, "SET isolation = 'serializable';")
+	if err == nil {
+		t.Fatal("expected error for an unknown setting")
+	}
+}
+
+func TestStmt129(t *testing.T) {
+	defer os.RemoveAll("./test/")
+
+	// Create a new AriaSQL instance
+	aria, err := core.New(&core.Config{
+		DataDir: "./test",
+	})
+	if err != nil {
+		t.Fatal(err)
+		return
+
+	}
+
+	aria.Catalog = catalog.New(aria.Config.DataDir)
+
+	if err := aria.Catalog.Open(); err != nil {
+		t.Fatal(err)
+		return
+	}
+
+	defer aria.Close()
+
+	aria.Channels = make([]*core.Channel, 0)
+	aria.ChannelsLock = &sync.Mutex{}
+
+	ex := New(aria, aria.OpenChannel(aria.Catalog.GetUser("admin")))
+	ex.SetJsonOutput(true)
+
+	execute := func(stmt string) error {
+		t.Log(stmt)
+
+		ast, err := parser.NewParser(parser.NewLexer([]byte(stmt))).Parse()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ex.Clear()
+
+		return ex.Execute(ast)
+	}
+
+	for _, stmt := range []string{
+		"CREATE DATABASE test WITH (compress = true, collation = 'nocase');",
+		"USE test;",
+		"CREATE TABLE users (user_id INT, name CHAR(50));",
+		"CREATE TABLE tags (tag_id INT, name CHAR(50)) WITH (compress = false, collation = '');",
+		"INSERT INTO users (user_id, name) VALUES (1, 'alex'), (2, 'Bob'), (3, 'ALEX');",
+		"INSERT INTO tags (tag_id, name) VALUES (1, 'go'), (2, 'GO');",
+	} {
+		err = execute(stmt)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	users := ex.ch.Database.GetTable("users")
+	if !users.Compress || users.TableSchema.Collation != "nocase" {
+		t.Fatalf("expected users to inherit the defaults of the database, got compress %v collation %s", users.Compress, users.TableSchema.Collation)
+	}
+
+	tags := ex.ch.Database.GetTable("tags")
+	if tags.Compress || tags.TableSchema.Collation != "" {
+		t.Fatal("expected tags to override the defaults of the database")
+	}
+
+	// String columns compare and order in the default collation of their table
+	err = execute("SELECT user_id FROM users WHERE name = 'Alex';")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(ex.GetResultSet()) != `[{"user_id":1},{"user_id":3}]` {
+		t.Fatalf("unexpected users %s", string(ex.GetResultSet()))
+	}
+
+	err = execute("SELECT name FROM users ORDER BY name ASC;")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// In binary Bob sorts between ALEX and alex
+	if !strings.HasSuffix(string(ex.GetResultSet()), `{"name":"Bob"}]`) {
+		t.Fatalf("unexpected order %s", string(ex.GetResultSet()))
+	}
+
+	// COLLATE given in the statement wins
+	err = execute("SELECT user_id FROM users WHERE name = 'alex' COLLATE binary;")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(ex.GetResultSet()) != `[{"user_id":1}]` {
+		t.Fatalf("unexpected users %s", string(ex.GetResultSet()))
+	}
+
+	err = execute("SELECT tag_id FROM tags WHERE name = 'go';")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(ex.GetResultSet()) != `[{"tag_id":1}]` {
+		t.Fatalf("unexpected tags %s", string(ex.GetResultSet()))
+	}
+
+	// Tables of a database encrypting new tables need a key unless they opt out
+	for _, stmt := range []string{
+		"CREATE DATABASE secure WITH (encrypt = true);",
+		"USE secure;",
+		"CREATE TABLE notes (note_id INT, body TEXT, ENCRYPT('secret'));",
+		"CREATE TABLE lookups (lookup_id INT) WITH (encrypt = false);",
+	} {
+		err = execute(stmt)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if !ex.ch.Database.GetTable("notes").Encrypt || ex.ch.Database.GetTable("lookups").Encrypt {
+		t.Fatal("expected only notes to be encrypted")
+	}
+
+	for _, stmt := range []string{
+		"CREATE TABLE secrets (secret_id INT);",
+		"CREATE TABLE secrets (secret_id INT) WITH (replicas = 3);",
+		"CREATE TABLE secrets (secret_id INT) WITH (compress = 'yes');",
+		"CREATE DATABASE other WITH (collation = 'not a collation');",
+	} {
+		err = execute(stmt)
+		if err == nil {
+			t.Fatalf("expected error for %s", stmt)
+		}
+	}
+}
+
+func TestStmt130(t *testing.T) {
+	defer os.RemoveAll("./test/")
+	defer os.RemoveAll("./test_cold/")
+
+	// Create a new AriaSQL instance
+	aria, err := core.New(&core.Config{
+		DataDir: "./test",
+		Tiering: &core.Tiering{ColdDir: "./test_cold"},
+	})
+	if err != nil {
+		t.Fatal(err)
+		return
+
+	}
+
+	aria.Catalog = catalog.New(aria.Config.DataDir)
+	aria.Catalog.ColdDirectory = aria.Config.Tiering.ColdDir
+
+	if err := aria.Catalog.Open(); err != nil {
+		t.Fatal(err)
+		return
+	}
+
+	defer aria.Close()
+
+	aria.Channels = make([]*core.Channel, 0)
+	aria.ChannelsLock = &sync.Mutex{}
+
+	ex := New(aria, aria.OpenChannel(aria.Catalog.GetUser("admin")))
+	ex.SetJsonOutput(true)
+
+	execute := func(stmt string) error {
+		t.Log(stmt)
+
+		ast, err := parser.NewParser(parser.NewLexer([]byte(stmt))).Parse()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ex.Clear()
+
+		return ex.Execute(ast)
+	}
+
+	for _, stmt := range []string{
+		"CREATE DATABASE test;",
+		"USE test;",
+		"CREATE TABLE orders (order_id INT, item CHAR(50));",
+		"INSERT INTO orders (order_id, item) VALUES (1, 'pen'), (2, 'ink');",
+		"MOVE TABLE orders TO TIER COLD;",
+		"INSERT INTO orders (order_id, item) VALUES (3, 'paper');",
+	} {
+		err = execute(stmt)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// A table on the cold tier stays queryable
+	err = execute("SELECT item FROM orders WHERE order_id > 1;")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(ex.GetResultSet()) != `[{"item":"ink"},{"item":"paper"}]` {
+		t.Fatalf("unexpected orders %s", string(ex.GetResultSet()))
+	}
+
+	err = execute("SELECT table_name, tier FROM sys.tiers;")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(ex.GetResultSet()) != `[{"table_name":"orders","tier":"COLD"}]` {
+		t.Fatalf("unexpected tiers %s", string(ex.GetResultSet()))
+	}
+
+	if _, err = os.Stat(filepath.Join("test_cold", "databases", "test", "orders")); err != nil {
+		t.Fatal("expected the table files within the cold directory")
+	}
+
+	err = execute("MOVE TABLE orders TO TIER HOT;")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = execute("SELECT COUNT(*) FROM orders;")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(ex.GetResultSet()) != `[{"COUNT":3}]` {
+		t.Fatalf("unexpected count %s", string(ex.GetResultSet()))
+	}
+
+	for _, stmt := range []string{
+		"MOVE TABLE orders TO TIER HOT;",
+		"MOVE TABLE items TO TIER COLD;",
+	} {
+		err = execute(stmt)
+		if err == nil {
+			t.Fatalf("expected error for %s", stmt)
+		}
+	}
+}
+
+func TestStmt131(t *testing.T) {
+	defer os.RemoveAll("./test/")
+
+	// Create a new AriaSQL instance
+	aria, err := core.New(&core.Config{
+		DataDir: "./test",
+	})
+	if err != nil {
+		t.Fatal(err)
+		return
+
+	}
+
+	aria.Catalog = catalog.New(aria.Config.DataDir)
+
+	if err := aria.Catalog.Open(); err != nil {
+		t.Fatal(err)
+		return
+	}
+
+	defer aria.Close()
+
+	aria.Channels = make([]*core.Channel, 0)
+	aria.ChannelsLock = &sync.Mutex{}
+
+	ex := New(aria, aria.OpenChannel(aria.Catalog.GetUser("admin")))
+	ex.SetJsonOutput(true)
+
+	other := New(aria, aria.OpenChannel(aria.Catalog.GetUser("admin")))
+	other.SetJsonOutput(true)
+
+	execute := func(ex *Executor, stmt string) error {
+		t.Log(stmt)
+
+		ast, err := parser.NewParser(parser.NewLexer([]byte(stmt))).Parse()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ex.Clear()
+
+		return ex.Execute(ast)
+	}
+
+	for _, stmt := range []string{
+		"CREATE DATABASE test;",
+		"USE test;",
+		"CREATE TABLE doctors (name CHAR(50), on_call INT);",
+		"CREATE TABLE shifts (name CHAR(50));",
+		"INSERT INTO doctors (name, on_call) VALUES ('alice', 1), ('bob', 1);",
+	} {
+		err = execute(ex, stmt)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err = execute(other, "USE test;")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Write skew, each transaction reads a table the other writes, one of them fails to commit
+	for _, stmt := range []string{
+		"SET TRANSACTION ISOLATION LEVEL SERIALIZABLE;",
+		"BEGIN;",
+		"SELECT * FROM doctors;",
+	} {
+		err = execute(ex, stmt)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, stmt := range []string{
+		"BEGIN;",
+		"SET TRANSACTION ISOLATION LEVEL SERIALIZABLE;",
+		"SELECT * FROM shifts;",
+		"UPDATE doctors SET on_call = 0 WHERE name = 'bob';",
+		"COMMIT;",
+	} {
+		err = execute(other, stmt)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err = execute(ex, "INSERT INTO shifts (name) VALUES ('alice');")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = execute(ex, "COMMIT;")
+	if !errors.Is(err, core.ErrSerialization) {
+		t.Fatalf("expected a serialization failure, got %v", err)
+	}
+
+	if ex.TransactionBegun {
+		t.Fatal("expected the transaction to be rolled back")
+	}
+
+	err = execute(ex, "SELECT COUNT(*) FROM shifts;")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(ex.GetResultSet()) != `[{"COUNT":0}]` {
+		t.Fatalf("expected no shifts, got %s", string(ex.GetResultSet()))
+	}
+
+	// The transaction succeeds once retried
+	for _, stmt := range []string{
+		"BEGIN;",
+		"SELECT * FROM doctors;",
+		"INSERT INTO shifts (name) VALUES ('alice');",
+		"COMMIT;",
+	} {
+		err = execute(ex, stmt)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Reading a table written since the transaction began fails
+	err = execute(ex, "BEGIN;")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = execute(other, "INSERT INTO doctors (name, on_call) VALUES ('carol', 1);")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = execute(ex, "SELECT * FROM doctors;")
+	if !errors.Is(err, core.ErrSerialization) || ex.TransactionBegun {
+		t.Fatalf("expected a serialization failure, got %v", err)
+	}
+
+	// Read committed transactions are not checked, nor do they read
+	for _, stmt := range []string{
+		"SET TRANSACTION ISOLATION LEVEL READ COMMITTED;",
+		"BEGIN;",
+		"UPDATE doctors SET on_call = 0 WHERE name = 'alice';",
+	} {
+		err = execute(ex, stmt)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err = execute(ex, "SELECT * FROM doctors;")
+	if err == nil {
+		t.Fatal("expected error reading in a read committed transaction")
+	}
+
+	err = execute(other, "INSERT INTO doctors (name, on_call) VALUES ('dave', 1);")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = execute(ex, "COMMIT;")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The level of a transaction can not change once it has written
+	for _, stmt := range []string{"BEGIN;", "INSERT INTO shifts (name) VALUES ('bob');"} {
+		err = execute(ex, stmt)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err = execute(ex, "SET TRANSACTION ISOLATION LEVEL SERIALIZABLE;")
+	if err == nil {
+		t.Fatal("expected error setting the isolation level of a transaction which wrote")
+	}
+}
+
+func TestStmt132(t *testing.T) {
+	defer os.RemoveAll("./test/")
+
+	// Create a new AriaSQL instance
+	aria, err := core.New(&core.Config{
+		DataDir: "./test",
+	})
+	if err != nil {
+		t.Fatal(err)
+		return
+
+	}
+
+	aria.Catalog = catalog.New(aria.Config.DataDir)
+
+	if err := aria.Catalog.Open(); err != nil {
+		t.Fatal(err)
+		return
+	}
+
+	defer aria.Close()
+
+	aria.Channels = make([]*core.Channel, 0)
+	aria.ChannelsLock = &sync.Mutex{}
+
+	ex := New(aria, aria.OpenChannel(aria.Catalog.GetUser("admin")))
+	ex.SetJsonOutput(true)
+
+	other := New(aria, aria.OpenChannel(aria.Catalog.GetUser("admin")))
+	other.SetJsonOutput(true)
+
+	execute := func(ex *Executor, stmt string) error {
+		t.Log(stmt)
+
+		ast, err := parser.NewParser(parser.NewLexer([]byte(stmt))).Parse()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ex.Clear()
+
+		return ex.Execute(ast)
+	}
+
+	for _, stmt := range []string{
+		"CREATE DATABASE test;",
+		"USE test;",
+		"CREATE TABLE accounts (account_id INT, balance INT);",
+		"CREATE TABLE transfers (account_id INT, amount INT);",
+		"INSERT INTO accounts (account_id, balance) VALUES (1, 100), (2, 100);",
+		"SET TRANSACTION ISOLATION LEVEL REPEATABLE READ;",
+	} {
+		err = execute(ex, stmt)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, stmt := range []string{"USE test;", "SET TRANSACTION ISOLATION LEVEL REPEATABLE READ;"} {
+		err = execute(other, stmt)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// A repeatable read transaction reads the same rows again
+	for _, stmt := range []string{"BEGIN;", "SELECT balance FROM accounts WHERE account_id = 1;", "SELECT balance FROM accounts WHERE account_id = 1;"} {
+		err = execute(ex, stmt)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if string(ex.GetResultSet()) != `[{"balance":100}]` {
+		t.Fatalf("unexpected balance %s", string(ex.GetResultSet()))
+	}
+
+	// Rows changed since the transaction began are not read
+	err = execute(other, "UPDATE accounts SET balance = 50 WHERE account_id = 1;")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = execute(ex, "SELECT balance FROM accounts WHERE account_id = 1;")
+	if !errors.Is(err, core.ErrSerialization) || ex.TransactionBegun {
+		t.Fatalf("expected a serialization failure, got %v", err)
+	}
+
+	// Of two transactions updating the same table the one committing first wins, the other is not lost silently
+	for _, e := range []*Executor{ex, other} {
+		for _, stmt := range []string{"BEGIN;", "UPDATE accounts SET balance = 0 WHERE account_id = 2;"} {
+			err = execute(e, stmt)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	err = execute(other, "COMMIT;")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = execute(ex, "COMMIT;")
+	if !errors.Is(err, core.ErrSerialization) || ex.TransactionBegun {
+		t.Fatalf("expected a serialization failure, got %v", err)
+	}
+
+	// Unlike serializable transactions, a table read which is written by another transaction since does not fail the commit
+	for _, stmt := range []string{"BEGIN;", "SELECT * FROM transfers;", "INSERT INTO accounts (account_id, balance) VALUES (3, 0);"} {
+		err = execute(ex, stmt)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err = execute(other, "INSERT INTO transfers (account_id, amount) VALUES (1, 10);")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = execute(ex, "COMMIT;")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = execute(ex, "SELECT COUNT(*) FROM accounts;")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(ex.GetResultSet()) != `[{"COUNT":3}]` {
+		t.Fatalf("expected 3 accounts, got %s", string(ex.GetResultSet()))
+	}
+}
+
+func TestStmt133(t *testing.T) {
+	defer os.RemoveAll("./test/")
+
+	// Create a new AriaSQL instance
+	aria, err := core.New(&core.Config{
+		DataDir: "./test",
+	})
+	if err != nil {
+		t.Fatal(err)
+		return
+
+	}
+
+	aria.Catalog = catalog.New(aria.Config.DataDir)
+
+	if err := aria.Catalog.Open(); err != nil {
+		t.Fatal(err)
+		return
+	}
+
+	defer aria.Close()
+
+	aria.Channels = make([]*core.Channel, 0)
+	aria.ChannelsLock = &sync.Mutex{}
+
+	ex := New(aria, aria.OpenChannel(aria.Catalog.GetUser("admin")))
+	ex.SetJsonOutput(true)
+
+	execute := func(stmt string) error {
+		t.Log(stmt)
+
+		ast, err := parser.NewParser(parser.NewLexer([]byte(stmt))).Parse()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ex.Clear()
+
+		return ex.Execute(ast)
+	}
+
+	for _, stmt := range []string{
+		"CREATE DATABASE test;",
+		"USE test;",
+		"CREATE TABLE customers (customer_id INT NOT NULL UNIQUE);",
+		"CREATE TABLE orders (order_id INT, customer_id INT, status CHAR(16));",
+		"INSERT INTO customers (customer_id) VALUES (1);",
+		"INSERT INTO orders (order_id, customer_id, status) VALUES (1, 1, 'open'), (2, 1, 'shipped');",
+		"ALTER TABLE orders ALTER COLUMN customer_id ADD REFERENCES customers (customer_id);",
+	} {
+		err = execute(stmt)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// A foreign key column is indexed
+	err = execute("SHOW INDEXES FROM orders;")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(ex.GetResultSet()) != `[{"Columns":"customer_id","Index":"fk_customer_id","Unique":false,"Visible":true}]` {
+		t.Fatalf("unexpected indexes %s", string(ex.GetResultSet()))
+	}
+
+	aria.Statements.Record([]byte("SELECT * FROM orders WHERE status = 'open';"), "test", "admin", 10*time.Millisecond, 1, nil)
+	aria.Statements.Record([]byte("SELECT * FROM orders WHERE customer_id = 1;"), "test", "admin", 10*time.Millisecond, 2, nil)
+
+	err = execute("SHOW INDEX ADVICE;")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var advice []map[string]interface{}
+
+	err = json.Unmarshal(ex.GetResultSet(), &advice)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(advice) != 1 || advice[0]["Column"] != "status" || advice[0]["Suggestion"] != "CREATE INDEX orders_status ON orders (status);" || advice[0]["EstimatedSavingUs"] != float64(5000) {
+		t.Fatalf("unexpected advice %s", string(ex.GetResultSet()))
+	}
+}
+
+func TestStmt134(t *testing.T) {
+	defer os.RemoveAll("./test/")
+
+	// Create a new AriaSQL instance
+	aria, err := core.New(&core.Config{
+		DataDir: "./test",
+	})
+	if err != nil {
+		t.Fatal(err)
+		return
+
+	}
+
+	aria.Catalog = catalog.New(aria.Config.DataDir)
+
+	if err := aria.Catalog.Open(); err != nil {
+		t.Fatal(err)
+		return
+	}
+
+	defer aria.Close()
+
+	aria.Channels = make([]*core.Channel, 0)
+	aria.ChannelsLock = &sync.Mutex{}
+
+	ex := New(aria, aria.OpenChannel(aria.Catalog.GetUser("admin")))
+	ex.SetJsonOutput(true)
+
+	execute := func(stmt string) error {
+		t.Log(stmt)
+
+		ast, err := parser.NewParser(parser.NewLexer([]byte(stmt))).Parse()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ex.Clear()
+
+		return ex.Execute(ast)
+	}
+
+	for _, stmt := range []string{
+		"CREATE DATABASE test;",
+		"USE test;",
+		"CREATE TABLE users (user_id INT NOT NULL UNIQUE, name CHAR(32), email CHAR(64));",
+		"CREATE INDEX users_email ON users (email);",
+		"INSERT INTO users (user_id, name, email) VALUES (1, 'alex', 'alex@example.com'), (2, 'sam', 'sam@example.com');",
+	} {
+		err = execute(stmt)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Nothing is traced until optimizer_trace is on
+	err = execute("SHOW OPTIMIZER TRACE;")
+	if err == nil {
+		t.Fatal("expected error without a traced statement")
+	}
+
+	trace := func() *OptimizerTrace {
+		err := execute("SHOW OPTIMIZER TRACE;")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var results []map[string]interface{}
+
+		err = json.Unmarshal(ex.GetResultSet(), &results)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		trace := &OptimizerTrace{}
+
+		err = json.Unmarshal([]byte(results[0]["Trace"].(string)), trace)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return trace
+	}
+
+	err = execute("SET optimizer_trace = ON;")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = execute("SELECT * FROM users WHERE user_id = 1;")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tr := trace()
+	if len(tr.Tables) != 1 || tr.Tables[0].Chosen != "INDEX SCAN" || tr.Tables[0].Index != "unique_user_id" || tr.Tables[0].FullScanIO != 2 {
+		t.Fatalf("expected an index scan of unique_user_id, got %+v", tr.Tables)
+	}
+
+	// A column without an index is read with a full scan
+	err = execute("SELECT * FROM users WHERE name = 'alex';")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tr = trace()
+	if tr.Tables[0].Chosen != "FULL SCAN" || len(tr.Tables[0].Candidates) != 1 || tr.Tables[0].Candidates[0].Pruned != "no visible index on the column" {
+		t.Fatalf("expected a full scan without an index on name, got %+v", tr.Tables[0])
+	}
+
+	// An invisible index is pruned
+	err = execute("ALTER INDEX users_email ON users INVISIBLE;")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = execute("DELETE FROM users WHERE email = 'sam@example.com';")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tr = trace()
+	if tr.Tables[0].Chosen != "FULL SCAN" || tr.Tables[0].Candidates[0].Pruned != "index users_email is invisible" {
+		t.Fatalf("expected the invisible index to be pruned, got %+v", tr.Tables[0].Candidates[0])
+	}
+
+	err = execute("SET optimizer_trace = OFF;")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = execute("SELECT * FROM users;")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if tr = trace(); !strings.HasPrefix(tr.Statement, "DELETE") {
+		t.Fatalf("expected the trace of the DELETE to be kept, got %s", tr.Statement)
+	}
+
+	err = execute("SET optimizer_trace = 'maybe';")
+	if err == nil {
+		t.Fatal("expected error for an invalid optimizer_trace")
+	}
+}
+
+func TestStmt135(t *testing.T) {
+	defer os.RemoveAll("./test/")
+
+	// Create a new AriaSQL instance
+	aria, err := core.New(&core.Config{
+		DataDir: "./test",
+	})
+	if err != nil {
+		t.Fatal(err)
+		return
+
+	}
+
+	aria.Catalog = catalog.New(aria.Config.DataDir)
+
+	if err := aria.Catalog.Open(); err != nil {
+		t.Fatal(err)
+		return
+	}
+
+	defer aria.Close()
+
+	aria.Channels = make([]*core.Channel, 0)
+	aria.ChannelsLock = &sync.Mutex{}
+
+	ch := aria.OpenChannel(aria.Catalog.GetUser("admin"))
+
+	ex := New(aria, ch)
+	ex.SetJsonOutput(true)
+
+	// Statements are executed as the server executes them, plans are cached by the normalized statement
+	execute := func(stmt string) error {
+		t.Log(stmt)
+
+		ast, err := parser.NewParser(parser.NewLexer([]byte(stmt))).Parse()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ex.Clear()
+
+		ch.BeginQuery(parser.Normalize([]byte(stmt)))
+		defer ch.EndQuery()
+
+		return ex.Execute(ast)
+	}
+
+	plans := func() []map[string]interface{} {
+		err := execute("SHOW PLAN CACHE;")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var results []map[string]interface{}
+
+		err = json.Unmarshal(ex.GetResultSet(), &results)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return results
+	}
+
+	for _, stmt := range []string{
+		"CREATE DATABASE test;",
+		"USE test;",
+		"CREATE TABLE users (user_id INT NOT NULL UNIQUE, name CHAR(32));",
+		"INSERT INTO users (user_id, name) VALUES (1, 'alex'), (2, 'sam');",
+		"SELECT * FROM users WHERE user_id = 1;",
+	} {
+		err = execute(stmt)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The same statement with another literal reuses the plan
+	err = execute("SELECT * FROM users WHERE user_id = 2;")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(ex.GetResultSet()) != `[{"name":"sam","user_id":2}]` {
+		t.Fatalf("unexpected rows %s", string(ex.GetResultSet()))
+	}
+
+	results := plans()
+	if len(results) != 1 || results[0]["Hits"] != float64(1) || results[0]["Plan"] != "users.user_id INDEX SCAN unique_user_id" || results[0]["Tables"] != "users" {
+		t.Fatalf("unexpected plans %v", results)
+	}
+
+	// Altering an index of the table invalidates its plans
+	err = execute("ALTER INDEX unique_user_id ON users INVISIBLE;")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if results = plans(); len(results) != 0 {
+		t.Fatalf("expected no plans, got %v", results)
+	}
+
+	err = execute("SELECT * FROM users WHERE user_id = 1;")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if results = plans(); len(results) != 1 || results[0]["Plan"] != "users.user_id FULL SCAN" {
+		t.Fatalf("unexpected plans %v", results)
+	}
+
+	err = execute("DROP TABLE users;")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = execute("SHOW PLAN CACHE STATUS;")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var status []map[string]interface{}
+
+	err = json.Unmarshal(ex.GetResultSet(), &status)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(status) != 1 || status[0]["Plans"] != float64(0) || status[0]["Hits"] != float64(1) || status[0]["Invalidations"] != float64(2) {
+		t.Fatalf("unexpected status %v", status)
+	}
+}
+
+func TestStmt136(t *testing.T) {
+	defer os.RemoveAll("./test/")
+
+	// Create a new AriaSQL instance
+	aria, err := core.New(&core.Config{
+		DataDir: "./test",
+	})
+	if err != nil {
+		t.Fatal(err)
+		return
+
+	}
+
+	aria.Catalog = catalog.New(aria.Config.DataDir)
+
+	if err := aria.Catalog.Open(); err != nil {
+		t.Fatal(err)
+		return
+	}
+
+	defer aria.Close()
+
+	aria.Channels = make([]*core.Channel, 0)
+	aria.ChannelsLock = &sync.Mutex{}
+
+	ex := New(aria, aria.OpenChannel(aria.Catalog.GetUser("admin")))
+	ex.SetJsonOutput(true)
+
+	execute := func(stmt string) error {
+		t.Log(stmt)
+
+		ast, err := parser.NewParser(parser.NewLexer([]byte(stmt))).Parse()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ex.Clear()
+
+		return ex.Execute(ast)
+	}
+
+	values := make([]string, 50)
+	for i := range values {
+		values[i] = fmt.Sprintf("(%d, 'user%d')", i+1, i+1)
+	}
+
+	for _, stmt := range []string{
+		"CREATE DATABASE test;",
+		"USE test;",
+		"CREATE TABLE users (user_id INT, name CHAR(32));",
+		"CREATE INDEX users_user_id ON users (user_id);",
+		"INSERT INTO users (user_id, name) VALUES " + strings.Join(values, ", ") + ";",
+		"SET optimizer_trace = ON;",
+	} {
+		err = execute(stmt)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// selected returns the rows of a select and the join it traced
+	selected := func(stmt string) ([]map[string]interface{}, *OptimizerTrace) {
+		err := execute(stmt)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var rows []map[string]interface{}
+
+		err = json.Unmarshal(ex.GetResultSet(), &rows)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = execute("SHOW OPTIMIZER TRACE;")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var results []map[string]interface{}
+
+		err = json.Unmarshal(ex.GetResultSet(), &results)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		trace := &OptimizerTrace{}
+
+		err = json.Unmarshal([]byte(results[0]["Trace"].(string)), trace)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(trace.Joins) != 1 {
+			t.Fatalf("expected 1 join traced, got %+v", trace.Joins)
+		}
+
+		return rows, trace
+	}
+
+	// A table function estimated at a few rows is looked up in the index, once it returns far more the join is planned again as a hash join
+	rows, trace := selected("SELECT s.s, users.name FROM generate_series(1, 2000) AS s, users WHERE s.s = users.user_id;")
+	join := trace.Joins[0]
+	if join.Planned != INDEX_NESTED_LOOP || join.Executed != HASH_JOIN || join.Build != "RIGHT" || trace.Reoptimizations != 1 || join.Reason == "" {
+		t.Fatalf("expected an index nested loop re-optimized to a hash join, got %+v", join)
+	}
+
+	if len(rows) != 50 || rows[0]["name"] != "user1" || rows[49]["name"] != "user50" {
+		t.Fatalf("expected 50 users in order, got %v", rows)
+	}
+
+	// A hash join built on a table function far larger than estimated is built on the other input instead
+	rows, trace = selected("SELECT users.name, s.s FROM users, generate_series(1, 2000) AS s WHERE users.user_id = s.s;")
+	join = trace.Joins[0]
+	if join.Planned != HASH_JOIN || join.Executed != HASH_JOIN || join.Build != "LEFT" || join.Estimated != TABLE_FUNCTION_ROWS || join.Actual != 2000 || trace.Reoptimizations != 1 {
+		t.Fatalf("expected a hash join built on users, got %+v", join)
+	}
+
+	if len(rows) != 50 || rows[0]["name"] != "user1" || rows[49]["name"] != "user50" {
+		t.Fatalf("expected 50 users in order, got %v", rows)
+	}
+
+	// Without re-optimizations the join planned is executed
+	aria.Config.MaxReoptimizations = -1
+
+	rows, trace = selected("SELECT s.s, users.name FROM generate_series(1, 2000) AS s, users WHERE s.s = users.user_id;")
+	join = trace.Joins[0]
+	if join.Planned != INDEX_NESTED_LOOP || join.Executed != INDEX_NESTED_LOOP || join.Index != "users_user_id" || join.Actual != 50 || trace.Reoptimizations != 0 {
+		t.Fatalf("expected the index nested loop planned, got %+v", join)
+	}
+
+	if len(rows) != 50 || rows[0]["name"] != "user1" {
+		t.Fatalf("expected 50 users in order, got %v", rows)
+	}
+
+	// Without an equality predicate every combination is joined
+	rows, trace = selected("SELECT users.name, s.s FROM users, generate_series(1, 2) AS s WHERE users.user_id < 3;")
+	if trace.Joins[0].Executed != NESTED_LOOP || len(rows) != 4 {
+		t.Fatalf("expected a nested loop of 4 rows, got %+v %v", trace.Joins[0], rows)
+	}
+}
+
+func TestStmt137(t *testing.T) {
+	defer os.RemoveAll("./test/")
+
+	// Create a new AriaSQL instance
+	aria, err := core.New(&core.Config{
+		DataDir: "./test",
+	})
+	if err != nil {
+		t.Fatal(err)
+		return
+
+	}
+
+	aria.Catalog = catalog.New(aria.Config.DataDir)
+
+	if err := aria.Catalog.Open(); err != nil {
+		t.Fatal(err)
+		return
+	}
+
+	defer aria.Close()
+
+	aria.Channels = make([]*core.Channel, 0)
+	aria.ChannelsLock = &sync.Mutex{}
+
+	ex := New(aria, aria.OpenChannel(aria.Catalog.GetUser("admin")))
+	ex.SetJsonOutput(true)
+
+	execute := func(stmt string) error {
+		ast, err := parser.NewParser(parser.NewLexer([]byte(stmt))).Parse()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ex.Clear()
+
+		return ex.Execute(ast)
+	}
+
+	// Orders of a customer fill a segment of the table before the orders of the next
+	values := make([]string, 2100)
+	for i := range values {
+		values[i] = fmt.Sprintf("(%d, %d)", i+1, i/catalog.BLOOM_SEGMENT_ROWS+1)
+	}
+
+	for _, stmt := range []string{
+		"CREATE DATABASE test;",
+		"USE test;",
+		"CREATE TABLE customers (customer_id INT, name CHAR(32));",
+		"INSERT INTO customers (customer_id, name) VALUES (1, 'alex'), (2, 'sam'), (3, 'kim');",
+		"CREATE TABLE orders (order_id INT, customer_id INT);",
+		"INSERT INTO orders (order_id, customer_id) VALUES " + strings.Join(values, ", ") + ";",
+		"CREATE BLOOM FILTER orders_customer_id ON orders (customer_id);",
+		"SET optimizer_trace = ON;",
+	} {
+		err = execute(stmt)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// selected returns the rows of a select and the join it traced
+	selected := func(stmt string) ([]map[string]interface{}, *JoinTrace) {
+		err := execute(stmt)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var rows []map[string]interface{}
+
+		err = json.Unmarshal(ex.GetResultSet(), &rows)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = execute("SHOW OPTIMIZER TRACE;")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var results []map[string]interface{}
+
+		err = json.Unmarshal(ex.GetResultSet(), &results)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		trace := &OptimizerTrace{}
+
+		err = json.Unmarshal([]byte(results[0]["Trace"].(string)), trace)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(trace.Joins) != 1 {
+			t.Fatalf("expected 1 join traced, got %+v", trace.Joins)
+		}
+
+		return rows, trace.Joins[0]
+	}
+
+	stmt := "WITH c AS (SELECT * FROM customers WHERE customer_id = 3) SELECT c.name, orders.order_id FROM c, orders WHERE c.customer_id = orders.customer_id;"
+
+	// The hash join is built on the customer selected, the segments of the other customers' orders are not read
+	rows, join := selected(stmt)
+	if join.Executed != HASH_JOIN || join.Build != "LEFT" || join.RuntimeFilter != "customer_id" || join.SkippedSegments != 2 || join.Actual != 52 {
+		t.Fatalf("expected a runtime filter skipping 2 segments, got %+v", join)
+	}
+
+	if len(rows) != 52 || rows[0]["name"] != "kim" || rows[0]["order_id"] != float64(2049) {
+		t.Fatalf("expected the 52 orders of kim, got %d rows %v", len(rows), rows[0])
+	}
+
+	// Without the bloom filter every row is read, the rows of the other customers are skipped before they are joined
+	err = execute("DROP BLOOM FILTER orders_customer_id ON orders;")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rows, join = selected(stmt)
+	if join.RuntimeFilter != "customer_id" || join.SkippedSegments != 0 || join.FilteredRows < 2000 || join.Actual+join.FilteredRows != 2100 {
+		t.Fatalf("expected a runtime filter skipping the rows of other customers, got %+v", join)
+	}
+
+	if len(rows) != 52 {
+		t.Fatalf("expected the 52 orders of kim, got %d", len(rows))
+	}
+}
+
+func TestStmt138(t *testing.T) {
+	defer os.RemoveAll("./test/")
+
+	// Create a new AriaSQL instance
+	aria, err := core.New(&core.Config{
+		DataDir: "./test",
+	})
+	if err != nil {
+		t.Fatal(err)
+		return
+
+	}
+
+	aria.Catalog = catalog.New(aria.Config.DataDir)
+
+	if err := aria.Catalog.Open(); err != nil {
+		t.Fatal(err)
+		return
+	}
+
+	defer aria.Close()
+
+	aria.Channels = make([]*core.Channel, 0)
+	aria.ChannelsLock = &sync.Mutex{}
+
+	ex := New(aria, aria.OpenChannel(aria.Catalog.GetUser("admin")))
+	ex.SetJsonOutput(true)
+
+	execute := func(stmt string) error {
+		ast, err := parser.NewParser(parser.NewLexer([]byte(stmt))).Parse()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ex.Clear()
+
+		return ex.Execute(ast)
+	}
+
+	values := make([]string, 300)
+	for i := range values {
+		values[i] = fmt.Sprintf("(%d, %d)", i+1, i%3+1)
+	}
+
+	for _, stmt := range []string{
+		"CREATE DATABASE test;",
+		"USE test;",
+		"CREATE TABLE customers (customer_id INT, name CHAR(32));",
+		"INSERT INTO customers (customer_id, name) VALUES (1, 'alex'), (2, 'sam'), (3, 'kim');",
+		"CREATE TABLE orders (order_id INT, customer_id INT);",
+		"INSERT INTO orders (order_id, customer_id) VALUES " + strings.Join(values, ", ") + ";",
+		"SET optimizer_trace = ON;",
+	} {
+		err = execute(stmt)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// selected returns the rows of a select and its trace
+	selected := func(stmt string) ([]map[string]interface{}, *OptimizerTrace) {
+		err := execute(stmt)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var rows []map[string]interface{}
+
+		err = json.Unmarshal(ex.GetResultSet(), &rows)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = execute("SHOW OPTIMIZER TRACE;")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var results []map[string]interface{}
+
+		err = json.Unmarshal(ex.GetResultSet(), &results)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		trace := &OptimizerTrace{}
+
+		err = json.Unmarshal([]byte(results[0]["Trace"].(string)), trace)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return rows, trace
+	}
+
+	// The subquery is executed once, every other row reads its results from the cache
+	for _, stmt := range []string{
+		"SELECT order_id FROM orders WHERE customer_id IN (SELECT customer_id FROM customers WHERE name = 'kim');",
+		"SELECT order_id FROM orders WHERE customer_id = (SELECT customer_id FROM customers WHERE name = 'kim');",
+	} {
+		rows, trace := selected(stmt)
+		if len(rows) != 100 {
+			t.Fatalf("expected the 100 orders of kim, got %d", len(rows))
+		}
+
+		if trace.SubqueryMisses != 1 || trace.SubqueryHits < 299 {
+			t.Fatalf("expected 1 execution of the subquery and a cache hit for every other row, got %d and %d", trace.SubqueryMisses, trace.SubqueryHits)
+		}
+	}
+
+	// The cache does not outlive the statement
+	err = execute("UPDATE customers SET name = 'sam' WHERE customer_id = 3;")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rows, _ := selected("SELECT order_id FROM orders WHERE customer_id IN (SELECT customer_id FROM customers WHERE name = 'sam');")
+	if len(rows) != 200 {
+		t.Fatalf("expected the 200 orders of both customers named sam, got %d", len(rows))
+	}
+
+	// Memoization disabled executes the subquery for every row
+	aria.Config.SubqueryCacheRows = -1
+
+	rows, trace := selected("SELECT order_id FROM orders WHERE customer_id IN (SELECT customer_id FROM customers WHERE name = 'alex');")
+	if len(rows) != 100 || trace.SubqueryMisses < 300 || trace.SubqueryHits != 0 {
+		t.Fatalf("expected 300 executions of the subquery, got %d rows, %d and %d", len(rows), trace.SubqueryMisses, trace.SubqueryHits)
+	}
+
+	// A correlated subquery is keyed by the values of the outer columns it references
+	ast, err := parser.NewParser(parser.NewLexer([]byte("SELECT * FROM orders WHERE customer_id = (SELECT customer_id FROM customers AS c WHERE c.customer_id = orders.customer_id);"))).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	subquery := ast.(*parser.SelectStmt).TableExpression.WhereClause.SearchCondition.(*parser.ComparisonPredicate).Right.Value.(*parser.ValueExpression).Value.(*parser.SelectStmt)
+
+	outer := outerColumns(subquery)
+	if len(outer) != 1 || outer[0].TableName.Value != "orders" || outer[0].ColumnName.Value != "customer_id" {
+		t.Fatalf("expected orders.customer_id as the outer column, got %v", outer)
+	}
+
+	first := correlationKey(outer, &[]map[string]interface{}{{"orders.order_id": 1, "orders.customer_id": 1}})
+	second := correlationKey(outer, &[]map[string]interface{}{{"orders.order_id": 4, "orders.customer_id": 1}})
+	third := correlationKey(outer, &[]map[string]interface{}{{"orders.order_id": 2, "orders.customer_id": 2}})
+
+	if first != second || first == third {
+		t.Fatalf("expected rows of the same customer to share a correlation key, got %q, %q and %q", first, second, third)
+	}
+}
+
+func TestStmt139(t *testing.T) {
+	defer os.RemoveAll("./test/")
+
+	// Create a new AriaSQL instance
+	aria, err := core.New(&core.Config{
+		DataDir: "./test",
+	})
+	if err != nil {
+		t.Fatal(err)
+		return
+
+	}
+
+	aria.Catalog = catalog.New(aria.Config.DataDir)
+
+	if err := aria.Catalog.Open(); err != nil {
+		t.Fatal(err)
+		return
+	}
+
+	defer aria.Close()
+
+	aria.Channels = make([]*core.Channel, 0)
+	aria.ChannelsLock = &sync.Mutex{}
+
+	ex := New(aria, aria.OpenChannel(aria.Catalog.GetUser("admin")))
+	ex.SetJsonOutput(true)
+
+	execute := func(stmt string) error {
+		ast, err := parser.NewParser(parser.NewLexer([]byte(stmt))).Parse()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ex.Clear()
+
+		return ex.Execute(ast)
+	}
+
+	// results returns the rows of the statement executed last
+	results := func() []map[string]interface{} {
+		var rows []map[string]interface{}
+
+		err := json.Unmarshal(ex.GetResultSet(), &rows)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return rows
+	}
+
+	for _, stmt := range []string{
+		"CREATE DATABASE test;",
+		"USE test;",
+		"CREATE TABLE users (user_id INT UNIQUE NOT NULL, name CHAR(32));",
+		"PREPARE add_user AS INSERT INTO users (user_id, name) VALUES ($1, $2);",
+	} {
+		err = execute(stmt)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// A set of values failing does not fail the others
+	err = execute("EXECUTE add_user USING (1, 'alex'), (2, 'sam'), (1, 'kim'), (3), (4, 'lee');")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	failed := results()
+	if len(failed) != 2 || failed[0]["Row"] != float64(3) || failed[1]["Row"] != float64(4) || failed[1]["Error"] != "expected 2 values, got 1" {
+		t.Fatalf("expected rows 3 and 4 to fail, got %v", failed)
+	}
+
+	if ex.Rows() != 3 {
+		t.Fatalf("expected 3 rows inserted, got %d", ex.Rows())
+	}
+
+	// Thousands of rows are inserted in batches, a duplicate within a batch leaves out only its row
+	values := make([]string, 2500)
+	for i := range values {
+		values[i] = fmt.Sprintf("(%d, 'user%d')", i+10, i)
+	}
+
+	values[1500] = "(10, 'duplicate')"
+
+	err = execute("EXECUTE add_user USING " + strings.Join(values, ", ") + ";")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	failed = results()
+	if len(failed) != 1 || failed[0]["Row"] != float64(1501) {
+		t.Fatalf("expected row 1501 to fail, got %v", failed)
+	}
+
+	err = execute("SELECT COUNT(*) FROM users;")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if rows := results(); rows[0]["COUNT"] != float64(2502) {
+		t.Fatalf("expected 2502 users, got %v", rows)
+	}
+
+	// UPDATE and DELETE are executed for every set of values
+	for _, stmt := range []string{
+		"PREPARE set_name AS UPDATE users SET name = $1 WHERE user_id = $2;",
+		"EXECUTE set_name USING ('ALEX', 1), ('SAM', 2);",
+		"PREPARE remove_user AS DELETE FROM users WHERE user_id = $1;",
+		"EXECUTE remove_user USING (4), (10);",
+		"SELECT * FROM users WHERE user_id < 11;",
+	} {
+		err = execute(stmt)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	rows := results()
+	if len(rows) != 2 || rows[0]["name"] != "ALEX" || rows[1]["name"] != "SAM" {
+		t.Fatalf("expected ALEX and SAM, got %v", rows)
+	}
+
+	err = execute("PREPARE add_user AS INSERT INTO users (user_id, name) VALUES ($1, $2);")
+	if err == nil || err.Error() != "prepared statement add_user already exists" {
+		t.Fatalf("expected prepared statement add_user already exists, got %v", err)
+	}
+
+	err = execute("DEALLOCATE PREPARE add_user;")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = execute("EXECUTE add_user USING (5, 'kim');")
+	if err == nil || err.Error() != "prepared statement add_user does not exist" {
+		t.Fatalf("expected prepared statement add_user does not exist, got %v", err)
+	}
+}
+
+// usagePurger is a purger reporting fixed usage
+type usagePurger struct {
+	usage []core.LogUsage
+}
+
+func (p *usagePurger) Usage() ([]core.LogUsage, error) {
+	return p.usage, nil
+}
+
+func TestStmt140(t *testing.T) {
+	defer os.RemoveAll("./test/")
+
+	// Create a new AriaSQL instance
+	aria, err := core.New(&core.Config{
+		DataDir: "./test",
+	})
+	if err != nil {
+		t.Fatal(err)
+		return
+
+	}
+
+	aria.Catalog = catalog.New(aria.Config.DataDir)
+
+	if err := aria.Catalog.Open(); err != nil {
+		t.Fatal(err)
+		return
+	}
+
+	defer aria.Close()
+
+	aria.Channels = make([]*core.Channel, 0)
+	aria.ChannelsLock = &sync.Mutex{}
+
+	ex := New(aria, aria.OpenChannel(aria.Catalog.GetUser("admin")))
+	ex.SetJsonOutput(true)
+
+	execute := func(stmt string) error {
+		ast, err := parser.NewParser(parser.NewLexer([]byte(stmt))).Parse()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ex.Clear()
+
+		return ex.Execute(ast)
+	}
+
+	// Without retention no log is purged
+	err = execute("SELECT log FROM sys.retention;")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(ex.GetResultSet()) != "null" && string(ex.GetResultSet()) != "[]" {
+		t.Fatalf("expected no logs, got %s", string(ex.GetResultSet()))
+	}
+
+	aria.Purger = &usagePurger{usage: []core.LogUsage{
+		{Log: "wal", Files: 3, Bytes: 4096, Reclaimable: 1024, Purged: 2048, LastPurge: time.Now()},
+		{Log: "changelog", Files: 1, Bytes: 512},
+	}}
+
+	err = execute("SELECT log, files, bytes, reclaimable_bytes, purged_bytes FROM sys.retention WHERE reclaimable_bytes > 0;")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(ex.GetResultSet()) != `[{"log":"wal","files":3,"bytes":4096,"reclaimable_bytes":1024,"purged_bytes":2048}]` {
+		t.Fatalf("unexpected retention %s", string(ex.GetResultSet()))
+	}
+
+	err = execute("SELECT last_purge FROM sys.retention WHERE log = 'changelog';")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(ex.GetResultSet()) != `[{"last_purge":null}]` {
+		t.Fatalf("unexpected retention %s", string(ex.GetResultSet()))
+	}
+}
+
+func TestStmt141(t *testing.T) {
+	defer os.RemoveAll("./test/")
+
+	// Create a new AriaSQL instance
+	aria, err := core.New(&core.Config{
+		DataDir: "./test",
+	})
+	if err != nil {
+		t.Fatal(err)
+		return
+
+	}
+
+	aria.Catalog = catalog.New(aria.Config.DataDir)
+
+	if err := aria.Catalog.Open(); err != nil {
+		t.Fatal(err)
+		return
+	}
+
+	defer aria.Close()
+
+	aria.Channels = make([]*core.Channel, 0)
+	aria.ChannelsLock = &sync.Mutex{}
+
+	ex := New(aria, aria.OpenChannel(aria.Catalog.GetUser("admin")))
+	ex.SetJsonOutput(true)
+
+	execute := func(stmt string) error {
+		ast, err := parser.NewParser(parser.NewLexer([]byte(stmt))).Parse()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ex.Clear()
+
+		return ex.Execute(ast)
+	}
+
+	err = execute("CHECKPOINT;")
+	if err == nil || err.Error() != "checkpoints are not taken by this server" {
+		t.Fatalf("expected checkpoints not to be taken, got %v", err)
+	}
+
+	aria.Checkpointer, err = checkpoint.New(aria)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, stmt := range []string{
+		"CREATE DATABASE test;",
+		"USE test;",
+		"CREATE TABLE users (user_id INT NOT NULL UNIQUE, name CHAR(50));",
+		"INSERT INTO users (user_id, name) VALUES (1, 'alex');",
+		"CHECKPOINT;",
+	} {
+		err = execute(stmt)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err = execute("SELECT lsn, files FROM sys.checkpoint WHERE lsn > 0;")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var rows []map[string]interface{}
+
+	err = json.Unmarshal(ex.GetResultSet(), &rows)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// CREATE DATABASE, USE, CREATE TABLE and INSERT were written to the WAL before the checkpoint
+	if len(rows) != 1 || rows[0]["lsn"] != float64(4) || rows[0]["files"].(float64) == 0 {
+		t.Fatalf("unexpected checkpoint %s", string(ex.GetResultSet()))
+	}
+
+	// Writes go on after the checkpoint
+	err = execute("INSERT INTO users (user_id, name) VALUES (2, 'sam');")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = execute("BEGIN;")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = execute("CHECKPOINT;")
+	if err == nil {
+		t.Fatal("expected CHECKPOINT not to be allowed in a transaction")
+	}
+}
+
+func TestStmt142(t *testing.T) {
+	defer os.RemoveAll("./test/")
+
+	// Create a new AriaSQL instance
+	aria, err := core.New(&core.Config{
+		DataDir: "./test",
+	})
+	if err != nil {
+		t.Fatal(err)
+		return
+
+	}
+
+	aria.Catalog = catalog.New(aria.Config.DataDir)
+
+	if err := aria.Catalog.Open(); err != nil {
+		t.Fatal(err)
+		return
+	}
+
+	defer aria.Close()
+
+	aria.Channels = make([]*core.Channel, 0)
+	aria.ChannelsLock = &sync.Mutex{}
+
+	ex := New(aria, aria.OpenChannel(aria.Catalog.GetUser("admin")))
+	ex.SetJsonOutput(true)
+
+	execute := func(stmt string) error {
+		ast, err := parser.NewParser(parser.NewLexer([]byte(stmt))).Parse()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ex.Clear()
+
+		return ex.Execute(ast)
+	}
+
+	for _, stmt := range []string{
+		"CREATE DATABASE test;",
+		"USE test;",
+		"CREATE TABLE users (user_id INT NOT NULL UNIQUE, name CHAR(50));",
+		"CREATE TABLE orders (order_id INT NOT NULL UNIQUE, user_id INT);",
+		"INSERT INTO users (user_id, name) VALUES (1, 'alex'), (2, 'sam');",
+		"ALTER TABLE users WARM ON;",
+	} {
+		err = execute(stmt)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err = execute("LOAD INTO CACHE users, orders;")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var rows []map[string]interface{}
+
+	err = json.Unmarshal(ex.GetResultSet(), &rows)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The data file and the index of the unique column of each table are read
+	if len(rows) != 2 || rows[0]["Table"] != "users" || rows[0]["Files"] != float64(2) || rows[0]["Bytes"].(float64) == 0 {
+		t.Fatalf("unexpected load %s", string(ex.GetResultSet()))
+	}
+
+	err = execute("SELECT table_name, warm FROM sys.tiers;")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = json.Unmarshal(ex.GetResultSet(), &rows)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(rows) != 2 || rows[0]["table_name"] != "orders" || rows[0]["warm"] != float64(0) || rows[1]["warm"] != float64(1) {
+		t.Fatalf("unexpected tables %s", string(ex.GetResultSet()))
+	}
+
+	// Tables marked warm stay marked once the catalog is opened again, and are read on startup
+	aria.Catalog.Close()
+
+	aria.Catalog = catalog.New(aria.Config.DataDir)
+
+	if err := aria.Catalog.Open(); err != nil {
+		t.Fatal(err)
+	}
+
+	loads := aria.Catalog.WarmTables()
+	if len(loads) != 1 || loads[0].Table != "users" {
+		t.Fatalf("expected users to be warmed, got %v", loads)
+	}
+
+	err = execute("LOAD INTO CACHE missing;")
+	if err == nil || err.Error() != "table does not exist" {
+		t.Fatalf("expected table does not exist, got %v", err)
+	}
+}
+
+func TestStmt143(t *testing.T) {
+	defer os.RemoveAll("./test/")
+
+	// Create a new AriaSQL instance
+	aria, err := core.New(&core.Config{
+		DataDir: "./test",
+	})
+	if err != nil {
+		t.Fatal(err)
+		return
+
+	}
+
+	aria.Catalog = catalog.New(aria.Config.DataDir)
+
+	if err := aria.Catalog.Open(); err != nil {
+		t.Fatal(err)
+		return
+	}
+
+	defer aria.Close()
+
+	aria.Channels = make([]*core.Channel, 0)
+	aria.ChannelsLock = &sync.Mutex{}
+
+	admin := New(aria, aria.OpenChannel(aria.Catalog.GetUser("admin")))
+	admin.SetJsonOutput(true)
+
+	execute := func(ex *Executor, stmt string) error {
+		ast, err := parser.NewParser(parser.NewLexer([]byte(stmt))).Parse()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ex.Clear()
+
+		return ex.Execute(ast)
+	}
+
+	for _, stmt := range []string{
+		"CREATE DATABASE test;",
+		"USE test;",
+		"CREATE TABLE users (user_id INT NOT NULL UNIQUE, name CHAR(50));",
+		"INSERT INTO users (user_id, name) VALUES (1, 'alex'), (2, 'sam');",
+		"CREATE PROCEDURE list_users() SECURITY DEFINER BEGIN SELECT * FROM users; END;",
+		"CREATE PROCEDURE list_users_invoker() SECURITY INVOKER BEGIN SELECT * FROM users; END;",
+		"CREATE PROCEDURE user_names() BEGIN SELECT name FROM users; END;",
+		"CREATE USER app IDENTIFIED BY 'password';",
+		"GRANT EXECUTE ON test.list_users TO app;",
+		"GRANT EXEC ON test.list_users_invoker TO app;",
+	} {
+		err = execute(admin, stmt)
+		if err != nil {
+			t.Fatalf("%s: %s", stmt, err.Error())
+		}
+	}
+
+	app := New(aria, aria.OpenChannel(aria.Catalog.GetUser("app")))
+	app.SetJsonOutput(true)
+
+	err = execute(app, "USE test;")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The definer procedure reads the table with the privileges of admin
+	err = execute(app, "EXEC list_users();")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var rows []map[string]interface{}
+
+	err = json.Unmarshal(app.GetResultSet(), &rows)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(rows) != 2 {
+		t.Fatalf("expected 2 users, got %s", string(app.GetResultSet()))
+	}
+
+	// The caller gets back its own privileges
+	if app.ch.User.Username != "app" || app.ch.Database.Name != "test" {
+		t.Fatalf("expected app on test, got %s", app.ch.User.Username)
+	}
+
+	err = execute(app, "SELECT * FROM users;")
+	if err == nil || err.Error() != "user does not have the privilege to SELECT on table users" {
+		t.Fatalf("expected the SELECT privilege error, got %v", err)
+	}
+
+	// The invoker procedure runs with the privileges of app
+	err = execute(app, "EXEC list_users_invoker();")
+	if err == nil || err.Error() != "user does not have the privilege to SELECT on table users" {
+		t.Fatalf("expected the SELECT privilege error, got %v", err)
+	}
+
+	if app.ch.User.Username != "app" {
+		t.Fatalf("expected app, got %s", app.ch.User.Username)
+	}
+
+	// EXEC requires the privilege on the procedure
+	err = execute(app, "EXEC user_names();")
+	if err == nil || err.Error() != "user does not have the privilege to EXEC on procedure user_names" {
+		t.Fatalf("expected the EXEC privilege error, got %v", err)
+	}
+
+	// Nor can app take over the name of a definer procedure
+	err = execute(app, "DROP PROCEDURE list_users;")
+	if err == nil || !strings.Contains(err.Error(), "privilege") {
+		t.Fatalf("expected a privilege error, got %v", err)
+	}
+
+	err = execute(app, "CREATE PROCEDURE mine() SECURITY DEFINER BEGIN SELECT * FROM users; END;")
+	if err == nil || !strings.Contains(err.Error(), "privilege") {
+		t.Fatalf("expected a privilege error, got %v", err)
+	}
+
+	// A definer whose user was dropped can no longer be executed
+	for _, stmt := range []string{
+		"CREATE USER owner IDENTIFIED BY 'password';",
+		"GRANT ALL ON test.* TO owner;",
+	} {
+		err = execute(admin, stmt)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	owner := New(aria, aria.OpenChannel(aria.Catalog.GetUser("owner")))
+
+	for _, stmt := range []string{"USE test;", "CREATE PROCEDURE owned() SECURITY DEFINER BEGIN SELECT * FROM users; END;"} {
+		err = execute(owner, stmt)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	proc, err := aria.Catalog.GetDatabase("test").GetProcedure("owned")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if proc.Proc.(*parser.Procedure).Definer != "owner" {
+		t.Fatalf("expected owner as the definer, got %s", proc.Proc.(*parser.Procedure).Definer)
+	}
+
+	for _, stmt := range []string{"GRANT EXEC ON test.owned TO app;", "DROP USER owner;"} {
+		err = execute(admin, stmt)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err = execute(app, "EXEC owned();")
+	if err == nil || err.Error() != "definer of procedure owned does not exist" {
+		t.Fatalf("expected the definer error, got %v", err)
+	}
+}
+
+func TestStmt144(t *testing.T) {
+	defer os.RemoveAll("./test/")
+
+	// Create a new AriaSQL instance
+	aria, err := core.New(&core.Config{
+		DataDir: "./test",
+	})
+	if err != nil {
+		t.Fatal(err)
+		return
+
+	}
+
+	aria.Catalog = catalog.New(aria.Config.DataDir)
+
+	if err := aria.Catalog.Open(); err != nil {
+		t.Fatal(err)
+		return
+	}
+
+	defer aria.Close()
+
+	aria.Channels = make([]*core.Channel, 0)
+	aria.ChannelsLock = &sync.Mutex{}
+
+	admin := New(aria, aria.OpenChannel(aria.Catalog.GetUser("admin")))
+	admin.SetJsonOutput(true)
+
+	execute := func(ex *Executor, stmt string) error {
+		ast, err := parser.NewParser(parser.NewLexer([]byte(stmt))).Parse()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ex.Clear()
+
+		return ex.Execute(ast)
+	}
+
+	for _, stmt := range []string{
+		"CREATE DATABASE test;",
+		"USE test;",
+		"CREATE TABLE users (user_id INT NOT NULL UNIQUE, name CHAR(50));",
+		"INSERT INTO users (user_id, name) VALUES (1, 'alex');",
+		// The second insert fails on the unique user_id, after the first inserted as admin
+		"CREATE PROCEDURE add_users() SECURITY DEFINER BEGIN INSERT INTO users (user_id, name) VALUES (2, 'sam'); INSERT INTO users (user_id, name) VALUES (1, 'alex'); END;",
+		"CREATE USER app IDENTIFIED BY 'password';",
+		"GRANT EXEC ON test.add_users TO app;",
+	} {
+		err = execute(admin, stmt)
+		if err != nil {
+			t.Fatalf("%s: %s", stmt, err.Error())
+		}
+	}
+
+	channel := aria.OpenChannel(aria.Catalog.GetUser("app"))
+
+	app := New(aria, channel)
+	app.SetJsonOutput(true)
+
+	err = execute(app, "USE test;")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = execute(app, "EXEC add_users();")
+	if err == nil || errors.Is(err, ErrNoPrivilege) {
+		t.Fatalf("expected the procedure to fail on the unique user_id, got %v", err)
+	}
+
+	// The caller's privileges apply again after the failure, the channel was app all along
+	if app.definer != nil || channel.User.Username != "app" || app.currentUser().Username != "app" {
+		t.Fatalf("expected app, got %s", app.currentUser().Username)
+	}
+
+	for _, stmt := range []string{"SELECT * FROM users;", "INSERT INTO users (user_id, name) VALUES (3, 'kim');"} {
+		err = execute(app, stmt)
+		if !errors.Is(err, ErrNoPrivilege) {
+			t.Fatalf("%s: expected a privilege error, got %v", stmt, err)
+		}
+	}
+
+	err = execute(admin, "SELECT user_id FROM users ORDER BY user_id ASC;")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(admin.GetResultSet()) != `[{"user_id":1},{"user_id":2}]` {
+		t.Fatalf("expected the user inserted by the procedure, got %s", admin.GetResultSet())
+	}
+}
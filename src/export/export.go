@@ -0,0 +1,331 @@
+// Package export
+// AriaSQL export package
+// Copyright (C) AriaSQL
+// Author(s): Alex Gaetano Padula
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+package export
+
+import (
+	"ariasql/shared"
+	"errors"
+	"fmt"
+	"github.com/parquet-go/parquet-go"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const DIRECTORY = "exports"   // Directory within the data directory exports are written to
+const WRITE_BATCH_SIZE = 1024 // Rows handed to the Parquet writer at once
+
+// Column is a column of the exported rows
+type Column struct {
+	Name     string // Column name
+	DataType string // AriaSQL data type, if empty the type is inferred from the row values
+}
+
+// leaf is a Parquet column and the conversion of row values into it
+type leaf struct {
+	node  parquet.Node                               // Parquet column type
+	value func(v interface{}) (parquet.Value, error) // Converts a row value
+}
+
+// Path returns the path of an export file within the data directory
+// Files must be relative and cannot leave the exports directory
+func Path(dataDir, file string) (string, error) {
+	if !filepath.IsLocal(file) {
+		return "", errors.New("export file must be a relative path within the exports directory")
+	}
+
+	return filepath.Join(dataDir, DIRECTORY, file), nil
+}
+
+// WriteParquet writes rows to a Parquet file
+// Columns are written in name order, rowGroupSize limits the rows per row group if greater than 0
+func WriteParquet(filename string, columns []*Column, rows []map[string]interface{}, rowGroupSize int) error {
+	if len(columns) == 0 {
+		return errors.New("no columns to export")
+	}
+
+	columns = append([]*Column{}, columns...)
+	sort.Slice(columns, func(i, j int) bool { return columns[i].Name < columns[j].Name })
+
+	group := parquet.Group{}
+	leaves := make([]*leaf, len(columns))
+
+	for i, column := range columns {
+		var err error
+
+		if column.DataType == "" {
+			leaves[i] = inferLeaf(column.Name, rows)
+		} else {
+			leaves[i], err = dataTypeLeaf(column.DataType)
+			if err != nil {
+				return fmt.Errorf("column %s: %s", column.Name, err.Error())
+			}
+		}
+
+		group[column.Name] = parquet.Optional(leaves[i].node)
+	}
+
+	err := os.MkdirAll(filepath.Dir(filename), 0755)
+	if err != nil {
+		return err
+	}
+
+	// Write to a temporary file so a failed export does not leave a partial file behind
+	f, err := os.Create(filename + ".tmp")
+	if err != nil {
+		return err
+	}
+
+	defer os.Remove(filename + ".tmp")
+
+	options := []parquet.WriterOption{parquet.NewSchema("ariasql", group), parquet.Compression(&parquet.Snappy)}
+	if rowGroupSize > 0 {
+		options = append(options, parquet.MaxRowsPerRowGroup(int64(rowGroupSize)))
+	}
+
+	w := parquet.NewWriter(f, options...)
+
+	batch := make([]parquet.Row, 0, WRITE_BATCH_SIZE)
+
+	for _, row := range rows {
+		parquetRow := make(parquet.Row, len(columns))
+
+		for i, column := range columns {
+			v, ok := row[column.Name]
+			if !ok || v == nil {
+				parquetRow[i] = parquet.NullValue().Level(0, 0, i)
+				continue
+			}
+
+			value, err := leaves[i].value(v)
+			if err != nil {
+				f.Close()
+				return fmt.Errorf("column %s: %s", column.Name, err.Error())
+			}
+
+			parquetRow[i] = value.Level(0, 1, i)
+		}
+
+		batch = append(batch, parquetRow)
+
+		if len(batch) == WRITE_BATCH_SIZE {
+			_, err = w.WriteRows(batch)
+			if err != nil {
+				f.Close()
+				return err
+			}
+
+			batch = batch[:0]
+		}
+	}
+
+	_, err = w.WriteRows(batch)
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	err = w.Close()
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	err = f.Close()
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(filename+".tmp", filename)
+}
+
+// dataTypeLeaf returns the Parquet column for an AriaSQL data type
+func dataTypeLeaf(dataType string) (*leaf, error) {
+	switch strings.ToUpper(strings.Split(dataType, "(")[0]) {
+	case "INT", "INTEGER":
+		return &leaf{node: parquet.Int(32), value: func(v interface{}) (parquet.Value, error) {
+			i, err := toInt(v)
+			return parquet.Int32Value(int32(i)), err
+		}}, nil
+	case "SMALLINT":
+		return &leaf{node: parquet.Int(16), value: func(v interface{}) (parquet.Value, error) {
+			i, err := toInt(v)
+			return parquet.Int32Value(int32(i)), err
+		}}, nil
+	case "DEC", "DECIMAL", "NUMERIC", "REAL", "FLOAT", "DOUBLE":
+		return &leaf{node: parquet.Leaf(parquet.DoubleType), value: func(v interface{}) (parquet.Value, error) {
+			f, err := toFloat(v)
+			return parquet.DoubleValue(f), err
+		}}, nil
+	case "CHAR", "CHARACTER", "TEXT", "UUID":
+		return &leaf{node: parquet.String(), value: func(v interface{}) (parquet.Value, error) {
+			return parquet.ByteArrayValue([]byte(toString(v))), nil
+		}}, nil
+	case "BOOL", "BOOLEAN":
+		return &leaf{node: parquet.Leaf(parquet.BooleanType), value: func(v interface{}) (parquet.Value, error) {
+			b, ok := v.(bool)
+			if !ok {
+				return parquet.Value{}, fmt.Errorf("%v is not a boolean", v)
+			}
+
+			return parquet.BooleanValue(b), nil
+		}}, nil
+	case "DATE":
+		return &leaf{node: parquet.Date(), value: func(v interface{}) (parquet.Value, error) {
+			t, err := toTime(v)
+			// Days since the unix epoch
+			days := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC).Unix() / 86400
+			return parquet.Int32Value(int32(days)), err
+		}}, nil
+	case "TIME":
+		return &leaf{node: parquet.Time(parquet.Millisecond), value: func(v interface{}) (parquet.Value, error) {
+			t, err := toTime(v)
+			// Milliseconds since midnight
+			millis := t.Hour()*3600000 + t.Minute()*60000 + t.Second()*1000 + t.Nanosecond()/1000000
+			return parquet.Int32Value(int32(millis)), err
+		}}, nil
+	case "TIMESTAMP", "DATETIME":
+		return &leaf{node: parquet.Timestamp(parquet.Microsecond), value: func(v interface{}) (parquet.Value, error) {
+			t, err := toTime(v)
+			return parquet.Int64Value(t.UnixMicro()), err
+		}}, nil
+	case "BINARY", "BLOB":
+		return &leaf{node: parquet.Leaf(parquet.ByteArrayType), value: func(v interface{}) (parquet.Value, error) {
+			if b, ok := v.([]byte); ok {
+				return parquet.ByteArrayValue(b), nil
+			}
+
+			return parquet.ByteArrayValue([]byte(toString(v))), nil
+		}}, nil
+	}
+
+	return nil, fmt.Errorf("unsupported data type %s", dataType)
+}
+
+// inferLeaf returns the Parquet column for a column without a data type, such as an expression of a query, based on its first non null value
+func inferLeaf(name string, rows []map[string]interface{}) *leaf {
+	for _, row := range rows {
+		switch row[name].(type) {
+		case nil:
+			continue
+		case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+			return &leaf{node: parquet.Int(64), value: func(v interface{}) (parquet.Value, error) {
+				i, err := toInt(v)
+				return parquet.Int64Value(i), err
+			}}
+		case float32, float64:
+			l, _ := dataTypeLeaf("DOUBLE")
+			return l
+		case bool:
+			l, _ := dataTypeLeaf("BOOLEAN")
+			return l
+		case time.Time:
+			l, _ := dataTypeLeaf("TIMESTAMP")
+			return l
+		case []byte:
+			l, _ := dataTypeLeaf("BLOB")
+			return l
+		}
+
+		break
+	}
+
+	l, _ := dataTypeLeaf("TEXT")
+	return l
+}
+
+// toInt converts a row value to an integer
+func toInt(v interface{}) (int64, error) {
+	switch v := v.(type) {
+	case int:
+		return int64(v), nil
+	case int8:
+		return int64(v), nil
+	case int16:
+		return int64(v), nil
+	case int32:
+		return int64(v), nil
+	case int64:
+		return v, nil
+	case uint:
+		return int64(v), nil
+	case uint8:
+		return int64(v), nil
+	case uint16:
+		return int64(v), nil
+	case uint32:
+		return int64(v), nil
+	case uint64:
+		return int64(v), nil
+	case float64:
+		if v == math.Trunc(v) {
+			return int64(v), nil
+		}
+	case string:
+		return strconv.ParseInt(toString(v), 10, 64)
+	}
+
+	return 0, fmt.Errorf("%v is not an integer", v)
+}
+
+// toFloat converts a row value to a floating point number
+func toFloat(v interface{}) (float64, error) {
+	switch v := v.(type) {
+	case float64:
+		return v, nil
+	case float32:
+		return float64(v), nil
+	case string:
+		return strconv.ParseFloat(toString(v), 64)
+	}
+
+	i, err := toInt(v)
+	if err != nil {
+		return 0, fmt.Errorf("%v is not a floating point number", v)
+	}
+
+	return float64(i), nil
+}
+
+// toString converts a row value to a string, removing the quotes of string literals
+func toString(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return shared.UnquoteLiteral(v)
+	case time.Time:
+		return v.Format("2006-01-02 15:04:05")
+	}
+
+	return fmt.Sprintf("%v", v)
+}
+
+// toTime converts a row value to a time
+func toTime(v interface{}) (time.Time, error) {
+	switch v := v.(type) {
+	case time.Time:
+		return v, nil
+	case string:
+		return shared.StringToGOTime(toString(v))
+	}
+
+	return time.Time{}, fmt.Errorf("%v is not a date or time", v)
+}
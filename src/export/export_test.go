@@ -0,0 +1,140 @@
+// Package export tests
+// Copyright (C) AriaSQL
+// Author(s): Alex Gaetano Padula
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+package export
+
+import (
+	"github.com/parquet-go/parquet-go"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestWriteParquet(t *testing.T) {
+	defer os.RemoveAll("./exports")
+
+	created := time.Date(2024, 5, 1, 10, 30, 0, 0, time.UTC)
+
+	rows := make([]map[string]interface{}, 0)
+	for i := 0; i < 10; i++ {
+		rows = append(rows, map[string]interface{}{"id": i, "name": "'alex'", "amount": 1.5, "created": created, "total": int64(i * 2)})
+	}
+
+	rows[3]["name"] = nil
+
+	columns := []*Column{
+		{Name: "id", DataType: "INT"},
+		{Name: "name", DataType: "CHAR(32)"},
+		{Name: "amount", DataType: "DECIMAL(10,2)"},
+		{Name: "created", DataType: "DATE"},
+		{Name: "total"},
+	}
+
+	err := WriteParquet("./exports/orders.parquet", columns, rows, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.Open("./exports/orders.parquet")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	file, err := parquet.OpenFile(f, info.Size())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if file.NumRows() != 10 {
+		t.Fatalf("expected 10 rows, got %d", file.NumRows())
+	}
+
+	if len(file.RowGroups()) != 3 {
+		t.Fatalf("expected 3 row groups, got %d", len(file.RowGroups()))
+	}
+
+	// Columns are written in name order
+	expected := map[string]string{"amount": "DOUBLE", "created": "DATE", "id": "INT(32,true)", "name": "STRING", "total": "INT(64,true)"}
+
+	for i, field := range file.Schema().Fields() {
+		typ := field.Type().String()
+		if field.Type().LogicalType() == nil {
+			typ = field.Type().Kind().String()
+		}
+
+		if expected[field.Name()] != typ {
+			t.Fatalf("expected column %d %s to be %s, got %s", i, field.Name(), expected[field.Name()], typ)
+		}
+	}
+
+	reader := parquet.NewReader(file)
+	defer reader.Close()
+
+	read := make([]parquet.Row, 10)
+	n, _ := reader.ReadRows(read)
+	if n != 10 {
+		t.Fatalf("expected to read 10 rows, got %d", n)
+	}
+
+	if read[2][0].Double() != 1.5 {
+		t.Fatalf("expected amount 1.5, got %v", read[2][0])
+	}
+
+	if time.Unix(int64(read[2][1].Int32())*86400, 0).UTC().Format("2006-01-02") != "2024-05-01" {
+		t.Fatalf("expected date 2024-05-01, got %v", read[2][1])
+	}
+
+	if read[2][2].Int32() != 2 {
+		t.Fatalf("expected id 2, got %v", read[2][2])
+	}
+
+	if string(read[2][3].ByteArray()) != "alex" {
+		t.Fatalf("expected name alex without quotes, got %v", read[2][3])
+	}
+
+	if !read[3][3].IsNull() {
+		t.Fatalf("expected null name, got %v", read[3][3])
+	}
+
+	if read[2][4].Int64() != 4 {
+		t.Fatalf("expected total 4, got %v", read[2][4])
+	}
+}
+
+func TestPath(t *testing.T) {
+	path, err := Path("./data", "daily/orders.parquet")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if path != "data/exports/daily/orders.parquet" {
+		t.Fatalf("expected data/exports/daily/orders.parquet, got %s", path)
+	}
+
+	for _, file := range []string{"../orders.parquet", "/tmp/orders.parquet", "daily/../../orders.parquet"} {
+		_, err = Path("./data", file)
+		if err == nil {
+			t.Fatalf("expected error for %s", file)
+		}
+	}
+}
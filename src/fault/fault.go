@@ -0,0 +1,314 @@
+// Package fault
+// AriaSQL fault injection package
+// Copyright (C) AriaSQL
+// Author(s): Alex Gaetano Padula
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+package fault
+
+import (
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+)
+
+// Fault injection is for tests only.  Faults apply to every file opened through package storage, the data, index
+// and WAL files of the process, and to the crash points reached by the catalog and WAL.  A crash simulates the process
+// dying, every later file operation and crash point fails with ErrCrashed until Reset, so a test can reopen the data
+// directory and check what was recovered.
+
+var ErrInjected = errors.New("injected fault") // Returned by a faulted operation
+var ErrCrashed = errors.New("injected crash")  // Returned by every operation once crashed
+var ErrShortRead = io.ErrUnexpectedEOF         // Returned by a short read along with the bytes read
+
+// Op is a file operation faults are injected into
+type Op int
+
+const (
+	READ Op = iota
+	WRITE
+	SYNC
+)
+
+// Kind is the kind of fault injected
+type Kind int
+
+const (
+	FAIL       Kind = iota // The operation fails without touching the file
+	TORN_WRITE             // Only the first Bytes of the write reach the file
+	SHORT_READ             // Only the first Bytes of the read are returned
+	NO_SPACE               // The write or sync fails with ENOSPC as on a full disk, the first Bytes of a write reach the file
+)
+
+// Fault is a fault injected into the nth matching file operation
+type Fault struct {
+	Op       Op     // Operation to fault
+	File     string // Faults files whose name contains File, every file if empty
+	Nth      int    // Matching operation to fault, counting from 1
+	Kind     Kind   // Kind of fault
+	Bytes    int    // Bytes written by a torn write or read by a short read
+	Crash    bool   // Crash once the fault is injected
+	seen     int    // Matching operations seen
+	injected bool   // True once injected
+}
+
+var (
+	lock        = &sync.Mutex{}
+	enabled     atomic.Bool        // True while faults, crash points or a trace are set, operations skip the lock otherwise
+	faults      []*Fault           // Faults to inject
+	crashed     bool               // True once crashed
+	crashPoints map[string]int     // Crash points to crash at, by the hit to crash at
+	hits        map[string]int     // Hits of crash points
+	trace       func(point string) // Called with every crash point reached
+)
+
+// Inject adds faults to inject
+func Inject(f ...*Fault) {
+	lock.Lock()
+	defer lock.Unlock()
+
+	faults = append(faults, f...)
+	enabled.Store(true)
+}
+
+// CrashAt crashes on the nth time a crash point is reached, counting from 1
+func CrashAt(point string, nth int) {
+	lock.Lock()
+	defer lock.Unlock()
+
+	if crashPoints == nil {
+		crashPoints = make(map[string]int)
+		hits = make(map[string]int)
+	}
+
+	crashPoints[point] = nth
+	enabled.Store(true)
+}
+
+// Trace calls fn with every crash point reached, to find the points a test can crash at
+func Trace(fn func(point string)) {
+	lock.Lock()
+	defer lock.Unlock()
+
+	trace = fn
+	enabled.Store(true)
+}
+
+// Crash crashes now
+func Crash() {
+	lock.Lock()
+	defer lock.Unlock()
+
+	crashed = true
+	enabled.Store(true)
+}
+
+// Crashed returns true once crashed
+func Crashed() bool {
+	lock.Lock()
+	defer lock.Unlock()
+
+	return crashed
+}
+
+// Injected returns true once the fault has been injected
+func (f *Fault) Injected() bool {
+	lock.Lock()
+	defer lock.Unlock()
+
+	return f.injected
+}
+
+// Reset removes every fault, crash point and trace and recovers from a crash
+func Reset() {
+	lock.Lock()
+	defer lock.Unlock()
+
+	faults = nil
+	crashed = false
+	crashPoints = nil
+	hits = nil
+	trace = nil
+	enabled.Store(false)
+}
+
+// CrashPoint marks a point a test can crash at, returns ErrCrashed once crashed
+func CrashPoint(point string) error {
+	if !enabled.Load() {
+		return nil
+	}
+
+	lock.Lock()
+
+	if crashed {
+		lock.Unlock()
+		return ErrCrashed
+	}
+
+	fn := trace
+
+	if nth, ok := crashPoints[point]; ok {
+		hits[point]++
+
+		if hits[point] == nth {
+			crashed = true
+		}
+	}
+
+	err := error(nil)
+	if crashed {
+		err = ErrCrashed
+	}
+
+	lock.Unlock()
+
+	// The trace is called without the lock so it can inject faults or crash
+	if fn != nil {
+		fn(point)
+	}
+
+	return err
+}
+
+// next returns the fault to inject into an operation on a file, nil if none
+func next(op Op, name string) (*Fault, error) {
+	lock.Lock()
+	defer lock.Unlock()
+
+	if crashed {
+		return nil, ErrCrashed
+	}
+
+	var inject *Fault
+
+	for _, f := range faults {
+		if f.Op != op || f.injected || !strings.Contains(name, f.File) {
+			continue
+		}
+
+		f.seen++
+
+		if f.seen == f.Nth && inject == nil {
+			f.injected = true
+			inject = f
+		}
+	}
+
+	return inject, nil
+}
+
+// crashAfter crashes after a fault was injected if the fault crashes
+func crashAfter(f *Fault) {
+	if f.Crash {
+		Crash()
+	}
+}
+
+// Read reads from a file through read, injecting faults
+func Read(name string, b []byte, off int64, read func(b []byte, off int64) (int, error)) (int, error) {
+	if !enabled.Load() {
+		return read(b, off)
+	}
+
+	f, err := next(READ, name)
+	if err != nil {
+		return 0, err
+	}
+
+	if f == nil {
+		return read(b, off)
+	}
+
+	defer crashAfter(f)
+
+	if f.Kind == SHORT_READ && f.Bytes < len(b) {
+		n, err := read(b[:f.Bytes], off)
+		if err != nil {
+			return n, err
+		}
+
+		return n, ErrShortRead
+	}
+
+	return 0, ErrInjected
+}
+
+// Write writes to a file through write, injecting faults
+func Write(name string, b []byte, off int64, write func(b []byte, off int64) (int, error)) (int, error) {
+	if !enabled.Load() {
+		return write(b, off)
+	}
+
+	f, err := next(WRITE, name)
+	if err != nil {
+		return 0, err
+	}
+
+	if f == nil {
+		return write(b, off)
+	}
+
+	defer crashAfter(f)
+
+	if f.Kind == TORN_WRITE && f.Bytes < len(b) {
+		n, err := write(b[:f.Bytes], off)
+		if err != nil {
+			return n, err
+		}
+
+		return n, ErrInjected
+	}
+
+	if f.Kind == NO_SPACE {
+		n := 0
+		if f.Bytes > 0 {
+			n, err = write(b[:min(f.Bytes, len(b))], off)
+			if err != nil {
+				return n, err
+			}
+		}
+
+		return n, &os.PathError{Op: "write", Path: name, Err: syscall.ENOSPC}
+	}
+
+	return 0, ErrInjected
+}
+
+// Sync syncs a file through sync, injecting faults
+func Sync(name string, sync func() error) error {
+	if !enabled.Load() {
+		return sync()
+	}
+
+	f, err := next(SYNC, name)
+	if err != nil {
+		return err
+	}
+
+	if f == nil {
+		return sync()
+	}
+
+	defer crashAfter(f)
+
+	if f.Kind == NO_SPACE {
+		return &os.PathError{Op: "sync", Path: name, Err: syscall.ENOSPC}
+	}
+
+	return ErrInjected
+}
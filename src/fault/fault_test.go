@@ -0,0 +1,230 @@
+// Package fault tests
+// Copyright (C) AriaSQL
+// Author(s): Alex Gaetano Padula
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+package fault
+
+import (
+	"errors"
+	"testing"
+)
+
+// file is an in memory file
+type file struct {
+	data   []byte
+	syncs  int
+	writes int
+}
+
+func (f *file) read(b []byte, off int64) (int, error) {
+	return copy(b, f.data[off:]), nil
+}
+
+func (f *file) write(b []byte, off int64) (int, error) {
+	f.writes++
+	end := int(off) + len(b)
+	if end > len(f.data) {
+		f.data = append(f.data, make([]byte, end-len(f.data))...)
+	}
+
+	return copy(f.data[off:], b), nil
+}
+
+func (f *file) sync() error {
+	f.syncs++
+	return nil
+}
+
+func TestWrite(t *testing.T) {
+	defer Reset()
+
+	f := &file{}
+
+	fail := &Fault{Op: WRITE, File: ".dat", Nth: 2, Kind: FAIL}
+	Inject(fail)
+
+	// Files not matching are not counted
+	_, err := Write("table.bt", []byte("abc"), 0, f.write)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = Write("table.dat", []byte("abc"), 0, f.write)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if fail.Injected() {
+		t.Fatal("expected fault not injected yet")
+	}
+
+	n, err := Write("table.dat", []byte("def"), 3, f.write)
+	if !errors.Is(err, ErrInjected) || n != 0 {
+		t.Fatalf("expected injected fault, got %d %v", n, err)
+	}
+
+	if !fail.Injected() || f.writes != 2 {
+		t.Fatalf("expected fault injected without writing, got %d writes", f.writes)
+	}
+
+	// A fault is injected once
+	_, err = Write("table.dat", []byte("def"), 3, f.write)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(f.data) != "abcdef" {
+		t.Fatalf("expected abcdef, got %s", f.data)
+	}
+}
+
+func TestWrite_Torn(t *testing.T) {
+	defer Reset()
+
+	f := &file{}
+
+	Inject(&Fault{Op: WRITE, Nth: 1, Kind: TORN_WRITE, Bytes: 2, Crash: true})
+
+	n, err := Write("wal.dat", []byte("abcdef"), 0, f.write)
+	if !errors.Is(err, ErrInjected) || n != 2 {
+		t.Fatalf("expected torn write of 2 bytes, got %d %v", n, err)
+	}
+
+	if string(f.data) != "ab" {
+		t.Fatalf("expected ab, got %s", f.data)
+	}
+
+	if !Crashed() {
+		t.Fatal("expected crash after torn write")
+	}
+
+	_, err = Write("wal.dat", []byte("abcdef"), 0, f.write)
+	if !errors.Is(err, ErrCrashed) {
+		t.Fatalf("expected crashed, got %v", err)
+	}
+
+	err = Sync("wal.dat", f.sync)
+	if !errors.Is(err, ErrCrashed) || f.syncs != 0 {
+		t.Fatalf("expected crashed, got %v", err)
+	}
+
+	Reset()
+
+	_, err = Write("wal.dat", []byte("abcdef"), 0, f.write)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRead_Short(t *testing.T) {
+	defer Reset()
+
+	f := &file{data: []byte("abcdef")}
+
+	Inject(&Fault{Op: READ, Nth: 1, Kind: SHORT_READ, Bytes: 4})
+
+	b := make([]byte, 6)
+
+	n, err := Read("table.dat", b, 0, f.read)
+	if !errors.Is(err, ErrShortRead) || n != 4 {
+		t.Fatalf("expected short read of 4 bytes, got %d %v", n, err)
+	}
+
+	if string(b[:n]) != "abcd" {
+		t.Fatalf("expected abcd, got %s", b[:n])
+	}
+
+	Inject(&Fault{Op: READ, Nth: 1, Kind: FAIL})
+
+	_, err = Read("table.dat", b, 0, f.read)
+	if !errors.Is(err, ErrInjected) {
+		t.Fatalf("expected injected fault, got %v", err)
+	}
+}
+
+func TestSync(t *testing.T) {
+	defer Reset()
+
+	f := &file{}
+
+	Inject(&Fault{Op: SYNC, Nth: 1})
+
+	err := Sync("table.dat", f.sync)
+	if !errors.Is(err, ErrInjected) || f.syncs != 0 {
+		t.Fatalf("expected injected fault, got %v", err)
+	}
+
+	err = Sync("table.dat", f.sync)
+	if err != nil || f.syncs != 1 {
+		t.Fatalf("expected sync, got %v", err)
+	}
+}
+
+func TestCrashPoint(t *testing.T) {
+	defer Reset()
+
+	// Without crash points set every point passes
+	err := CrashPoint("wal.append.after")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reached := make([]string, 0)
+	Trace(func(point string) {
+		reached = append(reached, point)
+	})
+
+	CrashAt("wal.append.after", 2)
+
+	for i := 0; i < 2; i++ {
+		err = CrashPoint("wal.append.before")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = CrashPoint("wal.append.after")
+		if i == 0 && err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if !errors.Is(err, ErrCrashed) {
+		t.Fatalf("expected crash on second hit, got %v", err)
+	}
+
+	expected := []string{"wal.append.before", "wal.append.after", "wal.append.before", "wal.append.after"}
+	if len(reached) != len(expected) {
+		t.Fatalf("expected %v, got %v", expected, reached)
+	}
+
+	for i := range expected {
+		if reached[i] != expected[i] {
+			t.Fatalf("expected %v, got %v", expected, reached)
+		}
+	}
+
+	// Every point fails once crashed
+	err = CrashPoint("catalog.insert.row")
+	if !errors.Is(err, ErrCrashed) {
+		t.Fatalf("expected crashed, got %v", err)
+	}
+
+	Reset()
+
+	err = CrashPoint("wal.append.after")
+	if err != nil {
+		t.Fatal(err)
+	}
+}
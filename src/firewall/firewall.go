@@ -0,0 +1,275 @@
+// Package firewall
+// AriaSQL statement firewall package
+// Copyright (C) AriaSQL
+// Author(s): Alex Gaetano Padula
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+package firewall
+
+import (
+	"ariasql/core"
+	"ariasql/parser"
+	"ariasql/tracing"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+)
+
+const ACTION_BLOCK = "BLOCK" // Rejects the statement
+const ACTION_LIMIT = "LIMIT" // Adds a LIMIT to a SELECT, or lowers its LIMIT
+const ACTION_LOG = "LOG"     // Only logs the statement
+
+// Firewall checks the statements sent by clients against the configured rules
+type Firewall struct {
+	rules []*rule // Configured rules, in order
+}
+
+// rule is a configured rule and its compiled pattern
+type rule struct {
+	config  *core.Rule     // Rule configuration
+	pattern *regexp.Regexp // Compiled pattern, nil when not matching on the text
+}
+
+// New creates a firewall for the rules of the configuration
+func New(aria *core.AriaSQL) (*Firewall, error) {
+	if len(aria.Config.Rules) == 0 {
+		return nil, errors.New("no rules configured")
+	}
+
+	f := &Firewall{}
+
+	for i, config := range aria.Config.Rules {
+		if config.Name == "" {
+			return nil, fmt.Errorf("rule %d has no name", i+1)
+		}
+
+		r := &rule{config: config}
+
+		switch strings.ToUpper(config.Action) {
+		case ACTION_BLOCK, ACTION_LOG:
+		case ACTION_LIMIT:
+			if config.Limit <= 0 {
+				return nil, fmt.Errorf("rule %s: limit must be greater than 0", config.Name)
+			}
+		default:
+			return nil, fmt.Errorf("rule %s: unknown action %s, expected BLOCK, LIMIT or LOG", config.Name, config.Action)
+		}
+
+		if config.Pattern != "" {
+			var err error
+			r.pattern, err = regexp.Compile(config.Pattern)
+			if err != nil {
+				return nil, fmt.Errorf("rule %s: %s", config.Name, err.Error())
+			}
+		}
+
+		f.rules = append(f.rules, r)
+	}
+
+	return f, nil
+}
+
+// Check checks a statement against the rules in order, every rule triggered is logged
+// A BLOCK rule returns an error and stops the check, a LIMIT rule rewrites the statement in place
+func (f *Firewall) Check(channel *core.Channel, query []byte, stmt interface{}) error {
+	database := ""
+	if channel.Database != nil {
+		database = channel.Database.Name
+	}
+
+	normalized := parser.Normalize(query)
+	operation := tracing.Operation(stmt)
+	client := channel.Client()
+
+	for _, r := range f.rules {
+		if !r.matches(channel.User.Username, database, operation, normalized, stmt) {
+			continue
+		}
+
+		switch strings.ToUpper(r.config.Action) {
+		case ACTION_BLOCK:
+			log.Printf("rule %s: blocked %s by %s on %s: %s", r.config.Name, operation, client, database, normalized)
+
+			if r.config.Message != "" {
+				return fmt.Errorf("statement blocked by rule %s: %s", r.config.Name, r.config.Message)
+			}
+
+			return fmt.Errorf("statement blocked by rule %s", r.config.Name)
+		case ACTION_LIMIT:
+			if limit(stmt, r.config.Limit) {
+				log.Printf("rule %s: limited %s by %s on %s to %d rows: %s", r.config.Name, operation, client, database, r.config.Limit, normalized)
+			}
+		case ACTION_LOG:
+			log.Printf("rule %s: logged %s by %s on %s: %s", r.config.Name, operation, client, database, normalized)
+		}
+	}
+
+	return nil
+}
+
+// matches returns true if every condition of the rule set matches the statement
+func (r *rule) matches(user, database, operation, normalized string, stmt interface{}) bool {
+	if r.config.User != "" && r.config.User != user {
+		return false
+	}
+
+	if r.config.Database != "" && r.config.Database != database {
+		return false
+	}
+
+	if r.config.Statement != "" && !strings.EqualFold(r.config.Statement, operation) {
+		return false
+	}
+
+	if r.config.Table != "" && !containsFold(tables(stmt), r.config.Table) {
+		return false
+	}
+
+	if r.config.NoWhere && !noWhere(stmt) {
+		return false
+	}
+
+	if r.pattern != nil && !r.pattern.MatchString(normalized) {
+		return false
+	}
+
+	return true
+}
+
+// tables returns the tables a statement reads or changes
+func tables(stmt interface{}) []string {
+	switch s := stmt.(type) {
+	case *parser.SelectStmt:
+		var names []string
+
+		// The queries of common table expressions read tables too
+		if s.With != nil {
+			for _, cte := range s.With.CommonTableExpressions {
+				names = append(names, tables(cte.Query)...)
+			}
+		}
+
+		for s != nil {
+			if s.TableExpression != nil && s.TableExpression.FromClause != nil {
+				for _, tbl := range s.TableExpression.FromClause.Tables {
+					names = append(names, tbl.Name.Value)
+				}
+			}
+
+			s = s.Union
+		}
+
+		return names
+	case *parser.InsertStmt:
+		return []string{s.TableName.Value}
+	case *parser.UpdateStmt:
+		return []string{s.TableName.Value}
+	case *parser.DeleteStmt:
+		return []string{s.TableName.Value}
+	case *parser.DropTableStmt:
+		return []string{s.TableName.Value}
+	case *parser.AlterTableStmt:
+		return []string{s.TableName.Value}
+	case *parser.AlterIndexStmt:
+		return []string{s.TableName.Value}
+	case *parser.CreateBloomFilterStmt:
+		return []string{s.TableName.Value}
+	case *parser.DropBloomFilterStmt:
+		return []string{s.TableName.Value}
+	case *parser.CopyStmt:
+		if s.Query != nil {
+			return tables(s.Query)
+		}
+
+		return []string{s.TableName.Value}
+	case *parser.MoveTableStmt:
+		return []string{s.TableName.Value}
+	case *parser.DescribeStmt:
+		names := make([]string, 0, len(s.TableNames))
+		for _, name := range s.TableNames {
+			names = append(names, name.Value)
+		}
+
+		return names
+	case *parser.ChecksumTableStmt:
+		names := make([]string, 0, len(s.TableNames))
+		for _, name := range s.TableNames {
+			names = append(names, name.Value)
+		}
+
+		return names
+	case *parser.LoadIntoCacheStmt:
+		names := make([]string, 0, len(s.TableNames))
+		for _, name := range s.TableNames {
+			names = append(names, name.Value)
+		}
+
+		return names
+	case *parser.PrepareStmt:
+		// A prepared statement is matched when prepared, EXECUTE only binds values
+		return tables(s.Stmt)
+	}
+
+	return nil
+}
+
+// noWhere returns true if a SELECT reading a table, an UPDATE or a DELETE has no WHERE clause
+func noWhere(stmt interface{}) bool {
+	switch s := stmt.(type) {
+	case *parser.SelectStmt:
+		return s.TableExpression != nil && s.TableExpression.FromClause != nil && s.TableExpression.WhereClause == nil
+	case *parser.UpdateStmt:
+		return s.WhereClause == nil
+	case *parser.DeleteStmt:
+		return s.WhereClause == nil
+	case *parser.PrepareStmt:
+		return noWhere(s.Stmt)
+	}
+
+	return false
+}
+
+// limit limits a SELECT to count rows, returns true if the statement was rewritten
+func limit(stmt interface{}, count int) bool {
+	s, ok := stmt.(*parser.SelectStmt)
+	if !ok || s.TableExpression == nil {
+		return false
+	}
+
+	if s.TableExpression.LimitClause == nil {
+		s.TableExpression.LimitClause = &parser.LimitClause{}
+	}
+
+	current := s.TableExpression.LimitClause.Count
+	if current != nil && current.Value.(uint64) <= uint64(count) {
+		return false
+	}
+
+	s.TableExpression.LimitClause.Count = &parser.Literal{Value: uint64(count)}
+
+	return true
+}
+
+// containsFold returns true if names contains name, ignoring case
+func containsFold(names []string, name string) bool {
+	for _, n := range names {
+		if strings.EqualFold(n, name) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,140 @@
+// Package firewall tests
+// Copyright (C) AriaSQL
+// Author(s): Alex Gaetano Padula
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+package firewall
+
+import (
+	"ariasql/catalog"
+	"ariasql/core"
+	"ariasql/parser"
+	"bytes"
+	"log"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestNew(t *testing.T) {
+	for _, rules := range [][]*core.Rule{
+		nil,
+		{{Action: "BLOCK"}},
+		{{Name: "a", Action: "DROP"}},
+		{{Name: "a", Action: "LIMIT"}},
+		{{Name: "a", Action: "LOG", Pattern: "("}},
+	} {
+		_, err := New(&core.AriaSQL{Config: &core.Config{Rules: rules}})
+		if err == nil {
+			t.Fatalf("expected error for %v", rules)
+		}
+	}
+}
+
+func TestFirewall_Check(t *testing.T) {
+	var logged bytes.Buffer
+	log.SetOutput(&logged)
+	defer log.SetOutput(os.Stderr)
+
+	f, err := New(&core.AriaSQL{Config: &core.Config{Rules: []*core.Rule{
+		{Name: "no-unbounded-delete", Statement: "DELETE", NoWhere: true, Action: "BLOCK", Message: "add a WHERE clause"},
+		{Name: "limit-logs", Statement: "SELECT", Table: "logs", Action: "limit", Limit: 100},
+		{Name: "alex-drops", Statement: "DROP TABLE", User: "alex", Action: "BLOCK"},
+		{Name: "audit-users", Database: "shop", Pattern: `^UPDATE users SET`, Action: "LOG"},
+	}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	channel := &core.Channel{User: &catalog.User{Username: "alex"}, Database: &catalog.Database{Name: "shop"}}
+
+	check := func(query string) (interface{}, error) {
+		stmt, err := parser.NewParser(parser.NewLexer([]byte(query))).Parse()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return stmt, f.Check(channel, []byte(query), stmt)
+	}
+
+	_, err = check("DELETE FROM users;")
+	if err == nil || err.Error() != "statement blocked by rule no-unbounded-delete: add a WHERE clause" {
+		t.Fatalf("expected blocked delete, got %v", err)
+	}
+
+	_, err = check("DELETE FROM users WHERE user_id = 1;")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// SELECT * FROM logs is rewritten to SELECT * FROM logs LIMIT 100, lower limits are kept
+	stmt, err := check("SELECT * FROM logs;")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if stmt.(*parser.SelectStmt).TableExpression.LimitClause.Count.Value.(uint64) != 100 {
+		t.Fatal("expected LIMIT 100")
+	}
+
+	stmt, err = check("SELECT * FROM logs LIMIT 10;")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if stmt.(*parser.SelectStmt).TableExpression.LimitClause.Count.Value.(uint64) != 10 {
+		t.Fatal("expected LIMIT 10 kept")
+	}
+
+	stmt, err = check("SELECT * FROM users;")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if stmt.(*parser.SelectStmt).TableExpression.LimitClause != nil {
+		t.Fatal("expected no LIMIT on users")
+	}
+
+	_, err = check("DROP TABLE users;")
+	if err == nil {
+		t.Fatal("expected blocked drop of alex")
+	}
+
+	channel.User = &catalog.User{Username: "admin"}
+
+	_, err = check("DROP TABLE users;")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = check("UPDATE users SET name = 'jane' WHERE user_id = 2;")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, expected := range []string{
+		"rule no-unbounded-delete: blocked DELETE by alex on shop: DELETE FROM users",
+		"rule limit-logs: limited SELECT by alex on shop to 100 rows: SELECT * FROM logs",
+		"rule alex-drops: blocked DROP TABLE by alex on shop: DROP TABLE users",
+		"rule audit-users: logged UPDATE by admin on shop: UPDATE users SET name = ? WHERE user_id = ?",
+	} {
+		if !strings.Contains(logged.String(), expected) {
+			t.Fatalf("expected %q logged, got %s", expected, logged.String())
+		}
+	}
+
+	if strings.Count(logged.String(), "\n") != 4 {
+		t.Fatalf("expected 4 rules logged, got %s", logged.String())
+	}
+}
@@ -17,32 +17,498 @@
 package main
 
 import (
+	"ariasql/bench"
+	"ariasql/bootstrap"
 	"ariasql/catalog"
+	"ariasql/checkpoint"
+	"ariasql/cluster"
 	"ariasql/core"
+	"ariasql/daemon"
+	"ariasql/diff"
+	"ariasql/diskguard"
+	"ariasql/dsn"
+	"ariasql/edge"
 	"ariasql/executor"
+	"ariasql/firewall"
+	"ariasql/retention"
 	"ariasql/server"
+	"ariasql/shard"
 	"ariasql/shared"
+	"ariasql/shell"
+	"ariasql/storage"
+	"ariasql/storage/btree"
+	"ariasql/tiering"
+	"ariasql/tracing"
 	"ariasql/wal"
+	"ariasql/watchdog"
+	"ariasql/webhook"
+	"encoding/json"
 	"flag"
 	"fmt"
 	"github.com/briandowns/spinner"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
 	"sync"
 	"syscall"
 	"time"
 )
 
-// The main function starts the AriaSQL server
-// you can pass the -recover flag to recover the AriaSQL instance from the WAL if it was not shut down properly, crashed, etc
+// USAGE lists the commands of the aria binary
+const USAGE = `Usage: aria <command> [flags]
+
+Commands:
+  server   Start the AriaSQL server, the command run without one
+  shell    Connect to a server with the AriaSQL shell
+  dump     Write the tables of a database as SQL statements to stdout
+  backup   Back up, restore or verify backups of the data directory
+  check    Check the data directory for inconsistencies
+  diff     Compare the tables of a database on two instances
+  bench    Run a benchmark workload against a server or an embedded instance
+  version  Print the version
+  help     Print this help
+
+Run aria <command> -h for the flags of a command
+`
+
+// The main function runs the command given as the first argument, the server if there is none
+// aria run with flags and no command is the server with these flags, as the binary was before the commands
 func main() {
+	if len(os.Args) < 2 || strings.HasPrefix(os.Args[1], "-") {
+		serve(os.Args[1:])
+		return
+	}
+
+	args := os.Args[2:]
+
+	switch os.Args[1] {
+	case "server":
+		serve(args)
+	case "shell":
+		shell.Main(args)
+	case "dump":
+		shell.Dump(args)
+	case "backup":
+		backupCommand(args)
+	case "check":
+		checkCommand(args)
+	case "diff":
+		os.Exit(diffCommand(args))
+	case "bench":
+		benchCommand(args)
+	case "version":
+		fmt.Printf("AriaSQL %s\n", shared.VERSION)
+	case "help":
+		fmt.Print(USAGE)
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown command %s\n\n%s", os.Args[1], USAGE)
+		os.Exit(2)
+	}
+}
+
+// backupCommand backs up the data directory into a backup directory with the arguments following aria backup
+// with -restore the latest backup is restored instead, with -verify the backups are verified
+func backupCommand(args []string) {
+	flags := flag.NewFlagSet("backup", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: aria backup [-incremental] [-restore | -verify] [-passphrase passphrase] [-datadir dir] backup-dir")
+		flags.PrintDefaults()
+	}
+
+	var (
+		incremental = flags.Bool("incremental", false, "Only back up pages changed since the previous backup")
+		restore     = flags.Bool("restore", false, "Restore the latest backup into an empty data directory")
+		verify      = flags.Bool("verify", false, "Verify the integrity of the backups without restoring them")
+		passphrase  = flags.String("passphrase", os.Getenv("ARIASQL_BACKUP_PASSPHRASE"), "Passphrase to encrypt a backup with, or to decrypt it when restoring and verifying")
+		dataDir     = flags.String("datadir", shared.GetDefaultDataDir(), "Data directory to back up or restore")
+	)
+
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	switch {
+	case *restore:
+		restoreBackup(flags.Arg(0), *dataDir, *passphrase)
+	case *verify:
+		verifyBackup(flags.Arg(0), *passphrase)
+	default:
+		backupDataDir(*dataDir, flags.Arg(0), *incremental, *passphrase)
+	}
+}
+
+// checkCommand checks the data directory with the arguments following aria check
+func checkCommand(args []string) {
+	flags := flag.NewFlagSet("check", flag.ExitOnError)
+
+	var (
+		repair  = flags.Bool("repair", false, "Repair the inconsistencies found where possible")
+		dataDir = flags.String("datadir", shared.GetDefaultDataDir(), "Data directory to check, the server must not be running")
+	)
+
+	flags.Parse(args)
+
+	checkDataDir(*dataDir, *repair)
+}
+
+// diffCommand compares the tables of a database on two instances with the arguments following aria diff and returns the exit code
+// an instance is a server, host:port, or the data directory of an instance which is not running
+// the exit code is 0 if every table matches, 1 if a table differs and 2 on error
+func diffCommand(args []string) int {
+	flags := flag.NewFlagSet("diff", flag.ExitOnError)
+
+	var (
+		source   = flags.String("source", "", "Source instance, host:port or ariasql:// connection string of a server, or a data directory")
+		target   = flags.String("target", "", "Target instance, host:port or ariasql:// connection string of a server, or a data directory")
+		username = flags.String("username", "admin", "Server user, requires the privilege to SELECT on the tables compared")
+		password = flags.String("password", "admin", "Server user password")
+		database = flags.String("database", "", "Database to compare")
+		tables   = flags.String("tables", "", "Tables to compare separated by commas, table:column compares a table by chunks of the column, every table if empty")
+		chunks   = flags.Int("chunks", diff.DEFAULT_CHUNKS, "Chunks a table compared by a column is checksummed in")
+		jsonOut  = flags.Bool("json", false, "Print the results as JSON")
+	)
+
+	flags.Parse(args)
+
+	if *source == "" || *target == "" {
+		fmt.Println("-source and -target are required")
+		return 2
+	}
+
+	sessions := make([]bench.Session, 0, 2)
+
+	for _, instance := range []string{*source, *target} {
+		var t bench.Target
+
+		if strings.HasPrefix(instance, dsn.SCHEME+"://") {
+			d, err := dsn.Parse(instance)
+			if err != nil {
+				fmt.Println(err)
+				return 2
+			}
+
+			t = &bench.Remote{DSN: d}
+		} else if _, err := os.Stat(instance); err == nil {
+			embedded, err := bench.NewEmbedded(instance)
+			if err != nil {
+				fmt.Println(err)
+				return 2
+			}
+
+			defer embedded.Close()
+			t = embedded
+		} else {
+			t = &bench.Remote{Address: instance, Username: *username, Password: *password}
+		}
+
+		session, err := t.Open()
+		if err != nil {
+			fmt.Println(err)
+			return 2
+		}
+
+		defer session.Close()
+		sessions = append(sessions, session)
+	}
+
+	options := &diff.Options{Database: *database, Chunks: *chunks}
+	if *tables != "" {
+		options.Tables = strings.Split(*tables, ",")
+	}
+
+	results, err := diff.Compare(sessions[0], sessions[1], options)
+	if err != nil {
+		fmt.Println(err)
+		return 2
+	}
+
+	code := 0
+	for _, result := range results {
+		if !result.Match() {
+			code = 1
+		}
+	}
+
+	if *jsonOut {
+		b, err := json.MarshalIndent(results, "", "  ")
+		if err != nil {
+			fmt.Println(err)
+			return 2
+		}
+
+		fmt.Println(string(b))
+	} else {
+		for _, result := range results {
+			fmt.Print(result.String())
+		}
+	}
+
+	return code
+}
+
+// benchCommand runs a benchmark workload with the arguments following aria bench and prints its report
+// with -host or -dsn the workload runs against a server, otherwise against an embedded instance within -datadir
+// the workload creates and drops the ariabench database, point it at a server or data directory used for benchmarking only
+func benchCommand(args []string) {
+	flags := flag.NewFlagSet("bench", flag.ExitOnError)
+
+	var (
+		workload  = flags.String("workload", "tpcb", "Workload to run, tpcb, kv, load or scan")
+		host      = flags.String("host", "", "Server to benchmark, an embedded instance is benchmarked if empty")
+		port      = flags.Int("port", 3695, "Server port")
+		username  = flags.String("username", "admin", "Server user, requires the privileges to create and drop a database")
+		password  = flags.String("password", "admin", "Server user password")
+		conn      = flags.String("dsn", "", "Server to benchmark as an ariasql:// connection string, instead of -host, -port, -username and -password")
+		dataDir   = flags.String("datadir", "", "Data directory of the embedded instance, a temporary directory removed afterwards if empty")
+		clients   = flags.Int("clients", 1, "Concurrent clients")
+		duration  = flags.Duration("duration", 10*time.Second, "How long operations are run for, excluding setup")
+		scale     = flags.Int("scale", 1, "Scale of the data loaded by the workload")
+		batchSize = flags.Int("batch", 100, "Rows inserted per operation by the load workload")
+		readRatio = flags.Float64("reads", 0.9, "Share of reads of the kv workload, 0 to 1")
+		jsonOut   = flags.Bool("json", false, "Print the report as JSON")
+		list      = flags.Bool("list", false, "List the workloads")
+	)
+
+	flags.Parse(args)
+
+	if *list {
+		names := make([]string, 0, len(bench.Workloads))
+		for name := range bench.Workloads {
+			names = append(names, name)
+		}
+
+		sort.Strings(names)
+
+		for _, name := range names {
+			fmt.Printf("%-6s %s\n", name, bench.Workloads[name].Description)
+		}
+
+		return
+	}
+
+	var target bench.Target
+	var name string
+
+	if *conn != "" {
+		d, err := dsn.Parse(*conn)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		name = d.String()
+		target = &bench.Remote{DSN: d}
+	} else if *host != "" {
+		name = fmt.Sprintf("%s:%d", *host, *port)
+		target = &bench.Remote{Address: name, Username: *username, Password: *password}
+	} else {
+		dir := *dataDir
+		if dir == "" {
+			var err error
+			dir, err = os.MkdirTemp("", bench.DATABASE)
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+
+			defer os.RemoveAll(dir)
+		}
+
+		embedded, err := bench.NewEmbedded(dir)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		name = "embedded " + dir
+		target = embedded
+	}
+
+	report, err := bench.Run(target, *workload, &bench.Options{
+		Clients:   *clients,
+		Duration:  *duration,
+		Scale:     *scale,
+		BatchSize: *batchSize,
+		ReadRatio: *readRatio,
+	})
+	target.Close()
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	report.Target = name
+
+	if *jsonOut {
+		b, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		fmt.Println(string(b))
+	} else {
+		fmt.Print(report.String())
+	}
+}
+
+// checkDataDir validates the data directory offline and exits, with a non zero status if problems were left unrepaired
+func checkDataDir(dataDir string, repair bool) {
+	issues, err := catalog.Check(dataDir, repair)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	unrepaired := 0
+
+	for _, issue := range issues {
+		if issue.Repaired {
+			fmt.Printf("REPAIRED %s: %s\n", issue.Path, issue.Problem)
+		} else {
+			fmt.Printf("%s: %s\n", issue.Path, issue.Problem)
+			unrepaired++
+		}
+	}
+
+	fmt.Printf("%d problem(s) found, %d repaired\n", len(issues), len(issues)-unrepaired)
+
+	if unrepaired > 0 {
+		os.Exit(1)
+	}
+
+	os.Exit(0)
+}
+
+// backupDataDir backs up the data directory into a backup directory and exits
+func backupDataDir(dataDir, backupDir string, incremental bool, passphrase string) {
+	manifest, err := catalog.Backup(dataDir, backupDir, incremental, passphrase)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	copied := 0
+	for _, file := range manifest.Files {
+		if file.Incremental {
+			copied += len(file.Pages) * (btree.PAGE_SIZE + btree.HEADER_SIZE)
+		} else {
+			copied += int(file.Size)
+		}
+	}
+
+	if manifest.Incremental {
+		fmt.Printf("Incremental backup %06d written to %s, %d bytes copied\n", manifest.Sequence, backupDir, copied)
+	} else {
+		fmt.Printf("Full backup %06d written to %s, %d bytes copied\n", manifest.Sequence, backupDir, copied)
+	}
+
+	os.Exit(0)
+}
+
+// restoreBackup restores the latest backup of a backup directory into an empty data directory and exits
+func restoreBackup(backupDir, dataDir, passphrase string) {
+	manifest, err := catalog.Restore(backupDir, dataDir, passphrase)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Backup %06d restored to %s\n", manifest.Sequence, dataDir)
+
+	os.Exit(0)
+}
+
+// verifyBackup validates the backups of a backup directory and exits, with a non zero status if problems were found
+func verifyBackup(backupDir, passphrase string) {
+	issues, err := catalog.VerifyBackup(backupDir, passphrase)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	for _, issue := range issues {
+		fmt.Printf("%s: %s\n", issue.Path, issue.Problem)
+	}
+
+	fmt.Printf("%d problem(s) found\n", len(issues))
+
+	if len(issues) > 0 {
+		os.Exit(1)
+	}
+
+	os.Exit(0)
+}
+
+// serve starts the AriaSQL server with the arguments following aria server
+// you can pass the -recover flag to recover the AriaSQL instance from the WAL if it was not shut down properly, crashed, etc
+// you can pass the -check flag to validate the data directory offline, with -repair found problems are repaired where possible
+// you can pass the -upgrade flag to migrate a data directory written by an older version to the current layout
+// you can pass the -backup flag to back up the data directory, with -incremental only pages changed since the previous backup are copied
+// you can pass the -restore flag to restore the latest backup into an empty data directory
+// you can pass the -verify flag to validate the backups within a backup directory without restoring them
+// backups are encrypted with the -passphrase flag or the ARIASQL_BACKUP_PASSPHRASE environment variable
+// you can pass the -safe-mode flag to start with every table validated, tables failing validation are quarantined instead of failing startup
+// you can pass the -pid-file flag to write the pid of the server once it accepts connections, systemd is notified on $NOTIFY_SOCKET
+// you can pass the -http-port flag to serve the HTTP query endpoint on a port, httpport of ariaserver.yaml otherwise
+func serve(args []string) {
+	flags := flag.NewFlagSet("server", flag.ExitOnError)
 
 	var (
-		recov     = flag.Bool("recover", false, "Recover AriaSQL instance from WAL")
-		recovFile = flag.String("wal", "wal.dat", "Recover AriaSQL instance from WAL file")
+		recov       = flags.Bool("recover", false, "Recover AriaSQL instance from WAL")
+		recovFile   = flags.String("wal", "wal.dat", "Recover AriaSQL instance from WAL file")
+		check       = flags.Bool("check", false, "Check the data directory for inconsistencies, the server must not be running")
+		repair      = flags.Bool("repair", false, "Repair inconsistencies found by -check")
+		upgrade     = flags.Bool("upgrade", false, "Upgrade the data directory to the current layout version, the server must not be running")
+		backup      = flags.String("backup", "", "Back up the data directory into this backup directory, the server must not be running")
+		incremental = flags.Bool("incremental", false, "Only back up pages changed since the previous backup with -backup")
+		restore     = flags.String("restore", "", "Restore the latest backup from this backup directory into an empty data directory")
+		verify      = flags.String("verify", "", "Verify the integrity of the backups within this backup directory")
+		passphrase  = flags.String("passphrase", os.Getenv("ARIASQL_BACKUP_PASSPHRASE"), "Passphrase to encrypt a backup with -backup, or to decrypt it with -restore and -verify")
+		dataDir     = flags.String("datadir", shared.GetDefaultDataDir(), "Data directory of the server, its ariaconf.yaml is read, or to check, upgrade, back up or restore")
+		safeMode    = flags.Bool("safe-mode", false, "Validate every table on startup and quarantine corrupt tables and procedures instead of failing")
+		pidFile     = flags.String("pid-file", "", "Write the pid of the server to this file once it accepts connections, removed on shutdown")
+		httpPort    = flags.Int("http-port", 0, "Serve the HTTP query endpoint, POST /query, on this port, in place of httpport of ariaserver.yaml")
 	)
 
-	flag.Parse()
+	flags.Parse(args)
+
+	if *check {
+		checkDataDir(*dataDir, *repair)
+	}
+
+	if *upgrade {
+		from, err := catalog.Upgrade(*dataDir)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		if from == catalog.LAYOUT_VERSION {
+			fmt.Printf("Data directory is already at layout version %d\n", from)
+		} else {
+			fmt.Printf("Data directory upgraded from layout version %d to %d\n", from, catalog.LAYOUT_VERSION)
+		}
+
+		os.Exit(0)
+	}
+
+	if *backup != "" {
+		backupDataDir(*dataDir, *backup, *incremental, *passphrase)
+	}
+
+	if *restore != "" {
+		restoreBackup(*restore, *dataDir, *passphrase)
+	}
+
+	if *verify != "" {
+		verifyBackup(*verify, *passphrase)
+	}
 
 	if *recov {
 		fmt.Println("Recovering AriaSQL instance from WAL...")
@@ -57,7 +523,7 @@ func main() {
 
 			// Will look in default data directory for wal.dat unless specified
 			if *recovFile == "" {
-				w, err = wal.OpenWAL(shared.GetDefaultDataDir()+shared.GetOsPathSeparator()+"wal.dat", os.O_CREATE|os.O_RDWR, 0644)
+				w, err = wal.OpenWAL(filepath.Join(shared.GetDefaultDataDir(), "wal.dat"), os.O_CREATE|os.O_RDWR, 0644)
 				if err != nil {
 					fmt.Println(err)
 					os.Exit(1)
@@ -72,15 +538,53 @@ func main() {
 
 			defer w.Close()
 
-			ex := executor.New(nil, nil)
+			// The data directory is the one of the WAL
+			ex := executor.New(&core.AriaSQL{Config: &core.Config{DataDir: filepath.Dir(w.FilePath)}}, nil)
 			ex.SetRecover(true) // set true to avoid checking permissions
 
-			asts, err := w.RecoverASTs()
+			last, err := checkpoint.Read(filepath.Dir(w.FilePath))
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+
+			// Segments rotated out of the WAL by retention hold the entries before it, oldest first
+			// The entries up to the last checkpoint are within it, they are not replayed
+			segments, err := wal.Segments(w.FilePath)
 			if err != nil {
 				fmt.Println(err)
 				os.Exit(1)
 			}
 
+			segments = checkpoint.Replayed(last, segments)
+
+			asts := make([]interface{}, 0)
+
+			for _, segment := range segments {
+				s, err := wal.OpenWAL(segment.Path, os.O_RDWR, 0644)
+				if err != nil {
+					fmt.Println(err)
+					os.Exit(1)
+				}
+
+				segmentASTs, err := s.RecoverASTs()
+				s.Close()
+				if err != nil {
+					fmt.Println(err)
+					os.Exit(1)
+				}
+
+				asts = append(asts, segmentASTs...)
+			}
+
+			walASTs, err := w.RecoverASTs()
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+
+			asts = append(asts, walASTs...)
+
 			err = ex.Recover(asts)
 			if err != nil {
 				fmt.Println(err)
@@ -95,7 +599,7 @@ func main() {
 		wg.Wait()
 		s.Stop()
 
-		fmt.Sprintf("AriaSQL instance recovered from WAL successfully")
+		fmt.Println("AriaSQL instance recovered from WAL successfully")
 
 		os.Exit(0)
 
@@ -108,42 +612,296 @@ func main() {
 		signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
 
 		// Create a new AriaSQL instance
-		aria, err := core.New(nil)
+		aria, err := core.New(&core.Config{DataDir: *dataDir})
 		if err != nil {
 			fmt.Println(err)
 			os.Exit(1)
 		}
 
+		// Tell a service manager such as systemd when the server is ready, and ping its watchdog if enabled
+		notifier, err := daemon.New(aria, *pidFile)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		if aria.Config.MaxOpenFiles > 0 {
+			storage.SetMaxOpenFiles(aria.Config.MaxOpenFiles)
+		}
+
 		aria.Catalog = catalog.New(aria.Config.DataDir)
+		aria.Catalog.MaxOpenTables = aria.Config.MaxOpenTables
+		aria.Catalog.AutoUpgrade = aria.Config.AutoUpgrade
+		aria.Catalog.FlashbackRetention = time.Duration(aria.Config.FlashbackRetention) * time.Second
+		aria.Catalog.SafeMode = *safeMode
+
+		if aria.Config.Tiering != nil {
+			aria.Catalog.ColdDirectory = aria.Config.Tiering.ColdDir
+		}
+
+		// A new data directory is initialized from the environment, the admin password, a database and init scripts
+		settings, err := bootstrap.FromEnv()
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		aria.Catalog.AdminPassword = settings.RootPassword
 
 		if err := aria.Catalog.Open(); err != nil {
 			fmt.Println(err)
 			os.Exit(1)
 		}
 
+		// The generated password is only ever shown here
+		if aria.Catalog.PasswordGenerated {
+			fmt.Printf("Generated password of the %s user: %s\n", catalog.DEFAULT_ADMIN_USER, aria.Catalog.AdminPassword)
+			fmt.Println("It is shown once, and has to be changed with ALTER USER on first login")
+		} else if !aria.Catalog.Fresh && aria.Catalog.DefaultPasswordInUse() {
+			fmt.Printf("WARNING: the %s user has the default password %s, anyone can log in as %s, change it with ALTER USER %s SET PASSWORD\n", catalog.DEFAULT_ADMIN_USER, catalog.DEFAULT_ADMIN_PASSWORD, catalog.DEFAULT_ADMIN_USER, catalog.DEFAULT_ADMIN_USER)
+		}
+
+		aria.Catalog.AdminPassword = ""
+
+		if *safeMode {
+			quarantined := aria.Catalog.GetQuarantined()
+
+			for _, q := range quarantined {
+				fmt.Printf("QUARANTINED %s %s.%s (%s): %s\n", q.Kind, q.Database, q.Name, q.Path, q.Reason)
+			}
+
+			fmt.Printf("Safe mode: %d object(s) quarantined, see sys.quarantine\n", len(quarantined))
+		}
+
+		// Read the tables marked WARM into the cache while the server starts serving queries
+		go func() {
+			loads := aria.Catalog.WarmTables()
+			if len(loads) == 0 {
+				return
+			}
+
+			var read int64
+			for _, load := range loads {
+				read += load.Bytes
+			}
+
+			fmt.Printf("Warmed %d table(s), %d bytes read into the cache\n", len(loads), read)
+		}()
+
 		aria.Channels = make([]*core.Channel, 0)
 		aria.ChannelsLock = &sync.Mutex{}
 
+		// Join the cluster if configured, the leader replicates its WAL entries to the other nodes
+		var node *cluster.Node
+		if aria.Config.Cluster != nil {
+			node, err = cluster.Open(aria)
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+
+			aria.Replicator = node
+		}
+
+		// Sync changed rows with the hub, or accept edge nodes as a hub, if configured
+		var edgeNode *edge.Node
+		if aria.Config.Edge != nil {
+			edgeNode, err = edge.Open(aria)
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+
+			err = edgeNode.Start()
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+
+			aria.ChangeLog = edgeNode
+		}
+
+		// Route queries to the shards of the shard map if configured as a coordinator
+		if aria.Config.Sharding != nil {
+			aria.Coordinator, err = shard.New(aria)
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+		}
+
+		// Post row changes to the configured webhooks
+		var dispatcher *webhook.Dispatcher
+		if len(aria.Config.Webhooks) > 0 {
+			dispatcher, err = webhook.New(aria)
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+
+			aria.Notifier = dispatcher
+		}
+
+		// Check statements sent by clients against the configured rules
+		if len(aria.Config.Rules) > 0 {
+			aria.Firewall, err = firewall.New(aria)
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+		}
+
+		// Export spans of queries to the configured OTLP collector
+		var provider *tracing.Provider
+		if aria.Config.Tracing != nil {
+			provider, err = tracing.New(aria)
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+		}
+
+		// Turn read-only on a full disk and read-write again once space is freed
+		guard := diskguard.New(aria)
+		guard.Start()
+
+		// Cancel queries before the server runs out of memory if configured
+		var dog *watchdog.Watchdog
+		if aria.Config.Watchdog != nil {
+			dog, err = watchdog.New(aria)
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+
+			dog.Start()
+		}
+
+		// Move tables not accessed for long to the cold tier if configured
+		var mover *tiering.Mover
+		if aria.Config.Tiering != nil {
+			mover, err = tiering.New(aria)
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+
+			mover.Start()
+		}
+
+		// Take checkpoints on CHECKPOINT, and on the configured triggers
+		checkpointer, err := checkpoint.New(aria)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		aria.Checkpointer = checkpointer
+		checkpointer.Start()
+
+		// Rotate and purge the WAL, change log and audit log past their retention if configured
+		var purger *retention.Purger
+		if aria.Config.Retention != nil {
+			purger, err = retention.New(aria)
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+
+			aria.Purger = purger
+			purger.Start()
+		}
+
+		// Before connections are accepted, clients see the data directory initialized
+		err = bootstrap.Run(aria, settings)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
 		server, err := server.NewTCPServer(3695, "0.0.0.0", aria, 1024)
 		if err != nil {
 			fmt.Println(err)
 			os.Exit(1)
 		}
 
+		if *httpPort > 0 {
+			err = server.ListenHTTP(*httpPort)
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+		}
+
+		// The catalog is open and the listener bound, connections are accepted from here on
+		err = notifier.Ready(fmt.Sprintf("%s:%d", server.Host, server.Port))
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
 		go func() {
 			sig := <-sigs
 			switch sig {
 			case syscall.SIGINT:
 				// Handling SIGINT (Ctrl+C) signal
 				fmt.Println("Received SIGINT, shutting down...")
+				notifier.Close()
 				server.Stop()
+				if node != nil {
+					node.Close()
+				}
+				if edgeNode != nil {
+					edgeNode.Close()
+				}
+				if dispatcher != nil {
+					dispatcher.Close()
+				}
+				if provider != nil {
+					provider.Close()
+				}
+				if dog != nil {
+					dog.Close()
+				}
+				if mover != nil {
+					mover.Close()
+				}
+				if purger != nil {
+					purger.Close()
+				}
+				checkpointer.Close()
+				guard.Close()
 				aria.Catalog.Close()
 				aria.WAL.Close()
 				os.Exit(0)
 			case syscall.SIGTERM:
 				// Handling SIGTERM signal
 				fmt.Println("Received SIGTERM, shutting down...")
+				notifier.Close()
 				server.Stop()
+				if node != nil {
+					node.Close()
+				}
+				if edgeNode != nil {
+					edgeNode.Close()
+				}
+				if dispatcher != nil {
+					dispatcher.Close()
+				}
+				if provider != nil {
+					provider.Close()
+				}
+				if dog != nil {
+					dog.Close()
+				}
+				if mover != nil {
+					mover.Close()
+				}
+				if purger != nil {
+					purger.Close()
+				}
+				checkpointer.Close()
+				guard.Close()
 				aria.Catalog.Close()
 				aria.WAL.Close()
 				os.Exit(0)
@@ -0,0 +1,164 @@
+// Package migration
+// AriaSQL schema migration package
+// Copyright (C) AriaSQL
+// Author(s): Alex Gaetano Padula
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+package migration
+
+import (
+	"ariasql/catalog"
+	"ariasql/parser"
+	"ariasql/tracing"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+const DIRECTORY = "migrations" // Directory within the data directory migration files are read from
+
+// Migration is a migration file read and parsed
+type Migration struct {
+	Statements []parser.Statement // Statements of the file, in order
+	Checksum   string             // SHA-256 of the file
+}
+
+// Path returns the path of a migration file within the data directory
+// Files must be relative and cannot leave the migrations directory
+func Path(dataDir, file string) (string, error) {
+	if !filepath.IsLocal(file) {
+		return "", errors.New("migration file must be a relative path within the migrations directory")
+	}
+
+	return filepath.Join(dataDir, DIRECTORY, file), nil
+}
+
+// Read reads a migration file and parses its statements, nothing is applied if a statement does not parse
+func Read(filename string) (*Migration, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	statements, err := parser.Split(data)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(statements) == 0 {
+		return nil, errors.New("migration has no statements")
+	}
+
+	migration := &Migration{Checksum: fmt.Sprintf("%x", sha256.Sum256(data))}
+
+	for i, statement := range statements {
+		ast, err := parser.NewParser(parser.NewLexer(statement)).Parse()
+		if err != nil {
+			return nil, fmt.Errorf("statement %d: %s", i+1, err.Error())
+		}
+
+		migration.Statements = append(migration.Statements, ast)
+	}
+
+	return migration, nil
+}
+
+// Undo returns the statement undoing a statement of a migration, read before the statement is applied
+// A migration runs as a whole, if a statement fails the statements applied before it are undone in reverse order.
+// Statements which cannot be undone, such as DROP TABLE, are not allowed.  No statement is returned for
+// statements which change nothing, or which will fail as what they change does not exist
+func Undo(db *catalog.Database, stmt parser.Statement) (parser.Statement, error) {
+	switch s := stmt.(type) {
+	case *parser.SelectStmt:
+		return nil, nil
+	case *parser.CreateTableStmt:
+		return &parser.DropTableStmt{TableName: s.TableName}, nil
+	case *parser.CreateIndexStmt:
+		return &parser.DropIndexStmt{TableName: s.TableName, IndexName: s.IndexName}, nil
+	case *parser.DropIndexStmt:
+		tbl := db.GetTable(s.TableName.Value)
+		if tbl == nil || tbl.GetIndex(s.IndexName.Value) == nil {
+			return nil, nil
+		}
+
+		idx := tbl.GetIndex(s.IndexName.Value)
+
+		columns := make([]*parser.Identifier, len(idx.Columns))
+		for i, column := range idx.Columns {
+			columns[i] = &parser.Identifier{Value: column}
+		}
+
+		return &parser.CreateIndexStmt{TableName: s.TableName, IndexName: s.IndexName, ColumnNames: columns, Unique: idx.Unique}, nil
+	case *parser.AlterIndexStmt:
+		tbl := db.GetTable(s.TableName.Value)
+		if tbl == nil || tbl.GetIndex(s.IndexName.Value) == nil {
+			return nil, nil
+		}
+
+		if s.NewName != nil {
+			return &parser.AlterIndexStmt{TableName: s.TableName, IndexName: s.NewName, NewName: s.IndexName}, nil
+		}
+
+		visibility := parser.ALTER_INDEX_VISIBLE
+		if tbl.GetIndex(s.IndexName.Value).Invisible {
+			visibility = parser.ALTER_INDEX_INVISIBLE
+		}
+
+		return &parser.AlterIndexStmt{TableName: s.TableName, IndexName: s.IndexName, Visibility: visibility}, nil
+	case *parser.CreateBloomFilterStmt:
+		return &parser.DropBloomFilterStmt{TableName: s.TableName, FilterName: s.FilterName}, nil
+	case *parser.DropBloomFilterStmt:
+		tbl := db.GetTable(s.TableName.Value)
+		if tbl == nil {
+			return nil, nil
+		}
+
+		for _, b := range tbl.GetBloomFilters() {
+			if b.Name == s.FilterName.Value {
+				return &parser.CreateBloomFilterStmt{TableName: s.TableName, FilterName: s.FilterName, ColumnName: &parser.Identifier{Value: b.Column}}, nil
+			}
+		}
+
+		return nil, nil
+	case *parser.CreateProcedureStmt:
+		return &parser.DropProcedureStmt{ProcedureName: s.Procedure.Name}, nil
+	case *parser.DropProcedureStmt:
+		proc, err := db.GetProcedure(s.ProcedureName.Value)
+		if err != nil {
+			return nil, nil
+		}
+
+		return &parser.CreateProcedureStmt{Procedure: proc.Proc.(*parser.Procedure)}, nil
+	case *parser.AlterTableStmt:
+		// A column added is dropped, other changes to a table cannot be undone
+		if s.ColumnDefinition == nil || s.Constraint != nil || s.Validate != nil || s.ShardKey != nil || s.Storage != 0 {
+			break
+		}
+
+		tbl := db.GetTable(s.TableName.Value)
+		if tbl == nil {
+			return nil, nil
+		}
+
+		if _, ok := tbl.TableSchema.ColumnDefinitions[s.ColumnName.Value]; ok {
+			return nil, nil
+		}
+
+		return &parser.AlterTableStmt{TableName: s.TableName, ColumnName: s.ColumnName}, nil
+	}
+
+	return nil, fmt.Errorf("%s cannot be undone and is not allowed in a migration", tracing.Operation(stmt))
+}
@@ -0,0 +1,157 @@
+// Package migration tests
+// Copyright (C) AriaSQL
+// Author(s): Alex Gaetano Padula
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+package migration
+
+import (
+	"ariasql/catalog"
+	"ariasql/parser"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPath(t *testing.T) {
+	path, err := Path("data", "0001_orders.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if path != filepath.Join("data", DIRECTORY, "0001_orders.sql") {
+		t.Fatalf("unexpected path %s", path)
+	}
+
+	for _, file := range []string{"../0001_orders.sql", "/tmp/0001_orders.sql", ""} {
+		_, err = Path("data", file)
+		if err == nil {
+			t.Fatalf("expected error for %s", file)
+		}
+	}
+}
+
+func TestRead(t *testing.T) {
+	defer os.RemoveAll("./test/")
+
+	err := os.MkdirAll("./test", 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = os.WriteFile("./test/0001_orders.sql", []byte("CREATE TABLE orders (order_id INT);\nCREATE INDEX orders_id ON orders (order_id);\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := Read("./test/0001_orders.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(m.Statements) != 2 || len(m.Checksum) != 64 {
+		t.Fatalf("expected 2 statements and a checksum, got %d %s", len(m.Statements), m.Checksum)
+	}
+
+	if _, ok := m.Statements[1].(*parser.CreateIndexStmt); !ok {
+		t.Fatalf("expected *parser.CreateIndexStmt, got %T", m.Statements[1])
+	}
+
+	// Nothing is applied if a statement does not parse
+	err = os.WriteFile("./test/0002_broken.sql", []byte("CREATE TABLE items (item_id INT);\nCREATE orders;\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = Read("./test/0002_broken.sql")
+	if err == nil || err.Error()[:11] != "statement 2" {
+		t.Fatalf("expected statement 2 to fail, got %v", err)
+	}
+}
+
+func TestUndo(t *testing.T) {
+	defer os.RemoveAll("./test/")
+
+	c := catalog.New("./test/")
+	err := c.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer c.Close()
+
+	err = c.CreateDatabase("db1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db := c.GetDatabase("db1")
+
+	err = db.CreateTable("orders", &catalog.TableSchema{
+		ColumnDefinitions: map[string]*catalog.ColumnDefinition{"order_id": {DataType: "INT"}},
+	}, false, false, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = db.GetTable("orders").CreateIndex("orders_id", []string{"order_id"}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parse := func(stmt string) parser.Statement {
+		ast, err := parser.NewParser(parser.NewLexer([]byte(stmt))).Parse()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return ast
+	}
+
+	undo, err := Undo(db, parse("DROP INDEX orders_id ON orders;"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	create, ok := undo.(*parser.CreateIndexStmt)
+	if !ok || create.IndexName.Value != "orders_id" || !create.Unique || create.ColumnNames[0].Value != "order_id" {
+		t.Fatalf("expected the index to be created again, got %+v", undo)
+	}
+
+	undo, err = Undo(db, parse("ALTER TABLE orders ALTER COLUMN total INT;"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	drop, ok := undo.(*parser.AlterTableStmt)
+	if !ok || drop.ColumnName.Value != "total" || drop.ColumnDefinition != nil {
+		t.Fatalf("expected the column to be dropped, got %+v", undo)
+	}
+
+	undo, err = Undo(db, parse("CREATE TABLE items (item_id INT);"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if undo.(*parser.DropTableStmt).TableName.Value != "items" {
+		t.Fatalf("expected the table to be dropped, got %+v", undo)
+	}
+
+	for _, stmt := range []string{"DROP TABLE orders;", "ALTER TABLE orders DROP COLUMN order_id;", "INSERT INTO orders (order_id) VALUES (1);", "USE db1;"} {
+		_, err = Undo(db, parse(stmt))
+		if err == nil {
+			t.Fatalf("expected error for %s", stmt)
+		}
+	}
+}
@@ -19,9 +19,22 @@ package parser
 import (
 	"ariasql/catalog"
 	"ariasql/shared"
+	"encoding/gob"
 	"encoding/json"
 )
 
+// init registers the nodes of search conditions, CHECK constraints are kept in table schemas which are gob encoded
+func init() {
+	for _, node := range []interface{}{
+		&Identifier{}, &Literal{}, &ComparisonPredicate{}, &LogicalCondition{}, &ValueExpression{}, &ColumnSpecification{},
+		&BinaryExpression{}, &UnaryExpr{}, &NotExpr{}, &BetweenPredicate{}, &InPredicate{}, &LikePredicate{}, &IsPredicate{},
+		&UpperFunc{}, &LowerFunc{}, &CastFunc{}, &CoalesceFunc{}, &ReverseFunc{}, &RoundFunc{}, &PositionFunc{}, &LengthFunc{},
+		&TrimFunc{}, &SubstrFunc{}, &ConcatFunc{}, &HashFunc{}, &CaseExpr{}, &WhenClause{}, &ElseClause{},
+	} {
+		gob.Register(node)
+	}
+}
+
 // Node represents an AST node
 type Node interface{}
 
@@ -42,9 +55,13 @@ type Literal struct {
 
 // CreateDatabaseStmt represents a CREATE DATABASE statement
 type CreateDatabaseStmt struct {
-	Name *Identifier
+	Name     *Identifier
+	Defaults Settings // Defaults of the tables created in the database, i.e WITH (compress = true, collation = 'nocase')
 }
 
+// Settings are the settings of a WITH (name = value, ...) clause by lower case name, strings are unquoted
+type Settings map[string]*Literal
+
 // DropDatabaseStmt represents a DROP DATABASE statement
 type DropDatabaseStmt struct {
 	Name *Identifier
@@ -64,6 +81,35 @@ type DropIndexStmt struct {
 	IndexName *Identifier
 }
 
+// AlterIndexStmt represents an ALTER INDEX statement
+type AlterIndexStmt struct {
+	TableName  *Identifier          // Table of the index
+	IndexName  *Identifier          // Index name
+	NewName    *Identifier          // i.e. RENAME TO new_name
+	Visibility AlterIndexVisibility // i.e. VISIBLE or INVISIBLE
+}
+
+type AlterIndexVisibility int
+
+const (
+	_                     AlterIndexVisibility = iota
+	ALTER_INDEX_VISIBLE                        // The optimizer uses the index
+	ALTER_INDEX_INVISIBLE                      // The optimizer ignores the index, it is still maintained
+)
+
+// CreateBloomFilterStmt represents a CREATE BLOOM FILTER statement
+type CreateBloomFilterStmt struct {
+	TableName  *Identifier // Table of the bloom filter
+	FilterName *Identifier // Bloom filter name
+	ColumnName *Identifier // Column filtered on
+}
+
+// DropBloomFilterStmt represents a DROP BLOOM FILTER statement
+type DropBloomFilterStmt struct {
+	TableName  *Identifier // Table of the bloom filter
+	FilterName *Identifier // Bloom filter name
+}
+
 // CreateTableStmt represents a CREATE TABLE statement
 type CreateTableStmt struct {
 	TableName   *Identifier
@@ -71,6 +117,7 @@ type CreateTableStmt struct {
 	Compress    bool
 	Encrypt     bool
 	EncryptKey  *Literal
+	Settings    Settings // Overrides of the table defaults of the database, i.e WITH (compress = false)
 }
 
 // DropTableStmt represents a DROP TABLE statement
@@ -97,6 +144,20 @@ type SelectStmt struct {
 	TableExpression *TableExpression
 	Union           *SelectStmt
 	UnionAll        bool
+	With            *WithClause // i.e WITH name AS (SELECT ...) SELECT ... FROM name, nil without a WITH clause
+}
+
+// WithClause represents the common table expressions a SELECT statement can read from
+type WithClause struct {
+	Recursive              bool // WITH RECURSIVE, a common table expression can read from itself
+	CommonTableExpressions []*CommonTableExpression
+}
+
+// CommonTableExpression represents a named query of a WITH clause
+type CommonTableExpression struct {
+	Name    *Identifier
+	Columns []*Identifier // Names of the columns of the query, in order, empty to keep the names of the query
+	Query   *SelectStmt   // A recursive query is its first SELECT, UNION or UNION ALL, SELECTs reading from Name
 }
 
 // UpdateStmt represents an UPDATE statement
@@ -135,8 +196,33 @@ type FromClause struct {
 
 // Table represents a table in a FROM clause
 type Table struct {
-	Name  *Identifier
-	Alias *Identifier // i.e. AS alias
+	Name    *Identifier
+	Alias   *Identifier    // i.e. AS alias
+	AsOf    *Literal       // i.e. AS OF TIMESTAMP '2024-06-01 12:00:00' or FOR SYSTEM_TIME AS OF '2024-06-01 12:00:00', nil to read the table as it is
+	Between []*Literal     // i.e. FOR SYSTEM_TIME BETWEEN '2024-06-01 00:00:00' AND '2024-06-02 00:00:00', every version of the rows current within the range
+	Pivot   *PivotClause   // i.e. PIVOT (SUM(amount) FOR product IN ('apple', 'pear')), nil if not pivoted
+	Unpivot *UnpivotClause // i.e. UNPIVOT (amount FOR product IN (apple, pear)), nil if not unpivoted
+	Args    []*Literal     // Arguments of a table function i.e. generate_series(1, 10, 2), nil if not a table function
+}
+
+// PivotClause represents a PIVOT of a table, the values of a column become columns aggregating the rows of that value
+type PivotClause struct {
+	Aggregate *AggregateFunc       // Aggregate of every pivoted column
+	For       *ColumnSpecification // Column the values of are pivoted
+	Values    []*PivotValue        // Values which become columns
+}
+
+// PivotValue represents a value of a PIVOT which becomes a column i.e. 'apple' AS apples
+type PivotValue struct {
+	Value *Literal
+	Alias *Identifier // Column name, the value if nil
+}
+
+// UnpivotClause represents an UNPIVOT of a table, the columns listed become a row each
+type UnpivotClause struct {
+	Value   *Identifier   // Column the values of the columns listed are put in
+	For     *Identifier   // Column the names of the columns listed are put in
+	Columns []*Identifier // Columns which become rows
 }
 
 // WhereClause represents a WHERE clause in a SELECT statement
@@ -216,6 +302,7 @@ type LogicalCondition struct {
 // GroupByClause represents a GROUP BY clause in a SELECT statement
 type GroupByClause struct {
 	GroupByExpressions []*ValueExpression
+	GroupingSets       [][]*ValueExpression // Sets of columns GROUPING SETS, ROLLUP and CUBE group by, nil for a plain GROUP BY
 }
 
 // HavingClause represents a HAVING clause in a SELECT statement
@@ -230,8 +317,9 @@ type SelectList struct {
 
 // ValueExpression represents a value expression
 type ValueExpression struct {
-	Value interface{}
-	Alias *Identifier
+	Value     interface{}
+	Alias     *Identifier
+	Collation *Identifier // COLLATE name, compares and orders strings in the collation
 }
 
 // Wildcard represents a wildcard in a select list
@@ -282,6 +370,12 @@ type AggregateFunc struct {
 	Args     []interface{} // ColumnSpec or  BinaryExpr or AggFunc
 }
 
+// GroupingFunc represents a GROUPING function i.e GROUPING(region, product)
+// A bit is set for every argument not grouped by in the grouping set of a row, the first argument being the most significant
+type GroupingFunc struct {
+	Args []*ColumnSpecification
+}
+
 // UnaryExpr represents a unary expression
 type UnaryExpr struct {
 	Op   string
@@ -382,6 +476,17 @@ type DropUserStmt struct {
 	Username *Identifier
 }
 
+// CreateShardStmt represents a CREATE SHARD statement
+type CreateShardStmt struct {
+	ShardName *Identifier // Shard name, not Name so WAL entries are not decoded as a CreateDatabaseStmt
+	Address   *Literal    // Server address of the shard, host:port
+}
+
+// DropShardStmt represents a DROP SHARD statement
+type DropShardStmt struct {
+	ShardName *Identifier // Shard name
+}
+
 type ShowType int
 
 const (
@@ -391,6 +496,14 @@ const (
 	SHOW_USERS
 	SHOW_INDEXES
 	SHOW_GRANTS
+	SHOW_IO
+	SHOW_ENGINE_STATUS
+	SHOW_PROCESSLIST
+	SHOW_MIGRATIONS
+	SHOW_INDEX_ADVICE      // Indexes recommended from the statements executed, see package advisor
+	SHOW_OPTIMIZER_TRACE   // Trace of the plans considered for the statement traced last, set with SET optimizer_trace
+	SHOW_PLAN_CACHE        // Plans cached for the statements of every session, see package plancache
+	SHOW_PLAN_CACHE_STATUS // Lookups of the plan cache since the server started
 )
 
 // ShowStmt represents a SHOW statement
@@ -405,8 +518,29 @@ type AlterTableStmt struct {
 	TableName        *Identifier               // Table name
 	ColumnName       *Identifier               // Column name
 	ColumnDefinition *catalog.ColumnDefinition // Column definition
+	Storage          AlterTableStorageType     // Storage change, rewrites existing rows
+	ShardKey         *Identifier               // Column to shard the table by, SHARD BY
+	Constraint       *ColumnConstraint         // Constraint added to the column, ALTER COLUMN column ADD
+	Validate         *Identifier               // Constraint whose existing rows are validated, VALIDATE CONSTRAINT
+	Warm             *bool                     // Whether the table is read into the cache on startup, WARM ON or WARM OFF
+}
+
+// ColumnConstraint represents a CHECK or foreign key constraint added to a column of an existing table
+type ColumnConstraint struct {
+	Check      interface{}        // Check search condition
+	References *catalog.Reference // Foreign key reference
+	NotValid   bool               // Existing rows are not validated, NOT VALID
 }
 
+type AlterTableStorageType int
+
+const (
+	_                      AlterTableStorageType = iota
+	ALTER_TABLE_COMPRESS                         // Enable compression and compress existing rows
+	ALTER_TABLE_DECOMPRESS                       // Disable compression and decompress existing rows
+	ALTER_TABLE_RECOMPRESS                       // Rewrite existing rows to the current compression setting
+)
+
 type AlterUserSetType int
 
 const (
@@ -512,6 +646,15 @@ type ConcatFunc struct {
 	Args []interface{} // Can be a column name or a string
 }
 
+// RandomFunc represents a RANDOM function, a number from 0 up to 1 which differs on every call
+type RandomFunc struct{}
+
+// HashFunc represents a MD5 or SHA256 function, the hex digest of a string
+type HashFunc struct {
+	FuncName string      // MD5 or SHA256
+	Arg      interface{} // Can be a column name or a string
+}
+
 // CaseExpr represents a CASE expression
 type CaseExpr struct {
 	WhenClauses []*WhenClause
@@ -623,9 +766,11 @@ type ExecStmt struct {
 
 // Procedure represents a procedure
 type Procedure struct {
-	Name       *Identifier    // procedure name
-	Parameters []*Parameter   // procedure parameters
-	Body       *BeginEndBlock // procedure body
+	Name            *Identifier    // procedure name
+	Parameters      []*Parameter   // procedure parameters
+	Body            *BeginEndBlock // procedure body
+	SecurityDefiner bool           // whether the body runs with the privileges of the definer
+	Definer         string         // user who created the procedure
 }
 
 // DropProcedureStmt represents a DROP PROCEDURE statement
@@ -637,3 +782,122 @@ type DropProcedureStmt struct {
 type ExplainStmt struct {
 	Stmt interface{} // Can be SelectStmt, UpdateStmt, DeleteStmt
 }
+
+// ExportStmt represents an EXPORT statement
+// i.e EXPORT TABLE users TO 'users.parquet' ROW GROUP SIZE 10000;
+type ExportStmt struct {
+	TableName    *Identifier // Table to export, nil when exporting a query
+	Query        *SelectStmt // Query to export, EXPORT QUERY SELECT ...
+	File         *Literal    // File to export to, relative to the exports directory
+	RowGroupSize int         // Rows per Parquet row group, 0 for the writer default
+}
+
+// ResetStatisticsStmt represents a RESET STATISTICS statement
+// i.e RESET STATISTICS;
+type ResetStatisticsStmt struct{}
+
+// CheckpointStmt represents a CHECKPOINT statement
+// i.e CHECKPOINT;
+type CheckpointStmt struct{}
+
+// LoadIntoCacheStmt represents a LOAD INTO CACHE statement, the data and index files of tables are read into the cache
+// i.e LOAD INTO CACHE users, orders;
+type LoadIntoCacheStmt struct {
+	TableNames []*Identifier // Tables read
+}
+
+// ChecksumTableStmt represents a CHECKSUM TABLE statement
+// i.e CHECKSUM TABLE users, orders; or CHECKSUM TABLE users BY user_id CHUNKS 16;
+type ChecksumTableStmt struct {
+	TableNames []*Identifier // Tables to checksum
+	By         *Identifier   // Column rows are assigned to chunks by, nil for one checksum per table
+	Chunks     int           // Amount of chunks with By
+}
+
+// CopyStmt represents a COPY statement, rows are streamed between a table or query and the client connection
+// i.e COPY users (user_id, name) TO STDOUT; COPY users FROM STDIN; or COPY (SELECT * FROM users) TO STDOUT;
+type CopyStmt struct {
+	TableName   *Identifier   // Table copied, nil when copying a query
+	ColumnNames []*Identifier // Columns copied, every column of the table if empty
+	Query       *SelectStmt   // Query copied to the client, nil when copying a table
+	From        bool          // Rows are copied from the client, FROM STDIN
+}
+
+// DescribeStmt represents a DESCRIBE statement, the metadata of tables
+// i.e DESCRIBE users, orders; or DESCRIBE; for every table of the database
+type DescribeStmt struct {
+	TableNames []*Identifier // Tables described, every table of the database if empty
+}
+
+// SetSessionStmt represents a SET statement changing a setting of the session
+// i.e SET trace = 'plan,io'; or SET SESSION trace TO 'off';
+type SetSessionStmt struct {
+	Name  *Identifier // Setting name
+	Value *Literal    // Setting value
+}
+
+// SetTransactionStmt represents a SET TRANSACTION statement setting the isolation level of transactions
+// i.e SET TRANSACTION ISOLATION LEVEL SERIALIZABLE;
+type SetTransactionStmt struct {
+	Isolation string // READ COMMITTED, REPEATABLE READ or SERIALIZABLE
+}
+
+// MoveTableStmt represents a MOVE TABLE statement, the files of a table are moved to a tier
+// i.e MOVE TABLE orders TO TIER COLD;
+type MoveTableStmt struct {
+	TableName *Identifier // Table moved
+	Tier      string      // HOT or COLD
+}
+
+// ApplyMigrationStmt represents an APPLY MIGRATION statement, the statements of a file are applied to the database and recorded
+// i.e APPLY MIGRATION 'add_orders' FROM '0002_add_orders.sql';
+type ApplyMigrationStmt struct {
+	Name *Literal // Migration name
+	File *Literal // Migration file, relative to the migrations directory
+}
+
+// ListenStmt represents a LISTEN statement
+// i.e LISTEN jobs;
+type ListenStmt struct {
+	Channel *Identifier // Notification channel
+}
+
+// UnlistenStmt represents an UNLISTEN statement
+// i.e UNLISTEN jobs; or UNLISTEN *;
+type UnlistenStmt struct {
+	Channel *Identifier // Notification channel, * for every channel
+}
+
+// NotifyStmt represents a NOTIFY statement
+// i.e NOTIFY jobs, 'payload';
+type NotifyStmt struct {
+	Channel *Identifier // Notification channel
+	Payload *Literal    // Optional payload
+}
+
+// Placeholder is a parameter of a prepared statement, the value of a literal until EXECUTE binds it
+// i.e $1
+type Placeholder struct {
+	Position int // Position of the value bound within a set of values of EXECUTE, from 1
+}
+
+// PrepareStmt represents a PREPARE statement, a statement with parameters executed by name
+// i.e PREPARE add_user AS INSERT INTO users (user_id, name) VALUES ($1, $2);
+type PrepareStmt struct {
+	Name       *Identifier // Prepared statement name
+	Stmt       Statement   // INSERT, UPDATE or DELETE statement prepared
+	Parameters int         // Values a set of values of EXECUTE binds, the highest position of the parameters
+}
+
+// ExecutePreparedStmt represents an EXECUTE statement, a prepared statement executed for every set of values bound to its parameters
+// i.e EXECUTE add_user USING (1, 'alex'), (2, 'sam');
+type ExecutePreparedStmt struct {
+	Name   *Identifier  // Prepared statement name
+	Values [][]*Literal // Sets of values, bound to the parameters by position
+}
+
+// DeallocatePrepareStmt represents a DEALLOCATE PREPARE statement
+// i.e DEALLOCATE PREPARE add_user;
+type DeallocatePrepareStmt struct {
+	Name *Identifier // Prepared statement name
+}
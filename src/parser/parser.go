@@ -21,10 +21,13 @@ package parser
 import (
 	"ariasql/catalog"
 	"ariasql/shared"
+	"bytes"
 	"errors"
 	"fmt"
+	"slices"
 	"strconv"
 	"strings"
+	"unicode/utf8"
 )
 
 var (
@@ -48,10 +51,22 @@ var (
 		"UPPER", "LOWER", "CAST", "COALESCE", "REVERSE", "ROUND", "POSITION", "LENGTH", "REPLACE",
 		"CONCAT", "SUBSTRING", "TRIM", "GENERATE_UUID", "SYS_DATE", "SYS_TIME", "SYS_TIMESTAMP", "SYS_DATETIME",
 		"CASE", "WHEN", "THEN", "ELSE", "END", "IF", "ELSEIF", "DEALLOCATE", "NEXT", "WHILE", "PRINT", "EXPLAIN",
-		"COMPRESS", "ENCRYPT", "COLUMN",
+		"COMPRESS", "ENCRYPT", "COLUMN", "DECOMPRESS", "RECOMPRESS", "SHARD", "EXPORT",
+		"LISTEN", "UNLISTEN", "NOTIFY", "RESET", "STATISTICS", "RENAME", "RECURSIVE",
+		"ROLLUP", "CUBE", "GROUPING", "SETS", "PIVOT", "UNPIVOT", "RANDOM", "UUID_V7", "MD5", "SHA256",
+		"COLLATE", "CHECKSUM", "COPY", "APPLY", "DESCRIBE", "MOVE", "PREPARE", "EXECUTE", "CHECKPOINT",
+		"LOAD",
 	}, shared.DataTypes...)
 )
 
+// Keywords returns the keywords and data types of the language, sorted and without duplicates
+func Keywords() []string {
+	sorted := slices.Clone(keywords)
+	slices.Sort(sorted)
+
+	return slices.Compact(sorted)
+}
+
 type TokenType int // Token type
 
 const (
@@ -85,6 +100,7 @@ type Lexer struct {
 	input  []byte  // Input to be tokenized
 	pos    int     // Position in the input
 	tokens []Token // Tokens found
+	err    error   // Error tokenizing, tokenizing stops at the error
 }
 
 // Token is a token found by the lexer
@@ -141,7 +157,7 @@ func (l *Lexer) nextToken() Token {
 					l.pos += 2
 					comment := ""
 					for l.pos < len(l.input) && l.input[l.pos] != '\n' {
-						comment += string(l.input[l.pos])
+						comment += string(l.input[l.pos : l.pos+1])
 						l.pos++
 					}
 
@@ -151,7 +167,7 @@ func (l *Lexer) nextToken() Token {
 				return Token{tokenT: MINUS_TOK, value: "-"}
 
 			} else {
-				stringLiteral += string(l.input[l.pos])
+				stringLiteral += string(l.input[l.pos : l.pos+1])
 				l.pos++
 				continue
 			}
@@ -160,7 +176,7 @@ func (l *Lexer) nextToken() Token {
 				l.pos++
 				continue
 			}
-			stringLiteral += string(l.input[l.pos])
+			stringLiteral += string(l.input[l.pos : l.pos+1])
 			l.pos++
 			continue
 		case '\\': // Escape character
@@ -171,6 +187,17 @@ func (l *Lexer) nextToken() Token {
 					l.pos += 2
 					continue
 				}
+
+				// An escaped backslash is a backslash
+				if l.pos+1 < len(l.input) && l.input[l.pos+1] == '\\' {
+					stringLiteral += "\\"
+					l.pos += 2
+					continue
+				}
+
+				// Any other escape is malformed, a literal must not be read differently than it was written
+				l.err = fmt.Errorf("invalid escape sequence in string literal at position %d", l.pos)
+				return Token{tokenT: EOF_TOK}
 			}
 			l.pos++
 			continue
@@ -179,12 +206,12 @@ func (l *Lexer) nextToken() Token {
 				if l.input[l.pos] == quoteChar {
 					// End of string literal
 					insideLiteral = false
-					stringLiteral += string(l.input[l.pos])
+					stringLiteral += string(l.input[l.pos : l.pos+1])
 					l.pos++
 					return Token{tokenT: LITERAL_TOK, value: stringLiteral}
 				} else {
 					// Quote character inside string literal
-					stringLiteral += string(l.input[l.pos])
+					stringLiteral += string(l.input[l.pos : l.pos+1])
 					l.pos++
 					continue
 				}
@@ -192,7 +219,7 @@ func (l *Lexer) nextToken() Token {
 				// Start of string literal
 				insideLiteral = true
 				quoteChar = l.input[l.pos]
-				stringLiteral += string(l.input[l.pos])
+				stringLiteral += string(l.input[l.pos : l.pos+1])
 				l.pos++
 				continue
 			}
@@ -201,7 +228,7 @@ func (l *Lexer) nextToken() Token {
 				l.pos++
 				return Token{tokenT: COMPARISON_TOK, value: "="}
 			} else {
-				stringLiteral += string(l.input[l.pos])
+				stringLiteral += string(l.input[l.pos : l.pos+1])
 				l.pos++
 				continue
 			}
@@ -210,7 +237,7 @@ func (l *Lexer) nextToken() Token {
 				l.pos++
 				return Token{tokenT: PLUS_TOK, value: "+"}
 			} else {
-				stringLiteral += string(l.input[l.pos])
+				stringLiteral += string(l.input[l.pos : l.pos+1])
 				l.pos++
 				continue
 			}
@@ -220,7 +247,7 @@ func (l *Lexer) nextToken() Token {
 					l.pos += 2
 					comment := ""
 					for l.input[l.pos] != '*' && l.input[l.pos+1] != '/' {
-						comment += string(l.input[l.pos])
+						comment += string(l.input[l.pos : l.pos+1])
 						l.pos++
 					}
 					l.pos += 2
@@ -229,7 +256,7 @@ func (l *Lexer) nextToken() Token {
 				l.pos++
 				return Token{tokenT: DIVIDE_TOK, value: "/"}
 			} else {
-				stringLiteral += string(l.input[l.pos])
+				stringLiteral += string(l.input[l.pos : l.pos+1])
 				l.pos++
 				continue
 			}
@@ -238,7 +265,7 @@ func (l *Lexer) nextToken() Token {
 				l.pos++
 				return Token{tokenT: MODULUS_TOK, value: "%"}
 			} else {
-				stringLiteral += string(l.input[l.pos])
+				stringLiteral += string(l.input[l.pos : l.pos+1])
 				l.pos++
 				continue
 			}
@@ -247,7 +274,7 @@ func (l *Lexer) nextToken() Token {
 				l.pos++
 				return Token{tokenT: AT_TOK, value: "@"}
 			} else {
-				stringLiteral += string(l.input[l.pos])
+				stringLiteral += string(l.input[l.pos : l.pos+1])
 				l.pos++
 				continue
 			}
@@ -264,7 +291,7 @@ func (l *Lexer) nextToken() Token {
 				l.pos++
 				return Token{tokenT: COMPARISON_TOK, value: "<"}
 			} else {
-				stringLiteral += string(l.input[l.pos])
+				stringLiteral += string(l.input[l.pos : l.pos+1])
 				l.pos++
 				continue
 			}
@@ -278,7 +305,7 @@ func (l *Lexer) nextToken() Token {
 				l.pos++
 				return Token{tokenT: COMPARISON_TOK, value: ">"}
 			} else {
-				stringLiteral += string(l.input[l.pos])
+				stringLiteral += string(l.input[l.pos : l.pos+1])
 				l.pos++
 				continue
 			}
@@ -287,7 +314,7 @@ func (l *Lexer) nextToken() Token {
 				l.pos++
 				return Token{tokenT: ASTERISK_TOK, value: "*"}
 			} else {
-				stringLiteral += string(l.input[l.pos])
+				stringLiteral += string(l.input[l.pos : l.pos+1])
 				l.pos++
 				continue
 			}
@@ -296,7 +323,7 @@ func (l *Lexer) nextToken() Token {
 				l.pos++
 				return Token{tokenT: COMMA_TOK, value: ","}
 			} else {
-				stringLiteral += string(l.input[l.pos])
+				stringLiteral += string(l.input[l.pos : l.pos+1])
 				l.pos++
 				continue
 			}
@@ -305,7 +332,7 @@ func (l *Lexer) nextToken() Token {
 				l.pos++
 				return Token{tokenT: LPAREN_TOK, value: "("}
 			} else {
-				stringLiteral += string(l.input[l.pos])
+				stringLiteral += string(l.input[l.pos : l.pos+1])
 				l.pos++
 				continue
 			}
@@ -314,30 +341,44 @@ func (l *Lexer) nextToken() Token {
 				l.pos++
 				return Token{tokenT: RPAREN_TOK, value: ")"}
 			} else {
-				stringLiteral += string(l.input[l.pos])
+				stringLiteral += string(l.input[l.pos : l.pos+1])
 				l.pos++
 				continue
 			}
 		case '!':
 			if insideLiteral {
-				stringLiteral += string(l.input[l.pos])
+				stringLiteral += string(l.input[l.pos : l.pos+1])
 				l.pos++
 				continue
 			}
 			continue
 		case '$':
 			if insideLiteral {
-				stringLiteral += string(l.input[l.pos])
+				stringLiteral += string(l.input[l.pos : l.pos+1])
 				l.pos++
 				continue
 			}
+
+			// $1 is a parameter of a prepared statement, bound by EXECUTE
+			end := l.pos + 1
+			for end < len(l.input) && isDigit(rune(l.input[end])) {
+				end++
+			}
+
+			position, err := strconv.Atoi(string(l.input[l.pos+1 : end]))
+			if err == nil && position > 0 {
+				l.pos = end
+				return Token{tokenT: LITERAL_TOK, value: &Placeholder{Position: position}}
+			}
+
+			l.pos++
 			continue
 		case ';':
 			if !insideLiteral {
 				l.pos++
 				return Token{tokenT: SEMICOLON_TOK, value: ";"}
 			} else {
-				stringLiteral += string(l.input[l.pos])
+				stringLiteral += string(l.input[l.pos : l.pos+1])
 				l.pos++
 				continue
 			}
@@ -401,7 +442,7 @@ func (l *Lexer) nextToken() Token {
 						}
 					}
 				} else {
-					stringLiteral += string(l.input[l.pos])
+					stringLiteral += string(l.input[l.pos : l.pos+1])
 					l.pos++
 					continue
 				}
@@ -413,7 +454,7 @@ func (l *Lexer) nextToken() Token {
 
 						for isDigit(rune(l.input[l.pos])) || l.input[l.pos] == '.' {
 
-							n += string(l.input[l.pos])
+							n += string(l.input[l.pos : l.pos+1])
 							l.pos++
 						}
 						parsedUInt, err := strconv.ParseUint(n, 10, 32) // convert string to uint
@@ -431,10 +472,14 @@ func (l *Lexer) nextToken() Token {
 					}
 
 				} else {
-					stringLiteral += string(l.input[l.pos])
+					stringLiteral += string(l.input[l.pos : l.pos+1])
 					l.pos++
 					continue
 				}
+			} else if insideLiteral {
+				stringLiteral += string(l.input[l.pos : l.pos+1])
+				l.pos++
+				continue
 			}
 
 			l.pos++
@@ -442,6 +487,19 @@ func (l *Lexer) nextToken() Token {
 	}
 }
 
+// parameters returns the highest position of the parameters of the tokens, 0 if there are none
+func (l *Lexer) parameters() int {
+	n := 0
+
+	for _, tok := range l.tokens {
+		if placeholder, ok := tok.value.(*Placeholder); ok {
+			n = max(n, placeholder.Position)
+		}
+	}
+
+	return n
+}
+
 // Tokenize tokenizes the input
 func (l *Lexer) tokenize() {
 	for {
@@ -506,9 +564,107 @@ func (l *Lexer) stripComments() {
 
 }
 
+// Normalize returns a query with its literals replaced by ?, lists of literals collapsed to (...) and comments stripped
+// Queries differing only in their literals, spacing or case of keywords normalize the same
+func Normalize(query []byte) string {
+	lexer := NewLexer(query)
+	lexer.tokenize()
+	lexer.stripComments()
+
+	normalized := make([]Token, 0, len(lexer.tokens))
+
+	for _, tok := range lexer.tokens {
+		switch tok.tokenT {
+		case LITERAL_TOK:
+			// A minus not following an operand is the sign of the literal
+			if n := len(normalized); n > 0 && normalized[n-1].tokenT == MINUS_TOK && (n == 1 || !isOperand(normalized[n-2])) {
+				normalized = normalized[:n-1]
+			}
+
+			normalized = append(normalized, Token{tokenT: LITERAL_TOK, value: "?"})
+		case KEYWORD_TOK, DATATYPE_TOK:
+			normalized = append(normalized, Token{tokenT: tok.tokenT, value: strings.ToUpper(fmt.Sprint(tok.value))})
+		case RPAREN_TOK:
+			normalized = append(normalized, tok)
+			normalized = collapseList(normalized)
+		default:
+			normalized = append(normalized, Token{tokenT: tok.tokenT, value: fmt.Sprint(tok.value)})
+		}
+	}
+
+	for len(normalized) > 0 && normalized[len(normalized)-1].tokenT == SEMICOLON_TOK {
+		normalized = normalized[:len(normalized)-1]
+	}
+
+	sb := strings.Builder{}
+	for i, tok := range normalized {
+		if i > 0 {
+			prev := normalized[i-1].tokenT
+			switch {
+			case tok.tokenT == COMMA_TOK, tok.tokenT == RPAREN_TOK, tok.tokenT == SEMICOLON_TOK:
+			case prev == LPAREN_TOK, prev == AT_TOK:
+			default:
+				sb.WriteString(" ")
+			}
+		}
+
+		sb.WriteString(tok.value.(string))
+	}
+
+	return sb.String()
+}
+
+// isOperand returns true if a normalized token ends an operand, a minus following it is a subtraction
+func isOperand(tok Token) bool {
+	return tok.tokenT == IDENT_TOK || tok.tokenT == LITERAL_TOK || tok.tokenT == RPAREN_TOK
+}
+
+// collapseList collapses a list of literals ending the normalized tokens to (...), as are consecutive lists so rows of VALUES do not matter
+func collapseList(normalized []Token) []Token {
+	n := len(normalized)
+
+	// Walk back over ? , ? ... to the opening parenthesis
+	i := n - 2
+	for i >= 0 && normalized[i].tokenT == LITERAL_TOK && normalized[i].value == "?" {
+		if i > 0 && normalized[i-1].tokenT == COMMA_TOK {
+			i -= 2
+			continue
+		}
+
+		i--
+		break
+	}
+
+	if i < 0 || i == n-2 || normalized[i].tokenT != LPAREN_TOK {
+		return normalized
+	}
+
+	normalized = append(normalized[:i], Token{tokenT: LITERAL_TOK, value: "(...)"})
+
+	// (...), (...) is (...)
+	if i >= 2 && normalized[i-1].tokenT == COMMA_TOK && normalized[i-2].value == "(...)" {
+		normalized = normalized[:i-1]
+	}
+
+	return normalized
+}
+
 // Parse parses the input
 func (p *Parser) Parse() (Node, error) {
-	p.lexer.tokenize()      // Tokenize the input
+	// Statements are UTF-8, string literals are kept as they were sent
+	if !utf8.Valid(p.lexer.input) {
+		return nil, errors.New("statement is not valid UTF-8")
+	}
+
+	if bytes.IndexByte(p.lexer.input, 0) != -1 {
+		return nil, errors.New("statement contains a NUL byte")
+	}
+
+	p.lexer.tokenize() // Tokenize the input
+	if p.lexer.err != nil {
+		return nil, p.lexer.err
+	}
+
 	p.lexer.stripComments() // Strip comments
 
 	// Check if statement is empty
@@ -525,6 +681,11 @@ func (p *Parser) Parse() (Node, error) {
 		return nil, errors.New("expected ';'")
 	}
 
+	// Parameters are bound by EXECUTE, only a prepared statement has them
+	if p.peek(0).value != "PREPARE" && p.lexer.parameters() > 0 {
+		return nil, errors.New("parameters are only allowed within PREPARE")
+	}
+
 	// Check if statement starts with a keyword
 	if p.peek(0).tokenT == KEYWORD_TOK {
 		switch p.peek(0).value {
@@ -538,6 +699,8 @@ func (p *Parser) Parse() (Node, error) {
 			return p.parseInsertStmt()
 		case "SELECT":
 			return p.parseSelectStmt()
+		case "WITH":
+			return p.parseWithStmt()
 		case "UPDATE":
 			return p.parseUpdateStmt()
 		case "DELETE":
@@ -574,6 +737,38 @@ func (p *Parser) Parse() (Node, error) {
 			return p.parseExecStmt()
 		case "EXPLAIN":
 			return p.parseExplainStmt()
+		case "EXPORT":
+			return p.parseExportStmt()
+		case "LISTEN":
+			return p.parseListenStmt()
+		case "UNLISTEN":
+			return p.parseUnlistenStmt()
+		case "NOTIFY":
+			return p.parseNotifyStmt()
+		case "RESET":
+			return p.parseResetStmt()
+		case "CHECKSUM":
+			return p.parseChecksumStmt()
+		case "COPY":
+			return p.parseCopyStmt()
+		case "APPLY":
+			return p.parseApplyMigrationStmt()
+		case "DESCRIBE":
+			return p.parseDescribeStmt()
+		case "SET":
+			return p.parseSetSessionStmt()
+		case "MOVE":
+			return p.parseMoveTableStmt()
+		case "PREPARE":
+			return p.parsePrepareStmt()
+		case "EXECUTE":
+			return p.parseExecutePreparedStmt()
+		case "CHECKPOINT":
+			p.consume() // Consume CHECKPOINT
+
+			return &CheckpointStmt{}, nil
+		case "LOAD":
+			return p.parseLoadIntoCacheStmt()
 
 		}
 	}
@@ -582,6 +777,130 @@ func (p *Parser) Parse() (Node, error) {
 
 }
 
+// parsePrepareStmt parses a PREPARE statement
+// i.e PREPARE add_user AS INSERT INTO users (user_id, name) VALUES ($1, $2);
+func (p *Parser) parsePrepareStmt() (Node, error) {
+	p.consume() // Consume PREPARE
+
+	if p.peek(0).tokenT != IDENT_TOK {
+		return nil, errors.New("expected identifier")
+	}
+
+	prepareStmt := &PrepareStmt{Name: &Identifier{Value: p.peek(0).value.(string)}, Parameters: p.lexer.parameters()}
+
+	p.consume() // Consume name
+
+	if p.peek(0).tokenT != KEYWORD_TOK || p.peek(0).value != "AS" {
+		return nil, errors.New("expected AS")
+	}
+
+	p.consume() // Consume AS
+
+	var err error
+
+	switch p.peek(0).value {
+	case "INSERT":
+		prepareStmt.Stmt, err = p.parseInsertStmt()
+	case "UPDATE":
+		prepareStmt.Stmt, err = p.parseUpdateStmt()
+	case "DELETE":
+		prepareStmt.Stmt, err = p.parseDeleteStmt()
+	default:
+		return nil, errors.New("expected INSERT, UPDATE or DELETE")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return prepareStmt, nil
+}
+
+// parseExecutePreparedStmt parses an EXECUTE statement, a set of values per execution of the prepared statement
+// i.e EXECUTE add_user USING (1, 'alex'), (2, 'sam');
+func (p *Parser) parseExecutePreparedStmt() (Node, error) {
+	p.consume() // Consume EXECUTE
+
+	if p.peek(0).tokenT != IDENT_TOK {
+		return nil, errors.New("expected identifier")
+	}
+
+	executeStmt := &ExecutePreparedStmt{Name: &Identifier{Value: p.peek(0).value.(string)}}
+
+	p.consume() // Consume name
+
+	// A prepared statement without parameters is executed once
+	if p.peek(0).tokenT == SEMICOLON_TOK {
+		executeStmt.Values = [][]*Literal{{}}
+		return executeStmt, nil
+	}
+
+	if p.peek(0).tokenT != IDENT_TOK || strings.ToUpper(p.peek(0).value.(string)) != "USING" {
+		return nil, errors.New("expected USING")
+	}
+
+	p.consume() // Consume USING
+
+	for {
+		if p.peek(0).tokenT != LPAREN_TOK {
+			return nil, errors.New("expected (")
+		}
+
+		p.consume() // Consume (
+
+		values := make([]*Literal, 0)
+
+		for p.peek(0).tokenT != RPAREN_TOK {
+			negative := false
+			if p.peek(0).tokenT == MINUS_TOK {
+				negative = true
+				p.consume() // Consume -
+			}
+
+			switch {
+			case p.peek(0).tokenT == KEYWORD_TOK && p.peek(0).value == "NULL" && !negative:
+				values = append(values, &Literal{Value: nil})
+			case p.peek(0).tokenT == LITERAL_TOK && negative:
+				switch v := p.peek(0).value.(type) {
+				case uint64:
+					values = append(values, &Literal{Value: -int(v)})
+				case float64:
+					values = append(values, &Literal{Value: -v})
+				default:
+					return nil, errors.New("expected number")
+				}
+			case p.peek(0).tokenT == LITERAL_TOK:
+				values = append(values, &Literal{Value: p.peek(0).value})
+			default:
+				return nil, errors.New("expected literal or NULL")
+			}
+
+			p.consume() // Consume literal
+
+			if p.peek(0).tokenT == COMMA_TOK {
+				p.consume() // Consume ,
+			} else if p.peek(0).tokenT != RPAREN_TOK {
+				return nil, errors.New("expected ,")
+			}
+		}
+
+		p.consume() // Consume )
+
+		executeStmt.Values = append(executeStmt.Values, values)
+
+		if p.peek(0).tokenT != COMMA_TOK {
+			break
+		}
+
+		p.consume() // Consume ,
+	}
+
+	if p.peek(0).tokenT != SEMICOLON_TOK {
+		return nil, errors.New("expected ';'")
+	}
+
+	return executeStmt, nil
+}
+
 // parseExplainStmt parses an EXPLAIN statement
 func (p *Parser) parseExplainStmt() (Node, error) {
 	p.consume() // Consume EXPLAIN
@@ -631,1359 +950,3083 @@ func (p *Parser) parseExplainStmt() (Node, error) {
 
 }
 
-// parsePrintStmt parses a PRINT statement
-func (p *Parser) parsePrintStmt() (Node, error) {
-	p.consume() // Consume PRINT
+// parseResetStmt parses a RESET STATISTICS statement
+func (p *Parser) parseResetStmt() (Node, error) {
+	p.consume() // Consume RESET
 
-	// PRINT (literal | @variable)
-	// i.e. PRINT 'Hello, World!'
-	// i.e. PRINT @variable
+	if p.peek(0).tokenT != KEYWORD_TOK || p.peek(0).value != "STATISTICS" {
+		return nil, errors.New("expected STATISTICS")
+	}
 
-	// You can print a literal or a @variable
-	if p.peek(0).tokenT == AT_TOK {
-		variableName := ""
-		if p.peek(1).tokenT != IDENT_TOK {
-			return nil, errors.New("expected identifier")
-		}
+	p.consume() // Consume STATISTICS
 
-		variableName = p.peek(0).value.(string) + p.peek(1).value.(string)
-		p.consume()
-		p.consume()
+	return &ResetStatisticsStmt{}, nil
+}
 
-		return &PrintStmt{
-			Expr: &Identifier{Value: variableName},
-		}, nil
-	} else {
-		// check for literal
-		if p.peek(0).tokenT != LITERAL_TOK {
-			return nil, errors.New("expected literal")
-		}
+// parseChecksumStmt parses a CHECKSUM TABLE statement
+func (p *Parser) parseChecksumStmt() (Node, error) {
+	// CHECKSUM TABLE table_name [, table_name ...]
+	// CHECKSUM TABLE table_name BY column_name CHUNKS n
+	checksumStmt := &ChecksumTableStmt{}
 
-		return &PrintStmt{
-			Expr: &Literal{Value: p.peek(0).value},
-		}, nil
+	p.consume() // Consume CHECKSUM
+
+	if p.peek(0).value != "TABLE" {
+		return nil, errors.New("expected TABLE")
 	}
 
-}
+	p.consume() // Consume TABLE
 
-// parseWhileStmt parses a WHILE statement
-func (p *Parser) parseWhileStmt() (Node, error) {
-	// Look for
-	// WHILE @@FETCH_STATUS = 0
-	// BEGIN
+	for {
+		tableName, err := p.parseIdentifier()
+		if err != nil {
+			return nil, err
+		}
 
-	p.consume() // Consume WHILE
+		checksumStmt.TableNames = append(checksumStmt.TableNames, tableName)
 
-	if p.peek(0).tokenT != AT_TOK {
-		return nil, errors.New("expected @")
-	}
+		if p.peek(0).tokenT != COMMA_TOK {
+			break
+		}
 
-	p.consume() // Consume @
+		p.consume() // Consume ,
+	}
 
-	if p.peek(0).tokenT != AT_TOK {
-		return nil, errors.New("expected @")
+	if p.peek(0).value != "BY" {
+		return checksumStmt, nil
 	}
 
-	p.consume() // Consume @
+	if len(checksumStmt.TableNames) > 1 {
+		return nil, errors.New("expected a single table to checksum by chunks")
+	}
 
-	// Should be FETCH_STATUS
-	if p.peek(0).tokenT != IDENT_TOK || p.peek(0).value != "FETCH_STATUS" {
-		return nil, errors.New("expected FETCH_STATUS")
+	p.consume() // Consume BY
 
+	column, err := p.parseIdentifier()
+	if err != nil {
+		return nil, err
 	}
 
-	p.consume() // Consume FETCH_STATUS
+	checksumStmt.By = column
 
-	// Next tok should be =
-	if p.peek(0).tokenT != COMPARISON_TOK || p.peek(0).value != "=" {
-		return nil, errors.New("expected =")
+	if p.peek(0).tokenT != IDENT_TOK || strings.ToUpper(p.peek(0).value.(string)) != "CHUNKS" {
+		return nil, errors.New("expected CHUNKS")
 	}
 
-	p.consume() // Consume =
+	p.consume() // Consume CHUNKS
 
-	// Next tok should be 0
-	if p.peek(0).tokenT != LITERAL_TOK || p.peek(0).value != uint64(0) {
-		return nil, errors.New("expected 0") // While @@FETCH_STATUS = 0 means while there are rows to fetch
-		// There is no benefit in using -1, or -2, or any other number
+	chunks, ok := p.peek(0).value.(uint64)
+	if p.peek(0).tokenT != LITERAL_TOK || !ok || chunks == 0 {
+		return nil, errors.New("expected amount of chunks greater than 0")
 	}
 
-	fetchStatus := p.peek(0).value.(uint64)
+	checksumStmt.Chunks = int(chunks)
+	p.consume() // Consume chunks
 
-	p.consume() // Consume 0
+	return checksumStmt, nil
+}
 
-	// Next tok should be BEGIN
+// parseListenStmt parses a LISTEN statement
+func (p *Parser) parseListenStmt() (Node, error) {
+	p.consume() // Consume LISTEN
 
-	if p.peek(0).tokenT != KEYWORD_TOK || p.peek(0).value != "BEGIN" {
-		return nil, errors.New("expected BEGIN")
+	if p.peek(0).tokenT != IDENT_TOK {
+		return nil, errors.New("expected identifier")
 	}
 
-	p.consume() // Consume BEGIN
+	name := p.peek(0).value.(string)
+	p.consume() // Consume channel
 
-	// Parse statements inside the while loop
-	stmts, err := p.parseCursorStmts()
-	if err != nil {
-		return nil, err
+	return &ListenStmt{
+		Channel: &Identifier{Value: name},
+	}, nil
+}
+
+// parseUnlistenStmt parses an UNLISTEN statement
+func (p *Parser) parseUnlistenStmt() (Node, error) {
+	p.consume() // Consume UNLISTEN
+
+	if p.peek(0).tokenT == ASTERISK_TOK {
+		p.consume() // Consume *
+
+		return &UnlistenStmt{
+			Channel: &Identifier{Value: "*"},
+		}, nil
 	}
 
-	// Look for END
-	if p.peek(0).tokenT != KEYWORD_TOK || p.peek(0).value != "END" {
-		return nil, errors.New("expected END")
+	if p.peek(0).tokenT != IDENT_TOK {
+		return nil, errors.New("expected identifier or *")
 	}
 
-	p.consume() // Consume END
+	name := p.peek(0).value.(string)
+	p.consume() // Consume channel
 
-	return &WhileStmt{
-		FetchStatus: &Literal{Value: fetchStatus},
-		Stmts: &BeginEndBlock{
-			Stmts: stmts,
-		},
+	return &UnlistenStmt{
+		Channel: &Identifier{Value: name},
 	}, nil
-
 }
 
-// parseCursorStmts parses statements inside a cursor
-func (p *Parser) parseCursorStmts() ([]interface{}, error) {
-	stmts := make([]interface{}, 0)
+// parseNotifyStmt parses a NOTIFY statement
+func (p *Parser) parseNotifyStmt() (Node, error) {
+	p.consume() // Consume NOTIFY
 
-	for {
-		if p.peek(0).tokenT == KEYWORD_TOK && p.peek(0).value == "END" {
-			break
-		}
+	if p.peek(0).tokenT != IDENT_TOK {
+		return nil, errors.New("expected identifier")
+	}
 
-		stmt, err := p.Parse()
-		if err != nil {
-			return nil, err
-		}
+	notifyStmt := &NotifyStmt{
+		Channel: &Identifier{Value: p.peek(0).value.(string)},
+	}
 
-		stmts = append(stmts, stmt)
+	p.consume() // Consume channel
 
-		if p.peek(0).tokenT == SEMICOLON_TOK {
-			p.consume()
-			continue
-		}
+	if p.peek(0).tokenT != COMMA_TOK {
+		return notifyStmt, nil
 	}
 
-	return stmts, nil
-
-}
+	p.consume() // Consume ,
 
-// parseFetchStmt parses a FETCH statement
-func (p *Parser) parseFetchStmt() (Node, error) {
-	p.consume() // Consume FETCH
+	if p.peek(0).tokenT != LITERAL_TOK {
+		return nil, errors.New("expected literal")
+	}
 
-	if p.peek(0).tokenT != KEYWORD_TOK || p.peek(0).value != "NEXT" {
-		return nil, errors.New("expected NEXT")
+	payload, ok := p.peek(0).value.(string)
+	if !ok {
+		return nil, errors.New("expected string payload")
 	}
 
-	p.consume() // Consume NEXT
+	// Remove the quotes of the literal
+	notifyStmt.Payload = &Literal{Value: shared.UnquoteLiteral(payload)}
+	p.consume() // Consume payload
 
-	if p.peek(0).tokenT != KEYWORD_TOK || p.peek(0).value != "FROM" {
-		return nil, errors.New("expected FROM")
-	}
+	return notifyStmt, nil
+}
 
-	p.consume() // Consume FROM
+// parseCopyStmt parses a COPY statement
+func (p *Parser) parseCopyStmt() (Node, error) {
+	// COPY table_name [(column_name, ...)] TO STDOUT | FROM STDIN
+	// COPY (SELECT ...) TO STDOUT
+	copyStmt := &CopyStmt{}
 
-	if p.peek(0).tokenT != IDENT_TOK {
-		return nil, errors.New("expected identifier")
-	}
+	p.consume() // Consume COPY
 
-	cursorName := p.peek(0).value.(string)
-	p.consume() // Consume cursor name
+	if p.peek(0).tokenT == LPAREN_TOK {
+		p.consume() // Consume (
 
-	// check for INTO
-	if p.peek(0).tokenT != KEYWORD_TOK || p.peek(0).value != "INTO" {
-		return nil, errors.New("expected INTO")
-	}
+		if p.peek(0).value != "SELECT" {
+			return nil, errors.New("expected SELECT")
+		}
 
-	p.consume() // Consume INTO
+		// The select ends at the closing parenthesis, we parse its tokens on their own
+		end, depth := p.pos, 0
+		for ; end < len(p.lexer.tokens); end++ {
+			if p.lexer.tokens[end].tokenT == LPAREN_TOK {
+				depth++
+			} else if p.lexer.tokens[end].tokenT == RPAREN_TOK {
+				if depth == 0 {
+					break
+				}
 
-	var into []*Identifier
+				depth--
+			}
+		}
 
-	for {
-		// The cursor variable name must start with a @
-		if p.peek(0).tokenT != IDENT_TOK && !strings.HasPrefix(p.peek(0).value.(string), "@") {
-			return nil, errors.New("expected cursor variable name")
+		if end == len(p.lexer.tokens) {
+			return nil, errors.New("expected )")
 		}
 
-		varName := p.peek(0).value.(string)
+		tokens := append(append([]Token{}, p.lexer.tokens[p.pos:end]...), Token{tokenT: SEMICOLON_TOK, value: ";"})
+		selectParser := &Parser{lexer: &Lexer{tokens: tokens}}
 
-		if p.peek(1).tokenT != IDENT_TOK {
-			return nil, errors.New("expected identifier")
+		selectStmt, err := selectParser.parseSelectStmt()
+		if err != nil {
+			return nil, err
 		}
 
-		varName += p.peek(1).value.(string)
-
-		p.consume() // Consume cursor variable name
-		p.consume()
+		if selectParser.peek(0).tokenT != SEMICOLON_TOK {
+			return nil, errors.New("expected )")
+		}
 
-		if p.peek(0).tokenT != COMMA_TOK {
-			into = append(into, &Identifier{Value: varName})
-			break
-		} else {
-			into = append(into, &Identifier{Value: varName})
-			p.consume()
+		copyStmt.Query = selectStmt.(*SelectStmt)
+		p.pos = end + 1 // Consume the select and )
+	} else {
+		tableName, err := p.parseIdentifier()
+		if err != nil {
+			return nil, err
 		}
 
-	}
+		copyStmt.TableName = tableName
 
-	return &FetchStmt{
-		CursorName: &Identifier{Value: cursorName},
-		Into:       into,
-	}, nil
+		if p.peek(0).tokenT == LPAREN_TOK {
+			p.consume() // Consume (
 
-}
+			for {
+				columnName, err := p.parseIdentifier()
+				if err != nil {
+					return nil, err
+				}
 
-// parseDeallocateStmt parses a DEALLOCATE statement
-func (p *Parser) parseDeallocateStmt() (Node, error) {
-	p.consume() // Consume DEALLOCATE
+				copyStmt.ColumnNames = append(copyStmt.ColumnNames, columnName)
 
-	if p.peek(0).tokenT != IDENT_TOK && p.peek(0).value != "@" {
-		return nil, errors.New("expected identifier")
+				if p.peek(0).tokenT != COMMA_TOK {
+					break
+				}
+
+				p.consume() // Consume ,
+			}
+
+			if p.peek(0).tokenT != RPAREN_TOK {
+				return nil, errors.New("expected )")
+			}
+
+			p.consume() // Consume )
+		}
 	}
 
-	// if the ident starts with a @
-	if strings.HasPrefix(p.peek(0).value.(string), "@") {
-		// check next token
-		if p.peek(1).tokenT != IDENT_TOK {
-			return nil, errors.New("expected identifier")
+	switch p.peek(0).value {
+	case "TO":
+		p.consume() // Consume TO
+
+		if p.peek(0).tokenT != IDENT_TOK || strings.ToUpper(p.peek(0).value.(string)) != "STDOUT" {
+			return nil, errors.New("expected STDOUT")
 		}
 
-		variableName := p.peek(0).value.(string) + p.peek(1).value.(string)
-		p.consume()
-		p.consume()
+		p.consume() // Consume STDOUT
+	case "FROM":
+		if copyStmt.Query != nil {
+			return nil, errors.New("expected TO, a query can only be copied to the client")
+		}
 
-		return &DeallocateStmt{
-			CursorVariableName: &Identifier{Value: variableName},
-		}, nil
+		p.consume() // Consume FROM
 
-	} else {
+		if p.peek(0).tokenT != IDENT_TOK || strings.ToUpper(p.peek(0).value.(string)) != "STDIN" {
+			return nil, errors.New("expected STDIN")
+		}
 
-		cursorName := p.peek(0).value.(string)
-		p.consume() // Consume cursor name
+		p.consume() // Consume STDIN
 
-		return &DeallocateStmt{
-			CursorName: &Identifier{Value: cursorName},
-		}, nil
+		copyStmt.From = true
+	default:
+		return nil, errors.New("expected TO or FROM")
 	}
 
+	return copyStmt, nil
 }
 
-// parseCloseStmt parses an CLOSE statement
-func (p *Parser) parseCloseStmt() (Node, error) {
-	p.consume() // Consume OPEN
+// parseDescribeStmt parses a DESCRIBE statement
+func (p *Parser) parseDescribeStmt() (Node, error) {
+	// DESCRIBE [table_name, ...]
+	describeStmt := &DescribeStmt{}
 
-	if p.peek(0).tokenT != IDENT_TOK {
-		return nil, errors.New("expected identifier")
-	}
+	p.consume() // Consume DESCRIBE
 
-	cursorName := p.peek(0).value.(string)
-	p.consume() // Consume cursor name
+	if p.peek(0).tokenT == SEMICOLON_TOK {
+		return describeStmt, nil
+	}
 
-	return &CloseStmt{
-		CursorName: &Identifier{Value: cursorName},
-	}, nil
+	for {
+		tableName, err := p.parseIdentifier()
+		if err != nil {
+			return nil, err
+		}
 
-}
+		describeStmt.TableNames = append(describeStmt.TableNames, tableName)
 
-// parseOpenStmt parses an OPEN statement
-func (p *Parser) parseOpenStmt() (Node, error) {
-	p.consume() // Consume OPEN
+		if p.peek(0).tokenT != COMMA_TOK {
+			break
+		}
 
-	if p.peek(0).tokenT != IDENT_TOK {
-		return nil, errors.New("expected identifier")
+		p.consume() // Consume ,
 	}
 
-	cursorName := p.peek(0).value.(string)
-	p.consume() // Consume cursor name
-
-	return &OpenStmt{
-		CursorName: &Identifier{Value: cursorName},
-	}, nil
+	if p.peek(0).tokenT != SEMICOLON_TOK {
+		return nil, errors.New("expected ';'")
+	}
 
+	return describeStmt, nil
 }
 
-// parseDeclareStmt parses a DECLARE statement
-func (p *Parser) parseDeclareStmt() (Node, error) {
-	p.consume() // Consume DECLARE
+// parseSetSessionStmt parses a SET statement changing a setting of the session
+func (p *Parser) parseSetSessionStmt() (Node, error) {
+	// SET [SESSION] name { = | TO } { 'value' | ON | OFF }
+	p.consume() // Consume SET
 
-	if p.peek(0).tokenT != IDENT_TOK && p.peek(0).value != "@" {
-		return nil, errors.New("expected identifier")
+	if p.peek(0).tokenT == IDENT_TOK && strings.ToUpper(p.peek(0).value.(string)) == "SESSION" {
+		p.consume() // Consume SESSION
 	}
 
-	// if the ident starts with a @
-	if strings.HasPrefix(p.peek(0).value.(string), "@") {
-		if p.peek(1).tokenT != IDENT_TOK {
-			return nil, errors.New("expected identifier")
-		}
-
-		// we know it's a cursor variable not a cursor
-		cursorVariableName := p.peek(0).value.(string) + p.peek(1).value.(string)
+	if p.peek(0).tokenT == IDENT_TOK && strings.ToUpper(p.peek(0).value.(string)) == "TRANSACTION" {
+		return p.parseSetTransactionStmt()
+	}
 
-		// consume the cursor variable name
-		p.consume()
+	name, err := p.parseIdentifier()
+	if err != nil {
+		return nil, err
+	}
 
-		p.consume()
+	if !(p.peek(0).tokenT == COMPARISON_TOK && p.peek(0).value == "=") && !(p.peek(0).tokenT == KEYWORD_TOK && p.peek(0).value == "TO") {
+		return nil, errors.New("expected = or TO")
+	}
 
-		// Check for datatype
-		if p.peek(0).tokenT != DATATYPE_TOK {
-			return nil, errors.New("expected datatype")
-		}
+	p.consume() // Consume = or TO
 
-		// consume the datatype
-		cursorVariableDataType := p.peek(0).value.(string)
+	value, ok := p.peek(0).value.(string)
 
-		// consume the datatype
-		p.consume()
+	// Switches are set unquoted, SET optimizer_trace = ON
+	word := ok && ((p.peek(0).tokenT == KEYWORD_TOK && value == "ON") || (p.peek(0).tokenT == IDENT_TOK && strings.ToUpper(value) == "OFF"))
 
-		return &DeclareStmt{
-			CursorVariableName: &Identifier{Value: cursorVariableName},
-			CursorVariableDataType: &Identifier{
-				Value: cursorVariableDataType,
-			},
-		}, nil
+	if (p.peek(0).tokenT != LITERAL_TOK && !word) || !ok {
+		return nil, errors.New("expected setting value")
+	}
 
-	} else {
-		// we know it's a cursor
-		cursorName := p.peek(0).value.(string)
+	p.consume() // Consume value
 
-		// consume the cursor name
-		p.consume()
+	if p.peek(0).tokenT != SEMICOLON_TOK {
+		return nil, errors.New("expected ';'")
+	}
 
-		// look gor CURSOR FOR
-		if p.peek(0).tokenT != KEYWORD_TOK || p.peek(0).value != "CURSOR" {
-			return nil, errors.New("expected CURSOR")
-		}
+	return &SetSessionStmt{Name: name, Value: &Literal{Value: strings.Trim(value, "'\"")}}, nil
+}
 
-		p.consume() // Consume CURSOR
+// parseSetTransactionStmt parses a SET TRANSACTION statement, SET is consumed
+func (p *Parser) parseSetTransactionStmt() (Node, error) {
+	// SET TRANSACTION ISOLATION LEVEL { READ COMMITTED | REPEATABLE READ | SERIALIZABLE }
+	p.consume() // Consume TRANSACTION
 
-		if p.peek(0).tokenT != KEYWORD_TOK || p.peek(0).value != "FOR" {
-			return nil, errors.New("expected FOR")
+	for _, word := range []string{"ISOLATION", "LEVEL"} {
+		if p.peek(0).tokenT != IDENT_TOK || strings.ToUpper(p.peek(0).value.(string)) != word {
+			return nil, errors.New("expected " + word)
 		}
 
-		p.consume() // Consume FOR
+		p.consume() // Consume ISOLATION or LEVEL
+	}
 
-		// parse select statement
-		selectStmt, err := p.parseSelectStmt()
-		if err != nil {
-			return nil, err
-		}
+	var level []string
 
-		return &DeclareStmt{
-			CursorName: &Identifier{Value: cursorName},
-			CursorStmt: selectStmt.(*SelectStmt),
-		}, nil
+	for p.peek(0).tokenT == IDENT_TOK {
+		level = append(level, strings.ToUpper(p.peek(0).value.(string)))
+		p.consume() // Consume level
+	}
+
+	isolation := strings.Join(level, " ")
+	switch isolation {
+	case "READ COMMITTED", "REPEATABLE READ", "SERIALIZABLE":
+	default:
+		return nil, errors.New("expected READ COMMITTED, REPEATABLE READ or SERIALIZABLE")
+	}
 
+	if p.peek(0).tokenT != SEMICOLON_TOK {
+		return nil, errors.New("expected ';'")
 	}
 
+	return &SetTransactionStmt{Isolation: isolation}, nil
 }
 
-// parseAlterStmt parses an ALTER statement
-func (p *Parser) parseAlterStmt() (Node, error) {
-	p.consume() // Consume ALTER
+// parseMoveTableStmt parses a MOVE TABLE statement
+func (p *Parser) parseMoveTableStmt() (Node, error) {
+	// MOVE TABLE table_name TO TIER { HOT | COLD }
+	p.consume() // Consume MOVE
 
-	if p.peek(0).tokenT != KEYWORD_TOK {
-		return nil, errors.New("expected keyword")
+	if p.peek(0).tokenT != KEYWORD_TOK || p.peek(0).value != "TABLE" {
+		return nil, errors.New("expected TABLE")
 	}
 
-	switch p.peek(0).value {
-	case "USER":
-		return p.parseAlterUserStmt()
-	case "TABLE":
-		return p.parseAlterTableStmt()
+	p.consume() // Consume TABLE
+
+	tableName, err := p.parseIdentifier()
+	if err != nil {
+		return nil, err
 	}
 
-	return nil, errors.New("expected USER or TABLE")
+	if p.peek(0).tokenT != KEYWORD_TOK || p.peek(0).value != "TO" {
+		return nil, errors.New("expected TO")
+	}
 
-}
+	p.consume() // Consume TO
 
-// parseAlterTableStmt
-func (p *Parser) parseAlterTableStmt() (Node, error) {
-	p.consume() // Consume TABLE
+	if p.peek(0).tokenT != IDENT_TOK || strings.ToUpper(p.peek(0).value.(string)) != "TIER" {
+		return nil, errors.New("expected TIER")
+	}
 
-	tableName := ""
+	p.consume() // Consume TIER
 
-	if p.peek(0).tokenT != IDENT_TOK {
-		return nil, errors.New("expected identifier")
+	tier, ok := p.peek(0).value.(string)
+	if p.peek(0).tokenT != IDENT_TOK || !ok || (strings.ToUpper(tier) != "HOT" && strings.ToUpper(tier) != "COLD") {
+		return nil, errors.New("expected HOT or COLD")
 	}
 
-	tableName = p.peek(0).value.(string)
+	p.consume() // Consume tier
 
-	p.consume() // Consume table name
+	if p.peek(0).tokenT != SEMICOLON_TOK {
+		return nil, errors.New("expected ';'")
+	}
 
-	// ALTER COLUMN [identifier] [column_definition]
-	// DROP COLUMN [identifier]
+	return &MoveTableStmt{TableName: tableName, Tier: strings.ToUpper(tier)}, nil
+}
 
-	if p.peek(0).tokenT != KEYWORD_TOK {
-		return nil, errors.New("expected keyword")
+// parseLoadIntoCacheStmt parses a LOAD INTO CACHE statement
+func (p *Parser) parseLoadIntoCacheStmt() (Node, error) {
+	// LOAD INTO CACHE table_name [, table_name ...]
+	p.consume() // Consume LOAD
+
+	if p.peek(0).tokenT != KEYWORD_TOK || p.peek(0).value != "INTO" {
+		return nil, errors.New("expected INTO")
 	}
 
-	switch p.peek(0).value {
-	case "DROP":
-		p.consume() // Consume DROP
-
-		if p.peek(0).tokenT != KEYWORD_TOK {
-			return nil, errors.New("expected keyword")
-		}
-
-		p.consume() // Consume COLUMN
-
-		if p.peek(0).tokenT != IDENT_TOK {
-			return nil, errors.New("expected identifier")
-		}
-
-		columnName := p.peek(0).value.(string)
+	p.consume() // Consume INTO
 
-		p.consume()
+	if p.peek(0).tokenT != IDENT_TOK || strings.ToUpper(p.peek(0).value.(string)) != "CACHE" {
+		return nil, errors.New("expected CACHE")
+	}
 
-		return &AlterTableStmt{
-			TableName:  &Identifier{Value: tableName},
-			ColumnName: &Identifier{Value: columnName},
-		}, nil
+	p.consume() // Consume CACHE
 
-	case "ALTER":
-		p.consume() // Consume ALTER
+	loadStmt := &LoadIntoCacheStmt{}
 
-		if p.peek(0).tokenT != KEYWORD_TOK {
-			return nil, errors.New("expected keyword")
+	for {
+		tableName, err := p.parseIdentifier()
+		if err != nil {
+			return nil, err
 		}
 
-		p.consume() // Consume COLUMN
+		loadStmt.TableNames = append(loadStmt.TableNames, tableName)
 
-		dummyCreateTblStatement := &CreateTableStmt{
-			TableSchema: &catalog.TableSchema{
-				ColumnDefinitions: make(map[string]*catalog.ColumnDefinition),
-			},
+		if p.peek(0).tokenT != COMMA_TOK {
+			break
 		}
 
-		if p.peek(0).tokenT != IDENT_TOK {
+		p.consume() // Consume ,
+	}
 
-			err := p.parseTableConstraints(dummyCreateTblStatement, "")
-			if err != nil {
-				return nil, err
-			}
-			break
-		}
+	if p.peek(0).tokenT != SEMICOLON_TOK {
+		return nil, errors.New("expected ';'")
+	}
 
-		columnName := p.peek(0).value.(string)
+	return loadStmt, nil
+}
 
-		p.consume() // Consume column name
+// parseApplyMigrationStmt parses an APPLY MIGRATION statement
+func (p *Parser) parseApplyMigrationStmt() (Node, error) {
+	// APPLY MIGRATION 'name' FROM 'file'
+	p.consume() // Consume APPLY
 
-		if p.peek(0).tokenT != DATATYPE_TOK {
+	if p.peek(0).tokenT != IDENT_TOK || strings.ToUpper(p.peek(0).value.(string)) != "MIGRATION" {
+		return nil, errors.New("expected MIGRATION")
+	}
 
-			return nil, errors.New("expected data type")
-		}
+	p.consume() // Consume MIGRATION
 
-		dataType := p.peek(0).value.(string)
+	name, ok := p.peek(0).value.(string)
+	if p.peek(0).tokenT != LITERAL_TOK || !ok || strings.Trim(name, "'\"") == "" {
+		return nil, errors.New("expected migration name")
+	}
 
-		dummyCreateTblStatement.TableSchema.ColumnDefinitions[columnName] = &catalog.ColumnDefinition{
-			DataType: dataType,
-		}
+	p.consume() // Consume name
 
-		p.consume() // Consume data type
+	if p.peek(0).value != "FROM" {
+		return nil, errors.New("expected FROM")
+	}
 
-		// check for DATATYPE(LEN) or DATATYPE(PRECISION, SCALE)
-		if p.peek(0).tokenT == LPAREN_TOK {
-			switch dataType {
+	p.consume() // Consume FROM
 
-			case "CHAR", "CHARACTER", "BINARY":
-				p.consume() // Consume (
+	file, ok := p.peek(0).value.(string)
+	if p.peek(0).tokenT != LITERAL_TOK || !ok || strings.Trim(file, "'\"") == "" {
+		return nil, errors.New("expected migration file")
+	}
 
-				if p.peek(0).tokenT != LITERAL_TOK {
+	p.consume() // Consume file
 
-					return nil, errors.New("expected literal")
-				}
+	return &ApplyMigrationStmt{
+		Name: &Literal{Value: strings.Trim(name, "'\"")},
+		File: &Literal{Value: strings.Trim(file, "'\"")},
+	}, nil
+}
 
-				length := p.peek(0).value.(uint64)
+// Split splits a script into its statements, each ending with its semicolon
+// The statements within a BEGIN ... END block end with the block, as do the WHEN clauses of a CASE
+func Split(input []byte) ([][]byte, error) {
+	l := NewLexer(input)
 
-				p.consume() // Consume literal
+	var statements [][]byte
+	start, depth := 0, 0
+	var prev Token
 
-				if p.peek(0).tokenT != RPAREN_TOK {
-					return nil, errors.New("expected )")
-				}
+	for {
+		tok := l.nextToken()
+		if l.err != nil {
+			return nil, l.err
+		}
 
-				p.consume() // Consume )
+		if tok.tokenT == EOF_TOK {
+			break
+		}
 
-				dummyCreateTblStatement.TableSchema.ColumnDefinitions[columnName].Length = int(length)
-			case "DEC", "DECIMAL", "NUMERIC", "REAL", "FLOAT", "DOUBLE":
+		switch {
+		case tok.tokenT == KEYWORD_TOK && (tok.value == "BEGIN" || tok.value == "CASE"):
+			depth++
+		case tok.tokenT == KEYWORD_TOK && tok.value == "END" && depth > 0:
+			depth--
+		case tok.tokenT == SEMICOLON_TOK:
+			// BEGIN; begins a transaction rather than a block
+			if prev.tokenT == KEYWORD_TOK && prev.value == "BEGIN" {
+				depth--
+			}
 
-				p.consume() // Consume (
+			if depth == 0 {
+				statements = append(statements, input[start:l.pos])
+				start = l.pos
+			}
+		}
 
-				if p.peek(0).tokenT != LITERAL_TOK {
-					return nil, errors.New("expected literal")
-				}
+		if tok.tokenT != COMMENT_TOK {
+			prev = tok
+		}
+	}
 
-				precision := p.peek(0).value.(uint64)
+	// Only comments may follow the last statement
+	if prev.tokenT != SEMICOLON_TOK && prev.tokenT != EOF_TOK {
+		return nil, errors.New("expected ';'")
+	}
 
-				p.consume() // Consume literal
+	if depth != 0 {
+		return nil, errors.New("expected END")
+	}
 
-				if p.peek(0).tokenT != COMMA_TOK {
-					return nil, errors.New("expected ,")
-				}
+	return statements, nil
+}
 
-				p.consume() // Consume ,
+// parseExportStmt parses an EXPORT statement
+func (p *Parser) parseExportStmt() (Node, error) {
+	// EXPORT TABLE table_name TO 'file.parquet' [ROW GROUP SIZE n]
+	// EXPORT QUERY SELECT ... TO 'file.parquet' [ROW GROUP SIZE n]
+	exportStmt := &ExportStmt{}
 
-				if p.peek(0).tokenT != LITERAL_TOK {
-					return nil, errors.New("expected literal")
-				}
+	p.consume() // Consume EXPORT
 
-				scale := p.peek(0).value.(uint64)
+	switch {
+	case p.peek(0).value == "TABLE":
+		p.consume() // Consume TABLE
 
-				p.consume() // Consume literal
+		if p.peek(0).tokenT != IDENT_TOK {
+			return nil, errors.New("expected identifier")
+		}
 
-				if p.peek(0).tokenT != RPAREN_TOK {
-					return nil, errors.New("expected )")
-				}
+		exportStmt.TableName = &Identifier{Value: p.peek(0).value.(string)}
+		p.consume() // Consume table name
+	case p.peek(0).tokenT == IDENT_TOK && strings.ToUpper(p.peek(0).value.(string)) == "QUERY":
+		p.consume() // Consume QUERY
 
-				p.consume() // Consume )
+		if p.peek(0).value != "SELECT" {
+			return nil, errors.New("expected SELECT")
+		}
 
-				dummyCreateTblStatement.TableSchema.ColumnDefinitions[columnName].Precision = int(precision)
-				dummyCreateTblStatement.TableSchema.ColumnDefinitions[columnName].Scale = int(scale)
+		// The select ends at TO, we parse its tokens on their own
+		end := p.pos
+		for end < len(p.lexer.tokens) && p.lexer.tokens[end].value != "TO" {
+			end++
+		}
 
-			}
+		if end == len(p.lexer.tokens) {
+			return nil, errors.New("expected TO")
 		}
 
-		err := p.parseTableConstraints(dummyCreateTblStatement, columnName)
+		tokens := append(append([]Token{}, p.lexer.tokens[p.pos:end]...), Token{tokenT: SEMICOLON_TOK, value: ";"})
+		selectParser := &Parser{lexer: &Lexer{tokens: tokens}}
+
+		selectStmt, err := selectParser.parseSelectStmt()
 		if err != nil {
 			return nil, err
-
 		}
 
-		return &AlterTableStmt{
-			TableName:        &Identifier{Value: tableName},
-			ColumnName:       &Identifier{Value: columnName},
-			ColumnDefinition: dummyCreateTblStatement.TableSchema.ColumnDefinitions[columnName],
-		}, nil
+		if selectParser.peek(0).tokenT != SEMICOLON_TOK {
+			return nil, errors.New("expected TO")
+		}
 
+		exportStmt.Query = selectStmt.(*SelectStmt)
+		p.pos = end
+	default:
+		return nil, errors.New("expected TABLE or QUERY")
 	}
 
-	return nil, errors.New("expected ADD, DROP, SET, RENAME, or MODIFY")
+	if p.peek(0).value != "TO" {
+		return nil, errors.New("expected TO")
+	}
 
-}
+	p.consume() // Consume TO
 
-// parseAlterUserStmt parses an ALTER USER statement
-func (p *Parser) parseAlterUserStmt() (Node, error) {
-	alterUserStmt := &AlterUserStmt{}
-	p.consume() // Consume USER
+	if p.peek(0).tokenT != LITERAL_TOK {
+		return nil, errors.New("expected literal")
+	}
 
-	if p.peek(0).tokenT != IDENT_TOK {
-		return nil, errors.New("expected identifier")
+	file, ok := p.peek(0).value.(string)
+	if !ok || !strings.HasSuffix(strings.ToLower(strings.Trim(file, "'\"")), ".parquet") {
+		return nil, errors.New("expected a .parquet file")
 	}
 
-	alterUserStmt.Username = &Identifier{Value: p.peek(0).value.(string)}
-	p.consume() // Consume username
+	exportStmt.File = &Literal{Value: strings.Trim(file, "'\"")}
+	p.consume() // Consume file
 
-	if p.peek(0).tokenT != KEYWORD_TOK {
-		return nil, errors.New("expected keyword")
-	}
+	// ROW GROUP SIZE n
+	if p.peek(0).tokenT == IDENT_TOK && strings.ToUpper(p.peek(0).value.(string)) == "ROW" {
+		p.consume() // Consume ROW
 
-	switch p.peek(0).value {
-	case "SET":
-		p.consume() // Consume SET
-		switch p.peek(0).value {
-		case "PASSWORD":
-			alterUserStmt.SetType = ALTER_USER_SET_PASSWORD
-		case "USERNAME":
-			alterUserStmt.SetType = ALTER_USER_SET_USERNAME
-		default:
-			return nil, errors.New("expected PASSWORD or USERNAME")
+		if p.peek(0).value != "GROUP" {
+			return nil, errors.New("expected GROUP")
+		}
+
+		p.consume() // Consume GROUP
 
+		if p.peek(0).tokenT != IDENT_TOK || strings.ToUpper(p.peek(0).value.(string)) != "SIZE" {
+			return nil, errors.New("expected SIZE")
 		}
-	default:
-		return nil, errors.New("expected SET")
-	}
 
-	p.consume() // Consume PASSWORD or USERNAME
+		p.consume() // Consume SIZE
 
-	if p.peek(0).tokenT != LITERAL_TOK {
+		size, ok := p.peek(0).value.(uint64)
+		if !ok || size == 0 {
+			return nil, errors.New("expected row group size")
+		}
 
-		return nil, errors.New("expected literal")
+		exportStmt.RowGroupSize = int(size)
+		p.consume() // Consume size
 	}
 
-	alterUserStmt.Value = &Literal{Value: strings.TrimSuffix(strings.TrimPrefix(p.peek(0).value.(string), "'"), "'")}
+	if p.peek(0).tokenT != SEMICOLON_TOK {
+		return nil, errors.New("expected ';'")
+	}
 
-	return alterUserStmt, nil
+	return exportStmt, nil
 }
 
-// parseShowStmt parses a SHOW statement
-func (p *Parser) parseShowStmt() (Node, error) {
-	p.consume() // Consume SHOW
+// parsePrintStmt parses a PRINT statement
+func (p *Parser) parsePrintStmt() (Node, error) {
+	p.consume() // Consume PRINT
 
-	switch strings.ToUpper(p.peek(0).value.(string)) {
-	case "DATABASES":
-		return &ShowStmt{ShowType: SHOW_DATABASES}, nil
-	case "TABLES":
-		return &ShowStmt{ShowType: SHOW_TABLES}, nil
-	case "USERS":
-		return &ShowStmt{ShowType: SHOW_USERS}, nil
-	case "INDEXES":
-		p.consume() // Consume INDEXES
+	// PRINT (literal | @variable)
+	// i.e. PRINT 'Hello, World!'
+	// i.e. PRINT @variable
 
-		if p.peek(0).tokenT != KEYWORD_TOK || p.peek(0).value != "FROM" {
-			return nil, errors.New("expected FROM")
+	// You can print a literal or a @variable
+	if p.peek(0).tokenT == AT_TOK {
+		variableName := ""
+		if p.peek(1).tokenT != IDENT_TOK {
+			return nil, errors.New("expected identifier")
 		}
 
-		p.consume() // Consume FROM
-
-		if p.peek(0).tokenT != IDENT_TOK {
+		variableName = p.peek(0).value.(string) + p.peek(1).value.(string)
+		p.consume()
+		p.consume()
 
-			return nil, errors.New("expected identifier")
+		return &PrintStmt{
+			Expr: &Identifier{Value: variableName},
+		}, nil
+	} else {
+		// check for literal
+		if p.peek(0).tokenT != LITERAL_TOK {
+			return nil, errors.New("expected literal")
 		}
 
-		tableName := p.peek(0).value.(string)
-
-		return &ShowStmt{ShowType: SHOW_INDEXES, From: &Identifier{
-			Value: tableName,
-		}}, nil
-	case "GRANTS":
+		return &PrintStmt{
+			Expr: &Literal{Value: p.peek(0).value},
+		}, nil
+	}
 
-		p.consume() // Consume GRANTS
+}
 
-		if p.peek(0).tokenT == KEYWORD_TOK && p.peek(0).value == "FOR" {
-			p.consume() // Consume ON
+// parseWhileStmt parses a WHILE statement
+func (p *Parser) parseWhileStmt() (Node, error) {
+	// Look for
+	// WHILE @@FETCH_STATUS = 0
+	// BEGIN
 
-			if p.peek(0).tokenT != IDENT_TOK {
-				return nil, errors.New("expected identifier")
-			}
+	p.consume() // Consume WHILE
 
-			tableName := p.peek(0).value.(string)
-			p.consume() // Consume username
+	if p.peek(0).tokenT != AT_TOK {
+		return nil, errors.New("expected @")
+	}
 
-			return &ShowStmt{ShowType: SHOW_GRANTS, For: &Identifier{Value: tableName}}, nil
-		}
+	p.consume() // Consume @
 
-		return &ShowStmt{ShowType: SHOW_GRANTS}, nil
+	if p.peek(0).tokenT != AT_TOK {
+		return nil, errors.New("expected @")
 	}
 
-	return nil, errors.New("expected DATABASES, TABLES, or USERS")
+	p.consume() // Consume @
 
-}
-
-// parseRevokeStmt parses a REVOKE statement
-func (p *Parser) parseRevokeStmt() (Node, error) {
-	p.consume() // Consume REVOKE
+	// Should be FETCH_STATUS
+	if p.peek(0).tokenT != IDENT_TOK || p.peek(0).value != "FETCH_STATUS" {
+		return nil, errors.New("expected FETCH_STATUS")
 
-	if p.peek(0).tokenT != KEYWORD_TOK {
-		return nil, errors.New("expected keyword")
 	}
 
-	switch p.peek(0).value {
-	case "SELECT", "INSERT", "UPDATE", "DELETE", "ALL", "DROP", "CREATE", "CONNECT", "ALTER":
-		return p.parsePrivilegeStmt(true)
+	p.consume() // Consume FETCH_STATUS
+
+	// Next tok should be =
+	if p.peek(0).tokenT != COMPARISON_TOK || p.peek(0).value != "=" {
+		return nil, errors.New("expected =")
 	}
 
-	return nil, errors.New("expected SELECT, INSERT, UPDATE, DELETE")
+	p.consume() // Consume =
 
-}
+	// Next tok should be 0
+	if p.peek(0).tokenT != LITERAL_TOK || p.peek(0).value != uint64(0) {
+		return nil, errors.New("expected 0") // While @@FETCH_STATUS = 0 means while there are rows to fetch
+		// There is no benefit in using -1, or -2, or any other number
+	}
 
-// parseGrantStmt parses a GRANT statement
-func (p *Parser) parseGrantStmt() (Node, error) {
+	fetchStatus := p.peek(0).value.(uint64)
 
-	p.consume() // Consume GRANT
+	p.consume() // Consume 0
 
-	if p.peek(0).tokenT != KEYWORD_TOK {
-		return nil, errors.New("expected keyword")
-	}
+	// Next tok should be BEGIN
 
-	switch p.peek(0).value {
-	case "SELECT", "INSERT", "UPDATE", "DELETE", "ALL", "DROP", "CREATE", "CONNECT", "ALTER":
-		return p.parsePrivilegeStmt(false)
+	if p.peek(0).tokenT != KEYWORD_TOK || p.peek(0).value != "BEGIN" {
+		return nil, errors.New("expected BEGIN")
 	}
 
-	return nil, errors.New("expected SELECT, INSERT, UPDATE, DELETE")
+	p.consume() // Consume BEGIN
 
-}
+	// Parse statements inside the while loop
+	stmts, err := p.parseCursorStmts()
+	if err != nil {
+		return nil, err
+	}
 
-// parsePrivilegeStmt parses a privilege statement
-func (p *Parser) parsePrivilegeStmt(revoke bool) (Node, error) {
-	//  GRANT SELECT, INSERT, UPDATE, DELETE ON database.table TO user;
+	// Look for END
+	if p.peek(0).tokenT != KEYWORD_TOK || p.peek(0).value != "END" {
+		return nil, errors.New("expected END")
+	}
 
-	grantStmt := &GrantStmt{}
-	revokeStmt := &RevokeStmt{}
+	p.consume() // Consume END
 
-	privilegeDefinition := &PrivilegeDefinition{
-		Actions: make([]shared.PrivilegeAction, 0),
-	}
+	return &WhileStmt{
+		FetchStatus: &Literal{Value: fetchStatus},
+		Stmts: &BeginEndBlock{
+			Stmts: stmts,
+		},
+	}, nil
 
-	all := false
+}
+
+// parseCursorStmts parses statements inside a cursor
+func (p *Parser) parseCursorStmts() ([]interface{}, error) {
+	stmts := make([]interface{}, 0)
 
 	for {
-		switch p.peek(0).value {
-		case "ALL":
-			privilegeDefinition.Actions = append(privilegeDefinition.Actions, shared.PRIV_ALL)
-			all = true
-		case "SELECT":
-			if !all {
-				privilegeDefinition.Actions = append(privilegeDefinition.Actions, shared.PRIV_SELECT)
-			}
-		case "BEGIN":
-			if !all {
-				privilegeDefinition.Actions = append(privilegeDefinition.Actions, shared.PRIV_BEGIN)
-			}
-		case "COMMIT":
-			if !all {
-				privilegeDefinition.Actions = append(privilegeDefinition.Actions, shared.PRIV_COMMIT)
-			}
-		case "ROLLBACK":
-			if !all {
-				privilegeDefinition.Actions = append(privilegeDefinition.Actions, shared.PRIV_ROLLBACK)
-			}
-		case "INSERT":
-			if !all {
-				privilegeDefinition.Actions = append(privilegeDefinition.Actions, shared.PRIV_INSERT)
-			}
-		case "UPDATE":
-			if !all {
-				privilegeDefinition.Actions = append(privilegeDefinition.Actions, shared.PRIV_UPDATE)
-			}
-		case "DELETE":
-			if !all {
-				privilegeDefinition.Actions = append(privilegeDefinition.Actions, shared.PRIV_DELETE)
-			}
-		case "DROP":
-			if !all {
-				privilegeDefinition.Actions = append(privilegeDefinition.Actions, shared.PRIV_DROP)
-			}
-		case "CREATE":
-			if !all {
-				privilegeDefinition.Actions = append(privilegeDefinition.Actions, shared.PRIV_CREATE)
-			}
-		case "CONNECT":
-			if !all {
-				privilegeDefinition.Actions = append(privilegeDefinition.Actions, shared.PRIV_CONNECT)
-			}
-		case "ALTER":
-			if !all {
-				privilegeDefinition.Actions = append(privilegeDefinition.Actions, shared.PRIV_ALTER)
-			}
-		case "REVOKE":
-			if !all {
-				privilegeDefinition.Actions = append(privilegeDefinition.Actions, shared.PRIV_REVOKE)
-			}
-		case "GRANT":
-			if !all {
-				privilegeDefinition.Actions = append(privilegeDefinition.Actions, shared.PRIV_GRANT)
-			}
-		case "SHOW":
-			if !all {
-				privilegeDefinition.Actions = append(privilegeDefinition.Actions, shared.PRIV_SHOW)
-			}
-		case "EXEC":
-			if !all {
-				privilegeDefinition.Actions = append(privilegeDefinition.Actions, shared.PRIV_EXEC)
-			}
-		case "EXPLAIN":
-			if !all {
-				privilegeDefinition.Actions = append(privilegeDefinition.Actions, shared.PRIV_EXPLAIN)
-			}
-		case "PRINT":
-			if !all {
-				privilegeDefinition.Actions = append(privilegeDefinition.Actions, shared.PRIV_PRINT)
-			}
-		case "DECLARE":
-			if !all {
-				privilegeDefinition.Actions = append(privilegeDefinition.Actions, shared.PRIV_DECLARE)
-			}
-		case "OPEN":
-			if !all {
-				privilegeDefinition.Actions = append(privilegeDefinition.Actions, shared.PRIV_OPEN)
-			}
-		case "CLOSE":
-			if !all {
-				privilegeDefinition.Actions = append(privilegeDefinition.Actions, shared.PRIV_CLOSE)
-			}
-		case "DEALLOCATE":
-			if !all {
-				privilegeDefinition.Actions = append(privilegeDefinition.Actions, shared.PRIV_DEALLOCATE)
-			}
-		case "FETCH":
-			if !all {
-				privilegeDefinition.Actions = append(privilegeDefinition.Actions, shared.PRIV_FETCH)
-			}
-		case "WHILE":
-			if !all {
-				privilegeDefinition.Actions = append(privilegeDefinition.Actions, shared.PRIV_WHILE)
-			}
-		case "RETURN":
-			if !all {
-				privilegeDefinition.Actions = append(privilegeDefinition.Actions, shared.PRIV_RETURN)
-			}
-		case "BREAK":
-			if !all {
-				privilegeDefinition.Actions = append(privilegeDefinition.Actions, shared.PRIV_BREAK)
-			}
-		case "SET":
-			if !all {
-				privilegeDefinition.Actions = append(privilegeDefinition.Actions, shared.PRIV_SET)
-			}
-		case "EXIT":
-			if !all {
-				privilegeDefinition.Actions = append(privilegeDefinition.Actions, shared.PRIV_EXIT)
-			}
-		default:
-			return nil, errors.New("expected privilege")
+		if p.peek(0).tokenT == KEYWORD_TOK && p.peek(0).value == "END" {
+			break
 		}
 
-		p.consume()
+		stmt, err := p.Parse()
+		if err != nil {
+			return nil, err
+		}
 
-		if p.peek(0).tokenT == COMMA_TOK {
+		stmts = append(stmts, stmt)
+
+		if p.peek(0).tokenT == SEMICOLON_TOK {
 			p.consume()
 			continue
-		} else {
-			break
 		}
-
 	}
 
-	if p.peek(0).value != "TO" {
+	return stmts, nil
 
-		if p.peek(0).tokenT != KEYWORD_TOK || p.peek(0).value != "ON" {
-			return nil, errors.New("expected ON")
-		}
+}
 
-		p.consume() // Consume ON
+// parseFetchStmt parses a FETCH statement
+func (p *Parser) parseFetchStmt() (Node, error) {
+	p.consume() // Consume FETCH
 
-		if p.peek(0).tokenT != IDENT_TOK {
-			if p.peek(0).value != "*" {
-				return nil, errors.New("expected identifier or * ")
-			}
-		}
+	if p.peek(0).tokenT != KEYWORD_TOK || p.peek(0).value != "NEXT" {
+		return nil, errors.New("expected NEXT")
+	}
 
-		db := &Identifier{}
-		table := &Identifier{}
+	p.consume() // Consume NEXT
 
-		// if asterisk is found, set database to *
-		if p.peek(0).value == "*" {
-			db = &Identifier{Value: "*"}
-			p.consume()
+	if p.peek(0).tokenT != KEYWORD_TOK || p.peek(0).value != "FROM" {
+		return nil, errors.New("expected FROM")
+	}
 
-			// check if next value is * or identifier
-			if p.peek(0).value == ".*" {
-				table = &Identifier{Value: "*"}
-			}
-			p.consume() // Consume table name
-			privilegeDefinition.Object = &Identifier{Value: db.Value + "." + table.Value}
+	p.consume() // Consume FROM
 
-		} else {
-			if len(strings.Split(p.peek(0).value.(string), ".")) != 2 {
-				return nil, errors.New("expected database.table, *.*, or database.*")
-			}
+	if p.peek(0).tokenT != IDENT_TOK {
+		return nil, errors.New("expected identifier")
+	}
 
-			db = &Identifier{Value: strings.Split(p.peek(0).value.(string), ".")[0]}
-			table = &Identifier{Value: strings.Split(p.peek(0).value.(string), ".")[1]}
+	cursorName := p.peek(0).value.(string)
+	p.consume() // Consume cursor name
 
-			privilegeDefinition.Object = &Identifier{Value: db.Value + "." + table.Value}
+	// check for INTO
+	if p.peek(0).tokenT != KEYWORD_TOK || p.peek(0).value != "INTO" {
+		return nil, errors.New("expected INTO")
+	}
+
+	p.consume() // Consume INTO
+
+	var into []*Identifier
+
+	for {
+		// The cursor variable name must start with a @
+		if p.peek(0).tokenT != IDENT_TOK && !strings.HasPrefix(p.peek(0).value.(string), "@") {
+			return nil, errors.New("expected cursor variable name")
+		}
+
+		varName := p.peek(0).value.(string)
+
+		if p.peek(1).tokenT != IDENT_TOK {
+			return nil, errors.New("expected identifier")
+		}
+
+		varName += p.peek(1).value.(string)
+
+		p.consume() // Consume cursor variable name
+		p.consume()
+
+		if p.peek(0).tokenT != COMMA_TOK {
+			into = append(into, &Identifier{Value: varName})
+			break
+		} else {
+			into = append(into, &Identifier{Value: varName})
+			p.consume()
+		}
+
+	}
+
+	return &FetchStmt{
+		CursorName: &Identifier{Value: cursorName},
+		Into:       into,
+	}, nil
+
+}
+
+// parseDeallocateStmt parses a DEALLOCATE statement
+func (p *Parser) parseDeallocateStmt() (Node, error) {
+	p.consume() // Consume DEALLOCATE
+
+	if p.peek(0).tokenT == KEYWORD_TOK && p.peek(0).value == "PREPARE" {
+		p.consume() // Consume PREPARE
+
+		if p.peek(0).tokenT != IDENT_TOK {
+			return nil, errors.New("expected identifier")
+		}
+
+		name := p.peek(0).value.(string)
+		p.consume() // Consume name
+
+		if p.peek(0).tokenT != SEMICOLON_TOK {
+			return nil, errors.New("expected ';'")
+		}
+
+		return &DeallocatePrepareStmt{Name: &Identifier{Value: name}}, nil
+	}
+
+	if p.peek(0).tokenT != IDENT_TOK && p.peek(0).value != "@" {
+		return nil, errors.New("expected identifier")
+	}
+
+	// if the ident starts with a @
+	if strings.HasPrefix(p.peek(0).value.(string), "@") {
+		// check next token
+		if p.peek(1).tokenT != IDENT_TOK {
+			return nil, errors.New("expected identifier")
+		}
+
+		variableName := p.peek(0).value.(string) + p.peek(1).value.(string)
+		p.consume()
+		p.consume()
+
+		return &DeallocateStmt{
+			CursorVariableName: &Identifier{Value: variableName},
+		}, nil
+
+	} else {
+
+		cursorName := p.peek(0).value.(string)
+		p.consume() // Consume cursor name
+
+		return &DeallocateStmt{
+			CursorName: &Identifier{Value: cursorName},
+		}, nil
+	}
+
+}
+
+// parseCloseStmt parses an CLOSE statement
+func (p *Parser) parseCloseStmt() (Node, error) {
+	p.consume() // Consume OPEN
+
+	if p.peek(0).tokenT != IDENT_TOK {
+		return nil, errors.New("expected identifier")
+	}
+
+	cursorName := p.peek(0).value.(string)
+	p.consume() // Consume cursor name
+
+	return &CloseStmt{
+		CursorName: &Identifier{Value: cursorName},
+	}, nil
+
+}
+
+// parseOpenStmt parses an OPEN statement
+func (p *Parser) parseOpenStmt() (Node, error) {
+	p.consume() // Consume OPEN
+
+	if p.peek(0).tokenT != IDENT_TOK {
+		return nil, errors.New("expected identifier")
+	}
+
+	cursorName := p.peek(0).value.(string)
+	p.consume() // Consume cursor name
+
+	return &OpenStmt{
+		CursorName: &Identifier{Value: cursorName},
+	}, nil
+
+}
+
+// parseDeclareStmt parses a DECLARE statement
+func (p *Parser) parseDeclareStmt() (Node, error) {
+	p.consume() // Consume DECLARE
+
+	if p.peek(0).tokenT != IDENT_TOK && p.peek(0).value != "@" {
+		return nil, errors.New("expected identifier")
+	}
+
+	// if the ident starts with a @
+	if strings.HasPrefix(p.peek(0).value.(string), "@") {
+		if p.peek(1).tokenT != IDENT_TOK {
+			return nil, errors.New("expected identifier")
+		}
+
+		// we know it's a cursor variable not a cursor
+		cursorVariableName := p.peek(0).value.(string) + p.peek(1).value.(string)
+
+		// consume the cursor variable name
+		p.consume()
+
+		p.consume()
+
+		// Check for datatype
+		if p.peek(0).tokenT != DATATYPE_TOK {
+			return nil, errors.New("expected datatype")
+		}
+
+		// consume the datatype
+		cursorVariableDataType := p.peek(0).value.(string)
+
+		// consume the datatype
+		p.consume()
+
+		return &DeclareStmt{
+			CursorVariableName: &Identifier{Value: cursorVariableName},
+			CursorVariableDataType: &Identifier{
+				Value: cursorVariableDataType,
+			},
+		}, nil
+
+	} else {
+		// we know it's a cursor
+		cursorName := p.peek(0).value.(string)
+
+		// consume the cursor name
+		p.consume()
+
+		// look gor CURSOR FOR
+		if p.peek(0).tokenT != KEYWORD_TOK || p.peek(0).value != "CURSOR" {
+			return nil, errors.New("expected CURSOR")
+		}
+
+		p.consume() // Consume CURSOR
+
+		if p.peek(0).tokenT != KEYWORD_TOK || p.peek(0).value != "FOR" {
+			return nil, errors.New("expected FOR")
+		}
+
+		p.consume() // Consume FOR
+
+		// parse select statement
+		selectStmt, err := p.parseSelectStmt()
+		if err != nil {
+			return nil, err
+		}
+
+		return &DeclareStmt{
+			CursorName: &Identifier{Value: cursorName},
+			CursorStmt: selectStmt.(*SelectStmt),
+		}, nil
+
+	}
+
+}
+
+// parseAlterStmt parses an ALTER statement
+func (p *Parser) parseAlterStmt() (Node, error) {
+	p.consume() // Consume ALTER
+
+	if p.peek(0).tokenT != KEYWORD_TOK {
+		return nil, errors.New("expected keyword")
+	}
+
+	switch p.peek(0).value {
+	case "USER":
+		return p.parseAlterUserStmt()
+	case "TABLE":
+		return p.parseAlterTableStmt()
+	case "INDEX":
+		return p.parseAlterIndexStmt()
+	}
+
+	return nil, errors.New("expected USER, TABLE or INDEX")
+
+}
+
+// parseAlterIndexStmt parses an ALTER INDEX statement
+func (p *Parser) parseAlterIndexStmt() (Node, error) {
+	// ALTER INDEX index_name ON table_name RENAME TO new_name
+	// ALTER INDEX index_name ON table_name VISIBLE|INVISIBLE
+	p.consume() // Consume INDEX
+
+	if p.peek(0).tokenT != IDENT_TOK {
+		return nil, errors.New("expected identifier")
+	}
+
+	indexName := p.peek(0).value.(string)
+	p.consume() // Consume index name
+
+	if p.peek(0).value != "ON" {
+		return nil, errors.New("expected ON")
+	}
+
+	p.consume() // Consume ON
+
+	if p.peek(0).tokenT != IDENT_TOK {
+		return nil, errors.New("expected identifier")
+	}
+
+	tableName := p.peek(0).value.(string)
+	p.consume() // Consume table name
+
+	if p.peek(0).tokenT == IDENT_TOK {
+		visibility := map[string]AlterIndexVisibility{
+			"VISIBLE":   ALTER_INDEX_VISIBLE,
+			"INVISIBLE": ALTER_INDEX_INVISIBLE,
+		}[strings.ToUpper(p.peek(0).value.(string))]
+
+		if visibility == 0 {
+			return nil, errors.New("expected RENAME, VISIBLE or INVISIBLE")
+		}
+
+		p.consume() // Consume VISIBLE or INVISIBLE
+
+		return &AlterIndexStmt{
+			TableName:  &Identifier{Value: tableName},
+			IndexName:  &Identifier{Value: indexName},
+			Visibility: visibility,
+		}, nil
+	}
+
+	if p.peek(0).value != "RENAME" {
+		return nil, errors.New("expected RENAME, VISIBLE or INVISIBLE")
+	}
+
+	p.consume() // Consume RENAME
+
+	if p.peek(0).value != "TO" {
+		return nil, errors.New("expected TO")
+	}
+
+	p.consume() // Consume TO
+
+	if p.peek(0).tokenT != IDENT_TOK {
+		return nil, errors.New("expected identifier")
+	}
+
+	newName := p.peek(0).value.(string)
+	p.consume() // Consume new name
+
+	return &AlterIndexStmt{
+		TableName: &Identifier{Value: tableName},
+		IndexName: &Identifier{Value: indexName},
+		NewName:   &Identifier{Value: newName},
+	}, nil
+}
+
+// parseAlterTableStmt
+func (p *Parser) parseAlterTableStmt() (Node, error) {
+	p.consume() // Consume TABLE
+
+	tableName := ""
+
+	if p.peek(0).tokenT != IDENT_TOK {
+		return nil, errors.New("expected identifier")
+	}
+
+	tableName = p.peek(0).value.(string)
+
+	p.consume() // Consume table name
+
+	// ALTER COLUMN [identifier] [column_definition]
+	// ALTER COLUMN [identifier] ADD CHECK (search_condition) | ADD REFERENCES [identifier] ([identifier]) [NOT VALID]
+	// DROP COLUMN [identifier]
+	// COMPRESS | DECOMPRESS | RECOMPRESS
+	// SHARD BY [identifier]
+	// VALIDATE CONSTRAINT [identifier]
+	// WARM ON | WARM OFF
+
+	if p.peek(0).tokenT == IDENT_TOK && strings.ToUpper(p.peek(0).value.(string)) == "VALIDATE" {
+		p.consume() // Consume VALIDATE
+
+		if p.peek(0).tokenT != IDENT_TOK || strings.ToUpper(p.peek(0).value.(string)) != "CONSTRAINT" {
+			return nil, errors.New("expected CONSTRAINT")
+		}
+
+		p.consume() // Consume CONSTRAINT
+
+		if p.peek(0).tokenT != IDENT_TOK {
+			return nil, errors.New("expected identifier")
+		}
+
+		constraintName := p.peek(0).value.(string)
+
+		p.consume() // Consume constraint name
+
+		return &AlterTableStmt{
+			TableName: &Identifier{Value: tableName},
+			Validate:  &Identifier{Value: constraintName},
+		}, nil
+	}
+
+	if p.peek(0).tokenT == IDENT_TOK && strings.ToUpper(p.peek(0).value.(string)) == "WARM" {
+		p.consume() // Consume WARM
+
+		value, _ := p.peek(0).value.(string)
+
+		var warm bool
+		switch {
+		case p.peek(0).tokenT == KEYWORD_TOK && value == "ON":
+			warm = true
+		case p.peek(0).tokenT == IDENT_TOK && strings.ToUpper(value) == "OFF":
+			warm = false
+		default:
+			return nil, errors.New("expected ON or OFF")
+		}
+
+		p.consume() // Consume ON or OFF
+
+		return &AlterTableStmt{
+			TableName: &Identifier{Value: tableName},
+			Warm:      &warm,
+		}, nil
+	}
+
+	if p.peek(0).tokenT != KEYWORD_TOK {
+		return nil, errors.New("expected keyword")
+	}
+
+	switch p.peek(0).value {
+	case "SHARD":
+		p.consume() // Consume SHARD
+
+		if p.peek(0).value != "BY" {
+			return nil, errors.New("expected BY")
+		}
+
+		p.consume() // Consume BY
+
+		if p.peek(0).tokenT != IDENT_TOK {
+			return nil, errors.New("expected identifier")
+		}
+
+		columnName := p.peek(0).value.(string)
+
+		p.consume() // Consume column name
+
+		return &AlterTableStmt{
+			TableName: &Identifier{Value: tableName},
+			ShardKey:  &Identifier{Value: columnName},
+		}, nil
+	case "COMPRESS", "DECOMPRESS", "RECOMPRESS":
+		storage := map[string]AlterTableStorageType{
+			"COMPRESS":   ALTER_TABLE_COMPRESS,
+			"DECOMPRESS": ALTER_TABLE_DECOMPRESS,
+			"RECOMPRESS": ALTER_TABLE_RECOMPRESS,
+		}[p.peek(0).value.(string)]
+
+		p.consume() // Consume COMPRESS, DECOMPRESS or RECOMPRESS
+
+		return &AlterTableStmt{
+			TableName: &Identifier{Value: tableName},
+			Storage:   storage,
+		}, nil
+	case "DROP":
+		p.consume() // Consume DROP
+
+		if p.peek(0).tokenT != KEYWORD_TOK {
+			return nil, errors.New("expected keyword")
+		}
+
+		p.consume() // Consume COLUMN
+
+		if p.peek(0).tokenT != IDENT_TOK {
+			return nil, errors.New("expected identifier")
+		}
+
+		columnName := p.peek(0).value.(string)
+
+		p.consume()
+
+		return &AlterTableStmt{
+			TableName:  &Identifier{Value: tableName},
+			ColumnName: &Identifier{Value: columnName},
+		}, nil
+
+	case "ALTER":
+		p.consume() // Consume ALTER
+
+		if p.peek(0).tokenT != KEYWORD_TOK {
+			return nil, errors.New("expected keyword")
+		}
+
+		p.consume() // Consume COLUMN
+
+		dummyCreateTblStatement := &CreateTableStmt{
+			TableSchema: &catalog.TableSchema{
+				ColumnDefinitions: make(map[string]*catalog.ColumnDefinition),
+			},
+		}
+
+		if p.peek(0).tokenT != IDENT_TOK {
+
+			err := p.parseTableConstraints(dummyCreateTblStatement, "")
+			if err != nil {
+				return nil, err
+			}
+			break
+		}
+
+		columnName := p.peek(0).value.(string)
+
+		p.consume() // Consume column name
+
+		if p.peek(0).tokenT == IDENT_TOK && strings.ToUpper(p.peek(0).value.(string)) == "ADD" {
+			constraint, err := p.parseColumnConstraint(columnName)
+			if err != nil {
+				return nil, err
+			}
+
+			return &AlterTableStmt{
+				TableName:  &Identifier{Value: tableName},
+				ColumnName: &Identifier{Value: columnName},
+				Constraint: constraint,
+			}, nil
+		}
+
+		if p.peek(0).tokenT != DATATYPE_TOK {
+
+			return nil, errors.New("expected data type")
+		}
+
+		dataType := p.peek(0).value.(string)
+
+		dummyCreateTblStatement.TableSchema.ColumnDefinitions[columnName] = &catalog.ColumnDefinition{
+			DataType: dataType,
+		}
+
+		p.consume() // Consume data type
+
+		// check for DATATYPE(LEN) or DATATYPE(PRECISION, SCALE)
+		if p.peek(0).tokenT == LPAREN_TOK {
+			switch dataType {
+
+			case "CHAR", "CHARACTER", "BINARY":
+				p.consume() // Consume (
+
+				if p.peek(0).tokenT != LITERAL_TOK {
+
+					return nil, errors.New("expected literal")
+				}
+
+				length := p.peek(0).value.(uint64)
+
+				p.consume() // Consume literal
+
+				if p.peek(0).tokenT != RPAREN_TOK {
+					return nil, errors.New("expected )")
+				}
+
+				p.consume() // Consume )
+
+				dummyCreateTblStatement.TableSchema.ColumnDefinitions[columnName].Length = int(length)
+			case "DEC", "DECIMAL", "NUMERIC", "REAL", "FLOAT", "DOUBLE":
+
+				p.consume() // Consume (
+
+				if p.peek(0).tokenT != LITERAL_TOK {
+					return nil, errors.New("expected literal")
+				}
+
+				precision := p.peek(0).value.(uint64)
+
+				p.consume() // Consume literal
+
+				if p.peek(0).tokenT != COMMA_TOK {
+					return nil, errors.New("expected ,")
+				}
+
+				p.consume() // Consume ,
+
+				if p.peek(0).tokenT != LITERAL_TOK {
+					return nil, errors.New("expected literal")
+				}
+
+				scale := p.peek(0).value.(uint64)
+
+				p.consume() // Consume literal
+
+				if p.peek(0).tokenT != RPAREN_TOK {
+					return nil, errors.New("expected )")
+				}
+
+				p.consume() // Consume )
+
+				dummyCreateTblStatement.TableSchema.ColumnDefinitions[columnName].Precision = int(precision)
+				dummyCreateTblStatement.TableSchema.ColumnDefinitions[columnName].Scale = int(scale)
+
+			}
+		}
+
+		err := p.parseTableConstraints(dummyCreateTblStatement, columnName)
+		if err != nil {
+			return nil, err
+
+		}
+
+		return &AlterTableStmt{
+			TableName:        &Identifier{Value: tableName},
+			ColumnName:       &Identifier{Value: columnName},
+			ColumnDefinition: dummyCreateTblStatement.TableSchema.ColumnDefinitions[columnName],
+		}, nil
+
+	}
+
+	return nil, errors.New("expected ADD, DROP, SET, RENAME, or MODIFY")
+
+}
+
+// parseAlterUserStmt parses an ALTER USER statement
+func (p *Parser) parseAlterUserStmt() (Node, error) {
+	alterUserStmt := &AlterUserStmt{}
+	p.consume() // Consume USER
+
+	if p.peek(0).tokenT != IDENT_TOK {
+		return nil, errors.New("expected identifier")
+	}
+
+	alterUserStmt.Username = &Identifier{Value: p.peek(0).value.(string)}
+	p.consume() // Consume username
+
+	if p.peek(0).tokenT != KEYWORD_TOK {
+		return nil, errors.New("expected keyword")
+	}
+
+	switch p.peek(0).value {
+	case "SET":
+		p.consume() // Consume SET
+		switch p.peek(0).value {
+		case "PASSWORD":
+			alterUserStmt.SetType = ALTER_USER_SET_PASSWORD
+		case "USERNAME":
+			alterUserStmt.SetType = ALTER_USER_SET_USERNAME
+		default:
+			return nil, errors.New("expected PASSWORD or USERNAME")
+
+		}
+	default:
+		return nil, errors.New("expected SET")
+	}
+
+	p.consume() // Consume PASSWORD or USERNAME
+
+	if p.peek(0).tokenT != LITERAL_TOK {
+
+		return nil, errors.New("expected literal")
+	}
+
+	alterUserStmt.Value = &Literal{Value: strings.TrimSuffix(strings.TrimPrefix(p.peek(0).value.(string), "'"), "'")}
+
+	return alterUserStmt, nil
+}
+
+// parseShowStmt parses a SHOW statement
+func (p *Parser) parseShowStmt() (Node, error) {
+	p.consume() // Consume SHOW
+
+	switch strings.ToUpper(p.peek(0).value.(string)) {
+	case "DATABASES":
+		return &ShowStmt{ShowType: SHOW_DATABASES}, nil
+	case "TABLES":
+		return &ShowStmt{ShowType: SHOW_TABLES}, nil
+	case "USERS":
+		return &ShowStmt{ShowType: SHOW_USERS}, nil
+	case "INDEXES":
+		p.consume() // Consume INDEXES
+
+		if p.peek(0).tokenT != KEYWORD_TOK || p.peek(0).value != "FROM" {
+			return nil, errors.New("expected FROM")
+		}
+
+		p.consume() // Consume FROM
+
+		if p.peek(0).tokenT != IDENT_TOK {
+
+			return nil, errors.New("expected identifier")
+		}
+
+		tableName := p.peek(0).value.(string)
+
+		return &ShowStmt{ShowType: SHOW_INDEXES, From: &Identifier{
+			Value: tableName,
+		}}, nil
+	case "GRANTS":
+
+		p.consume() // Consume GRANTS
+
+		if p.peek(0).tokenT == KEYWORD_TOK && p.peek(0).value == "FOR" {
+			p.consume() // Consume ON
+
+			if p.peek(0).tokenT != IDENT_TOK {
+				return nil, errors.New("expected identifier")
+			}
+
+			tableName := p.peek(0).value.(string)
+			p.consume() // Consume username
+
+			return &ShowStmt{ShowType: SHOW_GRANTS, For: &Identifier{Value: tableName}}, nil
+		}
+
+		return &ShowStmt{ShowType: SHOW_GRANTS}, nil
+	case "IO":
+		return &ShowStmt{ShowType: SHOW_IO}, nil
+	case "ENGINE":
+		p.consume() // Consume ENGINE
+
+		if p.peek(0).tokenT != IDENT_TOK || strings.ToUpper(p.peek(0).value.(string)) != "STATUS" {
+			return nil, errors.New("expected STATUS")
+		}
+
+		return &ShowStmt{ShowType: SHOW_ENGINE_STATUS}, nil
+	case "PROCESSLIST":
+		return &ShowStmt{ShowType: SHOW_PROCESSLIST}, nil
+	case "MIGRATIONS":
+		return &ShowStmt{ShowType: SHOW_MIGRATIONS}, nil
+	case "INDEX":
+		p.consume() // Consume INDEX
+
+		if p.peek(0).tokenT != IDENT_TOK || strings.ToUpper(p.peek(0).value.(string)) != "ADVICE" {
+			return nil, errors.New("expected ADVICE")
+		}
+
+		return &ShowStmt{ShowType: SHOW_INDEX_ADVICE}, nil
+	case "PLAN":
+		p.consume() // Consume PLAN
+
+		if p.peek(0).tokenT != IDENT_TOK || strings.ToUpper(p.peek(0).value.(string)) != "CACHE" {
+			return nil, errors.New("expected CACHE")
+		}
+
+		p.consume() // Consume CACHE
+
+		if p.peek(0).tokenT == IDENT_TOK && strings.ToUpper(p.peek(0).value.(string)) == "STATUS" {
+			return &ShowStmt{ShowType: SHOW_PLAN_CACHE_STATUS}, nil
+		}
+
+		return &ShowStmt{ShowType: SHOW_PLAN_CACHE}, nil
+	case "OPTIMIZER":
+		p.consume() // Consume OPTIMIZER
+
+		if p.peek(0).tokenT != IDENT_TOK || strings.ToUpper(p.peek(0).value.(string)) != "TRACE" {
+			return nil, errors.New("expected TRACE")
+		}
+
+		return &ShowStmt{ShowType: SHOW_OPTIMIZER_TRACE}, nil
+	}
+
+	return nil, errors.New("expected DATABASES, TABLES, or USERS")
+
+}
+
+// parseRevokeStmt parses a REVOKE statement
+func (p *Parser) parseRevokeStmt() (Node, error) {
+	p.consume() // Consume REVOKE
+
+	if p.peek(0).tokenT != KEYWORD_TOK {
+		return nil, errors.New("expected keyword")
+	}
+
+	switch p.peek(0).value {
+	case "SELECT", "INSERT", "UPDATE", "DELETE", "ALL", "DROP", "CREATE", "CONNECT", "ALTER", "EXEC", "EXECUTE":
+		return p.parsePrivilegeStmt(true)
+	}
+
+	return nil, errors.New("expected SELECT, INSERT, UPDATE, DELETE")
+
+}
+
+// parseGrantStmt parses a GRANT statement
+func (p *Parser) parseGrantStmt() (Node, error) {
+
+	p.consume() // Consume GRANT
+
+	if p.peek(0).tokenT != KEYWORD_TOK {
+		return nil, errors.New("expected keyword")
+	}
+
+	switch p.peek(0).value {
+	case "SELECT", "INSERT", "UPDATE", "DELETE", "ALL", "DROP", "CREATE", "CONNECT", "ALTER", "EXEC", "EXECUTE":
+		return p.parsePrivilegeStmt(false)
+	}
+
+	return nil, errors.New("expected SELECT, INSERT, UPDATE, DELETE")
+
+}
+
+// parsePrivilegeStmt parses a privilege statement
+func (p *Parser) parsePrivilegeStmt(revoke bool) (Node, error) {
+	//  GRANT SELECT, INSERT, UPDATE, DELETE ON database.table TO user;
+
+	grantStmt := &GrantStmt{}
+	revokeStmt := &RevokeStmt{}
+
+	privilegeDefinition := &PrivilegeDefinition{
+		Actions: make([]shared.PrivilegeAction, 0),
+	}
+
+	all := false
+
+	for {
+		switch p.peek(0).value {
+		case "ALL":
+			privilegeDefinition.Actions = append(privilegeDefinition.Actions, shared.PRIV_ALL)
+			all = true
+		case "SELECT":
+			if !all {
+				privilegeDefinition.Actions = append(privilegeDefinition.Actions, shared.PRIV_SELECT)
+			}
+		case "BEGIN":
+			if !all {
+				privilegeDefinition.Actions = append(privilegeDefinition.Actions, shared.PRIV_BEGIN)
+			}
+		case "COMMIT":
+			if !all {
+				privilegeDefinition.Actions = append(privilegeDefinition.Actions, shared.PRIV_COMMIT)
+			}
+		case "ROLLBACK":
+			if !all {
+				privilegeDefinition.Actions = append(privilegeDefinition.Actions, shared.PRIV_ROLLBACK)
+			}
+		case "INSERT":
+			if !all {
+				privilegeDefinition.Actions = append(privilegeDefinition.Actions, shared.PRIV_INSERT)
+			}
+		case "UPDATE":
+			if !all {
+				privilegeDefinition.Actions = append(privilegeDefinition.Actions, shared.PRIV_UPDATE)
+			}
+		case "DELETE":
+			if !all {
+				privilegeDefinition.Actions = append(privilegeDefinition.Actions, shared.PRIV_DELETE)
+			}
+		case "DROP":
+			if !all {
+				privilegeDefinition.Actions = append(privilegeDefinition.Actions, shared.PRIV_DROP)
+			}
+		case "CREATE":
+			if !all {
+				privilegeDefinition.Actions = append(privilegeDefinition.Actions, shared.PRIV_CREATE)
+			}
+		case "CONNECT":
+			if !all {
+				privilegeDefinition.Actions = append(privilegeDefinition.Actions, shared.PRIV_CONNECT)
+			}
+		case "ALTER":
+			if !all {
+				privilegeDefinition.Actions = append(privilegeDefinition.Actions, shared.PRIV_ALTER)
+			}
+		case "REVOKE":
+			if !all {
+				privilegeDefinition.Actions = append(privilegeDefinition.Actions, shared.PRIV_REVOKE)
+			}
+		case "GRANT":
+			if !all {
+				privilegeDefinition.Actions = append(privilegeDefinition.Actions, shared.PRIV_GRANT)
+			}
+		case "SHOW":
+			if !all {
+				privilegeDefinition.Actions = append(privilegeDefinition.Actions, shared.PRIV_SHOW)
+			}
+		case "EXEC", "EXECUTE":
+			if !all {
+				privilegeDefinition.Actions = append(privilegeDefinition.Actions, shared.PRIV_EXEC)
+			}
+		case "EXPLAIN":
+			if !all {
+				privilegeDefinition.Actions = append(privilegeDefinition.Actions, shared.PRIV_EXPLAIN)
+			}
+		case "PRINT":
+			if !all {
+				privilegeDefinition.Actions = append(privilegeDefinition.Actions, shared.PRIV_PRINT)
+			}
+		case "DECLARE":
+			if !all {
+				privilegeDefinition.Actions = append(privilegeDefinition.Actions, shared.PRIV_DECLARE)
+			}
+		case "OPEN":
+			if !all {
+				privilegeDefinition.Actions = append(privilegeDefinition.Actions, shared.PRIV_OPEN)
+			}
+		case "CLOSE":
+			if !all {
+				privilegeDefinition.Actions = append(privilegeDefinition.Actions, shared.PRIV_CLOSE)
+			}
+		case "DEALLOCATE":
+			if !all {
+				privilegeDefinition.Actions = append(privilegeDefinition.Actions, shared.PRIV_DEALLOCATE)
+			}
+		case "FETCH":
+			if !all {
+				privilegeDefinition.Actions = append(privilegeDefinition.Actions, shared.PRIV_FETCH)
+			}
+		case "WHILE":
+			if !all {
+				privilegeDefinition.Actions = append(privilegeDefinition.Actions, shared.PRIV_WHILE)
+			}
+		case "RETURN":
+			if !all {
+				privilegeDefinition.Actions = append(privilegeDefinition.Actions, shared.PRIV_RETURN)
+			}
+		case "BREAK":
+			if !all {
+				privilegeDefinition.Actions = append(privilegeDefinition.Actions, shared.PRIV_BREAK)
+			}
+		case "SET":
+			if !all {
+				privilegeDefinition.Actions = append(privilegeDefinition.Actions, shared.PRIV_SET)
+			}
+		case "EXIT":
+			if !all {
+				privilegeDefinition.Actions = append(privilegeDefinition.Actions, shared.PRIV_EXIT)
+			}
+		default:
+			return nil, errors.New("expected privilege")
+		}
+
+		p.consume()
+
+		if p.peek(0).tokenT == COMMA_TOK {
+			p.consume()
+			continue
+		} else {
+			break
+		}
+
+	}
+
+	if p.peek(0).value != "TO" {
+
+		if p.peek(0).tokenT != KEYWORD_TOK || p.peek(0).value != "ON" {
+			return nil, errors.New("expected ON")
+		}
+
+		p.consume() // Consume ON
+
+		if p.peek(0).tokenT != IDENT_TOK {
+			if p.peek(0).value != "*" {
+				return nil, errors.New("expected identifier or * ")
+			}
+		}
+
+		db := &Identifier{}
+		table := &Identifier{}
+
+		// if asterisk is found, set database to *
+		if p.peek(0).value == "*" {
+			db = &Identifier{Value: "*"}
+			p.consume()
+
+			// check if next value is * or identifier
+			if p.peek(0).value == ".*" {
+				table = &Identifier{Value: "*"}
+			}
+			p.consume() // Consume table name
+			privilegeDefinition.Object = &Identifier{Value: db.Value + "." + table.Value}
+
+		} else {
+			if len(strings.Split(p.peek(0).value.(string), ".")) != 2 {
+				return nil, errors.New("expected database.table, *.*, or database.*")
+			}
+
+			db = &Identifier{Value: strings.Split(p.peek(0).value.(string), ".")[0]}
+			table = &Identifier{Value: strings.Split(p.peek(0).value.(string), ".")[1]}
+
+			privilegeDefinition.Object = &Identifier{Value: db.Value + "." + table.Value}
+
+			p.consume() // Consume table name
+
+		}
+
+		if p.peek(0).tokenT != KEYWORD_TOK || p.peek(0).value != "TO" {
+			return nil, errors.New("expected TO")
+		}
+	}
+
+	p.consume() // Consume TO
+
+	if p.peek(0).tokenT != IDENT_TOK {
+		return nil, errors.New("expected identifier")
+	}
+
+	user := p.peek(0).value.(string)
+
+	if revoke {
+		privilegeDefinition.Revokee = &Identifier{Value: user}
+		revokeStmt.PrivilegeDefinition = privilegeDefinition
+
+		return revokeStmt, nil
+
+	}
+	privilegeDefinition.Grantee = &Identifier{Value: user}
+	grantStmt.PrivilegeDefinition = privilegeDefinition
+
+	return grantStmt, nil
+
+}
+
+// parseBeginStmt parses a BEGIN statement
+func (p *Parser) parseBeginStmt() (Node, error) {
+	p.consume() // Consume BEGIN
+	return &BeginStmt{}, nil
+}
+
+// parseCommitStmt parses a COMMIT statement
+func (p *Parser) parseCommitStmt() (Node, error) {
+	p.consume() // Consume COMMIT
+	return &CommitStmt{}, nil
+}
+
+// parseRollbackStmt parses a ROLLBACK statement
+func (p *Parser) parseRollbackStmt() (Node, error) {
+	p.consume() // Consume ROLLBACK
+	return &RollbackStmt{}, nil
+
+}
+
+// parseDeleteStmt parses a DELETE statement
+func (p *Parser) parseDeleteStmt() (Node, error) {
+	p.consume() // Consume DELETE
+
+	if p.peek(0).tokenT != KEYWORD_TOK || p.peek(0).value != "FROM" {
+		return nil, errors.New("expected FROM")
+	}
+
+	p.consume() // Consume FROM
+
+	if p.peek(0).tokenT != IDENT_TOK {
+		return nil, errors.New("expected identifier")
+	}
+
+	tableName := p.peek(0).value.(string)
+	p.consume() // Consume table name
+
+	deleteStmt := &DeleteStmt{
+		TableName: &Identifier{Value: tableName},
+	}
+
+	if p.peek(0).tokenT == KEYWORD_TOK && p.peek(0).value == "WHERE" {
+		whereClause, err := p.parseWhereClause()
+		if err != nil {
+			return nil, err
+		}
+
+		deleteStmt.WhereClause = whereClause
+	}
+
+	return deleteStmt, nil
+
+}
+
+// parseUpdateStmt parses an UPDATE statement
+func (p *Parser) parseUpdateStmt() (Node, error) {
+	p.consume() // Consume UPDATE
+
+	if p.peek(0).tokenT != IDENT_TOK {
+		return nil, errors.New("expected identifier")
+	}
+
+	tableName := p.peek(0).value.(string)
+	p.consume() // Consume table name
+
+	if p.peek(0).tokenT != KEYWORD_TOK || p.peek(0).value != "SET" {
+		return nil, errors.New("expected SET")
+	}
+
+	p.consume() // Consume SET
+
+	updateStmt := &UpdateStmt{
+		TableName: &Identifier{Value: tableName},
+		SetClause: make([]*SetClause, 0),
+	}
+
+	for p.peek(0).value != "WHERE" {
+
+		if p.peek(0).tokenT != IDENT_TOK {
+			return nil, errors.New("expected identifier")
+		}
+
+		columnName := p.peek(0).value.(string)
+		p.consume() // Consume column name
+
+		if p.peek(0).tokenT != COMPARISON_TOK || p.peek(0).value != "=" {
+			return nil, errors.New("expected =")
+		}
+
+		p.consume() // Consume =
+
+		var literal interface{}
+
+		if p.peek(0).tokenT != LITERAL_TOK {
+			if p.peek(0).value == "SYS_DATE" {
+				literal = &shared.SysDate{}
+			} else if p.peek(0).value == "SYS_TIME" {
+				literal = &shared.SysTime{}
+			} else if p.peek(0).value == "GENERATE_UUID" {
+				literal = &shared.GenUUID{}
+			} else if p.peek(0).value == "UUID_V7" {
+				literal = &shared.GenUUIDv7{}
+			} else if p.peek(0).value == "SYS_TIMESTAMP" {
+				literal = &shared.SysTimestamp{}
+			} else if p.peek(1).tokenT == PLUS_TOK || p.peek(1).tokenT == MINUS_TOK || p.peek(1).tokenT == ASTERISK_TOK || p.peek(1).tokenT == DIVIDE_TOK {
+				// binary expression
+				binaryExpr, err := p.parseBinaryExpr(0)
+				if err != nil {
+					return nil, err
+				}
+
+				literal = binaryExpr
+
+				p.rewind(1)
+			} else if p.peek(0).tokenT == IDENT_TOK {
+				literal = &Identifier{Value: p.peek(0).value.(string)}
+			}
+		} else if p.peek(0).tokenT == LITERAL_TOK {
+			literal = p.peek(0).value
+		}
+
+		setClause := &SetClause{
+			Column: &Identifier{Value: columnName},
+			Value:  &Literal{Value: literal},
+		}
+
+		updateStmt.SetClause = append(updateStmt.SetClause, setClause)
+
+		p.consume()
+
+		if p.peek(0).tokenT == SEMICOLON_TOK {
+			break
+		} else if p.peek(0).tokenT != COMMA_TOK {
+			break
+		}
+
+	}
+
+	// Parse where
+	if p.peek(0).tokenT == KEYWORD_TOK || p.peek(0).value == "WHERE" {
+		whereClause, err := p.parseWhereClause()
+		if err != nil {
+			return nil, err
+		}
+
+		updateStmt.WhereClause = whereClause
+	}
+
+	return updateStmt, nil
+
+}
+
+// parseDropStmt parses a DROP statement
+func (p *Parser) parseDropStmt() (Node, error) {
+	p.consume() // Consume DROP
+
+	if p.isBloomFilter() {
+		return p.parseDropBloomFilterStmt()
+	}
+
+	if p.peek(0).tokenT != KEYWORD_TOK {
+		return nil, errors.New("expected keyword")
+	}
+
+	switch p.peek(0).value {
+	case "DATABASE":
+		return p.parseDropDatabaseStmt()
+	case "TABLE":
+		return p.parseDropTableStmt()
+	case "INDEX":
+		return p.parseDropIndexStmt()
+	case "USER":
+		return p.parseDropUserStmt()
+	case "PROCEDURE":
+		return p.parseDropProcedureStmt()
+	case "SHARD":
+		return p.parseDropShardStmt()
+	}
+
+	return nil, errors.New("expected DATABASE or TABLE")
+
+}
+
+// parseDropProcedureStmt parses a DROP PROCEDURE statement
+func (p *Parser) parseDropProcedureStmt() (Node, error) {
+	p.consume() // Consume PROCEDURE
+
+	if p.peek(0).tokenT != IDENT_TOK {
+		return nil, errors.New("expected identifier")
+	}
+
+	procedureName := p.peek(0).value.(string)
+	p.consume() // Consume procedure name
+
+	return &DropProcedureStmt{
+		ProcedureName: &Identifier{Value: procedureName},
+	}, nil
+
+}
+
+// parseDropShardStmt parses a DROP SHARD statement
+func (p *Parser) parseDropShardStmt() (Node, error) {
+	p.consume() // Consume SHARD
+
+	if p.peek(0).tokenT != IDENT_TOK {
+		return nil, errors.New("expected identifier")
+	}
+
+	name := p.peek(0).value.(string)
+	p.consume() // Consume shard name
+
+	return &DropShardStmt{
+		ShardName: &Identifier{Value: name},
+	}, nil
+
+}
+
+// parseDropUserStmt parses a DROP USER statement
+func (p *Parser) parseDropUserStmt() (Node, error) {
+	p.consume() // Consume USER
+
+	if p.peek(0).tokenT != IDENT_TOK {
+		return nil, errors.New("expected identifier")
+	}
+
+	user := p.peek(0).value.(string)
+	p.consume() // Consume user
+
+	return &DropUserStmt{
+		Username: &Identifier{Value: user},
+	}, nil
+
+}
+
+// parseDropTableStmt parses a DROP TABLE statement
+func (p *Parser) parseDropTableStmt() (Node, error) {
+	p.consume() // Consume TABLE
+
+	if p.peek(0).tokenT != IDENT_TOK {
+		return nil, errors.New("expected identifier")
+	}
+
+	tableName := p.peek(0).value.(string)
+	p.consume() // Consume identifier
+
+	return &DropTableStmt{
+		TableName: &Identifier{Value: tableName},
+	}, nil
+
+}
+
+// parseDropIndexStmt parses a DROP INDEX statement
+func (p *Parser) parseDropIndexStmt() (Node, error) {
+	p.consume() // Consume INDEX
+
+	if p.peek(0).tokenT != IDENT_TOK {
+		return nil, errors.New("expected identifier")
+	}
+
+	indexName := p.peek(0).value.(string)
+	p.consume() // Consume identifier
+
+	if p.peek(0).value != "ON" {
+		return nil, errors.New("expected ON")
+	}
+
+	p.consume() // Consume ON
+
+	if p.peek(0).tokenT != IDENT_TOK {
+		return nil, errors.New("expected identifier")
+	}
+
+	tableName := p.peek(0).value.(string)
+	p.consume() // Consume table name
+
+	return &DropIndexStmt{
+		TableName: &Identifier{Value: tableName},
+		IndexName: &Identifier{Value: indexName},
+	}, nil
+
+}
+
+// parseDropDatabaseStmt parses a DROP DATABASE statement
+func (p *Parser) parseDropDatabaseStmt() (Node, error) {
+	p.consume() // Consume DATABASE
+
+	if p.peek(0).tokenT != IDENT_TOK {
+		return nil, errors.New("expected identifier")
+	}
+
+	name := p.peek(0).value.(string)
+	p.consume() // Consume identifier
+
+	return &DropDatabaseStmt{
+		Name: &Identifier{Value: name},
+	}, nil
+}
+
+// parseInsertStmt parses an INSERT statement
+func (p *Parser) parseInsertStmt() (Node, error) {
+	// INSERT INTO schema_name.table_name (column_name1, column_name2, ...) VALUES (value1, value2, ...), (value1, value2, ...), ...
+
+	insertStmt := &InsertStmt{}
+
+	// Eat INSERT
+	p.consume()
+
+	if p.peek(0).value != "INTO" {
+		return nil, errors.New("expected INTO")
+	}
+
+	// Eat INTO
+	p.consume()
+
+	if p.peek(0).tokenT != IDENT_TOK {
+		return nil, errors.New("expected identifier")
+	}
+
+	tableName := p.peek(0).value.(string)
+
+	insertStmt.TableName = &Identifier{Value: tableName}
+	insertStmt.ColumnNames = make([]*Identifier, 0)
+	insertStmt.Values = make([][]interface{}, 0)
+
+	p.consume() // Consume schema_name.table_name
+
+	if p.peek(0).tokenT != LPAREN_TOK {
+		return nil, errors.New("expected (")
+	}
+
+	p.consume() // Consume (
+	for {
+		if p.peek(0).tokenT != IDENT_TOK {
+			return nil, errors.New("expected identifier")
+		}
+
+		columnName := p.peek(0).value.(string)
+		insertStmt.ColumnNames = append(insertStmt.ColumnNames, &Identifier{Value: columnName})
+
+		p.consume() // Consume column name
+
+		if p.peek(0).tokenT == RPAREN_TOK {
+			break
+		}
+
+		if p.peek(0).tokenT != COMMA_TOK {
+			return nil, errors.New("expected ,")
+		}
+
+		p.consume() // Consume ,
+
+	}
+
+	if p.peek(0).tokenT != RPAREN_TOK {
+		return nil, errors.New("expected )")
+	}
+
+	p.consume() // Consume )
+
+	// Look for VALUES
+
+	if p.peek(0).value != "VALUES" {
+		return nil, errors.New("expected VALUES")
+	}
+
+	p.consume() // Consume VALUES
+
+	if p.peek(0).tokenT != LPAREN_TOK {
+		return nil, errors.New("expected (")
+	}
+
+	for {
+		if p.peek(0).tokenT != LPAREN_TOK {
+			return nil, errors.New("expected (")
+		}
+
+		p.consume() // Consume (
+
+		values := make([]interface{}, 0)
+
+		for {
+			if p.peek(0).tokenT == RPAREN_TOK {
+				break
+			}
+
+			if p.peek(0).tokenT != LITERAL_TOK && p.peek(0).value != "NULL" && p.peek(0).value != "SYS_DATE" && p.peek(0).value != "SYS_TIME" && p.peek(0).value != "SYS_TIMESTAMP" && p.peek(0).value != "GENERATE_UUID" {
+
+				return nil, errors.New("expected literal or NULL")
+
+			}
+
+			if p.peek(0).value == "NULL" {
+				values = append(values, &Literal{Value: nil})
+			} else if p.peek(0).value == "SYS_DATE" {
+				values = append(values, &shared.SysDate{})
+			} else {
+				values = append(values, &Literal{Value: p.peek(0).value})
+			}
+
+			p.consume() // Consume literal
+
+			if p.peek(0).tokenT == RPAREN_TOK {
+				break
+			}
+
+			if p.peek(0).tokenT != COMMA_TOK {
+				return nil, errors.New("expected ,")
+			}
+
+			p.consume() // Consume ,
+		}
+
+		insertStmt.Values = append(insertStmt.Values, values)
+
+		if p.peek(0).tokenT != RPAREN_TOK {
+			return nil, errors.New("expected )")
+		}
+
+		p.consume() // Consume )
+
+		if p.peek(0).tokenT == SEMICOLON_TOK {
+			break
+		}
+
+		if p.peek(0).tokenT != COMMA_TOK {
+			return nil, errors.New("expected ,")
+		}
+
+		p.consume() // Consume ,
+	}
+
+	return insertStmt, nil
+}
+
+// parseCreateStmt parses a CREATE statement
+func (p *Parser) parseCreateStmt() (Node, error) {
+	p.consume() // Consume CREATE
+
+	if p.isBloomFilter() {
+		return p.parseCreateBloomFilterStmt()
+	}
+
+	if p.peek(0).tokenT != KEYWORD_TOK {
+		return nil, errors.New("expected keyword")
+	}
+
+	switch strings.ToUpper(p.peek(0).value.(string)) {
+	case "DATABASE":
+		return p.parseCreateDatabaseStmt()
+	case "INDEX", "UNIQUE":
+		if p.peek(1).value == "INDEX" {
+			// eat unique
+			p.consume()
+
+			ast, err := p.parseCreateIndexStmt()
+			if err != nil {
+				return nil, err
+			}
+
+			ast.(*CreateIndexStmt).Unique = true
+			return ast, nil
+		}
+		return p.parseCreateIndexStmt()
+	case "TABLE":
+		return p.parseCreateTableStmt()
+	case "USER":
+		return p.parseCreateUserStmt()
+	case "PROCEDURE":
+		return p.parseCreateProcedureStmt()
+	case "SHARD":
+		return p.parseCreateShardStmt()
+	}
+
+	return nil, errors.New("expected DATABASE or TABLE or INDEX")
+
+}
+
+// parseExecStmt parses an EXEC statement
+func (p *Parser) parseExecStmt() (Node, error) {
+	p.consume() // Consume EXEC
+
+	if p.peek(0).tokenT != IDENT_TOK {
+		return nil, errors.New("expected identifier")
+	}
+
+	procedureName := p.peek(0).value.(string)
+	p.consume() // Consume procedure name
+
+	if p.peek(0).tokenT != LPAREN_TOK {
+		return nil, errors.New("expected (")
+	}
+
+	p.consume() // Consume (
+
+	var args []interface{}
+
+	for {
+		if p.peek(0).tokenT == RPAREN_TOK {
+			break
+		}
+
+		if p.peek(0).tokenT != LITERAL_TOK && p.peek(0).value != "NULL" {
+			return nil, errors.New("expected literal or NULL")
+		}
+
+		if p.peek(0).value == "NULL" {
+			args = append(args, &Literal{Value: nil})
+		} else {
+			args = append(args, &Literal{Value: p.peek(0).value})
+		}
+
+		p.consume() // Consume literal
+
+		if p.peek(0).tokenT == RPAREN_TOK {
+			break
+		}
+
+		if p.peek(0).tokenT != COMMA_TOK {
+			return nil, errors.New("expected ,")
+		}
+
+		p.consume() // Consume ,
+	}
+
+	p.consume() // Consume )
+
+	return &ExecStmt{
+		ProcedureName: &Identifier{Value: procedureName},
+		Args:          args,
+	}, nil
+
+}
+
+// parseCreateProcedureStmt parses a CREATE PROCEDURE statement
+func (p *Parser) parseCreateProcedureStmt() (Node, error) {
+	p.consume() // Consume PROCEDURE
+
+	if p.peek(0).tokenT != IDENT_TOK {
+		return nil, errors.New("expected identifier")
+	}
+
+	name := p.peek(0).value.(string)
+
+	p.consume() // Consume name
+
+	if p.peek(0).tokenT != LPAREN_TOK {
+		return nil, errors.New("expected (")
+	}
+
+	p.consume() // Consume (
+
+	var params []*Parameter
+
+	for {
+		// @var1 INT, @var2 VARCHAR(255)
+		// if == )
+		if p.peek(0).tokenT == RPAREN_TOK {
+			break
+		}
+
+		// Check for @
+		if p.peek(0).value != "@" {
+
+			return nil, errors.New("expected @")
+		}
+
+		p.consume() // Consume @
+
+		if p.peek(0).tokenT != IDENT_TOK {
+			return nil, errors.New("expected identifier")
+		}
+
+		paramName := fmt.Sprintf("@%s", p.peek(0).value.(string))
+
+		p.consume() // Consume name
+
+		if p.peek(0).tokenT != DATATYPE_TOK {
+			return nil, errors.New("expected datatype")
+		}
+
+		dataType := p.peek(0).value.(string)
+
+		p.consume() // Consume data type
+
+		// Check for DATATYPE(LEN) or DATATYPE(PRECISION, SCALE)
+		if p.peek(0).tokenT == LPAREN_TOK {
+			switch dataType {
+			case "CHAR", "CHARACTER", "BINARY":
+				p.consume() // Consume (
+
+				if p.peek(0).tokenT != LITERAL_TOK {
+					return nil, errors.New("expected literal")
+				}
+
+				length := p.peek(0).value.(uint64)
+
+				p.consume() // Consume literal
+
+				if p.peek(0).tokenT != RPAREN_TOK {
+					return nil, errors.New("expected )")
+				}
+
+				p.consume() // Consume )
+
+				params = append(params, &Parameter{
+					Name:     &Identifier{Value: paramName},
+					DataType: &Identifier{Value: dataType},
+					Length:   &Literal{Value: length},
+				})
+			case "DEC", "DECIMAL", "NUMERIC", "REAL", "FLOAT", "DOUBLE":
+
+				p.consume() // Consume (
+
+				if p.peek(0).tokenT != LITERAL_TOK {
+					return nil, errors.New("expected literal")
+				}
+
+				precision := p.peek(0).value.(uint64)
+
+				p.consume() // Consume literal
+
+				if p.peek(0).tokenT != COMMA_TOK {
+					return nil, errors.New("expected ,")
+				}
+
+				p.consume() // Consume ,
+
+				if p.peek(0).tokenT != LITERAL_TOK {
+					return nil, errors.New("expected literal")
+				}
+
+				scale := p.peek(0).value.(uint64)
+
+				p.consume() // Consume literal
+
+				if p.peek(0).tokenT != RPAREN_TOK {
+					return nil, errors.New("expected )")
+				}
+
+				p.consume() // Consume )
+
+				params = append(params, &Parameter{
+					Name:      &Identifier{Value: paramName},
+					DataType:  &Identifier{Value: dataType},
+					Precision: &Literal{Value: precision},
+					Scale:     &Literal{Value: scale},
+				})
+			}
+		} else {
+			params = append(params, &Parameter{
+				Name:     &Identifier{Value: paramName},
+				DataType: &Identifier{Value: dataType},
+			})
+		}
+
+		if p.peek(0).tokenT == RPAREN_TOK {
+			break
+		}
+
+		if p.peek(0).tokenT != COMMA_TOK {
+			return nil, errors.New("expected ,")
+		}
+
+		p.consume() // Consume ,
+
+	}
+
+	if p.peek(0).tokenT != RPAREN_TOK {
+		return nil, errors.New("expected )")
+
+	}
+
+	p.consume() // Consume )
+
+	// SECURITY DEFINER runs the body with the privileges of the creator, SECURITY INVOKER (the default) with those of the caller
+	securityDefiner := false
+
+	if p.peek(0).tokenT == IDENT_TOK && strings.ToUpper(p.peek(0).value.(string)) == "SECURITY" {
+		p.consume() // Consume SECURITY
+
+		if p.peek(0).tokenT != IDENT_TOK {
+			return nil, errors.New("expected DEFINER or INVOKER")
+		}
+
+		switch strings.ToUpper(p.peek(0).value.(string)) {
+		case "DEFINER":
+			securityDefiner = true
+		case "INVOKER":
+		default:
+			return nil, errors.New("expected DEFINER or INVOKER")
+		}
+
+		p.consume() // Consume DEFINER or INVOKER
+	}
+
+	var block []interface{}
+
+	if p.peek(0).tokenT != KEYWORD_TOK || p.peek(0).value != "BEGIN" {
+		return nil, errors.New("expected BEGIN")
+	}
+
+	p.consume() // Consume BEGIN
+
+	// Parse statements
+	for p.peek(0).tokenT != KEYWORD_TOK || p.peek(0).value != "END" {
+		stmt, err := p.Parse()
+		if err != nil {
+			return nil, err
+		}
+
+		// A definer procedure must not change the database its names resolve in, nor run the caller's prepared statements
+		if securityDefiner {
+			switch stmt.(type) {
+			case *UseStmt, *PrepareStmt, *ExecutePreparedStmt, *DeallocatePrepareStmt:
+				return nil, errors.New("USE and prepared statements are not allowed in a SECURITY DEFINER procedure")
+			}
+		}
+
+		// Add statement to create procedure statement
+
+		block = append(block, stmt)
+
+		p.consume() // Consume ;
+	}
+
+	p.consume() // Consume END
+
+	return &CreateProcedureStmt{
+		Procedure: &Procedure{
+			Name:       &Identifier{Value: name},
+			Parameters: params,
+			Body: &BeginEndBlock{
+				Stmts: block,
+			},
+			SecurityDefiner: securityDefiner,
+		},
+	}, nil
+
+}
+
+// parseCreateShardStmt parses a CREATE SHARD statement
+func (p *Parser) parseCreateShardStmt() (Node, error) {
+	p.consume() // Consume SHARD
+
+	if p.peek(0).tokenT != IDENT_TOK {
+		return nil, errors.New("expected identifier")
+	}
+
+	name := p.peek(0).value.(string)
+	p.consume() // Consume shard name
+
+	if p.peek(0).value != "ON" {
+		return nil, errors.New("expected ON")
+	}
+
+	p.consume() // Consume ON
+
+	if p.peek(0).tokenT != LITERAL_TOK {
+		return nil, errors.New("expected literal")
+	}
 
-			p.consume() // Consume table name
+	address := p.peek(0).value.(string)
+	p.consume() // Consume address
 
-		}
+	return &CreateShardStmt{
+		ShardName: &Identifier{Value: name},
+		Address:   &Literal{Value: strings.TrimSuffix(strings.TrimPrefix(address, "'"), "'")},
+	}, nil
+}
 
-		if p.peek(0).tokenT != KEYWORD_TOK || p.peek(0).value != "TO" {
-			return nil, errors.New("expected TO")
-		}
-	}
+// parseCreateUserStmt
+func (p *Parser) parseCreateUserStmt() (Node, error) {
+	createUserStmt := &CreateUserStmt{}
 
-	p.consume() // Consume TO
+	// Eat USER
+	p.consume()
 
 	if p.peek(0).tokenT != IDENT_TOK {
 		return nil, errors.New("expected identifier")
 	}
 
-	user := p.peek(0).value.(string)
+	username := p.peek(0).value.(string)
+	createUserStmt.Username = &Identifier{Value: username}
 
-	if revoke {
-		privilegeDefinition.Revokee = &Identifier{Value: user}
-		revokeStmt.PrivilegeDefinition = privilegeDefinition
+	p.consume() // Consume username
 
-		return revokeStmt, nil
+	// Eat IDENTIFIED
+	if p.peek(0).value != "IDENTIFIED" {
+		return nil, errors.New("expected IDENTIFIED")
+	}
+
+	p.consume() // Consume IDENTIFIED
 
+	// Eat BY
+	if p.peek(0).value != "BY" {
+		return nil, errors.New("expected BY")
 	}
-	privilegeDefinition.Grantee = &Identifier{Value: user}
-	grantStmt.PrivilegeDefinition = privilegeDefinition
 
-	return grantStmt, nil
+	p.consume() // Consume BY
 
-}
+	if p.peek(0).tokenT != LITERAL_TOK {
+		return nil, errors.New("expected literal")
+	}
 
-// parseBeginStmt parses a BEGIN statement
-func (p *Parser) parseBeginStmt() (Node, error) {
-	p.consume() // Consume BEGIN
-	return &BeginStmt{}, nil
-}
+	password := p.peek(0).value.(string)
+	createUserStmt.Password = &Literal{Value: strings.TrimSuffix(strings.TrimPrefix(password, "'"), "'")}
 
-// parseCommitStmt parses a COMMIT statement
-func (p *Parser) parseCommitStmt() (Node, error) {
-	p.consume() // Consume COMMIT
-	return &CommitStmt{}, nil
-}
+	p.consume() // Consume password
 
-// parseRollbackStmt parses a ROLLBACK statement
-func (p *Parser) parseRollbackStmt() (Node, error) {
-	p.consume() // Consume ROLLBACK
-	return &RollbackStmt{}, nil
+	return createUserStmt, nil
 
 }
 
-// parseDeleteStmt parses a DELETE statement
-func (p *Parser) parseDeleteStmt() (Node, error) {
-	p.consume() // Consume DELETE
-
-	if p.peek(0).tokenT != KEYWORD_TOK || p.peek(0).value != "FROM" {
-		return nil, errors.New("expected FROM")
-	}
+// parseCreateTableStmt parses a CREATE TABLE statement
+func (p *Parser) parseCreateTableStmt() (Node, error) {
+	// CREATE TABLE schema_name.table_name (column_name1 data_type constraints, column_name2 data_type constraints, ...)
+	createTableStmt := &CreateTableStmt{}
 
-	p.consume() // Consume FROM
+	// Eat TABLE
+	p.consume()
 
 	if p.peek(0).tokenT != IDENT_TOK {
 		return nil, errors.New("expected identifier")
 	}
 
 	tableName := p.peek(0).value.(string)
-	p.consume() // Consume table name
 
-	deleteStmt := &DeleteStmt{
-		TableName: &Identifier{Value: tableName},
-	}
+	createTableStmt.TableName = &Identifier{Value: tableName}
 
-	if p.peek(0).tokenT == KEYWORD_TOK && p.peek(0).value == "WHERE" {
-		whereClause, err := p.parseWhereClause()
-		if err != nil {
-			return nil, err
-		}
+	p.consume() // Consume schema_name.table_name
 
-		deleteStmt.WhereClause = whereClause
+	createTableStmt.TableSchema = &catalog.TableSchema{
+		ColumnDefinitions: make(map[string]*catalog.ColumnDefinition),
 	}
 
-	return deleteStmt, nil
+	if p.peek(0).tokenT != LPAREN_TOK {
+		return nil, errors.New("expected (")
+	}
 
-}
+	p.consume() // Consume (
 
-// parseUpdateStmt parses an UPDATE statement
-func (p *Parser) parseUpdateStmt() (Node, error) {
-	p.consume() // Consume UPDATE
+	for p.peek(0).tokenT != SEMICOLON_TOK {
 
-	if p.peek(0).tokenT != IDENT_TOK {
-		return nil, errors.New("expected identifier")
-	}
+		// CREATE TABLE table_name (...) WITH (compress = false, ...) overrides the table defaults of the database
+		if p.peek(0).tokenT == KEYWORD_TOK && p.peek(0).value == "WITH" && p.peek(1).tokenT == LPAREN_TOK {
+			if createTableStmt.Settings != nil {
+				return nil, errors.New("settings are given twice")
+			}
 
-	tableName := p.peek(0).value.(string)
-	p.consume() // Consume table name
+			settings, err := p.parseSettings()
+			if err != nil {
+				return nil, err
+			}
 
-	if p.peek(0).tokenT != KEYWORD_TOK || p.peek(0).value != "SET" {
-		return nil, errors.New("expected SET")
-	}
+			createTableStmt.Settings = settings
 
-	p.consume() // Consume SET
+			continue
+		}
 
-	updateStmt := &UpdateStmt{
-		TableName: &Identifier{Value: tableName},
-		SetClause: make([]*SetClause, 0),
-	}
+		// CREATE TABLE table_name (...) WITH SYSTEM VERSIONING keeps every version of the rows
+		if p.peek(0).tokenT == KEYWORD_TOK && p.peek(0).value == "WITH" {
+			err := p.parseSystemVersioning(createTableStmt)
+			if err != nil {
+				return nil, err
+			}
 
-	for p.peek(0).value != "WHERE" {
+			continue
+		}
 
 		if p.peek(0).tokenT != IDENT_TOK {
-			return nil, errors.New("expected identifier")
+
+			err := p.parseTableConstraints(createTableStmt, "")
+			if err != nil {
+				return nil, err
+			}
+			break
 		}
 
 		columnName := p.peek(0).value.(string)
+
 		p.consume() // Consume column name
 
-		if p.peek(0).tokenT != COMPARISON_TOK || p.peek(0).value != "=" {
-			return nil, errors.New("expected =")
+		if p.peek(0).tokenT != DATATYPE_TOK {
+
+			return nil, errors.New("expected data type")
 		}
 
-		p.consume() // Consume =
+		dataType := p.peek(0).value.(string)
 
-		var literal interface{}
+		createTableStmt.TableSchema.ColumnDefinitions[columnName] = &catalog.ColumnDefinition{
+			DataType: dataType,
+		}
 
-		if p.peek(0).tokenT != LITERAL_TOK {
-			if p.peek(0).value == "SYS_DATE" {
-				literal = &shared.SysDate{}
-			} else if p.peek(0).value == "SYS_TIME" {
-				literal = &shared.SysTime{}
-			} else if p.peek(0).value == "GENERATE_UUID" {
-				literal = &shared.GenUUID{}
-			} else if p.peek(0).value == "SYS_TIMESTAMP" {
-				literal = &shared.SysTimestamp{}
-			} else if p.peek(1).tokenT == PLUS_TOK || p.peek(1).tokenT == MINUS_TOK || p.peek(1).tokenT == ASTERISK_TOK || p.peek(1).tokenT == DIVIDE_TOK {
-				// binary expression
-				binaryExpr, err := p.parseBinaryExpr(0)
-				if err != nil {
-					return nil, err
+		p.consume() // Consume data type
+
+		// check for DATATYPE(LEN) or DATATYPE(PRECISION, SCALE)
+		if p.peek(0).tokenT == LPAREN_TOK {
+			switch dataType {
+
+			case "CHAR", "CHARACTER", "BINARY":
+				p.consume() // Consume (
+
+				if p.peek(0).tokenT != LITERAL_TOK {
+
+					return nil, errors.New("expected literal")
 				}
 
-				literal = binaryExpr
+				length := p.peek(0).value.(uint64)
 
-				p.rewind(1)
-			} else if p.peek(0).tokenT == IDENT_TOK {
-				literal = &Identifier{Value: p.peek(0).value.(string)}
-			}
-		} else if p.peek(0).tokenT == LITERAL_TOK {
-			literal = p.peek(0).value
-		}
+				p.consume() // Consume literal
 
-		setClause := &SetClause{
-			Column: &Identifier{Value: columnName},
-			Value:  &Literal{Value: literal},
-		}
+				if p.peek(0).tokenT != RPAREN_TOK {
+					return nil, errors.New("expected )")
+				}
 
-		updateStmt.SetClause = append(updateStmt.SetClause, setClause)
+				p.consume() // Consume )
 
-		p.consume()
+				createTableStmt.TableSchema.ColumnDefinitions[columnName].Length = int(length)
+			case "DEC", "DECIMAL", "NUMERIC", "REAL", "FLOAT", "DOUBLE":
+
+				p.consume() // Consume (
+
+				if p.peek(0).tokenT != LITERAL_TOK {
+					return nil, errors.New("expected literal")
+				}
+
+				precision := p.peek(0).value.(uint64)
+
+				p.consume() // Consume literal
+
+				if p.peek(0).tokenT != COMMA_TOK {
+					return nil, errors.New("expected ,")
+				}
+
+				p.consume() // Consume ,
+
+				if p.peek(0).tokenT != LITERAL_TOK {
+					return nil, errors.New("expected literal")
+				}
+
+				scale := p.peek(0).value.(uint64)
+
+				p.consume() // Consume literal
+
+				if p.peek(0).tokenT != RPAREN_TOK {
+					return nil, errors.New("expected )")
+				}
+
+				p.consume() // Consume )
+
+				createTableStmt.TableSchema.ColumnDefinitions[columnName].Precision = int(precision)
+				createTableStmt.TableSchema.ColumnDefinitions[columnName].Scale = int(scale)
+
+			}
+		}
+
+		err := p.parseTableConstraints(createTableStmt, columnName)
+		if err != nil {
+			return nil, err
 
-		if p.peek(0).tokenT == SEMICOLON_TOK {
-			break
-		} else if p.peek(0).tokenT != COMMA_TOK {
-			break
 		}
 
 	}
 
-	// Parse where
-	if p.peek(0).tokenT == KEYWORD_TOK || p.peek(0).value == "WHERE" {
-		whereClause, err := p.parseWhereClause()
+	// Storage options end the column list, WITH SYSTEM VERSIONING follows them
+	if p.peek(0).tokenT == KEYWORD_TOK && p.peek(0).value == "WITH" {
+		err := p.parseSystemVersioning(createTableStmt)
 		if err != nil {
 			return nil, err
 		}
-
-		updateStmt.WhereClause = whereClause
 	}
 
-	return updateStmt, nil
+	p.consume() // Consume ,
 
+	return createTableStmt, nil
 }
 
-// parseDropStmt parses a DROP statement
-func (p *Parser) parseDropStmt() (Node, error) {
-	p.consume() // Consume DROP
+// parseSystemVersioning parses WITH SYSTEM VERSIONING of a CREATE TABLE statement
+func (p *Parser) parseSystemVersioning(createTableStmt *CreateTableStmt) error {
+	p.consume() // Consume WITH
 
-	if p.peek(0).tokenT != KEYWORD_TOK {
-		return nil, errors.New("expected keyword")
+	if p.peek(0).tokenT != IDENT_TOK || strings.ToUpper(p.peek(0).value.(string)) != "SYSTEM" {
+		return errors.New("expected SYSTEM")
 	}
-
-	switch p.peek(0).value {
-	case "DATABASE":
-		return p.parseDropDatabaseStmt()
-	case "TABLE":
-		return p.parseDropTableStmt()
-	case "INDEX":
-		return p.parseDropIndexStmt()
-	case "USER":
-		return p.parseDropUserStmt()
-	case "PROCEDURE":
-		return p.parseDropProcedureStmt()
+
+	p.consume() // Consume SYSTEM
+
+	if p.peek(0).tokenT != IDENT_TOK || strings.ToUpper(p.peek(0).value.(string)) != "VERSIONING" {
+		return errors.New("expected VERSIONING")
 	}
 
-	return nil, errors.New("expected DATABASE or TABLE")
+	p.consume() // Consume VERSIONING
+
+	createTableStmt.TableSchema.SystemVersioned = true
 
+	return nil
 }
 
-// parseDropProcedureStmt parses a DROP PROCEDURE statement
-func (p *Parser) parseDropProcedureStmt() (Node, error) {
-	p.consume() // Consume PROCEDURE
+func (p *Parser) parseTableConstraints(createTableStmt *CreateTableStmt, columnName string) error {
+	// Check for constraints
+	if p.peek(0).tokenT == KEYWORD_TOK {
+		for p.peek(0).tokenT == KEYWORD_TOK {
+			switch p.peek(0).value {
+			case "CHECK":
+				p.consume() // Consume CHECK
 
-	if p.peek(0).tokenT != IDENT_TOK {
-		return nil, errors.New("expected identifier")
-	}
+				if p.peek(0).tokenT != LPAREN_TOK {
+					return errors.New("expected (")
+				}
 
-	procedureName := p.peek(0).value.(string)
-	p.consume() // Consume procedure name
+				p.consume() // Consume (
 
-	return &DropProcedureStmt{
-		ProcedureName: &Identifier{Value: procedureName},
-	}, nil
+				searchCond, err := p.parseSearchCondition()
+				if err != nil {
+					return err
+				}
 
-}
+				createTableStmt.TableSchema.ColumnDefinitions[columnName].Check = searchCond
 
-// parseDropUserStmt parses a DROP USER statement
-func (p *Parser) parseDropUserStmt() (Node, error) {
-	p.consume() // Consume USER
+				if p.peek(0).tokenT != RPAREN_TOK {
+					return errors.New("expected )")
+				}
 
-	if p.peek(0).tokenT != IDENT_TOK {
-		return nil, errors.New("expected identifier")
-	}
+				p.consume() // Consume )
 
-	user := p.peek(0).value.(string)
-	p.consume() // Consume user
+			case "DEFAULT":
+				p.consume() // Consume DEFAULT
 
-	return &DropUserStmt{
-		Username: &Identifier{Value: user},
-	}, nil
+				if p.peek(0).tokenT != LITERAL_TOK && p.peek(0).tokenT != KEYWORD_TOK {
+					return errors.New("expected literal or keyword")
+				}
 
-}
+				defaultValue := p.peek(0).value
 
-// parseDropTableStmt parses a DROP TABLE statement
-func (p *Parser) parseDropTableStmt() (Node, error) {
-	p.consume() // Consume TABLE
+				if defaultValue == "SYS_DATE" {
+					createTableStmt.TableSchema.ColumnDefinitions[columnName].Default = &shared.SysDate{}
+				} else if defaultValue == "SYS_TIME" {
+					createTableStmt.TableSchema.ColumnDefinitions[columnName].Default = &shared.SysTime{}
+				} else if defaultValue == "SYS_TIMESTAMP" {
+					createTableStmt.TableSchema.ColumnDefinitions[columnName].Default = &shared.SysTimestamp{}
+				} else if defaultValue == "GENERATE_UUID" {
+					createTableStmt.TableSchema.ColumnDefinitions[columnName].Default = &shared.GenUUID{}
+				} else if defaultValue == "UUID_V7" {
+					createTableStmt.TableSchema.ColumnDefinitions[columnName].Default = &shared.GenUUIDv7{}
+				} else {
+					createTableStmt.TableSchema.ColumnDefinitions[columnName].Default = &Literal{Value: defaultValue}
+				}
 
-	if p.peek(0).tokenT != IDENT_TOK {
-		return nil, errors.New("expected identifier")
-	}
+				p.consume() // Consume literal or keyword
 
-	tableName := p.peek(0).value.(string)
-	p.consume() // Consume identifier
+			case "PRIMARY":
+				p.consume() // Consume PRIMARY
+				if p.peek(0).value != "KEY" {
+					return errors.New("expected KEY")
+				}
 
-	return &DropTableStmt{
-		TableName: &Identifier{Value: tableName},
-	}, nil
+				p.consume() // Consume KEY
+				// We set not null to true
+				// We set unique to true
+				// We set sequence to true
+				createTableStmt.TableSchema.ColumnDefinitions[columnName].NotNull = true
+				createTableStmt.TableSchema.ColumnDefinitions[columnName].Unique = true
+				createTableStmt.TableSchema.ColumnDefinitions[columnName].Sequence = true
+			case "FOREIGN":
+				p.consume() // Consume FOREIGN
+				// FOREIGN KEY (1) REFERENCES Departments(2)
+				// 1, 2 should be the same column identifier
+				if p.peek(0).value != "KEY" {
+					return errors.New("expected KEY")
+				}
 
-}
+				p.consume() // Consume KEY
 
-// parseDropIndexStmt parses a DROP INDEX statement
-func (p *Parser) parseDropIndexStmt() (Node, error) {
-	p.consume() // Consume INDEX
+				if p.peek(0).tokenT != LPAREN_TOK {
+					return errors.New("expected (")
+				}
 
-	if p.peek(0).tokenT != IDENT_TOK {
-		return nil, errors.New("expected identifier")
-	}
+				p.consume() // Consume (
 
-	indexName := p.peek(0).value.(string)
-	p.consume() // Consume identifier
+				refColumn := ""
 
-	if p.peek(0).value != "ON" {
-		return nil, errors.New("expected ON")
-	}
+				if p.peek(0).tokenT != IDENT_TOK {
+					return errors.New("expected identifier")
+				}
 
-	p.consume() // Consume ON
+				refColumn = p.peek(0).value.(string)
 
-	if p.peek(0).tokenT != IDENT_TOK {
-		return nil, errors.New("expected identifier")
-	}
+				p.consume() // Consume column name
 
-	tableName := p.peek(0).value.(string)
-	p.consume() // Consume table name
+				if p.peek(0).tokenT != RPAREN_TOK {
+					return errors.New("expected )")
+				}
 
-	return &DropIndexStmt{
-		TableName: &Identifier{Value: tableName},
-		IndexName: &Identifier{Value: indexName},
-	}, nil
+				p.consume() // Consume )
 
-}
+				// Check for REFERENCES keyword
+				if p.peek(0).value != "REFERENCES" {
+					return errors.New("expected REFERENCES")
+				}
 
-// parseDropDatabaseStmt parses a DROP DATABASE statement
-func (p *Parser) parseDropDatabaseStmt() (Node, error) {
-	p.consume() // Consume DATABASE
+				p.consume() // Consume REFERENCES
 
-	if p.peek(0).tokenT != IDENT_TOK {
-		return nil, errors.New("expected identifier")
-	}
+				if p.peek(0).tokenT != IDENT_TOK {
+					return errors.New("expected identifier")
+				}
 
-	name := p.peek(0).value.(string)
-	p.consume() // Consume identifier
+				refTable := p.peek(0).value.(string)
 
-	return &DropDatabaseStmt{
-		Name: &Identifier{Value: name},
-	}, nil
-}
+				p.consume() // Consume table name
 
-// parseInsertStmt parses an INSERT statement
-func (p *Parser) parseInsertStmt() (Node, error) {
-	// INSERT INTO schema_name.table_name (column_name1, column_name2, ...) VALUES (value1, value2, ...), (value1, value2, ...), ...
+				createTableStmt.TableSchema.ColumnDefinitions[refColumn].References = &catalog.Reference{
+					ColumnName: refColumn,
+					TableName:  refTable,
+				}
 
-	insertStmt := &InsertStmt{}
+				if p.peek(0).tokenT != LPAREN_TOK {
+					return errors.New("expected (")
+				}
 
-	// Eat INSERT
-	p.consume()
+				p.consume() // Consume (
 
-	if p.peek(0).value != "INTO" {
-		return nil, errors.New("expected INTO")
-	}
+				if p.peek(0).tokenT != IDENT_TOK {
+					return errors.New("expected identifier")
+				}
 
-	// Eat INTO
-	p.consume()
+				// Check if the column name is the same as the reference column name
+				if p.peek(0).value != refColumn {
+					return errors.New("expected column name to be the same as the reference column name")
+				}
 
-	if p.peek(0).tokenT != IDENT_TOK {
-		return nil, errors.New("expected identifier")
-	}
+			case "NOT":
+				p.consume() // Consume NOT
 
-	tableName := p.peek(0).value.(string)
+				if p.peek(0).value != "NULL" {
+					return errors.New("expected NULL")
+				}
 
-	insertStmt.TableName = &Identifier{Value: tableName}
-	insertStmt.ColumnNames = make([]*Identifier, 0)
-	insertStmt.Values = make([][]interface{}, 0)
+				p.consume() // Consume NULL
 
-	p.consume() // Consume schema_name.table_name
+				createTableStmt.TableSchema.ColumnDefinitions[columnName].NotNull = true
+			case "UNIQUE":
+				createTableStmt.TableSchema.ColumnDefinitions[columnName].Unique = true
 
-	if p.peek(0).tokenT != LPAREN_TOK {
-		return nil, errors.New("expected (")
-	}
+				p.consume() // Consume UNIQUE
+			case "SEQUENCE":
+				createTableStmt.TableSchema.ColumnDefinitions[columnName].Sequence = true
 
-	p.consume() // Consume (
-	for {
-		if p.peek(0).tokenT != IDENT_TOK {
-			return nil, errors.New("expected identifier")
-		}
+				p.consume() // Consume SEQUENCE
+			case "ENCRYPT":
+				createTableStmt.Encrypt = true
 
-		columnName := p.peek(0).value.(string)
-		insertStmt.ColumnNames = append(insertStmt.ColumnNames, &Identifier{Value: columnName})
+				p.consume() // Consume ENCRYPT
 
-		p.consume() // Consume column name
+				// look for (
+				if p.peek(0).tokenT != LPAREN_TOK {
+					return errors.New("expected (")
+				}
 
-		if p.peek(0).tokenT == RPAREN_TOK {
-			break
-		}
+				p.consume()
 
-		if p.peek(0).tokenT != COMMA_TOK {
-			return nil, errors.New("expected ,")
-		}
+				key, err := p.parseLiteral()
+				if err != nil {
+					return err
+				}
 
-		p.consume() // Consume ,
+				createTableStmt.EncryptKey = key.(*Literal)
 
-	}
+				// look for )
+				if p.peek(0).tokenT != RPAREN_TOK {
+					return errors.New("expected )")
+				}
 
-	if p.peek(0).tokenT != RPAREN_TOK {
-		return nil, errors.New("expected )")
+				p.consume() // Consume )
+			case "COMPRESS":
+				createTableStmt.Compress = true
+				p.consume() // Consume COMPRESS
+
+			default:
+				return errors.New("expected NOT NULL, UNIQUE, SEQUENCE, PRIMARY KEY, FOREIGN KEY, CHECK, DEFAULT, COMPRESS, ENCRYPT")
+			}
+
+		}
 	}
 
-	p.consume() // Consume )
+	p.consume()
+
+	return nil
 
-	// Look for VALUES
+}
 
-	if p.peek(0).value != "VALUES" {
-		return nil, errors.New("expected VALUES")
-	}
+// parseColumnConstraint parses a constraint added to a column of an existing table
+// ADD CHECK (search_condition) [NOT VALID]
+// ADD REFERENCES table_name (column_name) [NOT VALID], the referenced column has the name of the column
+func (p *Parser) parseColumnConstraint(columnName string) (*ColumnConstraint, error) {
+	p.consume() // Consume ADD
 
-	p.consume() // Consume VALUES
+	constraint := &ColumnConstraint{}
 
-	if p.peek(0).tokenT != LPAREN_TOK {
-		return nil, errors.New("expected (")
-	}
+	switch p.peek(0).value {
+	case "CHECK":
+		p.consume() // Consume CHECK
 
-	for {
 		if p.peek(0).tokenT != LPAREN_TOK {
 			return nil, errors.New("expected (")
 		}
 
 		p.consume() // Consume (
 
-		values := make([]interface{}, 0)
+		searchCond, err := p.parseSearchCondition()
+		if err != nil {
+			return nil, err
+		}
 
-		for {
-			if p.peek(0).tokenT == RPAREN_TOK {
-				break
-			}
+		constraint.Check = searchCond
 
-			if p.peek(0).tokenT != LITERAL_TOK && p.peek(0).value != "NULL" && p.peek(0).value != "SYS_DATE" && p.peek(0).value != "SYS_TIME" && p.peek(0).value != "SYS_TIMESTAMP" && p.peek(0).value != "GENERATE_UUID" {
+		if p.peek(0).tokenT != RPAREN_TOK {
+			return nil, errors.New("expected )")
+		}
 
-				return nil, errors.New("expected literal or NULL")
+		p.consume() // Consume )
+	case "REFERENCES":
+		p.consume() // Consume REFERENCES
 
-			}
+		if p.peek(0).tokenT != IDENT_TOK {
+			return nil, errors.New("expected identifier")
+		}
 
-			if p.peek(0).value == "NULL" {
-				values = append(values, &Literal{Value: nil})
-			} else if p.peek(0).value == "SYS_DATE" {
-				values = append(values, &shared.SysDate{})
-			} else {
-				values = append(values, &Literal{Value: p.peek(0).value})
-			}
+		constraint.References = &catalog.Reference{
+			TableName:  p.peek(0).value.(string),
+			ColumnName: columnName,
+		}
 
-			p.consume() // Consume literal
+		p.consume() // Consume table name
 
-			if p.peek(0).tokenT == RPAREN_TOK {
-				break
-			}
+		if p.peek(0).tokenT != LPAREN_TOK {
+			return nil, errors.New("expected (")
+		}
 
-			if p.peek(0).tokenT != COMMA_TOK {
-				return nil, errors.New("expected ,")
-			}
+		p.consume() // Consume (
 
-			p.consume() // Consume ,
+		if p.peek(0).tokenT != IDENT_TOK {
+			return nil, errors.New("expected identifier")
 		}
 
-		insertStmt.Values = append(insertStmt.Values, values)
+		// Check if the column name is the same as the reference column name
+		if p.peek(0).value != columnName {
+			return nil, errors.New("expected column name to be the same as the reference column name")
+		}
+
+		p.consume() // Consume column name
 
 		if p.peek(0).tokenT != RPAREN_TOK {
 			return nil, errors.New("expected )")
 		}
 
 		p.consume() // Consume )
+	default:
+		return nil, errors.New("expected CHECK or REFERENCES")
+	}
 
-		if p.peek(0).tokenT == SEMICOLON_TOK {
-			break
-		}
+	if p.peek(0).value == "NOT" {
+		p.consume() // Consume NOT
 
-		if p.peek(0).tokenT != COMMA_TOK {
-			return nil, errors.New("expected ,")
+		if p.peek(0).tokenT != IDENT_TOK || strings.ToUpper(p.peek(0).value.(string)) != "VALID" {
+			return nil, errors.New("expected VALID")
 		}
 
-		p.consume() // Consume ,
+		p.consume() // Consume VALID
+
+		constraint.NotValid = true
 	}
 
-	return insertStmt, nil
+	return constraint, nil
 }
 
-// parseCreateStmt parses a CREATE statement
-func (p *Parser) parseCreateStmt() (Node, error) {
-	p.consume() // Consume CREATE
-
-	if p.peek(0).tokenT != KEYWORD_TOK {
-		return nil, errors.New("expected keyword")
-	}
-
-	switch strings.ToUpper(p.peek(0).value.(string)) {
-	case "DATABASE":
-		return p.parseCreateDatabaseStmt()
-	case "INDEX", "UNIQUE":
-		if p.peek(1).value == "INDEX" {
-			// eat unique
-			p.consume()
+// parseCreateIndexStmt parses a CREATE INDEX statement
+func (p *Parser) parseCreateIndexStmt() (Node, error) {
+	createIndexStmt := &CreateIndexStmt{}
+	// CREATE INDEX index_name ON schema_name.table_name (column_name1, column_name2, ...)
+	// creating unique index
+	// CREATE UNIQUE INDEX index_name ON schema_name.table_name (column_name1, column_name2, ...)
 
-			ast, err := p.parseCreateIndexStmt()
-			if err != nil {
-				return nil, err
-			}
+	// Eat INDEX
+	p.consume()
 
-			ast.(*CreateIndexStmt).Unique = true
-			return ast, nil
-		}
-		return p.parseCreateIndexStmt()
-	case "TABLE":
-		return p.parseCreateTableStmt()
-	case "USER":
-		return p.parseCreateUserStmt()
-	case "PROCEDURE":
-		return p.parseCreateProcedureStmt()
+	if p.peek(0).tokenT != IDENT_TOK {
+		return nil, errors.New("expected identifier")
 	}
 
-	return nil, errors.New("expected DATABASE or TABLE or INDEX")
+	indexName := p.peek(0).value.(string)
+	p.consume() // Consume index name
 
-}
+	if p.peek(0).value != "ON" {
+		return nil, errors.New("expected ON")
+	}
 
-// parseExecStmt parses an EXEC statement
-func (p *Parser) parseExecStmt() (Node, error) {
-	p.consume() // Consume EXEC
+	p.consume() // Consume ON
 
 	if p.peek(0).tokenT != IDENT_TOK {
 		return nil, errors.New("expected identifier")
 	}
 
-	procedureName := p.peek(0).value.(string)
-	p.consume() // Consume procedure name
+	tableName := p.peek(0).value.(string)
+	p.consume() // Consume table name
 
 	if p.peek(0).tokenT != LPAREN_TOK {
 		return nil, errors.New("expected (")
+
 	}
 
 	p.consume() // Consume (
 
-	var args []interface{}
+	createIndexStmt.TableName = &Identifier{Value: tableName}
+	createIndexStmt.IndexName = &Identifier{Value: indexName}
+	createIndexStmt.ColumnNames = make([]*Identifier, 0)
 
 	for {
-		if p.peek(0).tokenT == RPAREN_TOK {
-			break
-		}
-
-		if p.peek(0).tokenT != LITERAL_TOK && p.peek(0).value != "NULL" {
-			return nil, errors.New("expected literal or NULL")
+		if p.peek(0).tokenT != IDENT_TOK {
+			return nil, errors.New("expected identifier")
 		}
 
-		if p.peek(0).value == "NULL" {
-			args = append(args, &Literal{Value: nil})
-		} else {
-			args = append(args, &Literal{Value: p.peek(0).value})
-		}
+		columnName := p.peek(0).value.(string)
+		createIndexStmt.ColumnNames = append(createIndexStmt.ColumnNames, &Identifier{Value: columnName})
 
-		p.consume() // Consume literal
+		p.consume() // Consume column name
 
 		if p.peek(0).tokenT == RPAREN_TOK {
 			break
@@ -1994,28 +4037,60 @@ func (p *Parser) parseExecStmt() (Node, error) {
 		}
 
 		p.consume() // Consume ,
+
+	}
+
+	if p.peek(0).tokenT != RPAREN_TOK {
+		return nil, errors.New("expected )")
 	}
 
 	p.consume() // Consume )
 
-	return &ExecStmt{
-		ProcedureName: &Identifier{Value: procedureName},
-		Args:          args,
-	}, nil
+	return createIndexStmt, nil
+}
 
+// isBloomFilter returns true if the next tokens are BLOOM FILTER
+func (p *Parser) isBloomFilter() bool {
+	return p.peek(0).tokenT == IDENT_TOK && strings.ToUpper(p.peek(0).value.(string)) == "BLOOM" &&
+		p.peek(1).tokenT == IDENT_TOK && strings.ToUpper(p.peek(1).value.(string)) == "FILTER"
 }
 
-// parseCreateProcedureStmt parses a CREATE PROCEDURE statement
-func (p *Parser) parseCreateProcedureStmt() (Node, error) {
-	p.consume() // Consume PROCEDURE
+// parseBloomFilterName parses BLOOM FILTER filter_name ON table_name
+func (p *Parser) parseBloomFilterName() (*Identifier, *Identifier, error) {
+	p.consume() // Consume BLOOM
+	p.consume() // Consume FILTER
 
 	if p.peek(0).tokenT != IDENT_TOK {
-		return nil, errors.New("expected identifier")
+		return nil, nil, errors.New("expected identifier")
 	}
 
-	name := p.peek(0).value.(string)
+	filterName := p.peek(0).value.(string)
+	p.consume() // Consume filter name
 
-	p.consume() // Consume name
+	if p.peek(0).value != "ON" {
+		return nil, nil, errors.New("expected ON")
+	}
+
+	p.consume() // Consume ON
+
+	if p.peek(0).tokenT != IDENT_TOK {
+		return nil, nil, errors.New("expected identifier")
+	}
+
+	tableName := p.peek(0).value.(string)
+	p.consume() // Consume table name
+
+	return &Identifier{Value: filterName}, &Identifier{Value: tableName}, nil
+}
+
+// parseCreateBloomFilterStmt parses a CREATE BLOOM FILTER statement
+func (p *Parser) parseCreateBloomFilterStmt() (Node, error) {
+	// CREATE BLOOM FILTER filter_name ON table_name (column_name)
+
+	filterName, tableName, err := p.parseBloomFilterName()
+	if err != nil {
+		return nil, err
+	}
 
 	if p.peek(0).tokenT != LPAREN_TOK {
 		return nil, errors.New("expected (")
@@ -2023,589 +4098,675 @@ func (p *Parser) parseCreateProcedureStmt() (Node, error) {
 
 	p.consume() // Consume (
 
-	var params []*Parameter
-
-	for {
-		// @var1 INT, @var2 VARCHAR(255)
-		// if == )
-		if p.peek(0).tokenT == RPAREN_TOK {
-			break
-		}
-
-		// Check for @
-		if p.peek(0).value != "@" {
+	if p.peek(0).tokenT != IDENT_TOK {
+		return nil, errors.New("expected identifier")
+	}
 
-			return nil, errors.New("expected @")
-		}
+	columnName := p.peek(0).value.(string)
+	p.consume() // Consume column name
 
-		p.consume() // Consume @
+	if p.peek(0).tokenT != RPAREN_TOK {
+		return nil, errors.New("expected ), a bloom filter is on a single column")
+	}
 
-		if p.peek(0).tokenT != IDENT_TOK {
-			return nil, errors.New("expected identifier")
-		}
+	p.consume() // Consume )
 
-		paramName := fmt.Sprintf("@%s", p.peek(0).value.(string))
+	return &CreateBloomFilterStmt{
+		TableName:  tableName,
+		FilterName: filterName,
+		ColumnName: &Identifier{Value: columnName},
+	}, nil
+}
 
-		p.consume() // Consume name
+// parseDropBloomFilterStmt parses a DROP BLOOM FILTER statement
+func (p *Parser) parseDropBloomFilterStmt() (Node, error) {
+	// DROP BLOOM FILTER filter_name ON table_name
 
-		if p.peek(0).tokenT != DATATYPE_TOK {
-			return nil, errors.New("expected datatype")
-		}
+	filterName, tableName, err := p.parseBloomFilterName()
+	if err != nil {
+		return nil, err
+	}
 
-		dataType := p.peek(0).value.(string)
+	return &DropBloomFilterStmt{
+		TableName:  tableName,
+		FilterName: filterName,
+	}, nil
+}
 
-		p.consume() // Consume data type
+// parseCreateDatabaseStmt parses a CREATE DATABASE statement
+func (p *Parser) parseCreateDatabaseStmt() (Node, error) {
+	p.consume() // Consume DATABASE
 
-		// Check for DATATYPE(LEN) or DATATYPE(PRECISION, SCALE)
-		if p.peek(0).tokenT == LPAREN_TOK {
-			switch dataType {
-			case "CHAR", "CHARACTER", "BINARY":
-				p.consume() // Consume (
+	if p.peek(0).tokenT != IDENT_TOK {
+		return nil, errors.New("expected identifier")
+	}
 
-				if p.peek(0).tokenT != LITERAL_TOK {
-					return nil, errors.New("expected literal")
-				}
+	name := p.peek(0).value.(string)
+	p.consume() // Consume identifier
 
-				length := p.peek(0).value.(uint64)
+	createDatabaseStmt := &CreateDatabaseStmt{
+		Name: &Identifier{Value: name},
+	}
 
-				p.consume() // Consume literal
+	// CREATE DATABASE name WITH (compress = true, ...) sets the defaults of the tables created in it
+	if p.peek(0).tokenT == KEYWORD_TOK && p.peek(0).value == "WITH" {
+		settings, err := p.parseSettings()
+		if err != nil {
+			return nil, err
+		}
 
-				if p.peek(0).tokenT != RPAREN_TOK {
-					return nil, errors.New("expected )")
-				}
+		createDatabaseStmt.Defaults = settings
+	}
 
-				p.consume() // Consume )
+	return createDatabaseStmt, nil
+}
 
-				params = append(params, &Parameter{
-					Name:     &Identifier{Value: paramName},
-					DataType: &Identifier{Value: dataType},
-					Length:   &Literal{Value: length},
-				})
-			case "DEC", "DECIMAL", "NUMERIC", "REAL", "FLOAT", "DOUBLE":
+// parseSettings parses a WITH (name = value, ...) clause
+func (p *Parser) parseSettings() (Settings, error) {
+	p.consume() // Consume WITH
 
-				p.consume() // Consume (
+	if p.peek(0).tokenT != LPAREN_TOK {
+		return nil, errors.New("expected (")
+	}
 
-				if p.peek(0).tokenT != LITERAL_TOK {
-					return nil, errors.New("expected literal")
-				}
+	p.consume() // Consume (
 
-				precision := p.peek(0).value.(uint64)
+	settings := make(Settings)
 
-				p.consume() // Consume literal
+	for {
+		// Setting names such as compress can be keywords
+		name, ok := p.peek(0).value.(string)
+		if (p.peek(0).tokenT != IDENT_TOK && p.peek(0).tokenT != KEYWORD_TOK) || !ok {
+			return nil, errors.New("expected setting name")
+		}
 
-				if p.peek(0).tokenT != COMMA_TOK {
-					return nil, errors.New("expected ,")
-				}
+		name = strings.ToLower(name)
 
-				p.consume() // Consume ,
+		p.consume() // Consume name
 
-				if p.peek(0).tokenT != LITERAL_TOK {
-					return nil, errors.New("expected literal")
-				}
+		if p.peek(0).tokenT != COMPARISON_TOK || p.peek(0).value != "=" {
+			return nil, errors.New("expected =")
+		}
 
-				scale := p.peek(0).value.(uint64)
+		p.consume() // Consume =
 
-				p.consume() // Consume literal
+		if p.peek(0).tokenT != LITERAL_TOK {
+			return nil, errors.New("expected setting value")
+		}
 
-				if p.peek(0).tokenT != RPAREN_TOK {
-					return nil, errors.New("expected )")
-				}
+		value := p.peek(0).value
+		if str, ok := value.(string); ok {
+			value = strings.Trim(str, "'\"")
+		}
 
-				p.consume() // Consume )
+		p.consume() // Consume value
 
-				params = append(params, &Parameter{
-					Name:      &Identifier{Value: paramName},
-					DataType:  &Identifier{Value: dataType},
-					Precision: &Literal{Value: precision},
-					Scale:     &Literal{Value: scale},
-				})
-			}
-		} else {
-			params = append(params, &Parameter{
-				Name:     &Identifier{Value: paramName},
-				DataType: &Identifier{Value: dataType},
-			})
+		if _, ok := settings[name]; ok {
+			return nil, fmt.Errorf("setting %s is given twice", name)
 		}
 
+		settings[name] = &Literal{Value: value}
+
 		if p.peek(0).tokenT == RPAREN_TOK {
-			break
+			p.consume() // Consume )
+			return settings, nil
 		}
 
 		if p.peek(0).tokenT != COMMA_TOK {
-			return nil, errors.New("expected ,")
+			return nil, errors.New("expected , or )")
 		}
 
 		p.consume() // Consume ,
-
 	}
+}
 
-	if p.peek(0).tokenT != RPAREN_TOK {
-		return nil, errors.New("expected )")
+// parseUseStmt parses a USE statement
+func (p *Parser) parseUseStmt() (Node, error) {
+	p.consume() // Consume USE
 
+	if p.peek(0).tokenT != IDENT_TOK {
+		return nil, errors.New("expected identifier")
 	}
 
-	p.consume() // Consume )
+	name := p.peek(0).value.(string)
+	p.consume() // Consume identifier
 
-	var block []interface{}
+	return &UseStmt{
+		DatabaseName: &Identifier{Value: name},
+	}, nil
 
-	if p.peek(0).tokenT != KEYWORD_TOK || p.peek(0).value != "BEGIN" {
-		return nil, errors.New("expected BEGIN")
+}
+
+// parseSelectStmt parses a SELECT statement
+func (p *Parser) parseSelectStmt() (Node, error) {
+
+	selectStmt := &SelectStmt{}
+
+	// Eat SELECT
+	p.consume()
+
+	// Check for DISTINCT
+	if p.peek(0).value == "DISTINCT" {
+		selectStmt.Distinct = true
+		p.consume()
 	}
 
-	p.consume() // Consume BEGIN
+	// Parse select list
+	err := p.parseSelectList(selectStmt)
+	if err != nil {
+		return nil, err
+	}
 
-	// Parse statements
-	for p.peek(0).tokenT != KEYWORD_TOK || p.peek(0).value != "END" {
-		stmt, err := p.Parse()
+	// Check for FROM
+	if p.peek(0).value == "FROM" {
+		tableExpr, err := p.parseTableExpression()
 		if err != nil {
 			return nil, err
-		}
 
-		// Add statement to create procedure statement
+		}
 
-		block = append(block, stmt)
+		selectStmt.TableExpression = tableExpr
 
-		p.consume() // Consume ;
 	}
 
-	p.consume() // Consume END
+	// Check for WHERE
+	if p.peek(0).value == "WHERE" {
 
-	return &CreateProcedureStmt{
-		Procedure: &Procedure{
-			Name:       &Identifier{Value: name},
-			Parameters: params,
-			Body: &BeginEndBlock{
-				Stmts: block,
-			},
-		},
-	}, nil
+		whereClause, err := p.parseWhereClause()
+		if err != nil {
+			return nil, err
+		}
 
-}
+		selectStmt.TableExpression.WhereClause = whereClause
 
-// parseCreateUserStmt
-func (p *Parser) parseCreateUserStmt() (Node, error) {
-	createUserStmt := &CreateUserStmt{}
+	}
 
-	// Eat USER
-	p.consume()
+	// Look for GROUP BY
+	if p.peek(0).value == "GROUP" {
+		if p.peek(1).value != "BY" {
+			return nil, errors.New("expected BY")
 
-	if p.peek(0).tokenT != IDENT_TOK {
-		return nil, errors.New("expected identifier")
+		} else {
+			p.consume()
+			p.consume()
+
+			groupByClause, err := p.parseGroupByClause()
+			if err != nil {
+				return nil, err
+			}
+
+			selectStmt.TableExpression.GroupByClause = groupByClause
+
+		}
 	}
 
-	username := p.peek(0).value.(string)
-	createUserStmt.Username = &Identifier{Value: username}
+	if p.peek(0).value == "HAVING" {
+		havingClause, err := p.parseHavingClause()
+		if err != nil {
+			return nil, err
+		}
 
-	p.consume() // Consume username
+		selectStmt.TableExpression.HavingClause = havingClause
 
-	// Eat IDENTIFIED
-	if p.peek(0).value != "IDENTIFIED" {
-		return nil, errors.New("expected IDENTIFIED")
 	}
 
-	p.consume() // Consume IDENTIFIED
+	// Look for ORDER BY
+	if p.peek(0).value == "ORDER" {
+		if p.peek(1).value != "BY" {
+			return nil, errors.New("expected BY")
+
+		} else {
+
+			orderByClause, err := p.parseOrderByClause()
+			if err != nil {
+				return nil, err
+			}
+
+			selectStmt.TableExpression.OrderByClause = orderByClause
+
+		}
 
-	// Eat BY
-	if p.peek(0).value != "BY" {
-		return nil, errors.New("expected BY")
 	}
 
-	p.consume() // Consume BY
+	if p.peek(0).value == "LIMIT" {
+		limitClause, err := p.parseLimitClause()
+		if err != nil {
+			return nil, err
+		}
 
-	if p.peek(0).tokenT != LITERAL_TOK {
-		return nil, errors.New("expected literal")
+		selectStmt.TableExpression.LimitClause = limitClause
 	}
 
-	password := p.peek(0).value.(string)
-	createUserStmt.Password = &Literal{Value: strings.TrimSuffix(strings.TrimPrefix(password, "'"), "'")}
+	// Look for union
+	if p.peek(0).value == "UNION" {
+		p.consume()
+		if p.peek(0).value == "ALL" {
+			selectStmt.UnionAll = true
+			p.consume()
+		}
 
-	p.consume() // Consume password
+		unionStmt, err := p.parseSelectStmt()
+		if err != nil {
+			return nil, err
+		}
 
-	return createUserStmt, nil
+		selectStmt.Union = unionStmt.(*SelectStmt)
+
+	}
+
+	return selectStmt, nil
 
 }
 
-// parseCreateTableStmt parses a CREATE TABLE statement
-func (p *Parser) parseCreateTableStmt() (Node, error) {
-	// CREATE TABLE schema_name.table_name (column_name1 data_type constraints, column_name2 data_type constraints, ...)
-	createTableStmt := &CreateTableStmt{}
+// parseWithStmt parses a SELECT statement preceded by a WITH clause
+// i.e WITH RECURSIVE name (column, ...) AS (SELECT ... UNION ALL SELECT ... FROM name ...), ... SELECT ... FROM name
+func (p *Parser) parseWithStmt() (Node, error) {
+	withClause := &WithClause{}
 
-	// Eat TABLE
-	p.consume()
+	p.consume() // Consume WITH
 
-	if p.peek(0).tokenT != IDENT_TOK {
-		return nil, errors.New("expected identifier")
+	if p.peek(0).tokenT == KEYWORD_TOK && p.peek(0).value == "RECURSIVE" {
+		withClause.Recursive = true
+		p.consume() // Consume RECURSIVE
 	}
 
-	tableName := p.peek(0).value.(string)
-
-	createTableStmt.TableName = &Identifier{Value: tableName}
+	for {
+		cte := &CommonTableExpression{}
 
-	p.consume() // Consume schema_name.table_name
+		name, err := p.parseIdentifier()
+		if err != nil {
+			return nil, err
+		}
 
-	createTableStmt.TableSchema = &catalog.TableSchema{
-		ColumnDefinitions: make(map[string]*catalog.ColumnDefinition),
-	}
+		cte.Name = name
 
-	if p.peek(0).tokenT != LPAREN_TOK {
-		return nil, errors.New("expected (")
-	}
+		// The columns of the query can be renamed, in order
+		if p.peek(0).tokenT == LPAREN_TOK {
+			p.consume() // Consume (
 
-	p.consume() // Consume (
+			for {
+				column, err := p.parseIdentifier()
+				if err != nil {
+					return nil, err
+				}
 
-	for p.peek(0).tokenT != SEMICOLON_TOK {
+				cte.Columns = append(cte.Columns, column)
 
-		if p.peek(0).tokenT != IDENT_TOK {
+				if p.peek(0).tokenT != COMMA_TOK {
+					break
+				}
 
-			err := p.parseTableConstraints(createTableStmt, "")
-			if err != nil {
-				return nil, err
+				p.consume() // Consume ,
 			}
-			break
-		}
-
-		columnName := p.peek(0).value.(string)
 
-		p.consume() // Consume column name
+			if p.peek(0).tokenT != RPAREN_TOK {
+				return nil, errors.New("expected )")
+			}
 
-		if p.peek(0).tokenT != DATATYPE_TOK {
+			p.consume() // Consume )
+		}
 
-			return nil, errors.New("expected data type")
+		if p.peek(0).tokenT != KEYWORD_TOK || p.peek(0).value != "AS" {
+			return nil, errors.New("expected AS")
 		}
 
-		dataType := p.peek(0).value.(string)
+		p.consume() // Consume AS
 
-		createTableStmt.TableSchema.ColumnDefinitions[columnName] = &catalog.ColumnDefinition{
-			DataType: dataType,
+		if p.peek(0).tokenT != LPAREN_TOK {
+			return nil, errors.New("expected (")
 		}
 
-		p.consume() // Consume data type
+		p.consume() // Consume (
 
-		// check for DATATYPE(LEN) or DATATYPE(PRECISION, SCALE)
-		if p.peek(0).tokenT == LPAREN_TOK {
-			switch dataType {
+		if p.peek(0).tokenT != KEYWORD_TOK || p.peek(0).value != "SELECT" {
+			return nil, errors.New("expected SELECT")
+		}
 
-			case "CHAR", "CHARACTER", "BINARY":
-				p.consume() // Consume (
+		query, err := p.parseSelectStmt()
+		if err != nil {
+			return nil, err
+		}
 
-				if p.peek(0).tokenT != LITERAL_TOK {
+		if p.peek(0).tokenT != RPAREN_TOK {
+			return nil, errors.New("expected )")
+		}
 
-					return nil, errors.New("expected literal")
-				}
+		p.consume() // Consume )
 
-				length := p.peek(0).value.(uint64)
+		cte.Query = query.(*SelectStmt)
+		withClause.CommonTableExpressions = append(withClause.CommonTableExpressions, cte)
 
-				p.consume() // Consume literal
+		if p.peek(0).tokenT != COMMA_TOK {
+			break
+		}
 
-				if p.peek(0).tokenT != RPAREN_TOK {
-					return nil, errors.New("expected )")
-				}
+		p.consume() // Consume ,
+	}
 
-				p.consume() // Consume )
+	if p.peek(0).tokenT != KEYWORD_TOK || p.peek(0).value != "SELECT" {
+		return nil, errors.New("expected SELECT")
+	}
 
-				createTableStmt.TableSchema.ColumnDefinitions[columnName].Length = int(length)
-			case "DEC", "DECIMAL", "NUMERIC", "REAL", "FLOAT", "DOUBLE":
+	stmt, err := p.parseSelectStmt()
+	if err != nil {
+		return nil, err
+	}
 
-				p.consume() // Consume (
+	stmt.(*SelectStmt).With = withClause
 
-				if p.peek(0).tokenT != LITERAL_TOK {
-					return nil, errors.New("expected literal")
-				}
+	return stmt, nil
+}
 
-				precision := p.peek(0).value.(uint64)
+// parseLimitClause parses a LIMIT clause
+func (p *Parser) parseLimitClause() (*LimitClause, error) {
+	limitClause := &LimitClause{}
 
-				p.consume() // Consume literal
+	// Eat LIMIT
+	p.consume()
 
-				if p.peek(0).tokenT != COMMA_TOK {
-					return nil, errors.New("expected ,")
-				}
+	if p.peek(0).tokenT != LITERAL_TOK {
+		return nil, errors.New("expected literal")
+	}
 
-				p.consume() // Consume ,
+	count := p.peek(0).value.(uint64)
 
-				if p.peek(0).tokenT != LITERAL_TOK {
-					return nil, errors.New("expected literal")
-				}
+	p.consume()
 
-				scale := p.peek(0).value.(uint64)
+	// check for offset
+	if p.peek(0).value == "OFFSET" {
+		p.consume()
 
-				p.consume() // Consume literal
+		if p.peek(0).tokenT != LITERAL_TOK {
+			return nil, errors.New("expected literal")
+		}
 
-				if p.peek(0).tokenT != RPAREN_TOK {
-					return nil, errors.New("expected )")
-				}
+		offset := p.peek(0).value.(uint64)
+		limitClause.Offset = &Literal{Value: offset}
 
-				p.consume() // Consume )
+		p.consume()
+	}
 
-				createTableStmt.TableSchema.ColumnDefinitions[columnName].Precision = int(precision)
-				createTableStmt.TableSchema.ColumnDefinitions[columnName].Scale = int(scale)
+	limitClause.Count = &Literal{Value: count}
 
-			}
-		}
+	return limitClause, nil
 
-		err := p.parseTableConstraints(createTableStmt, columnName)
-		if err != nil {
-			return nil, err
+}
 
-		}
+// parseOrderByClause parses an ORDER BY clause
+func (p *Parser) parseOrderByClause() (*OrderByClause, error) {
+	orderByClause := &OrderByClause{}
 
+	// Parse order by list
+	err := p.parseOrderByList(orderByClause)
+	if err != nil {
+		return nil, err
 	}
 
-	p.consume() // Consume ,
-
-	return createTableStmt, nil
+	return orderByClause, nil
 }
 
-func (p *Parser) parseTableConstraints(createTableStmt *CreateTableStmt, columnName string) error {
-	// Check for constraints
-	if p.peek(0).tokenT == KEYWORD_TOK {
-		for p.peek(0).tokenT == KEYWORD_TOK {
-			switch p.peek(0).value {
-			case "CHECK":
-				p.consume() // Consume CHECK
+// parseOrderByList parses an order by list
+func (p *Parser) parseOrderByList(orderByClause *OrderByClause) error {
+	p.consume() // Consume ORDER
 
-				if p.peek(0).tokenT != LPAREN_TOK {
-					return errors.New("expected (")
-				}
+	if p.peek(0).value != "BY" {
+		return errors.New("expected BY")
+	}
 
-				p.consume() // Consume (
+	p.consume() // Consume BY
 
-				searchCond, err := p.parseSearchCondition()
-				if err != nil {
-					return err
-				}
+	for p.peek(0).tokenT != EOF_TOK || p.peek(0).value != "ROWS" || p.peek(0).value == "RANGE" || p.peek(0).tokenT != RPAREN_TOK {
 
-				createTableStmt.TableSchema.ColumnDefinitions[columnName].Check = searchCond
+		// Parse order by expression
+		expr, err := p.parseValueExpression()
+		if err != nil {
+			return err
+		}
 
-				if p.peek(0).tokenT != RPAREN_TOK {
-					return errors.New("expected )")
-				}
+		err = p.parseCollation(expr)
+		if err != nil {
+			return err
+		}
 
-				p.consume() // Consume )
+		orderByClause.OrderByExpressions = append(orderByClause.OrderByExpressions, expr)
 
-			case "DEFAULT":
-				p.consume() // Consume DEFAULT
+		// Look for ,
+		if p.peek(0).value == "," {
+			p.consume() // Consume ,
 
-				if p.peek(0).tokenT != LITERAL_TOK && p.peek(0).tokenT != KEYWORD_TOK {
-					return errors.New("expected literal or keyword")
-				}
+			continue
+		}
 
-				defaultValue := p.peek(0).value
+		break
 
-				if defaultValue == "SYS_DATE" {
-					createTableStmt.TableSchema.ColumnDefinitions[columnName].Default = &shared.SysDate{}
-				} else if defaultValue == "SYS_TIME" {
-					createTableStmt.TableSchema.ColumnDefinitions[columnName].Default = &shared.SysTime{}
-				} else if defaultValue == "SYS_TIMESTAMP" {
-					createTableStmt.TableSchema.ColumnDefinitions[columnName].Default = &shared.SysTimestamp{}
-				} else if defaultValue == "GENERATE_UUID" {
-					createTableStmt.TableSchema.ColumnDefinitions[columnName].Default = &shared.GenUUID{}
-				} else {
-					createTableStmt.TableSchema.ColumnDefinitions[columnName].Default = &Literal{Value: defaultValue}
-				}
+	}
 
-				p.consume() // Consume literal or keyword
+	if p.peek(0).value == "ASC" {
+		orderByClause.Order = ASC
+		p.consume()
 
-			case "PRIMARY":
-				p.consume() // Consume PRIMARY
-				if p.peek(0).value != "KEY" {
-					return errors.New("expected KEY")
-				}
+	} else if p.peek(0).value == "DESC" {
+		orderByClause.Order = DESC
+		p.consume()
+	} else {
+		orderByClause.Order = ASC
 
-				p.consume() // Consume KEY
-				// We set not null to true
-				// We set unique to true
-				// We set sequence to true
-				createTableStmt.TableSchema.ColumnDefinitions[columnName].NotNull = true
-				createTableStmt.TableSchema.ColumnDefinitions[columnName].Unique = true
-				createTableStmt.TableSchema.ColumnDefinitions[columnName].Sequence = true
-			case "FOREIGN":
-				p.consume() // Consume FOREIGN
-				// FOREIGN KEY (1) REFERENCES Departments(2)
-				// 1, 2 should be the same column identifier
-				if p.peek(0).value != "KEY" {
-					return errors.New("expected KEY")
-				}
+	}
 
-				p.consume() // Consume KEY
+	return nil
 
-				if p.peek(0).tokenT != LPAREN_TOK {
-					return errors.New("expected (")
-				}
+}
 
-				p.consume() // Consume (
+// parseGroupByClause
+func (p *Parser) parseGroupByClause() (*GroupByClause, error) {
 
-				refColumn := ""
+	groupByClause := &GroupByClause{}
 
-				if p.peek(0).tokenT != IDENT_TOK {
-					return errors.New("expected identifier")
-				}
+	// Parse group by list
+	err := p.parseGroupByList(groupByClause)
+	if err != nil {
+		return nil, err
+	}
 
-				refColumn = p.peek(0).value.(string)
+	return groupByClause, nil
+}
 
-				p.consume() // Consume column name
+// parseGroupByList parses a group by list
+// A list with GROUPING SETS, ROLLUP or CUBE groups by every combination of the sets of its elements, GROUP BY a, ROLLUP(b) groups by (a, b) and (a)
+func (p *Parser) parseGroupByList(groupByClause *GroupByClause) error {
+	sets := [][]*ValueExpression{{}}
+	groupingSets := false
 
-				if p.peek(0).tokenT != RPAREN_TOK {
-					return errors.New("expected )")
-				}
+	for {
+		var elementSets [][]*ValueExpression
 
-				p.consume() // Consume )
+		switch {
+		case p.peek(0).tokenT == KEYWORD_TOK && (p.peek(0).value == "ROLLUP" || p.peek(0).value == "CUBE"):
+			cube := p.peek(0).value == "CUBE"
+			p.consume() // Consume ROLLUP or CUBE
 
-				// Check for REFERENCES keyword
-				if p.peek(0).value != "REFERENCES" {
-					return errors.New("expected REFERENCES")
-				}
+			columns, err := p.parseGroupingColumns()
+			if err != nil {
+				return err
+			}
 
-				p.consume() // Consume REFERENCES
+			if len(columns) == 0 {
+				return errors.New("expected column")
+			}
 
-				if p.peek(0).tokenT != IDENT_TOK {
-					return errors.New("expected identifier")
-				}
+			if cube {
+				// Every subset of the columns, from all of them to none
+				for mask := 1<<len(columns) - 1; mask >= 0; mask-- {
+					var set []*ValueExpression
+					for i, column := range columns {
+						if mask&(1<<(len(columns)-1-i)) != 0 {
+							set = append(set, column)
+						}
+					}
 
-				refTable := p.peek(0).value.(string)
+					elementSets = append(elementSets, set)
+				}
+			} else {
+				// The columns, then without the last column until none are left
+				for i := len(columns); i >= 0; i-- {
+					elementSets = append(elementSets, columns[:i])
+				}
+			}
 
-				p.consume() // Consume table name
+			groupingSets = true
+		case p.peek(0).tokenT == KEYWORD_TOK && p.peek(0).value == "GROUPING" && p.peek(1).tokenT == KEYWORD_TOK && p.peek(1).value == "SETS":
+			p.consume() // Consume GROUPING
+			p.consume() // Consume SETS
 
-				createTableStmt.TableSchema.ColumnDefinitions[refColumn].References = &catalog.Reference{
-					ColumnName: refColumn,
-					TableName:  refTable,
-				}
+			if p.peek(0).tokenT != LPAREN_TOK {
+				return errors.New("expected (")
+			}
 
-				if p.peek(0).tokenT != LPAREN_TOK {
-					return errors.New("expected (")
-				}
+			p.consume() // Consume (
 
-				p.consume() // Consume (
+			for {
+				// A set is a column or a list of columns, () groups every row together
+				if p.peek(0).tokenT == LPAREN_TOK {
+					columns, err := p.parseGroupingColumns()
+					if err != nil {
+						return err
+					}
 
-				if p.peek(0).tokenT != IDENT_TOK {
-					return errors.New("expected identifier")
-				}
+					elementSets = append(elementSets, columns)
+				} else {
+					column, err := p.parseColumnSpecification()
+					if err != nil {
+						return err
+					}
 
-				// Check if the column name is the same as the reference column name
-				if p.peek(0).value != refColumn {
-					return errors.New("expected column name to be the same as the reference column name")
+					elementSets = append(elementSets, []*ValueExpression{{Value: column}})
 				}
 
-			case "NOT":
-				p.consume() // Consume NOT
-
-				if p.peek(0).value != "NULL" {
-					return errors.New("expected NULL")
+				if p.peek(0).tokenT != COMMA_TOK {
+					break
 				}
 
-				p.consume() // Consume NULL
+				p.consume() // Consume ,
+			}
 
-				createTableStmt.TableSchema.ColumnDefinitions[columnName].NotNull = true
-			case "UNIQUE":
-				createTableStmt.TableSchema.ColumnDefinitions[columnName].Unique = true
+			if p.peek(0).tokenT != RPAREN_TOK {
+				return errors.New("expected )")
+			}
 
-				p.consume() // Consume UNIQUE
-			case "SEQUENCE":
-				createTableStmt.TableSchema.ColumnDefinitions[columnName].Sequence = true
+			p.consume() // Consume )
 
-				p.consume() // Consume SEQUENCE
-			case "ENCRYPT":
-				createTableStmt.Encrypt = true
+			groupingSets = true
+		default:
+			// Parse group by expression
+			expr, err := p.parseValueExpression()
+			if err != nil {
+				return err
+			}
 
-				p.consume() // Consume ENCRYPT
+			elementSets = [][]*ValueExpression{{expr}}
+		}
 
-				// look for (
-				if p.peek(0).tokenT != LPAREN_TOK {
-					return errors.New("expected (")
-				}
+		// Every set so far is combined with every set of the element
+		var combined [][]*ValueExpression
+		for _, set := range sets {
+			for _, elementSet := range elementSets {
+				combined = append(combined, append(append([]*ValueExpression{}, set...), elementSet...))
+			}
+		}
 
-				p.consume()
+		sets = combined
 
-				key, err := p.parseLiteral()
-				if err != nil {
-					return err
-				}
+		// Look for ,
+		if p.peek(0).tokenT != COMMA_TOK {
+			break
+		}
 
-				createTableStmt.EncryptKey = key.(*Literal)
+		p.consume() // Consume ,
+	}
 
-				// look for )
-				if p.peek(0).tokenT != RPAREN_TOK {
-					return errors.New("expected )")
-				}
+	// The group by expressions are every column grouped by, in order
+	grouped := make(map[string]bool)
 
-				p.consume() // Consume )
-			case "COMPRESS":
-				createTableStmt.Compress = true
-				p.consume() // Consume COMPRESS
+	for _, set := range sets {
+		for _, expr := range set {
+			if col, ok := expr.Value.(*ColumnSpecification); ok {
+				if grouped[col.ColumnName.Value] {
+					continue
+				}
 
-			default:
-				return errors.New("expected NOT NULL, UNIQUE, SEQUENCE, PRIMARY KEY, FOREIGN KEY, CHECK, DEFAULT, COMPRESS, ENCRYPT")
+				grouped[col.ColumnName.Value] = true
 			}
 
+			groupByClause.GroupByExpressions = append(groupByClause.GroupByExpressions, expr)
 		}
 	}
 
-	p.consume()
+	if groupingSets {
+		groupByClause.GroupingSets = sets
+	}
 
 	return nil
-
 }
 
-// parseCreateIndexStmt parses a CREATE INDEX statement
-func (p *Parser) parseCreateIndexStmt() (Node, error) {
-	createIndexStmt := &CreateIndexStmt{}
-	// CREATE INDEX index_name ON schema_name.table_name (column_name1, column_name2, ...)
-	// creating unique index
-	// CREATE UNIQUE INDEX index_name ON schema_name.table_name (column_name1, column_name2, ...)
+// parseGroupingColumns parses the parenthesized columns of a grouping set, ROLLUP or CUBE
+func (p *Parser) parseGroupingColumns() ([]*ValueExpression, error) {
+	if p.peek(0).tokenT != LPAREN_TOK {
+		return nil, errors.New("expected (")
+	}
 
-	// Eat INDEX
-	p.consume()
+	p.consume() // Consume (
 
-	if p.peek(0).tokenT != IDENT_TOK {
-		return nil, errors.New("expected identifier")
-	}
+	var columns []*ValueExpression
 
-	indexName := p.peek(0).value.(string)
-	p.consume() // Consume index name
+	for p.peek(0).tokenT != RPAREN_TOK {
+		column, err := p.parseColumnSpecification()
+		if err != nil {
+			return nil, err
+		}
 
-	if p.peek(0).value != "ON" {
-		return nil, errors.New("expected ON")
-	}
+		columns = append(columns, &ValueExpression{Value: column})
 
-	p.consume() // Consume ON
+		if p.peek(0).tokenT != COMMA_TOK {
+			break
+		}
 
-	if p.peek(0).tokenT != IDENT_TOK {
-		return nil, errors.New("expected identifier")
+		p.consume() // Consume ,
 	}
 
-	tableName := p.peek(0).value.(string)
-	p.consume() // Consume table name
+	if p.peek(0).tokenT != RPAREN_TOK {
+		return nil, errors.New("expected )")
+	}
+
+	p.consume() // Consume )
+
+	return columns, nil
+}
+
+// parseGroupingFunc parses a GROUPING function
+func (p *Parser) parseGroupingFunc() (*GroupingFunc, error) {
+	p.consume() // Consume GROUPING
 
 	if p.peek(0).tokenT != LPAREN_TOK {
 		return nil, errors.New("expected (")
-
 	}
 
 	p.consume() // Consume (
 
-	createIndexStmt.TableName = &Identifier{Value: tableName}
-	createIndexStmt.IndexName = &Identifier{Value: indexName}
-	createIndexStmt.ColumnNames = make([]*Identifier, 0)
+	groupingFunc := &GroupingFunc{}
 
 	for {
-		if p.peek(0).tokenT != IDENT_TOK {
-			return nil, errors.New("expected identifier")
+		column, err := p.parseColumnSpecification()
+		if err != nil {
+			return nil, err
 		}
 
-		columnName := p.peek(0).value.(string)
-		createIndexStmt.ColumnNames = append(createIndexStmt.ColumnNames, &Identifier{Value: columnName})
-
-		p.consume() // Consume column name
-
-		if p.peek(0).tokenT == RPAREN_TOK {
-			break
-		}
+		groupingFunc.Args = append(groupingFunc.Args, column)
 
 		if p.peek(0).tokenT != COMMA_TOK {
-			return nil, errors.New("expected ,")
+			break
 		}
 
 		p.consume() // Consume ,
-
 	}
 
 	if p.peek(0).tokenT != RPAREN_TOK {
@@ -2614,870 +4775,941 @@ func (p *Parser) parseCreateIndexStmt() (Node, error) {
 
 	p.consume() // Consume )
 
-	return createIndexStmt, nil
+	return groupingFunc, nil
 }
 
-// parseCreateDatabaseStmt parses a CREATE DATABASE statement
-func (p *Parser) parseCreateDatabaseStmt() (Node, error) {
-	p.consume() // Consume DATABASE
+// parseWhereClause parses a WHERE clause
+func (p *Parser) parseWhereClause() (*WhereClause, error) {
+	whereClause := &WhereClause{}
 
-	if p.peek(0).tokenT != IDENT_TOK {
-		return nil, errors.New("expected identifier")
+	// Eat WHERE
+	p.consume()
+
+	// Parse search condition
+	searchCondition, err := p.parseSearchCondition()
+	if err != nil {
+		return nil, err
 	}
 
-	name := p.peek(0).value.(string)
-	p.consume() // Consume identifier
+	whereClause.SearchCondition = searchCondition
+
+	return whereClause, nil
 
-	return &CreateDatabaseStmt{
-		Name: &Identifier{Value: name},
-	}, nil
 }
 
-// parseUseStmt parses a USE statement
-func (p *Parser) parseUseStmt() (Node, error) {
-	p.consume() // Consume USE
+// parseSearchCondition parses a search condition
+func (p *Parser) parseSearchCondition() (interface{}, error) {
+	// A search condition can be a binary expression, comparison expression, or a logical expression
 
-	if p.peek(0).tokenT != IDENT_TOK {
-		return nil, errors.New("expected identifier")
-	}
+	var expr interface{}
+	var err error
+	var not *NotExpr
 
-	name := p.peek(0).value.(string)
-	p.consume() // Consume identifier
+	if p.peek(0).tokenT == IDENT_TOK {
+		if p.peek(1).value == "NOT" {
+			// put ident in the not position
 
-	return &UseStmt{
-		DatabaseName: &Identifier{Value: name},
-	}, nil
+			p.switchToken(0, 1)
 
-}
+			p.consume()
 
-// parseSelectStmt parses a SELECT statement
-func (p *Parser) parseSelectStmt() (Node, error) {
+			not = &NotExpr{}
+		}
 
-	selectStmt := &SelectStmt{}
+	}
 
-	// Eat SELECT
-	p.consume()
+	if p.peek(0).value == "EXISTS" {
+		// Parse subquery
 
-	// Check for DISTINCT
-	if p.peek(0).value == "DISTINCT" {
-		selectStmt.Distinct = true
 		p.consume()
-	}
+		p.consume()
 
-	// Parse select list
-	err := p.parseSelectList(selectStmt)
-	if err != nil {
-		return nil, err
+		subquery, err := p.parseSubquery()
+		if err != nil {
+			return nil, err
+		}
+
+		return &ExistsPredicate{
+			Expr: subquery,
+		}, nil
 	}
 
-	// Check for FROM
-	if p.peek(0).value == "FROM" {
-		tableExpr, err := p.parseTableExpression()
+	if p.peek(1).tokenT == COMPARISON_TOK || p.peek(1).tokenT == ASTERISK_TOK || p.peek(1).tokenT == PLUS_TOK || p.peek(1).tokenT == MINUS_TOK || p.peek(1).tokenT == DIVIDE_TOK || p.peek(1).tokenT == MODULUS_TOK || p.peek(1).tokenT == AT_TOK ||
+		(p.peek(1).tokenT == KEYWORD_TOK && p.peek(1).value == "COLLATE") {
+		// Parse comparison expression
+		expr, err = p.parseComparisonExpr(nil)
 		if err != nil {
 			return nil, err
-
 		}
 
-		selectStmt.TableExpression = tableExpr
+	} else if p.peek(1).tokenT == KEYWORD_TOK {
+		// Check for case
+		if p.peek(0).value == "CASE" {
+			expr, err = p.parseCaseExpr()
+			if err != nil {
+				return nil, err
+			}
 
-	}
+			// Check next token
+			// Case can be evaluated as a left side of a predicate
+			if p.peek(0).tokenT == COMPARISON_TOK || p.peek(0).tokenT == ASTERISK_TOK || p.peek(0).tokenT == PLUS_TOK || p.peek(0).tokenT == MINUS_TOK || p.peek(0).tokenT == DIVIDE_TOK || p.peek(0).tokenT == MODULUS_TOK || p.peek(0).tokenT == AT_TOK {
+				// Parse comparison expression
+				expr, err = p.parseComparisonExpr(&ValueExpression{
+					Value: expr,
+				})
+				if err != nil {
+					return nil, err
+				}
+			} else if p.peek(0).tokenT == KEYWORD_TOK {
+				switch p.peek(0).value {
+				case "BETWEEN":
+					// Parse between expression
+					expr, err = p.parseBetweenExpr(&ValueExpression{
+						Value: expr,
+					})
+					if err != nil {
+						return nil, err
+					}
 
-	// Check for WHERE
-	if p.peek(0).value == "WHERE" {
+					if not != nil {
+						not.Expr = expr
+						expr = not
+					}
+				case "IN":
+					// Parse in expression
+					expr, err = p.parseInExpr(&ValueExpression{
+						Value: expr,
+					})
+					if err != nil {
+						return nil, err
+					}
+
+					if not != nil {
+						not.Expr = expr
+						expr = not
+					}
+				case "LIKE":
+					// Parse like expression
+					expr, err = p.parseLikeExpr(&ValueExpression{
+						Value: expr,
+					})
+					if err != nil {
+						return nil, err
+					}
+
+					if not != nil {
+						not.Expr = expr
+						expr = not
+					}
+				case "IS":
+					// Parse is expression
+					expr, err = p.parseIsExpr(&ValueExpression{
+						Value: expr,
+					})
+					if err != nil {
+						return nil, err
+					}
+				default:
+					return nil, errors.New("expected predicate or logical expression")
+
+				}
+			}
 
-		whereClause, err := p.parseWhereClause()
-		if err != nil {
-			return nil, err
 		}
 
-		selectStmt.TableExpression.WhereClause = whereClause
+		switch p.peek(1).value {
+		case "BETWEEN":
 
-	}
+			// Parse between expression
+			expr, err = p.parseBetweenExpr(nil)
+			if err != nil {
+				return nil, err
+			}
 
-	// Look for GROUP BY
-	if p.peek(0).value == "GROUP" {
-		if p.peek(1).value != "BY" {
-			return nil, errors.New("expected BY")
+			if not != nil {
+				not.Expr = expr
+				expr = not
+			}
 
-		} else {
-			p.consume()
-			p.consume()
+		case "IN":
+			// Parse in expression
+			expr, err = p.parseInExpr(nil)
+			if err != nil {
+				return nil, err
+			}
 
-			groupByClause, err := p.parseGroupByClause()
+			if not != nil {
+				not.Expr = expr
+				expr = not
+			}
+		case "LIKE":
+			// Parse like expression
+			expr, err = p.parseLikeExpr(nil)
 			if err != nil {
 				return nil, err
 			}
 
-			selectStmt.TableExpression.GroupByClause = groupByClause
+			if not != nil {
+				not.Expr = expr
+				expr = not
+			}
+		case "IS":
+			// Parse is expression
+			expr, err = p.parseIsExpr(nil)
+			if err != nil {
+				return nil, err
+			}
 
 		}
-	}
+	} else if p.peek(0).tokenT == KEYWORD_TOK {
 
-	if p.peek(0).value == "HAVING" {
-		havingClause, err := p.parseHavingClause()
-		if err != nil {
-			return nil, err
+		currentPos := p.pos
+
+		if p.peek(0).value == "AVG" || p.peek(0).value == "COUNT" || p.peek(0).value == "MAX" || p.peek(0).value == "MIN" || p.peek(0).value == "SUM" {
+			expr, err = p.parseAggregateFunc()
+			if err != nil {
+				return nil, err
+			}
+		} else if p.peek(0).value == "GROUPING" {
+			expr, err = p.parseGroupingFunc()
+			if err != nil {
+				return nil, err
+			}
+		} else if p.peek(0).value == "LENGTH" || p.peek(0).value == "LOWER" || p.peek(0).value == "UPPER" || p.peek(0).value == "TRIM" || p.peek(0).value == "SUBSTRING" || p.peek(0).value == "POSITION" || p.peek(0).value == "CONCAT" || p.peek(0).value == "COALESCE" ||
+			p.peek(0).value == "CAST" || p.peek(0).value == "REVERSE" || p.peek(0).value == "ROUND" || p.peek(0).value == "REPLACE" || p.peek(0).value == "TRIM" || p.peek(0).value == "COALESCE" ||
+			p.peek(0).value == "RANDOM" || p.peek(0).value == "MD5" || p.peek(0).value == "SHA256" {
+			expr, err = p.parseSystemFunc()
+			if err != nil {
+				return nil, err
+			}
 		}
 
-		selectStmt.TableExpression.HavingClause = havingClause
+		if p.peek(0).tokenT == COMPARISON_TOK || p.peek(0).tokenT == ASTERISK_TOK || p.peek(0).tokenT == PLUS_TOK || p.peek(0).tokenT == MINUS_TOK || p.peek(0).tokenT == DIVIDE_TOK || p.peek(0).tokenT == MODULUS_TOK || p.peek(0).tokenT == AT_TOK {
+			// Parse comparison expression
+			p.pos = currentPos
 
-	}
+			expr, err = p.parseComparisonExpr(nil)
+			if err != nil {
+				return nil, err
+			}
 
-	// Look for ORDER BY
-	if p.peek(0).value == "ORDER" {
-		if p.peek(1).value != "BY" {
-			return nil, errors.New("expected BY")
+		}
 
-		} else {
+		switch p.peek(0).value {
+		case "BETWEEN":
 
-			orderByClause, err := p.parseOrderByClause()
+			// Parse between expression
+			expr, err = p.parseBetweenExpr(nil)
 			if err != nil {
 				return nil, err
 			}
 
-			selectStmt.TableExpression.OrderByClause = orderByClause
+			if not != nil {
+				not.Expr = expr
+				expr = not
+			}
 
-		}
+		case "IN":
+			// Parse in expression
+			expr, err = p.parseInExpr(nil)
+			if err != nil {
+				return nil, err
+			}
 
-	}
+			if not != nil {
+				not.Expr = expr
+				expr = not
+			}
+		case "LIKE":
+			// Parse like expression
+			expr, err = p.parseLikeExpr(nil)
+			if err != nil {
+				return nil, err
+			}
 
-	if p.peek(0).value == "LIMIT" {
-		limitClause, err := p.parseLimitClause()
-		if err != nil {
-			return nil, err
-		}
+			if not != nil {
+				not.Expr = expr
+				expr = not
+			}
+		case "IS":
+			// Parse is expression
+			expr, err = p.parseIsExpr(nil)
+			if err != nil {
+				return nil, err
+			}
 
-		selectStmt.TableExpression.LimitClause = limitClause
+		}
+	} else {
+		return nil, errors.New("expected predicate or logical expression")
 	}
 
-	// Look for union
-	if p.peek(0).value == "UNION" {
-		p.consume()
-		if p.peek(0).value == "ALL" {
-			selectStmt.UnionAll = true
-			p.consume()
+	if p.peek(0).tokenT == KEYWORD_TOK {
+		if p.peek(0).value == "AND" || p.peek(0).value == "OR" {
+			// Parse logical expression
+			expr, err = p.parseLogicalExpr(expr)
+			if err != nil {
+				return nil, err
+			}
+
 		}
+	}
 
-		unionStmt, err := p.parseSelectStmt()
+	return expr, nil
+
+}
+
+// parseLikeExpr parses a LIKE expression
+func (p *Parser) parseLikeExpr(left *ValueExpression) (*LikePredicate, error) {
+	// Parse left side of like expression
+
+	if left == nil {
+		var err error
+		left, err = p.parseValueExpression()
 		if err != nil {
 			return nil, err
 		}
+	}
 
-		selectStmt.Union = unionStmt.(*SelectStmt)
+	// Eat LIKE
+	p.consume()
 
+	// Parse pattern
+	pattern, err := p.parseValueExpression()
+	if err != nil {
+		return nil, err
 	}
 
-	return selectStmt, nil
+	return &LikePredicate{
+		Left:    left,
+		Pattern: pattern,
+	}, nil
 
 }
 
-// parseLimitClause parses a LIMIT clause
-func (p *Parser) parseLimitClause() (*LimitClause, error) {
-	limitClause := &LimitClause{}
-
-	// Eat LIMIT
-	p.consume()
-
-	if p.peek(0).tokenT != LITERAL_TOK {
-		return nil, errors.New("expected literal")
+// parseIsExpr parses an IS expression
+func (p *Parser) parseIsExpr(left *ValueExpression) (*IsPredicate, error) {
+	// Parse left side of is expression
+	if left == nil {
+		var err error
+		left, err = p.parseValueExpression()
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	count := p.peek(0).value.(uint64)
-
+	// Eat IS
 	p.consume()
 
-	// check for offset
-	if p.peek(0).value == "OFFSET" {
+	// NULL or NOT NULL
+
+	if p.peek(0).value == "NULL" {
+		p.consume()
+		return &IsPredicate{
+			Left: left,
+			Null: true,
+		}, nil
+	} else if p.peek(0).value == "NOT" {
+		// Eat NOT
 		p.consume()
 
-		if p.peek(0).tokenT != LITERAL_TOK {
-			return nil, errors.New("expected literal")
+		if p.peek(0).value != "NULL" {
+			return nil, errors.New("expected NULL")
 		}
 
-		offset := p.peek(0).value.(uint64)
-		limitClause.Offset = &Literal{Value: offset}
-
 		p.consume()
-	}
 
-	limitClause.Count = &Literal{Value: count}
+		return &IsPredicate{
+			Left: left,
+			Null: false,
+		}, nil
 
-	return limitClause, nil
+	}
+
+	return nil, errors.New("expected NULL or NOT NULL")
 
 }
 
-// parseOrderByClause parses an ORDER BY clause
-func (p *Parser) parseOrderByClause() (*OrderByClause, error) {
-	orderByClause := &OrderByClause{}
+// parseInExpr parses an IN expression
+func (p *Parser) parseInExpr(left *ValueExpression) (*InPredicate, error) {
+	// Parse left side of in expression
 
-	// Parse order by list
-	err := p.parseOrderByList(orderByClause)
-	if err != nil {
-		return nil, err
+	if left == nil {
+		var err error
+		left, err = p.parseValueExpression()
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	return orderByClause, nil
-}
+	// Eat IN
+	p.consume()
 
-// parseOrderByList parses an order by list
-func (p *Parser) parseOrderByList(orderByClause *OrderByClause) error {
-	p.consume() // Consume ORDER
+	// Eat (
+	p.consume()
 
-	if p.peek(0).value != "BY" {
-		return errors.New("expected BY")
+	inPredicate := &InPredicate{
+		Left: left,
 	}
 
-	p.consume() // Consume BY
+	if p.peek(0).value == "SELECT" {
+		// Parse subquery
+		subquery, err := p.parseSubquery()
+		if err != nil {
+			return nil, err
+		}
+
+		inPredicate.Values = append(inPredicate.Values, subquery)
 
-	for p.peek(0).tokenT != EOF_TOK || p.peek(0).value != "ROWS" || p.peek(0).value == "RANGE" || p.peek(0).tokenT != RPAREN_TOK {
+		// Eat )
+		p.consume()
 
-		// Parse order by expression
-		expr, err := p.parseValueExpression()
-		if err != nil {
-			return err
-		}
+		return inPredicate, nil
 
-		orderByClause.OrderByExpressions = append(orderByClause.OrderByExpressions, expr)
+	}
 
-		// Look for ,
-		if p.peek(0).value == "," {
-			p.consume() // Consume ,
+	for p.peek(0).tokenT != EOF_TOK {
+		if p.peek(0).tokenT == RPAREN_TOK {
+			break
+		}
 
+		if p.peek(0).tokenT == COMMA_TOK {
+			p.consume()
 			continue
 		}
 
-		break
+		// Parse right side of in expression
+		right, err := p.parseValueExpression()
+		if err != nil {
+			return nil, err
+		}
 
+		inPredicate.Values = append(inPredicate.Values, right)
 	}
 
-	if p.peek(0).value == "ASC" {
-		orderByClause.Order = ASC
-		p.consume()
-
-	} else if p.peek(0).value == "DESC" {
-		orderByClause.Order = DESC
-		p.consume()
-	} else {
-		orderByClause.Order = ASC
-
-	}
+	// Eat )
+	p.consume()
 
-	return nil
+	return inPredicate, nil
 
 }
 
-// parseGroupByClause
-func (p *Parser) parseGroupByClause() (*GroupByClause, error) {
+// parseBetweenExpr parses a between expression
+func (p *Parser) parseBetweenExpr(left *ValueExpression) (*BetweenPredicate, error) {
+	// check for not if there remove
 
-	groupByClause := &GroupByClause{}
+	if left == nil {
+		var err error
+		// Parse left side of between expression
+		left, err = p.parseValueExpression()
+		if err != nil {
+			return nil, err
+		}
+	}
 
-	// Parse group by list
-	err := p.parseGroupByList(groupByClause)
+	// Eat BETWEEN
+	p.consume()
+
+	// Parse lower bound
+	lower, err := p.parseValueExpression()
 	if err != nil {
 		return nil, err
 	}
 
-	return groupByClause, nil
-}
+	// Eat AND
+	p.consume()
 
-// parseGroupByList parses a group by list
-func (p *Parser) parseGroupByList(groupByClause *GroupByClause) error {
-	// Parse group by expression
-	expr, err := p.parseValueExpression()
+	// Parse upper bound
+	upper, err := p.parseValueExpression()
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	groupByClause.GroupByExpressions = append(groupByClause.GroupByExpressions, expr)
+	return &BetweenPredicate{
+		Left:  left,
+		Lower: lower,
+		Upper: upper,
+	}, nil
 
-	// Look for ,
-	for p.peek(0).value == "," {
-		p.consume() // Consume ,
+}
 
-		expr, err := p.parseValueExpression()
+// parseComparisonExpr parses a comparison expression
+func (p *Parser) parseComparisonExpr(left *ValueExpression) (*ComparisonPredicate, error) {
+	// Parse left side of comparison
+	if left == nil {
+		var err error
+		left, err = p.parseValueExpression()
 		if err != nil {
-			return err
+			return nil, err
 		}
-
-		groupByClause.GroupByExpressions = append(groupByClause.GroupByExpressions, expr)
 	}
 
-	return nil
-}
+	err := p.parseCollation(left)
+	if err != nil {
+		return nil, err
+	}
 
-// parseWhereClause parses a WHERE clause
-func (p *Parser) parseWhereClause() (*WhereClause, error) {
-	whereClause := &WhereClause{}
+	// Parse comparison operator
+	op := p.peek(0).value.(string)
 
-	// Eat WHERE
 	p.consume()
 
-	// Parse search condition
-	searchCondition, err := p.parseSearchCondition()
+	// Parse right side of comparison
+	right, err := p.parseValueExpression()
 	if err != nil {
 		return nil, err
 	}
 
-	whereClause.SearchCondition = searchCondition
-
-	return whereClause, nil
+	err = p.parseCollation(right)
+	if err != nil {
+		return nil, err
+	}
 
+	return &ComparisonPredicate{
+		Left:  left,
+		Op:    getComparisonOperator(op),
+		Right: right,
+	}, nil
 }
 
-// parseSearchCondition parses a search condition
-func (p *Parser) parseSearchCondition() (interface{}, error) {
-	// A search condition can be a binary expression, comparison expression, or a logical expression
-
-	var expr interface{}
-	var err error
-	var not *NotExpr
-
-	if p.peek(0).tokenT == IDENT_TOK {
-		if p.peek(1).value == "NOT" {
-			// put ident in the not position
-
-			p.switchToken(0, 1)
+// parseCollation parses COLLATE name or COLLATE 'locale' following a value expression, if any
+func (p *Parser) parseCollation(expr *ValueExpression) error {
+	if p.peek(0).tokenT != KEYWORD_TOK || p.peek(0).value != "COLLATE" {
+		return nil
+	}
 
-			p.consume()
+	p.consume() // Consume COLLATE
 
-			not = &NotExpr{}
+	switch p.peek(0).tokenT {
+	case IDENT_TOK, KEYWORD_TOK, DATATYPE_TOK, LITERAL_TOK:
+		name, ok := p.peek(0).value.(string)
+		if !ok {
+			return errors.New("expected collation")
 		}
 
+		expr.Collation = &Identifier{Value: shared.UnquoteLiteral(name)}
+	default:
+		return errors.New("expected collation")
 	}
 
-	if p.peek(0).value == "EXISTS" {
-		// Parse subquery
+	p.consume() // Consume collation
 
-		p.consume()
-		p.consume()
+	return nil
+}
 
-		subquery, err := p.parseSubquery()
-		if err != nil {
-			return nil, err
-		}
+// parseLogicalExpr parses a logical expression
+func (p *Parser) parseLogicalExpr(left interface{}) (*LogicalCondition, error) {
 
-		return &ExistsPredicate{
-			Expr: subquery,
-		}, nil
+	// Parse logical operator
+	op := p.peek(0).value.(string)
+	p.consume()
+
+	// Parse right side of logical expression
+	right, err := p.parseSearchCondition()
+	if err != nil {
+		return nil, err
 	}
 
-	if p.peek(1).tokenT == COMPARISON_TOK || p.peek(1).tokenT == ASTERISK_TOK || p.peek(1).tokenT == PLUS_TOK || p.peek(1).tokenT == MINUS_TOK || p.peek(1).tokenT == DIVIDE_TOK || p.peek(1).tokenT == MODULUS_TOK || p.peek(1).tokenT == AT_TOK {
-		// Parse comparison expression
-		expr, err = p.parseComparisonExpr(nil)
-		if err != nil {
-			return nil, err
-		}
+	return &LogicalCondition{
+		Left:  left,
+		Op:    getLogicalOperator(op),
+		Right: right,
+	}, nil
+}
 
-	} else if p.peek(1).tokenT == KEYWORD_TOK {
-		// Check for case
-		if p.peek(0).value == "CASE" {
-			expr, err = p.parseCaseExpr()
-			if err != nil {
-				return nil, err
-			}
+// parseTableExpression parses a table expression
+func (p *Parser) parseTableExpression() (*TableExpression, error) {
+	tableExpr := &TableExpression{}
 
-			// Check next token
-			// Case can be evaluated as a left side of a predicate
-			if p.peek(0).tokenT == COMPARISON_TOK || p.peek(0).tokenT == ASTERISK_TOK || p.peek(0).tokenT == PLUS_TOK || p.peek(0).tokenT == MINUS_TOK || p.peek(0).tokenT == DIVIDE_TOK || p.peek(0).tokenT == MODULUS_TOK || p.peek(0).tokenT == AT_TOK {
-				// Parse comparison expression
-				expr, err = p.parseComparisonExpr(&ValueExpression{
-					Value: expr,
-				})
-				if err != nil {
-					return nil, err
-				}
-			} else if p.peek(0).tokenT == KEYWORD_TOK {
-				switch p.peek(0).value {
-				case "BETWEEN":
-					// Parse between expression
-					expr, err = p.parseBetweenExpr(&ValueExpression{
-						Value: expr,
-					})
-					if err != nil {
-						return nil, err
-					}
+	// Eat FROM
+	p.consume()
 
-					if not != nil {
-						not.Expr = expr
-						expr = not
-					}
-				case "IN":
-					// Parse in expression
-					expr, err = p.parseInExpr(&ValueExpression{
-						Value: expr,
-					})
-					if err != nil {
-						return nil, err
-					}
+	// Parse from clause
+	fromClause, err := p.parseFromClause()
+	if err != nil {
+		return nil, err
+	}
 
-					if not != nil {
-						not.Expr = expr
-						expr = not
-					}
-				case "LIKE":
-					// Parse like expression
-					expr, err = p.parseLikeExpr(&ValueExpression{
-						Value: expr,
-					})
-					if err != nil {
-						return nil, err
-					}
+	tableExpr.FromClause = fromClause
 
-					if not != nil {
-						not.Expr = expr
-						expr = not
-					}
-				case "IS":
-					// Parse is expression
-					expr, err = p.parseIsExpr(&ValueExpression{
-						Value: expr,
-					})
-					if err != nil {
-						return nil, err
-					}
-				default:
-					return nil, errors.New("expected predicate or logical expression")
+	return tableExpr, nil
+}
+
+// parseFromClause parses a FROM clause
+func (p *Parser) parseFromClause() (*FromClause, error) {
+	fromClause := &FromClause{
+		Tables: make([]*Table, 0),
+	}
+
+	for p.peek(0).tokenT != SEMICOLON_TOK || p.peek(0).value != "WHERE" || p.peek(0).value != "INNER" || p.peek(0).value != "LEFT" || p.peek(0).value != "RIGHT" || p.peek(0).value != "FULL" || p.peek(0).value != "GROUP" || p.peek(0).value != "HAVING" || p.peek(0).value != "ORDER" || p.peek(0).value != "LIMIT" || p.peek(0).value != "UNION" || p.peek(0).value != "JOIN" {
+		if p.peek(0).tokenT == COMMA_TOK {
+			p.consume()
 
-				}
-			}
+			continue
+		}
 
+		if p.peek(0).tokenT == SEMICOLON_TOK || p.peek(0).value == "WHERE" || p.peek(0).tokenT == LPAREN_TOK || p.peek(0).tokenT == RPAREN_TOK || p.peek(0).value == "GROUP" || p.peek(0).value == "HAVING" || p.peek(0).value == "ORDER" || p.peek(0).value == "LIMIT" || p.peek(0).value == "INNER" || p.peek(0).value == "LEFT" || p.peek(0).value == "RIGHT" || p.peek(0).value == "FULL" || p.peek(0).value == "GROUP" || p.peek(0).value == "HAVING" || p.peek(0).value == "ORDER" || p.peek(0).value == "LIMIT" || p.peek(0).value == "UNION" || p.peek(0).value == "JOIN" || p.peek(0).value == "JOIN" {
+			break
 		}
 
-		switch p.peek(1).value {
-		case "BETWEEN":
+		// Parse table
+		table, err := p.parseTable()
+		if err != nil {
+			return nil, err
+		}
 
-			// Parse between expression
-			expr, err = p.parseBetweenExpr(nil)
-			if err != nil {
-				return nil, err
-			}
+		fromClause.Tables = append(fromClause.Tables, table)
+	}
 
-			if not != nil {
-				not.Expr = expr
-				expr = not
-			}
+	return fromClause, nil
+}
 
-		case "IN":
-			// Parse in expression
-			expr, err = p.parseInExpr(nil)
-			if err != nil {
-				return nil, err
-			}
+// parseTable parses a table
+func (p *Parser) parseTable() (*Table, error) {
+	table := &Table{}
 
-			if not != nil {
-				not.Expr = expr
-				expr = not
-			}
-		case "LIKE":
-			// Parse like expression
-			expr, err = p.parseLikeExpr(nil)
-			if err != nil {
-				return nil, err
-			}
+	// Parse table name
+	tableName, err := p.parseIdentifier()
+	if err != nil {
+		return nil, err
+	}
 
-			if not != nil {
-				not.Expr = expr
-				expr = not
-			}
-		case "IS":
-			// Parse is expression
-			expr, err = p.parseIsExpr(nil)
-			if err != nil {
-				return nil, err
-			}
+	table.Name = tableName
 
+	// name(args) calls a table function
+	if p.peek(0).tokenT == LPAREN_TOK {
+		table.Args, err = p.parseTableFunctionArgs()
+		if err != nil {
+			return nil, err
 		}
-	} else if p.peek(0).tokenT == KEYWORD_TOK {
+	}
 
-		currentPos := p.pos
+	// tablename AS OF TIMESTAMP 'timestamp' reads the table as it was at timestamp
+	if p.peek(0).tokenT == KEYWORD_TOK && p.peek(0).value == "AS" && p.peek(1).tokenT == KEYWORD_TOK && p.peek(1).value == "OF" {
+		p.consume() // Consume AS
+		p.consume() // Consume OF
 
-		if p.peek(0).value == "AVG" || p.peek(0).value == "COUNT" || p.peek(0).value == "MAX" || p.peek(0).value == "MIN" || p.peek(0).value == "SUM" {
-			expr, err = p.parseAggregateFunc()
-			if err != nil {
-				return nil, err
-			}
-		} else if p.peek(0).value == "LENGTH" || p.peek(0).value == "LOWER" || p.peek(0).value == "UPPER" || p.peek(0).value == "TRIM" || p.peek(0).value == "SUBSTRING" || p.peek(0).value == "POSITION" || p.peek(0).value == "CONCAT" || p.peek(0).value == "COALESCE" ||
-			p.peek(0).value == "CAST" || p.peek(0).value == "REVERSE" || p.peek(0).value == "ROUND" || p.peek(0).value == "REPLACE" || p.peek(0).value == "TRIM" || p.peek(0).value == "COALESCE" {
-			expr, err = p.parseSystemFunc()
-			if err != nil {
-				return nil, err
-			}
+		if p.peek(0).tokenT != DATATYPE_TOK || strings.ToUpper(p.peek(0).value.(string)) != "TIMESTAMP" {
+			return nil, errors.New("expected TIMESTAMP")
 		}
 
-		if p.peek(0).tokenT == COMPARISON_TOK || p.peek(0).tokenT == ASTERISK_TOK || p.peek(0).tokenT == PLUS_TOK || p.peek(0).tokenT == MINUS_TOK || p.peek(0).tokenT == DIVIDE_TOK || p.peek(0).tokenT == MODULUS_TOK || p.peek(0).tokenT == AT_TOK {
-			// Parse comparison expression
-			p.pos = currentPos
+		p.consume() // Consume TIMESTAMP
 
-			expr, err = p.parseComparisonExpr(nil)
-			if err != nil {
-				return nil, err
-			}
+		if p.peek(0).tokenT != LITERAL_TOK {
+			return nil, errors.New("expected timestamp literal")
+		}
 
+		if _, ok := p.peek(0).value.(string); !ok {
+			return nil, errors.New("expected timestamp literal")
 		}
 
-		switch p.peek(0).value {
-		case "BETWEEN":
+		table.AsOf = &Literal{Value: p.peek(0).value}
+		p.consume() // Consume timestamp
+	}
 
-			// Parse between expression
-			expr, err = p.parseBetweenExpr(nil)
-			if err != nil {
-				return nil, err
-			}
+	// tablename FOR SYSTEM_TIME AS OF 'timestamp' or FOR SYSTEM_TIME BETWEEN 'timestamp' AND 'timestamp' reads the versions of a system versioned table
+	if p.peek(0).tokenT == KEYWORD_TOK && p.peek(0).value == "FOR" && p.peek(1).tokenT == IDENT_TOK && strings.ToUpper(p.peek(1).value.(string)) == "SYSTEM_TIME" {
+		p.consume() // Consume FOR
+		p.consume() // Consume SYSTEM_TIME
 
-			if not != nil {
-				not.Expr = expr
-				expr = not
-			}
+		switch {
+		case p.peek(0).tokenT == KEYWORD_TOK && p.peek(0).value == "AS" && p.peek(1).tokenT == KEYWORD_TOK && p.peek(1).value == "OF":
+			p.consume() // Consume AS
+			p.consume() // Consume OF
 
-		case "IN":
-			// Parse in expression
-			expr, err = p.parseInExpr(nil)
+			timestamp, err := p.parseTimestamp()
 			if err != nil {
 				return nil, err
 			}
 
-			if not != nil {
-				not.Expr = expr
-				expr = not
-			}
-		case "LIKE":
-			// Parse like expression
-			expr, err = p.parseLikeExpr(nil)
+			table.AsOf = timestamp
+		case p.peek(0).tokenT == KEYWORD_TOK && p.peek(0).value == "BETWEEN":
+			p.consume() // Consume BETWEEN
+
+			from, err := p.parseTimestamp()
 			if err != nil {
 				return nil, err
 			}
 
-			if not != nil {
-				not.Expr = expr
-				expr = not
-			}
-		case "IS":
-			// Parse is expression
-			expr, err = p.parseIsExpr(nil)
-			if err != nil {
-				return nil, err
+			if p.peek(0).tokenT != KEYWORD_TOK || p.peek(0).value != "AND" {
+				return nil, errors.New("expected AND")
 			}
 
-		}
-	} else {
-		return nil, errors.New("expected predicate or logical expression")
-	}
+			p.consume() // Consume AND
 
-	if p.peek(0).tokenT == KEYWORD_TOK {
-		if p.peek(0).value == "AND" || p.peek(0).value == "OR" {
-			// Parse logical expression
-			expr, err = p.parseLogicalExpr(expr)
+			to, err := p.parseTimestamp()
 			if err != nil {
 				return nil, err
 			}
 
+			table.Between = []*Literal{from, to}
+		default:
+			return nil, errors.New("expected AS OF or BETWEEN")
 		}
 	}
 
-	return expr, nil
-
-}
-
-// parseLikeExpr parses a LIKE expression
-func (p *Parser) parseLikeExpr(left *ValueExpression) (*LikePredicate, error) {
-	// Parse left side of like expression
-
-	if left == nil {
-		var err error
-		left, err = p.parseValueExpression()
+	// tablename PIVOT (...) or tablename UNPIVOT (...) reshapes the rows of the table
+	if p.peek(0).tokenT == KEYWORD_TOK && p.peek(0).value == "PIVOT" {
+		table.Pivot, err = p.parsePivot()
+		if err != nil {
+			return nil, err
+		}
+	} else if p.peek(0).tokenT == KEYWORD_TOK && p.peek(0).value == "UNPIVOT" {
+		table.Unpivot, err = p.parseUnpivot()
 		if err != nil {
 			return nil, err
 		}
 	}
 
-	// Eat LIKE
-	p.consume()
-
-	// Parse pattern
-	pattern, err := p.parseValueExpression()
-	if err != nil {
-		return nil, err
+	// can have tablename aliasname i.e users u
+	// OR tablename aliasname i.e users as u
+	if p.peek(0).tokenT == KEYWORD_TOK {
+		if p.peek(0).value == "AS" {
+			p.consume()
+		}
 	}
 
-	return &LikePredicate{
-		Left:    left,
-		Pattern: pattern,
-	}, nil
-
-}
-
-// parseIsExpr parses an IS expression
-func (p *Parser) parseIsExpr(left *ValueExpression) (*IsPredicate, error) {
-	// Parse left side of is expression
-	if left == nil {
-		var err error
-		left, err = p.parseValueExpression()
+	if p.peek(0).tokenT == IDENT_TOK {
+		aliasName, err := p.parseIdentifier()
 		if err != nil {
 			return nil, err
 		}
+		table.Alias = aliasName
+
 	}
 
-	// Eat IS
-	p.consume()
+	return table, nil
+}
 
-	// NULL or NOT NULL
+// parseTableFunctionArgs parses the arguments of a table function, literals and negative numbers
+func (p *Parser) parseTableFunctionArgs() ([]*Literal, error) {
+	p.consume() // Consume (
 
-	if p.peek(0).value == "NULL" {
-		p.consume()
-		return &IsPredicate{
-			Left: left,
-			Null: true,
-		}, nil
-	} else if p.peek(0).value == "NOT" {
-		// Eat NOT
-		p.consume()
+	args := make([]*Literal, 0)
 
-		if p.peek(0).value != "NULL" {
-			return nil, errors.New("expected NULL")
+	for p.peek(0).tokenT != RPAREN_TOK {
+		negative := false
+		if p.peek(0).tokenT == MINUS_TOK {
+			negative = true
+			p.consume() // Consume -
 		}
 
-		p.consume()
-
-		return &IsPredicate{
-			Left: left,
-			Null: false,
-		}, nil
+		if p.peek(0).tokenT != LITERAL_TOK {
+			return nil, errors.New("expected literal")
+		}
 
-	}
+		value := p.peek(0).value
 
-	return nil, errors.New("expected NULL or NOT NULL")
+		if negative {
+			switch v := value.(type) {
+			case uint64:
+				value = -int(v)
+			case float64:
+				value = -v
+			default:
+				return nil, errors.New("expected number")
+			}
+		}
 
-}
+		args = append(args, &Literal{Value: value})
 
-// parseInExpr parses an IN expression
-func (p *Parser) parseInExpr(left *ValueExpression) (*InPredicate, error) {
-	// Parse left side of in expression
+		p.consume() // Consume literal
 
-	if left == nil {
-		var err error
-		left, err = p.parseValueExpression()
-		if err != nil {
-			return nil, err
+		if p.peek(0).tokenT != COMMA_TOK {
+			break
 		}
-	}
-
-	// Eat IN
-	p.consume()
-
-	// Eat (
-	p.consume()
 
-	inPredicate := &InPredicate{
-		Left: left,
+		p.consume() // Consume ,
 	}
 
-	if p.peek(0).value == "SELECT" {
-		// Parse subquery
-		subquery, err := p.parseSubquery()
-		if err != nil {
-			return nil, err
-		}
+	if p.peek(0).tokenT != RPAREN_TOK {
+		return nil, errors.New("expected )")
+	}
 
-		inPredicate.Values = append(inPredicate.Values, subquery)
+	p.consume() // Consume )
 
-		// Eat )
-		p.consume()
+	return args, nil
+}
 
-		return inPredicate, nil
+// parsePivot parses a PIVOT clause i.e. PIVOT (SUM(amount) FOR product IN ('apple' AS apples, 'pear'))
+func (p *Parser) parsePivot() (*PivotClause, error) {
+	p.consume() // Consume PIVOT
 
+	if p.peek(0).tokenT != LPAREN_TOK {
+		return nil, errors.New("expected (")
 	}
 
-	for p.peek(0).tokenT != EOF_TOK {
-		if p.peek(0).tokenT == RPAREN_TOK {
-			break
-		}
-
-		if p.peek(0).tokenT == COMMA_TOK {
-			p.consume()
-			continue
-		}
-
-		// Parse right side of in expression
-		right, err := p.parseValueExpression()
-		if err != nil {
-			return nil, err
-		}
+	p.consume() // Consume (
 
-		inPredicate.Values = append(inPredicate.Values, right)
+	if p.peek(0).tokenT != KEYWORD_TOK {
+		return nil, errors.New("expected aggregate function")
 	}
 
-	// Eat )
-	p.consume()
+	switch p.peek(0).value {
+	case "AVG", "COUNT", "MAX", "MIN", "SUM":
+	default:
+		return nil, errors.New("expected aggregate function")
+	}
 
-	return inPredicate, nil
+	pivot := &PivotClause{}
 
-}
+	var err error
 
-// parseBetweenExpr parses a between expression
-func (p *Parser) parseBetweenExpr(left *ValueExpression) (*BetweenPredicate, error) {
-	// check for not if there remove
+	pivot.Aggregate, err = p.parseAggregateFunc()
+	if err != nil {
+		return nil, err
+	}
 
-	if left == nil {
-		var err error
-		// Parse left side of between expression
-		left, err = p.parseValueExpression()
-		if err != nil {
-			return nil, err
-		}
+	if p.peek(0).tokenT != KEYWORD_TOK || p.peek(0).value != "FOR" {
+		return nil, errors.New("expected FOR")
 	}
 
-	// Eat BETWEEN
-	p.consume()
+	p.consume() // Consume FOR
 
-	// Parse lower bound
-	lower, err := p.parseValueExpression()
+	pivot.For, err = p.parseColumnSpecification()
 	if err != nil {
 		return nil, err
 	}
 
-	// Eat AND
-	p.consume()
+	if p.peek(0).tokenT != KEYWORD_TOK || p.peek(0).value != "IN" {
+		return nil, errors.New("expected IN")
+	}
 
-	// Parse upper bound
-	upper, err := p.parseValueExpression()
-	if err != nil {
-		return nil, err
+	p.consume() // Consume IN
+
+	if p.peek(0).tokenT != LPAREN_TOK {
+		return nil, errors.New("expected (")
 	}
 
-	return &BetweenPredicate{
-		Left:  left,
-		Lower: lower,
-		Upper: upper,
-	}, nil
+	p.consume() // Consume (
 
-}
+	for {
+		if p.peek(0).tokenT != LITERAL_TOK {
+			return nil, errors.New("expected literal")
+		}
 
-// parseComparisonExpr parses a comparison expression
-func (p *Parser) parseComparisonExpr(left *ValueExpression) (*ComparisonPredicate, error) {
-	// Parse left side of comparison
-	if left == nil {
-		var err error
-		left, err = p.parseValueExpression()
-		if err != nil {
-			return nil, err
+		value := &PivotValue{Value: &Literal{Value: p.peek(0).value}}
+
+		p.consume() // Consume literal
+
+		if p.peek(0).tokenT == KEYWORD_TOK && p.peek(0).value == "AS" {
+			p.consume() // Consume AS
+
+			value.Alias, err = p.parseIdentifier()
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		pivot.Values = append(pivot.Values, value)
+
+		if p.peek(0).tokenT != COMMA_TOK {
+			break
 		}
+
+		p.consume() // Consume ,
 	}
 
-	// Parse comparison operator
-	op := p.peek(0).value.(string)
+	if p.peek(0).tokenT != RPAREN_TOK {
+		return nil, errors.New("expected )")
+	}
 
-	p.consume()
+	p.consume() // Consume )
 
-	// Parse right side of comparison
-	right, err := p.parseValueExpression()
-	if err != nil {
-		return nil, err
+	if p.peek(0).tokenT != RPAREN_TOK {
+		return nil, errors.New("expected )")
 	}
 
-	return &ComparisonPredicate{
-		Left:  left,
-		Op:    getComparisonOperator(op),
-		Right: right,
-	}, nil
+	p.consume() // Consume )
+
+	return pivot, nil
 }
 
-// parseLogicalExpr parses a logical expression
-func (p *Parser) parseLogicalExpr(left interface{}) (*LogicalCondition, error) {
+// parseUnpivot parses an UNPIVOT clause i.e. UNPIVOT (amount FOR product IN (apple, pear))
+func (p *Parser) parseUnpivot() (*UnpivotClause, error) {
+	p.consume() // Consume UNPIVOT
 
-	// Parse logical operator
-	op := p.peek(0).value.(string)
-	p.consume()
+	if p.peek(0).tokenT != LPAREN_TOK {
+		return nil, errors.New("expected (")
+	}
 
-	// Parse right side of logical expression
-	right, err := p.parseSearchCondition()
+	p.consume() // Consume (
+
+	unpivot := &UnpivotClause{}
+
+	var err error
+
+	unpivot.Value, err = p.parseIdentifier()
 	if err != nil {
 		return nil, err
 	}
 
-	return &LogicalCondition{
-		Left:  left,
-		Op:    getLogicalOperator(op),
-		Right: right,
-	}, nil
-}
-
-// parseTableExpression parses a table expression
-func (p *Parser) parseTableExpression() (*TableExpression, error) {
-	tableExpr := &TableExpression{}
+	if p.peek(0).tokenT != KEYWORD_TOK || p.peek(0).value != "FOR" {
+		return nil, errors.New("expected FOR")
+	}
 
-	// Eat FROM
-	p.consume()
+	p.consume() // Consume FOR
 
-	// Parse from clause
-	fromClause, err := p.parseFromClause()
+	unpivot.For, err = p.parseIdentifier()
 	if err != nil {
 		return nil, err
 	}
 
-	tableExpr.FromClause = fromClause
+	if p.peek(0).tokenT != KEYWORD_TOK || p.peek(0).value != "IN" {
+		return nil, errors.New("expected IN")
+	}
 
-	return tableExpr, nil
-}
+	p.consume() // Consume IN
 
-// parseFromClause parses a FROM clause
-func (p *Parser) parseFromClause() (*FromClause, error) {
-	fromClause := &FromClause{
-		Tables: make([]*Table, 0),
+	if p.peek(0).tokenT != LPAREN_TOK {
+		return nil, errors.New("expected (")
 	}
 
-	for p.peek(0).tokenT != SEMICOLON_TOK || p.peek(0).value != "WHERE" || p.peek(0).value != "INNER" || p.peek(0).value != "LEFT" || p.peek(0).value != "RIGHT" || p.peek(0).value != "FULL" || p.peek(0).value != "GROUP" || p.peek(0).value != "HAVING" || p.peek(0).value != "ORDER" || p.peek(0).value != "LIMIT" || p.peek(0).value != "UNION" || p.peek(0).value != "JOIN" {
-		if p.peek(0).tokenT == COMMA_TOK {
-			p.consume()
+	p.consume() // Consume (
 
-			continue
+	for {
+		column, err := p.parseIdentifier()
+		if err != nil {
+			return nil, err
 		}
 
-		if p.peek(0).tokenT == SEMICOLON_TOK || p.peek(0).value == "WHERE" || p.peek(0).tokenT == LPAREN_TOK || p.peek(0).tokenT == RPAREN_TOK || p.peek(0).value == "GROUP" || p.peek(0).value == "HAVING" || p.peek(0).value == "ORDER" || p.peek(0).value == "LIMIT" || p.peek(0).value == "INNER" || p.peek(0).value == "LEFT" || p.peek(0).value == "RIGHT" || p.peek(0).value == "FULL" || p.peek(0).value == "GROUP" || p.peek(0).value == "HAVING" || p.peek(0).value == "ORDER" || p.peek(0).value == "LIMIT" || p.peek(0).value == "UNION" || p.peek(0).value == "JOIN" || p.peek(0).value == "JOIN" {
-			break
-		}
+		unpivot.Columns = append(unpivot.Columns, column)
 
-		// Parse table
-		table, err := p.parseTable()
-		if err != nil {
-			return nil, err
+		if p.peek(0).tokenT != COMMA_TOK {
+			break
 		}
 
-		fromClause.Tables = append(fromClause.Tables, table)
+		p.consume() // Consume ,
 	}
 
-	return fromClause, nil
-}
+	if p.peek(0).tokenT != RPAREN_TOK {
+		return nil, errors.New("expected )")
+	}
 
-// parseTable parses a table
-func (p *Parser) parseTable() (*Table, error) {
-	table := &Table{}
+	p.consume() // Consume )
 
-	// Parse table name
-	tableName, err := p.parseIdentifier()
-	if err != nil {
-		return nil, err
+	if p.peek(0).tokenT != RPAREN_TOK {
+		return nil, errors.New("expected )")
 	}
 
-	table.Name = tableName
+	p.consume() // Consume )
 
-	// can have tablename aliasname i.e users u
-	// OR tablename aliasname i.e users as u
-	if p.peek(0).tokenT == KEYWORD_TOK {
-		if p.peek(0).value == "AS" {
-			p.consume()
-		}
-	}
+	return unpivot, nil
+}
 
-	if p.peek(0).tokenT == IDENT_TOK {
-		aliasName, err := p.parseIdentifier()
-		if err != nil {
-			return nil, err
-		}
-		table.Alias = aliasName
+// parseTimestamp parses a timestamp literal of a system time clause
+func (p *Parser) parseTimestamp() (*Literal, error) {
+	if p.peek(0).tokenT != LITERAL_TOK {
+		return nil, errors.New("expected timestamp literal")
+	}
 
+	if _, ok := p.peek(0).value.(string); !ok {
+		return nil, errors.New("expected timestamp literal")
 	}
 
-	return table, nil
+	timestamp := &Literal{Value: p.peek(0).value}
+	p.consume() // Consume timestamp
+
+	return timestamp, nil
 }
 
 // parseSelectList parses a select list
@@ -3491,11 +5723,17 @@ func (p *Parser) parseSelectList(selectStmt *SelectStmt) error {
 			p.consume()
 			continue
 		} else if p.peek(0).tokenT == KEYWORD_TOK {
-			if p.peek(0).value == "FROM" {
+			// A select without a table can be followed by a UNION
+			if p.peek(0).value == "FROM" || p.peek(0).value == "UNION" {
 				break
 			}
 		}
 
+		// A select without a table can be the query of a common table expression
+		if p.peek(0).tokenT == RPAREN_TOK {
+			break
+		}
+
 		// can be binary expression, column spec, or aggregate function
 		if p.peek(0).tokenT == ASTERISK_TOK {
 			// if we encounter an asterisk, we add all columns and no more columns nor expressions can be added
@@ -3659,6 +5897,28 @@ func (p *Parser) parseValueExpression() (*ValueExpression, error) {
 			return &ValueExpression{
 				Value: expr,
 			}, nil
+		case "GROUPING":
+			groupingFunc, err := p.parseGroupingFunc()
+			if err != nil {
+				return nil, err
+			}
+
+			var alias *Identifier
+
+			// Check for alias
+			if p.peek(0).value == "AS" {
+				p.consume()
+
+				alias, err = p.parseIdentifier()
+				if err != nil {
+					return nil, err
+				}
+			}
+
+			return &ValueExpression{
+				Value: groupingFunc,
+				Alias: alias,
+			}, nil
 		case "CASE":
 			caseExpr, err := p.parseCaseExpr()
 			if err != nil {
@@ -3690,7 +5950,7 @@ func (p *Parser) parseValueExpression() (*ValueExpression, error) {
 
 		case "UPPER", "LOWER", "CAST",
 			"COALESCE", "REVERSE", "ROUND", "POSITION", "LENGTH", "REPLACE", "CONCAT",
-			"SUBSTRING", "TRIM", "SYS_DATE", "SYS_TIME", "SYS_TIMESTAMP":
+			"SUBSTRING", "TRIM", "SYS_DATE", "SYS_TIME", "SYS_TIMESTAMP", "RANDOM", "UUID_V7", "MD5", "SHA256":
 			// Parse system function
 			sysFunc, err := p.parseSystemFunc()
 			if err != nil {
@@ -4330,12 +6590,112 @@ func (p *Parser) parseSystemFunc() (interface{}, error) {
 		return &shared.SysTimestamp{}, nil
 	case "GENERATE_UUID":
 		return &shared.GenUUID{}, nil
+	case "RANDOM":
+		p.consume() // Consume RANDOM
+
+		if p.peek(0).tokenT != LPAREN_TOK || p.peek(1).tokenT != RPAREN_TOK {
+			return nil, errors.New("expected ()")
+		}
+
+		p.consume() // Consume (
+		p.consume() // Consume )
+
+		return &RandomFunc{}, nil
+	case "UUID_V7":
+		p.consume() // Consume UUID_V7
+
+		// The parentheses are optional, as GENERATE_UUID has none
+		if p.peek(0).tokenT == LPAREN_TOK && p.peek(1).tokenT == RPAREN_TOK {
+			p.consume() // Consume (
+			p.consume() // Consume )
+		}
+
+		return &shared.GenUUIDv7{}, nil
+	case "MD5", "SHA256":
+		hashFunc := &HashFunc{FuncName: p.peek(0).value.(string)}
+
+		p.consume() // Consume MD5 or SHA256
+
+		if p.peek(0).tokenT != LPAREN_TOK {
+			return nil, errors.New("expected (")
+		}
+
+		p.consume() // Consume (
+
+		// Look for literal or identifier
+		if p.peek(0).tokenT != LITERAL_TOK && p.peek(0).tokenT != IDENT_TOK {
+			return nil, errors.New("expected literal or identifier")
+		}
+
+		expr, err := p.parseValueExpression()
+		if err != nil {
+			return nil, err
+		}
+
+		hashFunc.Arg = expr
+
+		if p.peek(0).tokenT != RPAREN_TOK {
+			return nil, errors.New("expected )")
+		}
+
+		p.consume() // Consume )
+
+		return hashFunc, nil
 	default:
 		return nil, errors.New("expected system function")
 
 	}
 }
 
+// Deterministic returns false if an expression calls a function which can return a different value on every call with the same arguments
+// RANDOM, UUID_V7, GENERATE_UUID, SYS_DATE, SYS_TIME and SYS_TIMESTAMP are not deterministic, a deterministic expression of literals can be folded to its value once
+func Deterministic(expr interface{}) bool {
+	switch expr := expr.(type) {
+	case *RandomFunc, *shared.GenUUID, *shared.GenUUIDv7, *shared.SysDate, *shared.SysTime, *shared.SysTimestamp:
+		return false
+	case *ValueExpression:
+		return Deterministic(expr.Value)
+	case *BinaryExpression:
+		return Deterministic(expr.Left) && Deterministic(expr.Right)
+	case *HashFunc:
+		return Deterministic(expr.Arg)
+	case *UpperFunc:
+		return Deterministic(expr.Arg)
+	case *LowerFunc:
+		return Deterministic(expr.Arg)
+	case *LengthFunc:
+		return Deterministic(expr.Arg)
+	case *TrimFunc:
+		return Deterministic(expr.Arg)
+	case *ReverseFunc:
+		return Deterministic(expr.Arg)
+	case *RoundFunc:
+		return Deterministic(expr.Arg)
+	case *SubstrFunc:
+		return Deterministic(expr.Arg)
+	case *CastFunc:
+		return Deterministic(expr.Expr)
+	case *PositionFunc:
+		return Deterministic(expr.Arg) && Deterministic(expr.In)
+	case *ConcatFunc:
+		for _, arg := range expr.Args {
+			if !Deterministic(arg) {
+				return false
+			}
+		}
+	case *CoalesceFunc:
+		for _, arg := range expr.Args {
+			if !Deterministic(arg) {
+				return false
+			}
+		}
+
+		return Deterministic(expr.Value)
+	}
+
+	return true
+}
+
 // parseColumnSpecification parses a column specification
 func (p *Parser) parseColumnSpecification() (*ColumnSpecification, error) {
 
@@ -19,6 +19,8 @@ package parser
 import (
 	"ariasql/shared"
 	"fmt"
+	"slices"
+	"strings"
 	"testing"
 )
 
@@ -7059,3 +7061,1774 @@ func TestNewParserAlterTable2(t *testing.T) {
 	}
 
 }
+
+func TestNewParserAlterTable3(t *testing.T) {
+	statement := []byte(`
+	ALTER TABLE users COMPRESS;
+`)
+
+	lexer := NewLexer(statement)
+	t.Log(string(statement))
+
+	parser := NewParser(lexer)
+	if parser == nil {
+		t.Fatal("expected non-nil parser")
+	}
+
+	stmt, err := parser.Parse()
+	if err != nil {
+		t.Fatal(err)
+
+	}
+
+	alterTableStmt, ok := stmt.(*AlterTableStmt)
+	if !ok {
+		t.Fatalf("expected *AlterTableStmt, got %T", stmt)
+	}
+
+	if alterTableStmt.TableName.Value != "users" {
+		t.Fatalf("expected users, got %s", alterTableStmt.TableName.Value)
+	}
+
+	if alterTableStmt.Storage != ALTER_TABLE_COMPRESS {
+		t.Fatalf("expected ALTER_TABLE_COMPRESS, got %d", alterTableStmt.Storage)
+	}
+
+}
+
+func TestNewParserAlterTable4(t *testing.T) {
+	statement := []byte(`
+	ALTER TABLE users SHARD BY user_id;
+`)
+
+	lexer := NewLexer(statement)
+	t.Log(string(statement))
+
+	parser := NewParser(lexer)
+	if parser == nil {
+		t.Fatal("expected non-nil parser")
+	}
+
+	stmt, err := parser.Parse()
+	if err != nil {
+		t.Fatal(err)
+
+	}
+
+	alterTableStmt, ok := stmt.(*AlterTableStmt)
+	if !ok {
+		t.Fatalf("expected *AlterTableStmt, got %T", stmt)
+	}
+
+	if alterTableStmt.TableName.Value != "users" {
+		t.Fatalf("expected users, got %s", alterTableStmt.TableName.Value)
+	}
+
+	if alterTableStmt.ShardKey == nil || alterTableStmt.ShardKey.Value != "user_id" {
+		t.Fatalf("expected shard key user_id, got %v", alterTableStmt.ShardKey)
+	}
+
+}
+
+func TestNewParserCreateShard(t *testing.T) {
+	statement := []byte(`
+	CREATE SHARD shard1 ON '10.0.0.1:3695';
+`)
+
+	lexer := NewLexer(statement)
+	t.Log(string(statement))
+
+	parser := NewParser(lexer)
+	if parser == nil {
+		t.Fatal("expected non-nil parser")
+	}
+
+	stmt, err := parser.Parse()
+	if err != nil {
+		t.Fatal(err)
+
+	}
+
+	createShardStmt, ok := stmt.(*CreateShardStmt)
+	if !ok {
+		t.Fatalf("expected *CreateShardStmt, got %T", stmt)
+	}
+
+	if createShardStmt.ShardName.Value != "shard1" {
+		t.Fatalf("expected shard1, got %s", createShardStmt.ShardName.Value)
+	}
+
+	if createShardStmt.Address.Value != "10.0.0.1:3695" {
+		t.Fatalf("expected 10.0.0.1:3695, got %s", createShardStmt.Address.Value)
+	}
+
+}
+
+func TestNewParserDropShard(t *testing.T) {
+	statement := []byte(`
+	DROP SHARD shard1;
+`)
+
+	lexer := NewLexer(statement)
+	t.Log(string(statement))
+
+	parser := NewParser(lexer)
+	if parser == nil {
+		t.Fatal("expected non-nil parser")
+	}
+
+	stmt, err := parser.Parse()
+	if err != nil {
+		t.Fatal(err)
+
+	}
+
+	dropShardStmt, ok := stmt.(*DropShardStmt)
+	if !ok {
+		t.Fatalf("expected *DropShardStmt, got %T", stmt)
+	}
+
+	if dropShardStmt.ShardName.Value != "shard1" {
+		t.Fatalf("expected shard1, got %s", dropShardStmt.ShardName.Value)
+	}
+
+}
+
+func TestNewParserExportTable(t *testing.T) {
+	statement := []byte(`
+	EXPORT TABLE users TO 'users.parquet' ROW GROUP SIZE 10000;
+`)
+
+	lexer := NewLexer(statement)
+	t.Log(string(statement))
+
+	parser := NewParser(lexer)
+	if parser == nil {
+		t.Fatal("expected non-nil parser")
+	}
+
+	stmt, err := parser.Parse()
+	if err != nil {
+		t.Fatal(err)
+
+	}
+
+	exportStmt, ok := stmt.(*ExportStmt)
+	if !ok {
+		t.Fatalf("expected *ExportStmt, got %T", stmt)
+	}
+
+	if exportStmt.TableName.Value != "users" {
+		t.Fatalf("expected users, got %s", exportStmt.TableName.Value)
+	}
+
+	if exportStmt.File.Value != "users.parquet" {
+		t.Fatalf("expected users.parquet, got %s", exportStmt.File.Value)
+	}
+
+	if exportStmt.RowGroupSize != 10000 {
+		t.Fatalf("expected 10000, got %d", exportStmt.RowGroupSize)
+	}
+
+}
+
+func TestNewParserExportQuery(t *testing.T) {
+	statement := []byte(`
+	EXPORT QUERY SELECT name, age FROM users WHERE age > 21 ORDER BY name TO 'adults.parquet';
+`)
+
+	lexer := NewLexer(statement)
+	t.Log(string(statement))
+
+	parser := NewParser(lexer)
+	if parser == nil {
+		t.Fatal("expected non-nil parser")
+	}
+
+	stmt, err := parser.Parse()
+	if err != nil {
+		t.Fatal(err)
+
+	}
+
+	exportStmt, ok := stmt.(*ExportStmt)
+	if !ok {
+		t.Fatalf("expected *ExportStmt, got %T", stmt)
+	}
+
+	if exportStmt.TableName != nil {
+		t.Fatalf("expected nil table name, got %s", exportStmt.TableName.Value)
+	}
+
+	if len(exportStmt.Query.SelectList.Expressions) != 2 {
+		t.Fatalf("expected 2 select list expressions, got %d", len(exportStmt.Query.SelectList.Expressions))
+	}
+
+	if exportStmt.Query.TableExpression.FromClause.Tables[0].Name.Value != "users" {
+		t.Fatalf("expected users, got %s", exportStmt.Query.TableExpression.FromClause.Tables[0].Name.Value)
+	}
+
+	if exportStmt.Query.TableExpression.WhereClause == nil || exportStmt.Query.TableExpression.OrderByClause == nil {
+		t.Fatal("expected where and order by clauses")
+	}
+
+	if exportStmt.File.Value != "adults.parquet" {
+		t.Fatalf("expected adults.parquet, got %s", exportStmt.File.Value)
+	}
+
+	if exportStmt.RowGroupSize != 0 {
+		t.Fatalf("expected 0, got %d", exportStmt.RowGroupSize)
+	}
+
+}
+
+func TestNewParserListen(t *testing.T) {
+	statement := []byte(`
+	LISTEN jobs;
+`)
+
+	lexer := NewLexer(statement)
+	t.Log(string(statement))
+
+	parser := NewParser(lexer)
+	if parser == nil {
+		t.Fatal("expected non-nil parser")
+	}
+
+	stmt, err := parser.Parse()
+	if err != nil {
+		t.Fatal(err)
+
+	}
+
+	listenStmt, ok := stmt.(*ListenStmt)
+	if !ok {
+		t.Fatalf("expected *ListenStmt, got %T", stmt)
+	}
+
+	if listenStmt.Channel.Value != "jobs" {
+		t.Fatalf("expected jobs, got %s", listenStmt.Channel.Value)
+	}
+
+}
+
+func TestNewParserUnlisten(t *testing.T) {
+	statement := []byte(`
+	UNLISTEN *;
+`)
+
+	lexer := NewLexer(statement)
+	t.Log(string(statement))
+
+	parser := NewParser(lexer)
+	if parser == nil {
+		t.Fatal("expected non-nil parser")
+	}
+
+	stmt, err := parser.Parse()
+	if err != nil {
+		t.Fatal(err)
+
+	}
+
+	unlistenStmt, ok := stmt.(*UnlistenStmt)
+	if !ok {
+		t.Fatalf("expected *UnlistenStmt, got %T", stmt)
+	}
+
+	if unlistenStmt.Channel.Value != "*" {
+		t.Fatalf("expected *, got %s", unlistenStmt.Channel.Value)
+	}
+
+}
+
+func TestNewParserNotify(t *testing.T) {
+	statement := []byte(`
+	NOTIFY jobs, 'it\'s ready';
+`)
+
+	lexer := NewLexer(statement)
+	t.Log(string(statement))
+
+	parser := NewParser(lexer)
+	if parser == nil {
+		t.Fatal("expected non-nil parser")
+	}
+
+	stmt, err := parser.Parse()
+	if err != nil {
+		t.Fatal(err)
+
+	}
+
+	notifyStmt, ok := stmt.(*NotifyStmt)
+	if !ok {
+		t.Fatalf("expected *NotifyStmt, got %T", stmt)
+	}
+
+	if notifyStmt.Channel.Value != "jobs" {
+		t.Fatalf("expected jobs, got %s", notifyStmt.Channel.Value)
+	}
+
+	if notifyStmt.Payload.Value != "it's ready" {
+		t.Fatalf("expected it's ready, got %s", notifyStmt.Payload.Value)
+	}
+
+}
+
+func TestNewParserShowIO(t *testing.T) {
+	statement := []byte(`
+	SHOW IO;
+`)
+
+	lexer := NewLexer(statement)
+	t.Log(string(statement))
+
+	parser := NewParser(lexer)
+	if parser == nil {
+		t.Fatal("expected non-nil parser")
+	}
+
+	stmt, err := parser.Parse()
+	if err != nil {
+		t.Fatal(err)
+
+	}
+
+	showStmt, ok := stmt.(*ShowStmt)
+	if !ok {
+		t.Fatalf("expected *ShowStmt, got %T", stmt)
+	}
+
+	if showStmt.ShowType != SHOW_IO {
+		t.Fatalf("expected SHOW_IO, got %d", showStmt.ShowType)
+	}
+
+}
+
+func TestNewParserCheckpoint(t *testing.T) {
+	stmt, err := NewParser(NewLexer([]byte("CHECKPOINT;"))).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := stmt.(*CheckpointStmt); !ok {
+		t.Fatalf("expected *CheckpointStmt, got %T", stmt)
+	}
+}
+
+func TestNewParserLoadIntoCache(t *testing.T) {
+	stmt, err := NewParser(NewLexer([]byte("LOAD INTO CACHE users, orders;"))).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	loadStmt, ok := stmt.(*LoadIntoCacheStmt)
+	if !ok {
+		t.Fatalf("expected *LoadIntoCacheStmt, got %T", stmt)
+	}
+
+	if len(loadStmt.TableNames) != 2 || loadStmt.TableNames[0].Value != "users" || loadStmt.TableNames[1].Value != "orders" {
+		t.Fatalf("unexpected tables %v", loadStmt.TableNames)
+	}
+
+	for statement, expected := range map[string]bool{
+		"ALTER TABLE users WARM ON;":  true,
+		"ALTER TABLE users WARM OFF;": false,
+	} {
+		stmt, err = NewParser(NewLexer([]byte(statement))).Parse()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		alterStmt, ok := stmt.(*AlterTableStmt)
+		if !ok || alterStmt.Warm == nil || *alterStmt.Warm != expected {
+			t.Fatalf("expected WARM %v for %s", expected, statement)
+		}
+	}
+
+	_, err = NewParser(NewLexer([]byte("ALTER TABLE users WARM;"))).Parse()
+	if err == nil || err.Error() != "expected ON or OFF" {
+		t.Fatalf("expected ON or OFF, got %v", err)
+	}
+}
+
+func TestNewParserResetStatistics(t *testing.T) {
+	statement := []byte(`
+	RESET STATISTICS;
+`)
+
+	lexer := NewLexer(statement)
+	t.Log(string(statement))
+
+	parser := NewParser(lexer)
+	if parser == nil {
+		t.Fatal("expected non-nil parser")
+	}
+
+	stmt, err := parser.Parse()
+	if err != nil {
+		t.Fatal(err)
+
+	}
+
+	if _, ok := stmt.(*ResetStatisticsStmt); !ok {
+		t.Fatalf("expected *ResetStatisticsStmt, got %T", stmt)
+	}
+
+	_, err = NewParser(NewLexer([]byte("RESET users;"))).Parse()
+	if err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestNewParserShowEngineStatus(t *testing.T) {
+	statement := []byte(`
+	SHOW ENGINE STATUS;
+`)
+
+	lexer := NewLexer(statement)
+	t.Log(string(statement))
+
+	parser := NewParser(lexer)
+	if parser == nil {
+		t.Fatal("expected non-nil parser")
+	}
+
+	stmt, err := parser.Parse()
+	if err != nil {
+		t.Fatal(err)
+
+	}
+
+	showStmt, ok := stmt.(*ShowStmt)
+	if !ok {
+		t.Fatalf("expected *ShowStmt, got %T", stmt)
+	}
+
+	if showStmt.ShowType != SHOW_ENGINE_STATUS {
+		t.Fatalf("expected SHOW_ENGINE_STATUS, got %d", showStmt.ShowType)
+	}
+
+	_, err = NewParser(NewLexer([]byte("SHOW ENGINE;"))).Parse()
+	if err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestNewParserShowProcesslist(t *testing.T) {
+	statement := []byte(`
+	SHOW PROCESSLIST;
+`)
+
+	lexer := NewLexer(statement)
+	t.Log(string(statement))
+
+	parser := NewParser(lexer)
+	if parser == nil {
+		t.Fatal("expected non-nil parser")
+	}
+
+	stmt, err := parser.Parse()
+	if err != nil {
+		t.Fatal(err)
+
+	}
+
+	showStmt, ok := stmt.(*ShowStmt)
+	if !ok {
+		t.Fatalf("expected *ShowStmt, got %T", stmt)
+	}
+
+	if showStmt.ShowType != SHOW_PROCESSLIST {
+		t.Fatalf("expected SHOW_PROCESSLIST, got %d", showStmt.ShowType)
+	}
+}
+
+func TestNewParserUTF8(t *testing.T) {
+	statement := []byte("INSERT INTO words (word) VALUES ('héllo 日本語');")
+
+	stmt, err := NewParser(NewLexer(statement)).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	insertStmt, ok := stmt.(*InsertStmt)
+	if !ok {
+		t.Fatalf("expected *InsertStmt, got %T", stmt)
+	}
+
+	// Multibyte characters are kept as they were sent
+	if insertStmt.Values[0][0].(*Literal).Value != "'héllo 日本語'" {
+		t.Fatalf("expected 'héllo 日本語', got %v", insertStmt.Values[0][0].(*Literal).Value)
+	}
+
+	_, err = NewParser(NewLexer([]byte("INSERT INTO words (word) VALUES ('h\xe9llo');"))).Parse()
+	if err == nil || err.Error() != "statement is not valid UTF-8" {
+		t.Fatalf("expected statement is not valid UTF-8, got %v", err)
+	}
+}
+
+func TestNewParserQuoteLiteral(t *testing.T) {
+	for _, value := range []string{"it's", "back\\slash", "\\", "\\'", "'); DROP TABLE users; --", "日本語", ""} {
+		statement := []byte("INSERT INTO notes (note) VALUES (" + shared.QuoteLiteral(value) + ");")
+
+		stmt, err := NewParser(NewLexer(statement)).Parse()
+		if err != nil {
+			t.Fatalf("%s: %s", statement, err)
+		}
+
+		insertStmt, ok := stmt.(*InsertStmt)
+		if !ok {
+			t.Fatalf("%s: expected *InsertStmt, got %T", statement, stmt)
+		}
+
+		// The quoted value is a single literal which reads back as the value
+		if len(insertStmt.Values) != 1 || len(insertStmt.Values[0]) != 1 {
+			t.Fatalf("%s: expected a single value", statement)
+		}
+
+		if shared.UnquoteLiteral(insertStmt.Values[0][0].(*Literal).Value.(string)) != value {
+			t.Fatalf("%s: expected %q, got %q", statement, value, insertStmt.Values[0][0].(*Literal).Value)
+		}
+	}
+
+	_, err := NewParser(NewLexer([]byte("INSERT INTO notes (note) VALUES ('C:\\temp');"))).Parse()
+	if err == nil || !strings.HasPrefix(err.Error(), "invalid escape sequence") {
+		t.Fatalf("expected invalid escape sequence, got %v", err)
+	}
+
+	_, err = NewParser(NewLexer([]byte("INSERT INTO notes (note) VALUES ('a\x00b');"))).Parse()
+	if err == nil || err.Error() != "statement contains a NUL byte" {
+		t.Fatalf("expected statement contains a NUL byte, got %v", err)
+	}
+
+	for name, valid := range map[string]bool{"users": true, "_tmp1": true, "1users": false, "users; DROP": false, "": false, "a.b": false} {
+		_, err = shared.QuoteIdentifier(name)
+		if (err == nil) != valid {
+			t.Fatalf("identifier %q: expected valid %v, got %v", name, valid, err)
+		}
+	}
+}
+
+func TestNewParserWith(t *testing.T) {
+	statement := []byte(`
+	WITH RECURSIVE chart (id, depth) AS (
+		SELECT id, 1 AS depth FROM employees WHERE manager_id = 0
+		UNION ALL
+		SELECT e.id, c.depth + 1 AS depth FROM employees e, chart c WHERE e.manager_id = c.id
+	), top AS (SELECT 1 AS id) SELECT id, depth FROM chart;
+`)
+
+	lexer := NewLexer(statement)
+	t.Log(string(statement))
+
+	parser := NewParser(lexer)
+	if parser == nil {
+		t.Fatal("expected non-nil parser")
+	}
+
+	stmt, err := parser.Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	selectStmt, ok := stmt.(*SelectStmt)
+	if !ok {
+		t.Fatalf("expected *SelectStmt, got %T", stmt)
+	}
+
+	if selectStmt.With == nil || !selectStmt.With.Recursive {
+		t.Fatal("expected a recursive WITH clause")
+	}
+
+	if len(selectStmt.With.CommonTableExpressions) != 2 {
+		t.Fatalf("expected 2 common table expressions, got %d", len(selectStmt.With.CommonTableExpressions))
+	}
+
+	chart := selectStmt.With.CommonTableExpressions[0]
+	if chart.Name.Value != "chart" || len(chart.Columns) != 2 || chart.Columns[0].Value != "id" || chart.Columns[1].Value != "depth" {
+		t.Fatalf("unexpected common table expression %v", chart)
+	}
+
+	// The first query is combined with the recursive query by UNION ALL
+	if !chart.Query.UnionAll || chart.Query.Union == nil {
+		t.Fatal("expected UNION ALL")
+	}
+
+	if chart.Query.Union.TableExpression.FromClause.Tables[1].Name.Value != "chart" || chart.Query.Union.TableExpression.FromClause.Tables[1].Alias.Value != "c" {
+		t.Fatal("expected the recursive query to read chart as c")
+	}
+
+	top := selectStmt.With.CommonTableExpressions[1]
+	if top.Name.Value != "top" || len(top.Columns) != 0 || top.Query.TableExpression != nil || top.Query.SelectList.Expressions[0].Alias.Value != "id" {
+		t.Fatalf("unexpected common table expression %v", top)
+	}
+
+	if selectStmt.TableExpression.FromClause.Tables[0].Name.Value != "chart" {
+		t.Fatal("expected the select to read chart")
+	}
+
+	for _, invalid := range []string{
+		"WITH chart AS SELECT 1 AS id;",
+		"WITH chart AS (SELECT 1 AS id) DELETE FROM chart;",
+		"WITH chart (id AS (SELECT 1 AS id) SELECT id FROM chart;",
+	} {
+		_, err = NewParser(NewLexer([]byte(invalid))).Parse()
+		if err == nil {
+			t.Fatalf("expected an error parsing %s", invalid)
+		}
+	}
+}
+
+func TestNewParserGroupingSets(t *testing.T) {
+	// names returns the columns of every grouping set
+	names := func(sets [][]*ValueExpression) [][]string {
+		columns := make([][]string, 0, len(sets))
+		for _, set := range sets {
+			names := []string{}
+			for _, expr := range set {
+				names = append(names, expr.Value.(*ColumnSpecification).ColumnName.Value)
+			}
+
+			columns = append(columns, names)
+		}
+
+		return columns
+	}
+
+	for _, test := range []struct {
+		statement string
+		expected  string
+	}{
+		{"SELECT region FROM sales GROUP BY ROLLUP (region, product);", "[[region product] [region] []]"},
+		{"SELECT region FROM sales GROUP BY CUBE (region, product);", "[[region product] [region] [product] []]"},
+		{"SELECT region FROM sales GROUP BY GROUPING SETS ((region, product), region, ());", "[[region product] [region] []]"},
+		{"SELECT region FROM sales GROUP BY year, ROLLUP (region);", "[[year region] [year]]"},
+	} {
+		stmt, err := NewParser(NewLexer([]byte(test.statement))).Parse()
+		if err != nil {
+			t.Fatalf("%s: %s", test.statement, err)
+		}
+
+		groupBy := stmt.(*SelectStmt).TableExpression.GroupByClause
+		if fmt.Sprint(names(groupBy.GroupingSets)) != test.expected {
+			t.Fatalf("%s: expected %s, got %v", test.statement, test.expected, names(groupBy.GroupingSets))
+		}
+	}
+
+	stmt, err := NewParser(NewLexer([]byte("SELECT region, GROUPING(region, product) AS level FROM sales GROUP BY ROLLUP (region, product) HAVING GROUPING(product) = 1;"))).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	selectStmt := stmt.(*SelectStmt)
+
+	groupingFunc, ok := selectStmt.SelectList.Expressions[1].Value.(*GroupingFunc)
+	if !ok || len(groupingFunc.Args) != 2 || selectStmt.SelectList.Expressions[1].Alias.Value != "level" {
+		t.Fatalf("expected GROUPING(region, product) AS level, got %v", selectStmt.SelectList.Expressions[1])
+	}
+
+	if _, ok := selectStmt.TableExpression.HavingClause.SearchCondition.(*ComparisonPredicate).Left.Value.(*GroupingFunc); !ok {
+		t.Fatal("expected GROUPING in the having clause")
+	}
+
+	// A plain GROUP BY has no grouping sets
+	stmt, err = NewParser(NewLexer([]byte("SELECT region FROM sales GROUP BY region, product;"))).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if stmt.(*SelectStmt).TableExpression.GroupByClause.GroupingSets != nil || len(stmt.(*SelectStmt).TableExpression.GroupByClause.GroupByExpressions) != 2 {
+		t.Fatal("expected a plain GROUP BY")
+	}
+}
+
+func TestNewParserPivot(t *testing.T) {
+	stmt, err := NewParser(NewLexer([]byte("SELECT * FROM sales PIVOT (SUM(amount) FOR product IN ('apple' AS apples, 'pear')) AS p WHERE region = 'east';"))).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	table := stmt.(*SelectStmt).TableExpression.FromClause.Tables[0]
+	if table.Pivot == nil {
+		t.Fatal("expected PIVOT")
+	}
+
+	if table.Pivot.Aggregate.FuncName != "SUM" || table.Pivot.For.ColumnName.Value != "product" {
+		t.Fatalf("expected SUM FOR product, got %s FOR %s", table.Pivot.Aggregate.FuncName, table.Pivot.For.ColumnName.Value)
+	}
+
+	if len(table.Pivot.Values) != 2 || table.Pivot.Values[0].Value.Value != "'apple'" || table.Pivot.Values[0].Alias.Value != "apples" || table.Pivot.Values[1].Alias != nil {
+		t.Fatalf("expected 'apple' AS apples, 'pear', got %v", table.Pivot.Values)
+	}
+
+	if table.Alias == nil || table.Alias.Value != "p" {
+		t.Fatal("expected alias p")
+	}
+
+	if stmt.(*SelectStmt).TableExpression.WhereClause == nil {
+		t.Fatal("expected where clause")
+	}
+
+	stmt, err = NewParser(NewLexer([]byte("SELECT * FROM wide UNPIVOT (amount FOR product IN (apple, pear));"))).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	table = stmt.(*SelectStmt).TableExpression.FromClause.Tables[0]
+	if table.Unpivot == nil || table.Unpivot.Value.Value != "amount" || table.Unpivot.For.Value != "product" || len(table.Unpivot.Columns) != 2 || table.Unpivot.Columns[1].Value != "pear" {
+		t.Fatalf("expected UNPIVOT (amount FOR product IN (apple, pear)), got %v", table.Unpivot)
+	}
+
+	_, err = NewParser(NewLexer([]byte("SELECT * FROM sales PIVOT (amount FOR product IN ('apple'));"))).Parse()
+	if err == nil {
+		t.Fatal("expected an aggregate function")
+	}
+}
+
+func TestNewParserTableFunction(t *testing.T) {
+	stmt, err := NewParser(NewLexer([]byte("SELECT n FROM generate_series(10, -2, -1.5) AS n WHERE n > 1;"))).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	table := stmt.(*SelectStmt).TableExpression.FromClause.Tables[0]
+	if table.Name.Value != "generate_series" || table.Alias == nil || table.Alias.Value != "n" {
+		t.Fatalf("expected generate_series AS n, got %v", table)
+	}
+
+	if fmt.Sprint(table.Args[0].Value, table.Args[1].Value, table.Args[2].Value) != "10 -2 -1.5" {
+		t.Fatalf("expected arguments 10, -2, -1.5, got %v %v %v", table.Args[0].Value, table.Args[1].Value, table.Args[2].Value)
+	}
+
+	stmt, err = NewParser(NewLexer([]byte("SELECT * FROM users;"))).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if stmt.(*SelectStmt).TableExpression.FromClause.Tables[0].Args != nil {
+		t.Fatal("expected a table")
+	}
+
+	_, err = NewParser(NewLexer([]byte("SELECT * FROM generate_series(1, -'a');"))).Parse()
+	if err == nil {
+		t.Fatal("expected a number")
+	}
+}
+
+func TestNewParserRandomAndHash(t *testing.T) {
+	stmt, err := NewParser(NewLexer([]byte("SELECT MD5(name) AS h, RANDOM(), UUID_V7() AS id FROM users WHERE SHA256(name) = 'x' ORDER BY RANDOM() LIMIT 1;"))).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	selectStmt := stmt.(*SelectStmt)
+
+	hashFunc, ok := selectStmt.SelectList.Expressions[0].Value.(*HashFunc)
+	if !ok || hashFunc.FuncName != "MD5" || hashFunc.Arg.(*ValueExpression).Value.(*ColumnSpecification).ColumnName.Value != "name" {
+		t.Fatalf("expected MD5(name), got %v", selectStmt.SelectList.Expressions[0].Value)
+	}
+
+	if _, ok := selectStmt.SelectList.Expressions[1].Value.(*RandomFunc); !ok {
+		t.Fatalf("expected RANDOM(), got %T", selectStmt.SelectList.Expressions[1].Value)
+	}
+
+	if _, ok := selectStmt.SelectList.Expressions[2].Value.(*shared.GenUUIDv7); !ok || selectStmt.SelectList.Expressions[2].Alias.Value != "id" {
+		t.Fatalf("expected UUID_V7() AS id, got %T", selectStmt.SelectList.Expressions[2].Value)
+	}
+
+	if _, ok := selectStmt.TableExpression.WhereClause.SearchCondition.(*ComparisonPredicate).Left.Value.(*HashFunc); !ok {
+		t.Fatal("expected SHA256 in the where clause")
+	}
+
+	if _, ok := selectStmt.TableExpression.OrderByClause.OrderByExpressions[0].Value.(*RandomFunc); !ok {
+		t.Fatal("expected ORDER BY RANDOM()")
+	}
+
+	stmt, err = NewParser(NewLexer([]byte("CREATE TABLE users (user_id UUID DEFAULT UUID_V7, name CHAR(8));"))).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := stmt.(*CreateTableStmt).TableSchema.ColumnDefinitions["user_id"].Default.(*shared.GenUUIDv7); !ok {
+		t.Fatal("expected DEFAULT UUID_V7")
+	}
+
+	for _, test := range []struct {
+		expr          interface{}
+		deterministic bool
+	}{
+		{&HashFunc{FuncName: "MD5", Arg: &ValueExpression{Value: &Literal{Value: "'a'"}}}, true},
+		{&UpperFunc{Arg: &ValueExpression{Value: &ColumnSpecification{ColumnName: &Identifier{Value: "name"}}}}, true},
+		{&RandomFunc{}, false},
+		{&shared.GenUUIDv7{}, false},
+		{&shared.SysDate{}, false},
+		{&BinaryExpression{Left: &Literal{Value: uint64(1)}, Op: OP_PLUS, Right: &RandomFunc{}}, false},
+		{&ConcatFunc{Args: []interface{}{&ValueExpression{Value: &shared.GenUUID{}}}}, false},
+	} {
+		if Deterministic(test.expr) != test.deterministic {
+			t.Fatalf("expected %T to be deterministic %v", test.expr, test.deterministic)
+		}
+	}
+}
+
+func TestNewParserCollate(t *testing.T) {
+	stmt, err := NewParser(NewLexer([]byte("SELECT * FROM users WHERE name COLLATE nocase = 'alex' AND city = 'Zurich' COLLATE 'de' ORDER BY name COLLATE 'en-u-kn-true' DESC;"))).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	selectStmt := stmt.(*SelectStmt)
+
+	and := selectStmt.TableExpression.WhereClause.SearchCondition.(*LogicalCondition)
+
+	left := and.Left.(*ComparisonPredicate)
+	if left.Left.Collation == nil || left.Left.Collation.Value != "nocase" || left.Right.Collation != nil {
+		t.Fatalf("expected name COLLATE nocase, got %v", left.Left.Collation)
+	}
+
+	right := and.Right.(*ComparisonPredicate)
+	if right.Right.Collation == nil || right.Right.Collation.Value != "de" || right.Right.Value.(*Literal).Value != "'Zurich'" {
+		t.Fatalf("expected 'Zurich' COLLATE 'de', got %v", right.Right.Collation)
+	}
+
+	orderBy := selectStmt.TableExpression.OrderByClause
+	if orderBy.OrderByExpressions[0].Collation == nil || orderBy.OrderByExpressions[0].Collation.Value != "en-u-kn-true" || orderBy.Order != DESC {
+		t.Fatal("expected ORDER BY name COLLATE 'en-u-kn-true' DESC")
+	}
+
+	_, err = NewParser(NewLexer([]byte("SELECT * FROM users ORDER BY name COLLATE;"))).Parse()
+	if err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestNewParserChecksumTable(t *testing.T) {
+	stmt, err := NewParser(NewLexer([]byte("CHECKSUM TABLE users, orders;"))).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checksumStmt, ok := stmt.(*ChecksumTableStmt)
+	if !ok {
+		t.Fatalf("expected *ChecksumTableStmt, got %T", stmt)
+	}
+
+	if len(checksumStmt.TableNames) != 2 || checksumStmt.TableNames[0].Value != "users" || checksumStmt.TableNames[1].Value != "orders" || checksumStmt.By != nil {
+		t.Fatalf("expected users and orders, got %v", checksumStmt.TableNames)
+	}
+
+	stmt, err = NewParser(NewLexer([]byte("CHECKSUM TABLE users BY user_id CHUNKS 16;"))).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checksumStmt = stmt.(*ChecksumTableStmt)
+	if checksumStmt.By == nil || checksumStmt.By.Value != "user_id" || checksumStmt.Chunks != 16 {
+		t.Fatalf("expected BY user_id CHUNKS 16, got %v %d", checksumStmt.By, checksumStmt.Chunks)
+	}
+
+	for _, statement := range []string{
+		"CHECKSUM users;",
+		"CHECKSUM TABLE users, orders BY user_id CHUNKS 16;",
+		"CHECKSUM TABLE users BY user_id;",
+		"CHECKSUM TABLE users BY user_id CHUNKS 0;",
+	} {
+		_, err = NewParser(NewLexer([]byte(statement))).Parse()
+		if err == nil {
+			t.Fatalf("expected error for %s", statement)
+		}
+	}
+}
+
+func TestNewParserAlterTableConstraint(t *testing.T) {
+	stmt, err := NewParser(NewLexer([]byte("ALTER TABLE orders ALTER COLUMN total ADD CHECK (total > 0) NOT VALID;"))).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	alterTableStmt, ok := stmt.(*AlterTableStmt)
+	if !ok {
+		t.Fatalf("expected *AlterTableStmt, got %T", stmt)
+	}
+
+	if alterTableStmt.ColumnName.Value != "total" || alterTableStmt.Constraint == nil || !alterTableStmt.Constraint.NotValid {
+		t.Fatalf("expected a check constraint NOT VALID on total, got %v", alterTableStmt.Constraint)
+	}
+
+	if _, ok := alterTableStmt.Constraint.Check.(*ComparisonPredicate); !ok {
+		t.Fatalf("expected *ComparisonPredicate, got %T", alterTableStmt.Constraint.Check)
+	}
+
+	stmt, err = NewParser(NewLexer([]byte("ALTER TABLE orders ALTER COLUMN user_id ADD REFERENCES users (user_id);"))).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	alterTableStmt = stmt.(*AlterTableStmt)
+	if alterTableStmt.Constraint.References == nil || alterTableStmt.Constraint.References.TableName != "users" || alterTableStmt.Constraint.References.ColumnName != "user_id" || alterTableStmt.Constraint.NotValid {
+		t.Fatalf("expected a foreign key on users, got %v", alterTableStmt.Constraint.References)
+	}
+
+	stmt, err = NewParser(NewLexer([]byte("ALTER TABLE orders VALIDATE CONSTRAINT orders_total_check;"))).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	alterTableStmt = stmt.(*AlterTableStmt)
+	if alterTableStmt.Validate == nil || alterTableStmt.Validate.Value != "orders_total_check" {
+		t.Fatalf("expected orders_total_check, got %v", alterTableStmt.Validate)
+	}
+
+	for _, statement := range []string{
+		"ALTER TABLE orders ALTER COLUMN total ADD UNIQUE;",
+		"ALTER TABLE orders ALTER COLUMN user_id ADD REFERENCES users (id);",
+		"ALTER TABLE orders ALTER COLUMN total ADD CHECK (total > 0) NOT NULL;",
+		"ALTER TABLE orders VALIDATE orders_total_check;",
+	} {
+		_, err = NewParser(NewLexer([]byte(statement))).Parse()
+		if err == nil {
+			t.Fatalf("expected error for %s", statement)
+		}
+	}
+}
+
+func TestNewParserCopy(t *testing.T) {
+	stmt, err := NewParser(NewLexer([]byte("COPY users (user_id, name) TO STDOUT;"))).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	copyStmt, ok := stmt.(*CopyStmt)
+	if !ok {
+		t.Fatalf("expected *CopyStmt, got %T", stmt)
+	}
+
+	if copyStmt.TableName.Value != "users" || len(copyStmt.ColumnNames) != 2 || copyStmt.ColumnNames[1].Value != "name" || copyStmt.From {
+		t.Fatalf("expected users (user_id, name) TO STDOUT, got %v", copyStmt)
+	}
+
+	stmt, err = NewParser(NewLexer([]byte("COPY users FROM STDIN;"))).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	copyStmt = stmt.(*CopyStmt)
+	if copyStmt.TableName.Value != "users" || len(copyStmt.ColumnNames) != 0 || !copyStmt.From {
+		t.Fatalf("expected users FROM STDIN, got %v", copyStmt)
+	}
+
+	stmt, err = NewParser(NewLexer([]byte("COPY (SELECT name FROM users WHERE user_id IN (1, 2)) TO STDOUT;"))).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	copyStmt = stmt.(*CopyStmt)
+	if copyStmt.Query == nil || copyStmt.TableName != nil || copyStmt.Query.TableExpression.WhereClause == nil {
+		t.Fatalf("expected a query, got %v", copyStmt)
+	}
+
+	for _, statement := range []string{
+		"COPY users TO 'users.txt';",
+		"COPY users;",
+		"COPY users (user_id TO STDOUT;",
+		"COPY (SELECT * FROM users) FROM STDIN;",
+		"COPY (SELECT * FROM users TO STDOUT;",
+	} {
+		_, err = NewParser(NewLexer([]byte(statement))).Parse()
+		if err == nil {
+			t.Fatalf("expected error for %s", statement)
+		}
+	}
+}
+
+func TestNewParserApplyMigration(t *testing.T) {
+	stmt, err := NewParser(NewLexer([]byte("APPLY MIGRATION 'add_orders' FROM '0002_add_orders.sql';"))).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	applyStmt, ok := stmt.(*ApplyMigrationStmt)
+	if !ok {
+		t.Fatalf("expected *ApplyMigrationStmt, got %T", stmt)
+	}
+
+	if applyStmt.Name.Value != "add_orders" || applyStmt.File.Value != "0002_add_orders.sql" {
+		t.Fatalf("expected add_orders from 0002_add_orders.sql, got %v %v", applyStmt.Name.Value, applyStmt.File.Value)
+	}
+
+	stmt, err = NewParser(NewLexer([]byte("SHOW MIGRATIONS;"))).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if stmt.(*ShowStmt).ShowType != SHOW_MIGRATIONS {
+		t.Fatalf("expected SHOW_MIGRATIONS, got %d", stmt.(*ShowStmt).ShowType)
+	}
+
+	for _, statement := range []string{
+		"APPLY 'add_orders' FROM 'a.sql';",
+		"APPLY MIGRATION add_orders FROM 'a.sql';",
+		"APPLY MIGRATION 'add_orders';",
+		"APPLY MIGRATION 'add_orders' FROM '';",
+	} {
+		_, err = NewParser(NewLexer([]byte(statement))).Parse()
+		if err == nil {
+			t.Fatalf("expected error for %s", statement)
+		}
+	}
+}
+
+func TestNewParserDescribe(t *testing.T) {
+	stmt, err := NewParser(NewLexer([]byte("DESCRIBE users, orders;"))).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	describeStmt, ok := stmt.(*DescribeStmt)
+	if !ok {
+		t.Fatalf("expected *DescribeStmt, got %T", stmt)
+	}
+
+	if len(describeStmt.TableNames) != 2 || describeStmt.TableNames[0].Value != "users" || describeStmt.TableNames[1].Value != "orders" {
+		t.Fatalf("expected users and orders, got %v", describeStmt.TableNames)
+	}
+
+	stmt, err = NewParser(NewLexer([]byte("DESCRIBE;"))).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(stmt.(*DescribeStmt).TableNames) != 0 {
+		t.Fatalf("expected every table, got %v", stmt.(*DescribeStmt).TableNames)
+	}
+
+	for _, statement := range []string{"DESCRIBE users,;", "DESCRIBE users orders;", "DESCRIBE 'users';"} {
+		_, err = NewParser(NewLexer([]byte(statement))).Parse()
+		if err == nil {
+			t.Fatalf("expected error for %s", statement)
+		}
+	}
+}
+
+func TestNewParserSetSession(t *testing.T) {
+	for _, statement := range []string{"SET trace = 'plan,io';", "SET SESSION trace TO 'plan,io';"} {
+		stmt, err := NewParser(NewLexer([]byte(statement))).Parse()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		setStmt, ok := stmt.(*SetSessionStmt)
+		if !ok {
+			t.Fatalf("expected *SetSessionStmt, got %T", stmt)
+		}
+
+		if setStmt.Name.Value != "trace" || setStmt.Value.Value != "plan,io" {
+			t.Fatalf("expected trace plan,io, got %s %v", setStmt.Name.Value, setStmt.Value.Value)
+		}
+	}
+
+	for _, statement := range []string{"SET trace;", "SET trace = plan;", "SET trace 'plan';", "SET trace = 'plan' 'io';"} {
+		_, err := NewParser(NewLexer([]byte(statement))).Parse()
+		if err == nil {
+			t.Fatalf("expected error for %s", statement)
+		}
+	}
+}
+
+func TestSplit(t *testing.T) {
+	script := []byte(`-- orders
+CREATE TABLE orders (order_id INT, note TEXT);
+INSERT INTO orders (order_id, note) VALUES (1, 'a;b');
+CREATE PROCEDURE close_order(@id INT)
+BEGIN
+	UPDATE orders SET note = 'closed' WHERE order_id = @id;
+	SELECT CASE WHEN order_id = 1 THEN 'one' ELSE 'other' END FROM orders;
+END;
+BEGIN;
+COMMIT;
+-- done
+`)
+
+	statements, err := Split(script)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(statements) != 5 {
+		t.Fatalf("expected 5 statements, got %d %q", len(statements), statements)
+	}
+
+	if !strings.HasSuffix(string(statements[1]), "VALUES (1, 'a;b');") || !strings.HasSuffix(string(statements[2]), "END;") || strings.TrimSpace(string(statements[3])) != "BEGIN;" {
+		t.Fatalf("unexpected statements %q", statements)
+	}
+
+	for _, statement := range statements {
+		_, err = NewParser(NewLexer(statement)).Parse()
+		if err != nil {
+			t.Fatalf("%s: %s", statement, err.Error())
+		}
+	}
+
+	_, err = Split([]byte("CREATE TABLE orders (order_id INT);\nDROP TABLE orders"))
+	if err == nil {
+		t.Fatal("expected error for a statement without a semicolon")
+	}
+}
+
+func TestNewParserSelectAsOf(t *testing.T) {
+	statement := []byte(`
+	SELECT * FROM users AS OF TIMESTAMP '2024-06-01 12:00:00' u WHERE u.user_id = 1;
+`)
+
+	lexer := NewLexer(statement)
+	t.Log(string(statement))
+
+	parser := NewParser(lexer)
+	if parser == nil {
+		t.Fatal("expected non-nil parser")
+	}
+
+	stmt, err := parser.Parse()
+	if err != nil {
+		t.Fatal(err)
+
+	}
+
+	selectStmt, ok := stmt.(*SelectStmt)
+	if !ok {
+		t.Fatalf("expected *SelectStmt, got %T", stmt)
+	}
+
+	tbl := selectStmt.TableExpression.FromClause.Tables[0]
+
+	if tbl.Name.Value != "users" {
+		t.Fatalf("expected users, got %s", tbl.Name.Value)
+	}
+
+	if tbl.AsOf == nil || tbl.AsOf.Value != "'2024-06-01 12:00:00'" {
+		t.Fatalf("expected AS OF '2024-06-01 12:00:00', got %v", tbl.AsOf)
+	}
+
+	if tbl.Alias == nil || tbl.Alias.Value != "u" {
+		t.Fatalf("expected alias u, got %v", tbl.Alias)
+	}
+
+	_, err = NewParser(NewLexer([]byte("SELECT * FROM users AS OF 1;"))).Parse()
+	if err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestNewParserCreateTableSystemVersioning(t *testing.T) {
+	statement := []byte(`
+	CREATE TABLE users (user_id INT, name CHAR(50), COMPRESS) WITH SYSTEM VERSIONING;
+`)
+
+	lexer := NewLexer(statement)
+	t.Log(string(statement))
+
+	parser := NewParser(lexer)
+	if parser == nil {
+		t.Fatal("expected non-nil parser")
+	}
+
+	stmt, err := parser.Parse()
+	if err != nil {
+		t.Fatal(err)
+
+	}
+
+	createTableStmt, ok := stmt.(*CreateTableStmt)
+	if !ok {
+		t.Fatalf("expected *CreateTableStmt, got %T", stmt)
+	}
+
+	if !createTableStmt.TableSchema.SystemVersioned {
+		t.Fatal("expected system versioned table")
+	}
+
+	if !createTableStmt.Compress {
+		t.Fatal("expected compressed table")
+	}
+
+	_, err = NewParser(NewLexer([]byte("CREATE TABLE users (user_id INT) WITH SYSTEM;"))).Parse()
+	if err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestNewParserCreateDatabaseSettings(t *testing.T) {
+	statement := []byte(`
+	CREATE DATABASE test WITH (compress = true, ENCRYPT = false, collation = 'nocase');
+`)
+
+	lexer := NewLexer(statement)
+	t.Log(string(statement))
+
+	parser := NewParser(lexer)
+	if parser == nil {
+		t.Fatal("expected non-nil parser")
+	}
+
+	stmt, err := parser.Parse()
+	if err != nil {
+		t.Fatal(err)
+
+	}
+
+	createDatabaseStmt, ok := stmt.(*CreateDatabaseStmt)
+	if !ok {
+		t.Fatalf("expected *CreateDatabaseStmt, got %T", stmt)
+	}
+
+	if createDatabaseStmt.Name.Value != "test" {
+		t.Fatalf("expected test, got %s", createDatabaseStmt.Name.Value)
+	}
+
+	if len(createDatabaseStmt.Defaults) != 3 {
+		t.Fatalf("expected 3 settings, got %d", len(createDatabaseStmt.Defaults))
+	}
+
+	if createDatabaseStmt.Defaults["compress"].Value != true || createDatabaseStmt.Defaults["encrypt"].Value != false || createDatabaseStmt.Defaults["collation"].Value != "nocase" {
+		t.Fatalf("unexpected settings %v", createDatabaseStmt.Defaults)
+	}
+
+	stmt, err = NewParser(NewLexer([]byte("CREATE TABLE users (user_id INT, name CHAR(50)) WITH (compress = false) WITH SYSTEM VERSIONING;"))).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	createTableStmt, ok := stmt.(*CreateTableStmt)
+	if !ok {
+		t.Fatalf("expected *CreateTableStmt, got %T", stmt)
+	}
+
+	if createTableStmt.Settings["compress"].Value != false || !createTableStmt.TableSchema.SystemVersioned {
+		t.Fatalf("unexpected table %v", createTableStmt.Settings)
+	}
+
+	for _, stmt := range []string{
+		"CREATE DATABASE test WITH (compress);",
+		"CREATE DATABASE test WITH (compress = true, compress = false);",
+		"CREATE DATABASE test WITH (compress = true;",
+		"CREATE DATABASE test WITH compress = true;",
+	} {
+		_, err = NewParser(NewLexer([]byte(stmt))).Parse()
+		if err == nil {
+			t.Fatalf("expected error for %s", stmt)
+		}
+	}
+}
+
+func TestNewParserSelectForSystemTime(t *testing.T) {
+	statement := []byte(`
+	SELECT * FROM users FOR SYSTEM_TIME BETWEEN '2024-06-01 00:00:00' AND '2024-06-02 00:00:00' u WHERE u.user_id = 1;
+`)
+
+	lexer := NewLexer(statement)
+	t.Log(string(statement))
+
+	parser := NewParser(lexer)
+	if parser == nil {
+		t.Fatal("expected non-nil parser")
+	}
+
+	stmt, err := parser.Parse()
+	if err != nil {
+		t.Fatal(err)
+
+	}
+
+	selectStmt, ok := stmt.(*SelectStmt)
+	if !ok {
+		t.Fatalf("expected *SelectStmt, got %T", stmt)
+	}
+
+	tbl := selectStmt.TableExpression.FromClause.Tables[0]
+
+	if len(tbl.Between) != 2 || tbl.Between[0].Value != "'2024-06-01 00:00:00'" || tbl.Between[1].Value != "'2024-06-02 00:00:00'" {
+		t.Fatalf("expected BETWEEN '2024-06-01 00:00:00' AND '2024-06-02 00:00:00', got %v", tbl.Between)
+	}
+
+	if tbl.Alias == nil || tbl.Alias.Value != "u" {
+		t.Fatalf("expected alias u, got %v", tbl.Alias)
+	}
+
+	stmt, err = NewParser(NewLexer([]byte("SELECT * FROM users FOR SYSTEM_TIME AS OF '2024-06-01 12:00:00';"))).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tbl = stmt.(*SelectStmt).TableExpression.FromClause.Tables[0]
+	if tbl.AsOf == nil || tbl.AsOf.Value != "'2024-06-01 12:00:00'" {
+		t.Fatalf("expected AS OF '2024-06-01 12:00:00', got %v", tbl.AsOf)
+	}
+
+	_, err = NewParser(NewLexer([]byte("SELECT * FROM users FOR SYSTEM_TIME BETWEEN '2024-06-01 00:00:00';"))).Parse()
+	if err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestNewParserAlterIndex(t *testing.T) {
+	statement := []byte(`
+	ALTER INDEX idx_name ON users RENAME TO idx_full_name;
+`)
+
+	lexer := NewLexer(statement)
+	t.Log(string(statement))
+
+	parser := NewParser(lexer)
+	if parser == nil {
+		t.Fatal("expected non-nil parser")
+	}
+
+	stmt, err := parser.Parse()
+	if err != nil {
+		t.Fatal(err)
+
+	}
+
+	alterIndexStmt, ok := stmt.(*AlterIndexStmt)
+	if !ok {
+		t.Fatalf("expected *AlterIndexStmt, got %T", stmt)
+	}
+
+	if alterIndexStmt.IndexName.Value != "idx_name" {
+		t.Fatalf("expected idx_name, got %s", alterIndexStmt.IndexName.Value)
+	}
+
+	if alterIndexStmt.TableName.Value != "users" {
+		t.Fatalf("expected users, got %s", alterIndexStmt.TableName.Value)
+	}
+
+	if alterIndexStmt.NewName.Value != "idx_full_name" {
+		t.Fatalf("expected idx_full_name, got %s", alterIndexStmt.NewName.Value)
+	}
+
+	_, err = NewParser(NewLexer([]byte("ALTER INDEX idx_name ON users RENAME idx_full_name;"))).Parse()
+	if err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestNewParserAlterIndexInvisible(t *testing.T) {
+	for statement, visibility := range map[string]AlterIndexVisibility{
+		"ALTER INDEX idx_name ON users INVISIBLE;": ALTER_INDEX_INVISIBLE,
+		"ALTER INDEX idx_name ON users visible;":   ALTER_INDEX_VISIBLE,
+	} {
+		t.Log(statement)
+
+		stmt, err := NewParser(NewLexer([]byte(statement))).Parse()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		alterIndexStmt, ok := stmt.(*AlterIndexStmt)
+		if !ok {
+			t.Fatalf("expected *AlterIndexStmt, got %T", stmt)
+		}
+
+		if alterIndexStmt.Visibility != visibility {
+			t.Fatalf("expected %d, got %d", visibility, alterIndexStmt.Visibility)
+		}
+
+		if alterIndexStmt.NewName != nil {
+			t.Fatalf("expected no new name, got %s", alterIndexStmt.NewName.Value)
+		}
+	}
+
+	_, err := NewParser(NewLexer([]byte("ALTER INDEX idx_name ON users HIDDEN;"))).Parse()
+	if err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestNewParserCreateBloomFilter(t *testing.T) {
+	stmt, err := NewParser(NewLexer([]byte("CREATE BLOOM FILTER bf_email ON users (email);"))).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	createBloomFilterStmt, ok := stmt.(*CreateBloomFilterStmt)
+	if !ok {
+		t.Fatalf("expected *CreateBloomFilterStmt, got %T", stmt)
+	}
+
+	if createBloomFilterStmt.FilterName.Value != "bf_email" {
+		t.Fatalf("expected bf_email, got %s", createBloomFilterStmt.FilterName.Value)
+	}
+
+	if createBloomFilterStmt.TableName.Value != "users" {
+		t.Fatalf("expected users, got %s", createBloomFilterStmt.TableName.Value)
+	}
+
+	if createBloomFilterStmt.ColumnName.Value != "email" {
+		t.Fatalf("expected email, got %s", createBloomFilterStmt.ColumnName.Value)
+	}
+
+	_, err = NewParser(NewLexer([]byte("CREATE BLOOM FILTER bf_email ON users (email, name);"))).Parse()
+	if err == nil {
+		t.Fatal("expected error for a bloom filter on more than one column")
+	}
+}
+
+func TestNewParserDropBloomFilter(t *testing.T) {
+	stmt, err := NewParser(NewLexer([]byte("drop bloom filter bf_email ON users;"))).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dropBloomFilterStmt, ok := stmt.(*DropBloomFilterStmt)
+	if !ok {
+		t.Fatalf("expected *DropBloomFilterStmt, got %T", stmt)
+	}
+
+	if dropBloomFilterStmt.FilterName.Value != "bf_email" {
+		t.Fatalf("expected bf_email, got %s", dropBloomFilterStmt.FilterName.Value)
+	}
+
+	if dropBloomFilterStmt.TableName.Value != "users" {
+		t.Fatalf("expected users, got %s", dropBloomFilterStmt.TableName.Value)
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	for query, expected := range map[string]string{
+		"SELECT * FROM users WHERE user_id = 1;":                                      "SELECT * FROM users WHERE user_id = ?",
+		"select *  from users\n where user_id = -42; -- by id":                        "SELECT * FROM users WHERE user_id = ?",
+		"INSERT INTO users (user_id, name) VALUES (1, 'john'), (2, 'jane');":          "INSERT INTO users (user_id, name) VALUES (...)",
+		"SELECT * FROM users WHERE user_id IN (1, 2, 3) AND age - 1 > 2.5;":           "SELECT * FROM users WHERE user_id IN (...) AND age - ? > ?",
+		"SELECT COALESCE(name, 'none') FROM users WHERE active = TRUE;":               "SELECT COALESCE (name, ?) FROM users WHERE active = ?",
+		"UPDATE users SET name = 'jane' WHERE user_id = 2; /* from the admin page */": "UPDATE users SET name = ? WHERE user_id = ?",
+	} {
+		if Normalize([]byte(query)) != expected {
+			t.Fatalf("expected %s, got %s", expected, Normalize([]byte(query)))
+		}
+	}
+}
+
+func TestNewParserMoveTable(t *testing.T) {
+	statement := []byte(`
+	MOVE TABLE orders TO TIER cold;
+`)
+
+	lexer := NewLexer(statement)
+	t.Log(string(statement))
+
+	parser := NewParser(lexer)
+	if parser == nil {
+		t.Fatal("expected non-nil parser")
+	}
+
+	stmt, err := parser.Parse()
+	if err != nil {
+		t.Fatal(err)
+
+	}
+
+	moveTableStmt, ok := stmt.(*MoveTableStmt)
+	if !ok {
+		t.Fatalf("expected *MoveTableStmt, got %T", stmt)
+	}
+
+	if moveTableStmt.TableName.Value != "orders" {
+		t.Fatalf("expected orders, got %s", moveTableStmt.TableName.Value)
+	}
+
+	if moveTableStmt.Tier != "COLD" {
+		t.Fatalf("expected COLD, got %s", moveTableStmt.Tier)
+	}
+
+	for _, stmt := range []string{
+		"MOVE TABLE orders TO TIER warm;",
+		"MOVE TABLE orders TO COLD;",
+		"MOVE PARTITION orders TO TIER COLD;",
+		"MOVE TABLE orders TO TIER COLD NOW;",
+	} {
+		_, err = NewParser(NewLexer([]byte(stmt))).Parse()
+		if err == nil {
+			t.Fatalf("expected error for %s", stmt)
+		}
+	}
+}
+
+func TestNewParserSetTransaction(t *testing.T) {
+	statement := []byte(`
+	SET TRANSACTION ISOLATION LEVEL serializable;
+`)
+
+	lexer := NewLexer(statement)
+	t.Log(string(statement))
+
+	parser := NewParser(lexer)
+	if parser == nil {
+		t.Fatal("expected non-nil parser")
+	}
+
+	stmt, err := parser.Parse()
+	if err != nil {
+		t.Fatal(err)
+
+	}
+
+	setTransactionStmt, ok := stmt.(*SetTransactionStmt)
+	if !ok {
+		t.Fatalf("expected *SetTransactionStmt, got %T", stmt)
+	}
+
+	if setTransactionStmt.Isolation != "SERIALIZABLE" {
+		t.Fatalf("expected SERIALIZABLE, got %s", setTransactionStmt.Isolation)
+	}
+
+	stmt, err = NewParser(NewLexer([]byte("SET SESSION TRANSACTION ISOLATION LEVEL READ COMMITTED;"))).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if stmt.(*SetTransactionStmt).Isolation != "READ COMMITTED" {
+		t.Fatalf("expected READ COMMITTED, got %s", stmt.(*SetTransactionStmt).Isolation)
+	}
+
+	stmt, err = NewParser(NewLexer([]byte("SET TRANSACTION ISOLATION LEVEL repeatable read;"))).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if stmt.(*SetTransactionStmt).Isolation != "REPEATABLE READ" {
+		t.Fatalf("expected REPEATABLE READ, got %s", stmt.(*SetTransactionStmt).Isolation)
+	}
+
+	for _, stmt := range []string{
+		"SET TRANSACTION ISOLATION LEVEL READ UNCOMMITTED;",
+		"SET TRANSACTION ISOLATION SERIALIZABLE;",
+		"SET TRANSACTION LEVEL SERIALIZABLE;",
+		"SET TRANSACTION ISOLATION LEVEL;",
+		"SET TRANSACTION ISOLATION LEVEL SERIALIZABLE NOW;",
+	} {
+		_, err = NewParser(NewLexer([]byte(stmt))).Parse()
+		if err == nil {
+			t.Fatalf("expected error for %s", stmt)
+		}
+	}
+}
+
+func TestNewParserShowIndexAdvice(t *testing.T) {
+	statement := []byte(`
+	SHOW INDEX ADVICE;
+`)
+
+	lexer := NewLexer(statement)
+	t.Log(string(statement))
+
+	parser := NewParser(lexer)
+	if parser == nil {
+		t.Fatal("expected non-nil parser")
+	}
+
+	stmt, err := parser.Parse()
+	if err != nil {
+		t.Fatal(err)
+
+	}
+
+	showStmt, ok := stmt.(*ShowStmt)
+	if !ok {
+		t.Fatalf("expected *ShowStmt, got %T", stmt)
+	}
+
+	if showStmt.ShowType != SHOW_INDEX_ADVICE {
+		t.Fatalf("expected SHOW_INDEX_ADVICE, got %d", showStmt.ShowType)
+	}
+
+	_, err = NewParser(NewLexer([]byte("SHOW INDEX users;"))).Parse()
+	if err == nil {
+		t.Fatal("expected error for SHOW INDEX without ADVICE")
+	}
+}
+
+func TestNewParserShowOptimizerTrace(t *testing.T) {
+	statement := []byte(`
+	SHOW OPTIMIZER TRACE;
+`)
+
+	lexer := NewLexer(statement)
+	t.Log(string(statement))
+
+	parser := NewParser(lexer)
+	if parser == nil {
+		t.Fatal("expected non-nil parser")
+	}
+
+	stmt, err := parser.Parse()
+	if err != nil {
+		t.Fatal(err)
+
+	}
+
+	showStmt, ok := stmt.(*ShowStmt)
+	if !ok {
+		t.Fatalf("expected *ShowStmt, got %T", stmt)
+	}
+
+	if showStmt.ShowType != SHOW_OPTIMIZER_TRACE {
+		t.Fatalf("expected SHOW_OPTIMIZER_TRACE, got %d", showStmt.ShowType)
+	}
+
+	_, err = NewParser(NewLexer([]byte("SHOW OPTIMIZER;"))).Parse()
+	if err == nil {
+		t.Fatal("expected error for SHOW OPTIMIZER without TRACE")
+	}
+
+	// Switches are set unquoted
+	for statement, value := range map[string]string{"SET optimizer_trace = ON;": "ON", "SET optimizer_trace TO off;": "off"} {
+		stmt, err := NewParser(NewLexer([]byte(statement))).Parse()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		setStmt, ok := stmt.(*SetSessionStmt)
+		if !ok || setStmt.Name.Value != "optimizer_trace" || setStmt.Value.Value != value {
+			t.Fatalf("expected optimizer_trace %s, got %+v", value, stmt)
+		}
+	}
+}
+
+func TestNewParserPrepare(t *testing.T) {
+	stmt, err := NewParser(NewLexer([]byte("PREPARE set_name AS UPDATE users SET name = $1 WHERE user_id = $2;"))).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	prepareStmt, ok := stmt.(*PrepareStmt)
+	if !ok {
+		t.Fatalf("expected *PrepareStmt, got %T", stmt)
+	}
+
+	if prepareStmt.Name.Value != "set_name" || prepareStmt.Parameters != 2 {
+		t.Fatalf("expected set_name with 2 parameters, got %+v", prepareStmt)
+	}
+
+	updateStmt, ok := prepareStmt.Stmt.(*UpdateStmt)
+	if !ok {
+		t.Fatalf("expected *UpdateStmt, got %T", prepareStmt.Stmt)
+	}
+
+	if placeholder, ok := updateStmt.SetClause[0].Value.Value.(*Placeholder); !ok || placeholder.Position != 1 {
+		t.Fatalf("expected $1, got %+v", updateStmt.SetClause[0].Value.Value)
+	}
+
+	stmt, err = NewParser(NewLexer([]byte("EXECUTE set_name USING ('alex', 1), (NULL, -2);"))).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	executeStmt, ok := stmt.(*ExecutePreparedStmt)
+	if !ok {
+		t.Fatalf("expected *ExecutePreparedStmt, got %T", stmt)
+	}
+
+	if len(executeStmt.Values) != 2 || executeStmt.Values[0][0].Value != "'alex'" || executeStmt.Values[1][0].Value != nil || executeStmt.Values[1][1].Value != -2 {
+		t.Fatalf("expected 2 sets of values, got %+v", executeStmt.Values)
+	}
+
+	stmt, err = NewParser(NewLexer([]byte("DEALLOCATE PREPARE set_name;"))).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if deallocateStmt, ok := stmt.(*DeallocatePrepareStmt); !ok || deallocateStmt.Name.Value != "set_name" {
+		t.Fatalf("expected DEALLOCATE PREPARE set_name, got %+v", stmt)
+	}
+
+	for _, statement := range []string{
+		"SELECT * FROM users WHERE user_id = $1;",
+		"PREPARE all_users AS SELECT * FROM users;",
+		"EXECUTE set_name USING 'alex', 1;",
+	} {
+		_, err = NewParser(NewLexer([]byte(statement))).Parse()
+		if err == nil {
+			t.Fatalf("expected error for %s", statement)
+		}
+	}
+}
+
+func TestNewParserCreateProcedureSecurity(t *testing.T) {
+	for statement, definer := range map[string]bool{
+		"CREATE PROCEDURE list_users() SECURITY DEFINER BEGIN SELECT * FROM users; END;": true,
+		"CREATE PROCEDURE list_users() security invoker BEGIN SELECT * FROM users; END;": false,
+		"CREATE PROCEDURE list_users() BEGIN SELECT * FROM users; END;":                  false,
+	} {
+		stmt, err := NewParser(NewLexer([]byte(statement))).Parse()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		createProcedureStmt, ok := stmt.(*CreateProcedureStmt)
+		if !ok {
+			t.Fatalf("expected *CreateProcedureStmt, got %T", stmt)
+		}
+
+		if createProcedureStmt.Procedure.SecurityDefiner != definer {
+			t.Fatalf("expected SecurityDefiner %v for %s", definer, statement)
+		}
+	}
+
+	for _, statement := range []string{
+		"CREATE PROCEDURE list_users() SECURITY OWNER BEGIN SELECT * FROM users; END;",
+		"CREATE PROCEDURE list_users() SECURITY DEFINER BEGIN USE other; SELECT * FROM users; END;",
+		"CREATE PROCEDURE list_users() SECURITY DEFINER BEGIN EXECUTE set_name USING ('alex', 1); END;",
+	} {
+		_, err := NewParser(NewLexer([]byte(statement))).Parse()
+		if err == nil {
+			t.Fatalf("expected error for %s", statement)
+		}
+	}
+
+	// USE is allowed in a procedure running with the privileges of the caller
+	_, err := NewParser(NewLexer([]byte("CREATE PROCEDURE list_users() BEGIN USE other; SELECT * FROM users; END;"))).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestNewParserShowPlanCache(t *testing.T) {
+	for statement, showType := range map[string]ShowType{"SHOW PLAN CACHE;": SHOW_PLAN_CACHE, "SHOW PLAN CACHE STATUS;": SHOW_PLAN_CACHE_STATUS} {
+		stmt, err := NewParser(NewLexer([]byte(statement))).Parse()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		showStmt, ok := stmt.(*ShowStmt)
+		if !ok {
+			t.Fatalf("expected *ShowStmt, got %T", stmt)
+		}
+
+		if showStmt.ShowType != showType {
+			t.Fatalf("expected %d, got %d", showType, showStmt.ShowType)
+		}
+	}
+
+	_, err := NewParser(NewLexer([]byte("SHOW PLAN;"))).Parse()
+	if err == nil {
+		t.Fatal("expected error for SHOW PLAN without CACHE")
+	}
+}
+
+func TestKeywords(t *testing.T) {
+	words := Keywords()
+
+	if !slices.IsSorted(words) {
+		t.Fatal("expected keywords sorted")
+	}
+
+	if !slices.Contains(words, "SELECT") || !slices.Contains(words, "INT") {
+		t.Fatalf("expected keywords and data types, got %v", words)
+	}
+
+	if len(slices.Compact(slices.Clone(words))) != len(words) {
+		t.Fatal("expected no duplicate keywords")
+	}
+}
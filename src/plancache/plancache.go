@@ -0,0 +1,289 @@
+// Package plancache
+// AriaSQL plan cache package
+// Copyright (C) AriaSQL
+// Author(s): Alex Gaetano Padula
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+package plancache
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const DEFAULT_MAX_PLANS = 1000 // Plans kept if not configured, the least recently used is evicted for a new one
+const STALE_MIN_ROWS = 100     // A plan of tables with fewer rows than this, when planned and now, is never stale
+
+// Access is how a column compared by a statement is read
+type Access struct {
+	Table  string // Table of the column
+	Column string // Column compared
+	Index  string // Index the column is looked up in, empty if the table is read with a full scan
+}
+
+// Plan is the plan of a normalized statement within a database
+type Plan struct {
+	Database  string           // Database the statement was planned in
+	Statement string           // Normalized statement, literals replaced by ?
+	Step      int              // Filter of the statement planned, a statement with subqueries plans several
+	Rows      map[string]int64 // Rows of the tables read when the statement was planned
+	Access    []Access         // How the columns compared are read
+	Hits      int64            // Executions the plan was reused by
+	Created   time.Time        // When the statement was planned
+	used      uint64           // Cache clock when the plan was last used
+}
+
+// Index returns the index a column of a table is looked up in, empty if the table is read with a full scan
+// False is returned if the column was not planned or the plan is nil
+func (p *Plan) Index(table, column string) (string, bool) {
+	if p == nil {
+		return "", false
+	}
+
+	for _, access := range p.Access {
+		if access.Table == table && access.Column == column {
+			return access.Index, true
+		}
+	}
+
+	return "", false
+}
+
+// String returns how the plan reads the columns compared
+// i.e orders.order_id INDEX SCAN unique_order_id, orders.status FULL SCAN
+func (p *Plan) String() string {
+	access := make([]string, len(p.Access))
+
+	for i, a := range p.Access {
+		if a.Index == "" {
+			access[i] = fmt.Sprintf("%s.%s FULL SCAN", a.Table, a.Column)
+		} else {
+			access[i] = fmt.Sprintf("%s.%s INDEX SCAN %s", a.Table, a.Column, a.Index)
+		}
+	}
+
+	return strings.Join(access, ", ")
+}
+
+// Tables returns the tables the plan reads, sorted
+func (p *Plan) Tables() []string {
+	tables := make([]string, 0, len(p.Rows))
+	for table := range p.Rows {
+		tables = append(tables, table)
+	}
+
+	sort.Strings(tables)
+
+	return tables
+}
+
+// Stats are the lookups of the cache since the server started
+type Stats struct {
+	Plans         int   // Plans cached
+	Max           int   // Plans kept at most
+	Hits          int64 // Lookups which found a plan
+	Misses        int64 // Lookups which did not, the statement was planned
+	Invalidations int64 // Plans removed as a table they read was altered, dropped or its rows changed
+	Evictions     int64 // Plans removed for a new plan once the cache was full
+}
+
+// key identifies the plan of a statement
+type key struct {
+	database, statement string
+	step                int
+}
+
+// Cache keeps the plans of statements of every session
+type Cache struct {
+	plans map[key]*Plan // Plans by database, statement and step
+	max   int           // Max amount of plans kept
+	clock uint64        // Advanced on every lookup, the least recently used plan is evicted
+	stats Stats         // Lookups since the cache was created
+	lock  *sync.Mutex   // Plans lock
+}
+
+// New returns a new plan cache keeping up to max plans, 0 is DEFAULT_MAX_PLANS
+func New(max int) *Cache {
+	if max <= 0 {
+		max = DEFAULT_MAX_PLANS
+	}
+
+	return &Cache{plans: make(map[key]*Plan), max: max, lock: &sync.Mutex{}}
+}
+
+// Get returns the plan of a statement, nil if it was not planned
+// rows returns the rows of a table the plan reads now, a plan is invalidated once the rows of a table it reads doubled or halved
+func (c *Cache) Get(database, statement string, step int, rows func(table string) int64) *Plan {
+	if c == nil {
+		return nil
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	k := key{database: database, statement: statement, step: step}
+
+	plan, ok := c.plans[k]
+	if !ok {
+		c.stats.Misses++
+		return nil
+	}
+
+	for table, planned := range plan.Rows {
+		if stale(planned, rows(table)) {
+			delete(c.plans, k)
+			c.stats.Invalidations++
+			c.stats.Misses++
+
+			return nil
+		}
+	}
+
+	c.clock++
+	plan.used = c.clock
+	plan.Hits++
+	c.stats.Hits++
+
+	return plan
+}
+
+// Put caches the plan of a statement, the least recently used plan is evicted if the cache is full
+func (c *Cache) Put(plan *Plan) {
+	if c == nil {
+		return
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	k := key{database: plan.Database, statement: plan.Statement, step: plan.Step}
+
+	if _, ok := c.plans[k]; !ok && len(c.plans) >= c.max {
+		c.evict()
+	}
+
+	c.clock++
+	plan.used = c.clock
+
+	if plan.Created.IsZero() {
+		plan.Created = time.Now()
+	}
+
+	c.plans[k] = plan
+}
+
+// Invalidate removes the plans reading a table of a database, an empty table removes the plans of the database
+// The amount of plans removed is returned
+func (c *Cache) Invalidate(database, table string) int {
+	if c == nil {
+		return 0
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	removed := 0
+
+	for k, plan := range c.plans {
+		if k.database != database {
+			continue
+		}
+
+		if _, ok := plan.Rows[table]; ok || table == "" {
+			delete(c.plans, k)
+			removed++
+		}
+	}
+
+	c.stats.Invalidations += int64(removed)
+
+	return removed
+}
+
+// evict removes the least recently used plan
+func (c *Cache) evict() {
+	var least *key
+	var used uint64
+
+	for k, plan := range c.plans {
+		if least == nil || plan.used < used {
+			k := k
+			least = &k
+			used = plan.used
+		}
+	}
+
+	if least != nil {
+		delete(c.plans, *least)
+		c.stats.Evictions++
+	}
+}
+
+// Plans returns a copy of every plan, by hits descending
+func (c *Cache) Plans() []Plan {
+	if c == nil {
+		return nil
+	}
+
+	c.lock.Lock()
+	plans := make([]Plan, 0, len(c.plans))
+	for _, plan := range c.plans {
+		p := *plan
+		p.Access = slices.Clone(plan.Access)
+		plans = append(plans, p)
+	}
+	c.lock.Unlock()
+
+	sort.Slice(plans, func(i, j int) bool {
+		if plans[i].Hits != plans[j].Hits {
+			return plans[i].Hits > plans[j].Hits
+		}
+
+		if plans[i].Statement != plans[j].Statement {
+			return plans[i].Statement < plans[j].Statement
+		}
+
+		return plans[i].Step < plans[j].Step
+	})
+
+	return plans
+}
+
+// Stats returns the lookups of the cache and the plans it keeps
+func (c *Cache) Stats() Stats {
+	if c == nil {
+		return Stats{}
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	stats := c.stats
+	stats.Plans, stats.Max = len(c.plans), c.max
+
+	return stats
+}
+
+// stale returns true if the rows of a table changed enough since it was planned for another plan to be better
+func stale(planned, rows int64) bool {
+	if planned < STALE_MIN_ROWS && rows < STALE_MIN_ROWS {
+		return false
+	}
+
+	return rows > planned*2 || rows*2 < planned
+}
@@ -0,0 +1,135 @@
+// Package plancache tests
+// Copyright (C) AriaSQL
+// Author(s): Alex Gaetano Padula
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+package plancache
+
+import (
+	"testing"
+)
+
+func TestCache_Get(t *testing.T) {
+	c := New(0)
+
+	rows := map[string]int64{"orders": 1000}
+	count := func(table string) int64 { return rows[table] }
+
+	if c.Get("shop", "SELECT * FROM orders WHERE id = ?", 1, count) != nil {
+		t.Fatal("expected a miss")
+	}
+
+	c.Put(&Plan{Database: "shop", Statement: "SELECT * FROM orders WHERE id = ?", Step: 1, Rows: map[string]int64{"orders": 1000}, Access: []Access{{Table: "orders", Column: "id", Index: "unique_id"}}})
+
+	plan := c.Get("shop", "SELECT * FROM orders WHERE id = ?", 1, count)
+	if plan == nil {
+		t.Fatal("expected a hit")
+	}
+
+	if index, ok := plan.Index("orders", "id"); !ok || index != "unique_id" {
+		t.Fatalf("expected unique_id, got %s %v", index, ok)
+	}
+
+	if _, ok := plan.Index("orders", "status"); ok {
+		t.Fatal("expected status not to be planned")
+	}
+
+	if plan.String() != "orders.id INDEX SCAN unique_id" {
+		t.Fatalf("unexpected plan %s", plan.String())
+	}
+
+	// Plans are by database and step
+	if c.Get("other", "SELECT * FROM orders WHERE id = ?", 1, count) != nil || c.Get("shop", "SELECT * FROM orders WHERE id = ?", 2, count) != nil {
+		t.Fatal("expected a miss for another database or step")
+	}
+
+	// A plan is stale once the rows of a table doubled
+	rows["orders"] = 2500
+
+	if c.Get("shop", "SELECT * FROM orders WHERE id = ?", 1, count) != nil {
+		t.Fatal("expected the plan to be invalidated")
+	}
+
+	stats := c.Stats()
+	if stats.Hits != 1 || stats.Misses != 4 || stats.Invalidations != 1 || stats.Plans != 0 || stats.Max != DEFAULT_MAX_PLANS {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+}
+
+func TestCache_Invalidate(t *testing.T) {
+	c := New(0)
+
+	c.Put(&Plan{Database: "shop", Statement: "SELECT * FROM orders WHERE id = ?", Step: 1, Rows: map[string]int64{"orders": 10}})
+	c.Put(&Plan{Database: "shop", Statement: "SELECT * FROM users WHERE id = ?", Step: 1, Rows: map[string]int64{"users": 10}})
+	c.Put(&Plan{Database: "blog", Statement: "SELECT * FROM orders WHERE id = ?", Step: 1, Rows: map[string]int64{"orders": 10}})
+
+	if removed := c.Invalidate("shop", "orders"); removed != 1 {
+		t.Fatalf("expected 1 plan invalidated, got %d", removed)
+	}
+
+	if len(c.Plans()) != 2 {
+		t.Fatalf("expected 2 plans, got %d", len(c.Plans()))
+	}
+
+	// An empty table invalidates the plans of the database
+	if removed := c.Invalidate("blog", ""); removed != 1 {
+		t.Fatalf("expected 1 plan invalidated, got %d", removed)
+	}
+
+	if plans := c.Plans(); len(plans) != 1 || plans[0].Statement != "SELECT * FROM users WHERE id = ?" {
+		t.Fatalf("unexpected plans %+v", plans)
+	}
+}
+
+func TestCache_Evict(t *testing.T) {
+	c := New(2)
+
+	count := func(table string) int64 { return 0 }
+
+	c.Put(&Plan{Database: "shop", Statement: "a", Step: 1})
+	c.Put(&Plan{Database: "shop", Statement: "b", Step: 1})
+
+	// a is used last, b is evicted for c
+	c.Get("shop", "a", 1, count)
+	c.Put(&Plan{Database: "shop", Statement: "c", Step: 1})
+
+	if c.Get("shop", "b", 1, count) != nil {
+		t.Fatal("expected b to be evicted")
+	}
+
+	if c.Get("shop", "a", 1, count) == nil || c.Get("shop", "c", 1, count) == nil {
+		t.Fatal("expected a and c to be cached")
+	}
+
+	if c.Stats().Evictions != 1 {
+		t.Fatalf("expected 1 eviction, got %d", c.Stats().Evictions)
+	}
+}
+
+func TestStale(t *testing.T) {
+	for _, tt := range []struct {
+		planned, rows int64
+		stale         bool
+	}{
+		{0, 50, false},
+		{0, 150, true},
+		{1000, 1900, false},
+		{1000, 2100, true},
+		{1000, 400, true},
+	} {
+		if stale(tt.planned, tt.rows) != tt.stale {
+			t.Fatalf("expected stale(%d, %d) to be %v", tt.planned, tt.rows, tt.stale)
+		}
+	}
+}
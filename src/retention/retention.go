@@ -0,0 +1,402 @@
+// Package retention
+// AriaSQL log retention package
+// Copyright (C) AriaSQL
+// Author(s): Alex Gaetano Padula
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+package retention
+
+import (
+	"ariasql/checkpoint"
+	"ariasql/core"
+	"ariasql/storage/btree"
+	"ariasql/wal"
+	"errors"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const DEFAULT_INTERVAL = time.Hour // Time between purges if not configured
+
+const LOG_WAL = "wal"             // WAL segments rotated out of wal.dat
+const LOG_CHANGELOG = "changelog" // Changes accepted by an edge hub
+const LOG_AUDITLOG = "auditlog"   // Rotations of aria.log
+
+// changeLog is a change log trimmed in place, see edge.Node
+type changeLog interface {
+	ChangesSize(before time.Time, maxBytes int64) (int64, int64, error) // Returns the bytes of the changes and how many of them would be purged
+	PurgeChanges(before time.Time, maxBytes int64) (int64, error)       // Purges the changes, the bytes purged are returned
+}
+
+// Purger rotates the WAL and the audit log and purges the logs past their retention
+// The WAL and the audit log are rotated on every purge, a rotated file is removed once it was rotated longer than
+// MaxAge ago or the files of its log take more than MaxBytes.  The file written to is never removed, nor is a WAL
+// segment rotated after the last checkpoint recorded, -recover replays it on the checkpoint.
+type Purger struct {
+	aria   *core.AriaSQL        // AriaSQL instance pointer
+	config *core.Retention      // Retention configuration
+	purged map[string]int64     // Bytes purged of every log since the purger was created
+	last   map[string]time.Time // When every log was last purged
+	lock   *sync.Mutex          // Purges and usage lock
+	stop   chan struct{}        // Closed to stop purging
+	wg     *sync.WaitGroup      // Purging goroutine
+}
+
+// rotated is a file rotated out of a log
+type rotated struct {
+	path      string    // Path of the file
+	size      int64     // Bytes of the file, with the deleted and dirty pages of a WAL segment
+	rotatedAt time.Time // When the file was rotated, its entries are older
+}
+
+// New creates a purger for the configuration, purging starts with Start
+func New(aria *core.AriaSQL) (*Purger, error) {
+	if aria.Config.Retention == nil {
+		return nil, errors.New("no retention configured")
+	}
+
+	config := aria.Config.Retention
+
+	if config.Interval < 0 {
+		return nil, errors.New("retention interval cannot be negative")
+	}
+
+	for _, policy := range []*core.LogRetention{config.WAL, config.ChangeLog, config.AuditLog} {
+		if policy != nil && (policy.MaxAge < 0 || policy.MaxBytes < 0) {
+			return nil, errors.New("retention limits cannot be negative")
+		}
+	}
+
+	return &Purger{
+		aria:   aria,
+		config: config,
+		purged: make(map[string]int64),
+		last:   make(map[string]time.Time),
+		lock:   &sync.Mutex{},
+		stop:   make(chan struct{}),
+		wg:     &sync.WaitGroup{},
+	}, nil
+}
+
+// Start starts purging every interval
+func (p *Purger) Start() {
+	interval := DEFAULT_INTERVAL
+	if p.config.Interval > 0 {
+		interval = time.Duration(p.config.Interval) * time.Second
+	}
+
+	p.wg.Add(1)
+
+	go func() {
+		defer p.wg.Done()
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-p.stop:
+				return
+			case <-ticker.C:
+				p.purge()
+			}
+		}
+	}()
+}
+
+// Close stops purging
+func (p *Purger) Close() {
+	close(p.stop)
+	p.wg.Wait()
+}
+
+// purge rotates the WAL and the audit log and purges every log past its retention, the bytes purged are returned by log
+func (p *Purger) purge() map[string]int64 {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	purged := make(map[string]int64)
+
+	if p.config.WAL != nil && p.aria.WAL != nil {
+		_, err := p.aria.WAL.Rotate()
+		if err != nil {
+			log.Printf("retention: WAL not rotated: %s", err.Error())
+		}
+
+		purged[LOG_WAL], err = p.purgeFiles(LOG_WAL, p.config.WAL)
+		if err != nil {
+			log.Printf("retention: WAL segments not purged: %s", err.Error())
+		}
+	}
+
+	if p.config.AuditLog != nil && p.aria.LogFile != nil {
+		_, err := p.aria.RotateLog()
+		if err != nil {
+			log.Printf("retention: audit log not rotated: %s", err.Error())
+		}
+
+		purged[LOG_AUDITLOG], err = p.purgeFiles(LOG_AUDITLOG, p.config.AuditLog)
+		if err != nil {
+			log.Printf("retention: audit log not purged: %s", err.Error())
+		}
+	}
+
+	if changes, ok := p.aria.ChangeLog.(changeLog); ok && p.config.ChangeLog != nil {
+		bytes, err := changes.PurgeChanges(cutoff(p.config.ChangeLog), p.config.ChangeLog.MaxBytes)
+		if err != nil {
+			log.Printf("retention: change log not purged: %s", err.Error())
+		}
+
+		purged[LOG_CHANGELOG] = bytes
+	}
+
+	for name, bytes := range purged {
+		p.purged[name] += bytes
+		p.last[name] = time.Now()
+
+		if bytes > 0 {
+			log.Printf("retention: purged %d bytes of the %s", bytes, name)
+		}
+	}
+
+	return purged
+}
+
+// purgeFiles removes the files rotated out of a log past its retention, the bytes removed are returned
+func (p *Purger) purgeFiles(name string, policy *core.LogRetention) (int64, error) {
+	current, files, err := p.files(name)
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := p.purgeable(name, current, files, policy)
+	if err != nil {
+		return 0, err
+	}
+
+	purged := int64(0)
+
+	for _, file := range files[:n] {
+		if name == LOG_WAL {
+			err = wal.RemoveSegment(&wal.Segment{Path: file.path, RotatedAt: file.rotatedAt})
+		} else {
+			err = os.Remove(file.path)
+		}
+
+		if err != nil {
+			return purged, err
+		}
+
+		purged += file.size
+	}
+
+	return purged, nil
+}
+
+// purgeable returns how many of the oldest files rotated out of a log may be purged
+// WAL segments rotated after the last checkpoint recorded are kept whatever the retention, none is purged before a
+// checkpoint was recorded
+func (p *Purger) purgeable(name string, current int64, files []rotated, policy *core.LogRetention) (int, error) {
+	n := expired(current, files, policy)
+
+	if name != LOG_WAL {
+		return n, nil
+	}
+
+	last, err := checkpoint.Read(p.aria.Config.DataDir)
+	if err != nil {
+		return 0, err
+	}
+
+	checkpointed := 0
+	for last != nil && checkpointed < n && !files[checkpointed].rotatedAt.After(last.WALRotatedAt) {
+		checkpointed++
+	}
+
+	return checkpointed, nil
+}
+
+// files returns the bytes of the file a log is written to and the files rotated out of it, oldest first
+func (p *Purger) files(name string) (int64, []rotated, error) {
+	switch name {
+	case LOG_WAL:
+		current, err := p.aria.WAL.Size()
+		if err != nil {
+			return 0, nil, err
+		}
+
+		segments, err := wal.Segments(p.aria.WAL.FilePath)
+		if err != nil {
+			return 0, nil, err
+		}
+
+		files := make([]rotated, 0, len(segments))
+
+		for _, segment := range segments {
+			size := int64(0)
+
+			for _, extension := range []string{"", btree.DELETED_PAGES_EXTENSION, btree.DIRTY_PAGES_EXTENSION} {
+				stat, err := os.Stat(segment.Path + extension)
+				if err == nil {
+					size += stat.Size()
+				}
+			}
+
+			files = append(files, rotated{path: segment.Path, size: size, rotatedAt: segment.RotatedAt})
+		}
+
+		return current, files, nil
+	default:
+		stat, err := p.aria.LogFile.Stat()
+		if err != nil {
+			return 0, nil, err
+		}
+
+		files, err := rotations(p.aria.LogFile.Name())
+
+		return stat.Size(), files, err
+	}
+}
+
+// Usage returns the space taken by every log retained and how much of it the next purge would reclaim
+func (p *Purger) Usage() ([]core.LogUsage, error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	usage := make([]core.LogUsage, 0, 3)
+
+	for _, entry := range []struct {
+		name   string
+		policy *core.LogRetention
+		logged bool
+	}{
+		{LOG_WAL, p.config.WAL, p.aria.WAL != nil},
+		{LOG_AUDITLOG, p.config.AuditLog, p.aria.LogFile != nil},
+	} {
+		if entry.policy == nil || !entry.logged {
+			continue
+		}
+
+		current, files, err := p.files(entry.name)
+		if err != nil {
+			return nil, err
+		}
+
+		n, err := p.purgeable(entry.name, current, files, entry.policy)
+		if err != nil {
+			return nil, err
+		}
+
+		u := core.LogUsage{Log: entry.name, Files: len(files) + 1, Bytes: current, Purged: p.purged[entry.name], LastPurge: p.last[entry.name]}
+
+		for i, file := range files {
+			u.Bytes += file.size
+
+			if i < n {
+				u.Reclaimable += file.size
+			}
+		}
+
+		usage = append(usage, u)
+	}
+
+	if changes, ok := p.aria.ChangeLog.(changeLog); ok && p.config.ChangeLog != nil {
+		size, reclaimable, err := changes.ChangesSize(cutoff(p.config.ChangeLog), p.config.ChangeLog.MaxBytes)
+		if err != nil {
+			return nil, err
+		}
+
+		usage = append(usage, core.LogUsage{
+			Log:         LOG_CHANGELOG,
+			Files:       1,
+			Bytes:       size,
+			Reclaimable: reclaimable,
+			Purged:      p.purged[LOG_CHANGELOG],
+			LastPurge:   p.last[LOG_CHANGELOG],
+		})
+	}
+
+	return usage, nil
+}
+
+// cutoff returns the time entries of a log before are past MaxAge, zero without MaxAge
+func cutoff(policy *core.LogRetention) time.Time {
+	if policy.MaxAge == 0 {
+		return time.Time{}
+	}
+
+	return time.Now().Add(-time.Duration(policy.MaxAge) * time.Second)
+}
+
+// expired returns how many of the oldest files rotated out of a log are past its retention
+// current is the bytes of the file written to, it counts towards MaxBytes
+func expired(current int64, files []rotated, policy *core.LogRetention) int {
+	n := 0
+
+	if before := cutoff(policy); !before.IsZero() {
+		for n < len(files) && files[n].rotatedAt.Before(before) {
+			n++
+		}
+	}
+
+	if policy.MaxBytes > 0 {
+		kept := current
+		for _, file := range files[n:] {
+			kept += file.size
+		}
+
+		for n < len(files) && kept > policy.MaxBytes {
+			kept -= files[n].size
+			n++
+		}
+	}
+
+	return n
+}
+
+// rotations returns the files rotated out of a log file, named after it and the unix nanoseconds they were rotated at
+func rotations(path string) ([]rotated, error) {
+	matches, err := filepath.Glob(path + ".*")
+	if err != nil {
+		return nil, err
+	}
+
+	files := make([]rotated, 0)
+
+	for _, match := range matches {
+		nanos, err := strconv.ParseInt(strings.TrimPrefix(match, path+"."), 10, 64)
+		if err != nil {
+			continue
+		}
+
+		stat, err := os.Stat(match)
+		if err != nil {
+			return nil, err
+		}
+
+		files = append(files, rotated{path: match, size: stat.Size(), rotatedAt: time.Unix(0, nanos)})
+	}
+
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].rotatedAt.Before(files[j].rotatedAt)
+	})
+
+	return files, nil
+}
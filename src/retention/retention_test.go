@@ -0,0 +1,165 @@
+// Package retention
+// AriaSQL log retention package
+// Copyright (C) AriaSQL
+// Author(s): Alex Gaetano Padula
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+package retention
+
+import (
+	"ariasql/core"
+	"ariasql/wal"
+	"encoding/gob"
+	"log"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestNew(t *testing.T) {
+	for _, config := range []*core.Retention{
+		nil,
+		{Interval: -1},
+		{WAL: &core.LogRetention{MaxAge: -1}},
+		{AuditLog: &core.LogRetention{MaxBytes: -1}},
+	} {
+		_, err := New(&core.AriaSQL{Config: &core.Config{Retention: config}})
+		if err == nil {
+			t.Fatalf("expected error for %+v", config)
+		}
+	}
+}
+
+func TestPurger_purge(t *testing.T) {
+	defer os.RemoveAll("./test/")
+	defer log.SetOutput(os.Stderr)
+
+	aria, err := core.New(&core.Config{DataDir: "./test", Logging: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer aria.WAL.Close()
+	defer aria.LogFile.Close()
+
+	aria.Config.Retention = &core.Retention{
+		WAL:      &core.LogRetention{MaxAge: 1},
+		AuditLog: &core.LogRetention{MaxBytes: 1},
+	}
+
+	p, err := New(aria)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = aria.WAL.Append([]byte("entry 1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	log.Print("logged before the first purge")
+
+	// The WAL is rotated into a segment kept for MaxAge, the audit log rotation is past MaxBytes right away
+	purged := p.purge()
+	if purged[LOG_WAL] != 0 || purged[LOG_AUDITLOG] == 0 {
+		t.Fatalf("expected only the audit log to be purged, got %v", purged)
+	}
+
+	segments, err := wal.Segments(aria.WAL.FilePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(segments) != 1 {
+		t.Fatalf("expected 1 WAL segment, got %d", len(segments))
+	}
+
+	// The WAL file written to starts out empty and is not rotated while empty
+	size, err := aria.WAL.Size()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if size != 0 {
+		t.Fatalf("expected an empty WAL file, got %d bytes", size)
+	}
+
+	time.Sleep(1100 * time.Millisecond)
+
+	// The WAL segment is past MaxAge but not within a checkpoint, -recover replays it
+	usage, err := p.Usage()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(usage) != 2 || usage[0].Log != LOG_WAL || usage[0].Files != 2 || usage[0].Reclaimable != 0 {
+		t.Fatalf("expected the WAL segment not to be reclaimable, got %+v", usage)
+	}
+
+	if usage[1].Log != LOG_AUDITLOG || usage[1].Purged != purged[LOG_AUDITLOG] || usage[1].LastPurge.IsZero() {
+		t.Fatalf("expected the audit log purge to be counted, got %+v", usage[1])
+	}
+
+	// A checkpoint holds the segment, a segment rotated after the checkpoint is kept past MaxAge
+	err = os.MkdirAll("./test/checkpoint", 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	record, err := os.Create("./test/checkpoint/record")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = gob.NewEncoder(record).Encode(&core.CheckpointRecord{Created: time.Now(), WALRotatedAt: segments[0].RotatedAt})
+	record.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = aria.WAL.Append([]byte("entry 2"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = aria.WAL.Rotate()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(1100 * time.Millisecond)
+
+	usage, err = p.Usage()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if usage[0].Files != 3 || usage[0].Reclaimable == 0 || usage[0].Reclaimable >= usage[0].Bytes {
+		t.Fatalf("expected only the checkpointed WAL segment to be reclaimable, got %+v", usage[0])
+	}
+
+	purged = p.purge()
+	if purged[LOG_WAL] != usage[0].Reclaimable {
+		t.Fatalf("expected %d WAL bytes purged, got %d", usage[0].Reclaimable, purged[LOG_WAL])
+	}
+
+	remaining, err := wal.Segments(aria.WAL.FilePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(remaining) != 1 || !remaining[0].RotatedAt.After(segments[0].RotatedAt) {
+		t.Fatalf("expected the WAL segment rotated after the checkpoint to be kept, got %d segments", len(remaining))
+	}
+}
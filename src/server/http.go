@@ -0,0 +1,337 @@
+// Package server
+// AriaSQL server package
+// Copyright (C) AriaSQL
+// Author(s): Alex Gaetano Padula
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+package server
+
+import (
+	"ariasql/catalog"
+	"ariasql/core"
+	"ariasql/executor"
+	"ariasql/parser"
+	"ariasql/shared"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const QUERY_PATH = "/query"                        // Path statements are posted to
+const MAX_QUERY_BODY_SIZE = MAX_FRAME_SIZE         // Largest body of a query request
+const HTTP_READ_HEADER_TIMEOUT = 10 * time.Second  // How long a client has to send the headers of a request
+const APPLICATION_HEADER = "X-AriaSQL-Application" // Name of the application, listed by SHOW PROCESSLIST
+
+// Error codes of the HTTP query endpoint
+const (
+	CODE_BAD_REQUEST              = "bad_request"              // The body is not a query request
+	CODE_TOO_LARGE                = "too_large"                // The body is larger than MAX_QUERY_BODY_SIZE
+	CODE_UNAUTHORIZED             = "unauthorized"             // Credentials are missing or wrong
+	CODE_FORBIDDEN                = "forbidden"                // The user lacks the CONNECT privilege or a privilege the statement needs
+	CODE_PASSWORD_CHANGE_REQUIRED = "password_change_required" // The generated password of the user has to be changed first
+	CODE_BLOCKED                  = "blocked"                  // A statement rule blocked the statement
+	CODE_SYNTAX_ERROR             = "syntax_error"             // A statement does not parse
+	CODE_UNKNOWN_DATABASE         = "unknown_database"         // The database of the request does not exist
+	CODE_STATEMENT_FAILED         = "statement_failed"         // A statement failed to execute
+	CODE_NOT_FOUND                = "not_found"                // The path is not QUERY_PATH
+	CODE_METHOD_NOT_ALLOWED       = "method_not_allowed"       // The request is not a POST
+)
+
+// httpEndpoint is the HTTP query endpoint of a server
+type httpEndpoint struct {
+	listener net.Listener // Listener of the endpoint
+	server   *http.Server // HTTP server serving the endpoint
+}
+
+// QueryRequest is the JSON body posted to the HTTP query endpoint
+type QueryRequest struct {
+	Database string `json:"database"` // Database the statements run in, none is selected if empty
+	Query    string `json:"query"`    // Statements separated by semicolons, run in order within one session
+}
+
+// QueryResponse is the JSON response of the HTTP query endpoint
+type QueryResponse struct {
+	Results []*QueryResult `json:"results"`         // Result of every statement executed, up to the failed one
+	Error   *QueryError    `json:"error,omitempty"` // Why the request failed, nil on success
+}
+
+// QueryResult is the result of a statement
+type QueryResult struct {
+	Rows    json.RawMessage `json:"rows,omitempty"`    // Rows returned as an array of objects, or the JSON result of the statement
+	Message string          `json:"message,omitempty"` // Result of a statement with a result which is not JSON
+	Status  string          `json:"status,omitempty"`  // OK for a statement without a result
+}
+
+// QueryError is the error of a failed request
+type QueryError struct {
+	Code      string `json:"code"`                // One of the CODE_ constants
+	Message   string `json:"message"`             // Error message
+	Statement int    `json:"statement,omitempty"` // Position of the failed statement from 1, 0 if no statement failed
+}
+
+// listenHTTP binds the HTTP query endpoint
+func (s *TCPServer) listenHTTP() error {
+	host := s.HTTPHost
+	if host == "" {
+		host = s.Host
+	}
+
+	listener, err := net.Listen("tcp4", fmt.Sprintf("%s:%d", host, s.HTTPPort))
+	if err != nil {
+		return err
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", s.handleHTTP)
+
+	s.endpoint = &httpEndpoint{
+		listener: listener,
+		server:   &http.Server{Handler: mux, ReadHeaderTimeout: HTTP_READ_HEADER_TIMEOUT},
+	}
+
+	return nil
+}
+
+// ListenHTTP binds the HTTP query endpoint on a port, in place of the port of ariaserver.yaml, before the server starts
+func (s *TCPServer) ListenHTTP(port int) error {
+	if s.endpoint != nil {
+		s.endpoint.listener.Close()
+		s.endpoint = nil
+	}
+
+	s.HTTPPort = port
+
+	return s.listenHTTP()
+}
+
+// serveHTTP serves the HTTP query endpoint until the server is stopped, over HTTPS if TLS is enabled
+func (s *TCPServer) serveHTTP() {
+	var err error
+
+	if s.TLS {
+		err = s.endpoint.server.ServeTLS(s.endpoint.listener, s.TLSCert, s.TLSKey)
+	} else {
+		err = s.endpoint.server.Serve(s.endpoint.listener)
+	}
+
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.Printf("http query endpoint: %s", err.Error())
+	}
+}
+
+// handleHTTP handles a request to the HTTP query endpoint
+// Every request authenticates with basic authentication and runs its statements in a session of its own, closed
+// once the response is written.  A transaction left open by the statements is rolled back.
+func (s *TCPServer) handleHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != QUERY_PATH {
+		writeQueryError(w, http.StatusNotFound, &QueryResponse{}, CODE_NOT_FOUND, "no endpoint at "+r.URL.Path, 0)
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		writeQueryError(w, http.StatusMethodNotAllowed, &QueryResponse{}, CODE_METHOD_NOT_ALLOWED, "statements are posted to "+QUERY_PATH, 0)
+		return
+	}
+
+	response := &QueryResponse{Results: make([]*QueryResult, 0)}
+
+	username, password, ok := r.BasicAuth()
+	if !ok {
+		w.Header().Set("WWW-Authenticate", `Basic realm="AriaSQL"`)
+		writeQueryError(w, http.StatusUnauthorized, response, CODE_UNAUTHORIZED, "basic authentication required", 0)
+		return
+	}
+
+	user, err := s.aria.Catalog.AuthenticateUser(username, password)
+	if err != nil {
+		log.Printf("authentication of %s from %s failed", username, r.RemoteAddr)
+		w.Header().Set("WWW-Authenticate", `Basic realm="AriaSQL"`)
+		writeQueryError(w, http.StatusUnauthorized, response, CODE_UNAUTHORIZED, "authentication failed", 0)
+		return
+	}
+
+	if username == catalog.DEFAULT_ADMIN_USER && password == catalog.DEFAULT_ADMIN_PASSWORD {
+		log.Printf("WARNING: %s logged in from %s with the default password %s, change it with ALTER USER %s SET PASSWORD", username, r.RemoteAddr, catalog.DEFAULT_ADMIN_PASSWORD, username)
+	}
+
+	if !user.HasPrivilege("", "", []shared.PrivilegeAction{shared.PRIV_CONNECT}) {
+		log.Printf("connection of %s from %s refused, no CONNECT privilege", username, r.RemoteAddr)
+		writeQueryError(w, http.StatusForbidden, response, CODE_FORBIDDEN, "user does not have CONNECT privilege", 0)
+		return
+	}
+
+	var request QueryRequest
+
+	err = json.NewDecoder(http.MaxBytesReader(w, r.Body, MAX_QUERY_BODY_SIZE)).Decode(&request)
+	if tooLarge := (*http.MaxBytesError)(nil); errors.As(err, &tooLarge) {
+		writeQueryError(w, http.StatusRequestEntityTooLarge, response, CODE_TOO_LARGE, fmt.Sprintf("query request larger than %d bytes", tooLarge.Limit), 0)
+		return
+	}
+
+	if err != nil {
+		writeQueryError(w, http.StatusBadRequest, response, CODE_BAD_REQUEST, "invalid query request: "+err.Error(), 0)
+		return
+	}
+
+	// A single statement can be posted without its semicolon
+	query := strings.TrimSpace(request.Query)
+	if query == "" {
+		writeQueryError(w, http.StatusBadRequest, response, CODE_BAD_REQUEST, "query is empty", 0)
+		return
+	}
+
+	if !strings.HasSuffix(query, ";") {
+		query += ";"
+	}
+
+	statements, err := parser.Split([]byte(query))
+	if err != nil {
+		writeQueryError(w, http.StatusBadRequest, response, CODE_SYNTAX_ERROR, err.Error(), 0)
+		return
+	}
+
+	channel := s.aria.OpenChannel(user)
+	channel.Address = r.RemoteAddr
+	channel.ApplicationName = r.Header.Get(APPLICATION_HEADER)
+	defer s.aria.CloseChannel(channel)
+
+	if s.aria.Coordinator != nil {
+		defer s.aria.Coordinator.CloseChannel(channel)
+	}
+
+	exe := executor.New(s.aria, channel)
+	exe.SetJsonOutput(true)
+
+	// Nothing is applied of a transaction the statements did not commit
+	defer func() {
+		if exe.TransactionBegun {
+			exe.Execute(&parser.RollbackStmt{})
+		}
+	}()
+
+	if request.Database != "" {
+		err = exe.Execute(&parser.UseStmt{DatabaseName: &parser.Identifier{Value: request.Database}})
+		if err != nil {
+			writeQueryError(w, http.StatusNotFound, response, CODE_UNKNOWN_DATABASE, err.Error(), 0)
+			return
+		}
+	}
+
+	for i, statement := range statements {
+		result, status, code, err := s.runHTTP(channel, exe, bytes.TrimSpace(statement))
+		if err != nil {
+			writeQueryError(w, status, response, code, err.Error(), i+1)
+			return
+		}
+
+		response.Results = append(response.Results, result)
+	}
+
+	writeQueryResponse(w, http.StatusOK, response)
+}
+
+// runHTTP executes a statement posted to the HTTP query endpoint
+// A failed statement returns the HTTP status and error code of the failure
+func (s *TCPServer) runHTTP(channel *core.Channel, exe *executor.Executor, q []byte) (result *QueryResult, status int, code string, err error) {
+	ctx, span := startQuery(channel, q)
+
+	defer func() { span.End(err) }()
+
+	ast, err := parser.NewParser(parser.NewLexer(q)).Parse()
+	if err != nil {
+		return nil, http.StatusBadRequest, CODE_SYNTAX_ERROR, err
+	}
+
+	if s.aria.Firewall != nil {
+		err = s.aria.Firewall.Check(channel, q, ast)
+		if err != nil {
+			return nil, http.StatusForbidden, CODE_BLOCKED, err
+		}
+	}
+
+	if channel.User.MustChangePassword && !changesPassword(channel, ast) {
+		err = fmt.Errorf("password change required, run ALTER USER %s SET PASSWORD 'newpassword'", channel.User.Username)
+		return nil, http.StatusForbidden, CODE_PASSWORD_CHANGE_REQUIRED, err
+	}
+
+	// Rows of a COPY are streamed over a connection of the wire protocol
+	if _, ok := ast.(*parser.CopyStmt); ok {
+		err = errors.New("COPY is not supported over HTTP")
+		return nil, http.StatusBadRequest, CODE_STATEMENT_FAILED, err
+	}
+
+	var resultSet []byte
+
+	if s.aria.Coordinator != nil && !isNotificationStmt(ast) {
+		resultSet, err = s.aria.Coordinator.Execute(channel, q, ast, true)
+	} else {
+		exe.SetContext(ctx)
+		defer exe.SetContext(context.Background())
+
+		exe.Clear()
+
+		err = s.record(channel, exe, q, ast, func() error {
+			return exe.Execute(ast)
+		})
+
+		resultSet = bytes.TrimSpace(exe.GetResultSet())
+	}
+
+	if err != nil {
+		if errors.Is(err, executor.ErrNoPrivilege) {
+			return nil, http.StatusForbidden, CODE_FORBIDDEN, err
+		}
+
+		return nil, http.StatusUnprocessableEntity, CODE_STATEMENT_FAILED, err
+	}
+
+	switch {
+	case bytes.Equal(resultSet, []byte("null")):
+		// A select without rows
+		return &QueryResult{Rows: json.RawMessage("[]")}, http.StatusOK, "", nil
+	case len(resultSet) == 0:
+		return &QueryResult{Status: "OK"}, http.StatusOK, "", nil
+	case json.Valid(resultSet):
+		return &QueryResult{Rows: json.RawMessage(resultSet)}, http.StatusOK, "", nil
+	}
+
+	return &QueryResult{Message: string(resultSet)}, http.StatusOK, "", nil
+}
+
+// writeQueryError writes a failed response with the results of the statements executed before the failure
+func writeQueryError(w http.ResponseWriter, status int, response *QueryResponse, code string, message string, statement int) {
+	response.Error = &QueryError{Code: code, Message: message, Statement: statement}
+
+	writeQueryResponse(w, status, response)
+}
+
+// writeQueryResponse writes a response of the HTTP query endpoint
+func writeQueryResponse(w http.ResponseWriter, status int, response *QueryResponse) {
+	if response.Results == nil {
+		response.Results = make([]*QueryResult, 0)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,178 @@
+// Package server tests
+// AriaSQL server package tests
+// Copyright (C) AriaSQL
+// Author(s): Alex Gaetano Padula
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+package server
+
+import (
+	"ariasql/catalog"
+	"ariasql/core"
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// postQuery posts a body to the HTTP query endpoint, with basic authentication unless username is empty
+func postQuery(t *testing.T, method, url, username, password, body string) (int, *QueryResponse) {
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if username != "" {
+		req.SetBasicAuth(username, password)
+	}
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer res.Body.Close()
+
+	b, err := io.ReadAll(res.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	response := &QueryResponse{}
+
+	err = json.Unmarshal(b, response)
+	if err != nil {
+		t.Fatalf("response %s is not JSON: %v", b, err)
+	}
+
+	return res.StatusCode, response
+}
+
+func TestHTTPQuery(t *testing.T) {
+	defer os.RemoveAll("./test")
+
+	aria, err := core.New(&core.Config{DataDir: "./test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	aria.Catalog = catalog.New(aria.Config.DataDir)
+	aria.Catalog.AdminPassword = "s3cret"
+
+	err = aria.Catalog.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer aria.Close()
+
+	aria.Channels = make([]*core.Channel, 0)
+	aria.ChannelsLock = &sync.Mutex{}
+
+	s, err := NewTCPServer(3694, "127.0.0.1", aria, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// As with -http-port, the endpoint is enabled without httpport in ariaserver.yaml
+	err = s.ListenHTTP(3696)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer s.Stop()
+
+	go s.Start()
+
+	url := "http://127.0.0.1:3696" + QUERY_PATH
+
+	status, response := postQuery(t, http.MethodPost, url, "admin", "s3cret",
+		`{"query": "CREATE DATABASE shop; USE shop; CREATE TABLE users (user_id INT NOT NULL UNIQUE, name CHAR(255)); INSERT INTO users (user_id, name) VALUES (1, 'alex'), (2, 'bob');"}`)
+	if status != http.StatusOK || response.Error != nil {
+		t.Fatalf("expected the statements to succeed, got %d %+v", status, response.Error)
+	}
+
+	if len(response.Results) != 4 {
+		t.Fatalf("expected 4 results, got %d", len(response.Results))
+	}
+
+	for _, result := range response.Results {
+		if result.Status != "OK" {
+			t.Fatalf("expected status OK, got %+v", result)
+		}
+	}
+
+	// Rows are an array of objects with the columns in the order they were selected, a select without rows is an empty array
+	status, response = postQuery(t, http.MethodPost, url, "admin", "s3cret",
+		`{"database": "shop", "query": "SELECT name, user_id FROM users WHERE user_id = 2; SELECT name FROM users WHERE user_id = 3"}`)
+	if status != http.StatusOK || response.Error != nil {
+		t.Fatalf("expected the selects to succeed, got %d %+v", status, response.Error)
+	}
+
+	if string(response.Results[0].Rows) != `[{"name":"bob","user_id":2}]` {
+		t.Fatalf("unexpected rows %s", response.Results[0].Rows)
+	}
+
+	if string(response.Results[1].Rows) != `[]` {
+		t.Fatalf("expected no rows, got %s", response.Results[1].Rows)
+	}
+
+	status, response = postQuery(t, http.MethodPost, url, "admin", "s3cret", `{"query": "CREATE USER reader IDENTIFIED BY 'password'; GRANT CONNECT ON *.* TO reader;"}`)
+	if status != http.StatusOK || response.Error != nil {
+		t.Fatalf("expected the user to be created, got %d %+v", status, response.Error)
+	}
+
+	for _, test := range []struct {
+		name      string
+		method    string
+		path      string
+		username  string
+		password  string
+		body      string
+		status    int
+		code      string
+		statement int
+	}{
+		{name: "missing credentials", method: http.MethodPost, path: QUERY_PATH, body: `{"query": "SELECT 1"}`, status: http.StatusUnauthorized, code: CODE_UNAUTHORIZED},
+		{name: "wrong password", method: http.MethodPost, path: QUERY_PATH, username: "admin", password: "wrong", body: `{"query": "SELECT 1"}`, status: http.StatusUnauthorized, code: CODE_UNAUTHORIZED},
+		{name: "unknown user", method: http.MethodPost, path: QUERY_PATH, username: "nobody", password: "s3cret", body: `{"query": "SELECT 1"}`, status: http.StatusUnauthorized, code: CODE_UNAUTHORIZED},
+		{name: "body not JSON", method: http.MethodPost, path: QUERY_PATH, username: "admin", password: "s3cret", body: `SELECT 1`, status: http.StatusBadRequest, code: CODE_BAD_REQUEST},
+		{name: "body of the wrong type", method: http.MethodPost, path: QUERY_PATH, username: "admin", password: "s3cret", body: `{"query": 1}`, status: http.StatusBadRequest, code: CODE_BAD_REQUEST},
+		{name: "empty query", method: http.MethodPost, path: QUERY_PATH, username: "admin", password: "s3cret", body: `{"query": " "}`, status: http.StatusBadRequest, code: CODE_BAD_REQUEST},
+		{name: "syntax error", method: http.MethodPost, path: QUERY_PATH, username: "admin", password: "s3cret", body: `{"database": "shop", "query": "SELECT name FROM users; SELEC name FROM users;"}`, status: http.StatusBadRequest, code: CODE_SYNTAX_ERROR, statement: 2},
+		{name: "unknown database", method: http.MethodPost, path: QUERY_PATH, username: "admin", password: "s3cret", body: `{"database": "nope", "query": "SELECT 1"}`, status: http.StatusNotFound, code: CODE_UNKNOWN_DATABASE},
+		{name: "statement failed", method: http.MethodPost, path: QUERY_PATH, username: "admin", password: "s3cret", body: `{"database": "shop", "query": "SELECT name FROM missing"}`, status: http.StatusUnprocessableEntity, code: CODE_STATEMENT_FAILED, statement: 1},
+		{name: "no privilege", method: http.MethodPost, path: QUERY_PATH, username: "reader", password: "password", body: `{"database": "shop", "query": "SELECT name FROM users"}`, status: http.StatusForbidden, code: CODE_FORBIDDEN, statement: 1},
+		{name: "wrong path", method: http.MethodPost, path: "/queries", username: "admin", password: "s3cret", body: `{"query": "SELECT 1"}`, status: http.StatusNotFound, code: CODE_NOT_FOUND},
+		{name: "not a POST", method: http.MethodGet, path: QUERY_PATH, username: "admin", password: "s3cret", status: http.StatusMethodNotAllowed, code: CODE_METHOD_NOT_ALLOWED},
+	} {
+		status, response := postQuery(t, test.method, "http://127.0.0.1:3696"+test.path, test.username, test.password, test.body)
+		if status != test.status {
+			t.Fatalf("%s: expected status %d, got %d", test.name, test.status, status)
+		}
+
+		if response.Error == nil || response.Error.Code != test.code || response.Error.Statement != test.statement {
+			t.Fatalf("%s: expected error %s of statement %d, got %+v", test.name, test.code, test.statement, response.Error)
+		}
+	}
+
+	// A REVOKE of a privilege the user does not have fails the statement, its message mentions a privilege
+	status, response = postQuery(t, http.MethodPost, url, "admin", "s3cret", `{"query": "REVOKE SELECT ON shop.users TO reader;"}`)
+	if status != http.StatusUnprocessableEntity || response.Error == nil || response.Error.Code != CODE_STATEMENT_FAILED {
+		t.Fatalf("expected the revoke to fail the statement, got %d %+v", status, response.Error)
+	}
+}
@@ -18,19 +18,49 @@
 package server
 
 import (
+	"ariasql/catalog"
 	"ariasql/core"
 	"ariasql/executor"
 	"ariasql/parser"
 	"ariasql/shared"
+	"ariasql/tracing"
+	"ariasql/wait"
+	"bufio"
 	"bytes"
+	"context"
 	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"github.com/DataDog/zstd"
+	"github.com/pierrec/lz4/v4"
+	"go.opentelemetry.io/otel/attribute"
 	"gopkg.in/yaml.v3"
+	"io"
+	"log"
 	"net"
 	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 )
 
+const MAX_FRAME_SIZE = 64 * 1024 * 1024             // Largest statement accepted within a frame, compressed or decompressed
+const FRAME_COMPRESSED = 1 << 31                    // Set on the length of a compressed frame
+const DEFAULT_COMPRESSION_THRESHOLD = 1024          // Frames smaller than this many bytes are not compressed if not configured
+const COMPRESSION_ZSTD = "zstd"                     // Zstandard frame compression
+const COMPRESSION_LZ4 = "lz4"                       // LZ4 frame compression
+const LABEL_PREFIX = "label."                       // Prefix of the connection parameters labelling a session
+const PROXY_HEADER_TIMEOUT = 5 * time.Second        // How long a proxy has to send the PROXY protocol header of a connection
+const PROXY_V1_MAX_LENGTH = 107                     // Longest PROXY protocol v1 header, including the CRLF
+const PROXY_V2_SIGNATURE = "\r\n\r\n\x00\r\nQUIT\n" // PROXY protocol v2 header signature
+const COPY_OUT = "COPY OUT\n"                       // Written before the rows of a COPY ... TO STDOUT
+const COPY_IN = "COPY IN\n"                         // Written when the server is ready to read the rows of a COPY ... FROM STDIN
+const DEFAULT_WRITE_BUFFER_SIZE = 64 * 1024         // Bytes of responses buffered on a connection if not configured
+
 // TCPServer is the main AriaSQL Server structure
 type TCPServer struct {
 	Port       int    // Port to listen on, default is 3695
@@ -42,7 +72,417 @@ type TCPServer struct {
 	TLS        bool          // Enable TLS, default is false
 	TLSCert    string        // TLS certificate file
 	TLSKey     string        // TLS key file
-	json       bool          // Enable JSON output, default is false
+	JSON       bool          // Responses of new connections are JSON until the client sends json off, default is false
+	// Responses smaller than this many bytes are not compressed on compressed connections, default is 1024
+	CompressionThreshold int
+	// Expect a PROXY protocol v1 or v2 header on connections, the address of the client is the one the proxy reports
+	ProxyProtocol bool
+	// Networks of the proxies, CIDR, connections from other addresses have no header, required with ProxyProtocol
+	ProxyNetworks []string
+	// Statements taking this many milliseconds or longer are logged with the client which sent them, 0 disables the slow query log
+	SlowQueryTime int
+	// Bytes of responses buffered on a connection, written once the client sent no further statement or the buffer is full
+	// Default is 65536, below 0 writes every response as soon as it is ready
+	WriteBufferSize int
+	// Leave TCP_NODELAY off, the kernel coalesces small writes while earlier ones are not acknowledged, default is false
+	Nagle bool
+	// Port of the HTTP query endpoint, POST /query, 0 disables it
+	HTTPPort int
+	// Host the HTTP query endpoint listens on, default is the host of the server
+	HTTPHost string
+	// HTTP query endpoint, nil when disabled
+	endpoint *httpEndpoint
+	// ProxyNetworks parsed when the server is created
+	proxyNetworks []*net.IPNet
+}
+
+// proxyConn is a connection accepted from a proxy, its remote address is the address of the client
+type proxyConn struct {
+	net.Conn
+	remote net.Addr // Address of the client reported by the proxy
+}
+
+// RemoteAddr returns the address of the client
+func (c *proxyConn) RemoteAddr() net.Addr {
+	return c.remote
+}
+
+// lockedConn is a connection whose writes are serialized, responses and notifications are written from different goroutines
+type lockedConn struct {
+	net.Conn
+	lock        *sync.Mutex
+	pipelined   bool   // Statements and responses are frames, the connection is pipelined
+	compression string // Algorithm frames are compressed with, empty if none was negotiated
+	threshold   int    // Frames smaller than this many bytes are not compressed
+	buffer      []byte // Writes not yet written to the connection
+	bufferSize  int    // Bytes buffered at most before they are written, 0 if writes are not buffered
+	json        bool   // Responses are JSON, set with json on and json off, changed with the lock held
+}
+
+// framed returns true if statements and responses are length prefixed frames, on pipelined or compressed connections
+func (c *lockedConn) framed() bool {
+	return c.pipelined || c.compression != ""
+}
+
+// Write writes to the connection, a single frame when framed
+func (c *lockedConn) Write(b []byte) (int, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	err := c.write(b)
+	if err != nil {
+		return 0, err
+	}
+
+	return len(b), nil
+}
+
+// Flush writes the writes buffered to the connection
+func (c *lockedConn) Flush() error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return c.flush()
+}
+
+// flush writes the writes buffered, the lock is held
+func (c *lockedConn) flush() error {
+	if len(c.buffer) == 0 {
+		return nil
+	}
+
+	_, err := c.Conn.Write(c.buffer)
+	c.buffer = c.buffer[:0]
+
+	return err
+}
+
+// send buffers b, the buffer and b are written together once they do not fit, the lock is held
+// b is not copied if it does not fit, both are written in a single vectored write
+func (c *lockedConn) send(b []byte) error {
+	if c.bufferSize <= 0 {
+		_, err := c.Conn.Write(b)
+		return err
+	}
+
+	if len(c.buffer)+len(b) <= c.bufferSize {
+		c.buffer = append(c.buffer, b...)
+		return nil
+	}
+
+	buffers := net.Buffers{b}
+	if len(c.buffer) > 0 {
+		buffers = net.Buffers{c.buffer, b}
+	}
+
+	// Connections from a proxy are unwrapped, a TCP connection writes buffers with writev
+	var w io.Writer = c.Conn
+	if proxied, ok := c.Conn.(*proxyConn); ok {
+		w = proxied.Conn
+	}
+
+	_, err := buffers.WriteTo(w)
+	c.buffer = c.buffer[:0]
+
+	return err
+}
+
+// write writes b, or a frame of b when framed, the lock is held
+func (c *lockedConn) write(b []byte) error {
+	if !c.framed() {
+		return c.send(b)
+	}
+
+	size := uint32(len(b))
+
+	if c.compression != "" && len(b) >= c.threshold {
+		compressed, err := compress(c.compression, b)
+		if err != nil {
+			return err
+		}
+
+		// Compressing does not pay off for data which is already compressed
+		if len(compressed) < len(b) {
+			b = compressed
+			size = uint32(len(b)) | FRAME_COMPRESSED
+		}
+	}
+
+	header := make([]byte, 4)
+	binary.BigEndian.PutUint32(header, size)
+
+	if c.bufferSize <= 0 {
+		_, err := c.Conn.Write(append(header, b...))
+		return err
+	}
+
+	err := c.send(header)
+	if err != nil {
+		return err
+	}
+
+	return c.send(b)
+}
+
+// writeThen writes b and then changes how the writes which follow are framed
+func (c *lockedConn) writeThen(b []byte, change func()) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.write(b)
+	change()
+}
+
+// pipeline is the state of a pipelined connection
+type pipeline struct {
+	abort   bool // Skip the statements following a failed statement until the next sync
+	aborted bool // A statement failed, statements are skipped
+}
+
+// readFrame reads a length prefixed frame, decompressing it with the algorithm negotiated if it is compressed
+func readFrame(reader *bufio.Reader, compression string) ([]byte, error) {
+	header := make([]byte, 4)
+	_, err := io.ReadFull(reader, header)
+	if err != nil {
+		return nil, err
+	}
+
+	size := binary.BigEndian.Uint32(header)
+	compressed := size&FRAME_COMPRESSED != 0
+	size &^= FRAME_COMPRESSED
+
+	if size > MAX_FRAME_SIZE {
+		return nil, fmt.Errorf("frame of %d bytes exceeds %d bytes", size, MAX_FRAME_SIZE)
+	}
+
+	frame := make([]byte, size)
+	_, err = io.ReadFull(reader, frame)
+	if err != nil {
+		return nil, err
+	}
+
+	if !compressed {
+		return frame, nil
+	}
+
+	if compression == "" {
+		return nil, errors.New("compressed frame on a connection without compression")
+	}
+
+	return decompress(compression, frame)
+}
+
+// negotiate returns the first of the algorithms a client supports which the server supports, empty if there is none
+func negotiate(algorithms string) string {
+	for _, algorithm := range strings.Split(algorithms, ",") {
+		algorithm = strings.ToLower(strings.TrimSpace(algorithm))
+
+		switch algorithm {
+		case COMPRESSION_ZSTD, COMPRESSION_LZ4:
+			return algorithm
+		}
+	}
+
+	return ""
+}
+
+// compress compresses b with an algorithm
+func compress(algorithm string, b []byte) ([]byte, error) {
+	switch algorithm {
+	case COMPRESSION_ZSTD:
+		return zstd.Compress(nil, b)
+	case COMPRESSION_LZ4:
+		buf := bytes.NewBuffer(nil)
+		w := lz4.NewWriter(buf)
+
+		_, err := w.Write(b)
+		if err != nil {
+			return nil, err
+		}
+
+		err = w.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		return buf.Bytes(), nil
+	}
+
+	return nil, fmt.Errorf("unknown compression %s", algorithm)
+}
+
+// decompress decompresses b with an algorithm, up to MAX_FRAME_SIZE bytes
+func decompress(algorithm string, b []byte) ([]byte, error) {
+	var r io.Reader
+
+	switch algorithm {
+	case COMPRESSION_ZSTD:
+		zr := zstd.NewReader(bytes.NewReader(b))
+		defer zr.Close()
+
+		r = zr
+	case COMPRESSION_LZ4:
+		r = lz4.NewReader(bytes.NewReader(b))
+	default:
+		return nil, fmt.Errorf("unknown compression %s", algorithm)
+	}
+
+	frame, err := io.ReadAll(io.LimitReader(r, MAX_FRAME_SIZE+1))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(frame) > MAX_FRAME_SIZE {
+		return nil, fmt.Errorf("decompressed frame exceeds %d bytes", MAX_FRAME_SIZE)
+	}
+
+	return frame, nil
+}
+
+// parseProxyNetworks parses the networks of the proxies
+// A server reading PROXY protocol headers must be given the networks of its proxies, otherwise any client could send
+// a header and claim any address
+func (s *TCPServer) parseProxyNetworks() error {
+	if !s.ProxyProtocol {
+		return nil
+	}
+
+	if len(s.ProxyNetworks) == 0 {
+		return errors.New("proxyprotocol requires proxynetworks, the networks of the proxies")
+	}
+
+	s.proxyNetworks = make([]*net.IPNet, 0, len(s.ProxyNetworks))
+
+	for _, network := range s.ProxyNetworks {
+		_, ipNet, err := net.ParseCIDR(network)
+		if err != nil {
+			return fmt.Errorf("invalid proxy network %s: %s", network, err.Error())
+		}
+
+		s.proxyNetworks = append(s.proxyNetworks, ipNet)
+	}
+
+	return nil
+}
+
+// fromProxy returns true if a connection is expected to start with a PROXY protocol header
+func (s *TCPServer) fromProxy(conn net.Conn) bool {
+	if !s.ProxyProtocol {
+		return false
+	}
+
+	addr, ok := conn.RemoteAddr().(*net.TCPAddr)
+	if !ok {
+		return false
+	}
+
+	for _, ipNet := range s.proxyNetworks {
+		if ipNet.Contains(addr.IP) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// readProxyHeader reads the PROXY protocol v1 or v2 header a proxy sends ahead of the client's data
+// The address of the client is returned, nil if the proxy sent no address, for a health check or an UNKNOWN connection
+// Only the header is read, the client's data which follows is left on the connection
+func readProxyHeader(conn net.Conn) (net.Addr, error) {
+	// A v1 header is at least 15 bytes, PROXY UNKNOWN\r\n, and a v2 header is at least 16 bytes
+	header := make([]byte, 12)
+	_, err := io.ReadFull(conn, header)
+	if err != nil {
+		return nil, err
+	}
+
+	if string(header) == PROXY_V2_SIGNATURE {
+		return readProxyV2Header(conn)
+	}
+
+	if !bytes.HasPrefix(header, []byte("PROXY ")) {
+		return nil, errors.New("expected a PROXY protocol header")
+	}
+
+	// The rest of a v1 header is read a byte at a time so no data of the client is read
+	b := make([]byte, 1)
+	for !bytes.HasSuffix(header, []byte("\r\n")) {
+		if len(header) >= PROXY_V1_MAX_LENGTH {
+			return nil, errors.New("PROXY protocol header too long")
+		}
+
+		_, err = io.ReadFull(conn, b)
+		if err != nil {
+			return nil, err
+		}
+
+		header = append(header, b[0])
+	}
+
+	// PROXY TCP4|TCP6 source destination source-port destination-port, or PROXY UNKNOWN
+	fields := strings.Fields(string(header))
+	if len(fields) >= 2 && fields[1] == "UNKNOWN" {
+		return nil, nil
+	}
+
+	if len(fields) != 6 || (fields[1] != "TCP4" && fields[1] != "TCP6") {
+		return nil, fmt.Errorf("invalid PROXY protocol header %q", strings.TrimSpace(string(header)))
+	}
+
+	ip := net.ParseIP(fields[2])
+	if ip == nil {
+		return nil, fmt.Errorf("invalid PROXY protocol source address %s", fields[2])
+	}
+
+	port, err := strconv.ParseUint(fields[4], 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("invalid PROXY protocol source port %s", fields[4])
+	}
+
+	return &net.TCPAddr{IP: ip, Port: int(port)}, nil
+}
+
+// readProxyV2Header reads the binary PROXY protocol v2 header following its signature
+func readProxyV2Header(conn net.Conn) (net.Addr, error) {
+	// Version and command, address family and protocol, and the length of the addresses
+	header := make([]byte, 4)
+	_, err := io.ReadFull(conn, header)
+	if err != nil {
+		return nil, err
+	}
+
+	if header[0]>>4 != 2 {
+		return nil, fmt.Errorf("unsupported PROXY protocol version %d", header[0]>>4)
+	}
+
+	addresses := make([]byte, binary.BigEndian.Uint16(header[2:]))
+	_, err = io.ReadFull(conn, addresses)
+	if err != nil {
+		return nil, err
+	}
+
+	// A LOCAL connection is made by the proxy itself, a health check
+	if header[0]&0x0f == 0 {
+		return nil, nil
+	}
+
+	switch header[1] {
+	case 0x11: // TCP over IPv4
+		if len(addresses) < 12 {
+			return nil, errors.New("truncated PROXY protocol header")
+		}
+
+		return &net.TCPAddr{IP: net.IP(addresses[0:4]), Port: int(binary.BigEndian.Uint16(addresses[8:10]))}, nil
+	case 0x21: // TCP over IPv6
+		if len(addresses) < 36 {
+			return nil, errors.New("truncated PROXY protocol header")
+		}
+
+		return &net.TCPAddr{IP: net.IP(addresses[0:16]), Port: int(binary.BigEndian.Uint16(addresses[32:34]))}, nil
+	}
+
+	// Other families, such as UNIX sockets, have no address of a client
+	return nil, nil
 }
 
 // NewTCPServer creates a new TCPServer
@@ -56,7 +496,7 @@ func NewTCPServer(port int, host string, aria *core.AriaSQL, bufferSize int) (*T
 
 	// if it doesn't, create it with the default values
 
-	if _, err := os.Stat(fmt.Sprintf("%s%sariaserver.yaml", aria.Config.DataDir, shared.GetOsPathSeparator())); os.IsNotExist(err) {
+	if _, err := os.Stat(filepath.Join(aria.Config.DataDir, "ariaserver.yaml")); os.IsNotExist(err) {
 		// Resolve the string address to a TCP address
 		tcpAddr, err := net.ResolveTCPAddr("tcp4", fmt.Sprintf("%s:%d", host, port))
 		if err != nil {
@@ -71,7 +511,7 @@ func NewTCPServer(port int, host string, aria *core.AriaSQL, bufferSize int) (*T
 		server := &TCPServer{Port: port, Host: host, listener: listener, addr: tcpAddr, aria: aria, BufferSize: bufferSize}
 
 		// create a new file
-		f, err := os.Create(fmt.Sprintf("%s%sariaserver.yaml", aria.Config.DataDir, shared.GetOsPathSeparator()))
+		f, err := os.Create(filepath.Join(aria.Config.DataDir, "ariaserver.yaml"))
 		if err != nil {
 			return nil, err
 		}
@@ -93,7 +533,7 @@ func NewTCPServer(port int, host string, aria *core.AriaSQL, bufferSize int) (*T
 
 		// if there is no error, update the server struct values
 
-		b, err := os.ReadFile(fmt.Sprintf("%s%sariaserver.yaml", aria.Config.DataDir, shared.GetOsPathSeparator()))
+		b, err := os.ReadFile(filepath.Join(aria.Config.DataDir, "ariaserver.yaml"))
 		if err != nil {
 			return nil, err
 		}
@@ -108,6 +548,11 @@ func NewTCPServer(port int, host string, aria *core.AriaSQL, bufferSize int) (*T
 			return nil, err
 		}
 
+		err = server.parseProxyNetworks()
+		if err != nil {
+			return nil, err
+		}
+
 		// Resolve the string address to a TCP address
 		tcpAddr, err := net.ResolveTCPAddr("tcp4", fmt.Sprintf("%s:%d", server.Host, server.Port))
 		if err != nil {
@@ -124,6 +569,15 @@ func NewTCPServer(port int, host string, aria *core.AriaSQL, bufferSize int) (*T
 		server.listener = listener
 		server.addr = tcpAddr
 
+		// The HTTP query endpoint is bound along with the server, it serves once the server starts
+		if server.HTTPPort > 0 {
+			err = server.listenHTTP()
+			if err != nil {
+				listener.Close()
+				return nil, err
+			}
+		}
+
 		return &server, nil
 
 	}
@@ -132,6 +586,10 @@ func NewTCPServer(port int, host string, aria *core.AriaSQL, bufferSize int) (*T
 
 // Start starts the server
 func (s *TCPServer) Start() {
+	if s.endpoint != nil {
+		go s.serveHTTP()
+	}
+
 	for {
 		conn, err := s.listener.Accept()
 		if err != nil {
@@ -145,6 +603,10 @@ func (s *TCPServer) Start() {
 // Stop stops the server
 func (s *TCPServer) Stop() {
 	s.listener.Close()
+
+	if s.endpoint != nil {
+		s.endpoint.server.Close()
+	}
 }
 
 // handleConnection handles a connection
@@ -153,6 +615,28 @@ func (s *TCPServer) handleConnection(conn net.Conn) {
 	// Defer closing the connection
 	defer conn.Close()
 
+	// Go sets TCP_NODELAY on connections, small writes are sent right away unless Nagle's algorithm is enabled
+	if tcpConn, ok := conn.(*net.TCPConn); ok && s.Nagle {
+		tcpConn.SetNoDelay(false)
+	}
+
+	// Behind a proxy the address of the client is read from the PROXY protocol header
+	if s.fromProxy(conn) {
+		conn.SetReadDeadline(time.Now().Add(PROXY_HEADER_TIMEOUT))
+
+		remote, err := readProxyHeader(conn)
+		if err != nil {
+			log.Printf("connection from %s: %s", conn.RemoteAddr(), err.Error())
+			return
+		}
+
+		conn.SetReadDeadline(time.Time{})
+
+		if remote != nil {
+			conn = &proxyConn{Conn: conn, remote: remote}
+		}
+	}
+
 	// Create a new buffer to read from the connection
 	buf := make([]byte, s.BufferSize)
 
@@ -176,96 +660,487 @@ func (s *TCPServer) handleConnection(conn net.Conn) {
 	username := strings.Split(string(decodedAuth), "\\0")[0]
 	password := strings.Split(string(decodedAuth), "\\0")[1]
 
+	// Connection parameters follow the password as \0key=value, unknown parameters are ignored
+	parameters := connectionParameters(strings.Split(string(decodedAuth), "\\0")[2:])
+
 	// Authenticate the user
 	user, err := s.aria.Catalog.AuthenticateUser(username, password)
 	if err != nil {
+		log.Printf("authentication of %s from %s failed", username, conn.RemoteAddr())
 		conn.Write([]byte("ERR: Authentication failed\n"))
 		return
 	}
 
+	if username == catalog.DEFAULT_ADMIN_USER && password == catalog.DEFAULT_ADMIN_PASSWORD {
+		log.Printf("WARNING: %s logged in from %s with the default password %s, change it with ALTER USER %s SET PASSWORD", username, conn.RemoteAddr(), catalog.DEFAULT_ADMIN_PASSWORD, username)
+	}
+
 	// Check if user has CONNECT privilege
 	if !user.HasPrivilege("", "", []shared.PrivilegeAction{shared.PRIV_CONNECT}) {
+		log.Printf("connection of %s from %s refused, no CONNECT privilege", username, conn.RemoteAddr())
 		conn.Write([]byte("ERR: User does not have CONNECT privilege\n"))
 		return
 	}
 
 	// Open a new channel
 	channel := s.aria.OpenChannel(user)
+	channel.Address = conn.RemoteAddr().String()
+	channel.ApplicationName = parameters["application_name"]
+	channel.ClientVersion = parameters["client_version"]
+	channel.Labels = labels(parameters)
 	defer s.aria.CloseChannel(channel)
 
+	// Close the shard connections of the channel in coordinator mode
+	if s.aria.Coordinator != nil {
+		defer s.aria.Coordinator.CloseChannel(channel)
+	}
+
 	// Write the OK response to the connection
 	// We also pass AriaSQL version to client
 	// The reasoning behind this is so a client connecting can check the AriaSQL version, possibly right when connecting for example, on the CLI.
 	conn.Write([]byte("OK\nVERSION: " + shared.VERSION + "\n"))
 
-	exe := executor.New(s.aria, channel)
-
-	if s.json {
-		exe.SetJsonOutput(true)
+	// Notifications on listened notification channels are written as they arrive, between responses
+	// JSON output is a setting of the connection, json on and json off leave other connections as they are
+	locked := &lockedConn{Conn: conn, lock: &sync.Mutex{}, threshold: s.CompressionThreshold, bufferSize: s.WriteBufferSize, json: s.JSON}
+	if locked.threshold <= 0 {
+		locked.threshold = DEFAULT_COMPRESSION_THRESHOLD
+	}
 
+	if locked.bufferSize == 0 {
+		locked.bufferSize = DEFAULT_WRITE_BUFFER_SIZE
 	}
 
+	// Responses still buffered are written before the connection is closed
+	defer locked.Flush()
+
+	conn = locked
+
+	// Frames are read through a buffer, a pipelining client may send many at once
+	reader := bufio.NewReaderSize(conn, s.BufferSize)
+	var pipe *pipeline
+
+	done := make(chan struct{})
+	defer close(done)
+
+	go s.writeNotifications(locked, channel, done)
+
+	exe := executor.New(s.aria, channel)
+	exe.SetJsonOutput(locked.json)
+
 	for {
-		// Read from the connection
-		n, err := conn.Read(buf)
+		// Responses are written once the statements a client pipelined were all read, before waiting on the next
+		if reader.Buffered() == 0 {
+			err = locked.Flush()
+			if err != nil {
+				return
+			}
+		}
+
+		// Read from the connection, the channel waits on the client until the next query arrives
+		var q []byte
+
+		end := channel.Waits.Begin(wait.CLIENT_READ)
+		if locked.framed() {
+			q, err = readFrame(reader, locked.compression)
+		} else {
+			n, err = reader.Read(buf)
+			q = buf[:n]
+		}
+		end()
 		if err != nil {
 			return
 		}
 
-		q := buf[:n]
+		cmd := bytes.TrimSpace(bytes.TrimSuffix(q, []byte(";")))
 
 		switch {
-		case bytes.Equal([]byte("close"), bytes.TrimSpace(bytes.TrimSuffix(q, []byte(";")))):
+		case bytes.Equal([]byte("close"), cmd):
 			// Close the connection
 			return
-		case bytes.HasPrefix([]byte("json on"), bytes.TrimSpace(bytes.TrimSuffix(q, []byte(";")))):
-			// Enable JSON output
-			s.json = true
+		case bytes.Equal([]byte("pipeline on"), cmd) || bytes.Equal([]byte("pipeline on abort"), cmd):
+			// Pipeline the connection, statements and responses are length prefixed frames from now on
+			// On a pipelined connection only whether a failed statement aborts those following changes
+			pipe = &pipeline{abort: bytes.HasSuffix(cmd, []byte("abort"))}
+			locked.writeThen(ok(locked.json), func() { locked.pipelined = true })
+			continue
+		case pipe != nil && bytes.Equal([]byte("pipeline off"), cmd):
+			// The response to pipeline off is the last frame unless the connection is compressed
+			pipe = nil
+			locked.writeThen(ok(locked.json), func() { locked.pipelined = false })
+			continue
+		case locked.compression == "" && bytes.HasPrefix(cmd, []byte("compression ")):
+			// The client lists the algorithms it supports by preference, statements and responses are frames from now on if one is supported
+			algorithm := negotiate(string(bytes.TrimPrefix(cmd, []byte("compression "))))
+			locked.writeThen(compressionResponse(algorithm, locked.json), func() { locked.compression = algorithm })
+			continue
+		case pipe != nil && bytes.Equal([]byte("sync"), cmd):
+			// Statements following a sync are executed again
+			// The client waits on the responses up to the sync, they are written even if more of its frames were read
+			pipe.aborted = false
+			conn.Write(ok(locked.json))
+
+			err = locked.Flush()
+			if err != nil {
+				return
+			}
+
+			continue
+		case pipe != nil && pipe.aborted:
+			conn.Write([]byte("ERR: statement skipped, an earlier statement of the pipeline failed\n"))
+			continue
+		case bytes.Equal([]byte("json on"), cmd):
+			// Enable JSON output on this connection
 			exe.SetJsonOutput(true)
-			conn.Write([]byte(`{"status":"OK"}` + "\n"))
+			locked.writeThen(ok(true), func() { locked.json = true })
 			continue
-		case bytes.HasPrefix([]byte("json off"), bytes.TrimSpace(bytes.TrimSuffix(q, []byte(";")))):
-			// Disable JSON output
-			s.json = false
+		case bytes.Equal([]byte("json off"), cmd):
+			// Disable JSON output on this connection
 			exe.SetJsonOutput(false)
-			conn.Write([]byte("OK\n"))
+			locked.writeThen(ok(false), func() { locked.json = false })
 			continue
 		default:
+			err = s.handleQuery(locked, reader, channel, exe, q)
+			if err != nil && pipe != nil && pipe.abort {
+				pipe.aborted = true
+			}
+		}
+	}
 
-			lexer := parser.NewLexer(q)
+}
 
-			p := parser.NewParser(lexer)
-			ast, err := p.Parse()
-			if err != nil {
-				conn.Write(append([]byte(fmt.Sprintf("ERR: %s", err.Error())), []byte("\n")...))
-				continue
-			}
+// handleQuery parses and executes a query and writes its response, within a span continuing the trace of the application
+// The rows of a COPY are read through reader, the reader of the connection
+// The error written as response is returned
+func (s *TCPServer) handleQuery(conn *lockedConn, reader *bufio.Reader, channel *core.Channel, exe *executor.Executor, q []byte) (err error) {
+	ctx, span := startQuery(channel, q)
 
-			err = exe.Execute(ast)
-			if err != nil {
-				// Write the error to the connection
-				conn.Write(append([]byte(fmt.Sprintf("ERR: %s", err.Error())), []byte("\n")...))
-				continue
-			}
+	defer func() { span.End(err) }()
 
-			// Write the response to the connection
-			if len(exe.GetResultSet()) == 0 {
-				if s.json {
-					conn.Write([]byte(`{"status":"OK"}` + "\n"))
-				} else {
-					conn.Write([]byte("OK\n"))
-				}
-			} else {
-				conn.Write(append(exe.GetResultSet(), []byte("\n")...))
+	lexer := parser.NewLexer(q)
+
+	p := parser.NewParser(lexer)
+
+	_, parseSpan := tracing.Start(ctx, "parse")
+	ast, err := p.Parse()
+	parseSpan.End(err)
+	if err != nil {
+		conn.Write(append([]byte(fmt.Sprintf("ERR: %s", err.Error())), []byte("\n")...))
+		return
+	}
 
+	// Rules are checked before the statement is executed or routed, a rule can block or rewrite it
+	if s.aria.Firewall != nil {
+		err = s.aria.Firewall.Check(channel, q, ast)
+		if err != nil {
+			conn.Write(append([]byte(fmt.Sprintf("ERR: %s", err.Error())), []byte("\n")...))
+			return
+		}
+	}
+
+	// A user whose password was generated changes it before anything else
+	if channel.User.MustChangePassword && !changesPassword(channel, ast) {
+		err = fmt.Errorf("password change required, run ALTER USER %s SET PASSWORD 'newpassword'", channel.User.Username)
+		conn.Write(append([]byte(fmt.Sprintf("ERR: %s", err.Error())), []byte("\n")...))
+		return
+	}
+
+	copyStmt, isCopy := ast.(*parser.CopyStmt)
+
+	// In coordinator mode the query is routed to the shards, notifications stay on the coordinator
+	if s.aria.Coordinator != nil && isCopy {
+		err = errors.New("COPY is not supported in coordinator mode")
+		conn.Write(append([]byte(fmt.Sprintf("ERR: %s", err.Error())), []byte("\n")...))
+		return
+	}
+
+	if s.aria.Coordinator != nil && !isNotificationStmt(ast) {
+		var result []byte
+		result, err = s.aria.Coordinator.Execute(channel, q, ast, conn.json)
+		if err != nil {
+			conn.Write(append([]byte(fmt.Sprintf("ERR: %s", err.Error())), []byte("\n")...))
+			return
+		}
+
+		if len(result) == 0 {
+			if conn.json {
+				conn.Write([]byte(`{"status":"OK"}` + "\n"))
+			} else {
+				conn.Write([]byte("OK\n"))
 			}
+		} else {
+			conn.Write(append(result, []byte("\n")...))
+		}
+
+		return
+	}
 
-			// Clear the response buffer
-			exe.Clear()
+	exe.SetContext(ctx)
+	defer exe.SetContext(context.Background())
 
-			continue
+	err = s.record(channel, exe, q, ast, func() error {
+		if isCopy {
+			return s.copy(conn, reader, exe, copyStmt)
+		}
 
+		return exe.Execute(ast)
+	})
+	if err != nil {
+		// Write the error to the connection
+		conn.Write(append([]byte(fmt.Sprintf("ERR: %s", err.Error())), []byte("\n")...))
+		return
+	}
+
+	// Write the response to the connection
+	if len(exe.GetResultSet()) == 0 {
+		if conn.json {
+			conn.Write([]byte(`{"status":"OK"}` + "\n"))
+		} else {
+			conn.Write([]byte("OK\n"))
 		}
+	} else {
+		conn.Write(append(exe.GetResultSet(), []byte("\n")...))
+
+	}
+
+	// Clear the response buffer
+	exe.Clear()
+
+	return nil
+}
+
+// startQuery starts the span of a statement sent by a client, continuing the trace of the application
+func startQuery(channel *core.Channel, q []byte) (context.Context, *tracing.Span) {
+	attrs := []attribute.KeyValue{
+		attribute.String("db.system", "ariasql"),
+		attribute.String("db.user", channel.User.Username),
+		attribute.String("db.query.text", tracing.Statement(q)),
+	}
+
+	if channel.Database != nil {
+		attrs = append(attrs, attribute.String("db.namespace", channel.Database.Name))
+	}
+
+	return tracing.Start(tracing.Extract(context.Background(), q), "query", attrs...)
+}
+
+// record runs a statement sent by a client with execute, records it in the statement statistics and logs it if slow
+func (s *TCPServer) record(channel *core.Channel, exe *executor.Executor, q []byte, ast parser.Statement, execute func() error) error {
+	database := ""
+	if channel.Database != nil {
+		database = channel.Database.Name
+	}
+
+	// The resource watchdog cancels the query through the channel
+	channel.BeginQuery(parser.Normalize(q))
+	defer channel.EndQuery()
+
+	start := time.Now()
+	err := execute()
+	elapsed := time.Since(start)
+	s.aria.Statements.Record(q, database, channel.User.Username, elapsed, exe.Rows(), err)
+
+	if s.SlowQueryTime > 0 && elapsed >= time.Duration(s.SlowQueryTime)*time.Millisecond {
+		log.Printf("slow query: %s by %s on %s took %s: %s", tracing.Operation(ast), channel.Client(), database, elapsed, parser.Normalize(q))
+	}
+
+	return err
+}
+
+// copy streams the rows of a COPY between a table and the client, in the COPY text format
+// COPY ... TO STDOUT writes COPY OUT, the rows and a line of \. before the response, no notification is written in between
+// COPY ... FROM STDIN writes COPY IN, the client then sends the rows and a line of \. before it reads the response
+// On a framed connection rows are sent within frames, a line can span frames
+func (s *TCPServer) copy(conn *lockedConn, reader *bufio.Reader, exe *executor.Executor, stmt *parser.CopyStmt) error {
+	if stmt.From {
+		_, err := exe.CopyIn(stmt, &copyReader{conn: conn, reader: reader})
+		return err
+	}
+
+	conn.lock.Lock()
+	defer conn.lock.Unlock()
+
+	out := &copyWriter{conn: conn}
+
+	_, err := exe.CopyOut(stmt, out)
+	if err != nil && !out.begun {
+		return err
+	}
+
+	// Rows end even if the copy failed part way, its error follows
+	_, endErr := out.Write([]byte(executor.COPY_END + "\n"))
+	if err != nil {
+		return err
+	}
+
+	return endErr
+}
+
+// copyWriter writes the rows of a COPY ... TO STDOUT to a connection whose lock is held, COPY OUT is written first
+type copyWriter struct {
+	conn  *lockedConn
+	begun bool // COPY OUT was written
+}
+
+// Write writes rows to the connection, a single frame when framed
+func (w *copyWriter) Write(b []byte) (int, error) {
+	rows := b
+
+	if !w.begun {
+		w.begun = true
+		b = append([]byte(COPY_OUT), b...)
+	}
+
+	err := w.conn.write(b)
+	if err != nil {
+		return 0, err
+	}
+
+	return len(rows), nil
+}
+
+// copyReader reads the rows of a COPY ... FROM STDIN from a connection, COPY IN is written before the first read
+type copyReader struct {
+	conn   *lockedConn
+	reader *bufio.Reader
+	begun  bool   // COPY IN was written
+	frame  []byte // Rest of the frame read last when framed
+}
+
+// Read reads rows from the connection
+func (r *copyReader) Read(b []byte) (int, error) {
+	if !r.begun {
+		r.begun = true
+
+		_, err := r.conn.Write([]byte(COPY_IN))
+		if err != nil {
+			return 0, err
+		}
+
+		// The client sends the rows once it read COPY IN
+		err = r.conn.Flush()
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	if !r.conn.framed() {
+		return r.reader.Read(b)
+	}
+
+	for len(r.frame) == 0 {
+		frame, err := readFrame(r.reader, r.conn.compression)
+		if err != nil {
+			return 0, err
+		}
+
+		r.frame = frame
+	}
+
+	n := copy(b, r.frame)
+	r.frame = r.frame[n:]
+
+	return n, nil
+}
+
+// changesPassword returns true if a statement sets the password of the user of the channel
+func changesPassword(channel *core.Channel, ast parser.Statement) bool {
+	stmt, ok := ast.(*parser.AlterUserStmt)
+
+	return ok && stmt.SetType == parser.ALTER_USER_SET_PASSWORD && stmt.Username.Value == channel.User.Username
+}
+
+// connectionParameters returns the key=value parameters sent with the authentication string
+func connectionParameters(fields []string) map[string]string {
+	parameters := make(map[string]string)
+
+	for _, field := range fields {
+		key, value, ok := strings.Cut(field, "=")
+		if ok {
+			parameters[key] = value
+		}
+	}
+
+	return parameters
+}
+
+// labels returns the labels among the connection parameters, sent as label.key=value
+func labels(parameters map[string]string) map[string]string {
+	labels := make(map[string]string)
+
+	for key, value := range parameters {
+		if label, ok := strings.CutPrefix(key, LABEL_PREFIX); ok && label != "" {
+			labels[label] = value
+		}
+	}
+
+	return labels
+}
+
+// ok returns the OK response, in JSON on a connection with JSON output
+func ok(json bool) []byte {
+	if json {
+		return []byte(`{"status":"OK"}` + "\n")
+	}
+
+	return []byte("OK\n")
+}
+
+// compressionResponse returns the response to compression, the algorithm negotiated or none
+func compressionResponse(algorithm string, json bool) []byte {
+	if algorithm == "" {
+		algorithm = "none"
+	}
+
+	if json {
+		return []byte(`{"compression":"` + algorithm + `"}` + "\n")
+	}
+
+	return []byte("COMPRESSION: " + algorithm + "\n")
+}
+
+// writeNotifications writes the notifications received by a channel to its connection until done is closed
+// A notification is a line of its own, NOTIFY: channel sender "payload" or {"notify":"channel","payload":"payload","sender":sender} with JSON output
+// A notification is written right away, with the responses buffered before it
+func (s *TCPServer) writeNotifications(conn *lockedConn, channel *core.Channel, done chan struct{}) {
+	for {
+		select {
+		case <-done:
+			return
+		case notification := <-channel.Notifications:
+			var line []byte
+
+			conn.lock.Lock()
+
+			if conn.json {
+				line, _ = json.Marshal(map[string]interface{}{
+					"notify":  notification.Channel,
+					"payload": notification.Payload,
+					"sender":  notification.Sender,
+				})
+			} else {
+				line = []byte(fmt.Sprintf("NOTIFY: %s %d %s", notification.Channel, notification.Sender, strconv.Quote(notification.Payload)))
+			}
+
+			err := conn.write(append(line, []byte("\n")...))
+			if err == nil {
+				err = conn.flush()
+			}
+			conn.lock.Unlock()
+
+			if err != nil {
+				return
+			}
+		}
+	}
+}
+
+// isNotificationStmt returns true for LISTEN, UNLISTEN and NOTIFY statements
+func isNotificationStmt(ast interface{}) bool {
+	switch ast.(type) {
+	case *parser.ListenStmt, *parser.UnlistenStmt, *parser.NotifyStmt:
+		return true
 	}
 
+	return false
 }
@@ -18,23 +18,42 @@
 package server
 
 import (
+	"ariasql/catalog"
 	"ariasql/core"
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
 	"net"
 	"os"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 )
 
 func TestNewTCPServer(t *testing.T) {
-	aria := core.New(&core.Config{
-		DataDir: "./",
+	defer os.RemoveAll("./test")
+
+	aria, err := core.New(&core.Config{
+		DataDir: "./test",
 	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer aria.WAL.Close()
 
 	server, err := NewTCPServer(3695, "0.0.0.0", aria, 1024)
 	if err != nil {
 		t.Fatalf("Failed to create new server: %v", err)
 	}
 
+	defer server.Stop()
+
 	if server.Port != 3695 {
 		t.Errorf("Expected port to be 3695, got %d", server.Port)
 	}
@@ -49,15 +68,16 @@ func TestNewTCPServer(t *testing.T) {
 }
 
 func TestTCPServer_Start(t *testing.T) {
-	defer os.RemoveAll("databases")
-	defer os.Remove("ariasql.log")
-	defer os.Remove(".ariaconfig")
-	defer os.Remove("ariaserver.yaml")
-	aria := core.New(&core.Config{
-		DataDir: "./",
+	defer os.RemoveAll("./test")
+
+	aria, err := core.New(&core.Config{
+		DataDir: "./test",
 	})
+	if err != nil {
+		t.Fatal(err)
+	}
 
-	err := aria.Catalog.Open()
+	err = aria.Catalog.Open()
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -83,5 +103,737 @@ func TestTCPServer_Start(t *testing.T) {
 
 	// Stop the server
 	server.Stop()
-	aria.Catalog.Close()
+	aria.Close()
+}
+
+// proxyV2Header returns a PROXY protocol v2 header of a command, address family and protocol, and addresses
+func proxyV2Header(command, family byte, addresses []byte) []byte {
+	header := append([]byte(PROXY_V2_SIGNATURE), 0x20|command, family, 0, 0)
+	binary.BigEndian.PutUint16(header[14:], uint16(len(addresses)))
+
+	return append(header, addresses...)
+}
+
+func TestReadProxyHeader(t *testing.T) {
+	// Source 192.0.2.1:56324, destination 198.51.100.1:3695
+	ipv4 := []byte{192, 0, 2, 1, 198, 51, 100, 1, 0xdc, 0x04, 0x0e, 0x6f}
+
+	// Source [2001:db8::1]:56324, destination [2001:db8::2]:3695
+	ipv6 := append(append(append(net.ParseIP("2001:db8::1").To16(), net.ParseIP("2001:db8::2").To16()...), 0xdc, 0x04), 0x0e, 0x6f)
+
+	unix := make([]byte, 216)
+	copy(unix, "/var/run/client.sock")
+
+	for _, test := range []struct {
+		name   string
+		header []byte
+		addr   string // Address of the client returned, empty if none
+		err    string // Error returned, empty if none
+	}{
+		// Version 1
+		{name: "v1 TCP4", header: []byte("PROXY TCP4 192.0.2.1 198.51.100.1 56324 3695\r\n"), addr: "192.0.2.1:56324"},
+		{name: "v1 TCP6", header: []byte("PROXY TCP6 2001:db8::1 2001:db8::2 56324 3695\r\n"), addr: "[2001:db8::1]:56324"},
+		{name: "v1 UNKNOWN", header: []byte("PROXY UNKNOWN\r\n")},
+		{name: "v1 UNKNOWN with addresses", header: []byte("PROXY UNKNOWN 192.0.2.1 198.51.100.1 56324 3695\r\n")},
+		{name: "v1 longest", header: []byte("PROXY TCP6 ffff:ffff:ffff:ffff:ffff:ffff:ffff:ffff ffff:ffff:ffff:ffff:ffff:ffff:ffff:ffff 65535 65535\r\n"), addr: "[ffff:ffff:ffff:ffff:ffff:ffff:ffff:ffff]:65535"},
+		{name: "v1 truncated", header: []byte("PROXY TCP4 192.0.2.1"), err: "EOF"},
+		{name: "v1 truncated signature", header: []byte("PROXY"), err: "EOF"},
+		{name: "v1 oversized", header: []byte("PROXY TCP4 " + strings.Repeat("1", PROXY_V1_MAX_LENGTH) + "\r\n"), err: "PROXY protocol header too long"},
+		{name: "v1 not a header", header: []byte("SELECT 1 FROM t;\r\n"), err: "expected a PROXY protocol header"},
+		{name: "v1 unknown protocol", header: []byte("PROXY UDP4 192.0.2.1 198.51.100.1 56324 3695\r\n"), err: "invalid PROXY protocol header"},
+		{name: "v1 missing port", header: []byte("PROXY TCP4 192.0.2.1 198.51.100.1 56324\r\n"), err: "invalid PROXY protocol header"},
+		{name: "v1 invalid address", header: []byte("PROXY TCP4 192.0.2 198.51.100.1 56324 3695\r\n"), err: "invalid PROXY protocol source address"},
+		{name: "v1 invalid port", header: []byte("PROXY TCP4 192.0.2.1 198.51.100.1 65536 3695\r\n"), err: "invalid PROXY protocol source port"},
+
+		// Version 2
+		{name: "v2 PROXY TCP over IPv4", header: proxyV2Header(1, 0x11, ipv4), addr: "192.0.2.1:56324"},
+		{name: "v2 PROXY TCP over IPv6", header: proxyV2Header(1, 0x21, ipv6), addr: "[2001:db8::1]:56324"},
+		{name: "v2 PROXY UDP over IPv4", header: proxyV2Header(1, 0x12, ipv4)},
+		{name: "v2 PROXY UNIX stream", header: proxyV2Header(1, 0x31, unix)},
+		{name: "v2 PROXY UNSPEC", header: proxyV2Header(1, 0x00, nil)},
+		{name: "v2 PROXY with TLVs", header: proxyV2Header(1, 0x11, append(append([]byte{}, ipv4...), 0x04, 0x00, 0x01, 0x00)), addr: "192.0.2.1:56324"},
+		{name: "v2 LOCAL", header: proxyV2Header(0, 0x00, nil)},
+		{name: "v2 LOCAL with addresses", header: proxyV2Header(0, 0x11, ipv4)},
+		{name: "v2 truncated signature", header: []byte(PROXY_V2_SIGNATURE[:8]), err: "EOF"},
+		{name: "v2 truncated header", header: proxyV2Header(1, 0x11, ipv4)[:14], err: "EOF"},
+		{name: "v2 truncated addresses", header: proxyV2Header(1, 0x11, ipv4)[:20], err: "EOF"},
+		{name: "v2 IPv4 addresses too short", header: proxyV2Header(1, 0x11, ipv4[:8]), err: "truncated PROXY protocol header"},
+		{name: "v2 IPv6 addresses too short", header: proxyV2Header(1, 0x21, ipv4), err: "truncated PROXY protocol header"},
+		{name: "v2 unsupported version", header: append([]byte(PROXY_V2_SIGNATURE), 0x11, 0x11, 0, 0), err: "unsupported PROXY protocol version 1"},
+	} {
+		client, server := net.Pipe()
+
+		// The data of the client following a header is left on the connection, a truncated header is all there is
+		go func() {
+			if test.err == "" {
+				client.Write(append(test.header, "SELECT 1;"...))
+			} else {
+				client.Write(test.header)
+			}
+
+			client.Close()
+		}()
+
+		addr, err := readProxyHeader(server)
+
+		switch {
+		case test.err != "":
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Fatalf("%s: expected error %q, got %v", test.name, test.err, err)
+			}
+		case err != nil:
+			t.Fatalf("%s: %v", test.name, err)
+		case test.addr == "" && addr != nil:
+			t.Fatalf("%s: expected no address, got %s", test.name, addr)
+		case test.addr != "" && (addr == nil || addr.String() != test.addr):
+			t.Fatalf("%s: expected address %s, got %v", test.name, test.addr, addr)
+		default:
+			rest, err := io.ReadAll(server)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if string(rest) != "SELECT 1;" {
+				t.Fatalf("%s: expected the data of the client to be left, got %q", test.name, rest)
+			}
+		}
+
+		server.Close()
+	}
+}
+
+// recordingConn is a connection recording every write to it, failing them with err if set
+type recordingConn struct {
+	net.Conn
+	writes [][]byte // Bytes of every write, in order
+	err    error    // Error of the writes
+}
+
+// Write records b, or fails with err
+
+func TestTCPServer_fromProxy(t *testing.T) {
+	for _, test := range []struct {
+		networks []string
+		err      string
+	}{
+		{err: "proxyprotocol requires proxynetworks"},
+		{networks: []string{"10.0.0.0/24", "10.0.1.1"}, err: "invalid proxy network 10.0.1.1"},
+	} {
+		s := &TCPServer{ProxyProtocol: true, ProxyNetworks: test.networks}
+
+		err := s.parseProxyNetworks()
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Fatalf("expected error %q for %v, got %v", test.err, test.networks, err)
+		}
+	}
+
+	s := &TCPServer{ProxyProtocol: true, ProxyNetworks: []string{"10.0.0.0/24", "2001:db8::/32"}}
+
+	err := s.parseProxyNetworks()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for ip, proxied := range map[string]bool{"10.0.0.7": true, "2001:db8::1": true, "10.0.1.7": false, "192.0.2.1": false} {
+		conn := &proxyConn{remote: &net.TCPAddr{IP: net.ParseIP(ip), Port: 56324}}
+
+		if s.fromProxy(conn) != proxied {
+			t.Fatalf("expected a connection from %s to be from a proxy: %v", ip, proxied)
+		}
+	}
+}
+func (c *recordingConn) Write(b []byte) (int, error) {
+	if c.err != nil {
+		return 0, c.err
+	}
+
+	c.writes = append(c.writes, append([]byte{}, b...))
+
+	return len(b), nil
+}
+
+// frame returns b as a length prefixed frame
+func frame(b string) []byte {
+	header := make([]byte, 4)
+	binary.BigEndian.PutUint32(header, uint32(len(b)))
+
+	return append(header, b...)
+}
+
+func TestLockedConnBuffering(t *testing.T) {
+	rec := &recordingConn{}
+	conn := &lockedConn{Conn: rec, lock: &sync.Mutex{}, pipelined: true, bufferSize: 64}
+
+	// Responses to pipelined statements are buffered until flushed, then written at once in order
+	for _, response := range []string{"OK\n", "ERR: table does not exist\n", "OK\n"} {
+		_, err := conn.Write([]byte(response))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if len(rec.writes) != 0 {
+		t.Fatalf("expected the responses to be buffered, got %d writes", len(rec.writes))
+	}
+
+	err := conn.Flush()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := bytes.Join([][]byte{frame("OK\n"), frame("ERR: table does not exist\n"), frame("OK\n")}, nil)
+	if len(rec.writes) != 1 || !bytes.Equal(rec.writes[0], expected) {
+		t.Fatalf("expected a single write of the responses, got %q", rec.writes)
+	}
+
+	// Flushing an empty buffer writes nothing
+	err = conn.Flush()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(rec.writes) != 1 {
+		t.Fatalf("expected no write, got %d writes", len(rec.writes))
+	}
+
+	// A response which does not fit is written right away after the responses buffered before it
+	rec.writes = nil
+
+	_, err = conn.Write([]byte("OK\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	large := strings.Repeat("x", 100)
+
+	_, err = conn.Write([]byte(large))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected = append(frame("OK\n"), frame(large)...)
+	if !bytes.Equal(bytes.Join(rec.writes, nil), expected) {
+		t.Fatalf("expected the buffered response before the large one, got %q", rec.writes)
+	}
+
+	if len(conn.buffer) != 0 {
+		t.Fatalf("expected the buffer to be empty, got %q", conn.buffer)
+	}
+
+	// Writes are not buffered with a buffer size below 0
+	rec.writes = nil
+	conn.bufferSize = -1
+
+	_, err = conn.Write([]byte("OK\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(rec.writes) != 1 || !bytes.Equal(rec.writes[0], frame("OK\n")) {
+		t.Fatalf("expected the response to be written right away, got %q", rec.writes)
+	}
+}
+
+func TestLockedConnWriteError(t *testing.T) {
+	rec := &recordingConn{}
+	conn := &lockedConn{Conn: rec, lock: &sync.Mutex{}, bufferSize: 64}
+
+	rec.err = errors.New("connection reset by peer")
+
+	// A buffered write does not reach the connection, its error is returned on flushing
+	_, err := conn.Write([]byte("OK\n"))
+	if err != nil {
+		t.Fatalf("expected the write to be buffered, got %v", err)
+	}
+
+	err = conn.Flush()
+	if err == nil || err.Error() != "connection reset by peer" {
+		t.Fatalf("expected the error of the connection, got %v", err)
+	}
+
+	// The responses which failed are not written again
+	rec.err = nil
+
+	err = conn.Flush()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(rec.writes) != 0 {
+		t.Fatalf("expected no write, got %q", rec.writes)
+	}
+
+	// A write which does not fit fails right away
+	rec.err = errors.New("broken pipe")
+
+	_, err = conn.Write([]byte(strings.Repeat("x", 100)))
+	if err == nil || err.Error() != "broken pipe" {
+		t.Fatalf("expected the error of the connection, got %v", err)
+	}
+}
+
+// startTestServer starts a server on a port with a data directory in ./test, the admin password is s3cret
+// The returned function stops the server and removes the data directory
+func startTestServer(t *testing.T, port int) (*TCPServer, func()) {
+	aria, err := core.New(&core.Config{DataDir: "./test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	aria.Catalog = catalog.New(aria.Config.DataDir)
+	aria.Catalog.AdminPassword = "s3cret"
+
+	err = aria.Catalog.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	aria.Channels = make([]*core.Channel, 0)
+	aria.ChannelsLock = &sync.Mutex{}
+
+	s, err := NewTCPServer(port, "127.0.0.1", aria, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go s.Start()
+
+	return s, func() {
+		s.Stop()
+		aria.Close()
+		os.RemoveAll("./test")
+	}
+}
+
+// dialTestServer connects to a server started with startTestServer as admin
+func dialTestServer(t *testing.T, port int) (net.Conn, *bufio.Reader) {
+	conn, err := net.Dial("tcp", fmt.Sprintf("127.0.0.1:%d", port))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conn.SetDeadline(time.Now().Add(10 * time.Second))
+
+	reader := bufio.NewReader(conn)
+
+	_, err = conn.Write([]byte(base64.StdEncoding.EncodeToString([]byte("admin\\0s3cret"))))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, expected := range []string{"OK\n", "VERSION: "} {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !strings.HasPrefix(line, expected) {
+			t.Fatalf("expected %q, got %q", expected, line)
+		}
+	}
+
+	return conn, reader
+}
+
+// pipelineTestConn sends pipeline on, or another command switching to frames, on a connection of dialTestServer
+func pipelineTestConn(t *testing.T, conn net.Conn, reader *bufio.Reader, command string) {
+	_, err := conn.Write([]byte(command))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	line, err := reader.ReadString('\n')
+	if err != nil || line != "OK\n" {
+		t.Fatalf("expected OK to %s, got %q %v", command, line, err)
+	}
+}
+
+func TestPipelineSyncFlush(t *testing.T) {
+	_, stop := startTestServer(t, 3693)
+	defer stop()
+
+	conn, reader := dialTestServer(t, 3693)
+	defer conn.Close()
+
+	pipelineTestConn(t, conn, reader, "pipeline on")
+
+	// The server has read part of the next frame after the sync, the responses up to the sync are written nonetheless
+	batch := bytes.Join([][]byte{frame("CREATE DATABASE shop;"), frame("SELEC 1;"), frame("sync"), frame("close")[:2]}, nil)
+
+	_, err := conn.Write(batch)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, expected := range []string{"OK\n", "ERR: ", "OK\n"} {
+		response, err := readFrame(reader, "")
+		if err != nil {
+			t.Fatalf("expected the response %q before the next frame is complete, got %v", expected, err)
+		}
+
+		if !strings.HasPrefix(string(response), expected) {
+			t.Fatalf("expected %q, got %q", expected, response)
+		}
+	}
+
+	_, err = conn.Write(frame("close")[2:])
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReadFrame(t *testing.T) {
+	oversized := make([]byte, 4)
+	binary.BigEndian.PutUint32(oversized, MAX_FRAME_SIZE+1)
+
+	flagged := frame("SELECT 1;")
+	flagged[0] |= 0x80
+
+	for _, test := range []struct {
+		name   string
+		data   []byte
+		frames []string // Frames read in order
+		err    string   // Error reading the frame following them, empty if the data ends there
+	}{
+		{name: "frame", data: frame("SELECT 1;"), frames: []string{"SELECT 1;"}},
+		{name: "empty frame", data: frame(""), frames: []string{""}},
+		{name: "frames back to back", data: bytes.Join([][]byte{frame("SELECT 1;"), frame("sync"), frame("SELECT 2;")}, nil), frames: []string{"SELECT 1;", "sync", "SELECT 2;"}},
+		{name: "truncated length", data: frame("SELECT 1;")[:3], err: io.ErrUnexpectedEOF.Error()},
+		{name: "truncated frame", data: frame("SELECT 1;")[:8], err: io.ErrUnexpectedEOF.Error()},
+		{name: "truncated second frame", data: append(frame("sync"), frame("SELECT 1;")[:6]...), frames: []string{"sync"}, err: io.ErrUnexpectedEOF.Error()},
+		{name: "oversized frame", data: oversized, err: "exceeds"},
+		{name: "compressed frame without compression", data: flagged, err: "compressed frame on a connection without compression"},
+	} {
+		reader := bufio.NewReader(bytes.NewReader(test.data))
+
+		for _, expected := range test.frames {
+			b, err := readFrame(reader, "")
+			if err != nil {
+				t.Fatalf("%s: %v", test.name, err)
+			}
+
+			if string(b) != expected {
+				t.Fatalf("%s: expected frame %q, got %q", test.name, expected, b)
+			}
+		}
+
+		_, err := readFrame(reader, "")
+
+		switch {
+		case test.err == "" && err != io.EOF:
+			t.Fatalf("%s: expected EOF, got %v", test.name, err)
+		case test.err != "" && (err == nil || !strings.Contains(err.Error(), test.err)):
+			t.Fatalf("%s: expected error %q, got %v", test.name, test.err, err)
+		}
+	}
+}
+
+func TestLockedConnFrames(t *testing.T) {
+	rec := &recordingConn{}
+	conn := &lockedConn{Conn: rec, lock: &sync.Mutex{}, bufferSize: -1}
+
+	// The response to pipeline on is the last response which is not a frame
+	conn.writeThen([]byte("OK\n"), func() { conn.pipelined = true })
+
+	_, err := conn.Write([]byte("OK\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = conn.Write(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The response to pipeline off is the last frame
+	conn.writeThen([]byte("OK\n"), func() { conn.pipelined = false })
+
+	_, err = conn.Write([]byte("OK\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := [][]byte{[]byte("OK\n"), frame("OK\n"), frame(""), frame("OK\n"), []byte("OK\n")}
+	if len(rec.writes) != len(expected) {
+		t.Fatalf("expected %d writes, got %q", len(expected), rec.writes)
+	}
+
+	for i := range expected {
+		if !bytes.Equal(rec.writes[i], expected[i]) {
+			t.Fatalf("expected write %d to be %q, got %q", i, expected[i], rec.writes[i])
+		}
+	}
+}
+
+func TestPipeline(t *testing.T) {
+	_, stop := startTestServer(t, 3692)
+	defer stop()
+
+	conn, reader := dialTestServer(t, 3692)
+	defer conn.Close()
+
+	pipelineTestConn(t, conn, reader, "pipeline on")
+
+	for _, test := range []struct {
+		name      string
+		frames    []string
+		responses []string // Prefixes of the responses, in the order of the frames
+	}{
+		{
+			// Every statement is executed, a failed statement has its error as response
+			name:      "pipeline on",
+			frames:    []string{"CREATE DATABASE shop;", "USE shop;", "SELEC 1;", "CREATE TABLE users (user_id INT);"},
+			responses: []string{"OK\n", "OK\n", "ERR: ", "OK\n"},
+		},
+		{
+			name:      "pipeline on abort",
+			frames:    []string{"pipeline on abort"},
+			responses: []string{"OK\n"},
+		},
+		{
+			// Statements following a failed statement are skipped until the sync
+			name:      "abort",
+			frames:    []string{"INSERT INTO users (user_id) VALUES (1);", "SELEC 1;", "INSERT INTO users (user_id) VALUES (2);", "sync", "INSERT INTO users (user_id) VALUES (3);"},
+			responses: []string{"OK\n", "ERR: ", "ERR: statement skipped", "OK\n", "OK\n"},
+		},
+		{
+			name:      "pipeline off",
+			frames:    []string{"pipeline off"},
+			responses: []string{"OK\n"},
+		},
+	} {
+		batch := make([][]byte, 0)
+		for _, f := range test.frames {
+			batch = append(batch, frame(f))
+		}
+
+		_, err := conn.Write(bytes.Join(batch, nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, expected := range test.responses {
+			response, err := readFrame(reader, "")
+			if err != nil {
+				t.Fatalf("%s: %v", test.name, err)
+			}
+
+			if !strings.HasPrefix(string(response), expected) {
+				t.Fatalf("%s: expected %q, got %q", test.name, expected, response)
+			}
+		}
+	}
+
+	// Statements and responses are no longer frames, the statement skipped was not executed
+	_, err := conn.Write([]byte("json on"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	line, err := reader.ReadString('\n')
+	if err != nil || line != `{"status":"OK"}`+"\n" {
+		t.Fatalf("expected an OK not framed, got %q %v", line, err)
+	}
+
+	_, err = conn.Write([]byte("SELECT user_id FROM users;"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	line, err = reader.ReadString('\n')
+	if err != nil || line != `[{"user_id":1},{"user_id":3}]`+"\n" {
+		t.Fatalf("expected the rows inserted, got %q %v", line, err)
+	}
+}
+
+func TestNegotiate(t *testing.T) {
+	for _, test := range []struct {
+		algorithms string
+		expected   string
+	}{
+		{algorithms: "zstd,lz4", expected: COMPRESSION_ZSTD},
+		{algorithms: "lz4,zstd", expected: COMPRESSION_LZ4},
+		{algorithms: "gzip, LZ4", expected: COMPRESSION_LZ4},
+		{algorithms: "gzip,snappy", expected: ""},
+		{algorithms: "", expected: ""},
+	} {
+		if algorithm := negotiate(test.algorithms); algorithm != test.expected {
+			t.Fatalf("%q: expected %q, got %q", test.algorithms, test.expected, algorithm)
+		}
+	}
+}
+
+func TestCompression(t *testing.T) {
+	compressible := []byte(strings.Repeat(`{"user_id":1,"name":"alex"},`, 100))
+
+	// Random bytes do not get smaller
+	incompressible := make([]byte, 2048)
+	binary.BigEndian.PutUint64(incompressible, 1)
+	for i := 8; i < len(incompressible); i++ {
+		incompressible[i] = byte(uint32(i)*2654435761>>13) ^ incompressible[i-8]
+	}
+
+	for _, algorithm := range []string{COMPRESSION_ZSTD, COMPRESSION_LZ4} {
+		compressed, err := compress(algorithm, compressible)
+		if err != nil {
+			t.Fatalf("%s: %v", algorithm, err)
+		}
+
+		if len(compressed) >= len(compressible) {
+			t.Fatalf("%s: expected %d bytes to compress, got %d bytes", algorithm, len(compressible), len(compressed))
+		}
+
+		b, err := decompress(algorithm, compressed)
+		if err != nil {
+			t.Fatalf("%s: %v", algorithm, err)
+		}
+
+		if !bytes.Equal(b, compressible) {
+			t.Fatalf("%s: decompressed data differs", algorithm)
+		}
+
+		_, err = decompress(algorithm, []byte("not compressed"))
+		if err == nil {
+			t.Fatalf("%s: expected data not compressed to fail", algorithm)
+		}
+
+		for _, test := range []struct {
+			name       string
+			data       []byte
+			compressed bool // The frame is compressed
+		}{
+			{name: "above the threshold", data: compressible, compressed: true},
+			{name: "below the threshold", data: compressible[:100]},
+			{name: "incompressible", data: incompressible},
+		} {
+			rec := &recordingConn{}
+			conn := &lockedConn{Conn: rec, lock: &sync.Mutex{}, compression: algorithm, threshold: 1024, bufferSize: -1}
+
+			_, err = conn.Write(test.data)
+			if err != nil {
+				t.Fatalf("%s %s: %v", algorithm, test.name, err)
+			}
+
+			header := binary.BigEndian.Uint32(rec.writes[0])
+			if (header&FRAME_COMPRESSED != 0) != test.compressed {
+				t.Fatalf("%s %s: expected the frame to be compressed %t, got length %x", algorithm, test.name, test.compressed, header)
+			}
+
+			// Compressed or not, the frame reads back as written
+			b, err := readFrame(bufio.NewReader(bytes.NewReader(rec.writes[0])), algorithm)
+			if err != nil {
+				t.Fatalf("%s %s: %v", algorithm, test.name, err)
+			}
+
+			if !bytes.Equal(b, test.data) {
+				t.Fatalf("%s %s: frame read differs from the frame written", algorithm, test.name)
+			}
+		}
+	}
+
+	_, err := compress("gzip", compressible)
+	if err == nil || err.Error() != "unknown compression gzip" {
+		t.Fatalf("expected an unknown compression, got %v", err)
+	}
+}
+
+func TestCompressedConnection(t *testing.T) {
+	_, stop := startTestServer(t, 3691)
+	defer stop()
+
+	// A client without an algorithm the server supports stays uncompressed
+	conn, reader := dialTestServer(t, 3691)
+
+	_, err := conn.Write([]byte("compression gzip,snappy"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	line, err := reader.ReadString('\n')
+	if err != nil || line != "COMPRESSION: none\n" {
+		t.Fatalf("expected no compression, got %q %v", line, err)
+	}
+
+	_, err = conn.Write([]byte("CREATE DATABASE shop;"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	line, err = reader.ReadString('\n')
+	if err != nil || line != "OK\n" {
+		t.Fatalf("expected an OK not framed, got %q %v", line, err)
+	}
+
+	conn.Close()
+
+	for _, algorithm := range []string{COMPRESSION_ZSTD, COMPRESSION_LZ4} {
+		conn, reader := dialTestServer(t, 3691)
+
+		// The first algorithm of the client the server supports is picked
+		_, err = conn.Write([]byte("compression gzip," + algorithm))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		line, err := reader.ReadString('\n')
+		if err != nil || line != "COMPRESSION: "+algorithm+"\n" {
+			t.Fatalf("expected compression %s, got %q %v", algorithm, line, err)
+		}
+
+		// A bulk load is sent compressed, small statements are not
+		values := make([]string, 0)
+		for i := 1; i <= 200; i++ {
+			values = append(values, fmt.Sprintf("(%d, 'name of user %d')", i, i))
+		}
+
+		insert := "INSERT INTO users (user_id, name) VALUES " + strings.Join(values, ", ") + ";"
+
+		compressed, err := compress(algorithm, []byte(insert))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		header := make([]byte, 4)
+		binary.BigEndian.PutUint32(header, uint32(len(compressed))|FRAME_COMPRESSED)
+
+		batch := bytes.Join([][]byte{frame("USE shop;"), frame("DROP TABLE users;"), frame("CREATE TABLE users (user_id INT, name CHAR(32));"), header, compressed, frame("SELECT user_id, name FROM users;")}, nil)
+
+		_, err = conn.Write(batch)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, expected := range []string{"OK\n", "", "OK\n", "OK\n"} {
+			response, err := readFrame(reader, algorithm)
+			if err != nil {
+				t.Fatalf("%s: %v", algorithm, err)
+			}
+
+			// The table only exists on the second connection compressed
+			if expected != "" && string(response) != expected {
+				t.Fatalf("%s: expected %q, got %q", algorithm, expected, response)
+			}
+		}
+
+		// The rows are above the threshold, they are sent compressed
+		peek, err := reader.Peek(4)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if binary.BigEndian.Uint32(peek)&FRAME_COMPRESSED == 0 {
+			t.Fatalf("%s: expected the rows to be compressed", algorithm)
+		}
+
+		rows, err := readFrame(reader, algorithm)
+		if err != nil {
+			t.Fatalf("%s: %v", algorithm, err)
+		}
+
+		if !strings.Contains(string(rows), "name of user 200") || strings.Count(string(rows), "name of user") != 200 {
+			t.Fatalf("%s: expected the 200 rows inserted, got %d bytes", algorithm, len(rows))
+		}
+
+		conn.Close()
+	}
 }
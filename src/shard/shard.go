@@ -0,0 +1,1247 @@
+// Package shard
+// AriaSQL sharding coordinator package
+// Copyright (C) AriaSQL
+// Author(s): Alex Gaetano Padula
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+package shard
+
+import (
+	"ariasql/catalog"
+	"ariasql/core"
+	"ariasql/executor"
+	"ariasql/parser"
+	"ariasql/shared"
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"maps"
+	"net"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const DIAL_TIMEOUT = 5 * time.Second // How long to wait connecting to a shard
+
+// Coordinator routes queries to the shards of the catalog shard map
+// Rows of a sharded table are spread across the shards by the hash of their shard key, unsharded tables are copied to every shard
+type Coordinator struct {
+	aria     *core.AriaSQL       // AriaSQL instance, its catalog holds the shard map and the schemas of all tables
+	username string              // User to connect to the shards with
+	password string              // Password of the user
+	sessions map[uint64]*session // Sessions by channel id
+	lock     *sync.Mutex         // Sessions lock
+	unique   *sync.Mutex         // Held checking and writing the unique keys of sharded tables, see uniqueKeys
+}
+
+// session is the coordinator state of a client channel
+type session struct {
+	ex    *executor.Executor // Executes statements on the coordinator catalog
+	ch    *core.Channel      // Client channel
+	conns map[string]*conn   // Shard connections by shard name
+}
+
+// conn is a connection to a shard
+type conn struct {
+	shard  *catalog.Shard
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+// New creates a new coordinator from the sharding configuration
+func New(aria *core.AriaSQL) (*Coordinator, error) {
+	if aria.Config.Sharding == nil {
+		return nil, errors.New("sharding is not configured")
+	}
+
+	return &Coordinator{
+		aria:     aria,
+		username: aria.Config.Sharding.Username,
+		password: aria.Config.Sharding.Password,
+		sessions: make(map[uint64]*session),
+		lock:     &sync.Mutex{},
+		unique:   &sync.Mutex{},
+	}, nil
+}
+
+// session returns the session of a channel, creating it if it does not exist
+func (c *Coordinator) session(ch *core.Channel) *session {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	sess, ok := c.sessions[ch.ChannelID]
+	if !ok {
+		sess = &session{ex: executor.New(c.aria, ch), ch: ch, conns: make(map[string]*conn)}
+		c.sessions[ch.ChannelID] = sess
+	}
+
+	return sess
+}
+
+// CloseChannel closes the shard connections of a channel
+func (c *Coordinator) CloseChannel(ch *core.Channel) {
+	c.lock.Lock()
+	sess, ok := c.sessions[ch.ChannelID]
+	delete(c.sessions, ch.ChannelID)
+	c.lock.Unlock()
+
+	if !ok {
+		return
+	}
+
+	for _, cn := range sess.conns {
+		cn.close()
+	}
+}
+
+// Execute executes a parsed query on the shards and returns the formatted result set, nil if there is none
+func (c *Coordinator) Execute(ch *core.Channel, query []byte, stmt interface{}, jsonOutput bool) ([]byte, error) {
+	sess := c.session(ch)
+
+	// Without shards the coordinator is a regular instance
+	if len(c.aria.Catalog.GetShards()) == 0 {
+		return sess.local(stmt, jsonOutput)
+	}
+
+	switch s := stmt.(type) {
+	case *parser.CreateShardStmt, *parser.DropShardStmt, *parser.CreateUserStmt, *parser.DropUserStmt,
+		*parser.AlterUserStmt, *parser.GrantStmt, *parser.RevokeStmt, *parser.ShowStmt:
+		// Users, privileges and the shard map only live on the coordinator
+		return sess.local(stmt, jsonOutput)
+	case *parser.CreateIndexStmt:
+		// A unique index of a sharded table spans the shards, the rows of every shard must not duplicate its key
+		// The key is read from the shards only once the user is known to be allowed to create the index
+		if tbl := c.shardedTable(sess, s.TableName.Value); tbl != nil && s.Unique && sess.ch.User.HasPrivilege(sess.ch.Database.Name, "*", []shared.PrivilegeAction{shared.PRIV_CREATE}) {
+			key := make([]string, 0, len(s.ColumnNames))
+			for _, col := range s.ColumnNames {
+				key = append(key, col.Value)
+			}
+
+			if !slices.Contains(key, tbl.TableSchema.ShardKey) {
+				c.unique.Lock()
+				defer c.unique.Unlock()
+
+				err := c.checkUnique(sess, tbl, key, nil, c.aria.Catalog.GetShards())
+				if err != nil {
+					return nil, err
+				}
+			}
+		}
+
+		_, err := sess.local(stmt, jsonOutput)
+		if err != nil {
+			return nil, err
+		}
+
+		_, err = c.scatter(sess, c.aria.Catalog.GetShards(), query)
+		return nil, err
+	case *parser.CreateDatabaseStmt, *parser.DropDatabaseStmt, *parser.UseStmt, *parser.CreateTableStmt,
+		*parser.DropTableStmt, *parser.DropIndexStmt, *parser.AlterIndexStmt,
+		*parser.CreateBloomFilterStmt, *parser.DropBloomFilterStmt:
+		// Schema changes are applied on the coordinator first, which checks privileges, then on every shard
+		_, err := sess.local(stmt, jsonOutput)
+		if err != nil {
+			return nil, err
+		}
+
+		_, err = c.scatter(sess, c.aria.Catalog.GetShards(), query)
+		return nil, err
+	case *parser.AlterTableStmt:
+		_, err := sess.local(stmt, jsonOutput)
+		if err != nil {
+			return nil, err
+		}
+
+		// The shard key is only known to the coordinator
+		if s.ShardKey != nil {
+			return nil, nil
+		}
+
+		_, err = c.scatter(sess, c.aria.Catalog.GetShards(), query)
+		return nil, err
+	case *parser.InsertStmt:
+		return nil, c.insert(sess, s)
+	case *parser.UpdateStmt:
+		return c.write(sess, query, s.TableName.Value, s.WhereClause, shared.PRIV_UPDATE, s.SetClause, jsonOutput)
+	case *parser.DeleteStmt:
+		return c.write(sess, query, s.TableName.Value, s.WhereClause, shared.PRIV_DELETE, nil, jsonOutput)
+	case *parser.SelectStmt:
+		return c.selectStmt(sess, query, s, jsonOutput)
+	case *parser.BeginStmt, *parser.CommitStmt, *parser.RollbackStmt:
+		return nil, errors.New("transactions are not supported by a coordinator")
+	default:
+		return nil, errors.New("unsupported statement on a coordinator " + reflect.TypeOf(s).String())
+	}
+}
+
+// local executes a statement on the coordinator catalog
+func (sess *session) local(stmt interface{}, jsonOutput bool) ([]byte, error) {
+	sess.ex.SetJsonOutput(jsonOutput)
+	defer sess.ex.Clear()
+
+	err := sess.ex.Execute(stmt)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(sess.ex.GetResultSet()) == 0 {
+		return nil, nil
+	}
+
+	return append([]byte{}, sess.ex.GetResultSet()...), nil
+}
+
+// table returns a table of the current database after checking the privilege of the user on it
+func (sess *session) table(name string, action shared.PrivilegeAction) (*catalog.Table, error) {
+	if sess.ch.Database == nil {
+		return nil, errors.New("no database selected")
+	}
+
+	tbl := sess.ch.Database.GetTable(name)
+	if tbl == nil {
+		return nil, errors.New("table does not exist")
+	}
+
+	if !sess.ch.User.HasPrivilege(sess.ch.Database.Name, tbl.Name, []shared.PrivilegeAction{action}) {
+		return nil, fmt.Errorf("%w to %s on table %s", executor.ErrNoPrivilege, privilegeName(action), tbl.Name)
+	}
+
+	return tbl, nil
+}
+
+// reads checks the user may read every table a statement reads, returning how many tables it reads and the sharded table
+// it reads if any.  The whole statement is walked, its UNION branches, common table expressions and subqueries of IN,
+// EXISTS or a value.  A subquery is run by every shard on its own rows so it can not read a sharded table.
+func (sess *session) reads(stmt interface{}, sub bool) (int, *catalog.Table, error) {
+	var sharded *catalog.Table
+	tables := 0
+
+	refs, ctes := references(stmt, sub)
+
+	for _, ref := range refs {
+		// Common table expressions and table functions are not tables
+		if ctes[ref.table.Name.Value] || ref.table.Args != nil {
+			continue
+		}
+
+		tbl, err := sess.table(ref.table.Name.Value, shared.PRIV_SELECT)
+		if err != nil {
+			return 0, nil, err
+		}
+
+		if tbl.TableSchema.ShardKey == "" {
+			tables++
+			continue
+		}
+
+		if ref.sub {
+			return 0, nil, fmt.Errorf("sharded table %s can not be read by a subquery", tbl.Name)
+		}
+
+		tables++
+		sharded = tbl
+	}
+
+	return tables, sharded, nil
+}
+
+// reference is a table of a FROM clause or EXISTS predicate within a statement
+type reference struct {
+	table *parser.Table
+	sub   bool // Read by a subquery
+}
+
+// references returns the tables a statement reads and the names of its common table expressions
+func references(stmt interface{}, sub bool) ([]reference, map[string]bool) {
+	var refs []reference
+	ctes := make(map[string]bool)
+
+	var walk func(v reflect.Value, sub bool)
+	var query func(s *parser.SelectStmt, sub bool)
+
+	// The UNION branches and common table expressions of a query are read as the query is
+	query = func(s *parser.SelectStmt, sub bool) {
+		walk(reflect.ValueOf(s.SelectList), sub)
+		walk(reflect.ValueOf(s.TableExpression), sub)
+
+		if s.Union != nil {
+			query(s.Union, sub)
+		}
+
+		if s.With != nil {
+			for _, cte := range s.With.CommonTableExpressions {
+				ctes[cte.Name.Value] = true
+				query(cte.Query, sub)
+			}
+		}
+	}
+
+	walk = func(v reflect.Value, sub bool) {
+		switch v.Kind() {
+		case reflect.Pointer, reflect.Interface:
+			if v.IsNil() {
+				return
+			}
+
+			switch node := v.Interface().(type) {
+			case *parser.SelectStmt:
+				query(node, true)
+				return
+			case *parser.ExistsPredicate:
+				walk(reflect.ValueOf(node.Tables), true)
+				walk(reflect.ValueOf(node.Expr), true)
+				return
+			case *parser.Table:
+				if node.Name != nil {
+					refs = append(refs, reference{table: node, sub: sub})
+				}
+			}
+
+			walk(v.Elem(), sub)
+		case reflect.Struct:
+			for i := 0; i < v.NumField(); i++ {
+				if v.Type().Field(i).IsExported() {
+					walk(v.Field(i), sub)
+				}
+			}
+		case reflect.Slice, reflect.Array:
+			for i := 0; i < v.Len(); i++ {
+				walk(v.Index(i), sub)
+			}
+		case reflect.Map:
+			iter := v.MapRange()
+			for iter.Next() {
+				walk(iter.Value(), sub)
+			}
+		}
+	}
+
+	if s, ok := stmt.(*parser.SelectStmt); ok {
+		query(s, sub)
+	} else {
+		walk(reflect.ValueOf(stmt), sub)
+	}
+
+	return refs, ctes
+}
+
+// privilegeName returns the statement name of a privilege action
+func privilegeName(action shared.PrivilegeAction) string {
+	switch action {
+	case shared.PRIV_SELECT:
+		return "SELECT"
+	case shared.PRIV_INSERT:
+		return "INSERT"
+	case shared.PRIV_UPDATE:
+		return "UPDATE"
+	case shared.PRIV_DELETE:
+		return "DELETE"
+	}
+
+	return "ALTER"
+}
+
+// shardFor returns the position of the shard a shard key value belongs to
+func shardFor(value interface{}, shards int) int {
+	h := fnv.New32a()
+	h.Write([]byte(strings.TrimSuffix(strings.TrimPrefix(fmt.Sprintf("%v", value), "'"), "'")))
+
+	return int(h.Sum32() % uint32(shards))
+}
+
+// shardKeyValue returns the value a search condition requires the shard key column to equal, if any
+func shardKeyValue(cond interface{}, column string) (interface{}, bool) {
+	switch cond := cond.(type) {
+	case *parser.ComparisonPredicate:
+		if cond.Op != parser.OP_EQ || cond.Left == nil || cond.Right == nil {
+			return nil, false
+		}
+
+		left, right := cond.Left.Value, cond.Right.Value
+
+		// Allow the literal on either side
+		if _, ok := left.(*parser.Literal); ok {
+			left, right = right, left
+		}
+
+		col, ok := left.(*parser.ColumnSpecification)
+		if !ok || col.ColumnName == nil || col.ColumnName.Value != column {
+			return nil, false
+		}
+
+		lit, ok := right.(*parser.Literal)
+		if !ok || lit.Value == nil {
+			return nil, false
+		}
+
+		return lit.Value, true
+	case *parser.LogicalCondition:
+		if cond.Op != parser.OP_AND {
+			return nil, false
+		}
+
+		// Both sides must hold so either one pins the shard
+		if value, ok := shardKeyValue(cond.Left, column); ok {
+			return value, true
+		}
+
+		return shardKeyValue(cond.Right, column)
+	}
+
+	return nil, false
+}
+
+// route returns the shards a statement on a table has to run on
+// Sharded tables are narrowed down to one shard by an equality on the shard key, unsharded tables are on every shard
+func route(tbl *catalog.Table, where *parser.WhereClause, shards []*catalog.Shard) []*catalog.Shard {
+	if tbl.TableSchema.ShardKey == "" || where == nil {
+		return shards
+	}
+
+	value, ok := shardKeyValue(where.SearchCondition, tbl.TableSchema.ShardKey)
+	if !ok {
+		return shards
+	}
+
+	return []*catalog.Shard{shards[shardFor(value, len(shards))]}
+}
+
+// shardedTable returns a sharded table of the current database, nil if it is not sharded or does not exist
+func (c *Coordinator) shardedTable(sess *session, name string) *catalog.Table {
+	if sess.ch.Database == nil {
+		return nil
+	}
+
+	tbl := sess.ch.Database.GetTable(name)
+	if tbl == nil || tbl.TableSchema.ShardKey == "" {
+		return nil
+	}
+
+	return tbl
+}
+
+// uniqueKeys returns the columns of the unique indexes of a sharded table which do not have the shard key
+// Rows with the same shard key value are on the same shard, which enforces the other unique keys on its own rows only.
+// The coordinator checks these keys across every shard, while no other write through it does.
+func uniqueKeys(tbl *catalog.Table) [][]string {
+	if tbl.TableSchema.ShardKey == "" {
+		return nil
+	}
+
+	var keys [][]string
+
+	for _, idx := range tbl.Indexes {
+		if idx.Unique && !slices.Contains(idx.Columns, tbl.TableSchema.ShardKey) {
+			keys = append(keys, idx.Columns)
+		}
+	}
+
+	sort.Slice(keys, func(i, j int) bool { return strings.Join(keys[i], ",") < strings.Join(keys[j], ",") })
+
+	return keys
+}
+
+// keyValue returns a value of a unique key as compared across shards, a literal or a value of a shard result
+func keyValue(value interface{}) string {
+	if s, ok := value.(string); ok {
+		return shared.UnquoteLiteral(s)
+	}
+
+	return fmt.Sprintf("%v", value)
+}
+
+// checkUnique checks the unique key of a sharded table is not duplicated by rows written, by the rows of shards or by each other
+// Rows hold the literals written by column, rows with a key column NULL or not set are not checked.  Without rows written
+// the rows of the shards are checked against each other.
+func (c *Coordinator) checkUnique(sess *session, tbl *catalog.Table, key []string, rows []map[string]*parser.Literal, shards []*catalog.Shard) error {
+	seen := make(map[string]bool)
+	first := make([]string, 0, len(rows)) // Values of the first key column written
+
+	for _, row := range rows {
+		values := make([]string, 0, len(key))
+
+		for _, col := range key {
+			lit, ok := row[col]
+			if !ok || lit.Value == nil {
+				break
+			}
+
+			values = append(values, keyValue(lit.Value))
+		}
+
+		if len(values) < len(key) {
+			continue
+		}
+
+		tuple := strings.Join(values, ", ")
+		if seen[tuple] {
+			return fmt.Errorf("row with %s %s already exists", strings.Join(key, ", "), tuple)
+		}
+
+		seen[tuple] = true
+
+		v, err := formatValue(row[key[0]])
+		if err != nil {
+			return err
+		}
+
+		first = append(first, v)
+	}
+
+	if (rows != nil && len(first) == 0) || len(shards) == 0 {
+		return nil
+	}
+
+	query := fmt.Sprintf("SELECT %s FROM %s", strings.Join(key, ", "), tbl.Name)
+	if rows != nil {
+		query += fmt.Sprintf(" WHERE %s IN (%s)", key[0], strings.Join(first, ", "))
+	}
+
+	results, err := c.scatter(sess, shards, []byte(query+";"))
+	if err != nil {
+		return err
+	}
+
+	for i, result := range results {
+		for _, row := range result {
+			values := make([]string, 0, len(key))
+
+			for _, col := range key {
+				if row[col] == nil {
+					break
+				}
+
+				values = append(values, keyValue(row[col]))
+			}
+
+			if len(values) < len(key) {
+				continue
+			}
+
+			tuple := strings.Join(values, ", ")
+
+			if rows == nil {
+				// The rows of the shards are checked against each other
+				if seen[tuple] {
+					return fmt.Errorf("several rows with %s %s exist", strings.Join(key, ", "), tuple)
+				}
+
+				seen[tuple] = true
+				continue
+			}
+
+			if seen[tuple] {
+				return fmt.Errorf("row with %s %s already exists on shard %s", strings.Join(key, ", "), tuple, shards[i].Name)
+			}
+		}
+	}
+
+	return nil
+}
+
+// formatValue formats an insert value as SQL
+func formatValue(value interface{}) (string, error) {
+	switch value := value.(type) {
+	case *parser.Literal:
+		if value.Value == nil {
+			return "NULL", nil
+		}
+
+		// A string literal is quoted again, as kept by the parser a backslash within is no longer escaped
+		if s, ok := value.Value.(string); ok && shared.UnquoteLiteral(s) != s {
+			return shared.QuoteLiteral(shared.UnquoteLiteral(s)), nil
+		}
+
+		return fmt.Sprintf("%v", value.Value), nil
+	case *shared.SysDate:
+		return "SYS_DATE", nil
+	case *shared.SysTime:
+		return "SYS_TIME", nil
+	case *shared.SysTimestamp:
+		return "SYS_TIMESTAMP", nil
+	case *shared.GenUUID:
+		return "GENERATE_UUID", nil
+	}
+
+	return "", fmt.Errorf("unsupported insert value %T", value)
+}
+
+// resolve replaces the UUIDs and system times an insert generates, given or defaulted, by literals generated once
+// Every shard inserts the rows of an unsharded table and would otherwise generate values of its own.
+func resolve(tbl *catalog.Table, columns []string, rows [][]interface{}) ([]string, [][]interface{}) {
+	columns = slices.Clone(columns)
+	added := 0
+
+	for _, name := range slices.Sorted(maps.Keys(tbl.TableSchema.ColumnDefinitions)) {
+		if slices.Contains(columns, name) {
+			continue
+		}
+
+		switch tbl.TableSchema.ColumnDefinitions[name].Default.(type) {
+		case *shared.GenUUID, *shared.GenUUIDv7, *shared.SysDate, *shared.SysTime, *shared.SysTimestamp:
+			columns = append(columns, name)
+			added++
+		}
+	}
+
+	now := shared.Now()
+	resolved := make([][]interface{}, 0, len(rows))
+
+	for _, row := range rows {
+		values := make([]interface{}, 0, len(row)+added)
+
+		for i, col := range columns {
+			var value interface{} = &parser.Literal{Value: nil}
+			if i < len(row) {
+				value = row[i]
+			}
+
+			values = append(values, generated(tbl.TableSchema.ColumnDefinitions[col], value, now))
+		}
+
+		resolved = append(resolved, values)
+	}
+
+	return columns, resolved
+}
+
+// generated returns the literal of a value generated on insert, as the catalog generates it for the column, or the value
+func generated(colDef *catalog.ColumnDefinition, value interface{}, now time.Time) interface{} {
+	if colDef == nil {
+		return value
+	}
+
+	// The parser keeps system functions of an insert as literals, a NULL takes the default
+	fn := value
+	if lit, ok := value.(*parser.Literal); ok {
+		switch lit.Value {
+		case nil:
+			fn = colDef.Default
+		case "SYS_TIME":
+			fn = &shared.SysTime{}
+		case "SYS_TIMESTAMP":
+			fn = &shared.SysTimestamp{}
+		case "GENERATE_UUID":
+			fn = &shared.GenUUID{}
+		}
+	}
+
+	switch strings.ToUpper(colDef.DataType) {
+	case "UUID":
+		switch fn.(type) {
+		case *shared.GenUUID:
+			return &parser.Literal{Value: shared.QuoteLiteral(shared.GenerateUUID())}
+		case *shared.GenUUIDv7:
+			return &parser.Literal{Value: shared.QuoteLiteral(shared.GenerateUUIDv7())}
+		}
+	case "DATETIME", "TIMESTAMP":
+		switch fn.(type) {
+		case *shared.SysDate, *shared.SysTime, *shared.SysTimestamp:
+			// Written as the catalog reads a datetime of an insert
+			return &parser.Literal{Value: shared.QuoteLiteral(now.Format("2006-01-02 150405"))}
+		}
+	}
+
+	return value
+}
+
+// insert spreads the rows of an insert across the shards by their shard key, rows of unsharded tables are inserted on every shard
+func (c *Coordinator) insert(sess *session, stmt *parser.InsertStmt) error {
+	tbl, err := sess.table(stmt.TableName.Value, shared.PRIV_INSERT)
+	if err != nil {
+		return err
+	}
+
+	shards := c.aria.Catalog.GetShards()
+
+	columns := make([]string, 0, len(stmt.ColumnNames))
+	key := -1
+
+	for i, col := range stmt.ColumnNames {
+		columns = append(columns, col.Value)
+
+		if col.Value == tbl.TableSchema.ShardKey {
+			key = i
+		}
+	}
+
+	if tbl.TableSchema.ShardKey != "" && key == -1 {
+		return fmt.Errorf("shard key column %s must be set", tbl.TableSchema.ShardKey)
+	}
+
+	// Shards only enforce the unique keys of their own rows
+	keys := uniqueKeys(tbl)
+	if len(keys) > 0 {
+		c.unique.Lock()
+		defer c.unique.Unlock()
+
+		rows := make([]map[string]*parser.Literal, 0, len(stmt.Values))
+
+		for _, row := range stmt.Values {
+			values := make(map[string]*parser.Literal)
+			for i, value := range row {
+				if lit, ok := value.(*parser.Literal); ok {
+					values[columns[i]] = lit
+				}
+			}
+
+			rows = append(rows, values)
+		}
+
+		for _, key := range keys {
+			err = c.checkUnique(sess, tbl, key, rows, shards)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	rows := stmt.Values
+	if key == -1 {
+		columns, rows = resolve(tbl, columns, rows)
+	}
+
+	values := make(map[int][]string) // Rows by shard position
+
+	for _, row := range rows {
+		formatted := make([]string, 0, len(row))
+
+		for _, value := range row {
+			v, err := formatValue(value)
+			if err != nil {
+				return err
+			}
+
+			formatted = append(formatted, v)
+		}
+
+		tuple := "(" + strings.Join(formatted, ", ") + ")"
+
+		if key == -1 {
+			for i := range shards {
+				values[i] = append(values[i], tuple)
+			}
+
+			continue
+		}
+
+		lit, ok := row[key].(*parser.Literal)
+		if !ok || lit.Value == nil {
+			return fmt.Errorf("shard key column %s must be set to a literal", tbl.TableSchema.ShardKey)
+		}
+
+		i := shardFor(lit.Value, len(shards))
+		values[i] = append(values[i], tuple)
+	}
+
+	conns := make(map[int]*conn)
+
+	for i := range values {
+		cn, err := c.connect(sess, shards[i])
+		if err != nil {
+			return err
+		}
+
+		conns[i] = cn
+	}
+
+	errs := make([]error, len(shards))
+	wg := &sync.WaitGroup{}
+
+	for i, tuples := range values {
+		query := []byte(fmt.Sprintf("INSERT INTO %s (%s) VALUES %s;", tbl.Name, strings.Join(columns, ", "), strings.Join(tuples, ", ")))
+
+		wg.Add(1)
+		go func(i int, cn *conn, query []byte) {
+			defer wg.Done()
+			_, errs[i] = cn.query(query)
+		}(i, conns[i], query)
+	}
+
+	wg.Wait()
+
+	return errors.Join(errs...)
+}
+
+// write runs an update or delete on the shards holding the affected rows and sums the affected rows
+func (c *Coordinator) write(sess *session, query []byte, table string, where *parser.WhereClause, action shared.PrivilegeAction, set []*parser.SetClause, jsonOutput bool) ([]byte, error) {
+	tbl, err := sess.table(table, action)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, clause := range set {
+		if clause.Column.Value == tbl.TableSchema.ShardKey {
+			return nil, errors.New("the shard key can not be updated")
+		}
+	}
+
+	// Every table the search condition reads is read by a subquery
+	_, _, err = sess.reads(where, true)
+	if err != nil {
+		return nil, err
+	}
+
+	shards := c.aria.Catalog.GetShards()
+	targets := route(tbl, where, shards)
+
+	// A unique key updated is checked against the rows of the other shards, the shard updated enforces it on its own rows
+	values := make(map[string]*parser.Literal)
+	for _, clause := range set {
+		values[clause.Column.Value] = clause.Value
+	}
+
+	locked := false
+
+	for _, key := range uniqueKeys(tbl) {
+		set := 0
+		for _, col := range key {
+			if _, ok := values[col]; ok {
+				set++
+			}
+		}
+
+		if set == 0 {
+			continue
+		}
+
+		if set < len(key) {
+			return nil, fmt.Errorf("unique key %s of a sharded table must be updated as a whole", strings.Join(key, ", "))
+		}
+
+		if len(targets) != 1 {
+			return nil, fmt.Errorf("updating unique key %s of a sharded table requires an equality on the shard key", strings.Join(key, ", "))
+		}
+
+		others := slices.DeleteFunc(slices.Clone(shards), func(shard *catalog.Shard) bool { return shard == targets[0] })
+
+		if !locked {
+			c.unique.Lock()
+			defer c.unique.Unlock()
+			locked = true
+		}
+
+		err = c.checkUnique(sess, tbl, key, []map[string]*parser.Literal{values}, others)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	results, err := c.scatter(sess, targets, query)
+	if err != nil {
+		return nil, err
+	}
+
+	affected := int64(0)
+
+	for _, rows := range results {
+		for _, row := range rows {
+			if n, ok := row["RowsAffected"].(json.Number); ok {
+				i, _ := n.Int64()
+				affected += i
+			}
+		}
+
+		// Every shard holds the same rows of an unsharded table
+		if tbl.TableSchema.ShardKey == "" {
+			break
+		}
+	}
+
+	return format([]map[string]interface{}{{"RowsAffected": affected}}, jsonOutput)
+}
+
+// selectStmt reads from the shards, a query on a sharded table without a shard key equality is sent to every shard and the results are combined
+func (c *Coordinator) selectStmt(sess *session, query []byte, stmt *parser.SelectStmt, jsonOutput bool) ([]byte, error) {
+	tables, sharded, err := sess.reads(stmt, false)
+	if err != nil {
+		return nil, err
+	}
+
+	if tables == 0 {
+		return sess.local(stmt, jsonOutput)
+	}
+
+	shards := c.aria.Catalog.GetShards()
+
+	// Unsharded tables are the same on every shard
+	if sharded == nil {
+		results, err := c.scatter(sess, shards[:1], query)
+		if err != nil {
+			return nil, err
+		}
+
+		return format(results[0], jsonOutput)
+	}
+
+	if stmt.With != nil {
+		return nil, fmt.Errorf("sharded table %s can not be read by a WITH query", sharded.Name)
+	}
+
+	if tables > 1 {
+		return nil, fmt.Errorf("sharded table %s can not be joined or combined with other tables", sharded.Name)
+	}
+
+	targets := route(sharded, stmt.TableExpression.WhereClause, shards)
+
+	results, err := c.scatter(sess, targets, query)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(targets) == 1 {
+		return format(results[0], jsonOutput)
+	}
+
+	rows, err := gather(stmt, results)
+	if err != nil {
+		return nil, err
+	}
+
+	return format(rows, jsonOutput)
+}
+
+// gather combines the results of a select from several shards
+func gather(stmt *parser.SelectStmt, results [][]map[string]interface{}) ([]map[string]interface{}, error) {
+	expr := stmt.TableExpression
+
+	if expr.GroupByClause != nil {
+		return nil, errors.New("GROUP BY on a sharded table requires an equality on the shard key")
+	}
+
+	if expr.LimitClause != nil && expr.LimitClause.Offset != nil && expr.LimitClause.Offset.Value.(uint64) > 0 {
+		return nil, errors.New("OFFSET on a sharded table requires an equality on the shard key")
+	}
+
+	var rows []map[string]interface{}
+
+	// Partial aggregates are combined into one row
+	aggregates := make(map[string]string)
+
+	for _, e := range stmt.SelectList.Expressions {
+		agg, ok := e.Value.(*parser.AggregateFunc)
+		if !ok {
+			continue
+		}
+
+		name := agg.FuncName
+		if e.Alias != nil {
+			name = e.Alias.Value
+		}
+
+		aggregates[name] = agg.FuncName
+	}
+
+	if len(aggregates) > 0 {
+		row := make(map[string]interface{})
+
+		for name, fn := range aggregates {
+			var acc interface{}
+
+			for _, shardRows := range results {
+				for _, r := range shardRows {
+					v, ok := r[name]
+					if !ok || v == nil {
+						continue
+					}
+
+					combined, err := combine(fn, acc, v)
+					if err != nil {
+						return nil, err
+					}
+
+					acc = combined
+				}
+			}
+
+			row[name] = acc
+		}
+
+		return []map[string]interface{}{row}, nil
+	}
+
+	for _, shardRows := range results {
+		rows = append(rows, shardRows...)
+	}
+
+	if stmt.Distinct && len(rows) > 0 {
+		rows = shared.DistinctMap(rows, shared.GetColumns(rows)...)
+	}
+
+	if expr.OrderByClause != nil {
+		columns := make([]string, 0)
+
+		for _, e := range expr.OrderByClause.OrderByExpressions {
+			if col, ok := e.Value.(*parser.ColumnSpecification); ok {
+				columns = append(columns, col.ColumnName.Value)
+			}
+		}
+
+		sort.SliceStable(rows, func(i, j int) bool {
+			for _, col := range columns {
+				c := compare(rows[i][col], rows[j][col])
+				if c == 0 {
+					continue
+				}
+
+				if expr.OrderByClause.Order == parser.DESC {
+					return c > 0
+				}
+
+				return c < 0
+			}
+
+			return false
+		})
+	}
+
+	if expr.LimitClause != nil {
+		count := int(expr.LimitClause.Count.Value.(uint64))
+		if len(rows) > count {
+			rows = rows[:count]
+		}
+	}
+
+	return rows, nil
+}
+
+// combine combines a partial aggregate of a shard with the aggregate so far
+func combine(fn string, acc interface{}, value interface{}) (interface{}, error) {
+	if acc == nil {
+		return value, nil
+	}
+
+	switch fn {
+	case "COUNT", "SUM":
+		a, aok := acc.(json.Number)
+		v, vok := value.(json.Number)
+		if !aok || !vok {
+			return nil, fmt.Errorf("%s of a sharded table returned a non numeric value", fn)
+		}
+
+		ai, aerr := a.Int64()
+		vi, verr := v.Int64()
+		if aerr == nil && verr == nil {
+			return json.Number(fmt.Sprintf("%d", ai+vi)), nil
+		}
+
+		af, _ := a.Float64()
+		vf, _ := v.Float64()
+
+		return json.Number(fmt.Sprintf("%v", af+vf)), nil
+	case "MIN":
+		if compare(value, acc) < 0 {
+			return value, nil
+		}
+
+		return acc, nil
+	case "MAX":
+		if compare(value, acc) > 0 {
+			return value, nil
+		}
+
+		return acc, nil
+	}
+
+	return nil, fmt.Errorf("%s on a sharded table requires an equality on the shard key", fn)
+}
+
+// compare compares two result values, numbers numerically and anything else as text
+func compare(a, b interface{}) int {
+	an, aok := a.(json.Number)
+	bn, bok := b.(json.Number)
+
+	if aok && bok {
+		af, _ := an.Float64()
+		bf, _ := bn.Float64()
+
+		switch {
+		case af < bf:
+			return -1
+		case af > bf:
+			return 1
+		}
+
+		return 0
+	}
+
+	return strings.Compare(fmt.Sprintf("%v", a), fmt.Sprintf("%v", b))
+}
+
+// format formats rows like the executor does
+func format(rows []map[string]interface{}, jsonOutput bool) ([]byte, error) {
+	if jsonOutput {
+		return shared.CreateJSONByteArray(rows)
+	}
+
+	if len(rows) == 0 {
+		return nil, nil
+	}
+
+	return shared.CreateTableByteArray(rows, shared.GetHeaders(rows, true)), nil
+}
+
+// scatter runs a query on shards in parallel and returns the rows of each shard in the order of the shards
+func (c *Coordinator) scatter(sess *session, shards []*catalog.Shard, query []byte) ([][]map[string]interface{}, error) {
+	conns := make([]*conn, len(shards))
+
+	for i, shard := range shards {
+		cn, err := c.connect(sess, shard)
+		if err != nil {
+			return nil, err
+		}
+
+		conns[i] = cn
+	}
+
+	results := make([][]map[string]interface{}, len(shards))
+	errs := make([]error, len(shards))
+	wg := &sync.WaitGroup{}
+
+	for i, cn := range conns {
+		wg.Add(1)
+		go func(i int, cn *conn) {
+			defer wg.Done()
+			results[i], errs[i] = cn.query(query)
+		}(i, cn)
+	}
+
+	wg.Wait()
+
+	return results, errors.Join(errs...)
+}
+
+// connect returns the connection of a session to a shard, connecting and selecting the current database if there is none
+func (c *Coordinator) connect(sess *session, shard *catalog.Shard) (*conn, error) {
+	if cn, ok := sess.conns[shard.Name]; ok {
+		// The shard may have been dropped and created again with another address
+		if cn.shard.Address == shard.Address {
+			return cn, nil
+		}
+
+		cn.close()
+		delete(sess.conns, shard.Name)
+	}
+
+	nc, err := net.DialTimeout("tcp", shard.Address, DIAL_TIMEOUT)
+	if err != nil {
+		return nil, fmt.Errorf("shard %s: %s", shard.Name, err.Error())
+	}
+
+	cn := &conn{shard: shard, conn: nc, reader: bufio.NewReader(nc)}
+
+	err = cn.open(c.username, c.password, sess.ch.Database)
+	if err != nil {
+		nc.Close()
+		return nil, err
+	}
+
+	sess.conns[shard.Name] = cn
+
+	return cn, nil
+}
+
+// open authenticates, enables JSON output and selects the database on a new shard connection
+func (cn *conn) open(username, password string, db *catalog.Database) error {
+	_, err := cn.conn.Write([]byte(base64.StdEncoding.EncodeToString([]byte(username + "\\0" + password))))
+	if err != nil {
+		return err
+	}
+
+	line, err := cn.readLine()
+	if err != nil {
+		return err
+	}
+
+	if line != "OK" {
+		return fmt.Errorf("shard %s: %s", cn.shard.Name, strings.TrimPrefix(line, "ERR: "))
+	}
+
+	// Skip the version line
+	_, err = cn.readLine()
+	if err != nil {
+		return err
+	}
+
+	_, err = cn.query([]byte("json on"))
+	if err != nil {
+		return err
+	}
+
+	if db != nil {
+		_, err = cn.query([]byte("USE " + db.Name + ";"))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// readLine reads a response line from the shard
+func (cn *conn) readLine() (string, error) {
+	line, err := cn.reader.ReadString('\n')
+	if err != nil {
+		return "", fmt.Errorf("shard %s: %s", cn.shard.Name, err.Error())
+	}
+
+	return strings.TrimSuffix(line, "\n"), nil
+}
+
+// query sends a query to the shard and decodes the JSON response, rows are nil if there is no result set
+func (cn *conn) query(query []byte) ([]map[string]interface{}, error) {
+	_, err := cn.conn.Write(query)
+	if err != nil {
+		return nil, fmt.Errorf("shard %s: %s", cn.shard.Name, err.Error())
+	}
+
+	line, err := cn.readLine()
+	if err != nil {
+		return nil, err
+	}
+
+	if strings.HasPrefix(line, "ERR: ") {
+		return nil, fmt.Errorf("shard %s: %s", cn.shard.Name, strings.TrimPrefix(line, "ERR: "))
+	}
+
+	if line == `{"status":"OK"}` {
+		return nil, nil
+	}
+
+	var rows []map[string]interface{}
+
+	dec := json.NewDecoder(bytes.NewReader([]byte(line)))
+	dec.UseNumber()
+
+	err = dec.Decode(&rows)
+	if err != nil {
+		return nil, fmt.Errorf("shard %s: %s", cn.shard.Name, err.Error())
+	}
+
+	return rows, nil
+}
+
+// close closes the shard connection
+func (cn *conn) close() {
+	cn.conn.Write([]byte("close"))
+	cn.conn.Close()
+}
@@ -0,0 +1,426 @@
+// Package shard tests
+// Copyright (C) AriaSQL
+// Author(s): Alex Gaetano Padula
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+package shard
+
+import (
+	"ariasql/catalog"
+	"ariasql/core"
+	"ariasql/executor"
+	"ariasql/parser"
+	"ariasql/server"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+)
+
+// open opens an AriaSQL instance
+func open(t *testing.T, dataDir string) *core.AriaSQL {
+	aria, err := core.New(&core.Config{DataDir: dataDir})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	aria.Catalog = catalog.New(dataDir)
+	aria.Catalog.AdminPassword = "admin" // Shards are logged in to as admin/admin
+
+	err = aria.Catalog.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	aria.Channels = make([]*core.Channel, 0)
+	aria.ChannelsLock = &sync.Mutex{}
+
+	return aria
+}
+
+// execute parses and executes a statement on the coordinator, returning the JSON result rows
+func execute(t *testing.T, c *Coordinator, ch *core.Channel, stmt string) []map[string]interface{} {
+	p := parser.NewParser(parser.NewLexer([]byte(stmt)))
+
+	ast, err := p.Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := c.Execute(ch, []byte(stmt), ast, true)
+	if err != nil {
+		t.Fatalf("%s: %s", stmt, err)
+	}
+
+	var rows []map[string]interface{}
+
+	if len(result) > 0 {
+		dec := json.NewDecoder(bytes.NewReader(result))
+		dec.UseNumber()
+
+		err = dec.Decode(&rows)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return rows
+}
+
+func TestCoordinator_Execute(t *testing.T) {
+	shards := make([]*core.AriaSQL, 0)
+
+	for i := 0; i < 2; i++ {
+		dataDir := fmt.Sprintf("./shard%d", i)
+		defer os.RemoveAll(dataDir)
+
+		aria := open(t, dataDir)
+		defer aria.Close()
+
+		s, err := server.NewTCPServer(37970+i, "127.0.0.1", aria, 1024)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		defer s.Stop()
+		go s.Start()
+
+		shards = append(shards, aria)
+	}
+
+	defer os.RemoveAll("./coordinator")
+
+	aria := open(t, "./coordinator")
+	defer aria.Close()
+
+	aria.Config.Sharding = &core.Sharding{Username: "admin", Password: "admin"}
+
+	c, err := New(aria)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ch := aria.OpenChannel(aria.Catalog.GetUser("admin"))
+	defer c.CloseChannel(ch)
+
+	for _, stmt := range []string{
+		"CREATE SHARD s0 ON '127.0.0.1:37970';",
+		"CREATE SHARD s1 ON '127.0.0.1:37971';",
+		"CREATE DATABASE shop;",
+		"USE shop;",
+		"CREATE TABLE orders (order_id INT NOT NULL UNIQUE, amount INT);",
+		"ALTER TABLE orders SHARD BY order_id;",
+		"CREATE TABLE regions (name CHAR(32));",
+		"INSERT INTO orders (order_id, amount) VALUES (1, 10), (2, 20), (3, 30), (4, 40), (5, 50), (6, 60);",
+		"INSERT INTO regions (name) VALUES ('eu'), ('us');",
+	} {
+		execute(t, c, ch, stmt)
+	}
+
+	// Rows of the sharded table are spread across the shards, unsharded rows are on every shard
+	total := 0
+
+	for _, s := range shards {
+		db := s.Catalog.GetDatabase("shop")
+		if db == nil {
+			t.Fatal("expected database on shard")
+		}
+
+		n := int(db.GetTable("orders").Rows.Count())
+		if n == 0 || n == 6 {
+			t.Fatalf("expected orders to be spread across shards, got %d on one shard", n)
+		}
+
+		total += n
+
+		if db.GetTable("regions").Rows.Count() != 2 {
+			t.Fatal("expected regions on every shard")
+		}
+	}
+
+	if total != 6 {
+		t.Fatalf("expected 6 orders, got %d", total)
+	}
+
+	rows := execute(t, c, ch, "SELECT * FROM orders WHERE order_id = 4;")
+	if len(rows) != 1 || rows[0]["amount"].(json.Number).String() != "40" {
+		t.Fatalf("expected order 4, got %v", rows)
+	}
+
+	rows = execute(t, c, ch, "SELECT * FROM orders WHERE amount > 15 ORDER BY order_id DESC LIMIT 3;")
+	if len(rows) != 3 || rows[0]["order_id"].(json.Number).String() != "6" || rows[2]["order_id"].(json.Number).String() != "4" {
+		t.Fatalf("expected orders 6, 5 and 4, got %v", rows)
+	}
+
+	rows = execute(t, c, ch, "SELECT COUNT(*) FROM orders;")
+	if len(rows) != 1 || rows[0]["COUNT"].(json.Number).String() != "6" {
+		t.Fatalf("expected count of 6, got %v", rows)
+	}
+
+	rows = execute(t, c, ch, "SELECT SUM(amount) FROM orders WHERE amount > 15;")
+	if len(rows) != 1 || rows[0]["SUM"].(json.Number).String() != "200" {
+		t.Fatalf("expected sum of 200, got %v", rows)
+	}
+
+	rows = execute(t, c, ch, "SELECT * FROM regions;")
+	if len(rows) != 2 {
+		t.Fatalf("expected 2 regions, got %v", rows)
+	}
+
+	rows = execute(t, c, ch, "UPDATE orders SET amount = 0 WHERE amount < 35;")
+	if rows[0]["RowsAffected"].(json.Number).String() != "3" {
+		t.Fatalf("expected 3 updated rows, got %v", rows)
+	}
+
+	rows = execute(t, c, ch, "DELETE FROM regions WHERE name = 'eu';")
+	if rows[0]["RowsAffected"].(json.Number).String() != "1" {
+		t.Fatalf("expected 1 deleted row, got %v", rows)
+	}
+
+	p := parser.NewParser(parser.NewLexer([]byte("UPDATE orders SET order_id = 7 WHERE order_id = 1;")))
+
+	ast, err := p.Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = c.Execute(ch, []byte("UPDATE orders SET order_id = 7 WHERE order_id = 1;"), ast, true)
+	if err == nil {
+		t.Fatal("expected error updating the shard key")
+	}
+}
+
+func TestShardFor(t *testing.T) {
+	// Insert values and where clause literals of the same value belong to the same shard
+	if shardFor("'alex'", 4) != shardFor("alex", 4) {
+		t.Fatal("expected quoted and unquoted value on the same shard")
+	}
+
+	if shardFor(uint64(42), 3) != shardFor(uint64(42), 3) {
+		t.Fatal("expected the same shard for the same value")
+	}
+}
+
+func TestCoordinator_UniqueKey(t *testing.T) {
+	for i := 0; i < 2; i++ {
+		dataDir := fmt.Sprintf("./shard%d", i)
+		defer os.RemoveAll(dataDir)
+
+		aria := open(t, dataDir)
+		defer aria.Close()
+
+		s, err := server.NewTCPServer(37972+i, "127.0.0.1", aria, 1024)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		defer s.Stop()
+		go s.Start()
+	}
+
+	defer os.RemoveAll("./coordinator")
+
+	aria := open(t, "./coordinator")
+	defer aria.Close()
+
+	aria.Config.Sharding = &core.Sharding{Username: "admin", Password: "admin"}
+
+	c, err := New(aria)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ch := aria.OpenChannel(aria.Catalog.GetUser("admin"))
+	defer c.CloseChannel(ch)
+
+	for _, stmt := range []string{
+		"CREATE SHARD s0 ON '127.0.0.1:37972';",
+		"CREATE SHARD s1 ON '127.0.0.1:37973';",
+		"CREATE DATABASE shop;",
+		"USE shop;",
+		"CREATE TABLE users (user_id INT, email CHAR(64) UNIQUE);",
+		"ALTER TABLE users SHARD BY user_id;",
+		"CREATE TABLE items (item_id INT, sku CHAR(16), code CHAR(16));",
+		"ALTER TABLE items SHARD BY item_id;",
+		"INSERT INTO users (user_id, email) VALUES (1, 'a@shop'), (2, 'b@shop'), (3, 'c@shop'), (4, 'd@shop');",
+		"INSERT INTO items (item_id, sku, code) VALUES (1, 'pen', 'p1'), (2, 'pen', 'p2'), (3, 'ink', 'i1'), (4, 'ink', 'i2');",
+	} {
+		execute(t, c, ch, stmt)
+	}
+
+	fail := func(stmt string) {
+		ast, err := parser.NewParser(parser.NewLexer([]byte(stmt))).Parse()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = c.Execute(ch, []byte(stmt), ast, true)
+		if err == nil {
+			t.Fatalf("expected error for %s", stmt)
+		}
+
+		t.Log(err)
+	}
+
+	// Unique keys without the shard key are checked across every shard, whichever shard a row is inserted on
+	for i := 5; i < 9; i++ {
+		fail(fmt.Sprintf("INSERT INTO users (user_id, email) VALUES (%d, 'a@shop');", i))
+	}
+
+	fail("INSERT INTO users (user_id, email) VALUES (5, 'e@shop'), (6, 'e@shop');")
+	fail("UPDATE users SET email = 'b@shop' WHERE user_id = 1;")
+	fail("UPDATE users SET email = 'f@shop' WHERE email = 'a@shop';")
+
+	execute(t, c, ch, "INSERT INTO users (user_id, email) VALUES (5, 'e@shop'), (6, 'f@shop');")
+	execute(t, c, ch, "UPDATE users SET email = 'g@shop' WHERE user_id = 1;")
+
+	rows := execute(t, c, ch, "SELECT COUNT(*) FROM users;")
+	if len(rows) != 1 || rows[0]["COUNT"].(json.Number).String() != "6" {
+		t.Fatalf("expected 6 users, got %v", rows)
+	}
+
+	rows = execute(t, c, ch, "SELECT email FROM users WHERE user_id = 1;")
+	if len(rows) != 1 || rows[0]["email"] != "g@shop" {
+		t.Fatalf("expected the email of user 1 updated, got %v", rows)
+	}
+
+	// A unique index is only created if no rows of the shards duplicate its key
+	fail("CREATE UNIQUE INDEX items_sku ON items (sku);")
+
+	execute(t, c, ch, "CREATE UNIQUE INDEX items_code ON items (code);")
+
+	fail("INSERT INTO items (item_id, sku, code) VALUES (5, 'cap', 'p1');")
+	fail("INSERT INTO items (item_id, sku, code) VALUES (6, 'cap', 'p2');")
+}
+
+func TestCoordinator_Subquery(t *testing.T) {
+	shards := make([]*core.AriaSQL, 0)
+
+	for i := 0; i < 2; i++ {
+		dataDir := fmt.Sprintf("./shard%d", i)
+		defer os.RemoveAll(dataDir)
+
+		aria := open(t, dataDir)
+		defer aria.Close()
+
+		s, err := server.NewTCPServer(37974+i, "127.0.0.1", aria, 1024)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		defer s.Stop()
+		go s.Start()
+
+		shards = append(shards, aria)
+	}
+
+	defer os.RemoveAll("./coordinator")
+
+	aria := open(t, "./coordinator")
+	defer aria.Close()
+
+	aria.Config.Sharding = &core.Sharding{Username: "admin", Password: "admin"}
+
+	c, err := New(aria)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ch := aria.OpenChannel(aria.Catalog.GetUser("admin"))
+	defer c.CloseChannel(ch)
+
+	for _, stmt := range []string{
+		"CREATE SHARD s0 ON '127.0.0.1:37974';",
+		"CREATE SHARD s1 ON '127.0.0.1:37975';",
+		"CREATE DATABASE shop;",
+		"USE shop;",
+		"CREATE TABLE orders (order_id INT, region CHAR(8));",
+		"ALTER TABLE orders SHARD BY order_id;",
+		"CREATE TABLE regions (name CHAR(8), uid UUID DEFAULT GENERATE_UUID, created TIMESTAMP DEFAULT SYS_TIMESTAMP);",
+		"CREATE TABLE secrets (name CHAR(8));",
+		"INSERT INTO orders (order_id, region) VALUES (1, 'eu'), (2, 'us');",
+		"INSERT INTO regions (name) VALUES ('eu'), ('us');",
+		"INSERT INTO secrets (name) VALUES ('eu');",
+		"CREATE USER clerk IDENTIFIED BY 'password';",
+		"GRANT SELECT, DELETE ON shop.regions TO clerk;",
+	} {
+		execute(t, c, ch, stmt)
+	}
+
+	// Every shard holds the same UUIDs and times generated for an unsharded table
+	var regions []string
+
+	for _, s := range shards {
+		ex := executor.New(s, s.OpenChannel(s.Catalog.GetUser("admin")))
+		ex.SetJsonOutput(true)
+
+		for _, stmt := range []string{"USE shop;", "SELECT * FROM regions ORDER BY name;"} {
+			ast, err := parser.NewParser(parser.NewLexer([]byte(stmt))).Parse()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = ex.Execute(ast)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		regions = append(regions, string(ex.GetResultSet()))
+	}
+
+	if regions[0] != regions[1] {
+		t.Fatalf("expected the same regions on every shard, got %s and %s", regions[0], regions[1])
+	}
+
+	fail := func(ch *core.Channel, stmt string) {
+		ast, err := parser.NewParser(parser.NewLexer([]byte(stmt))).Parse()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = c.Execute(ch, []byte(stmt), ast, true)
+		if err == nil {
+			t.Fatalf("expected error for %s", stmt)
+		}
+
+		t.Log(err)
+	}
+
+	// A shard only holds some of the rows of a sharded table
+	fail(ch, "SELECT * FROM regions WHERE name IN (SELECT region FROM orders);")
+	fail(ch, "DELETE FROM regions WHERE name IN (SELECT region FROM orders WHERE order_id = 1);")
+
+	rows := execute(t, c, ch, "SELECT name FROM regions WHERE name IN (SELECT name FROM secrets);")
+	if len(rows) != 1 || rows[0]["name"] != "eu" {
+		t.Fatalf("expected region eu, got %v", rows)
+	}
+
+	// Tables read by subqueries are checked against the privileges of the user
+	clerk := aria.OpenChannel(aria.Catalog.GetUser("clerk"))
+	defer c.CloseChannel(clerk)
+
+	execute(t, c, clerk, "USE shop;")
+
+	fail(clerk, "SELECT name FROM regions WHERE name IN (SELECT name FROM secrets);")
+	fail(clerk, "SELECT name FROM regions WHERE EXISTS (SELECT name FROM secrets WHERE secrets.name = regions.name);")
+	fail(clerk, "DELETE FROM regions WHERE name IN (SELECT name FROM secrets);")
+
+	rows = execute(t, c, clerk, "SELECT name FROM regions ORDER BY name;")
+	if len(rows) != 2 {
+		t.Fatalf("expected 2 regions, got %v", rows)
+	}
+}
@@ -20,18 +20,24 @@ package shared
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/google/uuid"
 	"golang.org/x/crypto/bcrypt"
 	"io"
 	"io/fs"
+	"math/rand"
 	"os"
 	"path/filepath"
 	"reflect"
 	"runtime"
+	"slices"
 	"sort"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
+	"unicode/utf8"
 )
 
 // Shared between all packages
@@ -91,6 +97,9 @@ type SysTimestamp struct{} // Current TIMESTAMP alias for DATETIME
 // GenUUID represents generate UUID function
 type GenUUID struct{} // Generate a UUID
 
+// GenUUIDv7 represents the UUID_V7 function
+type GenUUIDv7 struct{} // Generate a UUID ordered by the time it is generated
+
 // You grant privileges to a user on a database or table
 // GRANT SELECT, INSERT, UPDATE, DELETE ON database.table TO user;
 
@@ -106,7 +115,7 @@ func GetDefaultDataDir() string {
 	// A user of AriaSQL can set the data directory, if not set we use the default which would be preferred
 	switch runtime.GOOS {
 	case "windows":
-		return os.Getenv("ProgramData") + GetOsPathSeparator() + "AriaSQL"
+		return filepath.Join(os.Getenv("ProgramData"), "AriaSQL")
 	case "darwin":
 		return "/Library/Application Support/AriaSQL"
 	default:
@@ -136,13 +145,14 @@ func IsValidDataType(dataType string) bool {
 func getColumnWidths(data []map[string]interface{}, headers []string) map[string]int {
 	widths := make(map[string]int)
 	for _, header := range headers {
-		widths[header] = len(header)
+		widths[header] = utf8.RuneCountInString(header)
 	}
 	for _, row := range data {
 		for _, header := range headers {
+			// Values are padded to the width in characters
 			value := fmt.Sprintf("%v", row[header])
-			if len(value) > widths[header] {
-				widths[header] = len(value)
+			if utf8.RuneCountInString(value) > widths[header] {
+				widths[header] = utf8.RuneCountInString(value)
 			}
 		}
 	}
@@ -326,6 +336,68 @@ func CreateJSONByteArray(data []map[string]interface{}) ([]byte, error) {
 	return marshal, nil
 }
 
+// CreateOrderedJSONByteArray creates a JSON byte array of the data whose objects have their keys in the order of headers
+// Keys which are not headers follow in name order
+func CreateOrderedJSONByteArray(data []map[string]interface{}, headers []string) ([]byte, error) {
+	if len(data) == 0 {
+		return json.Marshal(data)
+	}
+
+	var buffer bytes.Buffer
+
+	buffer.WriteByte('[')
+
+	for i, row := range data {
+		if i > 0 {
+			buffer.WriteByte(',')
+		}
+
+		keys := make([]string, 0, len(row))
+		for _, header := range headers {
+			if _, ok := row[header]; ok && !slices.Contains(keys, header) {
+				keys = append(keys, header)
+			}
+		}
+
+		rest := make([]string, 0)
+		for key := range row {
+			if !slices.Contains(keys, key) {
+				rest = append(rest, key)
+			}
+		}
+
+		sort.Strings(rest)
+
+		buffer.WriteByte('{')
+
+		for j, key := range append(keys, rest...) {
+			if j > 0 {
+				buffer.WriteByte(',')
+			}
+
+			k, err := json.Marshal(key)
+			if err != nil {
+				return nil, err
+			}
+
+			v, err := json.Marshal(row[key])
+			if err != nil {
+				return nil, err
+			}
+
+			buffer.Write(k)
+			buffer.WriteByte(':')
+			buffer.Write(v)
+		}
+
+		buffer.WriteByte('}')
+	}
+
+	buffer.WriteByte(']')
+
+	return buffer.Bytes(), nil
+}
+
 // IsValidDateTimeFormat checks if the date time format is valid or not (format is YYYY-MM-DD HH:MM:SS)
 func IsValidDateTimeFormat(dateTimeFormat string) bool {
 	if len(dateTimeFormat) != 19 {
@@ -406,9 +478,201 @@ func FormatToTimeStamp(date time.Time) string {
 	return date.Format("2006-01-02 15:04:05")
 }
 
+// Source is a clock and a random number generator, statements replicated to a cluster are executed with
+// the same source on every node so SYS_TIMESTAMP, GENERATE_UUID and RANDOM have the same values on all of them
+// A nil source uses the clock and random numbers of the package
+type Source struct {
+	now  time.Time     // Time returned by the next call to Now
+	step time.Duration // How far the time advances on every call to Now
+	rand *rand.Rand    // Source of UUIDs and random numbers
+	lock *sync.Mutex   // Guards now and rand
+}
+
+// NewSource returns a source at the time now, its UUIDs and random numbers are generated from seed
+func NewSource(now time.Time, seed int64) *Source {
+	return &Source{now: now, rand: rand.New(rand.NewSource(seed)), lock: &sync.Mutex{}}
+}
+
+var deterministic atomic.Pointer[Source] // Makes Now, GenerateUUID, GenerateUUIDv7 and Random deterministic for tests, nil when not deterministic
+
+// SetDeterministic makes Now, GenerateUUID, GenerateUUIDv7 and Random deterministic, for tests only
+// Now returns start and advances a millisecond on every call, UUIDs and random numbers are generated from seed
+func SetDeterministic(start time.Time, seed int64) {
+	source := NewSource(start, seed)
+	source.step = time.Millisecond
+
+	deterministic.Store(source)
+}
+
+// ResetDeterministic makes Now, GenerateUUID, GenerateUUIDv7 and Random use the clock and random numbers again
+func ResetDeterministic() {
+	deterministic.Store(nil)
+}
+
+// Now returns the current time, used for SYS_DATE, SYS_TIME and SYS_TIMESTAMP
+func Now() time.Time {
+	d := deterministic.Load()
+	if d == nil {
+		return time.Now()
+	}
+
+	return d.Now()
+}
+
 // GenerateUUID generates a UUID
 func GenerateUUID() string {
-	return uuid.New().String()
+	d := deterministic.Load()
+	if d == nil {
+		return uuid.New().String()
+	}
+
+	return d.GenerateUUID()
+}
+
+// GenerateUUIDv7 generates a UUID starting with the unix milliseconds it was generated at
+// UUIDs generated later sort after, rows keyed by them are appended to the end of an index rather than spread across it
+func GenerateUUIDv7() string {
+	d := deterministic.Load()
+	if d == nil {
+		id, err := uuid.NewV7()
+		if err != nil {
+			return uuid.New().String()
+		}
+
+		return id.String()
+	}
+
+	return d.GenerateUUIDv7()
+}
+
+// Random returns a random number from 0 up to but not including 1
+func Random() float64 {
+	d := deterministic.Load()
+	if d == nil {
+		return rand.Float64()
+	}
+
+	return d.Random()
+}
+
+// Now returns the time of the source
+func (s *Source) Now() time.Time {
+	if s == nil {
+		return Now()
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	now := s.now
+	s.now = s.now.Add(s.step)
+
+	return now
+}
+
+// GenerateUUID generates a UUID from the source
+func (s *Source) GenerateUUID() string {
+	if s == nil {
+		return GenerateUUID()
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	id, err := uuid.NewRandomFromReader(s.rand)
+	if err != nil {
+		return uuid.New().String()
+	}
+
+	return id.String()
+}
+
+// GenerateUUIDv7 generates a UUID starting with the unix milliseconds of the time of the source
+func (s *Source) GenerateUUIDv7() string {
+	if s == nil {
+		return GenerateUUIDv7()
+	}
+
+	ms := s.Now().UnixMilli()
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	var id uuid.UUID
+	s.rand.Read(id[6:])
+
+	for i := 5; i >= 0; i-- {
+		id[i] = byte(ms)
+		ms >>= 8
+	}
+
+	id[6] = 0x70 | id[6]&0x0f // Version 7
+	id[8] = 0x80 | id[8]&0x3f // RFC 4122 variant
+
+	return id.String()
+}
+
+// Random returns a random number of the source from 0 up to but not including 1
+func (s *Source) Random() float64 {
+	if s == nil {
+		return Random()
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.rand.Float64()
+}
+
+// QuoteLiteral returns s as a single quoted string literal, quotes and backslashes within are escaped so the literal cannot end early
+// Statements with a NUL byte are rejected by the parser, s should not have one
+func QuoteLiteral(s string) string {
+	var b strings.Builder
+
+	b.Grow(len(s) + 2)
+	b.WriteByte('\'')
+
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\'' || s[i] == '\\' {
+			b.WriteByte('\\')
+		}
+
+		b.WriteByte(s[i])
+	}
+
+	b.WriteByte('\'')
+
+	return b.String()
+}
+
+// UnquoteLiteral returns the text of a string literal as the parser keeps it, without its quotes and with its escaped quotes unescaped
+func UnquoteLiteral(s string) string {
+	if len(s) < 2 || (s[0] != '\'' && s[0] != '"') || s[len(s)-1] != s[0] {
+		return s
+	}
+
+	quote := s[:1]
+
+	return strings.ReplaceAll(s[1:len(s)-1], "\\"+quote, quote)
+}
+
+// QuoteIdentifier returns name if it can be used as an identifier within a statement
+// Identifiers cannot be quoted, a name which is not letters, digits and underscores, starting with a letter or underscore, is rejected
+func QuoteIdentifier(name string) (string, error) {
+	if name == "" {
+		return "", errors.New("empty identifier")
+	}
+
+	for i, r := range name {
+		switch {
+		case r == '_', r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z':
+		case r >= '0' && r <= '9' && i > 0:
+		default:
+			return "", fmt.Errorf("invalid identifier %q", name)
+		}
+	}
+
+	return name, nil
 }
 
 // ReverseString reverses a string
@@ -420,6 +684,16 @@ func ReverseString(s string) string {
 	return string(runes)
 }
 
+// RuneIndex returns the index in characters of the first instance of substr in s, or -1 if substr is not present
+func RuneIndex(s, substr string) int {
+	i := strings.Index(s, substr)
+	if i < 0 {
+		return i
+	}
+
+	return utf8.RuneCountInString(s[:i])
+}
+
 // IdenticalMap checks if two maps are identical
 func IdenticalMap(x, y map[string]interface{}) bool {
 	if len(x) != len(y) {
@@ -0,0 +1,1643 @@
+// Package shell tests
+// Copyright (C) AriaSQL
+// Author(s): Alex Gaetano Padula
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+package shell
+
+import (
+	"ariasql/dsn"
+	"ariasql/shared"
+	"bufio"
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/chzyer/readline"
+)
+
+func TestNew(t *testing.T) {
+	defer os.Remove(".asql_history")
+
+	asql, err := New()
+	if err != nil {
+		t.Errorf("Expected nil, got %s", err)
+	}
+
+	if asql == nil {
+		t.Errorf("Expected not nil, got nil")
+	}
+
+}
+
+func TestTranslateDump(t *testing.T) {
+	mysqldump := "-- MySQL dump 10.13  Distrib 8.0.36\n" +
+		"/*!40101 SET NAMES utf8mb4 */;\n" +
+		"DROP TABLE IF EXISTS `users`;\n" +
+		"CREATE TABLE `users` (\n" +
+		"  `id` int NOT NULL AUTO_INCREMENT,\n" +
+		"  `email` varchar(255) NOT NULL,\n" +
+		"  `balance` decimal(10,2) DEFAULT '0.00',\n" +
+		"  `created` datetime DEFAULT CURRENT_TIMESTAMP,\n" +
+		"  PRIMARY KEY (`id`),\n" +
+		"  UNIQUE KEY `email` (`email`),\n" +
+		"  KEY `idx_created` (`created`)\n" +
+		") ENGINE=InnoDB AUTO_INCREMENT=3 DEFAULT CHARSET=utf8mb4;\n" +
+		"LOCK TABLES `users` WRITE;\n" +
+		"/*!40000 ALTER TABLE `users` DISABLE KEYS */;\n" +
+		"INSERT INTO `users` VALUES (1,'alex@example.com',10.50,'2024-01-01 10:00:00'),(2,'o\\'brien;@example.com',0.00,NULL);\n" +
+		"UNLOCK TABLES;\n"
+
+	d := translateDump(mysqldump)
+
+	expected := []string{
+		"CREATE TABLE users (id INT NOT NULL UNIQUE SEQUENCE, email CHAR(255) NOT NULL UNIQUE, balance DECIMAL(10,2) DEFAULT 0.00, created DATETIME DEFAULT SYS_TIMESTAMP);",
+		"CREATE INDEX idx_created ON users (created);",
+		"INSERT INTO users (id, email, balance, created) VALUES (1, 'alex@example.com', 10.50, '2024-01-01 10:00:00');",
+		"INSERT INTO users (id, email, balance, created) VALUES (2, 'o\\'brien;@example.com', 0.00, NULL);",
+	}
+
+	if len(d.skipped) != 0 {
+		t.Fatalf("expected no skipped statements, got %v", d.skipped)
+	}
+
+	if strings.Join(d.statements, "\n") != strings.Join(expected, "\n") {
+		t.Fatalf("expected\n%s\ngot\n%s", strings.Join(expected, "\n"), strings.Join(d.statements, "\n"))
+	}
+
+	pgdump := "--\n-- PostgreSQL database dump\n--\n" +
+		"SET standard_conforming_strings = on;\n" +
+		"SELECT pg_catalog.set_config('search_path', '', false);\n" +
+		"CREATE TABLE public.\"orders\" (\n" +
+		"    id integer NOT NULL,\n" +
+		"    status character varying(16) DEFAULT 'new'::character varying NOT NULL,\n" +
+		"    paid boolean,\n" +
+		"    note text,\n" +
+		"    created timestamp without time zone\n" +
+		");\n" +
+		"ALTER TABLE public.orders OWNER TO postgres;\n" +
+		"CREATE SEQUENCE public.orders_id_seq AS integer START WITH 1 INCREMENT BY 1 NO MINVALUE NO MAXVALUE CACHE 1;\n" +
+		"ALTER TABLE ONLY public.orders ALTER COLUMN id SET DEFAULT nextval('public.orders_id_seq'::regclass);\n" +
+		"COPY public.orders (id, status, paid, note, created) FROM stdin;\n" +
+		"1\tnew\tt\tit's here\t2024-01-01 10:00:00\n" +
+		"2\tshipped\tf\t\\N\t\\N\n" +
+		"3\tnew\tf\tC:\\\\temp\t\\N\n" +
+		"\\.\n" +
+		"SELECT pg_catalog.setval('public.orders_id_seq', 2, true);\n" +
+		"ALTER TABLE ONLY public.orders ADD CONSTRAINT orders_pkey PRIMARY KEY (id);\n" +
+		"CREATE INDEX orders_status_idx ON public.orders USING btree (status);\n" +
+		"ALTER TABLE ONLY public.orders ADD CONSTRAINT orders_customer_fkey FOREIGN KEY (customer_id) REFERENCES public.customers(id);\n"
+
+	d = translateDump(pgdump)
+
+	expected = []string{
+		"CREATE TABLE orders (id INT NOT NULL UNIQUE SEQUENCE, status CHAR(16) NOT NULL DEFAULT 'new', paid BOOLEAN, note TEXT, created TIMESTAMP);",
+		"INSERT INTO orders (id, status, paid, note, created) VALUES (1, 'new', TRUE, 'it\\'s here', '2024-01-01 10:00:00');",
+		"INSERT INTO orders (id, status, paid, note, created) VALUES (2, 'shipped', FALSE, NULL, NULL);",
+		"INSERT INTO orders (id, status, paid, note, created) VALUES (3, 'new', FALSE, 'C:\\\\temp', NULL);",
+		"CREATE INDEX orders_status_idx ON orders (status);",
+	}
+
+	if strings.Join(d.statements, "\n") != strings.Join(expected, "\n") {
+		t.Fatalf("expected\n%s\ngot\n%s", strings.Join(expected, "\n"), strings.Join(d.statements, "\n"))
+	}
+
+	// The foreign key cannot be translated and is reported
+	if len(d.skipped) != 1 || !strings.Contains(d.skipped[0], "orders_customer_fkey") {
+		t.Fatalf("expected the foreign key to be skipped, got %v", d.skipped)
+	}
+}
+
+func TestSplitNotifications(t *testing.T) {
+	notifications, rest := splitNotifications([]byte("NOTIFY: jobs 2 \"job 1\"\nOK\n{\"notify\":\"cache\",\"payload\":\"\",\"sender\":2}\n"))
+
+	if len(notifications) != 2 || notifications[0] != `NOTIFY: jobs 2 "job 1"` || notifications[1] != `{"notify":"cache","payload":"","sender":2}` {
+		t.Fatalf("unexpected notifications %q", notifications)
+	}
+
+	if string(rest) != "OK\n" {
+		t.Fatalf("expected OK, got %q", string(rest))
+	}
+}
+
+func TestPipeline(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	// The server reads every frame before responding, as if the responses were delayed by a slow link
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		buf := make([]byte, 1024)
+		n, _ := conn.Read(buf)
+		if string(buf[:n]) != "pipeline on abort" {
+			conn.Write([]byte("ERR: unexpected " + string(buf[:n]) + "\n"))
+			return
+		}
+
+		conn.Write([]byte("OK\n"))
+
+		reader := bufio.NewReader(conn)
+		stmts := make([]string, 0)
+		for len(stmts) == 0 || stmts[len(stmts)-1] != "pipeline off" {
+			f, err := readFrame(reader, "")
+			if err != nil {
+				return
+			}
+
+			stmts = append(stmts, string(f))
+		}
+
+		f, _ := frame([]byte("NOTIFY: jobs 2 \"job 1\"\n"), "")
+		conn.Write(f)
+		for _, stmt := range stmts {
+			f, _ := frame([]byte("RAN: "+stmt+"\n"), "")
+			conn.Write(f)
+		}
+	}()
+
+	asql, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	asql.bufferSize = 1024
+	asql.conn, err = net.DialTCP("tcp", nil, listener.Addr().(*net.TCPAddr))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer asql.close()
+
+	responses, err := asql.pipeline([]string{"USE db;", "SELECT * FROM t;"}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(responses) != 2 || string(responses[0]) != "RAN: USE db;\n" || string(responses[1]) != "RAN: SELECT * FROM t;\n" {
+		t.Fatalf("unexpected responses %q", responses)
+	}
+}
+
+func TestReadResponse(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	large := strings.Repeat("row\n", 4096)
+
+	// A response written in parts, split within a line, then the response to a framed statement larger than the buffer
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		conn.Write([]byte("OK\nro"))
+		time.Sleep(50 * time.Millisecond)
+		conn.Write([]byte("w\n"))
+
+		_, err = readFrame(bufio.NewReader(conn), "")
+		if err != nil {
+			return
+		}
+
+		f, _ := frame([]byte(large), "")
+		conn.Write(f)
+	}()
+
+	asql, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	asql.bufferSize = 1024
+	asql.conn, err = net.DialTCP("tcp", nil, listener.Addr().(*net.TCPAddr))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer asql.close()
+
+	response, err := asql.read()
+	if err != nil || string(response) != "OK\nrow\n" {
+		t.Fatalf("expected the whole response, got %q, %v", response, err)
+	}
+
+	asql.frames = true
+
+	response, err = asql.execute("SELECT * FROM t;")
+	if err != nil || string(response) != large {
+		t.Fatalf("expected the whole frame, got %d bytes, %v", len(response), err)
+	}
+}
+
+func TestBatch(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	received := make(chan []string, 1)
+
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		stmts := make([]string, 0)
+		defer func() { received <- stmts }()
+
+		buf := make([]byte, 1024)
+		for {
+			n, err := conn.Read(buf)
+			if err != nil {
+				return
+			}
+
+			stmts = append(stmts, string(buf[:n]))
+
+			if strings.Contains(string(buf[:n]), "missing") {
+				conn.Write([]byte("ERR: table does not exist\n"))
+				continue
+			}
+
+			conn.Write([]byte("RAN: " + string(buf[:n]) + "\n"))
+		}
+	}()
+
+	asql, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	asql.bufferSize = 1024
+	asql.conn, err = net.DialTCP("tcp", nil, listener.Addr().(*net.TCPAddr))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out := &bytes.Buffer{}
+
+	// Statements run until the first which fails
+	err = asql.batch([]byte("USE db;\nSELECT * FROM t;\nSELECT * FROM missing;\nSELECT * FROM t;\n"), out)
+	if err == nil || err.Error() != "ERR: table does not exist" {
+		t.Fatalf("expected the error of the failed statement, got %v", err)
+	}
+
+	asql.close()
+
+	if out.String() != "RAN: USE db;\nRAN: SELECT * FROM t;\n" {
+		t.Fatalf("unexpected output %q", out.String())
+	}
+
+	if stmts := <-received; len(stmts) != 3 {
+		t.Fatalf("expected 3 statements executed, got %q", stmts)
+	}
+}
+
+func TestInclude(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		buf := make([]byte, 1024)
+		for {
+			n, err := conn.Read(buf)
+			if err != nil {
+				return
+			}
+
+			if strings.Contains(string(buf[:n]), "missing") {
+				conn.Write([]byte("ERR: table does not exist\n"))
+				continue
+			}
+
+			conn.Write([]byte("RAN: " + string(buf[:n]) + "\n"))
+		}
+	}()
+
+	asql, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	asql.bufferSize = 1024
+	asql.conn, err = net.DialTCP("tcp", nil, listener.Addr().(*net.TCPAddr))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer asql.close()
+
+	path := filepath.Join(t.TempDir(), "script.sql")
+
+	err = os.WriteFile(path, []byte("USE db;\n\n-- orders\nSELECT *\nFROM missing;\nSELECT * FROM t;\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Statements following a failed statement run, the failure is reported with its line
+	response, ok := asql.metaCommand("\\i " + path)
+	if !ok {
+		t.Fatal("expected \\i to be a meta command")
+	}
+
+	expected := "RAN: USE db;\n" +
+		"Error at line 4 of " + path + ": ERR: table does not exist\n" +
+		"RAN: SELECT * FROM t;\n" +
+		"1 of 3 statements failed\n"
+	if string(response) != expected {
+		t.Fatalf("expected %q, got %q", expected, response)
+	}
+
+	response, _ = asql.metaCommand("\\onerror stop")
+	if string(response) != "Scripts stop at the first statement which fails\n" {
+		t.Fatalf("unexpected response %q", response)
+	}
+
+	response, _ = asql.metaCommand("\\i " + path)
+
+	expected = "RAN: USE db;\n" +
+		"Error at line 4 of " + path + ": ERR: table does not exist\n" +
+		"Stopped at line 4 of " + path + ", 1 statements not executed\n"
+	if string(response) != expected {
+		t.Fatalf("expected %q, got %q", expected, response)
+	}
+
+	response, _ = asql.metaCommand("\\i " + path + ".missing")
+	if !strings.HasPrefix(string(response), "Error: open ") {
+		t.Fatalf("expected an error opening the file, got %q", response)
+	}
+}
+
+func TestOutput(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		buf := make([]byte, 1024)
+		for {
+			n, err := conn.Read(buf)
+			if err != nil {
+				return
+			}
+
+			if strings.Contains(string(buf[:n]), "missing") {
+				conn.Write([]byte("ERR: table does not exist\n"))
+				continue
+			}
+
+			conn.Write([]byte("RAN: " + string(buf[:n]) + "\n"))
+		}
+	}()
+
+	asql, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	asql.bufferSize = 1024
+	asql.conn, err = net.DialTCP("tcp", nil, listener.Addr().(*net.TCPAddr))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer asql.close()
+
+	dir := t.TempDir()
+	script := filepath.Join(dir, "report.sql")
+	results := filepath.Join(dir, "results.txt")
+
+	err = os.WriteFile(script, []byte("SELECT * FROM t;\nSELECT * FROM missing;\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	response, ok := asql.metaCommand("\\o " + results)
+	if !ok {
+		t.Fatal("expected \\o to be a meta command")
+	}
+
+	if string(response) != "Results are written to "+results+"\n" {
+		t.Fatalf("unexpected response %q", response)
+	}
+
+	// Results are written to the file, errors stay on the terminal
+	response, _ = asql.metaCommand("\\i " + script)
+
+	expected := "Error at line 2 of " + script + ": ERR: table does not exist\n" +
+		"1 of 2 statements failed\n"
+	if string(response) != expected {
+		t.Fatalf("expected %q, got %q", expected, response)
+	}
+
+	// tee writes results to both, the file is truncated
+	response, _ = asql.metaCommand("\\o tee " + results)
+	if string(response) != "Results are written to "+results+" and the terminal\n" {
+		t.Fatalf("unexpected response %q", response)
+	}
+
+	response, _ = asql.metaCommand("\\i " + script)
+	if !strings.HasPrefix(string(response), "RAN: SELECT * FROM t;\nError at line 2") {
+		t.Fatalf("expected the results on the terminal, got %q", response)
+	}
+
+	response, _ = asql.metaCommand("\\o")
+	if string(response) != "Results are written to the terminal\n" {
+		t.Fatalf("unexpected response %q", response)
+	}
+
+	written, err := os.ReadFile(results)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(written) != "RAN: SELECT * FROM t;\n" {
+		t.Fatalf("expected the results of the last script, got %q", written)
+	}
+
+	if asql.results(os.Stdout) != os.Stdout {
+		t.Fatal("expected results to be written to the terminal")
+	}
+
+	response, _ = asql.metaCommand("\\o " + filepath.Join(dir, "missing", "results.txt"))
+	if !strings.HasPrefix(string(response), "Error: open ") {
+		t.Fatalf("expected an error opening the file, got %q", response)
+	}
+}
+
+func TestTiming(t *testing.T) {
+	asql, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	response, ok := asql.metaCommand("\\timing summary")
+	if !ok || string(response) != "No statements timed\n" {
+		t.Fatalf("unexpected response %q", response)
+	}
+
+	if line := asql.timed(12400 * time.Microsecond); line != "Time: 12.4ms\n" {
+		t.Fatalf("unexpected timing %q", line)
+	}
+
+	response, _ = asql.metaCommand("\\timing off")
+	if string(response) != "Timing is off\n" {
+		t.Fatalf("unexpected response %q", response)
+	}
+
+	// Statements are still timed for the summary with timing off
+	if line := asql.timed(2 * time.Millisecond); line != "" {
+		t.Fatalf("expected no timing, got %q", line)
+	}
+
+	asql.timed(100 * time.Millisecond)
+
+	response, _ = asql.metaCommand("\\timing summary")
+
+	expected := "Statements: 3, total: 114.4ms, mean: 38.1ms, min: 2.0ms, max: 100.0ms\n"
+	if string(response) != expected {
+		t.Fatalf("expected %q, got %q", expected, response)
+	}
+
+	response, _ = asql.metaCommand("\\timing")
+	if string(response) != "Timing is off\n" {
+		t.Fatalf("unexpected response %q", response)
+	}
+
+	response, _ = asql.metaCommand("\\timing later")
+	if !strings.HasPrefix(string(response), "Expected") {
+		t.Fatalf("expected an error, got %q", response)
+	}
+}
+
+func TestPrompt(t *testing.T) {
+	asql, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if asql.renderPrompt() != "ariasql>" {
+		t.Fatalf("expected ariasql>, got %s", asql.renderPrompt())
+	}
+
+	asql.username, asql.host, asql.port = "alex", "db.example.com", 3695
+
+	response, ok := asql.metaCommand("\\prompt '%u@%h:%p/%d%x> '")
+	if !ok || string(response) != "Prompt is '%u@%h:%p/%d%x> '\n" {
+		t.Fatalf("unexpected response %q", response)
+	}
+
+	if prompt := asql.renderPrompt(); prompt != "alex@db.example.com:3695/> " {
+		t.Fatalf("unexpected prompt %q", prompt)
+	}
+
+	// The database in use and the transaction state follow the statements which succeeded
+	asql.track("USE shop;", []byte("OK\n"))
+	asql.track("BEGIN;", []byte("OK\n"))
+
+	if prompt := asql.renderPrompt(); prompt != "alex@db.example.com:3695/shop*> " {
+		t.Fatalf("unexpected prompt %q", prompt)
+	}
+
+	// A statement failing within the transaction marks it failed, until it is rolled back
+	for _, step := range []struct {
+		stmt, response, prompt string
+	}{
+		{"USE other;", "ERR: statement not allowed in a transaction\n", "shop!> "},
+		{"INSERT INTO orders (id) VALUES (1);", "OK\n", "shop!> "},
+		{"ROLLBACK;", "ERR: user does not have the privilege to ROLLBACK transaction on system\n", "shop!> "},
+		{"rollback;", "OK\n", "shop> "},
+		{"SELECT 1;", "ERR: no table\n", "shop> "},
+		{"BEGIN;", "OK\n", "shop*> "},
+		{"COMMIT;", "ERR: serialization failure, table orders was written since the transaction began, retry the transaction\n", "shop> "},
+		{"BEGIN;", "OK\n", "shop*> "},
+		{"commit;", "OK\n", "shop> "},
+	} {
+		asql.track(step.stmt, []byte(step.response))
+
+		if prompt := asql.renderPrompt(); prompt != "alex@db.example.com:3695/"+step.prompt {
+			t.Fatalf("unexpected prompt %q after %s", prompt, step.stmt)
+		}
+	}
+
+	// The continuation prompt is right aligned with the prompt
+	s := &statement{lines: []string{"SELECT *"}}
+	if continuation := s.prompt(asql.renderPrompt()); continuation != strings.Repeat(" ", 27)+"...>" {
+		t.Fatalf("unexpected continuation prompt %q", continuation)
+	}
+
+	asql.metaCommand("\\prompt 100%% %q")
+	if prompt := asql.renderPrompt(); prompt != "100% %q" {
+		t.Fatalf("unexpected prompt %q", prompt)
+	}
+
+	// The config file sets the prompt and the other settings of the CLI
+	config := filepath.Join(t.TempDir(), CONFIG_FILE)
+
+	err = os.WriteFile(config, []byte("-- asql settings\n\\prompt %d>\n\n\\timing off\n\\format csv\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = asql.loadConfig(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if asql.renderPrompt() != "shop>" || asql.timing || asql.outputFormat != FORMAT_CSV {
+		t.Fatalf("unexpected settings %q %v %s", asql.renderPrompt(), asql.timing, asql.outputFormat)
+	}
+
+	err = os.WriteFile(config, []byte("\\timing on\nSELECT 1;\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = asql.loadConfig(config)
+	if err == nil || !strings.Contains(err.Error(), "line 2") {
+		t.Fatalf("expected an error at line 2, got %v", err)
+	}
+
+	err = asql.loadConfig(filepath.Join(t.TempDir(), "missing"))
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLookupPassword(t *testing.T) {
+	passwords := filepath.Join(t.TempDir(), PASSWORD_FILE)
+
+	d := &dsn.DSN{Username: "alex", Host: "db.example.com", Port: 3695, Database: "shop"}
+
+	// No file is no password
+	password, err := lookupPassword(passwords, d)
+	if err != nil || password != "" {
+		t.Fatalf("expected no password, got %q %v", password, err)
+	}
+
+	err = os.WriteFile(passwords, []byte(`# host:port:database:username:password
+db.example.com:3695:other:alex:wrong
+db.example.com:*:shop:alex:p\:ss:word
+*:*:*:sam:secret
+`), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	password, err = lookupPassword(passwords, d)
+	if err != nil || password != "p:ss:word" {
+		t.Fatalf("expected p:ss:word, got %q %v", password, err)
+	}
+
+	d.Username = "sam"
+
+	password, err = lookupPassword(passwords, d)
+	if err != nil || password != "secret" {
+		t.Fatalf("expected secret, got %q %v", password, err)
+	}
+
+	d.Username = "kim"
+
+	password, err = lookupPassword(passwords, d)
+	if err != nil || password != "" {
+		t.Fatalf("expected no password, got %q %v", password, err)
+	}
+
+	// A file other users can read is ignored
+	err = os.Chmod(passwords, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d.Username = "sam"
+
+	password, err = lookupPassword(passwords, d)
+	if err == nil || password != "" {
+		t.Fatalf("expected the file to be ignored, got %q %v", password, err)
+	}
+}
+
+func TestCopyCSV(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	received := make(chan string, 16)
+
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		buf := make([]byte, 4096)
+		for {
+			n, err := conn.Read(buf)
+			if err != nil {
+				return
+			}
+
+			stmt := string(buf[:n])
+
+			switch {
+			case stmt == "DESCRIBE users;":
+				conn.Write([]byte(`[{"Table":"users","Columns":[` +
+					`{"Name":"user_id","DataType":"INT"},{"Name":"name","DataType":"CHAR"},` +
+					`{"Name":"score","DataType":"FLOAT"},{"Name":"active","DataType":"BOOL"}]}]` + "\n"))
+			case strings.Contains(stmt, "'bad'"):
+				received <- stmt
+				conn.Write([]byte("ERR: column user_id is not an int\n"))
+			default:
+				received <- stmt
+				conn.Write([]byte(`{"status":"OK"}` + "\n"))
+			}
+		}
+	}()
+
+	asql, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	asql.bufferSize = 4096
+	asql.tabular = true
+	asql.conn, err = net.DialTCP("tcp", nil, listener.Addr().(*net.TCPAddr))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer asql.close()
+
+	path := filepath.Join(t.TempDir(), "users.csv")
+
+	err = os.WriteFile(path, []byte("user_id,name,score,active\n1,alex,5,true\n2,\"o'brien, sam\",1.5,false\n3,,,\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	progress := &bytes.Buffer{}
+
+	// Values are written as literals of the type of their column, an empty value is NULL
+	response, err := asql.copyCSV("users", path, []string{"header", "batch", "2"}, progress)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(response) != "3 rows copied\n" {
+		t.Fatalf("unexpected response %q", response)
+	}
+
+	for _, expected := range []string{
+		"INSERT INTO users (user_id, name, score, active) VALUES (1, 'alex', 5.0, TRUE), (2, 'o\\'brien, sam', 1.5, FALSE);",
+		"INSERT INTO users (user_id, name, score, active) VALUES (3, NULL, NULL, NULL);",
+	} {
+		if stmt := <-received; stmt != expected {
+			t.Fatalf("expected %q, got %q", expected, stmt)
+		}
+	}
+
+	if progress.String() != "\r2 rows copied\r3 rows copied\n" {
+		t.Fatalf("unexpected progress %q", progress.String())
+	}
+
+	// The batch failing is reported with its lines, the batches before it are kept
+	err = os.WriteFile(path, []byte("1,alex\n2,sam\nbad,kim\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = asql.copyCommand("\\copy users (user_id, name) from '" + path + "' with csv batch 2")
+	if err == nil || err.Error() != "rows at lines 3 to 3 of "+path+": ERR: column user_id is not an int, 2 rows copied before them" {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	<-received
+
+	if stmt := <-received; stmt != "INSERT INTO users (user_id, name) VALUES ('bad', 'kim');" {
+		t.Fatalf("unexpected statement %q", stmt)
+	}
+
+	_, err = asql.copyCommand("\\copy users from '" + path + "' with header batch 0")
+	if err == nil || err.Error() != "invalid batch 0" {
+		t.Fatalf("unexpected error %v", err)
+	}
+}
+
+func TestFrameCompression(t *testing.T) {
+	large := []byte(strings.Repeat("| 1 | ariasql |\n", 1000))
+
+	for _, compression := range []string{COMPRESSION_ZSTD, COMPRESSION_LZ4} {
+		f, err := frame(large, compression)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(f) >= len(large) {
+			t.Fatalf("%s: expected a compressed frame, got %d bytes for %d", compression, len(f), len(large))
+		}
+
+		decoded, err := readFrame(bufio.NewReader(bytes.NewReader(f)), compression)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !bytes.Equal(decoded, large) {
+			t.Fatalf("%s: decompressed frame does not match", compression)
+		}
+
+		// Small statements are sent as they are
+		f, err = frame([]byte("SELECT 1;"), compression)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if string(f[4:]) != "SELECT 1;" {
+			t.Fatalf("%s: expected an uncompressed frame, got %q", compression, f)
+		}
+	}
+}
+
+func TestFormatResult(t *testing.T) {
+	table := renderers[FORMAT_TABLE]
+
+	result := formatResult([]byte(`[{"user_id":1,"name":"alex","email":null},{"user_id":20,"name":"zoë","email":"zoe@example.com"}]`+"\n"), table)
+
+	expected := "+-----------------+------+---------+\n" +
+		"| email           | name | user_id |\n" +
+		"+-----------------+------+---------+\n" +
+		"| NULL            | alex | 1       |\n" +
+		"| zoe@example.com | zoë  | 20      |\n" +
+		"+-----------------+------+---------+\n" +
+		"(2 rows)\n"
+
+	if string(result) != expected {
+		t.Fatalf("expected\n%s\ngot\n%s", expected, result)
+	}
+
+	if !strings.HasSuffix(string(formatResult([]byte(`[{"n":1.5}]`), table)), "| 1.5 |\n+-----+\n(1 row)\n") {
+		t.Fatalf("expected a single row, got %s", formatResult([]byte(`[{"n":1.5}]`), table))
+	}
+
+	for response, expected := range map[string]string{
+		`{"status":"OK"}` + "\n":      "OK\n",
+		"null\n":                      "(0 rows)\n",
+		"ERR: table does not exist\n": "ERR: table does not exist\n",
+	} {
+		if string(formatResult([]byte(response), table)) != expected {
+			t.Fatalf("expected %q for %q, got %q", expected, response, formatResult([]byte(response), table))
+		}
+	}
+}
+
+func TestFormats(t *testing.T) {
+	response := []byte(`[{"user_id":1,"name":"alex, \"al\"","email":null},{"user_id":2,"name":"sam","email":"sam@example.com"}]` + "\n")
+
+	for format, expected := range map[string]string{
+		FORMAT_CSV: "email,name,user_id\n" +
+			",\"alex, \"\"al\"\"\",1\n" +
+			"sam@example.com,sam,2\n",
+		FORMAT_JSON: `[{"email":null,"name":"alex, \"al\"","user_id":1},{"email":"sam@example.com","name":"sam","user_id":2}]` + "\n",
+		FORMAT_VERTICAL: "-[ RECORD 1 ]----------\n" +
+			"email   | NULL\n" +
+			"name    | alex, \"al\"\n" +
+			"user_id | 1\n" +
+			"-[ RECORD 2 ]----------\n" +
+			"email   | sam@example.com\n" +
+			"name    | sam\n" +
+			"user_id | 2\n",
+	} {
+		if result := formatResult(response, renderers[format]); string(result) != expected {
+			t.Fatalf("expected %s as\n%s\ngot\n%s", format, expected, result)
+		}
+	}
+
+	asql, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	asql.tabular = true
+
+	if _, ok := asql.formatCommand("\\format CSV"); !ok || asql.outputFormat != FORMAT_CSV {
+		t.Fatalf("expected the csv format, got %s", asql.outputFormat)
+	}
+
+	if message, _ := asql.formatCommand("\\format xml"); !strings.HasPrefix(string(message), "unknown format xml") || asql.outputFormat != FORMAT_CSV {
+		t.Fatalf("expected xml to be refused, got %s", message)
+	}
+
+	// json on and json off typed by the user set the json and table formats
+	if _, ok := asql.formatCommand("JSON ON;"); !ok || asql.outputFormat != FORMAT_JSON {
+		t.Fatal("expected json on to set the json format")
+	}
+
+	if _, ok := asql.formatCommand("SELECT 1;"); ok {
+		t.Fatal("expected a statement not to be handled by the CLI")
+	}
+
+	// A server which does not send JSON is printed as is
+	asql.tabular = false
+
+	if string(asql.format([]byte("OK\n"))) != "OK\n" {
+		t.Fatal("expected the response as sent")
+	}
+}
+
+func TestCompleter(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		buf := make([]byte, 1024)
+		for {
+			n, err := conn.Read(buf)
+			if err != nil {
+				return
+			}
+
+			switch string(buf[:n]) {
+			case "SHOW DATABASES;":
+				conn.Write([]byte(`[{"Database":"shop"},{"Database":"staging"}]` + "\n"))
+			case "DESCRIBE;":
+				conn.Write([]byte(`[{"Table":"orders","Columns":[{"Name":"order_id"},{"Name":"user_id"}]},{"Table":"users","Columns":[{"Name":"user_id"},{"Name":"name"}]}]` + "\n"))
+			default:
+				conn.Write([]byte("ERR: unexpected statement\n"))
+			}
+		}
+	}()
+
+	asql, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	asql.bufferSize = 1024
+	asql.tabular = true
+	asql.conn, err = net.DialTCP("tcp", nil, listener.Addr().(*net.TCPAddr))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer asql.close()
+
+	c := newCompleter(asql)
+
+	complete := func(line string) []string {
+		completions, _ := c.Do([]rune(line), len([]rune(line)))
+
+		var candidates []string
+		for _, completion := range completions {
+			candidates = append(candidates, string(completion))
+		}
+
+		return candidates
+	}
+
+	for line, expected := range map[string][]string{
+		"sel":                         {"ect "},
+		"SEL":                         {"ECT "},
+		"SELECT * FROM u":             {"sers "},
+		"SELECT * FROM ":              {"orders ", "users "},
+		"USE s":                       {"hop ", "taging "},
+		"SELECT na":                   {"me "},
+		"SELECT * FROM users WHERE u": {"ser_id ", "nion ", "nique ", "nlisten ", "npivot ", "pdate ", "pper ", "se ", "ser ", "uid ", "uid_v7 "},
+		"SELECT users.":               {"user_id ", "name "},
+		"SELECT orders.o":             {"rder_id "},
+	} {
+		if candidates := complete(line); strings.Join(candidates, "|") != strings.Join(expected, "|") {
+			t.Fatalf("expected %q for %q, got %q", expected, line, candidates)
+		}
+	}
+
+	// The catalog is read once until a statement changes it
+	if !c.loaded {
+		t.Fatal("expected the catalog to be read")
+	}
+
+	c.invalidate("SELECT * FROM users;")
+	if !c.loaded {
+		t.Fatal("expected a select to keep the catalog read")
+	}
+
+	c.invalidate("use staging;")
+	if c.loaded {
+		t.Fatal("expected use to read the catalog again")
+	}
+}
+
+func TestStatement(t *testing.T) {
+	for stmt, expected := range map[string]bool{
+		"SELECT 1;":                            true,
+		"SELECT 1; ":                           true,
+		"SELECT 1":                             false,
+		"SELECT * FROM users\nWHERE id = 1;":   true,
+		"INSERT INTO t VALUES ('a;":            false,
+		"INSERT INTO t VALUES ('a;\nb');":      true,
+		"INSERT INTO t VALUES ('o\\'brien;');": true,
+		"INSERT INTO t VALUES ('it''s;":        false,
+		"SELECT \"a;\" FROM t":                 false,
+	} {
+		if terminated(stmt) != expected {
+			t.Fatalf("expected %v for %q", expected, stmt)
+		}
+	}
+
+	s := &statement{}
+	if s.prompt("ariasql>") != "ariasql>" {
+		t.Fatalf("expected ariasql>, got %s", s.prompt("ariasql>"))
+	}
+
+	// Lines are kept as typed, a string can span them
+	s.add("INSERT INTO notes (body) VALUES ('first")
+	if s.terminated() || s.prompt("ariasql>") != "    ...>" {
+		t.Fatalf("expected the continuation prompt, got %s", s.prompt("ariasql>"))
+	}
+
+	s.add("  second');")
+	if !s.terminated() || s.String() != "INSERT INTO notes (body) VALUES ('first\n  second');" {
+		t.Fatalf("expected the statement terminated, got %q", s.String())
+	}
+
+	s.reset()
+	if !s.empty() {
+		t.Fatal("expected the statement reset")
+	}
+
+	// The editor is given the statement and returns it edited
+	t.Setenv("VISUAL", "")
+	t.Setenv("EDITOR", "sed -i s/users/accounts/")
+
+	edited, err := edit("SELECT *\nFROM users;")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if edited != "SELECT *\nFROM accounts;" {
+		t.Fatalf("expected the statement edited, got %q", edited)
+	}
+
+	// A statement spanning lines is saved to the history on one, Ctrl+R finds it whole
+	if entry := historyEntry("SELECT *\n  FROM users\tWHERE id = 1;"); entry != "SELECT * FROM users WHERE id = 1;" {
+		t.Fatalf("expected the statement on a single line, got %q", entry)
+	}
+}
+
+func TestPager(t *testing.T) {
+	var output bytes.Buffer
+	for i := 1; i <= 100; i++ {
+		fmt.Fprintf(&output, "row %d\n", i)
+	}
+
+	// 10 lines shown above the status line
+	p := newPager(output.Bytes(), 40, 11)
+
+	for _, step := range []struct {
+		keys string
+		top  int
+	}{
+		{" ", 10},
+		{"\x1b[B", 11},
+		{"k", 10},
+		{"b", 0},
+		{"b", 0},
+		{"G", 90},
+		{" ", 90},
+		{"g", 0},
+		{"/ROW 42\r", 41},
+		{"/row 4\rn", 43},
+		{"/row 99\r", 90},
+		{"/missing\r", 90},
+	} {
+		out := &bytes.Buffer{}
+
+		err := p.run(bufio.NewReader(strings.NewReader(step.keys+"q")), out)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if p.top != step.top {
+			t.Fatalf("expected line %d on top after %q, got %d", step.top, step.keys, p.top)
+		}
+	}
+
+	if p.status != "Pattern not found" {
+		t.Fatalf("expected the search to fail, got %q", p.status)
+	}
+
+	// Matches are highlighted, wide lines scroll sideways
+	p.search, p.left = "row", 1
+	if line := p.highlight(p.visible("a row")); line != " \033[7mrow\033[0m" {
+		t.Fatalf("unexpected line %q", line)
+	}
+}
+
+func TestLineEditor(t *testing.T) {
+	e := &lineEditor{}
+
+	for _, step := range []struct {
+		keys   []string
+		text   string
+		cursor int
+	}{
+		{[]string{"s", "e", "l", "e", "c", "t", " ", "a", "b", "c", ".", "d", "e", "f"}, "select abc.def", 14},
+		{[]string{"alt-b"}, "select abc.def", 11},
+		{[]string{"alt-b", "alt-b"}, "select abc.def", 0},
+		{[]string{"alt-f"}, "select abc.def", 6},
+		{[]string{"\x05", "\x02", "\x01", "right"}, "select abc.def", 1},
+		{[]string{"\x05", "\x17"}, "select ", 7},
+		{[]string{"\x19"}, "select abc.def", 14},
+		{[]string{"alt-\x7f"}, "select abc.", 11},
+		{[]string{"\x01", "alt-d"}, " abc.", 0},
+		{[]string{"\x0b"}, "", 0},
+		{[]string{"\x19"}, "select abc.", 11},
+		{[]string{"alt-y"}, "def", 3},
+		{[]string{"alt-y"}, "abc.def", 7},
+		{[]string{"left", "left", "\x15"}, "ef", 0},
+		{[]string{"x", "alt-y"}, "xef", 1},
+		{[]string{"\x19", "\x04", "\x7f"}, "xabc.f", 5},
+		{[]string{"\x01", "\x17"}, "xabc.f", 0},
+	} {
+		for _, key := range step.keys {
+			e.handle(key)
+		}
+
+		if string(e.text) != step.text || e.cursor != step.cursor {
+			t.Fatalf("expected %q with the cursor at %d after %q, got %q at %d", step.text, step.cursor, step.keys, string(e.text), e.cursor)
+		}
+	}
+
+	if e.render() != "xabc.f\033[6D" {
+		t.Fatalf("unexpected line %q", e.render())
+	}
+
+	// Keys read from a terminal, Alt is sent as escape before the key
+	p := newPager([]byte("row 1\nrow 2\n"), 40, 11)
+
+	text, err := p.prompt(bufio.NewReader(strings.NewReader("rw 2\x1bb\x1bb\x1b[Co\r")), &bytes.Buffer{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if text != "row 2" {
+		t.Fatalf("expected row 2, got %q", text)
+	}
+}
+
+// chunkReader returns its chunks one read at a time
+type chunkReader struct {
+	chunks []string
+}
+
+func (c *chunkReader) Read(p []byte) (int, error) {
+	if len(c.chunks) == 0 {
+		return 0, io.EOF
+	}
+
+	n := copy(p, c.chunks[0])
+	c.chunks = c.chunks[1:]
+
+	return n, nil
+}
+
+func (c *chunkReader) Close() error {
+	return nil
+}
+
+func TestAltKeyReader(t *testing.T) {
+	// Escape y is read as Alt+Y even with the escape read apart, other escape sequences are left as they are
+	r := newAltKeyReader(&chunkReader{chunks: []string{"ab\x1by", "\x1b", "y\x1b[D\x1bb", "\x1b\x1by", "\x1b"}})
+
+	b, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(b) != "ab\u0080\u0080\x1b[D\x1bb\x1b\u0080\x1b" {
+		t.Fatalf("unexpected keys %q", b)
+	}
+
+	// Escape pressed alone is returned once no key follows it within ESCAPE_TIMEOUT
+	keys, terminal := io.Pipe()
+	r = newAltKeyReader(keys)
+	defer r.Close()
+
+	go terminal.Write([]byte{0x1b})
+
+	p := make([]byte, 8)
+
+	n, err := r.Read(p)
+	if err != nil || string(p[:n]) != "\x1b" {
+		t.Fatalf("expected escape, got %q %v", p[:n], err)
+	}
+
+	// The key following it later is read on its own
+	go terminal.Write([]byte("y"))
+
+	n, err = r.Read(p)
+	if err != nil || string(p[:n]) != "y" {
+		t.Fatalf("expected y, got %q %v", p[:n], err)
+	}
+}
+
+func TestKillRing(t *testing.T) {
+	k := &killRing{}
+	line, pos := []rune{}, 0
+
+	// press hands a key to the ring as readline does, other keys are inserted at the cursor
+	press := func(key rune) {
+		key, _ = k.filter(key)
+		if key != readline.CharBell {
+			line = append(line[:pos:pos], append([]rune{key}, line[pos:]...)...)
+			pos++
+		}
+
+		if newLine, newPos, ok := k.OnChange(line, pos, key); ok {
+			line, pos = newLine, newPos
+		}
+	}
+
+	for _, step := range []struct {
+		keys   string
+		text   string
+		cursor int
+	}{
+		{keys: "select one two", text: "select one two", cursor: 14},
+		{keys: "\x17\x17", text: "select ", cursor: 7},
+		{keys: "\x19", text: "select one two", cursor: 14},
+		{keys: "\x15", text: "", cursor: 0},
+		{keys: "x \x19", text: "x select one two", cursor: 16},
+		{keys: string(ALT_Y), text: "x one two", cursor: 9},
+		{keys: string(ALT_Y), text: "x select one two", cursor: 16},
+	} {
+		for _, key := range step.keys {
+			press(key)
+		}
+
+		if string(line) != step.text || pos != step.cursor {
+			t.Fatalf("expected %q with the cursor at %d after %q, got %q at %d", step.text, step.cursor, step.keys, string(line), pos)
+		}
+	}
+}
+
+func TestMetaCommand(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		buf := make([]byte, 1024)
+		for {
+			n, err := conn.Read(buf)
+			if err != nil {
+				return
+			}
+
+			switch string(buf[:n]) {
+			case "SHOW DATABASES;":
+				conn.Write([]byte(`[{"Database":"shop"},{"Database":"staging"}]` + "\n"))
+			case "SHOW TABLES;":
+				conn.Write([]byte(`[{"Table":"order_items"},{"Table":"orders"},{"Table":"users"}]` + "\n"))
+			case "SHOW GRANTS;":
+				conn.Write([]byte(`[{"Grants":"ALL","User":"admin"},{"Grants":"SELECT","User":"reader"}]` + "\n"))
+			case "DESCRIBE orders;":
+				conn.Write([]byte(`[{"Table":"orders","Columns":[` +
+					`{"Name":"order_id","Type":"INT","Nullable":false,"Default":null,"PrimaryKey":true,"Unique":false,"Check":false,"References":null},` +
+					`{"Name":"status","Type":"CHAR(16)","Nullable":true,"Default":"'new'","PrimaryKey":false,"Unique":false,"Check":true,"References":null},` +
+					`{"Name":"user_id","Type":"INT","Nullable":true,"Default":null,"PrimaryKey":false,"Unique":false,"Check":false,"References":{"Table":"users","Column":"user_id"}}],` +
+					`"Indexes":[{"Name":"orders_user_id","Columns":["user_id"],"Unique":false,"Visible":false}],` +
+					`"ForeignKeys":[{"Name":"orders_user_id_fkey","Column":"user_id","ReferencedTable":"users","ReferencedColumn":"user_id","Valid":true}]}]` + "\n"))
+			case "DESCRIBE order_items, orders;":
+				conn.Write([]byte(`[{"Table":"order_items","Columns":[]},{"Table":"orders","Columns":[]}]` + "\n"))
+			default:
+				conn.Write([]byte("ERR: table does not exist\n"))
+			}
+		}
+	}()
+
+	asql, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	asql.bufferSize = 1024
+	asql.tabular = true
+	asql.outputFormat = FORMAT_CSV
+	asql.conn, err = net.DialTCP("tcp", nil, listener.Addr().(*net.TCPAddr))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer asql.close()
+
+	for line, expected := range map[string]string{
+		"\\l":         "Database\nshop\nstaging\n",
+		"\\dt order*": "Table\norder_items\norders\n",
+		"\\d":         "Table\norder_items\norders\nusers\n",
+		"\\du reader": "Grants,User\nSELECT,reader\n",
+		"\\d orders": "Table \"orders\"\n" +
+			"Column,Type,Nullable,Default,Constraints\n" +
+			"order_id,INT,NO,,PRIMARY KEY\n" +
+			"status,CHAR(16),YES,'new',CHECK\n" +
+			"user_id,INT,YES,,REFERENCES users(user_id)\n" +
+			"Indexes:\n" +
+			"    orders_user_id (user_id) INVISIBLE\n" +
+			"Foreign keys:\n" +
+			"    orders_user_id_fkey (user_id) REFERENCES users(user_id)\n",
+		"\\d order*":  "Table \"order_items\"\n\nTable \"orders\"\n",
+		"\\d missing": "ERR: table does not exist\n",
+	} {
+		response, ok := asql.metaCommand(line)
+		if !ok {
+			t.Fatalf("expected %q to be a meta command", line)
+		}
+
+		if string(response) != expected {
+			t.Fatalf("expected %q for %q, got %q", expected, line, response)
+		}
+	}
+
+	for _, line := range []string{"SELECT 1;", "\\copy users to users.csv", "\\format csv"} {
+		if _, ok := asql.metaCommand(line); ok {
+			t.Fatalf("expected %q not to be a meta command", line)
+		}
+	}
+
+	if response, _ := asql.metaCommand("\\?"); !strings.Contains(string(response), "\\d [pattern]") {
+		t.Fatalf("expected \\? to list \\d, got %q", response)
+	}
+}
+
+func TestDump(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		buf := make([]byte, 1024)
+		for {
+			n, err := conn.Read(buf)
+			if err != nil {
+				return
+			}
+
+			switch string(buf[:n]) {
+			case "json on":
+				conn.Write([]byte(`{"status":"OK"}` + "\n"))
+			case "USE shop;":
+				conn.Write([]byte("OK\n"))
+			case "DESCRIBE;":
+				conn.Write([]byte(`[{"Table":"orders","Columns":[` +
+					`{"Name":"order_id","Type":"INT","DataType":"INT","Nullable":false,"Default":null,"Unique":false,"Sequence":true,"Check":false,"References":null},` +
+					`{"Name":"status","Type":"CHAR(16)","DataType":"CHAR","Nullable":true,"Default":"'new'","Unique":false,"Sequence":false,"Check":true,"References":null},` +
+					`{"Name":"user_id","Type":"INT","DataType":"INT","Nullable":true,"Default":null,"Unique":false,"Sequence":false,"Check":false,"References":{"Table":"users","Column":"user_id"}}],` +
+					`"Indexes":[{"Name":"fk_user_id","Columns":["user_id"],"Unique":false},{"Name":"orders_status","Columns":["status"],"Unique":false}],"Compressed":true},` +
+					`{"Table":"users","Columns":[` +
+					`{"Name":"email","Type":"CHAR(255)","DataType":"CHAR","Nullable":false,"Default":null,"Unique":true,"Sequence":false,"Check":false,"References":null},` +
+					`{"Name":"user_id","Type":"INT","DataType":"INT","Nullable":false,"Default":null,"Unique":false,"Sequence":true,"Check":false,"References":null}],` +
+					`"Indexes":[{"Name":"unique_email","Columns":["email"],"Unique":true}]}]` + "\n"))
+			case "SELECT * FROM orders;":
+				conn.Write([]byte(`[{"order_id":1,"status":"it's new","user_id":12345678901234567},{"order_id":2,"status":null,"user_id":1}]` + "\n"))
+			case "SELECT * FROM users;":
+				conn.Write([]byte(`[{"email":"alex@example.com","user_id":1}]` + "\n"))
+			default:
+				conn.Write([]byte("ERR: table does not exist\n"))
+			}
+		}
+	}()
+
+	asql, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	asql.bufferSize = 1024
+	asql.conn, err = net.DialTCP("tcp", nil, listener.Addr().(*net.TCPAddr))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer asql.close()
+
+	var out bytes.Buffer
+
+	err = asql.dumpDatabase("shop", nil, &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "-- AriaSQL " + shared.VERSION + " dump of database shop\n\n" +
+		"CREATE DATABASE shop;\n" +
+		"USE shop;\n\n" +
+		"CREATE TABLE users (email CHAR(255) NOT NULL UNIQUE, user_id INT NOT NULL SEQUENCE);\n" +
+		"INSERT INTO users (email) VALUES ('alex@example.com');\n\n" +
+		"CREATE TABLE orders (order_id INT NOT NULL SEQUENCE, status CHAR(16) DEFAULT 'new', user_id INT, FOREIGN KEY (user_id) REFERENCES users(user_id));\n" +
+		"-- orders.status has a check constraint, it is not dumped\n" +
+		"ALTER TABLE orders COMPRESS;\n" +
+		"CREATE INDEX orders_status ON orders (status);\n" +
+		"INSERT INTO orders (status, user_id) VALUES ('it\\'s new', 12345678901234567), (NULL, 1);\n"
+
+	if out.String() != expected {
+		t.Fatalf("expected %q, got %q", expected, out.String())
+	}
+
+	err = asql.dumpDatabase("missing", []string{"orders"}, &out)
+	if err == nil {
+		t.Fatal("expected an error dumping a missing database")
+	}
+}
+
+func TestReconnect(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	received := make(chan []string, 8)
+
+	go func() {
+		for connections := 1; ; connections++ {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+
+			go func(conn net.Conn, connection int) {
+				defer conn.Close()
+
+				stmts := make([]string, 0)
+				defer func() { received <- stmts }()
+
+				buf := make([]byte, 1024)
+
+				// The fourth connection and those after it are refused
+				if _, err := conn.Read(buf); err != nil || connection > 3 {
+					conn.Write([]byte("ERR: invalid credentials\n"))
+					return
+				}
+
+				conn.Write([]byte("OK\nVERSION:ALPHA\n"))
+
+				for {
+					n, err := conn.Read(buf)
+					if err != nil {
+						return
+					}
+
+					stmt := string(buf[:n])
+					stmts = append(stmts, stmt)
+
+					switch {
+					case stmt == "pipeline on":
+						conn.Write([]byte("ERR: pipelining is not supported\n"))
+					case stmt == "SELECT 'drop';", stmt == "SELECT 'lost';" && connection == 1:
+						// The connection is lost before the response
+						return
+					default:
+						conn.Write([]byte(`{"status":"OK"}` + "\n"))
+					}
+				}
+			}(conn, connections)
+		}
+	}()
+
+	asql, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	asql.backoff = time.Millisecond
+
+	err = asql.connect(&dsn.DSN{Username: "admin", Password: "admin", Host: "127.0.0.1", Port: listener.Addr().(*net.TCPAddr).Port, TLS: dsn.TLS_DISABLE}, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer asql.close()
+
+	err = asql.tabulate()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = asql.execute("USE shop;"); err != nil {
+		t.Fatal(err)
+	}
+
+	// The statement is sent again on a new connection with the session restored
+	out := &bytes.Buffer{}
+
+	response, err := asql.send("SELECT 'lost';", out)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.TrimSpace(string(response)) != `{"status":"OK"}` || !strings.Contains(out.String(), "attempt 1 of 3") {
+		t.Fatalf("unexpected response %q, output %q", response, out.String())
+	}
+
+	if stmts := <-received; strings.Join(stmts, "|") != "pipeline on|json on|USE shop;|SELECT 'lost';" {
+		t.Fatalf("unexpected statements on the lost connection %q", stmts)
+	}
+
+	if !asql.tabular || asql.database != "shop" {
+		t.Fatalf("expected the session restored, tabular %v, database %q", asql.tabular, asql.database)
+	}
+
+	// Within a transaction the statement is not sent again, the server rolled the transaction back
+	if _, err = asql.execute("BEGIN;"); err != nil || !asql.transaction {
+		t.Fatalf("expected a transaction begun, got %v", err)
+	}
+
+	_, err = asql.send("SELECT 'drop';", out)
+	if err == nil || !strings.Contains(err.Error(), "rolled back") || !asql.authenticated || asql.transaction {
+		t.Fatalf("expected reconnected with the transaction rolled back, got %v", err)
+	}
+
+	if stmts := <-received; strings.Join(stmts, "|") != "pipeline on|USE shop;|json on|SELECT 'lost';|BEGIN;|SELECT 'drop';" {
+		t.Fatalf("unexpected statements on the restored connection %q", stmts)
+	}
+
+	// Refused credentials are not attempted again
+	out.Reset()
+
+	_, err = asql.send("SELECT 'drop';", out)
+	if err == nil || !strings.HasPrefix(err.Error(), "unable to reconnect") || asql.authenticated {
+		t.Fatalf("expected the connection refused, got %v", err)
+	}
+
+	if !strings.Contains(out.String(), "attempt 1 of 3") || strings.Contains(out.String(), "attempt 2 of 3") {
+		t.Fatalf("expected a single attempt against refused credentials, got %q", out.String())
+	}
+
+	// Without retries the connection is not attempted again
+	asql.retries = 0
+
+	if err = asql.reconnect(out); err == nil {
+		t.Fatal("expected reconnecting disabled")
+	}
+}
+
+func TestConnectionFlags(t *testing.T) {
+	t.Setenv(PASSWORD_ENV, "admin")
+
+	parse := func(args ...string) (*dsn.DSN, error) {
+		flags := flag.NewFlagSet("shell", flag.ContinueOnError)
+		connection := newConnectionFlags(flags)
+
+		if err := flags.Parse(args); err != nil {
+			return nil, err
+		}
+
+		return connection.dsn()
+	}
+
+	d, err := parse("-u", "admin")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if d.TLS != dsn.TLS_DISABLE {
+		t.Fatalf("expected TLS disabled, got %s", d.TLS)
+	}
+
+	// A TLS flag implies TLS verifying the server
+	d, err = parse("-u", "admin", "-tls-servername", "db.internal")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if d.TLS != dsn.TLS_VERIFY_FULL || d.TLSServerName != "db.internal" {
+		t.Fatalf("expected verify-full against db.internal, got %s %s", d.TLS, d.TLSServerName)
+	}
+
+	// Flags override the options of a connection string
+	d, err = parse("-dsn", "ariasql://admin@localhost?tls_servername=db.example.com", "-tls-servername", "db.internal", "-tls-skip-verify")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if d.TLS != dsn.TLS_REQUIRE || d.TLSServerName != "db.internal" {
+		t.Fatalf("expected require against db.internal, got %s %s", d.TLS, d.TLSServerName)
+	}
+
+	// Certificates are read before connecting
+	for _, args := range [][]string{
+		{"-u", "admin", "-tls-ca", filepath.Join(t.TempDir(), "missing.pem")},
+		{"-u", "admin", "-tls-cert", "client.pem"},
+	} {
+		if _, err = parse(args...); err == nil || !strings.HasPrefix(err.Error(), "invalid TLS configuration") {
+			t.Fatalf("expected an invalid TLS configuration for %q, got %v", args, err)
+		}
+	}
+}
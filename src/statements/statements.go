@@ -0,0 +1,177 @@
+// Package statements
+// AriaSQL statement statistics package
+// Copyright (C) AriaSQL
+// Author(s): Alex Gaetano Padula
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+package statements
+
+import (
+	"ariasql/parser"
+	"crypto/sha256"
+	"encoding/hex"
+	"sort"
+	"sync"
+	"time"
+)
+
+const DEFAULT_MAX_STATEMENTS = 5000 // Statements kept if not configured, the least called is evicted for a new one
+const MAX_QUERY_LENGTH = 2048       // Normalized queries are truncated to this many bytes
+
+// Stat is the aggregated executions of a normalized statement by a user within a database
+type Stat struct {
+	Digest   string        // Digest of the normalized statement
+	Query    string        // Normalized statement, literals replaced by ?
+	Database string        // Database the statement was executed in, empty if none was selected
+	User     string        // User the statement was executed by
+	Calls    int64         // Amount of executions
+	Errors   int64         // Amount of executions which failed
+	Rows     int64         // Rows returned or changed
+	Total    time.Duration // Time spent executing
+	Min      time.Duration // Fastest execution
+	Max      time.Duration // Slowest execution
+}
+
+// Mean returns the mean execution time
+func (s *Stat) Mean() time.Duration {
+	if s.Calls == 0 {
+		return 0
+	}
+
+	return s.Total / time.Duration(s.Calls)
+}
+
+// key identifies the stat of a statement
+type key struct {
+	digest, database, user string
+}
+
+// Statements aggregates the executions of statements by their digest
+type Statements struct {
+	stats map[key]*Stat // Stats by digest, database and user
+	max   int           // Max amount of stats kept
+	lock  *sync.Mutex   // Stats lock
+}
+
+// New returns new statement statistics keeping up to max statements, 0 is DEFAULT_MAX_STATEMENTS
+func New(max int) *Statements {
+	if max <= 0 {
+		max = DEFAULT_MAX_STATEMENTS
+	}
+
+	return &Statements{stats: make(map[key]*Stat), max: max, lock: &sync.Mutex{}}
+}
+
+// Digest returns the digest of a normalized statement
+func Digest(normalized string) string {
+	sum := sha256.Sum256([]byte(normalized))
+	return hex.EncodeToString(sum[:8])
+}
+
+// Record records an execution of query which took d and returned or changed rows, a nil Statements records nothing
+func (s *Statements) Record(query []byte, database, user string, d time.Duration, rows int, err error) {
+	if s == nil {
+		return
+	}
+
+	normalized := parser.Normalize(query)
+	k := key{digest: Digest(normalized), database: database, user: user}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	stat, ok := s.stats[k]
+	if !ok {
+		if len(s.stats) >= s.max {
+			s.evict()
+		}
+
+		if len(normalized) > MAX_QUERY_LENGTH {
+			normalized = normalized[:MAX_QUERY_LENGTH]
+		}
+
+		stat = &Stat{Digest: k.digest, Query: normalized, Database: database, User: user, Min: d}
+		s.stats[k] = stat
+	}
+
+	stat.Calls++
+	stat.Rows += int64(rows)
+	stat.Total += d
+
+	if err != nil {
+		stat.Errors++
+	}
+
+	if d < stat.Min {
+		stat.Min = d
+	}
+
+	if d > stat.Max {
+		stat.Max = d
+	}
+}
+
+// evict removes the least called statement
+func (s *Statements) evict() {
+	var least *key
+	var calls int64
+
+	for k, stat := range s.stats {
+		if least == nil || stat.Calls < calls {
+			k := k
+			least = &k
+			calls = stat.Calls
+		}
+	}
+
+	if least != nil {
+		delete(s.stats, *least)
+	}
+}
+
+// Stats returns a copy of the stats of every statement, by total execution time descending
+func (s *Statements) Stats() []Stat {
+	if s == nil {
+		return nil
+	}
+
+	s.lock.Lock()
+	stats := make([]Stat, 0, len(s.stats))
+	for _, stat := range s.stats {
+		stats = append(stats, *stat)
+	}
+	s.lock.Unlock()
+
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].Total != stats[j].Total {
+			return stats[i].Total > stats[j].Total
+		}
+
+		return stats[i].Digest < stats[j].Digest
+	})
+
+	return stats
+}
+
+// Reset removes the stats of every statement
+func (s *Statements) Reset() {
+	if s == nil {
+		return
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.stats = make(map[key]*Stat)
+}
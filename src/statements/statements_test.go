@@ -0,0 +1,90 @@
+// Package statements tests
+// Copyright (C) AriaSQL
+// Author(s): Alex Gaetano Padula
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+package statements
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestStatements_Record(t *testing.T) {
+	s := New(0)
+
+	s.Record([]byte("SELECT * FROM users WHERE user_id = 1;"), "test", "admin", 2*time.Millisecond, 1, nil)
+	s.Record([]byte("select * from users where user_id = 2;"), "test", "admin", 4*time.Millisecond, 0, nil)
+	s.Record([]byte("SELECT * FROM users WHERE user_id = 'x';"), "test", "admin", time.Millisecond, 0, errors.New("type mismatch"))
+
+	// Other databases and users are aggregated apart
+	s.Record([]byte("SELECT * FROM users WHERE user_id = 1;"), "shop", "admin", time.Millisecond, 1, nil)
+	s.Record([]byte("SELECT * FROM users WHERE user_id = 1;"), "test", "alex", time.Millisecond, 1, nil)
+
+	stats := s.Stats()
+	if len(stats) != 3 {
+		t.Fatalf("expected 3 statements, got %d", len(stats))
+	}
+
+	stat := stats[0]
+	if stat.Query != "SELECT * FROM users WHERE user_id = ?" || stat.Database != "test" || stat.User != "admin" {
+		t.Fatalf("unexpected statement %+v", stat)
+	}
+
+	if stat.Calls != 3 || stat.Errors != 1 || stat.Rows != 1 {
+		t.Fatalf("expected 3 calls, 1 error and 1 row, got %+v", stat)
+	}
+
+	if stat.Total != 7*time.Millisecond || stat.Min != time.Millisecond || stat.Max != 4*time.Millisecond || stat.Mean() != 7*time.Millisecond/3 {
+		t.Fatalf("unexpected timings %+v", stat)
+	}
+
+	if stat.Digest != Digest(stat.Query) || stats[1].Digest != stat.Digest {
+		t.Fatal("expected the same digest for the same normalized statement")
+	}
+
+	s.Reset()
+
+	if len(s.Stats()) != 0 {
+		t.Fatal("expected no statements after reset")
+	}
+
+	// A nil Statements records nothing
+	var none *Statements
+	none.Record([]byte("SELECT 1;"), "", "admin", time.Millisecond, 1, nil)
+	if none.Stats() != nil {
+		t.Fatal("expected no statements")
+	}
+}
+
+func TestStatements_Evict(t *testing.T) {
+	s := New(2)
+
+	s.Record([]byte("SELECT * FROM a;"), "test", "admin", time.Millisecond, 0, nil)
+	s.Record([]byte("SELECT * FROM a;"), "test", "admin", time.Millisecond, 0, nil)
+	s.Record([]byte("SELECT * FROM b;"), "test", "admin", time.Millisecond, 0, nil)
+	s.Record([]byte("SELECT * FROM c;"), "test", "admin", time.Millisecond, 0, nil)
+
+	stats := s.Stats()
+	if len(stats) != 2 || stats[0].Query != "SELECT * FROM a" || stats[1].Query != "SELECT * FROM c" {
+		t.Fatalf("expected the least called statement evicted, got %+v", stats)
+	}
+}
+
+func TestDigest(t *testing.T) {
+	if len(Digest("SELECT ?")) != 16 || Digest("SELECT ?") == Digest("SELECT ? FROM users") {
+		t.Fatal("expected distinct 16 character digests")
+	}
+}
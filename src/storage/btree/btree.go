@@ -69,6 +69,11 @@ func (b *BTree) Close() error {
 	return b.Pager.Close()
 }
 
+// Idle closes the descriptors of the btree files not in use, they are opened again on next use
+func (b *BTree) Idle() {
+	b.Pager.Idle()
+}
+
 // encodeNode encodes a node into a byte slice
 func encodeNode(n *Node) ([]byte, error) {
 	// Create a new msgpack handle
@@ -598,11 +603,8 @@ func (b *BTree) remove(x *Node, key, value []byte) error {
 			}
 		}
 
-		// if the key has no values, remove the key
-		if len(x.Keys[i].V) == 0 {
-			// @TODO: remove the key from the node
-			return nil
-		}
+		// if the key has no values, the key is kept with an empty value list
+		// @TODO: remove the key from the node
 
 		// encode the node
 		encodedNode, err := encodeNode(x)
@@ -26,6 +26,7 @@ import (
 func TestOpen(t *testing.T) {
 	defer os.Remove("btree.db")
 	defer os.Remove("btree.db.del")
+	defer os.Remove("btree.db.dirty")
 
 	btree, err := Open("btree.db", os.O_CREATE|os.O_RDWR, 0644, 3)
 	if err != nil {
@@ -51,6 +52,7 @@ func TestOpen(t *testing.T) {
 func TestBTree_Close(t *testing.T) {
 	defer os.Remove("btree.db")
 	defer os.Remove("btree.db.del")
+	defer os.Remove("btree.db.dirty")
 
 	btree, err := Open("btree.db", os.O_CREATE|os.O_RDWR, 0644, 3)
 	if err != nil {
@@ -67,6 +69,7 @@ func TestBTree_Close(t *testing.T) {
 func TestBTree_Put(t *testing.T) {
 	defer os.Remove("btree.db")
 	defer os.Remove("btree.db.del")
+	defer os.Remove("btree.db.dirty")
 
 	btree, err := Open("btree.db", os.O_CREATE|os.O_RDWR, 0644, 3)
 	if err != nil {
@@ -101,6 +104,7 @@ func TestBTree_Put(t *testing.T) {
 func TestBTree_Delete(t *testing.T) {
 	defer os.Remove("btree.db")
 	defer os.Remove("btree.db.del")
+	defer os.Remove("btree.db.dirty")
 
 	btree, err := Open("btree.db", os.O_CREATE|os.O_RDWR, 0644, 3)
 	if err != nil {
@@ -135,6 +139,7 @@ func TestBTree_Delete(t *testing.T) {
 func TestBTree_Range(t *testing.T) {
 	defer os.Remove("btree.db")
 	defer os.Remove("btree.db.del")
+	defer os.Remove("btree.db.dirty")
 
 	btree, err := Open("btree.db", os.O_CREATE|os.O_RDWR, 0644, 3)
 	if err != nil {
@@ -165,6 +170,7 @@ func TestBTree_Range(t *testing.T) {
 func TestBTree_InOrderTraversal(t *testing.T) {
 	defer os.Remove("btree.db")
 	defer os.Remove("btree.db.del")
+	defer os.Remove("btree.db.dirty")
 
 	btree, err := Open("btree.db", os.O_CREATE|os.O_RDWR, 0644, 3)
 	if err != nil {
@@ -195,6 +201,7 @@ func TestBTree_InOrderTraversal(t *testing.T) {
 func TestBTree_Remove(t *testing.T) {
 	defer os.Remove("btree.db")
 	defer os.Remove("btree.db.del")
+	defer os.Remove("btree.db.dirty")
 
 	btree, err := Open("btree.db", os.O_CREATE|os.O_RDWR, 0644, 3)
 	if err != nil {
@@ -234,6 +241,7 @@ func TestBTree_Remove(t *testing.T) {
 func BenchmarkBTree_Put(b *testing.B) {
 	defer os.Remove("btree.db")
 	defer os.Remove("btree.db.del")
+	defer os.Remove("btree.db.dirty")
 
 	btree, err := Open("btree.db", os.O_CREATE|os.O_RDWR, 0644, 3)
 	if err != nil {
@@ -17,45 +17,76 @@
 package btree
 
 import (
+	"ariasql/storage"
+	"ariasql/wait"
 	"bytes"
+	"errors"
 	"fmt"
 	"io"
 	"os"
-	"slices"
 	"strconv"
 	"strings"
 	"sync"
 )
 
-const PAGE_SIZE = 1024  // Page size
-const HEADER_SIZE = 256 // next (overflowed)
+const PAGE_SIZE = 1024                    // Page size
+const HEADER_SIZE = 256                   // Page header, see pageHeader
+const PAGE_HEAD = 'H'                     // Header kind of a page data starts at
+const PAGE_OVERFLOW = 'O'                 // Header kind of a page holding the rest of the data of another page
+const DIRTY_PAGES_EXTENSION = ".dirty"    // Bitmap of pages written since the last backup
+const DELETED_PAGES_EXTENSION = ".del"    // Bitmap of deleted pages, writes reuse them
+const DELETED_PAGES_MAGIC = "ARIADEL\x01" // Start of a deleted pages bitmap, older files list the pages as text, i.e. 1,2,3
+
+const PRELOAD_CHUNK_SIZE = 64 * (PAGE_SIZE + HEADER_SIZE) // Bytes read at once by Preload
+
+var ErrOverflowPage = errors.New("overflow page") // An overflow page is read with the page its data starts at
+var ErrCorruptPage = errors.New("corrupt page")   // The chain of overflow pages of a page is broken
 
 // Pager manages pages in a file
 type Pager struct {
-	file             *os.File                // file to store pages
-	deletedPages     []int64                 // list of deleted pages
-	deletedPagesLock *sync.Mutex             // lock for deletedPages
-	deletedPagesFile *os.File                // file to store deleted pages
+	file             *storage.File           // file to store pages
+	deletedPages     []byte                  // bitmap of deleted pages
+	freePages        []int64                 // deleted pages writes reuse, the last deleted first, pages written since are skipped
+	deletedPagesLock *sync.Mutex             // lock for deletedPages, freePages and end
+	end              int64                   // pages past the end of the file are allocated from, reserved until written
+	deletedPagesFile *storage.File           // file to store deleted pages
 	pageLocks        map[int64]*sync.RWMutex // locks for pages
 	pageLocksLock    *sync.RWMutex           // lock for pagesLocks
 	StatLock         *sync.RWMutex           // lock for stats
+	dirtyPages       []byte                  // bitmap of pages written since the last backup
+	dirtyPagesLock   *sync.Mutex             // lock for dirtyPages
+	dirtyPagesFile   *storage.File           // file to store the dirty pages bitmap
 }
 
 // OpenPager opens a file for page management
 func OpenPager(filename string, flag int, perm os.FileMode) (*Pager, error) {
-	file, err := os.OpenFile(filename, flag, perm)
+	file, err := storage.OpenFile(filename, flag, perm)
 	if err != nil {
 		return nil, err
 	}
 
 	// open the deleted pages file
-	deletedPagesFile, err := os.OpenFile(filename+".del", os.O_CREATE|os.O_RDWR, perm)
+	deletedPagesFile, err := storage.OpenFile(filename+DELETED_PAGES_EXTENSION, os.O_CREATE|os.O_RDWR, perm)
 	if err != nil {
+		file.Close()
 		return nil, err
 	}
 
 	// read the deleted pages
-	deletedPages, err := readDelPages(deletedPagesFile)
+	deletedPages, bitmap, err := readDelPages(deletedPagesFile)
+	if err != nil {
+		return nil, err
+	}
+
+	// open the dirty pages file, incremental backups copy the pages marked in it
+	dirtyPagesFile, err := storage.OpenFile(filename+DIRTY_PAGES_EXTENSION, os.O_CREATE|os.O_RDWR, perm)
+	if err != nil {
+		file.Close()
+		deletedPagesFile.Close()
+		return nil, err
+	}
+
+	dirtyPages, err := dirtyPagesFile.ReadAll()
 	if err != nil {
 		return nil, err
 	}
@@ -72,10 +103,27 @@ func OpenPager(filename string, flag int, perm os.FileMode) (*Pager, error) {
 		pgLocks[i] = &sync.RWMutex{}
 	}
 
-	return &Pager{file: file, deletedPages: deletedPages, deletedPagesFile: deletedPagesFile, deletedPagesLock: &sync.Mutex{}, pageLocks: pgLocks, pageLocksLock: &sync.RWMutex{}, StatLock: &sync.RWMutex{}}, nil
+	p := &Pager{file: file, deletedPages: deletedPages, deletedPagesFile: deletedPagesFile, deletedPagesLock: &sync.Mutex{}, pageLocks: pgLocks, pageLocksLock: &sync.RWMutex{}, StatLock: &sync.RWMutex{}, dirtyPages: dirtyPages, dirtyPagesLock: &sync.Mutex{}, dirtyPagesFile: dirtyPagesFile}
+
+	for pageID := int64(0); pageID < int64(len(deletedPages))*8; pageID++ {
+		if p.deleted(pageID) {
+			p.freePages = append(p.freePages, pageID)
+		}
+	}
+
+	// A file listing the pages as text, or a new one, is written as a bitmap
+	if !bitmap {
+		err = p.writeDelPages()
+		if err != nil {
+			p.Close()
+			return nil, err
+		}
+	}
+
+	return p, nil
 }
 
-// writeDelPages writes the deleted pages that are in-memory to the deleted pages file
+// writeDelPages writes the deleted pages bitmap to the deleted pages file
 func (p *Pager) writeDelPages() error {
 
 	// Truncate the file
@@ -84,14 +132,8 @@ func (p *Pager) writeDelPages() error {
 		return err
 	}
 
-	// Seek to the start of the file
-	_, err = p.deletedPagesFile.Seek(0, io.SeekStart)
-	if err != nil {
-		return err
-	}
-
 	// Write the deleted pages to the file
-	_, err = p.deletedPagesFile.WriteAt([]byte(strings.Join(strings.Fields(fmt.Sprint(p.deletedPages)), ",")), 0)
+	_, err = p.deletedPagesFile.WriteAt(append([]byte(DELETED_PAGES_MAGIC), p.deletedPages...), 0)
 	if err != nil {
 		return err
 	}
@@ -99,158 +141,329 @@ func (p *Pager) writeDelPages() error {
 	return nil
 }
 
-// readDelPages reads the deleted pages from the deleted pages file
-func readDelPages(file *os.File) ([]int64, error) {
-	pages := make([]int64, 0)
-
-	// stored in comma separated format
-	// i.e. 1,2,3,4,5
-	data, err := io.ReadAll(file)
+// readDelPages reads the deleted pages bitmap from the deleted pages file
+// bitmap is false if the file is empty or lists the pages as text, as files written before the bitmap do
+func readDelPages(file *storage.File) (pages []byte, bitmap bool, err error) {
+	data, err := file.ReadAll()
 	if err != nil {
-		return nil, err
+		return nil, false, err
 	}
 
-	if len(data) == 0 {
-		return pages, nil
+	if bytes.HasPrefix(data, []byte(DELETED_PAGES_MAGIC)) {
+		return data[len(DELETED_PAGES_MAGIC):], true, nil
 	}
 
+	return deletedPagesList(data), false, nil
+}
+
+// deletedPagesList returns the bitmap of deleted pages listed as text
+// i.e. 1,2,3,4,5
+func deletedPagesList(data []byte) []byte {
+	pages := make([]byte, 0)
+
 	data = bytes.TrimLeft(data, "[")
 	data = bytes.TrimRight(data, "]")
 
-	// split the data into pages
-	pagesStr := strings.Split(string(data), ",")
-
-	for _, pageStr := range pagesStr {
-		// convert the string to int64
+	for _, pageStr := range strings.Split(string(data), ",") {
 		page, err := strconv.ParseInt(pageStr, 10, 64)
-		if err != nil {
+		if err != nil || page < 0 {
 			continue
 		}
 
-		pages = append(pages, page)
+		if page/8 >= int64(len(pages)) {
+			pages = append(pages, make([]byte, page/8-int64(len(pages))+1)...)
+		}
 
+		pages[page/8] |= 1 << (page % 8)
 	}
 
-	return pages, nil
+	return pages
 }
 
-// splitDataIntoChunks splits data into chunks of PAGE_SIZE
-func splitDataIntoChunks(data []byte) [][]byte {
-	var chunks [][]byte
-	for i := 0; i < len(data); i += PAGE_SIZE {
-		end := i + PAGE_SIZE
+// MigrateDeletedPages writes the deleted pages file of a pager file listing the pages as text as a bitmap
+// Files already holding a bitmap are left as is
+func MigrateDeletedPages(filename string) error {
+	data, err := os.ReadFile(filename + DELETED_PAGES_EXTENSION)
+	if err != nil {
+		return err
+	}
+
+	if bytes.HasPrefix(data, []byte(DELETED_PAGES_MAGIC)) {
+		return nil
+	}
+
+	tmp := filename + DELETED_PAGES_EXTENSION + ".tmp"
+
+	err = os.WriteFile(tmp, append([]byte(DELETED_PAGES_MAGIC), deletedPagesList(data)...), 0644)
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, filename+DELETED_PAGES_EXTENSION)
+}
+
+// deleted returns true if a page is set within the deleted pages bitmap, the caller holds deletedPagesLock
+func (p *Pager) deleted(pageID int64) bool {
+	i := pageID / 8
+
+	return pageID >= 0 && i < int64(len(p.deletedPages)) && p.deletedPages[i]&(1<<(pageID%8)) != 0
+}
+
+// setDeleted sets or clears a page within the deleted pages bitmap and writes the byte holding it, the caller holds deletedPagesLock
+func (p *Pager) setDeleted(pageID int64, deleted bool) error {
+	if p.deleted(pageID) == deleted {
+		return nil
+	}
+
+	i := pageID / 8
+	bit := byte(1) << (pageID % 8)
+
+	if i >= int64(len(p.deletedPages)) {
+		p.deletedPages = append(p.deletedPages, make([]byte, i-int64(len(p.deletedPages))+1)...)
+	}
+
+	if deleted {
+		p.deletedPages[i] |= bit
+		p.freePages = append(p.freePages, pageID)
+	} else {
+		p.deletedPages[i] &^= bit
+	}
+
+	_, err := p.deletedPagesFile.WriteAt(p.deletedPages[i:i+1], int64(len(DELETED_PAGES_MAGIC))+i)
+	return err
+}
+
+// markDirty marks a page as written since the last backup
+// The bitmap is written before the page so a page is never changed without being marked
+func (p *Pager) markDirty(pageID int64) error {
+	p.dirtyPagesLock.Lock()
+	defer p.dirtyPagesLock.Unlock()
+
+	i := pageID / 8
+	bit := byte(1) << (pageID % 8)
+
+	if i < int64(len(p.dirtyPages)) && p.dirtyPages[i]&bit != 0 {
+		return nil // already marked
+	}
+
+	if i >= int64(len(p.dirtyPages)) {
+		p.dirtyPages = append(p.dirtyPages, make([]byte, i-int64(len(p.dirtyPages))+1)...)
+	}
+
+	p.dirtyPages[i] |= bit
+
+	_, err := p.dirtyPagesFile.WriteAt(p.dirtyPages[i:i+1], i)
+	return err
+}
+
+// DirtyPages returns the pages of a pager file written since the last backup
+// ok is false if the file has no dirty pages bitmap, then it was not written by a pager since the bitmap was introduced
+func DirtyPages(filename string) (pages []int64, ok bool, err error) {
+	bitmap, err := os.ReadFile(filename + DIRTY_PAGES_EXTENSION)
+	if os.IsNotExist(err) {
+		return nil, false, nil
+	} else if err != nil {
+		return nil, false, err
+	}
 
-		// Check if end is beyond the length of data
-		if end > len(data) {
-			end = len(data)
+	pages = make([]int64, 0)
+
+	for i, b := range bitmap {
+		for j := 0; j < 8; j++ {
+			if b&(1<<j) != 0 {
+				pages = append(pages, int64(i)*8+int64(j))
+			}
 		}
+	}
+
+	return pages, true, nil
+}
+
+// ResetDirtyPages clears the dirty pages bitmap of a pager file after a backup, the pager must not be open
+func ResetDirtyPages(filename string) error {
+	return os.WriteFile(filename+DIRTY_PAGES_EXTENSION, []byte{}, 0644)
+}
 
-		chunks = append(chunks, data[i:end])
+// splitDataIntoChunks splits data into chunks of PAGE_SIZE, empty data is a single empty chunk
+func splitDataIntoChunks(data []byte) [][]byte {
+	chunks := [][]byte{data[:min(len(data), PAGE_SIZE)]}
+
+	for i := PAGE_SIZE; i < len(data); i += PAGE_SIZE {
+		chunks = append(chunks, data[i:min(i+PAGE_SIZE, len(data))])
 	}
+
 	return chunks
 }
 
-// WriteTo writes data to a specific page
-func (p *Pager) WriteTo(pageID int64, data []byte) error {
-	// lock the page
-	p.getPageLock(pageID).Lock()
-	defer p.getPageLock(pageID).Unlock()
+// pageHeader is the header of a page, written as text within HEADER_SIZE bytes
+// i.e. H 12 1024 1500 is the first page of 1500 bytes of data, 1024 of them within the page and the rest from page 12 on.
+// Pages written before headers held more than the next page are legacy pages, their header is the next page alone
+type pageHeader struct {
+	kind   byte  // PAGE_HEAD or PAGE_OVERFLOW, 0 for a legacy page
+	next   int64 // Next page of the data, -1 if the page is the last
+	length int   // Bytes of the data within the page
+	total  int   // Bytes of the data across every page
+}
 
-	p.DeletePage(pageID)
-	// remove from deleted pages
-	p.deletedPagesLock.Lock()
-	defer p.deletedPagesLock.Unlock()
+// encode returns the header padded to HEADER_SIZE
+func (h *pageHeader) encode() []byte {
+	header := make([]byte, HEADER_SIZE)
+	copy(header, fmt.Sprintf("%c %d %d %d", h.kind, h.next, h.length, h.total))
+
+	return header
+}
+
+// decodeHeader decodes the header of a page, legacy headers included
+func decodeHeader(b []byte) (*pageHeader, error) {
+	b = bytes.Trim(b, "\x00")
+
+	if len(b) > 0 && (b[0] == PAGE_HEAD || b[0] == PAGE_OVERFLOW) {
+		h := &pageHeader{kind: b[0]}
 
-	for i, page := range p.deletedPages {
-		if page == pageID {
-			p.deletedPages = append(p.deletedPages[:i], p.deletedPages[i+1:]...)
+		_, err := fmt.Sscanf(string(b[1:]), "%d %d %d", &h.next, &h.length, &h.total)
+		if err != nil || h.length < 0 || h.length > PAGE_SIZE || h.total < h.length {
+			return nil, fmt.Errorf("%w: invalid header %q", ErrCorruptPage, b)
 		}
 
+		return h, nil
 	}
 
-	// the reason we are doing this is because we are going to write to the page thus having any overflowed pages which are linked to the page may not be needed
+	next, err := strconv.ParseInt(string(b), 10, 64)
+	if err != nil {
+		return nil, err
+	}
+
+	return &pageHeader{next: next}, nil
+}
+
+// PageHeader decodes the header of a page, whether the page is an overflow page and the next page of its data, -1 if the data ends at the page
+func PageHeader(header []byte) (overflow bool, next int64, err error) {
+	h, err := decodeHeader(header)
+	if err != nil {
+		return false, 0, err
+	}
 
-	// check if data is larger than the page size
-	if len(data) > PAGE_SIZE {
-		// create an array [][]byte
-		// each element is a page
+	return h.kind == PAGE_OVERFLOW, h.next, nil
+}
 
-		chunks := splitDataIntoChunks(data)
+// readPage reads the header and data of a single page
+func (p *Pager) readPage(pageID int64) (*pageHeader, []byte, error) {
+	dataPHeader := make([]byte, PAGE_SIZE+HEADER_SIZE)
 
-		// clear data to free up memory
-		data = nil
+	_, err := p.file.ReadAt(dataPHeader, pageID*(PAGE_SIZE+HEADER_SIZE))
+	if err != nil {
+		return nil, nil, err
+	}
 
-		headerBuffer := make([]byte, HEADER_SIZE)
+	h, err := decodeHeader(dataPHeader[:HEADER_SIZE])
+	if err != nil {
+		return nil, nil, err
+	}
 
-		// We need to create pages for each chunk
-		// after index 0
-		// the next page is the current page + 1
+	return h, dataPHeader[HEADER_SIZE:], nil
+}
 
-		// index 0 would have the next page of index 1 index 1 would have the next page of index 2
+// writePage writes a single page and marks it live, a deleted page is live again once it is written
+func (p *Pager) writePage(pageID int64, h *pageHeader, chunk []byte) error {
+	err := p.markDirty(pageID)
+	if err != nil {
+		return err
+	}
 
-		for i, chunk := range chunks {
-			// check if we are at the last chunk
-			if i == len(chunks)-1 {
-				headerBuffer = make([]byte, HEADER_SIZE)
-				nextPage := pageID + 1
-				copy(headerBuffer, strconv.FormatInt(nextPage, 10))
+	// pad the chunk with null bytes to PAGE_SIZE
+	page := append(h.encode(), chunk...)
+	page = append(page, make([]byte, PAGE_SIZE-len(chunk))...)
 
-				// if chunk is less than PAGE_SIZE, we need to pad it with null bytes
-				if len(chunk) < PAGE_SIZE {
-					chunk = append(chunk, make([]byte, PAGE_SIZE-len(chunk))...)
-				}
+	_, err = p.file.WriteAt(page, pageID*(PAGE_SIZE+HEADER_SIZE))
+	if err != nil {
+		return err
+	}
 
-				// write the chunk to the file
-				_, err := p.file.WriteAt(append(headerBuffer, chunk...), pageID*(PAGE_SIZE+HEADER_SIZE))
-				if err != nil {
-					return err
-				}
+	p.deletedPagesLock.Lock()
+	defer p.deletedPagesLock.Unlock()
 
-			} else {
-				// update the header
-				headerBuffer = make([]byte, HEADER_SIZE)
-				nextPage := pageID + 1
-				copy(headerBuffer, strconv.FormatInt(nextPage, 10))
+	return p.setDeleted(pageID, false)
+}
 
-				if len(chunk) < PAGE_SIZE {
-					chunk = append(chunk, make([]byte, PAGE_SIZE-len(chunk))...)
-				}
+// WriteTo writes data to a specific page
+// Data larger than PAGE_SIZE continues on overflow pages allocated for it, each pointing to the next.  The overflow pages
+// are written before the page so the page never points to a partial chain, the overflow pages of the data written to the page before are deleted after
+func (p *Pager) WriteTo(pageID int64, data []byte) error {
+	// lock the page
+	wait.Lock(p.getPageLock(pageID), wait.BTREE_LATCH)
+	defer p.getPageLock(pageID).Unlock()
 
-				// write the chunk to the file
-				_, err := p.file.WriteAt(append(headerBuffer, chunk...), pageID*(PAGE_SIZE+HEADER_SIZE))
-				if err != nil {
-					return err
-				}
+	// The chain of a deleted page was deleted with it, its pages can be written since
+	var previous []int64
+	if !p.IsDeleted(pageID) {
+		previous = p.overflowPages(pageID)
+	}
 
-				// update the pageID
-				pageID = nextPage
+	chunks := splitDataIntoChunks(data)
 
-			}
+	pages := []int64{pageID}
+	for range chunks[1:] {
+		page, err := p.allocate()
+		if err != nil {
+			return err
 		}
 
-	} else {
-		// create a buffer to store the header
-		headerBuffer := make([]byte, HEADER_SIZE)
+		pages = append(pages, page)
+	}
 
-		// set the next page to -1
-		copy(headerBuffer, "-1")
+	for i := len(chunks) - 1; i >= 0; i-- {
+		h := &pageHeader{kind: PAGE_OVERFLOW, next: -1, length: len(chunks[i]), total: len(data)}
 
-		// if data is less than PAGE_SIZE, we need to pad it with null bytes
-		if len(data) < PAGE_SIZE {
-			data = append(data, make([]byte, PAGE_SIZE-len(data))...)
+		if i == 0 {
+			h.kind = PAGE_HEAD
 		}
 
-		// write the data to the file
-		_, err := p.file.WriteAt(append(headerBuffer, data...), (PAGE_SIZE+HEADER_SIZE)*pageID)
+		if i+1 < len(pages) {
+			h.next = pages[i+1]
+		}
+
+		err := p.writePage(pages[i], h, chunks[i])
 		if err != nil {
 			return err
 		}
+	}
 
+	p.deletedPagesLock.Lock()
+	defer p.deletedPagesLock.Unlock()
+
+	for _, page := range previous {
+		err := p.setDeleted(page, true)
+		if err != nil {
+			return err
+		}
 	}
 
 	return nil
 }
 
+// overflowPages returns the overflow pages the data of a page continues on, none for a legacy page
+// The chain is followed as far as it reads
+func (p *Pager) overflowPages(pageID int64) []int64 {
+	h, _, err := p.readPage(pageID)
+	if err != nil || h.kind != PAGE_HEAD {
+		return nil
+	}
+
+	pages := make([]int64, 0)
+
+	for next := h.next; next != -1 && len(pages) <= h.total/PAGE_SIZE; {
+		o, _, err := p.readPage(next)
+		if err != nil || o.kind != PAGE_OVERFLOW {
+			break
+		}
+
+		pages = append(pages, next)
+		next = o.next
+	}
+
+	return pages
+}
+
 // getPageLock gets the lock for a page
 func (p *Pager) getPageLock(pageID int64) *sync.RWMutex {
 	// Lock the mutex that protects the PageLocks map
@@ -270,117 +483,137 @@ func (p *Pager) getPageLock(pageID int64) *sync.RWMutex {
 
 // Write writes data to the next available page
 func (p *Pager) Write(data []byte) (int64, error) {
+	pageID, err := p.allocate()
+	if err != nil {
+		return -1, err
+	}
 
-	// check if there are any deleted pages
-	if len(p.deletedPages) > 0 {
-		// get the last deleted page
-		pageID := p.deletedPages[len(p.deletedPages)-1]
-		p.deletedPages = p.deletedPages[:len(p.deletedPages)-1]
+	err = p.WriteTo(pageID, data)
+	if err != nil {
+		return -1, err
+	}
 
-		err := p.WriteTo(pageID, data)
-		if err != nil {
-			return -1, err
-		}
+	return pageID, nil
+}
 
+// allocate returns a page to write to, the last deleted page if any, otherwise a page past the end of the file
+// Pages past the end are reserved until they are written, pages allocated at once are never the same
+func (p *Pager) allocate() (int64, error) {
+	if pageID, ok := p.freePage(); ok {
 		return pageID, nil
+	}
 
-	} else {
-		// get the current file size
-		fileInfo, err := p.file.Stat()
-		if err != nil {
-			return -1, err
-		}
-
-		if fileInfo.Size() == 0 {
+	stat, err := p.file.Stat()
+	if err != nil {
+		return -1, err
+	}
 
-			err = p.WriteTo(0, data)
-			if err != nil {
-				return -1, err
-			}
+	p.deletedPagesLock.Lock()
+	defer p.deletedPagesLock.Unlock()
 
-			return 0, nil
-		}
+	p.end = max(p.end, stat.Size()/(PAGE_SIZE+HEADER_SIZE))
+	p.end++
 
-		// create a new page
-		pageId := fileInfo.Size() / (PAGE_SIZE + HEADER_SIZE)
+	return p.end - 1, nil
+}
 
-		err = p.WriteTo(pageId, data)
-		if err != nil {
-			return -1, err
-		}
+// freePage takes the last deleted page off the free pages, false if no page is deleted
+func (p *Pager) freePage() (int64, bool) {
+	p.deletedPagesLock.Lock()
+	defer p.deletedPagesLock.Unlock()
 
-		return pageId, nil
+	for len(p.freePages) > 0 {
+		pageID := p.freePages[len(p.freePages)-1]
+		p.freePages = p.freePages[:len(p.freePages)-1]
 
+		// A page written since it was deleted is skipped
+		if p.deleted(pageID) {
+			return pageID, true
+		}
 	}
 
+	return -1, false
+}
+
+// Idle closes the descriptors of the pager files not in use, they are opened again on next use
+func (p *Pager) Idle() {
+	p.file.Idle()
+	p.deletedPagesFile.Idle()
+	p.dirtyPagesFile.Idle()
 }
 
 // Close closes the file
 func (p *Pager) Close() error {
-	p.writeDelPages()
+	p.deletedPagesFile.Close()
+	p.dirtyPagesFile.Close()
 	return p.file.Close()
 }
 
 // GetPage gets a page and returns the data
-// Will gather all the pages that are linked together
+// Will gather all the pages that are linked together.  ErrOverflowPage is returned for an overflow page, its data is
+// read with the page it starts at, and ErrCorruptPage if the chain of the page is broken
 func (p *Pager) GetPage(pageID int64) ([]byte, error) {
 
 	// lock the page
-	p.getPageLock(pageID).Lock()
+	wait.Lock(p.getPageLock(pageID), wait.BTREE_LATCH)
 	defer p.getPageLock(pageID).Unlock()
 
-	p.deletedPagesLock.Lock()
 	// Check if in deleted pages, if so return nil
-	if slices.Contains(p.deletedPages, pageID) {
-		p.deletedPagesLock.Unlock()
+	if p.IsDeleted(pageID) {
 		return nil, nil
 	}
-	p.deletedPagesLock.Unlock()
 
-	result := make([]byte, 0)
+	h, data, err := p.readPage(pageID)
+	if err != nil {
+		return nil, err
+	}
 
-	// get the page
-	dataPHeader := make([]byte, PAGE_SIZE+HEADER_SIZE)
+	switch h.kind {
+	case PAGE_OVERFLOW:
+		return nil, ErrOverflowPage
+	case 0:
+		return p.getLegacyPage(h, data), nil
+	}
 
-	if pageID == 0 {
+	result := make([]byte, 0, h.total)
+	result = append(result, data[:h.length]...)
 
-		_, err := p.file.ReadAt(dataPHeader, 0)
-		if err != nil {
-			return nil, err
+	for next := h.next; next != -1; {
+		if len(result) >= h.total {
+			return nil, fmt.Errorf("%w: page %d continues past its %d bytes", ErrCorruptPage, pageID, h.total)
 		}
-	} else {
 
-		_, err := p.file.ReadAt(dataPHeader, pageID*(PAGE_SIZE+HEADER_SIZE))
-		if err != nil {
-			return nil, err
+		if p.IsDeleted(next) {
+			return nil, fmt.Errorf("%w: page %d continues at deleted page %d", ErrCorruptPage, pageID, next)
 		}
-	}
 
-	// get header
-	header := dataPHeader[:HEADER_SIZE]
-	data := dataPHeader[HEADER_SIZE:]
-
-	// remove the null bytes
-	header = bytes.Trim(header, "\x00")
-	//data = bytes.Trim(data, "\x00")
+		o, data, err := p.readPage(next)
+		if err != nil {
+			return nil, fmt.Errorf("%w: page %d continues at page %d which does not read: %s", ErrCorruptPage, pageID, next, err.Error())
+		}
 
-	// append the data to the result
-	result = append(result, data...)
+		if o.kind != PAGE_OVERFLOW || o.total != h.total {
+			return nil, fmt.Errorf("%w: page %d continues at page %d which is not an overflow page of it", ErrCorruptPage, pageID, next)
+		}
 
-	// get the next page
-	nextPage, err := strconv.ParseInt(string(header), 10, 64)
-	if err != nil {
-		return nil, err
+		result = append(result, data[:o.length]...)
+		next = o.next
 	}
 
-	if nextPage == -1 {
-		return result, nil
-
+	if len(result) != h.total {
+		return nil, fmt.Errorf("%w: page %d holds %d bytes, expected %d", ErrCorruptPage, pageID, len(result), h.total)
 	}
 
-	for {
+	return result, nil
+}
 
-		dataPHeader = make([]byte, PAGE_SIZE+HEADER_SIZE)
+// getLegacyPage gathers the data of a legacy page, written on the pages following it padded with null bytes
+// The chain ends at a page whose header does not read, the data of pages past it can follow
+func (p *Pager) getLegacyPage(h *pageHeader, data []byte) []byte {
+	result := append([]byte{}, data...)
+
+	for nextPage := h.next; nextPage != -1; {
+		dataPHeader := make([]byte, PAGE_SIZE+HEADER_SIZE)
 
 		_, err := p.file.ReadAt(dataPHeader, nextPage*(PAGE_SIZE+HEADER_SIZE))
 		if err != nil {
@@ -388,49 +621,85 @@ func (p *Pager) GetPage(pageID int64) ([]byte, error) {
 		}
 
 		// get header
-		header = dataPHeader[:HEADER_SIZE]
-		data = dataPHeader[HEADER_SIZE:]
-
-		// remove the null bytes
-		header = bytes.Trim(header, "\x00")
-		//data = bytes.Trim(data, "\x00")
+		header := bytes.Trim(dataPHeader[:HEADER_SIZE], "\x00")
 
 		// append the data to the result
-		result = append(result, data...)
+		result = append(result, dataPHeader[HEADER_SIZE:]...)
 
 		// get the next page
 		nextPage, err = strconv.ParseInt(string(header), 10, 64)
-		if err != nil || nextPage == -1 {
+		if err != nil {
 			break
 		}
-
 	}
 
-	return result, nil
+	return result
 }
 
-// GetDeletedPages returns the list of deleted pages
-func (p *Pager) GetDeletedPages() []int64 {
+// IsLegacy returns true if a page was written before overflow pages had headers of their own
+// A legacy page can be the middle of the data of another page, it does not decode
+func (p *Pager) IsLegacy(pageID int64) bool {
+	h, _, err := p.readPage(pageID)
+
+	return err == nil && h.kind == 0
+}
+
+// IsDeleted returns true if a page is deleted
+func (p *Pager) IsDeleted(pageID int64) bool {
 	p.deletedPagesLock.Lock()
 	defer p.deletedPagesLock.Unlock()
-	return p.deletedPages
+
+	return p.deleted(pageID)
 }
 
-// DeletePage deletes a page
+// DeletePage deletes a page and its overflow pages, only the bytes of the deleted pages bitmap holding them are written
 func (p *Pager) DeletePage(pageID int64) error {
+	// The chain of a deleted page was deleted with it, its pages can be written since
+	if p.IsDeleted(pageID) {
+		return nil
+	}
+
+	pages := append([]int64{pageID}, p.overflowPages(pageID)...)
+
 	p.deletedPagesLock.Lock()
 	defer p.deletedPagesLock.Unlock()
 
-	// Add the page to the deleted pages
-	p.deletedPages = append(p.deletedPages, pageID)
+	for _, page := range pages {
+		err := p.setDeleted(page, true)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
 
-	// write the deleted pages to the file
-	err := p.writeDelPages()
+// Preload reads the whole file in order, so its pages are in the page cache of the operating system before they are read
+// The bytes read are returned
+func (p *Pager) Preload() (int64, error) {
+	stat, err := p.file.Stat()
 	if err != nil {
-		return err
+		return 0, err
 	}
 
-	return nil
+	buf := make([]byte, PRELOAD_CHUNK_SIZE)
+
+	var read int64
+
+	for read < stat.Size() {
+		n, err := p.file.ReadAt(buf, read)
+		read += int64(n)
+
+		if errors.Is(err, io.EOF) {
+			break
+		}
+
+		if err != nil {
+			return read, err
+		}
+	}
+
+	return read, nil
 }
 
 // Count returns the number of pages
@@ -18,6 +18,7 @@ package btree
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"os"
 	"testing"
@@ -26,6 +27,7 @@ import (
 func TestOpenPager(t *testing.T) {
 	defer os.Remove("btree.db")
 	defer os.Remove("btree.db.del")
+	defer os.Remove("btree.db.dirty")
 	pager, err := OpenPager("btree.db", os.O_CREATE|os.O_RDWR, 0644)
 	if err != nil {
 		t.Fatal(err)
@@ -42,6 +44,7 @@ func TestOpenPager(t *testing.T) {
 func TestPager_Write(t *testing.T) {
 	defer os.Remove("btree.db")
 	defer os.Remove("btree.db.del")
+	defer os.Remove("btree.db.dirty")
 
 	pager, err := OpenPager("btree.db", os.O_CREATE|os.O_RDWR, 0644)
 	if err != nil {
@@ -74,6 +77,7 @@ func TestPager_Write(t *testing.T) {
 func TestPager_Write2(t *testing.T) {
 	defer os.Remove("btree.db")
 	defer os.Remove("btree.db.del")
+	defer os.Remove("btree.db.dirty")
 
 	pager, err := OpenPager("btree.db", os.O_CREATE|os.O_RDWR, 0644)
 	if err != nil {
@@ -93,6 +97,7 @@ func TestPager_Write2(t *testing.T) {
 func TestPager_Count(t *testing.T) {
 	defer os.Remove("btree.db")
 	defer os.Remove("btree.db.del")
+	defer os.Remove("btree.db.dirty")
 
 	pager, err := OpenPager("btree.db", os.O_CREATE|os.O_RDWR, 0644)
 	if err != nil {
@@ -113,3 +118,344 @@ func TestPager_Count(t *testing.T) {
 		t.Fatalf("expected 1000, got %d", count)
 	}
 }
+
+func TestPager_Preload(t *testing.T) {
+	defer os.Remove("btree.db")
+	defer os.Remove("btree.db.del")
+	defer os.Remove("btree.db.dirty")
+
+	pager, err := OpenPager("btree.db", os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pager.Close()
+
+	for i := 0; i < 100; i++ {
+		_, err := pager.Write([]byte(fmt.Sprintf("Hello World %d", i)))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	read, err := pager.Preload()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The file is read whole, over more than one chunk
+	if read != 100*(PAGE_SIZE+HEADER_SIZE) {
+		t.Fatalf("expected %d bytes read, got %d", 100*(PAGE_SIZE+HEADER_SIZE), read)
+	}
+}
+
+func TestPager_DirtyPages(t *testing.T) {
+	defer os.Remove("btree.db")
+	defer os.Remove("btree.db.del")
+	defer os.Remove("btree.db.dirty")
+
+	pager, err := OpenPager("btree.db", os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 10; i++ {
+		_, err := pager.Write([]byte(fmt.Sprintf("Hello World %d", i)))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	pager.Close()
+
+	pages, ok, err := DirtyPages("btree.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !ok || len(pages) != 10 {
+		t.Fatalf("expected 10 dirty pages, got %v", pages)
+	}
+
+	err = ResetDirtyPages("btree.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Only pages written after the reset are dirty
+	pager, err = OpenPager("btree.db", os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = pager.WriteTo(3, []byte("Hello World 3 again"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = pager.WriteTo(12, bytes.Repeat([]byte("a"), PAGE_SIZE+1))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pager.Close()
+
+	pages, _, err = DirtyPages("btree.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The overflow page of page 12 is allocated at the end of the file, page 10
+	if len(pages) != 3 || pages[0] != 3 || pages[1] != 10 || pages[2] != 12 {
+		t.Fatalf("expected dirty pages 3, 10 and 12, got %v", pages)
+	}
+}
+
+func TestPager_DeletedPages(t *testing.T) {
+	defer os.Remove("btree.db")
+	defer os.Remove("btree.db.del")
+	defer os.Remove("btree.db.dirty")
+
+	pager, err := OpenPager("btree.db", os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 20; i++ {
+		_, err := pager.Write([]byte(fmt.Sprintf("Hello World %d", i)))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, pageID := range []int64{3, 9, 17} {
+		err = pager.DeletePage(pageID)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if !pager.IsDeleted(9) || pager.IsDeleted(10) || pager.IsDeleted(-1) || pager.IsDeleted(1000) {
+		t.Fatal("unexpected deleted pages")
+	}
+
+	page, err := pager.GetPage(9)
+	if err != nil || page != nil {
+		t.Fatalf("expected no data for a deleted page, got %q %v", page, err)
+	}
+
+	// A page written since it was deleted is not reused
+	err = pager.WriteTo(17, []byte("Hello World 17 again"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pageID, err := pager.Write([]byte("reused"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if pageID != 9 || pager.IsDeleted(9) {
+		t.Fatalf("expected page 9 to be reused, got %d", pageID)
+	}
+
+	pager.Close()
+
+	// The bitmap is written as pages are deleted and written
+	data, err := os.ReadFile("btree.db.del")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(data, []byte(DELETED_PAGES_MAGIC+"\x08\x00\x00")) {
+		t.Fatalf("unexpected bitmap %q", data)
+	}
+
+	// Files listing the pages as text are read and written as a bitmap
+	err = os.WriteFile("btree.db.del", []byte("[3,12]"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pager, err = OpenPager("btree.db", os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !pager.IsDeleted(3) || !pager.IsDeleted(12) || pager.IsDeleted(9) {
+		t.Fatal("expected pages 3 and 12 deleted")
+	}
+
+	pager.Close()
+
+	data, err = os.ReadFile("btree.db.del")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(data, []byte(DELETED_PAGES_MAGIC+"\x08\x10")) {
+		t.Fatalf("unexpected bitmap %q", data)
+	}
+
+	err = os.WriteFile("btree.db.del", []byte("1,2"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = MigrateDeletedPages("btree.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err = os.ReadFile("btree.db.del")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(data, []byte(DELETED_PAGES_MAGIC+"\x06")) {
+		t.Fatalf("unexpected bitmap %q", data)
+	}
+}
+
+func TestPager_OverflowPages(t *testing.T) {
+	defer os.Remove("btree.db")
+	defer os.Remove("btree.db.del")
+	defer os.Remove("btree.db.dirty")
+
+	pager, err := OpenPager("btree.db", os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pager.Close()
+
+	large := append(bytes.Repeat([]byte("abc"), PAGE_SIZE), 'd')
+
+	for i, data := range [][]byte{[]byte("small"), large, []byte("after")} {
+		pageID, err := pager.Write(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if i == 2 && pageID != 5 {
+			t.Fatalf("expected page 5 past the overflow pages, got %d", pageID)
+		}
+	}
+
+	// Data is read whole from the page it starts at, without padding
+	for pageID, expected := range map[int64][]byte{0: []byte("small"), 1: large, 5: []byte("after")} {
+		data, err := pager.GetPage(pageID)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !bytes.Equal(data, expected) {
+			t.Fatalf("unexpected data of page %d, %d bytes", pageID, len(data))
+		}
+	}
+
+	for pageID := int64(2); pageID < 5; pageID++ {
+		_, err := pager.GetPage(pageID)
+		if !errors.Is(err, ErrOverflowPage) {
+			t.Fatalf("expected page %d to be an overflow page, got %v", pageID, err)
+		}
+	}
+
+	// Writing smaller data deletes the overflow pages, they are reused
+	err = pager.WriteTo(1, []byte("smaller"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !pager.IsDeleted(2) || !pager.IsDeleted(4) || pager.IsDeleted(1) {
+		t.Fatal("expected the overflow pages of page 1 deleted")
+	}
+
+	pageID, err := pager.Write(large)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := pager.GetPage(pageID)
+	if err != nil || !bytes.Equal(data, large) {
+		t.Fatalf("unexpected data of page %d, %v", pageID, err)
+	}
+
+	// Deleting a page deletes its overflow pages
+	err = pager.DeletePage(pageID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for page := int64(2); page < 5; page++ {
+		if !pager.IsDeleted(page) {
+			t.Fatalf("expected page %d deleted", page)
+		}
+	}
+
+	// A broken chain is reported rather than read short
+	pageID, err = pager.Write(large)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h, _, err := pager.readPage(pageID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = pager.WriteTo(h.next, []byte("overwritten"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = pager.GetPage(pageID)
+	if !errors.Is(err, ErrCorruptPage) {
+		t.Fatalf("expected a corrupt page, got %v", err)
+	}
+}
+
+func TestPager_LegacyPages(t *testing.T) {
+	defer os.Remove("btree.db")
+	defer os.Remove("btree.db.del")
+	defer os.Remove("btree.db.dirty")
+
+	// Pages as written before headers held more than the next page
+	page := func(next string, data string) []byte {
+		header := make([]byte, HEADER_SIZE)
+		copy(header, next)
+
+		return append(append(header, data...), make([]byte, PAGE_SIZE-len(data))...)
+	}
+
+	err := os.WriteFile("btree.db", append(page("1", "first"), page("-1", "second")...), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pager, err := OpenPager("btree.db", os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pager.Close()
+
+	data, err := pager.GetPage(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(data) != PAGE_SIZE*2 || !bytes.HasPrefix(data, []byte("first")) || !bytes.HasPrefix(data[PAGE_SIZE:], []byte("second")) {
+		t.Fatalf("unexpected data %q", bytes.Trim(data, "\x00"))
+	}
+
+	if !pager.IsLegacy(1) {
+		t.Fatal("expected page 1 to be a legacy page")
+	}
+
+	err = pager.WriteTo(1, []byte("rewritten"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if pager.IsLegacy(1) {
+		t.Fatal("expected page 1 to have a header once written")
+	}
+}
@@ -1,4 +1,7 @@
-// asql - AriaSQL CLI
+//go:build !windows
+
+// Package storage
+// Free disk space for unix systems
 // Copyright (C) AriaSQL
 // Author(s): Alex Gaetano Padula
 //
@@ -14,23 +17,18 @@
 //
 // You should have received a copy of the GNU Affero General Public License
 // along with this program.  If not, see <http://www.gnu.org/licenses/>.
-package main
+package storage
 
-import (
-	"os"
-	"testing"
-)
+import "syscall"
 
-func TestNew(t *testing.T) {
-	defer os.Remove(".asql_history")
+// FreeSpace returns the bytes available to the process on the disk of dir
+func FreeSpace(dir string) (int64, error) {
+	stat := &syscall.Statfs_t{}
 
-	asql, err := New()
+	err := syscall.Statfs(dir, stat)
 	if err != nil {
-		t.Errorf("Expected nil, got %s", err)
-	}
-
-	if asql == nil {
-		t.Errorf("Expected not nil, got nil")
+		return 0, err
 	}
 
+	return int64(stat.Bavail) * int64(stat.Bsize), nil
 }
@@ -0,0 +1,39 @@
+//go:build windows
+
+// Package storage
+// Free disk space for windows systems
+// Copyright (C) AriaSQL
+// Author(s): Alex Gaetano Padula
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+package storage
+
+import "golang.org/x/sys/windows"
+
+// FreeSpace returns the bytes available to the process on the disk of dir
+func FreeSpace(dir string) (int64, error) {
+	path, err := windows.UTF16PtrFromString(dir)
+	if err != nil {
+		return 0, err
+	}
+
+	var available, total, free uint64
+
+	err = windows.GetDiskFreeSpaceEx(path, &available, &total, &free)
+	if err != nil {
+		return 0, err
+	}
+
+	return int64(available), nil
+}
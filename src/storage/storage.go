@@ -16,3 +16,454 @@
 // You should have received a copy of the GNU Affero General Public License
 // along with this program.  If not, see <http://www.gnu.org/licenses/>.
 package storage
+
+import (
+	"ariasql/fault"
+	"container/list"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const DEFAULT_MAX_OPEN_FILES = 512 // Default global budget of open file descriptors
+
+// File is a file whose descriptor is opened on demand
+// Idle files are closed by the descriptor pool when the budget of open files is exceeded, and opened again on next use
+type File struct {
+	name    string        // File path
+	flag    int           // Flags used to reopen the file
+	perm    os.FileMode   // Permissions used to reopen the file
+	file    *os.File      // Underlying file, nil when closed by the pool
+	inUse   int           // Amount of operations currently using the descriptor
+	element *list.Element // Element within the pool, nil when the descriptor is closed
+	closed  bool          // True once Close is called
+	stats   *fileCounters // IO counters of the file path
+}
+
+// descriptorPool keeps track of open descriptors, least recently used first to be closed
+type descriptorPool struct {
+	max  int         // Max amount of open descriptors
+	open *list.List  // Open files, most recently used first
+	lock *sync.Mutex // Pool lock
+}
+
+var pool = &descriptorPool{max: DEFAULT_MAX_OPEN_FILES, open: list.New(), lock: &sync.Mutex{}}
+
+// IOStats are counters of the IO performed through files of the process since it started
+type IOStats struct {
+	Reads        int64 // Amount of reads
+	Writes       int64 // Amount of writes
+	BytesRead    int64 // Bytes read
+	BytesWritten int64 // Bytes written
+	Syncs        int64 // Amount of syncs to stable storage
+}
+
+var ioReads, ioWrites, ioBytesRead, ioBytesWritten, ioSyncs atomic.Int64 // IO counters
+
+// Stats returns the IO counters, subtract two snapshots for the IO performed in between
+func Stats() IOStats {
+	return IOStats{
+		Reads:        ioReads.Load(),
+		Writes:       ioWrites.Load(),
+		BytesRead:    ioBytesRead.Load(),
+		BytesWritten: ioBytesWritten.Load(),
+		Syncs:        ioSyncs.Load(),
+	}
+}
+
+// Sub returns the IO performed between an earlier snapshot and this one
+func (s IOStats) Sub(earlier IOStats) IOStats {
+	return IOStats{
+		Reads:        s.Reads - earlier.Reads,
+		Writes:       s.Writes - earlier.Writes,
+		BytesRead:    s.BytesRead - earlier.BytesRead,
+		BytesWritten: s.BytesWritten - earlier.BytesWritten,
+		Syncs:        s.Syncs - earlier.Syncs,
+	}
+}
+
+// FileStats are counters of the IO performed on a file path, kept across reopens of the file until ResetFileStats
+type FileStats struct {
+	IOStats
+	ReadTime  time.Duration // Time spent reading
+	WriteTime time.Duration // Time spent writing
+	SyncTime  time.Duration // Time spent syncing
+}
+
+// fileCounters are the IO counters of a file path
+type fileCounters struct {
+	reads, writes, bytesRead, bytesWritten, syncs atomic.Int64
+	readTime, writeTime, syncTime                 atomic.Int64 // Nanoseconds
+}
+
+var fileStats = make(map[string]*fileCounters) // IO counters by file path
+var fileStatsLock = &sync.Mutex{}              // Lock for fileStats
+
+// countersOf returns the IO counters of a file path, creating them on first use
+func countersOf(name string) *fileCounters {
+	fileStatsLock.Lock()
+	defer fileStatsLock.Unlock()
+
+	name = filepath.Clean(name)
+
+	counters, ok := fileStats[name]
+	if !ok {
+		counters = &fileCounters{}
+		fileStats[name] = counters
+	}
+
+	return counters
+}
+
+// StatsOf returns the IO counters of a file path, zero if no IO was performed on it
+func StatsOf(name string) FileStats {
+	fileStatsLock.Lock()
+	counters, ok := fileStats[filepath.Clean(name)]
+	fileStatsLock.Unlock()
+
+	if !ok {
+		return FileStats{}
+	}
+
+	return FileStats{
+		IOStats: IOStats{
+			Reads:        counters.reads.Load(),
+			Writes:       counters.writes.Load(),
+			BytesRead:    counters.bytesRead.Load(),
+			BytesWritten: counters.bytesWritten.Load(),
+			Syncs:        counters.syncs.Load(),
+		},
+		ReadTime:  time.Duration(counters.readTime.Load()),
+		WriteTime: time.Duration(counters.writeTime.Load()),
+		SyncTime:  time.Duration(counters.syncTime.Load()),
+	}
+}
+
+// ResetFileStats zeroes the IO counters of every file path, the process wide counters of Stats are kept
+func ResetFileStats() {
+	fileStatsLock.Lock()
+	defer fileStatsLock.Unlock()
+
+	for _, counters := range fileStats {
+		counters.reset()
+	}
+}
+
+// reset zeroes the counters
+func (c *fileCounters) reset() {
+	c.reads.Store(0)
+	c.writes.Store(0)
+	c.bytesRead.Store(0)
+	c.bytesWritten.Store(0)
+	c.syncs.Store(0)
+	c.readTime.Store(0)
+	c.writeTime.Store(0)
+	c.syncTime.Store(0)
+}
+
+// SetMaxOpenFiles sets the global budget of open file descriptors
+// Files in use are never closed so the budget can be exceeded temporarily
+func SetMaxOpenFiles(max int) {
+	pool.lock.Lock()
+	defer pool.lock.Unlock()
+
+	pool.max = max
+	pool.evict()
+}
+
+// OpenFiles returns the amount of descriptors currently open
+func OpenFiles() int {
+	pool.lock.Lock()
+	defer pool.lock.Unlock()
+
+	return pool.open.Len()
+}
+
+// OpenFile opens a file through the descriptor pool, flags and permissions are as os.OpenFile
+func OpenFile(name string, flag int, perm os.FileMode) (*File, error) {
+	f := &File{name: name, flag: flag, perm: perm, stats: countersOf(name)}
+
+	_, err := os.Stat(name)
+	created := os.IsNotExist(err)
+
+	// Open once to create the file or surface errors now rather than on first use
+	err = f.acquire()
+	if err != nil {
+		return nil, err
+	}
+
+	// A file created again, after a drop, starts its counters over
+	if created {
+		f.stats.reset()
+	}
+
+	f.release()
+
+	// Reopening must not truncate or fail on an existing file
+	f.flag &^= os.O_TRUNC | os.O_EXCL
+
+	return f, nil
+}
+
+// acquire opens the descriptor if needed and marks it in use
+func (f *File) acquire() error {
+	pool.lock.Lock()
+	defer pool.lock.Unlock()
+
+	if f.closed {
+		return errors.New("file is closed")
+	}
+
+	if f.file == nil {
+		file, err := os.OpenFile(f.name, f.flag, f.perm)
+		if err != nil {
+			return err
+		}
+
+		f.file = file
+		f.element = pool.open.PushFront(f)
+	} else {
+		pool.open.MoveToFront(f.element)
+	}
+
+	f.inUse++
+
+	pool.evict()
+
+	return nil
+}
+
+// release marks one use of the descriptor done
+func (f *File) release() {
+	pool.lock.Lock()
+	defer pool.lock.Unlock()
+
+	f.inUse--
+
+	pool.evict()
+}
+
+// evict closes idle descriptors, least recently used first, while over budget
+// The pool lock must be held
+func (p *descriptorPool) evict() {
+	if p.max <= 0 {
+		return
+	}
+
+	for e := p.open.Back(); e != nil && p.open.Len() > p.max; {
+		f := e.Value.(*File)
+		prev := e.Prev()
+
+		if f.inUse == 0 {
+			f.file.Close()
+			f.file = nil
+			p.open.Remove(e)
+			f.element = nil
+		}
+
+		e = prev
+	}
+}
+
+// Name returns the name of the file
+func (f *File) Name() string {
+	return f.name
+}
+
+// ReadAt reads len(b) bytes from the file starting at offset
+func (f *File) ReadAt(b []byte, off int64) (int, error) {
+	err := f.acquire()
+	if err != nil {
+		return 0, err
+	}
+
+	defer f.release()
+
+	start := time.Now()
+
+	n, err := fault.Read(f.name, b, off, f.file.ReadAt)
+
+	f.stats.readTime.Add(int64(time.Since(start)))
+	f.stats.reads.Add(1)
+	f.stats.bytesRead.Add(int64(n))
+
+	ioReads.Add(1)
+	ioBytesRead.Add(int64(n))
+
+	return n, err
+}
+
+// WriteAt writes len(b) bytes to the file starting at offset
+func (f *File) WriteAt(b []byte, off int64) (int, error) {
+	err := f.acquire()
+	if err != nil {
+		return 0, err
+	}
+
+	defer f.release()
+
+	start := time.Now()
+
+	n, err := fault.Write(f.name, b, off, f.file.WriteAt)
+
+	f.stats.writeTime.Add(int64(time.Since(start)))
+	f.stats.writes.Add(1)
+	f.stats.bytesWritten.Add(int64(n))
+
+	ioWrites.Add(1)
+	ioBytesWritten.Add(int64(n))
+
+	return n, err
+}
+
+// Stat returns the file info
+func (f *File) Stat() (os.FileInfo, error) {
+	err := f.acquire()
+	if err != nil {
+		return nil, err
+	}
+
+	defer f.release()
+
+	return f.file.Stat()
+}
+
+// Truncate changes the size of the file
+func (f *File) Truncate(size int64) error {
+	err := f.acquire()
+	if err != nil {
+		return err
+	}
+
+	defer f.release()
+
+	return f.file.Truncate(size)
+}
+
+// Sync commits the file to stable storage
+func (f *File) Sync() error {
+	err := f.acquire()
+	if err != nil {
+		return err
+	}
+
+	defer f.release()
+
+	ioSyncs.Add(1)
+	f.stats.syncs.Add(1)
+
+	start := time.Now()
+	defer func() { f.stats.syncTime.Add(int64(time.Since(start))) }()
+
+	return fault.Sync(f.name, f.file.Sync)
+}
+
+// ReadAll reads the whole file
+func (f *File) ReadAll() ([]byte, error) {
+	stat, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	data := make([]byte, stat.Size())
+
+	n, err := f.ReadAt(data, 0)
+	if err != nil && n != len(data) {
+		return nil, err
+	}
+
+	return data, nil
+}
+
+// Idle closes the descriptor unless an operation is using it, the file is opened again on next use
+func (f *File) Idle() {
+	pool.lock.Lock()
+	defer pool.lock.Unlock()
+
+	if f.file == nil || f.inUse > 0 {
+		return
+	}
+
+	f.file.Close()
+	f.file = nil
+	pool.open.Remove(f.element)
+	f.element = nil
+}
+
+// Close closes the file and removes it from the pool
+func (f *File) Close() error {
+	pool.lock.Lock()
+	defer pool.lock.Unlock()
+
+	if f.closed {
+		return nil
+	}
+
+	f.closed = true
+
+	if f.file == nil {
+		return nil
+	}
+
+	pool.open.Remove(f.element)
+	f.element = nil
+
+	err := f.file.Close()
+	f.file = nil
+
+	return err
+}
+
+// DirectoryLock is an exclusive lock on a directory held through a lock file within it
+type DirectoryLock struct {
+	file *os.File // Lock file, kept open for as long as the lock is held
+}
+
+// LockDirectory takes an exclusive lock on a directory so no other process can use it at the same time
+// The lock file holds the pid of the process holding the lock, the lock itself is released by the os if the process dies
+func LockDirectory(directory string, lockFileName string) (*DirectoryLock, error) {
+	file, err := os.OpenFile(filepath.Join(directory, lockFileName), os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	err = lockFile(file)
+	if err != nil {
+		holder, _ := os.ReadFile(file.Name())
+		file.Close()
+		return nil, fmt.Errorf("directory %s is in use by another process (pid %s)", directory, strings.TrimSpace(string(holder)))
+	}
+
+	err = file.Truncate(0)
+	if err != nil {
+		unlockFile(file)
+		file.Close()
+		return nil, err
+	}
+
+	_, err = file.WriteAt([]byte(strconv.Itoa(os.Getpid())), 0)
+	if err != nil {
+		unlockFile(file)
+		file.Close()
+		return nil, err
+	}
+
+	return &DirectoryLock{file: file}, nil
+}
+
+// Unlock releases the directory lock
+func (l *DirectoryLock) Unlock() error {
+	err := unlockFile(l.file)
+	if err != nil {
+		l.file.Close()
+		return err
+	}
+
+	return l.file.Close()
+}
@@ -0,0 +1,269 @@
+// Package storage
+// Descriptor pool tests
+// Copyright (C) AriaSQL
+// Author(s): Alex Gaetano Padula
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+package storage
+
+import (
+	"fmt"
+	"os"
+	"testing"
+)
+
+func TestOpenFile(t *testing.T) {
+	defer os.Remove("test.dat")
+
+	f, err := OpenFile("test.dat", os.O_CREATE|os.O_RDWR|os.O_TRUNC, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer f.Close()
+
+	_, err = f.WriteAt([]byte("hello world"), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := f.ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(data) != "hello world" {
+		t.Fatalf("expected hello world, got %s", data)
+	}
+}
+
+func TestSetMaxOpenFiles(t *testing.T) {
+	SetMaxOpenFiles(2)
+	defer SetMaxOpenFiles(DEFAULT_MAX_OPEN_FILES)
+
+	files := make([]*File, 0)
+
+	for i := 0; i < 5; i++ {
+		name := fmt.Sprintf("test%d.dat", i)
+		defer os.Remove(name)
+
+		f, err := OpenFile(name, os.O_CREATE|os.O_RDWR|os.O_TRUNC, 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		defer f.Close()
+
+		_, err = f.WriteAt([]byte(name), 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		files = append(files, f)
+	}
+
+	if OpenFiles() != 2 {
+		t.Fatalf("expected 2 open files, got %d", OpenFiles())
+	}
+
+	// Closed descriptors are opened again on use, without truncating
+	for i, f := range files {
+		data, err := f.ReadAll()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if string(data) != fmt.Sprintf("test%d.dat", i) {
+			t.Fatalf("expected test%d.dat, got %s", i, data)
+		}
+	}
+
+	if OpenFiles() != 2 {
+		t.Fatalf("expected 2 open files, got %d", OpenFiles())
+	}
+}
+
+func TestFile_Idle(t *testing.T) {
+	defer os.Remove("test.dat")
+
+	f, err := OpenFile("test.dat", os.O_CREATE|os.O_RDWR|os.O_TRUNC, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer f.Close()
+
+	// A descriptor in use is left open
+	err = f.acquire()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f.Idle()
+
+	if f.file == nil {
+		t.Fatal("expected the descriptor in use to stay open")
+	}
+
+	f.release()
+	f.Idle()
+
+	if f.file != nil || f.element != nil {
+		t.Fatal("expected the idle descriptor to be closed")
+	}
+
+	// Opened again on next use
+	_, err = f.WriteAt([]byte("hello"), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := f.ReadAll()
+	if err != nil || string(data) != "hello" {
+		t.Fatalf("expected hello, got %s %v", data, err)
+	}
+}
+
+func TestLockDirectory(t *testing.T) {
+	defer os.Remove("test.lock")
+
+	lock, err := LockDirectory(".", "test.lock")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A second lock on the same directory must fail while the first is held
+	_, err = LockDirectory(".", "test.lock")
+	if err == nil {
+		t.Fatal("expected error locking a locked directory")
+	}
+
+	err = lock.Unlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lock, err = LockDirectory(".", "test.lock")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lock.Unlock()
+}
+
+func TestStats(t *testing.T) {
+	defer os.Remove("test.dat")
+
+	f, err := OpenFile("test.dat", os.O_CREATE|os.O_RDWR|os.O_TRUNC, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer f.Close()
+
+	before := Stats()
+
+	_, err = f.WriteAt([]byte("hello world"), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = f.Sync()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = f.ReadAt(make([]byte, 5), 6)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	io := Stats().Sub(before)
+
+	expected := IOStats{Reads: 1, Writes: 1, BytesRead: 5, BytesWritten: 11, Syncs: 1}
+	if io != expected {
+		t.Fatalf("expected %+v, got %+v", expected, io)
+	}
+}
+
+func TestStatsOf(t *testing.T) {
+	defer os.Remove("test.dat")
+
+	f, err := OpenFile("test.dat", os.O_CREATE|os.O_RDWR|os.O_TRUNC, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = f.WriteAt([]byte("hello world"), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f.Close()
+
+	// Counters are kept across reopens of the path
+	f, err = OpenFile("./test.dat", os.O_RDWR, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer f.Close()
+
+	ResetFileStats()
+
+	_, err = f.ReadAt(make([]byte, 5), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = f.WriteAt([]byte("hello"), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = f.Sync()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stats := StatsOf("test.dat")
+
+	expected := IOStats{Reads: 1, Writes: 1, BytesRead: 5, BytesWritten: 5, Syncs: 1}
+	if stats.IOStats != expected {
+		t.Fatalf("expected %+v, got %+v", expected, stats.IOStats)
+	}
+
+	if stats.ReadTime <= 0 || stats.WriteTime <= 0 || stats.SyncTime <= 0 {
+		t.Fatalf("expected time spent, got %+v", stats)
+	}
+
+	if StatsOf("missing.dat") != (FileStats{}) {
+		t.Fatal("expected no counters for a path without IO")
+	}
+
+	// A file created again starts over
+	f.Close()
+	os.Remove("test.dat")
+
+	f, err = OpenFile("test.dat", os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer f.Close()
+
+	if StatsOf("test.dat") != (FileStats{}) {
+		t.Fatalf("expected counters to start over, got %+v", StatsOf("test.dat"))
+	}
+}
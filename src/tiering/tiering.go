@@ -0,0 +1,125 @@
+// Package tiering
+// AriaSQL cold data tiering package
+// Copyright (C) AriaSQL
+// Author(s): Alex Gaetano Padula
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+package tiering
+
+import (
+	"ariasql/catalog"
+	"ariasql/core"
+	"errors"
+	"log"
+	"sync"
+	"time"
+)
+
+const DEFAULT_INTERVAL = time.Minute // Time between checks for tables not accessed if not configured
+
+// Mover moves the tables not accessed for ColdAfter to the cold tier
+// Tables are not moved while the server is read-only, a table moved back with MOVE TABLE is moved again
+// once it was not accessed for ColdAfter since.
+type Mover struct {
+	aria   *core.AriaSQL   // AriaSQL instance pointer
+	config *core.Tiering   // Tiering configuration
+	stop   chan struct{}   // Closed to stop checking
+	wg     *sync.WaitGroup // Checking goroutine
+}
+
+// New creates a mover for the configuration, checking starts with Start
+func New(aria *core.AriaSQL) (*Mover, error) {
+	if aria.Config.Tiering == nil {
+		return nil, errors.New("no tiering configured")
+	}
+
+	config := aria.Config.Tiering
+
+	if config.ColdDir == "" {
+		return nil, errors.New("tiering needs a cold directory")
+	}
+
+	if config.ColdAfter < 0 || config.Interval < 0 {
+		return nil, errors.New("tiering durations cannot be negative")
+	}
+
+	return &Mover{aria: aria, config: config, stop: make(chan struct{}), wg: &sync.WaitGroup{}}, nil
+}
+
+// Start starts checking for tables not accessed, nothing is moved without ColdAfter
+func (m *Mover) Start() {
+	if m.config.ColdAfter == 0 {
+		return
+	}
+
+	interval := DEFAULT_INTERVAL
+	if m.config.Interval > 0 {
+		interval = time.Duration(m.config.Interval) * time.Second
+	}
+
+	m.wg.Add(1)
+
+	go func() {
+		defer m.wg.Done()
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-m.stop:
+				return
+			case <-ticker.C:
+				m.check()
+			}
+		}
+	}()
+}
+
+// Close stops checking
+func (m *Mover) Close() {
+	close(m.stop)
+	m.wg.Wait()
+}
+
+// check moves the tables not accessed for ColdAfter to the cold tier, the tables moved are returned as database.table
+func (m *Mover) check() []string {
+	if m.aria.ReadOnly() != nil {
+		return nil
+	}
+
+	idle := time.Duration(m.config.ColdAfter) * time.Second
+	moved := make([]string, 0)
+
+	for _, name := range m.aria.Catalog.GetDatabases() {
+		db := m.aria.Catalog.GetDatabase(name)
+		if db == nil {
+			continue
+		}
+
+		for _, tbl := range db.IdleTables(idle) {
+			err := db.MoveTable(tbl, catalog.TIER_COLD)
+			if err != nil {
+				log.Printf("tiering: table %s of database %s not moved to the cold tier: %s", tbl, name, err.Error())
+				continue
+			}
+
+			log.Printf("tiering: moved table %s of database %s to the cold tier, not accessed for %s", tbl, name, idle)
+
+			moved = append(moved, name+"."+tbl)
+		}
+	}
+
+	return moved
+}
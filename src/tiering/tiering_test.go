@@ -0,0 +1,103 @@
+// Package tiering tests
+// Copyright (C) AriaSQL
+// Author(s): Alex Gaetano Padula
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+package tiering
+
+import (
+	"ariasql/catalog"
+	"ariasql/core"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestNew(t *testing.T) {
+	for _, config := range []*core.Tiering{
+		nil,
+		{},
+		{ColdDir: "./cold", ColdAfter: -1},
+	} {
+		_, err := New(&core.AriaSQL{Config: &core.Config{Tiering: config}})
+		if err == nil {
+			t.Fatalf("expected error for %+v", config)
+		}
+	}
+}
+
+func TestMover_check(t *testing.T) {
+	defer os.RemoveAll("./test/")
+	defer os.RemoveAll("./test_cold/")
+
+	aria := &core.AriaSQL{Config: &core.Config{DataDir: "./test", Tiering: &core.Tiering{ColdDir: "./test_cold", ColdAfter: 1}}}
+
+	aria.Catalog = catalog.New(aria.Config.DataDir)
+	aria.Catalog.ColdDirectory = aria.Config.Tiering.ColdDir
+
+	err := aria.Catalog.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer aria.Catalog.Close()
+
+	err = aria.Catalog.CreateDatabase("db1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db := aria.Catalog.GetDatabase("db1")
+
+	for _, name := range []string{"orders", "users"} {
+		err = db.CreateTable(name, &catalog.TableSchema{
+			ColumnDefinitions: map[string]*catalog.ColumnDefinition{"id": {DataType: "INT"}},
+		}, false, false, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	m, err := New(aria)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(m.check()) != 0 {
+		t.Fatal("expected no table to be moved before ColdAfter")
+	}
+
+	time.Sleep(1100 * time.Millisecond)
+
+	// A table accessed stays on the hot tier
+	db.GetTable("users")
+
+	moved := m.check()
+	if len(moved) != 1 || moved[0] != "db1.orders" {
+		t.Fatalf("expected orders to be moved, got %v", moved)
+	}
+
+	if db.Placement("orders").Tier != catalog.TIER_COLD || db.Placement("users").Tier != catalog.TIER_HOT {
+		t.Fatal("expected only orders on the cold tier")
+	}
+
+	// Nothing is moved while the server is read-only
+	time.Sleep(1100 * time.Millisecond)
+
+	aria.SetReadOnly("disk full")
+
+	if len(m.check()) != 0 {
+		t.Fatal("expected no table to be moved while read-only")
+	}
+}
@@ -0,0 +1,194 @@
+// Package tracing
+// AriaSQL tracing package
+// Copyright (C) AriaSQL
+// Author(s): Alex Gaetano Padula
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+package tracing
+
+import (
+	"ariasql/core"
+	"ariasql/shared"
+	"ariasql/storage"
+	"context"
+	"errors"
+	"fmt"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+)
+
+const TRACER_NAME = "ariasql"            // Instrumentation scope of AriaSQL spans
+const DEFAULT_SERVICE_NAME = "ariasql"   // Service name spans are exported under if not configured
+const MAX_STATEMENT_LENGTH = 2048        // Statements recorded on spans are truncated to this many bytes
+const SHUTDOWN_TIMEOUT = 5 * time.Second // How long Close waits for queued spans to be exported
+
+// traceparent matches a sqlcommenter comment carrying the trace of the application
+var traceparent = regexp.MustCompile(`/\*[^*]*traceparent='([^']+)'[^*]*\*/`)
+
+// Provider exports the spans of the process to an OTLP collector
+type Provider struct {
+	provider *sdktrace.TracerProvider // SDK provider spans are batched and exported by
+}
+
+// Span is a span which records the storage IO performed while it was open
+type Span struct {
+	trace.Span                 // The span
+	io         storage.IOStats // Storage IO counters when the span started
+}
+
+// New starts exporting spans to the OTLP endpoint configured, until then spans are dropped at little cost
+func New(aria *core.AriaSQL) (*Provider, error) {
+	if aria.Config.Tracing == nil || aria.Config.Tracing.Endpoint == "" {
+		return nil, errors.New("no tracing endpoint configured")
+	}
+
+	conf := aria.Config.Tracing
+
+	if conf.SampleRatio < 0 || conf.SampleRatio > 1 {
+		return nil, fmt.Errorf("sample ratio %v is not between 0 and 1", conf.SampleRatio)
+	}
+
+	options := []otlptracehttp.Option{otlptracehttp.WithEndpointURL(conf.Endpoint)}
+	if len(conf.Headers) > 0 {
+		options = append(options, otlptracehttp.WithHeaders(conf.Headers))
+	}
+
+	exporter, err := otlptracehttp.New(context.Background(), options...)
+	if err != nil {
+		return nil, err
+	}
+
+	serviceName := conf.ServiceName
+	if serviceName == "" {
+		serviceName = DEFAULT_SERVICE_NAME
+	}
+
+	// A query sampled by the application is always traced, others by the ratio configured
+	sampler := sdktrace.AlwaysSample()
+	if conf.SampleRatio > 0 {
+		sampler = sdktrace.TraceIDRatioBased(conf.SampleRatio)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithSampler(sdktrace.ParentBased(sampler)),
+		sdktrace.WithResource(resource.NewSchemaless(
+			attribute.String("service.name", serviceName),
+			attribute.String("service.version", shared.VERSION),
+		)),
+	)
+
+	otel.SetTracerProvider(provider)
+
+	return &Provider{provider: provider}, nil
+}
+
+// Close exports the spans still queued and stops exporting
+func (p *Provider) Close() error {
+	ctx, cancel := context.WithTimeout(context.Background(), SHUTDOWN_TIMEOUT)
+	defer cancel()
+
+	return p.provider.Shutdown(ctx)
+}
+
+// Start starts a span as a child of the span within ctx
+func Start(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, *Span) {
+	ctx, span := otel.Tracer(TRACER_NAME).Start(ctx, name, trace.WithAttributes(attrs...))
+
+	s := &Span{Span: span}
+
+	// Reading the counters is skipped for spans which are dropped
+	if span.IsRecording() {
+		s.io = storage.Stats()
+	}
+
+	return ctx, s
+}
+
+// End ends the span, recording the storage IO performed while it was open and err if not nil
+// The IO counters are of the process, with concurrent queries IO of other queries is included
+func (s *Span) End(err error) {
+	if !s.IsRecording() {
+		s.Span.End()
+		return
+	}
+
+	io := storage.Stats().Sub(s.io)
+
+	s.SetAttributes(
+		attribute.Int64("ariasql.io.reads", io.Reads),
+		attribute.Int64("ariasql.io.writes", io.Writes),
+		attribute.Int64("ariasql.io.bytes_read", io.BytesRead),
+		attribute.Int64("ariasql.io.bytes_written", io.BytesWritten),
+		attribute.Int64("ariasql.io.syncs", io.Syncs),
+	)
+
+	if err != nil {
+		s.RecordError(err)
+		s.SetStatus(codes.Error, err.Error())
+	}
+
+	s.Span.End()
+}
+
+// Extract returns ctx with the trace of the application which sent a query
+// The trace is read from a sqlcommenter comment within the query, /*traceparent='00-...-01'*/
+func Extract(ctx context.Context, query []byte) context.Context {
+	match := traceparent.FindSubmatch(query)
+	if match == nil {
+		return ctx
+	}
+
+	carrier := propagation.MapCarrier{"traceparent": string(match[1])}
+
+	return propagation.TraceContext{}.Extract(ctx, carrier)
+}
+
+// Statement returns a query as recorded on spans, truncated to MAX_STATEMENT_LENGTH bytes
+func Statement(query []byte) string {
+	statement := strings.TrimSpace(string(query))
+	if len(statement) > MAX_STATEMENT_LENGTH {
+		statement = statement[:MAX_STATEMENT_LENGTH]
+	}
+
+	return statement
+}
+
+// Operation returns the operation of a statement, CREATE TABLE for a *parser.CreateTableStmt
+func Operation(stmt interface{}) string {
+	name := fmt.Sprintf("%T", stmt)
+	name = name[strings.LastIndex(name, ".")+1:]
+	name = strings.TrimSuffix(name, "Stmt")
+
+	operation := strings.Builder{}
+	for i, r := range name {
+		if i > 0 && unicode.IsUpper(r) {
+			operation.WriteRune(' ')
+		}
+
+		operation.WriteRune(unicode.ToUpper(r))
+	}
+
+	return operation.String()
+}
@@ -0,0 +1,185 @@
+// Package tracing tests
+// Copyright (C) AriaSQL
+// Author(s): Alex Gaetano Padula
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+package tracing
+
+import (
+	"ariasql/core"
+	"ariasql/parser"
+	"context"
+	"errors"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	"google.golang.org/protobuf/proto"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestNew(t *testing.T) {
+	defer otel.SetTracerProvider(noop.NewTracerProvider())
+
+	lock := &sync.Mutex{}
+	requests := make([]*coltracepb.ExportTraceServiceRequest, 0)
+	headers := make([]string, 0)
+
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, err := io.ReadAll(req.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		request := &coltracepb.ExportTraceServiceRequest{}
+		err = proto.Unmarshal(body, request)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		lock.Lock()
+		requests = append(requests, request)
+		headers = append(headers, req.Header.Get("X-Api-Key"))
+		lock.Unlock()
+
+		w.Header().Set("Content-Type", "application/x-protobuf")
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer collector.Close()
+
+	aria := &core.AriaSQL{Config: &core.Config{Tracing: &core.Tracing{
+		Endpoint:    collector.URL + "/v1/traces",
+		Headers:     map[string]string{"X-Api-Key": "secret"},
+		ServiceName: "test",
+	}}}
+
+	provider, err := New(aria)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, query := Start(context.Background(), "query")
+	_, execute := Start(ctx, "execute SELECT")
+	execute.End(errors.New("table does not exist"))
+	query.End(nil)
+
+	err = provider.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lock.Lock()
+	defer lock.Unlock()
+
+	if len(requests) != 1 || headers[0] != "secret" {
+		t.Fatalf("expected 1 export with the configured header, got %d", len(requests))
+	}
+
+	spans := make(map[string]string)
+	for _, resourceSpans := range requests[0].ResourceSpans {
+		service := ""
+		for _, attr := range resourceSpans.Resource.Attributes {
+			if attr.Key == "service.name" {
+				service = attr.Value.GetStringValue()
+			}
+		}
+
+		if service != "test" {
+			t.Fatalf("expected service test, got %s", service)
+		}
+
+		for _, scopeSpans := range resourceSpans.ScopeSpans {
+			for _, span := range scopeSpans.Spans {
+				spans[span.Name] = span.Status.GetMessage()
+
+				io := false
+				for _, attr := range span.Attributes {
+					if attr.Key == "ariasql.io.reads" {
+						io = true
+					}
+				}
+
+				if !io {
+					t.Fatalf("expected IO attributes on %s", span.Name)
+				}
+			}
+		}
+	}
+
+	if len(spans) != 2 || spans["execute SELECT"] != "table does not exist" {
+		t.Fatalf("expected query and failed execute spans, got %v", spans)
+	}
+
+	_, err = New(&core.AriaSQL{Config: &core.Config{Tracing: &core.Tracing{Endpoint: collector.URL, SampleRatio: 2}}})
+	if err == nil {
+		t.Fatal("expected error for sample ratio")
+	}
+
+	_, err = New(&core.AriaSQL{Config: &core.Config{}})
+	if err == nil {
+		t.Fatal("expected error without endpoint")
+	}
+}
+
+func TestExtract(t *testing.T) {
+	q := []byte("SELECT * FROM users; /*application='shop',traceparent='00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01'*/")
+
+	spanContext := trace.SpanContextFromContext(Extract(context.Background(), q))
+	if !spanContext.IsRemote() || !spanContext.IsSampled() {
+		t.Fatal("expected remote sampled span context")
+	}
+
+	if spanContext.TraceID().String() != "0af7651916cd43dd8448eb211c80319c" || spanContext.SpanID().String() != "b7ad6b7169203331" {
+		t.Fatalf("unexpected span context %v", spanContext)
+	}
+
+	// The comment does not change the statement parsed
+	_, err := parser.NewParser(parser.NewLexer(q)).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if trace.SpanContextFromContext(Extract(context.Background(), []byte("SELECT 1;"))).IsValid() {
+		t.Fatal("expected no span context")
+	}
+}
+
+func TestStatement(t *testing.T) {
+	if Statement([]byte(" SELECT 1;\n")) != "SELECT 1;" {
+		t.Fatal("expected trimmed statement")
+	}
+
+	if len(Statement([]byte(strings.Repeat("a", MAX_STATEMENT_LENGTH+1)))) != MAX_STATEMENT_LENGTH {
+		t.Fatal("expected truncated statement")
+	}
+}
+
+func TestOperation(t *testing.T) {
+	for stmt, expected := range map[interface{}]string{
+		&parser.CreateTableStmt{}: "CREATE TABLE",
+		&parser.SelectStmt{}:      "SELECT",
+		&parser.NotifyStmt{}:      "NOTIFY",
+	} {
+		if Operation(stmt) != expected {
+			t.Fatalf("expected %s, got %s", expected, Operation(stmt))
+		}
+	}
+}
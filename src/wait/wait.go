@@ -0,0 +1,176 @@
+// Package wait
+// AriaSQL wait event package
+// Copyright (C) AriaSQL
+// Author(s): Alex Gaetano Padula
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+package wait
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Event is something a session waits on
+type Event int
+
+const (
+	CLIENT_READ   Event = iota // Waiting for the client to send the next query
+	WAL_WRITE                  // Appending to the write ahead log, including waiting for other appends
+	BTREE_LATCH                // Waiting for a page latch held by another reader or writer of a data or index file
+	INDEX_LOCK                 // Waiting for the lock of an index held by another lookup or update
+	SEQUENCE_LOCK              // Waiting for the sequence of a table held by another insert
+	EVENTS                     // Amount of events
+)
+
+// String returns the name of the event
+func (e Event) String() string {
+	switch e {
+	case CLIENT_READ:
+		return "client read"
+	case WAL_WRITE:
+		return "wal write"
+	case BTREE_LATCH:
+		return "btree latch"
+	case INDEX_LOCK:
+		return "index lock"
+	case SEQUENCE_LOCK:
+		return "sequence lock"
+	}
+
+	return "unknown"
+}
+
+// Stats are the cumulative waits on an event
+type Stats struct {
+	Event   Event         // The event
+	Waits   int64         // Amount of waits
+	Waiting int64         // Amount of waits in progress
+	Total   time.Duration // Time spent waiting
+	Max     time.Duration // Longest wait
+}
+
+// counters are the cumulative waits on an event
+type counters struct {
+	waits, waiting, total, max atomic.Int64
+}
+
+// record records a wait which took d
+func (c *counters) record(d time.Duration) {
+	c.waits.Add(1)
+	c.total.Add(int64(d))
+
+	for {
+		max := c.max.Load()
+		if int64(d) <= max || c.max.CompareAndSwap(max, int64(d)) {
+			return
+		}
+	}
+}
+
+// stats returns the counters of an event
+func (c *counters) stats(e Event) Stats {
+	return Stats{
+		Event:   e,
+		Waits:   c.waits.Load(),
+		Waiting: c.waiting.Load(),
+		Total:   time.Duration(c.total.Load()),
+		Max:     time.Duration(c.max.Load()),
+	}
+}
+
+var server [EVENTS]counters // Waits of the server on every event
+
+// Session is the waits of a session, a nil session only counts waits of the server
+type Session struct {
+	ID      uint64           // Session id
+	events  [EVENTS]counters // Waits of the session on every event
+	current atomic.Int32     // Event waited on plus one, 0 when not waiting
+	since   atomic.Int64     // Unix nanoseconds the current wait started at
+}
+
+// NewSession returns the waits of a new session
+func NewSession(id uint64) *Session {
+	return &Session{ID: id}
+}
+
+// Begin starts a wait on an event, the returned func ends it
+func (s *Session) Begin(e Event) func() {
+	start := time.Now()
+	server[e].waiting.Add(1)
+
+	if s != nil {
+		s.events[e].waiting.Add(1)
+		s.since.Store(start.UnixNano())
+		s.current.Store(int32(e) + 1)
+	}
+
+	return func() {
+		d := time.Since(start)
+
+		server[e].waiting.Add(-1)
+		server[e].record(d)
+
+		if s != nil {
+			s.current.Store(0)
+			s.events[e].waiting.Add(-1)
+			s.events[e].record(d)
+		}
+	}
+}
+
+// Current returns the event the session waits on and for how long, false if not waiting
+func (s *Session) Current() (Event, time.Duration, bool) {
+	current := s.current.Load()
+	if current == 0 {
+		return 0, 0, false
+	}
+
+	return Event(current - 1), time.Since(time.Unix(0, s.since.Load())), true
+}
+
+// Stats returns the cumulative waits of the session on every event
+func (s *Session) Stats() []Stats {
+	stats := make([]Stats, EVENTS)
+	for e := Event(0); e < EVENTS; e++ {
+		stats[e] = s.events[e].stats(e)
+	}
+
+	return stats
+}
+
+// ServerStats returns the cumulative waits of the server on every event since start up
+func ServerStats() []Stats {
+	stats := make([]Stats, EVENTS)
+	for e := Event(0); e < EVENTS; e++ {
+		stats[e] = server[e].stats(e)
+	}
+
+	return stats
+}
+
+// Lock locks l, a wait on e is counted if l is held by someone else
+func Lock(l interface {
+	sync.Locker
+	TryLock() bool
+}, e Event) {
+	if l.TryLock() {
+		return
+	}
+
+	end := (*Session)(nil).Begin(e)
+	l.Lock()
+	end()
+}
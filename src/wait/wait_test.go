@@ -0,0 +1,110 @@
+// Package wait tests
+// Copyright (C) AriaSQL
+// Author(s): Alex Gaetano Padula
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+package wait
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSession_Begin(t *testing.T) {
+	before := ServerStats()[WAL_WRITE]
+
+	s := NewSession(1)
+
+	end := s.Begin(WAL_WRITE)
+
+	event, _, waiting := s.Current()
+	if !waiting || event != WAL_WRITE {
+		t.Fatalf("expected waiting on wal write, got %s %v", event, waiting)
+	}
+
+	if s.Stats()[WAL_WRITE].Waiting != 1 || ServerStats()[WAL_WRITE].Waiting != before.Waiting+1 {
+		t.Fatal("expected wait in progress")
+	}
+
+	time.Sleep(time.Millisecond)
+	end()
+
+	_, _, waiting = s.Current()
+	if waiting {
+		t.Fatal("expected not waiting")
+	}
+
+	stats := s.Stats()[WAL_WRITE]
+	if stats.Waits != 1 || stats.Waiting != 0 || stats.Total < time.Millisecond || stats.Max != stats.Total {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+
+	server := ServerStats()[WAL_WRITE]
+	if server.Waits != before.Waits+1 || server.Total-before.Total != stats.Total {
+		t.Fatalf("expected wait counted for the server, got %+v", server)
+	}
+
+	// Waits without a session are only counted for the server
+	(*Session)(nil).Begin(WAL_WRITE)()
+
+	if ServerStats()[WAL_WRITE].Waits != before.Waits+2 || s.Stats()[WAL_WRITE].Waits != 1 {
+		t.Fatal("expected wait counted for the server only")
+	}
+}
+
+func TestLock(t *testing.T) {
+	before := ServerStats()[INDEX_LOCK].Waits
+
+	lock := &sync.Mutex{}
+
+	// Uncontended locks are not waits
+	Lock(lock, INDEX_LOCK)
+	lock.Unlock()
+
+	if ServerStats()[INDEX_LOCK].Waits != before {
+		t.Fatal("expected no wait")
+	}
+
+	lock.Lock()
+
+	locked := make(chan struct{})
+	go func() {
+		Lock(lock, INDEX_LOCK)
+		lock.Unlock()
+		close(locked)
+	}()
+
+	for ServerStats()[INDEX_LOCK].Waiting == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	lock.Unlock()
+	<-locked
+
+	if ServerStats()[INDEX_LOCK].Waits != before+1 {
+		t.Fatal("expected contended lock counted")
+	}
+
+	// Read write mutexes of pages are locked the same way
+	Lock(&sync.RWMutex{}, BTREE_LATCH)
+}
+
+func TestEvent_String(t *testing.T) {
+	for e := Event(0); e < EVENTS; e++ {
+		if e.String() == "unknown" {
+			t.Fatalf("expected name for event %d", e)
+		}
+	}
+}
@@ -18,13 +18,20 @@ package wal
 
 import (
 	"ariasql/catalog"
+	"ariasql/fault"
 	"ariasql/parser"
 	"ariasql/storage/btree"
 	"bytes"
 	"encoding/gob"
 	"errors"
+	"fmt"
 	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
+	"time"
 )
 
 // WAL is a write-ahead log file
@@ -34,9 +41,17 @@ type WAL struct {
 	// The file path for the WAL file
 	FilePath string
 	lock     *sync.Mutex // Lock for the WAL file
+	flags    int         // Flags the WAL file is opened with, again after a rotation
+	perm     os.FileMode // Permissions the WAL file is created with
 	// Every WAL contains ASTs to recover the database
 }
 
+// Segment is a WAL file rotated out by Rotate, named after the WAL file and the unix nanoseconds it was rotated at
+type Segment struct {
+	Path      string    // Path of the segment
+	RotatedAt time.Time // When the segment was rotated out
+}
+
 // OpenWAL opens a new WAL file
 func OpenWAL(filePath string, flags int, perm os.FileMode) (*WAL, error) {
 	wal, err := btree.OpenPager(filePath, flags, perm)
@@ -53,6 +68,9 @@ func OpenWAL(filePath string, flags int, perm os.FileMode) (*WAL, error) {
 	gob.Register(&parser.DeleteStmt{})
 	gob.Register(&parser.CreateIndexStmt{})
 	gob.Register(&parser.DropIndexStmt{})
+	gob.Register(&parser.AlterIndexStmt{})
+	gob.Register(&parser.CreateBloomFilterStmt{})
+	gob.Register(&parser.DropBloomFilterStmt{})
 	gob.Register(&parser.UseStmt{})
 	gob.Register(&parser.Literal{})
 	gob.Register(&parser.Identifier{})
@@ -62,6 +80,8 @@ func OpenWAL(filePath string, flags int, perm os.FileMode) (*WAL, error) {
 	gob.Register(&parser.DropProcedureStmt{})
 	gob.Register(&parser.CreateUserStmt{})
 	gob.Register(&parser.DropUserStmt{})
+	gob.Register(&parser.CreateShardStmt{})
+	gob.Register(&parser.DropShardStmt{})
 	gob.Register(&parser.RevokeStmt{})
 	gob.Register(&parser.GrantStmt{})
 	gob.Register(&parser.AlterUserStmt{})
@@ -108,6 +128,8 @@ func OpenWAL(filePath string, flags int, perm os.FileMode) (*WAL, error) {
 		file:     wal,
 		FilePath: filePath,
 		lock:     &sync.Mutex{},
+		flags:    flags,
+		perm:     perm,
 	}, nil
 }
 
@@ -116,16 +138,196 @@ func (w *WAL) Close() error {
 	return w.file.Close()
 }
 
+// Size returns the bytes of the WAL file
+func (w *WAL) Size() (int64, error) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	stat, err := os.Stat(w.FilePath)
+	if err != nil {
+		return 0, err
+	}
+
+	return stat.Size(), nil
+}
+
+// Rotate moves the entries of the WAL file to a new segment, the WAL file starts out empty
+// The segment is returned, nil if the WAL file held no entries
+func (w *WAL) Rotate() (*Segment, error) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	if w.file.Count() == 0 {
+		return nil, nil
+	}
+
+	err := w.file.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	segment := &Segment{Path: fmt.Sprintf("%s.%d", w.FilePath, now.UnixNano()), RotatedAt: now}
+
+	// The deleted and dirty pages of the WAL file go with it
+	for _, extension := range []string{"", btree.DELETED_PAGES_EXTENSION, btree.DIRTY_PAGES_EXTENSION} {
+		err = os.Rename(w.FilePath+extension, segment.Path+extension)
+		if err != nil && !os.IsNotExist(err) {
+			break
+		}
+
+		err = nil
+	}
+
+	file, openErr := btree.OpenPager(w.FilePath, w.flags, w.perm)
+	if openErr != nil {
+		return nil, openErr
+	}
+
+	w.file = file
+
+	if err != nil {
+		return nil, err
+	}
+
+	return segment, nil
+}
+
+// Entries returns the amount of entries within the WAL file
+func (w *WAL) Entries() (int64, error) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	entries := int64(0)
+
+	for i := int64(0); i < w.file.Count(); i++ {
+		data, err := w.file.GetPage(i)
+		if errors.Is(err, btree.ErrOverflowPage) {
+			continue
+		} else if err != nil {
+			return 0, err
+		}
+
+		if data != nil {
+			entries++
+		}
+	}
+
+	return entries, nil
+}
+
+// Segments returns the segments rotated out of a WAL file, oldest first
+func Segments(filePath string) ([]*Segment, error) {
+	matches, err := filepath.Glob(filePath + ".*")
+	if err != nil {
+		return nil, err
+	}
+
+	segments := make([]*Segment, 0)
+
+	for _, match := range matches {
+		// The deleted and dirty pages of a segment do not end in a timestamp
+		nanos, err := strconv.ParseInt(strings.TrimPrefix(match, filePath+"."), 10, 64)
+		if err != nil {
+			continue
+		}
+
+		segments = append(segments, &Segment{Path: match, RotatedAt: time.Unix(0, nanos)})
+	}
+
+	sort.Slice(segments, func(i, j int) bool {
+		return segments[i].RotatedAt.Before(segments[j].RotatedAt)
+	})
+
+	return segments, nil
+}
+
+// RemoveSegment removes a segment with its deleted and dirty pages
+func RemoveSegment(segment *Segment) error {
+	for _, extension := range []string{btree.DELETED_PAGES_EXTENSION, btree.DIRTY_PAGES_EXTENSION, ""} {
+		err := os.Remove(segment.Path + extension)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	return nil
+}
+
 // Append data to the WAL file
 func (w *WAL) Append(data []byte) error {
 	w.lock.Lock()
 	defer w.lock.Unlock()
-	_, err := w.file.Write(data)
+
+	err := fault.CrashPoint("wal.append.before")
 	if err != nil {
 		return err
 	}
 
-	return nil
+	_, err = w.file.Write(data)
+	if err != nil {
+		return err
+	}
+
+	return fault.CrashPoint("wal.append.after")
+}
+
+// Intact returns an error if the last entry of the WAL file was left part written, such as by a write failing on a full disk
+// Appending after such an entry would leave it unreadable, the WAL must be recovered first
+func (w *WAL) Intact() error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	f, err := os.Open(w.FilePath)
+	if err != nil {
+		return err
+	}
+
+	defer f.Close()
+
+	stat, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	pageSize := int64(btree.PAGE_SIZE + btree.HEADER_SIZE)
+
+	if stat.Size()%pageSize != 0 {
+		return fmt.Errorf("WAL file ends with a partial page of %d bytes", stat.Size()%pageSize)
+	}
+
+	pages := stat.Size() / pageSize
+	if pages == 0 {
+		return nil
+	}
+
+	// The last page ends the WAL, or continues an entry within it.  The overflow pages of an entry follow the page it
+	// starts at and are written before it, a crash can leave the pages before them without a header
+	header := make([]byte, btree.HEADER_SIZE)
+
+	for page := pages - 1; page >= 0; page-- {
+		_, err = f.ReadAt(header, page*pageSize)
+		if err != nil {
+			return err
+		}
+
+		overflow, next, err := btree.PageHeader(header)
+		if err != nil && page == pages-1 {
+			return errors.New("last page of the WAL file has no header")
+		} else if err != nil {
+			return fmt.Errorf("page %d of the last entry of the WAL file has no header", page)
+		}
+
+		if next >= pages {
+			return fmt.Errorf("last entry of the WAL file continues on page %d past the end of the file", next)
+		}
+
+		if !overflow {
+			return nil
+		}
+	}
+
+	return errors.New("last entry of the WAL file has no first page")
 }
 
 // Encode ASTs to be written to the WAL file
@@ -189,6 +391,27 @@ func (w *WAL) Encode(stmt interface{}) []byte {
 			return nil
 		}
 
+	case *parser.AlterIndexStmt:
+		enc := gob.NewEncoder(buff)
+		err := enc.Encode(stmt)
+		if err != nil {
+			return nil
+		}
+
+	case *parser.CreateBloomFilterStmt:
+		enc := gob.NewEncoder(buff)
+		err := enc.Encode(stmt)
+		if err != nil {
+			return nil
+		}
+
+	case *parser.DropBloomFilterStmt:
+		enc := gob.NewEncoder(buff)
+		err := enc.Encode(stmt)
+		if err != nil {
+			return nil
+		}
+
 	case *parser.UseStmt:
 		enc := gob.NewEncoder(buff)
 		err := enc.Encode(stmt)
@@ -217,6 +440,20 @@ func (w *WAL) Encode(stmt interface{}) []byte {
 			return nil
 		}
 
+	case *parser.CreateShardStmt:
+		enc := gob.NewEncoder(buff)
+		err := enc.Encode(stmt)
+		if err != nil {
+			return nil
+		}
+
+	case *parser.DropShardStmt:
+		enc := gob.NewEncoder(buff)
+		err := enc.Encode(stmt)
+		if err != nil {
+			return nil
+		}
+
 	case *parser.GrantStmt:
 		enc := gob.NewEncoder(buff)
 		err := enc.Encode(stmt)
@@ -515,6 +752,9 @@ func (w *WAL) Decode(data []byte) interface{} {
 
 	stmtTypes := []interface{}{
 		&parser.InsertStmt{},
+		&parser.AlterIndexStmt{}, // Before statements it shares fields with
+		&parser.CreateBloomFilterStmt{},
+		&parser.DropBloomFilterStmt{},
 		&parser.CreateDatabaseStmt{},
 		&parser.CreateTableStmt{},
 		&parser.DropTableStmt{},
@@ -526,6 +766,8 @@ func (w *WAL) Decode(data []byte) interface{} {
 		&parser.AlterUserStmt{},
 		&parser.CreateUserStmt{},
 		&parser.DropUserStmt{},
+		&parser.CreateShardStmt{},
+		&parser.DropShardStmt{},
 		&parser.GrantStmt{},
 		&parser.RevokeStmt{},
 		&parser.ExecStmt{},
@@ -624,6 +866,45 @@ func (w *WAL) Decode(data []byte) interface{} {
 				continue
 			}
 
+			return stmt
+		case *parser.AlterIndexStmt:
+			dec := gob.NewDecoder(bytes.NewBuffer(data))
+			stmt := &parser.AlterIndexStmt{}
+			err := dec.Decode(stmt)
+			if err != nil {
+				continue
+			}
+
+			if stmt.NewName == nil && stmt.Visibility == 0 {
+				continue
+			}
+
+			return stmt
+		case *parser.CreateBloomFilterStmt:
+			dec := gob.NewDecoder(bytes.NewBuffer(data))
+			stmt := &parser.CreateBloomFilterStmt{}
+			err := dec.Decode(stmt)
+			if err != nil {
+				continue
+			}
+
+			if stmt.FilterName == nil || stmt.ColumnName == nil {
+				continue
+			}
+
+			return stmt
+		case *parser.DropBloomFilterStmt:
+			dec := gob.NewDecoder(bytes.NewBuffer(data))
+			stmt := &parser.DropBloomFilterStmt{}
+			err := dec.Decode(stmt)
+			if err != nil {
+				continue
+			}
+
+			if stmt.FilterName == nil {
+				continue
+			}
+
 			return stmt
 		case *parser.DropIndexStmt:
 			dec := gob.NewDecoder(bytes.NewBuffer(data))
@@ -663,6 +944,32 @@ func (w *WAL) Decode(data []byte) interface{} {
 				continue
 			}
 
+			return stmt
+		case *parser.CreateShardStmt:
+			dec := gob.NewDecoder(bytes.NewBuffer(data))
+			stmt := &parser.CreateShardStmt{}
+			err := dec.Decode(stmt)
+			if err != nil {
+				continue
+			}
+
+			if stmt.ShardName == nil || stmt.Address == nil {
+				continue
+			}
+
+			return stmt
+		case *parser.DropShardStmt:
+			dec := gob.NewDecoder(bytes.NewBuffer(data))
+			stmt := &parser.DropShardStmt{}
+			err := dec.Decode(stmt)
+			if err != nil {
+				continue
+			}
+
+			if stmt.ShardName == nil {
+				continue
+			}
+
 			return stmt
 		case *parser.GrantStmt:
 			dec := gob.NewDecoder(bytes.NewBuffer(data))
@@ -744,7 +1051,9 @@ func (w *WAL) RecoverASTs() ([]interface{}, error) {
 
 	for i := 0; i < int(pages); i++ {
 		data, err := w.file.GetPage(int64(i))
-		if err != nil {
+		if errors.Is(err, btree.ErrOverflowPage) {
+			continue
+		} else if err != nil {
 			return nil, err
 		}
 
@@ -767,6 +1076,12 @@ func (w *WAL) RecoverASTs() ([]interface{}, error) {
 				stmts = append(stmts, stmt)
 			case *parser.DropIndexStmt:
 				stmts = append(stmts, stmt)
+			case *parser.AlterIndexStmt:
+				stmts = append(stmts, stmt)
+			case *parser.CreateBloomFilterStmt:
+				stmts = append(stmts, stmt)
+			case *parser.DropBloomFilterStmt:
+				stmts = append(stmts, stmt)
 			case *parser.UseStmt:
 				stmts = append(stmts, stmt)
 			case *parser.AlterUserStmt:
@@ -775,6 +1090,10 @@ func (w *WAL) RecoverASTs() ([]interface{}, error) {
 				stmts = append(stmts, stmt)
 			case *parser.DropUserStmt:
 				stmts = append(stmts, stmt)
+			case *parser.CreateShardStmt:
+				stmts = append(stmts, stmt)
+			case *parser.DropShardStmt:
+				stmts = append(stmts, stmt)
 			case *parser.GrantStmt:
 				stmts = append(stmts, stmt)
 			case *parser.RevokeStmt:
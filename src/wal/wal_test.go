@@ -36,6 +36,7 @@ func TestOpenWAL(t *testing.T) {
 func TestWAL_Append(t *testing.T) {
 	defer os.Remove("wal.dat")
 	defer os.Remove("wal.dat.del")
+	defer os.Remove("wal.dat.dirty")
 
 	wal, err := OpenWAL("wal.dat", os.O_CREATE|os.O_RDWR, 0644)
 	if err != nil {
@@ -53,6 +54,7 @@ func TestWAL_Append(t *testing.T) {
 func TestWAL_RecoverASTs(t *testing.T) {
 	defer os.Remove("wal.dat")
 	defer os.Remove("wal.dat.del")
+	defer os.Remove("wal.dat.dirty")
 
 	wal, err := OpenWAL("wal.dat", os.O_CREATE|os.O_RDWR, 0644)
 	if err != nil {
@@ -0,0 +1,222 @@
+// Package watchdog
+// AriaSQL resource watchdog package
+// Copyright (C) AriaSQL
+// Author(s): Alex Gaetano Padula
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+package watchdog
+
+import (
+	"ariasql/core"
+	"bytes"
+	"cmp"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const POLICY_LARGEST = "LARGEST"                // Cancel the query which read the most bytes of rows
+const POLICY_NEWEST = "NEWEST"                  // Cancel the query which started last
+const POLICY_ALL = "ALL"                        // Cancel every running query
+const DEFAULT_INTERVAL = 500 * time.Millisecond // Time between samples if not configured
+
+// Watchdog samples the resident memory of the process and cancels queries while it is over the limit
+// One query is cancelled at a time with the LARGEST and NEWEST policies, the next only once the cancelled
+// query ended and memory is still over the limit
+type Watchdog struct {
+	aria   *core.AriaSQL         // AriaSQL instance pointer
+	config *core.Watchdog        // Watchdog configuration
+	rss    func() (int64, error) // Reads the resident memory of the process
+	stop   chan struct{}         // Closed to stop sampling
+	wg     *sync.WaitGroup       // Sampling goroutine
+}
+
+// New creates a watchdog for the configuration, sampling starts with Start
+func New(aria *core.AriaSQL) (*Watchdog, error) {
+	if aria.Config.Watchdog == nil {
+		return nil, errors.New("no watchdog configured")
+	}
+
+	config := aria.Config.Watchdog
+
+	switch strings.ToUpper(config.Policy) {
+	case "", POLICY_LARGEST, POLICY_NEWEST, POLICY_ALL:
+	default:
+		return nil, fmt.Errorf("unknown watchdog policy %s, expected %s, %s or %s", config.Policy, POLICY_LARGEST, POLICY_NEWEST, POLICY_ALL)
+	}
+
+	if config.MaxMemory < 0 || config.MaxQueryBytes < 0 || config.Interval < 0 {
+		return nil, errors.New("watchdog limits cannot be negative")
+	}
+
+	return &Watchdog{aria: aria, config: config, rss: RSS, stop: make(chan struct{}), wg: &sync.WaitGroup{}}, nil
+}
+
+// Start starts sampling memory, nothing is sampled without MaxMemory
+func (w *Watchdog) Start() {
+	if w.config.MaxMemory == 0 {
+		return
+	}
+
+	interval := DEFAULT_INTERVAL
+	if w.config.Interval > 0 {
+		interval = time.Duration(w.config.Interval) * time.Millisecond
+	}
+
+	w.wg.Add(1)
+
+	go func() {
+		defer w.wg.Done()
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-w.stop:
+				return
+			case <-ticker.C:
+				w.check()
+			}
+		}
+	}()
+}
+
+// Close stops sampling
+func (w *Watchdog) Close() {
+	close(w.stop)
+	w.wg.Wait()
+}
+
+// check samples memory and cancels queries if it is over the limit, the queries cancelled are returned
+func (w *Watchdog) check() []*core.Query {
+	rss, err := w.rss()
+	if err != nil {
+		log.Printf("watchdog: %s", err.Error())
+		return nil
+	}
+
+	if rss <= w.config.MaxMemory {
+		return nil
+	}
+
+	// Memory freed by queries which ended may not be returned to the system yet
+	debug.FreeOSMemory()
+
+	rss, err = w.rss()
+	if err != nil || rss <= w.config.MaxMemory {
+		return nil
+	}
+
+	queries, cancelled := w.queries()
+
+	// The query cancelled last is still releasing its memory
+	if cancelled && strings.ToUpper(w.config.Policy) != POLICY_ALL {
+		return nil
+	}
+
+	victims := pick(queries, w.config.Policy)
+	reason := fmt.Sprintf("server memory %d bytes over the limit of %d bytes", rss, w.config.MaxMemory)
+
+	for _, victim := range victims {
+		victim.query.Cancel(reason)
+		log.Printf("watchdog: memory %d bytes over %d bytes, cancelled query of %s which read %d bytes: %s", rss, w.config.MaxMemory, victim.client, victim.query.Bytes(), victim.query.Text)
+	}
+
+	cancel := make([]*core.Query, len(victims))
+	for i, victim := range victims {
+		cancel[i] = victim.query
+	}
+
+	return cancel
+}
+
+// running is a query running on a channel
+type running struct {
+	query  *core.Query // The query
+	client string      // Client executing it
+}
+
+// queries returns the queries running, and true if one of them is cancelled
+func (w *Watchdog) queries() ([]*running, bool) {
+	w.aria.ChannelsLock.Lock()
+	defer w.aria.ChannelsLock.Unlock()
+
+	queries := make([]*running, 0)
+	cancelled := false
+
+	for _, ch := range w.aria.Channels {
+		query := ch.Query()
+		if query == nil || ch.User == nil {
+			continue
+		}
+
+		if query.Err() != nil {
+			cancelled = true
+			continue
+		}
+
+		queries = append(queries, &running{query: query, client: ch.Client()})
+	}
+
+	return queries, cancelled
+}
+
+// pick returns the queries cancelled by a policy
+func pick(queries []*running, policy string) []*running {
+	if len(queries) == 0 {
+		return nil
+	}
+
+	switch strings.ToUpper(policy) {
+	case POLICY_ALL:
+		return queries
+	case POLICY_NEWEST:
+		return []*running{slices.MaxFunc(queries, func(a, b *running) int { return a.query.Started.Compare(b.query.Started) })}
+	}
+
+	return []*running{slices.MaxFunc(queries, func(a, b *running) int { return cmp.Compare(a.query.Bytes(), b.query.Bytes()) })}
+}
+
+// RSS returns the resident memory of the process in bytes
+// It is read from /proc on Linux, elsewhere the memory obtained from the system by the Go runtime is returned
+func RSS() (int64, error) {
+	statm, err := os.ReadFile("/proc/self/statm")
+	if err != nil {
+		stats := &runtime.MemStats{}
+		runtime.ReadMemStats(stats)
+
+		return int64(stats.Sys), nil
+	}
+
+	fields := bytes.Fields(statm)
+	if len(fields) < 2 {
+		return 0, errors.New("unexpected /proc/self/statm")
+	}
+
+	pages, err := strconv.ParseInt(string(fields[1]), 10, 64)
+	if err != nil {
+		return 0, err
+	}
+
+	return pages * int64(os.Getpagesize()), nil
+}
@@ -0,0 +1,124 @@
+// Package watchdog tests
+// Copyright (C) AriaSQL
+// Author(s): Alex Gaetano Padula
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+package watchdog
+
+import (
+	"ariasql/catalog"
+	"ariasql/core"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestNew(t *testing.T) {
+	for _, config := range []*core.Watchdog{{Policy: "OLDEST"}, {MaxMemory: -1}} {
+		_, err := New(&core.AriaSQL{Config: &core.Config{Watchdog: config}})
+		if err == nil {
+			t.Fatalf("expected error for %+v", config)
+		}
+	}
+
+	_, err := New(&core.AriaSQL{Config: &core.Config{}})
+	if err == nil {
+		t.Fatal("expected error without a watchdog configured")
+	}
+}
+
+func TestWatchdog_check(t *testing.T) {
+	aria := &core.AriaSQL{
+		Config:       &core.Config{Watchdog: &core.Watchdog{MaxMemory: 1000}},
+		Channels:     make([]*core.Channel, 0),
+		ChannelsLock: &sync.Mutex{},
+	}
+
+	user := &catalog.User{Username: "alex"}
+
+	small := aria.OpenChannel(user).BeginQuery("SELECT * FROM small")
+	small.Read(100)
+
+	large := aria.OpenChannel(user).BeginQuery("SELECT * FROM large")
+	large.Read(5000)
+
+	// A channel not executing a query
+	aria.OpenChannel(user)
+
+	w, err := New(aria)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rss := int64(500)
+	w.rss = func() (int64, error) { return rss, nil }
+
+	if len(w.check()) != 0 {
+		t.Fatal("expected no query cancelled under the limit")
+	}
+
+	// The query which read the most is cancelled first
+	rss = 2000
+
+	cancelled := w.check()
+	if len(cancelled) != 1 || cancelled[0] != large || !errors.Is(large.Err(), core.ErrQueryCancelled) || small.Err() != nil {
+		t.Fatalf("expected the large query to be cancelled, got %v", cancelled)
+	}
+
+	// Nothing else is cancelled until the cancelled query ended
+	if len(w.check()) != 0 {
+		t.Fatal("expected no query cancelled while the cancelled query runs")
+	}
+
+	aria.Channels[1].EndQuery()
+
+	cancelled = w.check()
+	if len(cancelled) != 1 || cancelled[0] != small {
+		t.Fatalf("expected the small query to be cancelled, got %v", cancelled)
+	}
+}
+
+func TestPick(t *testing.T) {
+	older := &core.Query{Started: time.Now().Add(-time.Minute)}
+	older.Read(500)
+
+	newer := &core.Query{Started: time.Now()}
+	newer.Read(10)
+
+	queries := []*running{{query: older}, {query: newer}}
+
+	if picked := pick(queries, ""); len(picked) != 1 || picked[0].query != older {
+		t.Fatalf("expected the largest query, got %v", picked)
+	}
+
+	if picked := pick(queries, "newest"); len(picked) != 1 || picked[0].query != newer {
+		t.Fatalf("expected the newest query, got %v", picked)
+	}
+
+	if picked := pick(queries, POLICY_ALL); len(picked) != 2 {
+		t.Fatalf("expected every query, got %v", picked)
+	}
+}
+
+func TestRSS(t *testing.T) {
+	rss, err := RSS()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if rss <= 0 {
+		t.Fatalf("expected resident memory, got %d", rss)
+	}
+}
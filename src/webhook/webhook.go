@@ -0,0 +1,264 @@
+// Package webhook
+// AriaSQL webhook notification package
+// Copyright (C) AriaSQL
+// Author(s): Alex Gaetano Padula
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+package webhook
+
+import (
+	"ariasql/catalog"
+	"ariasql/core"
+	"ariasql/shared"
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const QUEUE_SIZE = 1024                        // Events queued per webhook, events are dropped when the queue is full
+const DEFAULT_TIMEOUT = 10 * time.Second       // Default request timeout
+const RETRY_BACKOFF = 500 * time.Millisecond   // Wait before the first retry, doubled on every retry
+const MAX_RETRY_BACKOFF = 30 * time.Second     // Longest wait between retries
+const SIGNATURE_HEADER = "X-AriaSQL-Signature" // HMAC-SHA256 of the body, sha256=hex
+const EVENT_HEADER = "X-AriaSQL-Event"         // Operation of the event
+const DELIVERY_HEADER = "X-AriaSQL-Delivery"   // Id of the event, the same for every attempt
+
+// Dispatcher posts row changes to the configured webhooks
+// Every webhook has its own queue and delivers its events in order.  Delivery is best effort,
+// events still queued when the dispatcher is closed and events failing every retry are dropped.
+type Dispatcher struct {
+	hooks []*hook         // Configured webhooks
+	stop  chan struct{}   // Closed to stop delivering
+	wg    *sync.WaitGroup // Delivery workers
+	once  *sync.Once      // Closes stop once
+}
+
+// hook is a configured webhook and its queue
+type hook struct {
+	config *core.Webhook // Webhook configuration
+	queue  chan *Event   // Events waiting to be delivered
+	client *http.Client  // HTTP client
+}
+
+// Event is the JSON payload posted to a webhook
+type Event struct {
+	ID        string                   `json:"id"`        // Unique id of the event
+	Database  string                   `json:"database"`  // Database of the changed table
+	Table     string                   `json:"table"`     // Changed table
+	Operation string                   `json:"operation"` // INSERT, UPDATE or DELETE
+	Timestamp time.Time                `json:"timestamp"` // Time of the change
+	Rows      []map[string]interface{} `json:"rows"`      // Inserted rows, updated rows with their new values or deleted rows
+}
+
+// New creates a dispatcher for the webhooks of the configuration and starts delivering
+func New(aria *core.AriaSQL) (*Dispatcher, error) {
+	if len(aria.Config.Webhooks) == 0 {
+		return nil, errors.New("no webhooks configured")
+	}
+
+	d := &Dispatcher{
+		hooks: make([]*hook, 0),
+		stop:  make(chan struct{}),
+		wg:    &sync.WaitGroup{},
+		once:  &sync.Once{},
+	}
+
+	for _, config := range aria.Config.Webhooks {
+		if !strings.HasPrefix(config.URL, "http://") && !strings.HasPrefix(config.URL, "https://") {
+			return nil, fmt.Errorf("webhook url %s must be http or https", config.URL)
+		}
+
+		for _, op := range config.Operations {
+			switch strings.ToUpper(op) {
+			case "INSERT", "UPDATE", "DELETE":
+			default:
+				return nil, fmt.Errorf("webhook operation %s must be INSERT, UPDATE or DELETE", op)
+			}
+		}
+
+		timeout := DEFAULT_TIMEOUT
+		if config.Timeout > 0 {
+			timeout = time.Duration(config.Timeout) * time.Millisecond
+		}
+
+		d.hooks = append(d.hooks, &hook{
+			config: config,
+			queue:  make(chan *Event, QUEUE_SIZE),
+			client: &http.Client{Timeout: timeout},
+		})
+	}
+
+	for _, h := range d.hooks {
+		d.wg.Add(1)
+		go d.deliver(h)
+	}
+
+	return d, nil
+}
+
+// Notify queues the changed rows of a table for the webhooks matching the database, table and operation
+func (d *Dispatcher) Notify(database string, table string, operation string, rows []map[string]interface{}) {
+	var event *Event
+
+	for _, h := range d.hooks {
+		if !h.matches(database, table, operation) {
+			continue
+		}
+
+		if event == nil {
+			event = &Event{
+				ID:        uuid.New().String(),
+				Database:  database,
+				Table:     table,
+				Operation: operation,
+				Timestamp: time.Now().UTC(),
+				Rows:      make([]map[string]interface{}, 0),
+			}
+
+			for _, row := range rows {
+				event.Rows = append(event.Rows, catalog.CopyRow(&row))
+			}
+
+			shared.RemoveSingleQuotesFromResult(&event.Rows)
+		}
+
+		select {
+		case h.queue <- event:
+		default:
+			log.Printf("webhook %s: queue full, %s event %s on %s.%s dropped", h.config.URL, operation, event.ID, database, table)
+		}
+	}
+}
+
+// Close stops delivering, events still queued are dropped
+func (d *Dispatcher) Close() {
+	d.once.Do(func() {
+		close(d.stop)
+	})
+
+	d.wg.Wait()
+}
+
+// matches returns true if the webhook is configured for the database, table and operation
+func (h *hook) matches(database string, table string, operation string) bool {
+	if h.config.Database != "" && h.config.Database != database {
+		return false
+	}
+
+	if h.config.Table != "" && h.config.Table != table {
+		return false
+	}
+
+	if len(h.config.Operations) == 0 {
+		return true
+	}
+
+	for _, op := range h.config.Operations {
+		if strings.ToUpper(op) == operation {
+			return true
+		}
+	}
+
+	return false
+}
+
+// deliver posts the queued events of a webhook until the dispatcher is closed
+func (d *Dispatcher) deliver(h *hook) {
+	defer d.wg.Done()
+
+	for {
+		select {
+		case <-d.stop:
+			return
+		case event := <-h.queue:
+			body, err := json.Marshal(event)
+			if err != nil {
+				log.Printf("webhook %s: %s", h.config.URL, err.Error())
+				continue
+			}
+
+			backoff := RETRY_BACKOFF
+
+			for attempt := 0; ; attempt++ {
+				err = h.post(event, body)
+				if err == nil {
+					break
+				}
+
+				if attempt >= h.config.Retries {
+					log.Printf("webhook %s: %s event %s on %s.%s dropped after %d attempts: %s", h.config.URL, event.Operation, event.ID, event.Database, event.Table, attempt+1, err.Error())
+					break
+				}
+
+				select {
+				case <-d.stop:
+					return
+				case <-time.After(backoff):
+				}
+
+				backoff *= 2
+				if backoff > MAX_RETRY_BACKOFF {
+					backoff = MAX_RETRY_BACKOFF
+				}
+			}
+		}
+	}
+}
+
+// post posts an event to the webhook, a response other than 2xx is an error
+func (h *hook) post(event *Event, body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, h.config.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EVENT_HEADER, event.Operation)
+	req.Header.Set(DELIVERY_HEADER, event.ID)
+
+	if h.config.Secret != "" {
+		req.Header.Set(SIGNATURE_HEADER, Sign(h.config.Secret, body))
+	}
+
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return err
+	}
+
+	resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	return nil
+}
+
+// Sign returns the signature of a payload, receivers compute it over the raw request body with the shared secret and compare
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
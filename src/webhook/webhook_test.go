@@ -0,0 +1,310 @@
+// Package webhook tests
+// Copyright (C) AriaSQL
+// Author(s): Alex Gaetano Padula
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Affero General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU Affero General Public License for more details.
+//
+// You should have received a copy of the GNU Affero General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+package webhook
+
+import (
+	"ariasql/catalog"
+	"ariasql/core"
+	"ariasql/executor"
+	"ariasql/parser"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+// receiver is a webhook endpoint recording the events posted to it
+type receiver struct {
+	server   *httptest.Server
+	lock     *sync.Mutex
+	events   []*Event
+	failures int // Requests to fail with a 500 before accepting
+	attempts int
+	err      error
+}
+
+// newReceiver starts a webhook endpoint checking signatures with secret
+func newReceiver(secret string, failures int) *receiver {
+	r := &receiver{lock: &sync.Mutex{}, failures: failures}
+
+	r.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		r.lock.Lock()
+		defer r.lock.Unlock()
+
+		r.attempts++
+
+		body, err := io.ReadAll(req.Body)
+		if err != nil {
+			r.err = err
+			return
+		}
+
+		if secret != "" && req.Header.Get(SIGNATURE_HEADER) != Sign(secret, body) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		if r.failures > 0 {
+			r.failures--
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		event := &Event{}
+		err = json.Unmarshal(body, event)
+		if err != nil {
+			r.err = err
+			return
+		}
+
+		if req.Header.Get(EVENT_HEADER) != event.Operation || req.Header.Get(DELIVERY_HEADER) != event.ID {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		r.events = append(r.events, event)
+	}))
+
+	return r
+}
+
+// wait waits for n events to be received
+func (r *receiver) wait(t *testing.T, n int) []*Event {
+	deadline := time.Now().Add(10 * time.Second)
+
+	for time.Now().Before(deadline) {
+		r.lock.Lock()
+		if r.err != nil {
+			r.lock.Unlock()
+			t.Fatal(r.err)
+		}
+
+		if len(r.events) >= n {
+			events := r.events
+			r.lock.Unlock()
+			return events
+		}
+		r.lock.Unlock()
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	t.Fatalf("expected %d events", n)
+	return nil
+}
+
+// startInstance opens an AriaSQL instance with the webhooks and a shop database
+func startInstance(t *testing.T, dataDir string, webhooks []*core.Webhook) (*Dispatcher, *executor.Executor) {
+	aria, err := core.New(&core.Config{DataDir: dataDir})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	aria.Config.Webhooks = webhooks
+
+	aria.Catalog = catalog.New(dataDir)
+
+	err = aria.Catalog.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	aria.Channels = make([]*core.Channel, 0)
+	aria.ChannelsLock = &sync.Mutex{}
+
+	d, err := New(aria)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	aria.Notifier = d
+
+	ex := executor.New(aria, aria.OpenChannel(aria.Catalog.GetUser("admin")))
+
+	for _, stmt := range []string{
+		"CREATE DATABASE shop;",
+		"USE shop;",
+		"CREATE TABLE items (sku CHAR(32) NOT NULL UNIQUE, qty INT);",
+		"CREATE TABLE orders (id INT PRIMARY KEY, sku CHAR(32));",
+	} {
+		execute(t, ex, stmt)
+	}
+
+	t.Cleanup(func() {
+		d.Close()
+		aria.Catalog.Close()
+	})
+
+	return d, ex
+}
+
+// execute parses and executes a statement
+func execute(t *testing.T, ex *executor.Executor, stmt string) {
+	p := parser.NewParser(parser.NewLexer([]byte(stmt)))
+
+	ast, err := p.Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = ex.Execute(ast)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDispatcher_Notify(t *testing.T) {
+	defer os.RemoveAll("./test")
+
+	all := newReceiver("secret", 0)
+	defer all.server.Close()
+
+	deletes := newReceiver("", 0)
+	defer deletes.server.Close()
+
+	_, ex := startInstance(t, "./test", []*core.Webhook{
+		{URL: all.server.URL, Secret: "secret", Database: "shop", Table: "items"},
+		{URL: deletes.server.URL, Table: "items", Operations: []string{"delete"}},
+	})
+
+	execute(t, ex, "INSERT INTO items (sku, qty) VALUES ('a', 1), ('b', 2);")
+	execute(t, ex, "INSERT INTO orders (sku) VALUES ('a');")
+	execute(t, ex, "UPDATE items SET qty = 5 WHERE sku = 'a';")
+	execute(t, ex, "DELETE FROM items WHERE sku = 'b';")
+
+	events := all.wait(t, 3)
+
+	if len(events) != 3 {
+		t.Fatalf("expected 3 events, got %d", len(events))
+	}
+
+	for i, op := range []string{"INSERT", "UPDATE", "DELETE"} {
+		if events[i].Operation != op || events[i].Database != "shop" || events[i].Table != "items" {
+			t.Fatalf("expected %s on shop.items, got %s on %s.%s", op, events[i].Operation, events[i].Database, events[i].Table)
+		}
+	}
+
+	if len(events[0].Rows) != 2 || events[0].Rows[0]["sku"] != "a" || events[0].Rows[1]["qty"] != float64(2) {
+		t.Fatalf("unexpected inserted rows %v", events[0].Rows)
+	}
+
+	if len(events[1].Rows) != 1 || events[1].Rows[0]["sku"] != "a" || events[1].Rows[0]["qty"] != float64(5) {
+		t.Fatalf("unexpected updated rows %v", events[1].Rows)
+	}
+
+	if len(events[2].Rows) != 1 || events[2].Rows[0]["sku"] != "b" {
+		t.Fatalf("unexpected deleted rows %v", events[2].Rows)
+	}
+
+	events = deletes.wait(t, 1)
+
+	if len(events) != 1 || events[0].Operation != "DELETE" || events[0].Rows[0]["sku"] != "b" {
+		t.Fatalf("expected only the delete, got %v", events)
+	}
+
+	// Changes of a transaction are posted once it commits, a transaction rolled back by a failing statement posts none
+	execute(t, ex, "BEGIN;")
+	execute(t, ex, "INSERT INTO items (sku, qty) VALUES ('c', 3);")
+	execute(t, ex, "INSERT INTO items (sku, qty) VALUES ('a', 1);")
+
+	ast, err := parser.NewParser(parser.NewLexer([]byte("COMMIT;"))).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = ex.Execute(ast)
+	if err == nil {
+		t.Fatal("expected commit to fail on a duplicate sku")
+	}
+
+	execute(t, ex, "BEGIN;")
+	execute(t, ex, "INSERT INTO items (sku, qty) VALUES ('d', 4);")
+	execute(t, ex, "COMMIT;")
+
+	events = all.wait(t, 4)
+
+	time.Sleep(100 * time.Millisecond)
+
+	all.lock.Lock()
+	events = all.events
+	all.lock.Unlock()
+
+	if len(events) != 4 || events[3].Operation != "INSERT" || events[3].Rows[0]["sku"] != "d" {
+		t.Fatalf("expected the commited insert, got %v", events)
+	}
+}
+
+func TestDispatcher_Retry(t *testing.T) {
+	defer os.RemoveAll("./test")
+
+	r := newReceiver("", 2)
+	defer r.server.Close()
+
+	_, ex := startInstance(t, "./test", []*core.Webhook{
+		{URL: r.server.URL, Retries: 2},
+	})
+
+	execute(t, ex, "INSERT INTO items (sku, qty) VALUES ('a', 1);")
+
+	events := r.wait(t, 1)
+
+	if events[0].Rows[0]["sku"] != "a" {
+		t.Fatalf("unexpected rows %v", events[0].Rows)
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if r.attempts != 3 {
+		t.Fatalf("expected 3 attempts, got %d", r.attempts)
+	}
+}
+
+func TestNew(t *testing.T) {
+	aria, err := core.New(&core.Config{DataDir: "./test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll("./test")
+
+	for _, webhooks := range [][]*core.Webhook{
+		{},
+		{{URL: "ftp://localhost/hook"}},
+		{{URL: "http://localhost/hook", Operations: []string{"SELECT"}}},
+	} {
+		aria.Config.Webhooks = webhooks
+
+		_, err = New(aria)
+		if err == nil {
+			t.Fatalf("expected error for %v", webhooks)
+		}
+	}
+}
+
+func TestSign(t *testing.T) {
+	// echo -n '{"id":"1"}' | openssl dgst -sha256 -hmac secret
+	expected := "sha256=6146142a2ce0159e84c0767881e4ec80bc397da62526e7d19f70795eb79460c0"
+
+	if Sign("secret", []byte(`{"id":"1"}`)) != expected {
+		t.Fatalf("expected %s, got %s", expected, Sign("secret", []byte(`{"id":"1"}`)))
+	}
+}